@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Config shapes the generated event stream.
+type Config struct {
+    Orders    int
+    Customers int
+    // Orders are created between From and To; later events that would
+    // fall after To are not generated, leaving the order in progress
+    From        time.Time
+    To          time.Time
+    // CancelRatio is the share of orders cancelled, half of them in draft
+    // and half after confirmation
+    CancelRatio float64
+    // MaxItems caps the products per order, at least one of which is on
+    // the order when it is created
+    MaxItems    int
+    Seed        int64
+}
+
+type product struct {
+    ID    string
+    Price int64
+}
+
+// catalog prices are in cents, spread around the free shipping thresholds
+var catalog = []product{
+    {"sku-notebook", 499},
+    {"sku-pen-set", 1299},
+    {"sku-backpack", 4999},
+    {"sku-headphones", 8999},
+    {"sku-keyboard", 12999},
+    {"sku-monitor", 24999},
+    {"sku-desk-lamp", 3499},
+    {"sku-mug", 899},
+    {"sku-charger", 2499},
+    {"sku-webcam", 6999},
+}
+
+var addresses = []valueobjects.Address{
+    valueobjects.NewAddress("1 Market St", "San Francisco", "CA", "94105", "US"),
+    valueobjects.NewAddress("350 5th Ave", "New York", "NY", "10118", "US"),
+    valueobjects.NewAddress("100 Queen St W", "Toronto", "ON", "M5H 2N2", "CA"),
+    valueobjects.NewAddress("10 Downing St", "London", "", "SW1A 2AA", "GB"),
+    valueobjects.NewAddress("1 Chome-1-2 Oshiage", "Tokyo", "", "131-0045", "JP"),
+}
+
+// channels are weighted towards the web, as most orders are placed there
+var channels = []valueobjects.OrderChannel{
+    valueobjects.OrderChannelWeb,
+    valueobjects.OrderChannelWeb,
+    valueobjects.OrderChannelWeb,
+    valueobjects.OrderChannelMobile,
+    valueobjects.OrderChannelMobile,
+    valueobjects.OrderChannelPhone,
+}
+
+// cancellations are weighted towards customers' requests, which carry
+// what the customer said as details
+var cancellations = []struct {
+    reason  valueobjects.CancellationReason
+    details string
+}{
+    {valueobjects.CancellationReasonCustomerRequest, "changed their mind"},
+    {valueobjects.CancellationReasonCustomerRequest, "found a better price"},
+    {valueobjects.CancellationReasonCustomerRequest, "ordered by mistake"},
+    {valueobjects.CancellationReasonPaymentFailed, ""},
+    {valueobjects.CancellationReasonInventory, ""},
+    {valueobjects.CancellationReasonExpired, ""},
+    {valueobjects.CancellationReasonOther, "delivery too slow"},
+}
+
+// Generate builds cfg.Orders orders through the real aggregate and event
+// constructors, so payloads match what the management service stores. Each
+// order's events carry their sequence, and the orders' events are merged by
+// time. The same Config always yields the same stream.
+func Generate(cfg Config) ([]events.DomainEvent, error) {
+    g := &generator{
+        cfg:      cfg,
+        rng:      rand.New(rand.NewSource(cfg.Seed)),
+        shipping: entities.NewDefaultShippingCalculator(),
+    }
+    
+    var stream []events.DomainEvent
+    for i := 0; i < cfg.Orders; i++ {
+        orderEvents, err := g.order()
+        if err != nil {
+            return nil, fmt.Errorf("order %d: %w", i+1, err)
+        }
+        stream = append(stream, orderEvents...)
+    }
+    
+    // Each order's events are strictly later than the previous one, so a
+    // stable sort keeps them in sequence
+    sort.SliceStable(stream, func(i, j int) bool {
+        return stream[i].OccurredAt().Before(stream[j].OccurredAt())
+    })
+    
+    if err := checkTotals(stream); err != nil {
+        return nil, err
+    }
+    return stream, nil
+}
+
+type generator struct {
+    cfg      Config
+    rng      *rand.Rand
+    shipping entities.ShippingCalculator
+}
+
+// orderStream collects one order's events on a simulated clock.
+type orderStream struct {
+    g      *generator
+    at     time.Time
+    events []events.DomainEvent
+}
+
+func (g *generator) order() ([]events.DomainEvent, error) {
+    span := g.cfg.To.Sub(g.cfg.From)
+    s := &orderStream{g: g, at: g.cfg.From.Add(time.Duration(g.rng.Int63n(int64(span) + 1)))}
+    
+    customerID := fmt.Sprintf("customer-%04d", g.rng.Intn(g.cfg.Customers)+1)
+    order, err := entities.NewOrder(customerID, "", addresses[g.rng.Intn(len(addresses))])
+    if err != nil {
+        return nil, err
+    }
+    order.ID = entities.OrderID(g.uuid())
+    order.Channel = channels[g.rng.Intn(len(channels))]
+    order.CreatedAt, order.UpdatedAt = s.at, s.at
+    
+    picks := g.rng.Perm(len(catalog))[:g.rng.Intn(g.cfg.MaxItems)+1]
+    initial := g.rng.Intn(len(picks)) + 1
+    for _, pick := range picks[:initial] {
+        if err := order.AddItem(catalog[pick].ID, g.rng.Intn(3)+1, valueobjects.NewMoney(catalog[pick].Price, "USD")); err != nil {
+            return nil, err
+        }
+    }
+    if err := order.ApplyShipping(g.shipping); err != nil {
+        return nil, err
+    }
+    created := events.NewOrderCreatedEvent(order)
+    created.BaseDomainEvent = s.stamp(created.BaseDomainEvent)
+    s.events = append(s.events, created)
+    
+    for _, pick := range picks[initial:] {
+        if !s.advance(5*time.Minute, 2*time.Hour) {
+            return s.events, nil
+        }
+        quantity, price := g.rng.Intn(3)+1, valueobjects.NewMoney(catalog[pick].Price, "USD")
+        if err := order.AddItem(catalog[pick].ID, quantity, price); err != nil {
+            return nil, err
+        }
+        if err := order.ApplyShipping(g.shipping); err != nil {
+            return nil, err
+        }
+        added := events.NewOrderItemAddedEvent(order, catalog[pick].ID, quantity, price)
+        added.BaseDomainEvent = s.stamp(added.BaseDomainEvent)
+        s.events = append(s.events, added)
+    }
+    
+    cancel := g.rng.Float64() < g.cfg.CancelRatio
+    cancelInDraft := g.rng.Intn(2) == 0
+    
+    if cancel && cancelInDraft {
+        return s.cancel(order)
+    }
+    
+    if !s.advance(10*time.Minute, 24*time.Hour) {
+        return s.events, nil
+    }
+    if err := order.Confirm(); err != nil {
+        return nil, err
+    }
+    order.ConfirmedAt = s.at
+    confirmed := events.NewOrderConfirmedEvent(order)
+    confirmed.BaseDomainEvent = s.stamp(confirmed.BaseDomainEvent)
+    s.events = append(s.events, confirmed)
+    
+    if cancel {
+        return s.cancel(order)
+    }
+    
+    if !s.advance(6*time.Hour, 72*time.Hour) {
+        return s.events, nil
+    }
+    if err := order.Ship(); err != nil {
+        return nil, err
+    }
+    order.ShippedAt = s.at
+    shipped := events.NewOrderShippedEvent(order)
+    shipped.BaseDomainEvent = s.stamp(shipped.BaseDomainEvent)
+    s.events = append(s.events, shipped)
+    
+    if !s.advance(24*time.Hour, 5*24*time.Hour) {
+        return s.events, nil
+    }
+    if err := order.Deliver(time.Time{}, ""); err != nil {
+        return nil, err
+    }
+    order.DeliveredAt = s.at
+    delivered := events.NewOrderDeliveredEvent(order, "")
+    delivered.BaseDomainEvent = s.stamp(delivered.BaseDomainEvent)
+    s.events = append(s.events, delivered)
+    
+    return s.events, nil
+}
+
+func (s *orderStream) cancel(order *entities.Order) ([]events.DomainEvent, error) {
+    if !s.advance(10*time.Minute, 48*time.Hour) {
+        return s.events, nil
+    }
+    if err := order.Cancel(entities.CancellationPolicy{}, false); err != nil {
+        return nil, err
+    }
+    cancellation := cancellations[s.g.rng.Intn(len(cancellations))]
+    cancelled := events.NewOrderCancelledEvent(order, cancellation.reason, cancellation.details, false)
+    cancelled.BaseDomainEvent = s.stamp(cancelled.BaseDomainEvent)
+    s.events = append(s.events, cancelled)
+    return s.events, nil
+}
+
+// advance moves the clock on by a random delay between min and max. It
+// returns false if that passes the end of the generated range.
+func (s *orderStream) advance(min, max time.Duration) bool {
+    s.at = s.at.Add(min + time.Duration(s.g.rng.Int63n(int64(max-min))))
+    return !s.at.After(s.g.cfg.To)
+}
+
+// stamp replaces the identity, time and sequence the event constructors
+// take from the real clock and random source with generated ones.
+func (s *orderStream) stamp(base events.BaseDomainEvent) events.BaseDomainEvent {
+    base.EventIDValue = s.g.uuid()
+    base.OccurredAtTime = s.at
+    base.SequenceValue = len(s.events) + 1
+    return base
+}
+
+func (g *generator) uuid() string {
+    id, err := uuid.NewRandomFromReader(g.rng)
+    if err != nil {
+        // rand.Rand reads never fail
+        panic(err)
+    }
+    return id.String()
+}
+
+// checkTotals replays each order's item events and checks the totals they
+// carry add up, guarding against the generator and the aggregate drifting
+// apart.
+func checkTotals(stream []events.DomainEvent) error {
+    itemTotals := map[string]int64{}
+    for _, event := range stream {
+        switch e := event.(type) {
+        case events.OrderCreatedEvent:
+            var total int64
+            for _, item := range e.Items {
+                total += item.Price.Amount * int64(item.Quantity)
+            }
+            if total != e.TotalAmount.Amount || total+e.ShippingCost.Amount != e.GrandTotal.Amount {
+                return fmt.Errorf("order %s was created with totals that do not match its items", e.AggregateID())
+            }
+            itemTotals[e.AggregateID()] = total
+        case events.OrderItemAddedEvent:
+            itemTotals[e.AggregateID()] += e.Price.Amount * int64(e.Quantity)
+            if itemTotals[e.AggregateID()]+e.ShippingCost.Amount != e.GrandTotal.Amount {
+                return fmt.Errorf("order %s has a grand total that does not match its items after adding %s", e.AggregateID(), e.ProductID)
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+func testConfig() Config {
+    return Config{
+        Orders:      50,
+        Customers:   5,
+        From:        time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+        To:          time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+        CancelRatio: 0.3,
+        MaxItems:    4,
+        Seed:        42,
+    }
+}
+
+func generate(t *testing.T, cfg Config) []events.DomainEvent {
+    t.Helper()
+    stream, err := Generate(cfg)
+    if err != nil {
+        t.Fatalf("Generate() = %v", err)
+    }
+    return stream
+}
+
+// The stream is time ordered, each order's events run in sequence from its
+// creation within the range, and every total matches the items so far.
+func TestGenerate_consistent(t *testing.T) {
+    cfg := testConfig()
+    stream := generate(t, cfg)
+    
+    type orderState struct {
+        sequence int
+        items    int64
+        last     string
+    }
+    orders := map[string]*orderState{}
+    // next lists the event types that may follow each one
+    next := map[string][]string{
+        "OrderCreated":   {"OrderItemAdded", "OrderConfirmed", "OrderCancelled"},
+        "OrderItemAdded": {"OrderItemAdded", "OrderConfirmed", "OrderCancelled"},
+        "OrderConfirmed": {"OrderShipped", "OrderCancelled"},
+        "OrderShipped":   {"OrderDelivered"},
+    }
+    
+    var previous time.Time
+    for _, event := range stream {
+        if event.OccurredAt().Before(previous) {
+            t.Fatalf("%s of %s at %v is before the previous event at %v", event.Type(), event.AggregateID(), event.OccurredAt(), previous)
+        }
+        previous = event.OccurredAt()
+        if event.OccurredAt().Before(cfg.From) || event.OccurredAt().After(cfg.To) {
+            t.Errorf("%s of %s at %v is outside the range", event.Type(), event.AggregateID(), event.OccurredAt())
+        }
+        
+        state, seen := orders[event.AggregateID()]
+        switch e := event.(type) {
+        case events.OrderCreatedEvent:
+            if seen {
+                t.Fatalf("order %s created twice", e.AggregateID())
+            }
+            state = &orderState{}
+            orders[e.AggregateID()] = state
+            for _, item := range e.Items {
+                state.items += item.Price.Amount * int64(item.Quantity)
+            }
+            if len(e.Items) == 0 || e.TotalAmount.Amount != state.items || e.GrandTotal.Amount != state.items+e.ShippingCost.Amount {
+                t.Errorf("order %s created with %d items totalling %d, total %d, shipping %d, grand total %d",
+                    e.AggregateID(), len(e.Items), state.items, e.TotalAmount.Amount, e.ShippingCost.Amount, e.GrandTotal.Amount)
+            }
+        case events.OrderItemAddedEvent:
+            if !seen {
+                t.Fatalf("item added to order %s before it was created", e.AggregateID())
+            }
+            state.items += e.Price.Amount * int64(e.Quantity)
+            if e.GrandTotal.Amount != state.items+e.ShippingCost.Amount {
+                t.Errorf("order %s grand total %d after adding %s, want items %d plus shipping %d",
+                    e.AggregateID(), e.GrandTotal.Amount, e.ProductID, state.items, e.ShippingCost.Amount)
+            }
+        default:
+            if !seen {
+                t.Fatalf("%s of order %s before it was created", e.Type(), e.AggregateID())
+            }
+        }
+        
+        if state.last != "" {
+            allowed := false
+            for _, eventType := range next[state.last] {
+                allowed = allowed || eventType == event.Type()
+            }
+            if !allowed {
+                t.Errorf("order %s has %s after %s", event.AggregateID(), event.Type(), state.last)
+            }
+        }
+        state.sequence++
+        if event.Sequence() != state.sequence {
+            t.Errorf("%s of order %s has sequence %d, want %d", event.Type(), event.AggregateID(), event.Sequence(), state.sequence)
+        }
+        state.last = event.Type()
+    }
+    
+    if len(orders) != cfg.Orders {
+        t.Errorf("generated %d orders, want %d", len(orders), cfg.Orders)
+    }
+}
+
+// The same seed reproduces the stream, ids included; another seed does not.
+func TestGenerate_deterministic(t *testing.T) {
+    encode := func(cfg Config) string {
+        data, err := json.Marshal(generate(t, cfg))
+        if err != nil {
+            t.Fatalf("json.Marshal() = %v", err)
+        }
+        return string(data)
+    }
+    
+    cfg := testConfig()
+    first := encode(cfg)
+    if again := encode(cfg); again != first {
+        t.Error("Generate() with the same seed generated different events")
+    }
+    cfg.Seed++
+    if other := encode(cfg); other == first {
+        t.Error("Generate() with another seed generated the same events")
+    }
+}
+
+func TestGenerate_cancelRatio(t *testing.T) {
+    tests := []struct {
+        ratio         float64
+        wantCancelled bool
+        wantShipped   bool
+    }{
+        {ratio: 0, wantShipped: true},
+        {ratio: 1, wantCancelled: true},
+    }
+    
+    for _, tt := range tests {
+        cfg := testConfig()
+        cfg.CancelRatio = tt.ratio
+        counts := map[string]int{}
+        for _, event := range generate(t, cfg) {
+            counts[event.Type()]++
+        }
+        if got := counts["OrderCancelled"] > 0; got != tt.wantCancelled {
+            t.Errorf("ratio %v: %d orders cancelled", tt.ratio, counts["OrderCancelled"])
+        }
+        if got := counts["OrderShipped"] > 0; got != tt.wantShipped {
+            t.Errorf("ratio %v: %d orders shipped", tt.ratio, counts["OrderShipped"])
+        }
+    }
+}
+
+// checkTotals catches an item event whose grand total does not add up.
+func TestCheckTotals(t *testing.T) {
+    stream := generate(t, testConfig())
+    if err := checkTotals(stream); err != nil {
+        t.Fatalf("checkTotals() of a generated stream = %v", err)
+    }
+    
+    tampered := make([]events.DomainEvent, len(stream))
+    copy(tampered, stream)
+    for i, event := range tampered {
+        if added, ok := event.(events.OrderItemAddedEvent); ok {
+            added.GrandTotal.Amount++
+            tampered[i] = added
+            break
+        }
+    }
+    if reflect.DeepEqual(tampered, stream) {
+        t.Fatal("generated stream has no item added to tamper with")
+    }
+    if err := checkTotals(tampered); err == nil {
+        t.Error("checkTotals() of a tampered stream = nil, want an error")
+    }
+}
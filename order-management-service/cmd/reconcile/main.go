@@ -0,0 +1,81 @@
+// Command reconcile compares the orders stored by the management service
+// with the orders projected by the reporting service, through their
+// /admin/reconcile endpoints. It reports the order counts of each side by
+// status, their divergence and, when the counts differ, a sample of the
+// order ids found on one side only.
+//
+// Both services are called with the admin key in ADMIN_API_KEY. The command
+// exits with status 1 when the divergence exceeds -threshold, so it can run
+// as a scheduled check.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/reconcile"
+)
+
+func main() {
+    writeURL := flag.String("write-url", "http://localhost:8080", "base URL of the order management service")
+    readURL := flag.String("read-url", "http://localhost:8081", "base URL of the order reporting service")
+    threshold := flag.Int64("threshold", 0, "divergence tolerated before failing")
+    sample := flag.Int("sample", 20, "order ids to list as missing on each side; 0 skips the id scan")
+    pageSize := flag.Int("page-size", 500, "order ids to read from each side at once")
+    timeout := flag.Duration("timeout", 5*time.Minute, "give up after this long")
+    outPath := flag.String("out", "", "write the JSON report to this file instead of stdout")
+    flag.Parse()
+    
+    if *pageSize < 1 || *pageSize > reconcile.MaxIDsLimit {
+        log.Fatalf("-page-size must be between 1 and %d", reconcile.MaxIDsLimit)
+    }
+    
+    ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+    defer cancel()
+    
+    adminKey := os.Getenv("ADMIN_API_KEY")
+    write, err := reconcile.NewClient(apiclient.Config{BaseURL: *writeURL, APIKey: adminKey})
+    if err != nil {
+        log.Fatalf("Invalid -write-url: %v", err)
+    }
+    read, err := reconcile.NewClient(apiclient.Config{BaseURL: *readURL, APIKey: adminKey})
+    if err != nil {
+        log.Fatalf("Invalid -read-url: %v", err)
+    }
+    
+    report, err := reconcile.Compare(ctx, write, read, reconcile.Options{
+        Threshold:  *threshold,
+        SampleSize: *sample,
+        PageSize:   *pageSize,
+    })
+    if err != nil {
+        log.Fatalf("Failed to reconcile: %v", err)
+    }
+    
+    out := os.Stdout
+    if *outPath != "" {
+        out, err = os.Create(*outPath)
+        if err != nil {
+            log.Fatalf("Failed to create report file: %v", err)
+        }
+    }
+    
+    encoder := json.NewEncoder(out)
+    encoder.SetIndent("", "  ")
+    if err := encoder.Encode(report); err != nil {
+        log.Fatalf("Failed to write report: %v", err)
+    }
+    if err := out.Close(); err != nil {
+        log.Fatalf("Failed to write report: %v", err)
+    }
+    
+    if report.Diverged {
+        log.Printf("Divergence %d exceeds threshold %d", report.Divergence, report.Threshold)
+        os.Exit(1)
+    }
+}
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
-	"github.com/gorilla/mux"
 	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
 )
 
 type CancelOrderHandler struct {
@@ -13,12 +15,17 @@ type CancelOrderHandler struct {
 }
 
 type CancelOrderRequest struct {
-    Reason string `json:"reason"`
+    Reason          string `json:"reason"`
+    Details         string `json:"details"`
+    Force           bool   `json:"force"`
+    ExpectedVersion *int   `json:"expected_version"`
 }
 
 func (h *CancelOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    orderID := entities.OrderID(vars["id"])
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
     
     var req CancelOrderRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -26,7 +33,30 @@ func (h *CancelOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request)
         return
     }
     
-    if err := h.Service.CancelOrder(r.Context(), orderID, req.Reason); err != nil {
+    // Forcing past the cancellation window is reserved for administrators
+    if req.Force && !httpmw.IsAdmin(r.Context()) {
+        http.Error(w, "force requires the admin key", http.StatusForbidden)
+        return
+    }
+    
+    ctx, ok := commandContext(w, r, req.ExpectedVersion)
+    if !ok {
+        return
+    }
+    
+    cmd := CancelOrderCommand{OrderID: string(orderID), Reason: req.Reason, Details: strings.TrimSpace(req.Details), Force: req.Force}
+    if err := h.Service.CancelOrder(ctx, cmd); err != nil {
+        if writeVersionError(w, r, err) {
+            return
+        }
+        if errors.Is(err, entities.ErrOrderAlreadyCancelled) {
+            http.Error(w, err.Error(), http.StatusConflict)
+            return
+        }
+        if errors.Is(err, entities.ErrCancellationWindowClosed) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
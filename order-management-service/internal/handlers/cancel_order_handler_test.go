@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// A cancellation needs one of the reason codes, with optional details that
+// are trimmed and carried on the OrderCancelled event; anything else is
+// refused before the order changes.
+func TestCancelOrderHandler_reasons(t *testing.T) {
+    f := newCommandFixture()
+    tests := []struct {
+        name        string
+        body        string
+        wantCode    int
+        wantReason  valueobjects.CancellationReason
+        wantDetails string
+    }{
+        {name: "code", body: `{"reason": "payment_failed"}`, wantCode: http.StatusOK, wantReason: valueobjects.CancellationReasonPaymentFailed},
+        {
+            name:        "code with details",
+            body:        `{"reason": "customer_request", "details": " found a better price "}`,
+            wantCode:    http.StatusOK,
+            wantReason:  valueobjects.CancellationReasonCustomerRequest,
+            wantDetails: "found a better price",
+        },
+        {name: "free text", body: `{"reason": "customer changed their mind"}`, wantCode: http.StatusBadRequest},
+        {name: "code in capitals", body: `{"reason": "FRAUD"}`, wantCode: http.StatusBadRequest},
+        {name: "no reason", body: `{"details": "no longer needed"}`, wantCode: http.StatusBadRequest},
+        {
+            name:     "details too long",
+            body:     `{"reason": "other", "details": "` + strings.Repeat("x", maxCancellationDetailsLength+1) + `"}`,
+            wantCode: http.StatusBadRequest,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            id := f.createOrder(t, uuid.NewString())
+            
+            r := httptest.NewRequest(http.MethodPost, "/orders/"+string(id)+"/cancel", strings.NewReader(tt.body))
+            r = mux.SetURLVars(r, map[string]string{"id": string(id)})
+            w := httptest.NewRecorder()
+            (&CancelOrderHandler{Service: f.service}).HandleHTTP(w, r)
+            if w.Code != tt.wantCode {
+                t.Fatalf("POST cancel = %d %q, want %d", w.Code, w.Body, tt.wantCode)
+            }
+            
+            if tt.wantCode != http.StatusOK {
+                if got := f.eventTypes(t, id, 1); len(got) != 0 || f.savedStatus(t, id) != "draft" {
+                    t.Errorf("refused cancellation stored %v and left the order %s, want nothing and draft", got, f.savedStatus(t, id))
+                }
+                return
+            }
+            stored, err := f.store.GetEvents(ctx, string(id))
+            if err != nil {
+                t.Fatalf("GetEvents() = %v", err)
+            }
+            cancelled, ok := stored[len(stored)-1].(events.OrderCancelledEvent)
+            if !ok {
+                t.Fatalf("last event = %T, want OrderCancelledEvent", stored[len(stored)-1])
+            }
+            if cancelled.Reason != tt.wantReason || cancelled.Details != tt.wantDetails {
+                t.Errorf("OrderCancelled reason, details = %q, %q, want %q, %q", cancelled.Reason, cancelled.Details, tt.wantReason, tt.wantDetails)
+            }
+        })
+    }
+}
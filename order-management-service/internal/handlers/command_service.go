@@ -2,20 +2,120 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/vdntruong/dddcqrs/order-management-service/internal/repositories"
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
 	"github.com/vdntruong/dddcqrs/shared/domain/entities"
 	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
 	"github.com/vdntruong/dddcqrs/shared/domain/events"
 	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/featureflags"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
 )
 
+// ErrUnknownAddress is returned by CreateOrder when the order names a saved
+// address the customer does not have, or relies on a default they have not
+// set.
+var ErrUnknownAddress = errors.New("unknown address")
+
+// ErrEventTooLarge is matched by the errors returned for changes recording
+// an event over the outbox's or the event store's size limit, as an order
+// with a huge item list does. Nothing is saved for such a change.
+var ErrEventTooLarge = events.ErrEventTooLarge
+
 type CommandService struct {
     OrderRepo  repositories.OrderRepository
     EventStore repositories.EventStore
-    Outbox     repositories.OutboxRepository
+    Outbox     outbox.Repository
+    // UnitOfWork saves each change to an order with its events and their
+    // outbox entries
+    UnitOfWork repositories.UnitOfWork
     EventBus   eventbus.EventBus
+    Shipping   entities.ShippingCalculator
+    
+    // Limits caps the size of orders; the zero value is unlimited
+    Limits entities.OrderLimits
+    // Restrictions lists the countries orders may not ship to; nil allows
+    // every country
+    Restrictions entities.ShippingRestrictions
+    // Cancellation limits when confirmed orders may be cancelled
+    Cancellation entities.CancellationPolicy
+    
+    // Customers checks that orders reference known customers, as
+    // configured by CustomerVerification
+    Customers            repositories.CustomerVerifier
+    CustomerVerification CustomerVerificationMode
+    // Addresses resolves orders placed with a saved address
+    Addresses            repositories.CustomerAddressBook
+    // OrderNumbers gives new orders their human-readable numbers; nil
+    // leaves them unnumbered
+    OrderNumbers         repositories.OrderNumberGenerator
+    // CustomerMerges records the customers merged into another, which
+    // take no new orders; nil disables MergeCustomers
+    CustomerMerges       repositories.CustomerMerges
+    
+    // RateLimit caps the orders each customer may create in a window; the
+    // zero value is unlimited
+    RateLimit  OrderRateLimit
+    // FraudCheck may refuse orders before they are created; nil allows all
+    FraudCheck FraudCheck
+    
+    // Prices checks the price of new items while PriceVerification is
+    // set; nil checks none
+    Prices            PriceCatalog
+    PriceVerification bool
+    
+    // SyncProjection applies each recorded event to the read models before
+    // the command returns; nil leaves them to the event consumer alone
+    SyncProjection eventbus.Handler
+    
+    // StrictConcurrency refuses commands on existing orders that do not
+    // say which version they expect, with WithExpectedVersion
+    StrictConcurrency bool
+    
+    // Flags, when set, switch StrictConcurrency, PriceVerification and
+    // SyncProjection while the service runs: their flags replace
+    // StrictConcurrency and PriceVerification, and turn a configured
+    // SyncProjection off and on
+    Flags *featureflags.Flags
+    
+    // Clock tells the time commands check against, such as the as-of
+    // limit; nil uses clock.Default
+    Clock clock.Clock
+    
+    // locks serializes the commands on each order
+    locks orderLocks
+    // merges serializes MergeCustomers
+    merges sync.Mutex
+}
+
+// shipping returns the configured shipping calculator, or the default rate
+// table when none is set.
+func (cs *CommandService) shipping() entities.ShippingCalculator {
+    if cs.Shipping == nil {
+        return entities.NewDefaultShippingCalculator()
+    }
+    return cs.Shipping
+}
+
+// now tells the time by the configured clock, or clock.Default.
+func (cs *CommandService) now() time.Time {
+    return clock.OrDefault(cs.Clock).Now()
+}
+
+// strictConcurrency reports whether commands must say which version they
+// expect, by the StrictConcurrency flag when there are flags.
+func (cs *CommandService) strictConcurrency() bool {
+    if cs.Flags != nil {
+        return cs.Flags.Enabled(featureflags.StrictConcurrency)
+    }
+    return cs.StrictConcurrency
 }
 
 func (cs *CommandService) CreateOrder(ctx context.Context, cmd CreateOrderCommand) (*entities.Order, error) {
@@ -23,41 +123,117 @@ func (cs *CommandService) CreateOrder(ctx context.Context, cmd CreateOrderComman
     if err := cmd.Validate(); err != nil {
         return nil, fmt.Errorf("invalid command: %w", err)
     }
+    if err := cmd.CheckLimits(cs.Limits); err != nil {
+        return nil, err
+    }
+    
+    // Guest checkouts have no customer to verify
+    if cmd.CustomerID != "" {
+        if err := cs.checkNotMerged(ctx, cmd.CustomerID); err != nil {
+            return nil, err
+        }
+        if err := cs.verifyCustomer(ctx, cmd.CustomerID); err != nil {
+            return nil, err
+        }
+    }
+    
+    if err := cs.admitOrder(ctx, cmd); err != nil {
+        return nil, err
+    }
+    
+    shippingAddress, err := cs.shippingAddress(ctx, cmd)
+    if err != nil {
+        return nil, err
+    }
+    // Checked on the resolved address, so saved addresses are covered too
+    if err := entities.CheckShippingCountry(cs.Restrictions, shippingAddress); err != nil {
+        auditRestrictedCountry(ctx, cmd.CustomerID, "", shippingAddress.Country, err)
+        return nil, err
+    }
+    
+    // Validate has already accepted the channel and contact email
+    channel, _ := valueobjects.ParseOrderChannel(cmd.Channel)
+    var contactEmail valueobjects.Email
+    if cmd.ContactEmail != "" {
+        contactEmail, _ = valueobjects.ParseEmail(cmd.ContactEmail)
+    }
     
     // Create order aggregate
-    order := entities.NewOrder(cmd.CustomerID, cmd.ShippingAddress)
+    order, err := entities.NewOrder(cmd.CustomerID, contactEmail, shippingAddress)
+    if err != nil {
+        return nil, fmt.Errorf("invalid command: %w", err)
+    }
+    order.Channel = channel
+    order.SetLimits(cs.Limits)
+    order.SetShippingRestrictions(cs.Restrictions)
     
     // Add items
     for _, item := range cmd.Items {
+        if err := cs.verifyPrice(ctx, item.ProductID, item.Price); err != nil {
+            return nil, err
+        }
         if err := order.AddItem(item.ProductID, item.Quantity, item.Price); err != nil {
             return nil, fmt.Errorf("failed to add item: %w", err)
         }
     }
     
-    // Save aggregate to database
-    if err := cs.OrderRepo.Save(ctx, order); err != nil {
-        return nil, fmt.Errorf("failed to save order: %w", err)
+    if err := order.ApplyShipping(cs.shipping()); err != nil {
+        return nil, err
     }
     
-    // Create domain event
-    event := events.NewOrderCreatedEvent(order)
-    
-    // Save event to event store
-    if err := cs.EventStore.SaveEvents(ctx, string(order.ID), []events.DomainEvent{event}, 0); err != nil {
-        return nil, fmt.Errorf("failed to save event: %w", err)
+    // A number another order already has is refused by the orders table,
+    // and the order is saved again with a new one
+    for attempt := 1; ; attempt++ {
+        if err := cs.numberOrder(ctx, order); err != nil {
+            return nil, err
+        }
+        
+        // Create domain event
+        event := events.NewOrderCreatedEvent(order)
+        
+        // Reject orders whose event could never be published before saving
+        // anything
+        if err := cs.Outbox.CheckEvent(event); err != nil {
+            return nil, err
+        }
+        
+        err := cs.commit(ctx, order, event)
+        if errors.Is(err, repositories.ErrOrderNumberTaken) && attempt < maxOrderNumberAttempts {
+            log.Printf("Order number %s is taken, retrying with another", order.Number)
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+        return order, nil
     }
-    
-    // Save event to outbox for reliable publishing
-    if err := cs.Outbox.SaveEvent(ctx, event); err != nil {
-        return nil, fmt.Errorf("failed to save event to outbox: %w", err)
+}
+
+// maxOrderNumberAttempts bounds the numbers CreateOrder tries for an order.
+const maxOrderNumberAttempts = 5
+
+// numberOrder gives order a new number from the configured generator.
+func (cs *CommandService) numberOrder(ctx context.Context, order *entities.Order) error {
+    if cs.OrderNumbers == nil {
+        return nil
     }
-    
-    return order, nil
+    number, err := cs.OrderNumbers.NextOrderNumber(ctx, order.CreatedAt)
+    if err != nil {
+        return err
+    }
+    order.Number = number
+    return nil
 }
 
 func (cs *CommandService) ConfirmOrder(ctx context.Context, orderID entities.OrderID) error {
+    unlock, err := cs.locks.lock(ctx, orderID)
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
     // Load order
-    order, err := cs.OrderRepo.FindByID(ctx, orderID)
+    order, err := cs.loadOrder(ctx, orderID)
     if err != nil {
         return fmt.Errorf("failed to find order: %w", err)
     }
@@ -67,81 +243,203 @@ func (cs *CommandService) ConfirmOrder(ctx context.Context, orderID entities.Ord
         return fmt.Errorf("failed to confirm order: %w", err)
     }
     
-    // Save updated order
-    if err := cs.OrderRepo.Update(ctx, order); err != nil {
-        return fmt.Errorf("failed to update order: %w", err)
+    return cs.commit(ctx, order, events.NewOrderConfirmedEvent(order))
+}
+
+// ShipOrder ships a confirmed order. It returns an error matching
+// entities.ErrOrderOnHold for an order on hold, which ReleaseOrder must
+// release first.
+func (cs *CommandService) ShipOrder(ctx context.Context, cmd ShipOrderCommand) error {
+    if err := cmd.Validate(); err != nil {
+        return fmt.Errorf("invalid command: %w", err)
+    }
+    
+    unlock, err := cs.locks.lock(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return err
     }
+    defer unlock()
     
-    // Create domain event
-    event := events.NewOrderConfirmedEvent(order)
+    // Load order
+    order, err := cs.loadOrder(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return fmt.Errorf("failed to find order: %w", err)
+    }
     
-    // Save event to outbox
-    if err := cs.Outbox.SaveEvent(ctx, event); err != nil {
-        return fmt.Errorf("failed to save event to outbox: %w", err)
+    // Ship order
+    if err := order.Ship(); err != nil {
+        return fmt.Errorf("failed to ship order: %w", err)
     }
     
-    return nil
+    return cs.commit(ctx, order, events.NewOrderShippedEvent(order))
 }
 
-func (cs *CommandService) CancelOrder(ctx context.Context, orderID entities.OrderID, reason string) error {
+// DeliverOrder confirms the delivery of a shipped order with the details in
+// cmd.
+func (cs *CommandService) DeliverOrder(ctx context.Context, cmd DeliverOrderCommand) error {
+    if err := cmd.Validate(); err != nil {
+        return fmt.Errorf("invalid command: %w", err)
+    }
+    
+    unlock, err := cs.locks.lock(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
     // Load order
-    order, err := cs.OrderRepo.FindByID(ctx, orderID)
+    order, err := cs.loadOrder(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return fmt.Errorf("failed to find order: %w", err)
+    }
+    
+    // Deliver order
+    if err := order.Deliver(cmd.DeliveredAt, cmd.SignedBy); err != nil {
+        return fmt.Errorf("failed to deliver order: %w", err)
+    }
+    
+    return cs.commit(ctx, order, events.NewOrderDeliveredEvent(order, strings.TrimSpace(cmd.CarrierReference)))
+}
+
+// CancelOrder cancels an order. cmd.Force overrides the cancellation
+// window; callers must only set it for administrators.
+func (cs *CommandService) CancelOrder(ctx context.Context, cmd CancelOrderCommand) error {
+    if err := cmd.Validate(); err != nil {
+        return fmt.Errorf("invalid command: %w", err)
+    }
+    
+    unlock, err := cs.locks.lock(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
+    // Load order
+    order, err := cs.loadOrder(ctx, entities.OrderID(cmd.OrderID))
     if err != nil {
         return fmt.Errorf("failed to find order: %w", err)
     }
     
     // Cancel order
-    if err := order.Cancel(); err != nil {
+    if err := order.Cancel(cs.Cancellation, cmd.Force); err != nil {
         return fmt.Errorf("failed to cancel order: %w", err)
     }
     
-    // Save updated order
-    if err := cs.OrderRepo.Update(ctx, order); err != nil {
-        return fmt.Errorf("failed to update order: %w", err)
+    return cs.commit(ctx, order, events.NewOrderCancelledEvent(order, valueobjects.CancellationReason(cmd.Reason), cmd.Details, cmd.Force))
+}
+
+func (cs *CommandService) ReopenOrder(ctx context.Context, orderID entities.OrderID) error {
+    unlock, err := cs.locks.lock(ctx, orderID)
+    if err != nil {
+        return err
     }
+    defer unlock()
     
-    // Create domain event
-    event := events.NewOrderCancelledEvent(order, reason)
+    // Load order
+    order, err := cs.loadOrder(ctx, orderID)
+    if err != nil {
+        return fmt.Errorf("failed to find order: %w", err)
+    }
     
-    // Save event to outbox
-    if err := cs.Outbox.SaveEvent(ctx, event); err != nil {
-        return fmt.Errorf("failed to save event to outbox: %w", err)
+    // Reopen order
+    if err := order.Reopen(); err != nil {
+        return fmt.Errorf("failed to reopen order: %w", err)
     }
     
-    return nil
+    return cs.commit(ctx, order, events.NewOrderReopenedEvent(order))
+}
+
+// HoldOrder puts a confirmed order on hold for review; it cannot be shipped
+// until ReleaseOrder releases it.
+func (cs *CommandService) HoldOrder(ctx context.Context, cmd HoldOrderCommand) error {
+    if err := cmd.Validate(); err != nil {
+        return fmt.Errorf("invalid command: %w", err)
+    }
+    
+    unlock, err := cs.locks.lock(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
+    // Load order
+    order, err := cs.loadOrder(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return fmt.Errorf("failed to find order: %w", err)
+    }
+    
+    // Hold order
+    if err := order.Hold(cmd.Reason); err != nil {
+        return fmt.Errorf("failed to hold order: %w", err)
+    }
+    
+    return cs.commit(ctx, order, events.NewOrderHeldEvent(order))
+}
+
+// ReleaseOrder returns an order on hold to confirmed.
+func (cs *CommandService) ReleaseOrder(ctx context.Context, cmd ReleaseOrderCommand) error {
+    if err := cmd.Validate(); err != nil {
+        return fmt.Errorf("invalid command: %w", err)
+    }
+    
+    unlock, err := cs.locks.lock(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
+    // Load order
+    order, err := cs.loadOrder(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return fmt.Errorf("failed to find order: %w", err)
+    }
+    
+    // Release order
+    holdReason := order.HoldReason
+    if err := order.Release(); err != nil {
+        return fmt.Errorf("failed to release order: %w", err)
+    }
+    
+    return cs.commit(ctx, order, events.NewOrderReleasedEvent(order, holdReason, strings.TrimSpace(cmd.Reason)))
 }
 
 func (cs *CommandService) AddOrderItem(ctx context.Context, orderID entities.OrderID, productID string, quantity int, price valueobjects.Money) error {
+    unlock, err := cs.locks.lock(ctx, orderID)
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
     // Load order
-    order, err := cs.OrderRepo.FindByID(ctx, orderID)
+    order, err := cs.loadOrder(ctx, orderID)
     if err != nil {
         return fmt.Errorf("failed to find order: %w", err)
     }
     
     // Add item
+    if err := cs.verifyPrice(ctx, productID, price); err != nil {
+        return err
+    }
     if err := order.AddItem(productID, quantity, price); err != nil {
         return fmt.Errorf("failed to add item: %w", err)
     }
     
-    // Save updated order
-    if err := cs.OrderRepo.Update(ctx, order); err != nil {
-        return fmt.Errorf("failed to update order: %w", err)
-    }
-    
-    // Create domain event
-    event := events.NewOrderItemAddedEvent(order, productID, quantity, price)
-    
-    // Save event to outbox
-    if err := cs.Outbox.SaveEvent(ctx, event); err != nil {
-        return fmt.Errorf("failed to save event to outbox: %w", err)
+    if err := order.ApplyShipping(cs.shipping()); err != nil {
+        return err
     }
     
-    return nil
+    return cs.commit(ctx, order, events.NewOrderItemAddedEvent(order, productID, quantity, price))
 }
 
 func (cs *CommandService) RemoveOrderItem(ctx context.Context, orderID entities.OrderID, productID string) error {
+    unlock, err := cs.locks.lock(ctx, orderID)
+    if err != nil {
+        return err
+    }
+    defer unlock()
+    
     // Load order
-    order, err := cs.OrderRepo.FindByID(ctx, orderID)
+    order, err := cs.loadOrder(ctx, orderID)
     if err != nil {
         return fmt.Errorf("failed to find order: %w", err)
     }
@@ -151,18 +449,245 @@ func (cs *CommandService) RemoveOrderItem(ctx context.Context, orderID entities.
         return fmt.Errorf("failed to remove item: %w", err)
     }
     
-    // Save updated order
-    if err := cs.OrderRepo.Update(ctx, order); err != nil {
-        return fmt.Errorf("failed to update order: %w", err)
+    if err := order.ApplyShipping(cs.shipping()); err != nil {
+        return err
+    }
+    
+    return cs.commit(ctx, order, events.NewOrderItemRemovedEvent(order, productID))
+}
+
+// PatchOrder applies a merge patch to a draft order, recording each change
+// as its own event: a new shipping address first, so item changes are priced
+// for it, then item removals, quantity changes and additions, so no item
+// list along the way is larger than the final one. The events are committed
+// together, after every change was accepted; a patch that changes nothing
+// records none. It returns the events recorded.
+func (cs *CommandService) PatchOrder(ctx context.Context, cmd PatchOrderCommand) ([]events.DomainEvent, error) {
+    if err := cmd.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid command: %w", err)
+    }
+    
+    unlock, err := cs.locks.lock(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return nil, err
+    }
+    defer unlock()
+    
+    // Load order
+    order, err := cs.loadOrder(ctx, entities.OrderID(cmd.OrderID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to find order: %w", err)
+    }
+    
+    var changes []events.DomainEvent
+    
+    if address := cmd.patchAddress(order.ShippingAddress); address != order.ShippingAddress {
+        if err := order.ChangeShippingAddress(address); err != nil {
+            auditRestrictedCountry(ctx, order.CustomerID, string(order.ID), address.Country, err)
+            return nil, fmt.Errorf("failed to change shipping address: %w", err)
+        }
+        if err := order.ApplyShipping(cs.shipping()); err != nil {
+            return nil, err
+        }
+        changes = append(changes, events.NewOrderShippingAddressChangedEvent(order))
+    }
+    
+    if cmd.Items != nil {
+        itemChanges, err := cs.patchItems(ctx, order, *cmd.Items)
+        if err != nil {
+            return nil, err
+        }
+        changes = append(changes, itemChanges...)
+    }
+    
+    if len(changes) == 0 {
+        return nil, nil
     }
     
-    // Create domain event
-    event := events.NewOrderItemRemovedEvent(order, productID)
+    if err := cs.commit(ctx, order, changes...); err != nil {
+        return nil, err
+    }
+    return changes, nil
+}
+
+// UpdateOrder replaces the items and shipping address of a draft order. The
+// change is recorded as the granular events PatchOrder records for a patch
+// giving every item and address field.
+func (cs *CommandService) UpdateOrder(ctx context.Context, cmd UpdateOrderCommand) error {
+    if err := cmd.Validate(); err != nil {
+        return fmt.Errorf("invalid command: %w", err)
+    }
+    if err := cmd.CheckLimits(cs.Limits); err != nil {
+        return err
+    }
     
-    // Save event to outbox
-    if err := cs.Outbox.SaveEvent(ctx, event); err != nil {
-        return fmt.Errorf("failed to save event to outbox: %w", err)
+    address := cmd.ShippingAddress
+    items := make([]OrderItemPatch, len(cmd.Items))
+    for i, item := range cmd.Items {
+        price := item.Price
+        items[i] = OrderItemPatch{ProductID: item.ProductID, Quantity: item.Quantity, Price: &price}
+    }
+    
+    _, err := cs.PatchOrder(ctx, PatchOrderCommand{
+        OrderID: cmd.OrderID,
+        Items:   &items,
+        ShippingAddress: map[string]*string{
+            "street":  &address.Street,
+            "city":    &address.City,
+            "state":   &address.State,
+            "zip":     &address.Zip,
+            "country": &address.Country,
+        },
+    })
+    return err
+}
+
+// patchItems turns order's items into the patched list, returning an event
+// for each change. Products on the order more than once keep only their
+// last line, so each ends up on a single line as in the patch.
+func (cs *CommandService) patchItems(ctx context.Context, order *entities.Order, patched []OrderItemPatch) ([]events.DomainEvent, error) {
+    wanted := make(map[string]bool, len(patched))
+    for _, item := range patched {
+        wanted[item.ProductID] = true
+    }
+    
+    var changes []events.DomainEvent
+    
+    // Removals; RemoveItem drops the first line of a product, which is the
+    // one reached here
+    lines := make(map[string]int, len(order.Items))
+    for _, item := range order.Items {
+        lines[item.ProductID]++
+    }
+    for _, item := range append([]entities.OrderItem{}, order.Items...) {
+        if wanted[item.ProductID] && lines[item.ProductID] == 1 {
+            continue
+        }
+        lines[item.ProductID]--
+        
+        if err := order.RemoveItem(item.ProductID); err != nil {
+            return nil, fmt.Errorf("failed to remove item: %w", err)
+        }
+        if err := order.ApplyShipping(cs.shipping()); err != nil {
+            return nil, err
+        }
+        changes = append(changes, events.NewOrderItemRemovedEvent(order, item.ProductID))
+    }
+    
+    // Quantity changes of the products kept
+    for _, item := range patched {
+        existing, ok := orderItem(order, item.ProductID)
+        if !ok {
+            continue
+        }
+        if item.Price != nil && *item.Price != existing.Price {
+            return nil, fmt.Errorf("failed to change item %s: %w", item.ProductID, entities.ErrItemPriceImmutable)
+        }
+        if item.Quantity == existing.Quantity {
+            continue
+        }
+        
+        if err := order.ChangeItemQuantity(item.ProductID, item.Quantity); err != nil {
+            return nil, fmt.Errorf("failed to change item quantity: %w", err)
+        }
+        if err := order.ApplyShipping(cs.shipping()); err != nil {
+            return nil, err
+        }
+        changes = append(changes, events.NewOrderItemQuantityChangedEvent(order, item.ProductID, item.Quantity))
+    }
+    
+    // Additions, in the patch's order
+    for _, item := range patched {
+        if _, ok := orderItem(order, item.ProductID); ok {
+            continue
+        }
+        if item.Price == nil {
+            return nil, fmt.Errorf("invalid command: price is required for new item %s", item.ProductID)
+        }
+        if err := cs.verifyPrice(ctx, item.ProductID, *item.Price); err != nil {
+            return nil, err
+        }
+        
+        if err := order.AddItem(item.ProductID, item.Quantity, *item.Price); err != nil {
+            return nil, fmt.Errorf("failed to add item: %w", err)
+        }
+        if err := order.ApplyShipping(cs.shipping()); err != nil {
+            return nil, err
+        }
+        changes = append(changes, events.NewOrderItemAddedEvent(order, item.ProductID, item.Quantity, *item.Price))
+    }
+    
+    return changes, nil
+}
+
+// orderItem returns the first line of a product on order.
+func orderItem(order *entities.Order, productID string) (entities.OrderItem, bool) {
+    for _, item := range order.Items {
+        if item.ProductID == productID {
+            return item, true
+        }
+    }
+    return entities.OrderItem{}, false
+}
+
+// shippingAddress returns the address an order ships to. Saved addresses
+// are copied, so later edits to them do not change the order.
+func (cs *CommandService) shippingAddress(ctx context.Context, cmd CreateOrderCommand) (valueobjects.Address, error) {
+    if cmd.ShippingAddress != (valueobjects.Address{}) {
+        return cmd.ShippingAddress, nil
+    }
+    if cs.Addresses == nil {
+        return valueobjects.Address{}, fmt.Errorf("%w: saved addresses are not available", ErrUnknownAddress)
+    }
+    
+    address, err := cs.Addresses.FindAddress(ctx, cmd.CustomerID, cmd.AddressID)
+    if err != nil {
+        if errors.Is(err, entities.ErrAddressNotFound) {
+            return valueobjects.Address{}, fmt.Errorf("%w: %v", ErrUnknownAddress, err)
+        }
+        return valueobjects.Address{}, err
+    }
+    return address, nil
+}
+
+// loadOrder finds an order at its current version, checks it is the one
+// the command expects, and applies the service's limits and shipping
+// restrictions to it.
+func (cs *CommandService) loadOrder(ctx context.Context, orderID entities.OrderID) (*entities.Order, error) {
+    order, err := cs.loadCurrentOrder(ctx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    if err := cs.checkVersion(ctx, order); err != nil {
+        return nil, err
+    }
+    return order, nil
+}
+
+// loadCurrentOrder is loadOrder without the version check, for commands
+// changing many orders, which cannot expect a version of each.
+func (cs *CommandService) loadCurrentOrder(ctx context.Context, orderID entities.OrderID) (*entities.Order, error) {
+    order, err := cs.OrderRepo.FindByID(ctx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    if order.Version, err = cs.EventStore.Version(ctx, string(orderID)); err != nil {
+        return nil, err
+    }
+    order.SetLimits(cs.Limits)
+    order.SetShippingRestrictions(cs.Restrictions)
+    return order, nil
+}
+
+// commit saves order together with the events recording its change and
+// their outbox entries, which carry the sequence the event store gave them,
+// then projects the events when a synchronous projection is configured.
+func (cs *CommandService) commit(ctx context.Context, order *entities.Order, domainEvents ...events.DomainEvent) error {
+    stored, err := cs.UnitOfWork.Commit(ctx, order, domainEvents)
+    if err != nil {
+        return fmt.Errorf("failed to save order: %w", err)
     }
     
+    cs.project(ctx, stored)
     return nil
 }
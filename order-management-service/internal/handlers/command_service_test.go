@@ -0,0 +1,615 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/internal/repositories"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+)
+
+// memoryOrders is an OrderRepository in memory, keeping a copy of each
+// order saved.
+type memoryOrders struct {
+    mu     sync.Mutex
+    orders map[entities.OrderID]entities.Order
+}
+
+func copyOrder(order *entities.Order) entities.Order {
+    saved := *order
+    saved.Items = append([]entities.OrderItem(nil), order.Items...)
+    return saved
+}
+
+func (m *memoryOrders) Save(_ context.Context, order *entities.Order) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.orders == nil {
+        m.orders = make(map[entities.OrderID]entities.Order)
+    }
+    m.orders[order.ID] = copyOrder(order)
+    return nil
+}
+
+func (m *memoryOrders) Update(ctx context.Context, order *entities.Order) error {
+    return m.Save(ctx, order)
+}
+
+func (m *memoryOrders) FindByID(_ context.Context, id entities.OrderID) (*entities.Order, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    saved, ok := m.orders[id]
+    if !ok {
+        return nil, fmt.Errorf("order not found")
+    }
+    order := copyOrder(&saved)
+    return &order, nil
+}
+
+func (m *memoryOrders) Delete(_ context.Context, id entities.OrderID) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    delete(m.orders, id)
+    return nil
+}
+
+func (m *memoryOrders) CountCreatedSince(_ context.Context, customerID string, since time.Time) (int, error) {
+    return m.countSince(func(order entities.Order) bool { return order.CustomerID == customerID }, since), nil
+}
+
+func (m *memoryOrders) CountGuestOrdersSince(_ context.Context, contactEmail valueobjects.Email, since time.Time) (int, error) {
+    return m.countSince(func(order entities.Order) bool { return order.CustomerID == "" && order.ContactEmail == contactEmail }, since), nil
+}
+
+func (m *memoryOrders) countSince(match func(entities.Order) bool, since time.Time) int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    count := 0
+    for _, order := range m.orders {
+        if match(order) && !order.CreatedAt.Before(since) {
+            count++
+        }
+    }
+    return count
+}
+
+func (m *memoryOrders) CountOrdersByStatus(context.Context) (map[string]int64, error) {
+    return nil, nil
+}
+
+func (m *memoryOrders) ListOrderIDs(context.Context, string, int) ([]string, error) {
+    return nil, nil
+}
+
+func (m *memoryOrders) ListCustomerOrderIDs(_ context.Context, customerID string) ([]string, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var ids []string
+    for id, order := range m.orders {
+        if order.CustomerID == customerID {
+            ids = append(ids, string(id))
+        }
+    }
+    sort.Strings(ids)
+    return ids, nil
+}
+
+// recordingOutbox records the types of the events saved to it.
+type recordingOutbox struct {
+    outbox.Repository
+    types []string
+}
+
+func (o *recordingOutbox) CheckEvent(events.DomainEvent) error {
+    return nil
+}
+
+func (o *recordingOutbox) SaveEvent(_ context.Context, event events.DomainEvent) error {
+    o.types = append(o.types, event.Type())
+    return nil
+}
+
+// memoryUnitOfWork commits to memoryOrders, an event store and a
+// recordingOutbox as the repositories' units of work commit in one
+// transaction: the events are saved at the order's version, so a conflict
+// writes nothing. beforeCommit, when set, runs first, as a concurrent
+// command would.
+type memoryUnitOfWork struct {
+    orders       *memoryOrders
+    store        repositories.EventStore
+    outbox       *recordingOutbox
+    beforeCommit func(order *entities.Order)
+}
+
+func (u *memoryUnitOfWork) Commit(ctx context.Context, order *entities.Order, domainEvents []events.DomainEvent) ([]events.DomainEvent, error) {
+    if u.beforeCommit != nil {
+        u.beforeCommit(order)
+    }
+    
+    stored, err := u.store.SaveEvents(ctx, string(order.ID), domainEvents, order.Version)
+    if err != nil {
+        return nil, err
+    }
+    
+    var status valueobjects.OrderStatus
+    if saved, err := u.orders.FindByID(ctx, order.ID); err == nil {
+        status = saved.Status
+    }
+    for _, event := range stored {
+        u.outbox.types = append(u.outbox.types, event.Type())
+        if changed, ok := events.NewOrderStatusChangedEvent(event, status); ok {
+            u.outbox.types = append(u.outbox.types, changed.Type())
+            status = valueobjects.OrderStatus(changed.ToStatus)
+        }
+    }
+    
+    if err := u.orders.Save(ctx, order); err != nil {
+        return nil, err
+    }
+    order.Version += len(stored)
+    return stored, nil
+}
+
+// memoryMerges is a CustomerMerges in memory.
+type memoryMerges map[string]string
+
+func (m memoryMerges) MergedInto(_ context.Context, customerID string) (string, error) {
+    return m[customerID], nil
+}
+
+func (m memoryMerges) RecordMerge(_ context.Context, sourceID, targetID string, _ time.Time) (string, error) {
+    if mergedInto, ok := m[sourceID]; ok {
+        return mergedInto, nil
+    }
+    m[sourceID] = targetID
+    return targetID, nil
+}
+
+// commandFixture is a CommandService committing through a
+// memoryUnitOfWork.
+type commandFixture struct {
+    service *CommandService
+    orders  *memoryOrders
+    store   repositories.EventStore
+    outbox  *recordingOutbox
+    work    *memoryUnitOfWork
+}
+
+func newCommandFixture() commandFixture {
+    orders := &memoryOrders{}
+    store := repositories.NewMemoryEventStore(events.DefaultRegistry())
+    repo := &recordingOutbox{}
+    work := &memoryUnitOfWork{orders: orders, store: store, outbox: repo}
+    service := &CommandService{
+        OrderRepo:      orders,
+        EventStore:     store,
+        Outbox:         repo,
+        UnitOfWork:     work,
+        CustomerMerges: memoryMerges{},
+    }
+    return commandFixture{service: service, orders: orders, store: store, outbox: repo, work: work}
+}
+
+func (f commandFixture) createOrder(t *testing.T, customerID string) entities.OrderID {
+    t.Helper()
+    order, err := f.service.CreateOrder(context.Background(), CreateOrderCommand{
+        CustomerID:      customerID,
+        Items:           []OrderItemCommand{{ProductID: "product-1", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")}},
+        ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+    })
+    if err != nil {
+        t.Fatalf("CreateOrder() = %v", err)
+    }
+    return order.ID
+}
+
+// eventTypes returns the types of the order's stored events after version
+// after.
+func (f commandFixture) eventTypes(t *testing.T, id entities.OrderID, after int) []string {
+    t.Helper()
+    stored, err := f.store.GetEvents(context.Background(), string(id))
+    if err != nil {
+        t.Fatalf("GetEvents() = %v", err)
+    }
+    var types []string
+    for _, event := range stored[after:] {
+        types = append(types, event.Type())
+    }
+    return types
+}
+
+func (f commandFixture) savedStatus(t *testing.T, id entities.OrderID) valueobjects.OrderStatus {
+    t.Helper()
+    saved, err := f.orders.FindByID(context.Background(), id)
+    if err != nil {
+        t.Fatalf("FindByID() = %v", err)
+    }
+    return saved.Status
+}
+
+type orderCommand func(ctx context.Context, cs *CommandService, id entities.OrderID) error
+
+var (
+    confirmOrder orderCommand = func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+        return cs.ConfirmOrder(ctx, id)
+    }
+    shipOrder orderCommand = func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+        return cs.ShipOrder(ctx, ShipOrderCommand{OrderID: string(id)})
+    }
+    holdOrder orderCommand = func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+        return cs.HoldOrder(ctx, HoldOrderCommand{OrderID: string(id), Reason: "fraud review"})
+    }
+    cancelOrder orderCommand = func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+        return cs.CancelOrder(ctx, CancelOrderCommand{OrderID: string(id), Reason: "customer_request"})
+    }
+)
+
+// Each command commits its events after those already stored, saves the
+// order with them and writes them to the outbox, each status change
+// followed by an OrderStatusChanged.
+func TestCommandService_commands(t *testing.T) {
+    tests := []struct {
+        name       string
+        before     []orderCommand
+        command    orderCommand
+        wantEvents []string
+        wantOutbox []string
+        wantStatus valueobjects.OrderStatus
+    }{
+        {
+            name:       "confirm",
+            command:    confirmOrder,
+            wantEvents: []string{"OrderConfirmed"},
+            wantOutbox: []string{"OrderConfirmed", "OrderStatusChanged"},
+            wantStatus: valueobjects.OrderStatusConfirmed,
+        },
+        {
+            name:       "ship",
+            before:     []orderCommand{confirmOrder},
+            command:    shipOrder,
+            wantEvents: []string{"OrderShipped"},
+            wantOutbox: []string{"OrderShipped", "OrderStatusChanged"},
+            wantStatus: valueobjects.OrderStatusShipped,
+        },
+        {
+            name:   "deliver",
+            before: []orderCommand{confirmOrder, shipOrder},
+            command: func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+                return cs.DeliverOrder(ctx, DeliverOrderCommand{OrderID: string(id), SignedBy: "J. Doe"})
+            },
+            wantEvents: []string{"OrderDelivered"},
+            wantOutbox: []string{"OrderDelivered", "OrderStatusChanged"},
+            wantStatus: valueobjects.OrderStatusDelivered,
+        },
+        {
+            name:       "cancel",
+            command:    cancelOrder,
+            wantEvents: []string{"OrderCancelled"},
+            wantOutbox: []string{"OrderCancelled", "OrderStatusChanged"},
+            wantStatus: valueobjects.OrderStatusCancelled,
+        },
+        {
+            name:   "reopen",
+            before: []orderCommand{cancelOrder},
+            command: func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+                return cs.ReopenOrder(ctx, id)
+            },
+            wantEvents: []string{"OrderReopened"},
+            wantOutbox: []string{"OrderReopened", "OrderStatusChanged"},
+            wantStatus: valueobjects.OrderStatusDraft,
+        },
+        {
+            name:       "hold",
+            before:     []orderCommand{confirmOrder},
+            command:    holdOrder,
+            wantEvents: []string{"OrderHeld"},
+            wantOutbox: []string{"OrderHeld", "OrderStatusChanged"},
+            wantStatus: valueobjects.OrderStatusOnHold,
+        },
+        {
+            name:   "release",
+            before: []orderCommand{confirmOrder, holdOrder},
+            command: func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+                return cs.ReleaseOrder(ctx, ReleaseOrderCommand{OrderID: string(id), Reason: "cleared"})
+            },
+            wantEvents: []string{"OrderReleased"},
+            wantOutbox: []string{"OrderReleased", "OrderStatusChanged"},
+            wantStatus: valueobjects.OrderStatusConfirmed,
+        },
+        {
+            name: "add item",
+            command: func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+                return cs.AddOrderItem(ctx, id, "product-2", 1, valueobjects.NewMoney(500, "USD"))
+            },
+            wantEvents: []string{"OrderItemAdded"},
+            wantOutbox: []string{"OrderItemAdded"},
+            wantStatus: valueobjects.OrderStatusDraft,
+        },
+        {
+            name: "remove item",
+            command: func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+                return cs.RemoveOrderItem(ctx, id, "product-1")
+            },
+            wantEvents: []string{"OrderItemRemoved"},
+            wantOutbox: []string{"OrderItemRemoved"},
+            wantStatus: valueobjects.OrderStatusDraft,
+        },
+        {
+            name: "patch",
+            command: func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+                city := "Chicago"
+                items := []OrderItemPatch{{ProductID: "product-1", Quantity: 3}}
+                _, err := cs.PatchOrder(ctx, PatchOrderCommand{OrderID: string(id), Items: &items, ShippingAddress: map[string]*string{"city": &city}})
+                return err
+            },
+            wantEvents: []string{"OrderShippingAddressChanged", "OrderItemQuantityChanged"},
+            wantOutbox: []string{"OrderShippingAddressChanged", "OrderItemQuantityChanged"},
+            wantStatus: valueobjects.OrderStatusDraft,
+        },
+        {
+            name: "update",
+            command: func(ctx context.Context, cs *CommandService, id entities.OrderID) error {
+                return cs.UpdateOrder(ctx, UpdateOrderCommand{
+                    OrderID:         string(id),
+                    Items:           []OrderItemCommand{{ProductID: "product-2", Quantity: 1, Price: valueobjects.NewMoney(500, "USD")}},
+                    ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+                })
+            },
+            wantEvents: []string{"OrderItemRemoved", "OrderItemAdded"},
+            wantOutbox: []string{"OrderItemRemoved", "OrderItemAdded"},
+            wantStatus: valueobjects.OrderStatusDraft,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            f := newCommandFixture()
+            id := f.createOrder(t, uuid.NewString())
+            for _, command := range tt.before {
+                if err := command(ctx, f.service, id); err != nil {
+                    t.Fatalf("preparing the order: %v", err)
+                }
+            }
+            version := 1 + len(tt.before)
+            f.outbox.types = nil
+            
+            if err := tt.command(ctx, f.service, id); err != nil {
+                t.Fatalf("command = %v", err)
+            }
+            
+            if got := f.eventTypes(t, id, version); !reflect.DeepEqual(got, tt.wantEvents) {
+                t.Errorf("events committed = %v, want %v", got, tt.wantEvents)
+            }
+            if !reflect.DeepEqual(f.outbox.types, tt.wantOutbox) {
+                t.Errorf("outbox = %v, want %v", f.outbox.types, tt.wantOutbox)
+            }
+            if got := f.savedStatus(t, id); got != tt.wantStatus {
+                t.Errorf("saved order is %s, want %s", got, tt.wantStatus)
+            }
+        })
+    }
+}
+
+func TestCommandService_CreateOrder(t *testing.T) {
+    f := newCommandFixture()
+    id := f.createOrder(t, uuid.NewString())
+    
+    if got, want := f.eventTypes(t, id, 0), []string{"OrderCreated"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("events committed = %v, want %v", got, want)
+    }
+    if got, want := f.outbox.types, []string{"OrderCreated"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("outbox = %v, want %v", got, want)
+    }
+    if got := f.savedStatus(t, id); got != valueobjects.OrderStatusDraft {
+        t.Errorf("saved order is %s, want draft", got)
+    }
+}
+
+func TestCommandService_MergeCustomers(t *testing.T) {
+    ctx := context.Background()
+    f := newCommandFixture()
+    source, target := uuid.NewString(), uuid.NewString()
+    first, second := f.createOrder(t, source), f.createOrder(t, source)
+    f.outbox.types = nil
+    
+    result, err := f.service.MergeCustomers(ctx, MergeCustomersCommand{SourceCustomerID: source, TargetCustomerID: target})
+    if err != nil {
+        t.Fatalf("MergeCustomers() = %v", err)
+    }
+    if result.OrdersMoved != 2 {
+        t.Errorf("MergeCustomers() moved %d orders, want 2", result.OrdersMoved)
+    }
+    
+    for _, id := range []entities.OrderID{first, second} {
+        if got, want := f.eventTypes(t, id, 1), []string{"OrderCustomerReassigned"}; !reflect.DeepEqual(got, want) {
+            t.Errorf("events committed for %s = %v, want %v", id, got, want)
+        }
+        if saved, _ := f.orders.FindByID(ctx, id); saved.CustomerID != target {
+            t.Errorf("order %s saved for customer %s, want %s", id, saved.CustomerID, target)
+        }
+    }
+    want := []string{"OrderCustomerReassigned", "OrderCustomerReassigned", "CustomerMerged"}
+    if !reflect.DeepEqual(f.outbox.types, want) {
+        t.Errorf("outbox = %v, want %v", f.outbox.types, want)
+    }
+}
+
+// Running a merge again moves only the orders still of the source, such as
+// one a failed run did not reach, and never moves an order twice.
+func TestCommandService_MergeCustomers_again(t *testing.T) {
+    ctx := context.Background()
+    f := newCommandFixture()
+    source, target := uuid.NewString(), uuid.NewString()
+    first := f.createOrder(t, source)
+    f.createOrder(t, target)
+    cmd := MergeCustomersCommand{SourceCustomerID: source, TargetCustomerID: target}
+    if _, err := f.service.MergeCustomers(ctx, cmd); err != nil {
+        t.Fatalf("MergeCustomers() = %v", err)
+    }
+    
+    // An order the first run did not reach
+    order, err := entities.NewOrder(source, "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    order.ID = entities.OrderID(uuid.NewString())
+    if _, err := f.work.Commit(ctx, order, []events.DomainEvent{events.NewOrderCreatedEvent(order)}); err != nil {
+        t.Fatalf("Commit() = %v", err)
+    }
+    f.outbox.types = nil
+    
+    result, err := f.service.MergeCustomers(ctx, cmd)
+    if err != nil {
+        t.Fatalf("MergeCustomers() again = %v", err)
+    }
+    if result.OrdersMoved != 1 {
+        t.Errorf("MergeCustomers() again moved %d orders, want 1", result.OrdersMoved)
+    }
+    if got, want := f.eventTypes(t, first, 1), []string{"OrderCustomerReassigned"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("events committed for the moved order = %v, want %v", got, want)
+    }
+    if got, want := f.eventTypes(t, order.ID, 1), []string{"OrderCustomerReassigned"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("events committed for the missed order = %v, want %v", got, want)
+    }
+    if got, want := f.outbox.types, []string{"OrderCustomerReassigned", "CustomerMerged"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("outbox = %v, want %v", got, want)
+    }
+    
+    f.outbox.types = nil
+    if result, err := f.service.MergeCustomers(ctx, cmd); err != nil || result.OrdersMoved != 0 {
+        t.Errorf("MergeCustomers() a third time = %+v, %v, want nothing moved", result, err)
+    }
+    if got, want := f.outbox.types, []string{"CustomerMerged"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("outbox = %v, want %v", got, want)
+    }
+}
+
+// A merged customer takes no new orders and cannot be merged elsewhere or
+// merged into; a customer cannot be merged into themselves.
+func TestCommandService_MergeCustomers_refused(t *testing.T) {
+    ctx := context.Background()
+    f := newCommandFixture()
+    source, target, other := uuid.NewString(), uuid.NewString(), uuid.NewString()
+    f.createOrder(t, source)
+    if _, err := f.service.MergeCustomers(ctx, MergeCustomersCommand{SourceCustomerID: source, TargetCustomerID: target}); err != nil {
+        t.Fatalf("MergeCustomers() = %v", err)
+    }
+    
+    tests := []struct {
+        name    string
+        cmd     MergeCustomersCommand
+        wantErr error
+    }{
+        {name: "into another target", cmd: MergeCustomersCommand{SourceCustomerID: source, TargetCustomerID: other}, wantErr: ErrCustomerMerged},
+        {name: "into a merged customer", cmd: MergeCustomersCommand{SourceCustomerID: other, TargetCustomerID: source}, wantErr: ErrCustomerMerged},
+        {name: "into themselves", cmd: MergeCustomersCommand{SourceCustomerID: other, TargetCustomerID: other}},
+        {name: "invalid id", cmd: MergeCustomersCommand{SourceCustomerID: "customer-1", TargetCustomerID: other}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f.outbox.types = nil
+            _, err := f.service.MergeCustomers(ctx, tt.cmd)
+            if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+                t.Errorf("MergeCustomers() = %v, want %v", err, tt.wantErr)
+            }
+            if len(f.outbox.types) != 0 {
+                t.Errorf("outbox = %v, want nothing", f.outbox.types)
+            }
+        })
+    }
+    
+    _, err := f.service.CreateOrder(ctx, CreateOrderCommand{
+        CustomerID:      source,
+        Items:           []OrderItemCommand{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")}},
+        ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+    })
+    var merged *CustomerMergedError
+    if !errors.As(err, &merged) || merged.MergedInto != target {
+        t.Errorf("CreateOrder() for the merged customer = %v, want it merged into %s", err, target)
+    }
+}
+
+// A command on an order another command changed first fails with
+// ErrVersionConflict and commits nothing, whether the change came before
+// it loaded the order, as its expected version says, or after.
+func TestCommandService_versionConflict(t *testing.T) {
+    tests := []struct {
+        name     string
+        expected bool
+        racing   bool
+    }{
+        {name: "stale expected version", expected: true},
+        {name: "change while committing", racing: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            f := newCommandFixture()
+            id := f.createOrder(t, uuid.NewString())
+            
+            if tt.expected {
+                if err := f.service.AddOrderItem(ctx, id, "product-2", 1, valueobjects.NewMoney(500, "USD")); err != nil {
+                    t.Fatalf("AddOrderItem() = %v", err)
+                }
+                // Read before the item was added
+                ctx = WithExpectedVersion(ctx, 1)
+            }
+            if tt.racing {
+                f.work.beforeCommit = func(order *entities.Order) {
+                    f.work.beforeCommit = nil
+                    concurrent := events.NewOrderItemAddedEvent(order, "product-2", 1, valueobjects.NewMoney(500, "USD"))
+                    if _, err := f.store.AppendEvents(ctx, string(order.ID), []events.DomainEvent{concurrent}); err != nil {
+                        t.Fatalf("AppendEvents() = %v", err)
+                    }
+                }
+            }
+            f.outbox.types = nil
+            
+            err := f.service.ConfirmOrder(ctx, id)
+            if !errors.Is(err, ErrVersionConflict) {
+                t.Fatalf("ConfirmOrder() = %v, want ErrVersionConflict", err)
+            }
+            
+            if got, want := f.eventTypes(t, id, 0), []string{"OrderCreated", "OrderItemAdded"}; !reflect.DeepEqual(got, want) {
+                t.Errorf("events after the conflict = %v, want %v", got, want)
+            }
+            if len(f.outbox.types) != 0 {
+                t.Errorf("outbox after the conflict = %v, want nothing", f.outbox.types)
+            }
+            if got := f.savedStatus(t, id); got != valueobjects.OrderStatusDraft {
+                t.Errorf("saved order is %s after the conflict, want draft", got)
+            }
+        })
+    }
+}
+
+// A PUT lists each product once, as a PATCH does.
+func TestUpdateOrderCommand_Validate_duplicateProduct(t *testing.T) {
+    item := OrderItemCommand{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")}
+    cmd := UpdateOrderCommand{
+        OrderID:         uuid.NewString(),
+        Items:           []OrderItemCommand{item, item},
+        ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+    }
+    if err := cmd.Validate(); err == nil {
+        t.Error("Validate() of a product listed twice = nil, want an error")
+    }
+    
+    cmd.Items = cmd.Items[:1]
+    if err := cmd.Validate(); err != nil {
+        t.Errorf("Validate() = %v", err)
+    }
+}
@@ -3,14 +3,26 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
 	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
 )
 
+// CreateOrderCommand ships to ShippingAddress, or to the customer's saved
+// address AddressID, or, when neither is given, to the customer's default
+// address. Channel defaults to valueobjects.DefaultOrderChannel.
+//
+// Guest checkouts leave CustomerID out and give a ContactEmail instead; as
+// they have no saved addresses, they must give a ShippingAddress.
 type CreateOrderCommand struct {
-    CustomerID      string                `json:"customer_id"`
+    CustomerID      string                `json:"customer_id,omitempty"`
+    ContactEmail    string                `json:"contact_email,omitempty"`
     Items           []OrderItemCommand    `json:"items"`
     ShippingAddress valueobjects.Address  `json:"shipping_address"`
+    AddressID       string                `json:"address_id,omitempty"`
+    Channel         string                `json:"channel,omitempty"`
 }
 
 type OrderItemCommand struct {
@@ -19,32 +31,127 @@ type OrderItemCommand struct {
     Price     valueobjects.Money  `json:"price"`
 }
 
+// UpdateOrderCommand replaces a draft order's items and shipping address.
+// Items is the whole new item list, listing each product at most once, as
+// PatchOrderCommand's Items does.
 type UpdateOrderCommand struct {
     OrderID         string                `json:"order_id"`
     Items           []OrderItemCommand    `json:"items"`
     ShippingAddress valueobjects.Address  `json:"shipping_address"`
 }
 
+// PatchOrderCommand is a JSON merge patch of a draft order: parts left out
+// are not changed. Items, when set, is the order's whole new item list,
+// applied as the item additions, removals and quantity changes that turn
+// the current list into it. ShippingAddress holds the address fields to
+// change; a nil value clears one.
+type PatchOrderCommand struct {
+    OrderID         string
+    Items           *[]OrderItemPatch
+    ShippingAddress map[string]*string
+}
+
+// OrderItemPatch is a line of a patched item list. Price is required for
+// products not on the order yet, and may be left out for those that are.
+type OrderItemPatch struct {
+    ProductID string              `json:"product_id"`
+    Quantity  int                 `json:"quantity"`
+    Price     *valueobjects.Money `json:"price,omitempty"`
+}
+
 type ConfirmOrderCommand struct {
     OrderID string `json:"order_id"`
 }
 
+// ShipOrderCommand ships a confirmed order, which must not be on hold.
+type ShipOrderCommand struct {
+    OrderID string `json:"order_id"`
+}
+
+// DeliverOrderCommand confirms the delivery of a shipped order. A zero
+// DeliveredAt means now; SignedBy and CarrierReference are optional.
+type DeliverOrderCommand struct {
+    OrderID          string    `json:"order_id"`
+    DeliveredAt      time.Time `json:"delivered_at"`
+    SignedBy         string    `json:"signed_by"`
+    CarrierReference string    `json:"carrier_reference"`
+}
+
+// CancelOrderCommand cancels an order for Reason, one of
+// valueobjects.CancellationReasons, with optional free-text Details.
 type CancelOrderCommand struct {
     OrderID string `json:"order_id"`
     Reason  string `json:"reason"`
+    Details string `json:"details"`
+    // Force cancels a confirmed order past the cancellation window; only
+    // admin-scoped callers may set it
+    Force   bool   `json:"force"`
+}
+
+// HoldOrderCommand puts a confirmed order on hold for Reason, such as a
+// fraud review.
+type HoldOrderCommand struct {
+    OrderID string `json:"order_id"`
+    Reason  string `json:"reason"`
+}
+
+// ReleaseOrderCommand returns an order on hold to confirmed, with an
+// optional Reason.
+type ReleaseOrderCommand struct {
+    OrderID string `json:"order_id"`
+    Reason  string `json:"reason"`
+}
+
+// MergeCustomersCommand merges the duplicate customer SourceCustomerID
+// into TargetCustomerID.
+type MergeCustomersCommand struct {
+    SourceCustomerID string `json:"source_customer_id"`
+    TargetCustomerID string `json:"target_customer_id"`
+}
+
+// decodeError is the response to a command body that failed to decode. A
+// price with more decimal places than its currency has is reported as such;
+// anything else is malformed JSON.
+func decodeError(err error) string {
+    if errors.Is(err, valueobjects.ErrAmountPrecision) {
+        return "invalid price: " + err.Error()
+    }
+    return "Invalid JSON"
 }
 
 func (c CreateOrderCommand) Validate() error {
-    if c.CustomerID == "" {
-        return errors.New("customer_id is required")
+    if c.CustomerID == "" && c.ContactEmail == "" {
+        return entities.ErrOrderContactRequired
+    }
+    if c.CustomerID != "" {
+        if _, err := entities.ParseCustomerID(c.CustomerID); err != nil {
+            return err
+        }
+    }
+    if c.ContactEmail != "" {
+        if _, err := valueobjects.ParseEmail(c.ContactEmail); err != nil {
+            return fmt.Errorf("invalid contact_email: %w", err)
+        }
+    }
+    if c.CustomerID == "" && c.ShippingAddress == (valueobjects.Address{}) {
+        return errors.New("shipping_address is required for guest checkouts")
     }
     
     if len(c.Items) == 0 {
         return errors.New("at least one item is required")
     }
     
-    if err := c.ShippingAddress.Validate(); err != nil {
-        return fmt.Errorf("invalid shipping address: %w", err)
+    if _, err := valueobjects.ParseOrderChannel(c.Channel); err != nil {
+        return err
+    }
+    
+    if c.ShippingAddress != (valueobjects.Address{}) {
+        if c.AddressID != "" {
+            return errors.New("give either shipping_address or address_id, not both")
+        }
+        if err := c.ShippingAddress.Validate(); err != nil {
+            return fmt.Errorf("invalid shipping address: %w", err)
+        }
     }
     
     for i, item := range c.Items {
@@ -81,15 +188,87 @@ func (c UpdateOrderCommand) Validate() error {
         return fmt.Errorf("invalid shipping address: %w", err)
     }
     
+    seen := make(map[string]bool, len(c.Items))
     for i, item := range c.Items {
         if err := item.Validate(); err != nil {
             return fmt.Errorf("invalid item at index %d: %w", i, err)
         }
+        if seen[item.ProductID] {
+            return fmt.Errorf("invalid item at index %d: product %s is listed more than once", i, item.ProductID)
+        }
+        seen[item.ProductID] = true
+    }
+    
+    return nil
+}
+
+// Validate checks the parts of the patch that are present.
+func (c PatchOrderCommand) Validate() error {
+    if c.OrderID == "" {
+        return errors.New("order_id is required")
+    }
+    
+    for field := range c.ShippingAddress {
+        if _, ok := addressFields[field]; !ok {
+            return fmt.Errorf("invalid shipping address: unknown field %q", field)
+        }
+    }
+    
+    if c.Items != nil {
+        seen := make(map[string]bool, len(*c.Items))
+        for i, item := range *c.Items {
+            if err := item.Validate(); err != nil {
+                return fmt.Errorf("invalid item at index %d: %w", i, err)
+            }
+            if seen[item.ProductID] {
+                return fmt.Errorf("invalid item at index %d: product %s is listed more than once", i, item.ProductID)
+            }
+            seen[item.ProductID] = true
+        }
+    }
+    
+    return nil
+}
+
+func (i OrderItemPatch) Validate() error {
+    if i.ProductID == "" {
+        return errors.New("product_id is required")
+    }
+    
+    if i.Quantity <= 0 {
+        return errors.New("quantity must be greater than zero")
+    }
+    
+    if i.Price != nil {
+        if err := i.Price.Validate(); err != nil {
+            return fmt.Errorf("invalid price: %w", err)
+        }
     }
     
     return nil
 }
 
+// addressFields sets the fields of an address by their JSON names.
+var addressFields = map[string]func(address *valueobjects.Address, value string){
+    "street":  func(a *valueobjects.Address, v string) { a.Street = v },
+    "city":    func(a *valueobjects.Address, v string) { a.City = v },
+    "state":   func(a *valueobjects.Address, v string) { a.State = v },
+    "zip":     func(a *valueobjects.Address, v string) { a.Zip = v },
+    "country": func(a *valueobjects.Address, v string) { a.Country = v },
+}
+
+// patchAddress returns address with the patch's fields applied.
+func (c PatchOrderCommand) patchAddress(address valueobjects.Address) valueobjects.Address {
+    for field, value := range c.ShippingAddress {
+        if value == nil {
+            addressFields[field](&address, "")
+            continue
+        }
+        addressFields[field](&address, *value)
+    }
+    return address
+}
+
 func (c ConfirmOrderCommand) Validate() error {
     if c.OrderID == "" {
         return errors.New("order_id is required")
@@ -97,6 +276,32 @@ func (c ConfirmOrderCommand) Validate() error {
     return nil
 }
 
+func (c ShipOrderCommand) Validate() error {
+    if c.OrderID == "" {
+        return errors.New("order_id is required")
+    }
+    return nil
+}
+
+// maxDeliveryDetailLength bounds SignedBy and CarrierReference.
+const maxDeliveryDetailLength = 255
+
+func (c DeliverOrderCommand) Validate() error {
+    if c.OrderID == "" {
+        return errors.New("order_id is required")
+    }
+    if len(c.SignedBy) > maxDeliveryDetailLength {
+        return fmt.Errorf("signed_by cannot be longer than %d bytes", maxDeliveryDetailLength)
+    }
+    if len(c.CarrierReference) > maxDeliveryDetailLength {
+        return fmt.Errorf("carrier_reference cannot be longer than %d bytes", maxDeliveryDetailLength)
+    }
+    return nil
+}
+
+// maxCancellationDetailsLength bounds CancelOrderCommand.Details.
+const maxCancellationDetailsLength = 1000
+
 func (c CancelOrderCommand) Validate() error {
     if c.OrderID == "" {
         return errors.New("order_id is required")
@@ -104,5 +309,51 @@ func (c CancelOrderCommand) Validate() error {
     if c.Reason == "" {
         return errors.New("reason is required")
     }
+    if _, err := valueobjects.ParseCancellationReason(c.Reason); err != nil {
+        return err
+    }
+    if len(c.Details) > maxCancellationDetailsLength {
+        return fmt.Errorf("details cannot be longer than %d bytes", maxCancellationDetailsLength)
+    }
+    return nil
+}
+
+// maxHoldReasonLength bounds the reasons of HoldOrderCommand and
+// ReleaseOrderCommand.
+const maxHoldReasonLength = 1000
+
+func (c HoldOrderCommand) Validate() error {
+    if c.OrderID == "" {
+        return errors.New("order_id is required")
+    }
+    if strings.TrimSpace(c.Reason) == "" {
+        return entities.ErrHoldReasonRequired
+    }
+    if len(c.Reason) > maxHoldReasonLength {
+        return fmt.Errorf("reason cannot be longer than %d bytes", maxHoldReasonLength)
+    }
+    return nil
+}
+
+func (c ReleaseOrderCommand) Validate() error {
+    if c.OrderID == "" {
+        return errors.New("order_id is required")
+    }
+    if len(c.Reason) > maxHoldReasonLength {
+        return fmt.Errorf("reason cannot be longer than %d bytes", maxHoldReasonLength)
+    }
+    return nil
+}
+
+func (c MergeCustomersCommand) Validate() error {
+    if _, err := entities.ParseCustomerID(c.SourceCustomerID); err != nil {
+        return fmt.Errorf("invalid source_customer_id: %w", err)
+    }
+    if _, err := entities.ParseCustomerID(c.TargetCustomerID); err != nil {
+        return fmt.Errorf("invalid target_customer_id: %w", err)
+    }
+    if c.SourceCustomerID == c.TargetCustomerID {
+        return errors.New("a customer cannot be merged into themselves")
+    }
     return nil
 }
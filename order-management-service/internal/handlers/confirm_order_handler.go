@@ -2,9 +2,6 @@ package handlers
 
 import (
 	"net/http"
-
-	"github.com/gorilla/mux"
-	"github.com/vdntruong/dddcqrs/shared/domain/entities"
 )
 
 type ConfirmOrderHandler struct {
@@ -12,10 +9,25 @@ type ConfirmOrderHandler struct {
 }
 
 func (h *ConfirmOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    orderID := entities.OrderID(vars["id"])
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    expected, ok := decodeExpectedVersion(w, r)
+    if !ok {
+        return
+    }
+    
+    ctx, ok := commandContext(w, r, expected)
+    if !ok {
+        return
+    }
     
-    if err := h.Service.ConfirmOrder(r.Context(), orderID); err != nil {
+    if err := h.Service.ConfirmOrder(ctx, orderID); err != nil {
+        if writeVersionError(w, r, err) {
+            return
+        }
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
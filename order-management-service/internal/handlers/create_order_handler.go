@@ -2,7 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
 )
 
 type CreateOrderHandler struct {
@@ -13,26 +18,73 @@ func (h *CreateOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request)
     var cmd CreateOrderCommand
     
     if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        http.Error(w, decodeError(err), http.StatusBadRequest)
         return
     }
     
+    // Customer ids are stored in the lower case form ParseCustomerID
+    // returns; guest checkouts have none
+    if customerID, err := entities.ParseCustomerID(cmd.CustomerID); err == nil {
+        cmd.CustomerID = string(customerID)
+    }
+    
     order, err := h.Service.CreateOrder(r.Context(), cmd)
     if err != nil {
+        if errors.Is(err, ErrUnknownCustomer) {
+            http.Error(w, "unknown customer", http.StatusUnprocessableEntity)
+            return
+        }
+        if errors.Is(err, ErrCustomerMerged) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        if errors.Is(err, ErrUnknownAddress) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        if errors.Is(err, ErrOrderRateLimited) {
+            w.Header().Set("Retry-After", strconv.Itoa(int(h.Service.RateLimit.Window.Seconds())))
+            http.Error(w, err.Error(), http.StatusTooManyRequests)
+            return
+        }
+        if errors.Is(err, ErrOrderRejected) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        if errors.Is(err, ErrRestrictedCountry) {
+            writeRestrictedCountry(w, err)
+            return
+        }
+        if errors.Is(err, ErrPriceMismatch) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        if errors.Is(err, ErrOrderLimitExceeded) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        if errors.Is(err, ErrEventTooLarge) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
     
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(http.StatusCreated)
-    
     response := map[string]interface{}{
         "id":         order.ID,
+        "order_number": order.Number,
         "customer_id": order.CustomerID,
         "status":     order.Status.String(),
+        "channel":    order.Channel.String(),
         "total_amount": order.TotalAmount,
-        "created_at": order.CreatedAt,
+        "shipping_cost": order.ShippingCost,
+        "grand_total": order.GrandTotal,
+        "created_at": apijson.NewTimestamp(order.CreatedAt),
+    }
+    if order.ContactEmail != "" {
+        response["contact_email"] = order.ContactEmail
     }
     
-    json.NewEncoder(w).Encode(response)
+    apijson.Write(w, r, http.StatusCreated, response)
 }
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Prices may be given as decimal strings in the currency's major unit, with
+// no more places than the currency has.
+func TestCreateOrderHandler_decimalPrices(t *testing.T) {
+    tests := []struct {
+        name       string
+        price      string
+        wantStatus int
+        wantTotal  int64
+        wantBody   string
+    }{
+        {name: "minor units", price: `{"amount": 1999, "currency": "USD"}`, wantStatus: http.StatusCreated, wantTotal: 3998},
+        {name: "decimal", price: `{"amount": "19.99", "currency": "USD"}`, wantStatus: http.StatusCreated, wantTotal: 3998},
+        {name: "zero-decimal currency", price: `{"amount": "1999", "currency": "JPY"}`, wantStatus: http.StatusCreated, wantTotal: 3998},
+        {name: "sub-cent", price: `{"amount": "19.999", "currency": "USD"}`, wantStatus: http.StatusBadRequest, wantBody: "invalid price"},
+        {name: "fraction of a yen", price: `{"amount": "19.5", "currency": "JPY"}`, wantStatus: http.StatusBadRequest, wantBody: "invalid price"},
+        {name: "not an amount", price: `{"amount": "cheap", "currency": "USD"}`, wantStatus: http.StatusBadRequest, wantBody: "Invalid JSON"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            handler := &CreateOrderHandler{Service: f.service}
+            body := `{
+                "customer_id": "` + uuid.NewString() + `",
+                "items": [{"product_id": "product-1", "quantity": 2, "price": ` + tt.price + `}],
+                "shipping_address": {"street": "1 Main St", "city": "Springfield", "state": "IL", "zip": "62701", "country": "US"}
+            }`
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("POST /orders = %d %q, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+            }
+            if tt.wantStatus != http.StatusCreated {
+                if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+                    t.Errorf("body = %q, want %q", recorder.Body, tt.wantBody)
+                }
+                return
+            }
+            
+            var created struct {
+                TotalAmount struct {
+                    Amount int64 `json:"amount"`
+                } `json:"total_amount"`
+            }
+            if err := json.NewDecoder(recorder.Body).Decode(&created); err != nil {
+                t.Fatalf("decoding response: %v", err)
+            }
+            if created.TotalAmount.Amount != tt.wantTotal {
+                t.Errorf("total = %d, want %d", created.TotalAmount.Amount, tt.wantTotal)
+            }
+        })
+    }
+}
+
+// Orders are placed through web unless they name another channel, which is
+// saved on the order and carried in its OrderCreated event.
+func TestCreateOrderHandler_channel(t *testing.T) {
+    tests := []struct {
+        name        string
+        channel     string
+        wantStatus  int
+        wantChannel valueobjects.OrderChannel
+    }{
+        {name: "default", wantStatus: http.StatusCreated, wantChannel: valueobjects.OrderChannelWeb},
+        {name: "mobile", channel: `, "channel": "mobile"`, wantStatus: http.StatusCreated, wantChannel: valueobjects.OrderChannelMobile},
+        {name: "phone", channel: `, "channel": "phone"`, wantStatus: http.StatusCreated, wantChannel: valueobjects.OrderChannelPhone},
+        {name: "unknown", channel: `, "channel": "unknown"`, wantStatus: http.StatusBadRequest},
+        {name: "unsupported", channel: `, "channel": "fax"`, wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            handler := &CreateOrderHandler{Service: f.service}
+            body := `{
+                "customer_id": "` + uuid.NewString() + `",
+                "items": [{"product_id": "product-1", "quantity": 1, "price": {"amount": 1000, "currency": "USD"}}],
+                "shipping_address": {"street": "1 Main St", "city": "Springfield", "state": "IL", "zip": "62701", "country": "US"}` + tt.channel + `
+            }`
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("POST /orders = %d %q, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+            }
+            if tt.wantStatus != http.StatusCreated {
+                if !strings.Contains(recorder.Body.String(), valueobjects.ErrInvalidOrderChannel.Error()) {
+                    t.Errorf("body = %q, want %q", recorder.Body, valueobjects.ErrInvalidOrderChannel)
+                }
+                return
+            }
+            
+            var created struct {
+                ID      entities.OrderID `json:"id"`
+                Channel string           `json:"channel"`
+            }
+            if err := json.NewDecoder(recorder.Body).Decode(&created); err != nil {
+                t.Fatalf("decoding response: %v", err)
+            }
+            if created.Channel != tt.wantChannel.String() {
+                t.Errorf("response channel = %q, want %q", created.Channel, tt.wantChannel)
+            }
+            saved, err := f.orders.FindByID(context.Background(), created.ID)
+            if err != nil {
+                t.Fatalf("FindByID() = %v", err)
+            }
+            if saved.Channel != tt.wantChannel {
+                t.Errorf("saved channel = %q, want %q", saved.Channel, tt.wantChannel)
+            }
+            stored, err := f.store.GetEvents(context.Background(), string(created.ID))
+            if err != nil {
+                t.Fatalf("GetEvents() = %v", err)
+            }
+            if event, ok := stored[0].(events.OrderCreatedEvent); !ok || event.Channel != tt.wantChannel {
+                t.Errorf("stored %#v, want an OrderCreated event through %q", stored[0], tt.wantChannel)
+            }
+        })
+    }
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// customerAddressBook serves the saved addresses of one customer.
+type customerAddressBook struct {
+    customer *entities.Customer
+}
+
+func (b customerAddressBook) FindAddress(_ context.Context, customerID, addressID string) (valueobjects.Address, error) {
+    if customerID == string(b.customer.ID) {
+        for _, saved := range b.customer.Addresses {
+            if saved.ID == addressID || addressID == "" && saved.Default {
+                return saved.Address, nil
+            }
+        }
+    }
+    return valueobjects.Address{}, fmt.Errorf("%w: customer %s has no address %q", entities.ErrAddressNotFound, customerID, addressID)
+}
+
+// Orders keep a copy of the saved address they ship to, so editing the
+// saved address later leaves them unchanged.
+func TestCommandService_CreateOrder_savedAddress(t *testing.T) {
+    ctx := context.Background()
+    home := valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US")
+    work := valueobjects.NewAddress("2 Oak Ave", "Springfield", "IL", "62702", "US")
+    customer := entities.NewCustomer("ada@example.com", "Ada")
+    homeID, err := customer.AddAddress(home)
+    if err != nil {
+        t.Fatalf("AddAddress() = %v", err)
+    }
+    workID, err := customer.AddAddress(work)
+    if err != nil {
+        t.Fatalf("AddAddress() = %v", err)
+    }
+    f := newCommandFixture()
+    f.service.Addresses = customerAddressBook{customer: customer}
+    
+    tests := []struct {
+        name      string
+        addressID string
+        want      valueobjects.Address
+    }{
+        {name: "saved address", addressID: workID, want: work},
+        {name: "default address", addressID: "", want: home},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            order, err := f.service.CreateOrder(ctx, CreateOrderCommand{
+                CustomerID: string(customer.ID),
+                Items:      []OrderItemCommand{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")}},
+                AddressID:  tt.addressID,
+            })
+            if err != nil {
+                t.Fatalf("CreateOrder() = %v", err)
+            }
+            
+            moved := valueobjects.NewAddress("9 New Rd", "Chicago", "IL", "60601", "US")
+            if err := customer.UpdateAddress(homeID, moved); err != nil {
+                t.Fatalf("UpdateAddress() = %v", err)
+            }
+            defer customer.UpdateAddress(homeID, home)
+            if err := customer.UpdateAddress(workID, valueobjects.NewAddress("10 New Rd", "Chicago", "IL", "60601", "US")); err != nil {
+                t.Fatalf("UpdateAddress() = %v", err)
+            }
+            defer customer.UpdateAddress(workID, work)
+            
+            saved, err := f.orders.FindByID(ctx, order.ID)
+            if err != nil {
+                t.Fatalf("FindByID() = %v", err)
+            }
+            if saved.ShippingAddress != tt.want {
+                t.Errorf("shipping address = %v, want the address when ordered, %v", saved.ShippingAddress, tt.want)
+            }
+        })
+    }
+}
+
+func TestCreateOrderHandler_unknownAddress(t *testing.T) {
+    customer := entities.NewCustomer("ada@example.com", "Ada")
+    tests := []struct {
+        name      string
+        addresses func(*CommandService)
+        addressID string
+    }{
+        {name: "unknown id", addressID: "missing"},
+        {name: "no default address", addressID: ""},
+        {name: "no address book", addressID: "missing", addresses: func(cs *CommandService) { cs.Addresses = nil }},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            f.service.Addresses = customerAddressBook{customer: customer}
+            if tt.addresses != nil {
+                tt.addresses(f.service)
+            }
+            body, err := json.Marshal(CreateOrderCommand{
+                CustomerID: string(customer.ID),
+                Items:      []OrderItemCommand{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")}},
+                AddressID:  tt.addressID,
+            })
+            if err != nil {
+                t.Fatal(err)
+            }
+            recorder := httptest.NewRecorder()
+            handler := &CreateOrderHandler{Service: f.service}
+            handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body)))
+            if recorder.Code != http.StatusUnprocessableEntity {
+                t.Errorf("POST /orders = %d %q, want 422", recorder.Code, recorder.Body)
+            }
+            
+            _, err = f.service.CreateOrder(context.Background(), CreateOrderCommand{
+                CustomerID: string(customer.ID),
+                Items:      []OrderItemCommand{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")}},
+                AddressID:  tt.addressID,
+            })
+            if !errors.Is(err, ErrUnknownAddress) {
+                t.Errorf("CreateOrder() = %v, want ErrUnknownAddress", err)
+            }
+        })
+    }
+}
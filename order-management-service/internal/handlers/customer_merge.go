@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+// ErrCustomerMerged is matched by the errors returned for orders of a
+// customer merged into another, and for merges from or into such a
+// customer other than the one recorded.
+var ErrCustomerMerged = errors.New("customer was merged into another")
+
+// ErrCustomerMergesUnavailable is returned by MergeCustomers when the
+// service has no CustomerMerges.
+var ErrCustomerMergesUnavailable = errors.New("customer merges are not available")
+
+// CustomerMergedError reports a customer merged into MergedInto.
+type CustomerMergedError struct {
+    CustomerID string
+    MergedInto string
+}
+
+func (e *CustomerMergedError) Error() string {
+    return fmt.Sprintf("%v: %s was merged into %s", ErrCustomerMerged, e.CustomerID, e.MergedInto)
+}
+
+// Is makes errors.Is match ErrCustomerMerged.
+func (e *CustomerMergedError) Is(target error) bool {
+    return target == ErrCustomerMerged
+}
+
+// CustomerMergeResult reports a MergeCustomers run.
+type CustomerMergeResult struct {
+    SourceCustomerID string `json:"source_customer_id"`
+    TargetCustomerID string `json:"target_customer_id"`
+    // OrdersMoved counts the orders this run reassigned; a merge run again
+    // moves only the orders earlier runs did not
+    OrdersMoved      int    `json:"orders_moved"`
+}
+
+// MergeCustomers merges a duplicate customer into another: the merge is
+// recorded first, so the source takes no new orders, then each of the
+// source's orders is reassigned to the target with an
+// OrderCustomerReassignedEvent, and a CustomerMergedEvent is saved to the
+// outbox for the read models.
+//
+// Merging is idempotent. Running the same merge again reassigns only the
+// orders still of the source, such as those a failed run did not reach, so
+// a merge that fails part way is finished by running it again. A source
+// merged into another target, or a target merged itself, is refused with a
+// *CustomerMergedError. Orders are not checked against the version their
+// callers expect, as a merge changes orders no caller has read.
+func (cs *CommandService) MergeCustomers(ctx context.Context, cmd MergeCustomersCommand) (*CustomerMergeResult, error) {
+    if err := cmd.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid command: %w", err)
+    }
+    if cs.CustomerMerges == nil {
+        return nil, ErrCustomerMergesUnavailable
+    }
+    
+    // Serialized so two merges cannot take customers into each other
+    cs.merges.Lock()
+    defer cs.merges.Unlock()
+    
+    if err := cs.checkNotMerged(ctx, cmd.TargetCustomerID); err != nil {
+        return nil, err
+    }
+    if err := cs.verifyCustomer(ctx, cmd.TargetCustomerID); err != nil {
+        return nil, err
+    }
+    
+    mergedInto, err := cs.CustomerMerges.RecordMerge(ctx, cmd.SourceCustomerID, cmd.TargetCustomerID, cs.now())
+    if err != nil {
+        return nil, err
+    }
+    if mergedInto != cmd.TargetCustomerID {
+        return nil, &CustomerMergedError{CustomerID: cmd.SourceCustomerID, MergedInto: mergedInto}
+    }
+    
+    orderIDs, err := cs.OrderRepo.ListCustomerOrderIDs(ctx, cmd.SourceCustomerID)
+    if err != nil {
+        return nil, err
+    }
+    
+    result := &CustomerMergeResult{SourceCustomerID: cmd.SourceCustomerID, TargetCustomerID: cmd.TargetCustomerID}
+    for _, orderID := range orderIDs {
+        moved, err := cs.reassignOrder(ctx, entities.OrderID(orderID), cmd.SourceCustomerID, cmd.TargetCustomerID)
+        if err != nil {
+            return nil, fmt.Errorf("failed to reassign order %s, merge again to finish: %w", orderID, err)
+        }
+        if moved {
+            result.OrdersMoved++
+        }
+    }
+    
+    if err := cs.Outbox.SaveEvent(ctx, events.NewCustomerMergedEvent(cmd.SourceCustomerID, cmd.TargetCustomerID, result.OrdersMoved)); err != nil {
+        return nil, fmt.Errorf("failed to save customer merge, merge again to finish: %w", err)
+    }
+    
+    log.Printf("Merged customer %s into %s, %d orders moved", cmd.SourceCustomerID, cmd.TargetCustomerID, result.OrdersMoved)
+    return result, nil
+}
+
+// reassignOrder moves an order of from to to, reporting whether it moved.
+// An order no longer of from, as one an earlier run moved, is left alone.
+func (cs *CommandService) reassignOrder(ctx context.Context, orderID entities.OrderID, from, to string) (bool, error) {
+    unlock, err := cs.locks.lock(ctx, orderID)
+    if err != nil {
+        return false, err
+    }
+    defer unlock()
+    
+    order, err := cs.loadCurrentOrder(ctx, orderID)
+    if err != nil {
+        return false, fmt.Errorf("failed to find order: %w", err)
+    }
+    if order.CustomerID != from {
+        return false, nil
+    }
+    
+    moved, err := order.ReassignCustomer(to)
+    if err != nil || !moved {
+        return false, err
+    }
+    
+    if err := cs.commit(ctx, order, events.NewOrderCustomerReassignedEvent(order, from)); err != nil {
+        return false, err
+    }
+    return true, nil
+}
+
+// checkNotMerged returns a *CustomerMergedError for a customer merged into
+// another.
+func (cs *CommandService) checkNotMerged(ctx context.Context, customerID string) error {
+    if cs.CustomerMerges == nil {
+        return nil
+    }
+    
+    mergedInto, err := cs.CustomerMerges.MergedInto(ctx, customerID)
+    if err != nil {
+        return err
+    }
+    if mergedInto != "" {
+        return &CustomerMergedError{CustomerID: customerID, MergedInto: mergedInto}
+    }
+    return nil
+}
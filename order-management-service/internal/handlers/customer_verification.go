@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrUnknownCustomer is returned by CreateOrder when customer verification
+// is enforced and the customer does not exist.
+var ErrUnknownCustomer = errors.New("unknown customer")
+
+// CustomerVerificationMode controls what CreateOrder does with orders for
+// customers the verifier does not know.
+type CustomerVerificationMode string
+
+const (
+    CustomerVerificationOff     CustomerVerificationMode = "off"
+    CustomerVerificationWarn    CustomerVerificationMode = "warn"
+    CustomerVerificationEnforce CustomerVerificationMode = "enforce"
+)
+
+// ParseCustomerVerificationMode parses the CUSTOMER_VERIFICATION setting.
+func ParseCustomerVerificationMode(value string) (CustomerVerificationMode, error) {
+    switch mode := CustomerVerificationMode(value); mode {
+    case CustomerVerificationOff, CustomerVerificationWarn, CustomerVerificationEnforce:
+        return mode, nil
+    default:
+        return "", fmt.Errorf("invalid customer verification mode %q: must be off, warn or enforce", value)
+    }
+}
+
+// verifyCustomer checks customerID according to the configured mode. In
+// warn mode unknown customers and failed lookups are only logged.
+func (cs *CommandService) verifyCustomer(ctx context.Context, customerID string) error {
+    if cs.Customers == nil || cs.CustomerVerification == "" || cs.CustomerVerification == CustomerVerificationOff {
+        return nil
+    }
+    
+    exists, err := cs.Customers.CustomerExists(ctx, customerID)
+    if err != nil {
+        if cs.CustomerVerification == CustomerVerificationEnforce {
+            return fmt.Errorf("failed to verify customer: %w", err)
+        }
+        log.Printf("Could not verify customer %s: %v", customerID, err)
+        return nil
+    }
+    
+    if exists {
+        return nil
+    }
+    
+    if cs.CustomerVerification == CustomerVerificationEnforce {
+        return fmt.Errorf("%w: %s", ErrUnknownCustomer, customerID)
+    }
+    
+    log.Printf("Creating order for unknown customer %s", customerID)
+    return nil
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// knownCustomers is a CustomerVerifier over a set of customers. Lookups
+// fail with err when it is set.
+type knownCustomers struct {
+    ids map[string]bool
+    err error
+}
+
+func (k knownCustomers) CustomerExists(_ context.Context, customerID string) (bool, error) {
+    return k.ids[customerID], k.err
+}
+
+func TestCommandService_CreateOrder_customerVerification(t *testing.T) {
+    known := uuid.NewString()
+    tests := []struct {
+        name       string
+        mode       CustomerVerificationMode
+        verifier   knownCustomers
+        customerID string
+        wantErr    error
+        wantAnyErr bool
+    }{
+        {name: "off accepts unknown", mode: CustomerVerificationOff, customerID: uuid.NewString()},
+        {name: "unset accepts unknown", customerID: uuid.NewString()},
+        {name: "warn accepts known", mode: CustomerVerificationWarn, customerID: known},
+        {name: "warn accepts unknown", mode: CustomerVerificationWarn, customerID: uuid.NewString()},
+        {name: "warn accepts a failed lookup", mode: CustomerVerificationWarn, verifier: knownCustomers{err: errors.New("db down")}, customerID: known},
+        {name: "enforce accepts known", mode: CustomerVerificationEnforce, customerID: known},
+        {name: "enforce rejects unknown", mode: CustomerVerificationEnforce, customerID: uuid.NewString(), wantErr: ErrUnknownCustomer},
+        {name: "enforce fails a failed lookup", mode: CustomerVerificationEnforce, verifier: knownCustomers{err: errors.New("db down")}, customerID: known, wantAnyErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            verifier := tt.verifier
+            if verifier.err == nil {
+                verifier.ids = map[string]bool{known: true}
+            }
+            f.service.Customers = verifier
+            f.service.CustomerVerification = tt.mode
+            
+            _, err := f.service.CreateOrder(context.Background(), CreateOrderCommand{
+                CustomerID:      tt.customerID,
+                Items:           []OrderItemCommand{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")}},
+                ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+            })
+            switch {
+            case tt.wantErr != nil:
+                if !errors.Is(err, tt.wantErr) {
+                    t.Errorf("CreateOrder() = %v, want %v", err, tt.wantErr)
+                }
+            case tt.wantAnyErr:
+                if err == nil || errors.Is(err, ErrUnknownCustomer) {
+                    t.Errorf("CreateOrder() = %v, want a lookup error", err)
+                }
+            case err != nil:
+                t.Errorf("CreateOrder() = %v", err)
+            }
+            
+            if rejected := tt.wantErr != nil || tt.wantAnyErr; rejected && len(f.outbox.types) != 0 {
+                t.Errorf("rejected order wrote %v to the outbox", f.outbox.types)
+            }
+        })
+    }
+}
+
+func TestCreateOrderHandler_unknownCustomer(t *testing.T) {
+    f := newCommandFixture()
+    f.service.Customers = knownCustomers{}
+    f.service.CustomerVerification = CustomerVerificationEnforce
+    handler := &CreateOrderHandler{Service: f.service}
+    
+    body, err := json.Marshal(CreateOrderCommand{
+        CustomerID:      uuid.NewString(),
+        Items:           []OrderItemCommand{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")}},
+        ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    recorder := httptest.NewRecorder()
+    handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body)))
+    
+    if recorder.Code != http.StatusUnprocessableEntity || !bytes.Contains(recorder.Body.Bytes(), []byte("unknown customer")) {
+        t.Errorf("POST /orders = %d %q, want 422 unknown customer", recorder.Code, recorder.Body)
+    }
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+)
+
+type DeliverOrderHandler struct {
+    Service *CommandService
+}
+
+// DeliverOrderRequest is optional; an empty body confirms the delivery now
+// with no details.
+type DeliverOrderRequest struct {
+    DeliveredAt      time.Time `json:"delivered_at"`
+    SignedBy         string    `json:"signed_by"`
+    CarrierReference string    `json:"carrier_reference"`
+    ExpectedVersion  *int      `json:"expected_version"`
+}
+
+func (h *DeliverOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    var req DeliverOrderRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    
+    ctx, ok := commandContext(w, r, req.ExpectedVersion)
+    if !ok {
+        return
+    }
+    
+    cmd := DeliverOrderCommand{
+        OrderID:          string(orderID),
+        DeliveredAt:      req.DeliveredAt,
+        SignedBy:         req.SignedBy,
+        CarrierReference: req.CarrierReference,
+    }
+    if err := h.Service.DeliverOrder(ctx, cmd); err != nil {
+        if writeVersionError(w, r, err) {
+            return
+        }
+        if errors.Is(err, entities.ErrDeliveryInFuture) || errors.Is(err, entities.ErrDeliveryBeforeShipment) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    w.WriteHeader(http.StatusOK)
+    w.Write([]byte("Order delivered successfully"))
+}
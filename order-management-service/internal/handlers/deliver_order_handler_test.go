@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+// Delivery details are validated against the clock and the shipment, and
+// recorded on the order and its OrderDelivered event; an empty body
+// confirms the delivery now with none.
+func TestDeliverOrderHandler(t *testing.T) {
+    shippedAt := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+    fake := clock.NewFake(shippedAt)
+    defer clock.Set(fake)()
+    f := newCommandFixture()
+    
+    tests := []struct {
+        name            string
+        body            string
+        wantCode        int
+        wantDeliveredAt time.Time
+        wantSignedBy    string
+        wantReference   string
+    }{
+        {
+            name:            "details",
+            body:            `{"delivered_at": "2024-03-15T13:30:00Z", "signed_by": " J. Doe ", "carrier_reference": " POD-123 "}`,
+            wantCode:        http.StatusOK,
+            wantDeliveredAt: shippedAt.Add(90 * time.Minute),
+            wantSignedBy:    "J. Doe",
+            wantReference:   "POD-123",
+        },
+        {
+            name:            "empty body",
+            wantCode:        http.StatusOK,
+            wantDeliveredAt: shippedAt.Add(2 * time.Hour),
+        },
+        {
+            name:     "in the future",
+            body:     `{"delivered_at": "2024-03-15T14:01:00Z"}`,
+            wantCode: http.StatusUnprocessableEntity,
+        },
+        {
+            name:     "before shipment",
+            body:     `{"delivered_at": "2024-03-15T11:59:00Z"}`,
+            wantCode: http.StatusUnprocessableEntity,
+        },
+        {
+            name:     "signer too long",
+            body:     `{"signed_by": "` + strings.Repeat("x", maxDeliveryDetailLength+1) + `"}`,
+            wantCode: http.StatusBadRequest,
+        },
+        {
+            name:     "invalid JSON",
+            body:     `{"signed_by":`,
+            wantCode: http.StatusBadRequest,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            fake.Set(shippedAt)
+            id := f.createOrder(t, uuid.NewString())
+            for _, command := range []orderCommand{confirmOrder, shipOrder} {
+                if err := command(ctx, f.service, id); err != nil {
+                    t.Fatalf("preparing the order: %v", err)
+                }
+            }
+            fake.Advance(2 * time.Hour)
+            
+            r := httptest.NewRequest(http.MethodPost, "/orders/"+string(id)+"/deliver", strings.NewReader(tt.body))
+            r = mux.SetURLVars(r, map[string]string{"id": string(id)})
+            w := httptest.NewRecorder()
+            (&DeliverOrderHandler{Service: f.service}).HandleHTTP(w, r)
+            if w.Code != tt.wantCode {
+                t.Fatalf("POST deliver = %d %q, want %d", w.Code, w.Body, tt.wantCode)
+            }
+            
+            if tt.wantCode != http.StatusOK {
+                if got := f.eventTypes(t, id, 3); len(got) != 0 || f.savedStatus(t, id) != "shipped" {
+                    t.Errorf("refused delivery stored %v and left the order %s, want nothing and shipped", got, f.savedStatus(t, id))
+                }
+                return
+            }
+            stored, err := f.store.GetEvents(ctx, string(id))
+            if err != nil {
+                t.Fatalf("GetEvents() = %v", err)
+            }
+            delivered, ok := stored[len(stored)-1].(events.OrderDeliveredEvent)
+            if !ok {
+                t.Fatalf("last event = %T, want OrderDeliveredEvent", stored[len(stored)-1])
+            }
+            if !delivered.DeliveredAt.Equal(tt.wantDeliveredAt) || delivered.SignedBy != tt.wantSignedBy || delivered.CarrierReference != tt.wantReference {
+                t.Errorf("OrderDelivered = %+v, want delivered at %s, signed by %q, reference %q", delivered, tt.wantDeliveredAt, tt.wantSignedBy, tt.wantReference)
+            }
+            saved, err := f.orders.FindByID(ctx, id)
+            if err != nil {
+                t.Fatalf("FindByID() = %v", err)
+            }
+            if !saved.DeliveredAt.Equal(tt.wantDeliveredAt) || saved.SignedBy != tt.wantSignedBy || saved.ShippedAt.IsZero() {
+                t.Errorf("saved order delivered at %s, signed by %q, shipped at %s", saved.DeliveredAt, saved.SignedBy, saved.ShippedAt)
+            }
+        })
+    }
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventfeed"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+)
+
+// EventFeedHandler pages through the events of every order in the order
+// they were stored, for consumers rebuilding their read models from the
+// whole history. Payloads are embedded as stored.
+type EventFeedHandler struct {
+    Service *CommandService
+}
+
+func (h *EventFeedHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    var after int64
+    if raw := r.URL.Query().Get("after"); raw != "" {
+        parsed, err := strconv.ParseInt(raw, 10, 64)
+        if err != nil || parsed < 0 {
+            http.Error(w, "Invalid after. Must be a non-negative position", http.StatusBadRequest)
+            return
+        }
+        after = parsed
+    }
+    
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 100}, eventfeed.MaxLimit)
+    if err != nil {
+        pagination.WriteError(w, err)
+        return
+    }
+    if page.Offset != 0 {
+        http.Error(w, "offset is not supported, page with after", http.StatusBadRequest)
+        return
+    }
+    
+    feed, err := h.Service.EventStore.GetEventsSince(r.Context(), after, page.Limit)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    response := eventfeed.Page{Events: feed, NextAfter: after}
+    if len(feed) > 0 {
+        response.NextAfter = feed[len(feed)-1].Position
+    }
+    
+    // Payloads are returned exactly as stored, so ?case=camel is not applied
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventfeed"
+)
+
+// Paging through the feed with the client returns every stored event once,
+// in position order.
+func TestEventFeedHandler_paging(t *testing.T) {
+    f := newCommandFixture()
+    for i := 0; i < 3; i++ {
+        f.createOrder(t, uuid.NewString())
+    }
+    stored, err := f.service.EventStore.GetEventsSince(context.Background(), 0, eventfeed.MaxLimit)
+    if err != nil {
+        t.Fatalf("GetEventsSince() = %v", err)
+    }
+    var want []int64
+    for _, event := range stored {
+        want = append(want, event.Position)
+    }
+    if len(want) < 3 {
+        t.Fatalf("stored %d events, want at least 3 to page through", len(want))
+    }
+    
+    server := httptest.NewServer(&feedServer{handler: &EventFeedHandler{Service: f.service}})
+    defer server.Close()
+    client, err := eventfeed.NewClient(apiclient.Config{BaseURL: server.URL})
+    if err != nil {
+        t.Fatalf("NewClient() = %v", err)
+    }
+    
+    var got []int64
+    var after int64
+    for pages := 0; ; pages++ {
+        if pages > len(want) {
+            t.Fatalf("feed did not end after %d pages", pages)
+        }
+        page, err := client.GetEventsSince(context.Background(), after, 2)
+        if err != nil {
+            t.Fatalf("GetEventsSince(%d) = %v", after, err)
+        }
+        for _, event := range page {
+            got = append(got, event.Position)
+            after = event.Position
+        }
+        if len(page) < 2 {
+            break
+        }
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("paged positions = %v, want %v", got, want)
+    }
+}
+
+// feedServer serves the feed handler at eventfeed.EventsPath.
+type feedServer struct {
+    handler *EventFeedHandler
+}
+
+func (s *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path != eventfeed.EventsPath {
+        http.NotFound(w, r)
+        return
+    }
+    s.handler.HandleHTTP(w, r)
+}
+
+func TestEventFeedHandler_page(t *testing.T) {
+    f := newCommandFixture()
+    f.createOrder(t, uuid.NewString())
+    handler := &EventFeedHandler{Service: f.service}
+    
+    tests := []struct {
+        name          string
+        query         string
+        wantStatus    int
+        wantParameter string
+        wantNextAfter int64
+        wantEvents    int
+    }{
+        {name: "first page", query: "", wantStatus: http.StatusOK, wantNextAfter: 1, wantEvents: 1},
+        {name: "past the end", query: "after=1", wantStatus: http.StatusOK, wantNextAfter: 1},
+        {name: "limit at the maximum", query: "limit=1000", wantStatus: http.StatusOK, wantNextAfter: 1, wantEvents: 1},
+        {name: "limit zero", query: "limit=0", wantStatus: http.StatusBadRequest, wantParameter: "limit"},
+        {name: "limit over the maximum", query: "limit=1001", wantStatus: http.StatusBadRequest, wantParameter: "limit"},
+        {name: "limit not a number", query: "limit=ten", wantStatus: http.StatusBadRequest, wantParameter: "limit"},
+        {name: "offset", query: "offset=5", wantStatus: http.StatusBadRequest},
+        {name: "negative after", query: "after=-1", wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodGet, eventfeed.EventsPath+"?"+tt.query, nil))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            
+            switch {
+            case tt.wantParameter != "":
+                var body struct {
+                    Error     string `json:"error"`
+                    Parameter string `json:"parameter"`
+                }
+                if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+                    t.Fatalf("decoding error body: %v", err)
+                }
+                if body.Error != "invalid_pagination" || body.Parameter != tt.wantParameter {
+                    t.Errorf("error body = %+v, want invalid_pagination of %s", body, tt.wantParameter)
+                }
+            case tt.wantStatus == http.StatusOK:
+                var page eventfeed.Page
+                if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+                    t.Fatalf("decoding page: %v", err)
+                }
+                if len(page.Events) != tt.wantEvents || page.NextAfter != tt.wantNextAfter {
+                    t.Errorf("page = %d events, next_after %d, want %d, %d", len(page.Events), page.NextAfter, tt.wantEvents, tt.wantNextAfter)
+                }
+            }
+        })
+    }
+}
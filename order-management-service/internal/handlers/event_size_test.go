@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/internal/repositories"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+// itemsJSON returns count order lines of one unit at 10.00 USD.
+func itemsJSON(count int) string {
+    items := make([]string, count)
+    for i := range items {
+        items[i] = fmt.Sprintf(`{"product_id": "product-%03d", "quantity": 1, "price": {"amount": 1000, "currency": "USD"}}`, i)
+    }
+    return "[" + strings.Join(items, ", ") + "]"
+}
+
+// Changes whose events are over the event store's limit are refused with
+// 422, and nothing is saved for them. Patches record an event per change,
+// so only a bloated address makes one too large.
+func TestHandlers_eventTooLarge(t *testing.T) {
+    f := newCommandFixture()
+    store := repositories.NewMemoryEventStore(events.DefaultRegistry(), repositories.WithMaxEventBytes(4096))
+    f.store, f.service.EventStore, f.work.store = store, store, store
+    id := f.createOrder(t, uuid.NewString())
+    f.outbox.types = nil
+    
+    t.Run("create", func(t *testing.T) {
+        body := `{
+            "customer_id": "` + uuid.NewString() + `",
+            "items": ` + itemsJSON(100) + `,
+            "shipping_address": {"street": "1 Main St", "city": "Springfield", "state": "IL", "zip": "62701", "country": "US"}
+        }`
+        recorder := httptest.NewRecorder()
+        (&CreateOrderHandler{Service: f.service}).HandleHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+        if recorder.Code != http.StatusUnprocessableEntity {
+            t.Fatalf("POST /orders = %d %q, want 422", recorder.Code, recorder.Body)
+        }
+        // The error names the event and the setting to raise
+        for _, want := range []string{"OrderCreated", "EVENT_STORE_MAX_EVENT_BYTES"} {
+            if !strings.Contains(recorder.Body.String(), want) {
+                t.Errorf("body %q does not mention %q", recorder.Body, want)
+            }
+        }
+        if len(f.orders.orders) != 1 || len(f.outbox.types) != 0 {
+            t.Errorf("saved %d orders and %d outbox events, want only the first order", len(f.orders.orders), len(f.outbox.types))
+        }
+    })
+    
+    t.Run("patch", func(t *testing.T) {
+        w := patchOrder(f, id, MergePatchContentType, `{"shipping_address": {"street": "`+strings.Repeat("x", 5000)+`"}}`)
+        if w.Code != http.StatusUnprocessableEntity {
+            t.Fatalf("PATCH = %d %q, want 422", w.Code, w.Body)
+        }
+        if got := f.eventTypes(t, id, 1); len(got) != 0 {
+            t.Errorf("stored events after the refused patch = %v, want none", got)
+        }
+        if saved := f.orders.orders[id]; saved.ShippingAddress.Street != "1 Main St" {
+            t.Errorf("saved order ships to %.20q, want 1 Main St", saved.ShippingAddress.Street)
+        }
+    })
+}
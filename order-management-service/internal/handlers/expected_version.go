@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/internal/repositories"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// ErrVersionConflict is matched by the errors returned for commands that
+// expected an order at another version than the one it is at, or that
+// raced another writer.
+var ErrVersionConflict = repositories.ErrVersionConflict
+
+// ErrVersionRequired is returned when the service's StrictConcurrency is
+// set, or its strict_concurrency flag is on, and a command does not say which order version it expects.
+var ErrVersionRequired = errors.New("expected order version is required")
+
+// VersionConflictError reports a command that expected an order at another
+// version than the one it is at.
+type VersionConflictError struct {
+    OrderID   entities.OrderID
+    Expected  int
+    Current   int
+    UpdatedAt time.Time
+}
+
+func (e *VersionConflictError) Error() string {
+    return fmt.Sprintf("%v: order %s is at version %d, not %d", ErrVersionConflict, e.OrderID, e.Current, e.Expected)
+}
+
+// Is makes errors.Is match ErrVersionConflict.
+func (e *VersionConflictError) Is(target error) bool {
+    return target == ErrVersionConflict
+}
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion makes the commands run with the returned context
+// fail with a *VersionConflictError unless the order is at version.
+func WithExpectedVersion(ctx context.Context, version int) context.Context {
+    return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+func expectedVersion(ctx context.Context) (int, bool) {
+    version, ok := ctx.Value(expectedVersionKey{}).(int)
+    return version, ok
+}
+
+// checkVersion compares order with the version the command expects.
+func (cs *CommandService) checkVersion(ctx context.Context, order *entities.Order) error {
+    expected, ok := expectedVersion(ctx)
+    if !ok {
+        if cs.strictConcurrency() {
+            return ErrVersionRequired
+        }
+        return nil
+    }
+    if order.Version != expected {
+        return &VersionConflictError{OrderID: order.ID, Expected: expected, Current: order.Version, UpdatedAt: order.UpdatedAt}
+    }
+    return nil
+}
+
+// ExpectedVersionRequest is the optional body of commands taking nothing
+// else, which may name the order version they expect in it rather than in
+// If-Match.
+type ExpectedVersionRequest struct {
+    ExpectedVersion *int `json:"expected_version"`
+}
+
+// commandContext returns the request's context, expecting the order
+// version its If-Match header names, such as "3", or else bodyVersion, the
+// expected_version of its body. A malformed header, a negative version or
+// a header and body naming different versions are answered with 400.
+func commandContext(w http.ResponseWriter, r *http.Request, bodyVersion *int) (context.Context, bool) {
+    header := r.Header.Get("If-Match")
+    if header == "" && bodyVersion == nil {
+        return r.Context(), true
+    }
+    if header == "" {
+        if *bodyVersion < 0 {
+            http.Error(w, "expected_version must be the order version the change applies to, such as 3", http.StatusBadRequest)
+            return nil, false
+        }
+        return WithExpectedVersion(r.Context(), *bodyVersion), true
+    }
+    
+    version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(strings.TrimSpace(header), "W/"), `"`))
+    if err != nil || version < 0 {
+        http.Error(w, `If-Match must be the order version the change applies to, such as "3"`, http.StatusBadRequest)
+        return nil, false
+    }
+    if bodyVersion != nil && *bodyVersion != version {
+        http.Error(w, fmt.Sprintf("If-Match names version %d but expected_version is %d", version, *bodyVersion), http.StatusBadRequest)
+        return nil, false
+    }
+    return WithExpectedVersion(r.Context(), version), true
+}
+
+// decodeExpectedVersion reads the optional body of a command taking
+// nothing but the expected version, answering 400 when it is malformed.
+func decodeExpectedVersion(w http.ResponseWriter, r *http.Request) (*int, bool) {
+    var req ExpectedVersionRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return nil, false
+    }
+    return req.ExpectedVersion, true
+}
+
+// writeVersionError answers a command that failed for the order version it
+// expected, reporting whether err was such a failure. Conflicts are
+// answered with 409 and the order's current version and update time, when
+// known, so the client can reload the order and retry.
+func writeVersionError(w http.ResponseWriter, r *http.Request, err error) bool {
+    if errors.Is(err, ErrVersionRequired) {
+        http.Error(w, "If-Match or expected_version with the order version is required", http.StatusPreconditionRequired)
+        return true
+    }
+    if !errors.Is(err, ErrVersionConflict) {
+        return false
+    }
+    
+    var conflict *VersionConflictError
+    if !errors.As(err, &conflict) {
+        http.Error(w, err.Error(), http.StatusConflict)
+        return true
+    }
+    apijson.Write(w, r, http.StatusConflict, map[string]interface{}{
+        "error":           conflict.Error(),
+        "current_version": conflict.Current,
+        "updated_at":      apijson.NewTimestamp(conflict.UpdatedAt),
+    })
+    return true
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The expected version comes from If-Match or the body's
+// expected_version, which must agree when both are given.
+func TestCommandContext(t *testing.T) {
+    tests := []struct {
+        name        string
+        ifMatch     string
+        body        string
+        wantVersion int
+        wantExpect  bool
+        wantStatus  int
+    }{
+        {name: "neither", body: `{}`},
+        {name: "no body", body: ``},
+        {name: "If-Match", ifMatch: `"3"`, wantVersion: 3, wantExpect: true},
+        {name: "weak If-Match", ifMatch: `W/"3"`, wantVersion: 3, wantExpect: true},
+        {name: "expected_version", body: `{"expected_version": 3}`, wantVersion: 3, wantExpect: true},
+        {name: "version zero", body: `{"expected_version": 0}`, wantVersion: 0, wantExpect: true},
+        {name: "both agree", ifMatch: `"3"`, body: `{"expected_version": 3}`, wantVersion: 3, wantExpect: true},
+        {name: "both disagree", ifMatch: `"3"`, body: `{"expected_version": 4}`, wantStatus: http.StatusBadRequest},
+        {name: "negative expected_version", body: `{"expected_version": -1}`, wantStatus: http.StatusBadRequest},
+        {name: "malformed If-Match", ifMatch: `"three"`, wantStatus: http.StatusBadRequest},
+        {name: "expected_version not a number", body: `{"expected_version": "3"}`, wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodPost, "/orders/order-1/confirm", strings.NewReader(tt.body))
+            if tt.ifMatch != "" {
+                r.Header.Set("If-Match", tt.ifMatch)
+            }
+            w := httptest.NewRecorder()
+            
+            expected, ok := decodeExpectedVersion(w, r)
+            if ok {
+                var ctx context.Context
+                if ctx, ok = commandContext(w, r, expected); ok {
+                    version, expects := expectedVersion(ctx)
+                    if expects != tt.wantExpect || version != tt.wantVersion {
+                        t.Errorf("expected version = %d, %t, want %d, %t", version, expects, tt.wantVersion, tt.wantExpect)
+                    }
+                }
+            }
+            if tt.wantStatus == 0 {
+                if !ok {
+                    t.Fatalf("request refused with %d: %s", w.Code, w.Body)
+                }
+                return
+            }
+            if ok || w.Code != tt.wantStatus {
+                t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+            }
+        })
+    }
+}
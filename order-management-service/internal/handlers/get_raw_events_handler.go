@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+)
+
+const maxRawEventsLimit = 500
+
+// GetRawEventsHandler returns an order's events exactly as the event store
+// holds them, for debugging. Payloads are embedded as JSON objects.
+type GetRawEventsHandler struct {
+    Service *CommandService
+}
+
+func (h *GetRawEventsHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 100}, maxRawEventsLimit)
+    if err != nil {
+        pagination.WriteError(w, err)
+        return
+    }
+    
+    rawEvents, total, err := h.Service.EventStore.GetRawEvents(r.Context(), string(orderID), page)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    if total == 0 {
+        http.Error(w, "no events for order", http.StatusNotFound)
+        return
+    }
+    
+    response := map[string]interface{}{
+        "aggregate_id": orderID,
+        "events":       rawEvents,
+        "pagination": map[string]interface{}{
+            "limit":  page.Limit,
+            "offset": page.Offset,
+            "count":  len(rawEvents),
+            "total":  total,
+        },
+    }
+    
+    // Payloads are returned exactly as stored, so ?case=camel is not applied
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
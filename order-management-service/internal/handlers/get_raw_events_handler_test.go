@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestGetRawEventsHandler(t *testing.T) {
+    f := newCommandFixture()
+    id := f.createOrder(t, uuid.NewString())
+    if err := f.service.ConfirmOrder(context.Background(), id); err != nil {
+        t.Fatalf("ConfirmOrder() = %v", err)
+    }
+    stored := f.eventTypes(t, id, 0)
+    handler := &GetRawEventsHandler{Service: f.service}
+    
+    tests := []struct {
+        name        string
+        id          string
+        query       string
+        wantStatus  int
+        wantTypes   []string
+        wantVersion int
+    }{
+        {name: "whole stream", id: string(id), wantStatus: http.StatusOK, wantTypes: stored, wantVersion: 1},
+        {name: "second page", id: string(id), query: "?limit=1&offset=1", wantStatus: http.StatusOK, wantTypes: stored[1:2], wantVersion: 2},
+        {name: "past the end", id: string(id), query: "?offset=100", wantStatus: http.StatusOK},
+        {name: "no events", id: uuid.NewString(), wantStatus: http.StatusNotFound},
+        {name: "invalid id", id: "not-an-id", wantStatus: http.StatusBadRequest},
+        {name: "limit over the maximum", id: string(id), query: "?limit=501", wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, "/api/v1/orders/"+tt.id+"/raw-events"+tt.query, nil)
+            r = mux.SetURLVars(r, map[string]string{"id": tt.id})
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, r)
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+            
+            var body struct {
+                Events []struct {
+                    EventType string          `json:"event_type"`
+                    Version   int             `json:"version"`
+                    Payload   json.RawMessage `json:"payload"`
+                } `json:"events"`
+                Pagination struct {
+                    Total int `json:"total"`
+                } `json:"pagination"`
+            }
+            if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+                t.Fatalf("decoding response: %v", err)
+            }
+            if body.Pagination.Total != len(stored) {
+                t.Errorf("total = %d, want %d", body.Pagination.Total, len(stored))
+            }
+            var types []string
+            for _, event := range body.Events {
+                types = append(types, event.EventType)
+                // Payloads are embedded objects, not encoded strings
+                if len(event.Payload) == 0 || event.Payload[0] != '{' {
+                    t.Errorf("%s payload = %s, want a JSON object", event.EventType, event.Payload)
+                }
+            }
+            if !reflect.DeepEqual(types, tt.wantTypes) {
+                t.Errorf("event types = %v, want %v", types, tt.wantTypes)
+            }
+            if len(body.Events) > 0 && body.Events[0].Version != tt.wantVersion {
+                t.Errorf("first version = %d, want %d", body.Events[0].Version, tt.wantVersion)
+            }
+        })
+    }
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+)
+
+// heartbeatStats is published as the "pipeline_heartbeats" expvar:
+// heartbeats saved to the outbox and heartbeats that failed to save since
+// start.
+var heartbeatStats = expvar.NewMap("pipeline_heartbeats")
+
+// HeartbeatPublisher saves a PipelineHeartbeatEvent to the outbox every
+// Interval. The outbox publisher sends them like any other event, so the
+// reporting service measures the delay of the whole pipeline from them.
+type HeartbeatPublisher struct {
+    // Disabled makes Run return at once
+    Disabled bool
+    Outbox   outbox.Repository
+    Interval time.Duration
+    // Source names this process in the heartbeats
+    Source   string
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+}
+
+// Run sends a heartbeat at start and then every Interval until ctx is done.
+func (p *HeartbeatPublisher) Run(ctx context.Context) error {
+    if p.Disabled {
+        return nil
+    }
+    
+    ticker := time.NewTicker(p.Interval)
+    defer ticker.Stop()
+    
+    for {
+        if err := p.PublishOnce(ctx); err != nil {
+            log.Printf("Error saving pipeline heartbeat: %v", err)
+        }
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// PublishOnce saves one heartbeat, stamped with the current time.
+func (p *HeartbeatPublisher) PublishOnce(ctx context.Context) error {
+    now := clock.Now()
+    if p.Now != nil {
+        now = p.Now()
+    }
+    
+    if err := p.Outbox.SaveEvent(ctx, events.NewPipelineHeartbeatEvent(p.Source, now)); err != nil {
+        heartbeatStats.Add("errors", 1)
+        return err
+    }
+    heartbeatStats.Add("sent", 1)
+    return nil
+}
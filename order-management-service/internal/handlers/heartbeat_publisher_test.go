@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+)
+
+// heartbeatOutbox keeps the events saved to it, or fails with err.
+type heartbeatOutbox struct {
+    outbox.Repository
+    err   error
+    saved []events.DomainEvent
+}
+
+func (o *heartbeatOutbox) SaveEvent(_ context.Context, event events.DomainEvent) error {
+    if o.err != nil {
+        return o.err
+    }
+    o.saved = append(o.saved, event)
+    return nil
+}
+
+func heartbeatStat(name string) int64 {
+    if v, ok := heartbeatStats.Get(name).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
+
+// Each heartbeat is saved to the outbox with the process's source and the
+// time it was sent; a failed save is counted and returned.
+func TestHeartbeatPublisher_PublishOnce(t *testing.T) {
+    sentAt := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+    store := &heartbeatOutbox{}
+    publisher := &HeartbeatPublisher{Outbox: store, Interval: time.Minute, Source: "management-1", Now: func() time.Time { return sentAt }}
+    sent, failed := heartbeatStat("sent"), heartbeatStat("errors")
+    
+    if err := publisher.PublishOnce(context.Background()); err != nil {
+        t.Fatalf("PublishOnce() = %v", err)
+    }
+    if len(store.saved) != 1 {
+        t.Fatalf("saved %d events, want 1", len(store.saved))
+    }
+    heartbeat, ok := store.saved[0].(events.PipelineHeartbeatEvent)
+    if !ok {
+        t.Fatalf("saved %T, want events.PipelineHeartbeatEvent", store.saved[0])
+    }
+    if heartbeat.Source != "management-1" || !heartbeat.SentAt.Equal(sentAt) || heartbeat.AggregateID() != events.PipelineHeartbeatAggregateID {
+        t.Errorf("heartbeat = %+v, want one from management-1 sent at %v", heartbeat, sentAt)
+    }
+    
+    store.err = errors.New("connection refused")
+    if err := publisher.PublishOnce(context.Background()); !errors.Is(err, store.err) {
+        t.Errorf("PublishOnce() = %v, want %v", err, store.err)
+    }
+    if got := heartbeatStat("sent") - sent; got != 1 {
+        t.Errorf("sent grew by %d, want 1", got)
+    }
+    if got := heartbeatStat("errors") - failed; got != 1 {
+        t.Errorf("errors grew by %d, want 1", got)
+    }
+}
+
+// A disabled publisher saves nothing.
+func TestHeartbeatPublisher_disabled(t *testing.T) {
+    store := &heartbeatOutbox{}
+    publisher := &HeartbeatPublisher{Disabled: true, Outbox: store, Interval: time.Minute}
+    if err := publisher.Run(context.Background()); err != nil || len(store.saved) != 0 {
+        t.Errorf("Run() = %v after saving %d events, want nil and none", err, len(store.saved))
+    }
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// HoldOrderHandler puts a confirmed order on hold, as for fraud review.
+// Mount it behind the admin key.
+type HoldOrderHandler struct {
+    Service *CommandService
+}
+
+type HoldOrderRequest struct {
+    Reason          string `json:"reason"`
+    ExpectedVersion *int   `json:"expected_version"`
+}
+
+func (h *HoldOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    var req HoldOrderRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    
+    ctx, ok := commandContext(w, r, req.ExpectedVersion)
+    if !ok {
+        return
+    }
+    
+    cmd := HoldOrderCommand{OrderID: string(orderID), Reason: strings.TrimSpace(req.Reason)}
+    if err := h.Service.HoldOrder(ctx, cmd); err != nil {
+        if writeVersionError(w, r, err) {
+            return
+        }
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    w.WriteHeader(http.StatusOK)
+    w.Write([]byte("Order held successfully"))
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// A confirmed order is held with a reason, cannot be shipped while held,
+// and is released, with or without a reason, back to confirmed; the events
+// carry the reasons.
+func TestHoldAndReleaseOrderHandlers(t *testing.T) {
+    ctx := context.Background()
+    f := newCommandFixture()
+    id := f.createOrder(t, uuid.NewString())
+    if err := confirmOrder(ctx, f.service, id); err != nil {
+        t.Fatalf("ConfirmOrder() = %v", err)
+    }
+    post := func(handler func(http.ResponseWriter, *http.Request), action, body string) *httptest.ResponseRecorder {
+        r := httptest.NewRequest(http.MethodPost, "/orders/"+string(id)+"/"+action, strings.NewReader(body))
+        r = mux.SetURLVars(r, map[string]string{"id": string(id)})
+        w := httptest.NewRecorder()
+        handler(w, r)
+        return w
+    }
+    hold := (&HoldOrderHandler{Service: f.service}).HandleHTTP
+    release := (&ReleaseOrderHandler{Service: f.service}).HandleHTTP
+    lastEvent := func() events.DomainEvent {
+        t.Helper()
+        stored, err := f.store.GetEvents(ctx, string(id))
+        if err != nil {
+            t.Fatalf("GetEvents() = %v", err)
+        }
+        return stored[len(stored)-1]
+    }
+    
+    if w := post(hold, "hold", `{"reason": "  "}`); w.Code != http.StatusBadRequest {
+        t.Errorf("hold without a reason = %d %q, want 400", w.Code, w.Body)
+    }
+    if w := post(release, "release", ""); w.Code != http.StatusBadRequest {
+        t.Errorf("release of a confirmed order = %d %q, want 400", w.Code, w.Body)
+    }
+    if got := f.eventTypes(t, id, 2); len(got) != 0 {
+        t.Fatalf("refused requests stored %v, want nothing", got)
+    }
+    
+    if w := post(hold, "hold", `{"reason": " fraud review "}`); w.Code != http.StatusOK {
+        t.Fatalf("hold = %d %q, want 200", w.Code, w.Body)
+    }
+    if held, ok := lastEvent().(events.OrderHeldEvent); !ok || held.Reason != "fraud review" {
+        t.Errorf("last event = %+v, want OrderHeld for fraud review", lastEvent())
+    }
+    if got := f.savedStatus(t, id); got != valueobjects.OrderStatusOnHold {
+        t.Errorf("held order saved as %s, want on_hold", got)
+    }
+    if err := shipOrder(ctx, f.service, id); !errors.Is(err, entities.ErrOrderOnHold) {
+        t.Errorf("ShipOrder() on hold = %v, want ErrOrderOnHold", err)
+    }
+    
+    if w := post(release, "release", ""); w.Code != http.StatusOK {
+        t.Fatalf("release = %d %q, want 200", w.Code, w.Body)
+    }
+    if released, ok := lastEvent().(events.OrderReleasedEvent); !ok || released.HoldReason != "fraud review" || released.Reason != "" {
+        t.Errorf("last event = %+v, want OrderReleased from the fraud review hold", lastEvent())
+    }
+    if got := f.savedStatus(t, id); got != valueobjects.OrderStatusConfirmed {
+        t.Errorf("released order saved as %s, want confirmed", got)
+    }
+    if err := shipOrder(ctx, f.service, id); err != nil {
+        t.Errorf("ShipOrder() after the release = %v", err)
+    }
+}
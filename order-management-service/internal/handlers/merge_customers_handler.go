@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// MergeCustomersHandler merges the customer {id} into the customer the
+// request names. Mount it behind the admin key.
+type MergeCustomersHandler struct {
+    Service *CommandService
+}
+
+type MergeCustomersRequest struct {
+    TargetCustomerID string `json:"target_customer_id"`
+}
+
+func (h *MergeCustomersHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    sourceID, err := entities.ParseCustomerID(mux.Vars(r)["id"])
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    var req MergeCustomersRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    
+    // Customer ids are stored in the lower case form ParseCustomerID
+    // returns
+    cmd := MergeCustomersCommand{SourceCustomerID: string(sourceID), TargetCustomerID: req.TargetCustomerID}
+    if targetID, err := entities.ParseCustomerID(req.TargetCustomerID); err == nil {
+        cmd.TargetCustomerID = string(targetID)
+    }
+    
+    result, err := h.Service.MergeCustomers(r.Context(), cmd)
+    if err != nil {
+        if errors.Is(err, ErrCustomerMerged) {
+            http.Error(w, err.Error(), http.StatusConflict)
+            return
+        }
+        if errors.Is(err, ErrUnknownCustomer) {
+            http.Error(w, "unknown target customer", http.StatusUnprocessableEntity)
+            return
+        }
+        if errors.Is(err, ErrCustomerMergesUnavailable) {
+            http.Error(w, err.Error(), http.StatusServiceUnavailable)
+            return
+        }
+        if writeVersionError(w, r, err) {
+            return
+        }
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    apijson.Write(w, r, http.StatusOK, result)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
+)
+
+// ErrOrderRateLimited is returned by CreateOrder when the customer has
+// already created OrderRateLimit.MaxOrders orders within the window.
+var ErrOrderRateLimited = errors.New("too many orders for customer")
+
+// ErrOrderRejected is returned by CreateOrder when the fraud check refuses
+// the order.
+var ErrOrderRejected = errors.New("order rejected by fraud check")
+
+// OrderRateLimit caps how many orders, in any status, one customer may
+// create within a sliding window. The count is read from the orders table,
+// so it holds across instances, but concurrent creations for the same
+// customer may pass it by a few orders.
+type OrderRateLimit struct {
+    // MaxOrders per customer within Window; zero disables the limit
+    MaxOrders int
+    Window    time.Duration
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+}
+
+func (l OrderRateLimit) enabled() bool {
+    return l.MaxOrders > 0 && l.Window > 0
+}
+
+func (l OrderRateLimit) now() time.Time {
+    if l.Now == nil {
+        return clock.Now()
+    }
+    return l.Now()
+}
+
+// OrderRateLimitFromEnv reads ORDER_RATE_LIMIT_MAX and
+// ORDER_RATE_LIMIT_WINDOW, such as 20 and 1h. The limit is disabled unless
+// both are set.
+func OrderRateLimitFromEnv() OrderRateLimit {
+    var limit OrderRateLimit
+    if value, err := strconv.Atoi(os.Getenv("ORDER_RATE_LIMIT_MAX")); err == nil && value > 0 {
+        limit.MaxOrders = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("ORDER_RATE_LIMIT_WINDOW")); err == nil && value > 0 {
+        limit.Window = value
+    }
+    return limit
+}
+
+// FraudCheck scores an order before it is created. Evaluate returns false
+// with a reason to refuse it. Implementations decide themselves whether to
+// allow orders when their scoring service is unavailable.
+type FraudCheck interface {
+    Evaluate(ctx context.Context, cmd CreateOrderCommand) (allow bool, reason string)
+}
+
+// AllowAllFraudCheck allows every order; it is the default until a scoring
+// service is plugged in.
+type AllowAllFraudCheck struct{}
+
+func (AllowAllFraudCheck) Evaluate(context.Context, CreateOrderCommand) (bool, string) {
+    return true, ""
+}
+
+// admissionStats is published as the "order_admission" expvar: orders
+// allowed, refused by the rate limit and rejected by the fraud check, plus
+// failed rate limit lookups.
+var admissionStats = expvar.NewMap("order_admission")
+
+// admitOrder applies the rate limit and the fraud check to a new order,
+// logging refusals with the customer and the request that asked.
+func (cs *CommandService) admitOrder(ctx context.Context, cmd CreateOrderCommand) error {
+    actor := fmt.Sprintf("customer %s (request %s, admin %t)", cmd.CustomerID, httpmw.RequestIDFromContext(ctx), httpmw.IsAdmin(ctx))
+    if cmd.CustomerID == "" {
+        // The email is left out of the logs, as personal data
+        actor = fmt.Sprintf("guest checkout (request %s, admin %t)", httpmw.RequestIDFromContext(ctx), httpmw.IsAdmin(ctx))
+    }
+    
+    if limit := cs.RateLimit; limit.enabled() {
+        count, err := cs.countRecentOrders(ctx, cmd, limit.now().Add(-limit.Window))
+        if err != nil {
+            admissionStats.Add("rate_limit_errors", 1)
+            return fmt.Errorf("failed to check order rate limit: %w", err)
+        }
+        if count >= limit.MaxOrders {
+            admissionStats.Add("rate_limited", 1)
+            log.Printf("Refused order for %s: %d orders within %s", actor, count, limit.Window)
+            return fmt.Errorf("%w: at most %d orders per %s", ErrOrderRateLimited, limit.MaxOrders, limit.Window)
+        }
+    }
+    
+    if cs.FraudCheck != nil {
+        if allow, reason := cs.FraudCheck.Evaluate(ctx, cmd); !allow {
+            admissionStats.Add("fraud_rejected", 1)
+            log.Printf("Fraud check rejected order for %s: %s", actor, reason)
+            return fmt.Errorf("%w: %s", ErrOrderRejected, reason)
+        }
+    }
+    
+    admissionStats.Add("allowed", 1)
+    return nil
+}
+
+// countRecentOrders counts the orders created since by cmd's customer or,
+// for a guest checkout, by guests with its contact email.
+func (cs *CommandService) countRecentOrders(ctx context.Context, cmd CreateOrderCommand, since time.Time) (int, error) {
+    if cmd.CustomerID != "" {
+        return cs.OrderRepo.CountCreatedSince(ctx, cmd.CustomerID, since)
+    }
+    // Validate has already accepted the email
+    contactEmail, _ := valueobjects.ParseEmail(cmd.ContactEmail)
+    return cs.OrderRepo.CountGuestOrdersSince(ctx, contactEmail, since)
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// fakeFraudCheck refuses the customers in refused and records the
+// customers it was asked about.
+type fakeFraudCheck struct {
+    refused   map[string]string
+    evaluated []string
+}
+
+func (c *fakeFraudCheck) Evaluate(_ context.Context, cmd CreateOrderCommand) (bool, string) {
+    c.evaluated = append(c.evaluated, cmd.CustomerID)
+    if reason, ok := c.refused[cmd.CustomerID]; ok {
+        return false, reason
+    }
+    return true, ""
+}
+
+func admissionStat(name string) int64 {
+    if value, ok := admissionStats.Get(name).(*expvar.Int); ok {
+        return value.Value()
+    }
+    return 0
+}
+
+func createOrderCommand(customerID, contactEmail string) CreateOrderCommand {
+    return CreateOrderCommand{
+        CustomerID:      customerID,
+        ContactEmail:    contactEmail,
+        Items:           []OrderItemCommand{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")}},
+        ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+    }
+}
+
+// The rate limit counts each customer's orders, and each guest email's,
+// within a window sliding with the clock.
+func TestCommandService_CreateOrder_rateLimit(t *testing.T) {
+    ctx := context.Background()
+    fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    defer clock.Set(fake)()
+    f := newCommandFixture()
+    f.service.RateLimit = OrderRateLimit{MaxOrders: 2, Window: time.Hour, Now: fake.Now}
+    customerID, otherID := uuid.NewString(), uuid.NewString()
+    
+    create := func(cmd CreateOrderCommand) error {
+        _, err := f.service.CreateOrder(ctx, cmd)
+        return err
+    }
+    limited := admissionStat("rate_limited")
+    for i := 0; i < 2; i++ {
+        if err := create(createOrderCommand(customerID, "")); err != nil {
+            t.Fatalf("CreateOrder() %d = %v", i+1, err)
+        }
+        fake.Advance(10 * time.Minute)
+    }
+    if err := create(createOrderCommand(customerID, "")); !errors.Is(err, ErrOrderRateLimited) {
+        t.Errorf("CreateOrder() over the limit = %v, want ErrOrderRateLimited", err)
+    }
+    if err := create(createOrderCommand(otherID, "")); err != nil {
+        t.Errorf("CreateOrder() for another customer = %v", err)
+    }
+    if got := admissionStat("rate_limited") - limited; got != 1 {
+        t.Errorf("rate_limited grew by %d, want 1", got)
+    }
+    
+    // The first order leaves the window an hour after it was created
+    fake.Advance(41 * time.Minute)
+    if err := create(createOrderCommand(customerID, "")); err != nil {
+        t.Errorf("CreateOrder() once the first order left the window = %v", err)
+    }
+    
+    for i := 0; i < 2; i++ {
+        if err := create(createOrderCommand("", "guest@example.com")); err != nil {
+            t.Fatalf("CreateOrder() for a guest %d = %v", i+1, err)
+        }
+    }
+    if err := create(createOrderCommand("", "guest@example.com")); !errors.Is(err, ErrOrderRateLimited) {
+        t.Errorf("CreateOrder() for a guest over the limit = %v, want ErrOrderRateLimited", err)
+    }
+}
+
+// The fraud check is asked about every order the rate limit lets through,
+// and an order it refuses is not created.
+func TestCommandService_CreateOrder_fraudCheck(t *testing.T) {
+    ctx := context.Background()
+    f := newCommandFixture()
+    refusedID, allowedID := uuid.NewString(), uuid.NewString()
+    check := &fakeFraudCheck{refused: map[string]string{refusedID: "velocity score 0.97"}}
+    f.service.FraudCheck = check
+    rejected := admissionStat("fraud_rejected")
+    
+    _, err := f.service.CreateOrder(ctx, createOrderCommand(refusedID, ""))
+    if !errors.Is(err, ErrOrderRejected) || err.Error() != "order rejected by fraud check: velocity score 0.97" {
+        t.Errorf("CreateOrder() refused = %v, want ErrOrderRejected with the reason", err)
+    }
+    if ids, _ := f.orders.ListCustomerOrderIDs(ctx, refusedID); len(ids) != 0 {
+        t.Errorf("refused customer has orders %v", ids)
+    }
+    if got := admissionStat("fraud_rejected") - rejected; got != 1 {
+        t.Errorf("fraud_rejected grew by %d, want 1", got)
+    }
+    
+    if _, err := f.service.CreateOrder(ctx, createOrderCommand(allowedID, "")); err != nil {
+        t.Errorf("CreateOrder() allowed = %v", err)
+    }
+    if want := []string{refusedID, allowedID}; !reflect.DeepEqual(check.evaluated, want) {
+        t.Errorf("evaluated %v, want %v", check.evaluated, want)
+    }
+    
+    // Orders refused by the rate limit are not scored
+    f.service.RateLimit = OrderRateLimit{MaxOrders: 1, Window: time.Hour}
+    if _, err := f.service.CreateOrder(ctx, createOrderCommand(allowedID, "")); !errors.Is(err, ErrOrderRateLimited) {
+        t.Errorf("CreateOrder() over the limit = %v, want ErrOrderRateLimited", err)
+    }
+    if len(check.evaluated) != 2 {
+        t.Errorf("evaluated %v, want the rate limited order left unscored", check.evaluated)
+    }
+}
+
+// The handler answers a rate limited order with 429 and a Retry-After of
+// the window, and a refused one with 422.
+func TestCreateOrderHandler_admission(t *testing.T) {
+    refusedID := uuid.NewString()
+    tests := []struct {
+        name           string
+        customerID     string
+        existing       int
+        wantStatus     int
+        wantRetryAfter string
+    }{
+        {name: "allowed", customerID: uuid.NewString(), wantStatus: http.StatusCreated},
+        {name: "rate limited", customerID: uuid.NewString(), existing: 1, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "1800"},
+        {name: "fraud", customerID: refusedID, wantStatus: http.StatusUnprocessableEntity},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            for i := 0; i < tt.existing; i++ {
+                f.createOrder(t, tt.customerID)
+            }
+            f.service.RateLimit = OrderRateLimit{MaxOrders: 1, Window: 30 * time.Minute}
+            f.service.FraudCheck = &fakeFraudCheck{refused: map[string]string{refusedID: "chargeback history"}}
+            body, err := json.Marshal(createOrderCommand(tt.customerID, ""))
+            if err != nil {
+                t.Fatalf("json.Marshal: %v", err)
+            }
+            
+            recorder := httptest.NewRecorder()
+            (&CreateOrderHandler{Service: f.service}).HandleHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body)))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            if got := recorder.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+                t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+            }
+        })
+    }
+}
+
+func TestOrderRateLimitFromEnv(t *testing.T) {
+    tests := []struct {
+        max    string
+        window string
+        want   OrderRateLimit
+    }{
+        {max: "20", window: "1h", want: OrderRateLimit{MaxOrders: 20, Window: time.Hour}},
+        {max: "20", window: "", want: OrderRateLimit{MaxOrders: 20}},
+        {max: "", window: "1h", want: OrderRateLimit{Window: time.Hour}},
+        {max: "-1", window: "soon", want: OrderRateLimit{}},
+    }
+    
+    for _, tt := range tests {
+        t.Setenv("ORDER_RATE_LIMIT_MAX", tt.max)
+        t.Setenv("ORDER_RATE_LIMIT_WINDOW", tt.window)
+        got := OrderRateLimitFromEnv()
+        if got.MaxOrders != tt.want.MaxOrders || got.Window != tt.want.Window {
+            t.Errorf("OrderRateLimitFromEnv() with %q, %q = %+v, want %+v", tt.max, tt.window, got, tt.want)
+        }
+        if got.enabled() != (tt.max == "20" && tt.window == "1h") {
+            t.Errorf("enabled() with %q, %q = %t", tt.max, tt.window, got.enabled())
+        }
+    }
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+// ErrNoOrderAsOf is returned by OrderAsOf when the order had no events at
+// the requested point in its history.
+var ErrNoOrderAsOf = errors.New("order did not exist at the requested point")
+
+// AsOf selects a point in an order's history: the state after the event
+// with the given version, or else the state at the given time.
+type AsOf struct {
+    Version int
+    Time    time.Time
+}
+
+// OrderAsOfResult is an order rebuilt from the events up to a point in its
+// history.
+type OrderAsOfResult struct {
+    Order         *entities.Order
+    AppliedEvents int
+    LastEvent     events.DomainEvent
+}
+
+// OrderAsOf replays the order's stored events up to point. Versions are
+// contiguous from 1, so the first n events are the state at version n.
+func (cs *CommandService) OrderAsOf(ctx context.Context, orderID entities.OrderID, point AsOf) (*OrderAsOfResult, error) {
+    history, err := cs.EventStore.GetEvents(ctx, string(orderID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to load events: %w", err)
+    }
+    
+    applied := 0
+    if point.Version > 0 {
+        if point.Version > len(history) {
+            return nil, fmt.Errorf("%w: order has %d events, not %d", ErrNoOrderAsOf, len(history), point.Version)
+        }
+        applied = point.Version
+    } else {
+        for _, event := range history {
+            if event.OccurredAt().After(point.Time) {
+                break
+            }
+            applied++
+        }
+    }
+    if applied == 0 {
+        return nil, ErrNoOrderAsOf
+    }
+    
+    order, err := events.ReplayOrder(history[:applied])
+    if err != nil {
+        return nil, fmt.Errorf("failed to replay order: %w", err)
+    }
+    
+    return &OrderAsOfResult{
+        Order:         order,
+        AppliedEvents: applied,
+        LastEvent:     history[applied-1],
+    }, nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// OrderSnapshot is an order as rebuilt from its events.
+type OrderSnapshot struct {
+    ID              entities.OrderID       `json:"id"`
+    CustomerID      string                 `json:"customer_id"`
+    ContactEmail    valueobjects.Email     `json:"contact_email,omitempty"`
+    Status          string                 `json:"status"`
+    PreviousStatus  string                 `json:"previous_status,omitempty"`
+    // HoldReason is why the order is on hold; empty unless it is
+    HoldReason      string                 `json:"hold_reason,omitempty"`
+    Items           []events.OrderItemData `json:"items"`
+    TotalAmount     valueobjects.Money     `json:"total_amount"`
+    ShippingCost    valueobjects.Money     `json:"shipping_cost"`
+    GrandTotal      valueobjects.Money     `json:"grand_total"`
+    ShippingAddress valueobjects.Address   `json:"shipping_address"`
+    Channel         string                 `json:"channel"`
+    OrderNumber     string                 `json:"order_number,omitempty"`
+    CreatedAt       apijson.Timestamp      `json:"created_at"`
+    UpdatedAt       apijson.Timestamp      `json:"updated_at"`
+}
+
+// OrderAsOfHandler returns an order as it was at a past time (?time=, RFC
+// 3339) or version (?version=), replayed from the event store.
+type OrderAsOfHandler struct {
+    Service *CommandService
+}
+
+func (h *OrderAsOfHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    query := r.URL.Query()
+    
+    var point AsOf
+    timeStr, versionStr := query.Get("time"), query.Get("version")
+    switch {
+    case (timeStr == "") == (versionStr == ""):
+        http.Error(w, "exactly one of time or version is required", http.StatusBadRequest)
+        return
+    case versionStr != "":
+        version, err := strconv.Atoi(versionStr)
+        if err != nil || version <= 0 {
+            http.Error(w, "version must be a positive integer", http.StatusBadRequest)
+            return
+        }
+        point.Version = version
+    default:
+        asOf, err := time.Parse(time.RFC3339Nano, timeStr)
+        if err != nil {
+            http.Error(w, "time must be an RFC 3339 timestamp", http.StatusBadRequest)
+            return
+        }
+        if asOf.After(h.Service.now()) {
+            http.Error(w, "time must not be in the future", http.StatusBadRequest)
+            return
+        }
+        point.Time = asOf
+    }
+    
+    result, err := h.Service.OrderAsOf(r.Context(), orderID, point)
+    if err != nil {
+        if errors.Is(err, ErrNoOrderAsOf) {
+            http.Error(w, err.Error(), http.StatusNotFound)
+            return
+        }
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    response := map[string]interface{}{
+        "order":          newOrderSnapshot(result.Order),
+        "applied_events": result.AppliedEvents,
+        "last_event_id":  result.LastEvent.EventID(),
+        "last_event_at":  apijson.NewTimestamp(result.LastEvent.OccurredAt()),
+    }
+    if !point.Time.IsZero() {
+        response["as_of"] = apijson.NewTimestamp(point.Time)
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
+
+func newOrderSnapshot(order *entities.Order) OrderSnapshot {
+    items := make([]events.OrderItemData, len(order.Items))
+    for i, item := range order.Items {
+        items[i] = events.OrderItemData{
+            ProductID: item.ProductID,
+            Quantity:  item.Quantity,
+            Price:     item.Price,
+        }
+    }
+    
+    return OrderSnapshot{
+        ID:              order.ID,
+        CustomerID:      order.CustomerID,
+        ContactEmail:    order.ContactEmail,
+        Status:          order.Status.String(),
+        PreviousStatus:  order.PreviousStatus.String(),
+        HoldReason:      order.HoldReason,
+        Items:           items,
+        TotalAmount:     order.TotalAmount,
+        ShippingCost:    order.ShippingCost,
+        GrandTotal:      order.GrandTotal,
+        ShippingAddress: order.ShippingAddress,
+        Channel:         order.Channel.String(),
+        OrderNumber:     order.Number,
+        CreatedAt:       apijson.NewTimestamp(order.CreatedAt),
+        UpdatedAt:       apijson.NewTimestamp(order.UpdatedAt),
+    }
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Replaying a create, add, confirm, cancel stream a minute apart rebuilds
+// each intermediate state.
+func TestOrderAsOfHandler(t *testing.T) {
+    ctx := context.Background()
+    start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    fake := clock.NewFake(start)
+    defer clock.Set(fake)()
+    
+    f := newCommandFixture()
+    id := f.createOrder(t, uuid.NewString())
+    fake.Advance(time.Minute)
+    if err := f.service.AddOrderItem(ctx, id, "product-2", 1, valueobjects.NewMoney(500, "USD")); err != nil {
+        t.Fatalf("AddOrderItem() = %v", err)
+    }
+    fake.Advance(time.Minute)
+    if err := f.service.ConfirmOrder(ctx, id); err != nil {
+        t.Fatalf("ConfirmOrder() = %v", err)
+    }
+    fake.Advance(time.Minute)
+    if err := f.service.CancelOrder(ctx, CancelOrderCommand{OrderID: string(id), Reason: "customer_request"}); err != nil {
+        t.Fatalf("CancelOrder() = %v", err)
+    }
+    fake.Advance(time.Minute)
+    handler := &OrderAsOfHandler{Service: f.service}
+    
+    tests := []struct {
+        name               string
+        query              url.Values
+        wantStatus         int
+        wantStatusName     string
+        wantPreviousStatus string
+        wantItems          int
+        wantApplied        int
+    }{
+        {name: "version 1", query: url.Values{"version": {"1"}}, wantStatus: http.StatusOK, wantStatusName: valueobjects.OrderStatusDraft.String(), wantItems: 1, wantApplied: 1},
+        {name: "version 2", query: url.Values{"version": {"2"}}, wantStatus: http.StatusOK, wantStatusName: valueobjects.OrderStatusDraft.String(), wantItems: 2, wantApplied: 2},
+        {name: "between confirm and cancel", query: url.Values{"time": {start.Add(150 * time.Second).Format(time.RFC3339)}}, wantStatus: http.StatusOK, wantStatusName: valueobjects.OrderStatusConfirmed.String(), wantItems: 2, wantApplied: 3},
+        {name: "at the cancellation", query: url.Values{"time": {start.Add(3 * time.Minute).Format(time.RFC3339)}}, wantStatus: http.StatusOK, wantStatusName: valueobjects.OrderStatusCancelled.String(), wantPreviousStatus: valueobjects.OrderStatusConfirmed.String(), wantItems: 2, wantApplied: 4},
+        {name: "before the order existed", query: url.Values{"time": {start.Add(-time.Second).Format(time.RFC3339)}}, wantStatus: http.StatusNotFound},
+        {name: "version past the end", query: url.Values{"version": {"5"}}, wantStatus: http.StatusNotFound},
+        {name: "future time", query: url.Values{"time": {start.Add(time.Hour).Format(time.RFC3339)}}, wantStatus: http.StatusBadRequest},
+        {name: "time and version", query: url.Values{"time": {start.Format(time.RFC3339)}, "version": {"1"}}, wantStatus: http.StatusBadRequest},
+        {name: "neither", query: url.Values{}, wantStatus: http.StatusBadRequest},
+        {name: "version zero", query: url.Values{"version": {"0"}}, wantStatus: http.StatusBadRequest},
+        {name: "malformed time", query: url.Values{"time": {"yesterday"}}, wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, "/api/v1/orders/"+string(id)+"/as-of?"+tt.query.Encode(), nil)
+            r = mux.SetURLVars(r, map[string]string{"id": string(id)})
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, r)
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+            
+            var body struct {
+                Order         OrderSnapshot `json:"order"`
+                AppliedEvents int           `json:"applied_events"`
+                LastEventID   string        `json:"last_event_id"`
+            }
+            if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+                t.Fatalf("decoding response: %v", err)
+            }
+            if body.Order.Status != tt.wantStatusName || body.Order.PreviousStatus != tt.wantPreviousStatus {
+                t.Errorf("status = %q (previous %q), want %q (previous %q)", body.Order.Status, body.Order.PreviousStatus, tt.wantStatusName, tt.wantPreviousStatus)
+            }
+            if len(body.Order.Items) != tt.wantItems {
+                t.Errorf("items = %d, want %d", len(body.Order.Items), tt.wantItems)
+            }
+            if body.AppliedEvents != tt.wantApplied || body.LastEventID == "" {
+                t.Errorf("applied %d events, last %q, want %d and an event id", body.AppliedEvents, body.LastEventID, tt.wantApplied)
+            }
+        })
+    }
+}
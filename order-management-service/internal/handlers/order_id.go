@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+)
+
+// orderIDVar parses the {id} path variable, answering 400 when it is not an
+// order id.
+func orderIDVar(w http.ResponseWriter, r *http.Request) (entities.OrderID, bool) {
+    orderID, err := entities.ParseOrderID(mux.Vars(r)["id"])
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return "", false
+    }
+    return orderID, true
+}
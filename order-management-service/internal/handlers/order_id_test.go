@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Every handler of an order answers a malformed id with 400 before using
+// its service, which is nil here.
+func TestHandlers_invalidOrderID(t *testing.T) {
+    handlers := map[string]http.HandlerFunc{
+        "update":     (&UpdateOrderHandler{}).HandleHTTP,
+        "patch":      (&PatchOrderHandler{}).HandleHTTP,
+        "confirm":    (&ConfirmOrderHandler{}).HandleHTTP,
+        "cancel":     (&CancelOrderHandler{}).HandleHTTP,
+        "ship":       (&ShipOrderHandler{}).HandleHTTP,
+        "deliver":    (&DeliverOrderHandler{}).HandleHTTP,
+        "reopen":     (&ReopenOrderHandler{}).HandleHTTP,
+        "hold":       (&HoldOrderHandler{}).HandleHTTP,
+        "release":    (&ReleaseOrderHandler{}).HandleHTTP,
+        "as-of":      (&OrderAsOfHandler{}).HandleHTTP,
+        "raw-events": (&GetRawEventsHandler{}).HandleHTTP,
+    }
+    
+    for name, handler := range handlers {
+        for _, id := range []string{"order-1", "1", "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9dzz"} {
+            t.Run(name+" "+id, func(t *testing.T) {
+                r := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/orders/"+id, strings.NewReader("{}")), map[string]string{"id": id})
+                w := httptest.NewRecorder()
+                handler(w, r)
+                if w.Code != http.StatusBadRequest || !strings.HasPrefix(w.Body.String(), "invalid order id") {
+                    t.Errorf("status = %d: %s, want 400 invalid order id", w.Code, w.Body)
+                }
+            })
+        }
+    }
+}
+
+// Orders are created for well-formed customer ids only, stored in lower
+// case.
+func TestCreateOrderHandler_customerID(t *testing.T) {
+    tests := []struct {
+        name           string
+        customerID     string
+        wantStatus     int
+        wantCustomerID string
+    }{
+        {name: "upper case", customerID: "7D1C3A52-5B2E-4F0E-9A43-2F6C1B8E9D10", wantStatus: http.StatusCreated, wantCustomerID: "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10"},
+        {name: "malformed", customerID: "customer-1", wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            body := `{
+                "customer_id": "` + tt.customerID + `",
+                "items": [{"product_id": "product-1", "quantity": 1, "price": {"amount": 1000, "currency": "USD"}}],
+                "shipping_address": {"street": "1 Main St", "city": "Springfield", "state": "IL", "zip": "62701", "country": "US"}
+            }`
+            w := httptest.NewRecorder()
+            (&CreateOrderHandler{Service: f.service}).HandleHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if tt.wantCustomerID == "" {
+                return
+            }
+            ids, _ := f.orders.ListCustomerOrderIDs(nil, tt.wantCustomerID)
+            if len(ids) != 1 {
+                t.Errorf("orders of %s = %v, want the created order", tt.wantCustomerID, ids)
+            }
+        })
+    }
+}
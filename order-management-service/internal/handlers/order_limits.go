@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+)
+
+// ErrOrderLimitExceeded is wrapped by the errors returned for orders over
+// the service's OrderLimits.
+var ErrOrderLimitExceeded = entities.ErrOrderLimitExceeded
+
+// OrderLimitsFromEnv reads ORDER_MAX_ITEMS, ORDER_MAX_ITEM_QUANTITY and
+// ORDER_MAX_TOTAL, falling back to entities.DefaultOrderLimits. Zero
+// disables a limit.
+func OrderLimitsFromEnv() entities.OrderLimits {
+    limits := entities.DefaultOrderLimits
+    
+    if value, err := strconv.Atoi(os.Getenv("ORDER_MAX_ITEMS")); err == nil && value >= 0 {
+        limits.MaxItems = value
+    }
+    if value, err := strconv.Atoi(os.Getenv("ORDER_MAX_ITEM_QUANTITY")); err == nil && value >= 0 {
+        limits.MaxQuantity = value
+    }
+    if value, err := strconv.ParseInt(os.Getenv("ORDER_MAX_TOTAL"), 10, 64); err == nil && value >= 0 {
+        limits.MaxTotal = value
+    }
+    
+    return limits
+}
+
+// orderItems converts item commands to order items.
+func orderItems(commands []OrderItemCommand) []entities.OrderItem {
+    items := make([]entities.OrderItem, 0, len(commands))
+    for _, item := range commands {
+        items = append(items, entities.OrderItem{
+            ProductID: item.ProductID,
+            Quantity:  item.Quantity,
+            Price:     item.Price,
+        })
+    }
+    return items
+}
+
+// CheckLimits reports the first of limits the command's items exceed.
+func (c CreateOrderCommand) CheckLimits(limits entities.OrderLimits) error {
+    return limits.Check(orderItems(c.Items))
+}
+
+// CheckLimits reports the first of limits the command's items exceed.
+func (c UpdateOrderCommand) CheckLimits(limits entities.OrderLimits) error {
+    return limits.Check(orderItems(c.Items))
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+func TestCreateOrderHandler_limits(t *testing.T) {
+    item := func(productID string, quantity int, amount int64) OrderItemCommand {
+        return OrderItemCommand{ProductID: productID, Quantity: quantity, Price: valueobjects.NewMoney(amount, "USD")}
+    }
+    tests := []struct {
+        name       string
+        items      []OrderItemCommand
+        wantStatus int
+    }{
+        {name: "at every limit", items: []OrderItemCommand{item("a", 2, 1000), item("b", 1, 1000)}, wantStatus: http.StatusCreated},
+        {name: "too many items", items: []OrderItemCommand{item("a", 1, 1), item("b", 1, 1), item("c", 1, 1)}, wantStatus: http.StatusUnprocessableEntity},
+        {name: "quantity over the limit", items: []OrderItemCommand{item("a", 3, 1)}, wantStatus: http.StatusUnprocessableEntity},
+        {name: "total over the limit", items: []OrderItemCommand{item("a", 2, 1501)}, wantStatus: http.StatusUnprocessableEntity},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            f.service.Limits = entities.OrderLimits{MaxItems: 2, MaxQuantity: 2, MaxTotal: 3000}
+            handler := &CreateOrderHandler{Service: f.service}
+            body, err := json.Marshal(CreateOrderCommand{
+                CustomerID:      uuid.NewString(),
+                Items:           tt.items,
+                ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+            })
+            if err != nil {
+                t.Fatal(err)
+            }
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body)))
+            if recorder.Code != tt.wantStatus {
+                t.Errorf("POST /orders = %d %q, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+            }
+        })
+    }
+}
+
+// Orders loaded to add an item are held to the service's limits too.
+func TestCommandService_AddOrderItem_limits(t *testing.T) {
+    f := newCommandFixture()
+    f.service.Limits = entities.OrderLimits{MaxItems: 1}
+    id := f.createOrder(t, uuid.NewString())
+    
+    err := f.service.AddOrderItem(context.Background(), id, "product-2", 1, valueobjects.NewMoney(1000, "USD"))
+    if !errors.Is(err, ErrOrderLimitExceeded) {
+        t.Errorf("AddOrderItem() over the item limit = %v, want ErrOrderLimitExceeded", err)
+    }
+}
+
+func TestOrderLimitsFromEnv(t *testing.T) {
+    t.Setenv("ORDER_MAX_ITEMS", "10")
+    t.Setenv("ORDER_MAX_ITEM_QUANTITY", "0")
+    t.Setenv("ORDER_MAX_TOTAL", "-5")
+    
+    want := entities.DefaultOrderLimits
+    want.MaxItems = 10
+    want.MaxQuantity = 0
+    if got := OrderLimitsFromEnv(); got != want {
+        t.Errorf("OrderLimitsFromEnv() = %+v, want %+v", got, want)
+    }
+}
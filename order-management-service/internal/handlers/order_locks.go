@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+)
+
+// orderLocks serializes the commands on each order within this process, so
+// two commands never load the same aggregate and overwrite each other's
+// update. Commands on different orders run in parallel. The zero value is
+// ready to use.
+//
+// Instances of the service do not share the locks, and correctness does not
+// depend on them: UnitOfWork.Commit stores the events only if the order is
+// still at the version it was loaded at, so a command racing one on another
+// instance fails with ErrVersionConflict instead of overwriting it. The
+// locks keep commands within one instance from failing that way.
+type orderLocks struct {
+    mu    sync.Mutex
+    locks map[entities.OrderID]*orderLock
+}
+
+type orderLock struct {
+    // held has room for one token, taken by the command holding the lock
+    held chan struct{}
+    // refs counts the holder and waiters, so the lock is dropped from the
+    // map once nobody needs it
+    refs int
+}
+
+// lock blocks until the caller holds the order's lock or ctx is done. Call
+// the returned function to release it.
+func (l *orderLocks) lock(ctx context.Context, orderID entities.OrderID) (func(), error) {
+    l.mu.Lock()
+    if l.locks == nil {
+        l.locks = make(map[entities.OrderID]*orderLock)
+    }
+    lock, ok := l.locks[orderID]
+    if !ok {
+        lock = &orderLock{held: make(chan struct{}, 1)}
+        l.locks[orderID] = lock
+    }
+    lock.refs++
+    l.mu.Unlock()
+    
+    select {
+    case lock.held <- struct{}{}:
+        return func() {
+            <-lock.held
+            l.release(orderID, lock)
+        }, nil
+    case <-ctx.Done():
+        l.release(orderID, lock)
+        return nil, ctx.Err()
+    }
+}
+
+func (l *orderLocks) release(orderID entities.OrderID, lock *orderLock) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    
+    lock.refs--
+    if lock.refs == 0 {
+        delete(l.locks, orderID)
+    }
+}
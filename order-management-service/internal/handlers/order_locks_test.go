@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+)
+
+// Run with -race: the counter is only safe if the lock serializes.
+func TestOrderLocks_lock_serializesOneOrder(t *testing.T) {
+    var locks orderLocks
+    var inside atomic.Int32
+    counter := 0
+    
+    const workers, rounds = 16, 200
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := 0; i < rounds; i++ {
+                unlock, err := locks.lock(context.Background(), "order-1")
+                if err != nil {
+                    t.Errorf("lock() = %v", err)
+                    return
+                }
+                if n := inside.Add(1); n != 1 {
+                    t.Errorf("%d holders of one order's lock", n)
+                }
+                counter++
+                inside.Add(-1)
+                unlock()
+            }
+        }()
+    }
+    wg.Wait()
+    
+    if counter != workers*rounds {
+        t.Errorf("counter = %d, want %d", counter, workers*rounds)
+    }
+    if n := len(locks.locks); n != 0 {
+        t.Errorf("%d locks left after every holder released, want 0", n)
+    }
+}
+
+func TestOrderLocks_lock_ordersRunInParallel(t *testing.T) {
+    var locks orderLocks
+    unlock, err := locks.lock(context.Background(), "order-1")
+    if err != nil {
+        t.Fatalf("lock(order-1) = %v", err)
+    }
+    defer unlock()
+    
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    other, err := locks.lock(ctx, "order-2")
+    if err != nil {
+        t.Fatalf("lock(order-2) while order-1 is held = %v", err)
+    }
+    other()
+}
+
+func TestOrderLocks_lock_contextDone(t *testing.T) {
+    tests := []struct {
+        name   string
+        cancel func(context.CancelFunc)
+        ctx    func() (context.Context, context.CancelFunc)
+        want   error
+    }{
+        {
+            name: "cancelled while waiting",
+            ctx:  func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+            cancel: func(cancel context.CancelFunc) {
+                time.Sleep(10 * time.Millisecond)
+                cancel()
+            },
+            want: context.Canceled,
+        },
+        {
+            name:   "deadline while waiting",
+            ctx:    func() (context.Context, context.CancelFunc) { return context.WithTimeout(context.Background(), 10*time.Millisecond) },
+            cancel: func(context.CancelFunc) {},
+            want:   context.DeadlineExceeded,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var locks orderLocks
+            unlock, err := locks.lock(context.Background(), "order-1")
+            if err != nil {
+                t.Fatalf("lock() = %v", err)
+            }
+            
+            ctx, cancel := tt.ctx()
+            defer cancel()
+            go tt.cancel(cancel)
+            
+            if _, err := locks.lock(ctx, "order-1"); !errors.Is(err, tt.want) {
+                t.Fatalf("lock() while held = %v, want %v", err, tt.want)
+            }
+            
+            // The waiter gave up; the holder still releases cleanly and the
+            // order can be locked again
+            unlock()
+            if n := len(locks.locks); n != 0 {
+                t.Errorf("%d locks left, want 0", n)
+            }
+            again, err := locks.lock(context.Background(), entities.OrderID("order-1"))
+            if err != nil {
+                t.Fatalf("lock() after release = %v", err)
+            }
+            again()
+        })
+    }
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/internal/repositories"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// scriptedNumbers gives the numbers listed, then fails.
+type scriptedNumbers struct {
+    numbers []string
+}
+
+func (g *scriptedNumbers) NextOrderNumber(context.Context, time.Time) (string, error) {
+    if len(g.numbers) == 0 {
+        return "", errors.New("sequence unavailable")
+    }
+    number := g.numbers[0]
+    g.numbers = g.numbers[1:]
+    return number, nil
+}
+
+// uniqueNumbers refuses orders numbered as a saved one, as the orders
+// table's unique index does.
+type uniqueNumbers struct {
+    repositories.UnitOfWork
+    taken    map[string]bool
+    attempts int
+}
+
+func (u *uniqueNumbers) Commit(ctx context.Context, order *entities.Order, domainEvents []events.DomainEvent) ([]events.DomainEvent, error) {
+    u.attempts++
+    if u.taken[order.Number] {
+        return nil, fmt.Errorf("%w: %s", repositories.ErrOrderNumberTaken, order.Number)
+    }
+    stored, err := u.UnitOfWork.Commit(ctx, order, domainEvents)
+    if err == nil && order.Number != "" {
+        u.taken[order.Number] = true
+    }
+    return stored, err
+}
+
+// A taken number is retried with the next one, which the order and its
+// OrderCreated carry; an order keeps being refused only so many times.
+func TestCommandService_CreateOrder_orderNumbers(t *testing.T) {
+    tests := []struct {
+        name         string
+        numbers      []string
+        wantNumber   string
+        wantAttempts int
+        wantErr      bool
+        wantTaken    bool
+    }{
+        {name: "first number free", numbers: []string{"ORD-2024-000002"}, wantNumber: "ORD-2024-000002", wantAttempts: 1},
+        {name: "taken once", numbers: []string{"ORD-2024-000001", "ORD-2024-000002"}, wantNumber: "ORD-2024-000002", wantAttempts: 2},
+        {name: "always taken", numbers: []string{"ORD-2024-000001", "ORD-2024-000001", "ORD-2024-000001", "ORD-2024-000001", "ORD-2024-000001", "ORD-2024-000002"}, wantAttempts: maxOrderNumberAttempts, wantErr: true, wantTaken: true},
+        {name: "generator failing", wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            work := &uniqueNumbers{UnitOfWork: f.work, taken: map[string]bool{"ORD-2024-000001": true}}
+            f.service.UnitOfWork = work
+            f.service.OrderNumbers = &scriptedNumbers{numbers: tt.numbers}
+            
+            order, err := f.service.CreateOrder(context.Background(), CreateOrderCommand{
+                CustomerID:      uuid.NewString(),
+                Items:           []OrderItemCommand{{ProductID: "product-1", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")}},
+                ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+            })
+            if work.attempts != tt.wantAttempts {
+                t.Errorf("committed %d times, want %d", work.attempts, tt.wantAttempts)
+            }
+            if tt.wantErr {
+                if err == nil || errors.Is(err, repositories.ErrOrderNumberTaken) != tt.wantTaken {
+                    t.Fatalf("CreateOrder() = %v, want an error, ErrOrderNumberTaken %t", err, tt.wantTaken)
+                }
+                if len(f.orders.orders) != 0 {
+                    t.Errorf("saved %d orders, want none", len(f.orders.orders))
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("CreateOrder() = %v", err)
+            }
+            
+            if order.Number != tt.wantNumber {
+                t.Errorf("order number = %q, want %q", order.Number, tt.wantNumber)
+            }
+            stored, err := f.store.GetEvents(context.Background(), string(order.ID))
+            if err != nil || len(stored) != 1 {
+                t.Fatalf("GetEvents() = %d events, %v, want the creation", len(stored), err)
+            }
+            if created, ok := stored[0].(events.OrderCreatedEvent); !ok || created.OrderNumber != tt.wantNumber {
+                t.Errorf("stored %#v, want OrderCreated numbered %s", stored[0], tt.wantNumber)
+            }
+        })
+    }
+}
+
+// Without a generator orders are left unnumbered.
+func TestCommandService_CreateOrder_unnumbered(t *testing.T) {
+    f := newCommandFixture()
+    id := f.createOrder(t, uuid.NewString())
+    if saved := f.orders.orders[id]; saved.Number != "" {
+        t.Errorf("order number = %q, want none", saved.Number)
+    }
+}
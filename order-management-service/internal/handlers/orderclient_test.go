@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/orderclient"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+)
+
+// newOrderClient serves the command handlers under /api/v2 as the service
+// mounts them and returns a client for them.
+func newOrderClient(t *testing.T, service *CommandService) *orderclient.Client {
+    t.Helper()
+    router := mux.NewRouter()
+    r := router.PathPrefix(apiversion.V2.Prefix()).Subrouter()
+    r.HandleFunc("/orders", (&CreateOrderHandler{Service: service}).HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}/confirm", (&ConfirmOrderHandler{Service: service}).HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}/cancel", (&CancelOrderHandler{Service: service}).HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}/as-of", (&OrderAsOfHandler{Service: service}).HandleHTTP).Methods("GET", "HEAD")
+    server := httptest.NewServer(router)
+    t.Cleanup(server.Close)
+    
+    client, err := orderclient.New(apiclient.Config{BaseURL: server.URL, Retry: apiclient.NoRetry})
+    if err != nil {
+        t.Fatalf("orderclient.New() = %v", err)
+    }
+    return client
+}
+
+// The client's requests and responses match the handlers: an order created,
+// confirmed and cancelled through it is rebuilt at each version, and a
+// refused command comes back as an *apiclient.Error with its status.
+func TestOrderClient(t *testing.T) {
+    ctx := context.Background()
+    f := newCommandFixture()
+    client := newOrderClient(t, f.service)
+    customerID := uuid.NewString()
+    
+    created, err := client.CreateOrder(ctx, orderclient.CreateOrderRequest{
+        CustomerID:      customerID,
+        Items:           []orderclient.OrderItem{{ProductID: "product-1", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")}},
+        ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+        Channel:         "mobile",
+    })
+    if err != nil {
+        t.Fatalf("CreateOrder() = %v", err)
+    }
+    if created.ID == "" || created.CustomerID != customerID || created.Status != valueobjects.OrderStatusDraft.String() || created.Channel != "mobile" {
+        t.Errorf("created = %+v, want a mobile draft for %s", created, customerID)
+    }
+    if created.TotalAmount.Amount != 2000 || created.CreatedAt.IsZero() {
+        t.Errorf("created total %d at %v, want 2000 and a creation time", created.TotalAmount.Amount, created.CreatedAt)
+    }
+    
+    if err := client.ConfirmOrder(ctx, created.ID); err != nil {
+        t.Fatalf("ConfirmOrder() = %v", err)
+    }
+    if err := client.CancelOrder(ctx, created.ID, orderclient.CancelOrderRequest{Reason: "customer_request"}); err != nil {
+        t.Fatalf("CancelOrder() = %v", err)
+    }
+    if err := client.ConfirmOrder(ctx, created.ID); apiclient.StatusCode(err) < 400 {
+        t.Errorf("ConfirmOrder() of a cancelled order = %v, want an error response", err)
+    }
+    
+    tests := []struct {
+        version    int
+        wantStatus string
+    }{
+        {version: 1, wantStatus: valueobjects.OrderStatusDraft.String()},
+        {version: 2, wantStatus: valueobjects.OrderStatusConfirmed.String()},
+        {version: 3, wantStatus: valueobjects.OrderStatusCancelled.String()},
+    }
+    for _, tt := range tests {
+        asOf, err := client.GetOrderAtVersion(ctx, created.ID, tt.version)
+        if err != nil {
+            t.Fatalf("GetOrderAtVersion(%d) = %v", tt.version, err)
+        }
+        if asOf.Order.ID != created.ID || asOf.Order.Status != tt.wantStatus || asOf.AppliedEvents != tt.version {
+            t.Errorf("version %d = %s with %d events, want %s", tt.version, asOf.Order.Status, asOf.AppliedEvents, tt.wantStatus)
+        }
+    }
+    
+    if _, err := client.GetOrderAtVersion(ctx, uuid.NewString(), 1); apiclient.StatusCode(err) != http.StatusNotFound {
+        t.Errorf("GetOrderAtVersion() of an unknown order = %v, want 404", err)
+    }
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+)
+
+// OutboxEventHandler looks an outbox event up by id, whether it is still in
+// the outbox or has been archived.
+type OutboxEventHandler struct {
+    Archiver *outbox.Archiver
+}
+
+func (h *OutboxEventHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    eventID := mux.Vars(r)["id"]
+    
+    event, err := h.Archiver.FindEvent(r.Context(), eventID)
+    if errors.Is(err, outbox.ErrEventNotFound) {
+        http.Error(w, "Outbox event not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    apijson.Write(w, r, http.StatusOK, event)
+}
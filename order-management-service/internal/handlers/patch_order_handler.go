@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// MergePatchContentType is the media type of JSON merge patches (RFC 7396),
+// the only body PatchOrderHandler accepts.
+const MergePatchContentType = "application/merge-patch+json"
+
+// PatchOrderHandler changes parts of a draft order with a JSON merge patch,
+// recording the changes as granular events. It responds with the types of
+// the events recorded, in order.
+type PatchOrderHandler struct {
+    Service *CommandService
+}
+
+func (h *PatchOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if err != nil || mediaType != MergePatchContentType {
+        http.Error(w, "Content-Type must be "+MergePatchContentType, http.StatusUnsupportedMediaType)
+        return
+    }
+    
+    var patch map[string]json.RawMessage
+    if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+        http.Error(w, "Invalid JSON: a merge patch must be an object", http.StatusBadRequest)
+        return
+    }
+    
+    // expected_version is not part of the order, so it is not patched
+    var expected *int
+    if value, ok := patch["expected_version"]; ok {
+        delete(patch, "expected_version")
+        if err := json.Unmarshal(value, &expected); err != nil {
+            http.Error(w, "expected_version must be the order version the change applies to, such as 3", http.StatusBadRequest)
+            return
+        }
+    }
+    
+    cmd, err := patchOrderCommand(patch)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    cmd.OrderID = string(orderID)
+    
+    ctx, ok := commandContext(w, r, expected)
+    if !ok {
+        return
+    }
+    
+    recorded, err := h.Service.PatchOrder(ctx, cmd)
+    if err != nil {
+        if writeVersionError(w, r, err) {
+            return
+        }
+        if errors.Is(err, ErrRestrictedCountry) {
+            writeRestrictedCountry(w, err)
+            return
+        }
+        if errors.Is(err, entities.ErrItemPriceImmutable) || errors.Is(err, ErrPriceMismatch) || errors.Is(err, ErrOrderLimitExceeded) || errors.Is(err, ErrEventTooLarge) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    eventTypes := make([]string, 0, len(recorded))
+    for _, event := range recorded {
+        eventTypes = append(eventTypes, event.Type())
+    }
+    apijson.Write(w, r, http.StatusOK, map[string]interface{}{
+        "order_id": orderID,
+        "events":   eventTypes,
+    })
+}
+
+// patchOrderCommand reads the members of a merge patch. Removing the items
+// or the address, which a null member would ask for, is not allowed.
+func patchOrderCommand(patch map[string]json.RawMessage) (PatchOrderCommand, error) {
+    var cmd PatchOrderCommand
+    for member, value := range patch {
+        if string(value) == "null" {
+            return cmd, fmt.Errorf("%s cannot be removed", member)
+        }
+        
+        switch member {
+        case "items":
+            var items []OrderItemPatch
+            if err := json.Unmarshal(value, &items); err != nil {
+                return cmd, fmt.Errorf("items: %s", decodeError(err))
+            }
+            if items == nil {
+                items = []OrderItemPatch{}
+            }
+            cmd.Items = &items
+        case "shipping_address":
+            if err := json.Unmarshal(value, &cmd.ShippingAddress); err != nil {
+                return cmd, errors.New("shipping_address: Invalid JSON")
+            }
+        default:
+            return cmd, fmt.Errorf("%s cannot be patched", member)
+        }
+    }
+    return cmd, nil
+}
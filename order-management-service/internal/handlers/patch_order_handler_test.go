@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// patchOrder sends body as a merge patch of the order.
+func patchOrder(f commandFixture, id entities.OrderID, contentType, body string) *httptest.ResponseRecorder {
+    r := httptest.NewRequest(http.MethodPatch, "/orders/"+string(id), strings.NewReader(body))
+    r.Header.Set("Content-Type", contentType)
+    r = mux.SetURLVars(r, map[string]string{"id": string(id)})
+    w := httptest.NewRecorder()
+    (&PatchOrderHandler{Service: f.service}).HandleHTTP(w, r)
+    return w
+}
+
+// A patch changes only the parts it gives, recording a granular event for
+// each change: the address first, then removals, quantity changes and
+// additions. The order created has two of product-1 at 10.00 USD.
+func TestPatchOrderHandler(t *testing.T) {
+    original := valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US")
+    chicago := original
+    chicago.City = "Chicago"
+    
+    tests := []struct {
+        name        string
+        body        string
+        wantEvents  []string
+        wantItems   []entities.OrderItem
+        wantAddress valueobjects.Address
+    }{
+        {
+            name:        "address only",
+            body:        `{"shipping_address": {"city": "Chicago"}}`,
+            wantEvents:  []string{"OrderShippingAddressChanged"},
+            wantItems:   []entities.OrderItem{{ProductID: "product-1", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")}},
+            wantAddress: chicago,
+        },
+        {
+            name:        "quantity",
+            body:        `{"items": [{"product_id": "product-1", "quantity": 3}]}`,
+            wantEvents:  []string{"OrderItemQuantityChanged"},
+            wantItems:   []entities.OrderItem{{ProductID: "product-1", Quantity: 3, Price: valueobjects.NewMoney(1000, "USD")}},
+            wantAddress: original,
+        },
+        {
+            name:        "items replaced",
+            body:        `{"items": [{"product_id": "product-2", "quantity": 1, "price": {"amount": 500, "currency": "USD"}}]}`,
+            wantEvents:  []string{"OrderItemRemoved", "OrderItemAdded"},
+            wantItems:   []entities.OrderItem{{ProductID: "product-2", Quantity: 1, Price: valueobjects.NewMoney(500, "USD")}},
+            wantAddress: original,
+        },
+        {
+            name: "combined",
+            body: `{
+                "shipping_address": {"city": "Chicago"},
+                "items": [
+                    {"product_id": "product-1", "quantity": 1, "price": {"amount": 1000, "currency": "USD"}},
+                    {"product_id": "product-2", "quantity": 4, "price": {"amount": 500, "currency": "USD"}}
+                ],
+                "expected_version": 1
+            }`,
+            wantEvents: []string{"OrderShippingAddressChanged", "OrderItemQuantityChanged", "OrderItemAdded"},
+            wantItems: []entities.OrderItem{
+                {ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")},
+                {ProductID: "product-2", Quantity: 4, Price: valueobjects.NewMoney(500, "USD")},
+            },
+            wantAddress: chicago,
+        },
+        {
+            name:        "no change",
+            body:        `{"items": [{"product_id": "product-1", "quantity": 2}], "shipping_address": {"city": "Springfield"}}`,
+            wantEvents:  []string{},
+            wantItems:   []entities.OrderItem{{ProductID: "product-1", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")}},
+            wantAddress: original,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            id := f.createOrder(t, uuid.NewString())
+            
+            w := patchOrder(f, id, MergePatchContentType+"; charset=utf-8", tt.body)
+            if w.Code != http.StatusOK {
+                t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+            }
+            var body struct {
+                Events []string `json:"events"`
+            }
+            if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+                t.Fatalf("decoding response: %v", err)
+            }
+            if !reflect.DeepEqual(body.Events, tt.wantEvents) {
+                t.Errorf("response events = %v, want %v", body.Events, tt.wantEvents)
+            }
+            stored := f.eventTypes(t, id, 1)
+            if len(stored) != len(tt.wantEvents) || (len(stored) > 0 && !reflect.DeepEqual(stored, tt.wantEvents)) {
+                t.Errorf("stored events = %v, want %v", stored, tt.wantEvents)
+            }
+            
+            saved, err := f.orders.FindByID(context.Background(), id)
+            if err != nil {
+                t.Fatalf("FindByID() = %v", err)
+            }
+            if !reflect.DeepEqual(saved.Items, tt.wantItems) || saved.ShippingAddress != tt.wantAddress {
+                t.Errorf("saved order = %+v at %+v, want %+v at %+v", saved.Items, saved.ShippingAddress, tt.wantItems, tt.wantAddress)
+            }
+            
+            // Replaying the stored events rebuilds the saved order
+            history, err := f.store.GetEvents(context.Background(), string(id))
+            if err != nil {
+                t.Fatalf("GetEvents() = %v", err)
+            }
+            replayed, err := events.ReplayOrder(history)
+            if err != nil {
+                t.Fatalf("ReplayOrder() = %v", err)
+            }
+            if !reflect.DeepEqual(replayed.Items, saved.Items) || replayed.ShippingAddress != saved.ShippingAddress || replayed.GrandTotal != saved.GrandTotal {
+                t.Errorf("replayed order = %+v at %+v, total %v, want the saved order, total %v", replayed.Items, replayed.ShippingAddress, replayed.GrandTotal, saved.GrandTotal)
+            }
+        })
+    }
+}
+
+// Patches that are not merge patches of the order, or that change what
+// cannot change, are refused without recording events.
+func TestPatchOrderHandler_refused(t *testing.T) {
+    tests := []struct {
+        name        string
+        contentType string
+        body        string
+        wantStatus  int
+    }{
+        {name: "JSON content type", contentType: "application/json", body: `{"shipping_address": {"city": "Chicago"}}`, wantStatus: http.StatusUnsupportedMediaType},
+        {name: "not an object", body: `[]`, wantStatus: http.StatusBadRequest},
+        {name: "items removed", body: `{"items": null}`, wantStatus: http.StatusBadRequest},
+        {name: "status", body: `{"status": "shipped"}`, wantStatus: http.StatusBadRequest},
+        {name: "unknown address field", body: `{"shipping_address": {"planet": "Mars"}}`, wantStatus: http.StatusBadRequest},
+        {name: "zero quantity", body: `{"items": [{"product_id": "product-1", "quantity": 0}]}`, wantStatus: http.StatusBadRequest},
+        {name: "product twice", body: `{"items": [{"product_id": "product-1", "quantity": 1}, {"product_id": "product-1", "quantity": 2}]}`, wantStatus: http.StatusBadRequest},
+        {name: "new item without price", body: `{"items": [{"product_id": "product-2", "quantity": 1}]}`, wantStatus: http.StatusBadRequest},
+        {name: "price changed", body: `{"items": [{"product_id": "product-1", "quantity": 2, "price": {"amount": 900, "currency": "USD"}}]}`, wantStatus: http.StatusUnprocessableEntity},
+        {name: "stale version", body: `{"shipping_address": {"city": "Chicago"}, "expected_version": 0}`, wantStatus: http.StatusConflict},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            f := newCommandFixture()
+            id := f.createOrder(t, uuid.NewString())
+            contentType := tt.contentType
+            if contentType == "" {
+                contentType = MergePatchContentType
+            }
+            
+            w := patchOrder(f, id, contentType, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if stored := f.eventTypes(t, id, 1); len(stored) != 0 {
+                t.Errorf("stored events = %v, want none", stored)
+            }
+        })
+    }
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/featureflags"
+)
+
+// ErrPriceMismatch is returned for new items whose price is not the price
+// catalog's, or whose product the catalog does not sell, while price
+// verification is on.
+var ErrPriceMismatch = errors.New("item price does not match the catalog")
+
+// PriceCatalog tells what products sell for. No catalog ships with the
+// service; services embedding it plug theirs in.
+type PriceCatalog interface {
+    // ProductPrice returns the price of productID, and false for products
+    // the catalog does not sell
+    ProductPrice(ctx context.Context, productID string) (valueobjects.Money, bool, error)
+}
+
+// priceVerification reports whether new items are checked against the
+// catalog, by the PriceVerification flag when there are flags.
+func (cs *CommandService) priceVerification() bool {
+    if cs.Prices == nil {
+        return false
+    }
+    if cs.Flags != nil {
+        return cs.Flags.Enabled(featureflags.PriceVerification)
+    }
+    return cs.PriceVerification
+}
+
+// verifyPrice checks that a new item of productID is priced as the catalog
+// says, when price verification is on. A failed lookup fails the command.
+func (cs *CommandService) verifyPrice(ctx context.Context, productID string, price valueobjects.Money) error {
+    if !cs.priceVerification() {
+        return nil
+    }
+    
+    want, ok, err := cs.Prices.ProductPrice(ctx, productID)
+    if err != nil {
+        return fmt.Errorf("failed to look up the price of %s: %w", productID, err)
+    }
+    if !ok {
+        return fmt.Errorf("%w: %s is not in the catalog", ErrPriceMismatch, productID)
+    }
+    if price != want {
+        return fmt.Errorf("%w: %s costs %s, not %s", ErrPriceMismatch, productID, want, price)
+    }
+    return nil
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/featureflags"
+)
+
+// catalog is a PriceCatalog in memory, failing with err when it is set.
+type catalog struct {
+    prices map[string]valueobjects.Money
+    err    error
+}
+
+func (c catalog) ProductPrice(_ context.Context, productID string) (valueobjects.Money, bool, error) {
+    price, ok := c.prices[productID]
+    return price, ok, c.err
+}
+
+func TestCommandService_verifyPrice(t *testing.T) {
+    prices := catalog{prices: map[string]valueobjects.Money{"product-1": valueobjects.NewMoney(1000, "USD")}}
+    tests := []struct {
+        name      string
+        catalog   PriceCatalog
+        enabled   bool
+        flag      *bool
+        productID string
+        price     valueobjects.Money
+        wantErr   error
+        wantAny   bool
+    }{
+        {name: "catalog price", catalog: prices, enabled: true, productID: "product-1", price: valueobjects.NewMoney(1000, "USD")},
+        {name: "different amount", catalog: prices, enabled: true, productID: "product-1", price: valueobjects.NewMoney(900, "USD"), wantErr: ErrPriceMismatch},
+        {name: "different currency", catalog: prices, enabled: true, productID: "product-1", price: valueobjects.NewMoney(1000, "EUR"), wantErr: ErrPriceMismatch},
+        {name: "not in the catalog", catalog: prices, enabled: true, productID: "product-2", price: valueobjects.NewMoney(1000, "USD"), wantErr: ErrPriceMismatch},
+        {name: "lookup fails", catalog: catalog{err: errors.New("catalog down")}, enabled: true, productID: "product-1", price: valueobjects.NewMoney(1000, "USD"), wantAny: true},
+        {name: "verification off", catalog: prices, productID: "product-1", price: valueobjects.NewMoney(900, "USD")},
+        {name: "no catalog", enabled: true, productID: "product-1", price: valueobjects.NewMoney(900, "USD")},
+        {name: "flag turns it on", catalog: prices, flag: boolPtr(true), productID: "product-1", price: valueobjects.NewMoney(900, "USD"), wantErr: ErrPriceMismatch},
+        {name: "flag turns it off", catalog: prices, enabled: true, flag: boolPtr(false), productID: "product-1", price: valueobjects.NewMoney(900, "USD")},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cs := &CommandService{Prices: tt.catalog, PriceVerification: tt.enabled}
+            if tt.flag != nil {
+                cs.Flags = featureflags.New()
+                cs.Flags.Configure(featureflags.PriceVerification, *tt.flag)
+            }
+            
+            err := cs.verifyPrice(context.Background(), tt.productID, tt.price)
+            switch {
+            case tt.wantAny:
+                if err == nil || errors.Is(err, ErrPriceMismatch) {
+                    t.Errorf("verifyPrice() = %v, want the lookup's error", err)
+                }
+            case !errors.Is(err, tt.wantErr):
+                t.Errorf("verifyPrice() = %v, want %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func boolPtr(b bool) *bool {
+    return &b
+}
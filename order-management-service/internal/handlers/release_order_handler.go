@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ReleaseOrderHandler returns an order on hold to confirmed. The body, with
+// an optional reason, may be empty. Mount it behind the admin key.
+type ReleaseOrderHandler struct {
+    Service *CommandService
+}
+
+type ReleaseOrderRequest struct {
+    Reason          string `json:"reason"`
+    ExpectedVersion *int   `json:"expected_version"`
+}
+
+func (h *ReleaseOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    var req ReleaseOrderRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    
+    ctx, ok := commandContext(w, r, req.ExpectedVersion)
+    if !ok {
+        return
+    }
+    
+    cmd := ReleaseOrderCommand{OrderID: string(orderID), Reason: strings.TrimSpace(req.Reason)}
+    if err := h.Service.ReleaseOrder(ctx, cmd); err != nil {
+        if writeVersionError(w, r, err) {
+            return
+        }
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    w.WriteHeader(http.StatusOK)
+    w.Write([]byte("Order released successfully"))
+}
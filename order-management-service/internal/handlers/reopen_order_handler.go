@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+)
+
+type ReopenOrderHandler struct {
+    Service *CommandService
+}
+
+func (h *ReopenOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    expected, ok := decodeExpectedVersion(w, r)
+    if !ok {
+        return
+    }
+    
+    ctx, ok := commandContext(w, r, expected)
+    if !ok {
+        return
+    }
+    
+    if err := h.Service.ReopenOrder(ctx, orderID); err != nil {
+        if writeVersionError(w, r, err) {
+            return
+        }
+        if errors.Is(err, entities.ErrReopenNotAllowed) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    w.WriteHeader(http.StatusOK)
+    w.Write([]byte("Order reopened successfully"))
+}
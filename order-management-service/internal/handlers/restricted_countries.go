@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
+)
+
+// ErrRestrictedCountry is wrapped by the errors returned for orders
+// shipping to a country on the service's RestrictedCountries.
+var ErrRestrictedCountry = entities.ErrRestrictedCountry
+
+// RestrictedCountryErrorCode is sent in the X-Error-Code header of the 422
+// responses refusing an order for its shipping country.
+const RestrictedCountryErrorCode = "restricted_country"
+
+// restrictionStats is published as the "restricted_country_rejections"
+// expvar: orders refused for their shipping country, by country.
+var restrictionStats = expvar.NewMap("restricted_country_rejections")
+
+// RestrictedCountries is a list of countries orders may not ship to: a
+// fixed list plus those in a file, one per line with # comments. Reload
+// reads the file again, so the list changes without a restart. Countries
+// are compared as entities.NormalizeCountry returns them.
+type RestrictedCountries struct {
+    fixed []string
+    path  string
+    
+    mu        sync.RWMutex
+    countries map[string]bool
+}
+
+// NewRestrictedCountries returns the list of countries plus those in the
+// file at path, which may be empty for none.
+func NewRestrictedCountries(countries []string, path string) (*RestrictedCountries, error) {
+    r := &RestrictedCountries{fixed: countries, path: path}
+    if err := r.Reload(); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// RestrictedCountriesFromEnv reads the countries listed in
+// RESTRICTED_COUNTRIES, comma separated, and in the file
+// RESTRICTED_COUNTRIES_FILE names. The list is empty when neither is set.
+func RestrictedCountriesFromEnv() (*RestrictedCountries, error) {
+    var countries []string
+    if value := os.Getenv("RESTRICTED_COUNTRIES"); value != "" {
+        countries = strings.Split(value, ",")
+    }
+    return NewRestrictedCountries(countries, os.Getenv("RESTRICTED_COUNTRIES_FILE"))
+}
+
+// Reload reads the file again. On failure the previous list stays in
+// effect.
+func (r *RestrictedCountries) Reload() error {
+    countries := make(map[string]bool)
+    for _, country := range r.fixed {
+        if country = entities.NormalizeCountry(country); country != "" {
+            countries[country] = true
+        }
+    }
+    if r.path != "" {
+        if err := readCountries(r.path, countries); err != nil {
+            return err
+        }
+    }
+    
+    r.mu.Lock()
+    r.countries = countries
+    r.mu.Unlock()
+    return nil
+}
+
+// IsRestricted implements entities.ShippingRestrictions. A nil list
+// restricts no country.
+func (r *RestrictedCountries) IsRestricted(country string) bool {
+    if r == nil {
+        return false
+    }
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    return r.countries[country]
+}
+
+// Countries returns the restricted countries in order.
+func (r *RestrictedCountries) Countries() []string {
+    if r == nil {
+        return []string{}
+    }
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    
+    countries := make([]string, 0, len(r.countries))
+    for country := range r.countries {
+        countries = append(countries, country)
+    }
+    sort.Strings(countries)
+    return countries
+}
+
+func readCountries(path string, countries map[string]bool) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return fmt.Errorf("failed to read restricted countries: %w", err)
+    }
+    defer file.Close()
+    
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line, _, _ := strings.Cut(scanner.Text(), "#")
+        if country := entities.NormalizeCountry(line); country != "" {
+            countries[country] = true
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return fmt.Errorf("failed to read restricted countries from %s: %w", path, err)
+    }
+    return nil
+}
+
+// auditRestrictedCountry counts and logs an order refused by err for its
+// shipping country, with the customer and the request that asked. Only the
+// country is logged, not the address. Other errors are ignored.
+func auditRestrictedCountry(ctx context.Context, customerID string, orderID string, country string, err error) {
+    if !errors.Is(err, ErrRestrictedCountry) {
+        return
+    }
+    country = entities.NormalizeCountry(country)
+    restrictionStats.Add(country, 1)
+    
+    order := "new order"
+    if orderID != "" {
+        order = "order " + orderID
+    }
+    log.Printf("Refused %s for customer %s (request %s, admin %t): shipping to restricted country %s", order, customerID, httpmw.RequestIDFromContext(ctx), httpmw.IsAdmin(ctx), country)
+}
+
+// writeRestrictedCountry responds to an order refused for its shipping
+// country with 422 and RestrictedCountryErrorCode.
+func writeRestrictedCountry(w http.ResponseWriter, err error) {
+    w.Header().Set("X-Error-Code", RestrictedCountryErrorCode)
+    http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// RestrictedCountriesHandler shows the countries orders may not ship to and
+// reloads them.
+type RestrictedCountriesHandler struct {
+    Countries *RestrictedCountries
+}
+
+// HandleList lists the restricted countries.
+func (h *RestrictedCountriesHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+    apijson.Write(w, r, http.StatusOK, map[string]interface{}{
+        "countries": h.Countries.Countries(),
+    })
+}
+
+// HandleReload reloads the list and returns it. A failed reload keeps the
+// previous list.
+func (h *RestrictedCountriesHandler) HandleReload(w http.ResponseWriter, r *http.Request) {
+    if h.Countries == nil {
+        http.Error(w, "Restricted countries are not configured", http.StatusNotFound)
+        return
+    }
+    if err := h.Countries.Reload(); err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    countries := h.Countries.Countries()
+    log.Printf("Reloaded restricted countries: %d listed", len(countries))
+    
+    apijson.Write(w, r, http.StatusOK, map[string]interface{}{
+        "countries": countries,
+    })
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func restrictionStat(country string) int64 {
+    if value, ok := restrictionStats.Get(country).(*expvar.Int); ok {
+        return value.Value()
+    }
+    return 0
+}
+
+// writeCountries writes the lines to the restricted countries file at path.
+func writeCountries(t *testing.T, path string, lines ...string) {
+    t.Helper()
+    if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+        t.Fatalf("writing %s: %v", path, err)
+    }
+}
+
+// The list joins the fixed countries and the file's, normalized. Reloading
+// picks up the file's changes, and a failed reload keeps the list as it was.
+func TestRestrictedCountries_Reload(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "restricted")
+    writeCountries(t, path, "# embargoed", "kp", "  SY  # since 2011", "")
+    countries, err := NewRestrictedCountries([]string{" ir", ""}, path)
+    if err != nil {
+        t.Fatalf("NewRestrictedCountries() = %v", err)
+    }
+    if got, want := countries.Countries(), []string{"IR", "KP", "SY"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Countries() = %v, want %v", got, want)
+    }
+    
+    writeCountries(t, path, "CU")
+    if err := countries.Reload(); err != nil {
+        t.Fatalf("Reload() = %v", err)
+    }
+    if got, want := countries.Countries(), []string{"CU", "IR"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Countries() after a reload = %v, want %v", got, want)
+    }
+    
+    if err := os.Remove(path); err != nil {
+        t.Fatalf("removing %s: %v", path, err)
+    }
+    if err := countries.Reload(); err == nil {
+        t.Error("Reload() of a missing file = nil, want an error")
+    }
+    if !countries.IsRestricted("CU") || countries.IsRestricted("KP") {
+        t.Errorf("Countries() after a failed reload = %v, want the previous list", countries.Countries())
+    }
+    
+    var none *RestrictedCountries
+    if none.IsRestricted("KP") || len(none.Countries()) != 0 {
+        t.Error("a nil list should restrict no country")
+    }
+}
+
+func TestRestrictedCountriesFromEnv(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "restricted")
+    writeCountries(t, path, "SY")
+    t.Setenv("RESTRICTED_COUNTRIES", "kp,ir")
+    t.Setenv("RESTRICTED_COUNTRIES_FILE", path)
+    
+    countries, err := RestrictedCountriesFromEnv()
+    if err != nil {
+        t.Fatalf("RestrictedCountriesFromEnv() = %v", err)
+    }
+    if got, want := countries.Countries(), []string{"IR", "KP", "SY"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Countries() = %v, want %v", got, want)
+    }
+    
+    t.Setenv("RESTRICTED_COUNTRIES_FILE", filepath.Join(t.TempDir(), "missing"))
+    if _, err := RestrictedCountriesFromEnv(); err == nil {
+        t.Error("RestrictedCountriesFromEnv() with a missing file = nil, want an error")
+    }
+}
+
+// Orders created for, or moved to, a restricted country are refused with
+// 422 and the restricted_country code, counted by country and logged
+// without the address. A reload restricts countries for the next orders.
+func TestRestrictedCountries_orders(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "restricted")
+    writeCountries(t, path, "KP")
+    countries, err := NewRestrictedCountries(nil, path)
+    if err != nil {
+        t.Fatalf("NewRestrictedCountries() = %v", err)
+    }
+    f := newCommandFixture()
+    f.service.Restrictions = countries
+    
+    var logged bytes.Buffer
+    writer := log.Writer()
+    log.SetOutput(&logged)
+    defer log.SetOutput(writer)
+    
+    create := func(country string) *httptest.ResponseRecorder {
+        body := `{
+            "customer_id": "` + uuid.NewString() + `",
+            "items": [{"product_id": "product-1", "quantity": 1, "price": {"amount": 1000, "currency": "USD"}}],
+            "shipping_address": {"street": "7 Secret Rd", "city": "Hiddenville", "state": "ST", "zip": "99999", "country": "` + country + `"}
+        }`
+        w := httptest.NewRecorder()
+        (&CreateOrderHandler{Service: f.service}).HandleHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+        return w
+    }
+    refused := func(what string, w *httptest.ResponseRecorder) {
+        t.Helper()
+        if w.Code != http.StatusUnprocessableEntity || w.Header().Get("X-Error-Code") != RestrictedCountryErrorCode {
+            t.Errorf("%s = %d, %q: %s, want 422 %s", what, w.Code, w.Header().Get("X-Error-Code"), w.Body, RestrictedCountryErrorCode)
+        }
+    }
+    
+    before := restrictionStat("KP")
+    refused("creating an order for kp", create("kp"))
+    if got := restrictionStat("KP") - before; got != 1 {
+        t.Errorf("KP rejections grew by %d, want 1", got)
+    }
+    if len(f.orders.orders) != 0 {
+        t.Errorf("refused creation saved %d orders", len(f.orders.orders))
+    }
+    if !strings.Contains(logged.String(), "restricted country KP") {
+        t.Errorf("log = %q, want the refusal with its country", logged.String())
+    }
+    for _, part := range []string{"7 Secret Rd", "Hiddenville", "99999"} {
+        if strings.Contains(logged.String(), part) {
+            t.Errorf("log = %q, should not contain the address", logged.String())
+        }
+    }
+    
+    // Moving an order there is refused too
+    id := f.createOrder(t, uuid.NewString())
+    refused("patching the address to KP", patchOrder(f, id, MergePatchContentType, `{"shipping_address": {"country": "KP", "state": "ST"}}`))
+    if stored := f.eventTypes(t, id, 1); len(stored) != 0 {
+        t.Errorf("refused address change recorded %v", stored)
+    }
+    
+    // Reloading restricts the countries of the next orders
+    if w := create("CU"); w.Code != http.StatusCreated {
+        t.Fatalf("creating an order for CU = %d: %s, want 201", w.Code, w.Body)
+    }
+    writeCountries(t, path, "KP", "CU")
+    w := httptest.NewRecorder()
+    (&RestrictedCountriesHandler{Countries: countries}).HandleReload(w, httptest.NewRequest(http.MethodPost, "/restricted-countries/reload", nil))
+    var list struct {
+        Countries []string `json:"countries"`
+    }
+    if err := json.NewDecoder(w.Body).Decode(&list); err != nil || !reflect.DeepEqual(list.Countries, []string{"CU", "KP"}) {
+        t.Fatalf("reload = %d, %v, %v, want CU and KP", w.Code, list.Countries, err)
+    }
+    refused("creating an order for CU after the reload", create("CU"))
+}
+
+// Reloading without a configured list is 404, and a failed reload 500.
+func TestRestrictedCountriesHandler_HandleReload_errors(t *testing.T) {
+    w := httptest.NewRecorder()
+    (&RestrictedCountriesHandler{}).HandleReload(w, httptest.NewRequest(http.MethodPost, "/restricted-countries/reload", nil))
+    if w.Code != http.StatusNotFound {
+        t.Errorf("reload without a list = %d, want 404", w.Code)
+    }
+    
+    path := filepath.Join(t.TempDir(), "restricted")
+    writeCountries(t, path, "KP")
+    countries, err := NewRestrictedCountries(nil, path)
+    if err != nil {
+        t.Fatalf("NewRestrictedCountries() = %v", err)
+    }
+    if err := os.Remove(path); err != nil {
+        t.Fatalf("removing %s: %v", path, err)
+    }
+    w = httptest.NewRecorder()
+    (&RestrictedCountriesHandler{Countries: countries}).HandleReload(w, httptest.NewRequest(http.MethodPost, "/restricted-countries/reload", nil))
+    if w.Code != http.StatusInternalServerError || !countries.IsRestricted("KP") {
+        t.Errorf("failed reload = %d, list %v, want 500 and the previous list", w.Code, countries.Countries())
+    }
+}
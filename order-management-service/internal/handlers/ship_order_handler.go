@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+)
+
+// ShipOrderHandler ships a confirmed order. An order on hold is refused
+// with 409 until it is released.
+type ShipOrderHandler struct {
+    Service *CommandService
+}
+
+func (h *ShipOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    expected, ok := decodeExpectedVersion(w, r)
+    if !ok {
+        return
+    }
+    
+    ctx, ok := commandContext(w, r, expected)
+    if !ok {
+        return
+    }
+    
+    if err := h.Service.ShipOrder(ctx, ShipOrderCommand{OrderID: string(orderID)}); err != nil {
+        if writeVersionError(w, r, err) {
+            return
+        }
+        if errors.Is(err, entities.ErrOrderOnHold) {
+            http.Error(w, err.Error(), http.StatusConflict)
+            return
+        }
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    w.WriteHeader(http.StatusOK)
+    w.Write([]byte("Order shipped successfully"))
+}
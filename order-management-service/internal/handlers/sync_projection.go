@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"log"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/featureflags"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/logredact"
+)
+
+// syncProjectionStats is published as the "sync_projection" expvar: events
+// projected in-process by commands, those that failed and are left to the
+// reporting service's consumer, and commands whose events were left to it
+// as the flag was off.
+var syncProjectionStats = expvar.NewMap("sync_projection")
+
+// project applies stored events to the read models in-process when a
+// synchronous projection is configured and its flag is not off, so reads
+// right after the command see it. The events are already committed and in the outbox: a failure is
+// logged and the consumer applies them later, as it does every event.
+func (cs *CommandService) project(ctx context.Context, stored []events.DomainEvent) {
+    if cs.SyncProjection == nil {
+        return
+    }
+    if cs.Flags != nil && !cs.Flags.Enabled(featureflags.SyncProjection) {
+        syncProjectionStats.Add("skipped_by_flag", 1)
+        return
+    }
+    for _, event := range stored {
+        if err := cs.SyncProjection(ctx, event); err != nil {
+            syncProjectionStats.Add("failed", 1)
+            log.Printf("Synchronous projection of %s for order %s failed, leaving it to the consumer: %v", event.Type(), event.AggregateID(), err)
+            if logredact.PayloadLogging() {
+                log.Printf("Synchronous projection event payload: %s", logredact.Value(event))
+            }
+            return
+        }
+        syncProjectionStats.Add("applied", 1)
+    }
+}
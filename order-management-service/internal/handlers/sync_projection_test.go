@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/featureflags"
+)
+
+// recordingProjection records the events it is handed, failing those of
+// the types in failing.
+type recordingProjection struct {
+    failing map[string]bool
+    types   []string
+}
+
+func (p *recordingProjection) handle(_ context.Context, event events.DomainEvent) error {
+    p.types = append(p.types, event.Type())
+    if p.failing[event.Type()] {
+        return errors.New("read model unavailable")
+    }
+    return nil
+}
+
+func syncProjectionStat(name string) int64 {
+    if value, ok := syncProjectionStats.Get(name).(*expvar.Int); ok {
+        return value.Value()
+    }
+    return 0
+}
+
+// Each command hands its stored events to the synchronous projection before
+// returning. A failing projection leaves the command applied, and the flag
+// switches the projection off.
+func TestCommandService_syncProjection(t *testing.T) {
+    tests := []struct {
+        name        string
+        failing     map[string]bool
+        flagOff     bool
+        wantTypes   []string
+        wantApplied int64
+        wantFailed  int64
+        wantSkipped int64
+    }{
+        {name: "applied", wantTypes: []string{"OrderCreated", "OrderConfirmed"}, wantApplied: 2},
+        {name: "failing", failing: map[string]bool{"OrderCreated": true}, wantTypes: []string{"OrderCreated", "OrderConfirmed"}, wantApplied: 1, wantFailed: 1},
+        {name: "flag off", flagOff: true, wantSkipped: 2},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            f := newCommandFixture()
+            projection := &recordingProjection{failing: tt.failing}
+            f.service.SyncProjection = projection.handle
+            flags := featureflags.New()
+            flags.Configure(featureflags.SyncProjection, !tt.flagOff)
+            f.service.Flags = flags
+            applied, failed, skipped := syncProjectionStat("applied"), syncProjectionStat("failed"), syncProjectionStat("skipped_by_flag")
+            
+            id := f.createOrder(t, uuid.NewString())
+            if err := f.service.ConfirmOrder(ctx, id); err != nil {
+                t.Fatalf("ConfirmOrder() = %v", err)
+            }
+            if !reflect.DeepEqual(projection.types, tt.wantTypes) {
+                t.Errorf("projected %v, want %v", projection.types, tt.wantTypes)
+            }
+            if got := f.eventTypes(t, id, 0); !reflect.DeepEqual(got, []string{"OrderCreated", "OrderConfirmed"}) {
+                t.Errorf("stored %v, want the commands applied", got)
+            }
+            if got, want := []int64{syncProjectionStat("applied") - applied, syncProjectionStat("failed") - failed, syncProjectionStat("skipped_by_flag") - skipped}, []int64{tt.wantApplied, tt.wantFailed, tt.wantSkipped}; !reflect.DeepEqual(got, want) {
+                t.Errorf("applied, failed, skipped grew by %v, want %v", got, want)
+            }
+        })
+    }
+}
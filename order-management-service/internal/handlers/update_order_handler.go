@@ -2,55 +2,56 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/gorilla/mux"
 	"github.com/vdntruong/dddcqrs/shared/domain/entities"
 )
 
+// UpdateOrderHandler replaces a draft order's items and shipping address.
 type UpdateOrderHandler struct {
     Service *CommandService
 }
 
+// UpdateOrderRequest is the command, with the order version it expects.
+type UpdateOrderRequest struct {
+    UpdateOrderCommand
+    ExpectedVersion *int `json:"expected_version"`
+}
+
 func (h *UpdateOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    orderID := entities.OrderID(vars["id"])
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
     
-    var cmd UpdateOrderCommand
-    if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+    var req UpdateOrderRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, decodeError(err), http.StatusBadRequest)
         return
     }
     
+    cmd := req.UpdateOrderCommand
     cmd.OrderID = string(orderID)
     
-    // For now, we'll implement a simple update that replaces all items
-    // In a real application, you might want more granular updates
-    
-    // Load existing order
-    order, err := h.Service.OrderRepo.FindByID(r.Context(), orderID)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusNotFound)
+    ctx, ok := commandContext(w, r, req.ExpectedVersion)
+    if !ok {
         return
     }
     
-    // Clear existing items
-    order.Items = []entities.OrderItem{}
-    
-    // Add new items
-    for _, item := range cmd.Items {
-        if err := order.AddItem(item.ProductID, item.Quantity, item.Price); err != nil {
-            http.Error(w, err.Error(), http.StatusBadRequest)
+    if err := h.Service.UpdateOrder(ctx, cmd); err != nil {
+        if writeVersionError(w, r, err) {
             return
         }
-    }
-    
-    // Update shipping address
-    order.ShippingAddress = cmd.ShippingAddress
-    
-    // Save updated order
-    if err := h.Service.OrderRepo.Update(r.Context(), order); err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        if errors.Is(err, ErrRestrictedCountry) {
+            writeRestrictedCountry(w, err)
+            return
+        }
+        if errors.Is(err, entities.ErrItemPriceImmutable) || errors.Is(err, ErrPriceMismatch) || errors.Is(err, ErrOrderLimitExceeded) || errors.Is(err, ErrEventTooLarge) {
+            http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+            return
+        }
+        http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
     
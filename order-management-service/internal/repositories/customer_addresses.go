@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// CustomerAddressBook finds addresses customers have saved.
+type CustomerAddressBook interface {
+    // FindAddress returns the customer's address with addressID, or their
+    // default address when addressID is empty. It returns an error wrapping
+    // entities.ErrAddressNotFound when there is no such address.
+    FindAddress(ctx context.Context, customerID, addressID string) (valueobjects.Address, error)
+}
+
+// queryFindCustomerAddress names the statement in sqlmetrics.
+const queryFindCustomerAddress = "customer_addresses.find"
+
+type customerAddressBook struct {
+    db *sqlmetrics.DB
+}
+
+// NewCustomerAddressBook reads addresses from the customer read model until
+// a customer service owns them.
+func NewCustomerAddressBook(db *sqlmetrics.DB) CustomerAddressBook {
+    return &customerAddressBook{db: db}
+}
+
+func (b *customerAddressBook) FindAddress(ctx context.Context, customerID, addressID string) (valueobjects.Address, error) {
+    query := `
+        SELECT address
+        FROM customer_read_models, jsonb_array_elements(addresses) AS address
+        WHERE id = $1 AND address->>'id' = $2
+    `
+    args := []interface{}{customerID, addressID}
+    if addressID == "" {
+        query = `
+            SELECT address
+            FROM customer_read_models, jsonb_array_elements(addresses) AS address
+            WHERE id = $1 AND (address->>'default')::boolean IS TRUE
+        `
+        args = args[:1]
+    }
+    
+    var addressJSON []byte
+    err := b.db.QueryRow(ctx, queryFindCustomerAddress, query, args...).Scan(&addressJSON)
+    if err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            if addressID == "" {
+                return valueobjects.Address{}, fmt.Errorf("%w: customer %s has no default address", entities.ErrAddressNotFound, customerID)
+            }
+            return valueobjects.Address{}, fmt.Errorf("%w: customer %s has no address %s", entities.ErrAddressNotFound, customerID, addressID)
+        }
+        return valueobjects.Address{}, fmt.Errorf("failed to look up address: %w", err)
+    }
+    
+    var address entities.CustomerAddress
+    if err := json.Unmarshal(addressJSON, &address); err != nil {
+        return valueobjects.Address{}, fmt.Errorf("failed to unmarshal address: %w", err)
+    }
+    
+    return address.Address, nil
+}
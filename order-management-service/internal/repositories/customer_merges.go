@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// CustomerMerges records which customers were merged into another, in the
+// customer_merges table the command side owns.
+type CustomerMerges interface {
+    // MergedInto returns the customer customerID was merged into, or an
+    // empty string when it was not merged.
+    MergedInto(ctx context.Context, customerID string) (string, error)
+    // RecordMerge records that sourceID was merged into targetID at
+    // mergedAt, unless sourceID was merged before. It returns the customer
+    // sourceID is recorded as merged into, which differs from targetID
+    // when an earlier merge took it elsewhere.
+    RecordMerge(ctx context.Context, sourceID, targetID string, mergedAt time.Time) (string, error)
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryCustomerMergedInto = "customer_merges.merged_into"
+    queryRecordMerge        = "customer_merges.record"
+)
+
+type customerMerges struct {
+    db *sqlmetrics.DB
+}
+
+func NewCustomerMerges(db *sqlmetrics.DB) CustomerMerges {
+    return &customerMerges{db: db}
+}
+
+func (m *customerMerges) MergedInto(ctx context.Context, customerID string) (string, error) {
+    query := `SELECT target_id FROM customer_merges WHERE source_id = $1`
+    
+    var targetID string
+    err := m.db.QueryRow(ctx, queryCustomerMergedInto, query, customerID).Scan(&targetID)
+    if errors.Is(err, sql.ErrNoRows) {
+        return "", nil
+    }
+    if err != nil {
+        return "", fmt.Errorf("failed to look up customer merge: %w", err)
+    }
+    return targetID, nil
+}
+
+func (m *customerMerges) RecordMerge(ctx context.Context, sourceID, targetID string, mergedAt time.Time) (string, error) {
+    // Both parts see the table as it was before the statement, so exactly
+    // one of them returns a row
+    query := `
+        WITH inserted AS (
+            INSERT INTO customer_merges (source_id, target_id, merged_at)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (source_id) DO NOTHING
+            RETURNING target_id
+        )
+        SELECT target_id FROM inserted
+        UNION ALL
+        SELECT target_id FROM customer_merges WHERE source_id = $1
+    `
+    
+    var recorded string
+    if err := m.db.QueryRow(ctx, queryRecordMerge, query, sourceID, targetID, mergedAt.UTC()).Scan(&recorded); err != nil {
+        return "", fmt.Errorf("failed to record customer merge: %w", err)
+    }
+    return recorded, nil
+}
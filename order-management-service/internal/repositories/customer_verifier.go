@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// CustomerVerifier reports whether a customer id refers to a known customer.
+type CustomerVerifier interface {
+    CustomerExists(ctx context.Context, customerID string) (bool, error)
+}
+
+// queryCustomerExists names the statement in sqlmetrics.
+const queryCustomerExists = "customers.exists"
+
+type customerVerifier struct {
+    db *sqlmetrics.DB
+}
+
+// NewCustomerVerifier checks customers against the customer read model until
+// a customer service owns them.
+func NewCustomerVerifier(db *sqlmetrics.DB) CustomerVerifier {
+    return &customerVerifier{db: db}
+}
+
+func (v *customerVerifier) CustomerExists(ctx context.Context, customerID string) (bool, error) {
+    query := `SELECT EXISTS (SELECT 1 FROM customer_read_models WHERE id = $1)`
+    
+    var exists bool
+    if err := v.db.QueryRow(ctx, queryCustomerExists, query, customerID).Scan(&exists); err != nil {
+        return false, fmt.Errorf("failed to look up customer: %w", err)
+    }
+    
+    return exists, nil
+}
+
+type cachedVerification struct {
+    exists    bool
+    expiresAt time.Time
+}
+
+type cachingCustomerVerifier struct {
+    next    CustomerVerifier
+    ttl     time.Duration
+    mu      sync.Mutex
+    results map[string]cachedVerification
+}
+
+// NewCachingCustomerVerifier remembers the answers of next for ttl so a
+// burst of orders from one customer costs a single lookup. Failed lookups
+// are not cached.
+func NewCachingCustomerVerifier(next CustomerVerifier, ttl time.Duration) CustomerVerifier {
+    return &cachingCustomerVerifier{
+        next:    next,
+        ttl:     ttl,
+        results: make(map[string]cachedVerification),
+    }
+}
+
+func (v *cachingCustomerVerifier) CustomerExists(ctx context.Context, customerID string) (bool, error) {
+    now := clock.Now()
+    
+    v.mu.Lock()
+    cached, ok := v.results[customerID]
+    v.mu.Unlock()
+    if ok && now.Before(cached.expiresAt) {
+        return cached.exists, nil
+    }
+    
+    exists, err := v.next.CustomerExists(ctx, customerID)
+    if err != nil {
+        return false, err
+    }
+    
+    v.mu.Lock()
+    defer v.mu.Unlock()
+    
+    // Drop expired entries so the cache stays bounded by recent customers
+    for id, result := range v.results {
+        if !now.Before(result.expiresAt) {
+            delete(v.results, id)
+        }
+    }
+    v.results[customerID] = cachedVerification{exists: exists, expiresAt: now.Add(v.ttl)}
+    
+    return exists, nil
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+)
+
+// countingVerifier knows the customers in ids and counts its lookups. They
+// fail with err when it is set.
+type countingVerifier struct {
+    ids     map[string]bool
+    err     error
+    lookups int
+}
+
+func (v *countingVerifier) CustomerExists(_ context.Context, customerID string) (bool, error) {
+    v.lookups++
+    return v.ids[customerID], v.err
+}
+
+func TestCachingCustomerVerifier(t *testing.T) {
+    ctx := context.Background()
+    fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    defer clock.Set(fake)()
+    next := &countingVerifier{ids: map[string]bool{"customer-1": true}}
+    verifier := NewCachingCustomerVerifier(next, time.Minute)
+    
+    steps := []struct {
+        name        string
+        advance     time.Duration
+        customerID  string
+        want        bool
+        wantLookups int
+    }{
+        {name: "first lookup", customerID: "customer-1", want: true, wantLookups: 1},
+        {name: "cache hit", advance: 30 * time.Second, customerID: "customer-1", want: true, wantLookups: 1},
+        {name: "unknown customer", customerID: "customer-2", wantLookups: 2},
+        {name: "unknown customer cached", customerID: "customer-2", wantLookups: 2},
+        {name: "expired", advance: 30 * time.Second, customerID: "customer-1", want: true, wantLookups: 3},
+    }
+    for _, step := range steps {
+        fake.Advance(step.advance)
+        exists, err := verifier.CustomerExists(ctx, step.customerID)
+        if err != nil || exists != step.want {
+            t.Errorf("%s: CustomerExists(%s) = %t, %v, want %t", step.name, step.customerID, exists, err, step.want)
+        }
+        if next.lookups != step.wantLookups {
+            t.Errorf("%s: %d lookups, want %d", step.name, next.lookups, step.wantLookups)
+        }
+    }
+}
+
+// Failed lookups are not cached, so the next order tries again.
+func TestCachingCustomerVerifier_failedLookup(t *testing.T) {
+    ctx := context.Background()
+    next := &countingVerifier{ids: map[string]bool{"customer-1": true}, err: errors.New("db down")}
+    verifier := NewCachingCustomerVerifier(next, time.Minute)
+    
+    if _, err := verifier.CustomerExists(ctx, "customer-1"); err == nil {
+        t.Fatal("CustomerExists() with a failing lookup = nil error")
+    }
+    next.err = nil
+    if exists, err := verifier.CustomerExists(ctx, "customer-1"); err != nil || !exists {
+        t.Errorf("CustomerExists() after the failure = %t, %v, want true", exists, err)
+    }
+    if next.lookups != 2 {
+        t.Errorf("%d lookups, want 2", next.lookups)
+    }
+}
@@ -0,0 +1,40 @@
+package repositories
+
+import (
+	"expvar"
+)
+
+// DefaultMaxEventBytes caps the JSON of an event in the event store. It is
+// well over the outbox's default limit, which applies to compressed
+// payloads, so any event the outbox accepts fits.
+const DefaultMaxEventBytes = 8 * 1024 * 1024
+
+// eventStoreStats is published as the "event_store_payloads" expvar: per
+// event type the number of events rejected as over the size limit.
+var eventStoreStats = expvar.NewMap("event_store_payloads")
+
+// EventStoreOption configures how NewEventStore and NewUnitOfWork store
+// events.
+type EventStoreOption func(*eventWriter)
+
+// WithMaxEventBytes replaces DefaultMaxEventBytes. Events whose JSON is
+// larger are refused with an *events.EventTooLargeError before anything is
+// written; zero disables the limit.
+func WithMaxEventBytes(maxBytes int) EventStoreOption {
+    return func(w *eventWriter) {
+        w.maxBytes = maxBytes
+    }
+}
+
+// eventWriter inserts events into the event store.
+type eventWriter struct {
+    maxBytes int
+}
+
+func newEventWriter(opts []EventStoreOption) eventWriter {
+    w := eventWriter{maxBytes: DefaultMaxEventBytes}
+    for _, opt := range opts {
+        opt(&w)
+    }
+    return w
+}
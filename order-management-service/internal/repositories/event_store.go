@@ -2,39 +2,152 @@ package repositories
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventfeed"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
 )
 
 type EventStore interface {
-    SaveEvents(ctx context.Context, aggregateID string, events []events.DomainEvent, expectedVersion int) error
+    // SaveEvents and AppendEvents return the events as stored, each with
+    // its version as its sequence.
+    // SaveEvents fails with ErrVersionConflict unless the aggregate is at
+    // expectedVersion.
+    SaveEvents(ctx context.Context, aggregateID string, events []events.DomainEvent, expectedVersion int) ([]events.DomainEvent, error)
+    // AppendEvents saves events after the aggregate's latest stored event.
+    AppendEvents(ctx context.Context, aggregateID string, events []events.DomainEvent) ([]events.DomainEvent, error)
+    // Version returns the version of the aggregate's latest event, 0 when
+    // it has none.
+    Version(ctx context.Context, aggregateID string) (int, error)
+    // GetEvents returns the aggregate's events in version order, each with
+    // its version as its sequence.
     GetEvents(ctx context.Context, aggregateID string) ([]events.DomainEvent, error)
+    // GetRawEvents returns a page of an aggregate's events as stored, in
+    // version order, along with the total number of events it has.
+    GetRawEvents(ctx context.Context, aggregateID string, page pagination.Pagination) ([]RawEvent, int, error)
+    // GetEventsSince returns up to limit events of every aggregate stored
+    // after position after, in the order they were stored. A transaction
+    // committing late can store events at positions already read past.
+    GetEventsSince(ctx context.Context, after int64, limit int) ([]eventfeed.Event, error)
 }
 
+// RawEvent is an event store row with its payload left undecoded.
+type RawEvent struct {
+    AggregateID string            `json:"aggregate_id"`
+    EventType   string            `json:"event_type"`
+    Version     int               `json:"version"`
+    OccurredAt  apijson.Timestamp `json:"occurred_at"`
+    StoredAt    apijson.Timestamp `json:"stored_at"`
+    Payload     json.RawMessage   `json:"payload"`
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryEventVersion = "events.version"
+    queryInsertEvent  = "events.insert"
+    queryGetEvents    = "events.get"
+    queryCountEvents  = "events.count"
+    queryGetRawEvents = "events.get_raw"
+    queryEventsSince  = "events.since"
+)
+
 type eventStore struct {
-    db *sql.DB
+    eventWriter
+    db       *sqlmetrics.DB
+    registry *events.Registry
+}
+
+func NewEventStore(db *sqlmetrics.DB, registry *events.Registry, opts ...EventStoreOption) EventStore {
+    return &eventStore{eventWriter: newEventWriter(opts), db: db, registry: registry}
+}
+
+func (es *eventStore) SaveEvents(ctx context.Context, aggregateID string, domainEvents []events.DomainEvent, expectedVersion int) ([]events.DomainEvent, error) {
+    tx, err := es.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+    
+    version, err := eventVersion(ctx, tx.DB, aggregateID)
+    if err != nil {
+        return nil, err
+    }
+    if version != expectedVersion {
+        return nil, fmt.Errorf("%w: aggregate %s is at version %d, expected %d", ErrVersionConflict, aggregateID, version, expectedVersion)
+    }
+    
+    stored, err := es.insertEvents(ctx, tx, aggregateID, domainEvents, expectedVersion)
+    if err != nil {
+        return nil, err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return stored, nil
 }
 
-func NewEventStore(db *sql.DB) EventStore {
-    return &eventStore{db: db}
+func (es *eventStore) Version(ctx context.Context, aggregateID string) (int, error) {
+    return eventVersion(ctx, es.db, aggregateID)
 }
 
-func (es *eventStore) SaveEvents(ctx context.Context, aggregateID string, domainEvents []events.DomainEvent, expectedVersion int) error {
+// eventVersion reads the latest version of an aggregate on db, which may be
+// a transaction's.
+func eventVersion(ctx context.Context, db *sqlmetrics.DB, aggregateID string) (int, error) {
+    var version int
+    query := `SELECT COALESCE(MAX(version), 0) FROM events WHERE aggregate_id = $1`
+    if err := db.QueryRow(ctx, queryEventVersion, query, aggregateID).Scan(&version); err != nil {
+        return 0, fmt.Errorf("failed to read event version: %w", err)
+    }
+    return version, nil
+}
+
+func (es *eventStore) AppendEvents(ctx context.Context, aggregateID string, domainEvents []events.DomainEvent) ([]events.DomainEvent, error) {
     tx, err := es.db.BeginTx(ctx, nil)
     if err != nil {
-        return fmt.Errorf("failed to begin transaction: %w", err)
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
     }
     defer tx.Rollback()
     
+    // A concurrent append takes the same version and fails on the unique
+    // (aggregate_id, version) constraint rather than interleaving
+    version, err := eventVersion(ctx, tx.DB, aggregateID)
+    if err != nil {
+        return nil, err
+    }
+    
+    stored, err := es.insertEvents(ctx, tx, aggregateID, domainEvents, version)
+    if err != nil {
+        return nil, err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return nil, err
+    }
+    return stored, nil
+}
+
+// insertEvents stores domainEvents after expectedVersion, stamping each with
+// its version so the payload carries its position in the history. An event
+// over the size limit fails the insert before it is written.
+func (w eventWriter) insertEvents(ctx context.Context, tx *sqlmetrics.Tx, aggregateID string, domainEvents []events.DomainEvent, expectedVersion int) ([]events.DomainEvent, error) {
+    stored := make([]events.DomainEvent, 0, len(domainEvents))
     for i, event := range domainEvents {
         version := expectedVersion + i + 1
+        event = events.WithSequence(event, version)
         
         eventData, err := json.Marshal(event)
         if err != nil {
-            return fmt.Errorf("failed to marshal event: %w", err)
+            return nil, fmt.Errorf("failed to marshal event: %w", err)
+        }
+        if err := events.CheckSize(event, eventData, w.maxBytes, "EVENT_STORE_MAX_EVENT_BYTES"); err != nil {
+            eventStoreStats.Add(event.Type()+".rejected", 1)
+            return nil, err
         }
         
         query := `
@@ -42,20 +155,21 @@ func (es *eventStore) SaveEvents(ctx context.Context, aggregateID string, domain
             VALUES ($1, $2, $3, $4, $5)
         `
         
-        _, err = tx.ExecContext(ctx, query,
+        _, err = tx.Exec(ctx, queryInsertEvent, query,
             aggregateID,
             event.Type(),
             eventData,
             version,
-            event.OccurredAt(),
+            event.OccurredAt().UTC(),
         )
         
         if err != nil {
-            return fmt.Errorf("failed to save event: %w", err)
+            return nil, fmt.Errorf("failed to save event: %w", err)
         }
+        stored = append(stored, event)
     }
     
-    return tx.Commit()
+    return stored, nil
 }
 
 func (es *eventStore) GetEvents(ctx context.Context, aggregateID string) ([]events.DomainEvent, error) {
@@ -66,7 +180,7 @@ func (es *eventStore) GetEvents(ctx context.Context, aggregateID string) ([]even
         ORDER BY version ASC
     `
     
-    rows, err := es.db.QueryContext(ctx, query, aggregateID)
+    rows, err := es.db.Query(ctx, queryGetEvents, query, aggregateID)
     if err != nil {
         return nil, fmt.Errorf("failed to query events: %w", err)
     }
@@ -77,7 +191,7 @@ func (es *eventStore) GetEvents(ctx context.Context, aggregateID string) ([]even
         var eventType string
         var eventData []byte
         var version int
-        var occurredAt string
+        var occurredAt time.Time
         
         err := rows.Scan(&eventType, &eventData, &version, &occurredAt)
         if err != nil {
@@ -85,64 +199,100 @@ func (es *eventStore) GetEvents(ctx context.Context, aggregateID string) ([]even
         }
         
         // Parse event based on type
-        event, err := es.parseEvent(eventType, eventData)
+        event, err := es.registry.Unmarshal(eventType, eventData)
         if err != nil {
             return nil, fmt.Errorf("failed to parse event: %w", err)
         }
         
-        domainEvents = append(domainEvents, event)
+        // Payloads stored before events carried a sequence lack one; the
+        // version column is authoritative either way
+        domainEvents = append(domainEvents, events.WithSequence(event, version))
     }
     
-    return domainEvents, nil
+    return domainEvents, rows.Err()
 }
 
-func (es *eventStore) parseEvent(eventType string, eventData []byte) (events.DomainEvent, error) {
-    // This is a simplified version - in production, you'd use a more sophisticated
-    // event deserialization mechanism
-    switch eventType {
-    case "OrderCreated":
-        var event events.OrderCreatedEvent
-        if err := json.Unmarshal(eventData, &event); err != nil {
-            return nil, err
-        }
-        return event, nil
-    case "OrderConfirmed":
-        var event events.OrderConfirmedEvent
-        if err := json.Unmarshal(eventData, &event); err != nil {
-            return nil, err
-        }
-        return event, nil
-    case "OrderShipped":
-        var event events.OrderShippedEvent
-        if err := json.Unmarshal(eventData, &event); err != nil {
-            return nil, err
-        }
-        return event, nil
-    case "OrderDelivered":
-        var event events.OrderDeliveredEvent
-        if err := json.Unmarshal(eventData, &event); err != nil {
-            return nil, err
-        }
-        return event, nil
-    case "OrderCancelled":
-        var event events.OrderCancelledEvent
-        if err := json.Unmarshal(eventData, &event); err != nil {
-            return nil, err
-        }
-        return event, nil
-    case "OrderItemAdded":
-        var event events.OrderItemAddedEvent
-        if err := json.Unmarshal(eventData, &event); err != nil {
-            return nil, err
+func (es *eventStore) GetRawEvents(ctx context.Context, aggregateID string, page pagination.Pagination) ([]RawEvent, int, error) {
+    var total int
+    countQuery := `SELECT COUNT(*) FROM events WHERE aggregate_id = $1`
+    if err := es.db.QueryRow(ctx, queryCountEvents, countQuery, aggregateID).Scan(&total); err != nil {
+        return nil, 0, fmt.Errorf("failed to count events: %w", err)
+    }
+    if total == 0 {
+        return nil, 0, nil
+    }
+    
+    limitClause, limitArgs := page.LimitOffsetClause(2)
+    query := `
+        SELECT aggregate_id, event_type, version, occurred_at, created_at, event_data
+        FROM events
+        WHERE aggregate_id = $1
+        ORDER BY version ASC
+        ` + limitClause
+    
+    args := append([]interface{}{aggregateID}, limitArgs...)
+    rows, err := es.db.Query(ctx, queryGetRawEvents, query, args...)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to query events: %w", err)
+    }
+    defer rows.Close()
+    
+    rawEvents := []RawEvent{}
+    for rows.Next() {
+        var event RawEvent
+        var payload []byte
+        err := rows.Scan(
+            &event.AggregateID,
+            &event.EventType,
+            &event.Version,
+            &event.OccurredAt,
+            &event.StoredAt,
+            &payload,
+        )
+        if err != nil {
+            return nil, 0, fmt.Errorf("failed to scan event: %w", err)
         }
-        return event, nil
-    case "OrderItemRemoved":
-        var event events.OrderItemRemovedEvent
-        if err := json.Unmarshal(eventData, &event); err != nil {
-            return nil, err
+        event.Payload = json.RawMessage(payload)
+        rawEvents = append(rawEvents, event)
+    }
+    
+    return rawEvents, total, rows.Err()
+}
+
+func (es *eventStore) GetEventsSince(ctx context.Context, after int64, limit int) ([]eventfeed.Event, error) {
+    query := `
+        SELECT id, aggregate_id, event_type, version, occurred_at, created_at, event_data
+        FROM events
+        WHERE id > $1
+        ORDER BY id ASC
+        LIMIT $2
+    `
+    
+    rows, err := es.db.Query(ctx, queryEventsSince, query, after, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query events: %w", err)
+    }
+    defer rows.Close()
+    
+    feed := []eventfeed.Event{}
+    for rows.Next() {
+        var event eventfeed.Event
+        var payload []byte
+        err := rows.Scan(
+            &event.Position,
+            &event.AggregateID,
+            &event.EventType,
+            &event.Version,
+            &event.OccurredAt,
+            &event.StoredAt,
+            &payload,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan event: %w", err)
         }
-        return event, nil
-    default:
-        return nil, fmt.Errorf("unknown event type: %s", eventType)
+        event.Payload = json.RawMessage(payload)
+        feed = append(feed, event)
     }
+    
+    return feed, rows.Err()
 }
@@ -0,0 +1,486 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// newEventStoreFunc returns an empty event store for one subtest.
+type newEventStoreFunc func(t *testing.T, opts ...EventStoreOption) EventStore
+
+func TestMemoryEventStore(t *testing.T) {
+    testEventStore(t, func(t *testing.T, opts ...EventStoreOption) EventStore {
+        return NewMemoryEventStore(events.DefaultRegistry(), opts...)
+    })
+}
+
+func TestFileEventStore(t *testing.T) {
+    testEventStore(t, func(t *testing.T, opts ...EventStoreOption) EventStore {
+        store, err := OpenFileEventStore(filepath.Join(t.TempDir(), "events.jsonl"), events.DefaultRegistry(), opts...)
+        if err != nil {
+            t.Fatalf("OpenFileEventStore: %v", err)
+        }
+        t.Cleanup(func() { store.Close() })
+        return store
+    })
+}
+
+func TestPostgresEventStore(t *testing.T) {
+    testEventStore(t, func(t *testing.T, opts ...EventStoreOption) EventStore {
+        return NewEventStore(sqlmetrics.Wrap(schematest.Open(t), 0), events.DefaultRegistry(), opts...)
+    })
+}
+
+// testEventStore checks that the store newStore returns behaves as the
+// EventStore interface documents, so every implementation is held to the
+// same contract.
+func testEventStore(t *testing.T, newStore newEventStoreFunc) {
+    ctx := context.Background()
+    
+    t.Run("empty", func(t *testing.T) {
+        store := newStore(t)
+        
+        if version, err := store.Version(ctx, "order-1"); err != nil || version != 0 {
+            t.Errorf("Version() = %d, %v; want 0", version, err)
+        }
+        if got, err := store.GetEvents(ctx, "order-1"); err != nil || len(got) != 0 {
+            t.Errorf("GetEvents() = %v, %v; want none", got, err)
+        }
+        if got, total, err := store.GetRawEvents(ctx, "order-1", pagination.Pagination{Limit: 10}); err != nil || len(got) != 0 || total != 0 {
+            t.Errorf("GetRawEvents() = %v, %d, %v; want none", got, total, err)
+        }
+        if got, err := store.GetEventsSince(ctx, 0, 10); err != nil || len(got) != 0 {
+            t.Errorf("GetEventsSince() = %v, %v; want none", got, err)
+        }
+    })
+    
+    t.Run("save and load", func(t *testing.T) {
+        store := newStore(t)
+        history := orderHistory(t, "order-1")
+        
+        stored, err := store.SaveEvents(ctx, "order-1", history, 0)
+        if err != nil {
+            t.Fatalf("SaveEvents() = %v", err)
+        }
+        assertSequences(t, "SaveEvents()", stored, history)
+        
+        if version, err := store.Version(ctx, "order-1"); err != nil || version != len(history) {
+            t.Errorf("Version() = %d, %v; want %d", version, err, len(history))
+        }
+        loaded, err := store.GetEvents(ctx, "order-1")
+        if err != nil {
+            t.Fatalf("GetEvents() = %v", err)
+        }
+        assertSequences(t, "GetEvents()", loaded, history)
+        for i, event := range loaded {
+            if event.EventID() != history[i].EventID() || event.AggregateID() != "order-1" {
+                t.Errorf("event %d = %s of %s, want %s of order-1", i, event.EventID(), event.AggregateID(), history[i].EventID())
+            }
+            // Decoded from the payload, which keeps the whole time
+            if !event.OccurredAt().Equal(history[i].OccurredAt()) {
+                t.Errorf("event %d occurred at %s, want %s", i, event.OccurredAt(), history[i].OccurredAt())
+            }
+        }
+        created, ok := loaded[0].(events.OrderCreatedEvent)
+        if !ok {
+            t.Fatalf("first event is %T, want events.OrderCreatedEvent", loaded[0])
+        }
+        if len(created.Items) != 1 || created.Items[0].ProductID != "product-1" {
+            t.Errorf("OrderCreated items = %+v, want product-1", created.Items)
+        }
+    })
+    
+    t.Run("version conflict", func(t *testing.T) {
+        store := newStore(t)
+        history := orderHistory(t, "order-1")
+        if _, err := store.SaveEvents(ctx, "order-1", history[:1], 0); err != nil {
+            t.Fatalf("SaveEvents() = %v", err)
+        }
+        
+        for _, expected := range []int{0, 2} {
+            _, err := store.SaveEvents(ctx, "order-1", history[1:], expected)
+            if !errors.Is(err, ErrVersionConflict) {
+                t.Errorf("SaveEvents() at version %d = %v, want ErrVersionConflict", expected, err)
+            }
+        }
+        if version, _ := store.Version(ctx, "order-1"); version != 1 {
+            t.Errorf("Version() after conflicts = %d, want 1", version)
+        }
+    })
+    
+    t.Run("append", func(t *testing.T) {
+        store := newStore(t)
+        history := orderHistory(t, "order-1")
+        if _, err := store.SaveEvents(ctx, "order-1", history[:1], 0); err != nil {
+            t.Fatalf("SaveEvents() = %v", err)
+        }
+        
+        stored, err := store.AppendEvents(ctx, "order-1", history[1:])
+        if err != nil {
+            t.Fatalf("AppendEvents() = %v", err)
+        }
+        if len(stored) != len(history)-1 || stored[0].Sequence() != 2 {
+            t.Fatalf("AppendEvents() stored %d events from sequence %d, want %d from 2", len(stored), stored[0].Sequence(), len(history)-1)
+        }
+        loaded, err := store.GetEvents(ctx, "order-1")
+        if err != nil {
+            t.Fatalf("GetEvents() = %v", err)
+        }
+        assertSequences(t, "GetEvents()", loaded, history)
+    })
+    
+    t.Run("aggregates are separate", func(t *testing.T) {
+        store := newStore(t)
+        if _, err := store.SaveEvents(ctx, "order-1", orderHistory(t, "order-1"), 0); err != nil {
+            t.Fatalf("SaveEvents(order-1) = %v", err)
+        }
+        other := orderHistory(t, "order-2")[:1]
+        if _, err := store.SaveEvents(ctx, "order-2", other, 0); err != nil {
+            t.Fatalf("SaveEvents(order-2) = %v", err)
+        }
+        
+        loaded, err := store.GetEvents(ctx, "order-2")
+        if err != nil {
+            t.Fatalf("GetEvents() = %v", err)
+        }
+        assertSequences(t, "GetEvents(order-2)", loaded, other)
+    })
+    
+    t.Run("raw events", func(t *testing.T) {
+        store := newStore(t)
+        history := orderHistory(t, "order-1")
+        if _, err := store.SaveEvents(ctx, "order-1", history, 0); err != nil {
+            t.Fatalf("SaveEvents() = %v", err)
+        }
+        
+        tests := []struct {
+            name         string
+            page         pagination.Pagination
+            wantVersions []int
+        }{
+            {name: "first page", page: pagination.Pagination{Limit: 2}, wantVersions: []int{1, 2}},
+            {name: "second page", page: pagination.Pagination{Limit: 2, Offset: 2}, wantVersions: []int{3}},
+            {name: "past the end", page: pagination.Pagination{Limit: 2, Offset: 5}, wantVersions: nil},
+        }
+        for _, tt := range tests {
+            t.Run(tt.name, func(t *testing.T) {
+                raw, total, err := store.GetRawEvents(ctx, "order-1", tt.page)
+                if err != nil {
+                    t.Fatalf("GetRawEvents() = %v", err)
+                }
+                if total != len(history) {
+                    t.Errorf("total = %d, want %d", total, len(history))
+                }
+                var versions []int
+                for _, event := range raw {
+                    versions = append(versions, event.Version)
+                    if event.AggregateID != "order-1" || event.EventType != history[event.Version-1].Type() {
+                        t.Errorf("version %d = %s of %s, want %s of order-1", event.Version, event.EventType, event.AggregateID, history[event.Version-1].Type())
+                    }
+                    if !strings.Contains(string(event.Payload), history[event.Version-1].EventID()) {
+                        t.Errorf("version %d payload %s lacks the event id", event.Version, event.Payload)
+                    }
+                    // Rows keep times to the microsecond, as Postgres does
+                    if want := history[event.Version-1].OccurredAt().Truncate(time.Microsecond); !event.OccurredAt.Equal(want) {
+                        t.Errorf("version %d occurred at %s, want %s", event.Version, event.OccurredAt.Time, want)
+                    }
+                    if event.StoredAt.IsZero() {
+                        t.Errorf("version %d has no stored time", event.Version)
+                    }
+                }
+                if !equalInts(versions, tt.wantVersions) {
+                    t.Errorf("versions = %v, want %v", versions, tt.wantVersions)
+                }
+            })
+        }
+    })
+    
+    t.Run("feed", func(t *testing.T) {
+        store := newStore(t)
+        first, second := orderHistory(t, "order-1"), orderHistory(t, "order-2")
+        if _, err := store.SaveEvents(ctx, "order-1", first[:2], 0); err != nil {
+            t.Fatalf("SaveEvents(order-1) = %v", err)
+        }
+        if _, err := store.SaveEvents(ctx, "order-2", second[:1], 0); err != nil {
+            t.Fatalf("SaveEvents(order-2) = %v", err)
+        }
+        if _, err := store.AppendEvents(ctx, "order-1", first[2:]); err != nil {
+            t.Fatalf("AppendEvents(order-1) = %v", err)
+        }
+        
+        feed, err := store.GetEventsSince(ctx, 0, 10)
+        if err != nil {
+            t.Fatalf("GetEventsSince() = %v", err)
+        }
+        want := []struct {
+            aggregateID string
+            version     int
+        }{{"order-1", 1}, {"order-1", 2}, {"order-2", 1}, {"order-1", 3}}
+        if len(feed) != len(want) {
+            t.Fatalf("GetEventsSince() returned %d events, want %d", len(feed), len(want))
+        }
+        for i, event := range feed {
+            if event.AggregateID != want[i].aggregateID || event.Version != want[i].version {
+                t.Errorf("feed[%d] = %s v%d, want %s v%d", i, event.AggregateID, event.Version, want[i].aggregateID, want[i].version)
+            }
+            if i > 0 && event.Position <= feed[i-1].Position {
+                t.Errorf("feed[%d] at position %d, not after %d", i, event.Position, feed[i-1].Position)
+            }
+            decoded, err := event.Decode(events.DefaultRegistry())
+            if err != nil || decoded.Sequence() != event.Version {
+                t.Errorf("feed[%d].Decode() = %v, %v; want sequence %d", i, decoded, err, event.Version)
+            }
+        }
+        
+        page, err := store.GetEventsSince(ctx, feed[0].Position, 2)
+        if err != nil {
+            t.Fatalf("GetEventsSince() = %v", err)
+        }
+        if len(page) != 2 || page[0].Position != feed[1].Position || page[1].Position != feed[2].Position {
+            t.Errorf("GetEventsSince(after %d, 2) = %+v, want positions %d and %d", feed[0].Position, page, feed[1].Position, feed[2].Position)
+        }
+        if rest, err := store.GetEventsSince(ctx, feed[len(feed)-1].Position, 10); err != nil || len(rest) != 0 {
+            t.Errorf("GetEventsSince(after the last) = %v, %v; want none", rest, err)
+        }
+    })
+    
+    t.Run("same timestamp", func(t *testing.T) {
+        store := newStore(t)
+        // Commands in the same instant, from a clock outside UTC
+        occurredAt := time.Date(2024, 3, 1, 19, 0, 0, 0, time.FixedZone("ICT", 7*60*60))
+        defer clock.Set(clock.NewFake(occurredAt))()
+        history := orderHistory(t, "order-1")
+        for i, event := range history {
+            if _, err := store.SaveEvents(ctx, "order-1", []events.DomainEvent{event}, i); err != nil {
+                t.Fatalf("SaveEvents(%s) = %v", event.Type(), err)
+            }
+        }
+        
+        loaded, err := store.GetEvents(ctx, "order-1")
+        if err != nil {
+            t.Fatalf("GetEvents() = %v", err)
+        }
+        assertSequences(t, "GetEvents()", loaded, history)
+        for _, event := range loaded {
+            if !event.OccurredAt().Equal(occurredAt) {
+                t.Errorf("%s occurred at %v, want %v", event.Type(), event.OccurredAt(), occurredAt)
+            }
+        }
+        
+        feed, err := store.GetEventsSince(ctx, 0, 10)
+        if err != nil {
+            t.Fatalf("GetEventsSince() = %v", err)
+        }
+        for i, event := range feed {
+            if event.EventType != history[i].Type() || event.Version != i+1 {
+                t.Errorf("feed[%d] = %s #%d, want %s #%d", i, event.EventType, event.Version, history[i].Type(), i+1)
+            }
+        }
+    })
+    
+    t.Run("event too large", func(t *testing.T) {
+        store := newStore(t, WithMaxEventBytes(200))
+        history := orderHistory(t, "order-1")
+        
+        _, err := store.SaveEvents(ctx, "order-1", history, 0)
+        if !errors.Is(err, events.ErrEventTooLarge) {
+            t.Fatalf("SaveEvents() = %v, want ErrEventTooLarge", err)
+        }
+        if version, _ := store.Version(ctx, "order-1"); version != 0 {
+            t.Errorf("Version() after a refused save = %d, want 0", version)
+        }
+        if feed, _ := store.GetEventsSince(ctx, 0, 10); len(feed) != 0 {
+            t.Errorf("GetEventsSince() after a refused save = %d events, want none", len(feed))
+        }
+    })
+}
+
+func TestFileEventStore_reopen(t *testing.T) {
+    ctx := context.Background()
+    path := filepath.Join(t.TempDir(), "events.jsonl")
+    history := orderHistory(t, "order-1")
+    
+    store, err := OpenFileEventStore(path, events.DefaultRegistry())
+    if err != nil {
+        t.Fatalf("OpenFileEventStore() = %v", err)
+    }
+    if _, err := store.SaveEvents(ctx, "order-1", history, 0); err != nil {
+        t.Fatalf("SaveEvents() = %v", err)
+    }
+    if err := store.Close(); err != nil {
+        t.Fatalf("Close() = %v", err)
+    }
+    
+    reopened, err := OpenFileEventStore(path, events.DefaultRegistry())
+    if err != nil {
+        t.Fatalf("reopening = %v", err)
+    }
+    defer reopened.Close()
+    loaded, err := reopened.GetEvents(ctx, "order-1")
+    if err != nil {
+        t.Fatalf("GetEvents() = %v", err)
+    }
+    assertSequences(t, "GetEvents() after reopening", loaded, history)
+    if _, err := reopened.SaveEvents(ctx, "order-1", history[:1], len(history)); err != nil {
+        t.Errorf("SaveEvents() after reopening = %v", err)
+    }
+}
+
+// The stores NewStoreUnitOfWork takes back the last events saved, and
+// refuse to once others were saved after them.
+func TestRetractingEventStore_RetractEvents(t *testing.T) {
+    ctx := context.Background()
+    stores := []struct {
+        name     string
+        newStore func(t *testing.T) RetractingEventStore
+    }{
+        {name: "memory", newStore: func(t *testing.T) RetractingEventStore {
+            return NewMemoryEventStore(events.DefaultRegistry())
+        }},
+        {name: "file", newStore: func(t *testing.T) RetractingEventStore {
+            store, err := OpenFileEventStore(filepath.Join(t.TempDir(), "events.jsonl"), events.DefaultRegistry())
+            if err != nil {
+                t.Fatalf("OpenFileEventStore: %v", err)
+            }
+            t.Cleanup(func() { store.Close() })
+            return store
+        }},
+    }
+    
+    for _, tt := range stores {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Run("last events", func(t *testing.T) {
+                store := tt.newStore(t)
+                history := orderHistory(t, "order-1")
+                if _, err := store.SaveEvents(ctx, "order-1", history[:1], 0); err != nil {
+                    t.Fatalf("SaveEvents() = %v", err)
+                }
+                if _, err := store.SaveEvents(ctx, "order-1", history[1:], 1); err != nil {
+                    t.Fatalf("SaveEvents() = %v", err)
+                }
+                
+                if err := store.RetractEvents(ctx, "order-1", 1); err != nil {
+                    t.Fatalf("RetractEvents() = %v", err)
+                }
+                if version, _ := store.Version(ctx, "order-1"); version != 1 {
+                    t.Errorf("Version() after retracting = %d, want 1", version)
+                }
+                if feed, _ := store.GetEventsSince(ctx, 0, 10); len(feed) != 1 {
+                    t.Errorf("GetEventsSince() after retracting = %d events, want 1", len(feed))
+                }
+                // The retracted versions are free again
+                if _, err := store.SaveEvents(ctx, "order-1", history[1:], 1); err != nil {
+                    t.Errorf("SaveEvents() after retracting = %v", err)
+                }
+            })
+            
+            t.Run("events saved since", func(t *testing.T) {
+                store := tt.newStore(t)
+                if _, err := store.SaveEvents(ctx, "order-1", orderHistory(t, "order-1"), 0); err != nil {
+                    t.Fatalf("SaveEvents(order-1) = %v", err)
+                }
+                if _, err := store.SaveEvents(ctx, "order-2", orderHistory(t, "order-2")[:1], 0); err != nil {
+                    t.Fatalf("SaveEvents(order-2) = %v", err)
+                }
+                
+                if err := store.RetractEvents(ctx, "order-1", 1); !errors.Is(err, ErrEventsNotLast) {
+                    t.Errorf("RetractEvents() = %v, want ErrEventsNotLast", err)
+                }
+                if version, _ := store.Version(ctx, "order-1"); version != 3 {
+                    t.Errorf("Version() after a refused retraction = %d, want 3", version)
+                }
+            })
+        })
+    }
+}
+
+func TestFileEventStore_RetractEvents_reopen(t *testing.T) {
+    ctx := context.Background()
+    path := filepath.Join(t.TempDir(), "events.jsonl")
+    history := orderHistory(t, "order-1")
+    
+    store, err := OpenFileEventStore(path, events.DefaultRegistry())
+    if err != nil {
+        t.Fatalf("OpenFileEventStore() = %v", err)
+    }
+    if _, err := store.SaveEvents(ctx, "order-1", history, 0); err != nil {
+        t.Fatalf("SaveEvents() = %v", err)
+    }
+    if err := store.RetractEvents(ctx, "order-1", 2); err != nil {
+        t.Fatalf("RetractEvents() = %v", err)
+    }
+    if err := store.Close(); err != nil {
+        t.Fatalf("Close() = %v", err)
+    }
+    
+    reopened, err := OpenFileEventStore(path, events.DefaultRegistry())
+    if err != nil {
+        t.Fatalf("reopening = %v", err)
+    }
+    defer reopened.Close()
+    loaded, err := reopened.GetEvents(ctx, "order-1")
+    if err != nil {
+        t.Fatalf("GetEvents() = %v", err)
+    }
+    assertSequences(t, "GetEvents() after reopening", loaded, history[:2])
+}
+
+// orderHistory returns the events of an order created, confirmed and
+// shipped, with one item, not yet stored.
+func orderHistory(t *testing.T, id string) []events.DomainEvent {
+    t.Helper()
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    order.ID = entities.OrderID(id)
+    if err := order.AddItem("product-1", 2, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    created := events.NewOrderCreatedEvent(order)
+    if err := order.Confirm(); err != nil {
+        t.Fatalf("Confirm: %v", err)
+    }
+    confirmed := events.NewOrderConfirmedEvent(order)
+    if err := order.Ship(); err != nil {
+        t.Fatalf("Ship: %v", err)
+    }
+    return []events.DomainEvent{created, confirmed, events.NewOrderShippedEvent(order)}
+}
+
+// assertSequences checks that got are want in order, numbered from 1.
+func assertSequences(t *testing.T, call string, got, want []events.DomainEvent) {
+    t.Helper()
+    if len(got) != len(want) {
+        t.Fatalf("%s returned %d events, want %d", call, len(got), len(want))
+    }
+    for i, event := range got {
+        if event.Type() != want[i].Type() || event.Sequence() != i+1 {
+            t.Errorf("%s[%d] = %s #%d, want %s #%d", call, i, event.Type(), event.Sequence(), want[i].Type(), i+1)
+        }
+    }
+}
+
+func equalInts(a, b []int) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
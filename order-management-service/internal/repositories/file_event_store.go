@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventfeed"
+)
+
+// FileEventStore is an EventStore appending its events to a file, one JSON
+// eventfeed.Event per line, so the file is also a snapshot eventfeed reads.
+// Each save is written and synced to disk before it returns. The file is
+// read into memory when opened, which indexes it by aggregate, so it suits
+// small tools and demos rather than large histories. Only one process may
+// have the file open at a time.
+type FileEventStore struct {
+    *memoryEventStore
+    
+    closeOnce sync.Once
+    file      *os.File
+}
+
+// OpenFileEventStore opens the event log at path, creating it if needed.
+// A last line left incomplete by a crash during a save is cut off, as that
+// save never returned; any other unreadable line fails the open.
+func OpenFileEventStore(path string, registry *events.Registry, opts ...EventStoreOption) (*FileEventStore, error) {
+    file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open event store: %w", err)
+    }
+    
+    store := &FileEventStore{memoryEventStore: newMemoryEventStore(registry, opts), file: file}
+    if err := store.load(); err != nil {
+        file.Close()
+        return nil, fmt.Errorf("failed to read event store %s: %w", path, err)
+    }
+    store.persist = store.write
+    store.unpersist = store.cut
+    return store, nil
+}
+
+// load reads the file into the index and leaves the file positioned at the
+// end of its last complete line.
+func (s *FileEventStore) load() error {
+    reader := bufio.NewReader(s.file)
+    var offset int64
+    for {
+        line, err := reader.ReadBytes('\n')
+        if errors.Is(err, io.EOF) {
+            if len(bytes.TrimSpace(line)) > 0 {
+                log.Printf("Event store %s ends in an incomplete line, cutting it off", s.file.Name())
+            }
+            break
+        }
+        if err != nil {
+            return err
+        }
+        
+        var record eventfeed.Event
+        if err := json.Unmarshal(line, &record); err != nil {
+            return fmt.Errorf("line at offset %d: %w", offset, err)
+        }
+        if err := s.check(record); err != nil {
+            return fmt.Errorf("line at offset %d: %w", offset, err)
+        }
+        s.add(record)
+        offset += int64(len(line))
+    }
+    
+    if err := s.file.Truncate(offset); err != nil {
+        return err
+    }
+    _, err := s.file.Seek(offset, io.SeekStart)
+    return err
+}
+
+// check reports a record that does not continue the log where it is.
+func (s *FileEventStore) check(record eventfeed.Event) error {
+    if want := int64(len(s.log) + 1); record.Position != want {
+        return fmt.Errorf("position %d where %d was expected", record.Position, want)
+    }
+    if want := len(s.aggregates[record.AggregateID]) + 1; record.Version != want {
+        return fmt.Errorf("aggregate %s at version %d where %d was expected", record.AggregateID, record.Version, want)
+    }
+    return nil
+}
+
+// encodeRecords returns records as the lines of the file.
+func encodeRecords(records []eventfeed.Event) ([]byte, error) {
+    var buf bytes.Buffer
+    encoder := json.NewEncoder(&buf)
+    for _, record := range records {
+        if err := encoder.Encode(record); err != nil {
+            return nil, err
+        }
+    }
+    return buf.Bytes(), nil
+}
+
+// write appends stored to the file in one write and syncs it. A failed
+// write is cut off again so the file still ends in a complete line.
+func (s *FileEventStore) write(stored []eventfeed.Event) error {
+    lines, err := encodeRecords(stored)
+    if err != nil {
+        return err
+    }
+    
+    offset, err := s.file.Seek(0, io.SeekCurrent)
+    if err != nil {
+        return err
+    }
+    if _, err := s.file.Write(lines); err != nil {
+        s.rewind(offset)
+        return err
+    }
+    if err := s.file.Sync(); err != nil {
+        s.rewind(offset)
+        return err
+    }
+    return nil
+}
+
+// cut removes retracted, the file's last lines, from it and syncs it.
+// They encode as they did when written, so their length is known.
+func (s *FileEventStore) cut(retracted []eventfeed.Event) error {
+    lines, err := encodeRecords(retracted)
+    if err != nil {
+        return err
+    }
+    
+    end, err := s.file.Seek(0, io.SeekCurrent)
+    if err != nil {
+        return err
+    }
+    offset := end - int64(len(lines))
+    if err := s.file.Truncate(offset); err != nil {
+        return err
+    }
+    if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+        return err
+    }
+    return s.file.Sync()
+}
+
+func (s *FileEventStore) rewind(offset int64) {
+    if err := s.file.Truncate(offset); err != nil {
+        log.Printf("Failed to cut off a failed write to event store %s: %v", s.file.Name(), err)
+        return
+    }
+    s.file.Seek(offset, io.SeekStart)
+}
+
+// Close closes the file. Saves after Close fail.
+func (s *FileEventStore) Close() error {
+    err := os.ErrClosed
+    s.closeOnce.Do(func() {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        err = s.file.Close()
+    })
+    return err
+}
@@ -0,0 +1,211 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventfeed"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+)
+
+// memoryEventStore keeps the event log in memory, as the feed carries it:
+// each event's payload as stored, with its position. Events are decoded
+// with the registry when read, as from the events table, so callers never
+// share values with the store.
+type memoryEventStore struct {
+    eventWriter
+    registry *events.Registry
+    
+    mu  sync.RWMutex
+    log []eventfeed.Event
+    // aggregates indexes log by aggregate, in version order
+    aggregates map[string][]int
+    // persist, when set, durably writes events before they are added to
+    // log; a failure leaves the store unchanged
+    persist func(stored []eventfeed.Event) error
+    // unpersist, when set, durably removes the last events persist wrote
+    // before they are removed from log
+    unpersist func(retracted []eventfeed.Event) error
+}
+
+// NewMemoryEventStore returns an EventStore holding its events in memory,
+// for demos and tests that have no Postgres. It behaves as the events
+// table does: versions are checked on save, and positions start at 1 and
+// follow the order events were saved in. Its events are lost when the
+// process exits.
+func NewMemoryEventStore(registry *events.Registry, opts ...EventStoreOption) RetractingEventStore {
+    return newMemoryEventStore(registry, opts)
+}
+
+func newMemoryEventStore(registry *events.Registry, opts []EventStoreOption) *memoryEventStore {
+    return &memoryEventStore{
+        eventWriter: newEventWriter(opts),
+        registry:    registry,
+        aggregates:  make(map[string][]int),
+    }
+}
+
+func (s *memoryEventStore) SaveEvents(ctx context.Context, aggregateID string, domainEvents []events.DomainEvent, expectedVersion int) ([]events.DomainEvent, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    if version := len(s.aggregates[aggregateID]); version != expectedVersion {
+        return nil, fmt.Errorf("%w: aggregate %s is at version %d, expected %d", ErrVersionConflict, aggregateID, version, expectedVersion)
+    }
+    return s.append(aggregateID, domainEvents, expectedVersion)
+}
+
+func (s *memoryEventStore) AppendEvents(ctx context.Context, aggregateID string, domainEvents []events.DomainEvent) ([]events.DomainEvent, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    return s.append(aggregateID, domainEvents, len(s.aggregates[aggregateID]))
+}
+
+// append stores domainEvents after version, all or none of them. The
+// caller holds the write lock.
+func (s *memoryEventStore) append(aggregateID string, domainEvents []events.DomainEvent, version int) ([]events.DomainEvent, error) {
+    stored := make([]events.DomainEvent, 0, len(domainEvents))
+    records := make([]eventfeed.Event, 0, len(domainEvents))
+    // Timestamps are kept to the microsecond, as Postgres keeps them
+    storedAt := clock.Now().UTC().Truncate(time.Microsecond)
+    for i, event := range domainEvents {
+        event = events.WithSequence(event, version+i+1)
+        
+        eventData, err := json.Marshal(event)
+        if err != nil {
+            return nil, fmt.Errorf("failed to marshal event: %w", err)
+        }
+        if err := events.CheckSize(event, eventData, s.maxBytes, "EVENT_STORE_MAX_EVENT_BYTES"); err != nil {
+            eventStoreStats.Add(event.Type()+".rejected", 1)
+            return nil, err
+        }
+        
+        records = append(records, eventfeed.Event{
+            Position:    int64(len(s.log) + i + 1),
+            AggregateID: aggregateID,
+            EventType:   event.Type(),
+            Version:     version + i + 1,
+            OccurredAt:  apijson.NewTimestamp(event.OccurredAt().UTC().Truncate(time.Microsecond)),
+            StoredAt:    apijson.NewTimestamp(storedAt),
+            Payload:     eventData,
+        })
+        stored = append(stored, event)
+    }
+    
+    if s.persist != nil && len(records) > 0 {
+        if err := s.persist(records); err != nil {
+            return nil, fmt.Errorf("failed to save event: %w", err)
+        }
+    }
+    s.add(records...)
+    return stored, nil
+}
+
+// add appends records, which continue the log, to it and its index.
+func (s *memoryEventStore) add(records ...eventfeed.Event) {
+    for _, record := range records {
+        s.aggregates[record.AggregateID] = append(s.aggregates[record.AggregateID], len(s.log))
+        s.log = append(s.log, record)
+    }
+}
+
+// RetractEvents removes the events of aggregateID after version after,
+// which must be the last events in the log: the positions of any saved
+// since would change under the readers of the feed.
+func (s *memoryEventStore) RetractEvents(ctx context.Context, aggregateID string, after int) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    indexes := s.aggregates[aggregateID]
+    if after < 0 || after > len(indexes) {
+        return fmt.Errorf("aggregate %s is at version %d, which has no events after version %d", aggregateID, len(indexes), after)
+    }
+    count := len(indexes) - after
+    if count == 0 {
+        return nil
+    }
+    // The aggregate's indexes increase, so its last count events are the
+    // log's last count exactly when the first of them is
+    if indexes[after] != len(s.log)-count {
+        return fmt.Errorf("%w: events were saved after those of aggregate %s", ErrEventsNotLast, aggregateID)
+    }
+    
+    retracted := s.log[len(s.log)-count:]
+    if s.unpersist != nil {
+        if err := s.unpersist(retracted); err != nil {
+            return fmt.Errorf("failed to retract events: %w", err)
+        }
+    }
+    s.log = s.log[:len(s.log)-count]
+    s.aggregates[aggregateID] = indexes[:after]
+    return nil
+}
+
+func (s *memoryEventStore) Version(ctx context.Context, aggregateID string) (int, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    return len(s.aggregates[aggregateID]), nil
+}
+
+func (s *memoryEventStore) GetEvents(ctx context.Context, aggregateID string) ([]events.DomainEvent, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    var domainEvents []events.DomainEvent
+    for _, i := range s.aggregates[aggregateID] {
+        event, err := s.log[i].Decode(s.registry)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse event: %w", err)
+        }
+        domainEvents = append(domainEvents, event)
+    }
+    
+    return domainEvents, nil
+}
+
+func (s *memoryEventStore) GetRawEvents(ctx context.Context, aggregateID string, page pagination.Pagination) ([]RawEvent, int, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    indexes := s.aggregates[aggregateID]
+    total := len(indexes)
+    if total == 0 {
+        return nil, 0, nil
+    }
+    
+    rawEvents := []RawEvent{}
+    for n := page.Offset; n < total && len(rawEvents) < page.Limit; n++ {
+        record := s.log[indexes[n]]
+        rawEvents = append(rawEvents, RawEvent{
+            AggregateID: record.AggregateID,
+            EventType:   record.EventType,
+            Version:     record.Version,
+            OccurredAt:  record.OccurredAt,
+            StoredAt:    record.StoredAt,
+            Payload:     record.Payload,
+        })
+    }
+    
+    return rawEvents, total, nil
+}
+
+func (s *memoryEventStore) GetEventsSince(ctx context.Context, after int64, limit int) ([]eventfeed.Event, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    // Positions are 1 and up without gaps, so position p is at log[p-1]
+    feed := []eventfeed.Event{}
+    for i := max(after, 0); i < int64(len(s.log)) && len(feed) < limit; i++ {
+        feed = append(feed, s.log[i])
+    }
+    
+    return feed, nil
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// ErrOrderNumberTaken is returned by UnitOfWork.Commit when another order
+// already has the new order's number. Drawing a new number and committing
+// again resolves it.
+var ErrOrderNumberTaken = errors.New("order number is already taken")
+
+// orderNumberIndex is the unique index on orders.order_number, which the
+// database names in the error for a duplicate number.
+const orderNumberIndex = "idx_orders_order_number"
+
+// isOrderNumberTaken reports whether err is the database refusing a
+// duplicate order number. Drivers differ in their error types but all name
+// the violated index.
+func isOrderNumberTaken(err error) bool {
+    return err != nil && strings.Contains(err.Error(), orderNumberIndex)
+}
+
+// OrderNumberGenerator gives new orders their human-readable numbers. It
+// must be safe for concurrent use, and the numbers it gives should be
+// unique across every instance of the service; a duplicate is refused by
+// the orders table and the order retried with another number.
+type OrderNumberGenerator interface {
+    NextOrderNumber(ctx context.Context, createdAt time.Time) (string, error)
+}
+
+// OrderNumberFormat picks the OrderNumberGenerator NewOrderNumberGenerator
+// returns.
+type OrderNumberFormat string
+
+const (
+    // OrderNumberSequential numbers orders from a sequence per year, such
+    // as ORD-2024-000123
+    OrderNumberSequential OrderNumberFormat = "sequential"
+    // OrderNumberShortCode gives orders a random code, such as
+    // ORD-7KQ2M9XD, that does not reveal how many orders were placed
+    OrderNumberShortCode  OrderNumberFormat = "short-code"
+)
+
+// ParseOrderNumberFormat parses the ORDER_NUMBER_FORMAT setting.
+func ParseOrderNumberFormat(value string) (OrderNumberFormat, error) {
+    switch format := OrderNumberFormat(value); format {
+    case OrderNumberSequential, OrderNumberShortCode:
+        return format, nil
+    default:
+        return "", fmt.Errorf("invalid order number format %q: must be sequential or short-code", value)
+    }
+}
+
+// NewOrderNumberGenerator returns the generator for format, drawing
+// sequential numbers from db.
+func NewOrderNumberGenerator(db *sqlmetrics.DB, format OrderNumberFormat) OrderNumberGenerator {
+    if format == OrderNumberShortCode {
+        return NewShortCodeOrderNumberGenerator()
+    }
+    return NewSequenceOrderNumberGenerator(db)
+}
+
+const (
+    queryCreateOrderNumberSequence = "order_numbers.create_sequence"
+    queryNextOrderNumber           = "order_numbers.next"
+)
+
+type sequenceOrderNumberGenerator struct {
+    db *sqlmetrics.DB
+    
+    mu sync.Mutex
+    // created holds the years whose sequence this instance has created
+    created map[int]bool
+}
+
+// NewSequenceOrderNumberGenerator numbers orders from a Postgres sequence
+// per year of their creation, order_number_seq_2024 giving ORD-2024-000001,
+// ORD-2024-000002 and so on. Postgres hands each value out once, so every
+// instance drawing from the same database gets distinct numbers. The
+// sequences are created on first use and need the CREATE privilege on the
+// schema; numbers past 999999 take more digits.
+func NewSequenceOrderNumberGenerator(db *sqlmetrics.DB) OrderNumberGenerator {
+    return &sequenceOrderNumberGenerator{db: db, created: make(map[int]bool)}
+}
+
+func (g *sequenceOrderNumberGenerator) NextOrderNumber(ctx context.Context, createdAt time.Time) (string, error) {
+    year := createdAt.UTC().Year()
+    sequence := fmt.Sprintf("order_number_seq_%d", year)
+    
+    // Instances creating the same sequence at once may see the creation
+    // fail although the sequence then exists, so only a failure to draw
+    // from it counts
+    createErr := g.createSequence(ctx, year, sequence)
+    
+    var value int64
+    err := g.db.QueryRow(ctx, queryNextOrderNumber, `SELECT nextval($1::regclass)`, sequence).Scan(&value)
+    if err != nil {
+        if createErr != nil {
+            return "", fmt.Errorf("failed to create order number sequence: %w", createErr)
+        }
+        return "", fmt.Errorf("failed to draw order number: %w", err)
+    }
+    
+    return fmt.Sprintf("ORD-%d-%06d", year, value), nil
+}
+
+func (g *sequenceOrderNumberGenerator) createSequence(ctx context.Context, year int, sequence string) error {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    if g.created[year] {
+        return nil
+    }
+    
+    // The name is built from the year alone, so it is safe to splice in
+    if _, err := g.db.Exec(ctx, queryCreateOrderNumberSequence, `CREATE SEQUENCE IF NOT EXISTS `+sequence); err != nil {
+        return err
+    }
+    g.created[year] = true
+    return nil
+}
+
+// shortCodeAlphabet leaves out 0, 1, I, L, O and U, which are easily
+// misheard or misread.
+const shortCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const shortCodeLength = 8
+
+type shortCodeOrderNumberGenerator struct{}
+
+// NewShortCodeOrderNumberGenerator gives orders random codes of eight
+// letters and digits, such as ORD-7KQ2M9XD. It needs no storage; with
+// about 6.5e11 codes a duplicate is rare, and is retried when the orders
+// table refuses it.
+func NewShortCodeOrderNumberGenerator() OrderNumberGenerator {
+    return shortCodeOrderNumberGenerator{}
+}
+
+func (shortCodeOrderNumberGenerator) NextOrderNumber(ctx context.Context, createdAt time.Time) (string, error) {
+    code := make([]byte, shortCodeLength)
+    size := big.NewInt(int64(len(shortCodeAlphabet)))
+    for i := range code {
+        n, err := rand.Int(rand.Reader, size)
+        if err != nil {
+            return "", fmt.Errorf("failed to generate order number: %w", err)
+        }
+        code[i] = shortCodeAlphabet[n.Int64()]
+    }
+    return "ORD-" + string(code), nil
+}
@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+func TestParseOrderNumberFormat(t *testing.T) {
+    tests := []struct {
+        value   string
+        want    OrderNumberFormat
+        wantErr bool
+    }{
+        {value: "sequential", want: OrderNumberSequential},
+        {value: "short-code", want: OrderNumberShortCode},
+        {value: "", wantErr: true},
+        {value: "Sequential", wantErr: true},
+        {value: "uuid", wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.value, func(t *testing.T) {
+            got, err := ParseOrderNumberFormat(tt.value)
+            if (err != nil) != tt.wantErr || got != tt.want {
+                t.Errorf("ParseOrderNumberFormat(%q) = %q, %v, want %q, error %t", tt.value, got, err, tt.want, tt.wantErr)
+            }
+        })
+    }
+}
+
+// drawOrderNumbers draws count numbers from generator across goroutines,
+// returning how often each was given.
+func drawOrderNumbers(t *testing.T, generator OrderNumberGenerator, createdAt time.Time, count int) map[string]int {
+    t.Helper()
+    const workers = 8
+    numbers := make(chan string, count)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            for i := w; i < count; i += workers {
+                number, err := generator.NextOrderNumber(context.Background(), createdAt)
+                if err != nil {
+                    t.Errorf("NextOrderNumber() = %v", err)
+                    return
+                }
+                numbers <- number
+            }
+        }(w)
+    }
+    wg.Wait()
+    close(numbers)
+    
+    seen := make(map[string]int)
+    for number := range numbers {
+        seen[number]++
+    }
+    return seen
+}
+
+// Short codes avoid easily confused characters, and concurrent draws give
+// distinct codes.
+func TestShortCodeOrderNumberGenerator(t *testing.T) {
+    format := regexp.MustCompile(`^ORD-[2-9A-HJKMNP-TV-Z]{8}$`)
+    seen := drawOrderNumbers(t, NewShortCodeOrderNumberGenerator(), time.Now(), 2000)
+    if len(seen) != 2000 {
+        t.Errorf("drew %d distinct codes of 2000", len(seen))
+    }
+    for number := range seen {
+        if !format.MatchString(number) {
+            t.Errorf("code %q does not match %s", number, format)
+        }
+    }
+}
+
+// Instances drawing from one database at once get each number once, from a
+// sequence of the order's year.
+func TestSequenceOrderNumberGenerator(t *testing.T) {
+    db := sqlmetrics.Wrap(schematest.Open(t), 0)
+    createdAt := time.Date(2024, 12, 31, 23, 30, 0, 0, time.UTC)
+    
+    // Two instances share the database and its sequences
+    first, second := NewSequenceOrderNumberGenerator(db), NewSequenceOrderNumberGenerator(db)
+    seen := drawOrderNumbers(t, first, createdAt, 100)
+    for number, n := range drawOrderNumbers(t, second, createdAt, 100) {
+        seen[number] += n
+    }
+    for i := 1; i <= 200; i++ {
+        number := fmt.Sprintf("ORD-2024-%06d", i)
+        if seen[number] != 1 {
+            t.Errorf("%s drawn %d times, want once", number, seen[number])
+        }
+    }
+    if len(seen) != 200 {
+        t.Errorf("drew %d distinct numbers, want 200", len(seen))
+    }
+    
+    // The year is the UTC year, each starting from one: New Year's Eve in
+    // New York is already 2025 in UTC
+    newYear := time.Date(2024, 12, 31, 20, 0, 0, 0, time.FixedZone("EST", -5*3600))
+    if number, err := first.NextOrderNumber(context.Background(), newYear); err != nil || number != "ORD-2025-000001" {
+        t.Errorf("NextOrderNumber() in 2025 = %q, %v, want ORD-2025-000001", number, err)
+    }
+}
+
+// Committing a new order with another order's number is refused with
+// ErrOrderNumberTaken, and nothing of it is saved.
+func TestUnitOfWork_Commit_orderNumberTaken(t *testing.T) {
+    ctx := context.Background()
+    f := newUnitOfWorkFixture(t, false)
+    taken := newUnitOfWorkOrder(t)
+    taken.Number = "ORD-2024-000001"
+    if _, err := f.work.Commit(ctx, taken, []events.DomainEvent{events.NewOrderCreatedEvent(taken)}); err != nil {
+        t.Fatalf("Commit() = %v", err)
+    }
+    
+    order := newUnitOfWorkOrder(t)
+    order.Number = taken.Number
+    _, err := f.work.Commit(ctx, order, []events.DomainEvent{events.NewOrderCreatedEvent(order)})
+    if !errors.Is(err, ErrOrderNumberTaken) {
+        t.Fatalf("Commit() with a taken number = %v, want ErrOrderNumberTaken", err)
+    }
+    if version, _ := f.store.Version(ctx, string(order.ID)); version != 0 {
+        t.Errorf("event store at version %d after the refusal, want 0", version)
+    }
+    
+    order.Number = "ORD-2024-000002"
+    if _, err := f.work.Commit(ctx, order, []events.DomainEvent{events.NewOrderCreatedEvent(order)}); err != nil {
+        t.Errorf("Commit() with a new number = %v", err)
+    }
+}
@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
 )
 
 type OrderRepository interface {
@@ -14,26 +17,68 @@ type OrderRepository interface {
     FindByID(ctx context.Context, id entities.OrderID) (*entities.Order, error)
     Update(ctx context.Context, order *entities.Order) error
     Delete(ctx context.Context, id entities.OrderID) error
+    // CountCreatedSince returns how many orders customerID has created at
+    // or after since.
+    CountCreatedSince(ctx context.Context, customerID string, since time.Time) (int, error)
+    // CountGuestOrdersSince returns how many guest checkouts with
+    // contactEmail were created at or after since.
+    CountGuestOrdersSince(ctx context.Context, contactEmail valueobjects.Email, since time.Time) (int, error)
+    // CountOrdersByStatus and ListOrderIDs serve the reconciliation with
+    // the read side; see package reconcile.
+    CountOrdersByStatus(ctx context.Context) (map[string]int64, error)
+    ListOrderIDs(ctx context.Context, after string, limit int) ([]string, error)
+    // ListCustomerOrderIDs returns the ids of every order of customerID,
+    // oldest first.
+    ListCustomerOrderIDs(ctx context.Context, customerID string) ([]string, error)
 }
 
+// Statement names recorded by sqlmetrics
+const (
+    queryUpsertOrder      = "orders.upsert"
+    queryFindOrder        = "orders.find"
+    queryOrderStatus      = "orders.status"
+    queryDeleteOrder      = "orders.delete"
+    queryDeleteOrderItems = "order_items.delete"
+    queryInsertOrderItem  = "order_items.insert"
+    queryFindOrderItems   = "order_items.find"
+    queryCountRecent      = "orders.count_recent"
+    queryCountRecentGuest = "orders.count_recent_guest"
+    queryCountByStatus    = "orders.count_by_status"
+    queryListOrderIDs     = "orders.list_ids"
+    queryListCustomerIDs  = "orders.list_customer_ids"
+)
+
 type orderRepository struct {
-    db *sql.DB
+    db *sqlmetrics.DB
 }
 
-func NewOrderRepository(db *sql.DB) OrderRepository {
+func NewOrderRepository(db *sqlmetrics.DB) OrderRepository {
     return &orderRepository{db: db}
 }
 
 func (r *orderRepository) Save(ctx context.Context, order *entities.Order) error {
+    return saveOrder(ctx, r.db, order)
+}
+
+// saveOrder upserts order and its items on db, which may be a transaction's.
+func saveOrder(ctx context.Context, db *sqlmetrics.DB, order *entities.Order) error {
     query := `
-        INSERT INTO orders (id, customer_id, status, total_amount, shipping_address, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        INSERT INTO orders (id, customer_id, status, previous_status, total_amount, shipping_cost, grand_total, shipping_address, created_at, updated_at, confirmed_at, channel, order_number, contact_email, shipped_at, delivered_at, signed_by, hold_reason)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, ''), NULLIF($14, ''), $15, $16, NULLIF($17, ''), NULLIF($18, ''))
         ON CONFLICT (id) DO UPDATE SET
             customer_id = $2,
             status = $3,
-            total_amount = $4,
-            shipping_address = $5,
-            updated_at = $7
+            previous_status = $4,
+            total_amount = $5,
+            shipping_cost = $6,
+            grand_total = $7,
+            shipping_address = $8,
+            updated_at = $10,
+            confirmed_at = $11,
+            shipped_at = $15,
+            delivered_at = $16,
+            signed_by = NULLIF($17, ''),
+            hold_reason = NULLIF($18, '')
     `
     
     shippingAddressJSON, err := json.Marshal(order.ShippingAddress)
@@ -41,42 +86,87 @@ func (r *orderRepository) Save(ctx context.Context, order *entities.Order) error
         return fmt.Errorf("failed to marshal shipping address: %w", err)
     }
     
-    _, err = r.db.ExecContext(ctx, query,
+    confirmedAt := nullTime(order.ConfirmedAt)
+    
+    _, err = db.Exec(ctx, queryUpsertOrder, query,
         order.ID,
         order.CustomerID,
         order.Status.String(),
+        order.PreviousStatus.String(),
         order.TotalAmount.Amount,
+        order.ShippingCost.Amount,
+        order.GrandTotal.Amount,
         shippingAddressJSON,
         order.CreatedAt,
         order.UpdatedAt,
+        confirmedAt,
+        order.Channel.String(),
+        order.Number,
+        order.ContactEmail.String(),
+        nullTime(order.ShippedAt),
+        nullTime(order.DeliveredAt),
+        order.SignedBy,
+        order.HoldReason,
     )
     
+    if isOrderNumberTaken(err) {
+        return fmt.Errorf("%w: %s", ErrOrderNumberTaken, order.Number)
+    }
     if err != nil {
         return fmt.Errorf("failed to save order: %w", err)
     }
     
     // Save order items
-    return r.saveOrderItems(ctx, order)
+    return saveOrderItems(ctx, db, order)
+}
+
+// nullTime stores a zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+    return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// savedStatus returns the status saved for the order on db, which may be a
+// transaction's, or an empty status for an order not saved yet.
+func savedStatus(ctx context.Context, db *sqlmetrics.DB, id entities.OrderID) (valueobjects.OrderStatus, error) {
+    var status valueobjects.OrderStatus
+    query := `SELECT status FROM orders WHERE id = $1`
+    err := db.QueryRow(ctx, queryOrderStatus, query, id).Scan(&status)
+    if err != nil && err != sql.ErrNoRows {
+        return "", fmt.Errorf("failed to read order status: %w", err)
+    }
+    return status, nil
 }
 
 func (r *orderRepository) FindByID(ctx context.Context, id entities.OrderID) (*entities.Order, error) {
     query := `
-        SELECT id, customer_id, status, total_amount, shipping_address, created_at, updated_at
+        SELECT id, customer_id, status, previous_status, total_amount, shipping_cost, grand_total, shipping_address, created_at, updated_at, confirmed_at, channel, COALESCE(order_number, ''), COALESCE(contact_email, ''), shipped_at, delivered_at, COALESCE(signed_by, ''), COALESCE(hold_reason, '')
         FROM orders
         WHERE id = $1
     `
     
     var order entities.Order
     var shippingAddressJSON string
+    var confirmedAt, shippedAt, deliveredAt sql.NullTime
     
-    err := r.db.QueryRowContext(ctx, query, id).Scan(
+    err := r.db.QueryRow(ctx, queryFindOrder, query, id).Scan(
         &order.ID,
         &order.CustomerID,
         &order.Status,
+        &order.PreviousStatus,
         &order.TotalAmount.Amount,
+        &order.ShippingCost.Amount,
+        &order.GrandTotal.Amount,
         &shippingAddressJSON,
         &order.CreatedAt,
         &order.UpdatedAt,
+        &confirmedAt,
+        &order.Channel,
+        &order.Number,
+        &order.ContactEmail,
+        &shippedAt,
+        &deliveredAt,
+        &order.SignedBy,
+        &order.HoldReason,
     )
     
     if err != nil {
@@ -86,14 +176,15 @@ func (r *orderRepository) FindByID(ctx context.Context, id entities.OrderID) (*e
         return nil, fmt.Errorf("failed to find order: %w", err)
     }
     
+    order.ConfirmedAt = confirmedAt.Time
+    order.ShippedAt = shippedAt.Time
+    order.DeliveredAt = deliveredAt.Time
+    
     // Parse shipping address
     if err := json.Unmarshal([]byte(shippingAddressJSON), &order.ShippingAddress); err != nil {
         return nil, fmt.Errorf("failed to unmarshal shipping address: %w", err)
     }
     
-    // Set currency
-    order.TotalAmount.Currency = "USD"
-    
     // Load order items
     items, err := r.findOrderItems(ctx, id)
     if err != nil {
@@ -101,6 +192,12 @@ func (r *orderRepository) FindByID(ctx context.Context, id entities.OrderID) (*e
     }
     order.Items = items
     
+    // The orders table keeps amounts only; they are in the items' currency
+    currency := order.Currency()
+    order.TotalAmount.Currency = currency
+    order.ShippingCost.Currency = currency
+    order.GrandTotal.Currency = currency
+    
     return &order, nil
 }
 
@@ -116,13 +213,13 @@ func (r *orderRepository) Delete(ctx context.Context, id entities.OrderID) error
     defer tx.Rollback()
     
     // Delete order items first
-    _, err = tx.ExecContext(ctx, "DELETE FROM order_items WHERE order_id = $1", id)
+    _, err = tx.Exec(ctx, queryDeleteOrderItems, "DELETE FROM order_items WHERE order_id = $1", id)
     if err != nil {
         return fmt.Errorf("failed to delete order items: %w", err)
     }
     
     // Delete order
-    _, err = tx.ExecContext(ctx, "DELETE FROM orders WHERE id = $1", id)
+    _, err = tx.Exec(ctx, queryDeleteOrder, "DELETE FROM orders WHERE id = $1", id)
     if err != nil {
         return fmt.Errorf("failed to delete order: %w", err)
     }
@@ -130,9 +227,9 @@ func (r *orderRepository) Delete(ctx context.Context, id entities.OrderID) error
     return tx.Commit()
 }
 
-func (r *orderRepository) saveOrderItems(ctx context.Context, order *entities.Order) error {
+func saveOrderItems(ctx context.Context, db *sqlmetrics.DB, order *entities.Order) error {
     // Delete existing items
-    _, err := r.db.ExecContext(ctx, "DELETE FROM order_items WHERE order_id = $1", order.ID)
+    _, err := db.Exec(ctx, queryDeleteOrderItems, "DELETE FROM order_items WHERE order_id = $1", order.ID)
     if err != nil {
         return fmt.Errorf("failed to delete existing order items: %w", err)
     }
@@ -144,7 +241,7 @@ func (r *orderRepository) saveOrderItems(ctx context.Context, order *entities.Or
             VALUES ($1, $2, $3, $4, $5)
         `
         
-        _, err = r.db.ExecContext(ctx, query,
+        _, err = db.Exec(ctx, queryInsertOrderItem, query,
             order.ID,
             item.ProductID,
             item.Quantity,
@@ -168,7 +265,7 @@ func (r *orderRepository) findOrderItems(ctx context.Context, orderID entities.O
         ORDER BY product_id
     `
     
-    rows, err := r.db.QueryContext(ctx, query, orderID)
+    rows, err := r.db.Query(ctx, queryFindOrderItems, query, orderID)
     if err != nil {
         return nil, fmt.Errorf("failed to query order items: %w", err)
     }
@@ -191,3 +288,95 @@ func (r *orderRepository) findOrderItems(ctx context.Context, orderID entities.O
     
     return items, nil
 }
+
+func (r *orderRepository) CountCreatedSince(ctx context.Context, customerID string, since time.Time) (int, error) {
+    query := `SELECT COUNT(*) FROM orders WHERE customer_id = $1 AND created_at >= $2`
+    
+    var count int
+    if err := r.db.QueryRow(ctx, queryCountRecent, query, customerID, since).Scan(&count); err != nil {
+        return 0, fmt.Errorf("failed to count recent orders: %w", err)
+    }
+    return count, nil
+}
+
+func (r *orderRepository) CountGuestOrdersSince(ctx context.Context, contactEmail valueobjects.Email, since time.Time) (int, error) {
+    query := `SELECT COUNT(*) FROM orders WHERE customer_id = '' AND contact_email = $1 AND created_at >= $2`
+    
+    var count int
+    if err := r.db.QueryRow(ctx, queryCountRecentGuest, query, contactEmail.String(), since).Scan(&count); err != nil {
+        return 0, fmt.Errorf("failed to count recent guest orders: %w", err)
+    }
+    return count, nil
+}
+
+func (r *orderRepository) CountOrdersByStatus(ctx context.Context) (map[string]int64, error) {
+    query := `SELECT status, COUNT(*) FROM orders GROUP BY status`
+    
+    rows, err := r.db.Query(ctx, queryCountByStatus, query)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count orders by status: %w", err)
+    }
+    defer rows.Close()
+    
+    counts := map[string]int64{}
+    for rows.Next() {
+        var status string
+        var count int64
+        if err := rows.Scan(&status, &count); err != nil {
+            return nil, fmt.Errorf("failed to scan status count: %w", err)
+        }
+        counts[status] = count
+    }
+    return counts, rows.Err()
+}
+
+// ListOrderIDs compares ids in the C collation, so they come in the byte
+// order the reconciliation merges them in whatever the database's collation.
+func (r *orderRepository) ListOrderIDs(ctx context.Context, after string, limit int) ([]string, error) {
+    query := `
+        SELECT id FROM orders
+        WHERE id COLLATE "C" > $1
+        ORDER BY id COLLATE "C"
+        LIMIT $2
+    `
+    
+    rows, err := r.db.Query(ctx, queryListOrderIDs, query, after, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list order ids: %w", err)
+    }
+    defer rows.Close()
+    
+    var ids []string
+    for rows.Next() {
+        var id string
+        if err := rows.Scan(&id); err != nil {
+            return nil, fmt.Errorf("failed to scan order id: %w", err)
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+func (r *orderRepository) ListCustomerOrderIDs(ctx context.Context, customerID string) ([]string, error) {
+    query := `
+        SELECT id FROM orders
+        WHERE customer_id = $1
+        ORDER BY created_at, id
+    `
+    
+    rows, err := r.db.Query(ctx, queryListCustomerIDs, query, customerID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list customer order ids: %w", err)
+    }
+    defer rows.Close()
+    
+    var ids []string
+    for rows.Next() {
+        var id string
+        if err := rows.Scan(&id); err != nil {
+            return nil, fmt.Errorf("failed to scan order id: %w", err)
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
@@ -0,0 +1,195 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// ErrVersionConflict is returned by UnitOfWork.Commit when events were
+// stored for the order after it was loaded, and by EventStore.SaveEvents
+// when the aggregate is not at the expected version.
+var ErrVersionConflict = errors.New("order was changed concurrently")
+
+// UnitOfWork persists a change to an order: the order itself, the events
+// recording the change and their outbox entries, all or none of them.
+type UnitOfWork interface {
+    // Commit saves order and appends domainEvents to its history after
+    // order.Version, writing each to the outbox, and advances order.Version
+    // past them. Each event changing the order's status is followed in the
+    // outbox, but not in the history, by an OrderStatusChangedEvent. It
+    // returns the events as stored, each with its version as its sequence.
+    Commit(ctx context.Context, order *entities.Order, domainEvents []events.DomainEvent) ([]events.DomainEvent, error)
+}
+
+type unitOfWork struct {
+    writer eventWriter
+    db     *sqlmetrics.DB
+    outbox outbox.Repository
+}
+
+// NewUnitOfWork returns a UnitOfWork writing in one transaction on db, which
+// must hold the orders and events tables as well as outbox's table. Events
+// are stored as the event store configured with opts stores them.
+func NewUnitOfWork(db *sqlmetrics.DB, outbox outbox.Repository, opts ...EventStoreOption) UnitOfWork {
+    return &unitOfWork{writer: newEventWriter(opts), db: db, outbox: outbox}
+}
+
+func (u *unitOfWork) Commit(ctx context.Context, order *entities.Order, domainEvents []events.DomainEvent) ([]events.DomainEvent, error) {
+    tx, err := u.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+    
+    // A writer racing past this check still fails on the unique
+    // (aggregate_id, version) constraint when inserting the events
+    version, err := eventVersion(ctx, tx.DB, string(order.ID))
+    if err != nil {
+        return nil, err
+    }
+    if version != order.Version {
+        return nil, fmt.Errorf("%w: order %s is at version %d, loaded at %d", ErrVersionConflict, order.ID, version, order.Version)
+    }
+    
+    status, err := statusBefore(ctx, tx.DB, order, domainEvents)
+    if err != nil {
+        return nil, err
+    }
+    
+    if err := saveOrder(ctx, tx.DB, order); err != nil {
+        return nil, err
+    }
+    
+    stored, err := u.writer.insertEvents(ctx, tx, string(order.ID), domainEvents, order.Version)
+    if err != nil {
+        return nil, err
+    }
+    
+    if err := saveToOutbox(ctx, u.outbox, tx, stored, status); err != nil {
+        return nil, err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return nil, fmt.Errorf("failed to commit order %s: %w", order.ID, err)
+    }
+    order.Version += len(stored)
+    return stored, nil
+}
+
+// ErrEventsNotLast is returned by RetractEvents for events other events
+// were saved after.
+var ErrEventsNotLast = errors.New("events are not the last in the store")
+
+// RetractingEventStore is an EventStore that can take back the events it
+// saved last, as NewStoreUnitOfWork does when the transaction saving the
+// order with them fails to commit.
+type RetractingEventStore interface {
+    EventStore
+    // RetractEvents removes the events of aggregateID after version after,
+    // provided no other events were saved since; otherwise it fails with
+    // ErrEventsNotLast and keeps them.
+    RetractEvents(ctx context.Context, aggregateID string, after int) error
+}
+
+type storeUnitOfWork struct {
+    store  RetractingEventStore
+    db     *sqlmetrics.DB
+    outbox outbox.Repository
+}
+
+// NewStoreUnitOfWork returns a UnitOfWork keeping orders and the outbox in
+// db but events in store, such as a NewMemoryEventStore. The events are
+// saved last, after the order and its outbox entries, under the store's
+// version check, so a conflict leaves nothing saved. If the transaction
+// then fails to commit, the events are retracted from store again. Only a
+// failed retraction, when events were saved since, or a commit reported as
+// failed after it succeeded, leaves the two out of step.
+func NewStoreUnitOfWork(db *sqlmetrics.DB, outbox outbox.Repository, store RetractingEventStore) UnitOfWork {
+    return &storeUnitOfWork{store: store, db: db, outbox: outbox}
+}
+
+func (u *storeUnitOfWork) Commit(ctx context.Context, order *entities.Order, domainEvents []events.DomainEvent) ([]events.DomainEvent, error) {
+    tx, err := u.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+    
+    status, err := statusBefore(ctx, tx.DB, order, domainEvents)
+    if err != nil {
+        return nil, err
+    }
+    
+    if err := saveOrder(ctx, tx.DB, order); err != nil {
+        return nil, err
+    }
+    
+    // The outbox entries carry the sequences the store is about to give
+    // the events
+    sequenced := make([]events.DomainEvent, len(domainEvents))
+    for i, event := range domainEvents {
+        sequenced[i] = events.WithSequence(event, order.Version+i+1)
+    }
+    if err := saveToOutbox(ctx, u.outbox, tx, sequenced, status); err != nil {
+        return nil, err
+    }
+    
+    stored, err := u.store.SaveEvents(ctx, string(order.ID), domainEvents, order.Version)
+    if err != nil {
+        return nil, err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        if retractErr := u.store.RetractEvents(ctx, string(order.ID), order.Version); retractErr != nil {
+            return nil, fmt.Errorf("failed to commit order %s: %w; its events stay in the event store: %v", order.ID, err, retractErr)
+        }
+        return nil, fmt.Errorf("failed to commit order %s: %w", order.ID, err)
+    }
+    order.Version += len(stored)
+    return stored, nil
+}
+
+// statusBefore returns the status order is saved with on db, which a
+// status change among domainEvents leaves, or an empty status when none
+// changes it.
+func statusBefore(ctx context.Context, db *sqlmetrics.DB, order *entities.Order, domainEvents []events.DomainEvent) (valueobjects.OrderStatus, error) {
+    if !changesStatus(domainEvents) {
+        return "", nil
+    }
+    return savedStatus(ctx, db, order.ID)
+}
+
+// saveToOutbox writes stored to the outbox in tx, each status change
+// followed by its OrderStatusChangedEvent, starting from status.
+func saveToOutbox(ctx context.Context, repo outbox.Repository, tx *sqlmetrics.Tx, stored []events.DomainEvent, status valueobjects.OrderStatus) error {
+    for _, event := range stored {
+        if err := repo.SaveEventWithOptions(ctx, event, outbox.SaveOptions{Tx: tx.Unwrap()}); err != nil {
+            return fmt.Errorf("failed to save event to outbox: %w", err)
+        }
+        if changed, ok := events.NewOrderStatusChangedEvent(event, status); ok {
+            if err := repo.SaveEventWithOptions(ctx, changed, outbox.SaveOptions{Tx: tx.Unwrap()}); err != nil {
+                return fmt.Errorf("failed to save event to outbox: %w", err)
+            }
+            status = valueobjects.OrderStatus(changed.ToStatus)
+        }
+    }
+    return nil
+}
+
+// changesStatus reports whether any of domainEvents changes the order's
+// status.
+func changesStatus(domainEvents []events.DomainEvent) bool {
+    for _, event := range domainEvents {
+        if _, ok := events.StatusAfter(event); ok {
+            return true
+        }
+    }
+    return false
+}
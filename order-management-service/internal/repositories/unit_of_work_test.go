@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// unitOfWorkFixture is a unit of work on a fresh schema, with what it
+// writes to.
+type unitOfWorkFixture struct {
+    work   UnitOfWork
+    orders OrderRepository
+    store  EventStore
+    outbox outbox.Repository
+}
+
+func newUnitOfWorkFixture(t *testing.T, inStore bool, opts ...EventStoreOption) unitOfWorkFixture {
+    t.Helper()
+    raw := schematest.Open(t)
+    if err := outbox.CreateTable(context.Background(), raw, outbox.DefaultTable); err != nil {
+        t.Fatal(err)
+    }
+    db := sqlmetrics.Wrap(raw, 0)
+    repo := outbox.NewRepository(raw, outbox.DefaultTable)
+    
+    fixture := unitOfWorkFixture{orders: NewOrderRepository(db), outbox: repo}
+    if inStore {
+        store := NewMemoryEventStore(events.DefaultRegistry(), opts...)
+        fixture.work, fixture.store = NewStoreUnitOfWork(db, repo, store), store
+    } else {
+        fixture.work, fixture.store = NewUnitOfWork(db, repo, opts...), NewEventStore(db, events.DefaultRegistry(), opts...)
+    }
+    return fixture
+}
+
+// outboxTypes returns the types of the events in the outbox, sorted, as
+// events saved together may share a timestamp.
+func (f unitOfWorkFixture) outboxTypes(t *testing.T) []string {
+    t.Helper()
+    saved, err := f.outbox.ListEvents(context.Background(), time.Time{})
+    if err != nil {
+        t.Fatalf("ListEvents() = %v", err)
+    }
+    var types []string
+    for _, event := range saved {
+        types = append(types, event.EventType)
+    }
+    sort.Strings(types)
+    return types
+}
+
+func newUnitOfWorkOrder(t *testing.T) *entities.Order {
+    t.Helper()
+    order, err := entities.NewOrder(uuid.NewString(), "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    if err := order.AddItem("product-1", 2, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem() = %v", err)
+    }
+    return order
+}
+
+// Both unit of work implementations save the order, its events and their
+// outbox entries together, and a version conflict saves none of them.
+func TestUnitOfWork_Commit(t *testing.T) {
+    ctx := context.Background()
+    variants := []struct {
+        name    string
+        inStore bool
+    }{
+        {name: "events table"},
+        {name: "event store", inStore: true},
+    }
+    
+    for _, variant := range variants {
+        t.Run(variant.name, func(t *testing.T) {
+            t.Run("writes everything", func(t *testing.T) {
+                f := newUnitOfWorkFixture(t, variant.inStore)
+                order := newUnitOfWorkOrder(t)
+                
+                stored, err := f.work.Commit(ctx, order, []events.DomainEvent{events.NewOrderCreatedEvent(order)})
+                if err != nil {
+                    t.Fatalf("Commit(created) = %v", err)
+                }
+                if len(stored) != 1 || stored[0].Sequence() != 1 || order.Version != 1 {
+                    t.Fatalf("Commit(created) stored %d events, order at version %d; want 1 event at sequence 1, version 1", len(stored), order.Version)
+                }
+                
+                if err := order.Confirm(); err != nil {
+                    t.Fatalf("Confirm() = %v", err)
+                }
+                if _, err := f.work.Commit(ctx, order, []events.DomainEvent{events.NewOrderConfirmedEvent(order)}); err != nil {
+                    t.Fatalf("Commit(confirmed) = %v", err)
+                }
+                
+                saved, err := f.orders.FindByID(ctx, order.ID)
+                if err != nil {
+                    t.Fatalf("FindByID() = %v", err)
+                }
+                if saved.Status != valueobjects.OrderStatusConfirmed {
+                    t.Errorf("saved order is %s, want confirmed", saved.Status)
+                }
+                if version, _ := f.store.Version(ctx, string(order.ID)); version != 2 || order.Version != 2 {
+                    t.Errorf("event store at version %d, order at %d; want 2", version, order.Version)
+                }
+                // Only the status change is followed by OrderStatusChanged
+                want := []string{"OrderConfirmed", "OrderCreated", "OrderStatusChanged"}
+                if got := f.outboxTypes(t); !reflect.DeepEqual(got, want) {
+                    t.Errorf("outbox = %v, want %v", got, want)
+                }
+            })
+            
+            t.Run("version conflict", func(t *testing.T) {
+                f := newUnitOfWorkFixture(t, variant.inStore)
+                order := newUnitOfWorkOrder(t)
+                if _, err := f.work.Commit(ctx, order, []events.DomainEvent{events.NewOrderCreatedEvent(order)}); err != nil {
+                    t.Fatalf("Commit(created) = %v", err)
+                }
+                
+                // Loaded before the first commit, at version 0
+                stale := *order
+                stale.Version = 0
+                if err := stale.Confirm(); err != nil {
+                    t.Fatalf("Confirm() = %v", err)
+                }
+                _, err := f.work.Commit(ctx, &stale, []events.DomainEvent{events.NewOrderConfirmedEvent(&stale)})
+                if !errors.Is(err, ErrVersionConflict) {
+                    t.Fatalf("Commit() of a stale order = %v, want ErrVersionConflict", err)
+                }
+                
+                saved, err := f.orders.FindByID(ctx, order.ID)
+                if err != nil {
+                    t.Fatalf("FindByID() = %v", err)
+                }
+                if saved.Status != valueobjects.OrderStatusDraft {
+                    t.Errorf("saved order is %s after the conflict, want draft", saved.Status)
+                }
+                if version, _ := f.store.Version(ctx, string(order.ID)); version != 1 {
+                    t.Errorf("event store at version %d after the conflict, want 1", version)
+                }
+                if got, want := f.outboxTypes(t), []string{"OrderCreated"}; !reflect.DeepEqual(got, want) {
+                    t.Errorf("outbox after the conflict = %v, want %v", got, want)
+                }
+            })
+            
+            t.Run("event too large", func(t *testing.T) {
+                f := newUnitOfWorkFixture(t, variant.inStore, WithMaxEventBytes(200))
+                order := newUnitOfWorkOrder(t)
+                
+                _, err := f.work.Commit(ctx, order, []events.DomainEvent{events.NewOrderCreatedEvent(order)})
+                var tooLarge *events.EventTooLargeError
+                if !errors.As(err, &tooLarge) || tooLarge.EventType != "OrderCreated" || tooLarge.AggregateID != string(order.ID) {
+                    t.Fatalf("Commit() of an oversized event = %v, want an *events.EventTooLargeError for it", err)
+                }
+                
+                if _, err := f.orders.FindByID(ctx, order.ID); err == nil {
+                    t.Error("the order was saved with its oversized event")
+                }
+                if version, _ := f.store.Version(ctx, string(order.ID)); version != 0 {
+                    t.Errorf("event store at version %d, want 0", version)
+                }
+                if got := f.outboxTypes(t); len(got) != 0 {
+                    t.Errorf("outbox = %v, want empty", got)
+                }
+            })
+        })
+    }
+}
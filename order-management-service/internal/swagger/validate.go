@@ -0,0 +1,187 @@
+package swagger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+)
+
+// Spec parses the embedded OpenAPI document and checks that it is valid.
+func Spec() (*openapi3.T, error) {
+	data, err := specFS.ReadFile("openapi.json")
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI spec: %w", err)
+	}
+	if err := spec.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	return spec, nil
+}
+
+// ValidationError is the 400 body written for a request that violates the
+// spec. Path is a JSON pointer into the body, or the parameter name when In
+// is a parameter location.
+type ValidationError struct {
+	Error   string `json:"error"`
+	In      string `json:"in"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Validator returns middleware that validates request parameters and bodies
+// against the embedded spec. Requests for routes the spec does not describe
+// pass through unchecked. Every API version accepts the same requests, so
+// requests under any version prefix are checked against the /api/v1 paths.
+func Validator() (func(http.Handler) http.Handler, error) {
+	spec, err := Spec()
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			documented := r.Clone(r.Context())
+			documented.URL.Path = specPath(r.URL.Path)
+			route, pathParams, err := router.FindRoute(documented)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    documented,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func writeValidationError(w http.ResponseWriter, err error) {
+	body := ValidationError{Error: "invalid_request", In: "body", Path: "/", Message: err.Error()}
+
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) {
+		body.Message = requestErr.Reason
+		if requestErr.Parameter != nil {
+			body.In = requestErr.Parameter.In
+			body.Path = requestErr.Parameter.Name
+		}
+		if body.Message == "" && requestErr.Err != nil {
+			body.Message = requestErr.Err.Error()
+		}
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		body.Message = schemaErr.Reason
+		if body.In == "body" {
+			body.Path = "/" + strings.Join(schemaErr.JSONPointer(), "/")
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(body)
+}
+
+// versionPrefix matches the API version prefix of a path, or the bare /api
+// prefix of unversioned routes.
+var versionPrefix = regexp.MustCompile(`^/api(/v[0-9]+)?/`)
+
+// specPath maps a path under any API version to the /api/v1 path the spec
+// documents it as.
+func specPath(path string) string {
+	return versionPrefix.ReplaceAllString(path, "/api/v1/")
+}
+
+// CheckRoutes compares the /api routes registered on router with the
+// operations in the embedded spec and reports any that only one of them
+// has, so the spec cannot silently drift from the handlers. Routes mounted
+// under each API version are compared as their /api/v1 paths.
+func CheckRoutes(router *mux.Router) error {
+	spec, err := Spec()
+	if err != nil {
+		return err
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths.Map() {
+		if !strings.HasPrefix(path, "/api/") {
+			continue
+		}
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	registered := make(map[string]bool)
+	err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, "/api/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if method == http.MethodHead {
+				continue
+			}
+			registered[method+" "+specPath(path)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var drift []string
+	for operation := range registered {
+		if !documented[operation] {
+			drift = append(drift, operation+" is not in the spec")
+		}
+	}
+	for operation := range documented {
+		if !registered[operation] {
+			drift = append(drift, operation+" has no handler")
+		}
+	}
+	if len(drift) > 0 {
+		sort.Strings(drift)
+		return fmt.Errorf("OpenAPI spec and routes differ: %s", strings.Join(drift, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package swagger_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/internal/swagger"
+	"github.com/vdntruong/dddcqrs/order-management-service/orderapi"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+)
+
+// The routes the service mounts are the operations the spec documents.
+func TestCheckRoutes(t *testing.T) {
+	router := mux.NewRouter()
+	orderapi.MountVersionedRoutes(router, orderapi.Deps{EventBus: eventbus.NewInMemoryEventBus(nil)})
+	if err := swagger.CheckRoutes(router); err != nil {
+		t.Errorf("CheckRoutes() = %v", err)
+	}
+
+	router.HandleFunc("/api/v1/orders/{id}/notes", func(http.ResponseWriter, *http.Request) {}).Methods("POST")
+	err := swagger.CheckRoutes(router)
+	if err == nil || !strings.Contains(err.Error(), "POST /api/v1/orders/{id}/notes") {
+		t.Errorf("CheckRoutes() with an undocumented route = %v, want it reported", err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	validator, err := swagger.Validator()
+	if err != nil {
+		t.Fatalf("Validator() = %v", err)
+	}
+	handler := validator(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	const address = `"shipping_address": {"street": "1 Main St", "city": "Springfield", "state": "IL", "zip": "62701", "country": "US"}`
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantIn     string
+		wantPath   string
+	}{
+		{
+			name:       "valid order",
+			method:     http.MethodPost,
+			target:     "/api/v1/orders",
+			body:       `{"customer_id": "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10", "items": [{"product_id": "product-1", "quantity": 2, "price": {"amount": 1000, "currency": "USD"}}], ` + address + `}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "quantity of the wrong type",
+			method:     http.MethodPost,
+			target:     "/api/v1/orders",
+			body:       `{"customer_id": "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10", "items": [{"product_id": "product-1", "quantity": "two", "price": {"amount": 1000, "currency": "USD"}}], ` + address + `}`,
+			wantStatus: http.StatusBadRequest,
+			wantIn:     "body",
+			wantPath:   "/items/0/quantity",
+		},
+		{
+			name:       "other versions are checked too",
+			method:     http.MethodPost,
+			target:     "/api/v2/orders",
+			body:       `{"customer_id": "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10", "items": [{"product_id": "product-1", "quantity": "two", "price": {"amount": 1000, "currency": "USD"}}], ` + address + `}`,
+			wantStatus: http.StatusBadRequest,
+			wantIn:     "body",
+			wantPath:   "/items/0/quantity",
+		},
+		{
+			name:       "query parameter out of range",
+			method:     http.MethodGet,
+			target:     "/api/v1/events?limit=0",
+			wantStatus: http.StatusBadRequest,
+			wantIn:     "query",
+			wantPath:   "limit",
+		},
+		{
+			name:       "undocumented route passes through",
+			method:     http.MethodPost,
+			target:     "/api/v1/unknown",
+			body:       `not json`,
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.target, w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusBadRequest {
+				return
+			}
+
+			var body swagger.ValidationError
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding the error: %v", err)
+			}
+			if body.Error != "invalid_request" || body.In != tt.wantIn || body.Path != tt.wantPath {
+				t.Errorf("error = %+v, want invalid_request in %s at %s", body, tt.wantIn, tt.wantPath)
+			}
+		})
+	}
+}
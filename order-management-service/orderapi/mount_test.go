@@ -0,0 +1,146 @@
+package orderapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/orderapi"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// mount mounts the order routes under /api/v1 of a fresh router, as a
+// binary embedding the service would.
+func mount(deps orderapi.Deps) *mux.Router {
+    router := mux.NewRouter()
+    orderapi.RegisterRoutes(router.PathPrefix("/api/v1").Subrouter(), deps)
+    return router
+}
+
+func serve(router http.Handler, method, target, body, adminKey string) *httptest.ResponseRecorder {
+    r := httptest.NewRequest(method, target, strings.NewReader(body))
+    r.Header.Set("Content-Type", "application/json")
+    if adminKey != "" {
+        r.Header.Set(httpmw.AdminKeyHeader, adminKey)
+    }
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, r)
+    return w
+}
+
+// The requests below are answered before the database is used, so the
+// routes are mounted without one.
+func TestRegisterRoutes_mountsOnAFreshRouter(t *testing.T) {
+    router := mount(orderapi.Deps{EventBus: eventbus.NewInMemoryEventBus(nil), AdminKey: "secret"})
+    tests := []struct {
+        name       string
+        method     string
+        target     string
+        body       string
+        adminKey   string
+        wantStatus int
+    }{
+        {name: "create with a malformed body", method: http.MethodPost, target: "/api/v1/orders", body: "{", wantStatus: http.StatusBadRequest},
+        {name: "create outside the prefix", method: http.MethodPost, target: "/orders", body: "{}", wantStatus: http.StatusNotFound},
+        {name: "ship a malformed order id", method: http.MethodPost, target: "/api/v1/orders/order-1/ship", wantStatus: http.StatusBadRequest},
+        {name: "method the route does not take", method: http.MethodDelete, target: "/api/v1/orders/order-1", wantStatus: http.StatusMethodNotAllowed},
+        {name: "raw events without the admin key", method: http.MethodGet, target: "/api/v1/orders/order-1/raw-events", wantStatus: http.StatusUnauthorized},
+        {name: "hold with a wrong admin key", method: http.MethodPost, target: "/api/v1/orders/order-1/hold", body: "{}", adminKey: "guess", wantStatus: http.StatusUnauthorized},
+        {name: "merge without the admin key", method: http.MethodPost, target: "/api/v1/customers/customer-1/merge", body: "{}", wantStatus: http.StatusUnauthorized},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if w := serve(router, tt.method, tt.target, tt.body, tt.adminKey); w.Code != tt.wantStatus {
+                t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.target, w.Code, tt.wantStatus, w.Body)
+            }
+        })
+    }
+}
+
+// newOrder creates an order with one item through router, returning its id.
+func newOrder(t *testing.T, router http.Handler) string {
+    t.Helper()
+    const order = `{
+        "customer_id": "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10",
+        "items": [{"product_id": "product-1", "quantity": 2, "price": {"amount": 1000, "currency": "USD"}}],
+        "shipping_address": {"street": "1 Main St", "city": "Springfield", "state": "IL", "zip": "62701", "country": "US"}
+    }`
+    w := serve(router, http.MethodPost, "/api/v1/orders", order, "")
+    if w.Code != http.StatusCreated {
+        t.Fatalf("create = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+    }
+    var created struct {
+        ID string `json:"id"`
+    }
+    if err := json.NewDecoder(w.Body).Decode(&created); err != nil || created.ID == "" {
+        t.Fatalf("create response has no id: %v", err)
+    }
+    return created.ID
+}
+
+// step is a request on the order an orderapi test walks through.
+type step struct {
+    method     string
+    path       string
+    body       string
+    adminKey   string
+    wantStatus int
+}
+
+func runSteps(t *testing.T, router http.Handler, orderID string, steps []step) {
+    t.Helper()
+    for _, step := range steps {
+        target := "/api/v1/orders/" + orderID + step.path
+        if w := serve(router, step.method, target, step.body, step.adminKey); w.Code != step.wantStatus {
+            t.Fatalf("%s %s = %d, want %d: %s", step.method, target, w.Code, step.wantStatus, w.Body)
+        }
+    }
+}
+
+// newMinimalDeps returns the minimal dependency set of the package
+// documentation, on a fresh schema.
+func newMinimalDeps(t *testing.T) orderapi.Deps {
+    t.Helper()
+    deps := orderapi.Deps{DB: schematest.Open(t), EventBus: eventbus.NewInMemoryEventBus(nil), AdminKey: "secret"}
+    if err := orderapi.CreateOutboxTable(context.Background(), deps); err != nil {
+        t.Fatalf("CreateOutboxTable() = %v", err)
+    }
+    return deps
+}
+
+// TestRegisterRoutes_minimalDeps runs an order through the mounted routes
+// with the minimal dependency set of the package documentation.
+func TestRegisterRoutes_minimalDeps(t *testing.T) {
+    router := mount(newMinimalDeps(t))
+    runSteps(t, router, newOrder(t, router), []step{
+        {method: http.MethodPost, path: "/confirm", body: `{"expected_version": 99}`, wantStatus: http.StatusConflict},
+        {method: http.MethodPost, path: "/confirm", body: "{}", wantStatus: http.StatusOK},
+        {method: http.MethodPost, path: "/cancel", body: `{"reason": "customer_request"}`, wantStatus: http.StatusOK},
+        {method: http.MethodGet, path: "/raw-events", adminKey: "secret", wantStatus: http.StatusOK},
+    })
+}
+
+// An order ships once confirmed and released from any hold, and is then
+// delivered.
+func TestRegisterRoutes_shipAndDeliver(t *testing.T) {
+    router := mount(newMinimalDeps(t))
+    runSteps(t, router, newOrder(t, router), []step{
+        {method: http.MethodPost, path: "/ship", wantStatus: http.StatusBadRequest},
+        {method: http.MethodPost, path: "/confirm", body: "{}", wantStatus: http.StatusOK},
+        {method: http.MethodPost, path: "/deliver", wantStatus: http.StatusBadRequest},
+        {method: http.MethodPost, path: "/hold", body: `{"reason": "fraud review"}`, adminKey: "secret", wantStatus: http.StatusOK},
+        {method: http.MethodPost, path: "/ship", wantStatus: http.StatusConflict},
+        {method: http.MethodPost, path: "/release", body: `{"reason": "cleared"}`, adminKey: "secret", wantStatus: http.StatusOK},
+        {method: http.MethodPost, path: "/ship", wantStatus: http.StatusOK},
+        {method: http.MethodPost, path: "/ship", wantStatus: http.StatusBadRequest},
+        {method: http.MethodPost, path: "/deliver", body: `{"signed_by": "J. Doe"}`, wantStatus: http.StatusOK},
+    })
+}
@@ -0,0 +1,637 @@
+// Package orderapi exposes the order management command side for embedding
+// in another binary. The standalone service in cmd is wired through it too.
+//
+// The minimal dependency set is a *sql.DB holding the orders, events and
+// outbox tables, and an eventbus.EventBus. Everything else in Deps has a
+// default. The embedding binary is responsible for running the outbox
+// publisher returned by NewOutboxPublisher, draining it with Drain at
+// shutdown, running the archiver returned by NewOutboxArchiver if it
+// wants processed events archived, and running the publisher returned by
+// NewHeartbeatPublisher if it wants the pipeline's latency measured.
+package orderapi
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/internal/handlers"
+	"github.com/vdntruong/dddcqrs/order-management-service/internal/repositories"
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/featureflags"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/reconcile"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/projections"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+	"github.com/vdntruong/dddcqrs/shared/schema"
+)
+
+// CommandService handles order commands; see NewCommandService.
+type CommandService = handlers.CommandService
+
+type CustomerVerificationMode = handlers.CustomerVerificationMode
+
+const (
+    CustomerVerificationOff     = handlers.CustomerVerificationOff
+    CustomerVerificationWarn    = handlers.CustomerVerificationWarn
+    CustomerVerificationEnforce = handlers.CustomerVerificationEnforce
+)
+
+// ErrUnknownCustomer is returned when customer verification is enforced and
+// an order references an unknown customer.
+var ErrUnknownCustomer = handlers.ErrUnknownCustomer
+
+// ErrUnknownAddress is returned when an order names a saved address the
+// customer does not have.
+var ErrUnknownAddress = handlers.ErrUnknownAddress
+
+// ErrOrderLimitExceeded is wrapped by the errors returned for orders over
+// Deps.OrderLimits.
+var ErrOrderLimitExceeded = handlers.ErrOrderLimitExceeded
+
+// ErrRestrictedCountry is wrapped by the errors returned for orders
+// shipping to a country in Deps.RestrictedCountries.
+var ErrRestrictedCountry = handlers.ErrRestrictedCountry
+
+// ErrEventTooLarge is matched by the errors returned for changes whose
+// events are over Deps.PayloadLimits or Deps.MaxEventBytes.
+var ErrEventTooLarge = handlers.ErrEventTooLarge
+
+// ErrVersionConflict is matched by the errors returned for commands that
+// expected an order at another version than the one it is at.
+var ErrVersionConflict = handlers.ErrVersionConflict
+
+// ErrVersionRequired is returned for commands without an expected version
+// when Deps.StrictConcurrency is set.
+var ErrVersionRequired = handlers.ErrVersionRequired
+
+// ErrOrderRateLimited is wrapped by the errors returned for customers over
+// Deps.OrderRateLimit.
+var ErrOrderRateLimited = handlers.ErrOrderRateLimited
+
+// ErrOrderRejected is wrapped by the errors returned for orders refused by
+// Deps.FraudCheck.
+var ErrOrderRejected = handlers.ErrOrderRejected
+
+// ErrCustomerMerged is matched by the errors returned for orders of a
+// customer merged into another, and for conflicting merges.
+var ErrCustomerMerged = handlers.ErrCustomerMerged
+
+// OrderNumberGenerator gives new orders their human-readable numbers.
+type OrderNumberGenerator = repositories.OrderNumberGenerator
+
+// OrderNumberFormat picks the built-in order number generator.
+type OrderNumberFormat = repositories.OrderNumberFormat
+
+const (
+    OrderNumberSequential = repositories.OrderNumberSequential
+    OrderNumberShortCode  = repositories.OrderNumberShortCode
+)
+
+// ErrOrderNumberTaken is wrapped by the errors returned when new orders
+// kept drawing numbers other orders already have.
+var ErrOrderNumberTaken = repositories.ErrOrderNumberTaken
+
+// VersionConflictError reports the order version a conflicting command
+// found.
+type VersionConflictError = handlers.VersionConflictError
+
+// MergeCustomersCommand and CustomerMergeResult are the input and result
+// of CommandService.MergeCustomers; CustomerMergedError reports a customer
+// merged into another.
+type (
+    MergeCustomersCommand = handlers.MergeCustomersCommand
+    CustomerMergeResult   = handlers.CustomerMergeResult
+    CustomerMergedError   = handlers.CustomerMergedError
+)
+
+// HeartbeatPublisher saves pipeline heartbeats to the outbox; see
+// NewHeartbeatPublisher.
+type HeartbeatPublisher = handlers.HeartbeatPublisher
+
+// RestrictedCountries lists the countries orders may not ship to.
+type RestrictedCountries = handlers.RestrictedCountries
+
+// OrderRateLimit caps the orders each customer may create in a window.
+type OrderRateLimit = handlers.OrderRateLimit
+
+// FraudCheck may refuse orders before they are created.
+type FraudCheck = handlers.FraudCheck
+
+// AllowAllFraudCheck allows every order.
+type AllowAllFraudCheck = handlers.AllowAllFraudCheck
+
+// PriceCatalog tells what products sell for; see Deps.PriceCatalog.
+type PriceCatalog = handlers.PriceCatalog
+
+// ErrPriceMismatch is wrapped by the errors returned for new items priced
+// differently from Deps.PriceCatalog.
+var ErrPriceMismatch = handlers.ErrPriceMismatch
+
+// EventStore stores the events of orders, and takes back those of an
+// order change that failed to commit; see Deps.EventStore.
+type EventStore = repositories.RetractingEventStore
+
+// FileEventStore is an EventStore appending to a file.
+type FileEventStore = repositories.FileEventStore
+
+// NewMemoryEventStore returns an EventStore holding the events of orders in
+// memory, for demos and tests, with the limits in deps.
+func NewMemoryEventStore(deps Deps) EventStore {
+    deps = deps.withDefaults()
+    return repositories.NewMemoryEventStore(deps.Registry, eventStoreLimit(deps))
+}
+
+// OpenFileEventStore opens an EventStore appending the events of orders to
+// the file at path, for small tools, with the limits in deps. The caller
+// closes it.
+func OpenFileEventStore(path string, deps Deps) (*FileEventStore, error) {
+    deps = deps.withDefaults()
+    return repositories.OpenFileEventStore(path, deps.Registry, eventStoreLimit(deps))
+}
+
+// eventStoreLimit returns the event size limit for deps, with defaults.
+func eventStoreLimit(deps Deps) repositories.EventStoreOption {
+    // The store disables its limit at zero, which Deps reserves for the
+    // default
+    return repositories.WithMaxEventBytes(max(deps.MaxEventBytes, 0))
+}
+
+// Deps lists what the command side needs. DB and EventBus are required.
+type Deps struct {
+    DB       *sql.DB
+    EventBus eventbus.EventBus
+    
+    // Registry decodes stored events; defaults to events.DefaultRegistry()
+    Registry *events.Registry
+    // OutboxTable defaults to outbox.DefaultTable
+    OutboxTable string
+    // PayloadLimits defaults to outbox.DefaultPayloadLimits when zero
+    PayloadLimits outbox.PayloadLimits
+    // EventStore holds the events of orders instead of the events table in
+    // DB, such as NewMemoryEventStore or OpenFileEventStore. Orders and the
+    // outbox stay in DB: the events are saved last, and retracted again if
+    // the orders transaction then fails to commit
+    EventStore EventStore
+    // MaxEventBytes caps the JSON of events in the event store; it
+    // defaults to repositories.DefaultMaxEventBytes when zero, and a
+    // negative limit disables the check
+    MaxEventBytes int
+    // TopicResolver picks the topic recorded with each outbox event and
+    // routes events saved without one; nil leaves both to the publisher's
+    // outbox.WithTopicResolver option
+    TopicResolver eventbus.TopicResolver
+    // Archive configures the archiver returned by NewOutboxArchiver;
+    // unset fields take outbox.DefaultArchiveConfig's
+    Archive outbox.ArchiveConfig
+    // Heartbeat configures the publisher returned by
+    // NewHeartbeatPublisher; disabled by default
+    Heartbeat HeartbeatConfig
+    // Shipping defaults to entities.NewDefaultShippingCalculator()
+    Shipping entities.ShippingCalculator
+    // OrderLimits defaults to entities.DefaultOrderLimits when zero
+    OrderLimits entities.OrderLimits
+    // RestrictedCountries are refused as shipping countries; nil allows
+    // every country
+    RestrictedCountries *RestrictedCountries
+    // OrderRateLimit is unlimited when zero
+    OrderRateLimit OrderRateLimit
+    // FraudCheck defaults to AllowAllFraudCheck
+    FraudCheck FraudCheck
+    // PriceCatalog checks the price of new items while PriceVerification
+    // is set; nil checks none
+    PriceCatalog      PriceCatalog
+    PriceVerification bool
+    // OrderNumberFormat defaults to OrderNumberSequential, numbering
+    // orders from a sequence per year in DB
+    OrderNumberFormat OrderNumberFormat
+    // OrderNumbers replaces the generator OrderNumberFormat picks
+    OrderNumbers OrderNumberGenerator
+    // StrictConcurrency requires commands on existing orders to name the
+    // order version they expect, in If-Match; without it a command that
+    // names none applies to the order as it is
+    StrictConcurrency bool
+    // CancellationWindow limits how long after confirmation an order may
+    // be cancelled without the admin override; zero allows any time
+    CancellationWindow time.Duration
+    // CustomerVerification defaults to CustomerVerificationOff
+    CustomerVerification CustomerVerificationMode
+    // CustomerCacheTTL defaults to one minute
+    CustomerCacheTTL time.Duration
+    // AdminKey guards the admin-scoped routes; empty disables them
+    AdminKey string
+    // SlowQueryThreshold defaults to sqlmetrics.DefaultSlowThreshold when
+    // zero; a negative threshold disables the slow query log
+    SlowQueryThreshold time.Duration
+    // V1Sunset is sent as the Sunset date of the deprecated /api/v1 routes
+    // mounted by MountVersionedRoutes; zero omits it
+    V1Sunset time.Time
+    // SyncProjection is disabled when zero
+    SyncProjection SyncProjectionConfig
+    // Flags switch StrictConcurrency, PriceVerification and a configured
+    // SyncProjection while the service runs, from the admin /flags
+    // endpoint; the service makes those settings the flags' defaults. Nil
+    // keeps the settings fixed
+    Flags *featureflags.Flags
+    // Clock stamps orders' commands and outbox rows and times the workers;
+    // defaults to clock.Default. Entities and events read the package
+    // clock, which clock.Set replaces.
+    Clock clock.Clock
+}
+
+// SyncProjectionConfig configures the synchronous projection, for small
+// deployments whose reporting service reads the same database. Each command
+// then applies its events to the order read model and history before it
+// responds, so the reporting API reflects the command at once. The events
+// are still published through the outbox for the reporting service's other
+// projections; its order projection skips the ones already applied.
+type SyncProjectionConfig struct {
+    Enabled bool
+    // Redis is the reporting service's read model cache, whose entries the
+    // projection invalidates; nil when the cache is disabled
+    Redis *redis.Client
+    // Cache must match the reporting service's cache configuration, so the
+    // projection invalidates the keys it reads
+    Cache readmodels.CacheConfig
+    // Archive must be set when the reporting service archives orders, so
+    // the projection restores an archived order before writing it
+    Archive bool
+}
+
+// MaxEventBytesFromEnv reads EVENT_STORE_MAX_EVENT_BYTES for
+// Deps.MaxEventBytes, returning zero when it is unset or invalid. Setting
+// it to zero disables the limit, which is returned as -1.
+func MaxEventBytesFromEnv() int {
+    value, err := strconv.Atoi(os.Getenv("EVENT_STORE_MAX_EVENT_BYTES"))
+    switch {
+    case err != nil || value < 0:
+        return 0
+    case value == 0:
+        return -1
+    default:
+        return value
+    }
+}
+
+// SyncProjectionConfigFromEnv enables the synchronous projection when
+// SYNC_PROJECTION is true, reading the cache and archive configuration as the
+// reporting service does. The caller connects Redis.
+func SyncProjectionConfigFromEnv() SyncProjectionConfig {
+    var cfg SyncProjectionConfig
+    cfg.Enabled, _ = strconv.ParseBool(os.Getenv("SYNC_PROJECTION"))
+    cfg.Cache = readmodels.CacheConfigFromEnv()
+    cfg.Archive = !readmodels.OrderArchiveConfigFromEnv().Disabled
+    return cfg
+}
+
+// newSyncProjection wires the order projection against the read model
+// tables in db.
+func newSyncProjection(deps Deps, db *sqlmetrics.DB) eventbus.Handler {
+    // A nil *redis.Client must not become a non-nil redis.Cmdable
+    var client redis.Cmdable
+    if deps.SyncProjection.Redis != nil {
+        client = deps.SyncProjection.Redis
+    }
+    
+    projection := &projections.OrderProjectionHandler{
+        OrderReadModel:   readmodels.NewOrderReadModel(db, readmodels.NewCache(client, deps.SyncProjection.Cache), readmodels.WithArchive(deps.SyncProjection.Archive)),
+        HistoryReadModel: readmodels.NewOrderHistoryReadModel(db),
+    }
+    return projection.Handle
+}
+
+func (d Deps) withDefaults() Deps {
+    d.Clock = clock.OrDefault(d.Clock)
+    if d.Registry == nil {
+        d.Registry = events.DefaultRegistry()
+    }
+    if d.OutboxTable == "" {
+        d.OutboxTable = outbox.DefaultTable
+    }
+    if d.PayloadLimits == (outbox.PayloadLimits{}) {
+        d.PayloadLimits = outbox.DefaultPayloadLimits
+    }
+    if d.MaxEventBytes == 0 {
+        d.MaxEventBytes = repositories.DefaultMaxEventBytes
+    }
+    if d.Shipping == nil {
+        d.Shipping = entities.NewDefaultShippingCalculator()
+    }
+    if d.OrderLimits == (entities.OrderLimits{}) {
+        d.OrderLimits = entities.DefaultOrderLimits
+    }
+    if d.FraudCheck == nil {
+        d.FraudCheck = AllowAllFraudCheck{}
+    }
+    if d.OrderNumberFormat == "" {
+        d.OrderNumberFormat = OrderNumberSequential
+    }
+    if d.CustomerVerification == "" {
+        d.CustomerVerification = CustomerVerificationOff
+    }
+    if d.CustomerCacheTTL == 0 {
+        d.CustomerCacheTTL = time.Minute
+    }
+    return d
+}
+
+// NewCommandService wires a command service from deps.
+func NewCommandService(deps Deps) *CommandService {
+    deps = deps.withDefaults()
+    db := sqlmetrics.Wrap(deps.DB, deps.SlowQueryThreshold)
+    
+    outboxRepo := newOutboxRepository(deps)
+    eventLimit := eventStoreLimit(deps)
+    
+    service := &CommandService{
+        OrderRepo:  repositories.NewOrderRepository(db),
+        EventStore: repositories.NewEventStore(db, deps.Registry, eventLimit),
+        Outbox:     outboxRepo,
+        UnitOfWork: repositories.NewUnitOfWork(db, outboxRepo, eventLimit),
+        EventBus:   deps.EventBus,
+        Shipping:   deps.Shipping,
+        
+        Limits:       deps.OrderLimits,
+        RateLimit:    deps.OrderRateLimit,
+        FraudCheck:   deps.FraudCheck,
+        Prices:       deps.PriceCatalog,
+        Cancellation: entities.CancellationPolicy{Window: deps.CancellationWindow, Now: deps.Clock.Now},
+        Clock:        deps.Clock,
+        
+        StrictConcurrency: deps.StrictConcurrency,
+        PriceVerification: deps.PriceVerification,
+        
+        Customers:            repositories.NewCachingCustomerVerifier(repositories.NewCustomerVerifier(db), deps.CustomerCacheTTL),
+        CustomerVerification: deps.CustomerVerification,
+        Addresses:            repositories.NewCustomerAddressBook(db),
+        OrderNumbers:         deps.OrderNumbers,
+        CustomerMerges:       repositories.NewCustomerMerges(db),
+    }
+    if service.RateLimit.Now == nil {
+        service.RateLimit.Now = deps.Clock.Now
+    }
+    if service.OrderNumbers == nil {
+        service.OrderNumbers = repositories.NewOrderNumberGenerator(db, deps.OrderNumberFormat)
+    }
+    if deps.EventStore != nil {
+        service.EventStore = deps.EventStore
+        service.UnitOfWork = repositories.NewStoreUnitOfWork(db, outboxRepo, deps.EventStore)
+    }
+    if deps.RestrictedCountries != nil {
+        service.Restrictions = deps.RestrictedCountries
+    }
+    if deps.SyncProjection.Enabled {
+        service.SyncProjection = newSyncProjection(deps, db)
+    }
+    if deps.Flags != nil {
+        deps.Flags.Configure(featureflags.StrictConcurrency, deps.StrictConcurrency)
+        deps.Flags.Configure(featureflags.SyncProjection, deps.SyncProjection.Enabled)
+        deps.Flags.Configure(featureflags.PriceVerification, deps.PriceVerification)
+        service.Flags = deps.Flags
+    }
+    return service
+}
+
+// RegisterRoutes mounts the order command endpoints on r, and the raw event
+// stream, order holds and customer merges behind the admin key in deps. Requests presenting the admin key may
+// also force cancellations. Mount them on a subrouter to add a prefix, as
+// the standalone service does with /api/v1.
+func RegisterRoutes(r *mux.Router, deps Deps) {
+    registerRoutes(r, deps, NewCommandService(deps))
+}
+
+// MountVersionedRoutes mounts the routes of RegisterRoutes on router under
+// /api/v1 and /api/v2, and under /api for clients picking a version with
+// their Accept header. use is applied to each version's subrouter first.
+// The versions currently share request and response shapes.
+func MountVersionedRoutes(router *mux.Router, deps Deps, use ...mux.MiddlewareFunc) {
+    service := NewCommandService(deps)
+    apiversion.DefaultRegistry(deps.V1Sunset).Mount(router, func(r *mux.Router) {
+        r.Use(use...)
+        registerRoutes(r, deps, service)
+    })
+}
+
+func registerRoutes(r *mux.Router, deps Deps, service *CommandService) {
+    r.Use(httpmw.IdentifyAdmin(deps.AdminKey))
+    RegisterServiceRoutes(r, service)
+    
+    getRawEventsHandler := &handlers.GetRawEventsHandler{Service: service}
+    eventFeedHandler := &handlers.EventFeedHandler{Service: service}
+    // Merges reassign orders, so they share the service's order locks
+    mergeCustomersHandler := &handlers.MergeCustomersHandler{Service: service}
+    holdOrderHandler := &handlers.HoldOrderHandler{Service: service}
+    releaseOrderHandler := &handlers.ReleaseOrderHandler{Service: service}
+    r.Handle("/orders/{id}/raw-events", httpmw.RequireAdminKey(deps.AdminKey)(http.HandlerFunc(getRawEventsHandler.HandleHTTP))).Methods("GET", "HEAD")
+    r.Handle("/events", httpmw.RequireAdminKey(deps.AdminKey)(http.HandlerFunc(eventFeedHandler.HandleHTTP))).Methods("GET", "HEAD")
+    r.Handle("/customers/{id}/merge", httpmw.RequireAdminKey(deps.AdminKey)(http.HandlerFunc(mergeCustomersHandler.HandleHTTP))).Methods("POST")
+    r.Handle("/orders/{id}/hold", httpmw.RequireAdminKey(deps.AdminKey)(http.HandlerFunc(holdOrderHandler.HandleHTTP))).Methods("POST")
+    r.Handle("/orders/{id}/release", httpmw.RequireAdminKey(deps.AdminKey)(http.HandlerFunc(releaseOrderHandler.HandleHTTP))).Methods("POST")
+}
+
+// RegisterServiceRoutes mounts the order command endpoints backed by an
+// existing service. Forced cancellations are refused unless r identifies
+// administrators with httpmw.IdentifyAdmin.
+func RegisterServiceRoutes(r *mux.Router, service *CommandService) {
+    createOrderHandler := &handlers.CreateOrderHandler{Service: service}
+    updateOrderHandler := &handlers.UpdateOrderHandler{Service: service}
+    patchOrderHandler := &handlers.PatchOrderHandler{Service: service}
+    confirmOrderHandler := &handlers.ConfirmOrderHandler{Service: service}
+    cancelOrderHandler := &handlers.CancelOrderHandler{Service: service}
+    shipOrderHandler := &handlers.ShipOrderHandler{Service: service}
+    deliverOrderHandler := &handlers.DeliverOrderHandler{Service: service}
+    reopenOrderHandler := &handlers.ReopenOrderHandler{Service: service}
+    orderAsOfHandler := &handlers.OrderAsOfHandler{Service: service}
+    
+    r.HandleFunc("/orders", createOrderHandler.HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}", updateOrderHandler.HandleHTTP).Methods("PUT")
+    r.HandleFunc("/orders/{id}", patchOrderHandler.HandleHTTP).Methods("PATCH")
+    r.HandleFunc("/orders/{id}/confirm", confirmOrderHandler.HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}/cancel", cancelOrderHandler.HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}/ship", shipOrderHandler.HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}/deliver", deliverOrderHandler.HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}/reopen", reopenOrderHandler.HandleHTTP).Methods("POST")
+    r.HandleFunc("/orders/{id}/as-of", orderAsOfHandler.HandleHTTP).Methods("GET", "HEAD")
+}
+
+// RegisterAdminRoutes guards r with the admin key in deps and mounts the
+// admin endpoints on it, with /flags when deps has flags. Routes added to r
+// afterwards share the guard.
+func RegisterAdminRoutes(r *mux.Router, deps Deps) {
+    outboxEventHandler := &handlers.OutboxEventHandler{Archiver: NewOutboxArchiver(deps)}
+    restrictedCountriesHandler := &handlers.RestrictedCountriesHandler{Countries: deps.RestrictedCountries}
+    reconcileHandler := &reconcile.Handler{Source: newOrderRepository(deps)}
+    
+    r.Use(httpmw.RequireAdminKey(deps.AdminKey))
+    r.HandleFunc("/outbox/events/{id}", outboxEventHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/restricted-countries", restrictedCountriesHandler.HandleList).Methods("GET", "HEAD")
+    r.HandleFunc("/restricted-countries/reload", restrictedCountriesHandler.HandleReload).Methods("POST")
+    r.HandleFunc("/reconcile/counts", reconcileHandler.HandleCounts).Methods("GET")
+    r.HandleFunc("/reconcile/ids", reconcileHandler.HandleIDs).Methods("GET")
+    if deps.Flags != nil {
+        flagsHandler := &featureflags.Handler{Flags: deps.Flags}
+        r.HandleFunc("/flags", flagsHandler.HandleList).Methods("GET", "HEAD")
+        r.HandleFunc("/flags", flagsHandler.HandleSet).Methods("PUT")
+    }
+}
+
+// CreateOutboxTable creates the outbox table named in deps and its archive
+// if they are missing.
+func CreateOutboxTable(ctx context.Context, deps Deps) error {
+    deps = deps.withDefaults()
+    return outbox.CreateTable(ctx, deps.DB, deps.OutboxTable)
+}
+
+// commandTables are the tables of orders and customer merges, and
+// eventsTable the event store's when the events are kept in DB.
+var commandTables = []string{"orders", "order_items", "customer_merges"}
+
+const eventsTable = "events"
+
+// CheckSchema verifies that DB has the tables deps uses, with the columns
+// the embedded schema gives them, as mode asks; see schema.Check. Run it
+// after CreateOutboxTable. In schema.CheckWarn mode the synchronous
+// projection is turned off in the returned Deps when read model tables are
+// missing, leaving the read models to the reporting service.
+func CheckSchema(ctx context.Context, deps Deps, mode schema.CheckMode) (Deps, error) {
+    if mode == schema.CheckOff {
+        return deps, nil
+    }
+    outboxTable := deps.withDefaults().OutboxTable
+    
+    names := append([]string(nil), commandTables...)
+    if deps.EventStore == nil {
+        names = append(names, eventsTable)
+    }
+    if deps.SyncProjection.Enabled {
+        names = append(names, readmodels.Tables...)
+        if deps.SyncProjection.Archive {
+            names = append(names, readmodels.ArchivedOrdersTable)
+        }
+    }
+    all, err := schema.Expected()
+    if err != nil {
+        return deps, err
+    }
+    expected, err := all.Select(names...)
+    if err != nil {
+        return deps, err
+    }
+    expected.Merge(schema.Parse(outbox.Schema(outboxTable)))
+    
+    mismatch, err := schema.Check(ctx, deps.DB, expected, mode)
+    if err != nil || mismatch == nil {
+        return deps, err
+    }
+    if deps.SyncProjection.Enabled && mismatch.MissingAny(readmodels.Tables...) {
+        log.Println("Synchronous projection disabled, the read model tables are not migrated")
+        deps.SyncProjection.Enabled = false
+    }
+    if deps.SyncProjection.Archive && mismatch.MissingAny(readmodels.ArchivedOrdersTable) {
+        log.Printf("Synchronous projection archive support disabled, table %s is not migrated", readmodels.ArchivedOrdersTable)
+        deps.SyncProjection.Archive = false
+    }
+    return deps, nil
+}
+
+// NewOutboxPublisher returns the publisher that moves events from the outbox
+// to deps.EventBus, each to the destination saved with it or, for rows
+// without one, to the topic deps.TopicResolver picks. Run its ProcessEvents
+// in a goroutine.
+func NewOutboxPublisher(deps Deps, opts ...outbox.Option) *outbox.Publisher {
+    deps = deps.withDefaults()
+    if deps.TopicResolver != nil {
+        // Ahead of opts so an explicit option still wins
+        opts = append([]outbox.Option{outbox.WithTopicResolver(deps.TopicResolver)}, opts...)
+    }
+    opts = append([]outbox.Option{outbox.WithClock(deps.Clock)}, opts...)
+    return outbox.NewPublisher(newOutboxRepository(deps), deps.EventBus, deps.Registry, opts...)
+}
+
+// newOutboxRepository expects deps with defaults applied.
+func newOutboxRepository(deps Deps) outbox.Repository {
+    opts := []outbox.RepositoryOption{outbox.WithPayloadLimits(deps.PayloadLimits), outbox.WithRepositoryClock(deps.Clock)}
+    if deps.TopicResolver != nil {
+        opts = append(opts, outbox.WithDestinations(deps.TopicResolver))
+    }
+    return outbox.NewRepository(deps.DB, deps.OutboxTable, opts...)
+}
+
+// newOrderRepository reads and writes orders on deps.DB.
+func newOrderRepository(deps Deps) repositories.OrderRepository {
+    deps = deps.withDefaults()
+    return repositories.NewOrderRepository(sqlmetrics.Wrap(deps.DB, deps.SlowQueryThreshold))
+}
+
+// HeartbeatConfig configures the pipeline heartbeat publisher.
+type HeartbeatConfig struct {
+    Disabled bool
+    // Interval is how often a heartbeat is sent
+    Interval time.Duration
+    // Source names the process in its heartbeats; defaults to the host
+    // name
+    Source   string
+}
+
+// DefaultHeartbeatConfig is disabled. Enabled, it sends a heartbeat every
+// 30 seconds.
+var DefaultHeartbeatConfig = HeartbeatConfig{Disabled: true, Interval: 30 * time.Second}
+
+// HeartbeatConfigFromEnv reads PIPELINE_HEARTBEAT_ENABLED and
+// PIPELINE_HEARTBEAT_INTERVAL, falling back to DefaultHeartbeatConfig.
+// Enable it once the reporting service knows the PipelineHeartbeat event.
+func HeartbeatConfigFromEnv() HeartbeatConfig {
+    cfg := DefaultHeartbeatConfig
+    if enabled, err := strconv.ParseBool(os.Getenv("PIPELINE_HEARTBEAT_ENABLED")); err == nil {
+        cfg.Disabled = !enabled
+    }
+    if value, err := time.ParseDuration(os.Getenv("PIPELINE_HEARTBEAT_INTERVAL")); err == nil && value > 0 {
+        cfg.Interval = value
+    }
+    return cfg
+}
+
+// NewHeartbeatPublisher returns the publisher saving a
+// PipelineHeartbeatEvent to the outbox named in deps every
+// deps.Heartbeat.Interval, whose unset fields take
+// DefaultHeartbeatConfig's. Run its Run in a goroutine.
+func NewHeartbeatPublisher(deps Deps) *HeartbeatPublisher {
+    deps = deps.withDefaults()
+    cfg := deps.Heartbeat
+    if cfg.Interval <= 0 {
+        cfg.Interval = DefaultHeartbeatConfig.Interval
+    }
+    if cfg.Source == "" {
+        cfg.Source, _ = os.Hostname()
+    }
+    return &HeartbeatPublisher{
+        Disabled: cfg.Disabled,
+        Outbox:   newOutboxRepository(deps),
+        Interval: cfg.Interval,
+        Source:   cfg.Source,
+        Now:      deps.Clock.Now,
+    }
+}
+
+// NewOutboxArchiver returns the archiver that moves processed events out of
+// the outbox named in deps. Run its Run in a goroutine.
+func NewOutboxArchiver(deps Deps) *outbox.Archiver {
+    deps = deps.withDefaults()
+    if deps.Archive.Clock == nil {
+        deps.Archive.Clock = deps.Clock
+    }
+    return outbox.NewArchiver(deps.DB, deps.OutboxTable, deps.Archive)
+}
@@ -0,0 +1,78 @@
+package orderapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/featureflags"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
+)
+
+func TestRegisterAdminRoutes_flagsRequireAdminKey(t *testing.T) {
+    const body = `{"name": "strict_concurrency", "enabled": true, "actor": "ops", "reason": "rollout"}`
+    tests := []struct {
+        name        string
+        adminKey    string
+        method      string
+        sendKey     string
+        wantStatus  int
+        wantChanged bool
+    }{
+        {name: "list without the key", adminKey: "secret", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+        {name: "list with a wrong key", adminKey: "secret", method: http.MethodGet, sendKey: "guess", wantStatus: http.StatusUnauthorized},
+        {name: "list with the key", adminKey: "secret", method: http.MethodGet, sendKey: "secret", wantStatus: http.StatusOK},
+        {name: "set without the key", adminKey: "secret", method: http.MethodPut, wantStatus: http.StatusUnauthorized},
+        {name: "set with a wrong key", adminKey: "secret", method: http.MethodPut, sendKey: "guess", wantStatus: http.StatusUnauthorized},
+        {name: "set with the key", adminKey: "secret", method: http.MethodPut, sendKey: "secret", wantStatus: http.StatusOK, wantChanged: true},
+        {name: "set with admin disabled", method: http.MethodPut, sendKey: "secret", wantStatus: http.StatusForbidden},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            flags := featureflags.New()
+            router := mux.NewRouter()
+            RegisterAdminRoutes(router.PathPrefix("/admin").Subrouter(), Deps{AdminKey: tt.adminKey, Flags: flags})
+            
+            r := httptest.NewRequest(tt.method, "/admin/flags", strings.NewReader(body))
+            if tt.sendKey != "" {
+                r.Header.Set(httpmw.AdminKeyHeader, tt.sendKey)
+            }
+            w := httptest.NewRecorder()
+            router.ServeHTTP(w, r)
+            
+            if w.Code != tt.wantStatus {
+                t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if got := flags.Enabled(featureflags.StrictConcurrency); got != tt.wantChanged {
+                t.Errorf("strict_concurrency = %t, want %t", got, tt.wantChanged)
+            }
+        })
+    }
+}
+
+// Zero in the environment disables the event store's limit, which Deps
+// spells -1 since its zero value means the default.
+func TestMaxEventBytesFromEnv(t *testing.T) {
+    tests := []struct {
+        value string
+        want  int
+    }{
+        {value: "", want: 0},
+        {value: "1048576", want: 1048576},
+        {value: "0", want: -1},
+        {value: "-5", want: 0},
+        {value: "large", want: 0},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.value, func(t *testing.T) {
+            t.Setenv("EVENT_STORE_MAX_EVENT_BYTES", tt.value)
+            if got := MaxEventBytesFromEnv(); got != tt.want {
+                t.Errorf("MaxEventBytesFromEnv() = %d, want %d", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,62 @@
+package orderapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/order-management-service/orderapi"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// With the synchronous projection enabled, the reporting read model holds
+// each command's result as soon as the command responds; without it, the
+// read model waits for the consumer.
+func TestRegisterRoutes_syncProjection(t *testing.T) {
+    tests := []struct {
+        name    string
+        enabled bool
+    }{
+        {name: "enabled", enabled: true},
+        {name: "disabled"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            deps := newMinimalDeps(t)
+            deps.SyncProjection = orderapi.SyncProjectionConfig{Enabled: tt.enabled}
+            router := mount(deps)
+            orders := readmodels.NewOrderReadModel(sqlmetrics.Wrap(deps.DB, 0), readmodels.NewCache(nil, readmodels.CacheConfig{}))
+            history := readmodels.NewOrderHistoryReadModel(sqlmetrics.Wrap(deps.DB, 0))
+            
+            orderID := newOrder(t, router)
+            order, err := orders.GetOrder(ctx, orderID)
+            if !tt.enabled {
+                if !errors.Is(err, readmodels.ErrOrderNotFound) {
+                    t.Errorf("GetOrder() without the synchronous projection = %+v, %v, want ErrOrderNotFound", order, err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("GetOrder() right after the create = %v", err)
+            }
+            if order.Status != valueobjects.OrderStatusDraft.String() || order.Version != 1 || order.TotalAmount.Amount != 2000 {
+                t.Errorf("order = %s at version %d totalling %d, want draft at version 1 totalling 2000", order.Status, order.Version, order.TotalAmount.Amount)
+            }
+            
+            runSteps(t, router, orderID, []step{{method: http.MethodPost, path: "/confirm", body: "{}", wantStatus: http.StatusOK}})
+            order, err = orders.GetOrder(ctx, orderID)
+            if err != nil || order.Status != valueobjects.OrderStatusConfirmed.String() || order.Version != 2 {
+                t.Errorf("GetOrder() right after the confirm = %+v, %v, want confirmed at version 2", order, err)
+            }
+            entries, err := history.GetHistory(ctx, orderID)
+            if err != nil || len(entries) != 2 {
+                t.Errorf("GetHistory() = %d entries, %v, want 2", len(entries), err)
+            }
+        })
+    }
+}
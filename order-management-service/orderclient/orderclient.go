@@ -0,0 +1,235 @@
+// Package orderclient is a Go client for the order management service's
+// /api/v2 command endpoints. It depends only on the shared module, so
+// callers do not link the service itself.
+//
+//	client, err := orderclient.New(apiclient.Config{BaseURL: "http://localhost:8080"})
+//	created, err := client.CreateOrder(ctx, orderclient.CreateOrderRequest{...})
+//	err = client.ConfirmOrder(ctx, created.ID)
+//
+// Errors returned for error responses are *apiclient.Error, carrying the
+// status and the server's body. Commands send an Idempotency-Key; set it
+// with apiclient.WithIdempotencyKey to keep it across your own retries.
+package orderclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+)
+
+// Client calls the order management service.
+type Client struct {
+    api *apiclient.Client
+}
+
+// New returns a client for the service at cfg.BaseURL. cfg.APIKey is only
+// needed to force cancellations.
+func New(cfg apiclient.Config) (*Client, error) {
+    api, err := apiclient.New(cfg)
+    if err != nil {
+        return nil, err
+    }
+    return &Client{api: api}, nil
+}
+
+type OrderItem struct {
+    ProductID string             `json:"product_id"`
+    Quantity  int                `json:"quantity"`
+    Price     valueobjects.Money `json:"price"`
+}
+
+// CreateOrderRequest gives a CustomerID, or, for a guest checkout, a
+// ContactEmail and a ShippingAddress.
+type CreateOrderRequest struct {
+    CustomerID      string               `json:"customer_id,omitempty"`
+    ContactEmail    string               `json:"contact_email,omitempty"`
+    Items           []OrderItem          `json:"items"`
+    ShippingAddress valueobjects.Address `json:"shipping_address"`
+    // AddressID picks one of the customer's saved addresses instead of
+    // ShippingAddress
+    AddressID       string               `json:"address_id,omitempty"`
+    // Channel is web, mobile or phone; empty means web
+    Channel         string               `json:"channel,omitempty"`
+}
+
+// CreatedOrder is the response to CreateOrder.
+type CreatedOrder struct {
+    ID           string             `json:"id"`
+    CustomerID   string             `json:"customer_id"`
+    ContactEmail string             `json:"contact_email,omitempty"`
+    Status       string             `json:"status"`
+    Channel      string             `json:"channel"`
+    // OrderNumber is the human-readable number, such as ORD-2024-000123,
+    // to quote to customer support
+    OrderNumber  string             `json:"order_number,omitempty"`
+    TotalAmount  valueobjects.Money `json:"total_amount"`
+    ShippingCost valueobjects.Money `json:"shipping_cost"`
+    GrandTotal   valueobjects.Money `json:"grand_total"`
+    CreatedAt    apijson.Timestamp  `json:"created_at"`
+}
+
+type UpdateOrderRequest struct {
+    Items           []OrderItem          `json:"items"`
+    ShippingAddress valueobjects.Address `json:"shipping_address"`
+}
+
+// CancelOrderRequest cancels for Reason, one of
+// valueobjects.CancellationReasons, with optional free-text Details.
+type CancelOrderRequest struct {
+    Reason  valueobjects.CancellationReason `json:"reason"`
+    Details string                          `json:"details,omitempty"`
+    // Force cancels past the cancellation window and requires the API key
+    Force   bool                            `json:"force"`
+}
+
+// DeliverOrderRequest confirms a delivery. Every field is optional; a zero
+// DeliveredAt means now.
+type DeliverOrderRequest struct {
+    DeliveredAt      time.Time `json:"delivered_at,omitempty"`
+    SignedBy         string    `json:"signed_by,omitempty"`
+    CarrierReference string    `json:"carrier_reference,omitempty"`
+}
+
+// HoldOrderRequest puts a confirmed order on hold for Reason, which is
+// required.
+type HoldOrderRequest struct {
+    Reason string `json:"reason"`
+}
+
+// ReleaseOrderRequest releases an order on hold, with an optional Reason.
+type ReleaseOrderRequest struct {
+    Reason string `json:"reason,omitempty"`
+}
+
+// CustomerMerge is the response to MergeCustomers.
+type CustomerMerge struct {
+    SourceCustomerID string `json:"source_customer_id"`
+    TargetCustomerID string `json:"target_customer_id"`
+    // OrdersMoved counts the orders this call reassigned
+    OrdersMoved      int    `json:"orders_moved"`
+}
+
+// OrderSnapshot is an order rebuilt from its events.
+type OrderSnapshot struct {
+    ID              string               `json:"id"`
+    CustomerID      string               `json:"customer_id"`
+    ContactEmail    string               `json:"contact_email,omitempty"`
+    Status          string               `json:"status"`
+    PreviousStatus  string               `json:"previous_status,omitempty"`
+    HoldReason      string               `json:"hold_reason,omitempty"`
+    Items           []OrderItem          `json:"items"`
+    TotalAmount     valueobjects.Money   `json:"total_amount"`
+    ShippingCost    valueobjects.Money   `json:"shipping_cost"`
+    GrandTotal      valueobjects.Money   `json:"grand_total"`
+    ShippingAddress valueobjects.Address `json:"shipping_address"`
+    Channel         string               `json:"channel"`
+    OrderNumber     string               `json:"order_number,omitempty"`
+    CreatedAt       apijson.Timestamp    `json:"created_at"`
+    UpdatedAt       apijson.Timestamp    `json:"updated_at"`
+}
+
+// OrderAsOf is the response to GetOrderAsOf.
+type OrderAsOf struct {
+    Order         OrderSnapshot     `json:"order"`
+    AppliedEvents int               `json:"applied_events"`
+    LastEventID   string            `json:"last_event_id"`
+    LastEventAt   apijson.Timestamp `json:"last_event_at"`
+    // AsOf is set when the order was asked for at a time
+    AsOf          *apijson.Timestamp `json:"as_of,omitempty"`
+}
+
+func (c *Client) CreateOrder(ctx context.Context, req CreateOrderRequest) (*CreatedOrder, error) {
+    var created CreatedOrder
+    if err := c.api.Do(ctx, apiclient.Request{Method: http.MethodPost, Path: ordersPath, Body: req}, &created); err != nil {
+        return nil, err
+    }
+    return &created, nil
+}
+
+// UpdateOrder replaces a draft order's items and shipping address.
+func (c *Client) UpdateOrder(ctx context.Context, orderID string, req UpdateOrderRequest) error {
+    return c.api.Do(ctx, apiclient.Request{Method: http.MethodPut, Path: orderPath(orderID), Body: req}, nil)
+}
+
+func (c *Client) ConfirmOrder(ctx context.Context, orderID string) error {
+    return c.api.Do(ctx, apiclient.Request{Method: http.MethodPost, Path: orderPath(orderID) + "/confirm"}, nil)
+}
+
+func (c *Client) CancelOrder(ctx context.Context, orderID string, req CancelOrderRequest) error {
+    return c.api.Do(ctx, apiclient.Request{Method: http.MethodPost, Path: orderPath(orderID) + "/cancel", Body: req}, nil)
+}
+
+// ShipOrder ships a confirmed order. It fails with 409 Conflict while the
+// order is on hold.
+func (c *Client) ShipOrder(ctx context.Context, orderID string) error {
+    return c.api.Do(ctx, apiclient.Request{Method: http.MethodPost, Path: orderPath(orderID) + "/ship"}, nil)
+}
+
+// DeliverOrder confirms the delivery of a shipped order.
+func (c *Client) DeliverOrder(ctx context.Context, orderID string, req DeliverOrderRequest) error {
+    return c.api.Do(ctx, apiclient.Request{Method: http.MethodPost, Path: orderPath(orderID) + "/deliver", Body: req}, nil)
+}
+
+func (c *Client) ReopenOrder(ctx context.Context, orderID string) error {
+    return c.api.Do(ctx, apiclient.Request{Method: http.MethodPost, Path: orderPath(orderID) + "/reopen"}, nil)
+}
+
+// HoldOrder puts a confirmed order on hold, as for fraud review, so it
+// cannot ship until released. It requires the API key.
+func (c *Client) HoldOrder(ctx context.Context, orderID string, req HoldOrderRequest) error {
+    return c.api.Do(ctx, apiclient.Request{Method: http.MethodPost, Path: orderPath(orderID) + "/hold", Body: req}, nil)
+}
+
+// ReleaseOrder returns an order on hold to confirmed. It requires the API
+// key.
+func (c *Client) ReleaseOrder(ctx context.Context, orderID string, req ReleaseOrderRequest) error {
+    return c.api.Do(ctx, apiclient.Request{Method: http.MethodPost, Path: orderPath(orderID) + "/release", Body: req}, nil)
+}
+
+// MergeCustomers merges the duplicate customer sourceID into targetID,
+// reassigning their orders. It requires the API key. Calling it again for
+// the same customers moves only the orders an earlier call did not.
+func (c *Client) MergeCustomers(ctx context.Context, sourceID, targetID string) (*CustomerMerge, error) {
+    var result CustomerMerge
+    req := apiclient.Request{
+        Method: http.MethodPost,
+        Path:   apiversion.V2.Prefix() + "/customers/" + url.PathEscape(sourceID) + "/merge",
+        Body:   map[string]string{"target_customer_id": targetID},
+    }
+    if err := c.api.Do(ctx, req, &result); err != nil {
+        return nil, err
+    }
+    return &result, nil
+}
+
+// GetOrderAsOf replays an order's events up to at.
+func (c *Client) GetOrderAsOf(ctx context.Context, orderID string, at time.Time) (*OrderAsOf, error) {
+    return c.orderAsOf(ctx, orderID, url.Values{"time": {at.UTC().Format(time.RFC3339Nano)}})
+}
+
+// GetOrderAtVersion replays an order's events up to version.
+func (c *Client) GetOrderAtVersion(ctx context.Context, orderID string, version int) (*OrderAsOf, error) {
+    return c.orderAsOf(ctx, orderID, url.Values{"version": {strconv.Itoa(version)}})
+}
+
+func (c *Client) orderAsOf(ctx context.Context, orderID string, query url.Values) (*OrderAsOf, error) {
+    var result OrderAsOf
+    req := apiclient.Request{Method: http.MethodGet, Path: orderPath(orderID) + "/as-of", Query: query}
+    if err := c.api.Do(ctx, req, &result); err != nil {
+        return nil, err
+    }
+    return &result, nil
+}
+
+var ordersPath = apiversion.V2.Prefix() + "/orders"
+
+func orderPath(orderID string) string {
+    return ordersPath + "/" + url.PathEscape(orderID)
+}
@@ -1,46 +1,291 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/vdntruong/dddcqrs/order-reporting-service/internal/readmodels"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
 )
 
+// analyticsFallbackStats is published as the "analytics_fallbacks" expvar:
+// analytics requests the database failed, answered with the last cached
+// analytics (served) or not, for want of a copy (missed).
+var analyticsFallbackStats = expvar.NewMap("analytics_fallbacks")
+
+// analyticsOutage is set from the first failed analytics query until one
+// succeeds, across the handlers of every API version.
+var analyticsOutage atomic.Bool
+
+// GetOrderAnalyticsHandler reports order analytics for a window, as
+// timewindow.ParsePeriod reads it from ?period, ?from, ?to and ?tz. When
+// the database fails, it serves the last analytics Fallback kept for the
+// window, marked stale with the time they were computed, rather than an
+// error. The fallback is logged once per outage, not per request.
 type GetOrderAnalyticsHandler struct {
     ReadModel readmodels.OrderReadModel
+    // Fallback keeps the analytics of every successful query; nil
+    // disables the fallback
+    Fallback  *readmodels.AnalyticsCache
+    // Now returns the current time; it defaults to clock.Now
+    Now       func() time.Time
 }
 
 func (h *GetOrderAnalyticsHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
-    period := r.URL.Query().Get("period")
-    if period == "" {
-        period = "monthly" // default
+    window, err := timewindow.ParsePeriod(r.URL.Query(), h.now(), time.UTC)
+    if err != nil {
+        timewindow.WriteError(w, err)
+        return
     }
     
-    // Validate period
-    validPeriods := map[string]bool{
-        "daily":   true,
-        "weekly":  true,
-        "monthly": true,
-        "all":     true,
+    // Revenue includes shipping unless ?include_shipping=false
+    includeShipping := true
+    if raw := r.URL.Query().Get("include_shipping"); raw != "" {
+        parsed, err := strconv.ParseBool(raw)
+        if err != nil {
+            http.Error(w, "Invalid include_shipping. Must be true or false", http.StatusBadRequest)
+            return
+        }
+        includeShipping = parsed
+    }
+    
+    result := analyticsResult{
+        Window:          window,
+        IncludeShipping: includeShipping,
+    }
+    
+    analytics, err := h.ReadModel.GetOrderAnalytics(r.Context(), window, includeShipping)
+    if err != nil {
+        cached, ok := h.fallback(r, window, includeShipping, err)
+        if !ok {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        result.Analytics = cached.Analytics
+        result.CachedAt = &cached.CachedAt
+    } else {
+        if analyticsOutage.CompareAndSwap(true, false) {
+            log.Println("Order analytics recovered, serving fresh analytics again")
+        }
+        if h.Fallback != nil {
+            h.Fallback.Save(r.Context(), window, includeShipping, analytics, h.now())
+        }
+        result.Analytics = analytics
+    }
+    
+    apijson.Write(w, r, http.StatusOK, analyticsResponses.For(r, result))
+}
+
+// fallback returns the cached analytics to serve for a query that failed
+// with err, reporting false when there are none.
+func (h *GetOrderAnalyticsHandler) fallback(r *http.Request, window timewindow.Window, includeShipping bool, err error) (*readmodels.CachedAnalyticsDTO, bool) {
+    // A client going away is no outage
+    if r.Context().Err() != nil {
+        return nil, false
+    }
+    if analyticsOutage.CompareAndSwap(false, true) {
+        log.Printf("Order analytics query failed, serving cached analytics until it recovers: %v", err)
+    }
+    if h.Fallback == nil {
+        analyticsFallbackStats.Add("missed", 1)
+        return nil, false
+    }
+    cached, ok := h.Fallback.Load(r.Context(), window, includeShipping)
+    if !ok {
+        analyticsFallbackStats.Add("missed", 1)
+        return nil, false
+    }
+    analyticsFallbackStats.Add("served", 1)
+    return cached, true
+}
+
+func (h *GetOrderAnalyticsHandler) now() time.Time {
+    if h.Now == nil {
+        return clock.Now()
+    }
+    return h.Now()
+}
+
+// CompareOrderAnalyticsHandler compares the orders of a window, as
+// timewindow.ParsePeriod reads it with period defaulting to weekly, with
+// those of the period before it.
+type CompareOrderAnalyticsHandler struct {
+    ReadModel readmodels.OrderReadModel
+    // Now returns the current time; it defaults to clock.Now
+    Now func() time.Time
+}
+
+func (h *CompareOrderAnalyticsHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    now := clock.Now
+    if h.Now != nil {
+        now = h.Now
+    }
+    
+    query := r.URL.Query()
+    if query.Get("period") == "" && query.Get("from") == "" && query.Get("to") == "" {
+        query.Set("period", string(timewindow.Weekly))
+    }
+    window, err := timewindow.ParsePeriod(query, now(), time.UTC)
+    if err != nil {
+        timewindow.WriteError(w, err)
+        return
+    }
+    
+    includeShipping := true
+    if raw := r.URL.Query().Get("include_shipping"); raw != "" {
+        parsed, err := strconv.ParseBool(raw)
+        if err != nil {
+            http.Error(w, "Invalid include_shipping. Must be true or false", http.StatusBadRequest)
+            return
+        }
+        includeShipping = parsed
+    }
+    
+    comparison, err := h.ReadModel.CompareOrderAnalytics(r.Context(), window, includeShipping)
+    if errors.Is(err, readmodels.ErrInvalidComparisonPeriod) {
+        http.Error(w, "Invalid period. Must be one of: daily, weekly, monthly, custom", http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
     }
     
-    if !validPeriods[period] {
-        http.Error(w, "Invalid period. Must be one of: daily, weekly, monthly, all", http.StatusBadRequest)
+    apijson.Write(w, r, http.StatusOK, struct {
+        IncludeShipping bool   `json:"include_shipping"`
+        Timezone        string `json:"timezone"`
+        *readmodels.OrderComparisonDTO
+    }{includeShipping, window.Location.String(), comparison})
+}
+
+// GetOrderValueDistributionHandler counts the orders of a window, as
+// timewindow.ParsePeriod reads it, in order value bands, given as comma
+// separated upper bounds in ?buckets.
+type GetOrderValueDistributionHandler struct {
+    ReadModel readmodels.OrderReadModel
+    // Now returns the current time; it defaults to clock.Now
+    Now       func() time.Time
+}
+
+func (h *GetOrderValueDistributionHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    now := clock.Now
+    if h.Now != nil {
+        now = h.Now
+    }
+    window, err := timewindow.ParsePeriod(r.URL.Query(), now(), time.UTC)
+    if err != nil {
+        timewindow.WriteError(w, err)
         return
     }
     
-    analytics, err := h.ReadModel.GetOrderAnalytics(r.Context(), period)
+    var bounds []int64
+    if raw := r.URL.Query().Get("buckets"); raw != "" {
+        for _, field := range strings.Split(raw, ",") {
+            bound, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+            if err != nil {
+                http.Error(w, "Invalid buckets. Must be comma separated amounts in minor units", http.StatusBadRequest)
+                return
+            }
+            bounds = append(bounds, bound)
+        }
+    }
+    
+    distribution, err := h.ReadModel.GetOrderValueDistribution(r.Context(), window, bounds)
+    if errors.Is(err, readmodels.ErrInvalidValueBuckets) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
     
-    response := map[string]interface{}{
-        "period": period,
-        "analytics": analytics,
+    from, to := windowBounds(window)
+    apijson.Write(w, r, http.StatusOK, struct {
+        From     *apijson.Timestamp `json:"from"`
+        To       *apijson.Timestamp `json:"to"`
+        Timezone string             `json:"timezone"`
+        *readmodels.OrderValueDistributionDTO
+    }{from, to, window.Location.String(), distribution})
+}
+
+// defaultSalesWindow is the range a product time series covers when from
+// is not given.
+const defaultSalesWindow = 30 * 24 * time.Hour
+
+// GetProductSalesTimeSeriesHandler reports the units sold of a product per
+// day, week or month between ?from and ?to, which default to the last 30
+// days.
+type GetProductSalesTimeSeriesHandler struct {
+    ReadModel readmodels.OrderReadModel
+    // Now returns the current time; it defaults to clock.Now
+    Now func() time.Time
+}
+
+func (h *GetProductSalesTimeSeriesHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    productID := mux.Vars(r)["id"]
+    query := r.URL.Query()
+    
+    bucket := query.Get("bucket")
+    if bucket == "" {
+        bucket = readmodels.BucketDay
+    }
+    
+    now := clock.Now
+    if h.Now != nil {
+        now = h.Now
+    }
+    to := now().UTC()
+    if raw := query.Get("to"); raw != "" {
+        parsed, ok := parseDateOrTime(raw)
+        if !ok {
+            http.Error(w, "to must be a date (2006-01-02) or an RFC 3339 timestamp", http.StatusBadRequest)
+            return
+        }
+        to = parsed
+    }
+    from := to.Add(-defaultSalesWindow)
+    if raw := query.Get("from"); raw != "" {
+        parsed, ok := parseDateOrTime(raw)
+        if !ok {
+            http.Error(w, "from must be a date (2006-01-02) or an RFC 3339 timestamp", http.StatusBadRequest)
+            return
+        }
+        from = parsed
+    }
+    
+    series, err := h.ReadModel.GetProductSalesTimeSeries(r.Context(), productID, from, to, bucket)
+    if errors.Is(err, readmodels.ErrInvalidTimeSeries) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if errors.Is(err, readmodels.ErrProductNotSold) {
+        http.Error(w, "Product not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
     }
     
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    apijson.Write(w, r, http.StatusOK, series)
+}
+
+// parseDateOrTime parses a date, as midnight UTC, or an RFC 3339 timestamp.
+func parseDateOrTime(raw string) (time.Time, bool) {
+    if parsed, err := time.Parse("2006-01-02", raw); err == nil {
+        return parsed, true
+    }
+    parsed, err := time.Parse(time.RFC3339, raw)
+    return parsed, err == nil
 }
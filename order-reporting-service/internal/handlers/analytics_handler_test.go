@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// distributionReadModel records the bounds it is asked for and validates
+// them as the read model does.
+type distributionReadModel struct {
+    readmodels.OrderReadModel
+    called bool
+    bounds []int64
+}
+
+func (rm *distributionReadModel) GetOrderValueDistribution(_ context.Context, window timewindow.Window, bounds []int64) (*readmodels.OrderValueDistributionDTO, error) {
+    rm.called, rm.bounds = true, bounds
+    if err := readmodels.ValidateOrderValueBuckets(bounds); err != nil {
+        return nil, err
+    }
+    return &readmodels.OrderValueDistributionDTO{Period: string(window.Period), Bounds: bounds}, nil
+}
+
+// ?buckets is read as comma separated bounds in minor units; bounds the
+// read model refuses, like those that are not numbers, answer 400.
+func TestGetOrderValueDistributionHandler(t *testing.T) {
+    now := func() time.Time { return time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) }
+    tests := []struct {
+        name       string
+        query      string
+        wantStatus int
+        wantBounds []int64
+        wantCalled bool
+    }{
+        {name: "default buckets", query: "", wantStatus: http.StatusOK, wantCalled: true},
+        {name: "custom buckets", query: "buckets=1000,%205000", wantStatus: http.StatusOK, wantBounds: []int64{1000, 5000}, wantCalled: true},
+        {name: "not a number", query: "buckets=10.50", wantStatus: http.StatusBadRequest},
+        {name: "empty bound", query: "buckets=1000,,5000", wantStatus: http.StatusBadRequest},
+        {name: "decreasing", query: "buckets=5000,1000", wantStatus: http.StatusBadRequest, wantBounds: []int64{5000, 1000}, wantCalled: true},
+        {name: "negative", query: "buckets=-1", wantStatus: http.StatusBadRequest, wantBounds: []int64{-1}, wantCalled: true},
+        {name: "invalid period", query: "period=yearly", wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rm := &distributionReadModel{}
+            handler := &GetOrderValueDistributionHandler{ReadModel: rm, Now: now}
+            w := httptest.NewRecorder()
+            handler.HandleHTTP(w, httptest.NewRequest(http.MethodGet, "/analytics/orders/value-distribution?"+tt.query, nil))
+            
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if rm.called != tt.wantCalled || !reflect.DeepEqual(rm.bounds, tt.wantBounds) {
+                t.Errorf("read model asked = %t for %v, want %t for %v", rm.called, rm.bounds, tt.wantCalled, tt.wantBounds)
+            }
+            if w.Code != http.StatusOK {
+                return
+            }
+            var body struct {
+                Timezone string `json:"timezone"`
+            }
+            if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Timezone != "UTC" {
+                t.Errorf("response timezone = %q, %v, want UTC", body.Timezone, err)
+            }
+        })
+    }
+}
+
+// flakyAnalyticsReadModel answers analytics until fail is set, as the
+// database does until it goes down.
+type flakyAnalyticsReadModel struct {
+    readmodels.OrderReadModel
+    fail      bool
+    analytics readmodels.OrderAnalyticsDTO
+}
+
+func (rm *flakyAnalyticsReadModel) GetOrderAnalytics(context.Context, timewindow.Window, bool) (*readmodels.OrderAnalyticsDTO, error) {
+    if rm.fail {
+        return nil, errors.New("connection refused")
+    }
+    analytics := rm.analytics
+    return &analytics, nil
+}
+
+func analyticsFallbackStat(name string) int64 {
+    if v, ok := analyticsFallbackStats.Get(name).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
+
+// While the database is down, analytics are served from the last copy
+// cached for the window, marked stale; a window with no copy, or a handler
+// without a fallback, still fails. The outage is logged when it starts and
+// when it ends, not per request.
+func TestGetOrderAnalyticsHandler_fallback(t *testing.T) {
+    computedAt := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+    client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+    defer client.Close()
+    rm := &flakyAnalyticsReadModel{analytics: readmodels.OrderAnalyticsDTO{TotalOrders: 3, TotalRevenue: 4500}}
+    handler := &GetOrderAnalyticsHandler{
+        ReadModel: rm,
+        Fallback:  readmodels.NewAnalyticsCache(readmodels.NewCache(client, readmodels.CacheConfig{})),
+        Now:       func() time.Time { return computedAt },
+    }
+    get := func(query string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        handler.HandleHTTP(w, httptest.NewRequest(http.MethodGet, "/analytics/orders?"+query, nil))
+        return w
+    }
+    
+    var logs bytes.Buffer
+    defer log.SetOutput(log.Writer())
+    log.SetOutput(&logs)
+    analyticsOutage.Store(false)
+    defer analyticsOutage.Store(false)
+    served, missed := analyticsFallbackStat("served"), analyticsFallbackStat("missed")
+    
+    // Cold cache: nothing to fall back on
+    rm.fail = true
+    if w := get("period=daily"); w.Code != http.StatusInternalServerError {
+        t.Fatalf("cold cache status = %d, want 500: %s", w.Code, w.Body)
+    }
+    if got := analyticsFallbackStat("missed") - missed; got != 1 {
+        t.Errorf("missed fallbacks grew by %d, want 1", got)
+    }
+    
+    // The database recovers and the analytics are cached
+    rm.fail = false
+    fresh := serveVersion(t, handler.HandleHTTP, httptest.NewRequest(http.MethodGet, "/analytics/orders?period=daily", nil), apiversion.V1)
+    if _, stale := fresh["stale"]; stale {
+        t.Errorf("fresh analytics = %v, want them unmarked", fresh)
+    }
+    if !strings.Contains(logs.String(), "recovered") {
+        t.Errorf("log = %q, want the recovery", logs.String())
+    }
+    
+    // Warm cache: the copy is served in every version, however many
+    // requests the outage sees
+    rm.fail = true
+    logs.Reset()
+    req := httptest.NewRequest(http.MethodGet, "/analytics/orders?period=daily", nil)
+    v1 := serveVersion(t, handler.HandleHTTP, req, apiversion.V1)
+    v2 := serveVersion(t, handler.HandleHTTP, req, apiversion.V2)
+    const cachedAt = "2024-03-15T12:00:00.000Z"
+    analytics, _ := v1["analytics"].(map[string]interface{})
+    if v1["stale"] != true || v1["cached_at"] != cachedAt || analytics["total_orders"] != 3.0 {
+        t.Errorf("v1 fallback = %v, want the cached analytics, stale at %s", v1, cachedAt)
+    }
+    if v2["stale"] != true || v2["cached_at"] != cachedAt || v2["total_orders"] != 3.0 {
+        t.Errorf("v2 fallback = %v, want the cached analytics, stale at %s", v2, cachedAt)
+    }
+    if got := analyticsFallbackStat("served") - served; got != 2 {
+        t.Errorf("served fallbacks grew by %d, want 2", got)
+    }
+    if n := strings.Count(logs.String(), "query failed"); n != 1 {
+        t.Errorf("outage logged %d times, want once: %q", n, logs.String())
+    }
+    
+    // Each window has its own copy
+    if w := get("period=weekly"); w.Code != http.StatusInternalServerError {
+        t.Errorf("uncached window status = %d, want 500", w.Code)
+    }
+    if w := get("period=daily&include_shipping=false"); w.Code != http.StatusInternalServerError {
+        t.Errorf("uncached revenue basis status = %d, want 500", w.Code)
+    }
+    
+    handler.Fallback = nil
+    if w := get("period=daily"); w.Code != http.StatusInternalServerError {
+        t.Errorf("status without a fallback = %d, want 500", w.Code)
+    }
+    if got := analyticsFallbackStat("missed") - missed; got != 4 {
+        t.Errorf("missed fallbacks grew by %d, want 4", got)
+    }
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// AnonymizeOrdersHandler scrubs the personal data of a customer or a guest
+// checkout from their orders in the read models (POST), for erasure
+// requests. The erasure is logged with who made it and why, but not with
+// the contact email erased.
+type AnonymizeOrdersHandler struct {
+    ReadModel readmodels.OrderReadModel
+}
+
+// AnonymizeOrdersRequest names the data subject by exactly one of
+// CustomerID and ContactEmail. Actor names the operator, as the admin key
+// does not identify one.
+type AnonymizeOrdersRequest struct {
+    CustomerID   string `json:"customer_id"`
+    ContactEmail string `json:"contact_email"`
+    Reason       string `json:"reason"`
+    Actor        string `json:"actor"`
+}
+
+// AnonymizeOrdersResponse counts the orders scrubbed.
+type AnonymizeOrdersResponse struct {
+    AnonymizedOrders int64 `json:"anonymized_orders"`
+}
+
+func (h *AnonymizeOrdersHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    var req AnonymizeOrdersRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    req.Reason, req.Actor = strings.TrimSpace(req.Reason), strings.TrimSpace(req.Actor)
+    if req.Reason == "" || req.Actor == "" {
+        http.Error(w, "reason and actor are required", http.StatusBadRequest)
+        return
+    }
+    if len(req.Reason) > maxOverrideReasonLength {
+        http.Error(w, fmt.Sprintf("reason must be at most %d characters", maxOverrideReasonLength), http.StatusBadRequest)
+        return
+    }
+    subject := readmodels.DataSubject{CustomerID: strings.TrimSpace(req.CustomerID), ContactEmail: strings.TrimSpace(req.ContactEmail)}
+    if err := subject.Validate(); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    anonymized, err := h.ReadModel.AnonymizeOrders(r.Context(), subject)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    whose := "a guest contact email"
+    if subject.CustomerID != "" {
+        whose = "customer " + subject.CustomerID
+    }
+    log.Printf("Anonymized %d orders of %s by %s: %s", anonymized, whose, req.Actor, req.Reason)
+    
+    apijson.Write(w, r, http.StatusOK, AnonymizeOrdersResponse{AnonymizedOrders: anonymized})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventfeed"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// bootstrapStats is published as the "projection_bootstrap" expvar: events
+// applied, events skipped because no projection applies their type or they
+// do not decode, and the position reached.
+var bootstrapStats = expvar.NewMap("projection_bootstrap")
+
+// Default Bootstrapper settings
+const (
+    DefaultBootstrapName     = "projections"
+    DefaultBootstrapPageSize = 500
+    DefaultBootstrapOverlap  = 5 * time.Minute
+)
+
+// Bootstrapper projects the history of an event feed source before the
+// projections consume from the broker, for deployments whose broker no
+// longer retains all of it. Progress is checkpointed after every page: an
+// interrupted bootstrap resumes from its last checkpoint, re-applying at
+// most a page of events, which the projections skip as redeliveries, and
+// a completed one is not run again.
+//
+// Dry-run projections are not bootstrapped.
+type Bootstrapper struct {
+    // Name identifies the checkpoint; it defaults to DefaultBootstrapName
+    Name        string
+    // SourceName describes Source in the checkpoint and logs
+    SourceName  string
+    Source      eventfeed.Source
+    Checkpoints readmodels.BootstrapCheckpointStore
+    Projections []Projection
+    // Registry decodes the events; it defaults to events.DefaultRegistry()
+    Registry    *events.Registry
+    // PageSize defaults to DefaultBootstrapPageSize
+    PageSize    int
+    // Overlap is how long before the last bootstrapped event was stored
+    // the projections start consuming, covering events stored late at
+    // earlier positions and clock skew; it defaults to
+    // DefaultBootstrapOverlap
+    Overlap     time.Duration
+    // Now returns the current time; it defaults to clock.Now
+    Now         func() time.Time
+}
+
+// Run bootstraps the projections unless the checkpoint shows a completed
+// bootstrap, and returns the time the projections should start consuming
+// at, for eventbus.WithStartTime. It is zero when the source had no events.
+func (b *Bootstrapper) Run(ctx context.Context) (time.Time, error) {
+    b.withDefaults()
+    
+    checkpoint, err := b.Checkpoints.GetCheckpoint(ctx, b.Name)
+    if err != nil {
+        return time.Time{}, err
+    }
+    switch {
+    case checkpoint == nil:
+        log.Printf("Bootstrapping projections from %s", b.SourceName)
+        now := b.Now().UTC()
+        checkpoint = &readmodels.BootstrapCheckpointDTO{Name: b.Name, Source: b.SourceName, StartedAt: now, UpdatedAt: now}
+    case checkpoint.CompletedAt != nil:
+        log.Printf("Projections were bootstrapped from %s up to position %d", checkpoint.Source, checkpoint.Position)
+        return b.startTime(checkpoint), nil
+    default:
+        log.Printf("Resuming bootstrap of projections from %s after position %d", b.SourceName, checkpoint.Position)
+    }
+    
+    for {
+        page, err := b.Source.GetEventsSince(ctx, checkpoint.Position, b.PageSize)
+        if err != nil {
+            return time.Time{}, fmt.Errorf("failed to read events after position %d: %w", checkpoint.Position, err)
+        }
+        
+        for _, stored := range page {
+            applied, err := b.apply(ctx, stored)
+            if err != nil {
+                return time.Time{}, err
+            }
+            if applied {
+                checkpoint.Applied++
+            }
+            checkpoint.Position = stored.Position
+            checkpoint.LastStoredAt = stored.StoredAt.Time
+        }
+        
+        checkpoint.Source = b.SourceName
+        checkpoint.UpdatedAt = b.Now().UTC()
+        done := len(page) < b.PageSize
+        if done {
+            completedAt := checkpoint.UpdatedAt
+            checkpoint.CompletedAt = &completedAt
+        }
+        if err := b.Checkpoints.SaveCheckpoint(ctx, checkpoint); err != nil {
+            return time.Time{}, err
+        }
+        bootstrapStats.Set("position", intVar(checkpoint.Position))
+        
+        if done {
+            log.Printf("Bootstrapped projections with %d events up to position %d", checkpoint.Applied, checkpoint.Position)
+            return b.startTime(checkpoint), nil
+        }
+    }
+}
+
+func (b *Bootstrapper) withDefaults() {
+    if b.Name == "" {
+        b.Name = DefaultBootstrapName
+    }
+    if b.Registry == nil {
+        b.Registry = events.DefaultRegistry()
+    }
+    if b.PageSize <= 0 {
+        b.PageSize = DefaultBootstrapPageSize
+    }
+    if b.Overlap <= 0 {
+        b.Overlap = DefaultBootstrapOverlap
+    }
+    if b.Now == nil {
+        b.Now = clock.Now
+    }
+}
+
+func (b *Bootstrapper) startTime(checkpoint *readmodels.BootstrapCheckpointDTO) time.Time {
+    if checkpoint.LastStoredAt.IsZero() {
+        return time.Time{}
+    }
+    return checkpoint.LastStoredAt.Add(-b.Overlap)
+}
+
+// apply passes stored to every projection applying its type, reporting
+// whether any did. Events that do not decode are logged and skipped, as
+// the consumer dead letters them.
+func (b *Bootstrapper) apply(ctx context.Context, stored eventfeed.Event) (bool, error) {
+    var targets []Projection
+    for _, projection := range b.Projections {
+        if projection.DryRun == nil && appliesType(projection, stored.EventType) {
+            targets = append(targets, projection)
+        }
+    }
+    if len(targets) == 0 {
+        bootstrapStats.Add("skipped", 1)
+        return false, nil
+    }
+    
+    event, err := stored.Decode(b.Registry)
+    if err != nil {
+        log.Printf("Bootstrap skipping event: %v", err)
+        bootstrapStats.Add("skipped", 1)
+        return false, nil
+    }
+    
+    for _, projection := range targets {
+        if err := projection.Handler(ctx, event); err != nil {
+            return false, fmt.Errorf("projection %s failed on %s at position %d: %w", projection.Name, stored.EventType, stored.Position, err)
+        }
+    }
+    bootstrapStats.Add("applied", 1)
+    return true, nil
+}
+
+func appliesType(projection Projection, eventType string) bool {
+    if len(projection.EventTypes) == 0 {
+        return true
+    }
+    for _, applied := range projection.EventTypes {
+        if applied == eventType {
+            return true
+        }
+    }
+    return false
+}
+
+func intVar(value int64) *expvar.Int {
+    v := new(expvar.Int)
+    v.Set(value)
+    return v
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventfeed"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// feedSource serves events as the feed endpoint does. When fail is set,
+// asking for the page after failAfter fails once.
+type feedSource struct {
+    events    []eventfeed.Event
+    fail      bool
+    failAfter int64
+    calls     int
+}
+
+func (s *feedSource) GetEventsSince(_ context.Context, after int64, limit int) ([]eventfeed.Event, error) {
+    s.calls++
+    if s.fail && after == s.failAfter {
+        s.fail = false
+        return nil, errors.New("connection reset")
+    }
+    page := []eventfeed.Event{}
+    for _, event := range s.events {
+        if event.Position > after && len(page) < limit {
+            page = append(page, event)
+        }
+    }
+    return page, nil
+}
+
+// memoryCheckpoints is a BootstrapCheckpointStore in memory.
+type memoryCheckpoints struct {
+    checkpoints map[string]readmodels.BootstrapCheckpointDTO
+}
+
+func (m *memoryCheckpoints) GetCheckpoint(_ context.Context, name string) (*readmodels.BootstrapCheckpointDTO, error) {
+    checkpoint, ok := m.checkpoints[name]
+    if !ok {
+        return nil, nil
+    }
+    return &checkpoint, nil
+}
+
+func (m *memoryCheckpoints) SaveCheckpoint(_ context.Context, checkpoint *readmodels.BootstrapCheckpointDTO) error {
+    if m.checkpoints == nil {
+        m.checkpoints = make(map[string]readmodels.BootstrapCheckpointDTO)
+    }
+    m.checkpoints[checkpoint.Name] = *checkpoint
+    return nil
+}
+
+// lastEventModel is a read model of each order's last event type. It skips
+// events it already applied, as the projections skip redeliveries.
+type lastEventModel struct {
+    mu      sync.Mutex
+    applied map[string]bool
+    last    map[string]string
+}
+
+func newLastEventModel() *lastEventModel {
+    return &lastEventModel{applied: make(map[string]bool), last: make(map[string]string)}
+}
+
+func (m *lastEventModel) apply(_ context.Context, event events.DomainEvent) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.applied[event.EventID()] {
+        return nil
+    }
+    m.applied[event.EventID()] = true
+    m.last[event.AggregateID()] = event.Type()
+    return nil
+}
+
+func (m *lastEventModel) snapshot() map[string]string {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    last := make(map[string]string, len(m.last))
+    for id, eventType := range m.last {
+        last[id] = eventType
+    }
+    return last
+}
+
+// seedFeed returns the events of three orders, the first two confirmed, at
+// positions 1 to 5 stored a minute apart from storedAt, with the orders.
+func seedFeed(t *testing.T, storedAt time.Time) ([]eventfeed.Event, []*entities.Order) {
+    t.Helper()
+    var orders []*entities.Order
+    var history []events.DomainEvent
+    for i := 0; i < 3; i++ {
+        order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+        if err != nil {
+            t.Fatalf("NewOrder() = %v", err)
+        }
+        orders = append(orders, order)
+        history = append(history, events.NewOrderCreatedEvent(order))
+    }
+    history = append(history, events.NewOrderConfirmedEvent(orders[0]), events.NewOrderConfirmedEvent(orders[1]))
+    
+    versions := make(map[string]int)
+    var feed []eventfeed.Event
+    for i, event := range history {
+        payload, err := json.Marshal(event)
+        if err != nil {
+            t.Fatalf("json.Marshal(%s) = %v", event.Type(), err)
+        }
+        versions[event.AggregateID()]++
+        stored := storedAt.Add(time.Duration(i) * time.Minute)
+        feed = append(feed, eventfeed.Event{
+            Position:    int64(i + 1),
+            AggregateID: event.AggregateID(),
+            EventType:   event.Type(),
+            Version:     versions[event.AggregateID()],
+            OccurredAt:  apijson.Timestamp{Time: event.OccurredAt()},
+            StoredAt:    apijson.Timestamp{Time: stored},
+            Payload:     payload,
+        })
+    }
+    return feed, orders
+}
+
+// A bootstrap failing part way resumes from its checkpoint and completes the
+// read model; the projections then continue from the bus.
+func TestBootstrapper_Run_resumesAfterFailure(t *testing.T) {
+    ctx := context.Background()
+    storedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    feed, orders := seedFeed(t, storedAt)
+    source := &feedSource{events: feed, fail: true, failAfter: 2}
+    checkpoints := &memoryCheckpoints{}
+    model := newLastEventModel()
+    bootstrapper := &Bootstrapper{
+        SourceName:  "management",
+        Source:      source,
+        Checkpoints: checkpoints,
+        Projections: []Projection{{Name: "orders", Handler: model.apply}},
+        PageSize:    2,
+        Overlap:     time.Minute,
+        Now:         func() time.Time { return storedAt.Add(time.Hour) },
+    }
+    
+    if _, err := bootstrapper.Run(ctx); err == nil {
+        t.Fatal("Run() with a failing source = nil, want an error")
+    }
+    checkpoint := checkpoints.checkpoints[DefaultBootstrapName]
+    if checkpoint.Position != 2 || checkpoint.CompletedAt != nil {
+        t.Fatalf("checkpoint after the failure = position %d, completed %v, want position 2, not completed", checkpoint.Position, checkpoint.CompletedAt)
+    }
+    
+    startTime, err := bootstrapper.Run(ctx)
+    if err != nil {
+        t.Fatalf("Run() resuming = %v", err)
+    }
+    if want := storedAt.Add(4 * time.Minute).Add(-time.Minute); !startTime.Equal(want) {
+        t.Errorf("Run() start time = %v, want %v", startTime, want)
+    }
+    checkpoint = checkpoints.checkpoints[DefaultBootstrapName]
+    if checkpoint.Position != 5 || checkpoint.Applied != 5 || checkpoint.CompletedAt == nil {
+        t.Errorf("checkpoint = position %d, applied %d, completed %v, want position 5, applied 5, completed", checkpoint.Position, checkpoint.Applied, checkpoint.CompletedAt)
+    }
+    want := map[string]string{
+        string(orders[0].ID): "OrderConfirmed",
+        string(orders[1].ID): "OrderConfirmed",
+        string(orders[2].ID): "OrderCreated",
+    }
+    if got := model.snapshot(); !reflect.DeepEqual(got, want) {
+        t.Errorf("read model after bootstrap = %v, want %v", got, want)
+    }
+    
+    // A completed bootstrap does not read its source again
+    calls := source.calls
+    if again, err := bootstrapper.Run(ctx); err != nil || !again.Equal(startTime) {
+        t.Errorf("Run() after completing = %v, %v, want %v", again, err, startTime)
+    }
+    if source.calls != calls {
+        t.Errorf("Run() after completing read the source %d times", source.calls-calls)
+    }
+    
+    bus := eventbus.NewInMemoryEventBus(nil)
+    if err := bus.Subscribe(ctx, []string{eventbus.DefaultTopic}, model.apply); err != nil {
+        t.Fatalf("Subscribe() = %v", err)
+    }
+    // The bus redelivers the last bootstrapped event within the overlap
+    redelivered, err := feed[len(feed)-1].Decode(events.DefaultRegistry())
+    if err != nil {
+        t.Fatalf("Decode() = %v", err)
+    }
+    for _, event := range []events.DomainEvent{redelivered, events.NewOrderConfirmedEvent(orders[2])} {
+        if err := bus.Publish(ctx, event); err != nil {
+            t.Fatalf("Publish(%s) = %v", event.Type(), err)
+        }
+    }
+    want[string(orders[2].ID)] = "OrderConfirmed"
+    if got := model.snapshot(); !reflect.DeepEqual(got, want) {
+        t.Errorf("read model after consuming the bus = %v, want %v", got, want)
+    }
+}
+
+// An empty source completes the bootstrap with no start time, so the
+// projections consume the broker from its beginning.
+func TestBootstrapper_Run_emptySource(t *testing.T) {
+    checkpoints := &memoryCheckpoints{}
+    bootstrapper := &Bootstrapper{
+        SourceName:  "snapshot",
+        Source:      &feedSource{},
+        Checkpoints: checkpoints,
+        Projections: []Projection{{Name: "orders", Handler: newLastEventModel().apply}},
+    }
+    
+    startTime, err := bootstrapper.Run(context.Background())
+    if err != nil || !startTime.IsZero() {
+        t.Errorf("Run() = %v, %v, want a zero start time", startTime, err)
+    }
+    if checkpoint := checkpoints.checkpoints[DefaultBootstrapName]; checkpoint.CompletedAt == nil || checkpoint.Position != 0 {
+        t.Errorf("checkpoint = position %d, completed %v, want position 0, completed", checkpoint.Position, checkpoint.CompletedAt)
+    }
+}
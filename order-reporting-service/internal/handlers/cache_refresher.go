@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+)
+
+// cacheRefreshStats is published as the "projection_cache_refresh" expvar:
+// refreshes scheduled, merged into one already pending, dropped because the
+// queue was full, completed and failed.
+var cacheRefreshStats = expvar.NewMap("projection_cache_refresh")
+
+// Default CustomerCacheRefresher settings
+const (
+    DefaultCacheRefreshWorkers   = 4
+    DefaultCacheRefreshWindow    = 250 * time.Millisecond
+    DefaultCacheRefreshQueueSize = 1000
+)
+
+// CacheRefreshFunc reloads one kind of a customer's cached reads.
+type CacheRefreshFunc func(ctx context.Context, customerID string) error
+
+// CustomerCacheRefresher re-populates customers' cached reads after the
+// projections it decorates change them, so readers find the cache warm
+// instead of all missing at once. Refreshes of the same reads of a customer
+// within the window are merged into one, and they run on a bounded pool of
+// workers; a refresh that cannot be queued is dropped, leaving the cache to
+// be filled by the next read.
+type CustomerCacheRefresher struct {
+    workers int
+    window  time.Duration
+    // lookupCustomer returns the customer of an order, for events that do
+    // not carry it
+    lookupCustomer func(ctx context.Context, orderID string) (string, error)
+    
+    queue   chan *cacheRefresh
+    mu      sync.Mutex
+    pending map[string]*cacheRefresh
+}
+
+// cacheRefresh is a refresh waiting for its window to pass, queued or
+// running. again is set when the reads changed while it was running.
+type cacheRefresh struct {
+    key        string
+    name       string
+    refresh    CacheRefreshFunc
+    customerID string
+    orderID    string
+    running    bool
+    again      bool
+}
+
+// NewCustomerCacheRefresher returns a refresher running workers refreshes
+// at once, merging those within window and queueing up to queueSize.
+// Zero values take the defaults. lookupCustomer resolves the customer of
+// order events that do not name it.
+func NewCustomerCacheRefresher(workers int, window time.Duration, queueSize int, lookupCustomer func(ctx context.Context, orderID string) (string, error)) *CustomerCacheRefresher {
+    if workers <= 0 {
+        workers = DefaultCacheRefreshWorkers
+    }
+    if window <= 0 {
+        window = DefaultCacheRefreshWindow
+    }
+    if queueSize <= 0 {
+        queueSize = DefaultCacheRefreshQueueSize
+    }
+    return &CustomerCacheRefresher{
+        workers:        workers,
+        window:         window,
+        lookupCustomer: lookupCustomer,
+        queue:          make(chan *cacheRefresh, queueSize),
+        pending:        make(map[string]*cacheRefresh),
+    }
+}
+
+// Decorate returns next followed by a refresh of the reads name of the
+// customer of each order event next applied, or only of events of
+// eventTypes when given. The refresh never changes next's result. A nil
+// refresher returns next unchanged.
+func (r *CustomerCacheRefresher) Decorate(name string, next eventbus.Handler, refresh CacheRefreshFunc, eventTypes ...string) eventbus.Handler {
+    if r == nil {
+        return next
+    }
+    only := make(map[string]bool, len(eventTypes))
+    for _, eventType := range eventTypes {
+        only[eventType] = true
+    }
+    
+    return func(ctx context.Context, event events.DomainEvent) error {
+        if err := next(ctx, event); err != nil {
+            return err
+        }
+        
+        customerID, ok := eventCustomerID(event)
+        if !ok || (len(only) > 0 && !only[event.Type()]) {
+            return nil
+        }
+        r.schedule(&cacheRefresh{
+            name:       name,
+            refresh:    refresh,
+            customerID: customerID,
+            orderID:    event.AggregateID(),
+        })
+        // The customer a merge moved the order from has its reads changed
+        // too
+        if reassigned, ok := event.(events.OrderCustomerReassignedEvent); ok {
+            r.schedule(&cacheRefresh{
+                name:       name,
+                refresh:    refresh,
+                customerID: reassigned.PreviousCustomerID,
+                orderID:    event.AggregateID(),
+            })
+        }
+        return nil
+    }
+}
+
+// eventCustomerID returns the customer named by an order event. ok is
+// false for events that change no order; an empty customer id with ok set
+// must be looked up from the order.
+func eventCustomerID(event events.DomainEvent) (customerID string, ok bool) {
+    switch e := event.(type) {
+    case events.OrderCreatedEvent:
+        return e.CustomerID, true
+    case events.OrderConfirmedEvent:
+        return e.CustomerID, true
+    case events.OrderShippedEvent:
+        return e.CustomerID, true
+    case events.OrderDeliveredEvent:
+        return e.CustomerID, true
+    case events.OrderCancelledEvent:
+        return e.CustomerID, true
+    case events.OrderReopenedEvent:
+        return e.CustomerID, true
+    case events.OrderHeldEvent:
+        return e.CustomerID, true
+    case events.OrderReleasedEvent:
+        return e.CustomerID, true
+    case events.OrderCustomerReassignedEvent:
+        return e.CustomerID, true
+    case events.OrderItemAddedEvent, events.OrderItemRemovedEvent,
+        events.OrderItemQuantityChangedEvent, events.OrderShippingAddressChangedEvent:
+        return "", true
+    default:
+        return "", false
+    }
+}
+
+// schedule queues job once the window has passed, unless a refresh of the
+// same reads is already pending. Refreshes whose customer is not known yet
+// are only merged with those of the same order.
+func (r *CustomerCacheRefresher) schedule(job *cacheRefresh) {
+    job.key = job.name + "/customer/" + job.customerID
+    if job.customerID == "" {
+        job.key = job.name + "/order/" + job.orderID
+    }
+    
+    r.mu.Lock()
+    if pending, ok := r.pending[job.key]; ok {
+        if pending.running {
+            pending.again = true
+        }
+        r.mu.Unlock()
+        cacheRefreshStats.Add("merged", 1)
+        return
+    }
+    r.pending[job.key] = job
+    r.mu.Unlock()
+    
+    cacheRefreshStats.Add("scheduled", 1)
+    time.AfterFunc(r.window, func() { r.enqueue(job) })
+}
+
+func (r *CustomerCacheRefresher) enqueue(job *cacheRefresh) {
+    select {
+    case r.queue <- job:
+    default:
+        r.mu.Lock()
+        delete(r.pending, job.key)
+        r.mu.Unlock()
+        cacheRefreshStats.Add("dropped", 1)
+    }
+}
+
+// Run refreshes queued reads on the worker pool until ctx is done.
+func (r *CustomerCacheRefresher) Run(ctx context.Context) error {
+    var wg sync.WaitGroup
+    for i := 0; i < r.workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-ctx.Done():
+                    return
+                case job := <-r.queue:
+                    r.run(ctx, job)
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    return ctx.Err()
+}
+
+// run refreshes job, and schedules it again when its reads changed in the
+// meantime.
+func (r *CustomerCacheRefresher) run(ctx context.Context, job *cacheRefresh) {
+    r.mu.Lock()
+    job.running = true
+    r.mu.Unlock()
+    
+    if err := r.refresh(ctx, job); err != nil {
+        cacheRefreshStats.Add("errors", 1)
+        log.Printf("Error refreshing %s cache after order %s: %v", job.name, job.orderID, err)
+    } else {
+        cacheRefreshStats.Add("refreshed", 1)
+    }
+    
+    r.mu.Lock()
+    again := job.again
+    job.running, job.again = false, false
+    if !again {
+        delete(r.pending, job.key)
+    }
+    r.mu.Unlock()
+    
+    if again {
+        time.AfterFunc(r.window, func() { r.enqueue(job) })
+    }
+}
+
+func (r *CustomerCacheRefresher) refresh(ctx context.Context, job *cacheRefresh) error {
+    customerID := job.customerID
+    if customerID == "" {
+        if r.lookupCustomer == nil {
+            return nil
+        }
+        var err error
+        if customerID, err = r.lookupCustomer(ctx, job.orderID); err != nil {
+            return err
+        }
+    }
+    // Guest checkouts have no customer whose reads are cached
+    if customerID == "" {
+        return nil
+    }
+    return job.refresh(ctx, customerID)
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// refreshRecorder is a CacheRefreshFunc recording the customers it
+// refreshed, failing with err when set.
+type refreshRecorder struct {
+    mu        sync.Mutex
+    customers []string
+    err       error
+}
+
+func (r *refreshRecorder) refresh(_ context.Context, customerID string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.customers = append(r.customers, customerID)
+    return r.err
+}
+
+func (r *refreshRecorder) refreshed() []string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    customers := append([]string(nil), r.customers...)
+    sort.Strings(customers)
+    return customers
+}
+
+func cacheRefreshStat(name string) int64 {
+    if v, ok := cacheRefreshStats.Get(name).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
+
+// waitForCacheRefreshStat waits until the stat name grew by want from
+// before.
+func waitForCacheRefreshStat(t *testing.T, name string, before, want int64) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for cacheRefreshStat(name)-before < want {
+        if time.Now().After(deadline) {
+            t.Fatalf("%s grew by %d, want %d", name, cacheRefreshStat(name)-before, want)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func newCustomerOrder(t *testing.T, customerID string) *entities.Order {
+    t.Helper()
+    order, err := entities.NewOrder(customerID, "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    return order
+}
+
+func noProjection(context.Context, events.DomainEvent) error { return nil }
+
+// Each order event schedules a refresh of its customer's reads, only for
+// the event types given; a reassignment refreshes both customers, and
+// events without a customer wait for it to be looked up from the order.
+func TestCustomerCacheRefresher_Decorate(t *testing.T) {
+    customerID, previousID := uuid.NewString(), uuid.NewString()
+    order := newCustomerOrder(t, customerID)
+    
+    tests := []struct {
+        name       string
+        eventTypes []string
+        event      events.DomainEvent
+        want       []string
+    }{
+        {name: "created", event: events.NewOrderCreatedEvent(order), want: []string{"orders/customer/" + customerID}},
+        {name: "confirmed", event: events.NewOrderConfirmedEvent(order), want: []string{"orders/customer/" + customerID}},
+        {name: "type not refreshed", eventTypes: []string{"OrderCreated"}, event: events.NewOrderConfirmedEvent(order)},
+        {name: "type refreshed", eventTypes: []string{"OrderCreated"}, event: events.NewOrderCreatedEvent(order), want: []string{"orders/customer/" + customerID}},
+        {name: "reassigned", event: events.NewOrderCustomerReassignedEvent(order, previousID), want: []string{"orders/customer/" + customerID, "orders/customer/" + previousID}},
+        {name: "item added", event: events.NewOrderItemAddedEvent(order, "product-1", 1, valueobjects.NewMoney(1000, "USD")), want: []string{"orders/order/" + string(order.ID)}},
+        {name: "not an order event", event: events.NewCustomerFirstOrderEvent(customerID, string(order.ID))},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // The window outlasts the test, so refreshes stay pending
+            refresher := NewCustomerCacheRefresher(1, time.Hour, 0, nil)
+            handler := refresher.Decorate("orders", noProjection, (&refreshRecorder{}).refresh, tt.eventTypes...)
+            if err := handler(context.Background(), tt.event); err != nil {
+                t.Fatalf("handler() = %v", err)
+            }
+            
+            var keys []string
+            for key := range refresher.pending {
+                keys = append(keys, key)
+            }
+            sort.Strings(keys)
+            sort.Strings(tt.want)
+            if !reflect.DeepEqual(keys, tt.want) {
+                t.Errorf("pending refreshes = %v, want %v", keys, tt.want)
+            }
+        })
+    }
+}
+
+// Events of one customer within the window are refreshed once, and the
+// refreshes run on the workers.
+func TestCustomerCacheRefresher_merges(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    refresher := NewCustomerCacheRefresher(2, 20*time.Millisecond, 0, nil)
+    go refresher.Run(ctx)
+    recorder := &refreshRecorder{}
+    handler := refresher.Decorate("orders", noProjection, recorder.refresh)
+    
+    busy, quiet := newCustomerOrder(t, uuid.NewString()), newCustomerOrder(t, uuid.NewString())
+    merged, refreshed := cacheRefreshStat("merged"), cacheRefreshStat("refreshed")
+    for _, event := range []events.DomainEvent{
+        events.NewOrderCreatedEvent(busy),
+        events.NewOrderConfirmedEvent(busy),
+        events.NewOrderCreatedEvent(quiet),
+        events.NewOrderShippedEvent(busy),
+    } {
+        if err := handler(ctx, event); err != nil {
+            t.Fatalf("handler(%s) = %v", event.Type(), err)
+        }
+    }
+    waitForCacheRefreshStat(t, "refreshed", refreshed, 2)
+    
+    want := []string{busy.CustomerID, quiet.CustomerID}
+    sort.Strings(want)
+    if got := recorder.refreshed(); !reflect.DeepEqual(got, want) {
+        t.Errorf("refreshed customers = %v, want %v", got, want)
+    }
+    if got := cacheRefreshStat("merged") - merged; got != 2 {
+        t.Errorf("merged = %d, want 2", got)
+    }
+    
+    // A later event is a new refresh, not merged into the finished one
+    if err := handler(ctx, events.NewOrderConfirmedEvent(busy)); err != nil {
+        t.Fatalf("handler() = %v", err)
+    }
+    waitForCacheRefreshStat(t, "refreshed", refreshed, 3)
+}
+
+// A failing refresh is counted and logged but leaves the projection's
+// result alone, and a failing projection schedules no refresh.
+func TestCustomerCacheRefresher_errors(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    refresher := NewCustomerCacheRefresher(1, time.Millisecond, 0, nil)
+    go refresher.Run(ctx)
+    recorder := &refreshRecorder{err: errors.New("redis unavailable")}
+    order := newCustomerOrder(t, uuid.NewString())
+    
+    failures := cacheRefreshStat("errors")
+    handler := refresher.Decorate("orders", noProjection, recorder.refresh)
+    if err := handler(ctx, events.NewOrderCreatedEvent(order)); err != nil {
+        t.Fatalf("handler() with a failing refresh = %v, want nil", err)
+    }
+    waitForCacheRefreshStat(t, "errors", failures, 1)
+    
+    errProjection := errors.New("database unavailable")
+    failing := refresher.Decorate("failing", func(context.Context, events.DomainEvent) error { return errProjection }, recorder.refresh)
+    if err := failing(ctx, events.NewOrderCreatedEvent(order)); !errors.Is(err, errProjection) {
+        t.Errorf("handler() with a failing projection = %v, want %v", err, errProjection)
+    }
+    refresher.mu.Lock()
+    defer refresher.mu.Unlock()
+    if _, ok := refresher.pending["failing/customer/"+order.CustomerID]; ok {
+        t.Error("a failing projection scheduled a refresh")
+    }
+}
+
+// Refreshes that find the queue full are dropped.
+func TestCustomerCacheRefresher_dropsWhenFull(t *testing.T) {
+    refresher := NewCustomerCacheRefresher(1, time.Millisecond, 1, nil)
+    handler := refresher.Decorate("orders", noProjection, (&refreshRecorder{}).refresh)
+    
+    dropped := cacheRefreshStat("dropped")
+    for i := 0; i < 3; i++ {
+        if err := handler(context.Background(), events.NewOrderCreatedEvent(newCustomerOrder(t, uuid.NewString()))); err != nil {
+            t.Fatalf("handler() = %v", err)
+        }
+    }
+    waitForCacheRefreshStat(t, "dropped", dropped, 2)
+    if len(refresher.queue) != 1 {
+        t.Errorf("queued %d refreshes, want 1", len(refresher.queue))
+    }
+}
+
+// The customer of events that do not carry it is looked up from the order;
+// guest orders have no reads to refresh.
+func TestCustomerCacheRefresher_lookup(t *testing.T) {
+    customerID := uuid.NewString()
+    customers := map[string]string{"order-1": customerID, "guest-order": ""}
+    lookup := func(_ context.Context, orderID string) (string, error) {
+        customerID, ok := customers[orderID]
+        if !ok {
+            return "", errors.New("order not found")
+        }
+        return customerID, nil
+    }
+    refresher := NewCustomerCacheRefresher(1, time.Hour, 0, lookup)
+    
+    tests := []struct {
+        orderID string
+        want    []string
+        wantErr bool
+    }{
+        {orderID: "order-1", want: []string{customerID}},
+        {orderID: "guest-order"},
+        {orderID: "missing", wantErr: true},
+    }
+    for _, tt := range tests {
+        recorder := &refreshRecorder{}
+        err := refresher.refresh(context.Background(), &cacheRefresh{refresh: recorder.refresh, orderID: tt.orderID})
+        if (err != nil) != tt.wantErr {
+            t.Errorf("refresh(%s) = %v, want error %t", tt.orderID, err, tt.wantErr)
+        }
+        if got := recorder.refreshed(); len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+            t.Errorf("refresh(%s) refreshed %v, want %v", tt.orderID, got, tt.want)
+        }
+    }
+}
+
+// A nil refresher leaves the projection undecorated.
+func TestCustomerCacheRefresher_nil(t *testing.T) {
+    var refresher *CustomerCacheRefresher
+    errProjection := errors.New("projection failed")
+    handler := refresher.Decorate("orders", func(context.Context, events.DomainEvent) error { return errProjection }, nil)
+    if err := handler(context.Background(), events.NewOrderCreatedEvent(newCustomerOrder(t, uuid.NewString()))); !errors.Is(err, errProjection) {
+        t.Errorf("handler() = %v, want %v", err, errProjection)
+    }
+}
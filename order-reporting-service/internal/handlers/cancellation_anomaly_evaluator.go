@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// anomalyStats is published as the "order_cancellation_anomalies" expvar:
+// anomalies detected, breaches suppressed by the cooldown, recoveries and
+// evaluations that failed since start, with the last evaluation's rate and
+// baseline.
+var anomalyStats = expvar.NewMap("order_cancellation_anomalies")
+
+// Cancellation anomaly baselines
+const (
+    // BaselineStatic compares the rate with Threshold
+    BaselineStatic   = "static"
+    // BaselineTrailing compares the rate with Multiplier times the rate
+    // over TrailingPeriod before the window, never below Threshold
+    BaselineTrailing = "trailing"
+)
+
+// AnomalyEvaluation is the outcome of one evaluation.
+type AnomalyEvaluation struct {
+    Counts    readmodels.DecisionCountsDTO
+    Rate      float64
+    Baseline  float64
+    // Skipped is set when the window had fewer than MinDecisions decisions
+    Skipped   bool
+    Breached  bool
+    // Detected is set when the breach was recorded, and not suppressed by
+    // the cooldown
+    Detected  bool
+    // Recovered is how many anomalies the evaluation found recovered
+    Recovered int64
+}
+
+// CancellationAnomalyEvaluator periodically compares the share of orders
+// cancelled over the last Window with a baseline. A breach records an
+// anomaly and saves an OrderCancellationAnomalyDetectedEvent to the outbox
+// in the same transaction, unless an anomaly was detected within Cooldown
+// before; an evaluation within the baseline marks the anomalies recovered.
+type CancellationAnomalyEvaluator struct {
+    // Disabled makes Run return at once
+    Disabled       bool
+    ReadModel      readmodels.AnomalyReadModel
+    Outbox         outbox.Repository
+    Window         time.Duration
+    Interval       time.Duration
+    // Baseline is BaselineStatic or BaselineTrailing
+    Baseline       string
+    // Threshold is the rate breached with BaselineStatic, and the lowest
+    // baseline with BaselineTrailing
+    Threshold      float64
+    Multiplier     float64
+    TrailingPeriod time.Duration
+    // MinDecisions is how many orders must have been confirmed or
+    // cancelled in a window for its rate to be judged
+    MinDecisions   int64
+    Cooldown       time.Duration
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+}
+
+// Run evaluates once at start and then every Interval until ctx is done.
+func (e *CancellationAnomalyEvaluator) Run(ctx context.Context) error {
+    if e.Disabled {
+        return nil
+    }
+    
+    ticker := time.NewTicker(e.Interval)
+    defer ticker.Stop()
+    
+    for {
+        if evaluation, err := e.EvaluateOnce(ctx); err != nil {
+            log.Printf("Error evaluating cancellation rate: %v", err)
+        } else if evaluation.Detected {
+            log.Printf("Cancellation rate %.3f exceeds baseline %.3f over %d decisions", evaluation.Rate, evaluation.Baseline, evaluation.Counts.Decisions())
+        }
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// EvaluateOnce judges the window ending now.
+func (e *CancellationAnomalyEvaluator) EvaluateOnce(ctx context.Context) (*AnomalyEvaluation, error) {
+    evaluation, err := e.evaluate(ctx)
+    if err != nil {
+        anomalyStats.Add("errors", 1)
+    }
+    return evaluation, err
+}
+
+func (e *CancellationAnomalyEvaluator) evaluate(ctx context.Context) (*AnomalyEvaluation, error) {
+    now := clock.Now()
+    if e.Now != nil {
+        now = e.Now()
+    }
+    windowStart := now.Add(-e.Window)
+    
+    counts, err := e.ReadModel.CountDecisions(ctx, windowStart, now)
+    if err != nil {
+        return nil, err
+    }
+    evaluation := &AnomalyEvaluation{Counts: *counts, Rate: counts.CancellationRate()}
+    if counts.Decisions() < e.MinDecisions {
+        evaluation.Skipped = true
+        return evaluation, nil
+    }
+    
+    evaluation.Baseline, err = e.baseline(ctx, windowStart)
+    if err != nil {
+        return nil, err
+    }
+    setAnomalyGauge("rate", evaluation.Rate)
+    setAnomalyGauge("baseline", evaluation.Baseline)
+    
+    if evaluation.Rate <= evaluation.Baseline {
+        evaluation.Recovered, err = e.ReadModel.RecoverAnomalies(ctx, readmodels.AnomalyCancellationRate, now)
+        if err != nil {
+            return nil, err
+        }
+        anomalyStats.Add("recovered", evaluation.Recovered)
+        return evaluation, nil
+    }
+    
+    evaluation.Breached = true
+    anomaly := &readmodels.AnomalyDTO{
+        AnomalyType: readmodels.AnomalyCancellationRate,
+        DetectedAt:  apijson.NewTimestamp(now),
+        WindowStart: apijson.NewTimestamp(windowStart),
+        WindowEnd:   apijson.NewTimestamp(now),
+        Value:       evaluation.Rate,
+        Baseline:    evaluation.Baseline,
+        Count:       counts.Cancellations,
+        Total:       counts.Decisions(),
+    }
+    evaluation.Detected, err = e.ReadModel.RecordAnomaly(ctx, anomaly, e.Cooldown, func(tx *sql.Tx, anomaly *readmodels.AnomalyDTO) error {
+        event := events.NewOrderCancellationAnomalyDetectedEvent(anomaly.ID, windowStart, now, anomaly.Count, anomaly.Total, anomaly.Value, anomaly.Baseline)
+        return e.Outbox.SaveEventWithTx(ctx, tx, event)
+    })
+    if err != nil {
+        return nil, err
+    }
+    if evaluation.Detected {
+        anomalyStats.Add("detected", 1)
+    } else {
+        anomalyStats.Add("suppressed", 1)
+    }
+    return evaluation, nil
+}
+
+// baseline returns the rate above which the window ending now, starting at
+// windowStart, is anomalous.
+func (e *CancellationAnomalyEvaluator) baseline(ctx context.Context, windowStart time.Time) (float64, error) {
+    switch e.Baseline {
+    case BaselineStatic:
+        return e.Threshold, nil
+    case BaselineTrailing:
+        trailing, err := e.ReadModel.CountDecisions(ctx, windowStart.Add(-e.TrailingPeriod), windowStart)
+        if err != nil {
+            return 0, err
+        }
+        // Too few decisions to tell a usual rate from noise
+        if trailing.Decisions() < e.MinDecisions {
+            return e.Threshold, nil
+        }
+        if baseline := trailing.CancellationRate() * e.Multiplier; baseline > e.Threshold {
+            return baseline, nil
+        }
+        return e.Threshold, nil
+    default:
+        return 0, fmt.Errorf("unknown cancellation anomaly baseline %q", e.Baseline)
+    }
+}
+
+func setAnomalyGauge(key string, value float64) {
+    gauge := new(expvar.Float)
+    gauge.Set(value)
+    anomalyStats.Set(key, gauge)
+}
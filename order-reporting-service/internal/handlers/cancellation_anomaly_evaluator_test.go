@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// decision is an order confirmed or cancelled at a time.
+type decision struct {
+    at        time.Time
+    cancelled bool
+}
+
+// memoryAnomalies counts synthetic decisions and records anomalies in
+// memory, as the anomaly read model does.
+type memoryAnomalies struct {
+    readmodels.AnomalyReadModel
+    decisions []decision
+    anomalies []*readmodels.AnomalyDTO
+}
+
+// decide adds count decisions at at.
+func (m *memoryAnomalies) decide(at time.Time, count int, cancelled bool) {
+    for i := 0; i < count; i++ {
+        m.decisions = append(m.decisions, decision{at: at, cancelled: cancelled})
+    }
+}
+
+func (m *memoryAnomalies) CountDecisions(_ context.Context, from, to time.Time) (*readmodels.DecisionCountsDTO, error) {
+    counts := &readmodels.DecisionCountsDTO{}
+    for _, d := range m.decisions {
+        if d.at.Before(from) || !d.at.Before(to) {
+            continue
+        }
+        if d.cancelled {
+            counts.Cancellations++
+        } else {
+            counts.Confirmations++
+        }
+    }
+    return counts, nil
+}
+
+func (m *memoryAnomalies) RecordAnomaly(_ context.Context, anomaly *readmodels.AnomalyDTO, cooldown time.Duration, save func(*sql.Tx, *readmodels.AnomalyDTO) error) (bool, error) {
+    if n := len(m.anomalies); n > 0 && anomaly.DetectedAt.Time.Sub(m.anomalies[n-1].DetectedAt.Time) < cooldown {
+        return false, nil
+    }
+    anomaly.ID = int64(len(m.anomalies) + 1)
+    if err := save(nil, anomaly); err != nil {
+        return false, err
+    }
+    m.anomalies = append(m.anomalies, anomaly)
+    return true, nil
+}
+
+func (m *memoryAnomalies) RecoverAnomalies(_ context.Context, _ string, at time.Time) (int64, error) {
+    var recovered int64
+    for _, anomaly := range m.anomalies {
+        if anomaly.RecoveredAt == nil {
+            recoveredAt := apijson.NewTimestamp(at)
+            anomaly.RecoveredAt = &recoveredAt
+            recovered++
+        }
+    }
+    return recovered, nil
+}
+
+// anomalyOutbox keeps the events saved to it.
+type anomalyOutbox struct {
+    outbox.Repository
+    saved []events.DomainEvent
+}
+
+func (o *anomalyOutbox) SaveEventWithTx(_ context.Context, _ *sql.Tx, event events.DomainEvent) error {
+    o.saved = append(o.saved, event)
+    return nil
+}
+
+func anomalyStat(name string) int64 {
+    if v, ok := anomalyStats.Get(name).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
+
+// A cancellation spike is detected once and published, repeated breaches
+// within the cooldown are suppressed, a rate back within the baseline
+// recovers the anomaly, and a spike after the cooldown is detected again.
+func TestCancellationAnomalyEvaluator_breachCooldownRecovery(t *testing.T) {
+    ctx := context.Background()
+    start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    fake := clock.NewFake(start)
+    defer clock.Set(fake)()
+    
+    anomalies, out := &memoryAnomalies{}, &anomalyOutbox{}
+    evaluator := &CancellationAnomalyEvaluator{
+        ReadModel:    anomalies,
+        Outbox:       out,
+        Window:       time.Hour,
+        Baseline:     BaselineStatic,
+        Threshold:    0.2,
+        MinDecisions: 10,
+        Cooldown:     2 * time.Hour,
+        Now:          fake.Now,
+    }
+    anomalies.decide(start.Add(-5*time.Minute), 9, false)
+    anomalies.decide(start.Add(-5*time.Minute), 1, true)
+    
+    tests := []struct {
+        name          string
+        advance       time.Duration
+        decide        func()
+        wantRate      float64
+        wantBreached  bool
+        wantDetected  bool
+        wantRecovered int64
+        wantPublished int
+    }{
+        {
+            name:     "within the baseline",
+            wantRate: 0.1,
+        },
+        {
+            name:          "spike",
+            advance:       15 * time.Minute,
+            decide:        func() { anomalies.decide(start.Add(10*time.Minute), 5, true) },
+            wantRate:      0.4,
+            wantBreached:  true,
+            wantDetected:  true,
+            wantPublished: 1,
+        },
+        {
+            name:          "still breached within the cooldown",
+            advance:       30 * time.Minute,
+            wantRate:      0.4,
+            wantBreached:  true,
+            wantPublished: 1,
+        },
+        {
+            name:          "recovery",
+            advance:       10 * time.Minute,
+            decide:        func() { anomalies.decide(start.Add(50*time.Minute), 15, false) },
+            wantRate:      0.2,
+            wantRecovered: 1,
+            wantPublished: 1,
+        },
+        {
+            name:          "spike after the cooldown",
+            advance:       2 * time.Hour,
+            decide:        func() { anomalies.decide(start.Add(170*time.Minute), 10, true) },
+            wantRate:      1,
+            wantBreached:  true,
+            wantDetected:  true,
+            wantPublished: 2,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            fake.Advance(tt.advance)
+            if tt.decide != nil {
+                tt.decide()
+            }
+            detected, suppressed := anomalyStat("detected"), anomalyStat("suppressed")
+            
+            evaluation, err := evaluator.EvaluateOnce(ctx)
+            if err != nil {
+                t.Fatalf("EvaluateOnce() = %v", err)
+            }
+            if evaluation.Rate != tt.wantRate || evaluation.Baseline != 0.2 || evaluation.Skipped {
+                t.Errorf("EvaluateOnce() rate %v against %v, skipped %v, want %v against 0.2", evaluation.Rate, evaluation.Baseline, evaluation.Skipped, tt.wantRate)
+            }
+            if evaluation.Breached != tt.wantBreached || evaluation.Detected != tt.wantDetected || evaluation.Recovered != tt.wantRecovered {
+                t.Errorf("EvaluateOnce() = %+v, want breached %v, detected %v, recovered %d", evaluation, tt.wantBreached, tt.wantDetected, tt.wantRecovered)
+            }
+            if len(out.saved) != tt.wantPublished {
+                t.Errorf("published %d anomaly events, want %d", len(out.saved), tt.wantPublished)
+            }
+            
+            wantDetected, wantSuppressed := int64(0), int64(0)
+            if tt.wantDetected {
+                wantDetected = 1
+            } else if tt.wantBreached {
+                wantSuppressed = 1
+            }
+            if got := anomalyStat("detected") - detected; got != wantDetected {
+                t.Errorf("detected stat rose by %d, want %d", got, wantDetected)
+            }
+            if got := anomalyStat("suppressed") - suppressed; got != wantSuppressed {
+                t.Errorf("suppressed stat rose by %d, want %d", got, wantSuppressed)
+            }
+        })
+    }
+    
+    // The published event carries what the anomaly was measured over
+    event, ok := out.saved[0].(events.OrderCancellationAnomalyDetectedEvent)
+    if !ok {
+        t.Fatalf("published %T, want OrderCancellationAnomalyDetectedEvent", out.saved[0])
+    }
+    windowEnd := start.Add(15 * time.Minute)
+    if event.AnomalyID != 1 || event.Cancellations != 6 || event.Decisions != 15 || event.Rate != 0.4 || event.Baseline != 0.2 ||
+        !event.WindowStart.Equal(windowEnd.Add(-time.Hour)) || !event.WindowEnd.Equal(windowEnd) {
+        t.Errorf("published %+v, want anomaly 1 of 6 cancellations in 15 decisions over the hour to %s", event, windowEnd)
+    }
+    if event.AggregateID() != events.CancellationRateAggregateID {
+        t.Errorf("published event of aggregate %q, want %q", event.AggregateID(), events.CancellationRateAggregateID)
+    }
+    if len(anomalies.anomalies) != 2 || anomalies.anomalies[0].RecoveredAt == nil || anomalies.anomalies[1].RecoveredAt != nil {
+        t.Errorf("anomalies = %+v, want the first recovered and the second open", anomalies.anomalies)
+    }
+}
+
+// Windows with too few decisions are not judged, however high their rate.
+func TestCancellationAnomalyEvaluator_minDecisions(t *testing.T) {
+    now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    anomalies, out := &memoryAnomalies{}, &anomalyOutbox{}
+    anomalies.decide(now.Add(-time.Minute), 3, true)
+    evaluator := &CancellationAnomalyEvaluator{
+        ReadModel:    anomalies,
+        Outbox:       out,
+        Window:       time.Hour,
+        Baseline:     BaselineStatic,
+        Threshold:    0.2,
+        MinDecisions: 10,
+        Now:          func() time.Time { return now },
+    }
+    
+    evaluation, err := evaluator.EvaluateOnce(context.Background())
+    if err != nil {
+        t.Fatalf("EvaluateOnce() = %v", err)
+    }
+    if !evaluation.Skipped || evaluation.Breached || len(out.saved) != 0 || evaluation.Rate != 1 {
+        t.Errorf("EvaluateOnce() = %+v with %d events published, want the window skipped", evaluation, len(out.saved))
+    }
+}
+
+// The trailing baseline is the rate before the window times the
+// multiplier, never below the threshold, and the threshold alone while
+// the trailing period saw too few decisions.
+func TestCancellationAnomalyEvaluator_trailingBaseline(t *testing.T) {
+    now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    windowStart := now.Add(-time.Hour)
+    
+    tests := []struct {
+        name          string
+        confirmations int
+        cancellations int
+        baseline      string
+        want          float64
+        wantErr       bool
+    }{
+        {name: "trailing rate times the multiplier", confirmations: 16, cancellations: 4, baseline: BaselineTrailing, want: 0.4},
+        {name: "never below the threshold", confirmations: 19, cancellations: 1, baseline: BaselineTrailing, want: 0.15},
+        {name: "too few trailing decisions", confirmations: 2, cancellations: 2, baseline: BaselineTrailing, want: 0.15},
+        {name: "static", confirmations: 16, cancellations: 4, baseline: BaselineStatic, want: 0.15},
+        {name: "unknown", baseline: "median", wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            anomalies := &memoryAnomalies{}
+            // Decisions in the window itself do not move the baseline
+            anomalies.decide(now.Add(-time.Minute), 50, true)
+            anomalies.decide(windowStart.Add(-time.Hour), tt.confirmations, false)
+            anomalies.decide(windowStart.Add(-time.Hour), tt.cancellations, true)
+            // Nor do those before the trailing period
+            anomalies.decide(windowStart.Add(-48*time.Hour), 50, true)
+            evaluator := &CancellationAnomalyEvaluator{
+                ReadModel:      anomalies,
+                Baseline:       tt.baseline,
+                Threshold:      0.15,
+                Multiplier:     2,
+                TrailingPeriod: 24 * time.Hour,
+                MinDecisions:   10,
+            }
+            
+            got, err := evaluator.baseline(context.Background(), windowStart)
+            if (err != nil) != tt.wantErr || got != tt.want {
+                t.Errorf("baseline() = %v, %v, want %v, error %v", got, err, tt.want, tt.wantErr)
+            }
+        })
+    }
+}
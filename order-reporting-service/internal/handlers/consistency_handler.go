@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+const maxDiscrepanciesLimit = 1000
+
+// OrderTotalsConsistencyHandler reports read model orders whose total does
+// not match the sum of their items.
+type OrderTotalsConsistencyHandler struct {
+    ReadModel readmodels.OrderReadModel
+}
+
+func (h *OrderTotalsConsistencyHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 100}, maxDiscrepanciesLimit)
+    if err != nil {
+        pagination.WriteError(w, err)
+        return
+    }
+    
+    discrepancies, err := h.ReadModel.FindTotalDiscrepancies(r.Context(), page.Limit)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    response := map[string]interface{}{
+        "discrepancies": discrepancies,
+        "count":         len(discrepancies),
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
+
+// CorruptOrdersConsistencyHandler reports read model orders whose JSON
+// columns do not decode. It reads the whole table.
+type CorruptOrdersConsistencyHandler struct {
+    ReadModel readmodels.OrderReadModel
+}
+
+func (h *CorruptOrdersConsistencyHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 100}, maxDiscrepanciesLimit)
+    if err != nil {
+        pagination.WriteError(w, err)
+        return
+    }
+    
+    corrupt, err := h.ReadModel.FindCorruptOrders(r.Context(), page.Limit)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    response := map[string]interface{}{
+        "corrupt_orders": corrupt,
+        "count":          len(corrupt),
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+)
+
+// DefaultProjection is the projection the consumer endpoints act on when
+// the request names none.
+const DefaultProjection = "orders"
+
+// ProjectionsHandler reports each projection's progress, checkpoints and
+// lag.
+type ProjectionsHandler struct {
+    Consumer *EventConsumer
+}
+
+func (h *ProjectionsHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    apijson.Write(w, r, http.StatusOK, map[string]interface{}{"projections": h.Consumer.Status(r.Context())})
+}
+
+// ConsumerOffsetsHandler lists the committed and high-water offsets of the
+// partitions assigned to one projection's consumer on this instance, named
+// by the projection query parameter.
+type ConsumerOffsetsHandler struct {
+    Consumer *EventConsumer
+}
+
+func (h *ConsumerOffsetsHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    name := r.URL.Query().Get("projection")
+    if name == "" {
+        name = DefaultProjection
+    }
+    
+    _, controller, err := h.Consumer.offsetController(name)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if controller == nil {
+        http.Error(w, "the event bus does not expose consumer offsets", http.StatusNotImplemented)
+        return
+    }
+    
+    offsets, err := controller.Offsets(r.Context())
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadGateway)
+        return
+    }
+    
+    apijson.Write(w, r, http.StatusOK, map[string]interface{}{"projection": name, "partitions": offsets})
+}
+
+// ConsumerResetRequest is the body of POST /admin/consumer/reset.
+type ConsumerResetRequest struct {
+    // Projection defaults to DefaultProjection
+    Projection string                 `json:"projection"`
+    Topic      string                 `json:"topic"`
+    To         eventbus.ResetPosition `json:"to"`
+    Timestamp  time.Time              `json:"timestamp"`
+    // Truncate deletes what the replay rebuilds: everything when resetting
+    // to earliest, or what was created at or after the timestamp
+    Truncate   bool                   `json:"truncate"`
+}
+
+// ConsumerResetHandler moves one projection's consumer back to replay
+// events into its read model, for recovering from a projection bug. The
+// other projections keep their position. Truncating needs this instance to
+// own every partition of the topic, since the deleted rows may come from
+// any of them.
+type ConsumerResetHandler struct {
+    Consumer *EventConsumer
+}
+
+func (h *ConsumerResetHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    var req ConsumerResetRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    if req.Projection == "" {
+        req.Projection = DefaultProjection
+    }
+    
+    projection, controller, err := h.Consumer.offsetController(req.Projection)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if controller == nil {
+        http.Error(w, "the event bus does not support offset resets", http.StatusNotImplemented)
+        return
+    }
+    if req.Truncate && projection.Truncate == nil {
+        http.Error(w, "projection "+projection.Name+" cannot be truncated", http.StatusBadRequest)
+        return
+    }
+    
+    reset := eventbus.OffsetReset{
+        Topic:         req.Topic,
+        To:            req.To,
+        Timestamp:     req.Timestamp,
+        AllPartitions: req.Truncate,
+    }
+    if err := reset.Validate(); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    var truncated int64
+    var truncate func(ctx context.Context) error
+    if req.Truncate {
+        since := time.Time{}
+        if reset.To == eventbus.ResetToTimestamp {
+            since = reset.Timestamp
+        }
+        truncate = func(ctx context.Context) error {
+            var err error
+            truncated, err = projection.Truncate(ctx, since)
+            return err
+        }
+    }
+    
+    offsets, err := controller.ResetOffsets(r.Context(), reset, truncate)
+    if err != nil {
+        switch {
+        case errors.Is(err, eventbus.ErrPartitionsNotAssigned), errors.Is(err, eventbus.ErrNotConsuming):
+            http.Error(w, err.Error(), http.StatusConflict)
+        default:
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+        }
+        return
+    }
+    log.Printf("Projection %s reset on %s to %s, %d rows truncated", projection.Name, reset.Topic, reset.To, truncated)
+    
+    response := map[string]interface{}{
+        "projection": projection.Name,
+        "partitions": offsets,
+        "truncated":  truncated,
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
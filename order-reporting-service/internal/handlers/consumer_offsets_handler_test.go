@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+)
+
+// offsetBus is an event bus whose offsets can be reset. It records the
+// resets asked for and runs whilePaused as the Kafka bus does.
+type offsetBus struct {
+    eventbus.EventBus
+    offsets []eventbus.PartitionOffsets
+    err     error
+    resets  []eventbus.OffsetReset
+}
+
+func (b *offsetBus) Offsets(context.Context) ([]eventbus.PartitionOffsets, error) {
+    return b.offsets, nil
+}
+
+func (b *offsetBus) ResetOffsets(ctx context.Context, reset eventbus.OffsetReset, whilePaused func(ctx context.Context) error) ([]eventbus.PartitionOffsets, error) {
+    b.resets = append(b.resets, reset)
+    if b.err != nil {
+        return nil, b.err
+    }
+    if whilePaused != nil {
+        if err := whilePaused(ctx); err != nil {
+            return nil, err
+        }
+    }
+    return b.offsets, nil
+}
+
+func TestConsumerOffsetsHandler(t *testing.T) {
+    committed := int64(4)
+    bus := &offsetBus{offsets: []eventbus.PartitionOffsets{{Topic: eventbus.DefaultTopic, Committed: &committed, HighWatermark: 6, Lag: 2}}}
+    consumer, err := NewEventConsumer(bus, []Projection{{Name: DefaultProjection}})
+    if err != nil {
+        t.Fatalf("NewEventConsumer() = %v", err)
+    }
+    handler := &ConsumerOffsetsHandler{Consumer: consumer}
+    
+    recorder := httptest.NewRecorder()
+    handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/consumer/offsets", nil))
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+    }
+    var body struct {
+        Projection string                      `json:"projection"`
+        Partitions []eventbus.PartitionOffsets `json:"partitions"`
+    }
+    if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+        t.Fatalf("decoding body: %v", err)
+    }
+    if body.Projection != DefaultProjection || !reflect.DeepEqual(body.Partitions, bus.offsets) {
+        t.Errorf("body = %+v, want %s with %+v", body, DefaultProjection, bus.offsets)
+    }
+    
+    recorder = httptest.NewRecorder()
+    handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/consumer/offsets?projection=unknown", nil))
+    if recorder.Code != http.StatusNotFound {
+        t.Errorf("unknown projection status = %d, want 404", recorder.Code)
+    }
+}
+
+func TestConsumerResetHandler(t *testing.T) {
+    at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    
+    tests := []struct {
+        name          string
+        body          string
+        busErr        error
+        plainBus      bool
+        truncatable   bool
+        wantStatus    int
+        wantReset     *eventbus.OffsetReset
+        wantTruncated []time.Time
+    }{
+        {
+            name:       "earliest",
+            body:       `{"topic":"orders","to":"earliest"}`,
+            wantStatus: http.StatusOK,
+            wantReset:  &eventbus.OffsetReset{Topic: "orders", To: eventbus.ResetToEarliest},
+        },
+        {
+            name:          "timestamp with truncate",
+            body:          `{"topic":"orders","to":"timestamp","timestamp":"2024-03-01T12:00:00Z","truncate":true}`,
+            truncatable:   true,
+            wantStatus:    http.StatusOK,
+            wantReset:     &eventbus.OffsetReset{Topic: "orders", To: eventbus.ResetToTimestamp, Timestamp: at, AllPartitions: true},
+            wantTruncated: []time.Time{at},
+        },
+        {
+            name:          "earliest with truncate deletes everything",
+            body:          `{"topic":"orders","to":"earliest","truncate":true}`,
+            truncatable:   true,
+            wantStatus:    http.StatusOK,
+            wantReset:     &eventbus.OffsetReset{Topic: "orders", To: eventbus.ResetToEarliest, AllPartitions: true},
+            wantTruncated: []time.Time{{}},
+        },
+        {name: "truncate unsupported", body: `{"topic":"orders","to":"earliest","truncate":true}`, wantStatus: http.StatusBadRequest},
+        {name: "timestamp missing", body: `{"topic":"orders","to":"timestamp"}`, wantStatus: http.StatusBadRequest},
+        {name: "invalid JSON", body: `{`, wantStatus: http.StatusBadRequest},
+        {name: "unknown projection", body: `{"projection":"unknown","topic":"orders","to":"earliest"}`, wantStatus: http.StatusNotFound},
+        {name: "bus without offsets", body: `{"topic":"orders","to":"earliest"}`, plainBus: true, wantStatus: http.StatusNotImplemented},
+        {
+            name:       "partitions owned elsewhere",
+            body:       `{"topic":"orders","to":"earliest"}`,
+            busErr:     eventbus.ErrPartitionsNotAssigned,
+            wantStatus: http.StatusConflict,
+            wantReset:  &eventbus.OffsetReset{Topic: "orders", To: eventbus.ResetToEarliest},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bus := &offsetBus{err: tt.busErr, offsets: []eventbus.PartitionOffsets{}}
+            var truncated []time.Time
+            projection := Projection{Name: DefaultProjection}
+            if tt.truncatable {
+                projection.Truncate = func(_ context.Context, since time.Time) (int64, error) {
+                    truncated = append(truncated, since)
+                    return 3, nil
+                }
+            }
+            var eventBus eventbus.EventBus = bus
+            if tt.plainBus {
+                eventBus = eventbus.NewInMemoryEventBus(nil)
+            }
+            consumer, err := NewEventConsumer(eventBus, []Projection{projection})
+            if err != nil {
+                t.Fatalf("NewEventConsumer() = %v", err)
+            }
+            
+            recorder := httptest.NewRecorder()
+            handler := &ConsumerResetHandler{Consumer: consumer}
+            handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodPost, "/admin/consumer/reset", strings.NewReader(tt.body)))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            
+            var wantResets []eventbus.OffsetReset
+            if tt.wantReset != nil {
+                wantResets = []eventbus.OffsetReset{*tt.wantReset}
+            }
+            if !reflect.DeepEqual(bus.resets, wantResets) {
+                t.Errorf("resets = %+v, want %+v", bus.resets, wantResets)
+            }
+            if !reflect.DeepEqual(truncated, tt.wantTruncated) {
+                t.Errorf("truncated since %v, want %v", truncated, tt.wantTruncated)
+            }
+        })
+    }
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// mergeOrders keeps the orders the order projection creates and moves.
+type mergeOrders struct {
+    readmodels.OrderReadModel
+    orders map[string]readmodels.OrderDTO
+}
+
+func (m *mergeOrders) InsertOrder(_ context.Context, order *readmodels.OrderDTO) error {
+    if _, ok := m.orders[order.ID]; !ok {
+        m.orders[order.ID] = *order
+    }
+    return nil
+}
+
+func (m *mergeOrders) GetOrder(_ context.Context, orderID string) (*readmodels.OrderDTO, error) {
+    order, ok := m.orders[orderID]
+    if !ok {
+        return nil, readmodels.ErrOrderNotFound
+    }
+    return &order, nil
+}
+
+func (m *mergeOrders) SetCustomer(_ context.Context, orderID string, change readmodels.CustomerChange) error {
+    order := m.orders[orderID]
+    if order.Version >= change.Version {
+        return readmodels.ErrStaleVersion
+    }
+    order.CustomerID, order.Version = change.CustomerID, change.Version
+    m.orders[orderID] = order
+    return nil
+}
+
+// mergeCustomers keeps the orders recorded for each customer and the
+// summaries counted from them, as the customer read model does.
+type mergeCustomers struct {
+    readmodels.CustomerReadModel
+    customers map[string]*readmodels.CustomerDTO
+    // recorded maps each recorded order to its customer
+    recorded  map[string]string
+    summaries map[string]int64
+}
+
+func (m *mergeCustomers) RecordOrder(ctx context.Context, customerID, orderID string, _ time.Time, _ func(tx *sql.Tx) error) error {
+    if _, ok := m.recorded[orderID]; !ok {
+        m.recorded[orderID] = customerID
+    }
+    _, _, err := m.RefreshOrderSummary(ctx, customerID)
+    return err
+}
+
+func (m *mergeCustomers) ReassignOrder(_ context.Context, orderID, customerID string) error {
+    if _, ok := m.recorded[orderID]; ok {
+        m.recorded[orderID] = customerID
+    }
+    return nil
+}
+
+func (m *mergeCustomers) RefreshOrderSummary(_ context.Context, customerID string) (int64, int64, error) {
+    previous := m.summaries[customerID]
+    var count int64
+    for _, recordedFor := range m.recorded {
+        if recordedFor == customerID {
+            count++
+        }
+    }
+    m.summaries[customerID] = count
+    return previous, count, nil
+}
+
+func (m *mergeCustomers) MarkMerged(_ context.Context, customerID, targetID string, mergedAt time.Time) error {
+    if customer, ok := m.customers[customerID]; ok {
+        at := apijson.NewTimestamp(mergedAt)
+        customer.MergedInto, customer.MergedAt = targetID, &at
+    }
+    return nil
+}
+
+// The events of a merge, published over the bus as the management service
+// publishes them, move the source's orders to the target in the order read
+// model and the summaries and mark the source merged; delivered again, they
+// move nothing twice.
+func TestCustomerMerge_projections(t *testing.T) {
+    ctx := context.Background()
+    source, target := uuid.NewString(), uuid.NewString()
+    orders := &mergeOrders{orders: map[string]readmodels.OrderDTO{}}
+    customers := &mergeCustomers{
+        customers: map[string]*readmodels.CustomerDTO{source: {ID: source}, target: {ID: target}},
+        recorded:  map[string]string{},
+        summaries: map[string]int64{},
+    }
+    bus := eventbus.NewInMemoryEventBus(nil)
+    orderProjection := &OrderProjectionHandler{OrderReadModel: orders}
+    summaryProjection := &CustomerSummaryProjectionHandler{CustomerReadModel: customers}
+    // The bus only logs handler errors
+    failOnError := func(handle eventbus.Handler) eventbus.Handler {
+        return func(ctx context.Context, event events.DomainEvent) error {
+            if err := handle(ctx, event); err != nil {
+                t.Errorf("handling %s: %v", event.Type(), err)
+            }
+            return nil
+        }
+    }
+    if err := bus.Subscribe(ctx, []string{eventbus.DefaultTopic}, failOnError(orderProjection.Handle), eventbus.WithEventTypes(orderProjection.EventTypes()...)); err != nil {
+        t.Fatal(err)
+    }
+    if err := bus.Subscribe(ctx, []string{eventbus.DefaultTopic}, failOnError(summaryProjection.Handle), eventbus.WithEventTypes(summaryProjection.EventTypes()...)); err != nil {
+        t.Fatal(err)
+    }
+    publish := func(event events.DomainEvent) {
+        t.Helper()
+        if err := bus.Publish(ctx, event); err != nil {
+            t.Fatalf("Publish(%s) = %v", event.Type(), err)
+        }
+    }
+    
+    var sourceOrders []*entities.Order
+    for _, customerID := range []string{source, source, target} {
+        order, err := entities.NewOrder(customerID, "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+        if err != nil {
+            t.Fatal(err)
+        }
+        order.ID = entities.OrderID(uuid.NewString())
+        created := events.NewOrderCreatedEvent(order)
+        created.SequenceValue = 1
+        publish(created)
+        if customerID == source {
+            sourceOrders = append(sourceOrders, order)
+        }
+    }
+    if customers.summaries[source] != 2 || customers.summaries[target] != 1 {
+        t.Fatalf("summaries before the merge = %v, want 2 for the source and 1 for the target", customers.summaries)
+    }
+    
+    var merge []events.DomainEvent
+    for _, order := range sourceOrders {
+        if moved, err := order.ReassignCustomer(target); err != nil || !moved {
+            t.Fatalf("ReassignCustomer() = %t, %v", moved, err)
+        }
+        reassigned := events.NewOrderCustomerReassignedEvent(order, source)
+        reassigned.SequenceValue = 2
+        merge = append(merge, reassigned)
+    }
+    merge = append(merge, events.NewCustomerMergedEvent(source, target, len(sourceOrders)))
+    for delivery := 0; delivery < 2; delivery++ {
+        for _, event := range merge {
+            publish(event)
+        }
+    }
+    
+    if customers.summaries[source] != 0 || customers.summaries[target] != 3 {
+        t.Errorf("summaries after the merge = %v, want 0 for the source and 3 for the target", customers.summaries)
+    }
+    for id, order := range orders.orders {
+        if order.CustomerID != target {
+            t.Errorf("order %s is of customer %s, want %s", id, order.CustomerID, target)
+        }
+    }
+    for _, order := range sourceOrders {
+        if got := orders.orders[string(order.ID)].Version; got != 2 {
+            t.Errorf("order %s at version %d, want 2", order.ID, got)
+        }
+    }
+    if merged := customers.customers[source]; merged.MergedInto != target || merged.MergedAt == nil {
+        t.Errorf("source customer = %+v, want merged into %s", merged, target)
+    }
+    if customers.customers[target].MergedInto != "" {
+        t.Errorf("target customer = %+v, want it not merged", customers.customers[target])
+    }
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// CustomerOrderSummaryHandler returns how many orders a customer placed and
+// when, as counted by the customer summaries projection.
+type CustomerOrderSummaryHandler struct {
+    ReadModel readmodels.CustomerReadModel
+}
+
+func (h *CustomerOrderSummaryHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    customerID, err := entities.ParseCustomerID(mux.Vars(r)["id"])
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    summary, err := h.ReadModel.GetOrderSummary(r.Context(), string(customerID))
+    if errors.Is(err, readmodels.ErrOrderSummaryNotFound) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    apijson.Write(w, r, http.StatusOK, summary)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// CustomerSummaryProjectionHandler keeps customers' order summaries up to
+// date and derives a CustomerFirstOrderEvent for each customer's first
+// order. Orders reassigned by a customer merge move between the customers'
+// summaries, which derive no first order event, and merged customers are
+// marked with the customer they were merged into.
+type CustomerSummaryProjectionHandler struct {
+    CustomerReadModel readmodels.CustomerReadModel
+    Outbox            outbox.Repository
+}
+
+// EventTypes lists the events Handle applies.
+func (h *CustomerSummaryProjectionHandler) EventTypes() []string {
+    return []string{"OrderCreated", "OrderCustomerReassigned", "CustomerMerged"}
+}
+
+func (h *CustomerSummaryProjectionHandler) Handle(ctx context.Context, event events.DomainEvent) error {
+    switch e := event.(type) {
+    case events.OrderCustomerReassignedEvent:
+        return h.handleOrderCustomerReassigned(ctx, e)
+    case events.CustomerMergedEvent:
+        return h.CustomerReadModel.MarkMerged(ctx, e.AggregateID(), e.TargetCustomerID, e.OccurredAt())
+    }
+    
+    created, ok := event.(events.OrderCreatedEvent)
+    // Guest checkouts have no customer to summarise
+    if !ok || created.CustomerID == "" {
+        return nil
+    }
+    
+    // The first order event is saved in the summary's transaction, so a
+    // redelivery after a failed save derives it again
+    var firstOrder func(tx *sql.Tx) error
+    if h.Outbox != nil {
+        firstOrder = func(tx *sql.Tx) error {
+            return h.Outbox.SaveEventWithOptions(ctx, events.NewCustomerFirstOrderEvent(created.CustomerID, created.AggregateID()), outbox.SaveOptions{Tx: tx})
+        }
+    }
+    return h.CustomerReadModel.RecordOrder(ctx, created.CustomerID, created.AggregateID(), created.OccurredAt(), firstOrder)
+}
+
+// handleOrderCustomerReassigned moves the order to its new customer and
+// recounts both summaries, which a redelivered event leaves unchanged.
+func (h *CustomerSummaryProjectionHandler) handleOrderCustomerReassigned(ctx context.Context, event events.OrderCustomerReassignedEvent) error {
+    if err := h.CustomerReadModel.ReassignOrder(ctx, event.AggregateID(), event.CustomerID); err != nil {
+        return err
+    }
+    
+    for _, customerID := range []string{event.PreviousCustomerID, event.CustomerID} {
+        if _, _, err := h.CustomerReadModel.RefreshOrderSummary(ctx, customerID); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+)
+
+const maxDryRunLimit = 1000
+
+// ProjectionDryRunHandler lists the writes a dry-run projection recorded,
+// newest first. With compare=true each write is checked against the live
+// read model, to see whether the new projection version agrees with the
+// one in service.
+type ProjectionDryRunHandler struct {
+    Consumer *EventConsumer
+}
+
+func (h *ProjectionDryRunHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    name := mux.Vars(r)["name"]
+    
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 100}, maxDryRunLimit)
+    if err != nil {
+        pagination.WriteError(w, err)
+        return
+    }
+    
+    compare := false
+    if value := r.URL.Query().Get("compare"); value != "" {
+        compare, err = strconv.ParseBool(value)
+        if err != nil {
+            http.Error(w, "compare must be true or false", http.StatusBadRequest)
+            return
+        }
+    }
+    
+    dryRun, err := h.Consumer.dryRun(name)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if dryRun == nil {
+        http.Error(w, "projection "+name+" is not running in dry-run mode", http.StatusConflict)
+        return
+    }
+    
+    if !compare {
+        mutations := dryRun.Mutations(page.Limit)
+        apijson.Write(w, r, http.StatusOK, map[string]interface{}{
+            "projection": name,
+            "mutations":  mutations,
+            "count":      len(mutations),
+        })
+        return
+    }
+    
+    comparisons, err := dryRun.Compare(r.Context(), page.Limit)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    mismatched := 0
+    for _, comparison := range comparisons {
+        if !comparison.Matches && !comparison.Superseded && comparison.OrderID != "" {
+            mismatched++
+        }
+    }
+    apijson.Write(w, r, http.StatusOK, map[string]interface{}{
+        "projection": name,
+        "mutations":  comparisons,
+        "count":      len(comparisons),
+        "mismatched": mismatched,
+    })
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// readOnlyOrders finds no orders; a write reaching it calls the nil
+// embedded OrderReadModel and panics.
+type readOnlyOrders struct {
+    readmodels.OrderReadModel
+}
+
+func (readOnlyOrders) GetOrder(context.Context, string) (*readmodels.OrderDTO, error) {
+    return nil, readmodels.ErrOrderNotFound
+}
+
+// A canary projection records the writes of the events it handles without
+// applying them, and the endpoint lists them and compares them with the
+// live read model.
+func TestProjectionDryRunHandler(t *testing.T) {
+    dryRun := readmodels.NewDryRunOrderReadModel(readOnlyOrders{}, 0)
+    canary := &OrderProjectionHandler{OrderReadModel: dryRun}
+    consumer, err := NewEventConsumer(eventbus.NewInMemoryEventBus(nil), []Projection{
+        {Name: DefaultProjection},
+        {Name: "orders-canary", Handler: canary.Handle, DryRun: dryRun},
+    })
+    if err != nil {
+        t.Fatalf("NewEventConsumer() = %v", err)
+    }
+    
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    if err := canary.Handle(context.Background(), events.NewOrderCreatedEvent(order)); err != nil {
+        t.Fatalf("Handle() = %v", err)
+    }
+    
+    handler := &ProjectionDryRunHandler{Consumer: consumer}
+    serve := func(name, query string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, "/admin/projections/"+name+"/dry-run?"+query, nil)
+        recorder := httptest.NewRecorder()
+        handler.HandleHTTP(recorder, mux.SetURLVars(req, map[string]string{"name": name}))
+        return recorder
+    }
+    
+    recorder := serve("orders-canary", "")
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+    }
+    var listed struct {
+        Count     int                         `json:"count"`
+        Mutations []readmodels.DryRunMutation `json:"mutations"`
+    }
+    if err := json.NewDecoder(recorder.Body).Decode(&listed); err != nil {
+        t.Fatalf("decoding body: %v", err)
+    }
+    if listed.Count != 1 || listed.Mutations[0].OrderID != string(order.ID) || listed.Mutations[0].Fields["status"] != order.Status.String() {
+        t.Errorf("mutations = %+v, want the insert of order %s", listed.Mutations, order.ID)
+    }
+    
+    recorder = serve("orders-canary", "compare=true")
+    var compared struct {
+        Count      int                           `json:"count"`
+        Mismatched int                           `json:"mismatched"`
+        Mutations  []readmodels.DryRunComparison `json:"mutations"`
+    }
+    if err := json.NewDecoder(recorder.Body).Decode(&compared); err != nil {
+        t.Fatalf("decoding body: %v", err)
+    }
+    if compared.Count != 1 || compared.Mismatched != 1 || !compared.Mutations[0].LiveMissing {
+        t.Errorf("comparison = %+v, want one mismatch missing from the live read model", compared)
+    }
+    
+    tests := []struct {
+        name       string
+        query      string
+        wantStatus int
+    }{
+        {name: DefaultProjection, wantStatus: http.StatusConflict},
+        {name: "unknown", wantStatus: http.StatusNotFound},
+        {name: "orders-canary", query: "compare=maybe", wantStatus: http.StatusBadRequest},
+        {name: "orders-canary", query: "limit=1001", wantStatus: http.StatusBadRequest},
+    }
+    for _, tt := range tests {
+        if recorder := serve(tt.name, tt.query); recorder.Code != tt.wantStatus {
+            t.Errorf("%s?%s status = %d, want %d", tt.name, tt.query, recorder.Code, tt.wantStatus)
+        }
+    }
+}
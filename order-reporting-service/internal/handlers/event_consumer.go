@@ -2,33 +2,273 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
 	"github.com/vdntruong/dddcqrs/shared/domain/events"
 	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/logredact"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
 )
 
+// ErrUnknownProjection is returned for a projection name the consumer does
+// not run.
+var ErrUnknownProjection = errors.New("unknown projection")
+
+// Projection is a read model kept up to date from events by its own
+// subscription, so it progresses, fails and is replayed independently of
+// the other projections.
+type Projection struct {
+    // Name identifies the projection in logs, status reports and resets
+    Name string
+    // Group is the consumer group the projection consumes as; empty uses
+    // the event bus's own group
+    Group   string
+    Topics  []string
+    Handler eventbus.Handler
+    // EventTypes are the event types Handler applies; the bus skips the
+    // others, without decoding those that name their type in a header.
+    // Empty passes every event
+    EventTypes []string
+    // Truncate deletes what replaying the events published since a time
+    // rebuilds, for consumer resets; nil if the projection has nothing
+    // to delete
+    Truncate func(ctx context.Context, since time.Time) (int64, error)
+    // DryRun is set for a projection trying out a new version of the order
+    // projection against live traffic: its handler writes to DryRun, which
+    // records the writes instead of applying them
+    DryRun *readmodels.DryRunOrderReadModel
+    // Strict dead letters events of types the registry does not know
+    // instead of skipping them
+    Strict bool
+    // StrictFunc, when set, reports Strict for each message instead, so it
+    // can be switched while the projection runs
+    StrictFunc func() bool
+}
+
+// ProjectionStatus reports a projection's progress since the process
+// started, and its partitions' checkpoints and lag when the event bus
+// exposes them.
+type ProjectionStatus struct {
+    Name            string                      `json:"name"`
+    Group           string                      `json:"group,omitempty"`
+    Topics          []string                    `json:"topics"`
+    EventTypes      []string                    `json:"event_types,omitempty"`
+    DryRun          bool                        `json:"dry_run,omitempty"`
+    Processed       int64                       `json:"processed"`
+    Failed          int64                       `json:"failed"`
+    LastProcessedAt *time.Time                  `json:"last_processed_at,omitempty"`
+    LastError       string                      `json:"last_error,omitempty"`
+    Lag             *int64                      `json:"lag,omitempty"`
+    Partitions      []eventbus.PartitionOffsets `json:"partitions,omitempty"`
+    OffsetsError    string                      `json:"offsets_error,omitempty"`
+}
+
+// EventConsumer runs each projection on a bus of its own group, obtained
+// from the event bus with ForGroup. Event buses that are not an
+// eventbus.GroupedEventBus, such as the in-memory one, subscribe every
+// projection separately on the shared bus.
 type EventConsumer struct {
-    ProjectionHandler *OrderProjectionHandler
-    EventBus         eventbus.EventBus
+    consumers []*projectionConsumer
 }
 
-func (ec *EventConsumer) Start(ctx context.Context) error {
-    topic := "orders"
+type projectionConsumer struct {
+    projection Projection
+    bus        eventbus.EventBus
+    // ownsBus is set when bus came from ForGroup and is closed with the
+    // consumer
+    ownsBus    bool
     
-    log.Printf("Starting event consumer for topic: %s", topic)
+    processed atomic.Int64
+    failed    atomic.Int64
     
-    return ec.EventBus.Subscribe(ctx, topic, ec.handleEvent)
+    mu              sync.Mutex
+    lastProcessedAt time.Time
+    lastError       string
+}
+
+func NewEventConsumer(bus eventbus.EventBus, projections []Projection) (*EventConsumer, error) {
+    ec := &EventConsumer{}
+    grouped, _ := bus.(eventbus.GroupedEventBus)
+    
+    for _, projection := range projections {
+        if ec.find(projection.Name) != nil {
+            ec.Close()
+            return nil, fmt.Errorf("projection %s is registered twice", projection.Name)
+        }
+        
+        consumer := &projectionConsumer{projection: projection, bus: bus}
+        if projection.Group != "" && grouped != nil {
+            groupBus, err := grouped.ForGroup(projection.Group)
+            if err != nil {
+                ec.Close()
+                return nil, fmt.Errorf("failed to create consumer for projection %s: %w", projection.Name, err)
+            }
+            consumer.bus = groupBus
+            consumer.ownsBus = true
+        }
+        ec.consumers = append(ec.consumers, consumer)
+    }
+    
+    return ec, nil
+}
+
+// Start subscribes every projection, with opts added to each
+// subscription. A projection that fails to subscribe does not stop the
+// others from starting.
+func (ec *EventConsumer) Start(ctx context.Context, opts ...eventbus.SubscribeOption) error {
+    var errs []error
+    for _, consumer := range ec.consumers {
+        projection := consumer.projection
+        log.Printf("Starting projection %s for topics: %v", projection.Name, projection.Topics)
+        
+        subscribeOpts := append([]eventbus.SubscribeOption{eventbus.WithEventTypes(projection.EventTypes...)}, opts...)
+        switch {
+        case projection.StrictFunc != nil:
+            subscribeOpts = append(subscribeOpts, eventbus.WithStrictEventTypesFunc(projection.StrictFunc))
+        case projection.Strict:
+            subscribeOpts = append(subscribeOpts, eventbus.WithStrictEventTypes())
+        }
+        err := consumer.bus.Subscribe(ctx, projection.Topics, consumer.handleEvent, subscribeOpts...)
+        if err != nil {
+            errs = append(errs, fmt.Errorf("projection %s: %w", projection.Name, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// Status reports every projection, in the order they were registered.
+func (ec *EventConsumer) Status(ctx context.Context) []ProjectionStatus {
+    statuses := make([]ProjectionStatus, len(ec.consumers))
+    for i, consumer := range ec.consumers {
+        statuses[i] = consumer.status(ctx)
+    }
+    return statuses
+}
+
+// Drain waits for the projections' subscriptions to stop, with the events
+// they were handling finished, or until ctx is done. Cancel the context
+// Start was given first. Event buses that are not an eventbus.Drainer are
+// not waited for.
+func (ec *EventConsumer) Drain(ctx context.Context) error {
+    drained := make(map[eventbus.EventBus]bool)
+    for _, consumer := range ec.consumers {
+        drainer, ok := consumer.bus.(eventbus.Drainer)
+        if !ok || drained[consumer.bus] {
+            continue
+        }
+        drained[consumer.bus] = true
+        if err := drainer.Drain(ctx); err != nil {
+            return fmt.Errorf("projection %s did not stop: %w", consumer.projection.Name, err)
+        }
+    }
+    return nil
+}
+
+// Close closes the buses created for the projections' groups. The shared
+// event bus is left to its owner.
+func (ec *EventConsumer) Close() error {
+    var errs []error
+    for _, consumer := range ec.consumers {
+        if consumer.ownsBus {
+            errs = append(errs, consumer.bus.Close())
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// offsetController returns the named projection and the offset controller
+// of its bus, nil if the bus has none.
+func (ec *EventConsumer) offsetController(name string) (*Projection, eventbus.OffsetController, error) {
+    consumer := ec.find(name)
+    if consumer == nil {
+        return nil, nil, fmt.Errorf("%w: %s", ErrUnknownProjection, name)
+    }
+    controller, _ := consumer.bus.(eventbus.OffsetController)
+    return &consumer.projection, controller, nil
+}
+
+// dryRun returns the dry-run read model of the named projection, nil if it
+// writes for real.
+func (ec *EventConsumer) dryRun(name string) (*readmodels.DryRunOrderReadModel, error) {
+    consumer := ec.find(name)
+    if consumer == nil {
+        return nil, fmt.Errorf("%w: %s", ErrUnknownProjection, name)
+    }
+    return consumer.projection.DryRun, nil
+}
+
+func (ec *EventConsumer) find(name string) *projectionConsumer {
+    for _, consumer := range ec.consumers {
+        if consumer.projection.Name == name {
+            return consumer
+        }
+    }
+    return nil
 }
 
-func (ec *EventConsumer) handleEvent(event events.DomainEvent) error {
-    log.Printf("Processing event: %s for aggregate: %s", event.Type(), event.AggregateID())
+func (pc *projectionConsumer) handleEvent(ctx context.Context, event events.DomainEvent) error {
+    name := pc.projection.Name
+    log.Printf("Projection %s processing event: %s for aggregate: %s", name, event.Type(), event.AggregateID())
+    if logredact.PayloadLogging() {
+        log.Printf("Projection %s event payload: %s", name, logredact.Value(event))
+    }
     
-    if err := ec.ProjectionHandler.Handle(context.Background(), event); err != nil {
-        log.Printf("Error processing event %s: %v", event.Type(), err)
+    if err := pc.projection.Handler(ctx, event); err != nil {
+        log.Printf("Projection %s failed to process event %s: %v", name, event.Type(), err)
+        pc.failed.Add(1)
+        pc.mu.Lock()
+        pc.lastError = err.Error()
+        pc.mu.Unlock()
         return err
     }
     
-    log.Printf("Successfully processed event: %s", event.Type())
+    pc.processed.Add(1)
+    pc.mu.Lock()
+    pc.lastProcessedAt = clock.Now().UTC()
+    pc.mu.Unlock()
     return nil
 }
+
+func (pc *projectionConsumer) status(ctx context.Context) ProjectionStatus {
+    status := ProjectionStatus{
+        Name:       pc.projection.Name,
+        Group:      pc.projection.Group,
+        Topics:     pc.projection.Topics,
+        EventTypes: pc.projection.EventTypes,
+        DryRun:     pc.projection.DryRun != nil,
+        Processed:  pc.processed.Load(),
+        Failed:     pc.failed.Load(),
+    }
+    
+    pc.mu.Lock()
+    if !pc.lastProcessedAt.IsZero() {
+        lastProcessedAt := pc.lastProcessedAt
+        status.LastProcessedAt = &lastProcessedAt
+    }
+    status.LastError = pc.lastError
+    pc.mu.Unlock()
+    
+    controller, ok := pc.bus.(eventbus.OffsetController)
+    if !ok {
+        return status
+    }
+    offsets, err := controller.Offsets(ctx)
+    if err != nil {
+        status.OffsetsError = err.Error()
+        return status
+    }
+    
+    var lag int64
+    for _, partition := range offsets {
+        lag += partition.Lag
+    }
+    status.Lag = &lag
+    status.Partitions = offsets
+    return status
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+)
+
+// A projection whose handler keeps failing is redelivered the same event in
+// its own group, while a projection in another group consumes every event
+// and reports no lag.
+func TestEventConsumer_failingProjectionDoesNotStallOthers(t *testing.T) {
+    cluster, err := kafka.NewMockCluster(1)
+    if err != nil {
+        t.Skipf("mock Kafka cluster unavailable: %v", err)
+    }
+    defer cluster.Close()
+    if err := cluster.CreateTopic(eventbus.DefaultTopic, 1, 1); err != nil {
+        t.Fatalf("CreateTopic() = %v", err)
+    }
+    bus := eventbus.NewKafkaEventBus(cluster.BootstrapServers(), eventbus.WithGroupID("order-reporting-service"))
+    defer bus.Close()
+    
+    handled := make(chan string, 10)
+    consumer, err := NewEventConsumer(bus, []Projection{
+        {
+            Name:    "broken",
+            Group:   "order-reporting-service-broken",
+            Topics:  []string{eventbus.DefaultTopic},
+            Handler: func(context.Context, events.DomainEvent) error { return errors.New("projection bug") },
+        },
+        {
+            Name:   DefaultProjection,
+            Group:  "order-reporting-service-orders",
+            Topics: []string{eventbus.DefaultTopic},
+            Handler: func(_ context.Context, event events.DomainEvent) error {
+                handled <- event.EventID()
+                return nil
+            },
+        },
+    })
+    if err != nil {
+        t.Fatalf("NewEventConsumer() = %v", err)
+    }
+    defer consumer.Close()
+    
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    const published = 3
+    for i := 0; i < published; i++ {
+        order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+        if err != nil {
+            t.Fatalf("NewOrder() = %v", err)
+        }
+        if err := bus.Publish(ctx, events.NewOrderCreatedEvent(order)); err != nil {
+            t.Fatalf("Publish() = %v", err)
+        }
+    }
+    if err := consumer.Start(ctx); err != nil {
+        t.Fatalf("Start() = %v", err)
+    }
+    
+    for i := 0; i < published; i++ {
+        select {
+        case <-handled:
+        case <-time.After(30 * time.Second):
+            t.Fatalf("orders projection handled %d of %d events", i, published)
+        }
+    }
+    
+    var statuses map[string]ProjectionStatus
+    deadline := time.Now().Add(10 * time.Second)
+    for {
+        statuses = make(map[string]ProjectionStatus)
+        for _, status := range consumer.Status(ctx) {
+            statuses[status.Name] = status
+        }
+        orders, broken := statuses[DefaultProjection], statuses["broken"]
+        if orders.Lag != nil && *orders.Lag == 0 && broken.Failed > 1 {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("statuses = %+v, want orders caught up and broken retried", statuses)
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+    
+    orders, broken := statuses[DefaultProjection], statuses["broken"]
+    if orders.Processed != published || orders.Failed != 0 || orders.Group != "order-reporting-service-orders" {
+        t.Errorf("orders status = %+v, want %d processed in its own group", orders, published)
+    }
+    if broken.Processed != 0 || broken.LastError != "projection bug" || broken.Lag == nil || *broken.Lag != published {
+        t.Errorf("broken status = %+v, want nothing processed, its error, and a lag of %d", broken, published)
+    }
+    
+    cancel()
+    drainCtx, drainCancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer drainCancel()
+    if err := consumer.Drain(drainCtx); err != nil {
+        t.Errorf("Drain() = %v", err)
+    }
+}
+
+// NewEventConsumer refuses two projections with one name.
+func TestNewEventConsumer_duplicateName(t *testing.T) {
+    bus := eventbus.NewInMemoryEventBus(nil)
+    _, err := NewEventConsumer(bus, []Projection{{Name: DefaultProjection}, {Name: DefaultProjection}})
+    if err == nil {
+        t.Error("NewEventConsumer() with a name registered twice = nil, want an error")
+    }
+}
+
+// drainingBus records its drains in drained, failing those of the group
+// named by failGroup. Its groups named "plain" cannot be drained.
+type drainingBus struct {
+    eventbus.EventBus
+    group     string
+    drained   *[]string
+    failGroup string
+}
+
+func (b *drainingBus) ForGroup(group string) (eventbus.EventBus, error) {
+    if group == "plain" {
+        return plainBus{}, nil
+    }
+    return &drainingBus{group: group, drained: b.drained, failGroup: b.failGroup}, nil
+}
+
+func (b *drainingBus) Drain(context.Context) error {
+    *b.drained = append(*b.drained, b.group)
+    if b.failGroup != "" && b.group == b.failGroup {
+        return errors.New("handler still running")
+    }
+    return nil
+}
+
+func (b *drainingBus) Close() error { return nil }
+
+type plainBus struct {
+    eventbus.EventBus
+}
+
+func (plainBus) Close() error { return nil }
+
+// Drain waits for each bus the projections consume from once, skipping
+// buses that cannot be drained, and names the projection that did not
+// stop.
+func TestEventConsumer_Drain(t *testing.T) {
+    tests := []struct {
+        name        string
+        failGroup   string
+        wantDrained []string
+        wantErr     string
+    }{
+        {name: "stopped", wantDrained: []string{"", "reporting-customers"}},
+        {name: "stuck", failGroup: "reporting-customers", wantDrained: []string{"", "reporting-customers"}, wantErr: "projection customers did not stop"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var drained []string
+            bus := &drainingBus{drained: &drained, failGroup: tt.failGroup}
+            noop := func(context.Context, events.DomainEvent) error { return nil }
+            consumer, err := NewEventConsumer(bus, []Projection{
+                {Name: DefaultProjection, Handler: noop},
+                {Name: "products", Handler: noop},
+                {Name: "customers", Group: "reporting-customers", Handler: noop},
+                {Name: "search", Group: "plain", Handler: noop},
+            })
+            if err != nil {
+                t.Fatalf("NewEventConsumer() = %v", err)
+            }
+            defer consumer.Close()
+            
+            err = consumer.Drain(context.Background())
+            if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+                t.Errorf("Drain() = %v, want %q", err, tt.wantErr)
+            }
+            if !reflect.DeepEqual(drained, tt.wantDrained) {
+                t.Errorf("drained buses = %q, want %q", drained, tt.wantDrained)
+            }
+        })
+    }
+}
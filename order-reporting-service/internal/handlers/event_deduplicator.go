@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// dedupStats is published as the "projection_deduplication" expvar:
+// redelivered events skipped and events recorded, by projection, and
+// records that failed and were pruned.
+var dedupStats = expvar.NewMap("projection_deduplication")
+
+// Default EventDeduplicator settings
+const (
+    DefaultDedupRetention       = 7 * 24 * time.Hour
+    DefaultDedupCleanupInterval = time.Hour
+)
+
+// EventDeduplicator skips events a projection already handled, for
+// projections whose writes are not idempotent on their own, such as those
+// applying events that carry no version. Each event id is recorded once
+// the projection handled it: a redelivery of an event whose record failed
+// or was pruned after Retention is applied again.
+type EventDeduplicator struct {
+    Store readmodels.ProcessedEventStore
+    // Retention is how long handled events are remembered; defaults to
+    // DefaultDedupRetention
+    Retention time.Duration
+    // CleanupInterval is how often Run prunes; defaults to
+    // DefaultDedupCleanupInterval
+    CleanupInterval time.Duration
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+}
+
+// Deduplicate returns projection skipping the events it already handled.
+// Its Truncate also forgets the events the replay redelivers, so they are
+// applied again; a reset without truncation skips them. A nil deduplicator
+// returns projection unchanged.
+func (d *EventDeduplicator) Deduplicate(projection Projection) Projection {
+    if d == nil {
+        return projection
+    }
+    name, next, truncate := projection.Name, projection.Handler, projection.Truncate
+    
+    projection.Handler = func(ctx context.Context, event events.DomainEvent) error {
+        eventID := event.EventID()
+        if eventID == "" {
+            return next(ctx, event)
+        }
+        
+        processed, err := d.Store.IsProcessed(ctx, name, eventID)
+        if err != nil {
+            return err
+        }
+        if processed {
+            dedupStats.Add(name+".skipped", 1)
+            return nil
+        }
+        
+        if err := next(ctx, event); err != nil {
+            return err
+        }
+        
+        // The event was applied; failing now would only apply it again
+        if err := d.Store.MarkProcessed(ctx, name, eventID, event.OccurredAt()); err != nil {
+            log.Printf("Projection %s could not record event %s: %v", name, eventID, err)
+            dedupStats.Add("failed", 1)
+            return nil
+        }
+        dedupStats.Add(name+".recorded", 1)
+        return nil
+    }
+    
+    if truncate != nil {
+        projection.Truncate = func(ctx context.Context, since time.Time) (int64, error) {
+            if _, err := d.Store.ForgetSince(ctx, name, since); err != nil {
+                return 0, err
+            }
+            return truncate(ctx, since)
+        }
+    }
+    return projection
+}
+
+// Run prunes the events recorded more than Retention ago, at start and
+// then every CleanupInterval until ctx is done.
+func (d *EventDeduplicator) Run(ctx context.Context) error {
+    d.withDefaults()
+    
+    ticker := time.NewTicker(d.CleanupInterval)
+    defer ticker.Stop()
+    
+    for {
+        pruned, err := d.Store.DeleteProcessedBefore(ctx, d.Now().Add(-d.Retention))
+        if err != nil {
+            log.Printf("Error pruning processed events: %v", err)
+        } else if pruned > 0 {
+            dedupStats.Add("pruned", pruned)
+        }
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+func (d *EventDeduplicator) withDefaults() {
+    if d.Retention <= 0 {
+        d.Retention = DefaultDedupRetention
+    }
+    if d.CleanupInterval <= 0 {
+        d.CleanupInterval = DefaultDedupCleanupInterval
+    }
+    if d.Now == nil {
+        d.Now = clock.Now
+    }
+}
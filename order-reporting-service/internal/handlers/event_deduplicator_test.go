@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+// memoryProcessedEvents is a ProcessedEventStore in memory. MarkProcessed
+// fails with markErr when set.
+type memoryProcessedEvents struct {
+    mu      sync.Mutex
+    // processed holds when each projection/event id occurred and was
+    // recorded
+    processed map[string][2]time.Time
+    markErr   error
+    // now is the time events are recorded at
+    now       time.Time
+}
+
+func newMemoryProcessedEvents(now time.Time) *memoryProcessedEvents {
+    return &memoryProcessedEvents{processed: make(map[string][2]time.Time), now: now}
+}
+
+func (s *memoryProcessedEvents) IsProcessed(_ context.Context, projection, eventID string) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    _, ok := s.processed[projection+"/"+eventID]
+    return ok, nil
+}
+
+func (s *memoryProcessedEvents) MarkProcessed(_ context.Context, projection, eventID string, occurredAt time.Time) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.markErr != nil {
+        return s.markErr
+    }
+    s.processed[projection+"/"+eventID] = [2]time.Time{occurredAt, s.now}
+    return nil
+}
+
+func (s *memoryProcessedEvents) ForgetSince(_ context.Context, projection string, since time.Time) (int64, error) {
+    return s.delete(func(key string, times [2]time.Time) bool {
+        return strings.HasPrefix(key, projection+"/") && !times[0].Before(since)
+    }), nil
+}
+
+func (s *memoryProcessedEvents) DeleteProcessedBefore(_ context.Context, cutoff time.Time) (int64, error) {
+    return s.delete(func(_ string, times [2]time.Time) bool { return times[1].Before(cutoff) }), nil
+}
+
+func (s *memoryProcessedEvents) delete(match func(key string, times [2]time.Time) bool) int64 {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var deleted int64
+    for key, times := range s.processed {
+        if match(key, times) {
+            delete(s.processed, key)
+            deleted++
+        }
+    }
+    return deleted
+}
+
+// countingProjection counts the events it applies, failing with err when
+// set.
+type countingProjection struct {
+    applied int
+    err     error
+}
+
+func (p *countingProjection) handle(context.Context, events.DomainEvent) error {
+    if p.err != nil {
+        return p.err
+    }
+    p.applied++
+    return nil
+}
+
+// customerEvent is an event carrying no version, as customer events are.
+func customerEvent(eventID string, occurredAt time.Time) events.DomainEvent {
+    event := events.NewCustomerFirstOrderEvent(uuid.NewString(), uuid.NewString())
+    event.EventIDValue, event.OccurredAtTime = eventID, occurredAt
+    return event
+}
+
+// Delivering an event twice applies it once. Events whose handling or
+// recording failed, and events without an id, are applied again.
+func TestEventDeduplicator_Deduplicate(t *testing.T) {
+    occurredAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name        string
+        eventID     string
+        markErr     error
+        wantApplied int
+    }{
+        {name: "redelivered", eventID: "event-1", wantApplied: 1},
+        {name: "recording failed", eventID: "event-1", markErr: errors.New("database unavailable"), wantApplied: 2},
+        {name: "no event id", eventID: "", wantApplied: 2},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            store := newMemoryProcessedEvents(occurredAt)
+            store.markErr = tt.markErr
+            counter := &countingProjection{}
+            projection := (&EventDeduplicator{Store: store}).Deduplicate(Projection{Name: "customers", Handler: counter.handle})
+            
+            event := customerEvent(tt.eventID, occurredAt)
+            for i := 0; i < 2; i++ {
+                if err := projection.Handler(context.Background(), event); err != nil {
+                    t.Fatalf("delivery %d = %v", i+1, err)
+                }
+            }
+            if counter.applied != tt.wantApplied {
+                t.Errorf("applied %d times, want %d", counter.applied, tt.wantApplied)
+            }
+        })
+    }
+}
+
+// A failing projection leaves the event unrecorded, so its redelivery is
+// applied; other projections' records do not skip it.
+func TestEventDeduplicator_Deduplicate_failure(t *testing.T) {
+    occurredAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    store := newMemoryProcessedEvents(occurredAt)
+    deduplicator := &EventDeduplicator{Store: store}
+    counter := &countingProjection{err: errors.New("database unavailable")}
+    projection := deduplicator.Deduplicate(Projection{Name: "customers", Handler: counter.handle})
+    event := customerEvent("event-1", occurredAt)
+    
+    if err := projection.Handler(context.Background(), event); !errors.Is(err, counter.err) {
+        t.Fatalf("failing delivery = %v, want %v", err, counter.err)
+    }
+    counter.err = nil
+    if err := projection.Handler(context.Background(), event); err != nil || counter.applied != 1 {
+        t.Errorf("redelivery = %v, applied %d times, want applied once", err, counter.applied)
+    }
+    
+    other := &countingProjection{}
+    otherProjection := deduplicator.Deduplicate(Projection{Name: "orders", Handler: other.handle})
+    if err := otherProjection.Handler(context.Background(), event); err != nil || other.applied != 1 {
+        t.Errorf("another projection's delivery = %v, applied %d times, want applied once", err, other.applied)
+    }
+}
+
+// Truncating the projection forgets the events it replays, so they apply
+// again, and keeps those before.
+func TestEventDeduplicator_Deduplicate_truncate(t *testing.T) {
+    start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    store := newMemoryProcessedEvents(start)
+    counter := &countingProjection{}
+    var truncatedSince time.Time
+    projection := (&EventDeduplicator{Store: store}).Deduplicate(Projection{
+        Name:    "customers",
+        Handler: counter.handle,
+        Truncate: func(_ context.Context, since time.Time) (int64, error) {
+            truncatedSince = since
+            return 0, nil
+        },
+    })
+    
+    before, after := customerEvent("event-1", start), customerEvent("event-2", start.Add(2*time.Hour))
+    deliver := func() {
+        t.Helper()
+        for _, event := range []events.DomainEvent{before, after} {
+            if err := projection.Handler(context.Background(), event); err != nil {
+                t.Fatalf("Handler() = %v", err)
+            }
+        }
+    }
+    deliver()
+    
+    since := start.Add(time.Hour)
+    if _, err := projection.Truncate(context.Background(), since); err != nil {
+        t.Fatalf("Truncate() = %v", err)
+    }
+    if !truncatedSince.Equal(since) {
+        t.Errorf("projection truncated since %v, want %v", truncatedSince, since)
+    }
+    deliver()
+    if counter.applied != 3 {
+        t.Errorf("applied %d events, want 3: both once, and the one after the truncation again", counter.applied)
+    }
+}
+
+// Run prunes what was recorded more than Retention ago.
+func TestEventDeduplicator_Run(t *testing.T) {
+    now := time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)
+    store := newMemoryProcessedEvents(now.Add(-8 * 24 * time.Hour))
+    if err := store.MarkProcessed(context.Background(), "customers", "old", now); err != nil {
+        t.Fatalf("MarkProcessed() = %v", err)
+    }
+    store.now = now.Add(-time.Hour)
+    if err := store.MarkProcessed(context.Background(), "customers", "recent", now); err != nil {
+        t.Fatalf("MarkProcessed() = %v", err)
+    }
+    
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    deduplicator := &EventDeduplicator{Store: store, Now: func() time.Time { return now }}
+    if err := deduplicator.Run(ctx); !errors.Is(err, context.Canceled) {
+        t.Fatalf("Run() = %v, want context.Canceled", err)
+    }
+    for eventID, want := range map[string]bool{"old": false, "recent": true} {
+        if processed, _ := store.IsProcessed(context.Background(), "customers", eventID); processed != want {
+            t.Errorf("%s remembered = %t, want %t", eventID, processed, want)
+        }
+    }
+}
+
+// A nil deduplicator leaves projections as they are.
+func TestEventDeduplicator_nil(t *testing.T) {
+    var deduplicator *EventDeduplicator
+    counter := &countingProjection{}
+    projection := deduplicator.Deduplicate(Projection{Name: "customers", Handler: counter.handle})
+    event := customerEvent("event-1", time.Now())
+    for i := 0; i < 2; i++ {
+        if err := projection.Handler(context.Background(), event); err != nil {
+            t.Fatalf("Handler() = %v", err)
+        }
+    }
+    if counter.applied != 2 {
+        t.Errorf("applied %d times, want 2", counter.applied)
+    }
+}
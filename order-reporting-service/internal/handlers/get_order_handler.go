@@ -1,11 +1,12 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/gorilla/mux"
-	"github.com/vdntruong/dddcqrs/order-reporting-service/internal/readmodels"
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
 )
 
 type GetOrderHandler struct {
@@ -13,15 +14,48 @@ type GetOrderHandler struct {
 }
 
 func (h *GetOrderHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
-    vars := mux.Vars(r)
-    orderID := vars["id"]
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
     
-    order, err := h.ReadModel.GetOrder(r.Context(), orderID)
+    order, err := h.ReadModel.GetOrder(r.Context(), string(orderID))
     if err != nil {
-        http.Error(w, err.Error(), http.StatusNotFound)
+        switch {
+        case errors.Is(err, readmodels.ErrOrderNotFound):
+            http.Error(w, err.Error(), http.StatusNotFound)
+        case errors.Is(err, readmodels.ErrCorruptOrder):
+            writeCorruptOrder(w, r, err)
+        default:
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+        }
+        return
+    }
+    
+    // The projection metadata is left out unless ?include=meta asks for
+    // it, keeping the response as it was
+    if r.URL.Query().Get("include") == "meta" && order.Meta != nil {
+        order.Meta = order.Meta.WithStaleness(clock.Now())
+    } else {
+        order.Meta = nil
+    }
+    
+    apijson.Write(w, r, http.StatusOK, orderResponses.For(r, order))
+}
+
+// writeCorruptOrder answers 500 with the order and column a read failed on,
+// so the row can be found and rebuilt.
+func writeCorruptOrder(w http.ResponseWriter, r *http.Request, err error) {
+    var corrupt *readmodels.CorruptOrderError
+    if !errors.As(err, &corrupt) {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
     
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(order)
+    apijson.Write(w, r, http.StatusInternalServerError, map[string]interface{}{
+        "error":    "corrupt_order",
+        "order_id": corrupt.OrderID,
+        "field":    corrupt.Field,
+        "message":  corrupt.Error(),
+    })
 }
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// The projection metadata is returned, with its staleness, only with
+// ?include=meta, in every API version.
+func TestGetOrderHandler_meta(t *testing.T) {
+    projectedAt := apijson.NewTimestamp(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    defer clock.Set(clock.NewFake(projectedAt.Add(90 * time.Second)))()
+    
+    tests := []struct {
+        name          string
+        query         string
+        meta          *readmodels.OrderMetaDTO
+        wantMeta      bool
+        wantStaleness interface{}
+    }{
+        {name: "default", meta: &readmodels.OrderMetaDTO{LastAppliedVersion: 2, LastEventType: "OrderConfirmed", ProjectedAt: &projectedAt}},
+        {name: "other include", query: "?include=items", meta: &readmodels.OrderMetaDTO{LastAppliedVersion: 2, LastEventType: "OrderConfirmed", ProjectedAt: &projectedAt}},
+        {name: "meta", query: "?include=meta", meta: &readmodels.OrderMetaDTO{LastAppliedVersion: 2, LastEventType: "OrderConfirmed", ProjectedAt: &projectedAt}, wantMeta: true, wantStaleness: 90.0},
+        {name: "row from before the metadata", query: "?include=meta", meta: &readmodels.OrderMetaDTO{LastAppliedVersion: 2}, wantMeta: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rm := newFixedReadModel()
+            rm.order.Meta = tt.meta
+            handler := &GetOrderHandler{ReadModel: rm}
+            req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/orders/"+rm.order.ID+tt.query, nil), map[string]string{"id": rm.order.ID})
+            
+            for _, version := range []apiversion.Version{apiversion.V1, apiversion.V2} {
+                body := serveVersion(t, handler.HandleHTTP, req, version)
+                meta, ok := body["meta"].(map[string]interface{})
+                if ok != tt.wantMeta {
+                    t.Fatalf("%s meta = %v, want it returned %t", version, body["meta"], tt.wantMeta)
+                }
+                if !tt.wantMeta {
+                    continue
+                }
+                if meta["last_applied_version"] != 2.0 || meta["staleness_seconds"] != tt.wantStaleness {
+                    t.Errorf("%s meta = %v, want version 2, staleness %v", version, meta, tt.wantStaleness)
+                }
+                if tt.meta.ProjectedAt != nil && (meta["last_event_type"] != "OrderConfirmed" || meta["projected_at"] != "2024-03-01T12:00:00.000Z") {
+                    t.Errorf("%s meta = %v, want OrderConfirmed projected at 12:00", version, meta)
+                }
+            }
+        })
+    }
+}
+
+// Delivered orders carry a delivery section in every API version, with
+// null details for deliveries projected from events without them; orders
+// not delivered have none.
+func TestGetOrderHandler_delivery(t *testing.T) {
+    deliveredAt := apijson.NewTimestamp(time.Date(2024, 3, 15, 13, 30, 0, 0, time.UTC))
+    signedBy := "J. Doe"
+    
+    tests := []struct {
+        name     string
+        delivery *readmodels.DeliveryDTO
+        want     map[string]interface{}
+    }{
+        {name: "not delivered"},
+        {
+            name:     "details",
+            delivery: &readmodels.DeliveryDTO{DeliveredAt: &deliveredAt, SignedBy: &signedBy},
+            want:     map[string]interface{}{"delivered_at": "2024-03-15T13:30:00.000Z", "signed_by": "J. Doe", "carrier_reference": nil},
+        },
+        {
+            name:     "legacy",
+            delivery: &readmodels.DeliveryDTO{},
+            want:     map[string]interface{}{"delivered_at": nil, "signed_by": nil, "carrier_reference": nil},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rm := newFixedReadModel()
+            rm.order.Delivery = tt.delivery
+            handler := &GetOrderHandler{ReadModel: rm}
+            req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/orders/"+rm.order.ID, nil), map[string]string{"id": rm.order.ID})
+            
+            for _, version := range []apiversion.Version{apiversion.V1, apiversion.V2} {
+                body := serveVersion(t, handler.HandleHTTP, req, version)
+                delivery, ok := body["delivery"].(map[string]interface{})
+                if ok != (tt.want != nil) || (ok && !reflect.DeepEqual(delivery, tt.want)) {
+                    t.Errorf("%s delivery = %v, want %v", version, body["delivery"], tt.want)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+type GetOrderHistoryHandler struct {
+    ReadModel readmodels.OrderHistoryReadModel
+}
+
+func (h *GetOrderHistoryHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    entries, err := h.ReadModel.GetHistory(r.Context(), string(orderID))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    if len(entries) == 0 {
+        http.Error(w, "order not found", http.StatusNotFound)
+        return
+    }
+    
+    response := map[string]interface{}{
+        "order_id": orderID,
+        "history":  entries,
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
@@ -1,58 +1,95 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
-	"github.com/vdntruong/dddcqrs/order-reporting-service/internal/readmodels"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
 )
 
+const maxListOrdersLimit = 100
+
 type ListOrdersHandler struct {
     ReadModel readmodels.OrderReadModel
 }
 
 func (h *ListOrdersHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
-    customerID := r.URL.Query().Get("customer_id")
-    if customerID == "" {
-        http.Error(w, "customer_id parameter is required", http.StatusBadRequest)
+    customerID, ok := customerIDParam(w, r)
+    if !ok {
         return
     }
-    
-    // Parse pagination parameters
-    limitStr := r.URL.Query().Get("limit")
-    offsetStr := r.URL.Query().Get("offset")
-    
-    limit := 10 // default
-    offset := 0  // default
-    
-    if limitStr != "" {
-        if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
-            limit = l
+    filter := readmodels.OrderFilter{
+        CustomerID: customerID,
+        // Order numbers are read out over the phone, so any case matches
+        Number:     strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("number"))),
+        Channel:    r.URL.Query().Get("channel"),
+        Tag:        r.URL.Query().Get("tag"),
+        ProductID:  r.URL.Query().Get("product_id"),
+    }
+    if raw := r.URL.Query().Get("contact_email"); raw != "" {
+        contactEmail, err := valueobjects.ParseEmail(raw)
+        if err != nil {
+            http.Error(w, "invalid contact_email: "+err.Error(), http.StatusBadRequest)
+            return
         }
+        filter.ContactEmail = contactEmail.String()
     }
-    
-    if offsetStr != "" {
-        if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-            offset = o
+    if filter == (readmodels.OrderFilter{}) {
+        http.Error(w, "customer_id, contact_email, number, channel, tag or product_id parameter is required", http.StatusBadRequest)
+        return
+    }
+    if channel := valueobjects.OrderChannel(filter.Channel); filter.Channel != "" && !channel.IsValid() && channel != valueobjects.OrderChannelUnknown {
+        http.Error(w, "channel must be one of web, mobile, phone or unknown", http.StatusBadRequest)
+        return
+    }
+    // Archived orders are left out unless asked for
+    if raw := r.URL.Query().Get("include_archived"); raw != "" {
+        includeArchived, err := strconv.ParseBool(raw)
+        if err != nil {
+            http.Error(w, "Invalid include_archived. Must be true or false", http.StatusBadRequest)
+            return
         }
+        filter.IncludeArchived = includeArchived
     }
     
-    orders, err := h.ReadModel.ListOrders(r.Context(), customerID, limit, offset)
+    // Parse pagination parameters
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 10}, maxListOrdersLimit)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        pagination.WriteError(w, err)
         return
     }
     
+    // Summaries are the default; ?expand=items returns full orders
+    var orders interface{}
+    var count int
+    if r.URL.Query().Get("expand") == "items" {
+        fullOrders, err := h.ReadModel.ListOrders(r.Context(), filter, page)
+        if err != nil {
+            writeCorruptOrder(w, r, err)
+            return
+        }
+        orders, count = fullOrders, len(fullOrders)
+    } else {
+        summaries, err := h.ReadModel.ListOrderSummaries(r.Context(), filter, page)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        orders, count = summaries, len(summaries)
+    }
+    
     response := map[string]interface{}{
         "orders": orders,
         "pagination": map[string]interface{}{
-            "limit":  limit,
-            "offset": offset,
-            "count":  len(orders),
+            "limit":  page.Limit,
+            "offset": page.Offset,
+            "count":  count,
         },
     }
     
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(response)
+    apijson.Write(w, r, http.StatusOK, response)
 }
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// filterReadModel records the filter orders are listed with.
+type filterReadModel struct {
+    readmodels.OrderReadModel
+    filter *readmodels.OrderFilter
+}
+
+func (rm *filterReadModel) ListOrderSummaries(_ context.Context, filter readmodels.OrderFilter, _ pagination.Pagination) ([]*readmodels.OrderSummaryDTO, error) {
+    rm.filter = &filter
+    return []*readmodels.OrderSummaryDTO{}, nil
+}
+
+// Order numbers are matched in any case and with stray spaces, as they
+// are read out over the phone.
+func TestListOrdersHandler_number(t *testing.T) {
+    tests := []struct {
+        name       string
+        query      string
+        wantStatus int
+        wantNumber string
+    }{
+        {name: "exact", query: "number=ORD-2024-000123", wantStatus: http.StatusOK, wantNumber: "ORD-2024-000123"},
+        {name: "lower case", query: "number=ord-7kq2m9xd", wantStatus: http.StatusOK, wantNumber: "ORD-7KQ2M9XD"},
+        {name: "spaces", query: "number=%20ORD-2024-000123%20", wantStatus: http.StatusOK, wantNumber: "ORD-2024-000123"},
+        {name: "blank", query: "number=%20", wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rm := &filterReadModel{}
+            w := httptest.NewRecorder()
+            (&ListOrdersHandler{ReadModel: rm}).HandleHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/orders?"+tt.query, nil))
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+            if rm.filter == nil || rm.filter.Number != tt.wantNumber {
+                t.Errorf("listed with %+v, want number %s", rm.filter, tt.wantNumber)
+            }
+        })
+    }
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/distlock"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// OrderArchiverLock names the lock archiving passes run under.
+const OrderArchiverLock = "order-archiver"
+
+// orderArchiverLockTTL is how long the lock of an instance that stopped
+// renewing it blocks the others.
+const orderArchiverLockTTL = time.Minute
+
+// archiveStats is published as the "order_read_model_archive" expvar:
+// orders archived, runs that failed and runs skipped for another
+// instance's since start.
+var archiveStats = expvar.NewMap("order_read_model_archive")
+
+// OrderArchiver periodically moves orders delivered or cancelled more than
+// MaxAge ago out of order_read_models, BatchSize at a time. The read model
+// must have been built with readmodels.WithArchive.
+type OrderArchiver struct {
+    // Disabled makes Run return at once
+    Disabled  bool
+    ReadModel readmodels.OrderReadModel
+    MaxAge    time.Duration
+    Interval  time.Duration
+    BatchSize int
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+    // Lock, when set, runs each pass on one instance at a time; the other
+    // instances skip theirs while it is held. Without it every instance
+    // archives, each batch skipping the rows another is moving
+    Lock *distlock.Locker
+}
+
+// Run archives once at start and then every Interval until ctx is done.
+func (a *OrderArchiver) Run(ctx context.Context) error {
+    if a.Disabled {
+        return nil
+    }
+    
+    ticker := time.NewTicker(a.Interval)
+    defer ticker.Stop()
+    
+    for {
+        if archived, ran, err := a.archive(ctx); err != nil {
+            log.Printf("Error archiving orders: %v", err)
+        } else if !ran {
+            log.Printf("Skipped archiving orders: another instance holds the %s lock", OrderArchiverLock)
+        } else if archived > 0 {
+            log.Printf("Archived %d orders", archived)
+        }
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// archive runs ArchiveOnce under Lock when it is set, reporting whether it
+// ran.
+func (a *OrderArchiver) archive(ctx context.Context) (int64, bool, error) {
+    if a.Lock == nil {
+        archived, err := a.ArchiveOnce(ctx)
+        return archived, true, err
+    }
+    
+    var archived int64
+    ran, err := a.Lock.Run(ctx, OrderArchiverLock, orderArchiverLockTTL, func(ctx context.Context) error {
+        var err error
+        archived, err = a.ArchiveOnce(ctx)
+        return err
+    })
+    if !ran {
+        archiveStats.Add("skipped", 1)
+    }
+    return archived, ran, err
+}
+
+// ArchiveOnce moves every order old enough, a batch at a time until a batch
+// comes back short, and returns how many it moved.
+func (a *OrderArchiver) ArchiveOnce(ctx context.Context) (int64, error) {
+    now := clock.Now()
+    if a.Now != nil {
+        now = a.Now()
+    }
+    before := now.Add(-a.MaxAge)
+    
+    var total int64
+    for ctx.Err() == nil {
+        archived, err := a.ReadModel.ArchiveOrders(ctx, before, a.BatchSize)
+        total += archived
+        archiveStats.Add("archived", archived)
+        if err != nil {
+            archiveStats.Add("errors", 1)
+            return total, err
+        }
+        if archived < int64(a.BatchSize) {
+            break
+        }
+    }
+    return total, nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/distlock"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// archivingReadModel counts ArchiveOrders calls, each of which waits for
+// release and then reports nothing left to archive.
+type archivingReadModel struct {
+    readmodels.OrderReadModel
+    calls   atomic.Int32
+    started chan struct{}
+    release chan struct{}
+}
+
+func (rm *archivingReadModel) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int64, error) {
+    rm.calls.Add(1)
+    rm.started <- struct{}{}
+    <-rm.release
+    return 0, nil
+}
+
+// Instances sharing a lock archive one at a time: the others skip their
+// pass while it is held.
+func TestOrderArchiver_archive_oneInstanceAtATime(t *testing.T) {
+    ctx := context.Background()
+    client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+    defer client.Close()
+    
+    newArchiver := func() (*OrderArchiver, *archivingReadModel) {
+        rm := &archivingReadModel{started: make(chan struct{}, 1), release: make(chan struct{})}
+        return &OrderArchiver{ReadModel: rm, MaxAge: time.Hour, BatchSize: 100, Lock: distlock.NewLocker(client)}, rm
+    }
+    first, firstModel := newArchiver()
+    second, secondModel := newArchiver()
+    
+    done := make(chan bool)
+    go func() {
+        _, ran, _ := first.archive(ctx)
+        done <- ran
+    }()
+    <-firstModel.started
+    
+    if _, ran, err := second.archive(ctx); ran || err != nil {
+        t.Errorf("archive() while another instance archives = ran %t, %v, want skipped", ran, err)
+    }
+    if calls := secondModel.calls.Load(); calls != 0 {
+        t.Errorf("skipped instance archived %d times", calls)
+    }
+    
+    close(firstModel.release)
+    if ran := <-done; !ran {
+        t.Error("first instance did not archive")
+    }
+    
+    // Once released, the lock is free for the next pass
+    close(secondModel.release)
+    if _, ran, err := second.archive(ctx); !ran || err != nil {
+        t.Errorf("archive() after release = ran %t, %v, want it run", ran, err)
+    }
+    if calls := secondModel.calls.Load(); calls != 1 {
+        t.Errorf("instance archived %d times, want 1", calls)
+    }
+}
+
+func TestOrderArchiver_archive_withoutLock(t *testing.T) {
+    rm := &archivingReadModel{started: make(chan struct{}, 1), release: make(chan struct{})}
+    close(rm.release)
+    archiver := &OrderArchiver{ReadModel: rm, MaxAge: time.Hour, BatchSize: 100}
+    
+    if _, ran, err := archiver.archive(context.Background()); !ran || err != nil {
+        t.Errorf("archive() = ran %t, %v, want it run", ran, err)
+    }
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// ListOrderChangesHandler serves the orders changed after a watermark, for
+// extracting orders incrementally rather than listing them all. A client
+// passes the next_since and next_after_id of each page as since and
+// after_id to get the next one, and keeps the last pair to resume from.
+type ListOrderChangesHandler struct {
+    ReadModel readmodels.OrderReadModel
+}
+
+func (h *ListOrderChangesHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    
+    // Without since the feed starts with the first order ever updated
+    var since time.Time
+    if raw := query.Get("since"); raw != "" {
+        parsed, err := time.Parse(time.RFC3339, raw)
+        if err != nil {
+            http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+            return
+        }
+        since = parsed
+    }
+    afterID := query.Get("after_id")
+    if afterID != "" && query.Get("since") == "" {
+        http.Error(w, "after_id requires since", http.StatusBadRequest)
+        return
+    }
+    
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 100}, readmodels.MaxOrderChangesLimit)
+    if err != nil {
+        pagination.WriteError(w, err)
+        return
+    }
+    if page.Offset != 0 {
+        http.Error(w, "offset is not supported, page with since and after_id", http.StatusBadRequest)
+        return
+    }
+    
+    changes, err := h.ReadModel.ListOrderChanges(r.Context(), since, afterID, page.Limit)
+    if err != nil {
+        writeCorruptOrder(w, r, err)
+        return
+    }
+    
+    apijson.Write(w, r, http.StatusOK, changes)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// changesReadModel records the watermark and limit it is asked for.
+type changesReadModel struct {
+    readmodels.OrderReadModel
+    called  bool
+    since   time.Time
+    afterID string
+    limit   int
+}
+
+func (rm *changesReadModel) ListOrderChanges(_ context.Context, since time.Time, afterID string, limit int) (*readmodels.OrderChangesDTO, error) {
+    rm.called, rm.since, rm.afterID, rm.limit = true, since, afterID, limit
+    return &readmodels.OrderChangesDTO{Orders: []*readmodels.OrderDTO{}, NextSince: since.Format(time.RFC3339Nano), NextAfterID: afterID}, nil
+}
+
+// The watermark is read at full precision; after_id only means something
+// with since, and the feed pages by watermark, not offset.
+func TestListOrderChangesHandler(t *testing.T) {
+    tests := []struct {
+        name        string
+        query       string
+        wantStatus  int
+        wantSince   time.Time
+        wantAfterID string
+        wantLimit   int
+    }{
+        {name: "from the start", query: "", wantStatus: http.StatusOK, wantLimit: 100},
+        {name: "watermark", query: "since=2024-03-01T12:05:00.123456Z&after_id=o1&limit=3", wantStatus: http.StatusOK, wantSince: time.Date(2024, 3, 1, 12, 5, 0, 123456000, time.UTC), wantAfterID: "o1", wantLimit: 3},
+        {name: "since in another zone", query: "since=2024-03-01T14:05:00%2B02:00", wantStatus: http.StatusOK, wantSince: time.Date(2024, 3, 1, 12, 5, 0, 0, time.UTC), wantLimit: 100},
+        {name: "since not a timestamp", query: "since=2024-03-01", wantStatus: http.StatusBadRequest},
+        {name: "after_id without since", query: "after_id=o1", wantStatus: http.StatusBadRequest},
+        {name: "offset", query: "offset=10", wantStatus: http.StatusBadRequest},
+        {name: "limit over the maximum", query: "limit=1001", wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rm := &changesReadModel{}
+            w := httptest.NewRecorder()
+            (&ListOrderChangesHandler{ReadModel: rm}).HandleHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/orders/changes?"+tt.query, nil))
+            
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                if rm.called {
+                    t.Error("read model asked for a refused request")
+                }
+                return
+            }
+            if !rm.since.Equal(tt.wantSince) || rm.afterID != tt.wantAfterID || rm.limit != tt.wantLimit {
+                t.Errorf("read model asked for %v, %q, %d, want %v, %q, %d", rm.since, rm.afterID, rm.limit, tt.wantSince, tt.wantAfterID, tt.wantLimit)
+            }
+        })
+    }
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+)
+
+// orderIDVar parses the {id} path variable, answering 400 when it is not an
+// order id.
+func orderIDVar(w http.ResponseWriter, r *http.Request) (entities.OrderID, bool) {
+    orderID, err := entities.ParseOrderID(mux.Vars(r)["id"])
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return "", false
+    }
+    return orderID, true
+}
+
+// customerIDParam parses the optional customer_id query parameter,
+// answering 400 when it is set but not a customer id.
+func customerIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+    raw := r.URL.Query().Get("customer_id")
+    if raw == "" {
+        return "", true
+    }
+    customerID, err := entities.ParseCustomerID(raw)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return "", false
+    }
+    return string(customerID), true
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Malformed order and customer ids are answered with 400 before reading
+// the read models, which are nil here.
+func TestHandlers_invalidIDs(t *testing.T) {
+    tests := []struct {
+        name    string
+        handler http.HandlerFunc
+        target  string
+        vars    map[string]string
+        want    string
+    }{
+        {name: "get order", handler: (&GetOrderHandler{}).HandleHTTP, target: "/orders/order-1", vars: map[string]string{"id": "order-1"}, want: "invalid order id"},
+        {name: "order history", handler: (&GetOrderHistoryHandler{}).HandleHTTP, target: "/orders/1/history", vars: map[string]string{"id": "1"}, want: "invalid order id"},
+        {name: "status override", handler: (&OrderStatusOverrideHandler{}).HandleHTTP, target: "/orders/x/status", vars: map[string]string{"id": "x"}, want: "invalid order id"},
+        {name: "tag", handler: (&OrderTagHandler{}).HandleHTTP, target: "/orders/x/tags/vip", vars: map[string]string{"id": "x", "tag": "vip"}, want: "invalid order id"},
+        {name: "list orders", handler: (&ListOrdersHandler{}).HandleHTTP, target: "/orders?customer_id=customer-1", want: "invalid customer id"},
+        {name: "SLA breaches", handler: (&ListSLABreachesHandler{}).HandleHTTP, target: "/sla-breaches?customer_id=customer-1", want: "invalid customer id"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodPut, tt.target, strings.NewReader("{}"))
+            if tt.vars != nil {
+                r = mux.SetURLVars(r, tt.vars)
+            }
+            w := httptest.NewRecorder()
+            tt.handler(w, r)
+            if w.Code != http.StatusBadRequest || !strings.HasPrefix(w.Body.String(), tt.want) {
+                t.Errorf("status = %d: %s, want 400 %s", w.Code, w.Body, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// ManualStatusOverrideEvent is the event type of the order history entries
+// recording status overrides.
+const ManualStatusOverrideEvent = "ManualStatusOverride"
+
+// maxOverrideReasonLength caps the reason recorded with an override.
+const maxOverrideReasonLength = 500
+
+// overrideStats is published as the "order_status_overrides" expvar:
+// overrides applied, those forced past a forbidden transition, and
+// overrides by target status.
+var overrideStats = expvar.NewMap("order_status_overrides")
+
+// OrderStatusOverrideHandler sets an order's status in the read model
+// directly (PUT), for when the read model disagrees with the event stream
+// and replaying is not practical. Each override is recorded in the order's
+// history with who made it and why. Transitions the order status does not
+// allow are refused unless forced.
+type OrderStatusOverrideHandler struct {
+    ReadModel        readmodels.OrderReadModel
+    HistoryReadModel readmodels.OrderHistoryReadModel
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+}
+
+// OrderStatusOverrideRequest is the body of an override. Actor names the
+// operator, as the admin key does not identify one.
+type OrderStatusOverrideRequest struct {
+    Status string `json:"status"`
+    Reason string `json:"reason"`
+    Actor  string `json:"actor"`
+    Force  bool   `json:"force"`
+}
+
+// OrderStatusOverrideResponse describes an applied override.
+type OrderStatusOverrideResponse struct {
+    OrderID        string            `json:"order_id"`
+    PreviousStatus string            `json:"previous_status"`
+    Status         string            `json:"status"`
+    Forced         bool              `json:"forced"`
+    Actor          string            `json:"actor"`
+    Reason         string            `json:"reason"`
+    OverriddenAt   apijson.Timestamp `json:"overridden_at"`
+}
+
+func (h *OrderStatusOverrideHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    
+    var req OrderStatusOverrideRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    status, err := valueobjects.ParseOrderStatus(req.Status)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    req.Reason, req.Actor = strings.TrimSpace(req.Reason), strings.TrimSpace(req.Actor)
+    if req.Reason == "" || req.Actor == "" {
+        http.Error(w, "reason and actor are required", http.StatusBadRequest)
+        return
+    }
+    if len(req.Reason) > maxOverrideReasonLength {
+        http.Error(w, fmt.Sprintf("reason must be at most %d characters", maxOverrideReasonLength), http.StatusBadRequest)
+        return
+    }
+    
+    ctx := r.Context()
+    order, err := h.ReadModel.GetOrder(ctx, string(orderID))
+    if err != nil {
+        writeOverrideError(w, err)
+        return
+    }
+    previous := valueobjects.OrderStatus(order.Status)
+    forced := !previous.CanTransitionTo(status)
+    if forced && !req.Force {
+        http.Error(w, fmt.Sprintf("an order cannot move from %s to %s; set force to override anyway", previous, status), http.StatusConflict)
+        return
+    }
+    
+    now := clock.Now
+    if h.Now != nil {
+        now = h.Now
+    }
+    at := now().UTC()
+    if err := h.ReadModel.OverrideStatus(ctx, order.ID, status.String(), at); err != nil {
+        writeOverrideError(w, err)
+        return
+    }
+    
+    details := fmt.Sprintf("manual override from %s to %s by %s: %s", previous, status, req.Actor, req.Reason)
+    if forced {
+        details = "forced " + details
+    }
+    // The order's version as sequence places the entry after the events
+    // the read model had applied
+    entry := &readmodels.OrderHistoryEntryDTO{
+        OrderID:    order.ID,
+        EventType:  ManualStatusOverrideEvent,
+        Sequence:   order.Version,
+        Details:    details,
+        OccurredAt: apijson.NewTimestamp(at),
+    }
+    if err := h.HistoryReadModel.AddEntry(ctx, entry); err != nil {
+        // The status was changed; the log keeps the audit trail
+        log.Printf("Failed to record status override of order %s in its history: %v", order.ID, err)
+    }
+    log.Printf("Order %s status %s", order.ID, details)
+    
+    overrideStats.Add("total", 1)
+    overrideStats.Add("to_"+status.String(), 1)
+    if forced {
+        overrideStats.Add("forced", 1)
+    }
+    
+    apijson.Write(w, r, http.StatusOK, OrderStatusOverrideResponse{
+        OrderID:        order.ID,
+        PreviousStatus: previous.String(),
+        Status:         status.String(),
+        Forced:         forced,
+        Actor:          req.Actor,
+        Reason:         req.Reason,
+        OverriddenAt:   entry.OccurredAt,
+    })
+}
+
+func writeOverrideError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, readmodels.ErrOrderNotFound):
+        http.Error(w, err.Error(), http.StatusNotFound)
+    default:
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+    }
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// overrideReadModel holds one order whose status OverrideStatus sets.
+type overrideReadModel struct {
+    readmodels.OrderReadModel
+    order      readmodels.OrderDTO
+    overridden bool
+}
+
+func (rm *overrideReadModel) GetOrder(_ context.Context, orderID string) (*readmodels.OrderDTO, error) {
+    if orderID != rm.order.ID {
+        return nil, readmodels.ErrOrderNotFound
+    }
+    order := rm.order
+    return &order, nil
+}
+
+func (rm *overrideReadModel) OverrideStatus(_ context.Context, orderID, status string, _ time.Time) error {
+    rm.order.Status, rm.overridden = status, true
+    return nil
+}
+
+// memoryHistory records the history entries added, failing with err when
+// set.
+type memoryHistory struct {
+    readmodels.OrderHistoryReadModel
+    entries []*readmodels.OrderHistoryEntryDTO
+    err     error
+}
+
+func (h *memoryHistory) AddEntry(_ context.Context, entry *readmodels.OrderHistoryEntryDTO) error {
+    if h.err != nil {
+        return h.err
+    }
+    h.entries = append(h.entries, entry)
+    return nil
+}
+
+func overrideStat(name string) int64 {
+    if v, ok := overrideStats.Get(name).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
+
+// An override allowed by the order's status, or forced past it, sets the
+// status and records who made it and why in the order's history; other
+// overrides change nothing.
+func TestOrderStatusOverrideHandler(t *testing.T) {
+    at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name        string
+        status      string
+        orderID     string
+        body        string
+        historyErr  error
+        wantStatus  int
+        wantDetails string
+        wantForced  bool
+    }{
+        {
+            name:        "allowed",
+            status:      "confirmed",
+            body:        `{"status": "shipped", "reason": " carrier scan missed ", "actor": "alice"}`,
+            wantStatus:  http.StatusOK,
+            wantDetails: "manual override from confirmed to shipped by alice: carrier scan missed",
+        },
+        {
+            name:       "forbidden transition",
+            status:     "delivered",
+            body:       `{"status": "draft", "reason": "customer asked", "actor": "alice"}`,
+            wantStatus: http.StatusConflict,
+        },
+        {
+            name:        "forced",
+            status:      "delivered",
+            body:        `{"status": "draft", "reason": "customer asked", "actor": "alice", "force": true}`,
+            wantStatus:  http.StatusOK,
+            wantDetails: "forced manual override from delivered to draft by alice: customer asked",
+            wantForced:  true,
+        },
+        {
+            name:       "history unavailable",
+            status:     "confirmed",
+            body:       `{"status": "shipped", "reason": "carrier scan missed", "actor": "alice"}`,
+            historyErr: errors.New("database unavailable"),
+            wantStatus: http.StatusOK,
+        },
+        {name: "unknown status", status: "confirmed", body: `{"status": "lost", "reason": "r", "actor": "alice"}`, wantStatus: http.StatusBadRequest},
+        {name: "no reason", status: "confirmed", body: `{"status": "shipped", "reason": "  ", "actor": "alice"}`, wantStatus: http.StatusBadRequest},
+        {name: "no actor", status: "confirmed", body: `{"status": "shipped", "reason": "r"}`, wantStatus: http.StatusBadRequest},
+        {name: "long reason", status: "confirmed", body: `{"status": "shipped", "reason": "` + strings.Repeat("r", maxOverrideReasonLength+1) + `", "actor": "alice"}`, wantStatus: http.StatusBadRequest},
+        {name: "missing order", status: "confirmed", orderID: uuid.NewString(), body: `{"status": "shipped", "reason": "r", "actor": "alice"}`, wantStatus: http.StatusNotFound},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rm := &overrideReadModel{order: readmodels.OrderDTO{ID: uuid.NewString(), Status: tt.status, Version: 4}}
+            history := &memoryHistory{err: tt.historyErr}
+            handler := &OrderStatusOverrideHandler{ReadModel: rm, HistoryReadModel: history, Now: func() time.Time { return at }}
+            orderID := tt.orderID
+            if orderID == "" {
+                orderID = rm.order.ID
+            }
+            total, forced := overrideStat("total"), overrideStat("forced")
+            
+            r := httptest.NewRequest(http.MethodPut, "/admin/orders/"+orderID+"/status", strings.NewReader(tt.body))
+            w := httptest.NewRecorder()
+            handler.HandleHTTP(w, mux.SetURLVars(r, map[string]string{"id": orderID}))
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            
+            if w.Code != http.StatusOK {
+                if rm.overridden || len(history.entries) != 0 || overrideStat("total") != total {
+                    t.Errorf("refused override changed the order: overridden %t, %d history entries", rm.overridden, len(history.entries))
+                }
+                return
+            }
+            var resp OrderStatusOverrideResponse
+            if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+                t.Fatalf("decoding response: %v", err)
+            }
+            if resp.PreviousStatus != tt.status || resp.Status != rm.order.Status || resp.Forced != tt.wantForced || resp.Actor != "alice" || !resp.OverriddenAt.Equal(at) {
+                t.Errorf("response = %+v, want the override from %s, forced %t", resp, tt.status, tt.wantForced)
+            }
+            if got := overrideStat("total") - total; got != 1 {
+                t.Errorf("total overrides grew by %d, want 1", got)
+            }
+            if got, want := overrideStat("forced")-forced, map[bool]int64{true: 1}[tt.wantForced]; got != want {
+                t.Errorf("forced overrides grew by %d, want %d", got, want)
+            }
+            
+            if tt.historyErr != nil {
+                return
+            }
+            if len(history.entries) != 1 {
+                t.Fatalf("history entries = %d, want 1", len(history.entries))
+            }
+            entry := history.entries[0]
+            if entry.OrderID != rm.order.ID || entry.EventType != ManualStatusOverrideEvent || entry.Sequence != 4 || entry.Details != tt.wantDetails || !entry.OccurredAt.Equal(at) {
+                t.Errorf("history entry = %+v, want a %s at sequence 4 with details %q", entry, ManualStatusOverrideEvent, tt.wantDetails)
+            }
+        })
+    }
+}
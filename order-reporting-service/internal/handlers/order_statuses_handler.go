@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+const maxOrderStatusIDs = 100
+
+// OrderStatusesRequest is the POST body of the bulk status endpoint.
+type OrderStatusesRequest struct {
+    IDs []string `json:"ids"`
+}
+
+// OrderStatusesHandler returns the statuses of up to 100 orders at once, for
+// clients that poll several orders. Ids come from ?ids= (comma separated or
+// repeated) on GET, or the JSON body on POST. Unknown ids are listed under
+// not_found rather than left out.
+type OrderStatusesHandler struct {
+    ReadModel readmodels.OrderReadModel
+}
+
+func (h *OrderStatusesHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    var ids []string
+    if r.Method == http.MethodPost {
+        var req OrderStatusesRequest
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            http.Error(w, "Invalid JSON", http.StatusBadRequest)
+            return
+        }
+        ids = req.IDs
+    } else {
+        for _, value := range r.URL.Query()["ids"] {
+            ids = append(ids, strings.Split(value, ",")...)
+        }
+    }
+    
+    ids = uniqueIDs(ids)
+    if len(ids) == 0 {
+        http.Error(w, "ids is required", http.StatusBadRequest)
+        return
+    }
+    if len(ids) > maxOrderStatusIDs {
+        http.Error(w, fmt.Sprintf("at most %d ids are allowed, got %d", maxOrderStatusIDs, len(ids)), http.StatusBadRequest)
+        return
+    }
+    for _, id := range ids {
+        if _, err := entities.ParseOrderID(id); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+    }
+    
+    statuses, err := h.ReadModel.GetOrderStatuses(r.Context(), ids)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    notFound := []string{}
+    for _, id := range ids {
+        if _, ok := statuses[id]; !ok {
+            notFound = append(notFound, id)
+        }
+    }
+    
+    response := map[string]interface{}{
+        "statuses":  statuses,
+        "not_found": notFound,
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
+
+// uniqueIDs drops blank and repeated ids, keeping the first occurrence.
+func uniqueIDs(ids []string) []string {
+    seen := make(map[string]bool, len(ids))
+    unique := make([]string, 0, len(ids))
+    for _, id := range ids {
+        id = strings.TrimSpace(id)
+        if id == "" || seen[id] {
+            continue
+        }
+        seen[id] = true
+        unique = append(unique, id)
+    }
+    return unique
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// statusReadModel knows the statuses of a fixed set of orders and records the
+// ids it was asked for.
+type statusReadModel struct {
+    readmodels.OrderReadModel
+    statuses map[string]readmodels.OrderStatusDTO
+    asked    []string
+}
+
+func (rm *statusReadModel) GetOrderStatuses(_ context.Context, orderIDs []string) (map[string]readmodels.OrderStatusDTO, error) {
+    rm.asked = orderIDs
+    found := make(map[string]readmodels.OrderStatusDTO)
+    for _, id := range orderIDs {
+        if status, ok := rm.statuses[id]; ok {
+            found[id] = status
+        }
+    }
+    return found, nil
+}
+
+func TestOrderStatusesHandler(t *testing.T) {
+    confirmed, shipped, missing := uuid.NewString(), uuid.NewString(), uuid.NewString()
+    statuses := map[string]readmodels.OrderStatusDTO{
+        confirmed: {Status: "confirmed", Version: 2},
+        shipped:   {Status: "shipped", Version: 3},
+    }
+    tooMany := make([]string, maxOrderStatusIDs+1)
+    for i := range tooMany {
+        tooMany[i] = uuid.NewString()
+    }
+    
+    tests := []struct {
+        name         string
+        method       string
+        target       string
+        body         string
+        wantStatus   int
+        wantAsked    []string
+        wantNotFound []string
+    }{
+        {
+            name:         "comma separated and repeated ids",
+            method:       http.MethodGet,
+            target:       "/orders/statuses?ids=" + confirmed + "," + missing + "&ids=" + shipped + "," + confirmed,
+            wantStatus:   http.StatusOK,
+            wantAsked:    []string{confirmed, missing, shipped},
+            wantNotFound: []string{missing},
+        },
+        {
+            name:         "ids in the body",
+            method:       http.MethodPost,
+            target:       "/orders/statuses",
+            body:         `{"ids": ["` + shipped + `", "` + confirmed + `"]}`,
+            wantStatus:   http.StatusOK,
+            wantAsked:    []string{shipped, confirmed},
+            wantNotFound: []string{},
+        },
+        {name: "no ids", method: http.MethodGet, target: "/orders/statuses?ids=,", wantStatus: http.StatusBadRequest},
+        {name: "too many ids", method: http.MethodGet, target: "/orders/statuses?ids=" + strings.Join(tooMany, ","), wantStatus: http.StatusBadRequest},
+        {name: "invalid id", method: http.MethodGet, target: "/orders/statuses?ids=" + confirmed + ",nope", wantStatus: http.StatusBadRequest},
+        {name: "invalid body", method: http.MethodPost, target: "/orders/statuses", body: `{"ids": "`, wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rm := &statusReadModel{statuses: statuses}
+            handler := &OrderStatusesHandler{ReadModel: rm}
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                if rm.asked != nil {
+                    t.Errorf("read model asked for %v on a rejected request", rm.asked)
+                }
+                return
+            }
+            
+            if !reflect.DeepEqual(rm.asked, tt.wantAsked) {
+                t.Errorf("read model asked for %v, want %v", rm.asked, tt.wantAsked)
+            }
+            var body struct {
+                Statuses map[string]readmodels.OrderStatusDTO `json:"statuses"`
+                NotFound []string                              `json:"not_found"`
+            }
+            if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+                t.Fatalf("decoding response: %v", err)
+            }
+            if !reflect.DeepEqual(body.NotFound, tt.wantNotFound) {
+                t.Errorf("not_found = %v, want %v", body.NotFound, tt.wantNotFound)
+            }
+            for _, id := range tt.wantAsked {
+                if status, ok := statuses[id]; ok && body.Statuses[id] != status {
+                    t.Errorf("status of %s = %+v, want %+v", id, body.Statuses[id], status)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// OrderTagHandler adds (PUT) and removes (DELETE) an operational tag on an
+// order. Tags live only in the read model; the order aggregate never sees
+// them.
+type OrderTagHandler struct {
+    ReadModel readmodels.OrderReadModel
+}
+
+func (h *OrderTagHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    orderID, ok := orderIDVar(w, r)
+    if !ok {
+        return
+    }
+    tag := vars["tag"]
+    
+    var err error
+    switch r.Method {
+    case http.MethodPut:
+        err = h.ReadModel.AddTag(r.Context(), string(orderID), tag)
+    case http.MethodDelete:
+        err = h.ReadModel.RemoveTag(r.Context(), string(orderID), tag)
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    
+    if err != nil {
+        switch {
+        case errors.Is(err, readmodels.ErrInvalidTag), errors.Is(err, entities.ErrInvalidOrderID):
+            http.Error(w, err.Error(), http.StatusBadRequest)
+        case errors.Is(err, readmodels.ErrOrderNotFound):
+            http.Error(w, err.Error(), http.StatusNotFound)
+        default:
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+        }
+        return
+    }
+    
+    w.WriteHeader(http.StatusNoContent)
+}
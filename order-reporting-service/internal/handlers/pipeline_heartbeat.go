@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// pipelineStats is published as the "pipeline_latency" expvar: under
+// "heartbeats", a histogram of how long heartbeats took from the order
+// management service saving them to the reporting service receiving them.
+var (
+    pipelineStats   = expvar.NewMap("pipeline_latency")
+    pipelineLatency = newLatencyHistogram(pipelineStats, "heartbeats")
+)
+
+// latencyBounds are the upper bounds of the pipeline latency buckets;
+// slower heartbeats fall in the last, unbounded bucket.
+var latencyBounds = []time.Duration{
+    100 * time.Millisecond,
+    500 * time.Millisecond,
+    time.Second,
+    5 * time.Second,
+    10 * time.Second,
+    30 * time.Second,
+    time.Minute,
+    5 * time.Minute,
+}
+
+// HeartbeatObservation is the last heartbeat a PipelineHeartbeatMonitor
+// received.
+type HeartbeatObservation struct {
+    Source     string            `json:"source"`
+    SentAt     apijson.Timestamp `json:"sent_at"`
+    ReceivedAt apijson.Timestamp `json:"received_at"`
+    // LatencyMS is negative when the sender's clock runs ahead of ours
+    LatencyMS  float64           `json:"latency_ms"`
+}
+
+// PipelineHeartbeatMonitor measures the latency of the event pipeline from
+// the PipelineHeartbeatEvents the order management service sends: the time
+// from the heartbeat being saved to the outbox to a projection receiving
+// it. It writes no read model.
+type PipelineHeartbeatMonitor struct {
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+    
+    mu   sync.Mutex
+    last *HeartbeatObservation
+}
+
+func (m *PipelineHeartbeatMonitor) EventTypes() []string {
+    return []string{"PipelineHeartbeat"}
+}
+
+func (m *PipelineHeartbeatMonitor) Handle(ctx context.Context, event events.DomainEvent) error {
+    heartbeat, ok := event.(events.PipelineHeartbeatEvent)
+    if !ok {
+        return nil
+    }
+    now := clock.Now()
+    if m.Now != nil {
+        now = m.Now()
+    }
+    
+    latency := now.Sub(heartbeat.SentAt)
+    pipelineLatency.observe(latency)
+    
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.last = &HeartbeatObservation{
+        Source:     heartbeat.Source,
+        SentAt:     apijson.NewTimestamp(heartbeat.SentAt),
+        ReceivedAt: apijson.NewTimestamp(now),
+        LatencyMS:  float64(latency) / float64(time.Millisecond),
+    }
+    return nil
+}
+
+// Last returns the last heartbeat received, or nil before the first.
+func (m *PipelineHeartbeatMonitor) Last() *HeartbeatObservation {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    
+    if m.last == nil {
+        return nil
+    }
+    last := *m.last
+    return &last
+}
+
+// latencyHistogram counts pipeline latencies by bucket. Buckets are
+// cumulative: le_1s includes every heartbeat received within a second.
+type latencyHistogram struct {
+    mu      sync.Mutex
+    count   int64
+    total   time.Duration
+    buckets []int64
+}
+
+// newLatencyHistogram returns a histogram published in stats under key.
+func newLatencyHistogram(stats *expvar.Map, key string) *latencyHistogram {
+    h := &latencyHistogram{buckets: make([]int64, len(latencyBounds)+1)}
+    stats.Set(key, h)
+    return h
+}
+
+// observe records latency, counting a negative one, from clock skew
+// between the services, as zero.
+func (h *latencyHistogram) observe(latency time.Duration) {
+    if latency < 0 {
+        latency = 0
+    }
+    
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    h.count++
+    h.total += latency
+    for i, bound := range latencyBounds {
+        if latency <= bound {
+            h.buckets[i]++
+        }
+    }
+    h.buckets[len(latencyBounds)]++
+}
+
+// String renders the histogram as JSON for expvar.
+func (h *latencyHistogram) String() string {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    var b strings.Builder
+    fmt.Fprintf(&b, `{"count": %d, "total_ms": %.3f`, h.count, float64(h.total)/float64(time.Millisecond))
+    for i, bound := range latencyBounds {
+        fmt.Fprintf(&b, `, "le_%s": %d`, bound, h.buckets[i])
+    }
+    fmt.Fprintf(&b, `, "le_inf": %d}`, h.buckets[len(latencyBounds)])
+    return b.String()
+}
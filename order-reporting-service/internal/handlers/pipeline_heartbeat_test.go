@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+)
+
+// A heartbeat sent through the bus is measured from its send time to the
+// monitor receiving it, in the histogram and as the last observation; the
+// order projection's subscription never sees it.
+func TestPipelineHeartbeatMonitor_bus(t *testing.T) {
+    sentAt := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+    fake := clock.NewFake(sentAt)
+    defer clock.Set(fake)()
+    
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    bus := eventbus.NewInMemoryEventBus(nil)
+    monitor := &PipelineHeartbeatMonitor{Now: fake.Now}
+    if err := bus.Subscribe(ctx, []string{eventbus.DefaultTopic}, monitor.Handle, eventbus.WithEventTypes(monitor.EventTypes()...)); err != nil {
+        t.Fatal(err)
+    }
+    var projected []string
+    orders := &OrderProjectionHandler{}
+    record := func(_ context.Context, event events.DomainEvent) error {
+        projected = append(projected, event.Type())
+        return nil
+    }
+    if err := bus.Subscribe(ctx, []string{eventbus.DefaultTopic}, record, eventbus.WithEventTypes(orders.EventTypes()...)); err != nil {
+        t.Fatal(err)
+    }
+    
+    if monitor.Last() != nil {
+        t.Fatalf("Last() = %+v before any heartbeat, want nil", monitor.Last())
+    }
+    before := pipelineLatency.String()
+    
+    // The heartbeat goes through JSON as it would through the broker
+    data, err := json.Marshal(events.NewPipelineHeartbeatEvent("management-1", sentAt))
+    if err != nil {
+        t.Fatal(err)
+    }
+    heartbeat, err := events.DefaultRegistry().Unmarshal("PipelineHeartbeat", data)
+    if err != nil {
+        t.Fatalf("Unmarshal() = %v", err)
+    }
+    fake.Advance(1500 * time.Millisecond)
+    if err := bus.Publish(ctx, heartbeat); err != nil {
+        t.Fatalf("Publish() = %v", err)
+    }
+    
+    last := monitor.Last()
+    if last == nil || last.Source != "management-1" || last.LatencyMS != 1500 || !last.SentAt.Equal(sentAt) || !last.ReceivedAt.Equal(fake.Now()) {
+        t.Errorf("Last() = %+v, want 1500ms from management-1", last)
+    }
+    if len(projected) != 0 {
+        t.Errorf("order projection received %v, want nothing", projected)
+    }
+    if after := pipelineLatency.String(); after == before || !strings.Contains(after, `"le_1s`) {
+        t.Errorf("pipeline_latency = %s, want the heartbeat counted", after)
+    }
+}
+
+// Latencies count in every bucket at or above them; a negative latency,
+// from clock skew, counts as zero.
+func TestLatencyHistogram(t *testing.T) {
+    h := &latencyHistogram{buckets: make([]int64, len(latencyBounds)+1)}
+    for _, latency := range []time.Duration{-time.Second, 300 * time.Millisecond, 1500 * time.Millisecond, 10 * time.Minute} {
+        h.observe(latency)
+    }
+    
+    rendered := h.String()
+    for _, want := range []string{`"count": 4`, `"total_ms": 601800.000`, `"le_100ms": 1`, `"le_500ms": 2`, `"le_1s": 2`, `"le_5s": 3`, `"le_5m0s": 3`, `"le_inf": 4`} {
+        if !strings.Contains(rendered, want) {
+            t.Errorf("histogram = %s, want %s", rendered, want)
+        }
+    }
+}
+
+// A skewed sender shows as a negative last latency.
+func TestPipelineHeartbeatMonitor_skew(t *testing.T) {
+    now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+    monitor := &PipelineHeartbeatMonitor{Now: func() time.Time { return now }}
+    if err := monitor.Handle(context.Background(), events.NewPipelineHeartbeatEvent("management-1", now.Add(2*time.Second))); err != nil {
+        t.Fatalf("Handle() = %v", err)
+    }
+    if last := monitor.Last(); last == nil || last.LatencyMS != -2000 {
+        t.Errorf("Last() = %+v, want -2000ms", last)
+    }
+}
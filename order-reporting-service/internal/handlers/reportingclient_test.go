@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/order-reporting-service/reportingclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+)
+
+// The client decodes the v2 responses of the handlers it calls, mounted as
+// the service mounts them, and returns their error responses as
+// *apiclient.Error.
+func TestReportingClient(t *testing.T) {
+    ctx := context.Background()
+    rm := newFixedReadModel()
+    getOrderHandler := &GetOrderHandler{ReadModel: rm}
+    analyticsHandler := &GetOrderAnalyticsHandler{
+        ReadModel: rm,
+        Now:       func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) },
+    }
+    router := mux.NewRouter()
+    apiversion.DefaultRegistry(time.Time{}).Mount(router, func(r *mux.Router) {
+        r.HandleFunc("/orders/{id}", getOrderHandler.HandleHTTP).Methods("GET", "HEAD")
+        r.HandleFunc("/analytics/orders", analyticsHandler.HandleHTTP).Methods("GET", "HEAD")
+    })
+    server := httptest.NewServer(router)
+    defer server.Close()
+    client, err := reportingclient.New(apiclient.Config{BaseURL: server.URL, Retry: apiclient.NoRetry})
+    if err != nil {
+        t.Fatalf("reportingclient.New() = %v", err)
+    }
+    
+    order, err := client.GetOrder(ctx, rm.order.ID)
+    if err != nil {
+        t.Fatalf("GetOrder() = %v", err)
+    }
+    if order.ID != rm.order.ID || order.Status != rm.order.Status || order.Version != rm.order.Version {
+        t.Errorf("order = %+v, want %s %s at version %d", order, rm.order.ID, rm.order.Status, rm.order.Version)
+    }
+    if order.Totals.Items != rm.order.TotalAmount || order.Totals.Shipping != rm.order.ShippingCost || order.Totals.Grand != rm.order.GrandTotal {
+        t.Errorf("totals = %+v, want %v + %v = %v", order.Totals, rm.order.TotalAmount, rm.order.ShippingCost, rm.order.GrandTotal)
+    }
+    if !order.Timeline.CreatedAt.Equal(rm.order.CreatedAt.Time) || order.ShippingAddress != rm.order.ShippingAddress {
+        t.Errorf("order created %v at %+v, want %v at %+v", order.Timeline.CreatedAt, order.ShippingAddress, rm.order.CreatedAt, rm.order.ShippingAddress)
+    }
+    
+    if _, err := client.GetOrder(ctx, uuid.NewString()); apiclient.StatusCode(err) != http.StatusNotFound {
+        t.Errorf("GetOrder() of an unknown order = %v, want 404", err)
+    }
+    
+    analytics, err := client.GetAnalytics(ctx, reportingclient.AnalyticsQuery{Period: "all"})
+    if err != nil {
+        t.Fatalf("GetAnalytics() = %v", err)
+    }
+    want := rm.analytics
+    if analytics.TotalOrders != want.TotalOrders || analytics.Revenue.Total != want.TotalRevenue || analytics.Revenue.AverageOrderValue != want.AverageOrderValue {
+        t.Errorf("analytics = %+v, want %+v", analytics, want)
+    }
+    if analytics.Period != "all" || analytics.ByChannel["web"].Orders != 2 || analytics.OrdersByStatus["confirmed"] != 2 {
+        t.Errorf("analytics = %+v, want period all with 2 confirmed web orders", analytics)
+    }
+    
+    if _, err := client.GetAnalytics(ctx, reportingclient.AnalyticsQuery{Period: "fortnightly"}); apiclient.StatusCode(err) != http.StatusBadRequest {
+        t.Errorf("GetAnalytics() with an unknown period = %v, want 400", err)
+    }
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// OrderResponseV2 is the v2 order response. Money amounts are grouped under
+// totals and timestamps under timeline; v1 returns the flat OrderDTO.
+type OrderResponseV2 struct {
+    ID              string                    `json:"id"`
+    OrderNumber     string                    `json:"order_number,omitempty"`
+    CustomerID      string                    `json:"customer_id"`
+    ContactEmail    string                    `json:"contact_email,omitempty"`
+    Status          string                    `json:"status"`
+    Channel         string                    `json:"channel"`
+    Totals          OrderTotalsV2             `json:"totals"`
+    ShippingAddress valueobjects.Address      `json:"shipping_address"`
+    Items           []readmodels.OrderItemDTO `json:"items"`
+    Tags            []string                  `json:"tags"`
+    Version         int                       `json:"version"`
+    Timeline        OrderTimelineV2           `json:"timeline"`
+    Delivery        *readmodels.DeliveryDTO   `json:"delivery,omitempty"`
+    Cancellation    *readmodels.CancellationDTO `json:"cancellation,omitempty"`
+    Meta            *readmodels.OrderMetaDTO  `json:"meta,omitempty"`
+    Archived        bool                      `json:"archived,omitempty"`
+}
+
+type OrderTotalsV2 struct {
+    Items    valueobjects.Money `json:"items"`
+    Shipping valueobjects.Money `json:"shipping"`
+    Grand    valueobjects.Money `json:"grand"`
+}
+
+type OrderTimelineV2 struct {
+    CreatedAt       apijson.Timestamp `json:"created_at"`
+    UpdatedAt       apijson.Timestamp `json:"updated_at"`
+    StatusChangedAt apijson.Timestamp `json:"status_changed_at"`
+}
+
+// orderResponses leaves v1 orders as the read model returns them.
+var orderResponses = apiversion.Responses[*readmodels.OrderDTO]{
+    apiversion.V2: func(order *readmodels.OrderDTO) interface{} {
+        return OrderResponseV2{
+            ID:           order.ID,
+            OrderNumber:  order.OrderNumber,
+            CustomerID:   order.CustomerID,
+            ContactEmail: order.ContactEmail,
+            Status:       order.Status,
+            Channel:      order.Channel,
+            Totals: OrderTotalsV2{
+                Items:    order.TotalAmount,
+                Shipping: order.ShippingCost,
+                Grand:    order.GrandTotal,
+            },
+            ShippingAddress: order.ShippingAddress,
+            Items:           order.Items,
+            Tags:            order.Tags,
+            Version:         order.Version,
+            Timeline: OrderTimelineV2{
+                CreatedAt:       order.CreatedAt,
+                UpdatedAt:       order.UpdatedAt,
+                StatusChangedAt: order.StatusChangedAt,
+            },
+            Delivery:     order.Delivery,
+            Cancellation: order.Cancellation,
+            Meta:         order.Meta,
+            Archived:     order.Archived,
+        }
+    },
+}
+
+// analyticsResult is what GetOrderAnalyticsHandler computes, before it is
+// shaped for the requested version.
+type analyticsResult struct {
+    Window          timewindow.Window
+    IncludeShipping bool
+    Analytics       *readmodels.OrderAnalyticsDTO
+    // CachedAt is set when the database failed and Analytics are the last
+    // cached, computed at CachedAt
+    CachedAt        *apijson.Timestamp
+}
+
+// windowBounds returns the bounds of window for a response, nil for
+// period all.
+func windowBounds(window timewindow.Window) (from, to *apijson.Timestamp) {
+    if window.Unbounded() {
+        return nil, nil
+    }
+    fromTimestamp, toTimestamp := apijson.NewTimestamp(window.From), apijson.NewTimestamp(window.To)
+    return &fromTimestamp, &toTimestamp
+}
+
+// OrderAnalyticsResponseV2 is the v2 analytics response. The figures sit at
+// the top level, with revenue grouped, rather than under "analytics".
+type OrderAnalyticsResponseV2 struct {
+    Period          string           `json:"period"`
+    // From and To bound the window covered, null for period all; days
+    // start at midnight in Timezone
+    From            *apijson.Timestamp `json:"from"`
+    To              *apijson.Timestamp `json:"to"`
+    Timezone        string           `json:"timezone"`
+    IncludeShipping bool             `json:"include_shipping"`
+    TotalOrders     int64            `json:"total_orders"`
+    Revenue         RevenueV2        `json:"revenue"`
+    OrdersByStatus  map[string]int64 `json:"orders_by_status"`
+    ByChannel       map[string]readmodels.ChannelAnalyticsDTO `json:"by_channel"`
+    CancellationsByReason map[string]int64                    `json:"cancellations_by_reason"`
+    // Stale and CachedAt are set when the analytics are the last cached
+    Stale           bool                                      `json:"stale,omitempty"`
+    CachedAt        *apijson.Timestamp                        `json:"cached_at,omitempty"`
+}
+
+type RevenueV2 struct {
+    Total             int64 `json:"total"`
+    Shipping          int64 `json:"shipping"`
+    AverageOrderValue int64 `json:"average_order_value"`
+}
+
+var analyticsResponses = apiversion.Responses[analyticsResult]{
+    apiversion.V1: func(result analyticsResult) interface{} {
+        from, to := windowBounds(result.Window)
+        response := map[string]interface{}{
+            "period": result.Window.Period,
+            "from": from,
+            "to": to,
+            "timezone": result.Window.Location.String(),
+            "include_shipping": result.IncludeShipping,
+            "analytics": result.Analytics,
+        }
+        if result.CachedAt != nil {
+            response["stale"] = true
+            response["cached_at"] = result.CachedAt
+        }
+        return response
+    },
+    apiversion.V2: func(result analyticsResult) interface{} {
+        from, to := windowBounds(result.Window)
+        return OrderAnalyticsResponseV2{
+            Period:          string(result.Window.Period),
+            From:            from,
+            To:              to,
+            Timezone:        result.Window.Location.String(),
+            IncludeShipping: result.IncludeShipping,
+            TotalOrders:     result.Analytics.TotalOrders,
+            Revenue: RevenueV2{
+                Total:             result.Analytics.TotalRevenue,
+                Shipping:          result.Analytics.ShippingRevenue,
+                AverageOrderValue: result.Analytics.AverageOrderValue,
+            },
+            OrdersByStatus: result.Analytics.OrdersByStatus,
+            ByChannel:      result.Analytics.ByChannel,
+            CancellationsByReason: result.Analytics.CancellationsByReason,
+            Stale:          result.CachedAt != nil,
+            CachedAt:       result.CachedAt,
+        }
+    },
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// fixedReadModel returns one order and one set of analytics.
+type fixedReadModel struct {
+    readmodels.OrderReadModel
+    order     readmodels.OrderDTO
+    analytics readmodels.OrderAnalyticsDTO
+}
+
+func (rm *fixedReadModel) GetOrder(_ context.Context, orderID string) (*readmodels.OrderDTO, error) {
+    if orderID != rm.order.ID {
+        return nil, readmodels.ErrOrderNotFound
+    }
+    order := rm.order
+    return &order, nil
+}
+
+func (rm *fixedReadModel) GetOrderAnalytics(context.Context, timewindow.Window, bool) (*readmodels.OrderAnalyticsDTO, error) {
+    analytics := rm.analytics
+    return &analytics, nil
+}
+
+func newFixedReadModel() *fixedReadModel {
+    at := apijson.NewTimestamp(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    return &fixedReadModel{
+        order: readmodels.OrderDTO{
+            ID:              uuid.NewString(),
+            CustomerID:      "customer-1",
+            Status:          valueobjects.OrderStatusConfirmed.String(),
+            TotalAmount:     valueobjects.NewMoney(2000, "USD"),
+            ShippingCost:    valueobjects.NewMoney(500, "USD"),
+            GrandTotal:      valueobjects.NewMoney(2500, "USD"),
+            ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+            Channel:         "web",
+            Items:           []readmodels.OrderItemDTO{},
+            Version:         2,
+            StatusChangedAt: at,
+            CreatedAt:       at,
+            UpdatedAt:       at,
+            Tags:            []string{},
+        },
+        analytics: readmodels.OrderAnalyticsDTO{
+            TotalOrders:       2,
+            TotalRevenue:      5000,
+            ShippingRevenue:   1000,
+            AverageOrderValue: 2500,
+            OrdersByStatus:    map[string]int64{"confirmed": 2},
+            ByChannel:         map[string]readmodels.ChannelAnalyticsDTO{"web": {Orders: 2, Revenue: 5000}},
+            CancellationsByReason: map[string]int64{},
+        },
+    }
+}
+
+// serveVersion serves req with handler as the given API version, returning
+// the decoded response body.
+func serveVersion(t *testing.T, handler http.HandlerFunc, req *http.Request, version apiversion.Version) map[string]interface{} {
+    t.Helper()
+    recorder := httptest.NewRecorder()
+    handler(recorder, req.WithContext(apiversion.WithVersion(req.Context(), version)))
+    if recorder.Code != http.StatusOK {
+        t.Fatalf("%s status = %d, want 200: %s", version, recorder.Code, recorder.Body)
+    }
+    var body map[string]interface{}
+    if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+        t.Fatalf("decoding %s body: %v", version, err)
+    }
+    return body
+}
+
+func sortedKeys(body map[string]interface{}) []string {
+    keys := make([]string, 0, len(body))
+    for key := range body {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// The order response keeps its flat v1 shape and groups totals and
+// timestamps in v2.
+func TestGetOrderHandler_versions(t *testing.T) {
+    rm := newFixedReadModel()
+    handler := &GetOrderHandler{ReadModel: rm}
+    req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/orders/"+rm.order.ID, nil), map[string]string{"id": rm.order.ID})
+    
+    v1 := serveVersion(t, handler.HandleHTTP, req, apiversion.V1)
+    wantV1 := []string{
+        "channel", "created_at", "customer_id", "grand_total", "id", "items", "shipping_address",
+        "shipping_cost", "status", "status_changed_at", "tags", "total_amount", "updated_at", "version",
+    }
+    if got := sortedKeys(v1); !reflect.DeepEqual(got, wantV1) {
+        t.Errorf("v1 order keys = %v, want %v", got, wantV1)
+    }
+    
+    v2 := serveVersion(t, handler.HandleHTTP, req, apiversion.V2)
+    wantV2 := []string{
+        "channel", "customer_id", "id", "items", "shipping_address", "status", "tags", "timeline", "totals", "version",
+    }
+    if got := sortedKeys(v2); !reflect.DeepEqual(got, wantV2) {
+        t.Errorf("v2 order keys = %v, want %v", got, wantV2)
+    }
+    totals, _ := v2["totals"].(map[string]interface{})
+    wantTotals := map[string]interface{}{"items": v1["total_amount"], "shipping": v1["shipping_cost"], "grand": v1["grand_total"]}
+    if !reflect.DeepEqual(totals, wantTotals) {
+        t.Errorf("v2 totals = %v, want %v", totals, wantTotals)
+    }
+    timeline, _ := v2["timeline"].(map[string]interface{})
+    wantTimeline := map[string]interface{}{"created_at": v1["created_at"], "updated_at": v1["updated_at"], "status_changed_at": v1["status_changed_at"]}
+    if !reflect.DeepEqual(timeline, wantTimeline) {
+        t.Errorf("v2 timeline = %v, want %v", timeline, wantTimeline)
+    }
+}
+
+// The analytics response nests the figures under "analytics" in v1 and
+// lifts them to the top level, with revenue grouped, in v2.
+func TestGetOrderAnalyticsHandler_versions(t *testing.T) {
+    handler := &GetOrderAnalyticsHandler{
+        ReadModel: newFixedReadModel(),
+        Now:       func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) },
+    }
+    req := httptest.NewRequest(http.MethodGet, "/analytics/orders?period=all", nil)
+    
+    v1 := serveVersion(t, handler.HandleHTTP, req, apiversion.V1)
+    if got, want := sortedKeys(v1), []string{"analytics", "from", "include_shipping", "period", "timezone", "to"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("v1 analytics keys = %v, want %v", got, want)
+    }
+    analytics, _ := v1["analytics"].(map[string]interface{})
+    if analytics["total_revenue"] != 5000.0 || analytics["total_orders"] != 2.0 {
+        t.Errorf("v1 analytics = %v, want total_revenue 5000 and total_orders 2", analytics)
+    }
+    
+    v2 := serveVersion(t, handler.HandleHTTP, req, apiversion.V2)
+    wantV2 := []string{
+        "by_channel", "cancellations_by_reason", "from", "include_shipping", "orders_by_status",
+        "period", "revenue", "timezone", "to", "total_orders",
+    }
+    if got := sortedKeys(v2); !reflect.DeepEqual(got, wantV2) {
+        t.Errorf("v2 analytics keys = %v, want %v", got, wantV2)
+    }
+    wantRevenue := map[string]interface{}{"total": 5000.0, "shipping": 1000.0, "average_order_value": 2500.0}
+    if !reflect.DeepEqual(v2["revenue"], wantRevenue) {
+        t.Errorf("v2 revenue = %v, want %v", v2["revenue"], wantRevenue)
+    }
+}
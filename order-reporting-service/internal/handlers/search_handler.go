@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+const (
+    minSearchQueryLength = 2
+    maxSearchQueryLength = 100
+    // searchHitsPerType caps the orders and the customers returned
+    searchHitsPerType = 20
+)
+
+// idFragmentPattern matches a fragment of a UUID, such as "7f3a" or
+// "7f3a9c2e-41", optionally behind an "ord-" or "order-" label.
+var idFragmentPattern = regexp.MustCompile(`^(?:ord(?:er)?-)?([0-9a-f]{4,}(?:-[0-9a-f]*)*)$`)
+
+// searchPlan is the set of lookups a search query runs.
+type searchPlan struct {
+    // OrderIDPrefix looks orders up by id prefix when set
+    OrderIDPrefix string
+    Customers     readmodels.CustomerSearch
+}
+
+// planSearch picks lookups from the shape of q. An id fragment searches
+// order and customer ids; a fragment containing @ searches emails; anything
+// else searches names and emails. Short hex words such as "cafe" are both
+// an id fragment and a name, so they search both.
+func planSearch(q string) searchPlan {
+    q = strings.TrimSpace(q)
+    lower := strings.ToLower(q)
+    
+    var plan searchPlan
+    if match := idFragmentPattern.FindStringSubmatch(lower); match != nil {
+        plan.OrderIDPrefix = match[1]
+        plan.Customers.IDPrefix = match[1]
+        if strings.ContainsAny(lower, "-0123456789") {
+            return plan
+        }
+    }
+    
+    if strings.Contains(q, "@") {
+        plan.Customers.EmailPrefix = q
+        return plan
+    }
+    
+    plan.Customers.NameContains = q
+    plan.Customers.EmailPrefix = q
+    return plan
+}
+
+// SearchHandler finds orders and customers matching ?q=, which may be an
+// order or customer id fragment, an email fragment, or part of a name. It
+// returns up to 20 hits of each type.
+type SearchHandler struct {
+    ReadModel readmodels.SearchReadModel
+}
+
+func (h *SearchHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    q := strings.TrimSpace(r.URL.Query().Get("q"))
+    if len(q) < minSearchQueryLength || len(q) > maxSearchQueryLength {
+        http.Error(w, "q must be between 2 and 100 characters", http.StatusBadRequest)
+        return
+    }
+    
+    plan := planSearch(q)
+    results := []readmodels.SearchHit{}
+    
+    if plan.OrderIDPrefix != "" {
+        orders, err := h.ReadModel.FindOrdersByIDPrefix(r.Context(), plan.OrderIDPrefix, searchHitsPerType)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        results = append(results, orders...)
+    }
+    
+    customers, err := h.ReadModel.FindCustomers(r.Context(), plan.Customers, searchHitsPerType)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    results = append(results, customers...)
+    
+    apijson.Write(w, r, http.StatusOK, map[string]interface{}{
+        "query":   q,
+        "results": results,
+    })
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+func TestPlanSearch(t *testing.T) {
+    tests := []struct {
+        name string
+        q    string
+        want searchPlan
+    }{
+        {
+            name: "order reference",
+            q:    "ORD-7f3a",
+            want: searchPlan{OrderIDPrefix: "7f3a", Customers: readmodels.CustomerSearch{IDPrefix: "7f3a"}},
+        },
+        {
+            name: "uuid fragment",
+            q:    "7f3a9c2e-41",
+            want: searchPlan{OrderIDPrefix: "7f3a9c2e-41", Customers: readmodels.CustomerSearch{IDPrefix: "7f3a9c2e-41"}},
+        },
+        {
+            name: "hex word is an id and a name",
+            q:    "Cafe",
+            want: searchPlan{OrderIDPrefix: "cafe", Customers: readmodels.CustomerSearch{IDPrefix: "cafe", NameContains: "Cafe", EmailPrefix: "Cafe"}},
+        },
+        {
+            name: "email fragment",
+            q:    " jane@ ",
+            want: searchPlan{Customers: readmodels.CustomerSearch{EmailPrefix: "jane@"}},
+        },
+        {
+            name: "free text",
+            q:    "Jane Doe",
+            want: searchPlan{Customers: readmodels.CustomerSearch{NameContains: "Jane Doe", EmailPrefix: "Jane Doe"}},
+        },
+        {
+            name: "too short for an id",
+            q:    "7f3",
+            want: searchPlan{Customers: readmodels.CustomerSearch{NameContains: "7f3", EmailPrefix: "7f3"}},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := planSearch(tt.q); got != tt.want {
+                t.Errorf("planSearch(%q) = %+v, want %+v", tt.q, got, tt.want)
+            }
+        })
+    }
+}
+
+// recordingSearch returns one hit of each type and records the lookups it
+// was asked for.
+type recordingSearch struct {
+    orderPrefix string
+    customers   readmodels.CustomerSearch
+    limits      []int
+}
+
+func (s *recordingSearch) FindOrdersByIDPrefix(_ context.Context, prefix string, limit int) ([]readmodels.SearchHit, error) {
+    s.orderPrefix = prefix
+    s.limits = append(s.limits, limit)
+    return []readmodels.SearchHit{{Type: readmodels.SearchHitOrder, ID: prefix + "-order"}}, nil
+}
+
+func (s *recordingSearch) FindCustomers(_ context.Context, search readmodels.CustomerSearch, limit int) ([]readmodels.SearchHit, error) {
+    s.customers = search
+    s.limits = append(s.limits, limit)
+    return []readmodels.SearchHit{{Type: readmodels.SearchHitCustomer, ID: "customer"}}, nil
+}
+
+func TestSearchHandler(t *testing.T) {
+    tests := []struct {
+        name       string
+        q          string
+        wantStatus int
+        wantTypes  []string
+    }{
+        {name: "id fragment searches orders and customers", q: "ord-7f3a", wantStatus: http.StatusOK, wantTypes: []string{"order", "customer"}},
+        {name: "email searches customers", q: "jane@", wantStatus: http.StatusOK, wantTypes: []string{"customer"}},
+        {name: "too short", q: " j ", wantStatus: http.StatusBadRequest},
+        {name: "too long", q: strings.Repeat("a", 101), wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            search := &recordingSearch{}
+            handler := &SearchHandler{ReadModel: search}
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodGet, "/search?q="+url.QueryEscape(tt.q), nil))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+            
+            var body struct {
+                Results []readmodels.SearchHit `json:"results"`
+            }
+            if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+                t.Fatalf("decoding response: %v", err)
+            }
+            var types []string
+            for _, hit := range body.Results {
+                types = append(types, hit.Type)
+            }
+            if !reflect.DeepEqual(types, tt.wantTypes) {
+                t.Errorf("result types = %v, want %v", types, tt.wantTypes)
+            }
+            for _, limit := range search.limits {
+                if limit != searchHitsPerType {
+                    t.Errorf("lookup limit = %d, want %d", limit, searchHitsPerType)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+const maxSLABreachesLimit = 500
+
+var validBreachStates = map[string]bool{
+    "open":     true,
+    "resolved": true,
+    "all":      true,
+}
+
+type ListSLABreachesHandler struct {
+    ReadModel readmodels.SLABreachReadModel
+}
+
+func (h *ListSLABreachesHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    customerID, ok := customerIDParam(w, r)
+    if !ok {
+        return
+    }
+    query := r.URL.Query()
+    filter := readmodels.SLABreachFilter{
+        State:      query.Get("state"),
+        BreachType: query.Get("breach_type"),
+        CustomerID: customerID,
+    }
+    if filter.State == "" {
+        filter.State = "open"
+    }
+    if !validBreachStates[filter.State] {
+        http.Error(w, "Invalid state. Must be one of: open, resolved, all", http.StatusBadRequest)
+        return
+    }
+    if since := query.Get("detected_since"); since != "" {
+        parsed, err := time.Parse(time.RFC3339, since)
+        if err != nil {
+            http.Error(w, "detected_since must be an RFC 3339 timestamp", http.StatusBadRequest)
+            return
+        }
+        filter.DetectedSince = parsed
+    }
+    
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 50}, maxSLABreachesLimit)
+    if err != nil {
+        pagination.WriteError(w, err)
+        return
+    }
+    
+    breaches, err := h.ReadModel.ListBreaches(r.Context(), filter, page)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    response := map[string]interface{}{
+        "breaches": breaches,
+        "pagination": map[string]interface{}{
+            "limit":  page.Limit,
+            "offset": page.Offset,
+            "count":  len(breaches),
+        },
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// slaStats is published as the "order_sla_breaches" expvar: breaches
+// detected and evaluations that failed since start, and the breaches open
+// after the last evaluation by breach type under "open".
+var slaStats = expvar.NewMap("order_sla_breaches")
+
+// SLAEvaluator periodically records confirmed orders that were not shipped
+// within ShipWithin. Breaches are resolved by the status duration
+// projection when the order moves on.
+type SLAEvaluator struct {
+    // Disabled makes Run return at once
+    Disabled   bool
+    ReadModel  readmodels.SLABreachReadModel
+    ShipWithin time.Duration
+    Interval   time.Duration
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+}
+
+// Run evaluates once at start and then every Interval until ctx is done.
+func (e *SLAEvaluator) Run(ctx context.Context) error {
+    if e.Disabled {
+        return nil
+    }
+    
+    ticker := time.NewTicker(e.Interval)
+    defer ticker.Stop()
+    
+    for {
+        if detected, err := e.EvaluateOnce(ctx); err != nil {
+            log.Printf("Error evaluating order SLAs: %v", err)
+        } else if detected > 0 {
+            log.Printf("Detected %d order SLA breaches", detected)
+        }
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// EvaluateOnce records new breaches, refreshes the open breach gauge and
+// returns how many breaches it recorded.
+func (e *SLAEvaluator) EvaluateOnce(ctx context.Context) (int64, error) {
+    now := clock.Now()
+    if e.Now != nil {
+        now = e.Now()
+    }
+    
+    detected, err := e.ReadModel.DetectNotShipped(ctx, e.ShipWithin, now)
+    if err != nil {
+        slaStats.Add("errors", 1)
+        return 0, err
+    }
+    slaStats.Add("detected", detected)
+    
+    counts, err := e.ReadModel.CountOpen(ctx)
+    if err != nil {
+        slaStats.Add("errors", 1)
+        return detected, err
+    }
+    open := new(expvar.Map)
+    for breachType, count := range counts {
+        open.Add(breachType, count)
+    }
+    slaStats.Set("open", open)
+    
+    return detected, nil
+}
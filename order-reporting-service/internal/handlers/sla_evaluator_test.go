@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// memorySLA tracks when orders were confirmed, as the status duration read
+// model does, and records their breaches in memory. Time on hold is not
+// modelled.
+type memorySLA struct {
+    readmodels.StatusDurationReadModel
+    confirmedAt map[string]time.Time
+    breaches    map[string]*readmodels.SLABreachDTO
+    // filters records the filters ListBreaches was asked for
+    filters     []readmodels.SLABreachFilter
+}
+
+func newMemorySLA() *memorySLA {
+    return &memorySLA{confirmedAt: make(map[string]time.Time), breaches: make(map[string]*readmodels.SLABreachDTO)}
+}
+
+func (m *memorySLA) TrackOrder(context.Context, string, string, time.Time) error {
+    return nil
+}
+
+func (m *memorySLA) RecordStatusChange(_ context.Context, orderID, status string, _ int, changedAt time.Time) error {
+    if status == "confirmed" {
+        m.confirmedAt[orderID] = changedAt
+    } else if status != "on_hold" {
+        delete(m.confirmedAt, orderID)
+    }
+    return nil
+}
+
+func (m *memorySLA) DetectNotShipped(_ context.Context, shipWithin time.Duration, now time.Time) (int64, error) {
+    var detected int64
+    for orderID, confirmedAt := range m.confirmedAt {
+        deadline := confirmedAt.Add(shipWithin)
+        if _, ok := m.breaches[orderID]; ok || !deadline.Before(now) {
+            continue
+        }
+        m.breaches[orderID] = &readmodels.SLABreachDTO{
+            OrderID:     orderID,
+            BreachType:  readmodels.BreachNotShipped,
+            ConfirmedAt: apijson.NewTimestamp(confirmedAt),
+            DeadlineAt:  apijson.NewTimestamp(deadline),
+            DetectedAt:  apijson.NewTimestamp(now),
+        }
+        detected++
+    }
+    return detected, nil
+}
+
+func (m *memorySLA) ResolveBreaches(_ context.Context, orderID, status string, changedAt time.Time) error {
+    if breach, ok := m.breaches[orderID]; ok && breach.ResolvedAt == nil {
+        resolvedAt := apijson.NewTimestamp(changedAt)
+        breach.ResolvedAt, breach.Resolution = &resolvedAt, status
+    }
+    return nil
+}
+
+func (m *memorySLA) ListBreaches(_ context.Context, filter readmodels.SLABreachFilter, _ pagination.Pagination) ([]*readmodels.SLABreachDTO, error) {
+    m.filters = append(m.filters, filter)
+    breaches := []*readmodels.SLABreachDTO{}
+    for _, breach := range m.breaches {
+        breaches = append(breaches, breach)
+    }
+    return breaches, nil
+}
+
+func (m *memorySLA) CountOpen(context.Context) (map[string]int64, error) {
+    counts := make(map[string]int64)
+    for _, breach := range m.breaches {
+        if breach.ResolvedAt == nil {
+            counts[breach.BreachType]++
+        }
+    }
+    return counts, nil
+}
+
+func openBreachesStat() string {
+    if open := slaStats.Get("open"); open != nil {
+        return open.String()
+    }
+    return ""
+}
+
+// Orders confirmed and not shipped within the deadline are detected once,
+// holding an order leaves its breach open, and shipping resolves it.
+func TestSLAEvaluator_detectAndResolve(t *testing.T) {
+    ctx := context.Background()
+    start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    fake := clock.NewFake(start)
+    defer clock.Set(fake)()
+    
+    sla := newMemorySLA()
+    projection := &StatusDurationProjectionHandler{ReadModel: sla, SLABreaches: sla}
+    evaluator := &SLAEvaluator{ReadModel: sla, ShipWithin: 48 * time.Hour, Now: fake.Now}
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    apply := func(event events.DomainEvent) {
+        t.Helper()
+        if err := projection.Handle(ctx, event); err != nil {
+            t.Fatalf("Handle(%s) = %v", event.Type(), err)
+        }
+    }
+    evaluate := func(want int64) {
+        t.Helper()
+        if detected, err := evaluator.EvaluateOnce(ctx); err != nil || detected != want {
+            t.Fatalf("EvaluateOnce() at %s = %d, %v, want %d", fake.Now().Sub(start), detected, err, want)
+        }
+    }
+    
+    apply(events.NewOrderCreatedEvent(order))
+    apply(events.NewOrderConfirmedEvent(order))
+    fake.Advance(48 * time.Hour)
+    evaluate(0)
+    
+    fake.Advance(time.Minute)
+    evaluate(1)
+    evaluate(0)
+    if got, want := openBreachesStat(), `{"confirmed_not_shipped": 1}`; got != want {
+        t.Errorf("open breaches = %s, want %s", got, want)
+    }
+    
+    fake.Advance(time.Hour)
+    apply(events.NewOrderHeldEvent(order))
+    if breach := sla.breaches[string(order.ID)]; breach.ResolvedAt != nil {
+        t.Errorf("holding the order resolved its breach as %s", breach.Resolution)
+    }
+    
+    fake.Advance(time.Hour)
+    apply(events.NewOrderShippedEvent(order))
+    evaluate(0)
+    breach := sla.breaches[string(order.ID)]
+    if breach.ResolvedAt == nil || !breach.ResolvedAt.Equal(fake.Now()) || breach.Resolution != "shipped" {
+        t.Errorf("breach after shipping = %+v, want resolved as shipped at %v", breach, fake.Now())
+    }
+    if got := openBreachesStat(); got != "{}" {
+        t.Errorf("open breaches after shipping = %s, want none", got)
+    }
+}
+
+func TestSLAEvaluator_Run_disabled(t *testing.T) {
+    // A nil read model would panic if the disabled evaluator used it
+    if err := (&SLAEvaluator{Disabled: true}).Run(context.Background()); err != nil {
+        t.Errorf("Run() = %v, want nil", err)
+    }
+}
+
+func TestListSLABreachesHandler(t *testing.T) {
+    since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name       string
+        query      string
+        wantStatus int
+        wantFilter readmodels.SLABreachFilter
+    }{
+        {name: "open by default", wantStatus: http.StatusOK, wantFilter: readmodels.SLABreachFilter{State: "open"}},
+        {
+            name:       "every filter",
+            query:      "state=all&breach_type=confirmed_not_shipped&detected_since=2024-03-01T00:00:00Z",
+            wantStatus: http.StatusOK,
+            wantFilter: readmodels.SLABreachFilter{State: "all", BreachType: readmodels.BreachNotShipped, DetectedSince: since},
+        },
+        {name: "unknown state", query: "state=late", wantStatus: http.StatusBadRequest},
+        {name: "malformed detected_since", query: "detected_since=yesterday", wantStatus: http.StatusBadRequest},
+        {name: "malformed customer", query: "customer_id=customer-1", wantStatus: http.StatusBadRequest},
+        {name: "limit over the maximum", query: "limit=501", wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            sla := newMemorySLA()
+            handler := &ListSLABreachesHandler{ReadModel: sla}
+            recorder := httptest.NewRecorder()
+            handler.HandleHTTP(recorder, httptest.NewRequest(http.MethodGet, "/analytics/sla-breaches?"+tt.query, nil))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                if len(sla.filters) != 0 {
+                    t.Errorf("read the breaches of a refused request")
+                }
+                return
+            }
+            
+            if !reflect.DeepEqual(sla.filters, []readmodels.SLABreachFilter{tt.wantFilter}) {
+                t.Errorf("filters = %+v, want %+v", sla.filters, tt.wantFilter)
+            }
+            var body map[string]interface{}
+            if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+                t.Fatalf("decoding body: %v", err)
+            }
+            if _, ok := body["breaches"].([]interface{}); !ok {
+                t.Errorf("body = %v, want a breaches list", body)
+            }
+        })
+    }
+}
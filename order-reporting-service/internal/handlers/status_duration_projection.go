@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// StatusDurationProjectionHandler records the status transitions behind the
+// status duration analytics, and resolves the SLA breaches of orders that
+// leave the confirmed status for good. Holding an order resolves nothing:
+// its shipping clock stops until it is released.
+type StatusDurationProjectionHandler struct {
+    ReadModel   readmodels.StatusDurationReadModel
+    // SLABreaches is optional
+    SLABreaches readmodels.SLABreachReadModel
+}
+
+// EventTypes lists the events Handle applies: the creation and those
+// statusAfter knows.
+func (h *StatusDurationProjectionHandler) EventTypes() []string {
+    return []string{"OrderCreated", "OrderConfirmed", "OrderShipped", "OrderDelivered", "OrderCancelled", "OrderReopened", "OrderHeld", "OrderReleased"}
+}
+
+func (h *StatusDurationProjectionHandler) Handle(ctx context.Context, event events.DomainEvent) error {
+    if _, ok := event.(events.OrderCreatedEvent); ok {
+        return h.ReadModel.TrackOrder(ctx, event.AggregateID(), "draft", event.OccurredAt())
+    }
+    
+    status, ok := statusAfter(event)
+    if !ok {
+        return nil
+    }
+    if err := h.ReadModel.RecordStatusChange(ctx, event.AggregateID(), status, event.Sequence(), event.OccurredAt()); err != nil {
+        return err
+    }
+    if h.SLABreaches == nil || status == "confirmed" || status == "on_hold" {
+        return nil
+    }
+    return h.SLABreaches.ResolveBreaches(ctx, event.AggregateID(), status, event.OccurredAt())
+}
+
+// statusAfter returns the status an event moves its order to, if it changes
+// the order's status.
+func statusAfter(event events.DomainEvent) (string, bool) {
+    status, ok := events.StatusAfter(event)
+    return status.String(), ok
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// GetStatusDurationsHandler reports the time orders spent in each status,
+// from the transitions in a window as timewindow.ParsePeriod reads it.
+type GetStatusDurationsHandler struct {
+    ReadModel readmodels.OrderReadModel
+    // Now returns the current time; it defaults to clock.Now
+    Now       func() time.Time
+}
+
+func (h *GetStatusDurationsHandler) HandleHTTP(w http.ResponseWriter, r *http.Request) {
+    now := clock.Now
+    if h.Now != nil {
+        now = h.Now
+    }
+    window, err := timewindow.ParsePeriod(r.URL.Query(), now(), time.UTC)
+    if err != nil {
+        timewindow.WriteError(w, err)
+        return
+    }
+    
+    durations, err := h.ReadModel.GetStatusDurations(r.Context(), window)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    from, to := windowBounds(window)
+    response := map[string]interface{}{
+        "period":    window.Period,
+        "from":      from,
+        "to":        to,
+        "timezone":  window.Location.String(),
+        "durations": durations.Durations,
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
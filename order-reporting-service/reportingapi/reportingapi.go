@@ -0,0 +1,1066 @@
+// Package reportingapi exposes the order reporting query side for embedding
+// in another binary. The standalone service in cmd is wired through it too.
+//
+// The minimal dependency set is a *sql.DB holding the read model tables, a
+// Redis client for the read model cache, and an eventbus.EventBus to consume
+// order events from. The embedding binary starts the consumer returned by
+// NewEventConsumer, which runs each projection under its own consumer
+// group, and runs the publisher returned by NewOutboxPublisher, the
+// archiver returned by NewOutboxArchiver if it wants processed events
+// archived, the evaluator returned by NewSLAEvaluator if it wants
+// fulfillment SLA breaches recorded, the evaluator returned by
+// NewCancellationAnomalyEvaluator if it wants cancellation rate spikes
+// detected, the archiver returned by NewOrderArchiver if it wants old
+// orders archived, and ReadModels.CacheRefresher and
+// ReadModels.Deduplicator when they are set. A new deployment whose broker no longer retains the whole history
+// runs Bootstrap before starting the consumer.
+package reportingapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vdntruong/dddcqrs/order-reporting-service/internal/handlers"
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/distlock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/featureflags"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventfeed"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/reconcile"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+	"github.com/vdntruong/dddcqrs/shared/schema"
+)
+
+// DefaultOutboxTable holds events derived by the projections. It differs
+// from the command side's outbox so the services can share a database.
+const DefaultOutboxTable = "reporting_outbox_events"
+
+// DefaultProjectionGroupPrefix prefixes the consumer groups of the
+// projections that do not use the event bus's own group.
+const DefaultProjectionGroupPrefix = "order-reporting-service"
+
+// DefaultGroupID returns the consumer group the service consumes as in
+// environment: DefaultProjectionGroupPrefix suffixed with the environment
+// name, so deployments sharing a broker do not share offsets. Without an
+// environment it is the prefix alone, the group deployments used before
+// environments were named.
+func DefaultGroupID(environment string) string {
+    if environment == "" {
+        return DefaultProjectionGroupPrefix
+    }
+    return DefaultProjectionGroupPrefix + "-" + environment
+}
+
+// Names of the projections returned by NewProjections
+const (
+    OrdersProjection             = handlers.DefaultProjection
+    CustomerSummariesProjection  = "customer-summaries"
+    StatusDurationsProjection    = "status-durations"
+    // PipelineHeartbeatsProjection runs when ReadModels.Heartbeats is set
+    PipelineHeartbeatsProjection = "pipeline-heartbeats"
+    // OrdersCanaryProjection runs when Deps.Canary is enabled
+    OrdersCanaryProjection       = "orders-canary"
+)
+
+type (
+    OrderProjectionHandler = handlers.OrderProjectionHandler
+    EventConsumer          = handlers.EventConsumer
+    Projection             = handlers.Projection
+    ProjectionStatus       = handlers.ProjectionStatus
+    
+    CustomerSummaryProjectionHandler = handlers.CustomerSummaryProjectionHandler
+    StatusDurationProjectionHandler  = handlers.StatusDurationProjectionHandler
+    StatusDurationReadModel          = readmodels.StatusDurationReadModel
+    DryRunOrderReadModel             = readmodels.DryRunOrderReadModel
+    SLABreachReadModel               = readmodels.SLABreachReadModel
+    SLAEvaluator                     = handlers.SLAEvaluator
+    AnomalyReadModel                 = readmodels.AnomalyReadModel
+    CancellationAnomalyEvaluator     = handlers.CancellationAnomalyEvaluator
+    OrderArchiver                    = handlers.OrderArchiver
+    PipelineHeartbeatMonitor         = handlers.PipelineHeartbeatMonitor
+    HeartbeatObservation             = handlers.HeartbeatObservation
+    CustomerCacheRefresher           = handlers.CustomerCacheRefresher
+    Bootstrapper                     = handlers.Bootstrapper
+    EventDeduplicator                = handlers.EventDeduplicator
+    OrderReadModel         = readmodels.OrderReadModel
+    CustomerReadModel      = readmodels.CustomerReadModel
+    OrderHistoryReadModel  = readmodels.OrderHistoryReadModel
+    SearchReadModel        = readmodels.SearchReadModel
+    CacheConfig            = readmodels.CacheConfig
+    OrderArchiveConfig     = readmodels.OrderArchiveConfig
+    AnalyticsCache         = readmodels.AnalyticsCache
+    
+    OrderResponseV2          = handlers.OrderResponseV2
+    OrderAnalyticsResponseV2 = handlers.OrderAnalyticsResponseV2
+)
+
+// Deps lists what the query side needs. DB and EventBus are required, and
+// Redis is unless Cache.Disabled is set.
+type Deps struct {
+    DB       *sql.DB
+    Redis    *redis.Client
+    EventBus eventbus.EventBus
+    
+    // Topics to consume; defaults to eventbus.DefaultTopic
+    Topics []string
+    // ProjectionGroupPrefix defaults to DefaultProjectionGroupPrefix
+    ProjectionGroupPrefix string
+    // Registry decodes derived events; defaults to events.DefaultRegistry()
+    Registry *events.Registry
+    // OutboxTable defaults to DefaultOutboxTable
+    OutboxTable string
+    // PayloadLimits defaults to outbox.DefaultPayloadLimits when zero
+    PayloadLimits outbox.PayloadLimits
+    // TopicResolver picks the topic recorded with each outbox event and
+    // routes events saved without one; nil leaves both to the publisher's
+    // outbox.WithTopicResolver option
+    TopicResolver eventbus.TopicResolver
+    // Archive configures the archiver returned by NewOutboxArchiver;
+    // unset fields take outbox.DefaultArchiveConfig's
+    Archive outbox.ArchiveConfig
+    // Canary runs a new version of the orders projection in dry-run mode
+    // next to the live one; disabled by default
+    Canary CanaryConfig
+    // SLA configures the evaluator returned by NewSLAEvaluator; unset
+    // fields take DefaultSLAConfig's
+    SLA SLAConfig
+    // CancellationAnomaly configures the evaluator returned by
+    // NewCancellationAnomalyEvaluator; disabled by default
+    CancellationAnomaly CancellationAnomalyConfig
+    // OrderArchive configures the archiver returned by NewOrderArchiver
+    // and whether the read models read the archive; disabled by default
+    OrderArchive OrderArchiveConfig
+    // CacheRefresh configures ReadModels.CacheRefresher; unset fields take
+    // the handlers' defaults
+    CacheRefresh CacheRefreshConfig
+    // Dedup names the projections that skip redelivered events; none do
+    // by default
+    Dedup DedupConfig
+    // Bootstrap configures the history Bootstrap projects before the
+    // projections consume events; disabled by default
+    Bootstrap BootstrapConfig
+    // AdminKey guards the admin routes; empty disables them
+    AdminKey string
+    // Cache namespaces keys and sets TTLs for the read model cache; the
+    // zero value caches for an hour with unprefixed keys
+    Cache CacheConfig
+    // SlowQueryThreshold defaults to sqlmetrics.DefaultSlowThreshold when
+    // zero; a negative threshold disables the slow query log
+    SlowQueryThreshold time.Duration
+    // StrictDecoding fails order listings on a read model row whose JSON
+    // columns do not decode; by default the row is skipped and counted
+    StrictDecoding bool
+    // StrictProjections dead letters events of types the registry does not
+    // know, and events reaching the orders projection that it does not
+    // apply; by default both are skipped, counted and warned about
+    StrictProjections bool
+    // Flags switch StrictProjections while the service runs, from the
+    // admin /flags endpoint; StrictProjections becomes the flag's default.
+    // Nil keeps the setting fixed
+    Flags *featureflags.Flags
+    // V1Sunset is sent as the Sunset date of the deprecated /api/v1 routes
+    // mounted by MountVersionedRoutes; zero omits it
+    V1Sunset time.Time
+    // Clock times the workers and the handlers' periods and stamps outbox
+    // rows; defaults to clock.Default. Read model writes read the package
+    // clock, which clock.Set replaces.
+    Clock clock.Clock
+}
+
+func (d Deps) withDefaults() Deps {
+    d.Clock = clock.OrDefault(d.Clock)
+    if len(d.Topics) == 0 {
+        d.Topics = []string{eventbus.DefaultTopic}
+    }
+    if d.Registry == nil {
+        d.Registry = events.DefaultRegistry()
+    }
+    if d.OutboxTable == "" {
+        d.OutboxTable = DefaultOutboxTable
+    }
+    if d.ProjectionGroupPrefix == "" {
+        d.ProjectionGroupPrefix = DefaultProjectionGroupPrefix
+    }
+    if d.PayloadLimits == (outbox.PayloadLimits{}) {
+        d.PayloadLimits = outbox.DefaultPayloadLimits
+    }
+    return d
+}
+
+// ReadModels groups the read models built from one set of Deps.
+type ReadModels struct {
+    Orders          OrderReadModel
+    Customers       CustomerReadModel
+    History         OrderHistoryReadModel
+    Search          SearchReadModel
+    StatusDurations StatusDurationReadModel
+    SLABreaches     SLABreachReadModel
+    Anomalies       AnomalyReadModel
+    // CacheRefresher re-populates customers' cached order lists and order
+    // summaries after the projections change them. It is nil when the cache
+    // or refreshing is disabled; otherwise the embedding binary runs it.
+    CacheRefresher *CustomerCacheRefresher
+    // AnalyticsFallback keeps the last order analytics to serve while the
+    // database is unavailable. It is nil when the cache is disabled.
+    AnalyticsFallback *AnalyticsCache
+    // Deduplicator remembers the events the projections deps.Dedup names
+    // handled. It is nil when none are named; otherwise the embedding
+    // binary runs it to prune what it remembers.
+    Deduplicator *EventDeduplicator
+    // Heartbeats measures the pipeline's latency from the heartbeats the
+    // pipeline-heartbeats projection receives; Last reports the latest
+    Heartbeats *PipelineHeartbeatMonitor
+}
+
+func NewReadModels(deps Deps) ReadModels {
+    db := sqlmetrics.Wrap(deps.DB, deps.SlowQueryThreshold)
+    
+    // A nil *redis.Client must not become a non-nil redis.Cmdable
+    var client redis.Cmdable
+    if deps.Redis != nil {
+        client = deps.Redis
+    }
+    cache := readmodels.NewCache(client, deps.Cache)
+    
+    models := ReadModels{
+        Orders:          readmodels.NewOrderReadModel(db, cache, readmodels.WithStrictDecoding(deps.StrictDecoding), readmodels.WithArchive(!deps.OrderArchive.Disabled)),
+        Customers:       readmodels.NewCustomerReadModel(db, cache),
+        History:         readmodels.NewOrderHistoryReadModel(db),
+        Search:          readmodels.NewSearchReadModel(db),
+        StatusDurations: readmodels.NewStatusDurationReadModel(db),
+        SLABreaches:     readmodels.NewSLABreachReadModel(db),
+        Anomalies:       readmodels.NewAnomalyReadModel(db),
+        Heartbeats:      &PipelineHeartbeatMonitor{Now: clock.OrDefault(deps.Clock).Now},
+    }
+    
+    if client != nil && !deps.Cache.Disabled {
+        models.AnalyticsFallback = readmodels.NewAnalyticsCache(cache)
+    }
+    if client != nil && !deps.Cache.Disabled && !deps.CacheRefresh.Disabled {
+        orders := models.Orders
+        lookupCustomer := func(ctx context.Context, orderID string) (string, error) {
+            order, err := orders.GetOrder(ctx, orderID)
+            if err != nil {
+                return "", err
+            }
+            return order.CustomerID, nil
+        }
+        cfg := deps.CacheRefresh
+        models.CacheRefresher = handlers.NewCustomerCacheRefresher(cfg.Workers, cfg.Window, cfg.QueueSize, lookupCustomer)
+    }
+    
+    if len(deps.Dedup.Projections) > 0 {
+        models.Deduplicator = &EventDeduplicator{
+            Store:           readmodels.NewProcessedEventStore(db),
+            Retention:       deps.Dedup.Retention,
+            CleanupInterval: deps.Dedup.CleanupInterval,
+            Now:             clock.OrDefault(deps.Clock).Now,
+        }
+    }
+    return models
+}
+
+// CacheConfigFromEnv reads the read model cache configuration from
+// CACHE_ENABLED, CACHE_NAMESPACE, CACHE_ORDER_TTL, CACHE_CUSTOMER_TTL and
+// CACHE_ANALYTICS_RETENTION.
+func CacheConfigFromEnv() CacheConfig {
+    return readmodels.CacheConfigFromEnv()
+}
+
+// StrictDecodingFromEnv reads Deps.StrictDecoding from
+// ORDER_READ_MODEL_STRICT.
+func StrictDecodingFromEnv() bool {
+    return readmodels.StrictDecodingFromEnv()
+}
+
+// StrictProjectionsFromEnv reads Deps.StrictProjections from
+// PROJECTION_STRICT.
+func StrictProjectionsFromEnv() bool {
+    strict, _ := strconv.ParseBool(os.Getenv("PROJECTION_STRICT"))
+    return strict
+}
+
+// strictProjections returns the switch of the StrictProjections flag, with
+// deps.StrictProjections as its default, or nil without flags.
+func strictProjections(deps Deps) func() bool {
+    if deps.Flags == nil {
+        return nil
+    }
+    deps.Flags.Configure(featureflags.StrictProjections, deps.StrictProjections)
+    return deps.Flags.Func(featureflags.StrictProjections)
+}
+
+// CacheRefreshConfig configures the refresh of customers' cached reads
+// after projections change them.
+type CacheRefreshConfig struct {
+    Disabled bool
+    // Workers bounds the refreshes running at once
+    Workers int
+    // Window is how long a refresh waits, merging later ones for the same
+    // customer
+    Window time.Duration
+    // QueueSize bounds the refreshes waiting for a worker; more are dropped
+    QueueSize int
+}
+
+// CacheRefreshConfigFromEnv reads CACHE_REFRESH_ENABLED,
+// CACHE_REFRESH_WORKERS, CACHE_REFRESH_WINDOW and CACHE_REFRESH_QUEUE_SIZE.
+func CacheRefreshConfigFromEnv() CacheRefreshConfig {
+    var cfg CacheRefreshConfig
+    if enabled, err := strconv.ParseBool(os.Getenv("CACHE_REFRESH_ENABLED")); err == nil {
+        cfg.Disabled = !enabled
+    }
+    if workers, err := strconv.Atoi(os.Getenv("CACHE_REFRESH_WORKERS")); err == nil && workers > 0 {
+        cfg.Workers = workers
+    }
+    if window, err := time.ParseDuration(os.Getenv("CACHE_REFRESH_WINDOW")); err == nil && window > 0 {
+        cfg.Window = window
+    }
+    if size, err := strconv.Atoi(os.Getenv("CACHE_REFRESH_QUEUE_SIZE")); err == nil && size > 0 {
+        cfg.QueueSize = size
+    }
+    return cfg
+}
+
+// DedupConfig configures the projections that skip events they already
+// handled, recognised by event id. They need the processed_events table.
+type DedupConfig struct {
+    // Projections names the projections that skip redelivered events
+    Projections []string
+    // Retention defaults to handlers.DefaultDedupRetention
+    Retention time.Duration
+    // CleanupInterval defaults to handlers.DefaultDedupCleanupInterval
+    CleanupInterval time.Duration
+}
+
+// DedupConfigFromEnv reads PROJECTION_DEDUP, a comma separated list of
+// projection names, PROJECTION_DEDUP_RETENTION and
+// PROJECTION_DEDUP_CLEANUP_INTERVAL.
+func DedupConfigFromEnv() DedupConfig {
+    var cfg DedupConfig
+    for _, name := range strings.Split(os.Getenv("PROJECTION_DEDUP"), ",") {
+        if name = strings.TrimSpace(name); name != "" {
+            cfg.Projections = append(cfg.Projections, name)
+        }
+    }
+    if retention, err := time.ParseDuration(os.Getenv("PROJECTION_DEDUP_RETENTION")); err == nil && retention > 0 {
+        cfg.Retention = retention
+    }
+    if interval, err := time.ParseDuration(os.Getenv("PROJECTION_DEDUP_CLEANUP_INTERVAL")); err == nil && interval > 0 {
+        cfg.CleanupInterval = interval
+    }
+    return cfg
+}
+
+// SLAConfig configures the fulfillment SLA evaluator.
+type SLAConfig struct {
+    Disabled bool
+    // ShipWithin is how long a confirmed order may wait to be shipped
+    ShipWithin time.Duration
+    // Interval is how often orders are evaluated
+    Interval time.Duration
+}
+
+// DefaultSLAConfig expects confirmed orders to ship within 48 hours and
+// evaluates every 5 minutes.
+var DefaultSLAConfig = SLAConfig{ShipWithin: 48 * time.Hour, Interval: 5 * time.Minute}
+
+// SLAConfigFromEnv reads SLA_EVALUATOR_ENABLED, SLA_SHIP_WITHIN and
+// SLA_EVALUATION_INTERVAL, falling back to DefaultSLAConfig.
+func SLAConfigFromEnv() SLAConfig {
+    cfg := DefaultSLAConfig
+    if enabled, err := strconv.ParseBool(os.Getenv("SLA_EVALUATOR_ENABLED")); err == nil {
+        cfg.Disabled = !enabled
+    }
+    if value, err := time.ParseDuration(os.Getenv("SLA_SHIP_WITHIN")); err == nil && value > 0 {
+        cfg.ShipWithin = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("SLA_EVALUATION_INTERVAL")); err == nil && value > 0 {
+        cfg.Interval = value
+    }
+    return cfg
+}
+
+// NewSLAEvaluator returns the evaluator recording confirmed orders not
+// shipped within deps.SLA.ShipWithin. The embedding binary runs it; the
+// status-durations projection resolves the breaches it records.
+func NewSLAEvaluator(deps Deps, models ReadModels) *SLAEvaluator {
+    cfg := deps.SLA
+    if cfg.ShipWithin <= 0 {
+        cfg.ShipWithin = DefaultSLAConfig.ShipWithin
+    }
+    if cfg.Interval <= 0 {
+        cfg.Interval = DefaultSLAConfig.Interval
+    }
+    return &SLAEvaluator{
+        Disabled:   cfg.Disabled,
+        ReadModel:  models.SLABreaches,
+        ShipWithin: cfg.ShipWithin,
+        Interval:   cfg.Interval,
+        Now:        clock.OrDefault(deps.Clock).Now,
+    }
+}
+
+// CancellationAnomalyConfig configures the cancellation anomaly evaluator,
+// which compares the share of cancelled orders over a sliding window with
+// a baseline.
+type CancellationAnomalyConfig struct {
+    Disabled       bool
+    // Window is the period the rate is measured over
+    Window         time.Duration
+    // Interval is how often the rate is evaluated
+    Interval       time.Duration
+    // Baseline is handlers.BaselineStatic, comparing the rate with
+    // Threshold, or handlers.BaselineTrailing, comparing it with Multiplier
+    // times the rate over TrailingPeriod before the window, never below
+    // Threshold
+    Baseline       string
+    Threshold      float64
+    Multiplier     float64
+    TrailingPeriod time.Duration
+    // MinDecisions is how many orders must be confirmed or cancelled in a
+    // window for its rate to be judged
+    MinDecisions   int64
+    // Cooldown is how long after an anomaly another is not recorded
+    Cooldown       time.Duration
+}
+
+// DefaultCancellationAnomalyConfig is disabled. Enabled, it flags an hour in
+// which more than half of at least 20 decided orders were cancelled, at most
+// once every 6 hours, evaluating every 5 minutes.
+var DefaultCancellationAnomalyConfig = CancellationAnomalyConfig{
+    Disabled:       true,
+    Window:         time.Hour,
+    Interval:       5 * time.Minute,
+    Baseline:       handlers.BaselineStatic,
+    Threshold:      0.5,
+    Multiplier:     2,
+    TrailingPeriod: 7 * 24 * time.Hour,
+    MinDecisions:   20,
+    Cooldown:       6 * time.Hour,
+}
+
+// CancellationAnomalyConfigFromEnv reads CANCELLATION_ANOMALY_ENABLED,
+// CANCELLATION_ANOMALY_WINDOW, CANCELLATION_ANOMALY_INTERVAL,
+// CANCELLATION_ANOMALY_BASELINE, CANCELLATION_ANOMALY_THRESHOLD,
+// CANCELLATION_ANOMALY_MULTIPLIER, CANCELLATION_ANOMALY_TRAILING_PERIOD,
+// CANCELLATION_ANOMALY_MIN_DECISIONS and CANCELLATION_ANOMALY_COOLDOWN,
+// falling back to DefaultCancellationAnomalyConfig.
+func CancellationAnomalyConfigFromEnv() CancellationAnomalyConfig {
+    cfg := DefaultCancellationAnomalyConfig
+    if enabled, err := strconv.ParseBool(os.Getenv("CANCELLATION_ANOMALY_ENABLED")); err == nil {
+        cfg.Disabled = !enabled
+    }
+    if value, err := time.ParseDuration(os.Getenv("CANCELLATION_ANOMALY_WINDOW")); err == nil && value > 0 {
+        cfg.Window = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("CANCELLATION_ANOMALY_INTERVAL")); err == nil && value > 0 {
+        cfg.Interval = value
+    }
+    switch baseline := os.Getenv("CANCELLATION_ANOMALY_BASELINE"); baseline {
+    case "":
+    case handlers.BaselineStatic, handlers.BaselineTrailing:
+        cfg.Baseline = baseline
+    default:
+        log.Printf("Ignoring unknown CANCELLATION_ANOMALY_BASELINE %q", baseline)
+    }
+    if value, err := strconv.ParseFloat(os.Getenv("CANCELLATION_ANOMALY_THRESHOLD"), 64); err == nil && value > 0 && value <= 1 {
+        cfg.Threshold = value
+    }
+    if value, err := strconv.ParseFloat(os.Getenv("CANCELLATION_ANOMALY_MULTIPLIER"), 64); err == nil && value > 0 {
+        cfg.Multiplier = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("CANCELLATION_ANOMALY_TRAILING_PERIOD")); err == nil && value > 0 {
+        cfg.TrailingPeriod = value
+    }
+    if value, err := strconv.ParseInt(os.Getenv("CANCELLATION_ANOMALY_MIN_DECISIONS"), 10, 64); err == nil && value > 0 {
+        cfg.MinDecisions = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("CANCELLATION_ANOMALY_COOLDOWN")); err == nil && value > 0 {
+        cfg.Cooldown = value
+    }
+    return cfg
+}
+
+// NewCancellationAnomalyEvaluator returns the evaluator configured by
+// deps.CancellationAnomaly, whose unset fields take
+// DefaultCancellationAnomalyConfig's. It records anomalies in
+// models.Anomalies and saves an OrderCancellationAnomalyDetectedEvent for
+// each to the outbox named in deps. The embedding binary runs it.
+func NewCancellationAnomalyEvaluator(deps Deps, models ReadModels) *CancellationAnomalyEvaluator {
+    deps = deps.withDefaults()
+    cfg := deps.CancellationAnomaly
+    defaults := DefaultCancellationAnomalyConfig
+    if cfg.Window <= 0 {
+        cfg.Window = defaults.Window
+    }
+    if cfg.Interval <= 0 {
+        cfg.Interval = defaults.Interval
+    }
+    if cfg.Baseline == "" {
+        cfg.Baseline = defaults.Baseline
+    }
+    if cfg.Threshold <= 0 {
+        cfg.Threshold = defaults.Threshold
+    }
+    if cfg.Multiplier <= 0 {
+        cfg.Multiplier = defaults.Multiplier
+    }
+    if cfg.TrailingPeriod <= 0 {
+        cfg.TrailingPeriod = defaults.TrailingPeriod
+    }
+    if cfg.MinDecisions <= 0 {
+        cfg.MinDecisions = defaults.MinDecisions
+    }
+    if cfg.Cooldown <= 0 {
+        cfg.Cooldown = defaults.Cooldown
+    }
+    return &CancellationAnomalyEvaluator{
+        Disabled:       cfg.Disabled,
+        ReadModel:      models.Anomalies,
+        Outbox:         newOutboxRepository(deps),
+        Window:         cfg.Window,
+        Interval:       cfg.Interval,
+        Baseline:       cfg.Baseline,
+        Threshold:      cfg.Threshold,
+        Multiplier:     cfg.Multiplier,
+        TrailingPeriod: cfg.TrailingPeriod,
+        MinDecisions:   cfg.MinDecisions,
+        Cooldown:       cfg.Cooldown,
+        Now:            deps.Clock.Now,
+    }
+}
+
+// OrderArchiveConfigFromEnv reads ORDER_ARCHIVE_ENABLED,
+// ORDER_ARCHIVE_MAX_AGE, ORDER_ARCHIVE_INTERVAL and
+// ORDER_ARCHIVE_BATCH_SIZE, falling back to
+// readmodels.DefaultOrderArchiveConfig.
+func OrderArchiveConfigFromEnv() OrderArchiveConfig {
+    return readmodels.OrderArchiveConfigFromEnv()
+}
+
+// NewOrderArchiver returns the archiver moving orders delivered or
+// cancelled more than deps.OrderArchive.MaxAge ago to the archive, whose
+// unset fields take readmodels.DefaultOrderArchiveConfig's. The embedding
+// binary runs it. With deps.Redis set, one instance archives at a time,
+// under a lock in the cache's namespace.
+func NewOrderArchiver(deps Deps, models ReadModels) *OrderArchiver {
+    cfg := deps.OrderArchive
+    defaults := readmodels.DefaultOrderArchiveConfig
+    if cfg.MaxAge <= 0 {
+        cfg.MaxAge = defaults.MaxAge
+    }
+    if cfg.Interval <= 0 {
+        cfg.Interval = defaults.Interval
+    }
+    if cfg.BatchSize <= 0 {
+        cfg.BatchSize = defaults.BatchSize
+    }
+    archiver := &OrderArchiver{
+        Disabled:  cfg.Disabled,
+        ReadModel: models.Orders,
+        MaxAge:    cfg.MaxAge,
+        Interval:  cfg.Interval,
+        BatchSize: cfg.BatchSize,
+        Now:       clock.OrDefault(deps.Clock).Now,
+    }
+    if deps.Redis != nil {
+        archiver.Lock = newLocker(deps)
+    }
+    return archiver
+}
+
+// newLocker returns the locker of the service's single-instance jobs, whose
+// keys are namespaced as the cache's are.
+func newLocker(deps Deps) *distlock.Locker {
+    prefix := distlock.DefaultKeyPrefix
+    if deps.Cache.Namespace != "" {
+        prefix = deps.Cache.Namespace + ":" + prefix
+    }
+    return distlock.NewLocker(deps.Redis, distlock.WithKeyPrefix(prefix))
+}
+
+// CanaryConfig configures the orders-canary projection, which runs an
+// orders projection handler against live traffic with its writes recorded
+// in a DryRunOrderReadModel instead of applied. Compare its writes with the
+// live read model through the admin dry-run endpoint before swapping the
+// handler in for real.
+type CanaryConfig struct {
+    Enabled bool
+    // LogSize bounds the recorded writes; defaults to
+    // readmodels.DefaultDryRunLogSize
+    LogSize int
+    // NewHandler builds the projection version under test on the dry-run
+    // read model; defaults to the OrderProjectionHandler in service,
+    // without order history
+    NewHandler func(orders OrderReadModel) eventbus.Handler
+}
+
+// CanaryConfigFromEnv reads the canary configuration from
+// PROJECTION_CANARY_ENABLED and PROJECTION_CANARY_LOG_SIZE.
+func CanaryConfigFromEnv() CanaryConfig {
+    var cfg CanaryConfig
+    cfg.Enabled, _ = strconv.ParseBool(os.Getenv("PROJECTION_CANARY_ENABLED"))
+    if size, err := strconv.Atoi(os.Getenv("PROJECTION_CANARY_LOG_SIZE")); err == nil && size > 0 {
+        cfg.LogSize = size
+    }
+    return cfg
+}
+
+// ConsumerConfig names what the service consumes and as which group.
+type ConsumerConfig struct {
+    // Environment names the deployment, such as staging or production
+    Environment string
+    // GroupID is the event bus's consumer group, which the orders
+    // projection consumes as, and prefixes the other projections' groups;
+    // defaults to DefaultGroupID(Environment)
+    GroupID string
+    // Topics lists the topics the projections consume and resolves the
+    // topic of each event published
+    Topics eventbus.TopicConfig
+}
+
+// ConsumerConfigFromEnv reads ENVIRONMENT, CONSUMER_GROUP_ID and the topics
+// of eventbus.TopicConfigFromEnv.
+func ConsumerConfigFromEnv() ConsumerConfig {
+    cfg := ConsumerConfig{
+        Environment: os.Getenv("ENVIRONMENT"),
+        GroupID:     os.Getenv("CONSUMER_GROUP_ID"),
+        Topics:      eventbus.TopicConfigFromEnv(),
+    }
+    if cfg.GroupID == "" {
+        cfg.GroupID = DefaultGroupID(cfg.Environment)
+    }
+    return cfg
+}
+
+// Bootstrap sources
+const (
+    // BootstrapFromManagement pages through the management service's event
+    // feed
+    BootstrapFromManagement = "management"
+    // BootstrapFromSnapshot reads a file of feed events
+    BootstrapFromSnapshot = "snapshot"
+)
+
+// BootstrapConfig configures the bootstrap of a new deployment, which
+// projects the history from Source and only then consumes events from the
+// broker, starting where the history ends.
+type BootstrapConfig struct {
+    // Source is BootstrapFromManagement or BootstrapFromSnapshot; empty
+    // disables bootstrapping
+    Source string
+    // ManagementURL and ManagementAPIKey reach the management service's
+    // event feed, which requires its admin key
+    ManagementURL    string
+    ManagementAPIKey string
+    // SnapshotFile holds one feed event per line, in position order
+    SnapshotFile string
+    // PageSize defaults to handlers.DefaultBootstrapPageSize
+    PageSize int
+    // Overlap defaults to handlers.DefaultBootstrapOverlap
+    Overlap time.Duration
+}
+
+// BootstrapConfigFromEnv reads BOOTSTRAP_SOURCE, BOOTSTRAP_MANAGEMENT_URL,
+// BOOTSTRAP_MANAGEMENT_API_KEY, BOOTSTRAP_SNAPSHOT_FILE,
+// BOOTSTRAP_PAGE_SIZE and BOOTSTRAP_OVERLAP.
+func BootstrapConfigFromEnv() BootstrapConfig {
+    cfg := BootstrapConfig{
+        Source:           os.Getenv("BOOTSTRAP_SOURCE"),
+        ManagementURL:    os.Getenv("BOOTSTRAP_MANAGEMENT_URL"),
+        ManagementAPIKey: os.Getenv("BOOTSTRAP_MANAGEMENT_API_KEY"),
+        SnapshotFile:     os.Getenv("BOOTSTRAP_SNAPSHOT_FILE"),
+    }
+    if size, err := strconv.Atoi(os.Getenv("BOOTSTRAP_PAGE_SIZE")); err == nil && size > 0 {
+        cfg.PageSize = size
+    }
+    if overlap, err := time.ParseDuration(os.Getenv("BOOTSTRAP_OVERLAP")); err == nil && overlap > 0 {
+        cfg.Overlap = overlap
+    }
+    return cfg
+}
+
+// NewProjectionHandler wires the projection that keeps the order read model
+// and order history up to date from order events.
+func NewProjectionHandler(deps Deps, models ReadModels) *OrderProjectionHandler {
+    return &OrderProjectionHandler{
+        OrderReadModel:   models.Orders,
+        HistoryReadModel: models.History,
+        Strict:           deps.StrictProjections,
+        StrictFunc:       strictProjections(deps),
+    }
+}
+
+// NewProjections declares the service's projections, each consuming
+// deps.Topics and skipping the event types its handler does not apply. The
+// orders projection keeps the event bus's own group, and with it the position the service consumed from before projections were
+// split; the others consume as deps.ProjectionGroupPrefix followed by
+// their name. A new group starts from the earliest retained event.
+//
+// With models.CacheRefresher set, the orders projection refreshes the
+// cached order list, and the customer summaries projection the cached order
+// summary, of the customer of each event they apply.
+//
+// When deps.Canary is enabled the orders-canary projection is added, in a
+// group of its own. Its reads see the live read model and it writes
+// nothing, so it may retry events until the live projection has caught
+// up; its failures do not hold back the live projections.
+//
+// With models.Heartbeats set, the pipeline-heartbeats projection hands it
+// the heartbeats the order management service sends. It writes nothing,
+// and the other projections skip heartbeats.
+//
+// The projections deps.Dedup names skip the events they already handled,
+// through models.Deduplicator. With deps.StrictProjections set every
+// projection dead letters the events of types the registry does not know.
+func NewProjections(deps Deps, models ReadModels) []Projection {
+    deps = deps.withDefaults()
+    customerSummaries := &CustomerSummaryProjectionHandler{
+        CustomerReadModel: models.Customers,
+        Outbox:            newOutboxRepository(deps),
+    }
+    statusDurations := &StatusDurationProjectionHandler{ReadModel: models.StatusDurations, SLABreaches: models.SLABreaches}
+    orders := NewProjectionHandler(deps, models)
+    ordersHandler := models.CacheRefresher.Decorate("customer_orders", orders.Handle, models.Orders.CacheCustomerOrders)
+    customerSummariesHandler := models.CacheRefresher.Decorate("customer_order_summary", customerSummaries.Handle, models.Customers.CacheOrderSummary, "OrderCreated", "OrderCustomerReassigned")
+    
+    projections := []Projection{
+        {
+            Name:       OrdersProjection,
+            Topics:     deps.Topics,
+            Handler:    ordersHandler,
+            EventTypes: orders.EventTypes(),
+            Truncate:   models.Orders.DeleteOrdersCreatedSince,
+        },
+        {
+            Name:       CustomerSummariesProjection,
+            Group:      deps.ProjectionGroupPrefix + "-" + CustomerSummariesProjection,
+            Topics:     deps.Topics,
+            Handler:    customerSummariesHandler,
+            EventTypes: customerSummaries.EventTypes(),
+            Truncate:   models.Customers.DeleteOrdersCreatedSince,
+        },
+        {
+            Name:       StatusDurationsProjection,
+            Group:      deps.ProjectionGroupPrefix + "-" + StatusDurationsProjection,
+            Topics:     deps.Topics,
+            Handler:    statusDurations.Handle,
+            EventTypes: statusDurations.EventTypes(),
+            Truncate:   models.StatusDurations.DeleteOrdersCreatedSince,
+        },
+    }
+    if models.Heartbeats != nil {
+        projections = append(projections, Projection{
+            Name:       PipelineHeartbeatsProjection,
+            Group:      deps.ProjectionGroupPrefix + "-" + PipelineHeartbeatsProjection,
+            Topics:     deps.Topics,
+            Handler:    models.Heartbeats.Handle,
+            EventTypes: models.Heartbeats.EventTypes(),
+        })
+    }
+    if deps.Canary.Enabled {
+        projections = append(projections, newCanaryProjection(deps, models))
+    }
+    
+    for i := range projections {
+        projections[i].Strict = deps.StrictProjections
+        projections[i].StrictFunc = strictProjections(deps)
+    }
+    
+    dedup := make(map[string]bool, len(deps.Dedup.Projections))
+    for _, name := range deps.Dedup.Projections {
+        dedup[name] = true
+    }
+    for i, projection := range projections {
+        if dedup[projection.Name] {
+            projections[i] = models.Deduplicator.Deduplicate(projection)
+            delete(dedup, projection.Name)
+        }
+    }
+    for name := range dedup {
+        log.Printf("Not deduplicating unknown projection %s", name)
+    }
+    return projections
+}
+
+// newCanaryProjection expects deps with defaults applied.
+func newCanaryProjection(deps Deps, models ReadModels) Projection {
+    dryRun := readmodels.NewDryRunOrderReadModel(models.Orders, deps.Canary.LogSize)
+    projection := Projection{
+        Name:   OrdersCanaryProjection,
+        Group:  deps.ProjectionGroupPrefix + "-" + OrdersCanaryProjection,
+        Topics: deps.Topics,
+        DryRun: dryRun,
+    }
+    
+    // A handler of the canary's own may apply any event type
+    if deps.Canary.NewHandler != nil {
+        projection.Handler = deps.Canary.NewHandler(dryRun)
+        return projection
+    }
+    handler := &OrderProjectionHandler{OrderReadModel: dryRun, Strict: deps.StrictProjections, StrictFunc: strictProjections(deps)}
+    projection.Handler = handler.Handle
+    projection.EventTypes = handler.EventTypes()
+    return projection
+}
+
+// NewEventConsumer returns a consumer running each projection on
+// deps.EventBus, under the projection's group when the bus supports
+// groups. Call Start to subscribe and Close once it is done.
+func NewEventConsumer(deps Deps, projections []Projection) (*EventConsumer, error) {
+    return handlers.NewEventConsumer(deps.EventBus, projections)
+}
+
+// Bootstrap projects the history deps.Bootstrap configures into
+// projections, unless an earlier run completed, and returns the options to
+// start the event consumer with: a start time where the history ends, so
+// consumer groups new to the broker skip what was bootstrapped. It returns
+// no options when bootstrapping is disabled. Run it again after a failure;
+// it resumes from its checkpoint.
+func Bootstrap(ctx context.Context, deps Deps, projections []Projection) ([]eventbus.SubscribeOption, error) {
+    deps = deps.withDefaults()
+    cfg := deps.Bootstrap
+    
+    var source eventfeed.Source
+    switch cfg.Source {
+    case "":
+        return nil, nil
+    case BootstrapFromManagement:
+        client, err := eventfeed.NewClient(apiclient.Config{BaseURL: cfg.ManagementURL, APIKey: cfg.ManagementAPIKey})
+        if err != nil {
+            return nil, fmt.Errorf("invalid bootstrap management service: %w", err)
+        }
+        source = client
+    case BootstrapFromSnapshot:
+        if cfg.SnapshotFile == "" {
+            return nil, errors.New("a snapshot file is required to bootstrap from a snapshot")
+        }
+        snapshot := eventfeed.NewSnapshot(cfg.SnapshotFile)
+        defer snapshot.Close()
+        source = snapshot
+    default:
+        return nil, fmt.Errorf("unknown bootstrap source %q: must be %s or %s", cfg.Source, BootstrapFromManagement, BootstrapFromSnapshot)
+    }
+    
+    bootstrapper := &Bootstrapper{
+        SourceName:  cfg.Source,
+        Source:      source,
+        Checkpoints: readmodels.NewBootstrapCheckpointStore(sqlmetrics.Wrap(deps.DB, deps.SlowQueryThreshold)),
+        Projections: projections,
+        Registry:    deps.Registry,
+        PageSize:    cfg.PageSize,
+        Overlap:     cfg.Overlap,
+        Now:         clock.OrDefault(deps.Clock).Now,
+    }
+    startTime, err := bootstrapper.Run(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if startTime.IsZero() {
+        return nil, nil
+    }
+    return []eventbus.SubscribeOption{eventbus.WithStartTime(startTime)}, nil
+}
+
+// RegisterRoutes mounts the order query endpoints on r, and the order tag
+// endpoints behind the admin key in deps. Mount them on a subrouter to add
+// a prefix, as the standalone service does with /api/v1.
+func RegisterRoutes(r *mux.Router, deps Deps, models ReadModels) {
+    now := clock.OrDefault(deps.Clock).Now
+    getOrderHandler := &handlers.GetOrderHandler{ReadModel: models.Orders}
+    listOrdersHandler := &handlers.ListOrdersHandler{ReadModel: models.Orders}
+    listOrderChangesHandler := &handlers.ListOrderChangesHandler{ReadModel: models.Orders}
+    getOrderAnalyticsHandler := &handlers.GetOrderAnalyticsHandler{ReadModel: models.Orders, Fallback: models.AnalyticsFallback, Now: now}
+    compareOrderAnalyticsHandler := &handlers.CompareOrderAnalyticsHandler{ReadModel: models.Orders, Now: now}
+    getOrderValueDistributionHandler := &handlers.GetOrderValueDistributionHandler{ReadModel: models.Orders, Now: now}
+    getProductSalesTimeSeriesHandler := &handlers.GetProductSalesTimeSeriesHandler{ReadModel: models.Orders, Now: now}
+    getOrderHistoryHandler := &handlers.GetOrderHistoryHandler{ReadModel: models.History}
+    getStatusDurationsHandler := &handlers.GetStatusDurationsHandler{ReadModel: models.Orders, Now: now}
+    orderTagHandler := &handlers.OrderTagHandler{ReadModel: models.Orders}
+    orderStatusesHandler := &handlers.OrderStatusesHandler{ReadModel: models.Orders}
+    searchHandler := &handlers.SearchHandler{ReadModel: models.Search}
+    listSLABreachesHandler := &handlers.ListSLABreachesHandler{ReadModel: models.SLABreaches}
+    customerOrderSummaryHandler := &handlers.CustomerOrderSummaryHandler{ReadModel: models.Customers}
+    
+    // Registered before /orders/{id}, which would otherwise match it
+    r.HandleFunc("/orders/statuses", orderStatusesHandler.HandleHTTP).Methods("GET", "HEAD", "POST")
+    r.HandleFunc("/orders/changes", listOrderChangesHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/orders/{id}", getOrderHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/orders/{id}/history", getOrderHistoryHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/orders", listOrdersHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/search", searchHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/customers/{id}/order-summary", customerOrderSummaryHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/analytics/orders", getOrderAnalyticsHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/analytics/orders/compare", compareOrderAnalyticsHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/analytics/orders/value-distribution", getOrderValueDistributionHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/analytics/orders/status-durations", getStatusDurationsHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/analytics/products/{id}/timeseries", getProductSalesTimeSeriesHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/analytics/sla-breaches", listSLABreachesHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.Handle("/orders/{id}/tags/{tag}", httpmw.RequireAdminKey(deps.AdminKey)(http.HandlerFunc(orderTagHandler.HandleHTTP))).Methods("PUT", "DELETE")
+}
+
+// MountVersionedRoutes mounts the routes of RegisterRoutes on router under
+// /api/v1 and /api/v2, and under /api for clients picking a version with
+// their Accept header. v1 keeps the original order and analytics response
+// shapes; v2 returns OrderResponseV2 and OrderAnalyticsResponseV2.
+func MountVersionedRoutes(router *mux.Router, deps Deps, models ReadModels) {
+    apiversion.DefaultRegistry(deps.V1Sunset).Mount(router, func(r *mux.Router) {
+        RegisterRoutes(r, deps, models)
+    })
+}
+
+// RegisterAdminRoutes guards r with the admin key in deps and mounts the
+// admin endpoints on it, with /flags when deps has flags. Routes added to r
+// afterwards share the guard. The
+// consumer endpoints act on one of consumer's projections, and answer 501
+// unless its event bus is an eventbus.OffsetController, as the Kafka bus
+// is.
+func RegisterAdminRoutes(r *mux.Router, deps Deps, models ReadModels, consumer *EventConsumer) {
+    orderTotalsConsistencyHandler := &handlers.OrderTotalsConsistencyHandler{ReadModel: models.Orders}
+    corruptOrdersConsistencyHandler := &handlers.CorruptOrdersConsistencyHandler{ReadModel: models.Orders}
+    projectionsHandler := &handlers.ProjectionsHandler{Consumer: consumer}
+    consumerOffsetsHandler := &handlers.ConsumerOffsetsHandler{Consumer: consumer}
+    consumerResetHandler := &handlers.ConsumerResetHandler{Consumer: consumer}
+    projectionDryRunHandler := &handlers.ProjectionDryRunHandler{Consumer: consumer}
+    outboxEventHandler := &handlers.OutboxEventHandler{Archiver: NewOutboxArchiver(deps)}
+    orderStatusOverrideHandler := &handlers.OrderStatusOverrideHandler{ReadModel: models.Orders, HistoryReadModel: models.History, Now: clock.OrDefault(deps.Clock).Now}
+    anonymizeOrdersHandler := &handlers.AnonymizeOrdersHandler{ReadModel: models.Orders}
+    reconcileHandler := &reconcile.Handler{Source: models.Orders}
+    
+    r.Use(httpmw.RequireAdminKey(deps.AdminKey))
+    r.HandleFunc("/consistency/order-totals", orderTotalsConsistencyHandler.HandleHTTP).Methods("GET")
+    r.HandleFunc("/consistency/corrupt-orders", corruptOrdersConsistencyHandler.HandleHTTP).Methods("GET")
+    r.HandleFunc("/projections", projectionsHandler.HandleHTTP).Methods("GET")
+    r.HandleFunc("/projections/{name}/dry-run", projectionDryRunHandler.HandleHTTP).Methods("GET")
+    r.HandleFunc("/consumer/offsets", consumerOffsetsHandler.HandleHTTP).Methods("GET")
+    r.HandleFunc("/consumer/reset", consumerResetHandler.HandleHTTP).Methods("POST")
+    r.HandleFunc("/outbox/events/{id}", outboxEventHandler.HandleHTTP).Methods("GET", "HEAD")
+    r.HandleFunc("/orders/{id}/status", orderStatusOverrideHandler.HandleHTTP).Methods("PUT")
+    r.HandleFunc("/orders/anonymize", anonymizeOrdersHandler.HandleHTTP).Methods("POST")
+    r.HandleFunc("/reconcile/counts", reconcileHandler.HandleCounts).Methods("GET")
+    r.HandleFunc("/reconcile/ids", reconcileHandler.HandleIDs).Methods("GET")
+    if deps.Flags != nil {
+        flagsHandler := &featureflags.Handler{Flags: deps.Flags}
+        r.HandleFunc("/flags", flagsHandler.HandleList).Methods("GET", "HEAD")
+        r.HandleFunc("/flags", flagsHandler.HandleSet).Methods("PUT")
+    }
+}
+
+// CreateOutboxTable creates the outbox table named in deps and its archive
+// if they are missing.
+func CreateOutboxTable(ctx context.Context, deps Deps) error {
+    deps = deps.withDefaults()
+    return outbox.CreateTable(ctx, deps.DB, deps.OutboxTable)
+}
+
+// CheckSchema verifies that DB has the tables deps uses, with the columns
+// the embedded schema gives them, as mode asks; see schema.Check. Run it
+// after CreateOutboxTable. In schema.CheckWarn mode deduplication, the
+// bootstrap, the cancellation anomaly evaluator and the order archive are
+// turned off in the returned Deps when their tables are missing.
+func CheckSchema(ctx context.Context, deps Deps, mode schema.CheckMode) (Deps, error) {
+    if mode == schema.CheckOff {
+        return deps, nil
+    }
+    outboxTable := deps.withDefaults().OutboxTable
+    
+    names := append([]string(nil), readmodels.Tables...)
+    dedup := len(deps.Dedup.Projections) > 0
+    if dedup {
+        names = append(names, readmodels.ProcessedEventsTable)
+    }
+    bootstrap := deps.Bootstrap.Source != ""
+    if bootstrap {
+        names = append(names, readmodels.BootstrapCheckpointsTable)
+    }
+    anomalies := !deps.CancellationAnomaly.Disabled
+    if anomalies {
+        names = append(names, readmodels.AnomaliesTable)
+    }
+    archive := !deps.OrderArchive.Disabled
+    if archive {
+        names = append(names, readmodels.ArchivedOrdersTable)
+    }
+    all, err := schema.Expected()
+    if err != nil {
+        return deps, err
+    }
+    expected, err := all.Select(names...)
+    if err != nil {
+        return deps, err
+    }
+    expected.Merge(schema.Parse(outbox.Schema(outboxTable)))
+    
+    mismatch, err := schema.Check(ctx, deps.DB, expected, mode)
+    if err != nil || mismatch == nil {
+        return deps, err
+    }
+    if dedup && mismatch.MissingAny(readmodels.ProcessedEventsTable) {
+        log.Printf("Projection deduplication disabled, table %s is not migrated", readmodels.ProcessedEventsTable)
+        deps.Dedup.Projections = nil
+    }
+    if bootstrap && mismatch.MissingAny(readmodels.BootstrapCheckpointsTable) {
+        log.Printf("Bootstrap disabled, table %s is not migrated", readmodels.BootstrapCheckpointsTable)
+        deps.Bootstrap.Source = ""
+    }
+    if anomalies && mismatch.MissingAny(readmodels.AnomaliesTable) {
+        log.Printf("Cancellation anomaly evaluator disabled, table %s is not migrated", readmodels.AnomaliesTable)
+        deps.CancellationAnomaly.Disabled = true
+    }
+    if archive && mismatch.MissingAny(readmodels.ArchivedOrdersTable) {
+        log.Printf("Order archive disabled, table %s is not migrated", readmodels.ArchivedOrdersTable)
+        deps.OrderArchive.Disabled = true
+    }
+    return deps, nil
+}
+
+// NewOutboxPublisher returns the publisher for events derived by the
+// projections, each sent to the destination saved with it or, for rows
+// without one, to the topic deps.TopicResolver picks. Run its ProcessEvents
+// in a goroutine.
+func NewOutboxPublisher(deps Deps, opts ...outbox.Option) *outbox.Publisher {
+    deps = deps.withDefaults()
+    if deps.TopicResolver != nil {
+        // Ahead of opts so an explicit option still wins
+        opts = append([]outbox.Option{outbox.WithTopicResolver(deps.TopicResolver)}, opts...)
+    }
+    opts = append([]outbox.Option{outbox.WithClock(deps.Clock)}, opts...)
+    return outbox.NewPublisher(newOutboxRepository(deps), deps.EventBus, deps.Registry, opts...)
+}
+
+// newOutboxRepository expects deps with defaults applied.
+func newOutboxRepository(deps Deps) outbox.Repository {
+    opts := []outbox.RepositoryOption{outbox.WithPayloadLimits(deps.PayloadLimits), outbox.WithRepositoryClock(deps.Clock)}
+    if deps.TopicResolver != nil {
+        opts = append(opts, outbox.WithDestinations(deps.TopicResolver))
+    }
+    return outbox.NewRepository(deps.DB, deps.OutboxTable, opts...)
+}
+
+// NewOutboxArchiver returns the archiver that moves processed events out of
+// the outbox named in deps. Run its Run in a goroutine.
+func NewOutboxArchiver(deps Deps) *outbox.Archiver {
+    deps = deps.withDefaults()
+    if deps.Archive.Clock == nil {
+        deps.Archive.Clock = deps.Clock
+    }
+    return outbox.NewArchiver(deps.DB, deps.OutboxTable, deps.Archive)
+}
@@ -0,0 +1,168 @@
+package reportingapi
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+)
+
+// subscription is a Subscribe call seen by recordingBus; group is empty on
+// the bus's own group.
+type subscription struct {
+    group  string
+    topics []string
+}
+
+// recordingBus records subscriptions, including those of the buses its
+// ForGroup returns.
+type recordingBus struct {
+    group         string
+    subscriptions *[]subscription
+}
+
+func newRecordingBus() *recordingBus {
+    return &recordingBus{subscriptions: &[]subscription{}}
+}
+
+func (b *recordingBus) Publish(context.Context, events.DomainEvent) error { return nil }
+
+func (b *recordingBus) PublishTo(context.Context, string, events.DomainEvent) error { return nil }
+
+func (b *recordingBus) Subscribe(_ context.Context, topics []string, _ eventbus.Handler, _ ...eventbus.SubscribeOption) error {
+    *b.subscriptions = append(*b.subscriptions, subscription{group: b.group, topics: topics})
+    return nil
+}
+
+func (b *recordingBus) Close() error { return nil }
+
+func (b *recordingBus) ForGroup(group string) (eventbus.EventBus, error) {
+    return &recordingBus{group: group, subscriptions: b.subscriptions}, nil
+}
+
+func TestConsumerConfigFromEnv(t *testing.T) {
+    tests := []struct {
+        name       string
+        env        map[string]string
+        wantGroup  string
+        wantTopics []string
+    }{
+        {name: "defaults", wantGroup: "order-reporting-service", wantTopics: []string{eventbus.DefaultTopic}},
+        {name: "environment", env: map[string]string{"ENVIRONMENT": "staging"}, wantGroup: "order-reporting-service-staging", wantTopics: []string{eventbus.DefaultTopic}},
+        {name: "group override", env: map[string]string{"ENVIRONMENT": "staging", "CONSUMER_GROUP_ID": "reporting-blue"}, wantGroup: "reporting-blue", wantTopics: []string{eventbus.DefaultTopic}},
+        {
+            name:       "topics",
+            env:        map[string]string{"KAFKA_TOPIC_ORDERS": "staging.orders", "KAFKA_TOPIC_ORDER_ITEMS": "staging.order-items", "KAFKA_TOPIC_CUSTOMERS": "staging.orders"},
+            wantGroup:  "order-reporting-service",
+            wantTopics: []string{"staging.orders", "staging.order-items", eventbus.DefaultTopic},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, name := range []string{"ENVIRONMENT", "CONSUMER_GROUP_ID", "KAFKA_TOPIC_ORDERS", "KAFKA_TOPIC_ORDER_ITEMS", "KAFKA_TOPIC_CUSTOMERS", "KAFKA_TOPIC_SAGAS", "KAFKA_TOPIC_ORDER_STATUS"} {
+                t.Setenv(name, tt.env[name])
+            }
+            
+            cfg := ConsumerConfigFromEnv()
+            if cfg.GroupID != tt.wantGroup {
+                t.Errorf("GroupID = %q, want %q", cfg.GroupID, tt.wantGroup)
+            }
+            if got := cfg.Topics.All(); !reflect.DeepEqual(got, tt.wantTopics) {
+                t.Errorf("topics = %v, want %v", got, tt.wantTopics)
+            }
+        })
+    }
+}
+
+func TestDedupConfigFromEnv(t *testing.T) {
+    tests := []struct {
+        name string
+        env  map[string]string
+        want DedupConfig
+    }{
+        {name: "defaults"},
+        {
+            name: "projections",
+            env:  map[string]string{"PROJECTION_DEDUP": " customers, ,customer_order_summaries", "PROJECTION_DEDUP_RETENTION": "48h", "PROJECTION_DEDUP_CLEANUP_INTERVAL": "10m"},
+            want: DedupConfig{Projections: []string{"customers", "customer_order_summaries"}, Retention: 48 * time.Hour, CleanupInterval: 10 * time.Minute},
+        },
+        {
+            name: "invalid durations",
+            env:  map[string]string{"PROJECTION_DEDUP": "customers", "PROJECTION_DEDUP_RETENTION": "a week", "PROJECTION_DEDUP_CLEANUP_INTERVAL": "-1h"},
+            want: DedupConfig{Projections: []string{"customers"}},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, name := range []string{"PROJECTION_DEDUP", "PROJECTION_DEDUP_RETENTION", "PROJECTION_DEDUP_CLEANUP_INTERVAL"} {
+                t.Setenv(name, tt.env[name])
+            }
+            if got := DedupConfigFromEnv(); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("DedupConfigFromEnv() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+// Every projection subscribes to the configured topics in one call, the
+// orders projection as the bus's own group and the others in groups
+// prefixed with the configured one.
+func TestEventConsumer_Start_subscribesToConfiguredTopics(t *testing.T) {
+    tests := []struct {
+        name string
+        cfg  ConsumerConfig
+    }{
+        {name: "default topic", cfg: ConsumerConfig{GroupID: DefaultGroupID("")}},
+        {
+            name: "topics per category",
+            cfg: ConsumerConfig{
+                GroupID: DefaultGroupID("staging"),
+                Topics:  eventbus.TopicConfig{OrderLifecycle: "staging.orders", OrderItems: "staging.order-items", Customers: "staging.customers", OrderStatus: "staging.order-status"},
+            },
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bus := newRecordingBus()
+            deps := Deps{
+                EventBus:              bus,
+                Topics:                tt.cfg.Topics.All(),
+                TopicResolver:         tt.cfg.Topics.Resolver(),
+                ProjectionGroupPrefix: tt.cfg.GroupID,
+                Cache:                 CacheConfig{Disabled: true},
+            }
+            consumer, err := NewEventConsumer(deps, NewProjections(deps, NewReadModels(deps)))
+            if err != nil {
+                t.Fatalf("NewEventConsumer() = %v", err)
+            }
+            if err := consumer.Start(context.Background()); err != nil {
+                t.Fatalf("Start() = %v", err)
+            }
+            
+            var groups []string
+            for _, sub := range *bus.subscriptions {
+                groups = append(groups, sub.group)
+                if !reflect.DeepEqual(sub.topics, tt.cfg.Topics.All()) {
+                    t.Errorf("group %q subscribed to %v, want %v", sub.group, sub.topics, tt.cfg.Topics.All())
+                }
+            }
+            sort.Strings(groups)
+            want := []string{
+                "",
+                tt.cfg.GroupID + "-" + CustomerSummariesProjection,
+                tt.cfg.GroupID + "-" + PipelineHeartbeatsProjection,
+                tt.cfg.GroupID + "-" + StatusDurationsProjection,
+            }
+            if !reflect.DeepEqual(groups, want) {
+                t.Errorf("subscribed as groups %q, want %q", groups, want)
+            }
+        })
+    }
+}
@@ -0,0 +1,249 @@
+// Package reportingclient is a Go client for the order reporting service's
+// /api/v2 query endpoints. It depends only on the shared module, so callers
+// do not link the service itself.
+//
+//	client, err := reportingclient.New(apiclient.Config{BaseURL: "http://localhost:8081"})
+//	order, err := client.GetOrder(ctx, orderID)
+//
+// Errors returned for error responses are *apiclient.Error, carrying the
+// status and the server's body; an invalid page is reported with Code
+// "invalid_pagination". Queries are retried on 429 and 5xx responses.
+package reportingclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiversion"
+)
+
+// Client calls the order reporting service.
+type Client struct {
+    api *apiclient.Client
+}
+
+// New returns a client for the service at cfg.BaseURL.
+func New(cfg apiclient.Config) (*Client, error) {
+    api, err := apiclient.New(cfg)
+    if err != nil {
+        return nil, err
+    }
+    return &Client{api: api}, nil
+}
+
+// Order is the v2 order response.
+type Order struct {
+    ID              string               `json:"id"`
+    // OrderNumber is empty for orders placed before numbers were given
+    OrderNumber     string               `json:"order_number,omitempty"`
+    // CustomerID is empty for guest checkouts, which have a ContactEmail
+    CustomerID      string               `json:"customer_id"`
+    ContactEmail    string               `json:"contact_email,omitempty"`
+    Status          string               `json:"status"`
+    Channel         string               `json:"channel"`
+    Totals          OrderTotals          `json:"totals"`
+    ShippingAddress valueobjects.Address `json:"shipping_address"`
+    Items           []OrderItem          `json:"items"`
+    Tags            []string             `json:"tags"`
+    Version         int                  `json:"version"`
+    Timeline        OrderTimeline        `json:"timeline"`
+    // Delivery is set once the order is delivered
+    Delivery        *Delivery            `json:"delivery,omitempty"`
+    // Cancellation is set while the order is cancelled
+    Cancellation    *Cancellation        `json:"cancellation,omitempty"`
+    // Archived is set for orders moved to the archive
+    Archived        bool                 `json:"archived,omitempty"`
+}
+
+type OrderTotals struct {
+    Items    valueobjects.Money `json:"items"`
+    Shipping valueobjects.Money `json:"shipping"`
+    Grand    valueobjects.Money `json:"grand"`
+}
+
+type OrderTimeline struct {
+    CreatedAt       apijson.Timestamp `json:"created_at"`
+    UpdatedAt       apijson.Timestamp `json:"updated_at"`
+    StatusChangedAt apijson.Timestamp `json:"status_changed_at"`
+}
+
+// Delivery details an order's delivery. Orders delivered before the
+// details were recorded have them nil.
+type Delivery struct {
+    DeliveredAt      *apijson.Timestamp `json:"delivered_at"`
+    SignedBy         *string            `json:"signed_by"`
+    CarrierReference *string            `json:"carrier_reference"`
+}
+
+// Cancellation tells why an order was cancelled: Reason is one of
+// customer_request, payment_failed, fraud, inventory, expired or other.
+type Cancellation struct {
+    Reason  string  `json:"reason"`
+    Details *string `json:"details"`
+    Forced  bool    `json:"forced"`
+}
+
+type OrderItem struct {
+    ProductID string             `json:"product_id"`
+    Quantity  int                `json:"quantity"`
+    Price     valueobjects.Money `json:"price"`
+}
+
+// OrderSummary is an order as ListOrders returns it. Amounts are in minor
+// units of Currency.
+type OrderSummary struct {
+    ID          string            `json:"id"`
+    OrderNumber string            `json:"order_number,omitempty"`
+    CustomerID  string            `json:"customer_id"`
+    Status      string            `json:"status"`
+    Channel     string            `json:"channel"`
+    Total       int64             `json:"total"`
+    GrandTotal  int64             `json:"grand_total"`
+    Currency    string            `json:"currency"`
+    ItemCount   int               `json:"item_count"`
+    CreatedAt   apijson.Timestamp `json:"created_at"`
+    Archived    bool              `json:"archived,omitempty"`
+}
+
+// OrderFilter selects the orders ListOrders returns; at least one field
+// must be set.
+type OrderFilter struct {
+    CustomerID      string
+    // ContactEmail selects guest checkouts by their contact email
+    ContactEmail    string
+    // Number is a human-readable order number, such as ORD-2024-000123
+    Number          string
+    // Channel is web, mobile, phone or unknown
+    Channel         string
+    Tag             string
+    ProductID       string
+    // IncludeArchived lists archived orders too; it selects none alone
+    IncludeArchived bool
+}
+
+// Page is a page of results. A zero Limit takes the server's default.
+type Page struct {
+    Limit  int `json:"limit"`
+    Offset int `json:"offset"`
+    // Count is how many results the page holds
+    Count  int `json:"count"`
+}
+
+type OrderList struct {
+    Orders     []OrderSummary `json:"orders"`
+    Pagination Page           `json:"pagination"`
+}
+
+// OrderAnalytics is the v2 analytics response.
+type OrderAnalytics struct {
+    Period          string                      `json:"period"`
+    // From and To are nil for period all
+    From            *apijson.Timestamp          `json:"from"`
+    To              *apijson.Timestamp          `json:"to"`
+    Timezone        string                      `json:"timezone"`
+    IncludeShipping bool                        `json:"include_shipping"`
+    TotalOrders     int64                       `json:"total_orders"`
+    Revenue         Revenue                     `json:"revenue"`
+    OrdersByStatus  map[string]int64            `json:"orders_by_status"`
+    ByChannel       map[string]ChannelAnalytics `json:"by_channel"`
+    // CancellationsByReason counts cancelled orders by reason
+    CancellationsByReason map[string]int64      `json:"cancellations_by_reason"`
+}
+
+type Revenue struct {
+    Total             int64 `json:"total"`
+    Shipping          int64 `json:"shipping"`
+    AverageOrderValue int64 `json:"average_order_value"`
+}
+
+type ChannelAnalytics struct {
+    Orders  int64 `json:"orders"`
+    Revenue int64 `json:"revenue"`
+}
+
+// AnalyticsQuery selects the analytics window.
+type AnalyticsQuery struct {
+    // Period is daily, weekly, monthly, all or custom; empty means
+    // monthly, or custom when From is set
+    Period          string
+    // From and To give a custom window; a zero To means now
+    From            time.Time
+    To              time.Time
+    // Timezone is the IANA time zone days start in; empty means UTC
+    Timezone        string
+    // ExcludeShipping leaves shipping out of the revenue figures
+    ExcludeShipping bool
+}
+
+func (c *Client) GetOrder(ctx context.Context, orderID string) (*Order, error) {
+    var order Order
+    req := apiclient.Request{Method: http.MethodGet, Path: apiversion.V2.Prefix() + "/orders/" + url.PathEscape(orderID)}
+    if err := c.api.Do(ctx, req, &order); err != nil {
+        return nil, err
+    }
+    return &order, nil
+}
+
+func (c *Client) ListOrders(ctx context.Context, filter OrderFilter, page Page) (*OrderList, error) {
+    query := url.Values{}
+    for name, value := range map[string]string{
+        "customer_id":   filter.CustomerID,
+        "contact_email": filter.ContactEmail,
+        "number":        filter.Number,
+        "channel":       filter.Channel,
+        "tag":           filter.Tag,
+        "product_id":    filter.ProductID,
+    } {
+        if value != "" {
+            query.Set(name, value)
+        }
+    }
+    if filter.IncludeArchived {
+        query.Set("include_archived", "true")
+    }
+    if page.Limit > 0 {
+        query.Set("limit", strconv.Itoa(page.Limit))
+    }
+    if page.Offset > 0 {
+        query.Set("offset", strconv.Itoa(page.Offset))
+    }
+    
+    var list OrderList
+    req := apiclient.Request{Method: http.MethodGet, Path: apiversion.V2.Prefix() + "/orders", Query: query}
+    if err := c.api.Do(ctx, req, &list); err != nil {
+        return nil, err
+    }
+    return &list, nil
+}
+
+func (c *Client) GetAnalytics(ctx context.Context, q AnalyticsQuery) (*OrderAnalytics, error) {
+    query := url.Values{}
+    if q.Period != "" {
+        query.Set("period", q.Period)
+    }
+    if !q.From.IsZero() {
+        query.Set("from", q.From.Format(time.RFC3339Nano))
+    }
+    if !q.To.IsZero() {
+        query.Set("to", q.To.Format(time.RFC3339Nano))
+    }
+    if q.Timezone != "" {
+        query.Set("tz", q.Timezone)
+    }
+    if q.ExcludeShipping {
+        query.Set("include_shipping", "false")
+    }
+    
+    var analytics OrderAnalytics
+    req := apiclient.Request{Method: http.MethodGet, Path: apiversion.V2.Prefix() + "/analytics/orders", Query: query}
+    if err := c.api.Do(ctx, req, &analytics); err != nil {
+        return nil, err
+    }
+    return &analytics, nil
+}
@@ -0,0 +1,110 @@
+// Package clock tells the time to the domain and the services, so the
+// timestamps they record can be made deterministic. Entities and event
+// constructors read the package clock through Now; services and workers
+// take a Clock and default to Default, which follows the package clock, so
+// Set stops or moves the time everywhere at once.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time.
+type Clock interface {
+    Now() time.Time
+}
+
+// System is the real clock.
+type System struct{}
+
+func (System) Now() time.Time {
+    return time.Now()
+}
+
+// Func adapts a function, such as the Now fields workers take, to a Clock.
+type Func func() time.Time
+
+func (f Func) Now() time.Time {
+    return f()
+}
+
+var (
+    mu      sync.RWMutex
+    current Clock = System{}
+)
+
+// Default tells the time of the package clock at each call, so holders of it
+// follow Set.
+var Default Clock = packageClock{}
+
+type packageClock struct{}
+
+func (packageClock) Now() time.Time {
+    mu.RLock()
+    defer mu.RUnlock()
+    return current.Now()
+}
+
+// Now returns the time of the package clock.
+func Now() time.Time {
+    return Default.Now()
+}
+
+// Set replaces the package clock with c and returns a function restoring the
+// clock it replaced. A nil c restores the real clock.
+func Set(c Clock) (restore func()) {
+    if c == nil {
+        c = System{}
+    }
+    mu.Lock()
+    previous := current
+    current = c
+    mu.Unlock()
+    return func() {
+        mu.Lock()
+        current = previous
+        mu.Unlock()
+    }
+}
+
+// OrDefault returns c, or Default when c is nil.
+func OrDefault(c Clock) Clock {
+    if c == nil {
+        return Default
+    }
+    return c
+}
+
+// Fake is a clock that only moves when told to. It is safe for concurrent
+// use.
+type Fake struct {
+    mu  sync.Mutex
+    now time.Time
+}
+
+// NewFake returns a fake clock stopped at now.
+func NewFake(now time.Time) *Fake {
+    return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.now
+}
+
+// Set stops the clock at now.
+func (f *Fake) Set(now time.Time) {
+    f.mu.Lock()
+    f.now = now
+    f.mu.Unlock()
+}
+
+// Advance moves the clock on by d and returns the new time.
+func (f *Fake) Advance(d time.Duration) time.Time {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.now = f.now.Add(d)
+    return f.now
+}
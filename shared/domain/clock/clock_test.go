@@ -0,0 +1,97 @@
+package clock
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestFake(t *testing.T) {
+    fake := NewFake(start)
+    if got := fake.Now(); !got.Equal(start) {
+        t.Fatalf("Now() = %v, want %v", got, start)
+    }
+    if got := fake.Now(); !got.Equal(start) {
+        t.Errorf("Now() moved on its own to %v", got)
+    }
+    if got := fake.Advance(time.Hour); !got.Equal(start.Add(time.Hour)) {
+        t.Errorf("Advance(1h) = %v, want %v", got, start.Add(time.Hour))
+    }
+    later := start.Add(48 * time.Hour)
+    fake.Set(later)
+    if got := fake.Now(); !got.Equal(later) {
+        t.Errorf("Now() after Set = %v, want %v", got, later)
+    }
+}
+
+// Run with -race.
+func TestFake_concurrentUse(t *testing.T) {
+    fake := NewFake(start)
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 100; j++ {
+                fake.Advance(time.Second)
+                fake.Now()
+            }
+        }()
+    }
+    wg.Wait()
+    if got, want := fake.Now(), start.Add(800*time.Second); !got.Equal(want) {
+        t.Errorf("Now() = %v, want %v", got, want)
+    }
+}
+
+func TestSet(t *testing.T) {
+    held := Default
+    fake := NewFake(start)
+    restore := Set(fake)
+    
+    if got := Now(); !got.Equal(start) {
+        t.Errorf("Now() = %v, want the fake's %v", got, start)
+    }
+    // Holders of Default follow the clock set after they took it
+    fake.Advance(time.Minute)
+    if got := held.Now(); !got.Equal(start.Add(time.Minute)) {
+        t.Errorf("Default.Now() = %v, want %v", got, start.Add(time.Minute))
+    }
+    
+    inner := Set(Func(func() time.Time { return start.Add(time.Hour) }))
+    if got := Now(); !got.Equal(start.Add(time.Hour)) {
+        t.Errorf("Now() under a nested Set = %v, want %v", got, start.Add(time.Hour))
+    }
+    inner()
+    if got := Now(); !got.Equal(start.Add(time.Minute)) {
+        t.Errorf("Now() after the inner restore = %v, want the fake's %v", got, start.Add(time.Minute))
+    }
+    
+    restore()
+    if got := Now(); time.Since(got) > time.Minute {
+        t.Errorf("Now() after restore = %v, want the real time", got)
+    }
+}
+
+func TestSet_nilIsTheRealClock(t *testing.T) {
+    restore := Set(NewFake(start))
+    defer restore()
+    
+    inner := Set(nil)
+    defer inner()
+    if got := Now(); time.Since(got) > time.Minute {
+        t.Errorf("Now() after Set(nil) = %v, want the real time", got)
+    }
+}
+
+func TestOrDefault(t *testing.T) {
+    if got := OrDefault(nil); got != Default {
+        t.Errorf("OrDefault(nil) = %#v, want Default", got)
+    }
+    fake := NewFake(start)
+    if got := OrDefault(fake); got != Clock(fake) {
+        t.Errorf("OrDefault(fake) = %#v, want the fake", got)
+    }
+}
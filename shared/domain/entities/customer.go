@@ -5,16 +5,42 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
 	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
 )
 
 type CustomerID string
 
+// ErrAddressNotFound is returned for an address id the customer does not
+// have.
+var ErrAddressNotFound = errors.New("address not found")
+
+// ErrDuplicateAddress is returned when an address being saved equals, as
+// valueobjects.Address.Equals compares them, one the customer already has.
+var ErrDuplicateAddress = errors.New("address already saved")
+
+// ErrTooManyAddresses is returned when a customer with MaxAddresses saved
+// addresses saves another.
+var ErrTooManyAddresses = errors.New("too many saved addresses")
+
+// MaxAddresses is how many addresses a customer can save.
+const MaxAddresses = 20
+
+// CustomerAddress is a saved address with an id that stays stable while
+// other addresses are added and removed. Orders copy the Address, so
+// editing a saved address does not change existing orders.
+type CustomerAddress struct {
+    ID string `json:"id"`
+    // Default marks the address orders ship to when none is given
+    Default bool `json:"default,omitempty"`
+    valueobjects.Address
+}
+
 type Customer struct {
     ID        CustomerID
     Email     string
     Name      string
-    Addresses []valueobjects.Address
+    Addresses []CustomerAddress
     CreatedAt time.Time
     UpdatedAt time.Time
 }
@@ -24,9 +50,9 @@ func NewCustomer(email, name string) *Customer {
         ID:        CustomerID(uuid.New().String()),
         Email:     email,
         Name:      name,
-        Addresses: []valueobjects.Address{},
-        CreatedAt: time.Now(),
-        UpdatedAt: time.Now(),
+        Addresses: []CustomerAddress{},
+        CreatedAt: clock.Now(),
+        UpdatedAt: clock.Now(),
     }
 }
 
@@ -41,7 +67,7 @@ func (c *Customer) UpdateEmail(email string) error {
     }
     
     c.Email = email
-    c.UpdatedAt = time.Now()
+    c.UpdatedAt = clock.Now()
     
     return nil
 }
@@ -52,33 +78,109 @@ func (c *Customer) UpdateName(name string) error {
     }
     
     c.Name = name
-    c.UpdatedAt = time.Now()
+    c.UpdatedAt = clock.Now()
     
     return nil
 }
 
-func (c *Customer) AddAddress(address valueobjects.Address) error {
+// AddAddress saves address and returns its id. The first address saved
+// becomes the default. It returns ErrDuplicateAddress when the address is
+// already saved, and ErrTooManyAddresses when MaxAddresses are.
+func (c *Customer) AddAddress(address valueobjects.Address) (string, error) {
+    if err := address.Validate(); err != nil {
+        return "", err
+    }
+    if _, ok := c.findDuplicateAddress(address, ""); ok {
+        return "", ErrDuplicateAddress
+    }
+    if len(c.Addresses) >= MaxAddresses {
+        return "", ErrTooManyAddresses
+    }
+    
+    saved := CustomerAddress{
+        ID:      uuid.New().String(),
+        Default: len(c.Addresses) == 0,
+        Address: address,
+    }
+    c.Addresses = append(c.Addresses, saved)
+    c.UpdatedAt = clock.Now()
+    
+    return saved.ID, nil
+}
+
+// UpdateAddress replaces the saved address with id. It returns
+// ErrDuplicateAddress when another saved address equals the new one.
+func (c *Customer) UpdateAddress(id string, address valueobjects.Address) error {
     if err := address.Validate(); err != nil {
         return err
     }
     
-    c.Addresses = append(c.Addresses, address)
-    c.UpdatedAt = time.Now()
+    i, ok := c.findAddress(id)
+    if !ok {
+        return ErrAddressNotFound
+    }
+    if _, ok := c.findDuplicateAddress(address, id); ok {
+        return ErrDuplicateAddress
+    }
+    
+    c.Addresses[i].Address = address
+    c.UpdatedAt = clock.Now()
+    
+    return nil
+}
+
+// RemoveAddress deletes the saved address with id. Removing the default
+// makes the oldest remaining address the default.
+func (c *Customer) RemoveAddress(id string) error {
+    i, ok := c.findAddress(id)
+    if !ok {
+        return ErrAddressNotFound
+    }
+    
+    wasDefault := c.Addresses[i].Default
+    c.Addresses = append(c.Addresses[:i], c.Addresses[i+1:]...)
+    if wasDefault && len(c.Addresses) > 0 {
+        c.Addresses[0].Default = true
+    }
+    c.UpdatedAt = clock.Now()
     
     return nil
 }
 
-func (c *Customer) RemoveAddress(index int) error {
-    if index < 0 || index >= len(c.Addresses) {
-        return errors.New("invalid address index")
+// SetDefaultAddress makes the saved address with id the default.
+func (c *Customer) SetDefaultAddress(id string) error {
+    if _, ok := c.findAddress(id); !ok {
+        return ErrAddressNotFound
     }
     
-    c.Addresses = append(c.Addresses[:index], c.Addresses[index+1:]...)
-    c.UpdatedAt = time.Now()
+    for i := range c.Addresses {
+        c.Addresses[i].Default = c.Addresses[i].ID == id
+    }
+    c.UpdatedAt = clock.Now()
     
     return nil
 }
 
+func (c *Customer) findAddress(id string) (int, bool) {
+    for i, address := range c.Addresses {
+        if address.ID == id {
+            return i, true
+        }
+    }
+    return -1, false
+}
+
+// findDuplicateAddress finds a saved address other than the one with
+// exceptID that equals address.
+func (c *Customer) findDuplicateAddress(address valueobjects.Address, exceptID string) (int, bool) {
+    for i, saved := range c.Addresses {
+        if saved.ID != exceptID && saved.Address.Equals(address) {
+            return i, true
+        }
+    }
+    return -1, false
+}
+
 func isValidEmail(email string) bool {
     // Simple email validation - in production, use a proper email validation library
     return len(email) > 0 && len(email) < 255
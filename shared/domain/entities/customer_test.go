@@ -0,0 +1,146 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// addresses returns n distinct valid addresses.
+func addresses(n int) []valueobjects.Address {
+    streets := []string{"1 Main St", "2 Oak Ave", "3 Elm Rd", "4 Pine Ln"}
+    var list []valueobjects.Address
+    for _, street := range streets[:n] {
+        list = append(list, valueobjects.NewAddress(street, "Springfield", "IL", "62701", "US"))
+    }
+    return list
+}
+
+// Saved address ids stay the same as other addresses come and go, and the
+// oldest remaining address takes over as default.
+func TestCustomer_addressIDs(t *testing.T) {
+    customer := NewCustomer("ada@example.com", "Ada")
+    var ids []string
+    for _, address := range addresses(3) {
+        id, err := customer.AddAddress(address)
+        if err != nil {
+            t.Fatalf("AddAddress() = %v", err)
+        }
+        ids = append(ids, id)
+    }
+    if !customer.Addresses[0].Default || customer.Addresses[1].Default || customer.Addresses[2].Default {
+        t.Errorf("defaults = %+v, want only the first address", customer.Addresses)
+    }
+    
+    if err := customer.RemoveAddress(ids[0]); err != nil {
+        t.Fatalf("RemoveAddress() = %v", err)
+    }
+    if len(customer.Addresses) != 2 || customer.Addresses[0].ID != ids[1] || customer.Addresses[1].ID != ids[2] {
+        t.Fatalf("addresses after removal = %+v, want ids %v", customer.Addresses, ids[1:])
+    }
+    if !customer.Addresses[0].Default {
+        t.Error("removing the default did not make the oldest remaining address the default")
+    }
+    
+    if err := customer.SetDefaultAddress(ids[2]); err != nil {
+        t.Fatalf("SetDefaultAddress() = %v", err)
+    }
+    if customer.Addresses[0].Default || !customer.Addresses[1].Default {
+        t.Errorf("defaults = %+v, want only %s", customer.Addresses, ids[2])
+    }
+    
+    edited := addresses(4)[3]
+    if err := customer.UpdateAddress(ids[1], edited); err != nil {
+        t.Fatalf("UpdateAddress() = %v", err)
+    }
+    if customer.Addresses[0].ID != ids[1] || customer.Addresses[0].Address != edited {
+        t.Errorf("address after update = %+v, want %s at %v", customer.Addresses[0], ids[1], edited)
+    }
+}
+
+func TestCustomer_unknownAddress(t *testing.T) {
+    customer := NewCustomer("ada@example.com", "Ada")
+    if _, err := customer.AddAddress(addresses(1)[0]); err != nil {
+        t.Fatalf("AddAddress() = %v", err)
+    }
+    
+    tests := []struct {
+        name   string
+        change func() error
+    }{
+        {name: "update", change: func() error { return customer.UpdateAddress("missing", addresses(2)[1]) }},
+        {name: "remove", change: func() error { return customer.RemoveAddress("missing") }},
+        {name: "set default", change: func() error { return customer.SetDefaultAddress("missing") }},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if err := tt.change(); !errors.Is(err, ErrAddressNotFound) {
+                t.Errorf("%s = %v, want ErrAddressNotFound", tt.name, err)
+            }
+        })
+    }
+}
+
+// Addresses differing from a saved one only in case, whitespace or zip
+// punctuation are duplicates, whether added or edited in; editing an
+// address into itself is not.
+func TestCustomer_duplicateAddress(t *testing.T) {
+    customer := NewCustomer("ada@example.com", "Ada")
+    saved := addresses(2)
+    var ids []string
+    for _, address := range saved {
+        id, err := customer.AddAddress(address)
+        if err != nil {
+            t.Fatalf("AddAddress() = %v", err)
+        }
+        ids = append(ids, id)
+    }
+    nearDuplicates := []valueobjects.Address{
+        valueobjects.NewAddress("1 MAIN ST", "springfield", "il", "62701", "us"),
+        valueobjects.NewAddress(" 1  Main St", "Springfield ", "IL", "627-01", "US"),
+    }
+    
+    for _, address := range nearDuplicates {
+        if _, err := customer.AddAddress(address); !errors.Is(err, ErrDuplicateAddress) {
+            t.Errorf("AddAddress(%v) = %v, want ErrDuplicateAddress", address, err)
+        }
+        if err := customer.UpdateAddress(ids[1], address); !errors.Is(err, ErrDuplicateAddress) {
+            t.Errorf("UpdateAddress(%v) = %v, want ErrDuplicateAddress", address, err)
+        }
+        if err := customer.UpdateAddress(ids[0], address); err != nil {
+            t.Errorf("UpdateAddress() of the address into %v = %v, want it saved", address, err)
+        }
+    }
+    if len(customer.Addresses) != 2 || customer.Addresses[1].Address != saved[1] {
+        t.Errorf("addresses = %+v, want the two saved", customer.Addresses)
+    }
+}
+
+func TestCustomer_tooManyAddresses(t *testing.T) {
+    customer := NewCustomer("ada@example.com", "Ada")
+    address := func(i int) valueobjects.Address {
+        return valueobjects.NewAddress(fmt.Sprintf("%d Main St", i+1), "Springfield", "IL", "62701", "US")
+    }
+    for i := 0; i < MaxAddresses; i++ {
+        if _, err := customer.AddAddress(address(i)); err != nil {
+            t.Fatalf("AddAddress() #%d = %v", i+1, err)
+        }
+    }
+    
+    if _, err := customer.AddAddress(address(MaxAddresses)); !errors.Is(err, ErrTooManyAddresses) {
+        t.Errorf("AddAddress() past MaxAddresses = %v, want ErrTooManyAddresses", err)
+    }
+    // A duplicate is reported as such even when full
+    if _, err := customer.AddAddress(address(0)); !errors.Is(err, ErrDuplicateAddress) {
+        t.Errorf("AddAddress() of a saved address = %v, want ErrDuplicateAddress", err)
+    }
+    if err := customer.RemoveAddress(customer.Addresses[0].ID); err != nil {
+        t.Fatalf("RemoveAddress() = %v", err)
+    }
+    if _, err := customer.AddAddress(address(MaxAddresses)); err != nil {
+        t.Errorf("AddAddress() after a removal = %v, want it saved", err)
+    }
+}
@@ -0,0 +1,48 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidOrderID is returned for an order id that is not a UUID.
+var ErrInvalidOrderID = errors.New("invalid order id")
+
+// ErrInvalidCustomerID is returned for a customer id that is not a UUID.
+var ErrInvalidCustomerID = errors.New("invalid customer id")
+
+// ParseOrderID validates an order id from outside the domain, such as a
+// path parameter. Ids are UUIDs; they are returned in the lower case form
+// they are stored in.
+func ParseOrderID(s string) (OrderID, error) {
+    id, err := parseUUID(s)
+    if err != nil {
+        return "", fmt.Errorf("%w %q", ErrInvalidOrderID, s)
+    }
+    return OrderID(id), nil
+}
+
+// ParseCustomerID validates a customer id from outside the domain, as
+// ParseOrderID does order ids.
+func ParseCustomerID(s string) (CustomerID, error) {
+    id, err := parseUUID(s)
+    if err != nil {
+        return "", fmt.Errorf("%w %q", ErrInvalidCustomerID, s)
+    }
+    return CustomerID(id), nil
+}
+
+// parseUUID accepts only the 36 character hyphenated form, which uuid.Parse
+// extends with braces and urn:uuid: prefixes.
+func parseUUID(s string) (string, error) {
+    if len(s) != 36 {
+        return "", errors.New("not a hyphenated UUID")
+    }
+    id, err := uuid.Parse(s)
+    if err != nil {
+        return "", err
+    }
+    return id.String(), nil
+}
@@ -0,0 +1,65 @@
+package entities
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseOrderID(t *testing.T) {
+    tests := []struct {
+        name    string
+        input   string
+        want    OrderID
+        wantErr bool
+    }{
+        {name: "lower case", input: "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10", want: "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10"},
+        {name: "upper case", input: "7D1C3A52-5B2E-4F0E-9A43-2F6C1B8E9D10", want: "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10"},
+        {name: "empty", input: "", wantErr: true},
+        {name: "word", input: "order-1", wantErr: true},
+        {name: "without hyphens", input: "7d1c3a525b2e4f0e9a432f6c1b8e9d10", wantErr: true},
+        {name: "braces", input: "{7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10}", wantErr: true},
+        {name: "urn", input: "urn:uuid:7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9d10", wantErr: true},
+        {name: "not hex", input: "7d1c3a52-5b2e-4f0e-9a43-2f6c1b8e9dzz", wantErr: true},
+        {name: "path traversal", input: "../../../../etc/passwd-aaaaaaaaaaaaa", wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := ParseOrderID(tt.input)
+            if tt.wantErr {
+                if !errors.Is(err, ErrInvalidOrderID) || errors.Is(err, ErrInvalidCustomerID) {
+                    t.Errorf("ParseOrderID(%q) = %q, %v, want ErrInvalidOrderID", tt.input, got, err)
+                }
+                return
+            }
+            if err != nil || got != tt.want {
+                t.Errorf("ParseOrderID(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseCustomerID(t *testing.T) {
+    tests := []struct {
+        input   string
+        want    CustomerID
+        wantErr bool
+    }{
+        {input: "0B6E4D1A-3C2F-4E5D-8A9B-1C2D3E4F5A6B", want: "0b6e4d1a-3c2f-4e5d-8a9b-1c2d3e4f5a6b"},
+        {input: "customer-1", wantErr: true},
+        {input: "", wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        got, err := ParseCustomerID(tt.input)
+        if tt.wantErr {
+            if !errors.Is(err, ErrInvalidCustomerID) {
+                t.Errorf("ParseCustomerID(%q) = %q, %v, want ErrInvalidCustomerID", tt.input, got, err)
+            }
+            continue
+        }
+        if err != nil || got != tt.want {
+            t.Errorf("ParseCustomerID(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+        }
+    }
+}
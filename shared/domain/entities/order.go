@@ -2,23 +2,120 @@ package entities
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
 	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
 )
 
 type OrderID string
 
+// ErrReopenNotAllowed is returned when reopening an order that was not
+// cancelled while still in draft.
+var ErrReopenNotAllowed = errors.New("only orders cancelled while in draft can be reopened")
+
+// ErrItemPriceImmutable is returned when an existing item would be given a
+// different unit price.
+var ErrItemPriceImmutable = errors.New("unit price of an existing item cannot be changed")
+
+// ErrItemCurrencyMismatch is returned when an item is priced in another
+// currency than the order's other items.
+var ErrItemCurrencyMismatch = errors.New("items of an order must share one currency")
+
+// ErrOrderContactRequired is returned when creating an order with neither a
+// customer nor, for guest checkouts, a contact email.
+var ErrOrderContactRequired = errors.New("an order needs a customer_id or a contact_email")
+
+// ErrOrderAlreadyCancelled is returned when cancelling an order that is
+// already cancelled.
+var ErrOrderAlreadyCancelled = errors.New("order is already cancelled")
+
+// ErrCancellationWindowClosed is returned when cancelling a confirmed order
+// after its CancellationPolicy window, without forcing it.
+var ErrCancellationWindowClosed = errors.New("cancellation window for confirmed order has closed")
+
+// ErrDeliveryInFuture is returned when delivering an order at a time that
+// has not come yet.
+var ErrDeliveryInFuture = errors.New("delivery time cannot be in the future")
+
+// ErrDeliveryBeforeShipment is returned when delivering an order at a time
+// before it was shipped.
+var ErrDeliveryBeforeShipment = errors.New("delivery time cannot be before shipment")
+
+// ErrOrderOnHold is returned when shipping an order on hold, which must be
+// released first.
+var ErrOrderOnHold = errors.New("order is on hold")
+
+// ErrHoldReasonRequired is returned when holding an order without saying
+// why.
+var ErrHoldReasonRequired = errors.New("a reason is required to hold an order")
+
+// ErrGuestOrderReassign is returned when reassigning a guest checkout,
+// which has no customer to merge into another.
+var ErrGuestOrderReassign = errors.New("guest checkouts cannot be reassigned to a customer")
+
+// CancellationPolicy limits how long after confirmation an order may still
+// be cancelled.
+type CancellationPolicy struct {
+    // Window after ConfirmedAt during which a confirmed order may be
+    // cancelled; zero allows cancellation at any time
+    Window time.Duration
+    // Now returns the current time; defaults to clock.Now
+    Now func() time.Time
+}
+
+func (p CancellationPolicy) now() time.Time {
+    if p.Now == nil {
+        return clock.Now()
+    }
+    return p.Now()
+}
+
 type Order struct {
     ID              OrderID
+    // Number is the human-readable order number, such as ORD-2024-000123,
+    // given when the order is created; empty for orders from before
+    // numbers were given
+    Number          string
+    // CustomerID is empty for guest checkouts, which have a ContactEmail
     CustomerID      string
+    // ContactEmail is the email guest checkouts are reached at; orders of
+    // customers may have one too
+    ContactEmail    valueobjects.Email
     Items           []OrderItem
     Status          valueobjects.OrderStatus
+    PreviousStatus  valueobjects.OrderStatus
     TotalAmount     valueobjects.Money
+    ShippingCost    valueobjects.Money
+    GrandTotal      valueobjects.Money
     ShippingAddress valueobjects.Address
+    Channel         valueobjects.OrderChannel
+    // ConfirmedAt is when the order was confirmed; zero until then
+    ConfirmedAt     time.Time
+    // ShippedAt is when the order was shipped; zero until then, and for
+    // orders shipped before it was recorded
+    ShippedAt       time.Time
+    // DeliveredAt is when the order was handed over and SignedBy who
+    // signed for it, if anyone; zero until delivered
+    DeliveredAt     time.Time
+    SignedBy        string
+    // HoldReason is why the order was put on hold; empty unless it is on
+    // hold
+    HoldReason      string
     CreatedAt       time.Time
     UpdatedAt       time.Time
+    // Version is the number of events in the order's history it reflects;
+    // new events are stored after it
+    Version         int
+    
+    // limits guard item changes; orders loaded from storage are unlimited
+    // until SetLimits is called
+    limits OrderLimits
+    // restrictions guard address changes; nil allows every country
+    restrictions ShippingRestrictions
 }
 
 type OrderItem struct {
@@ -27,17 +124,36 @@ type OrderItem struct {
     Price     valueobjects.Money
 }
 
-func NewOrder(customerID string, shippingAddress valueobjects.Address) *Order {
+// NewOrder starts a draft order of customerID, or, for a guest checkout
+// with no customer, of contactEmail. It returns ErrOrderContactRequired
+// when both are empty.
+func NewOrder(customerID string, contactEmail valueobjects.Email, shippingAddress valueobjects.Address) (*Order, error) {
+    if customerID == "" && contactEmail == "" {
+        return nil, ErrOrderContactRequired
+    }
     return &Order{
         ID:              OrderID(uuid.New().String()),
         CustomerID:      customerID,
+        ContactEmail:    contactEmail,
         Items:           []OrderItem{},
         Status:          valueobjects.OrderStatusDraft,
         TotalAmount:     valueobjects.Money{},
         ShippingAddress: shippingAddress,
-        CreatedAt:       time.Now(),
-        UpdatedAt:       time.Now(),
-    }
+        Channel:         valueobjects.DefaultOrderChannel,
+        CreatedAt:       clock.Now(),
+        UpdatedAt:       clock.Now(),
+        limits:          DefaultOrderLimits,
+    }, nil
+}
+
+// SetLimits sets the limits AddItem and ReplaceItems enforce.
+func (o *Order) SetLimits(limits OrderLimits) {
+    o.limits = limits
+}
+
+// SetShippingRestrictions sets the countries ChangeShippingAddress refuses.
+func (o *Order) SetShippingRestrictions(restrictions ShippingRestrictions) {
+    o.restrictions = restrictions
 }
 
 func (o *Order) AddItem(productID string, quantity int, price valueobjects.Money) error {
@@ -49,15 +165,57 @@ func (o *Order) AddItem(productID string, quantity int, price valueobjects.Money
         return errors.New("quantity must be greater than zero")
     }
     
+    if existing, ok := o.findItem(productID); ok && existing.Price != price {
+        return ErrItemPriceImmutable
+    }
+    if len(o.Items) > 0 && price.Currency != o.Currency() {
+        return ErrItemCurrencyMismatch
+    }
+    
     item := OrderItem{
         ProductID: productID,
         Quantity:  quantity,
         Price:     price,
     }
     
-    o.Items = append(o.Items, item)
+    items := append(append([]OrderItem{}, o.Items...), item)
+    if err := o.limits.Check(items); err != nil {
+        return err
+    }
+    
+    o.Items = items
     o.recalculateTotal()
-    o.UpdatedAt = time.Now()
+    o.UpdatedAt = clock.Now()
+    
+    return nil
+}
+
+// ReplaceItems swaps the item list of a draft order. Products already on the
+// order must keep their unit price; only quantities and membership may change.
+func (o *Order) ReplaceItems(items []OrderItem) error {
+    if o.Status != valueobjects.OrderStatusDraft {
+        return errors.New("cannot modify order that is not in draft status")
+    }
+    
+    for _, item := range items {
+        if item.Quantity <= 0 {
+            return errors.New("quantity must be greater than zero")
+        }
+        if existing, ok := o.findItem(item.ProductID); ok && existing.Price != item.Price {
+            return ErrItemPriceImmutable
+        }
+        if item.Price.Currency != items[0].Price.Currency {
+            return ErrItemCurrencyMismatch
+        }
+    }
+    
+    if err := o.limits.Check(items); err != nil {
+        return err
+    }
+    
+    o.Items = append([]OrderItem{}, items...)
+    o.recalculateTotal()
+    o.UpdatedAt = clock.Now()
     
     return nil
 }
@@ -71,7 +229,36 @@ func (o *Order) RemoveItem(productID string) error {
         if item.ProductID == productID {
             o.Items = append(o.Items[:i], o.Items[i+1:]...)
             o.recalculateTotal()
-            o.UpdatedAt = time.Now()
+            o.UpdatedAt = clock.Now()
+            return nil
+        }
+    }
+    
+    return errors.New("item not found")
+}
+
+// ChangeItemQuantity sets the quantity of the first line of a product on a
+// draft order, keeping its unit price.
+func (o *Order) ChangeItemQuantity(productID string, quantity int) error {
+    if o.Status != valueobjects.OrderStatusDraft {
+        return errors.New("cannot modify order that is not in draft status")
+    }
+    
+    if quantity <= 0 {
+        return errors.New("quantity must be greater than zero")
+    }
+    
+    for i, item := range o.Items {
+        if item.ProductID == productID {
+            items := append([]OrderItem{}, o.Items...)
+            items[i].Quantity = quantity
+            if err := o.limits.Check(items); err != nil {
+                return err
+            }
+            
+            o.Items = items
+            o.recalculateTotal()
+            o.UpdatedAt = clock.Now()
             return nil
         }
     }
@@ -79,6 +266,26 @@ func (o *Order) RemoveItem(productID string) error {
     return errors.New("item not found")
 }
 
+// ChangeShippingAddress moves a draft order to a new address. Call
+// ApplyShipping afterwards to reprice shipping for it.
+func (o *Order) ChangeShippingAddress(address valueobjects.Address) error {
+    if o.Status != valueobjects.OrderStatusDraft {
+        return errors.New("cannot modify order that is not in draft status")
+    }
+    
+    if err := address.Validate(); err != nil {
+        return fmt.Errorf("invalid shipping address: %w", err)
+    }
+    if err := CheckShippingCountry(o.restrictions, address); err != nil {
+        return err
+    }
+    
+    o.ShippingAddress = address
+    o.UpdatedAt = clock.Now()
+    
+    return nil
+}
+
 func (o *Order) Confirm() error {
     if o.Status != valueobjects.OrderStatusDraft {
         return errors.New("can only confirm draft orders")
@@ -89,44 +296,189 @@ func (o *Order) Confirm() error {
     }
     
     o.Status = valueobjects.OrderStatusConfirmed
-    o.UpdatedAt = time.Now()
+    o.ConfirmedAt = clock.Now()
+    o.UpdatedAt = o.ConfirmedAt
     
     return nil
 }
 
-func (o *Order) Cancel() error {
-    if o.Status == valueobjects.OrderStatusShipped || o.Status == valueobjects.OrderStatusDelivered {
+// Cancel cancels an order that has not shipped. A confirmed order can only
+// be cancelled within the policy's window unless force is set, which
+// callers must reserve for administrators; an order on hold can be
+// cancelled at any time. Cancelling an order again fails with
+// ErrOrderAlreadyCancelled, keeping the status it was cancelled from.
+func (o *Order) Cancel(policy CancellationPolicy, force bool) error {
+    if o.Status == valueobjects.OrderStatusCancelled {
+        return ErrOrderAlreadyCancelled
+    }
+    if !o.Status.CanTransitionTo(valueobjects.OrderStatusCancelled) {
         return errors.New("cannot cancel shipped or delivered orders")
     }
     
+    if o.Status == valueobjects.OrderStatusConfirmed && !force && policy.Window > 0 && !o.ConfirmedAt.IsZero() {
+        if elapsed := policy.now().Sub(o.ConfirmedAt); elapsed > policy.Window {
+            return fmt.Errorf("%w: confirmed %s ago, limit is %s", ErrCancellationWindowClosed, elapsed.Round(time.Minute), policy.Window)
+        }
+    }
+    
+    o.PreviousStatus = o.Status
     o.Status = valueobjects.OrderStatusCancelled
-    o.UpdatedAt = time.Now()
+    o.HoldReason = ""
+    o.UpdatedAt = clock.Now()
+    
+    return nil
+}
+
+// Reopen restores a cancelled order to draft. Only orders that were
+// cancelled while still in draft can be reopened.
+func (o *Order) Reopen() error {
+    if o.Status != valueobjects.OrderStatusCancelled || o.PreviousStatus != valueobjects.OrderStatusDraft {
+        return ErrReopenNotAllowed
+    }
+    
+    o.PreviousStatus = o.Status
+    o.Status = valueobjects.OrderStatusDraft
+    o.UpdatedAt = clock.Now()
+    
+    return nil
+}
+
+// ReassignCustomer moves the order to customerID, as merging the customer
+// who placed it into another does, in any status. It reports whether the
+// order changed: an order already of customerID is left alone, so a merge
+// run again moves nothing twice.
+func (o *Order) ReassignCustomer(customerID string) (bool, error) {
+    if o.CustomerID == "" {
+        return false, ErrGuestOrderReassign
+    }
+    if customerID == "" {
+        return false, ErrOrderContactRequired
+    }
+    if o.CustomerID == customerID {
+        return false, nil
+    }
+    
+    o.CustomerID = customerID
+    o.UpdatedAt = clock.Now()
+    
+    return true, nil
+}
+
+// Hold pauses a confirmed order for review, as of fraud, until Release
+// returns it to confirmed. An order on hold cannot be shipped, but can be
+// cancelled whatever the cancellation window.
+func (o *Order) Hold(reason string) error {
+    if o.Status != valueobjects.OrderStatusConfirmed {
+        return errors.New("can only hold confirmed orders")
+    }
+    
+    reason = strings.TrimSpace(reason)
+    if reason == "" {
+        return ErrHoldReasonRequired
+    }
+    
+    o.Status = valueobjects.OrderStatusOnHold
+    o.HoldReason = reason
+    o.UpdatedAt = clock.Now()
+    
+    return nil
+}
+
+// Release returns an order on hold to confirmed. ConfirmedAt is kept, so
+// the time on hold counts towards the cancellation window.
+func (o *Order) Release() error {
+    if o.Status != valueobjects.OrderStatusOnHold {
+        return errors.New("can only release orders on hold")
+    }
+    
+    o.Status = valueobjects.OrderStatusConfirmed
+    o.HoldReason = ""
+    o.UpdatedAt = clock.Now()
     
     return nil
 }
 
+// Ship ships a confirmed order. It returns ErrOrderOnHold for an order on
+// hold.
 func (o *Order) Ship() error {
+    if o.Status == valueobjects.OrderStatusOnHold {
+        return ErrOrderOnHold
+    }
     if o.Status != valueobjects.OrderStatusConfirmed {
         return errors.New("can only ship confirmed orders")
     }
     
     o.Status = valueobjects.OrderStatusShipped
-    o.UpdatedAt = time.Now()
+    o.ShippedAt = clock.Now()
+    o.UpdatedAt = o.ShippedAt
     
     return nil
 }
 
-func (o *Order) Deliver() error {
+// Deliver records that a shipped order was handed over at deliveredAt, now
+// when zero, and signed for by signedBy, which may be empty. It returns
+// ErrDeliveryInFuture for a time still to come and
+// ErrDeliveryBeforeShipment for one before ShippedAt.
+func (o *Order) Deliver(deliveredAt time.Time, signedBy string) error {
     if o.Status != valueobjects.OrderStatusShipped {
         return errors.New("can only deliver shipped orders")
     }
     
+    now := clock.Now()
+    if deliveredAt.IsZero() {
+        deliveredAt = now
+    }
+    if deliveredAt.After(now) {
+        return ErrDeliveryInFuture
+    }
+    if !o.ShippedAt.IsZero() && deliveredAt.Before(o.ShippedAt) {
+        return ErrDeliveryBeforeShipment
+    }
+    
     o.Status = valueobjects.OrderStatusDelivered
-    o.UpdatedAt = time.Now()
+    o.DeliveredAt = deliveredAt
+    o.SignedBy = strings.TrimSpace(signedBy)
+    o.UpdatedAt = now
+    
+    return nil
+}
+
+func (o *Order) findItem(productID string) (OrderItem, bool) {
+    for _, item := range o.Items {
+        if item.ProductID == productID {
+            return item, true
+        }
+    }
+    return OrderItem{}, false
+}
+
+// ApplyShipping prices shipping for the current items and address with calc
+// and refreshes the grand total. Call it after changing either.
+func (o *Order) ApplyShipping(calc ShippingCalculator) error {
+    cost, err := calc.Calculate(o.Items, o.ShippingAddress)
+    if err != nil {
+        return fmt.Errorf("failed to calculate shipping: %w", err)
+    }
+    
+    o.ShippingCost = cost
+    o.recalculateTotal()
     
     return nil
 }
 
+// Currency returns the currency the order is priced in: that of its items,
+// or, while it has none, that of its totals, or valueobjects.DefaultCurrency
+// before it had any.
+func (o *Order) Currency() string {
+    if len(o.Items) > 0 {
+        return o.Items[0].Price.Currency
+    }
+    if o.TotalAmount.Currency != "" {
+        return o.TotalAmount.Currency
+    }
+    return valueobjects.DefaultCurrency
+}
+
 func (o *Order) recalculateTotal() {
     total := int64(0)
     for _, item := range o.Items {
@@ -134,8 +486,13 @@ func (o *Order) recalculateTotal() {
         total += itemTotal
     }
     
+    currency := o.Currency()
     o.TotalAmount = valueobjects.Money{
         Amount:   total,
-        Currency: "USD",
+        Currency: currency,
+    }
+    o.GrandTotal = valueobjects.Money{
+        Amount:   total + o.ShippingCost.Amount,
+        Currency: currency,
     }
 }
@@ -0,0 +1,49 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrOrderLimitExceeded is wrapped by the errors returned when an order
+// would exceed its OrderLimits.
+var ErrOrderLimitExceeded = errors.New("order limit exceeded")
+
+// OrderLimits caps the size of an order. A zero field is unlimited.
+type OrderLimits struct {
+    // MaxItems is the largest number of lines on an order
+    MaxItems int
+    // MaxQuantity is the largest quantity of a single line
+    MaxQuantity int
+    // MaxTotal is the largest item total, in minor currency units
+    MaxTotal int64
+}
+
+// DefaultOrderLimits applies to orders created with NewOrder until SetLimits
+// is called.
+var DefaultOrderLimits = OrderLimits{
+    MaxItems:    100,
+    MaxQuantity: 1000,
+    MaxTotal:    100_000_000,
+}
+
+// Check reports the first limit items would exceed.
+func (l OrderLimits) Check(items []OrderItem) error {
+    if l.MaxItems > 0 && len(items) > l.MaxItems {
+        return fmt.Errorf("%w: order has %d items, over the limit of %d", ErrOrderLimitExceeded, len(items), l.MaxItems)
+    }
+    
+    total := int64(0)
+    for _, item := range items {
+        if l.MaxQuantity > 0 && item.Quantity > l.MaxQuantity {
+            return fmt.Errorf("%w: quantity %d of product %s is over the limit of %d", ErrOrderLimitExceeded, item.Quantity, item.ProductID, l.MaxQuantity)
+        }
+        total += item.Price.Amount * int64(item.Quantity)
+    }
+    
+    if l.MaxTotal > 0 && total > l.MaxTotal {
+        return fmt.Errorf("%w: order total %d is over the limit of %d", ErrOrderLimitExceeded, total, l.MaxTotal)
+    }
+    
+    return nil
+}
@@ -0,0 +1,88 @@
+package entities
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+func TestOrderLimits_Check(t *testing.T) {
+    limits := OrderLimits{MaxItems: 2, MaxQuantity: 3, MaxTotal: 1000}
+    item := func(productID string, quantity int, amount int64) OrderItem {
+        return OrderItem{ProductID: productID, Quantity: quantity, Price: valueobjects.NewMoney(amount, "USD")}
+    }
+    
+    tests := []struct {
+        name    string
+        limits  OrderLimits
+        items   []OrderItem
+        wantErr bool
+    }{
+        {name: "at every limit", limits: limits, items: []OrderItem{item("a", 3, 100), item("b", 1, 700)}},
+        {name: "one item too many", limits: limits, items: []OrderItem{item("a", 1, 1), item("b", 1, 1), item("c", 1, 1)}, wantErr: true},
+        {name: "quantity over the limit", limits: limits, items: []OrderItem{item("a", 4, 1)}, wantErr: true},
+        {name: "total one unit over", limits: limits, items: []OrderItem{item("a", 1, 1001)}, wantErr: true},
+        {name: "zero limits are unlimited", limits: OrderLimits{}, items: []OrderItem{item("a", 1_000_000, 1_000_000), item("b", 1, 1), item("c", 1, 1)}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := tt.limits.Check(tt.items)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Check() = %v, wantErr %v", err, tt.wantErr)
+            }
+            if err != nil && !errors.Is(err, ErrOrderLimitExceeded) {
+                t.Errorf("Check() = %v, want ErrOrderLimitExceeded", err)
+            }
+        })
+    }
+}
+
+// The aggregate enforces its limits on every item change and leaves the
+// order unchanged when one is exceeded.
+func TestOrder_limits(t *testing.T) {
+    limits := OrderLimits{MaxItems: 2, MaxQuantity: 5}
+    price := valueobjects.NewMoney(100, "USD")
+    
+    tests := []struct {
+        name   string
+        change func(order *Order) error
+    }{
+        {name: "add an item over the item limit", change: func(order *Order) error {
+            if err := order.AddItem("product-2", 1, price); err != nil {
+                t.Fatalf("AddItem() at the limit = %v", err)
+            }
+            return order.AddItem("product-3", 1, price)
+        }},
+        {name: "add an item over the quantity limit", change: func(order *Order) error {
+            return order.AddItem("product-2", 6, price)
+        }},
+        {name: "raise a quantity over the limit", change: func(order *Order) error {
+            if err := order.ChangeItemQuantity("product-1", 5); err != nil {
+                t.Fatalf("ChangeItemQuantity() at the limit = %v", err)
+            }
+            return order.ChangeItemQuantity("product-1", 6)
+        }},
+        {name: "replace the items with too many", change: func(order *Order) error {
+            return order.ReplaceItems([]OrderItem{
+                {ProductID: "a", Quantity: 1, Price: price},
+                {ProductID: "b", Quantity: 1, Price: price},
+                {ProductID: "c", Quantity: 1, Price: price},
+            })
+        }},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            order := newTestOrder(t)
+            order.SetLimits(limits)
+            if err := tt.change(order); !errors.Is(err, ErrOrderLimitExceeded) {
+                t.Fatalf("change = %v, want ErrOrderLimitExceeded", err)
+            }
+            if err := limits.Check(order.Items); err != nil {
+                t.Errorf("order after the rejected change: %v", err)
+            }
+        })
+    }
+}
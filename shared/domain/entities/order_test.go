@@ -0,0 +1,425 @@
+package entities
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// newTestOrder returns a draft order with one item.
+func newTestOrder(t *testing.T) *Order {
+    t.Helper()
+    order, err := NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    if err := order.AddItem("product-1", 2, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    return order
+}
+
+// orderIn returns a test order moved to status through the aggregate.
+func orderIn(t *testing.T, status valueobjects.OrderStatus) *Order {
+    t.Helper()
+    order := newTestOrder(t)
+    steps := map[valueobjects.OrderStatus][]func() error{
+        valueobjects.OrderStatusDraft:     nil,
+        valueobjects.OrderStatusConfirmed: {order.Confirm},
+        valueobjects.OrderStatusOnHold:    {order.Confirm, func() error { return order.Hold("fraud review") }},
+        valueobjects.OrderStatusShipped:   {order.Confirm, order.Ship},
+        valueobjects.OrderStatusDelivered: {order.Confirm, order.Ship, func() error { return order.Deliver(time.Now(), "") }},
+        valueobjects.OrderStatusCancelled: {func() error { return order.Cancel(CancellationPolicy{}, false) }},
+    }
+    for _, step := range steps[status] {
+        if err := step(); err != nil {
+            t.Fatalf("moving order to %s: %v", status, err)
+        }
+    }
+    return order
+}
+
+func TestOrder_Cancel(t *testing.T) {
+    tests := []struct {
+        name         string
+        status       valueobjects.OrderStatus
+        wantErr      error
+        wantAnyErr   bool
+        wantPrevious valueobjects.OrderStatus
+    }{
+        {name: "draft", status: valueobjects.OrderStatusDraft, wantPrevious: valueobjects.OrderStatusDraft},
+        {name: "confirmed", status: valueobjects.OrderStatusConfirmed, wantPrevious: valueobjects.OrderStatusConfirmed},
+        {name: "on hold", status: valueobjects.OrderStatusOnHold, wantPrevious: valueobjects.OrderStatusOnHold},
+        {name: "shipped", status: valueobjects.OrderStatusShipped, wantAnyErr: true},
+        {name: "delivered", status: valueobjects.OrderStatusDelivered, wantAnyErr: true},
+        {name: "already cancelled", status: valueobjects.OrderStatusCancelled, wantErr: ErrOrderAlreadyCancelled},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            order := orderIn(t, tt.status)
+            before := *order
+            
+            err := order.Cancel(CancellationPolicy{}, false)
+            
+            switch {
+            case tt.wantErr != nil || tt.wantAnyErr:
+                if err == nil {
+                    t.Fatalf("Cancel() = nil, want an error")
+                }
+                if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+                    t.Fatalf("Cancel() = %v, want %v", err, tt.wantErr)
+                }
+                if order.Status != before.Status || order.PreviousStatus != before.PreviousStatus {
+                    t.Errorf("failed Cancel() changed the order to %s from %s", order.Status, order.PreviousStatus)
+                }
+            case err != nil:
+                t.Fatalf("Cancel() = %v", err)
+            default:
+                if order.Status != valueobjects.OrderStatusCancelled {
+                    t.Errorf("Status = %s, want cancelled", order.Status)
+                }
+                if order.PreviousStatus != tt.wantPrevious {
+                    t.Errorf("PreviousStatus = %s, want %s", order.PreviousStatus, tt.wantPrevious)
+                }
+            }
+        })
+    }
+}
+
+func TestOrder_Cancel_twiceKeepsDraftReopenable(t *testing.T) {
+    order := orderIn(t, valueobjects.OrderStatusCancelled)
+    
+    if err := order.Cancel(CancellationPolicy{}, false); !errors.Is(err, ErrOrderAlreadyCancelled) {
+        t.Fatalf("second Cancel() = %v, want ErrOrderAlreadyCancelled", err)
+    }
+    if err := order.Reopen(); err != nil {
+        t.Fatalf("Reopen() after a refused second cancel = %v", err)
+    }
+    if order.Status != valueobjects.OrderStatusDraft {
+        t.Errorf("Status = %s, want draft", order.Status)
+    }
+}
+
+func TestOrder_Cancel_window(t *testing.T) {
+    confirmedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name    string
+        elapsed time.Duration
+        force   bool
+        wantErr error
+    }{
+        {name: "inside the window", elapsed: 30 * time.Minute},
+        {name: "past the window", elapsed: 2 * time.Hour, wantErr: ErrCancellationWindowClosed},
+        {name: "past the window, forced", elapsed: 2 * time.Hour, force: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            order := orderIn(t, valueobjects.OrderStatusConfirmed)
+            order.ConfirmedAt = confirmedAt
+            policy := CancellationPolicy{Window: time.Hour, Now: func() time.Time { return confirmedAt.Add(tt.elapsed) }}
+            
+            err := order.Cancel(policy, tt.force)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("Cancel() = %v, want %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestOrder_timestampsFollowClock(t *testing.T) {
+    fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    defer clock.Set(fake)()
+    
+    order := newTestOrder(t)
+    created := fake.Now()
+    if !order.CreatedAt.Equal(created) || !order.UpdatedAt.Equal(created) {
+        t.Errorf("CreatedAt, UpdatedAt = %v, %v, want %v", order.CreatedAt, order.UpdatedAt, created)
+    }
+    
+    confirmed := fake.Advance(time.Minute)
+    if err := order.Confirm(); err != nil {
+        t.Fatalf("Confirm() = %v", err)
+    }
+    if !order.ConfirmedAt.Equal(confirmed) || !order.UpdatedAt.Equal(confirmed) {
+        t.Errorf("ConfirmedAt, UpdatedAt = %v, %v, want %v", order.ConfirmedAt, order.UpdatedAt, confirmed)
+    }
+    
+    shipped := fake.Advance(time.Hour)
+    if err := order.Ship(); err != nil {
+        t.Fatalf("Ship() = %v", err)
+    }
+    if !order.ShippedAt.Equal(shipped) {
+        t.Errorf("ShippedAt = %v, want %v", order.ShippedAt, shipped)
+    }
+    if !order.CreatedAt.Equal(created) {
+        t.Errorf("CreatedAt moved to %v", order.CreatedAt)
+    }
+}
+
+// A policy without Now reads the package clock.
+func TestOrder_Cancel_windowFollowsClock(t *testing.T) {
+    tests := []struct {
+        name    string
+        elapsed time.Duration
+        wantErr error
+    }{
+        {name: "at the end of the window", elapsed: time.Hour},
+        {name: "a second past the window", elapsed: time.Hour + time.Second, wantErr: ErrCancellationWindowClosed},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+            defer clock.Set(fake)()
+            order := orderIn(t, valueobjects.OrderStatusConfirmed)
+            
+            fake.Advance(tt.elapsed)
+            if err := order.Cancel(CancellationPolicy{Window: time.Hour}, false); !errors.Is(err, tt.wantErr) {
+                t.Fatalf("Cancel() = %v, want %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestOrder_Deliver(t *testing.T) {
+    shippedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    now := shippedAt.Add(24 * time.Hour)
+    tests := []struct {
+        name        string
+        deliveredAt time.Time
+        want        time.Time
+        wantErr     error
+    }{
+        {name: "now when not given", want: now},
+        {name: "earlier today", deliveredAt: now.Add(-time.Hour), want: now.Add(-time.Hour)},
+        {name: "at shipment", deliveredAt: shippedAt, want: shippedAt},
+        {name: "in the future", deliveredAt: now.Add(time.Second), wantErr: ErrDeliveryInFuture},
+        {name: "before shipment", deliveredAt: shippedAt.Add(-time.Second), wantErr: ErrDeliveryBeforeShipment},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            fake := clock.NewFake(shippedAt)
+            defer clock.Set(fake)()
+            order := orderIn(t, valueobjects.OrderStatusShipped)
+            fake.Set(now)
+            
+            err := order.Deliver(tt.deliveredAt, "  J. Doe ")
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("Deliver() = %v, want %v", err, tt.wantErr)
+            }
+            if tt.wantErr != nil {
+                if order.Status != valueobjects.OrderStatusShipped {
+                    t.Errorf("Status = %s after a refused delivery, want shipped", order.Status)
+                }
+                return
+            }
+            if !order.DeliveredAt.Equal(tt.want) {
+                t.Errorf("DeliveredAt = %v, want %v", order.DeliveredAt, tt.want)
+            }
+            if order.SignedBy != "J. Doe" {
+                t.Errorf("SignedBy = %q, want %q", order.SignedBy, "J. Doe")
+            }
+        })
+    }
+}
+
+// Orders shipped before shipments were timed take any past delivery time;
+// orders not shipped take none.
+func TestOrder_Deliver_unshipped(t *testing.T) {
+    legacy := orderIn(t, valueobjects.OrderStatusShipped)
+    legacy.ShippedAt = time.Time{}
+    longAgo := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+    if err := legacy.Deliver(longAgo, ""); err != nil || !legacy.DeliveredAt.Equal(longAgo) || legacy.SignedBy != "" {
+        t.Errorf("Deliver() of an untimed shipment = %v, delivered at %v by %q", err, legacy.DeliveredAt, legacy.SignedBy)
+    }
+    
+    confirmed := orderIn(t, valueobjects.OrderStatusConfirmed)
+    if err := confirmed.Deliver(time.Time{}, ""); err == nil || confirmed.Status != valueobjects.OrderStatusConfirmed || !confirmed.DeliveredAt.IsZero() {
+        t.Errorf("Deliver() of a confirmed order = %v, status %s, want refused", err, confirmed.Status)
+    }
+}
+
+// Totals are in the currency of the order's items, and an item in another
+// currency is refused.
+func TestOrder_currency(t *testing.T) {
+    tests := []struct {
+        name         string
+        items        []OrderItem
+        wantErr      error
+        wantCurrency string
+        wantTotal    int64
+    }{
+        {name: "no items", wantCurrency: valueobjects.DefaultCurrency},
+        {name: "USD", items: []OrderItem{{ProductID: "a", Quantity: 2, Price: valueobjects.NewMoney(1999, "USD")}}, wantCurrency: "USD", wantTotal: 3998},
+        {name: "JPY", items: []OrderItem{{ProductID: "a", Quantity: 3, Price: valueobjects.NewMoney(1500, "JPY")}, {ProductID: "b", Quantity: 1, Price: valueobjects.NewMoney(500, "JPY")}}, wantCurrency: "JPY", wantTotal: 5000},
+        {name: "KWD", items: []OrderItem{{ProductID: "a", Quantity: 1, Price: valueobjects.NewMoney(1500, "KWD")}}, wantCurrency: "KWD", wantTotal: 1500},
+        {name: "mixed", items: []OrderItem{{ProductID: "a", Quantity: 1, Price: valueobjects.NewMoney(1500, "JPY")}, {ProductID: "b", Quantity: 1, Price: valueobjects.NewMoney(500, "USD")}}, wantErr: ErrItemCurrencyMismatch},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            added, err := NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+            if err != nil {
+                t.Fatalf("NewOrder: %v", err)
+            }
+            replaced := *added
+            
+            for _, item := range tt.items {
+                err = added.AddItem(item.ProductID, item.Quantity, item.Price)
+            }
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("AddItem() = %v, want %v", err, tt.wantErr)
+            }
+            if err := replaced.ReplaceItems(tt.items); !errors.Is(err, tt.wantErr) {
+                t.Fatalf("ReplaceItems() = %v, want %v", err, tt.wantErr)
+            }
+            if tt.wantErr != nil {
+                return
+            }
+            
+            for name, order := range map[string]*Order{"AddItem": added, "ReplaceItems": &replaced} {
+                if err := order.ApplyShipping(NewDefaultShippingCalculator()); err != nil {
+                    t.Fatalf("ApplyShipping: %v", err)
+                }
+                if got := order.Currency(); got != tt.wantCurrency {
+                    t.Errorf("%s: Currency() = %s, want %s", name, got, tt.wantCurrency)
+                }
+                if len(tt.items) == 0 {
+                    continue
+                }
+                if order.TotalAmount != valueobjects.NewMoney(tt.wantTotal, tt.wantCurrency) {
+                    t.Errorf("%s: TotalAmount = %v, want %d %s", name, order.TotalAmount, tt.wantTotal, tt.wantCurrency)
+                }
+                if order.GrandTotal.Currency != tt.wantCurrency {
+                    t.Errorf("%s: GrandTotal in %s, want %s", name, order.GrandTotal.Currency, tt.wantCurrency)
+                }
+            }
+        })
+    }
+}
+
+// Removing every item keeps the currency the order had.
+func TestOrder_Currency_afterRemovingItems(t *testing.T) {
+    order, err := NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    if err := order.AddItem("product-1", 1, valueobjects.NewMoney(1500, "JPY")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    if err := order.RemoveItem("product-1"); err != nil {
+        t.Fatalf("RemoveItem: %v", err)
+    }
+    if got := order.Currency(); got != "JPY" {
+        t.Errorf("Currency() = %s, want JPY", got)
+    }
+}
+
+// An item's unit price is fixed once it is on the order: adding or
+// replacing it at another price is rejected, and the items stay as they
+// were.
+func TestOrder_itemPriceImmutable(t *testing.T) {
+    usd := func(amount int64) valueobjects.Money { return valueobjects.NewMoney(amount, "USD") }
+    tests := []struct {
+        name    string
+        change  func(order *Order) error
+        wantErr error
+    }{
+        {name: "add more at the same price", change: func(order *Order) error { return order.AddItem("product-1", 1, usd(1000)) }},
+        {name: "add another product", change: func(order *Order) error { return order.AddItem("product-2", 1, usd(500)) }},
+        {name: "add at another price", change: func(order *Order) error { return order.AddItem("product-1", 1, usd(1)) }, wantErr: ErrItemPriceImmutable},
+        {
+            name:   "replace at the same price",
+            change: func(order *Order) error { return order.ReplaceItems([]OrderItem{{ProductID: "product-1", Quantity: 5, Price: usd(1000)}}) },
+        },
+        {
+            name:   "replace with a new product",
+            change: func(order *Order) error { return order.ReplaceItems([]OrderItem{{ProductID: "product-2", Quantity: 1, Price: usd(500)}}) },
+        },
+        {
+            name:    "replace at another price",
+            change:  func(order *Order) error { return order.ReplaceItems([]OrderItem{{ProductID: "product-1", Quantity: 2, Price: usd(1)}}) },
+            wantErr: ErrItemPriceImmutable,
+        },
+        {
+            name: "replace with another price further down",
+            change: func(order *Order) error {
+                return order.ReplaceItems([]OrderItem{{ProductID: "product-2", Quantity: 1, Price: usd(500)}, {ProductID: "product-1", Quantity: 2, Price: usd(2000)}})
+            },
+            wantErr: ErrItemPriceImmutable,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            order := newTestOrder(t)
+            before := append([]OrderItem(nil), order.Items...)
+            
+            err := tt.change(order)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("change = %v, want %v", err, tt.wantErr)
+            }
+            if tt.wantErr == nil {
+                return
+            }
+            if len(order.Items) != len(before) || order.Items[0] != before[0] || order.TotalAmount != usd(2000) {
+                t.Errorf("rejected change left items %+v, total %v, want %+v, 20.00 USD", order.Items, order.TotalAmount, before)
+            }
+        })
+    }
+}
+
+// Only a confirmed order can be held, and only with a reason; held, it
+// cannot be shipped but can be cancelled past the window, and released it
+// is confirmed again.
+func TestOrder_HoldAndRelease(t *testing.T) {
+    for _, status := range []valueobjects.OrderStatus{valueobjects.OrderStatusDraft, valueobjects.OrderStatusOnHold, valueobjects.OrderStatusShipped, valueobjects.OrderStatusCancelled} {
+        if err := orderIn(t, status).Hold("fraud review"); err == nil {
+            t.Errorf("Hold() of a %s order = nil, want an error", status)
+        }
+    }
+    for _, status := range []valueobjects.OrderStatus{valueobjects.OrderStatusDraft, valueobjects.OrderStatusConfirmed, valueobjects.OrderStatusShipped} {
+        if err := orderIn(t, status).Release(); err == nil {
+            t.Errorf("Release() of a %s order = nil, want an error", status)
+        }
+    }
+    if err := orderIn(t, valueobjects.OrderStatusConfirmed).Hold("  "); !errors.Is(err, ErrHoldReasonRequired) {
+        t.Errorf("Hold() without a reason = %v, want ErrHoldReasonRequired", err)
+    }
+    
+    order := orderIn(t, valueobjects.OrderStatusConfirmed)
+    if err := order.Hold(" fraud review "); err != nil {
+        t.Fatalf("Hold() = %v", err)
+    }
+    if order.Status != valueobjects.OrderStatusOnHold || order.HoldReason != "fraud review" {
+        t.Errorf("held order is %s for %q, want on_hold for fraud review", order.Status, order.HoldReason)
+    }
+    if err := order.Ship(); !errors.Is(err, ErrOrderOnHold) {
+        t.Errorf("Ship() on hold = %v, want ErrOrderOnHold", err)
+    }
+    if err := order.Release(); err != nil {
+        t.Fatalf("Release() = %v", err)
+    }
+    if order.Status != valueobjects.OrderStatusConfirmed || order.HoldReason != "" {
+        t.Errorf("released order is %s for %q, want confirmed with no reason", order.Status, order.HoldReason)
+    }
+    if err := order.Ship(); err != nil {
+        t.Errorf("Ship() after the release = %v", err)
+    }
+    
+    held := orderIn(t, valueobjects.OrderStatusOnHold)
+    confirmedAt := held.ConfirmedAt
+    policy := CancellationPolicy{Window: time.Hour, Now: func() time.Time { return confirmedAt.Add(2 * time.Hour) }}
+    if err := held.Cancel(policy, false); err != nil {
+        t.Errorf("Cancel() on hold past the window = %v", err)
+    }
+    if held.HoldReason != "" {
+        t.Errorf("cancelled order held for %q, want no reason", held.HoldReason)
+    }
+}
@@ -0,0 +1,58 @@
+package entities
+
+import (
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// ShippingCalculator prices the delivery of an order's items to an address.
+type ShippingCalculator interface {
+    Calculate(items []OrderItem, address valueobjects.Address) (valueobjects.Money, error)
+}
+
+// ShippingRate is the flat fee charged for a destination. Orders whose items
+// subtotal reaches FreeShippingThreshold ship for free; a zero threshold
+// means shipping is never free.
+type ShippingRate struct {
+    Fee                   valueobjects.Money
+    FreeShippingThreshold int64
+}
+
+// TableShippingCalculator looks the destination country up in Rates, keyed
+// by upper-case country code, and uses Fallback for unknown countries.
+type TableShippingCalculator struct {
+    Rates    map[string]ShippingRate
+    Fallback ShippingRate
+}
+
+// NewDefaultShippingCalculator returns the rate table used when no other
+// calculator is configured. Amounts are in cents.
+func NewDefaultShippingCalculator() *TableShippingCalculator {
+    return &TableShippingCalculator{
+        Rates: map[string]ShippingRate{
+            "US": {Fee: valueobjects.NewMoney(599, "USD"), FreeShippingThreshold: 5000},
+            "CA": {Fee: valueobjects.NewMoney(999, "USD"), FreeShippingThreshold: 10000},
+            "GB": {Fee: valueobjects.NewMoney(1499, "USD"), FreeShippingThreshold: 15000},
+        },
+        Fallback: ShippingRate{Fee: valueobjects.NewMoney(2499, "USD")},
+    }
+}
+
+func (c *TableShippingCalculator) Calculate(items []OrderItem, address valueobjects.Address) (valueobjects.Money, error) {
+    rate, ok := c.Rates[strings.ToUpper(strings.TrimSpace(address.Country))]
+    if !ok {
+        rate = c.Fallback
+    }
+    
+    subtotal := int64(0)
+    for _, item := range items {
+        subtotal += item.Price.Amount * int64(item.Quantity)
+    }
+    
+    if len(items) == 0 || (rate.FreeShippingThreshold > 0 && subtotal >= rate.FreeShippingThreshold) {
+        return valueobjects.NewMoney(0, rate.Fee.Currency), nil
+    }
+    
+    return rate.Fee, nil
+}
@@ -0,0 +1,39 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// ErrRestrictedCountry is wrapped by the errors returned for orders shipping
+// to a country they may not ship to.
+var ErrRestrictedCountry = errors.New("shipping country is restricted")
+
+// ShippingRestrictions lists the countries orders may not ship to.
+type ShippingRestrictions interface {
+    // IsRestricted reports whether orders may not ship to country, given
+    // in the normalized form NormalizeCountry returns
+    IsRestricted(country string) bool
+}
+
+// NormalizeCountry returns country as restrictions compare it: trimmed and
+// upper case.
+func NormalizeCountry(country string) string {
+    return strings.ToUpper(strings.TrimSpace(country))
+}
+
+// CheckShippingCountry reports whether restrictions forbid shipping to
+// address. The error names the country only, never the rest of the
+// address. Nil restrictions allow every country.
+func CheckShippingCountry(restrictions ShippingRestrictions, address valueobjects.Address) error {
+    if restrictions == nil {
+        return nil
+    }
+    if country := NormalizeCountry(address.Country); restrictions.IsRestricted(country) {
+        return fmt.Errorf("%w: orders cannot ship to %s", ErrRestrictedCountry, country)
+    }
+    return nil
+}
@@ -0,0 +1,70 @@
+package entities
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// countrySet restricts the countries it holds.
+type countrySet map[string]bool
+
+func (s countrySet) IsRestricted(country string) bool { return s[country] }
+
+// Countries are compared trimmed and in upper case, and the error names the
+// country but nothing else of the address.
+func TestCheckShippingCountry(t *testing.T) {
+    restricted := countrySet{"KP": true}
+    tests := []struct {
+        name         string
+        restrictions ShippingRestrictions
+        country      string
+        wantErr      bool
+    }{
+        {name: "allowed", restrictions: restricted, country: "US"},
+        {name: "restricted", restrictions: restricted, country: "KP", wantErr: true},
+        {name: "lower case", restrictions: restricted, country: " kp ", wantErr: true},
+        {name: "no restrictions", restrictions: nil, country: "KP"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            address := valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", tt.country)
+            err := CheckShippingCountry(tt.restrictions, address)
+            if errors.Is(err, ErrRestrictedCountry) != tt.wantErr {
+                t.Fatalf("CheckShippingCountry(%q) = %v, want restricted %t", tt.country, err, tt.wantErr)
+            }
+            if err == nil {
+                return
+            }
+            if msg := err.Error(); !strings.Contains(msg, "KP") || strings.Contains(msg, "Main St") || strings.Contains(msg, "Springfield") || strings.Contains(msg, "62701") {
+                t.Errorf("error %q should name the country only", msg)
+            }
+        })
+    }
+}
+
+// An order's address cannot be changed to a restricted country, so an
+// address change does not bypass the check at creation.
+func TestOrder_ChangeShippingAddress_restricted(t *testing.T) {
+    order, err := NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    order.SetShippingRestrictions(countrySet{"KP": true})
+    original := order.ShippingAddress
+    
+    if err := order.ChangeShippingAddress(valueobjects.NewAddress("1 Main St", "Pyongyang", "Pyongyang", "00000", "kp")); !errors.Is(err, ErrRestrictedCountry) {
+        t.Fatalf("ChangeShippingAddress() to a restricted country = %v, want ErrRestrictedCountry", err)
+    }
+    if order.ShippingAddress != original {
+        t.Errorf("refused change moved the order to %+v", order.ShippingAddress)
+    }
+    
+    allowed := valueobjects.NewAddress("2 Oak Ave", "Portland", "OR", "97201", "US")
+    if err := order.ChangeShippingAddress(allowed); err != nil || order.ShippingAddress != allowed {
+        t.Errorf("ChangeShippingAddress() to an allowed country = %v, address %+v", err, order.ShippingAddress)
+    }
+}
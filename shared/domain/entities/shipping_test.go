@@ -0,0 +1,67 @@
+package entities
+
+import (
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+func TestTableShippingCalculator_Calculate(t *testing.T) {
+    calc := NewDefaultShippingCalculator()
+    items := func(subtotal int64) []OrderItem {
+        return []OrderItem{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(subtotal, "USD")}}
+    }
+    tests := []struct {
+        name    string
+        items   []OrderItem
+        country string
+        want    int64
+    }{
+        {name: "US below the threshold", items: items(4999), country: "US", want: 599},
+        {name: "US at the threshold", items: items(5000), country: "US", want: 0},
+        {name: "US above the threshold", items: items(5001), country: "US", want: 0},
+        {name: "threshold counts quantities", items: []OrderItem{{ProductID: "product-1", Quantity: 5, Price: valueobjects.NewMoney(1000, "USD")}}, country: "US", want: 0},
+        {name: "CA below the threshold", items: items(9999), country: "CA", want: 999},
+        {name: "CA at the threshold", items: items(10000), country: "CA", want: 0},
+        {name: "country code case and spaces", items: items(100), country: " gb ", want: 1499},
+        {name: "unknown country", items: items(100), country: "FR", want: 2499},
+        {name: "unknown country never ships free", items: items(1000000), country: "FR", want: 2499},
+        {name: "no country", items: items(100), country: "", want: 2499},
+        {name: "no items", country: "FR", want: 0},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            address := valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", tt.country)
+            got, err := calc.Calculate(tt.items, address)
+            if err != nil {
+                t.Fatalf("Calculate() = %v", err)
+            }
+            if want := valueobjects.NewMoney(tt.want, "USD"); got != want {
+                t.Errorf("Calculate() = %v, want %v", got, want)
+            }
+        })
+    }
+}
+
+func TestOrder_ApplyShipping(t *testing.T) {
+    order := newTestOrder(t)
+    if err := order.ApplyShipping(NewDefaultShippingCalculator()); err != nil {
+        t.Fatalf("ApplyShipping: %v", err)
+    }
+    if order.ShippingCost != valueobjects.NewMoney(599, "USD") || order.GrandTotal != valueobjects.NewMoney(2599, "USD") {
+        t.Errorf("shipping %v, grand total %v, want 5.99 USD, 25.99 USD", order.ShippingCost, order.GrandTotal)
+    }
+    
+    // Shipping is repriced when applied again, here once the items reach
+    // the free shipping threshold
+    if err := order.AddItem("product-2", 3, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    if err := order.ApplyShipping(NewDefaultShippingCalculator()); err != nil {
+        t.Fatalf("ApplyShipping: %v", err)
+    }
+    if order.ShippingCost.Amount != 0 || order.GrandTotal != valueobjects.NewMoney(5000, "USD") {
+        t.Errorf("shipping %v, grand total %v, want free shipping, 50.00 USD", order.ShippingCost, order.GrandTotal)
+    }
+}
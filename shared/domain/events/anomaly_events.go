@@ -0,0 +1,44 @@
+package events
+
+import (
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+)
+
+// CancellationRateAggregateID is the aggregate of the cancellation anomaly
+// events, so they are delivered in the order they were detected.
+const CancellationRateAggregateID = "cancellation_rate"
+
+// OrderCancellationAnomalyDetectedEvent is derived by the reporting service
+// when the share of orders cancelled over a window rises above its
+// baseline. Rate and Baseline are fractions of the orders confirmed or
+// cancelled in the window.
+type OrderCancellationAnomalyDetectedEvent struct {
+    BaseDomainEvent
+    AnomalyID     int64     `json:"anomaly_id"`
+    WindowStart   time.Time `json:"window_start"`
+    WindowEnd     time.Time `json:"window_end"`
+    Cancellations int64     `json:"cancellations"`
+    Decisions     int64     `json:"decisions"`
+    Rate          float64   `json:"rate"`
+    Baseline      float64   `json:"baseline"`
+}
+
+func NewOrderCancellationAnomalyDetectedEvent(anomalyID int64, windowStart, windowEnd time.Time, cancellations, decisions int64, rate, baseline float64) OrderCancellationAnomalyDetectedEvent {
+    return OrderCancellationAnomalyDetectedEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "OrderCancellationAnomalyDetected",
+            AggregateIDValue: CancellationRateAggregateID,
+            OccurredAtTime:   clock.Now(),
+        },
+        AnomalyID:     anomalyID,
+        WindowStart:   windowStart,
+        WindowEnd:     windowEnd,
+        Cancellations: cancellations,
+        Decisions:     decisions,
+        Rate:          rate,
+        Baseline:      baseline,
+    }
+}
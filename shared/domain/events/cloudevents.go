@@ -0,0 +1,86 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CloudEvents envelope constants, for events published in the CloudEvents
+// 1.0 structured JSON format.
+const (
+    CloudEventsSpecVersion = "1.0"
+    // CloudEventsContentType is the content type of a structured mode
+    // message
+    CloudEventsContentType = "application/cloudevents+json"
+    // CloudEventsTypePrefix is prepended to the event type to form the
+    // CloudEvents type, such as com.dddcqrs.order.OrderCreated
+    CloudEventsTypePrefix = "com.dddcqrs.order."
+)
+
+// CloudEvent is the structured JSON envelope of an event. Data holds the
+// event as it is serialized without an envelope.
+type CloudEvent struct {
+    SpecVersion     string          `json:"specversion"`
+    ID              string          `json:"id"`
+    Type            string          `json:"type"`
+    Source          string          `json:"source"`
+    Subject         string          `json:"subject,omitempty"`
+    Time            time.Time       `json:"time"`
+    DataContentType string          `json:"datacontenttype"`
+    Data            json.RawMessage `json:"data"`
+}
+
+// WrapCloudEvent serializes event inside a CloudEvents envelope from
+// source, a URI reference naming the publishing service.
+func WrapCloudEvent(event DomainEvent, source string) ([]byte, error) {
+    data, err := json.Marshal(event)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal event: %w", err)
+    }
+    
+    // The spec requires an id; events from before ids existed get one
+    id := event.EventID()
+    if id == "" {
+        id = newEventID()
+    }
+    
+    return json.Marshal(CloudEvent{
+        SpecVersion:     CloudEventsSpecVersion,
+        ID:              id,
+        Type:            CloudEventsTypePrefix + event.Type(),
+        Source:          source,
+        Subject:         event.AggregateID(),
+        Time:            event.OccurredAt().UTC(),
+        DataContentType: "application/json",
+        Data:            data,
+    })
+}
+
+// cloudEventMarker is present in every CloudEvents envelope and in no
+// event serialized without one.
+var cloudEventMarker = []byte(`"specversion"`)
+
+// UnwrapCloudEvent returns the event type and payload of a CloudEvents
+// envelope. ok is false when data, which must not be compressed, is a plain
+// event payload.
+func UnwrapCloudEvent(data []byte) (eventType string, payload []byte, ok bool, err error) {
+    if !bytes.Contains(data, cloudEventMarker) {
+        return "", nil, false, nil
+    }
+    
+    var envelope CloudEvent
+    if err := json.Unmarshal(data, &envelope); err != nil || envelope.SpecVersion == "" {
+        // Not an envelope after all, such as a payload quoting the marker
+        return "", nil, false, nil
+    }
+    if !strings.HasPrefix(envelope.SpecVersion, "1.") {
+        return "", nil, true, fmt.Errorf("%w: unsupported CloudEvents specversion %q", ErrInvalidEvent, envelope.SpecVersion)
+    }
+    if len(envelope.Data) == 0 {
+        return "", nil, true, fmt.Errorf("%w: CloudEvent %s has no data", ErrInvalidEvent, envelope.ID)
+    }
+    return strings.TrimPrefix(envelope.Type, CloudEventsTypePrefix), envelope.Data, true, nil
+}
@@ -0,0 +1,150 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+func newCreatedEvent(t *testing.T) OrderCreatedEvent {
+    t.Helper()
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    return NewOrderCreatedEvent(order)
+}
+
+// An envelope carries the attributes CloudEvents 1.0 requires, id, source,
+// specversion and type, and the optional ones it maps, with the event as
+// its JSON data.
+func TestWrapCloudEvent_conformance(t *testing.T) {
+    event := newCreatedEvent(t)
+    data, err := WrapCloudEvent(event, "/dddcqrs/order-management")
+    if err != nil {
+        t.Fatalf("WrapCloudEvent() = %v", err)
+    }
+    
+    var envelope map[string]json.RawMessage
+    if err := json.Unmarshal(data, &envelope); err != nil {
+        t.Fatalf("envelope is not a JSON object: %v", err)
+    }
+    attribute := func(name string) string {
+        var value string
+        json.Unmarshal(envelope[name], &value)
+        return value
+    }
+    want := map[string]string{
+        "specversion":     "1.0",
+        "id":              event.EventID(),
+        "type":            "com.dddcqrs.order.OrderCreated",
+        "source":          "/dddcqrs/order-management",
+        "subject":         event.AggregateID(),
+        "time":            event.OccurredAt().UTC().Format(time.RFC3339Nano),
+        "datacontenttype": "application/json",
+    }
+    for name, value := range want {
+        if got := attribute(name); got != value {
+            t.Errorf("%s = %q, want %q", name, got, value)
+        }
+    }
+    if _, err := time.Parse(time.RFC3339, attribute("time")); err != nil {
+        t.Errorf("time %q is not an RFC 3339 timestamp: %v", attribute("time"), err)
+    }
+    
+    plain, err := json.Marshal(event)
+    if err != nil {
+        t.Fatalf("json.Marshal: %v", err)
+    }
+    if string(envelope["data"]) != string(plain) {
+        t.Errorf("data = %s, want the plain payload %s", envelope["data"], plain)
+    }
+    if len(envelope) != len(want)+1 {
+        t.Errorf("envelope has attributes %v, want only those mapped", reflect.ValueOf(envelope).MapKeys())
+    }
+}
+
+// Consumers decode plain payloads, envelopes and compressed envelopes to
+// the same event, so publishers can switch formats in a rolling upgrade.
+func TestRegistry_Unmarshal_mixedFormats(t *testing.T) {
+    event := newCreatedEvent(t)
+    plain, err := json.Marshal(event)
+    if err != nil {
+        t.Fatalf("json.Marshal: %v", err)
+    }
+    envelope, err := WrapCloudEvent(event, "/dddcqrs/order-management")
+    if err != nil {
+        t.Fatalf("WrapCloudEvent() = %v", err)
+    }
+    compressed, err := Compress(envelope)
+    if err != nil {
+        t.Fatalf("Compress() = %v", err)
+    }
+    
+    tests := []struct {
+        name      string
+        eventType string
+        data      []byte
+    }{
+        {name: "plain", eventType: "OrderCreated", data: plain},
+        {name: "envelope", eventType: "OrderCreated", data: envelope},
+        {name: "envelope without a type header", data: envelope},
+        {name: "compressed envelope", data: compressed},
+    }
+    
+    want, err := DefaultRegistry().Unmarshal("OrderCreated", plain)
+    if err != nil {
+        t.Fatalf("Unmarshal() = %v", err)
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := DefaultRegistry().Unmarshal(tt.eventType, tt.data)
+            if err != nil {
+                t.Fatalf("Unmarshal() = %v", err)
+            }
+            if !reflect.DeepEqual(got, want) {
+                t.Errorf("Unmarshal() = %+v, want %+v", got, want)
+            }
+        })
+    }
+}
+
+func TestUnwrapCloudEvent(t *testing.T) {
+    tests := []struct {
+        name        string
+        data        string
+        wantOK      bool
+        wantType    string
+        wantPayload string
+        wantErr     error
+    }{
+        {name: "plain payload", data: `{"event_type": "OrderCreated", "aggregate_id": "order-1"}`},
+        {name: "payload quoting the marker", data: `{"event_type": "OrderNoteAdded", "note": "\"specversion\""}`},
+        {
+            name:        "envelope",
+            data:        `{"specversion": "1.0", "id": "e-1", "type": "com.dddcqrs.order.OrderShipped", "source": "/s", "data": {"aggregate_id": "order-1"}}`,
+            wantOK:      true,
+            wantType:    "OrderShipped",
+            wantPayload: `{"aggregate_id": "order-1"}`,
+        },
+        {name: "unsupported version", data: `{"specversion": "2.0", "id": "e-1", "type": "x", "data": {}}`, wantOK: true, wantErr: ErrInvalidEvent},
+        {name: "no data", data: `{"specversion": "1.0", "id": "e-1", "type": "x"}`, wantOK: true, wantErr: ErrInvalidEvent},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            eventType, payload, ok, err := UnwrapCloudEvent([]byte(tt.data))
+            if ok != tt.wantOK || !errors.Is(err, tt.wantErr) {
+                t.Fatalf("UnwrapCloudEvent() = ok %t, %v, want ok %t, %v", ok, err, tt.wantOK, tt.wantErr)
+            }
+            if eventType != tt.wantType || string(payload) != tt.wantPayload {
+                t.Errorf("UnwrapCloudEvent() = %q, %s, want %q, %s", eventType, payload, tt.wantType, tt.wantPayload)
+            }
+        })
+    }
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// ErrInvalidEvent is wrapped by errors for events that decoded but lack the
+// envelope fields every event needs.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// legacyBaseFields lists the envelope field names used by older payloads,
+// from before BaseDomainEvent had JSON tags.
+type legacyBaseFields struct {
+    EventType        string    `json:"EventType"`
+    AggregateID      string    `json:"AggregateID"`
+    AggregateIDValue string    `json:"AggregateIDValue"`
+    OccurredAt       time.Time `json:"OccurredAt"`
+    OccurredAtTime   time.Time `json:"OccurredAtTime"`
+}
+
+// fillLegacyFields populates envelope fields left empty by the current JSON
+// tags from their historical names. BaseDomainEvent deliberately has no
+// UnmarshalJSON: it would be promoted to every embedding event and swallow
+// their own fields.
+func (e *BaseDomainEvent) fillLegacyFields(data []byte, eventType string) error {
+    if e.EventType != "" && e.AggregateIDValue != "" && !e.OccurredAtTime.IsZero() {
+        return nil
+    }
+    
+    var legacy legacyBaseFields
+    if err := json.Unmarshal(data, &legacy); err != nil {
+        return err
+    }
+    
+    if e.EventType == "" {
+        e.EventType = firstNonEmpty(legacy.EventType, eventType)
+    }
+    if e.AggregateIDValue == "" {
+        e.AggregateIDValue = firstNonEmpty(legacy.AggregateID, legacy.AggregateIDValue)
+    }
+    if e.OccurredAtTime.IsZero() {
+        e.OccurredAtTime = legacy.OccurredAt
+        if e.OccurredAtTime.IsZero() {
+            e.OccurredAtTime = legacy.OccurredAtTime
+        }
+    }
+    
+    return nil
+}
+
+// fillLegacyFields also maps the free-text reason of cancellations from
+// before reasons were enumerated to CancellationReasonOther, keeping the
+// text as the details.
+func (e *OrderCancelledEvent) fillLegacyFields(data []byte, eventType string) error {
+    if err := e.BaseDomainEvent.fillLegacyFields(data, eventType); err != nil {
+        return err
+    }
+    if !e.Reason.IsValid() && e.Details == "" {
+        e.Reason, e.Details = valueobjects.CancellationReasonOther, string(e.Reason)
+    }
+    return nil
+}
+
+// Validate reports whether event carries a type, an aggregate id and a
+// timestamp. Errors wrap ErrInvalidEvent.
+func Validate(event DomainEvent) error {
+    switch {
+    case event.Type() == "":
+        return fmt.Errorf("%w: missing event type", ErrInvalidEvent)
+    case event.AggregateID() == "":
+        return fmt.Errorf("%w: %s has no aggregate id", ErrInvalidEvent, event.Type())
+    case event.OccurredAt().IsZero():
+        return fmt.Errorf("%w: %s for aggregate %s has no occurred_at", ErrInvalidEvent, event.Type(), event.AggregateID())
+    }
+    return nil
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Fixtures in testdata/legacy are payloads as stored before the envelope
+// fields had JSON tags and before cancellation reasons were enumerated.
+func TestRegistry_Unmarshal_legacyPayloads(t *testing.T) {
+    tests := []struct {
+        fixture         string
+        eventType       string
+        wantAggregateID string
+        wantOccurredAt  string
+        wantErr         error
+        check           func(t *testing.T, event DomainEvent)
+    }{
+        {
+            fixture:         "order_confirmed_field_names.json",
+            eventType:       "OrderConfirmed",
+            wantAggregateID: "order-1",
+            wantOccurredAt:  "2023-05-01T10:00:00Z",
+            check: func(t *testing.T, event DomainEvent) {
+                confirmed := event.(OrderConfirmedEvent)
+                if confirmed.CustomerID != "customer-1" || confirmed.TotalAmount != valueobjects.NewMoney(2000, "USD") {
+                    t.Errorf("payload = %+v, want customer-1 and 20.00 USD", confirmed)
+                }
+                if confirmed.HasItems() || !confirmed.ConfirmedAt.IsZero() {
+                    t.Errorf("items, confirmed at = %v, %v, want none", confirmed.Items, confirmed.ConfirmedAt)
+                }
+            },
+        },
+        {
+            fixture:         "order_confirmed_without_items.json",
+            eventType:       "OrderConfirmed",
+            wantAggregateID: "order-1",
+            wantOccurredAt:  "2024-01-10T09:00:00Z",
+            check: func(t *testing.T, event DomainEvent) {
+                confirmed := event.(OrderConfirmedEvent)
+                if confirmed.HasItems() || confirmed.Items != nil {
+                    t.Errorf("items = %v, want none", confirmed.Items)
+                }
+                if confirmed.TotalAmount != valueobjects.NewMoney(2000, "USD") {
+                    t.Errorf("total = %v, want 20.00 USD", confirmed.TotalAmount)
+                }
+            },
+        },
+        {
+            fixture:         "order_shipped_short_names.json",
+            eventType:       "OrderShipped",
+            wantAggregateID: "order-1",
+            wantOccurredAt:  "2023-05-02T08:30:00Z",
+        },
+        {
+            fixture:         "order_shipped_no_type.json",
+            eventType:       "OrderShipped",
+            wantAggregateID: "order-1",
+            wantOccurredAt:  "2023-05-02T08:30:00Z",
+        },
+        {
+            fixture:         "order_cancelled_free_text.json",
+            eventType:       "OrderCancelled",
+            wantAggregateID: "order-1",
+            wantOccurredAt:  "2023-05-03T12:00:00Z",
+            check: func(t *testing.T, event DomainEvent) {
+                cancelled := event.(OrderCancelledEvent)
+                if cancelled.Reason != valueobjects.CancellationReasonOther || cancelled.Details != "customer changed their mind" {
+                    t.Errorf("reason, details = %q, %q, want other with the free text", cancelled.Reason, cancelled.Details)
+                }
+            },
+        },
+        {
+            fixture:         "order_cancelled_enumerated.json",
+            eventType:       "OrderCancelled",
+            wantAggregateID: "order-1",
+            wantOccurredAt:  "2024-01-10T09:00:00Z",
+            check: func(t *testing.T, event DomainEvent) {
+                cancelled := event.(OrderCancelledEvent)
+                if cancelled.Reason != valueobjects.CancellationReasonFraud || cancelled.Details != "chargeback" {
+                    t.Errorf("reason, details = %q, %q, want fraud, chargeback", cancelled.Reason, cancelled.Details)
+                }
+            },
+        },
+        {fixture: "order_confirmed_no_aggregate.json", eventType: "OrderConfirmed", wantErr: ErrInvalidEvent},
+        {fixture: "order_confirmed_no_time.json", eventType: "OrderConfirmed", wantErr: ErrInvalidEvent},
+        {fixture: "order_confirmed_field_names.json", eventType: "OrderArchived", wantErr: ErrUnknownEventType},
+    }
+    
+    registry := DefaultRegistry()
+    for _, tt := range tests {
+        t.Run(tt.fixture+" as "+tt.eventType, func(t *testing.T) {
+            data, err := os.ReadFile(filepath.Join("testdata", "legacy", tt.fixture))
+            if err != nil {
+                t.Fatal(err)
+            }
+            
+            event, err := registry.Unmarshal(tt.eventType, data)
+            if tt.wantErr != nil {
+                if !errors.Is(err, tt.wantErr) {
+                    t.Fatalf("Unmarshal() = %v, want %v", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Unmarshal() = %v", err)
+            }
+            
+            wantOccurredAt, _ := time.Parse(time.RFC3339, tt.wantOccurredAt)
+            if event.Type() != tt.eventType || event.AggregateID() != tt.wantAggregateID || !event.OccurredAt().Equal(wantOccurredAt) {
+                t.Errorf("envelope = %s %s %s, want %s %s %s", event.Type(), event.AggregateID(), event.OccurredAt(), tt.eventType, tt.wantAggregateID, wantOccurredAt)
+            }
+            if tt.check != nil {
+                tt.check(t, event)
+            }
+        })
+    }
+}
+
+func TestValidate(t *testing.T) {
+    occurredAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name    string
+        base    BaseDomainEvent
+        wantErr bool
+    }{
+        {name: "complete", base: BaseDomainEvent{EventType: "OrderShipped", AggregateIDValue: "order-1", OccurredAtTime: occurredAt}},
+        {name: "no type", base: BaseDomainEvent{AggregateIDValue: "order-1", OccurredAtTime: occurredAt}, wantErr: true},
+        {name: "no aggregate", base: BaseDomainEvent{EventType: "OrderShipped", OccurredAtTime: occurredAt}, wantErr: true},
+        {name: "no time", base: BaseDomainEvent{EventType: "OrderShipped", AggregateIDValue: "order-1"}, wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := Validate(OrderShippedEvent{BaseDomainEvent: tt.base})
+            if tt.wantErr != errors.Is(err, ErrInvalidEvent) || (!tt.wantErr && err != nil) {
+                t.Errorf("Validate() = %v, want error %t", err, tt.wantErr)
+            }
+        })
+    }
+}
@@ -0,0 +1,47 @@
+package events
+
+import "github.com/vdntruong/dddcqrs/shared/domain/clock"
+
+// CustomerFirstOrderEvent is derived by the reporting service when a
+// customer's first order is projected.
+type CustomerFirstOrderEvent struct {
+    BaseDomainEvent
+    OrderID string `json:"order_id"`
+}
+
+func NewCustomerFirstOrderEvent(customerID, orderID string) CustomerFirstOrderEvent {
+    return CustomerFirstOrderEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "CustomerFirstOrder",
+            AggregateIDValue: customerID,
+            OccurredAtTime:   clock.Now(),
+        },
+        OrderID: orderID,
+    }
+}
+
+// CustomerMergedEvent records that a duplicate customer, the aggregate,
+// was merged into TargetCustomerID: each of their orders was reassigned to
+// the target with an OrderCustomerReassignedEvent before it, and they take
+// no new orders. A merge run again, as to finish one that failed part way,
+// is recorded again.
+type CustomerMergedEvent struct {
+    BaseDomainEvent
+    TargetCustomerID string `json:"target_customer_id"`
+    // OrdersMoved counts the orders this run of the merge reassigned
+    OrdersMoved      int    `json:"orders_moved"`
+}
+
+func NewCustomerMergedEvent(sourceCustomerID, targetCustomerID string, ordersMoved int) CustomerMergedEvent {
+    return CustomerMergedEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "CustomerMerged",
+            AggregateIDValue: sourceCustomerID,
+            OccurredAtTime:   clock.Now(),
+        },
+        TargetCustomerID: targetCustomerID,
+        OrdersMoved:      ordersMoved,
+    }
+}
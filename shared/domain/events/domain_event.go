@@ -1,17 +1,38 @@
 package events
 
-import "time"
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type DomainEvent interface {
+    EventID() string
     Type() string
     AggregateID() string
     OccurredAt() time.Time
+    // Sequence is the event's position in its aggregate's history, from 1,
+    // assigned when the event store appends it. It orders events; two
+    // events may share an OccurredAt. Events not from the event store have
+    // a zero sequence.
+    Sequence() int
 }
 
 type BaseDomainEvent struct {
+    EventIDValue     string    `json:"event_id,omitempty"`
     EventType       string    `json:"event_type"`
     AggregateIDValue string    `json:"aggregate_id"`
     OccurredAtTime   time.Time `json:"occurred_at"`
+    SequenceValue    int       `json:"sequence,omitempty"`
+}
+
+// EventID identifies one occurrence of an event. It is carried through the
+// outbox and onto the bus so duplicates can be recognised downstream; events
+// stored before it existed have an empty id.
+func (e BaseDomainEvent) EventID() string {
+    return e.EventIDValue
 }
 
 func (e BaseDomainEvent) Type() string {
@@ -25,3 +46,24 @@ func (e BaseDomainEvent) AggregateID() string {
 func (e BaseDomainEvent) OccurredAt() time.Time {
     return e.OccurredAtTime
 }
+
+func (e BaseDomainEvent) Sequence() int {
+    return e.SequenceValue
+}
+
+// WithSequence returns a copy of event with its sequence set. event must
+// embed BaseDomainEvent, as every event type does.
+func WithSequence(event DomainEvent, sequence int) DomainEvent {
+    copied := reflect.New(reflect.TypeOf(event)).Elem()
+    copied.Set(reflect.ValueOf(event))
+    base := copied.FieldByName("BaseDomainEvent")
+    if !base.IsValid() {
+        panic(fmt.Sprintf("events: %T does not embed BaseDomainEvent", event))
+    }
+    base.FieldByName("SequenceValue").SetInt(int64(sequence))
+    return copied.Interface().(DomainEvent)
+}
+
+func newEventID() string {
+    return uuid.New().String()
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// ContentEncodingGzip marks a gzip-compressed event payload, in outbox rows
+// and in the content-encoding header of bus messages.
+const ContentEncodingGzip = "gzip"
+
+// gzipMagic starts every gzip stream. JSON never starts with it, so
+// compressed and plain payloads can be told apart without a header.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Compress gzips a serialized event.
+func Compress(data []byte) ([]byte, error) {
+    var buf bytes.Buffer
+    writer := gzip.NewWriter(&buf)
+    if _, err := writer.Write(data); err != nil {
+        return nil, fmt.Errorf("failed to compress event: %w", err)
+    }
+    if err := writer.Close(); err != nil {
+        return nil, fmt.Errorf("failed to compress event: %w", err)
+    }
+    return buf.Bytes(), nil
+}
+
+// Decompress returns the JSON of a serialized event, gunzipping it if it was
+// compressed. Plain payloads are returned unchanged.
+func Decompress(data []byte) ([]byte, error) {
+    if !IsCompressed(data) {
+        return data, nil
+    }
+    
+    reader, err := gzip.NewReader(bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("failed to decompress event: %w", err)
+    }
+    defer reader.Close()
+    
+    decompressed, err := io.ReadAll(reader)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decompress event: %w", err)
+    }
+    return decompressed, nil
+}
+
+// IsCompressed reports whether data is a gzip-compressed payload.
+func IsCompressed(data []byte) bool {
+    return bytes.HasPrefix(data, gzipMagic)
+}
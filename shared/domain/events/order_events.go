@@ -3,16 +3,27 @@ package events
 import (
 	"time"
 
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
 	"github.com/vdntruong/dddcqrs/shared/domain/entities"
 	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
 )
 
 type OrderCreatedEvent struct {
     BaseDomainEvent
+    // OrderNumber is empty in events from before order numbers were given
+    OrderNumber     string                `json:"order_number,omitempty"`
+    // CustomerID is empty for guest checkouts
     CustomerID      string                `json:"customer_id"`
+    // ContactEmail is set for guest checkouts, and empty in events from
+    // before they were taken
+    ContactEmail    valueobjects.Email    `json:"contact_email,omitempty"`
     Items           []OrderItemData       `json:"items"`
     TotalAmount     valueobjects.Money    `json:"total_amount"`
+    ShippingCost    valueobjects.Money    `json:"shipping_cost"`
+    GrandTotal      valueobjects.Money    `json:"grand_total"`
     ShippingAddress valueobjects.Address `json:"shipping_address"`
+    // Channel is empty in events from before channels were recorded
+    Channel         valueobjects.OrderChannel `json:"channel,omitempty"`
 }
 
 type OrderItemData struct {
@@ -21,91 +32,215 @@ type OrderItemData struct {
     Price     valueobjects.Money `json:"price"`
 }
 
+// NewOrderCreatedEvent records a new order with every item on it, so the
+// event grows with the item list. The outbox and the event store refuse
+// events over their size limits with ErrEventTooLarge, see CheckSize;
+// entities.OrderLimits keep orders well under them by default.
 func NewOrderCreatedEvent(order *entities.Order) OrderCreatedEvent {
-    items := make([]OrderItemData, len(order.Items))
-    for i, item := range order.Items {
-        items[i] = OrderItemData{
-            ProductID: item.ProductID,
-            Quantity:  item.Quantity,
-            Price:     item.Price,
-        }
-    }
-    
     return OrderCreatedEvent{
         BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
             EventType:   "OrderCreated",
             AggregateIDValue: string(order.ID),
-            OccurredAtTime:   time.Now(),
+            OccurredAtTime:   clock.Now(),
         },
+        OrderNumber:     order.Number,
         CustomerID:      order.CustomerID,
-        Items:           items,
+        ContactEmail:    order.ContactEmail,
+        Items:           orderItemData(order),
         TotalAmount:     order.TotalAmount,
+        ShippingCost:    order.ShippingCost,
+        GrandTotal:      order.GrandTotal,
         ShippingAddress: order.ShippingAddress,
+        Channel:         order.Channel,
     }
 }
 
+// orderItemData returns the items of order as events carry them.
+func orderItemData(order *entities.Order) []OrderItemData {
+    items := make([]OrderItemData, len(order.Items))
+    for i, item := range order.Items {
+        items[i] = OrderItemData{
+            ProductID: item.ProductID,
+            Quantity:  item.Quantity,
+            Price:     item.Price,
+        }
+    }
+    return items
+}
+
+// OrderConfirmedEvent carries the items and total the order was confirmed
+// with, for consumers reserving stock, such as the saga in package sagas,
+// not to read the order back. Events stored before they were carried
+// decode with nil Items and a zero TotalAmount, which HasItems reports;
+// orders are never confirmed empty.
 type OrderConfirmedEvent struct {
     BaseDomainEvent
-    CustomerID string `json:"customer_id"`
+    CustomerID  string             `json:"customer_id"`
+    // ConfirmedAt starts the cancellation window; events stored before it
+    // existed leave it zero
+    ConfirmedAt time.Time          `json:"confirmed_at,omitempty"`
+    Items       []OrderItemData    `json:"items,omitempty"`
+    TotalAmount valueobjects.Money `json:"total_amount"`
 }
 
+// NewOrderConfirmedEvent records the order's items as NewOrderCreatedEvent
+// does, so the event grows with the item list and is subject to the same
+// size limits.
 func NewOrderConfirmedEvent(order *entities.Order) OrderConfirmedEvent {
     return OrderConfirmedEvent{
         BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
             EventType:   "OrderConfirmed",
             AggregateIDValue: string(order.ID),
-            OccurredAtTime:   time.Now(),
+            OccurredAtTime:   clock.Now(),
         },
-        CustomerID: order.CustomerID,
+        CustomerID:  order.CustomerID,
+        ConfirmedAt: order.ConfirmedAt,
+        Items:       orderItemData(order),
+        TotalAmount: order.TotalAmount,
     }
 }
 
+// HasItems reports whether the event carries the order's items, which
+// events stored before items were carried do not. Consumers read the order
+// for those.
+func (e OrderConfirmedEvent) HasItems() bool {
+    return len(e.Items) > 0
+}
+
 type OrderShippedEvent struct {
     BaseDomainEvent
-    CustomerID string `json:"customer_id"`
+    CustomerID string    `json:"customer_id"`
+    // ShippedAt bounds the delivery time; events stored before it existed
+    // leave it zero
+    ShippedAt  time.Time `json:"shipped_at,omitempty"`
 }
 
 func NewOrderShippedEvent(order *entities.Order) OrderShippedEvent {
     return OrderShippedEvent{
         BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
             EventType:   "OrderShipped",
             AggregateIDValue: string(order.ID),
-            OccurredAtTime:   time.Now(),
+            OccurredAtTime:   clock.Now(),
         },
         CustomerID: order.CustomerID,
+        ShippedAt:  order.ShippedAt,
     }
 }
 
+// OrderDeliveredEvent records the delivery details given with the
+// confirmation. Events stored before they were recorded leave them zero.
 type OrderDeliveredEvent struct {
     BaseDomainEvent
-    CustomerID string `json:"customer_id"`
+    CustomerID       string    `json:"customer_id"`
+    DeliveredAt      time.Time `json:"delivered_at,omitempty"`
+    SignedBy         string    `json:"signed_by,omitempty"`
+    // CarrierReference is the carrier's reference for the delivery, such
+    // as its proof of delivery number
+    CarrierReference string    `json:"carrier_reference,omitempty"`
 }
 
-func NewOrderDeliveredEvent(order *entities.Order) OrderDeliveredEvent {
+func NewOrderDeliveredEvent(order *entities.Order, carrierReference string) OrderDeliveredEvent {
     return OrderDeliveredEvent{
         BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
             EventType:   "OrderDelivered",
             AggregateIDValue: string(order.ID),
-            OccurredAtTime:   time.Now(),
+            OccurredAtTime:   clock.Now(),
         },
-        CustomerID: order.CustomerID,
+        CustomerID:       order.CustomerID,
+        DeliveredAt:      order.DeliveredAt,
+        SignedBy:         order.SignedBy,
+        CarrierReference: carrierReference,
     }
 }
 
+// OrderCancelledEvent carries why the order was cancelled. Events from
+// before reasons were enumerated carried free text in reason; they decode
+// with CancellationReasonOther and the text as Details.
 type OrderCancelledEvent struct {
     BaseDomainEvent
-    CustomerID string `json:"customer_id"`
-    Reason     string `json:"reason"`
+    CustomerID string                          `json:"customer_id"`
+    Reason     valueobjects.CancellationReason `json:"reason"`
+    Details    string                          `json:"details,omitempty"`
+    // Forced marks an administrator's cancellation past the cancellation
+    // window
+    Forced     bool                            `json:"forced,omitempty"`
 }
 
-func NewOrderCancelledEvent(order *entities.Order, reason string) OrderCancelledEvent {
+func NewOrderCancelledEvent(order *entities.Order, reason valueobjects.CancellationReason, details string, forced bool) OrderCancelledEvent {
     return OrderCancelledEvent{
         BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
             EventType:   "OrderCancelled",
             AggregateIDValue: string(order.ID),
-            OccurredAtTime:   time.Now(),
+            OccurredAtTime:   clock.Now(),
+        },
+        CustomerID: order.CustomerID,
+        Reason:     reason,
+        Details:    details,
+        Forced:     forced,
+    }
+}
+
+type OrderReopenedEvent struct {
+    BaseDomainEvent
+    CustomerID string `json:"customer_id"`
+}
+
+func NewOrderReopenedEvent(order *entities.Order) OrderReopenedEvent {
+    return OrderReopenedEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:   "OrderReopened",
+            AggregateIDValue: string(order.ID),
+            OccurredAtTime:   clock.Now(),
+        },
+        CustomerID: order.CustomerID,
+    }
+}
+
+// OrderHeldEvent puts a confirmed order on hold for review, saying why.
+type OrderHeldEvent struct {
+    BaseDomainEvent
+    CustomerID string `json:"customer_id"`
+    Reason     string `json:"reason"`
+}
+
+func NewOrderHeldEvent(order *entities.Order) OrderHeldEvent {
+    return OrderHeldEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "OrderHeld",
+            AggregateIDValue: string(order.ID),
+            OccurredAtTime:   clock.Now(),
         },
         CustomerID: order.CustomerID,
+        Reason:     order.HoldReason,
+    }
+}
+
+// OrderReleasedEvent returns an order on hold to confirmed. HoldReason is
+// why it was held, and Reason why it was released, if given.
+type OrderReleasedEvent struct {
+    BaseDomainEvent
+    CustomerID string `json:"customer_id"`
+    HoldReason string `json:"hold_reason,omitempty"`
+    Reason     string `json:"reason,omitempty"`
+}
+
+func NewOrderReleasedEvent(order *entities.Order, holdReason, reason string) OrderReleasedEvent {
+    return OrderReleasedEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "OrderReleased",
+            AggregateIDValue: string(order.ID),
+            OccurredAtTime:   clock.Now(),
+        },
+        CustomerID: order.CustomerID,
+        HoldReason: holdReason,
         Reason:     reason,
     }
 }
@@ -115,33 +250,117 @@ type OrderItemAddedEvent struct {
     ProductID string              `json:"product_id"`
     Quantity  int                `json:"quantity"`
     Price     valueobjects.Money `json:"price"`
+    // Order shipping and grand total after the change
+    ShippingCost valueobjects.Money `json:"shipping_cost"`
+    GrandTotal   valueobjects.Money `json:"grand_total"`
 }
 
 func NewOrderItemAddedEvent(order *entities.Order, productID string, quantity int, price valueobjects.Money) OrderItemAddedEvent {
     return OrderItemAddedEvent{
         BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
             EventType:   "OrderItemAdded",
             AggregateIDValue: string(order.ID),
-            OccurredAtTime:   time.Now(),
+            OccurredAtTime:   clock.Now(),
         },
-        ProductID: productID,
-        Quantity:  quantity,
-        Price:     price,
+        ProductID:    productID,
+        Quantity:     quantity,
+        Price:        price,
+        ShippingCost: order.ShippingCost,
+        GrandTotal:   order.GrandTotal,
     }
 }
 
 type OrderItemRemovedEvent struct {
     BaseDomainEvent
     ProductID string `json:"product_id"`
+    // Order shipping and grand total after the change
+    ShippingCost valueobjects.Money `json:"shipping_cost"`
+    GrandTotal   valueobjects.Money `json:"grand_total"`
 }
 
 func NewOrderItemRemovedEvent(order *entities.Order, productID string) OrderItemRemovedEvent {
     return OrderItemRemovedEvent{
         BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
             EventType:   "OrderItemRemoved",
             AggregateIDValue: string(order.ID),
-            OccurredAtTime:   time.Now(),
+            OccurredAtTime:   clock.Now(),
+        },
+        ProductID:    productID,
+        ShippingCost: order.ShippingCost,
+        GrandTotal:   order.GrandTotal,
+    }
+}
+
+// OrderItemQuantityChangedEvent sets the quantity of the first line of a
+// product on the order.
+type OrderItemQuantityChangedEvent struct {
+    BaseDomainEvent
+    ProductID string `json:"product_id"`
+    Quantity  int    `json:"quantity"`
+    // Order shipping and grand total after the change
+    ShippingCost valueobjects.Money `json:"shipping_cost"`
+    GrandTotal   valueobjects.Money `json:"grand_total"`
+}
+
+func NewOrderItemQuantityChangedEvent(order *entities.Order, productID string, quantity int) OrderItemQuantityChangedEvent {
+    return OrderItemQuantityChangedEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "OrderItemQuantityChanged",
+            AggregateIDValue: string(order.ID),
+            OccurredAtTime:   clock.Now(),
+        },
+        ProductID:    productID,
+        Quantity:     quantity,
+        ShippingCost: order.ShippingCost,
+        GrandTotal:   order.GrandTotal,
+    }
+}
+
+// OrderShippingAddressChangedEvent moves the order to a new shipping
+// address, with shipping repriced for it.
+type OrderShippingAddressChangedEvent struct {
+    BaseDomainEvent
+    ShippingAddress valueobjects.Address `json:"shipping_address"`
+    // Order shipping and grand total after the change
+    ShippingCost valueobjects.Money `json:"shipping_cost"`
+    GrandTotal   valueobjects.Money `json:"grand_total"`
+}
+
+func NewOrderShippingAddressChangedEvent(order *entities.Order) OrderShippingAddressChangedEvent {
+    return OrderShippingAddressChangedEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "OrderShippingAddressChanged",
+            AggregateIDValue: string(order.ID),
+            OccurredAtTime:   clock.Now(),
+        },
+        ShippingAddress: order.ShippingAddress,
+        ShippingCost:    order.ShippingCost,
+        GrandTotal:      order.GrandTotal,
+    }
+}
+
+// OrderCustomerReassignedEvent moves an order to another customer, when
+// the customer who placed it, PreviousCustomerID, is merged into
+// CustomerID. It does not change the order's status.
+type OrderCustomerReassignedEvent struct {
+    BaseDomainEvent
+    CustomerID         string `json:"customer_id"`
+    PreviousCustomerID string `json:"previous_customer_id"`
+}
+
+func NewOrderCustomerReassignedEvent(order *entities.Order, previousCustomerID string) OrderCustomerReassignedEvent {
+    return OrderCustomerReassignedEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "OrderCustomerReassigned",
+            AggregateIDValue: string(order.ID),
+            OccurredAtTime:   clock.Now(),
         },
-        ProductID: productID,
+        CustomerID:         order.CustomerID,
+        PreviousCustomerID: previousCustomerID,
     }
 }
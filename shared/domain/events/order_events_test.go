@@ -0,0 +1,239 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// A confirmation carries the order's items and total through the outbox
+// and back, so consumers reserving stock need not read the order.
+func TestOrderConfirmedEvent_roundTrip(t *testing.T) {
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    if err := order.AddItem("product-1", 2, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    if err := order.AddItem("product-2", 1, valueobjects.NewMoney(550, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    if err := order.Confirm(); err != nil {
+        t.Fatalf("Confirm: %v", err)
+    }
+    
+    sent := NewOrderConfirmedEvent(order)
+    data, err := json.Marshal(sent)
+    if err != nil {
+        t.Fatal(err)
+    }
+    event, err := DefaultRegistry().Unmarshal("OrderConfirmed", data)
+    if err != nil {
+        t.Fatalf("Unmarshal() = %v", err)
+    }
+    got, ok := event.(OrderConfirmedEvent)
+    if !ok {
+        t.Fatalf("Unmarshal() = %T, want OrderConfirmedEvent", event)
+    }
+    
+    if !got.HasItems() {
+        t.Fatal("HasItems() = false after the round trip")
+    }
+    wantItems := []OrderItemData{
+        {ProductID: "product-1", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")},
+        {ProductID: "product-2", Quantity: 1, Price: valueobjects.NewMoney(550, "USD")},
+    }
+    if !reflect.DeepEqual(got.Items, wantItems) {
+        t.Errorf("items = %+v, want %+v", got.Items, wantItems)
+    }
+    if got.TotalAmount != order.TotalAmount || got.CustomerID != "customer-1" {
+        t.Errorf("total, customer = %v, %q, want %v, customer-1", got.TotalAmount, got.CustomerID, order.TotalAmount)
+    }
+    if !got.ConfirmedAt.Equal(order.ConfirmedAt) || got.ConfirmedAt.IsZero() {
+        t.Errorf("confirmed at = %v, want %v", got.ConfirmedAt, order.ConfirmedAt)
+    }
+    if got.EventID() != sent.EventID() || !got.OccurredAt().Equal(sent.OccurredAt()) || got.AggregateID() != string(order.ID) {
+        t.Errorf("envelope = %+v, want %+v", got.BaseDomainEvent, sent.BaseDomainEvent)
+    }
+}
+
+// An order confirmed before items were carried decodes without them, and
+// its total, as stored, survives.
+func TestOrderConfirmedEvent_HasItems(t *testing.T) {
+    tests := []struct {
+        name string
+        data string
+        want bool
+    }{
+        {name: "with items", data: `{"event_type": "OrderConfirmed", "aggregate_id": "order-1", "occurred_at": "2024-01-10T09:00:00Z", "items": [{"product_id": "product-1", "quantity": 1, "price": {"amount": 1000, "currency": "USD"}}]}`, want: true},
+        {name: "without items", data: `{"event_type": "OrderConfirmed", "aggregate_id": "order-1", "occurred_at": "2024-01-10T09:00:00Z"}`},
+        {name: "empty items", data: `{"event_type": "OrderConfirmed", "aggregate_id": "order-1", "occurred_at": "2024-01-10T09:00:00Z", "items": []}`},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            event, err := DefaultRegistry().Unmarshal("OrderConfirmed", []byte(tt.data))
+            if err != nil {
+                t.Fatalf("Unmarshal() = %v", err)
+            }
+            if got := event.(OrderConfirmedEvent).HasItems(); got != tt.want {
+                t.Errorf("HasItems() = %t, want %t", got, tt.want)
+            }
+        })
+    }
+}
+
+// WithSequence sets the sequence on a copy, leaving the event it was given
+// and the rest of the copy unchanged.
+func TestWithSequence(t *testing.T) {
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    original := NewOrderConfirmedEvent(order)
+    
+    stamped := WithSequence(original, 3)
+    if stamped.Sequence() != 3 || original.Sequence() != 0 {
+        t.Errorf("sequences = %d stamped, %d original, want 3 and 0", stamped.Sequence(), original.Sequence())
+    }
+    confirmed, ok := stamped.(OrderConfirmedEvent)
+    if !ok {
+        t.Fatalf("WithSequence() = %T, want OrderConfirmedEvent", stamped)
+    }
+    confirmed.SequenceValue = 0
+    if !reflect.DeepEqual(confirmed, original) {
+        t.Errorf("WithSequence() changed more than the sequence: %+v, want %+v", confirmed, original)
+    }
+}
+
+// Shipment and delivery details survive the outbox and replay; events
+// stored before they were recorded replay with the time they occurred and
+// no signer.
+func TestOrderDeliveredEvent_replay(t *testing.T) {
+    shippedAt := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+    fake := clock.NewFake(shippedAt)
+    defer clock.Set(fake)()
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    if err := order.AddItem("product-1", 1, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    if err := order.Confirm(); err != nil {
+        t.Fatalf("Confirm: %v", err)
+    }
+    if err := order.Ship(); err != nil {
+        t.Fatalf("Ship: %v", err)
+    }
+    shipped := NewOrderShippedEvent(order)
+    fake.Advance(3 * time.Hour)
+    if err := order.Deliver(shippedAt.Add(time.Hour), "J. Doe"); err != nil {
+        t.Fatalf("Deliver: %v", err)
+    }
+    delivered := NewOrderDeliveredEvent(order, "POD-123")
+    
+    roundTrip := func(event DomainEvent) DomainEvent {
+        t.Helper()
+        data, err := json.Marshal(event)
+        if err != nil {
+            t.Fatal(err)
+        }
+        decoded, err := DefaultRegistry().Unmarshal(event.Type(), data)
+        if err != nil {
+            t.Fatalf("Unmarshal(%s) = %v", event.Type(), err)
+        }
+        return decoded
+    }
+    
+    got := roundTrip(delivered).(OrderDeliveredEvent)
+    if !got.DeliveredAt.Equal(shippedAt.Add(time.Hour)) || got.SignedBy != "J. Doe" || got.CarrierReference != "POD-123" {
+        t.Errorf("OrderDelivered after the round trip = %+v", got)
+    }
+    
+    replayed := &entities.Order{Status: valueobjects.OrderStatusConfirmed}
+    for _, event := range []DomainEvent{roundTrip(shipped), got} {
+        if err := ApplyOrderEvent(replayed, event); err != nil {
+            t.Fatalf("ApplyOrderEvent(%s) = %v", event.Type(), err)
+        }
+    }
+    if !replayed.ShippedAt.Equal(shippedAt) || !replayed.DeliveredAt.Equal(shippedAt.Add(time.Hour)) || replayed.SignedBy != "J. Doe" {
+        t.Errorf("replayed shipped at %v, delivered at %v by %q", replayed.ShippedAt, replayed.DeliveredAt, replayed.SignedBy)
+    }
+    
+    occurredAt := shippedAt.Add(5 * time.Hour)
+    legacy := &entities.Order{Status: valueobjects.OrderStatusConfirmed}
+    for _, event := range []DomainEvent{
+        OrderShippedEvent{BaseDomainEvent: BaseDomainEvent{EventType: "OrderShipped", OccurredAtTime: occurredAt}},
+        OrderDeliveredEvent{BaseDomainEvent: BaseDomainEvent{EventType: "OrderDelivered", OccurredAtTime: occurredAt}},
+    } {
+        if err := ApplyOrderEvent(legacy, event); err != nil {
+            t.Fatalf("ApplyOrderEvent(%s) = %v", event.Type(), err)
+        }
+    }
+    if !legacy.ShippedAt.Equal(occurredAt) || !legacy.DeliveredAt.Equal(occurredAt) || legacy.SignedBy != "" {
+        t.Errorf("legacy events replayed shipped at %v, delivered at %v by %q, want both at %v", legacy.ShippedAt, legacy.DeliveredAt, legacy.SignedBy, occurredAt)
+    }
+}
+
+// Holds and releases round trip with their reasons and replay onto the
+// order.
+func TestOrderHeldAndReleasedEvents_replay(t *testing.T) {
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    if err := order.AddItem("product-1", 1, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    if err := order.Confirm(); err != nil {
+        t.Fatalf("Confirm: %v", err)
+    }
+    if err := order.Hold("fraud review"); err != nil {
+        t.Fatalf("Hold: %v", err)
+    }
+    held := NewOrderHeldEvent(order)
+    if err := order.Release(); err != nil {
+        t.Fatalf("Release: %v", err)
+    }
+    released := NewOrderReleasedEvent(order, "fraud review", "cleared")
+    
+    var decoded []DomainEvent
+    for _, event := range []DomainEvent{held, released} {
+        data, err := json.Marshal(event)
+        if err != nil {
+            t.Fatal(err)
+        }
+        got, err := DefaultRegistry().Unmarshal(event.Type(), data)
+        if err != nil {
+            t.Fatalf("Unmarshal(%s) = %v", event.Type(), err)
+        }
+        decoded = append(decoded, got)
+    }
+    if got := decoded[0].(OrderHeldEvent); got.Reason != "fraud review" {
+        t.Errorf("OrderHeld reason = %q, want fraud review", got.Reason)
+    }
+    if got := decoded[1].(OrderReleasedEvent); got.HoldReason != "fraud review" || got.Reason != "cleared" {
+        t.Errorf("OrderReleased = %+v, want held for fraud review, released as cleared", got)
+    }
+    
+    replayed := &entities.Order{Status: valueobjects.OrderStatusConfirmed}
+    if err := ApplyOrderEvent(replayed, decoded[0]); err != nil {
+        t.Fatalf("ApplyOrderEvent(OrderHeld) = %v", err)
+    }
+    if replayed.Status != valueobjects.OrderStatusOnHold || replayed.HoldReason != "fraud review" {
+        t.Errorf("replayed hold is %s for %q", replayed.Status, replayed.HoldReason)
+    }
+    if err := ApplyOrderEvent(replayed, decoded[1]); err != nil {
+        t.Fatalf("ApplyOrderEvent(OrderReleased) = %v", err)
+    }
+    if replayed.Status != valueobjects.OrderStatusConfirmed || replayed.HoldReason != "" {
+        t.Errorf("replayed release is %s for %q", replayed.Status, replayed.HoldReason)
+    }
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// ReplayOrder rebuilds an order from its events, oldest first. The history
+// must start with the OrderCreated event.
+func ReplayOrder(history []DomainEvent) (*entities.Order, error) {
+    if len(history) == 0 {
+        return nil, fmt.Errorf("no events to replay")
+    }
+    if _, ok := history[0].(OrderCreatedEvent); !ok {
+        return nil, fmt.Errorf("order history starts with %s, not OrderCreated", history[0].Type())
+    }
+    
+    order := &entities.Order{}
+    for _, event := range history {
+        if err := ApplyOrderEvent(order, event); err != nil {
+            return nil, err
+        }
+    }
+    return order, nil
+}
+
+// ApplyOrderEvent moves order to the state it had after event. Events are
+// facts, so the aggregate's business rules are not checked again.
+func ApplyOrderEvent(order *entities.Order, event DomainEvent) error {
+    switch e := event.(type) {
+    case OrderCreatedEvent:
+        *order = entities.Order{
+            ID:              entities.OrderID(e.AggregateID()),
+            Number:          e.OrderNumber,
+            CustomerID:      e.CustomerID,
+            ContactEmail:    e.ContactEmail,
+            Items:           make([]entities.OrderItem, 0, len(e.Items)),
+            Status:          valueobjects.OrderStatusDraft,
+            TotalAmount:     e.TotalAmount,
+            ShippingCost:    e.ShippingCost,
+            GrandTotal:      e.GrandTotal,
+            ShippingAddress: e.ShippingAddress,
+            Channel:         e.Channel,
+            CreatedAt:       e.OccurredAt(),
+        }
+        if order.Channel == "" {
+            order.Channel = valueobjects.OrderChannelUnknown
+        }
+        for _, item := range e.Items {
+            order.Items = append(order.Items, entities.OrderItem{
+                ProductID: item.ProductID,
+                Quantity:  item.Quantity,
+                Price:     item.Price,
+            })
+        }
+    case OrderConfirmedEvent:
+        order.Status = valueobjects.OrderStatusConfirmed
+        order.ConfirmedAt = e.ConfirmedAt
+        if order.ConfirmedAt.IsZero() {
+            order.ConfirmedAt = e.OccurredAt()
+        }
+    case OrderShippedEvent:
+        order.Status = valueobjects.OrderStatusShipped
+        order.ShippedAt = e.ShippedAt
+        if order.ShippedAt.IsZero() {
+            order.ShippedAt = e.OccurredAt()
+        }
+    case OrderDeliveredEvent:
+        order.Status = valueobjects.OrderStatusDelivered
+        order.DeliveredAt = e.DeliveredAt
+        if order.DeliveredAt.IsZero() {
+            order.DeliveredAt = e.OccurredAt()
+        }
+        order.SignedBy = e.SignedBy
+    case OrderCancelledEvent:
+        order.PreviousStatus = order.Status
+        order.Status = valueobjects.OrderStatusCancelled
+        order.HoldReason = ""
+    case OrderHeldEvent:
+        order.Status = valueobjects.OrderStatusOnHold
+        order.HoldReason = e.Reason
+    case OrderReleasedEvent:
+        order.Status = valueobjects.OrderStatusConfirmed
+        order.HoldReason = ""
+    case OrderReopenedEvent:
+        order.PreviousStatus = order.Status
+        order.Status = valueobjects.OrderStatusDraft
+    case OrderItemAddedEvent:
+        order.Items = append(order.Items, entities.OrderItem{
+            ProductID: e.ProductID,
+            Quantity:  e.Quantity,
+            Price:     e.Price,
+        })
+        applyOrderTotals(order, e.ShippingCost, e.GrandTotal)
+    case OrderItemRemovedEvent:
+        for i, item := range order.Items {
+            if item.ProductID == e.ProductID {
+                order.Items = append(order.Items[:i], order.Items[i+1:]...)
+                break
+            }
+        }
+        applyOrderTotals(order, e.ShippingCost, e.GrandTotal)
+    case OrderItemQuantityChangedEvent:
+        for i, item := range order.Items {
+            if item.ProductID == e.ProductID {
+                order.Items[i].Quantity = e.Quantity
+                break
+            }
+        }
+        applyOrderTotals(order, e.ShippingCost, e.GrandTotal)
+    case OrderShippingAddressChangedEvent:
+        order.ShippingAddress = e.ShippingAddress
+        applyOrderTotals(order, e.ShippingCost, e.GrandTotal)
+    case OrderCustomerReassignedEvent:
+        order.CustomerID = e.CustomerID
+    default:
+        return fmt.Errorf("%s is not an order event", event.Type())
+    }
+    
+    order.UpdatedAt = event.OccurredAt()
+    if event.Sequence() > 0 {
+        order.Version = event.Sequence()
+    }
+    return nil
+}
+
+// applyOrderTotals sets the totals carried by an item event. The item total
+// is not carried, so it is derived from the other two.
+func applyOrderTotals(order *entities.Order, shippingCost, grandTotal valueobjects.Money) {
+    order.ShippingCost = shippingCost
+    order.GrandTotal = grandTotal
+    order.TotalAmount = valueobjects.Money{
+        Amount:   grandTotal.Amount - shippingCost.Amount,
+        Currency: grandTotal.Currency,
+    }
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// OrderStatusChangedEvent is published alongside each event that changes an
+// order's status, OrderConfirmed, OrderHeld, OrderReleased, OrderShipped,
+// OrderDelivered, OrderCancelled and OrderReopened, for consumers that only need to know
+// the status changed. It is derived from the triggering event rather than
+// recorded: it goes to the outbox only, never to the event store, so it
+// takes no part in rebuilding orders or in their versions, and carries no
+// sequence of its own.
+type OrderStatusChangedEvent struct {
+    BaseDomainEvent
+    CustomerID string `json:"customer_id"`
+    FromStatus string `json:"from_status"`
+    ToStatus   string `json:"to_status"`
+    // TriggerEventID and TriggerEventType identify the specific event,
+    // and TriggerSequence its version in the order's history
+    TriggerEventID   string `json:"trigger_event_id"`
+    TriggerEventType string `json:"trigger_event_type"`
+    TriggerSequence  int    `json:"trigger_sequence,omitempty"`
+}
+
+// StatusAfter returns the status event moves its order to, if it changes
+// the order's status.
+func StatusAfter(event DomainEvent) (valueobjects.OrderStatus, bool) {
+    switch event.(type) {
+    case OrderConfirmedEvent:
+        return valueobjects.OrderStatusConfirmed, true
+    case OrderHeldEvent:
+        return valueobjects.OrderStatusOnHold, true
+    case OrderReleasedEvent:
+        return valueobjects.OrderStatusConfirmed, true
+    case OrderShippedEvent:
+        return valueobjects.OrderStatusShipped, true
+    case OrderDeliveredEvent:
+        return valueobjects.OrderStatusDelivered, true
+    case OrderCancelledEvent:
+        return valueobjects.OrderStatusCancelled, true
+    case OrderReopenedEvent:
+        return valueobjects.OrderStatusDraft, true
+    default:
+        return "", false
+    }
+}
+
+// NewOrderStatusChangedEvent returns the event announcing the status change
+// trigger made from the status from, or false when trigger does not change
+// the order's status. Its id is derived from trigger's, so the same trigger
+// always gives the same id and consumers can recognise redeliveries.
+func NewOrderStatusChangedEvent(trigger DomainEvent, from valueobjects.OrderStatus) (OrderStatusChangedEvent, bool) {
+    to, ok := StatusAfter(trigger)
+    if !ok {
+        return OrderStatusChangedEvent{}, false
+    }
+    
+    eventID := newEventID()
+    if trigger.EventID() != "" {
+        eventID = uuid.NewSHA1(uuid.NameSpaceURL, []byte("urn:order-status-changed:"+trigger.EventID())).String()
+    }
+    return OrderStatusChangedEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     eventID,
+            EventType:        "OrderStatusChanged",
+            AggregateIDValue: trigger.AggregateID(),
+            OccurredAtTime:   trigger.OccurredAt(),
+        },
+        CustomerID:       customerOf(trigger),
+        FromStatus:       from.String(),
+        ToStatus:         to.String(),
+        TriggerEventID:   trigger.EventID(),
+        TriggerEventType: trigger.Type(),
+        TriggerSequence:  trigger.Sequence(),
+    }, true
+}
+
+// customerOf returns the customer of a status event.
+func customerOf(event DomainEvent) string {
+    switch e := event.(type) {
+    case OrderConfirmedEvent:
+        return e.CustomerID
+    case OrderHeldEvent:
+        return e.CustomerID
+    case OrderReleasedEvent:
+        return e.CustomerID
+    case OrderShippedEvent:
+        return e.CustomerID
+    case OrderDeliveredEvent:
+        return e.CustomerID
+    case OrderCancelledEvent:
+        return e.CustomerID
+    case OrderReopenedEvent:
+        return e.CustomerID
+    default:
+        return ""
+    }
+}
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Each status event gives an OrderStatusChanged naming it, with an id
+// derived from its own; other events give none.
+func TestNewOrderStatusChangedEvent(t *testing.T) {
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    if err := order.AddItem("product-1", 1, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    if err := order.Confirm(); err != nil {
+        t.Fatalf("Confirm: %v", err)
+    }
+    confirmed := NewOrderConfirmedEvent(order)
+    confirmed.SequenceValue = 3
+    
+    changed, ok := NewOrderStatusChangedEvent(confirmed, valueobjects.OrderStatusDraft)
+    if !ok {
+        t.Fatal("NewOrderStatusChangedEvent(OrderConfirmed) reported no status change")
+    }
+    want := OrderStatusChangedEvent{
+        BaseDomainEvent:  changed.BaseDomainEvent,
+        CustomerID:       "customer-1",
+        FromStatus:       "draft",
+        ToStatus:         "confirmed",
+        TriggerEventID:   confirmed.EventID(),
+        TriggerEventType: "OrderConfirmed",
+        TriggerSequence:  3,
+    }
+    if !reflect.DeepEqual(changed, want) {
+        t.Errorf("event = %+v, want %+v", changed, want)
+    }
+    if changed.Type() != "OrderStatusChanged" || changed.AggregateID() != string(order.ID) || !changed.OccurredAt().Equal(confirmed.OccurredAt()) {
+        t.Errorf("event is %s of %s at %v, want OrderStatusChanged of %s at %v", changed.Type(), changed.AggregateID(), changed.OccurredAt(), order.ID, confirmed.OccurredAt())
+    }
+    
+    // A redelivered trigger gives the same event id, another trigger another
+    again, _ := NewOrderStatusChangedEvent(confirmed, valueobjects.OrderStatusDraft)
+    other, _ := NewOrderStatusChangedEvent(NewOrderConfirmedEvent(order), valueobjects.OrderStatusDraft)
+    if again.EventID() != changed.EventID() || other.EventID() == changed.EventID() || changed.EventID() == confirmed.EventID() {
+        t.Errorf("event ids = %s, %s, %s for trigger %s, want the first two equal and derived", changed.EventID(), again.EventID(), other.EventID(), confirmed.EventID())
+    }
+    
+    if _, ok := NewOrderStatusChangedEvent(NewOrderCreatedEvent(order), ""); ok {
+        t.Error("NewOrderStatusChangedEvent(OrderCreated) reported a status change")
+    }
+    
+    data, err := json.Marshal(changed)
+    if err != nil {
+        t.Fatalf("Marshal: %v", err)
+    }
+    decoded, err := DefaultRegistry().Unmarshal("OrderStatusChanged", data)
+    if err != nil {
+        t.Fatalf("Unmarshal: %v", err)
+    }
+    if got, ok := decoded.(OrderStatusChangedEvent); !ok || got.FromStatus != "draft" || got.ToStatus != "confirmed" || got.TriggerEventID != confirmed.EventID() {
+        t.Errorf("decoded %#v, want the OrderStatusChanged sent", decoded)
+    }
+}
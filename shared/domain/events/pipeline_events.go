@@ -0,0 +1,31 @@
+package events
+
+import "time"
+
+// PipelineHeartbeatAggregateID is the aggregate of the heartbeat events, so
+// they are delivered in the order they were sent.
+const PipelineHeartbeatAggregateID = "pipeline_heartbeat"
+
+// PipelineHeartbeatEvent is saved to the outbox by the order management
+// service at an interval and sent the way order events are, so the
+// reporting service can measure how long events take to reach its
+// projections. It describes no order.
+type PipelineHeartbeatEvent struct {
+    BaseDomainEvent
+    // Source names the process that sent the heartbeat
+    Source string    `json:"source"`
+    SentAt time.Time `json:"sent_at"`
+}
+
+func NewPipelineHeartbeatEvent(source string, sentAt time.Time) PipelineHeartbeatEvent {
+    return PipelineHeartbeatEvent{
+        BaseDomainEvent: BaseDomainEvent{
+            EventIDValue:     newEventID(),
+            EventType:        "PipelineHeartbeat",
+            AggregateIDValue: PipelineHeartbeatAggregateID,
+            OccurredAtTime:   sentAt,
+        },
+        Source: source,
+        SentAt: sentAt,
+    }
+}
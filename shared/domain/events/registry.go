@@ -0,0 +1,125 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownEventType is matched by the errors Unmarshal returns for event
+// types the registry has no type registered for, as opposed to events it
+// knows that a consumer does not handle.
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// UnknownEventTypeError names the event type Unmarshal did not know.
+type UnknownEventTypeError struct {
+    EventType string
+}
+
+func (e *UnknownEventTypeError) Error() string {
+    return fmt.Sprintf("%v: %s", ErrUnknownEventType, e.EventType)
+}
+
+func (e *UnknownEventTypeError) Is(target error) bool {
+    return target == ErrUnknownEventType
+}
+
+// Registry maps event type names to their concrete Go types so serialized
+// events (outbox rows, event store rows, bus messages) can be turned back
+// into DomainEvent values that handlers can type-switch on.
+type Registry struct {
+    decoders map[string]func(data []byte) (DomainEvent, error)
+}
+
+func NewRegistry() *Registry {
+    return &Registry{decoders: make(map[string]func(data []byte) (DomainEvent, error))}
+}
+
+// DefaultRegistry returns a registry with every event type defined in this
+// package registered.
+func DefaultRegistry() *Registry {
+    r := NewRegistry()
+    Register[OrderCreatedEvent](r, "OrderCreated")
+    Register[OrderConfirmedEvent](r, "OrderConfirmed")
+    Register[OrderShippedEvent](r, "OrderShipped")
+    Register[OrderDeliveredEvent](r, "OrderDelivered")
+    Register[OrderCancelledEvent](r, "OrderCancelled")
+    Register[OrderReopenedEvent](r, "OrderReopened")
+    Register[OrderHeldEvent](r, "OrderHeld")
+    Register[OrderReleasedEvent](r, "OrderReleased")
+    Register[OrderItemAddedEvent](r, "OrderItemAdded")
+    Register[OrderItemRemovedEvent](r, "OrderItemRemoved")
+    Register[OrderItemQuantityChangedEvent](r, "OrderItemQuantityChanged")
+    Register[OrderShippingAddressChangedEvent](r, "OrderShippingAddressChanged")
+    Register[OrderCustomerReassignedEvent](r, "OrderCustomerReassigned")
+    Register[OrderStatusChangedEvent](r, "OrderStatusChanged")
+    Register[CustomerFirstOrderEvent](r, "CustomerFirstOrder")
+    Register[CustomerMergedEvent](r, "CustomerMerged")
+    Register[OrderCancellationAnomalyDetectedEvent](r, "OrderCancellationAnomalyDetected")
+    Register[PipelineHeartbeatEvent](r, "PipelineHeartbeat")
+    return r
+}
+
+// legacyFiller is implemented by pointers to events embedding
+// BaseDomainEvent.
+type legacyFiller interface {
+    fillLegacyFields(data []byte, eventType string) error
+}
+
+// Register associates eventType with the event type T.
+func Register[T DomainEvent](r *Registry, eventType string) {
+    r.decoders[eventType] = func(data []byte) (DomainEvent, error) {
+        var event T
+        if err := json.Unmarshal(data, &event); err != nil {
+            return nil, err
+        }
+        if filler, ok := any(&event).(legacyFiller); ok {
+            if err := filler.fillLegacyFields(data, eventType); err != nil {
+                return nil, err
+            }
+        }
+        return event, nil
+    }
+}
+
+// Knows reports whether an event type is registered.
+func (r *Registry) Knows(eventType string) bool {
+    _, ok := r.decoders[eventType]
+    return ok
+}
+
+// Unmarshal decodes data as the event registered for eventType, accepting
+// legacy envelope field names, gzip-compressed payloads and CloudEvents
+// envelopes. An envelope's type takes precedence over eventType, which may
+// be empty for one. Types not registered fail with an
+// *UnknownEventTypeError. Events missing their type, aggregate id or
+// timestamp are rejected with an error wrapping ErrInvalidEvent.
+func (r *Registry) Unmarshal(eventType string, data []byte) (DomainEvent, error) {
+    data, err := Decompress(data)
+    if err != nil {
+        // A corrupt payload fails the same way on every attempt
+        return nil, fmt.Errorf("%w: %s event: %v", ErrInvalidEvent, eventType, err)
+    }
+    
+    if envelopeType, payload, ok, err := UnwrapCloudEvent(data); err != nil {
+        return nil, err
+    } else if ok {
+        eventType, data = envelopeType, payload
+    }
+    
+    decode, ok := r.decoders[eventType]
+    if !ok {
+        return nil, &UnknownEventTypeError{EventType: eventType}
+    }
+    
+    event, err := decode(data)
+    if err != nil {
+        return nil, fmt.Errorf("failed to unmarshal %s event: %w", eventType, err)
+    }
+    
+    if err := Validate(event); err != nil {
+        return nil, err
+    }
+    
+    return event, nil
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+// Types the registry has no decoder for fail with an
+// *UnknownEventTypeError naming them, distinct from known events that are
+// invalid.
+func TestRegistry_unknownEventType(t *testing.T) {
+    registry := DefaultRegistry()
+    if !registry.Knows("OrderCreated") || registry.Knows("OrderRenamed") || registry.Knows("") {
+        t.Errorf("Knows = %t, %t, %t, want only OrderCreated known", registry.Knows("OrderCreated"), registry.Knows("OrderRenamed"), registry.Knows(""))
+    }
+    
+    _, err := registry.Unmarshal("OrderRenamed", []byte(`{"event_type":"OrderRenamed","aggregate_id":"order-1","occurred_at":"2024-03-15T12:00:00Z"}`))
+    var unknown *UnknownEventTypeError
+    if !errors.As(err, &unknown) || unknown.EventType != "OrderRenamed" {
+        t.Fatalf("Unmarshal() = %v, want an *UnknownEventTypeError for OrderRenamed", err)
+    }
+    if !errors.Is(err, ErrUnknownEventType) || errors.Is(err, ErrInvalidEvent) {
+        t.Errorf("Unmarshal() = %v, want it to match ErrUnknownEventType only", err)
+    }
+    
+    _, err = registry.Unmarshal("OrderCreated", []byte(`{"event_type":"OrderCreated"}`))
+    if !errors.Is(err, ErrInvalidEvent) || errors.Is(err, ErrUnknownEventType) {
+        t.Errorf("Unmarshal() of an invalid known event = %v, want ErrInvalidEvent only", err)
+    }
+}
@@ -0,0 +1,47 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrEventTooLarge is matched by the errors returned for events whose
+// serialized payload is over a size limit of the store they were written
+// to. Nothing is stored for such an event.
+var ErrEventTooLarge = errors.New("event too large")
+
+// EventTooLargeError reports an event over a size limit.
+type EventTooLargeError struct {
+    EventType   string
+    AggregateID string
+    // Size and Limit are in bytes, as the store would have written them
+    Size  int
+    Limit int
+    // Setting names the configuration setting Limit comes from
+    Setting string
+}
+
+func (e *EventTooLargeError) Error() string {
+    return fmt.Sprintf("%v: %s event for aggregate %s is %d bytes, over the limit of %d bytes (%s)",
+        ErrEventTooLarge, e.EventType, e.AggregateID, e.Size, e.Limit, e.Setting)
+}
+
+// Is makes errors.Is match ErrEventTooLarge.
+func (e *EventTooLargeError) Is(target error) bool {
+    return target == ErrEventTooLarge
+}
+
+// CheckSize returns an *EventTooLargeError when payload, the serialized
+// event, is over limit bytes. A limit of zero or less disables the check.
+func CheckSize(event DomainEvent, payload []byte, limit int, setting string) error {
+    if limit <= 0 || len(payload) <= limit {
+        return nil
+    }
+    return &EventTooLargeError{
+        EventType:   event.Type(),
+        AggregateID: event.AggregateID(),
+        Size:        len(payload),
+        Limit:       limit,
+        Setting:     setting,
+    }
+}
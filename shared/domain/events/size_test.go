@@ -0,0 +1,57 @@
+package events
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+func TestCheckSize(t *testing.T) {
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    event := NewOrderCreatedEvent(order)
+    
+    tests := []struct {
+        name    string
+        size    int
+        limit   int
+        wantErr bool
+    }{
+        {name: "under the limit", size: 99, limit: 100},
+        {name: "at the limit", size: 100, limit: 100},
+        {name: "over the limit", size: 101, limit: 100, wantErr: true},
+        {name: "no limit", size: 101},
+        {name: "negative limit", size: 101, limit: -1},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := CheckSize(event, make([]byte, tt.size), tt.limit, "MAX_BYTES")
+            if !tt.wantErr {
+                if err != nil {
+                    t.Errorf("CheckSize() = %v, want nil", err)
+                }
+                return
+            }
+            
+            var tooLarge *EventTooLargeError
+            if !errors.As(err, &tooLarge) || !errors.Is(err, ErrEventTooLarge) {
+                t.Fatalf("CheckSize() = %v, want an *EventTooLargeError", err)
+            }
+            want := EventTooLargeError{EventType: "OrderCreated", AggregateID: string(order.ID), Size: tt.size, Limit: tt.limit, Setting: "MAX_BYTES"}
+            if *tooLarge != want {
+                t.Errorf("error = %+v, want %+v", *tooLarge, want)
+            }
+            for _, mention := range []string{"OrderCreated", string(order.ID), "101 bytes", "100 bytes", "MAX_BYTES"} {
+                if !strings.Contains(err.Error(), mention) {
+                    t.Errorf("error %q does not mention %q", err, mention)
+                }
+            }
+        })
+    }
+}
@@ -51,6 +51,32 @@ func (a Address) String() string {
     return strings.Join([]string{a.Street, a.City, a.State, a.Zip, a.Country}, ", ")
 }
 
+// Equals reports whether a and other are the same address written
+// differently: fields compare case-insensitively with surrounding and
+// repeated whitespace ignored, and zips ignore spaces and hyphens too, so
+// "SW1A 1AA" equals "sw1a1aa".
+func (a Address) Equals(other Address) bool {
+    return a.normalized() == other.normalized()
+}
+
+func (a Address) normalized() Address {
+    return Address{
+        Street:  normalizeAddressField(a.Street),
+        City:    normalizeAddressField(a.City),
+        State:   normalizeAddressField(a.State),
+        Zip:     normalizeZip(a.Zip),
+        Country: normalizeAddressField(a.Country),
+    }
+}
+
+func normalizeAddressField(value string) string {
+    return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
+
+func normalizeZip(zip string) string {
+    return strings.ToLower(strings.ReplaceAll(strings.Join(strings.Fields(zip), ""), "-", ""))
+}
+
 func (a Address) IsEmpty() bool {
     return a.Street == "" && a.City == "" && a.State == "" && a.Zip == "" && a.Country == ""
 }
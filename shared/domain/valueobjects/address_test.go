@@ -0,0 +1,33 @@
+package valueobjects
+
+import "testing"
+
+func TestAddress_Equals(t *testing.T) {
+    springfield := NewAddress("1 Main St", "Springfield", "IL", "62701", "US")
+    tests := []struct {
+        name string
+        a, b Address
+        want bool
+    }{
+        {name: "identical", a: springfield, b: springfield, want: true},
+        {name: "case", a: springfield, b: NewAddress("1 MAIN ST", "springfield", "il", "62701", "us"), want: true},
+        {name: "whitespace", a: springfield, b: NewAddress("  1  Main\tSt ", "Springfield ", " IL", "62701", "US"), want: true},
+        {name: "zip punctuation", a: NewAddress("10 Downing St", "London", "", "SW1A 2AA", "GB"), b: NewAddress("10 Downing St", "London", "", "sw1a2aa", "GB"), want: true},
+        {name: "zip hyphen", a: NewAddress("1 Main St", "Springfield", "IL", "62701-1234", "US"), b: NewAddress("1 Main St", "Springfield", "IL", "627011234", "US"), want: true},
+        {name: "other street", a: springfield, b: NewAddress("2 Main St", "Springfield", "IL", "62701", "US")},
+        {name: "words run together", a: springfield, b: NewAddress("1 MainSt", "Springfield", "IL", "62701", "US")},
+        {name: "other zip", a: springfield, b: NewAddress("1 Main St", "Springfield", "IL", "62702", "US")},
+        {name: "other country", a: springfield, b: NewAddress("1 Main St", "Springfield", "IL", "62701", "CA")},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.a.Equals(tt.b); got != tt.want {
+                t.Errorf("%v Equals(%v) = %v, want %v", tt.a, tt.b, got, tt.want)
+            }
+            if got := tt.b.Equals(tt.a); got != tt.want {
+                t.Errorf("%v Equals(%v) = %v, want %v", tt.b, tt.a, got, tt.want)
+            }
+        })
+    }
+}
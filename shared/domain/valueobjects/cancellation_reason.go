@@ -0,0 +1,55 @@
+package valueobjects
+
+import "errors"
+
+// CancellationReason is why an order was cancelled. Free-text details go
+// alongside it.
+type CancellationReason string
+
+const (
+    CancellationReasonCustomerRequest CancellationReason = "customer_request"
+    CancellationReasonPaymentFailed   CancellationReason = "payment_failed"
+    CancellationReasonFraud           CancellationReason = "fraud"
+    CancellationReasonInventory       CancellationReason = "inventory"
+    CancellationReasonExpired         CancellationReason = "expired"
+    // CancellationReasonOther is also the reason of orders cancelled before
+    // reasons were recorded, whose free text becomes the details
+    CancellationReasonOther           CancellationReason = "other"
+)
+
+// CancellationReasons lists every reason, in the order they are documented.
+var CancellationReasons = []CancellationReason{
+    CancellationReasonCustomerRequest,
+    CancellationReasonPaymentFailed,
+    CancellationReasonFraud,
+    CancellationReasonInventory,
+    CancellationReasonExpired,
+    CancellationReasonOther,
+}
+
+// ErrInvalidCancellationReason is returned for reasons not in
+// CancellationReasons.
+var ErrInvalidCancellationReason = errors.New("reason must be one of customer_request, payment_failed, fraud, inventory, expired or other")
+
+func (r CancellationReason) String() string {
+    return string(r)
+}
+
+func (r CancellationReason) IsValid() bool {
+    for _, reason := range CancellationReasons {
+        if r == reason {
+            return true
+        }
+    }
+    return false
+}
+
+// ParseCancellationReason returns ErrInvalidCancellationReason for an empty
+// or unknown reason.
+func ParseCancellationReason(reason string) (CancellationReason, error) {
+    cancellationReason := CancellationReason(reason)
+    if !cancellationReason.IsValid() {
+        return "", ErrInvalidCancellationReason
+    }
+    return cancellationReason, nil
+}
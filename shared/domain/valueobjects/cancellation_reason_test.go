@@ -0,0 +1,33 @@
+package valueobjects
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCancellationReason(t *testing.T) {
+    tests := []struct {
+        reason  string
+        want    CancellationReason
+        wantErr error
+    }{
+        {reason: "customer_request", want: CancellationReasonCustomerRequest},
+        {reason: "payment_failed", want: CancellationReasonPaymentFailed},
+        {reason: "fraud", want: CancellationReasonFraud},
+        {reason: "inventory", want: CancellationReasonInventory},
+        {reason: "expired", want: CancellationReasonExpired},
+        {reason: "other", want: CancellationReasonOther},
+        {reason: "", wantErr: ErrInvalidCancellationReason},
+        {reason: "Fraud", wantErr: ErrInvalidCancellationReason},
+        {reason: "customer changed their mind", wantErr: ErrInvalidCancellationReason},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.reason, func(t *testing.T) {
+            got, err := ParseCancellationReason(tt.reason)
+            if !errors.Is(err, tt.wantErr) || got != tt.want {
+                t.Errorf("ParseCancellationReason(%q) = %q, %v, want %q, %v", tt.reason, got, err, tt.want, tt.wantErr)
+            }
+        })
+    }
+}
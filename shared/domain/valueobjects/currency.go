@@ -0,0 +1,151 @@
+package valueobjects
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrAmountPrecision is wrapped by the errors returned for decimal amounts
+// with more places than their currency has.
+var ErrAmountPrecision = errors.New("amount has more decimal places than the currency allows")
+
+// Currency describes an ISO 4217 currency's minor unit.
+type Currency struct {
+    Code string
+    // Exponent is the number of decimal places in the major unit, so an
+    // amount of 1 minor unit is 10^-Exponent of the major unit
+    Exponent int
+}
+
+// DefaultCurrency prices orders before they have items, and the amounts
+// stored before orders kept their currency, which were all in US dollars.
+const DefaultCurrency = "USD"
+
+// defaultExponent applies to unknown currencies.
+const defaultExponent = 2
+
+// currencies lists the known currencies by code.
+var currencies = map[string]Currency{
+    // Two-decimal currencies
+    "AUD": {Code: "AUD", Exponent: 2},
+    "BRL": {Code: "BRL", Exponent: 2},
+    "CAD": {Code: "CAD", Exponent: 2},
+    "CHF": {Code: "CHF", Exponent: 2},
+    "CNY": {Code: "CNY", Exponent: 2},
+    "DKK": {Code: "DKK", Exponent: 2},
+    "EUR": {Code: "EUR", Exponent: 2},
+    "GBP": {Code: "GBP", Exponent: 2},
+    "HKD": {Code: "HKD", Exponent: 2},
+    "INR": {Code: "INR", Exponent: 2},
+    "MXN": {Code: "MXN", Exponent: 2},
+    "NOK": {Code: "NOK", Exponent: 2},
+    "NZD": {Code: "NZD", Exponent: 2},
+    "SEK": {Code: "SEK", Exponent: 2},
+    "SGD": {Code: "SGD", Exponent: 2},
+    "USD": {Code: "USD", Exponent: 2},
+    "ZAR": {Code: "ZAR", Exponent: 2},
+    // Zero-decimal currencies
+    "BIF": {Code: "BIF", Exponent: 0},
+    "CLP": {Code: "CLP", Exponent: 0},
+    "DJF": {Code: "DJF", Exponent: 0},
+    "GNF": {Code: "GNF", Exponent: 0},
+    "ISK": {Code: "ISK", Exponent: 0},
+    "JPY": {Code: "JPY", Exponent: 0},
+    "KMF": {Code: "KMF", Exponent: 0},
+    "KRW": {Code: "KRW", Exponent: 0},
+    "PYG": {Code: "PYG", Exponent: 0},
+    "RWF": {Code: "RWF", Exponent: 0},
+    "UGX": {Code: "UGX", Exponent: 0},
+    "UYI": {Code: "UYI", Exponent: 0},
+    "VND": {Code: "VND", Exponent: 0},
+    "VUV": {Code: "VUV", Exponent: 0},
+    "XAF": {Code: "XAF", Exponent: 0},
+    "XOF": {Code: "XOF", Exponent: 0},
+    "XPF": {Code: "XPF", Exponent: 0},
+    // Three-decimal currencies
+    "BHD": {Code: "BHD", Exponent: 3},
+    "IQD": {Code: "IQD", Exponent: 3},
+    "JOD": {Code: "JOD", Exponent: 3},
+    "KWD": {Code: "KWD", Exponent: 3},
+    "LYD": {Code: "LYD", Exponent: 3},
+    "OMR": {Code: "OMR", Exponent: 3},
+    "TND": {Code: "TND", Exponent: 3},
+}
+
+// LookupCurrency returns the metadata for code. Unknown currencies are
+// reported with ok false and the two-decimal exponent most currencies use.
+func LookupCurrency(code string) (currency Currency, ok bool) {
+    code = strings.ToUpper(code)
+    if known, found := currencies[code]; found {
+        return known, true
+    }
+    return Currency{Code: code, Exponent: defaultExponent}, false
+}
+
+// CurrencyExponent returns the number of decimal places in currency's major
+// unit: 2 for USD, 0 for JPY, 3 for KWD, and 2 for unknown currencies.
+func CurrencyExponent(currency string) int {
+    metadata, _ := LookupCurrency(currency)
+    return metadata.Exponent
+}
+
+// ParseAmount converts a decimal string in currency's major unit, such as
+// "19.99", to minor units. It rejects more decimal places than the currency
+// has, so "19.999" is not a USD amount and "1.5" is not a JPY one.
+func ParseAmount(s, currency string) (int64, error) {
+    exponent := CurrencyExponent(currency)
+    
+    digits := s
+    negative := strings.HasPrefix(digits, "-")
+    if negative {
+        digits = digits[1:]
+    }
+    whole, fraction, hasPoint := strings.Cut(digits, ".")
+    if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+        return 0, fmt.Errorf("invalid amount %q: want a decimal such as 19.99", s)
+    }
+    if len(fraction) > exponent {
+        return 0, fmt.Errorf("%w: %q has %d, %s has %d", ErrAmountPrecision, s, len(fraction), currency, exponent)
+    }
+    
+    var amount int64
+    for _, digit := range whole + fraction + strings.Repeat("0", exponent-len(fraction)) {
+        if amount > (math.MaxInt64-int64(digit-'0'))/10 {
+            return 0, fmt.Errorf("invalid amount %q: out of range", s)
+        }
+        amount = amount*10 + int64(digit-'0')
+    }
+    if negative {
+        amount = -amount
+    }
+    return amount, nil
+}
+
+// FormatAmount renders amount, in minor units, as a decimal string in
+// currency's major unit: 1999 USD is "19.99" and 1999 JPY is "1999".
+func FormatAmount(amount int64, currency string) string {
+    exponent := CurrencyExponent(currency)
+    
+    sign := ""
+    magnitude := uint64(amount)
+    if amount < 0 {
+        sign = "-"
+        magnitude = uint64(-(amount + 1)) + 1
+    }
+    digits := fmt.Sprintf("%0*d", exponent+1, magnitude)
+    if exponent == 0 {
+        return sign + digits
+    }
+    return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+func isDigits(s string) bool {
+    for _, r := range s {
+        if r < '0' || r > '9' {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,142 @@
+package valueobjects
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLookupCurrency(t *testing.T) {
+    tests := []struct {
+        code         string
+        wantExponent int
+        wantKnown    bool
+    }{
+        {code: "USD", wantExponent: 2, wantKnown: true},
+        {code: "JPY", wantExponent: 0, wantKnown: true},
+        {code: "KWD", wantExponent: 3, wantKnown: true},
+        {code: "jpy", wantExponent: 0, wantKnown: true},
+        {code: "XYZ", wantExponent: 2},
+        {code: "", wantExponent: 2},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.code, func(t *testing.T) {
+            currency, ok := LookupCurrency(tt.code)
+            if currency.Exponent != tt.wantExponent || ok != tt.wantKnown {
+                t.Errorf("LookupCurrency(%q) = exponent %d, %t, want %d, %t", tt.code, currency.Exponent, ok, tt.wantExponent, tt.wantKnown)
+            }
+            if got := CurrencyExponent(tt.code); got != tt.wantExponent {
+                t.Errorf("CurrencyExponent(%q) = %d, want %d", tt.code, got, tt.wantExponent)
+            }
+        })
+    }
+}
+
+func TestNewMoneyFromDecimal(t *testing.T) {
+    tests := []struct {
+        name     string
+        amount   string
+        currency string
+        want     int64
+        wantErr  error
+        wantAny  bool
+    }{
+        {name: "USD", amount: "19.99", currency: "USD", want: 1999},
+        {name: "USD whole", amount: "19", currency: "USD", want: 1900},
+        {name: "USD one place", amount: "19.5", currency: "USD", want: 1950},
+        {name: "USD negative", amount: "-0.05", currency: "USD", want: -5},
+        {name: "USD sub-cent", amount: "19.999", currency: "USD", wantErr: ErrAmountPrecision},
+        {name: "JPY", amount: "1999", currency: "JPY", want: 1999},
+        {name: "JPY sub-yen", amount: "1.5", currency: "JPY", wantErr: ErrAmountPrecision},
+        {name: "JPY zero places", amount: "1999.0", currency: "JPY", wantErr: ErrAmountPrecision},
+        {name: "KWD", amount: "1.5", currency: "KWD", want: 1500},
+        {name: "KWD three places", amount: "1.234", currency: "KWD", want: 1234},
+        {name: "KWD four places", amount: "1.2345", currency: "KWD", wantErr: ErrAmountPrecision},
+        {name: "unknown currency", amount: "19.99", currency: "XYZ", want: 1999},
+        {name: "unknown sub-unit", amount: "19.999", currency: "XYZ", wantErr: ErrAmountPrecision},
+        {name: "not a number", amount: "abc", currency: "USD", wantAny: true},
+        {name: "trailing point", amount: "19.", currency: "USD", wantAny: true},
+        {name: "out of range", amount: "99999999999999999999", currency: "USD", wantAny: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := NewMoneyFromDecimal(tt.amount, tt.currency)
+            switch {
+            case tt.wantAny:
+                if err == nil || errors.Is(err, ErrAmountPrecision) {
+                    t.Errorf("NewMoneyFromDecimal(%q, %s) = %v, want an invalid amount error", tt.amount, tt.currency, err)
+                }
+            case tt.wantErr != nil:
+                if !errors.Is(err, tt.wantErr) {
+                    t.Errorf("NewMoneyFromDecimal(%q, %s) = %v, want %v", tt.amount, tt.currency, err, tt.wantErr)
+                }
+            case err != nil:
+                t.Errorf("NewMoneyFromDecimal(%q, %s) = %v", tt.amount, tt.currency, err)
+            case got != NewMoney(tt.want, tt.currency):
+                t.Errorf("NewMoneyFromDecimal(%q, %s) = %v, want %d minor units", tt.amount, tt.currency, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestMoney_String(t *testing.T) {
+    tests := []struct {
+        money Money
+        want  string
+    }{
+        {money: NewMoney(1999, "USD"), want: "19.99 USD"},
+        {money: NewMoney(5, "USD"), want: "0.05 USD"},
+        {money: NewMoney(-5, "USD"), want: "-0.05 USD"},
+        {money: NewMoney(1999, "JPY"), want: "1999 JPY"},
+        {money: NewMoney(1500, "KWD"), want: "1.500 KWD"},
+        {money: NewMoney(7, "KWD"), want: "0.007 KWD"},
+        {money: NewMoney(1999, "XYZ"), want: "19.99 XYZ"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.want, func(t *testing.T) {
+            if got := tt.money.String(); got != tt.want {
+                t.Errorf("String() = %q, want %q", got, tt.want)
+            }
+            // Formatting and parsing agree
+            parsed, err := NewMoneyFromDecimal(tt.money.Display(), tt.money.Currency)
+            if err != nil || parsed != tt.money {
+                t.Errorf("NewMoneyFromDecimal(%q) = %v, %v, want %v", tt.money.Display(), parsed, err, tt.money)
+            }
+        })
+    }
+}
+
+func TestFormatAmount(t *testing.T) {
+    tests := []struct {
+        amount   int64
+        currency string
+        want     string
+    }{
+        {amount: 1999, currency: "USD", want: "19.99"},
+        {amount: 5, currency: "USD", want: "0.05"},
+        {amount: -5, currency: "USD", want: "-0.05"},
+        {amount: 0, currency: "USD", want: "0.00"},
+        {amount: 1999, currency: "JPY", want: "1999"},
+        {amount: 1234, currency: "KWD", want: "1.234"},
+        {amount: 1999, currency: "XYZ", want: "19.99"},
+        {amount: math.MinInt64, currency: "USD", want: "-92233720368547758.08"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.want+" "+tt.currency, func(t *testing.T) {
+            if got := FormatAmount(tt.amount, tt.currency); got != tt.want {
+                t.Errorf("FormatAmount(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+            }
+            if tt.amount == math.MinInt64 {
+                return
+            }
+            // Every formatted amount parses back
+            if parsed, err := ParseAmount(tt.want, tt.currency); err != nil || parsed != tt.amount {
+                t.Errorf("ParseAmount(%q, %s) = %d, %v, want %d", tt.want, tt.currency, parsed, err, tt.amount)
+            }
+        })
+    }
+}
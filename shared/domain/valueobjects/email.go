@@ -0,0 +1,44 @@
+package valueobjects
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// Email is an email address, such as the contact email of a guest
+// checkout. It is kept in lower case, so addresses differing only in case
+// are the same Email.
+type Email string
+
+// MaxEmailLength is the longest address SMTP delivers to.
+const MaxEmailLength = 254
+
+// ErrInvalidEmail is returned for strings that are not a single plain
+// email address.
+var ErrInvalidEmail = errors.New("email must be a single address such as name@example.com")
+
+// ParseEmail returns raw, trimmed and in lower case, as an Email. Display
+// names such as "Ann <ann@example.com>" are refused; only the address is
+// accepted.
+func ParseEmail(raw string) (Email, error) {
+    raw = strings.TrimSpace(raw)
+    if raw == "" || len(raw) > MaxEmailLength {
+        return "", ErrInvalidEmail
+    }
+    address, err := mail.ParseAddress(raw)
+    if err != nil || address.Name != "" || address.Address != raw {
+        return "", ErrInvalidEmail
+    }
+    // mail accepts addresses without a dot in the domain, as local hosts
+    // have; orders need one mail can be delivered to
+    at := strings.LastIndex(raw, "@")
+    if !strings.Contains(raw[at+1:], ".") {
+        return "", ErrInvalidEmail
+    }
+    return Email(strings.ToLower(raw)), nil
+}
+
+func (e Email) String() string {
+    return string(e)
+}
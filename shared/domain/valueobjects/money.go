@@ -17,6 +17,17 @@ func NewMoney(amount int64, currency string) Money {
     }
 }
 
+// NewMoneyFromDecimal creates Money from an amount in currency's major unit,
+// such as "19.99" USD or "1999" JPY. Amounts with more decimal places than
+// the currency has are rejected with ErrAmountPrecision rather than rounded.
+func NewMoneyFromDecimal(amount, currency string) (Money, error) {
+    minor, err := ParseAmount(amount, currency)
+    if err != nil {
+        return Money{}, err
+    }
+    return NewMoney(minor, currency), nil
+}
+
 func (m Money) Add(other Money) (Money, error) {
     if m.Currency != other.Currency {
         return Money{}, errors.New("cannot add different currencies")
@@ -62,8 +73,10 @@ func (m Money) IsNegative() bool {
     return m.Amount < 0
 }
 
+// String formats the amount in the currency's major unit, as "19.99 USD",
+// "1999 JPY" or "1.500 KWD".
 func (m Money) String() string {
-    return fmt.Sprintf("%.2f %s", float64(m.Amount)/100, m.Currency)
+    return fmt.Sprintf("%s %s", m.Display(), m.Currency)
 }
 
 func (m Money) Validate() error {
@@ -0,0 +1,76 @@
+package valueobjects
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// moneyDisplay adds a "display" field to every marshalled Money.
+var moneyDisplay atomic.Bool
+
+// SetMoneyDisplay makes Money marshal with a "display" field holding the
+// amount as a decimal string in the currency's major unit, for consumers
+// that would otherwise read minor units as major ones:
+//
+//	{"amount": 1999, "currency": "USD", "display": "19.99"}
+//
+// It affects every encoding, including events and cached read models;
+// apijson can add the field to a single response instead.
+func SetMoneyDisplay(on bool) {
+    moneyDisplay.Store(on)
+}
+
+// Display returns the amount as a decimal string in the currency's major
+// unit.
+func (m Money) Display() string {
+    return FormatAmount(m.Amount, m.Currency)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+    type plain Money
+    if !moneyDisplay.Load() {
+        return json.Marshal(plain(m))
+    }
+    return json.Marshal(struct {
+        plain
+        Display string `json:"display"`
+    }{plain(m), m.Display()})
+}
+
+// UnmarshalJSON accepts the amount either in minor units, as 1999, or as a
+// decimal string in the currency's major unit, as "19.99". A display field
+// is ignored.
+func (m *Money) UnmarshalJSON(data []byte) error {
+    var raw struct {
+        Amount   json.RawMessage `json:"amount"`
+        Currency string          `json:"currency"`
+    }
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return err
+    }
+    
+    var amount int64
+    switch {
+    case len(raw.Amount) == 0 || bytes.Equal(raw.Amount, []byte("null")):
+    case raw.Amount[0] == '"':
+        var decimal string
+        if err := json.Unmarshal(raw.Amount, &decimal); err != nil {
+            return err
+        }
+        parsed, err := NewMoneyFromDecimal(decimal, raw.Currency)
+        if err != nil {
+            return err
+        }
+        amount = parsed.Amount
+    default:
+        if err := json.Unmarshal(raw.Amount, &amount); err != nil {
+            return fmt.Errorf("invalid amount %s: want minor units or a decimal string", raw.Amount)
+        }
+    }
+    
+    m.Amount = amount
+    m.Currency = raw.Currency
+    return nil
+}
@@ -0,0 +1,83 @@
+package valueobjects
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMoney_MarshalJSON(t *testing.T) {
+    tests := []struct {
+        name    string
+        money   Money
+        display bool
+        want    string
+    }{
+        {name: "minor units", money: NewMoney(1999, "USD"), want: `{"amount":1999,"currency":"USD"}`},
+        {name: "display", money: NewMoney(1999, "USD"), display: true, want: `{"amount":1999,"currency":"USD","display":"19.99"}`},
+        {name: "zero-decimal display", money: NewMoney(1999, "JPY"), display: true, want: `{"amount":1999,"currency":"JPY","display":"1999"}`},
+        {name: "negative display", money: NewMoney(-250, "EUR"), display: true, want: `{"amount":-250,"currency":"EUR","display":"-2.50"}`},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            SetMoneyDisplay(tt.display)
+            defer SetMoneyDisplay(false)
+            
+            data, err := json.Marshal(tt.money)
+            if err != nil {
+                t.Fatalf("Marshal() = %v", err)
+            }
+            if string(data) != tt.want {
+                t.Errorf("Marshal() = %s, want %s", data, tt.want)
+            }
+            
+            var decoded Money
+            if err := json.Unmarshal(data, &decoded); err != nil || decoded != tt.money {
+                t.Errorf("Unmarshal(%s) = %v, %v, want %v", data, decoded, err, tt.money)
+            }
+        })
+    }
+}
+
+func TestMoney_UnmarshalJSON(t *testing.T) {
+    tests := []struct {
+        name    string
+        data    string
+        want    Money
+        wantErr error
+        wantAny bool
+    }{
+        {name: "minor units", data: `{"amount": 1999, "currency": "USD"}`, want: NewMoney(1999, "USD")},
+        {name: "decimal string", data: `{"amount": "19.99", "currency": "USD"}`, want: NewMoney(1999, "USD")},
+        {name: "zero-decimal string", data: `{"amount": "1999", "currency": "JPY"}`, want: NewMoney(1999, "JPY")},
+        {name: "currency before amount", data: `{"currency": "KWD", "amount": "1.5"}`, want: NewMoney(1500, "KWD")},
+        {name: "display is ignored", data: `{"amount": 1999, "currency": "USD", "display": "1.00"}`, want: NewMoney(1999, "USD")},
+        {name: "no amount", data: `{"currency": "USD"}`, want: NewMoney(0, "USD")},
+        {name: "too many places", data: `{"amount": "19.999", "currency": "USD"}`, wantErr: ErrAmountPrecision},
+        {name: "fraction of a yen", data: `{"amount": "1.5", "currency": "JPY"}`, wantErr: ErrAmountPrecision},
+        {name: "fractional minor units", data: `{"amount": 19.99, "currency": "USD"}`, wantAny: true},
+        {name: "not a decimal", data: `{"amount": "lots", "currency": "USD"}`, wantAny: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var got Money
+            err := json.Unmarshal([]byte(tt.data), &got)
+            switch {
+            case tt.wantAny:
+                if err == nil || errors.Is(err, ErrAmountPrecision) {
+                    t.Errorf("Unmarshal(%s) = %v, want an invalid amount error", tt.data, err)
+                }
+            case tt.wantErr != nil:
+                if !errors.Is(err, tt.wantErr) {
+                    t.Errorf("Unmarshal(%s) = %v, want %v", tt.data, err, tt.wantErr)
+                }
+            case err != nil:
+                t.Errorf("Unmarshal(%s) = %v", tt.data, err)
+            case got != tt.want:
+                t.Errorf("Unmarshal(%s) = %v, want %v", tt.data, got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,49 @@
+package valueobjects
+
+import "errors"
+
+// OrderChannel is the sales channel an order was placed through.
+type OrderChannel string
+
+const (
+    OrderChannelWeb    OrderChannel = "web"
+    OrderChannelMobile OrderChannel = "mobile"
+    OrderChannelPhone  OrderChannel = "phone"
+    // OrderChannelUnknown marks orders placed before channels were
+    // recorded. New orders cannot be given it.
+    OrderChannelUnknown OrderChannel = "unknown"
+)
+
+// DefaultOrderChannel is the channel of orders that do not name one.
+const DefaultOrderChannel = OrderChannelWeb
+
+// ErrInvalidOrderChannel is returned for channels orders cannot be placed
+// through.
+var ErrInvalidOrderChannel = errors.New("channel must be one of web, mobile or phone")
+
+func (c OrderChannel) String() string {
+    return string(c)
+}
+
+// IsValid reports whether new orders may be placed through c.
+func (c OrderChannel) IsValid() bool {
+    switch c {
+    case OrderChannelWeb, OrderChannelMobile, OrderChannelPhone:
+        return true
+    default:
+        return false
+    }
+}
+
+// ParseOrderChannel returns DefaultOrderChannel for an empty channel and
+// ErrInvalidOrderChannel for one new orders cannot be placed through.
+func ParseOrderChannel(channel string) (OrderChannel, error) {
+    if channel == "" {
+        return DefaultOrderChannel, nil
+    }
+    orderChannel := OrderChannel(channel)
+    if !orderChannel.IsValid() {
+        return "", ErrInvalidOrderChannel
+    }
+    return orderChannel, nil
+}
@@ -0,0 +1,32 @@
+package valueobjects
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseOrderChannel(t *testing.T) {
+    tests := []struct {
+        channel string
+        want    OrderChannel
+        wantErr error
+    }{
+        {channel: "", want: DefaultOrderChannel},
+        {channel: "web", want: OrderChannelWeb},
+        {channel: "mobile", want: OrderChannelMobile},
+        {channel: "phone", want: OrderChannelPhone},
+        // Only orders from before channels were recorded are unknown
+        {channel: "unknown", wantErr: ErrInvalidOrderChannel},
+        {channel: "Web", wantErr: ErrInvalidOrderChannel},
+        {channel: "fax", wantErr: ErrInvalidOrderChannel},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.channel, func(t *testing.T) {
+            got, err := ParseOrderChannel(tt.channel)
+            if !errors.Is(err, tt.wantErr) || got != tt.want {
+                t.Errorf("ParseOrderChannel(%q) = %q, %v, want %q, %v", tt.channel, got, err, tt.want, tt.wantErr)
+            }
+        })
+    }
+}
@@ -7,6 +7,9 @@ type OrderStatus string
 const (
     OrderStatusDraft     OrderStatus = "draft"
     OrderStatusConfirmed OrderStatus = "confirmed"
+    // OrderStatusOnHold pauses a confirmed order, as for fraud review,
+    // until it is released back to confirmed or cancelled
+    OrderStatusOnHold    OrderStatus = "on_hold"
     OrderStatusShipped   OrderStatus = "shipped"
     OrderStatusDelivered OrderStatus = "delivered"
     OrderStatusCancelled OrderStatus = "cancelled"
@@ -18,7 +21,7 @@ func (s OrderStatus) String() string {
 
 func (s OrderStatus) IsValid() bool {
     switch s {
-    case OrderStatusDraft, OrderStatusConfirmed, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled:
+    case OrderStatusDraft, OrderStatusConfirmed, OrderStatusOnHold, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled:
         return true
     default:
         return false
@@ -30,10 +33,16 @@ func (s OrderStatus) CanTransitionTo(newStatus OrderStatus) bool {
     case OrderStatusDraft:
         return newStatus == OrderStatusConfirmed || newStatus == OrderStatusCancelled
     case OrderStatusConfirmed:
-        return newStatus == OrderStatusShipped || newStatus == OrderStatusCancelled
+        return newStatus == OrderStatusShipped || newStatus == OrderStatusOnHold || newStatus == OrderStatusCancelled
+    case OrderStatusOnHold:
+        return newStatus == OrderStatusConfirmed || newStatus == OrderStatusCancelled
     case OrderStatusShipped:
         return newStatus == OrderStatusDelivered
-    case OrderStatusDelivered, OrderStatusCancelled:
+    case OrderStatusCancelled:
+        // Reopening is only valid for orders cancelled in draft, which the
+        // Order aggregate checks
+        return newStatus == OrderStatusDraft
+    case OrderStatusDelivered:
         return false
     default:
         return false
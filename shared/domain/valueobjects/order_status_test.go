@@ -0,0 +1,29 @@
+package valueobjects
+
+import "testing"
+
+// Every pair of statuses is checked: only the transitions listed are
+// allowed.
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+    allowed := map[OrderStatus][]OrderStatus{
+        OrderStatusDraft:     {OrderStatusConfirmed, OrderStatusCancelled},
+        OrderStatusConfirmed: {OrderStatusOnHold, OrderStatusShipped, OrderStatusCancelled},
+        OrderStatusOnHold:    {OrderStatusConfirmed, OrderStatusCancelled},
+        OrderStatusShipped:   {OrderStatusDelivered},
+        OrderStatusDelivered: nil,
+        OrderStatusCancelled: {OrderStatusDraft},
+    }
+    statuses := []OrderStatus{OrderStatusDraft, OrderStatusConfirmed, OrderStatusOnHold, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled, "unknown"}
+    
+    for _, from := range statuses {
+        for _, to := range statuses {
+            want := false
+            for _, status := range allowed[from] {
+                want = want || status == to
+            }
+            if got := from.CanTransitionTo(to); got != want {
+                t.Errorf("%s.CanTransitionTo(%s) = %t, want %t", from, to, got, want)
+            }
+        }
+    }
+}
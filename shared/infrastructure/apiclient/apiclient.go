@@ -0,0 +1,302 @@
+// Package apiclient is the HTTP plumbing behind the services' Go clients,
+// orderclient and reportingclient. It resolves paths against a base URL,
+// sends the admin key, retries with backoff, and turns error responses into
+// *Error values carrying the server's body.
+//
+// Queries are retried on 429 and 5xx responses and on transport errors.
+// Commands carry an Idempotency-Key header, the same on every attempt, but
+// are only retried on 429 and 503: those are refused before the command
+// runs, while a 500 or a lost connection may follow a command that was
+// applied.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
+)
+
+// IdempotencyKeyHeader carries the key identifying a command across retries.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryPolicy bounds retries. The delay before attempt n+1 is
+// InitialBackoff doubled n-1 times, capped at MaxBackoff, unless the server
+// asked for a longer one with Retry-After. A Retry-After beyond MaxBackoff
+// ends the retries, returning the error at once.
+type RetryPolicy struct {
+    MaxAttempts    int
+    InitialBackoff time.Duration
+    MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy makes three attempts over about a second.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// NoRetry makes each request once.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+    backoff := p.InitialBackoff << (attempt - 1)
+    if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+        return p.MaxBackoff
+    }
+    return backoff
+}
+
+// Config configures a Client. BaseURL is required.
+type Config struct {
+    // BaseURL is the service's root, such as http://localhost:8080; paths
+    // are resolved under it
+    BaseURL string
+    // APIKey is sent in the X-Admin-Key header when set
+    APIKey string
+    // HTTPClient defaults to a client with a 30 second timeout
+    HTTPClient *http.Client
+    // Retry defaults to DefaultRetryPolicy when zero
+    Retry RetryPolicy
+}
+
+// Client sends requests to one service.
+type Client struct {
+    base   *url.URL
+    apiKey string
+    http   *http.Client
+    retry  RetryPolicy
+}
+
+// New validates cfg and returns a client.
+func New(cfg Config) (*Client, error) {
+    base, err := url.Parse(strings.TrimRight(cfg.BaseURL, "/"))
+    if err != nil {
+        return nil, fmt.Errorf("invalid base URL: %w", err)
+    }
+    if base.Scheme == "" || base.Host == "" {
+        return nil, fmt.Errorf("invalid base URL %q: scheme and host are required", cfg.BaseURL)
+    }
+    if cfg.HTTPClient == nil {
+        cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+    }
+    if cfg.Retry == (RetryPolicy{}) {
+        cfg.Retry = DefaultRetryPolicy
+    }
+    if cfg.Retry.MaxAttempts < 1 {
+        cfg.Retry.MaxAttempts = 1
+    }
+    
+    return &Client{base: base, apiKey: cfg.APIKey, http: cfg.HTTPClient, retry: cfg.Retry}, nil
+}
+
+// Request is one call to the service.
+type Request struct {
+    Method string
+    // Path is appended to the base URL as is, so values placed in it must
+    // be escaped with url.PathEscape
+    Path   string
+    Query  url.Values
+    // Body is encoded as JSON when set
+    Body   interface{}
+}
+
+func (r Request) isCommand() bool {
+    return r.Method != http.MethodGet && r.Method != http.MethodHead
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey sets the Idempotency-Key sent with the commands made
+// with ctx. Without one each command gets a random key, kept across the
+// client's retries but not across the caller's.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+    return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// Do sends req, retrying as the package describes, and decodes a successful
+// JSON response into out unless it is nil. Error responses are returned as
+// *Error.
+func (c *Client) Do(ctx context.Context, req Request, out interface{}) error {
+    var body []byte
+    if req.Body != nil {
+        encoded, err := json.Marshal(req.Body)
+        if err != nil {
+            return fmt.Errorf("failed to encode request body: %w", err)
+        }
+        body = encoded
+    }
+    
+    key := ""
+    if req.isCommand() {
+        key, _ = ctx.Value(idempotencyKey{}).(string)
+        if key == "" {
+            key = uuid.NewString()
+        }
+    }
+    
+    target := c.base.String() + req.Path
+    if len(req.Query) > 0 {
+        target += "?" + req.Query.Encode()
+    }
+    
+    for attempt := 1; ; attempt++ {
+        delay, err := c.attempt(ctx, req, target, body, key, out)
+        if err == nil || delay < 0 || attempt >= c.retry.MaxAttempts {
+            return err
+        }
+        if c.retry.MaxBackoff > 0 && delay > c.retry.MaxBackoff {
+            return err
+        }
+        if backoff := c.retry.backoff(attempt); backoff > delay {
+            delay = backoff
+        }
+        
+        timer := time.NewTimer(delay)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return err
+        case <-timer.C:
+        }
+    }
+}
+
+// attempt makes one request. On failure it returns the least delay before
+// retrying, or a negative one if the request must not be retried.
+func (c *Client) attempt(ctx context.Context, req Request, target string, body []byte, key string, out interface{}) (time.Duration, error) {
+    httpReq, err := http.NewRequestWithContext(ctx, req.Method, target, bytes.NewReader(body))
+    if err != nil {
+        return -1, err
+    }
+    httpReq.Header.Set("Accept", "application/json")
+    if body != nil {
+        httpReq.Header.Set("Content-Type", "application/json")
+    }
+    if c.apiKey != "" {
+        httpReq.Header.Set(httpmw.AdminKeyHeader, c.apiKey)
+    }
+    if key != "" {
+        httpReq.Header.Set(IdempotencyKeyHeader, key)
+    }
+    
+    resp, err := c.http.Do(httpReq)
+    if err != nil {
+        if ctx.Err() != nil || req.isCommand() {
+            return -1, err
+        }
+        return 0, err
+    }
+    defer resp.Body.Close()
+    
+    if resp.StatusCode >= 300 {
+        apiErr := newError(resp)
+        if !retryable(resp.StatusCode, req.isCommand()) {
+            return -1, apiErr
+        }
+        return apiErr.RetryAfter, apiErr
+    }
+    
+    if out == nil || req.Method == http.MethodHead {
+        io.Copy(io.Discard, resp.Body)
+        return -1, nil
+    }
+    if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+        return -1, fmt.Errorf("failed to decode %s %s response: %w", req.Method, req.Path, err)
+    }
+    return -1, nil
+}
+
+func retryable(status int, command bool) bool {
+    if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+        return true
+    }
+    return !command && status >= 500
+}
+
+// Error is a response with a status of 300 or more.
+type Error struct {
+    StatusCode int
+    // Code is the "error" field of a JSON error body, such as
+    // "invalid_pagination" or "internal_error"; empty for plain text bodies
+    Code       string
+    // Message is the "message" field of a JSON error body, or the whole
+    // body when it is plain text
+    Message    string
+    // Fields holds a JSON error body's fields, such as the "parameter" of
+    // a pagination error or the "request_id" of an internal error
+    Fields     map[string]interface{}
+    // Body is the raw response body
+    Body       []byte
+    RequestID  string
+    // RetryAfter is the delay the server asked for, zero if none
+    RetryAfter time.Duration
+}
+
+// maxErrorBody caps how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+func newError(resp *http.Response) *Error {
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+    apiErr := &Error{
+        StatusCode: resp.StatusCode,
+        Body:       body,
+        RequestID:  resp.Header.Get(httpmw.RequestIDHeader),
+        RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+    }
+    
+    if err := json.Unmarshal(body, &apiErr.Fields); err == nil && apiErr.Fields != nil {
+        apiErr.Code, _ = apiErr.Fields["error"].(string)
+        apiErr.Message, _ = apiErr.Fields["message"].(string)
+        return apiErr
+    }
+    apiErr.Fields = nil
+    apiErr.Message = strings.TrimSpace(string(body))
+    return apiErr
+}
+
+func (e *Error) Error() string {
+    message := e.Message
+    if message == "" {
+        message = e.Code
+    }
+    if message == "" {
+        return fmt.Sprintf("api error: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+    }
+    return fmt.Sprintf("api error: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), message)
+}
+
+// StatusCode returns err's status if it is or wraps an *Error, and zero
+// otherwise.
+func StatusCode(err error) int {
+    var apiErr *Error
+    if errors.As(err, &apiErr) {
+        return apiErr.StatusCode
+    }
+    return 0
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string) time.Duration {
+    if value == "" {
+        return 0
+    }
+    if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+        return time.Duration(seconds) * time.Second
+    }
+    if at, err := http.ParseTime(value); err == nil {
+        if delay := time.Until(at); delay > 0 {
+            return delay
+        }
+    }
+    return 0
+}
@@ -0,0 +1,282 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/httpmw"
+)
+
+// fastRetry retries without waiting long.
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+// attemptServer answers with statuses in turn, then 200 with an empty
+// object, and records the requests it received.
+type attemptServer struct {
+    mu       sync.Mutex
+    statuses []int
+    header   http.Header
+    requests []*http.Request
+}
+
+func (s *attemptServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.requests = append(s.requests, r)
+    if len(s.requests) <= len(s.statuses) {
+        for name, values := range s.header {
+            w.Header()[name] = values
+        }
+        w.WriteHeader(s.statuses[len(s.requests)-1])
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Write([]byte(`{"id":"order-1"}`))
+}
+
+func (s *attemptServer) keys() []string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var keys []string
+    for _, r := range s.requests {
+        keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+    }
+    return keys
+}
+
+func newTestClient(t *testing.T, handler http.Handler, cfg Config) *Client {
+    t.Helper()
+    server := httptest.NewServer(handler)
+    t.Cleanup(server.Close)
+    cfg.BaseURL = server.URL
+    client, err := New(cfg)
+    if err != nil {
+        t.Fatalf("New() = %v", err)
+    }
+    return client
+}
+
+// Queries are retried on 429 and 5xx; commands only on 429 and 503, since a
+// 500 may follow a command that was applied.
+func TestClient_Do_retries(t *testing.T) {
+    tests := []struct {
+        name         string
+        method       string
+        statuses     []int
+        wantAttempts int
+        wantStatus   int
+    }{
+        {name: "query after 500", method: http.MethodGet, statuses: []int{500}, wantAttempts: 2},
+        {name: "query after 429 and 502", method: http.MethodGet, statuses: []int{429, 502}, wantAttempts: 3},
+        {name: "query out of attempts", method: http.MethodGet, statuses: []int{500, 500, 500}, wantAttempts: 3, wantStatus: 500},
+        {name: "query not found", method: http.MethodGet, statuses: []int{404}, wantAttempts: 1, wantStatus: 404},
+        {name: "command after 503", method: http.MethodPost, statuses: []int{503}, wantAttempts: 2},
+        {name: "command after 429", method: http.MethodPost, statuses: []int{429}, wantAttempts: 2},
+        {name: "command after 500", method: http.MethodPost, statuses: []int{500}, wantAttempts: 1, wantStatus: 500},
+        {name: "command conflict", method: http.MethodPost, statuses: []int{409}, wantAttempts: 1, wantStatus: 409},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            server := &attemptServer{statuses: tt.statuses}
+            client := newTestClient(t, server, Config{Retry: fastRetry})
+            
+            var out struct {
+                ID string `json:"id"`
+            }
+            err := client.Do(context.Background(), Request{Method: tt.method, Path: "/orders"}, &out)
+            if got := StatusCode(err); got != tt.wantStatus {
+                t.Errorf("Do() = %v, want status %d", err, tt.wantStatus)
+            }
+            if tt.wantStatus == 0 && out.ID != "order-1" {
+                t.Errorf("decoded %+v, want order-1", out)
+            }
+            if got := len(server.keys()); got != tt.wantAttempts {
+                t.Errorf("made %d attempts, want %d", got, tt.wantAttempts)
+            }
+        })
+    }
+}
+
+// A command sends one Idempotency-Key on every attempt: the caller's when
+// set with WithIdempotencyKey, a random one otherwise. Queries send none.
+func TestClient_Do_idempotencyKey(t *testing.T) {
+    server := &attemptServer{statuses: []int{503, 503}}
+    client := newTestClient(t, server, Config{Retry: fastRetry})
+    
+    ctx := WithIdempotencyKey(context.Background(), "create-order-1")
+    if err := client.Do(ctx, Request{Method: http.MethodPost, Path: "/orders", Body: map[string]string{"customer_id": "customer-1"}}, nil); err != nil {
+        t.Fatalf("Do() = %v", err)
+    }
+    if got, want := server.keys(), []string{"create-order-1", "create-order-1", "create-order-1"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("keys = %v, want %v", got, want)
+    }
+    
+    server = &attemptServer{statuses: []int{503}}
+    client = newTestClient(t, server, Config{Retry: fastRetry})
+    if err := client.Do(context.Background(), Request{Method: http.MethodPost, Path: "/orders"}, nil); err != nil {
+        t.Fatalf("Do() = %v", err)
+    }
+    keys := server.keys()
+    if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+        t.Errorf("keys = %v, want one random key on both attempts", keys)
+    }
+    
+    server = &attemptServer{}
+    client = newTestClient(t, server, Config{Retry: fastRetry})
+    if err := client.Do(ctx, Request{Method: http.MethodGet, Path: "/orders/order-1"}, nil); err != nil {
+        t.Fatalf("Do() = %v", err)
+    }
+    if got := server.keys(); !reflect.DeepEqual(got, []string{""}) {
+        t.Errorf("query keys = %v, want none", got)
+    }
+}
+
+// The client waits as long as Retry-After asks, and gives up at once when
+// that is beyond MaxBackoff.
+func TestClient_Do_retryAfter(t *testing.T) {
+    server := &attemptServer{statuses: []int{429}, header: http.Header{"Retry-After": {"1"}}}
+    client := newTestClient(t, server, Config{Retry: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Second}})
+    started := time.Now()
+    if err := client.Do(context.Background(), Request{Method: http.MethodGet, Path: "/orders"}, nil); err != nil {
+        t.Fatalf("Do() = %v", err)
+    }
+    if elapsed := time.Since(started); elapsed < time.Second {
+        t.Errorf("retried after %s, want the second asked for", elapsed)
+    }
+    
+    server = &attemptServer{statuses: []int{429}, header: http.Header{"Retry-After": {"60"}}}
+    client = newTestClient(t, server, Config{Retry: fastRetry})
+    err := client.Do(context.Background(), Request{Method: http.MethodGet, Path: "/orders"}, nil)
+    var apiErr *Error
+    if !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Minute {
+        t.Fatalf("Do() = %v, want a 429 asking for a minute", err)
+    }
+    if got := len(server.keys()); got != 1 {
+        t.Errorf("made %d attempts, want 1", got)
+    }
+}
+
+// Error responses keep the server's code, message, fields and request ID,
+// and plain text bodies become the message.
+func TestClient_Do_errors(t *testing.T) {
+    tests := []struct {
+        name        string
+        contentType string
+        body        string
+        want        Error
+    }{
+        {
+            name:        "json",
+            contentType: "application/json",
+            body:        `{"error":"invalid_pagination","message":"limit must be between 1 and 1000","parameter":"limit"}`,
+            want: Error{
+                StatusCode: http.StatusBadRequest,
+                Code:       "invalid_pagination",
+                Message:    "limit must be between 1 and 1000",
+                Fields:     map[string]interface{}{"error": "invalid_pagination", "message": "limit must be between 1 and 1000", "parameter": "limit"},
+                RequestID:  "request-1",
+            },
+        },
+        {
+            name:        "plain text",
+            contentType: "text/plain",
+            body:        "Invalid request body\n",
+            want:        Error{StatusCode: http.StatusBadRequest, Message: "Invalid request body", RequestID: "request-1"},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Type", tt.contentType)
+                w.Header().Set(httpmw.RequestIDHeader, "request-1")
+                w.WriteHeader(http.StatusBadRequest)
+                w.Write([]byte(tt.body))
+            }), Config{Retry: NoRetry})
+            
+            err := client.Do(context.Background(), Request{Method: http.MethodGet, Path: "/events"}, nil)
+            var apiErr *Error
+            if !errors.As(err, &apiErr) {
+                t.Fatalf("Do() = %v, want an *Error", err)
+            }
+            if string(apiErr.Body) != tt.body {
+                t.Errorf("Body = %q, want %q", apiErr.Body, tt.body)
+            }
+            apiErr.Body = nil
+            if !reflect.DeepEqual(*apiErr, tt.want) {
+                t.Errorf("error = %+v, want %+v", *apiErr, tt.want)
+            }
+        })
+    }
+}
+
+// The client sends the API key, a JSON body and the query, under the base
+// URL's path.
+func TestClient_Do_request(t *testing.T) {
+    var got *http.Request
+    var body []byte
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        got = r
+        body, _ = io.ReadAll(r.Body)
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    defer server.Close()
+    client, err := New(Config{BaseURL: server.URL + "/api/v2/", APIKey: "secret", Retry: NoRetry})
+    if err != nil {
+        t.Fatalf("New() = %v", err)
+    }
+    
+    query := url.Values{"reason": {"fraud"}}
+    if err := client.Do(context.Background(), Request{Method: http.MethodPost, Path: "/orders/order-1/hold", Query: query, Body: map[string]string{"reason": "fraud"}}, nil); err != nil {
+        t.Fatalf("Do() = %v", err)
+    }
+    if got.URL.Path != "/api/v2/orders/order-1/hold" || got.URL.RawQuery != "reason=fraud" {
+        t.Errorf("request URL = %s, want /api/v2/orders/order-1/hold?reason=fraud", got.URL)
+    }
+    if key := got.Header.Get(httpmw.AdminKeyHeader); key != "secret" {
+        t.Errorf("%s = %q, want secret", httpmw.AdminKeyHeader, key)
+    }
+    if contentType := got.Header.Get("Content-Type"); contentType != "application/json" || string(body) != `{"reason":"fraud"}` {
+        t.Errorf("body = %s %s, want the JSON encoded body", contentType, body)
+    }
+}
+
+func TestNew_invalidBaseURL(t *testing.T) {
+    for _, baseURL := range []string{"", "localhost:8080", "/api", "http://%zz"} {
+        if _, err := New(Config{BaseURL: baseURL}); err == nil {
+            t.Errorf("New(%q) = nil error, want invalid base URL", baseURL)
+        }
+    }
+}
+
+func TestParseRetryAfter(t *testing.T) {
+    tests := []struct {
+        value string
+        want  time.Duration
+    }{
+        {value: "", want: 0},
+        {value: "5", want: 5 * time.Second},
+        {value: "0", want: 0},
+        {value: "-1", want: 0},
+        {value: "soon", want: 0},
+        {value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), want: 0},
+    }
+    
+    for _, tt := range tests {
+        if got := parseRetryAfter(tt.value); got != tt.want {
+            t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+        }
+    }
+    if got := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); got <= 50*time.Second || got > time.Minute {
+        t.Errorf("parseRetryAfter(a minute from now) = %s", got)
+    }
+}
@@ -0,0 +1,169 @@
+// Package apijson encodes API responses. Keys are snake_case by default;
+// clients migrating to camelCase can ask for it per request with ?case=camel
+// or an Accept header such as "application/json; case=camel". Likewise
+// ?money=display or "application/json; money=display" adds a decimal
+// "display" field to every money amount.
+package apijson
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Options selects the optional response encodings.
+type Options struct {
+    // CamelCase converts every object key to camelCase
+    CamelCase bool
+    // MoneyDisplay adds a "display" field to money amounts
+    MoneyDisplay bool
+}
+
+// OptionsFor returns the encodings the request asked for.
+func OptionsFor(r *http.Request) Options {
+    return Options{
+        CamelCase:    WantsCamelCase(r),
+        MoneyDisplay: WantsMoneyDisplay(r),
+    }
+}
+
+// WantsCamelCase reports whether the request asked for camelCase keys.
+func WantsCamelCase(r *http.Request) bool {
+    return requested(r, "case", "camel")
+}
+
+// WantsMoneyDisplay reports whether the request asked for money amounts
+// with a display field.
+func WantsMoneyDisplay(r *http.Request) bool {
+    return requested(r, "money", "display")
+}
+
+// requested reports whether the request set the option name to value, as a
+// query parameter or a JSON media type parameter in its Accept header.
+func requested(r *http.Request, name, value string) bool {
+    if r == nil {
+        return false
+    }
+    if r.URL.Query().Get(name) == value {
+        return true
+    }
+    
+    for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+        mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+        if err != nil {
+            continue
+        }
+        if (mediaType == "application/json" || mediaType == "*/*") && params[name] == value {
+            return true
+        }
+    }
+    return false
+}
+
+// Write encodes v as the JSON response body with the given status, with the
+// options the request asked for.
+func Write(w http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+    data, err := Marshal(v, OptionsFor(r))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return err
+    }
+    
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Add("Vary", "Accept")
+    w.WriteHeader(status)
+    _, err = w.Write(append(data, '\n'))
+    return err
+}
+
+// Marshal encodes v with opts. With CamelCase, keys without underscores,
+// such as map keys holding statuses, are unchanged.
+func Marshal(v interface{}, opts Options) ([]byte, error) {
+    data, err := json.Marshal(v)
+    if err != nil || opts == (Options{}) {
+        return data, err
+    }
+    
+    // Decode generically to rewrite; UseNumber keeps int64 amounts exact
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.UseNumber()
+    var generic interface{}
+    if err := decoder.Decode(&generic); err != nil {
+        return nil, err
+    }
+    
+    if opts.MoneyDisplay {
+        generic = displayMoney(generic)
+    }
+    if opts.CamelCase {
+        generic = camelKeys(generic)
+    }
+    return json.Marshal(generic)
+}
+
+// displayMoney adds a display field to every object shaped like an encoded
+// valueobjects.Money: an integer amount and a currency.
+func displayMoney(v interface{}) interface{} {
+    switch value := v.(type) {
+    case map[string]interface{}:
+        for key, field := range value {
+            value[key] = displayMoney(field)
+        }
+        amount, isNumber := value["amount"].(json.Number)
+        currency, isString := value["currency"].(string)
+        if _, shown := value["display"]; isNumber && isString && !shown {
+            if minor, err := amount.Int64(); err == nil {
+                value["display"] = valueobjects.FormatAmount(minor, currency)
+            }
+        }
+        return value
+    case []interface{}:
+        for i, element := range value {
+            value[i] = displayMoney(element)
+        }
+        return value
+    default:
+        return v
+    }
+}
+
+func camelKeys(v interface{}) interface{} {
+    switch value := v.(type) {
+    case map[string]interface{}:
+        renamed := make(map[string]interface{}, len(value))
+        for key, field := range value {
+            renamed[CamelCase(key)] = camelKeys(field)
+        }
+        return renamed
+    case []interface{}:
+        for i, element := range value {
+            value[i] = camelKeys(element)
+        }
+        return value
+    default:
+        return v
+    }
+}
+
+// CamelCase converts a snake_case key such as "status_changed_at" to
+// "statusChangedAt".
+func CamelCase(key string) string {
+    if !strings.Contains(key, "_") {
+        return key
+    }
+    
+    parts := strings.Split(key, "_")
+    var b strings.Builder
+    b.WriteString(parts[0])
+    for _, part := range parts[1:] {
+        if part == "" {
+            continue
+        }
+        b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+    }
+    return b.String()
+}
@@ -0,0 +1,151 @@
+package apijson
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+func TestCamelCase(t *testing.T) {
+    tests := map[string]string{
+        "status_changed_at":  "statusChangedAt",
+        "id":                 "id",
+        "on_hold":            "onHold",
+        "trailing_":          "trailing",
+        "double__underscore": "doubleUnderscore",
+        "alreadyCamel":       "alreadyCamel",
+    }
+    
+    for key, want := range tests {
+        if got := CamelCase(key); got != want {
+            t.Errorf("CamelCase(%q) = %q, want %q", key, got, want)
+        }
+    }
+}
+
+func TestOptionsFor(t *testing.T) {
+    tests := []struct {
+        name   string
+        target string
+        accept string
+        want   Options
+    }{
+        {name: "defaults", target: "/orders", accept: "application/json"},
+        {name: "camel case query", target: "/orders?case=camel", want: Options{CamelCase: true}},
+        {name: "camel case media type", target: "/orders", accept: "application/json; case=camel", want: Options{CamelCase: true}},
+        {name: "any media type", target: "/orders", accept: "text/html, */*; case=camel", want: Options{CamelCase: true}},
+        {name: "other media type", target: "/orders", accept: "text/plain; case=camel"},
+        {name: "unknown case", target: "/orders?case=kebab"},
+        {name: "money display", target: "/orders?money=display", want: Options{MoneyDisplay: true}},
+        {name: "both", target: "/orders?money=display", accept: "application/json; case=camel", want: Options{CamelCase: true, MoneyDisplay: true}},
+        {name: "malformed accept", target: "/orders", accept: "application/json; case"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+            if tt.accept != "" {
+                r.Header.Set("Accept", tt.accept)
+            }
+            if got := OptionsFor(r); got != tt.want {
+                t.Errorf("OptionsFor() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestWrite(t *testing.T) {
+    r := httptest.NewRequest(http.MethodGet, "/orders?case=camel", nil)
+    w := httptest.NewRecorder()
+    
+    if err := Write(w, r, http.StatusCreated, map[string]int64{"total_amount": 9007199254740993}); err != nil {
+        t.Fatalf("Write() = %v", err)
+    }
+    
+    if w.Code != http.StatusCreated {
+        t.Errorf("status = %d, want %d", w.Code, http.StatusCreated)
+    }
+    if got := w.Header().Get("Vary"); got != "Accept" {
+        t.Errorf("Vary = %q, want Accept", got)
+    }
+    // Amounts past float64 precision stay exact through the rewrite
+    if got, want := w.Body.String(), "{\"totalAmount\":9007199254740993}\n"; got != want {
+        t.Errorf("body = %q, want %q", got, want)
+    }
+}
+
+func TestMarshal_moneyDisplay(t *testing.T) {
+    response := map[string]interface{}{
+        "grand_total": valueobjects.NewMoney(1999, "USD"),
+        "items": []map[string]interface{}{
+            {"product_id": "product-1", "price": valueobjects.NewMoney(500, "JPY")},
+        },
+        // Objects that only look like money in part are left alone
+        "limits": map[string]interface{}{"amount": 3},
+    }
+    
+    data, err := Marshal(response, Options{MoneyDisplay: true, CamelCase: true})
+    if err != nil {
+        t.Fatalf("Marshal() = %v", err)
+    }
+    want := `{"grandTotal":{"amount":1999,"currency":"USD","display":"19.99"},"items":[{"price":{"amount":500,"currency":"JPY","display":"500"},"productId":"product-1"}],"limits":{"amount":3}}`
+    if string(data) != want {
+        t.Errorf("Marshal() = %s, want %s", data, want)
+    }
+}
+
+func TestTimestamp_MarshalJSON(t *testing.T) {
+    tests := []struct {
+        name string
+        time time.Time
+        want string
+    }{
+        {name: "UTC", time: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), want: `"2024-03-01T12:00:00.000Z"`},
+        {name: "other zone", time: time.Date(2024, 3, 1, 5, 0, 0, 0, time.FixedZone("UTC-7", -7*60*60)), want: `"2024-03-01T12:00:00.000Z"`},
+        {name: "truncated", time: time.Date(2024, 3, 1, 12, 0, 59, 999999999, time.UTC), want: `"2024-03-01T12:00:59.999Z"`},
+        {name: "zero", want: `"0001-01-01T00:00:00.000Z"`},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := json.Marshal(NewTimestamp(tt.time))
+            if err != nil {
+                t.Fatalf("Marshal() = %v", err)
+            }
+            if string(got) != tt.want {
+                t.Errorf("Marshal() = %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestTimestamp_UnmarshalJSON(t *testing.T) {
+    tests := []struct {
+        data    string
+        want    time.Time
+        wantErr bool
+    }{
+        {data: `"2024-03-01T12:00:00.123Z"`, want: time.Date(2024, 3, 1, 12, 0, 0, 123000000, time.UTC)},
+        {data: `"2024-03-01T12:00:00.123456789Z"`, want: time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)},
+        {data: `"2024-03-01T19:00:00+07:00"`, want: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+        {data: `null`},
+        {data: `"2024-03-01"`, wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.data, func(t *testing.T) {
+            var got Timestamp
+            err := json.Unmarshal([]byte(tt.data), &got)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Unmarshal() = %v, want error %t", err, tt.wantErr)
+            }
+            if !got.Equal(tt.want) {
+                t.Errorf("Unmarshal() = %v, want %v", got.Time, tt.want)
+            }
+        })
+    }
+}
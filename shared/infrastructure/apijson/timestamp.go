@@ -0,0 +1,57 @@
+package apijson
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// TimestampLayout is RFC 3339 with exactly three fractional digits. API
+// timestamps are always UTC, so the zone is written as Z.
+const TimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Timestamp is the time type used in API responses. It marshals in UTC as
+// TimestampLayout, truncated to milliseconds, and scans from and writes to
+// SQL timestamp columns like time.Time.
+type Timestamp struct {
+    time.Time
+}
+
+func NewTimestamp(t time.Time) Timestamp {
+    return Timestamp{Time: t}
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+    return []byte(`"` + t.UTC().Truncate(time.Millisecond).Format(TimestampLayout) + `"`), nil
+}
+
+// UnmarshalJSON accepts any RFC 3339 timestamp, so payloads written with
+// full precision still decode.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+    if string(data) == "null" {
+        return nil
+    }
+    
+    parsed, err := time.Parse(`"`+time.RFC3339Nano+`"`, string(data))
+    if err != nil {
+        return fmt.Errorf("invalid timestamp %s: %w", data, err)
+    }
+    t.Time = parsed
+    return nil
+}
+
+func (t *Timestamp) Scan(src interface{}) error {
+    switch value := src.(type) {
+    case time.Time:
+        t.Time = value
+    case nil:
+        t.Time = time.Time{}
+    default:
+        return fmt.Errorf("cannot scan %T into Timestamp", src)
+    }
+    return nil
+}
+
+func (t Timestamp) Value() (driver.Value, error) {
+    return t.Time, nil
+}
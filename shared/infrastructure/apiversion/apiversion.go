@@ -0,0 +1,219 @@
+// Package apiversion mounts one set of routes under several API versions,
+// /api/v1 and /api/v2, so breaking response changes ship under a new prefix
+// while the old one keeps its shapes. Unversioned requests under /api pick a
+// version by content negotiation, with an Accept header such as
+// "application/json; version=2", and get the latest version otherwise.
+//
+// Every response names its version in the X-API-Version header. Deprecated
+// versions also send Deprecation and, once a date is set, Sunset headers.
+package apiversion
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Version is an API major version.
+type Version int
+
+const (
+    V1 Version = 1
+    V2 Version = 2
+)
+
+// Header names the version that served the response.
+const Header = "X-API-Version"
+
+// String returns the version as it appears in paths, such as "v2".
+func (v Version) String() string {
+    return "v" + strconv.Itoa(int(v))
+}
+
+// Prefix returns the path prefix the version is mounted under.
+func (v Version) Prefix() string {
+    return "/api/" + v.String()
+}
+
+// Spec describes one mounted version.
+type Spec struct {
+    Version Version
+    // Deprecated versions send a Deprecation header and a Link to the
+    // latest version
+    Deprecated bool
+    // Sunset is when a deprecated version stops being served; zero omits
+    // the Sunset header
+    Sunset time.Time
+}
+
+// Registry mounts routes under each of its versions.
+type Registry struct {
+    specs  []Spec
+    latest Version
+}
+
+// NewRegistry serves the versions in specs. The highest one answers
+// unversioned requests that do not ask for a version.
+func NewRegistry(specs ...Spec) *Registry {
+    reg := &Registry{specs: specs}
+    for _, spec := range specs {
+        if spec.Version > reg.latest {
+            reg.latest = spec.Version
+        }
+    }
+    return reg
+}
+
+// DefaultRegistry serves v1, deprecated with the given sunset, and v2.
+func DefaultRegistry(v1Sunset time.Time) *Registry {
+    return NewRegistry(
+        Spec{Version: V1, Deprecated: true, Sunset: v1Sunset},
+        Spec{Version: V2},
+    )
+}
+
+// Mount calls register once per version with a subrouter for its prefix,
+// and once more for unversioned requests under /api. Handlers read the
+// version with FromContext. Mount on the root router, before any other
+// /api routes.
+func (reg *Registry) Mount(router *mux.Router, register func(r *mux.Router)) {
+    for _, spec := range reg.specs {
+        sub := router.PathPrefix(spec.Version.Prefix()).Subrouter()
+        sub.Use(reg.serve(spec))
+        register(sub)
+    }
+    
+    negotiated := router.PathPrefix("/api").Subrouter()
+    negotiated.Use(reg.negotiate)
+    register(negotiated)
+}
+
+// serve tags requests under spec's prefix with its version. A request that
+// asks for another version in its Accept header is refused.
+func (reg *Registry) serve(spec Spec) mux.MiddlewareFunc {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if asked, ok := Requested(r); ok && asked != spec.Version {
+                http.Error(w, fmt.Sprintf("%s does not serve API version %d", spec.Version.Prefix(), asked), http.StatusNotAcceptable)
+                return
+            }
+            
+            reg.writeHeaders(w, spec)
+            next.ServeHTTP(w, r.WithContext(WithVersion(r.Context(), spec.Version)))
+        })
+    }
+}
+
+// negotiate tags unversioned requests with the version their Accept header
+// asks for, or the latest one.
+func (reg *Registry) negotiate(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        version := reg.latest
+        if asked, ok := Requested(r); ok {
+            version = asked
+        }
+        
+        spec, ok := reg.spec(version)
+        if !ok {
+            http.Error(w, fmt.Sprintf("API version %d is not served", version), http.StatusNotAcceptable)
+            return
+        }
+        
+        w.Header().Add("Vary", "Accept")
+        reg.writeHeaders(w, spec)
+        next.ServeHTTP(w, r.WithContext(WithVersion(r.Context(), spec.Version)))
+    })
+}
+
+func (reg *Registry) spec(version Version) (Spec, bool) {
+    for _, spec := range reg.specs {
+        if spec.Version == version {
+            return spec, true
+        }
+    }
+    return Spec{}, false
+}
+
+func (reg *Registry) writeHeaders(w http.ResponseWriter, spec Spec) {
+    w.Header().Set(Header, spec.Version.String())
+    if !spec.Deprecated {
+        return
+    }
+    
+    w.Header().Set("Deprecation", "true")
+    if !spec.Sunset.IsZero() {
+        w.Header().Set("Sunset", spec.Sunset.UTC().Format(http.TimeFormat))
+    }
+    w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", reg.latest.Prefix()))
+}
+
+// Requested returns the version asked for by a "version" parameter on a JSON
+// media type in the request's Accept header, such as
+// "application/json; version=2".
+func Requested(r *http.Request) (Version, bool) {
+    for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+        mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+        if err != nil || (mediaType != "application/json" && mediaType != "*/*") {
+            continue
+        }
+        raw := strings.TrimPrefix(params["version"], "v")
+        if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+            return Version(n), true
+        }
+    }
+    return 0, false
+}
+
+// Responses maps a handler's result to the response shape of each version.
+// A version without a mapper uses the mapper of the closest lower version,
+// and the result as it is when there is none.
+type Responses[T any] map[Version]func(T) interface{}
+
+// For returns result in the shape of the version the request was routed to.
+func (m Responses[T]) For(r *http.Request, result T) interface{} {
+    best := Version(0)
+    for version := range m {
+        if version <= FromContext(r.Context()) && version > best {
+            best = version
+        }
+    }
+    if mapper, ok := m[best]; ok {
+        return mapper(result)
+    }
+    return result
+}
+
+type versionKey struct{}
+
+// WithVersion returns a context carrying version.
+func WithVersion(ctx context.Context, version Version) context.Context {
+    return context.WithValue(ctx, versionKey{}, version)
+}
+
+// FromContext returns the version the request was routed to. Routes mounted
+// without a Registry are treated as V1, the shapes they have always had.
+func FromContext(ctx context.Context) Version {
+    if version, ok := ctx.Value(versionKey{}).(Version); ok {
+        return version
+    }
+    return V1
+}
+
+// V1SunsetFromEnv parses API_V1_SUNSET, a date such as "2027-06-30" or an
+// RFC 3339 time. It returns zero when the variable is unset or invalid.
+func V1SunsetFromEnv() time.Time {
+    raw := os.Getenv("API_V1_SUNSET")
+    for _, layout := range []string{"2006-01-02", time.RFC3339} {
+        if sunset, err := time.Parse(layout, raw); err == nil {
+            return sunset
+        }
+    }
+    return time.Time{}
+}
@@ -0,0 +1,146 @@
+package apiversion
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRegistry_Mount(t *testing.T) {
+    sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+    router := mux.NewRouter()
+    DefaultRegistry(sunset).Mount(router, func(r *mux.Router) {
+        r.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+            w.Write([]byte(FromContext(r.Context()).String()))
+        })
+    })
+    
+    tests := []struct {
+        name           string
+        path           string
+        accept         string
+        wantStatus     int
+        wantVersion    string
+        wantDeprecated bool
+    }{
+        {name: "v1 prefix", path: "/api/v1/orders", wantStatus: http.StatusOK, wantVersion: "v1", wantDeprecated: true},
+        {name: "v2 prefix", path: "/api/v2/orders", wantStatus: http.StatusOK, wantVersion: "v2"},
+        {name: "prefix with a matching Accept", path: "/api/v2/orders", accept: "application/json; version=2", wantStatus: http.StatusOK, wantVersion: "v2"},
+        {name: "prefix with another Accept", path: "/api/v2/orders", accept: "application/json; version=1", wantStatus: http.StatusNotAcceptable},
+        {name: "unversioned defaults to the latest", path: "/api/orders", wantStatus: http.StatusOK, wantVersion: "v2"},
+        {name: "unversioned asking for v1", path: "/api/orders", accept: "text/html, application/json; version=v1", wantStatus: http.StatusOK, wantVersion: "v1", wantDeprecated: true},
+        {name: "unversioned asking for any type", path: "/api/orders", accept: "*/*; version=1", wantStatus: http.StatusOK, wantVersion: "v1", wantDeprecated: true},
+        {name: "unversioned asking for an unserved version", path: "/api/orders", accept: "application/json; version=3", wantStatus: http.StatusNotAcceptable},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+            if tt.accept != "" {
+                req.Header.Set("Accept", tt.accept)
+            }
+            recorder := httptest.NewRecorder()
+            router.ServeHTTP(recorder, req)
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+            
+            if got := recorder.Header().Get(Header); got != tt.wantVersion {
+                t.Errorf("%s = %q, want %q", Header, got, tt.wantVersion)
+            }
+            if got := recorder.Body.String(); got != tt.wantVersion {
+                t.Errorf("handler saw version %q, want %q", got, tt.wantVersion)
+            }
+            
+            wantDeprecation, wantSunset, wantLink := "", "", ""
+            if tt.wantDeprecated {
+                wantDeprecation = "true"
+                wantSunset = "Wed, 30 Jun 2027 00:00:00 GMT"
+                wantLink = `</api/v2>; rel="successor-version"`
+            }
+            if got := recorder.Header().Get("Deprecation"); got != wantDeprecation {
+                t.Errorf("Deprecation = %q, want %q", got, wantDeprecation)
+            }
+            if got := recorder.Header().Get("Sunset"); got != wantSunset {
+                t.Errorf("Sunset = %q, want %q", got, wantSunset)
+            }
+            if got := recorder.Header().Get("Link"); got != wantLink {
+                t.Errorf("Link = %q, want %q", got, wantLink)
+            }
+        })
+    }
+}
+
+// A deprecated version without a sunset date sends no Sunset header.
+func TestRegistry_Mount_noSunset(t *testing.T) {
+    router := mux.NewRouter()
+    DefaultRegistry(time.Time{}).Mount(router, func(r *mux.Router) {
+        r.HandleFunc("/orders", func(http.ResponseWriter, *http.Request) {})
+    })
+    
+    recorder := httptest.NewRecorder()
+    router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil))
+    if recorder.Header().Get("Deprecation") != "true" {
+        t.Errorf("Deprecation = %q, want true", recorder.Header().Get("Deprecation"))
+    }
+    if _, ok := recorder.Header()["Sunset"]; ok {
+        t.Errorf("Sunset = %q, want none", recorder.Header().Get("Sunset"))
+    }
+}
+
+func TestResponses_For(t *testing.T) {
+    responses := Responses[int]{
+        V2: func(n int) interface{} { return n * 2 },
+    }
+    
+    tests := []struct {
+        name    string
+        version Version
+        routed  bool
+        want    interface{}
+    }{
+        {name: "unrouted reads as v1", want: 1},
+        {name: "v1 without a mapper", version: V1, routed: true, want: 1},
+        {name: "v2", version: V2, routed: true, want: 2},
+        {name: "a later version uses the closest lower mapper", version: 3, routed: true, want: 2},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest(http.MethodGet, "/", nil)
+            if tt.routed {
+                req = req.WithContext(WithVersion(req.Context(), tt.version))
+            }
+            if got := responses.For(req, 1); got != tt.want {
+                t.Errorf("For() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestV1SunsetFromEnv(t *testing.T) {
+    tests := []struct {
+        raw  string
+        want time.Time
+    }{
+        {raw: "", want: time.Time{}},
+        {raw: "2027-06-30", want: time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)},
+        {raw: "2027-06-30T12:00:00Z", want: time.Date(2027, 6, 30, 12, 0, 0, 0, time.UTC)},
+        {raw: "next june", want: time.Time{}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.raw, func(t *testing.T) {
+            t.Setenv("API_V1_SUNSET", tt.raw)
+            if got := V1SunsetFromEnv(); !got.Equal(tt.want) {
+                t.Errorf("V1SunsetFromEnv() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
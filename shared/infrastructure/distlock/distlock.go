@@ -0,0 +1,210 @@
+// Package distlock provides Redis-backed locks that keep a background job
+// running on a single instance at a time while the service is scaled out.
+package distlock
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrLocked is returned by TryAcquire when another owner holds the lock.
+var ErrLocked = errors.New("lock is held by another owner")
+
+// ErrNotHeld is returned when releasing or renewing a lock that has expired
+// or been taken by another owner.
+var ErrNotHeld = errors.New("lock is not held")
+
+// DefaultKeyPrefix namespaces lock keys in Redis.
+const DefaultKeyPrefix = "lock:"
+
+// stats is published as the "distlock" expvar: per lock name the number of
+// acquisitions, attempts that found the lock held, locks lost while running
+// and Redis errors.
+var stats = expvar.NewMap("distlock")
+
+// Only the owner's token may extend or delete a key, so an instance whose
+// lock expired cannot release one another instance has since acquired
+var (
+    releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("DEL", KEYS[1])
+end
+return 0`)
+    renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Locker acquires named locks in Redis.
+type Locker struct {
+    client redis.Cmdable
+    prefix string
+}
+
+type Option func(*Locker)
+
+// WithKeyPrefix replaces DefaultKeyPrefix.
+func WithKeyPrefix(prefix string) Option {
+    return func(l *Locker) {
+        l.prefix = prefix
+    }
+}
+
+func NewLocker(client redis.Cmdable, opts ...Option) *Locker {
+    l := &Locker{client: client, prefix: DefaultKeyPrefix}
+    for _, opt := range opts {
+        opt(l)
+    }
+    return l
+}
+
+// Lock is a held lock. It is renewed in the background every third of its
+// TTL until released; if a renewal finds it gone, Lost is closed.
+type Lock struct {
+    client redis.Cmdable
+    name   string
+    key    string
+    token  string
+    ttl    time.Duration
+    
+    lost     chan struct{}
+    lostOnce sync.Once
+    stop     chan struct{}
+    stopOnce sync.Once
+    renewing sync.WaitGroup
+}
+
+// TryAcquire takes the lock called name for ttl without waiting. It returns
+// ErrLocked if another owner holds it.
+func (l *Locker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+    if ttl < 3*time.Millisecond {
+        return nil, fmt.Errorf("lock %s: ttl %s is too short to renew", name, ttl)
+    }
+    
+    token := uuid.New().String()
+    key := l.prefix + name
+    
+    ok, err := l.client.SetNX(ctx, key, token, ttl).Result()
+    if err != nil {
+        stats.Add(name+".errors", 1)
+        return nil, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+    }
+    if !ok {
+        stats.Add(name+".contended", 1)
+        return nil, ErrLocked
+    }
+    stats.Add(name+".acquired", 1)
+    
+    lock := &Lock{
+        client: l.client,
+        name:   name,
+        key:    key,
+        token:  token,
+        ttl:    ttl,
+        lost:   make(chan struct{}),
+        stop:   make(chan struct{}),
+    }
+    lock.renewing.Add(1)
+    go lock.renew()
+    
+    return lock, nil
+}
+
+// Lost is closed when the lock expired or was taken over while held.
+func (lk *Lock) Lost() <-chan struct{} {
+    return lk.lost
+}
+
+// Release stops renewal and deletes the lock if it is still held. It
+// returns ErrNotHeld if the lock was lost in the meantime.
+func (lk *Lock) Release(ctx context.Context) error {
+    lk.stopOnce.Do(func() { close(lk.stop) })
+    lk.renewing.Wait()
+    
+    deleted, err := releaseScript.Run(ctx, lk.client, []string{lk.key}, lk.token).Int()
+    if err != nil {
+        stats.Add(lk.name+".errors", 1)
+        return fmt.Errorf("failed to release lock %s: %w", lk.name, err)
+    }
+    if deleted == 0 {
+        lk.markLost()
+        return ErrNotHeld
+    }
+    return nil
+}
+
+func (lk *Lock) renew() {
+    defer lk.renewing.Done()
+    
+    ticker := time.NewTicker(lk.ttl / 3)
+    defer ticker.Stop()
+    
+    for {
+        select {
+        case <-lk.stop:
+            return
+        case <-ticker.C:
+            ctx, cancel := context.WithTimeout(context.Background(), lk.ttl/3)
+            renewed, err := renewScript.Run(ctx, lk.client, []string{lk.key}, lk.token, lk.ttl.Milliseconds()).Int()
+            cancel()
+            if err != nil {
+                // Try again next tick; the lock survives until its TTL
+                stats.Add(lk.name+".errors", 1)
+                log.Printf("Error renewing lock %s: %v", lk.name, err)
+                continue
+            }
+            if renewed == 0 {
+                lk.markLost()
+                return
+            }
+        }
+    }
+}
+
+func (lk *Lock) markLost() {
+    lk.lostOnce.Do(func() {
+        stats.Add(lk.name+".lost", 1)
+        log.Printf("Lost lock %s", lk.name)
+        close(lk.lost)
+    })
+}
+
+// Run calls fn while holding the lock called name, and skips it, returning
+// false, if another instance holds the lock. fn's context is cancelled if
+// the lock is lost while it runs.
+func (l *Locker) Run(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context) error) (bool, error) {
+    lock, err := l.TryAcquire(ctx, name, ttl)
+    if errors.Is(err, ErrLocked) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    
+    runCtx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    go func() {
+        select {
+        case <-lock.Lost():
+            cancel()
+        case <-runCtx.Done():
+        }
+    }()
+    
+    err = fn(runCtx)
+    
+    if releaseErr := lock.Release(context.Background()); releaseErr != nil && err == nil {
+        err = releaseErr
+    }
+    return true, err
+}
@@ -0,0 +1,231 @@
+package distlock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestLocker returns a Locker on a fresh miniredis. miniredis expires
+// keys only when the test fast-forwards it.
+func newTestLocker(t *testing.T) (*Locker, *miniredis.Miniredis) {
+    t.Helper()
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+    t.Cleanup(func() { client.Close() })
+    return NewLocker(client), server
+}
+
+func TestLocker_TryAcquire(t *testing.T) {
+    tests := []struct {
+        name    string
+        ttl     time.Duration
+        // held acquires the lock first, for another owner
+        held    bool
+        wantErr error
+        wantAny bool
+    }{
+        {name: "free", ttl: time.Minute},
+        {name: "held by another owner", ttl: time.Minute, held: true, wantErr: ErrLocked},
+        {name: "ttl too short to renew", ttl: time.Millisecond, wantAny: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            locker, server := newTestLocker(t)
+            if tt.held {
+                other, err := locker.TryAcquire(ctx, "janitor", time.Minute)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                defer other.Release(ctx)
+            }
+            
+            lock, err := locker.TryAcquire(ctx, "janitor", tt.ttl)
+            switch {
+            case tt.wantAny:
+                if err == nil {
+                    t.Fatal("TryAcquire() = nil, want an error")
+                }
+                return
+            case !errors.Is(err, tt.wantErr):
+                t.Fatalf("TryAcquire() = %v, want %v", err, tt.wantErr)
+            case err != nil:
+                return
+            }
+            
+            if got, _ := server.Get(DefaultKeyPrefix + "janitor"); got != lock.token {
+                t.Errorf("key holds %q, want the lock's token", got)
+            }
+            if got := server.TTL(DefaultKeyPrefix + "janitor"); got != tt.ttl {
+                t.Errorf("key TTL = %s, want %s", got, tt.ttl)
+            }
+            if err := lock.Release(ctx); err != nil {
+                t.Errorf("Release() = %v", err)
+            }
+            if server.Exists(DefaultKeyPrefix + "janitor") {
+                t.Error("key still set after Release")
+            }
+        })
+    }
+}
+
+// A held lock is renewed, so it outlives its TTL.
+func TestLock_renewal(t *testing.T) {
+    ctx := context.Background()
+    locker, server := newTestLocker(t)
+    const ttl = 300 * time.Millisecond
+    lock, err := locker.TryAcquire(ctx, "janitor", ttl)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer lock.Release(ctx)
+    
+    // Twice the TTL passes in Redis while the renewal runs every third of it
+    for i := 0; i < 12; i++ {
+        server.FastForward(ttl / 6)
+        time.Sleep(ttl / 3)
+    }
+    
+    select {
+    case <-lock.Lost():
+        t.Fatal("lock lost while renewed")
+    default:
+    }
+    if got, _ := server.Get(DefaultKeyPrefix + "janitor"); got != lock.token {
+        t.Errorf("key holds %q, want the lock's token", got)
+    }
+}
+
+// A lock that expires while its owner runs is lost to the owner, and the
+// owner's release leaves the next owner's lock alone.
+func TestLock_expiresWhileRunning(t *testing.T) {
+    ctx := context.Background()
+    locker, server := newTestLocker(t)
+    first, err := locker.TryAcquire(ctx, "janitor", time.Second)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    // The owner stalls past the TTL, and another instance takes the lock
+    server.FastForward(2 * time.Second)
+    second, err := locker.TryAcquire(ctx, "janitor", time.Minute)
+    if err != nil {
+        t.Fatalf("TryAcquire() after expiry = %v", err)
+    }
+    defer second.Release(ctx)
+    
+    select {
+    case <-first.Lost():
+    case <-time.After(2 * time.Second):
+        t.Fatal("expired lock not reported lost")
+    }
+    if err := first.Release(ctx); !errors.Is(err, ErrNotHeld) {
+        t.Errorf("Release() of the expired lock = %v, want %v", err, ErrNotHeld)
+    }
+    if got, _ := server.Get(DefaultKeyPrefix + "janitor"); got != second.token {
+        t.Errorf("key holds %q, want the second owner's token", got)
+    }
+}
+
+// Only the token the lock was acquired with releases it.
+func TestLock_Release_notOwner(t *testing.T) {
+    ctx := context.Background()
+    locker, server := newTestLocker(t)
+    lock, err := locker.TryAcquire(ctx, "janitor", time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer lock.Release(ctx)
+    
+    impostor := &Lock{
+        client: locker.client,
+        name:   "janitor",
+        key:    lock.key,
+        token:  "another-owner",
+        ttl:    time.Minute,
+        lost:   make(chan struct{}),
+        stop:   make(chan struct{}),
+    }
+    if err := impostor.Release(ctx); !errors.Is(err, ErrNotHeld) {
+        t.Errorf("Release() by another owner = %v, want %v", err, ErrNotHeld)
+    }
+    if got, _ := server.Get(DefaultKeyPrefix + "janitor"); got != lock.token {
+        t.Errorf("key holds %q, want the owner's token", got)
+    }
+}
+
+func TestLocker_Run(t *testing.T) {
+    errJob := errors.New("job failed")
+    tests := []struct {
+        name    string
+        held    bool
+        // job runs under the lock; server expires keys when fast-forwarded
+        job     func(ctx context.Context, server *miniredis.Miniredis) error
+        wantRan bool
+        wantErr error
+    }{
+        {
+            name:    "runs and releases",
+            job:     func(context.Context, *miniredis.Miniredis) error { return nil },
+            wantRan: true,
+        },
+        {
+            name:    "job error is returned",
+            job:     func(context.Context, *miniredis.Miniredis) error { return errJob },
+            wantRan: true,
+            wantErr: errJob,
+        },
+        {
+            name:    "skipped while another instance holds the lock",
+            held:    true,
+            job:     func(context.Context, *miniredis.Miniredis) error { return errJob },
+        },
+        {
+            name: "lock lost while running cancels the job",
+            job: func(ctx context.Context, server *miniredis.Miniredis) error {
+                server.FastForward(time.Minute)
+                select {
+                case <-ctx.Done():
+                    return ctx.Err()
+                case <-time.After(5 * time.Second):
+                    return errors.New("job not cancelled")
+                }
+            },
+            wantRan: true,
+            wantErr: context.Canceled,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            locker, server := newTestLocker(t)
+            if tt.held {
+                other, err := locker.TryAcquire(ctx, "janitor", time.Minute)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                defer other.Release(ctx)
+            }
+            
+            ran, err := locker.Run(ctx, "janitor", 30*time.Millisecond, func(ctx context.Context) error {
+                return tt.job(ctx, server)
+            })
+            if ran != tt.wantRan {
+                t.Errorf("Run() ran = %t, want %t", ran, tt.wantRan)
+            }
+            if !errors.Is(err, tt.wantErr) {
+                t.Errorf("Run() = %v, want %v", err, tt.wantErr)
+            }
+            if !tt.held && server.Exists(DefaultKeyPrefix+"janitor") {
+                t.Error("lock still held after Run")
+            }
+        })
+    }
+}
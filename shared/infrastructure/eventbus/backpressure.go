@@ -0,0 +1,188 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+)
+
+// BackpressureConfig bounds the work a consumer takes on while its handler
+// is slow or failing, typically because the read model database is degraded.
+type BackpressureConfig struct {
+    // MaxInFlight is the number of messages handled concurrently. Above one,
+    // messages may complete and be committed out of order.
+    MaxInFlight int
+    // Window is the number of recent handler results latency and error rate
+    // are measured over.
+    Window int
+    // PauseLatency pauses consumption when the average handler latency over
+    // the window reaches it. Zero disables the check.
+    PauseLatency time.Duration
+    // PauseErrorRate pauses consumption when this fraction of the window
+    // failed. Zero disables the check.
+    PauseErrorRate float64
+    // ResumeAfter is how long consumption stays paused before it resumes to
+    // probe the handler again.
+    ResumeAfter time.Duration
+}
+
+// DefaultBackpressureConfig handles one message at a time, as the consumer
+// always has.
+var DefaultBackpressureConfig = BackpressureConfig{
+    MaxInFlight:    1,
+    Window:         10,
+    PauseLatency:   5 * time.Second,
+    PauseErrorRate: 0.5,
+    ResumeAfter:    10 * time.Second,
+}
+
+// BackpressureConfigFromEnv reads CONSUMER_MAX_IN_FLIGHT,
+// CONSUMER_PAUSE_LATENCY, CONSUMER_PAUSE_ERROR_RATE and
+// CONSUMER_RESUME_AFTER, falling back to DefaultBackpressureConfig.
+func BackpressureConfigFromEnv() BackpressureConfig {
+    cfg := DefaultBackpressureConfig
+    
+    if value, err := strconv.Atoi(os.Getenv("CONSUMER_MAX_IN_FLIGHT")); err == nil && value > 0 {
+        cfg.MaxInFlight = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("CONSUMER_PAUSE_LATENCY")); err == nil && value >= 0 {
+        cfg.PauseLatency = value
+    }
+    if value, err := strconv.ParseFloat(os.Getenv("CONSUMER_PAUSE_ERROR_RATE"), 64); err == nil && value >= 0 && value <= 1 {
+        cfg.PauseErrorRate = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("CONSUMER_RESUME_AFTER")); err == nil && value > 0 {
+        cfg.ResumeAfter = value
+    }
+    
+    return cfg
+}
+
+// backpressureStats is published as the "consumer_backpressure" expvar:
+// messages in flight, whether consumption is paused, and how many times it
+// was paused and resumed.
+var backpressureStats = expvar.NewMap("consumer_backpressure")
+
+type handlerResult struct {
+    latency time.Duration
+    failed  bool
+}
+
+// backpressure limits in-flight messages and decides when a consumer should
+// stop fetching, based on the results of recent handler calls.
+type backpressure struct {
+    cfg   BackpressureConfig
+    slots chan struct{}
+    
+    mu       sync.Mutex
+    results  []handlerResult
+    next     int
+    paused   bool
+    pausedAt time.Time
+}
+
+func newBackpressure(cfg BackpressureConfig) *backpressure {
+    if cfg.MaxInFlight <= 0 {
+        cfg.MaxInFlight = 1
+    }
+    if cfg.Window <= 0 {
+        cfg.Window = DefaultBackpressureConfig.Window
+    }
+    return &backpressure{
+        cfg:     cfg,
+        slots:   make(chan struct{}, cfg.MaxInFlight),
+        results: make([]handlerResult, 0, cfg.Window),
+    }
+}
+
+// acquire waits for an in-flight slot. It returns false if ctx is done
+// first.
+func (b *backpressure) acquire(ctx context.Context) bool {
+    select {
+    case b.slots <- struct{}{}:
+        backpressureStats.Add("in_flight", 1)
+        return true
+    case <-ctx.Done():
+        return false
+    }
+}
+
+// release frees the slot taken by acquire and records how the handler did.
+// Invalid events and panics are not counted as failures: they are dead
+// lettered and say nothing about the health of the handler's dependencies.
+func (b *backpressure) release(latency time.Duration, err error) {
+    failed := err != nil && !errors.Is(err, events.ErrInvalidEvent) && !errors.Is(err, recovery.ErrPanic)
+    
+    b.mu.Lock()
+    result := handlerResult{latency: latency, failed: failed}
+    if len(b.results) < cap(b.results) {
+        b.results = append(b.results, result)
+    } else {
+        b.results[b.next] = result
+    }
+    b.next = (b.next + 1) % cap(b.results)
+    b.mu.Unlock()
+    
+    <-b.slots
+    backpressureStats.Add("in_flight", -1)
+}
+
+// evaluate reports whether consumption should now be paused and whether that
+// changed since the last call. A paused consumer resumes once ResumeAfter
+// has passed and its in-flight messages have drained; the window is cleared
+// so only results seen after resuming can pause it again.
+func (b *backpressure) evaluate() (paused, changed bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    
+    if b.paused {
+        if time.Since(b.pausedAt) < b.cfg.ResumeAfter || len(b.slots) > 0 {
+            return true, false
+        }
+        b.paused = false
+        b.results = b.results[:0]
+        b.next = 0
+        backpressureStats.Add("paused", -1)
+        backpressureStats.Add("resumes", 1)
+        log.Printf("Resuming event consumption after %s", time.Since(b.pausedAt).Round(time.Millisecond))
+        return false, true
+    }
+    
+    // Wait for half a window so a single slow message does not pause
+    if len(b.results)*2 < cap(b.results) {
+        return false, false
+    }
+    
+    var total time.Duration
+    failures := 0
+    for _, result := range b.results {
+        total += result.latency
+        if result.failed {
+            failures++
+        }
+    }
+    latency := total / time.Duration(len(b.results))
+    errorRate := float64(failures) / float64(len(b.results))
+    
+    latencyHigh := b.cfg.PauseLatency > 0 && latency >= b.cfg.PauseLatency
+    errorsHigh := b.cfg.PauseErrorRate > 0 && errorRate >= b.cfg.PauseErrorRate
+    if !latencyHigh && !errorsHigh {
+        return false, false
+    }
+    
+    b.paused = true
+    b.pausedAt = time.Now()
+    backpressureStats.Add("paused", 1)
+    backpressureStats.Add("pauses", 1)
+    log.Printf("Pausing event consumption for %s: average handler latency %s, error rate %.0f%% over the last %d messages",
+        b.cfg.ResumeAfter, latency.Round(time.Millisecond), errorRate*100, len(b.results))
+    return true, true
+}
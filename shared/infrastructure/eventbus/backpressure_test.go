@@ -0,0 +1,162 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+)
+
+// slowReadModel stands in for a read model on a degraded database: every
+// write takes delay, and it records how many writes overlapped.
+type slowReadModel struct {
+    delay time.Duration
+    
+    mu          sync.Mutex
+    inFlight    int
+    maxInFlight int
+    applied     int
+}
+
+func (m *slowReadModel) apply() {
+    m.mu.Lock()
+    m.inFlight++
+    if m.inFlight > m.maxInFlight {
+        m.maxInFlight = m.inFlight
+    }
+    m.mu.Unlock()
+    
+    time.Sleep(m.delay)
+    
+    m.mu.Lock()
+    m.inFlight--
+    m.applied++
+    m.mu.Unlock()
+}
+
+// A consumer in front of a slow read model stops fetching once the handler
+// latency crosses the threshold, instead of piling up handlers, and resumes
+// after ResumeAfter.
+func TestBackpressure_slowReadModelPauses(t *testing.T) {
+    ctx := context.Background()
+    model := &slowReadModel{delay: 20 * time.Millisecond}
+    pressure := newBackpressure(BackpressureConfig{
+        MaxInFlight:  2,
+        Window:       4,
+        PauseLatency: 10 * time.Millisecond,
+        ResumeAfter:  50 * time.Millisecond,
+    })
+    
+    // Fetch as the Kafka consumer loop does, from an endless backlog
+    const backlog = 100
+    var handling sync.WaitGroup
+    fetched := 0
+    for ; fetched < backlog; fetched++ {
+        if paused, _ := pressure.evaluate(); paused {
+            break
+        }
+        if !pressure.acquire(ctx) {
+            t.Fatal("acquire() = false")
+        }
+        handling.Add(1)
+        go func() {
+            defer handling.Done()
+            started := time.Now()
+            model.apply()
+            pressure.release(time.Since(started), nil)
+        }()
+    }
+    pausedAt := time.Now()
+    if fetched == backlog {
+        t.Fatalf("consumer fetched the whole backlog of %d without pausing", backlog)
+    }
+    handling.Wait()
+    if model.maxInFlight > 2 {
+        t.Errorf("%d writes in flight at once, want at most 2", model.maxInFlight)
+    }
+    if model.applied != fetched {
+        t.Errorf("applied %d of %d fetched messages", model.applied, fetched)
+    }
+    
+    deadline := time.Now().Add(time.Second)
+    for {
+        paused, changed := pressure.evaluate()
+        if !paused {
+            if !changed {
+                t.Error("evaluate() resumed without reporting the change")
+            }
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("consumer did not resume")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    if elapsed := time.Since(pausedAt); elapsed < 50*time.Millisecond {
+        t.Errorf("resumed after %s, want at least ResumeAfter", elapsed)
+    }
+    // The slow results from before the pause are forgotten
+    if paused, changed := pressure.evaluate(); paused || changed {
+        t.Errorf("evaluate() after resuming = %v, %v, want false, false", paused, changed)
+    }
+}
+
+func TestBackpressure_evaluate_errorRate(t *testing.T) {
+    tests := []struct {
+        name       string
+        err        error
+        wantPaused bool
+    }{
+        {name: "handler succeeds", err: nil, wantPaused: false},
+        {name: "read model fails", err: errors.New("connection refused"), wantPaused: true},
+        {name: "invalid events are dead lettered", err: fmt.Errorf("decoding: %w", events.ErrInvalidEvent), wantPaused: false},
+        {name: "panics are dead lettered", err: fmt.Errorf("projection: %w", recovery.ErrPanic), wantPaused: false},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pressure := newBackpressure(BackpressureConfig{Window: 4, PauseErrorRate: 0.5, ResumeAfter: time.Minute})
+            for i := 0; i < 4; i++ {
+                if !pressure.acquire(context.Background()) {
+                    t.Fatal("acquire() = false")
+                }
+                pressure.release(time.Millisecond, tt.err)
+            }
+            if paused, changed := pressure.evaluate(); paused != tt.wantPaused || changed != tt.wantPaused {
+                t.Errorf("evaluate() = %v, %v, want %v, %v", paused, changed, tt.wantPaused, tt.wantPaused)
+            }
+        })
+    }
+}
+
+// acquire gives up when the consumer is stopped while every slot is taken.
+func TestBackpressure_acquire_cancelled(t *testing.T) {
+    pressure := newBackpressure(BackpressureConfig{MaxInFlight: 1})
+    if !pressure.acquire(context.Background()) {
+        t.Fatal("acquire() of a free slot = false")
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+    defer cancel()
+    if pressure.acquire(ctx) {
+        t.Error("acquire() with every slot taken = true, want false once cancelled")
+    }
+}
+
+func TestBackpressureConfigFromEnv(t *testing.T) {
+    t.Setenv("CONSUMER_MAX_IN_FLIGHT", "8")
+    t.Setenv("CONSUMER_PAUSE_LATENCY", "2s")
+    t.Setenv("CONSUMER_PAUSE_ERROR_RATE", "1.5")
+    t.Setenv("CONSUMER_RESUME_AFTER", "-1s")
+    
+    want := DefaultBackpressureConfig
+    want.MaxInFlight = 8
+    want.PauseLatency = 2 * time.Second
+    if got := BackpressureConfigFromEnv(); got != want {
+        t.Errorf("BackpressureConfigFromEnv() = %+v, want %+v", got, want)
+    }
+}
@@ -0,0 +1,20 @@
+package eventbus
+
+import (
+	"os"
+	"strings"
+)
+
+// CloudEventsSourceFromEnv returns the source to pass to WithCloudEvents
+// when EVENT_FORMAT is cloudevents, and an empty one, publishing plain
+// payloads, otherwise. The source is CLOUDEVENTS_SOURCE, defaulting to
+// /dddcqrs/ followed by service.
+func CloudEventsSourceFromEnv(service string) string {
+    if !strings.EqualFold(os.Getenv("EVENT_FORMAT"), "cloudevents") {
+        return ""
+    }
+    if source := os.Getenv("CLOUDEVENTS_SOURCE"); source != "" {
+        return source
+    }
+    return "/dddcqrs/" + service
+}
@@ -0,0 +1,87 @@
+package eventbus
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+func TestCloudEventsSourceFromEnv(t *testing.T) {
+    tests := []struct {
+        format string
+        source string
+        want   string
+    }{
+        {format: "", want: ""},
+        {format: "json", source: "/custom", want: ""},
+        {format: "cloudevents", want: "/dddcqrs/order-management"},
+        {format: "CloudEvents", source: "/custom", want: "/custom"},
+    }
+    
+    for _, tt := range tests {
+        t.Setenv("EVENT_FORMAT", tt.format)
+        t.Setenv("CLOUDEVENTS_SOURCE", tt.source)
+        if got := CloudEventsSourceFromEnv("order-management"); got != tt.want {
+            t.Errorf("CloudEventsSourceFromEnv() with %q, %q = %q, want %q", tt.format, tt.source, got, tt.want)
+        }
+    }
+}
+
+// During a rolling upgrade one consumer reads events published plain by an
+// old publisher and in CloudEvents envelopes by a new one.
+func TestKafkaEventBus_mixedFormats(t *testing.T) {
+    brokers := newMockKafka(t, DefaultTopic)
+    plainBus := NewKafkaEventBus(brokers)
+    defer plainBus.Close()
+    cloudEventsBus := NewKafkaEventBus(brokers, WithCloudEvents("/dddcqrs/order-management"))
+    defer cloudEventsBus.Close()
+    
+    var published []string
+    for _, bus := range []*KafkaEventBus{plainBus, cloudEventsBus} {
+        order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+        if err != nil {
+            t.Fatalf("NewOrder() = %v", err)
+        }
+        event := events.NewOrderCreatedEvent(order)
+        if err := bus.Publish(context.Background(), event); err != nil {
+            t.Fatalf("Publish() = %v", err)
+        }
+        published = append(published, event.EventID())
+    }
+    
+    consumer := NewKafkaEventBus(brokers, WithGroupID("mixed-formats"))
+    defer consumer.Close()
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    handled := make(chan string, 2)
+    err := consumer.Subscribe(ctx, []string{DefaultTopic}, func(_ context.Context, event events.DomainEvent) error {
+        if _, ok := event.(events.OrderCreatedEvent); ok {
+            handled <- event.EventID()
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Subscribe() = %v", err)
+    }
+    
+    var got []string
+    for len(got) < 2 {
+        select {
+        case id := <-handled:
+            got = append(got, id)
+        case <-time.After(30 * time.Second):
+            t.Fatalf("handled %v of %v", got, published)
+        }
+    }
+    sort.Strings(got)
+    sort.Strings(published)
+    if !reflect.DeepEqual(got, published) {
+        t.Errorf("handled %v, want %v", got, published)
+    }
+}
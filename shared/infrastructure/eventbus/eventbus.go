@@ -2,12 +2,91 @@ package eventbus
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"time"
 
 	"github.com/vdntruong/dddcqrs/shared/domain/events"
 )
 
+// DefaultHandlerTimeout bounds how long a handler may spend on one message.
+const DefaultHandlerTimeout = 30 * time.Second
+
+// ContentEncodingHeader names the message header that marks a compressed
+// payload. Consumers need not check it: the registry decompresses payloads
+// transparently.
+const ContentEncodingHeader = "content-encoding"
+
+// DefaultTopic is the topic events are published to when no TopicResolver
+// routes them elsewhere.
+const DefaultTopic = "orders"
+
+// TopicResolver picks the topic an event is published to.
+type TopicResolver func(event events.DomainEvent) string
+
+// DefaultTopicResolver sends every event to DefaultTopic.
+func DefaultTopicResolver(events.DomainEvent) string {
+    return DefaultTopic
+}
+
+// Handler processes a consumed event. ctx is derived from the subscription
+// context and carries a per-message deadline.
+type Handler func(ctx context.Context, event events.DomainEvent) error
+
+// ErrorHandler is told when a subscription stops consuming for good, such
+// as on a fatal broker error. The subscription's handler is not called
+// again.
+type ErrorHandler func(err error)
+
+// logSubscriptionError is the default ErrorHandler.
+func logSubscriptionError(err error) {
+    log.Printf("Event subscription stopped: %v", err)
+}
+
 type EventBus interface {
     Publish(ctx context.Context, event events.DomainEvent) error
-    Subscribe(ctx context.Context, topic string, handler func(events.DomainEvent) error) error
+    PublishTo(ctx context.Context, topic string, event events.DomainEvent) error
+    Subscribe(ctx context.Context, topics []string, handler Handler, opts ...SubscribeOption) error
     Close() error
 }
+
+// GroupedEventBus is implemented by event buses that can consume under more
+// than one consumer group, such as KafkaEventBus and NATSEventBus. Each group
+// keeps its own checkpoints, so its subscribers progress, fail and replay
+// independently of the other groups'.
+type GroupedEventBus interface {
+    EventBus
+    // ForGroup returns a bus whose Subscribe consumes as group. It shares
+    // the receiver's connection; closing it leaves the receiver open.
+    ForGroup(group string) (EventBus, error)
+}
+
+// Drainer is implemented by event buses whose subscriptions run in the
+// background, such as KafkaEventBus and NATSEventBus, so a shutdown can
+// wait for them before closing what their handlers use.
+type Drainer interface {
+    // Drain waits until every subscription has stopped and its in-flight
+    // handlers have returned, or until ctx is done. Subscriptions stop
+    // once their context is done, which the caller sees to first.
+    Drain(ctx context.Context) error
+}
+
+// describe identifies an event in logs and panic reports.
+func describe(event events.DomainEvent) string {
+    return fmt.Sprintf("%s %s event_id=%s", event.Type(), event.AggregateID(), event.EventID())
+}
+
+// encodePayload gzips a serialized event larger than compressAbove bytes,
+// returning the payload and its content encoding. A zero compressAbove
+// disables compression.
+func encodePayload(data []byte, compressAbove int) ([]byte, string, error) {
+    if compressAbove <= 0 || len(data) <= compressAbove {
+        return data, "", nil
+    }
+    
+    compressed, err := events.Compress(data)
+    if err != nil {
+        return nil, "", err
+    }
+    return compressed, events.ContentEncodingGzip, nil
+}
@@ -3,20 +3,139 @@ package eventbus
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/logredact"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type KafkaEventBus struct {
-    producer *kafka.Producer
-    consumer *kafka.Consumer
-    brokers  string
+    producer         *kafka.Producer
+    consumer         *kafka.Consumer
+    brokers          string
+    groupID          string
+    // sharedProducer is set on buses returned by ForGroup, whose Close
+    // leaves the producer to the bus they came from
+    sharedProducer   bool
+    topicResolver    TopicResolver
+    registry         *events.Registry
+    deadLetterSuffix string
+    handlerTimeout   time.Duration
+    compressAbove    int
+    // cloudEvents is the source of CloudEvents envelopes; empty publishes
+    // plain payloads
+    cloudEvents      string
+    backpressure     BackpressureConfig
+    onError          ErrorHandler
+    tracer           trace.Tracer
+    
+    // Subscription state, shared with offset resets
+    offsets       *offsetTracker
+    handling      sync.WaitGroup
+    // subscriptions counts the running poll loops, for Drain
+    subscriptions sync.WaitGroup
+    consuming     atomic.Bool
+    resets        chan *resetRequest
+}
+
+// DefaultGroupID is the consumer group of a KafkaEventBus unless WithGroupID
+// sets another.
+const DefaultGroupID = "order-reporting-service"
+
+// pollTimeout bounds each wait for a message so a paused consumer still
+// notices when to resume and when its context is done.
+const pollTimeout = 100 * time.Millisecond
+
+type KafkaOption func(*KafkaEventBus)
+
+// WithGroupID sets the consumer group Subscribe consumes as. The default is
+// DefaultGroupID.
+func WithGroupID(groupID string) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.groupID = groupID
+    }
+}
+
+// WithTopicResolver routes events passed to Publish to the topic returned by
+// resolver instead of DefaultTopic.
+func WithTopicResolver(resolver TopicResolver) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.topicResolver = resolver
+    }
+}
+
+// WithRegistry sets the registry used to decode consumed messages.
+func WithRegistry(registry *events.Registry) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.registry = registry
+    }
+}
+
+// WithDeadLetterSuffix sets the suffix appended to a topic name to form the
+// topic invalid messages are moved to. The default is ".dlq".
+func WithDeadLetterSuffix(suffix string) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.deadLetterSuffix = suffix
+    }
+}
+
+// WithHandlerTimeout bounds how long the subscription handler may spend on a
+// single message before its context is cancelled.
+func WithHandlerTimeout(timeout time.Duration) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.handlerTimeout = timeout
+    }
+}
+
+// WithCompression gzips message values larger than threshold bytes and marks
+// them with a content-encoding header. Zero, the default, disables it.
+func WithCompression(threshold int) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.compressAbove = threshold
+    }
 }
 
-func NewKafkaEventBus(brokers string) *KafkaEventBus {
+// WithCloudEvents publishes events in CloudEvents structured JSON envelopes
+// from source, with a content-type header of
+// events.CloudEventsContentType. An empty source, the default, publishes
+// plain event payloads. Consumers accept both formats, so publishers can
+// switch while consumers run.
+func WithCloudEvents(source string) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.cloudEvents = source
+    }
+}
+
+// WithBackpressure bounds in-flight messages and pauses the assigned
+// partitions while the handler is slow or failing. The default is
+// DefaultBackpressureConfig.
+func WithBackpressure(cfg BackpressureConfig) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.backpressure = cfg
+    }
+}
+
+// WithErrorHandler sets the function told when a subscription stops on a
+// fatal consumer error. The default logs the error.
+func WithErrorHandler(onError ErrorHandler) KafkaOption {
+    return func(k *KafkaEventBus) {
+        k.onError = onError
+    }
+}
+
+func NewKafkaEventBus(brokers string, opts ...KafkaOption) *KafkaEventBus {
     // Producer configuration
     producer, err := kafka.NewProducer(&kafka.ConfigMap{
         "bootstrap.servers": brokers,
@@ -28,31 +147,94 @@ func NewKafkaEventBus(brokers string) *KafkaEventBus {
         log.Fatalf("Failed to create Kafka producer: %v", err)
     }
     
-    // Consumer configuration
-    consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+    bus := &KafkaEventBus{
+        producer:         producer,
+        brokers:          brokers,
+        groupID:          DefaultGroupID,
+        topicResolver:    DefaultTopicResolver,
+        registry:         events.DefaultRegistry(),
+        deadLetterSuffix: ".dlq",
+        handlerTimeout:   DefaultHandlerTimeout,
+        backpressure:     DefaultBackpressureConfig,
+        onError:          logSubscriptionError,
+        tracer:           otel.Tracer("github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"),
+        offsets:          newOffsetTracker(),
+        resets:           make(chan *resetRequest),
+    }
+    
+    for _, opt := range opts {
+        opt(bus)
+    }
+    
+    bus.consumer, err = newKafkaConsumer(brokers, bus.groupID)
+    if err != nil {
+        log.Fatalf("Failed to create Kafka consumer: %v", err)
+    }
+    
+    return bus
+}
+
+func newKafkaConsumer(brokers, groupID string) (*kafka.Consumer, error) {
+    return kafka.NewConsumer(&kafka.ConfigMap{
         "bootstrap.servers": brokers,
-        "group.id":         "order-reporting-service",
+        "group.id":         groupID,
         "auto.offset.reset": "earliest",
         "enable.auto.commit": "false",
     })
+}
+
+var _ GroupedEventBus = (*KafkaEventBus)(nil)
+
+// ForGroup returns a bus with the receiver's settings consuming as groupID.
+// A group consuming for the first time starts from the earliest retained
+// message.
+func (k *KafkaEventBus) ForGroup(groupID string) (EventBus, error) {
+    consumer, err := newKafkaConsumer(k.brokers, groupID)
     if err != nil {
-        log.Fatalf("Failed to create Kafka consumer: %v", err)
+        return nil, fmt.Errorf("failed to create Kafka consumer for group %s: %w", groupID, err)
     }
     
     return &KafkaEventBus{
-        producer: producer,
-        consumer: consumer,
-        brokers:  brokers,
-    }
+        producer:         k.producer,
+        consumer:         consumer,
+        brokers:          k.brokers,
+        groupID:          groupID,
+        sharedProducer:   true,
+        topicResolver:    k.topicResolver,
+        registry:         k.registry,
+        deadLetterSuffix: k.deadLetterSuffix,
+        handlerTimeout:   k.handlerTimeout,
+        compressAbove:    k.compressAbove,
+        cloudEvents:      k.cloudEvents,
+        backpressure:     k.backpressure,
+        onError:          k.onError,
+        tracer:           k.tracer,
+        offsets:          newOffsetTracker(),
+        resets:           make(chan *resetRequest),
+    }, nil
 }
 
 func (k *KafkaEventBus) Publish(ctx context.Context, event events.DomainEvent) error {
-    eventData, err := json.Marshal(event)
+    return k.PublishTo(ctx, k.topicResolver(event), event)
+}
+
+func (k *KafkaEventBus) PublishTo(ctx context.Context, topic string, event events.DomainEvent) error {
+    var eventData []byte
+    var err error
+    if k.cloudEvents != "" {
+        eventData, err = events.WrapCloudEvent(event, k.cloudEvents)
+    } else {
+        eventData, err = json.Marshal(event)
+    }
     if err != nil {
         return fmt.Errorf("failed to marshal event: %w", err)
     }
     
-    topic := "orders"
+    eventData, encoding, err := encodePayload(eventData, k.compressAbove)
+    if err != nil {
+        return err
+    }
+    
     message := &kafka.Message{
         TopicPartition: kafka.TopicPartition{
             Topic:     &topic,
@@ -60,13 +242,30 @@ func (k *KafkaEventBus) Publish(ctx context.Context, event events.DomainEvent) e
         },
         Value: eventData,
         Headers: []kafka.Header{
-            {Key: "event-type", Value: []byte(event.Type())},
+            {Key: "event-id", Value: []byte(event.EventID())},
+            {Key: EventTypeHeader, Value: []byte(event.Type())},
             {Key: "aggregate-id", Value: []byte(event.AggregateID())},
         },
     }
     
+    if encoding != "" {
+        message.Headers = append(message.Headers, kafka.Header{Key: ContentEncodingHeader, Value: []byte(encoding)})
+    }
+    if k.cloudEvents != "" {
+        message.Headers = append(message.Headers, kafka.Header{Key: "content-type", Value: []byte(events.CloudEventsContentType)})
+    }
+    
+    // Carry the publishing span so consumers continue the trace
+    if traceparent := tracing.Traceparent(ctx); traceparent != "" {
+        message.Headers = append(message.Headers, kafka.Header{Key: tracing.TraceparentHeader, Value: []byte(traceparent)})
+    }
+    
+    return k.produce(ctx, message)
+}
+
+func (k *KafkaEventBus) produce(ctx context.Context, message *kafka.Message) error {
     deliveryChan := make(chan kafka.Event)
-    err = k.producer.Produce(message, deliveryChan)
+    err := k.producer.Produce(message, deliveryChan)
     if err != nil {
         return fmt.Errorf("failed to produce message: %w", err)
     }
@@ -84,41 +283,105 @@ func (k *KafkaEventBus) Publish(ctx context.Context, event events.DomainEvent) e
     }
 }
 
-func (k *KafkaEventBus) Subscribe(ctx context.Context, topic string, handler func(events.DomainEvent) error) error {
-    err := k.consumer.Subscribe(topic, nil)
+// Subscribe consumes topics, handling up to the configured number of
+// messages at once. While the handler is slow or failing the assigned
+// partitions are paused, so work waits in Kafka rather than piling up here.
+//
+// A partition is committed only up to its oldest message not yet handled:
+// a failed message is redelivered by seeking back to it, and messages after
+// it are replayed rather than committed past it. Consumption stops when ctx
+// is done or the consumer hits a fatal error, which is passed to the
+// handler set with WithErrorHandler. Between polls the subscription carries
+// out resets requested with ResetOffsets.
+//
+// Messages an event type filter set with WithEventTypes skips on their
+// header are committed straight from the poll loop, without decoding them
+// or taking a handling slot. A start time set with WithStartTime applies
+// to each assigned partition the group has not committed an offset for.
+func (k *KafkaEventBus) Subscribe(ctx context.Context, topics []string, handler Handler, opts ...SubscribeOption) error {
+    options := newSubscribeOptions(opts)
+    err := k.consumer.SubscribeTopics(topics, func(c *kafka.Consumer, event kafka.Event) error {
+        switch e := event.(type) {
+        case kafka.AssignedPartitions:
+            log.Printf("Assigned partitions %s", describePartitions(e.Partitions))
+            if !options.startTime.IsZero() {
+                assignFrom(c, e.Partitions, options.startTime)
+            }
+        case kafka.RevokedPartitions:
+            // Let in-flight messages finish and commit before the
+            // partitions move to another consumer
+            k.handling.Wait()
+            k.offsets.revoke(e.Partitions)
+            k.forgetPartitionStats(e.Partitions)
+            if c.AssignmentLost() {
+                log.Printf("Lost partitions %s, their uncommitted messages will be redelivered", describePartitions(e.Partitions))
+            } else {
+                log.Printf("Revoked partitions %s", describePartitions(e.Partitions))
+            }
+        }
+        return nil
+    })
     if err != nil {
-        return fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
+        return fmt.Errorf("failed to subscribe to topics %v: %w", topics, err)
     }
     
+    pressure := newBackpressure(k.backpressure)
+    
+    k.consuming.Store(true)
+    k.subscriptions.Add(1)
     go func() {
+        defer k.subscriptions.Done()
         defer k.consumer.Close()
+        defer k.handling.Wait()
+        defer k.consuming.Store(false)
         
-        for {
+        lastStats := time.Now()
+        for ctx.Err() == nil {
             select {
-            case <-ctx.Done():
-                return
+            case req := <-k.resets:
+                req.done <- k.performReset(req)
             default:
-                msg, err := k.consumer.ReadMessage(-1)
-                if err != nil {
-                    log.Printf("Error reading message: %v", err)
+            }
+            if time.Since(lastStats) >= partitionStatsInterval {
+                k.publishPartitionStats()
+                lastStats = time.Now()
+            }
+            
+            // Partitions assigned by a rebalance start unpaused, so the
+            // whole assignment is paused again on every pass
+            if paused, changed := pressure.evaluate(); paused || changed {
+                k.setPaused(paused)
+            }
+            
+            switch e := k.consumer.Poll(int(pollTimeout / time.Millisecond)).(type) {
+            case *kafka.Message:
+                if e.TopicPartition.Error != nil {
+                    log.Printf("Error consuming from %s: %v", e.TopicPartition, e.TopicPartition.Error)
                     continue
                 }
-                
-                var event events.DomainEvent
-                if err := json.Unmarshal(msg.Value, &event); err != nil {
-                    log.Printf("Error unmarshaling event: %v", err)
+                if options.skipsHeader(headerValue(e, EventTypeHeader), k.registry) {
+                    k.offsets.start(e.TopicPartition)
+                    k.settle(ctx, e, k.offsets, nil, false)
                     continue
                 }
-                
-                if err := handler(event); err != nil {
-                    log.Printf("Error handling event: %v", err)
-                    // In production, you might want to send to a dead letter queue
-                    continue
+                if !pressure.acquire(ctx) {
+                    return
+                }
+                k.offsets.start(e.TopicPartition)
+                k.handling.Add(1)
+                go func() {
+                    defer k.handling.Done()
+                    started := time.Now()
+                    err := k.handleMessage(ctx, e, handler, options, k.offsets)
+                    pressure.release(time.Since(started), err)
+                }()
+            case kafka.Error:
+                if e.IsFatal() {
+                    k.onError(fmt.Errorf("kafka consumer stopped: %w", e))
+                    return
                 }
-                
-                // Commit the message after successful processing
-                if _, err := k.consumer.CommitMessage(msg); err != nil {
-                    log.Printf("Error committing message: %v", err)
+                if !e.IsTimeout() {
+                    log.Printf("Kafka consumer error: %v", e)
                 }
             }
         }
@@ -127,8 +390,178 @@ func (k *KafkaEventBus) Subscribe(ctx context.Context, topic string, handler fun
     return nil
 }
 
+// handleMessage decodes and handles msg, then commits or schedules its
+// redelivery. Messages that will fail the same way on every redelivery are
+// dead lettered instead.
+func (k *KafkaEventBus) handleMessage(ctx context.Context, msg *kafka.Message, handler Handler, options subscribeOptions, offsets *offsetTracker) error {
+    event, err := k.registry.Unmarshal(headerValue(msg, EventTypeHeader), msg.Value)
+    var unknown *events.UnknownEventTypeError
+    if errors.As(err, &unknown) {
+        // Events of types this consumer does not know are skipped unless
+        // the subscription is strict
+        if options.rejectsUnknown(unknown) {
+            k.settle(ctx, msg, offsets, err, true)
+            return err
+        }
+        k.settle(ctx, msg, offsets, nil, false)
+        return nil
+    }
+    if err != nil {
+        log.Printf("Error unmarshaling event: %v", err)
+        if errors.Is(err, events.ErrInvalidEvent) {
+            k.settle(ctx, msg, offsets, err, true)
+            return err
+        }
+        k.settle(ctx, msg, offsets, nil, false)
+        return nil
+    }
+    if options.skips(event.Type()) {
+        k.settle(ctx, msg, offsets, nil, false)
+        return nil
+    }
+    
+    msgCtx, cancel := context.WithTimeout(ctx, k.handlerTimeout)
+    defer cancel()
+    msgCtx = tracing.ContextWithTraceparent(msgCtx, headerValue(msg, tracing.TraceparentHeader))
+    msgCtx, span := k.tracer.Start(msgCtx, "consume "+event.Type(), trace.WithSpanKind(trace.SpanKindConsumer))
+    defer span.End()
+    
+    err = recovery.Guard(msgCtx, "event-consumer", describe(event), func() error {
+        return handler(msgCtx, event)
+    })
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+        log.Printf("Error handling event: %v", err)
+        if logredact.PayloadLogging() {
+            log.Printf("Failed event payload: %s", logredact.Value(event))
+        }
+    }
+    k.settle(ctx, msg, offsets, err, errors.Is(err, events.ErrInvalidEvent) || errors.Is(err, recovery.ErrPanic))
+    return err
+}
+
+// settle commits msg if it was handled or dead lettered, and otherwise
+// seeks its partition back so it is redelivered.
+func (k *KafkaEventBus) settle(ctx context.Context, msg *kafka.Message, offsets *offsetTracker, handleErr error, deadLetter bool) {
+    if handleErr != nil && deadLetter {
+        if err := k.deadLetter(ctx, msg, handleErr); err == nil {
+            handleErr = nil
+        }
+    }
+    
+    if handleErr != nil {
+        if ctx.Err() != nil {
+            // Shutting down; the uncommitted message is redelivered on restart
+            return
+        }
+        retry := msg.TopicPartition
+        retry.Offset = offsets.failed(msg.TopicPartition)
+        if err := k.consumer.Seek(retry, 0); err != nil {
+            log.Printf("Error seeking %s back for redelivery: %v", retry, err)
+        }
+        return
+    }
+    
+    if offset, ok := offsets.succeeded(msg.TopicPartition); ok {
+        commit := msg.TopicPartition
+        commit.Offset = offset
+        if _, err := k.consumer.CommitOffsets([]kafka.TopicPartition{commit}); err != nil {
+            log.Printf("Error committing %s: %v", commit, err)
+        }
+    }
+}
+
+// setPaused pauses or resumes every partition currently assigned to the
+// consumer.
+func (k *KafkaEventBus) setPaused(paused bool) {
+    partitions, err := k.consumer.Assignment()
+    if err != nil {
+        log.Printf("Error reading partition assignment: %v", err)
+        return
+    }
+    if len(partitions) == 0 {
+        return
+    }
+    
+    if paused {
+        err = k.consumer.Pause(partitions)
+    } else {
+        err = k.consumer.Resume(partitions)
+    }
+    if err != nil {
+        log.Printf("Error setting partitions paused=%t: %v", paused, err)
+    }
+}
+
+// deadLetter copies msg to its topic's dead letter topic with the reason in
+// a header, so the consumer can commit it and move on.
+func (k *KafkaEventBus) deadLetter(ctx context.Context, msg *kafka.Message, reason error) error {
+    dlqTopic := *msg.TopicPartition.Topic + k.deadLetterSuffix
+    dlqMessage := &kafka.Message{
+        TopicPartition: kafka.TopicPartition{
+            Topic:     &dlqTopic,
+            Partition: kafka.PartitionAny,
+        },
+        Key:     msg.Key,
+        Value:   msg.Value,
+        Headers: append(msg.Headers, kafka.Header{Key: "dlq-reason", Value: []byte(reason.Error())}),
+    }
+    
+    if err := k.produce(ctx, dlqMessage); err != nil {
+        log.Printf("Error sending message to dead letter topic %s: %v", dlqTopic, err)
+        return err
+    }
+    return nil
+}
+
+// describePartitions lists partitions as topic[partition] for logs.
+func describePartitions(partitions []kafka.TopicPartition) string {
+    names := make([]string, len(partitions))
+    for i, tp := range partitions {
+        names[i] = fmt.Sprintf("%s[%d]", *tp.Topic, tp.Partition)
+    }
+    return "[" + strings.Join(names, " ") + "]"
+}
+
+func headerValue(msg *kafka.Message, key string) string {
+    for _, header := range msg.Headers {
+        if header.Key == key {
+            return string(header.Value)
+        }
+    }
+    return ""
+}
+
+// closeFlushTimeout bounds how long Close waits for messages still in
+// flight, such as those whose publish was cancelled, to be delivered.
+const closeFlushTimeout = 10 * time.Second
+
+// Close flushes the producer's undelivered messages, logging any still
+// left after closeFlushTimeout, and closes the producer and consumer.
+// Drain waits for the poll loops to stop, which they do once their
+// subscription's context is done and their in-flight messages are handled
+// and committed.
+func (k *KafkaEventBus) Drain(ctx context.Context) error {
+    done := make(chan struct{})
+    go func() {
+        k.subscriptions.Wait()
+        close(done)
+    }()
+    
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
 func (k *KafkaEventBus) Close() error {
-    if k.producer != nil {
+    if k.producer != nil && !k.sharedProducer {
+        if remaining := k.producer.Flush(int(closeFlushTimeout / time.Millisecond)); remaining > 0 {
+            log.Printf("Closing Kafka producer with %d messages undelivered", remaining)
+        }
         k.producer.Close()
     }
     if k.consumer != nil {
@@ -0,0 +1,75 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// newMockKafka starts an in-process Kafka cluster with topic.
+func newMockKafka(t *testing.T, topic string) string {
+    t.Helper()
+    cluster, err := kafka.NewMockCluster(1)
+    if err != nil {
+        t.Skipf("mock Kafka cluster unavailable: %v", err)
+    }
+    t.Cleanup(cluster.Close)
+    if err := cluster.CreateTopic(topic, 1, 1); err != nil {
+        t.Fatalf("CreateTopic() = %v", err)
+    }
+    return cluster.BootstrapServers()
+}
+
+// The consumer handles published events, and stops polling soon after its
+// context is done instead of blocking on the next message.
+func TestKafkaEventBus_Subscribe_stopsPromptly(t *testing.T) {
+    brokers := newMockKafka(t, DefaultTopic)
+    bus := NewKafkaEventBus(brokers, WithGroupID("test-group"))
+    defer bus.Close()
+    
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    published := events.NewOrderCreatedEvent(order)
+    if err := bus.Publish(context.Background(), published); err != nil {
+        t.Fatalf("Publish() = %v", err)
+    }
+    
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    handled := make(chan string, 1)
+    err = bus.Subscribe(ctx, []string{DefaultTopic}, func(_ context.Context, event events.DomainEvent) error {
+        handled <- event.EventID()
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Subscribe() = %v", err)
+    }
+    
+    select {
+    case id := <-handled:
+        if id != published.EventID() {
+            t.Errorf("handled event %s, want %s", id, published.EventID())
+        }
+    case <-time.After(30 * time.Second):
+        t.Fatal("published event was not handled")
+    }
+    
+    cancel()
+    stopped := time.Now()
+    drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer drainCancel()
+    if err := bus.Drain(drainCtx); err != nil {
+        t.Fatalf("Drain() = %v, want the subscription stopped", err)
+    }
+    if elapsed := time.Since(stopped); elapsed > time.Second+pollTimeout {
+        t.Errorf("subscription took %s to stop", elapsed)
+    }
+}
@@ -0,0 +1,279 @@
+package eventbus
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// adminTimeout bounds each broker request made to inspect or reset offsets.
+const adminTimeout = 5 * time.Second
+
+// partitionStatsInterval is how often the poll loop refreshes the
+// "consumer_partitions" expvar.
+const partitionStatsInterval = 10 * time.Second
+
+// partitionStats is published as the "consumer_partitions" expvar: for each
+// assigned partition, as group/topic[partition], the next offset to fetch, the
+// high watermark and the lag between them, from the consumer's local state.
+var partitionStats = expvar.NewMap("consumer_partitions")
+
+// resetRequest hands a reset to the poll loop, which carries it out between
+// polls so no message is dispatched while partitions are moved.
+type resetRequest struct {
+    ctx         context.Context
+    reset       OffsetReset
+    whilePaused func(ctx context.Context) error
+    done        chan resetResult
+}
+
+type resetResult struct {
+    offsets []PartitionOffsets
+    err     error
+}
+
+var _ OffsetController = (*KafkaEventBus)(nil)
+
+// Offsets lists the committed and watermark offsets of the partitions
+// assigned to the consumer, asking the brokers for both.
+func (k *KafkaEventBus) Offsets(ctx context.Context) ([]PartitionOffsets, error) {
+    assigned, err := k.consumer.Assignment()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read partition assignment: %w", err)
+    }
+    if len(assigned) == 0 {
+        return []PartitionOffsets{}, nil
+    }
+    
+    committed, err := k.consumer.Committed(assigned, timeoutMs(ctx))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read committed offsets: %w", err)
+    }
+    
+    offsets := make([]PartitionOffsets, 0, len(committed))
+    for _, tp := range committed {
+        low, high, err := k.consumer.QueryWatermarkOffsets(*tp.Topic, tp.Partition, timeoutMs(ctx))
+        if err != nil {
+            return nil, fmt.Errorf("failed to read watermarks of %s[%d]: %w", *tp.Topic, tp.Partition, err)
+        }
+        var committedOffset *int64
+        if tp.Offset >= 0 {
+            offset := int64(tp.Offset)
+            committedOffset = &offset
+        }
+        offsets = append(offsets, newPartitionOffsets(*tp.Topic, tp.Partition, committedOffset, low, high))
+    }
+    return offsets, nil
+}
+
+// ResetOffsets asks the running subscription to reset reset.Topic. Only the
+// partitions assigned to this consumer are moved; with several consumers
+// in the group, set AllPartitions or reset each of them.
+func (k *KafkaEventBus) ResetOffsets(ctx context.Context, reset OffsetReset, whilePaused func(ctx context.Context) error) ([]PartitionOffsets, error) {
+    if err := reset.Validate(); err != nil {
+        return nil, err
+    }
+    if !k.consuming.Load() {
+        return nil, ErrNotConsuming
+    }
+    
+    req := &resetRequest{ctx: ctx, reset: reset, whilePaused: whilePaused, done: make(chan resetResult, 1)}
+    select {
+    case k.resets <- req:
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+    
+    select {
+    case result := <-req.done:
+        return result.offsets, result.err
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+// performReset runs on the poll loop. In-flight messages finish first so
+// none commits its old offset after the seek.
+func (k *KafkaEventBus) performReset(req *resetRequest) resetResult {
+    k.handling.Wait()
+    
+    partitions, err := k.resetPartitions(req.ctx, req.reset)
+    if err != nil {
+        return resetResult{err: err}
+    }
+    
+    if err := k.consumer.Pause(partitions); err != nil {
+        return resetResult{err: fmt.Errorf("failed to pause %s: %w", describePartitions(partitions), err)}
+    }
+    defer func() {
+        // The poll loop pauses them again if backpressure calls for it
+        if err := k.consumer.Resume(partitions); err != nil {
+            log.Printf("Error resuming %s after offset reset: %v", describePartitions(partitions), err)
+        }
+    }()
+    
+    targets, offsets, err := k.resetTargets(req.ctx, req.reset, partitions)
+    if err != nil {
+        return resetResult{err: err}
+    }
+    
+    sought, err := k.consumer.SeekPartitions(targets)
+    if err != nil {
+        return resetResult{err: fmt.Errorf("failed to seek %s: %w", describePartitions(targets), err)}
+    }
+    for _, tp := range sought {
+        if tp.Error != nil {
+            return resetResult{err: fmt.Errorf("failed to seek %s[%d]: %w", *tp.Topic, tp.Partition, tp.Error)}
+        }
+    }
+    
+    // Committed too, so a restart or rebalance resumes from the new offsets
+    if _, err := k.consumer.CommitOffsets(targets); err != nil {
+        return resetResult{err: fmt.Errorf("failed to commit reset offsets: %w", err)}
+    }
+    k.offsets.revoke(targets)
+    log.Printf("Reset %s to %s", describePartitions(targets), describeReset(req.reset))
+    
+    if req.whilePaused != nil {
+        if err := req.whilePaused(req.ctx); err != nil {
+            return resetResult{offsets: offsets, err: err}
+        }
+    }
+    return resetResult{offsets: offsets}
+}
+
+// resetPartitions returns the assigned partitions of the reset's topic.
+func (k *KafkaEventBus) resetPartitions(ctx context.Context, reset OffsetReset) ([]kafka.TopicPartition, error) {
+    assigned, err := k.consumer.Assignment()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read partition assignment: %w", err)
+    }
+    
+    var partitions []kafka.TopicPartition
+    for _, tp := range assigned {
+        if *tp.Topic == reset.Topic {
+            partitions = append(partitions, tp)
+        }
+    }
+    if len(partitions) == 0 {
+        return nil, fmt.Errorf("%w: no partition of %s", ErrPartitionsNotAssigned, reset.Topic)
+    }
+    
+    if reset.AllPartitions {
+        topic := reset.Topic
+        metadata, err := k.consumer.GetMetadata(&topic, false, timeoutMs(ctx))
+        if err != nil {
+            return nil, fmt.Errorf("failed to read metadata of %s: %w", topic, err)
+        }
+        if total := len(metadata.Topics[topic].Partitions); len(partitions) < total {
+            return nil, fmt.Errorf("%w: %d of the %d partitions of %s", ErrPartitionsNotAssigned, total-len(partitions), total, topic)
+        }
+    }
+    return partitions, nil
+}
+
+// resetTargets resolves the reset to a concrete offset per partition, which
+// can be committed where the logical earliest and end offsets cannot.
+func (k *KafkaEventBus) resetTargets(ctx context.Context, reset OffsetReset, partitions []kafka.TopicPartition) ([]kafka.TopicPartition, []PartitionOffsets, error) {
+    var found []kafka.TopicPartition
+    if reset.To == ResetToTimestamp {
+        times := make([]kafka.TopicPartition, len(partitions))
+        for i, tp := range partitions {
+            times[i] = kafka.TopicPartition{Topic: tp.Topic, Partition: tp.Partition, Offset: kafka.Offset(reset.Timestamp.UnixMilli())}
+        }
+        var err error
+        found, err = k.consumer.OffsetsForTimes(times, timeoutMs(ctx))
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to look up offsets for %s: %w", reset.Timestamp.Format(time.RFC3339), err)
+        }
+    }
+    
+    targets := make([]kafka.TopicPartition, len(partitions))
+    offsets := make([]PartitionOffsets, len(partitions))
+    for i, tp := range partitions {
+        low, high, err := k.consumer.QueryWatermarkOffsets(*tp.Topic, tp.Partition, timeoutMs(ctx))
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to read watermarks of %s[%d]: %w", *tp.Topic, tp.Partition, err)
+        }
+        
+        target := low
+        if found != nil {
+            // No message at or after the time leaves nothing to replay
+            target = high
+            for _, f := range found {
+                if f.Partition == tp.Partition && f.Offset >= 0 {
+                    target = int64(f.Offset)
+                }
+            }
+        }
+        
+        targets[i] = kafka.TopicPartition{Topic: tp.Topic, Partition: tp.Partition, Offset: kafka.Offset(target)}
+        offsets[i] = newPartitionOffsets(*tp.Topic, tp.Partition, &target, low, high)
+    }
+    return targets, offsets, nil
+}
+
+// publishPartitionStats refreshes the "consumer_partitions" expvar from the
+// consumer's local state, without asking the brokers.
+func (k *KafkaEventBus) publishPartitionStats() {
+    assigned, err := k.consumer.Assignment()
+    if err != nil || len(assigned) == 0 {
+        return
+    }
+    positions, err := k.consumer.Position(assigned)
+    if err != nil {
+        return
+    }
+    
+    for _, tp := range positions {
+        _, high, err := k.consumer.GetWatermarkOffsets(*tp.Topic, tp.Partition)
+        if err != nil || tp.Offset < 0 {
+            continue
+        }
+        stats := new(expvar.Map)
+        stats.Set("position", intVar(int64(tp.Offset)))
+        stats.Set("high_watermark", intVar(high))
+        stats.Set("lag", intVar(high-int64(tp.Offset)))
+        partitionStats.Set(k.partitionStatsKey(tp), stats)
+    }
+}
+
+// forgetPartitionStats drops revoked partitions from "consumer_partitions".
+func (k *KafkaEventBus) forgetPartitionStats(partitions []kafka.TopicPartition) {
+    for _, tp := range partitions {
+        partitionStats.Delete(k.partitionStatsKey(tp))
+    }
+}
+
+func (k *KafkaEventBus) partitionStatsKey(tp kafka.TopicPartition) string {
+    return fmt.Sprintf("%s/%s[%d]", k.groupID, *tp.Topic, tp.Partition)
+}
+
+func intVar(value int64) *expvar.Int {
+    v := new(expvar.Int)
+    v.Set(value)
+    return v
+}
+
+// timeoutMs is adminTimeout in milliseconds, shortened to ctx's deadline.
+func timeoutMs(ctx context.Context) int {
+    timeout := adminTimeout
+    if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+        timeout = time.Until(deadline)
+    }
+    if timeout < time.Millisecond {
+        return 1
+    }
+    return int(timeout / time.Millisecond)
+}
+
+func describeReset(reset OffsetReset) string {
+    if reset.To == ResetToTimestamp {
+        return reset.Timestamp.UTC().Format(time.RFC3339)
+    }
+    return string(reset.To)
+}
@@ -0,0 +1,84 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Resetting to earliest seeks back to the first message, commits it and
+// runs whilePaused, so every event is handled again.
+func TestKafkaEventBus_ResetOffsets(t *testing.T) {
+    brokers := newMockKafka(t, DefaultTopic)
+    bus := NewKafkaEventBus(brokers, WithGroupID("test-group"))
+    defer bus.Close()
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    
+    reset := OffsetReset{Topic: DefaultTopic, To: ResetToEarliest}
+    if _, err := bus.ResetOffsets(ctx, reset, nil); !errors.Is(err, ErrNotConsuming) {
+        t.Fatalf("ResetOffsets() before subscribing = %v, want %v", err, ErrNotConsuming)
+    }
+    
+    var published []string
+    for i := 0; i < 3; i++ {
+        order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+        if err != nil {
+            t.Fatalf("NewOrder() = %v", err)
+        }
+        event := events.NewOrderCreatedEvent(order)
+        if err := bus.Publish(ctx, event); err != nil {
+            t.Fatalf("Publish() = %v", err)
+        }
+        published = append(published, event.EventID())
+    }
+    
+    handled := make(chan string, 2*len(published))
+    err := bus.Subscribe(ctx, []string{DefaultTopic}, func(_ context.Context, event events.DomainEvent) error {
+        handled <- event.EventID()
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Subscribe() = %v", err)
+    }
+    expectHandled := func(round string) {
+        t.Helper()
+        for _, want := range published {
+            select {
+            case id := <-handled:
+                if id != want {
+                    t.Fatalf("%s: handled %s, want %s", round, id, want)
+                }
+            case <-time.After(30 * time.Second):
+                t.Fatalf("%s: event %s was not handled", round, want)
+            }
+        }
+    }
+    expectHandled("first delivery")
+    
+    paused := false
+    offsets, err := bus.ResetOffsets(ctx, reset, func(context.Context) error {
+        paused = true
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("ResetOffsets() = %v", err)
+    }
+    if !paused {
+        t.Error("ResetOffsets() did not run whilePaused")
+    }
+    if len(offsets) != 1 || offsets[0].Committed == nil || *offsets[0].Committed != offsets[0].LowWatermark || offsets[0].HighWatermark != int64(len(published)) {
+        t.Errorf("ResetOffsets() = %+v, want the partition committed at its low watermark, with 3 messages", offsets)
+    }
+    expectHandled("after the reset")
+    
+    // A reset needing partitions the topic does not have assigned here
+    if _, err := bus.ResetOffsets(ctx, OffsetReset{Topic: "other", To: ResetToEarliest}, nil); !errors.Is(err, ErrPartitionsNotAssigned) {
+        t.Errorf("ResetOffsets() of an unassigned topic = %v, want %v", err, ErrPartitionsNotAssigned)
+    }
+}
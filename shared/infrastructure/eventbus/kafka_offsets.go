@@ -0,0 +1,126 @@
+package eventbus
+
+import (
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// offsetTracker decides how far each partition may be committed while
+// messages are handled concurrently and some fail. A partition is never
+// committed past a message still in flight or awaiting redelivery after a
+// failure, so a restart or rebalance cannot skip an unhandled message.
+type offsetTracker struct {
+    mu         sync.Mutex
+    partitions map[partitionKey]*partitionOffsets
+}
+
+type partitionKey struct {
+    topic     string
+    partition int32
+}
+
+type partitionOffsets struct {
+    inFlight map[kafka.Offset]struct{}
+    failed   map[kafka.Offset]struct{}
+    // handled is one past the newest message handled successfully
+    handled kafka.Offset
+    // committed is the offset last committed, the next message a new owner
+    // of the partition would read
+    committed kafka.Offset
+}
+
+func newOffsetTracker() *offsetTracker {
+    return &offsetTracker{partitions: make(map[partitionKey]*partitionOffsets)}
+}
+
+func keyOf(tp kafka.TopicPartition) partitionKey {
+    return partitionKey{topic: *tp.Topic, partition: tp.Partition}
+}
+
+// start records that the message at tp is being handled.
+func (t *offsetTracker) start(tp kafka.TopicPartition) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    
+    p, ok := t.partitions[keyOf(tp)]
+    if !ok {
+        p = &partitionOffsets{
+            inFlight:  make(map[kafka.Offset]struct{}),
+            failed:    make(map[kafka.Offset]struct{}),
+            handled:   tp.Offset,
+            committed: tp.Offset,
+        }
+        t.partitions[keyOf(tp)] = p
+    }
+    p.inFlight[tp.Offset] = struct{}{}
+}
+
+// succeeded records that the message at tp was handled, and returns the
+// offset its partition may now be committed to, if that moved.
+func (t *offsetTracker) succeeded(tp kafka.TopicPartition) (kafka.Offset, bool) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    
+    p, ok := t.partitions[keyOf(tp)]
+    if !ok {
+        // The partition was revoked while the message was in flight
+        return 0, false
+    }
+    delete(p.inFlight, tp.Offset)
+    delete(p.failed, tp.Offset)
+    if tp.Offset+1 > p.handled {
+        p.handled = tp.Offset + 1
+    }
+    
+    commit := p.handled
+    for offset := range p.inFlight {
+        if offset < commit {
+            commit = offset
+        }
+    }
+    for offset := range p.failed {
+        if offset < commit {
+            commit = offset
+        }
+    }
+    if commit <= p.committed {
+        return 0, false
+    }
+    p.committed = commit
+    return commit, true
+}
+
+// failed records that the message at tp must be redelivered, and returns
+// the offset to seek its partition back to: the oldest failed message, so
+// every message after it is replayed too.
+func (t *offsetTracker) failed(tp kafka.TopicPartition) kafka.Offset {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    
+    p, ok := t.partitions[keyOf(tp)]
+    if !ok {
+        return tp.Offset
+    }
+    delete(p.inFlight, tp.Offset)
+    p.failed[tp.Offset] = struct{}{}
+    
+    retryFrom := tp.Offset
+    for offset := range p.failed {
+        if offset < retryFrom {
+            retryFrom = offset
+        }
+    }
+    return retryFrom
+}
+
+// revoke forgets partitions that moved to another consumer, which resumes
+// them from their committed offsets.
+func (t *offsetTracker) revoke(partitions []kafka.TopicPartition) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    
+    for _, tp := range partitions {
+        delete(t.partitions, keyOf(tp))
+    }
+}
@@ -0,0 +1,80 @@
+package eventbus
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+func TestOffsetTracker(t *testing.T) {
+    topic := "orders"
+    at := func(offset kafka.Offset) kafka.TopicPartition {
+        return kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: offset}
+    }
+    type commit struct {
+        offset kafka.Offset
+        ok     bool
+    }
+    
+    tracker := newOffsetTracker()
+    for offset := kafka.Offset(10); offset < 15; offset++ {
+        tracker.start(at(offset))
+    }
+    steps := []struct {
+        name string
+        run  func() commit
+        want commit
+    }{
+        // Handled out of order, 11 waits for 10
+        {name: "11 handled while 10 is in flight", run: func() commit { o, ok := tracker.succeeded(at(11)); return commit{o, ok} }},
+        {name: "10 handled", run: func() commit { o, ok := tracker.succeeded(at(10)); return commit{o, ok} }, want: commit{12, true}},
+        // A failure holds the commit back and is retried from
+        {name: "12 fails", run: func() commit { return commit{tracker.failed(at(12)), true} }, want: commit{12, true}},
+        {name: "14 handled past the failure", run: func() commit { o, ok := tracker.succeeded(at(14)); return commit{o, ok} }},
+        {name: "13 fails, retried from 12", run: func() commit { return commit{tracker.failed(at(13)), true} }, want: commit{12, true}},
+        {name: "redelivered 12 handled", run: func() commit {
+            tracker.start(at(12))
+            o, ok := tracker.succeeded(at(12))
+            return commit{o, ok}
+        }, want: commit{13, true}},
+        {name: "redelivered 13 handled", run: func() commit {
+            tracker.start(at(13))
+            o, ok := tracker.succeeded(at(13))
+            return commit{o, ok}
+        }, want: commit{15, true}},
+        // Redelivering 14 again does not move the commit back
+        {name: "14 handled again", run: func() commit {
+            tracker.start(at(14))
+            o, ok := tracker.succeeded(at(14))
+            return commit{o, ok}
+        }},
+    }
+    
+    for _, step := range steps {
+        if got := step.run(); got != step.want {
+            t.Fatalf("%s: commit = %+v, want %+v", step.name, got, step.want)
+        }
+    }
+}
+
+// Messages finishing after their partition was revoked commit nothing, as
+// the partition's new owner resumes from the committed offset.
+func TestOffsetTracker_revoke(t *testing.T) {
+    topic := "orders"
+    kept := kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 5}
+    revoked := kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 7}
+    tracker := newOffsetTracker()
+    tracker.start(kept)
+    tracker.start(revoked)
+    
+    tracker.revoke([]kafka.TopicPartition{revoked})
+    if offset, ok := tracker.succeeded(revoked); ok {
+        t.Errorf("succeeded() on a revoked partition = %d, want no commit", offset)
+    }
+    if offset := tracker.failed(revoked); offset != 7 {
+        t.Errorf("failed() on a revoked partition = %d, want its own offset", offset)
+    }
+    if offset, ok := tracker.succeeded(kept); !ok || offset != 6 {
+        t.Errorf("succeeded() on a kept partition = %d, %v, want 6", offset, ok)
+    }
+}
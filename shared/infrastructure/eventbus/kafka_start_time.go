@@ -0,0 +1,68 @@
+package eventbus
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// assignFrom assigns partitions from a rebalance, starting those the group
+// has no committed offset for at the first message at or after startTime,
+// or at their end when there is none yet. The others resume from their
+// committed offsets. When the offsets cannot be looked up the assignment
+// is left to the consumer, which starts such partitions at the earliest
+// retained message.
+func assignFrom(c *kafka.Consumer, partitions []kafka.TopicPartition, startTime time.Time) {
+    ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+    defer cancel()
+    
+    committed, err := c.Committed(partitions, timeoutMs(ctx))
+    if err != nil {
+        log.Printf("Failed to read committed offsets of %s, new partitions start at the earliest message: %v", describePartitions(partitions), err)
+        return
+    }
+    
+    var times []kafka.TopicPartition
+    for _, tp := range committed {
+        if tp.Offset < 0 {
+            times = append(times, kafka.TopicPartition{Topic: tp.Topic, Partition: tp.Partition, Offset: kafka.Offset(startTime.UnixMilli())})
+        }
+    }
+    if len(times) == 0 {
+        return
+    }
+    
+    found, err := c.OffsetsForTimes(times, timeoutMs(ctx))
+    if err != nil {
+        log.Printf("Failed to look up offsets of %s at %s, they start at the earliest message: %v", describePartitions(times), startTime.Format(time.RFC3339), err)
+        return
+    }
+    
+    assignment := make([]kafka.TopicPartition, len(partitions))
+    for i, tp := range partitions {
+        assignment[i] = kafka.TopicPartition{Topic: tp.Topic, Partition: tp.Partition, Offset: kafka.OffsetStored}
+        for _, f := range found {
+            if *f.Topic != *tp.Topic || f.Partition != tp.Partition {
+                continue
+            }
+            // No message at or after the time yet
+            assignment[i].Offset = kafka.OffsetEnd
+            if f.Offset >= 0 {
+                assignment[i].Offset = f.Offset
+            }
+        }
+    }
+    
+    if c.GetRebalanceProtocol() == "COOPERATIVE" {
+        err = c.IncrementalAssign(assignment)
+    } else {
+        err = c.Assign(assignment)
+    }
+    if err != nil {
+        log.Printf("Failed to assign %s from %s: %v", describePartitions(assignment), startTime.Format(time.RFC3339), err)
+        return
+    }
+    log.Printf("Partitions %s new to the group start at %s", describePartitions(times), startTime.Format(time.RFC3339))
+}
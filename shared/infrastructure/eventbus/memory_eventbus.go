@@ -0,0 +1,95 @@
+package eventbus
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/logredact"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+)
+
+// InMemoryEventBus delivers events synchronously to in-process subscribers.
+// It is meant for tests and single-process development setups.
+type InMemoryEventBus struct {
+    mu             sync.RWMutex
+    subscriptions  map[string][]subscription
+    topicResolver  TopicResolver
+    handlerTimeout time.Duration
+}
+
+type subscription struct {
+    ctx     context.Context
+    handler Handler
+    options subscribeOptions
+}
+
+// NewInMemoryEventBus returns an in-memory bus routing events with resolver,
+// or to DefaultTopic when resolver is nil.
+func NewInMemoryEventBus(resolver TopicResolver) *InMemoryEventBus {
+    if resolver == nil {
+        resolver = DefaultTopicResolver
+    }
+    
+    return &InMemoryEventBus{
+        subscriptions:  make(map[string][]subscription),
+        topicResolver:  resolver,
+        handlerTimeout: DefaultHandlerTimeout,
+    }
+}
+
+func (b *InMemoryEventBus) Publish(ctx context.Context, event events.DomainEvent) error {
+    return b.PublishTo(ctx, b.topicResolver(event), event)
+}
+
+// PublishTo runs every live subscriber of topic before returning. Handler
+// errors are logged, matching a broker where publishing succeeds regardless
+// of how consumers fare.
+func (b *InMemoryEventBus) PublishTo(ctx context.Context, topic string, event events.DomainEvent) error {
+    b.mu.RLock()
+    subs := b.subscriptions[topic]
+    b.mu.RUnlock()
+    
+    for _, sub := range subs {
+        if sub.ctx.Err() != nil || sub.options.skips(event.Type()) {
+            continue
+        }
+        
+        msgCtx, cancel := context.WithTimeout(sub.ctx, b.handlerTimeout)
+        err := recovery.Guard(msgCtx, "event-consumer", describe(event), func() error {
+            return sub.handler(msgCtx, event)
+        })
+        cancel()
+        if err != nil {
+            log.Printf("Error handling event %s on topic %s: %v", event.Type(), topic, err)
+            if logredact.PayloadLogging() {
+                log.Printf("Failed event payload: %s", logredact.Value(event))
+            }
+        }
+    }
+    
+    return nil
+}
+
+// Subscribe registers handler for topics until ctx is done.
+func (b *InMemoryEventBus) Subscribe(ctx context.Context, topics []string, handler Handler, opts ...SubscribeOption) error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    
+    sub := subscription{ctx: ctx, handler: handler, options: newSubscribeOptions(opts)}
+    for _, topic := range topics {
+        b.subscriptions[topic] = append(b.subscriptions[topic], sub)
+    }
+    
+    return nil
+}
+
+func (b *InMemoryEventBus) Close() error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    
+    b.subscriptions = make(map[string][]subscription)
+    return nil
+}
@@ -0,0 +1,152 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+func TestInMemoryEventBus_messageContext(t *testing.T) {
+    tests := []struct {
+        name    string
+        timeout time.Duration
+        // before runs ahead of the publish, cancel being the subscription's
+        before  func(cancel context.CancelFunc)
+        // handle is the handler's work; it returns the error it saw
+        handle  func(ctx context.Context, cancel context.CancelFunc) error
+        wantRun bool
+        wantErr error
+    }{
+        {
+            name:    "live subscription",
+            timeout: time.Minute,
+            handle:  func(ctx context.Context, _ context.CancelFunc) error { return ctx.Err() },
+            wantRun: true,
+        },
+        {
+            name:    "root cancelled before the message",
+            timeout: time.Minute,
+            before:  func(cancel context.CancelFunc) { cancel() },
+            handle:  func(ctx context.Context, _ context.CancelFunc) error { return ctx.Err() },
+        },
+        {
+            name:    "root cancelled while handling",
+            timeout: time.Minute,
+            handle: func(ctx context.Context, cancel context.CancelFunc) error {
+                cancel()
+                <-ctx.Done()
+                return ctx.Err()
+            },
+            wantRun: true,
+            wantErr: context.Canceled,
+        },
+        {
+            name:    "handler past its timeout",
+            timeout: 10 * time.Millisecond,
+            handle: func(ctx context.Context, _ context.CancelFunc) error {
+                <-ctx.Done()
+                return ctx.Err()
+            },
+            wantRun: true,
+            wantErr: context.DeadlineExceeded,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bus := NewInMemoryEventBus(nil)
+            bus.handlerTimeout = tt.timeout
+            root, cancel := context.WithCancel(context.Background())
+            defer cancel()
+            
+            ran := false
+            var seen error
+            var deadline time.Time
+            err := bus.Subscribe(root, []string{DefaultTopic}, func(ctx context.Context, _ events.DomainEvent) error {
+                ran = true
+                deadline, _ = ctx.Deadline()
+                seen = tt.handle(ctx, cancel)
+                return seen
+            })
+            if err != nil {
+                t.Fatalf("Subscribe() = %v", err)
+            }
+            if tt.before != nil {
+                tt.before(cancel)
+            }
+            
+            start := time.Now()
+            if err := bus.Publish(context.Background(), events.NewCustomerFirstOrderEvent("customer-1", "order-1")); err != nil {
+                t.Fatalf("Publish() = %v", err)
+            }
+            end := time.Now()
+            
+            if ran != tt.wantRun {
+                t.Fatalf("handler ran = %t, want %t", ran, tt.wantRun)
+            }
+            if !ran {
+                return
+            }
+            if !errors.Is(seen, tt.wantErr) {
+                t.Errorf("handler saw %v, want %v", seen, tt.wantErr)
+            }
+            if deadline.Before(start.Add(tt.timeout)) || deadline.After(end.Add(tt.timeout)) {
+                t.Errorf("message deadline = %v, want %s after the publish", deadline, tt.timeout)
+            }
+        })
+    }
+}
+
+func TestInMemoryEventBus_Publish_handlerErrorsStayWithTheConsumer(t *testing.T) {
+    bus := NewInMemoryEventBus(nil)
+    calls := 0
+    failing := func(context.Context, events.DomainEvent) error {
+        calls++
+        return errors.New("projection failed")
+    }
+    panicking := func(context.Context, events.DomainEvent) error {
+        calls++
+        panic("projection bug")
+    }
+    for _, handler := range []Handler{failing, panicking, failing} {
+        if err := bus.Subscribe(context.Background(), []string{DefaultTopic}, handler); err != nil {
+            t.Fatalf("Subscribe() = %v", err)
+        }
+    }
+    
+    if err := bus.Publish(context.Background(), events.NewCustomerFirstOrderEvent("customer-1", "order-1")); err != nil {
+        t.Errorf("Publish() = %v, want nil whatever the handlers return", err)
+    }
+    if calls != 3 {
+        t.Errorf("%d handlers ran, want all 3", calls)
+    }
+}
+
+// A projection panicking on one event goes on to handle the next.
+func TestInMemoryEventBus_handlerPanic(t *testing.T) {
+    ctx := context.Background()
+    bus := NewInMemoryEventBus(nil)
+    var handled []string
+    err := bus.Subscribe(ctx, []string{DefaultTopic}, func(_ context.Context, event events.DomainEvent) error {
+        if event.AggregateID() == "order-bad" {
+            panic("projection bug")
+        }
+        handled = append(handled, event.AggregateID())
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Subscribe() = %v", err)
+    }
+    
+    for _, id := range []string{"order-bad", "order-good"} {
+        if err := bus.Publish(ctx, events.BaseDomainEvent{EventType: "OrderCreated", AggregateIDValue: id}); err != nil {
+            t.Fatalf("Publish(%s) = %v", id, err)
+        }
+    }
+    if len(handled) != 1 || handled[0] != "order-good" {
+        t.Errorf("handled %v, want [order-good]", handled)
+    }
+}
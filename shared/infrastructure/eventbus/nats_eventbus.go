@@ -0,0 +1,378 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/logredact"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NATSConfig configures a JetStream event bus. Topics become subject
+// prefixes: an event for aggregate A published to topic T is sent on
+// subject T.A, so each aggregate's events stay ordered within the stream.
+type NATSConfig struct {
+    URL            string
+    Stream         string
+    Durable        string
+    Topics         []string
+    ReconnectWait  time.Duration
+    HandlerTimeout time.Duration
+    TopicResolver  TopicResolver
+    Registry       *events.Registry
+    // CompressAbove gzips payloads larger than this many bytes; zero
+    // disables compression
+    CompressAbove int
+}
+
+// NATSConfigFromEnv reads NATS_URL, NATS_STREAM, NATS_DURABLE and
+// EVENT_COMPRESSION_THRESHOLD. durable is the default consumer name, the
+// JetStream equivalent of a Kafka group.
+func NATSConfigFromEnv(durable string, topics TopicConfig) NATSConfig {
+    cfg := NATSConfig{
+        URL:           nats.DefaultURL,
+        Stream:        "ORDERS",
+        Durable:       durable,
+        Topics:        topics.All(),
+        TopicResolver: topics.Resolver(),
+    }
+    
+    if url := os.Getenv("NATS_URL"); url != "" {
+        cfg.URL = url
+    }
+    if stream := os.Getenv("NATS_STREAM"); stream != "" {
+        cfg.Stream = stream
+    }
+    if durable := os.Getenv("NATS_DURABLE"); durable != "" {
+        cfg.Durable = durable
+    }
+    if threshold, err := strconv.Atoi(os.Getenv("EVENT_COMPRESSION_THRESHOLD")); err == nil {
+        cfg.CompressAbove = threshold
+    }
+    
+    return cfg
+}
+
+type NATSEventBus struct {
+    conn           *nats.Conn
+    js             jetstream.JetStream
+    stream         string
+    durable        string
+    handlerTimeout time.Duration
+    topicResolver  TopicResolver
+    registry       *events.Registry
+    compressAbove  int
+    tracer         trace.Tracer
+    // sharedConn is set on buses returned by ForGroup, whose Close leaves
+    // the connection to the bus they came from
+    sharedConn     bool
+    
+    mu       sync.Mutex
+    consumes []jetstream.ConsumeContext
+}
+
+// NewNATSEventBus connects to NATS, reconnecting indefinitely on connection
+// loss, and creates or updates the stream covering cfg.Topics.
+func NewNATSEventBus(cfg NATSConfig) (*NATSEventBus, error) {
+    if cfg.ReconnectWait == 0 {
+        cfg.ReconnectWait = 2 * time.Second
+    }
+    if cfg.HandlerTimeout == 0 {
+        cfg.HandlerTimeout = DefaultHandlerTimeout
+    }
+    if cfg.TopicResolver == nil {
+        cfg.TopicResolver = DefaultTopicResolver
+    }
+    if cfg.Registry == nil {
+        cfg.Registry = events.DefaultRegistry()
+    }
+    if len(cfg.Topics) == 0 {
+        cfg.Topics = []string{DefaultTopic}
+    }
+    
+    conn, err := nats.Connect(cfg.URL,
+        nats.MaxReconnects(-1),
+        nats.ReconnectWait(cfg.ReconnectWait),
+        nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+            log.Printf("Disconnected from NATS: %v", err)
+        }),
+        nats.ReconnectHandler(func(nc *nats.Conn) {
+            log.Printf("Reconnected to NATS at %s", nc.ConnectedUrl())
+        }),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+    }
+    
+    js, err := jetstream.New(conn)
+    if err != nil {
+        conn.Close()
+        return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+    }
+    
+    subjects := make([]string, len(cfg.Topics))
+    for i, topic := range cfg.Topics {
+        subjects[i] = topic + ".>"
+    }
+    
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+        Name:     cfg.Stream,
+        Subjects: subjects,
+        Storage:  jetstream.FileStorage,
+    }); err != nil {
+        conn.Close()
+        return nil, fmt.Errorf("failed to create stream %s: %w", cfg.Stream, err)
+    }
+    
+    return &NATSEventBus{
+        conn:           conn,
+        js:             js,
+        stream:         cfg.Stream,
+        durable:        cfg.Durable,
+        handlerTimeout: cfg.HandlerTimeout,
+        topicResolver:  cfg.TopicResolver,
+        registry:       cfg.Registry,
+        compressAbove:  cfg.CompressAbove,
+        tracer:         otel.Tracer("github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"),
+    }, nil
+}
+
+func (n *NATSEventBus) Publish(ctx context.Context, event events.DomainEvent) error {
+    return n.PublishTo(ctx, n.topicResolver(event), event)
+}
+
+func (n *NATSEventBus) PublishTo(ctx context.Context, topic string, event events.DomainEvent) error {
+    eventData, err := json.Marshal(event)
+    if err != nil {
+        return fmt.Errorf("failed to marshal event: %w", err)
+    }
+    
+    eventData, encoding, err := encodePayload(eventData, n.compressAbove)
+    if err != nil {
+        return err
+    }
+    
+    msg := nats.NewMsg(subjectFor(topic, event.AggregateID()))
+    msg.Data = eventData
+    msg.Header.Set("event-id", event.EventID())
+    msg.Header.Set(EventTypeHeader, event.Type())
+    msg.Header.Set("aggregate-id", event.AggregateID())
+    if encoding != "" {
+        msg.Header.Set(ContentEncodingHeader, encoding)
+    }
+    if traceparent := tracing.Traceparent(ctx); traceparent != "" {
+        msg.Header.Set(tracing.TraceparentHeader, traceparent)
+    }
+    
+    opts := []jetstream.PublishOpt{}
+    if event.EventID() != "" {
+        // Lets the stream drop duplicates of a retried publish
+        opts = append(opts, jetstream.WithMsgID(event.EventID()))
+    }
+    
+    if _, err := n.js.PublishMsg(ctx, msg, opts...); err != nil {
+        return fmt.Errorf("failed to publish event: %w", err)
+    }
+    
+    return nil
+}
+
+// Subscribe consumes topics through a durable consumer with explicit acks:
+// a nil handler error acks the message, invalid events and handler panics
+// terminate it, and any other error naks it for redelivery.
+func (n *NATSEventBus) Subscribe(ctx context.Context, topics []string, handler Handler, opts ...SubscribeOption) error {
+    options := newSubscribeOptions(opts)
+    filters := make([]string, len(topics))
+    for i, topic := range topics {
+        filters[i] = topic + ".>"
+    }
+    
+    config := jetstream.ConsumerConfig{
+        Durable:        n.durable,
+        FilterSubjects: filters,
+        AckPolicy:      jetstream.AckExplicitPolicy,
+        AckWait:        n.handlerTimeout + 5*time.Second,
+        DeliverPolicy:  jetstream.DeliverAllPolicy,
+    }
+    // The deliver policy of an existing consumer cannot change, and its
+    // position makes a start time moot
+    if existing, err := n.js.Consumer(ctx, n.stream, n.durable); err == nil {
+        config.DeliverPolicy = existing.CachedInfo().Config.DeliverPolicy
+        config.OptStartTime = existing.CachedInfo().Config.OptStartTime
+    } else if !options.startTime.IsZero() {
+        config.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+        config.OptStartTime = &options.startTime
+    }
+    
+    consumer, err := n.js.CreateOrUpdateConsumer(ctx, n.stream, config)
+    if err != nil {
+        return fmt.Errorf("failed to create consumer for topics %v: %w", topics, err)
+    }
+    
+    consume, err := consumer.Consume(func(msg jetstream.Msg) {
+        n.handleMessage(ctx, msg, handler, options)
+    })
+    if err != nil {
+        return fmt.Errorf("failed to consume topics %v: %w", topics, err)
+    }
+    
+    n.mu.Lock()
+    n.consumes = append(n.consumes, consume)
+    n.mu.Unlock()
+    
+    go func() {
+        <-ctx.Done()
+        consume.Stop()
+    }()
+    
+    return nil
+}
+
+func (n *NATSEventBus) handleMessage(ctx context.Context, msg jetstream.Msg, handler Handler, options subscribeOptions) {
+    eventType := msg.Headers().Get(EventTypeHeader)
+    if options.skipsHeader(eventType, n.registry) {
+        n.settle(msg, msg.Ack())
+        return
+    }
+    
+    event, err := n.registry.Unmarshal(eventType, msg.Data())
+    var unknown *events.UnknownEventTypeError
+    if errors.As(err, &unknown) {
+        // Redelivered in case a restarted consumer knows the type, unless
+        // the subscription is strict
+        if options.rejectsUnknown(unknown) {
+            n.settle(msg, msg.TermWithReason(err.Error()))
+            return
+        }
+        n.settle(msg, msg.Nak())
+        return
+    }
+    if err != nil {
+        log.Printf("Error unmarshaling event: %v", err)
+        if errors.Is(err, events.ErrInvalidEvent) {
+            // Invalid events will never succeed, stop redelivering them
+            n.settle(msg, msg.TermWithReason(err.Error()))
+            return
+        }
+        n.settle(msg, msg.Nak())
+        return
+    }
+    if options.skips(event.Type()) {
+        n.settle(msg, msg.Ack())
+        return
+    }
+    
+    msgCtx, cancel := context.WithTimeout(ctx, n.handlerTimeout)
+    defer cancel()
+    msgCtx = tracing.ContextWithTraceparent(msgCtx, msg.Headers().Get(tracing.TraceparentHeader))
+    msgCtx, span := n.tracer.Start(msgCtx, "consume "+event.Type(), trace.WithSpanKind(trace.SpanKindConsumer))
+    defer span.End()
+    
+    err = recovery.Guard(msgCtx, "event-consumer", describe(event), func() error {
+        return handler(msgCtx, event)
+    })
+    if err == nil {
+        n.settle(msg, msg.Ack())
+        return
+    }
+    
+    span.RecordError(err)
+    span.SetStatus(codes.Error, err.Error())
+    log.Printf("Error handling event: %v", err)
+    if logredact.PayloadLogging() {
+        log.Printf("Failed event payload: %s", logredact.Value(event))
+    }
+    
+    if errors.Is(err, events.ErrInvalidEvent) || errors.Is(err, recovery.ErrPanic) {
+        n.settle(msg, msg.TermWithReason(err.Error()))
+        return
+    }
+    n.settle(msg, msg.Nak())
+}
+
+func (n *NATSEventBus) settle(msg jetstream.Msg, err error) {
+    if err != nil {
+        log.Printf("Error acknowledging message on %s: %v", msg.Subject(), err)
+    }
+}
+
+var _ GroupedEventBus = (*NATSEventBus)(nil)
+
+// ForGroup returns a bus with the receiver's settings whose Subscribe uses
+// the durable consumer named group. Durable names cannot contain dots.
+func (n *NATSEventBus) ForGroup(group string) (EventBus, error) {
+    if group == "" || strings.ContainsAny(group, ".*> ") {
+        return nil, fmt.Errorf("invalid durable consumer name %q", group)
+    }
+    
+    return &NATSEventBus{
+        conn:           n.conn,
+        js:             n.js,
+        stream:         n.stream,
+        durable:        group,
+        handlerTimeout: n.handlerTimeout,
+        topicResolver:  n.topicResolver,
+        registry:       n.registry,
+        compressAbove:  n.compressAbove,
+        tracer:         n.tracer,
+        sharedConn:     true,
+    }, nil
+}
+
+// Drain waits for the consumers to stop, with the messages they were
+// handling acknowledged.
+func (n *NATSEventBus) Drain(ctx context.Context) error {
+    n.mu.Lock()
+    consumes := append([]jetstream.ConsumeContext(nil), n.consumes...)
+    n.mu.Unlock()
+    
+    for _, consume := range consumes {
+        select {
+        case <-consume.Closed():
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+    return nil
+}
+
+func (n *NATSEventBus) Close() error {
+    n.mu.Lock()
+    for _, consume := range n.consumes {
+        consume.Stop()
+    }
+    n.consumes = nil
+    n.mu.Unlock()
+    
+    if n.sharedConn {
+        return nil
+    }
+    return n.conn.Drain()
+}
+
+// subjectFor returns the subject for an aggregate's events on topic. Dots
+// and wildcards in the aggregate id would change the subject's shape, so
+// they are replaced.
+func subjectFor(topic, aggregateID string) string {
+    if aggregateID == "" {
+        aggregateID = "_"
+    }
+    return topic + "." + strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(aggregateID)
+}
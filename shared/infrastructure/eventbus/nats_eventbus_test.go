@@ -0,0 +1,304 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// runNATSServer starts a JetStream server in the test's temp dir and
+// returns its URL. It is shut down when t ends.
+func runNATSServer(t *testing.T) string {
+    t.Helper()
+    srv, err := server.NewServer(&server.Options{
+        Host:      "127.0.0.1",
+        Port:      -1,
+        JetStream: true,
+        StoreDir:  t.TempDir(),
+        NoLog:     true,
+        NoSigs:    true,
+    })
+    if err != nil {
+        t.Fatalf("nats server: %v", err)
+    }
+    go srv.Start()
+    t.Cleanup(srv.Shutdown)
+    if !srv.ReadyForConnections(5 * time.Second) {
+        t.Fatal("nats server not ready")
+    }
+    return srv.ClientURL()
+}
+
+func TestNATSEventBus_Subscribe_redelivery(t *testing.T) {
+    tests := []struct {
+        name    string
+        handler func(call int32) error
+        // wantCalls is how often the handler sees the event in all
+        wantCalls int32
+    }{
+        {name: "handled once", handler: func(int32) error { return nil }, wantCalls: 1},
+        {
+            name: "failed handling is redelivered",
+            handler: func(call int32) error {
+                if call < 3 {
+                    return errors.New("database unavailable")
+                }
+                return nil
+            },
+            wantCalls: 3,
+        },
+        {
+            name:      "invalid event is not redelivered",
+            handler:   func(int32) error { return fmt.Errorf("no items: %w", events.ErrInvalidEvent) },
+            wantCalls: 1,
+        },
+        {
+            name:      "panic is not redelivered",
+            handler:   func(int32) error { panic("handler bug") },
+            wantCalls: 1,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bus, err := NewNATSEventBus(NATSConfig{
+                URL:            runNATSServer(t),
+                Stream:         "ORDERS",
+                Durable:        "test",
+                Topics:         []string{"orders"},
+                HandlerTimeout: time.Second,
+            })
+            if err != nil {
+                t.Fatalf("NewNATSEventBus: %v", err)
+            }
+            defer bus.Close()
+            
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+            var calls atomic.Int32
+            err = bus.Subscribe(ctx, []string{"orders"}, func(context.Context, events.DomainEvent) error {
+                return tt.handler(calls.Add(1))
+            })
+            if err != nil {
+                t.Fatalf("Subscribe: %v", err)
+            }
+            
+            if err := bus.PublishTo(ctx, "orders", events.NewCustomerFirstOrderEvent("customer-1", "order-1")); err != nil {
+                t.Fatalf("PublishTo: %v", err)
+            }
+            
+            // Settled once nothing waits for an ack: a nak'ed message would
+            // still be pending
+            consumer, err := bus.js.Consumer(ctx, "ORDERS", "test")
+            if err != nil {
+                t.Fatalf("Consumer: %v", err)
+            }
+            deadline := time.Now().Add(5 * time.Second)
+            for {
+                info, err := consumer.Info(ctx)
+                if err != nil {
+                    t.Fatalf("consumer info: %v", err)
+                }
+                if info.Delivered.Consumer > 0 && info.NumAckPending == 0 && info.NumPending == 0 {
+                    break
+                }
+                if time.Now().After(deadline) {
+                    t.Fatalf("event not settled after %d calls: %d pending ack", calls.Load(), info.NumAckPending)
+                }
+                time.Sleep(10 * time.Millisecond)
+            }
+            
+            if got := calls.Load(); got != tt.wantCalls {
+                t.Errorf("handler called %d times, want %d", got, tt.wantCalls)
+            }
+        })
+    }
+}
+
+func TestNATSEventBus_compression(t *testing.T) {
+	order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.ID = "order-1"
+	for i := 0; i < 100; i++ {
+		if err := order.AddItem(fmt.Sprintf("product-%03d", i), 1, valueobjects.NewMoney(1000, "USD")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	event := events.NewOrderCreatedEvent(order)
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		compressAbove int
+		wantEncoding  string
+	}{
+		{name: "compression off", compressAbove: 0},
+		{name: "under the threshold", compressAbove: len(data)},
+		{name: "over the threshold", compressAbove: 256, wantEncoding: events.ContentEncodingGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus, err := NewNATSEventBus(NATSConfig{
+				URL:            runNATSServer(t),
+				Stream:         "ORDERS",
+				Durable:        "test",
+				Topics:         []string{"orders"},
+				HandlerTimeout: time.Second,
+				CompressAbove:  tt.compressAbove,
+			})
+			if err != nil {
+				t.Fatalf("NewNATSEventBus: %v", err)
+			}
+			defer bus.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			received := make(chan events.DomainEvent, 1)
+			err = bus.Subscribe(ctx, []string{"orders"}, func(_ context.Context, event events.DomainEvent) error {
+				received <- event
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+
+			if err := bus.PublishTo(ctx, "orders", event); err != nil {
+				t.Fatalf("PublishTo: %v", err)
+			}
+
+			select {
+			case got := <-received:
+				gotData, _ := json.Marshal(got)
+				if string(gotData) != string(data) {
+					t.Errorf("consumer received\n%s\nwant\n%s", gotData, data)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("event not received")
+			}
+
+			stream, err := bus.js.Stream(ctx, "ORDERS")
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			msg, err := stream.GetMsg(ctx, 1)
+			if err != nil {
+				t.Fatalf("GetMsg: %v", err)
+			}
+			if got := msg.Header.Get(ContentEncodingHeader); got != tt.wantEncoding {
+				t.Errorf("%s header = %q, want %q", ContentEncodingHeader, got, tt.wantEncoding)
+			}
+			if compressed := events.IsCompressed(msg.Data); compressed != (tt.wantEncoding != "") {
+				t.Errorf("message compressed = %t, want %t", compressed, tt.wantEncoding != "")
+			}
+		})
+	}
+}
+
+func TestSubjectFor(t *testing.T) {
+    tests := []struct {
+        topic       string
+        aggregateID string
+        want        string
+    }{
+        {topic: "orders", aggregateID: "order-1", want: "orders.order-1"},
+        {topic: "orders", aggregateID: "", want: "orders._"},
+        {topic: "orders", aggregateID: "a.b*c>d e", want: "orders.a_b_c_d_e"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.want, func(t *testing.T) {
+            if got := subjectFor(tt.topic, tt.aggregateID); got != tt.want {
+                t.Errorf("subjectFor(%q, %q) = %q, want %q", tt.topic, tt.aggregateID, got, tt.want)
+            }
+        })
+    }
+}
+
+// A message of a type the registry does not know never reaches the
+// handler: a lenient subscription naks it for a consumer that may know it,
+// a strict one terminates it.
+func TestNATSEventBus_unknownEventType(t *testing.T) {
+    tests := []struct {
+        name          string
+        opts          []SubscribeOption
+        wantRedeliver bool
+    }{
+        {name: "lenient", wantRedeliver: true},
+        {name: "strict", opts: []SubscribeOption{WithStrictEventTypes()}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bus, err := NewNATSEventBus(NATSConfig{
+                URL:            runNATSServer(t),
+                Stream:         "ORDERS",
+                Durable:        "test",
+                Topics:         []string{"orders"},
+                HandlerTimeout: time.Second,
+            })
+            if err != nil {
+                t.Fatalf("NewNATSEventBus: %v", err)
+            }
+            defer bus.Close()
+            
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+            var calls atomic.Int32
+            err = bus.Subscribe(ctx, []string{"orders"}, func(context.Context, events.DomainEvent) error {
+                calls.Add(1)
+                return nil
+            }, tt.opts...)
+            if err != nil {
+                t.Fatalf("Subscribe: %v", err)
+            }
+            
+            renamed := events.BaseDomainEvent{EventIDValue: "event-1", EventType: "OrderRenamed", AggregateIDValue: "order-1", OccurredAtTime: time.Now()}
+            if err := bus.PublishTo(ctx, "orders", renamed); err != nil {
+                t.Fatalf("PublishTo: %v", err)
+            }
+            
+            consumer, err := bus.js.Consumer(ctx, "ORDERS", "test")
+            if err != nil {
+                t.Fatalf("Consumer: %v", err)
+            }
+            want := "settled"
+            if tt.wantRedeliver {
+                want = "redelivered"
+            }
+            deadline := time.Now().Add(5 * time.Second)
+            for {
+                info, err := consumer.Info(ctx)
+                if err != nil {
+                    t.Fatalf("consumer info: %v", err)
+                }
+                settled := info.Delivered.Consumer > 0 && info.NumAckPending == 0 && info.NumPending == 0
+                if tt.wantRedeliver && info.NumRedelivered > 0 || !tt.wantRedeliver && settled {
+                    break
+                }
+                if time.Now().After(deadline) {
+                    t.Fatalf("consumer = %+v, want the message %s", info, want)
+                }
+                time.Sleep(10 * time.Millisecond)
+            }
+            
+            if got := calls.Load(); got != 0 {
+                t.Errorf("handler called %d times, want never", got)
+            }
+        })
+    }
+}
@@ -0,0 +1,95 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotConsuming is returned by OffsetController.ResetOffsets when no
+// subscription is running to reset.
+var ErrNotConsuming = errors.New("no subscription is consuming")
+
+// ErrPartitionsNotAssigned is returned when a reset needs partitions of its
+// topic that are assigned to another consumer in the group.
+var ErrPartitionsNotAssigned = errors.New("partitions are not assigned to this consumer")
+
+// ResetPosition is where OffsetReset moves a topic's partitions to.
+type ResetPosition string
+
+const (
+    // ResetToEarliest moves to the oldest message still retained
+    ResetToEarliest ResetPosition = "earliest"
+    // ResetToTimestamp moves to the first message at or after a time
+    ResetToTimestamp ResetPosition = "timestamp"
+)
+
+// OffsetReset moves a consumer back (or forward) on one topic.
+type OffsetReset struct {
+    Topic string
+    To    ResetPosition
+    // Timestamp is required with ResetToTimestamp
+    Timestamp time.Time
+    // AllPartitions refuses the reset unless the consumer is assigned
+    // every partition of the topic, for resets that rebuild state shared
+    // across partitions
+    AllPartitions bool
+}
+
+// Validate reports whether the reset names a topic and a usable position.
+func (r OffsetReset) Validate() error {
+    if r.Topic == "" {
+        return errors.New("topic is required")
+    }
+    switch r.To {
+    case ResetToEarliest:
+    case ResetToTimestamp:
+        if r.Timestamp.IsZero() {
+            return errors.New("timestamp is required when resetting to a timestamp")
+        }
+    default:
+        return fmt.Errorf("unknown reset position %q: must be %s or %s", r.To, ResetToEarliest, ResetToTimestamp)
+    }
+    return nil
+}
+
+// PartitionOffsets describes a partition assigned to a consumer. Lag counts
+// the messages after the committed offset, or all retained messages when
+// the group has not committed one.
+type PartitionOffsets struct {
+    Topic         string `json:"topic"`
+    Partition     int32  `json:"partition"`
+    Committed     *int64 `json:"committed"`
+    LowWatermark  int64  `json:"low_watermark"`
+    HighWatermark int64  `json:"high_watermark"`
+    Lag           int64  `json:"lag"`
+}
+
+func newPartitionOffsets(topic string, partition int32, committed *int64, low, high int64) PartitionOffsets {
+    lag := high - low
+    if committed != nil {
+        lag = high - *committed
+    }
+    return PartitionOffsets{
+        Topic:         topic,
+        Partition:     partition,
+        Committed:     committed,
+        LowWatermark:  low,
+        HighWatermark: high,
+        Lag:           lag,
+    }
+}
+
+// OffsetController is implemented by event buses whose consumer position
+// can be inspected and moved, such as KafkaEventBus. Only the partitions
+// assigned to this process are covered.
+type OffsetController interface {
+    // Offsets lists the committed and watermark offsets of the assigned
+    // partitions.
+    Offsets(ctx context.Context) ([]PartitionOffsets, error)
+    // ResetOffsets pauses consumption once in-flight messages are handled,
+    // moves and commits the topic's assigned partitions, runs whilePaused
+    // if it is not nil, and resumes. It returns the partitions as reset.
+    ResetOffsets(ctx context.Context, reset OffsetReset, whilePaused func(ctx context.Context) error) ([]PartitionOffsets, error)
+}
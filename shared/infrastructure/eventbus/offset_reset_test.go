@@ -0,0 +1,52 @@
+package eventbus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOffsetReset_Validate(t *testing.T) {
+    tests := []struct {
+        name    string
+        reset   OffsetReset
+        wantErr bool
+    }{
+        {name: "earliest", reset: OffsetReset{Topic: DefaultTopic, To: ResetToEarliest}},
+        {name: "timestamp", reset: OffsetReset{Topic: DefaultTopic, To: ResetToTimestamp, Timestamp: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}},
+        {name: "no topic", reset: OffsetReset{To: ResetToEarliest}, wantErr: true},
+        {name: "timestamp missing", reset: OffsetReset{Topic: DefaultTopic, To: ResetToTimestamp}, wantErr: true},
+        {name: "unknown position", reset: OffsetReset{Topic: DefaultTopic, To: "latest"}, wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if err := tt.reset.Validate(); (err != nil) != tt.wantErr {
+                t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestNewPartitionOffsets(t *testing.T) {
+    committed := int64(7)
+    
+    tests := []struct {
+        name      string
+        committed *int64
+        wantLag   int64
+    }{
+        {name: "committed", committed: &committed, wantLag: 3},
+        {name: "nothing committed counts every retained message", wantLag: 8},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := newPartitionOffsets(DefaultTopic, 1, tt.committed, 2, 10)
+            want := PartitionOffsets{Topic: DefaultTopic, Partition: 1, Committed: tt.committed, LowWatermark: 2, HighWatermark: 10, Lag: tt.wantLag}
+            if !reflect.DeepEqual(got, want) {
+                t.Errorf("newPartitionOffsets() = %+v, want %+v", got, want)
+            }
+        })
+    }
+}
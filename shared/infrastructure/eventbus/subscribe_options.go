@@ -0,0 +1,140 @@
+package eventbus
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/ratelog"
+)
+
+// filterStats is published as the "consumer_filtered" expvar: messages a
+// subscription's event type filter skipped on their event-type header
+// alone, and those without the header skipped only once decoded.
+var filterStats = expvar.NewMap("consumer_filtered")
+
+// unknownTypeStats is published as the "consumer_unknown_event_types"
+// expvar: messages of event types the registry does not know, by type.
+// Anything but zero means a producer sends events this consumer was not
+// built for, such as a renamed event.
+var unknownTypeStats = expvar.NewMap("consumer_unknown_event_types")
+
+// unknownTypeLog warns about each unknown event type once a minute.
+var unknownTypeLog = ratelog.New(time.Minute)
+
+// EventTypeHeader names the message header carrying the event type, which
+// lets consumers filter messages without decoding them.
+const EventTypeHeader = "event-type"
+
+// SubscribeOption configures a single subscription.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+    // eventTypes is the allow-list of event types; nil allows every type
+    eventTypes map[string]bool
+    // startTime is where a group new to a partition starts; zero starts
+    // at the earliest retained message
+    startTime time.Time
+    // strict reports whether messages of event types the registry does
+    // not know are dead lettered instead of skipped; nil skips them
+    strict func() bool
+}
+
+// WithEventTypes passes only events of eventTypes to the handler. Other
+// messages are acknowledged as if handled; those carrying their type in the
+// EventTypeHeader are skipped without decoding their payload. No types, the
+// default, passes every event.
+func WithEventTypes(eventTypes ...string) SubscribeOption {
+    return func(o *subscribeOptions) {
+        if len(eventTypes) == 0 {
+            o.eventTypes = nil
+            return
+        }
+        o.eventTypes = make(map[string]bool, len(eventTypes))
+        for _, eventType := range eventTypes {
+            o.eventTypes[eventType] = true
+        }
+    }
+}
+
+// WithStartTime starts the subscription at the first message published at
+// or after t wherever its group has no position yet: on the partitions it
+// has no committed offset for with Kafka, or with a NATS consumer it
+// creates. Positions the group already has are kept. Buses without
+// retained messages, such as the in-memory one, ignore it. The zero time,
+// the default, starts at the earliest retained message.
+func WithStartTime(t time.Time) SubscribeOption {
+    return func(o *subscribeOptions) {
+        o.startTime = t
+    }
+}
+
+// WithStrictEventTypes dead letters messages of event types the registry
+// does not know, on Kafka, or terminates them, on NATS, instead of the
+// default of skipping them. They are never skipped on their header alone.
+// Types the registry knows but the WithEventTypes filter leaves out are
+// still skipped. Either way each unknown type is counted and warned about.
+func WithStrictEventTypes() SubscribeOption {
+    return WithStrictEventTypesFunc(func() bool { return true })
+}
+
+// WithStrictEventTypesFunc is WithStrictEventTypes where strict reports it
+// for each message, so strictness can be switched while the subscription
+// runs.
+func WithStrictEventTypesFunc(strict func() bool) SubscribeOption {
+    return func(o *subscribeOptions) {
+        o.strict = strict
+    }
+}
+
+func (o subscribeOptions) isStrict() bool {
+    return o.strict != nil && o.strict()
+}
+
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+    var o subscribeOptions
+    for _, opt := range opts {
+        opt(&o)
+    }
+    return o
+}
+
+// skipsHeader reports whether a message whose EventTypeHeader is eventType
+// can be skipped before decoding. Messages without the header are decoded
+// and checked with skips, as are those of types registry does not know
+// when the subscription is strict.
+func (o subscribeOptions) skipsHeader(eventType string, registry *events.Registry) bool {
+    if o.eventTypes == nil || eventType == "" || o.eventTypes[eventType] {
+        return false
+    }
+    if o.isStrict() && !registry.Knows(eventType) {
+        return false
+    }
+    filterStats.Add("skipped", 1)
+    return true
+}
+
+// skips reports whether a decoded event of eventType is filtered out.
+func (o subscribeOptions) skips(eventType string) bool {
+    if o.eventTypes == nil || o.eventTypes[eventType] {
+        return false
+    }
+    filterStats.Add("skipped_after_decoding", 1)
+    return true
+}
+
+// rejectsUnknown counts a message whose event type the registry did not
+// know and reports whether it is to be dead lettered rather than skipped.
+func (o subscribeOptions) rejectsUnknown(err *events.UnknownEventTypeError) bool {
+    eventType := err.EventType
+    if eventType == "" {
+        eventType = "(none)"
+    }
+    unknownTypeStats.Add(eventType, 1)
+    if o.isStrict() {
+        unknownTypeLog.Printf(eventType, "Rejecting message of unknown event type %q", err.EventType)
+        return true
+    }
+    unknownTypeLog.Printf(eventType, "Skipping message of unknown event type %q", err.EventType)
+    return false
+}
@@ -0,0 +1,68 @@
+package eventbus
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+func unknownTypeStat(name string) int64 {
+    if v, ok := unknownTypeStats.Get(name).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
+
+// Messages are skipped on their header when the filter leaves their type
+// out, except, on a strict subscription, types the registry does not know,
+// which are decoded to be rejected.
+func TestSubscribeOptions_skipsHeader(t *testing.T) {
+    registry := events.DefaultRegistry()
+    tests := []struct {
+        name      string
+        opts      []SubscribeOption
+        eventType string
+        want      bool
+    }{
+        {name: "no filter", eventType: "OrderRenamed"},
+        {name: "no header", opts: []SubscribeOption{WithEventTypes("OrderCreated")}},
+        {name: "wanted", opts: []SubscribeOption{WithEventTypes("OrderCreated")}, eventType: "OrderCreated"},
+        {name: "filtered", opts: []SubscribeOption{WithEventTypes("OrderCreated")}, eventType: "OrderShipped", want: true},
+        {name: "unknown", opts: []SubscribeOption{WithEventTypes("OrderCreated")}, eventType: "OrderRenamed", want: true},
+        {name: "strict filtered", opts: []SubscribeOption{WithEventTypes("OrderCreated"), WithStrictEventTypes()}, eventType: "OrderShipped", want: true},
+        {name: "strict unknown", opts: []SubscribeOption{WithEventTypes("OrderCreated"), WithStrictEventTypes()}, eventType: "OrderRenamed"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := newSubscribeOptions(tt.opts).skipsHeader(tt.eventType, registry); got != tt.want {
+                t.Errorf("skipsHeader(%q) = %t, want %t", tt.eventType, got, tt.want)
+            }
+        })
+    }
+}
+
+// Unknown types are counted by name, or as "(none)" without one, whether
+// they are skipped or rejected.
+func TestSubscribeOptions_rejectsUnknown(t *testing.T) {
+    renamed, none := unknownTypeStat("OrderRenamed"), unknownTypeStat("(none)")
+    
+    if newSubscribeOptions(nil).rejectsUnknown(&events.UnknownEventTypeError{EventType: "OrderRenamed"}) {
+        t.Error("lenient subscription rejects the unknown type, want it skipped")
+    }
+    strict := newSubscribeOptions([]SubscribeOption{WithStrictEventTypes()})
+    if !strict.rejectsUnknown(&events.UnknownEventTypeError{EventType: "OrderRenamed"}) {
+        t.Error("strict subscription skips the unknown type, want it rejected")
+    }
+    if !strict.rejectsUnknown(&events.UnknownEventTypeError{}) {
+        t.Error("strict subscription skips a message without a type, want it rejected")
+    }
+    
+    if got := unknownTypeStat("OrderRenamed") - renamed; got != 2 {
+        t.Errorf("OrderRenamed counted %d times, want 2", got)
+    }
+    if got := unknownTypeStat("(none)") - none; got != 1 {
+        t.Errorf("(none) counted %d times, want 1", got)
+    }
+}
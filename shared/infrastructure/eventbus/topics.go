@@ -0,0 +1,81 @@
+package eventbus
+
+import (
+	"os"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+// TopicConfig names the topic used for each category of event. Categories
+// left empty fall back to DefaultTopic, so the zero value routes everything
+// to a single topic.
+type TopicConfig struct {
+    OrderLifecycle string
+    OrderItems     string
+    Customers      string
+    Sagas          string
+    // OrderStatus carries the OrderStatusChanged events; left empty they
+    // go to OrderLifecycle with the events they accompany
+    OrderStatus    string
+}
+
+// TopicConfigFromEnv reads KAFKA_TOPIC_ORDERS, KAFKA_TOPIC_ORDER_ITEMS,
+// KAFKA_TOPIC_CUSTOMERS, KAFKA_TOPIC_SAGAS and KAFKA_TOPIC_ORDER_STATUS.
+func TopicConfigFromEnv() TopicConfig {
+    return TopicConfig{
+        OrderLifecycle: os.Getenv("KAFKA_TOPIC_ORDERS"),
+        OrderItems:     os.Getenv("KAFKA_TOPIC_ORDER_ITEMS"),
+        Customers:      os.Getenv("KAFKA_TOPIC_CUSTOMERS"),
+        Sagas:          os.Getenv("KAFKA_TOPIC_SAGAS"),
+        OrderStatus:    os.Getenv("KAFKA_TOPIC_ORDER_STATUS"),
+    }
+}
+
+// Resolver routes events by category based on their type name: OrderItem*
+// events to OrderItems, Customer* to Customers, Saga* to Sagas,
+// OrderStatusChanged to OrderStatus when it is set, and all other events
+// to OrderLifecycle.
+func (c TopicConfig) Resolver() TopicResolver {
+    return func(event events.DomainEvent) string {
+        eventType := event.Type()
+        switch {
+        case eventType == "OrderStatusChanged" && c.OrderStatus != "":
+            return c.OrderStatus
+        case strings.HasPrefix(eventType, "OrderItem"):
+            return orDefault(c.OrderItems)
+        case strings.HasPrefix(eventType, "Customer"):
+            return orDefault(c.Customers)
+        case strings.HasPrefix(eventType, "Saga"):
+            return orDefault(c.Sagas)
+        default:
+            return orDefault(c.OrderLifecycle)
+        }
+    }
+}
+
+// All returns every distinct topic in the configuration, for subscribers
+// that need to consume all categories.
+func (c TopicConfig) All() []string {
+    var topics []string
+    seen := make(map[string]bool)
+    categories := []string{c.OrderLifecycle, c.OrderItems, c.Customers, c.Sagas}
+    if c.OrderStatus != "" {
+        categories = append(categories, c.OrderStatus)
+    }
+    for _, topic := range categories {
+        topic = orDefault(topic)
+        if !seen[topic] {
+            seen[topic] = true
+            topics = append(topics, topic)
+        }
+    }
+    return topics
+}
+
+func orDefault(topic string) string {
+    if topic == "" {
+        return DefaultTopic
+    }
+    return topic
+}
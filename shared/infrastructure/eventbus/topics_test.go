@@ -0,0 +1,92 @@
+package eventbus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+var testTopics = TopicConfig{
+    OrderLifecycle: "orders",
+    OrderItems:     "order-items",
+    Customers:      "customers",
+    Sagas:          "sagas",
+    OrderStatus:    "order-status",
+}
+
+func TestTopicConfig_Resolver(t *testing.T) {
+    tests := []struct {
+        eventType string
+        config    TopicConfig
+        want      string
+    }{
+        {eventType: "OrderCreated", config: testTopics, want: "orders"},
+        {eventType: "OrderConfirmed", config: testTopics, want: "orders"},
+        {eventType: "OrderCancelled", config: testTopics, want: "orders"},
+        {eventType: "OrderItemAdded", config: testTopics, want: "order-items"},
+        {eventType: "OrderItemRemoved", config: testTopics, want: "order-items"},
+        {eventType: "OrderItemQuantityChanged", config: testTopics, want: "order-items"},
+        {eventType: "CustomerFirstOrder", config: testTopics, want: "customers"},
+        {eventType: "CustomerMerged", config: testTopics, want: "customers"},
+        {eventType: "SagaStarted", config: testTopics, want: "sagas"},
+        {eventType: "OrderStatusChanged", config: testTopics, want: "order-status"},
+        {eventType: "OrderStatusChanged", config: TopicConfig{OrderLifecycle: "orders"}, want: "orders"},
+        {eventType: "OrderItemAdded", config: TopicConfig{OrderLifecycle: "orders"}, want: DefaultTopic},
+        {eventType: "OrderCreated", config: TopicConfig{}, want: DefaultTopic},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.eventType+" to "+tt.want, func(t *testing.T) {
+            event := events.BaseDomainEvent{EventType: tt.eventType}
+            if got := tt.config.Resolver()(event); got != tt.want {
+                t.Errorf("Resolver()(%s) = %q, want %q", tt.eventType, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestTopicConfig_All(t *testing.T) {
+    tests := []struct {
+        name   string
+        config TopicConfig
+        want   []string
+    }{
+        {name: "every category", config: testTopics, want: []string{"orders", "order-items", "customers", "sagas", "order-status"}},
+        {name: "unset categories share the default", config: TopicConfig{OrderItems: "order-items"}, want: []string{DefaultTopic, "order-items"}},
+        {name: "zero value", config: TopicConfig{}, want: []string{DefaultTopic}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.config.All(); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("All() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+// A subscriber to All receives the events of every category.
+func TestTopicConfig_subscribeAll(t *testing.T) {
+    ctx := context.Background()
+    bus := NewInMemoryEventBus(testTopics.Resolver())
+    var received []string
+    err := bus.Subscribe(ctx, testTopics.All(), func(_ context.Context, event events.DomainEvent) error {
+        received = append(received, event.Type())
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("Subscribe() = %v", err)
+    }
+    
+    published := []string{"OrderCreated", "OrderItemAdded", "CustomerFirstOrder", "SagaStarted", "OrderStatusChanged"}
+    for _, eventType := range published {
+        if err := bus.Publish(ctx, events.BaseDomainEvent{EventType: eventType}); err != nil {
+            t.Fatalf("Publish(%s) = %v", eventType, err)
+        }
+    }
+    if !reflect.DeepEqual(received, published) {
+        t.Errorf("received %v, want %v", received, published)
+    }
+}
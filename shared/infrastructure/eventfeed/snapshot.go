@@ -0,0 +1,94 @@
+package eventfeed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Snapshot is a Source reading a file of events, one JSON Event per line as
+// the feed endpoint returns them, in increasing position order. Such a file
+// is written by paging through the feed, for example with
+//
+//	curl -H "X-Admin-Key: $KEY" "$URL/api/v1/events?after=0&limit=1000" | jq -c '.events[]'
+//
+// Reads continue where the previous one stopped; asking for events before
+// it reads the file again from the start.
+type Snapshot struct {
+    path string
+    
+    mu      sync.Mutex
+    file    *os.File
+    decoder *json.Decoder
+    // last is the position of the last event read from decoder
+    last    int64
+}
+
+// NewSnapshot returns a Source reading the file at path, which is opened
+// on the first read.
+func NewSnapshot(path string) *Snapshot {
+    return &Snapshot{path: path}
+}
+
+func (s *Snapshot) GetEventsSince(ctx context.Context, after int64, limit int) ([]Event, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    if s.decoder == nil || after < s.last {
+        if err := s.reopen(); err != nil {
+            return nil, err
+        }
+    }
+    
+    var found []Event
+    for len(found) < limit {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        
+        var event Event
+        if err := s.decoder.Decode(&event); errors.Is(err, io.EOF) {
+            break
+        } else if err != nil {
+            return nil, fmt.Errorf("failed to read snapshot %s after position %d: %w", s.path, s.last, err)
+        }
+        if event.Position <= s.last {
+            return nil, fmt.Errorf("snapshot %s is out of order: position %d follows %d", s.path, event.Position, s.last)
+        }
+        s.last = event.Position
+        
+        if event.Position > after {
+            found = append(found, event)
+        }
+    }
+    return found, nil
+}
+
+// Close closes the file.
+func (s *Snapshot) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    if s.file == nil {
+        return nil
+    }
+    err := s.file.Close()
+    s.file, s.decoder, s.last = nil, nil, 0
+    return err
+}
+
+func (s *Snapshot) reopen() error {
+    if s.file != nil {
+        s.file.Close()
+    }
+    file, err := os.Open(s.path)
+    if err != nil {
+        return fmt.Errorf("failed to open snapshot: %w", err)
+    }
+    s.file, s.decoder, s.last = file, json.NewDecoder(file), 0
+    return nil
+}
@@ -0,0 +1,394 @@
+// Package featureflags switches risky behaviors on and off while a service
+// runs, so they can be rolled out and rolled back without a redeploy.
+//
+// Flags are defined in code with their defaults. A service may replace a
+// default at startup with its own configuration, FEATURE_<NAME> environment
+// variables override that, and overrides set at runtime through the admin
+// endpoint override both. With a Store, runtime overrides are shared by
+// every instance: each change is saved to the store and every instance
+// loads the store periodically.
+package featureflags
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// Flag names a feature flag.
+type Flag string
+
+const (
+    // StrictConcurrency requires commands on existing orders to name the
+    // order version they expect
+    StrictConcurrency Flag = "strict_concurrency"
+    // SyncProjection applies the order events to the read models before
+    // commands respond, where the synchronous projection is configured
+    SyncProjection    Flag = "sync_projection"
+    // StrictProjections dead letters events the projections do not know or
+    // do not apply instead of skipping them
+    StrictProjections Flag = "strict_projections"
+    // PriceVerification refuses new items priced differently from the
+    // price catalog, where one is configured
+    PriceVerification Flag = "price_verification"
+)
+
+// Definition is a flag with its default and what it turns on.
+type Definition struct {
+    Flag        Flag
+    Default     bool
+    Description string
+}
+
+// Definitions lists every flag, in the order they are listed.
+var Definitions = []Definition{
+    {Flag: StrictConcurrency, Description: "Commands on existing orders must send If-Match with the order version they expect"},
+    {Flag: SyncProjection, Description: "Commands update the order read models before responding; needs the synchronous projection configured"},
+    {Flag: StrictProjections, Description: "Projections dead letter events they do not know or do not apply instead of skipping them"},
+    {Flag: PriceVerification, Description: "New order items must be priced as the price catalog says; needs a price catalog configured"},
+}
+
+// Sources of a flag's value, as Status reports them
+const (
+    SourceDefault = "default"
+    SourceEnv     = "env"
+    SourceRuntime = "runtime"
+)
+
+// Default Flags settings
+const (
+    DefaultSyncInterval = 10 * time.Second
+    DefaultRedisKey     = "feature_flags"
+)
+
+// ErrUnknownFlag is returned for flags not defined.
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// stats is published as the "feature_flags" expvar: runtime changes by
+// flag, changes picked up from the store, and failed store reads.
+var stats = expvar.NewMap("feature_flags")
+
+// Override is a value set for a flag at runtime, with who set it and why.
+type Override struct {
+    Enabled   bool              `json:"enabled"`
+    Actor     string            `json:"actor"`
+    Reason    string            `json:"reason"`
+    ChangedAt apijson.Timestamp `json:"changed_at"`
+}
+
+// same reports whether o and other are the same override, wherever their
+// times were read from.
+func (o *Override) same(other Override) bool {
+    return o.Enabled == other.Enabled && o.Actor == other.Actor && o.Reason == other.Reason && o.ChangedAt.Equal(other.ChangedAt.Time)
+}
+
+// Store shares runtime overrides between instances.
+type Store interface {
+    // Load returns the overrides saved, by flag
+    Load(ctx context.Context) (map[Flag]Override, error)
+    // Save saves the override of flag, or removes it when override is nil
+    Save(ctx context.Context, flag Flag, override *Override) error
+}
+
+// Status is a flag's current value and where it comes from.
+type Status struct {
+    Name        Flag      `json:"name"`
+    Description string    `json:"description"`
+    Enabled     bool      `json:"enabled"`
+    // Default is the value in code or from the service's configuration
+    Default     bool      `json:"default"`
+    Source      string    `json:"source"`
+    Override    *Override `json:"override,omitempty"`
+}
+
+// Flags holds the value of each flag for the process. Enabled is safe for
+// concurrent use with every other method and never blocks.
+type Flags struct {
+    store        Store
+    syncInterval time.Duration
+    
+    // flags is fixed by New; the values it points to change
+    flags map[Flag]*flagState
+    order []Flag
+    
+    // mu serializes changes, so the store and the values agree
+    mu sync.Mutex
+}
+
+type flagState struct {
+    definition Definition
+    // enabled is the effective value, read without locking
+    enabled    atomic.Bool
+    
+    // Guarded by Flags.mu
+    startup  bool
+    env      *bool
+    override *Override
+}
+
+type Option func(*Flags)
+
+// WithDefinitions replaces Definitions.
+func WithDefinitions(definitions ...Definition) Option {
+    return func(f *Flags) {
+        f.flags, f.order = make(map[Flag]*flagState), nil
+        for _, definition := range definitions {
+            f.define(definition)
+        }
+    }
+}
+
+// WithStore shares runtime overrides through store, which Run loads every
+// interval; zero defaults to DefaultSyncInterval.
+func WithStore(store Store, interval time.Duration) Option {
+    return func(f *Flags) {
+        f.store = store
+        if interval > 0 {
+            f.syncInterval = interval
+        }
+    }
+}
+
+// New returns the flags of Definitions at their defaults.
+func New(opts ...Option) *Flags {
+    f := &Flags{flags: make(map[Flag]*flagState), syncInterval: DefaultSyncInterval}
+    for _, definition := range Definitions {
+        f.define(definition)
+    }
+    for _, opt := range opts {
+        opt(f)
+    }
+    return f
+}
+
+func (f *Flags) define(definition Definition) {
+    state := &flagState{definition: definition, startup: definition.Default}
+    state.enabled.Store(definition.Default)
+    f.flags[definition.Flag] = state
+    f.order = append(f.order, definition.Flag)
+}
+
+// Enabled reports whether flag is on. Flags not defined are off.
+func (f *Flags) Enabled(flag Flag) bool {
+    state, ok := f.flags[flag]
+    return ok && state.enabled.Load()
+}
+
+// Func returns a function reporting whether flag is on, for packages that
+// take a switch without depending on this one.
+func (f *Flags) Func(flag Flag) func() bool {
+    return func() bool {
+        return f.Enabled(flag)
+    }
+}
+
+// Configure replaces the default of flag with the service's configuration,
+// at startup. Environment variables and runtime overrides still win.
+func (f *Flags) Configure(flag Flag, enabled bool) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    
+    if state, ok := f.flags[flag]; ok {
+        state.startup = enabled
+        f.update(state)
+    }
+}
+
+// EnvName is the environment variable LoadEnv reads for flag, such as
+// FEATURE_STRICT_CONCURRENCY.
+func EnvName(flag Flag) string {
+    return "FEATURE_" + strings.ToUpper(string(flag))
+}
+
+// LoadEnv overrides the defaults of the flags whose EnvName variable is
+// set. A value that is not a boolean fails, leaving the flags unchanged.
+func (f *Flags) LoadEnv() error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    
+    values := make(map[Flag]bool)
+    for _, flag := range f.order {
+        value := os.Getenv(EnvName(flag))
+        if value == "" {
+            continue
+        }
+        enabled, err := strconv.ParseBool(value)
+        if err != nil {
+            return fmt.Errorf("invalid %s: %w", EnvName(flag), err)
+        }
+        values[flag] = enabled
+    }
+    for flag, enabled := range values {
+        state := f.flags[flag]
+        enabled := enabled
+        state.env = &enabled
+        f.update(state)
+    }
+    return nil
+}
+
+// Set overrides flag at runtime, saving the override to the store first
+// when there is one, and logs the change. The change time is kept to the
+// millisecond, as the store keeps it.
+func (f *Flags) Set(ctx context.Context, flag Flag, enabled bool, actor, reason string) (Status, error) {
+    return f.change(ctx, flag, &Override{Enabled: enabled, Actor: actor, Reason: reason, ChangedAt: apijson.NewTimestamp(clock.Now().UTC().Truncate(time.Millisecond))}, actor, reason)
+}
+
+// Reset removes the runtime override of flag, returning it to its default
+// or environment value, and logs the change.
+func (f *Flags) Reset(ctx context.Context, flag Flag, actor, reason string) (Status, error) {
+    return f.change(ctx, flag, nil, actor, reason)
+}
+
+func (f *Flags) change(ctx context.Context, flag Flag, override *Override, actor, reason string) (Status, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    
+    state, ok := f.flags[flag]
+    if !ok {
+        return Status{}, fmt.Errorf("%w: %q", ErrUnknownFlag, flag)
+    }
+    if f.store != nil {
+        if err := f.store.Save(ctx, flag, override); err != nil {
+            return Status{}, fmt.Errorf("failed to save feature flag %s: %w", flag, err)
+        }
+    }
+    
+    was := state.enabled.Load()
+    state.override = override
+    f.update(state)
+    stats.Add(string(flag), 1)
+    
+    if override == nil {
+        log.Printf("Feature flag %s reset to %t (was %t) by %s: %s", flag, state.enabled.Load(), was, actor, reason)
+    } else {
+        log.Printf("Feature flag %s set to %t (was %t) by %s: %s", flag, state.enabled.Load(), was, actor, reason)
+    }
+    return state.status(), nil
+}
+
+// Sync applies the overrides in the store, logging those other instances
+// changed. Without a store it does nothing.
+func (f *Flags) Sync(ctx context.Context) error {
+    if f.store == nil {
+        return nil
+    }
+    
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    
+    // Loaded under the lock, so a change made here meanwhile is not undone
+    overrides, err := f.store.Load(ctx)
+    if err != nil {
+        stats.Add("store_errors", 1)
+        return fmt.Errorf("failed to load feature flags: %w", err)
+    }
+    for _, flag := range f.order {
+        state := f.flags[flag]
+        override, ok := overrides[flag]
+        switch {
+        case ok && state.override != nil && state.override.same(override):
+            continue
+        case ok:
+            override := override
+            state.override = &override
+            f.update(state)
+            log.Printf("Feature flag %s set to %t by %s at %s, from the store: %s", flag, override.Enabled, override.Actor, override.ChangedAt.Format(time.RFC3339), override.Reason)
+        case state.override != nil:
+            state.override = nil
+            f.update(state)
+            log.Printf("Feature flag %s reset to %t, from the store", flag, state.enabled.Load())
+        default:
+            continue
+        }
+        stats.Add("synced", 1)
+    }
+    return nil
+}
+
+// Run syncs with the store at start and then every interval until ctx is
+// done, logging failures and keeping the values it has. Without a store it
+// returns at once.
+func (f *Flags) Run(ctx context.Context) error {
+    if f.store == nil {
+        return nil
+    }
+    
+    ticker := time.NewTicker(f.syncInterval)
+    defer ticker.Stop()
+    
+    for {
+        if err := f.Sync(ctx); err != nil && ctx.Err() == nil {
+            log.Printf("Feature flags not synced, keeping the current values: %v", err)
+        }
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// List returns the status of every flag, in the order they are defined.
+func (f *Flags) List() []Status {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    
+    statuses := make([]Status, 0, len(f.order))
+    for _, flag := range f.order {
+        statuses = append(statuses, f.flags[flag].status())
+    }
+    return statuses
+}
+
+// update stores the effective value of state. The caller holds f.mu.
+func (f *Flags) update(state *flagState) {
+    state.enabled.Store(state.value())
+}
+
+func (s *flagState) value() bool {
+    switch {
+    case s.override != nil:
+        return s.override.Enabled
+    case s.env != nil:
+        return *s.env
+    default:
+        return s.startup
+    }
+}
+
+func (s *flagState) status() Status {
+    status := Status{
+        Name:        s.definition.Flag,
+        Description: s.definition.Description,
+        Enabled:     s.value(),
+        Default:     s.startup,
+        Source:      SourceDefault,
+    }
+    switch {
+    case s.override != nil:
+        override := *s.override
+        status.Source, status.Override = SourceRuntime, &override
+    case s.env != nil:
+        status.Source = SourceEnv
+    }
+    return status
+}
+
+// HasStore reports whether runtime overrides are shared through a store,
+// for Run to be started.
+func (f *Flags) HasStore() bool {
+    return f.store != nil
+}
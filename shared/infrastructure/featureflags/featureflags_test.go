@@ -0,0 +1,263 @@
+package featureflags
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var testDefinitions = []Definition{
+    {Flag: "alpha", Description: "off by default"},
+    {Flag: "beta", Default: true, Description: "on by default"},
+}
+
+func TestFlags_precedence(t *testing.T) {
+    tests := []struct {
+        name       string
+        configured *bool
+        env        string
+        override   *bool
+        want       bool
+        wantSource string
+    }{
+        {name: "code default", want: false, wantSource: SourceDefault},
+        {name: "configured default", configured: boolPtr(true), want: true, wantSource: SourceDefault},
+        {name: "env over configured", configured: boolPtr(true), env: "false", want: false, wantSource: SourceEnv},
+        {name: "runtime over env", env: "false", override: boolPtr(true), want: true, wantSource: SourceRuntime},
+        {name: "runtime off over configured on", configured: boolPtr(true), override: boolPtr(false), want: false, wantSource: SourceRuntime},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Setenv(EnvName("alpha"), tt.env)
+            flags := New(WithDefinitions(testDefinitions...))
+            if tt.configured != nil {
+                flags.Configure("alpha", *tt.configured)
+            }
+            if err := flags.LoadEnv(); err != nil {
+                t.Fatalf("LoadEnv() = %v", err)
+            }
+            if tt.override != nil {
+                if _, err := flags.Set(context.Background(), "alpha", *tt.override, "ops", "test"); err != nil {
+                    t.Fatalf("Set() = %v", err)
+                }
+            }
+            
+            if got := flags.Enabled("alpha"); got != tt.want {
+                t.Errorf("Enabled() = %t, want %t", got, tt.want)
+            }
+            if got := flags.List()[0]; got.Source != tt.wantSource || got.Enabled != tt.want {
+                t.Errorf("List()[0] = %+v, want enabled %t from %s", got, tt.want, tt.wantSource)
+            }
+        })
+    }
+}
+
+func TestFlags_LoadEnv_invalid(t *testing.T) {
+    t.Setenv(EnvName("alpha"), "true")
+    t.Setenv(EnvName("beta"), "maybe")
+    flags := New(WithDefinitions(testDefinitions...))
+    
+    if err := flags.LoadEnv(); err == nil {
+        t.Fatal("LoadEnv() = nil, want an error")
+    }
+    // Nothing is applied when one value is bad
+    if flags.Enabled("alpha") || !flags.Enabled("beta") {
+        t.Errorf("Enabled() = %t, %t after a failed LoadEnv, want the defaults", flags.Enabled("alpha"), flags.Enabled("beta"))
+    }
+}
+
+func TestFlags_Reset(t *testing.T) {
+    flags := New(WithDefinitions(testDefinitions...))
+    ctx := context.Background()
+    if _, err := flags.Set(ctx, "beta", false, "ops", "incident"); err != nil {
+        t.Fatalf("Set() = %v", err)
+    }
+    
+    status, err := flags.Reset(ctx, "beta", "ops", "resolved")
+    if err != nil {
+        t.Fatalf("Reset() = %v", err)
+    }
+    if !status.Enabled || status.Source != SourceDefault || status.Override != nil {
+        t.Errorf("Reset() = %+v, want the default back", status)
+    }
+}
+
+func TestFlags_unknownFlag(t *testing.T) {
+    flags := New(WithDefinitions(testDefinitions...))
+    
+    if flags.Enabled("gamma") {
+        t.Error("Enabled(gamma) = true, want flags not defined off")
+    }
+    if _, err := flags.Set(context.Background(), "gamma", true, "ops", "test"); !errors.Is(err, ErrUnknownFlag) {
+        t.Errorf("Set(gamma) = %v, want ErrUnknownFlag", err)
+    }
+}
+
+// Run with -race: Enabled reads while Set, Reset, Sync and List change and
+// read the flags.
+func TestFlags_concurrentUse(t *testing.T) {
+    flags := New(WithDefinitions(testDefinitions...), WithStore(newMemoryStore(), 0))
+    ctx := context.Background()
+    
+    var wg sync.WaitGroup
+    for i := 0; i < 4; i++ {
+        wg.Add(2)
+        go func(i int) {
+            defer wg.Done()
+            for j := 0; j < 200; j++ {
+                if j%10 == 0 {
+                    flags.Reset(ctx, "alpha", "ops", "test")
+                    continue
+                }
+                if _, err := flags.Set(ctx, "alpha", (i+j)%2 == 0, "ops", "test"); err != nil {
+                    t.Errorf("Set() = %v", err)
+                    return
+                }
+                if err := flags.Sync(ctx); err != nil {
+                    t.Errorf("Sync() = %v", err)
+                    return
+                }
+            }
+        }(i)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 2000; j++ {
+                flags.Enabled("alpha")
+                flags.Enabled("beta")
+                if j%100 == 0 {
+                    flags.List()
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    
+    // Whatever won, the value read and the status agree
+    if status := flags.List()[0]; status.Enabled != flags.Enabled("alpha") {
+        t.Errorf("List() says %t, Enabled() says %t", status.Enabled, flags.Enabled("alpha"))
+    }
+}
+
+func TestFlags_Set_storeFails(t *testing.T) {
+    store := newMemoryStore()
+    store.err = errors.New("redis down")
+    flags := New(WithDefinitions(testDefinitions...), WithStore(store, 0))
+    
+    if _, err := flags.Set(context.Background(), "alpha", true, "ops", "test"); err == nil {
+        t.Fatal("Set() = nil, want the store's error")
+    }
+    if flags.Enabled("alpha") {
+        t.Error("Enabled() = true, want a change the store refused not applied")
+    }
+}
+
+// Two instances sharing one Redis converge on each other's changes.
+func TestFlags_Sync_redis(t *testing.T) {
+    server := miniredis.RunT(t)
+    newInstance := func() *Flags {
+        client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+        t.Cleanup(func() { client.Close() })
+        return New(WithDefinitions(testDefinitions...), WithStore(NewRedisStore(client, ""), 0))
+    }
+    first, second := newInstance(), newInstance()
+    ctx := context.Background()
+    
+    if _, err := first.Set(ctx, "alpha", true, "ops", "rollout"); err != nil {
+        t.Fatalf("Set() = %v", err)
+    }
+    if second.Enabled("alpha") {
+        t.Fatal("second instance changed before it synced")
+    }
+    if err := second.Sync(ctx); err != nil {
+        t.Fatalf("Sync() = %v", err)
+    }
+    status := second.List()[0]
+    if !status.Enabled || status.Source != SourceRuntime || status.Override == nil || status.Override.Actor != "ops" {
+        t.Errorf("second instance after Sync = %+v, want the first's override", status)
+    }
+    
+    if _, err := second.Reset(ctx, "alpha", "ops", "rollback"); err != nil {
+        t.Fatalf("Reset() = %v", err)
+    }
+    if err := first.Sync(ctx); err != nil {
+        t.Fatalf("Sync() = %v", err)
+    }
+    if first.Enabled("alpha") {
+        t.Error("first instance still has the override the second reset")
+    }
+    
+    // A restarted instance starts from the store
+    if _, err := first.Set(ctx, "beta", false, "ops", "incident"); err != nil {
+        t.Fatalf("Set() = %v", err)
+    }
+    restarted := newInstance()
+    if err := restarted.Sync(ctx); err != nil {
+        t.Fatalf("Sync() = %v", err)
+    }
+    if restarted.Enabled("beta") {
+        t.Error("restarted instance did not load the override from Redis")
+    }
+}
+
+func TestRedisStore_Load_skipsBadFields(t *testing.T) {
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+    defer client.Close()
+    server.HSet(DefaultRedisKey, "alpha", `{"enabled":true,"actor":"ops","reason":"test","changed_at":"2024-03-01T12:00:00.000Z"}`)
+    server.HSet(DefaultRedisKey, "beta", `not json`)
+    
+    overrides, err := NewRedisStore(client, "").Load(context.Background())
+    if err != nil {
+        t.Fatalf("Load() = %v", err)
+    }
+    if len(overrides) != 1 || !overrides["alpha"].Enabled {
+        t.Errorf("Load() = %+v, want alpha alone", overrides)
+    }
+}
+
+// memoryStore is a Store in memory, failing with err when it is set.
+type memoryStore struct {
+    mu        sync.Mutex
+    overrides map[Flag]Override
+    err       error
+}
+
+func newMemoryStore() *memoryStore {
+    return &memoryStore{overrides: make(map[Flag]Override)}
+}
+
+func (s *memoryStore) Load(context.Context) (map[Flag]Override, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.err != nil {
+        return nil, s.err
+    }
+    overrides := make(map[Flag]Override, len(s.overrides))
+    for flag, override := range s.overrides {
+        overrides[flag] = override
+    }
+    return overrides, nil
+}
+
+func (s *memoryStore) Save(_ context.Context, flag Flag, override *Override) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.err != nil {
+        return s.err
+    }
+    if override == nil {
+        delete(s.overrides, flag)
+    } else {
+        s.overrides[flag] = *override
+    }
+    return nil
+}
+
+func boolPtr(b bool) *bool {
+    return &b
+}
@@ -0,0 +1,72 @@
+package featureflags
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// maxReasonLength caps the reason recorded with a change.
+const maxReasonLength = 500
+
+// Handler lists the flags (GET) and changes one at runtime (PUT). Mount it
+// behind the admin key.
+type Handler struct {
+    Flags *Flags
+}
+
+// SetRequest is the body of a change. A null Enabled removes the flag's
+// runtime override. Actor names the operator, as the admin key does not
+// identify one.
+type SetRequest struct {
+    Name    Flag   `json:"name"`
+    Enabled *bool  `json:"enabled"`
+    Actor   string `json:"actor"`
+    Reason  string `json:"reason"`
+}
+
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+    apijson.Write(w, r, http.StatusOK, map[string]interface{}{
+        "flags": h.Flags.List(),
+    })
+}
+
+// HandleSet applies a change and returns the flag's status. Changes the
+// store fails to save are not applied and are answered with 503.
+func (h *Handler) HandleSet(w http.ResponseWriter, r *http.Request) {
+    var req SetRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        return
+    }
+    req.Actor, req.Reason = strings.TrimSpace(req.Actor), strings.TrimSpace(req.Reason)
+    if req.Actor == "" || req.Reason == "" {
+        http.Error(w, "actor and reason are required", http.StatusBadRequest)
+        return
+    }
+    if len(req.Reason) > maxReasonLength {
+        http.Error(w, "reason must be at most 500 characters", http.StatusBadRequest)
+        return
+    }
+    
+    var status Status
+    var err error
+    if req.Enabled == nil {
+        status, err = h.Flags.Reset(r.Context(), req.Name, req.Actor, req.Reason)
+    } else {
+        status, err = h.Flags.Set(r.Context(), req.Name, *req.Enabled, req.Actor, req.Reason)
+    }
+    if errors.Is(err, ErrUnknownFlag) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusServiceUnavailable)
+        return
+    }
+    
+    apijson.Write(w, r, http.StatusOK, status)
+}
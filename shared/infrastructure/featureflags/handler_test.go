@@ -0,0 +1,76 @@
+package featureflags
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler_HandleSet(t *testing.T) {
+    tests := []struct {
+        name        string
+        body        string
+        storeErr    error
+        wantStatus  int
+        wantEnabled bool
+        wantSource  string
+    }{
+        {name: "set", body: `{"name": "alpha", "enabled": true, "actor": "ops", "reason": "rollout"}`, wantStatus: http.StatusOK, wantEnabled: true, wantSource: SourceRuntime},
+        {name: "null enabled resets", body: `{"name": "alpha", "enabled": null, "actor": "ops", "reason": "rollback"}`, wantStatus: http.StatusOK, wantSource: SourceDefault},
+        {name: "unknown flag", body: `{"name": "gamma", "enabled": true, "actor": "ops", "reason": "rollout"}`, wantStatus: http.StatusNotFound},
+        {name: "no actor", body: `{"name": "alpha", "enabled": true, "reason": "rollout"}`, wantStatus: http.StatusBadRequest},
+        {name: "blank reason", body: `{"name": "alpha", "enabled": true, "actor": "ops", "reason": "  "}`, wantStatus: http.StatusBadRequest},
+        {name: "reason too long", body: `{"name": "alpha", "enabled": true, "actor": "ops", "reason": "` + strings.Repeat("x", maxReasonLength+1) + `"}`, wantStatus: http.StatusBadRequest},
+        {name: "not JSON", body: `enabled`, wantStatus: http.StatusBadRequest},
+        {name: "store fails", body: `{"name": "alpha", "enabled": true, "actor": "ops", "reason": "rollout"}`, storeErr: errors.New("redis down"), wantStatus: http.StatusServiceUnavailable},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            store := newMemoryStore()
+            store.err = tt.storeErr
+            flags := New(WithDefinitions(testDefinitions...), WithStore(store, 0))
+            handler := &Handler{Flags: flags}
+            
+            w := httptest.NewRecorder()
+            handler.HandleSet(w, httptest.NewRequest(http.MethodPut, "/admin/flags", strings.NewReader(tt.body)))
+            
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if got := flags.Enabled("alpha"); got != tt.wantEnabled {
+                t.Errorf("alpha = %t, want %t", got, tt.wantEnabled)
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+            var status Status
+            if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+                t.Fatalf("body is not a status: %v", err)
+            }
+            if status.Name != "alpha" || status.Enabled != tt.wantEnabled || status.Source != tt.wantSource {
+                t.Errorf("body = %+v, want alpha %t from %s", status, tt.wantEnabled, tt.wantSource)
+            }
+        })
+    }
+}
+
+func TestHandler_HandleList(t *testing.T) {
+    handler := &Handler{Flags: New(WithDefinitions(testDefinitions...))}
+    
+    w := httptest.NewRecorder()
+    handler.HandleList(w, httptest.NewRequest(http.MethodGet, "/admin/flags", nil))
+    
+    var body struct {
+        Flags []Status `json:"flags"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("body: %v", err)
+    }
+    if len(body.Flags) != 2 || body.Flags[0].Name != "alpha" || body.Flags[1].Name != "beta" || !body.Flags[1].Enabled {
+        t.Errorf("flags = %+v, want alpha off and beta on, in order", body.Flags)
+    }
+}
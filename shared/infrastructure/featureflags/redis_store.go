@@ -0,0 +1,86 @@
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Config configures where a service's flags come from.
+type Config struct {
+    // Redis shares runtime overrides between instances through Redis;
+    // without it each instance keeps its own until it restarts
+    Redis        bool
+    // RedisKey is the hash holding the overrides; defaults to
+    // DefaultRedisKey
+    RedisKey     string
+    // SyncInterval is how often the overrides are loaded from Redis;
+    // defaults to DefaultSyncInterval
+    SyncInterval time.Duration
+}
+
+// ConfigFromEnv reads FEATURE_FLAGS_REDIS, FEATURE_FLAGS_REDIS_KEY and
+// FEATURE_FLAGS_SYNC_INTERVAL. The flags themselves are read by LoadEnv.
+func ConfigFromEnv() Config {
+    var cfg Config
+    cfg.Redis, _ = strconv.ParseBool(os.Getenv("FEATURE_FLAGS_REDIS"))
+    cfg.RedisKey = os.Getenv("FEATURE_FLAGS_REDIS_KEY")
+    if interval, err := time.ParseDuration(os.Getenv("FEATURE_FLAGS_SYNC_INTERVAL")); err == nil && interval > 0 {
+        cfg.SyncInterval = interval
+    }
+    return cfg
+}
+
+// RedisStore keeps runtime overrides in a Redis hash, one JSON field per
+// flag.
+type RedisStore struct {
+    client redis.Cmdable
+    key    string
+}
+
+// NewRedisStore stores overrides in the hash key; empty defaults to
+// DefaultRedisKey.
+func NewRedisStore(client redis.Cmdable, key string) *RedisStore {
+    if key == "" {
+        key = DefaultRedisKey
+    }
+    return &RedisStore{client: client, key: key}
+}
+
+// Load returns every override in the hash. Fields that do not decode, as
+// written by a build that stores them differently, are skipped with a
+// warning.
+func (s *RedisStore) Load(ctx context.Context) (map[Flag]Override, error) {
+    fields, err := s.client.HGetAll(ctx, s.key).Result()
+    if err != nil {
+        return nil, err
+    }
+    
+    overrides := make(map[Flag]Override, len(fields))
+    for name, value := range fields {
+        var override Override
+        if err := json.Unmarshal([]byte(value), &override); err != nil {
+            log.Printf("Skipping feature flag %s stored in %s: %v", name, s.key, err)
+            continue
+        }
+        overrides[Flag(name)] = override
+    }
+    return overrides, nil
+}
+
+func (s *RedisStore) Save(ctx context.Context, flag Flag, override *Override) error {
+    if override == nil {
+        return s.client.HDel(ctx, s.key, string(flag)).Err()
+    }
+    value, err := json.Marshal(override)
+    if err != nil {
+        return fmt.Errorf("failed to encode feature flag %s: %w", flag, err)
+    }
+    return s.client.HSet(ctx, s.key, string(flag), value).Err()
+}
@@ -0,0 +1,49 @@
+package httpmw
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// APIKeyHeader carries the key required by RequireAPIKey.
+const APIKeyHeader = "X-API-Key"
+
+// RequireAPIKey only lets requests through when they present one of keys in
+// the X-API-Key header, answering 401 otherwise. Requests for the paths in
+// open, such as a health check, need no key.
+func RequireAPIKey(keys []string, open []string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if !containsPath(open, r.URL.Path) && !hasAPIKey(r, keys) {
+                http.Error(w, "unauthorized", http.StatusUnauthorized)
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+func hasAPIKey(r *http.Request, keys []string) bool {
+    provided := []byte(r.Header.Get(APIKeyHeader))
+    if len(provided) == 0 {
+        return false
+    }
+    
+    // Compare with every key so the time taken does not tell which matched
+    found := false
+    for _, key := range keys {
+        if subtle.ConstantTimeCompare(provided, []byte(key)) == 1 {
+            found = true
+        }
+    }
+    return found
+}
+
+func containsPath(paths []string, path string) bool {
+    for _, p := range paths {
+        if p == path {
+            return true
+        }
+    }
+    return false
+}
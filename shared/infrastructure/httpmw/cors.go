@@ -0,0 +1,134 @@
+package httpmw
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type CORSConfig struct {
+    AllowedOrigins   []string
+    AllowedMethods   []string
+    AllowedHeaders   []string
+    AllowCredentials bool
+    MaxAge           int
+}
+
+// CORSConfigFromEnv builds a CORSConfig from CORS_ALLOWED_ORIGINS,
+// CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS (comma separated),
+// CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE. No origins are allowed unless
+// CORS_ALLOWED_ORIGINS is set; use "*" to allow any origin.
+func CORSConfigFromEnv() CORSConfig {
+    cfg := CORSConfig{
+        AllowedOrigins: splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+        AllowedMethods: splitList(os.Getenv("CORS_ALLOWED_METHODS")),
+        AllowedHeaders: splitList(os.Getenv("CORS_ALLOWED_HEADERS")),
+        MaxAge:         600,
+    }
+    
+    if len(cfg.AllowedMethods) == 0 {
+        cfg.AllowedMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+    }
+    if len(cfg.AllowedHeaders) == 0 {
+        cfg.AllowedHeaders = []string{"Content-Type", "Authorization"}
+    }
+    if v, err := strconv.ParseBool(os.Getenv("CORS_ALLOW_CREDENTIALS")); err == nil {
+        cfg.AllowCredentials = v
+    }
+    if v, err := strconv.Atoi(os.Getenv("CORS_MAX_AGE")); err == nil && v >= 0 {
+        cfg.MaxAge = v
+    }
+    
+    return cfg
+}
+
+// CORS answers OPTIONS requests (including preflights) itself so they never
+// reach the router, and adds CORS response headers for allowed origins.
+// It must wrap the router rather than be registered with Router.Use, since
+// mux rejects OPTIONS with 405 before route middleware runs.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+    allowedMethods := strings.Join(cfg.AllowedMethods, ", ")
+    allowedHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+    
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            origin := r.Header.Get("Origin")
+            
+            if r.Method == http.MethodOptions {
+                w.Header().Set("Allow", allowedMethods+", OPTIONS")
+                
+                requestedMethod := r.Header.Get("Access-Control-Request-Method")
+                if origin == "" || requestedMethod == "" {
+                    w.WriteHeader(http.StatusNoContent)
+                    return
+                }
+                
+                w.Header().Add("Vary", "Origin")
+                if !cfg.originAllowed(origin) || !contains(cfg.AllowedMethods, requestedMethod) {
+                    w.WriteHeader(http.StatusForbidden)
+                    return
+                }
+                
+                cfg.setOriginHeaders(w, origin)
+                w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+                w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+                if cfg.MaxAge > 0 {
+                    w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+                }
+                w.WriteHeader(http.StatusNoContent)
+                return
+            }
+            
+            if origin != "" {
+                w.Header().Add("Vary", "Origin")
+                if cfg.originAllowed(origin) {
+                    cfg.setOriginHeaders(w, origin)
+                }
+            }
+            
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+func (cfg CORSConfig) originAllowed(origin string) bool {
+    for _, allowed := range cfg.AllowedOrigins {
+        if allowed == "*" || strings.EqualFold(allowed, origin) {
+            return true
+        }
+    }
+    return false
+}
+
+func (cfg CORSConfig) setOriginHeaders(w http.ResponseWriter, origin string) {
+    // A wildcard cannot be combined with credentials, so echo the origin
+    if contains(cfg.AllowedOrigins, "*") && !cfg.AllowCredentials {
+        w.Header().Set("Access-Control-Allow-Origin", "*")
+    } else {
+        w.Header().Set("Access-Control-Allow-Origin", origin)
+    }
+    
+    if cfg.AllowCredentials {
+        w.Header().Set("Access-Control-Allow-Credentials", "true")
+    }
+}
+
+func contains(values []string, value string) bool {
+    for _, v := range values {
+        if strings.EqualFold(v, value) {
+            return true
+        }
+    }
+    return false
+}
+
+func splitList(value string) []string {
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
@@ -0,0 +1,228 @@
+package httpmw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// corsRouter is a router with a GET route only, which answers OPTIONS with
+// 405 by itself.
+func corsRouter(cfg CORSConfig) http.Handler {
+    router := mux.NewRouter()
+    router.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }).Methods("GET")
+    return CORS(cfg)(router)
+}
+
+func TestCORS_preflight(t *testing.T) {
+    cfg := CORSConfig{
+        AllowedOrigins: []string{"https://shop.example.com"},
+        AllowedMethods: []string{"GET", "POST"},
+        AllowedHeaders: []string{"Content-Type", "Authorization"},
+        MaxAge:         600,
+    }
+    tests := []struct {
+        name       string
+        cfg        CORSConfig
+        origin     string
+        method     string
+        wantStatus int
+        wantHeader map[string]string
+    }{
+        {
+            name:       "allowed origin and method",
+            cfg:        cfg,
+            origin:     "https://shop.example.com",
+            method:     "POST",
+            wantStatus: http.StatusNoContent,
+            wantHeader: map[string]string{
+                "Access-Control-Allow-Origin":      "https://shop.example.com",
+                "Access-Control-Allow-Methods":     "GET, POST",
+                "Access-Control-Allow-Headers":     "Content-Type, Authorization",
+                "Access-Control-Max-Age":           "600",
+                "Access-Control-Allow-Credentials": "",
+                "Vary":                             "Origin",
+            },
+        },
+        {
+            name:       "origin matched without case",
+            cfg:        cfg,
+            origin:     "https://SHOP.example.com",
+            method:     "GET",
+            wantStatus: http.StatusNoContent,
+            wantHeader: map[string]string{"Access-Control-Allow-Origin": "https://SHOP.example.com"},
+        },
+        {
+            name:       "origin not allowed",
+            cfg:        cfg,
+            origin:     "https://evil.example.com",
+            method:     "GET",
+            wantStatus: http.StatusForbidden,
+            wantHeader: map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+        },
+        {
+            name:       "method not allowed",
+            cfg:        cfg,
+            origin:     "https://shop.example.com",
+            method:     "DELETE",
+            wantStatus: http.StatusForbidden,
+            wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+        },
+        {
+            name:       "no origins configured",
+            cfg:        CORSConfig{AllowedMethods: []string{"GET"}},
+            origin:     "https://shop.example.com",
+            method:     "GET",
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name:       "any origin",
+            cfg:        CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}},
+            origin:     "https://shop.example.com",
+            method:     "GET",
+            wantStatus: http.StatusNoContent,
+            wantHeader: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Max-Age": ""},
+        },
+        {
+            name:       "any origin with credentials echoes the origin",
+            cfg:        CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, AllowCredentials: true},
+            origin:     "https://shop.example.com",
+            method:     "GET",
+            wantStatus: http.StatusNoContent,
+            wantHeader: map[string]string{"Access-Control-Allow-Origin": "https://shop.example.com", "Access-Control-Allow-Credentials": "true"},
+        },
+        {
+            name:       "plain OPTIONS without origin",
+            cfg:        cfg,
+            wantStatus: http.StatusNoContent,
+            wantHeader: map[string]string{"Allow": "GET, POST, OPTIONS", "Access-Control-Allow-Origin": ""},
+        },
+        {
+            name:       "OPTIONS without a requested method",
+            cfg:        cfg,
+            origin:     "https://shop.example.com",
+            wantStatus: http.StatusNoContent,
+            wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodOptions, "/orders", nil)
+            if tt.origin != "" {
+                r.Header.Set("Origin", tt.origin)
+            }
+            if tt.method != "" {
+                r.Header.Set("Access-Control-Request-Method", tt.method)
+            }
+            w := httptest.NewRecorder()
+            
+            // Answered before the router, which would say 405
+            corsRouter(tt.cfg).ServeHTTP(w, r)
+            
+            if w.Code != tt.wantStatus {
+                t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+            }
+            for name, want := range tt.wantHeader {
+                if got := w.Header().Get(name); got != want {
+                    t.Errorf("%s = %q, want %q", name, got, want)
+                }
+            }
+        })
+    }
+}
+
+func TestCORS_request(t *testing.T) {
+    cfg := CORSConfig{AllowedOrigins: []string{"https://shop.example.com"}, AllowedMethods: []string{"GET"}, AllowCredentials: true}
+    tests := []struct {
+        name       string
+        origin     string
+        wantOrigin string
+        wantVary   string
+    }{
+        {name: "allowed origin", origin: "https://shop.example.com", wantOrigin: "https://shop.example.com", wantVary: "Origin"},
+        {name: "other origin is served without CORS headers", origin: "https://evil.example.com", wantVary: "Origin"},
+        {name: "same origin", origin: ""},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+            if tt.origin != "" {
+                r.Header.Set("Origin", tt.origin)
+            }
+            w := httptest.NewRecorder()
+            
+            corsRouter(cfg).ServeHTTP(w, r)
+            
+            if w.Code != http.StatusOK {
+                t.Errorf("status = %d, want the route's 200", w.Code)
+            }
+            if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+                t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+            }
+            if got := w.Header().Get("Vary"); got != tt.wantVary {
+                t.Errorf("Vary = %q, want %q", got, tt.wantVary)
+            }
+        })
+    }
+}
+
+func TestCORSConfigFromEnv(t *testing.T) {
+    tests := []struct {
+        name string
+        env  map[string]string
+        want CORSConfig
+    }{
+        {
+            name: "defaults",
+            want: CORSConfig{
+                AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+                AllowedHeaders: []string{"Content-Type", "Authorization"},
+                MaxAge:         600,
+            },
+        },
+        {
+            name: "configured",
+            env: map[string]string{
+                "CORS_ALLOWED_ORIGINS":   " https://a.example.com, ,https://b.example.com ",
+                "CORS_ALLOWED_METHODS":   "GET,POST",
+                "CORS_ALLOWED_HEADERS":   "X-Request-ID",
+                "CORS_ALLOW_CREDENTIALS": "true",
+                "CORS_MAX_AGE":           "0",
+            },
+            want: CORSConfig{
+                AllowedOrigins:   []string{"https://a.example.com", "https://b.example.com"},
+                AllowedMethods:   []string{"GET", "POST"},
+                AllowedHeaders:   []string{"X-Request-ID"},
+                AllowCredentials: true,
+            },
+        },
+        {
+            name: "invalid values keep the defaults",
+            env:  map[string]string{"CORS_ALLOW_CREDENTIALS": "sometimes", "CORS_MAX_AGE": "-1"},
+            want: CORSConfig{
+                AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+                AllowedHeaders: []string{"Content-Type", "Authorization"},
+                MaxAge:         600,
+            },
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, name := range []string{"CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_METHODS", "CORS_ALLOWED_HEADERS", "CORS_ALLOW_CREDENTIALS", "CORS_MAX_AGE"} {
+                t.Setenv(name, tt.env[name])
+            }
+            
+            if got := CORSConfigFromEnv(); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("CORSConfigFromEnv() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,101 @@
+package httpmw
+
+import (
+	"expvar"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/logredact"
+)
+
+// statusRecorder remembers the status written through it.
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+    if r.status == 0 {
+        r.status = status
+    }
+    r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+    if r.status == 0 {
+        r.status = http.StatusOK
+    }
+    return r.ResponseWriter.Write(data)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+    return r.ResponseWriter
+}
+
+// serve runs next and returns the status it answered with.
+func serve(next http.Handler, w http.ResponseWriter, r *http.Request) int {
+    recorder := &statusRecorder{ResponseWriter: w}
+    next.ServeHTTP(recorder, r)
+    if recorder.status == 0 {
+        return http.StatusOK
+    }
+    return recorder.status
+}
+
+// maxLoggedBody caps the part of a request body kept for the payload log.
+const maxLoggedBody = 4 << 10
+
+// bodyRecorder keeps the start of a request body as the handler reads it.
+type bodyRecorder struct {
+    io.ReadCloser
+    data []byte
+}
+
+func (b *bodyRecorder) Read(p []byte) (int, error) {
+    n, err := b.ReadCloser.Read(p)
+    if room := maxLoggedBody - len(b.data); room > 0 {
+        b.data = append(b.data, p[:min(n, room)]...)
+    }
+    return n, err
+}
+
+// Logging logs each request's method, path, status, duration and request
+// id once it has been answered. Bodies are never logged unless
+// logredact.SetPayloadLogging is on; then the body the handler read is
+// logged too, redacted, or as a byte count when it is not JSON or is
+// over 4 KiB.
+func Logging(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var body *bodyRecorder
+        if logredact.PayloadLogging() && r.Body != nil && r.Body != http.NoBody {
+            body = &bodyRecorder{ReadCloser: r.Body}
+            r.Body = body
+        }
+        
+        start := time.Now()
+        status := serve(next, w, r)
+        log.Printf("%s %s %d %s request_id=%s", r.Method, r.URL.Path, status, time.Since(start).Round(time.Microsecond), RequestIDFromContext(r.Context()))
+        if body != nil && len(body.data) > 0 {
+            log.Printf("Request %s body: %s", RequestIDFromContext(r.Context()), logredact.JSON(body.data))
+        }
+    })
+}
+
+// httpStats is published as the "http_requests" expvar: requests, requests
+// by status class such as 2xx, and their total duration in milliseconds.
+var httpStats = expvar.NewMap("http_requests")
+
+// Metrics counts requests and their durations in the "http_requests"
+// expvar.
+func Metrics(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        status := serve(next, w, r)
+        httpStats.Add("requests", 1)
+        httpStats.Add(strconv.Itoa(status/100)+"xx", 1)
+        httpStats.Add("duration_ms", time.Since(start).Milliseconds())
+    })
+}
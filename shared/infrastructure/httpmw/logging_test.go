@@ -0,0 +1,80 @@
+package httpmw
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/logredact"
+)
+
+// Request bodies are only logged with payload logging on, and then
+// redacted, as the handler read them.
+func TestLogging_body(t *testing.T) {
+    const body = `{"customer_id": "customer-1", "shipping_address": {"street": "1 Main St", "city": "Springfield", "zip": "62701", "country": "US"}}`
+    tests := []struct {
+        name     string
+        payloads bool
+        body     string
+        want     []string
+        wantNot  []string
+    }{
+        {name: "payload logging off", body: body, wantNot: []string{"body:", "customer-1", "1 Main St"}},
+        {name: "redacted", payloads: true, body: body, want: []string{"body:", "customer-1", `"country":"US"`}, wantNot: []string{"1 Main St", "Springfield", "62701"}},
+        {
+            name:     "guest order",
+            payloads: true,
+            body:     `{"contact_email": "jane.doe@example.com", "items": [{"product_id": "product-1", "quantity": 1}], "shipping_address": {"street": "742 Evergreen Terrace", "city": "Springfield", "state": "OR", "zip": "97475", "country": "US"}}`,
+            want:     []string{"product-1", `"contact_email":"[REDACTED]"`, `"country":"US"`},
+            wantNot:  []string{"jane.doe@example.com", "742 Evergreen Terrace", "Springfield", "97475"},
+        },
+        {
+            name:     "customer address",
+            payloads: true,
+            body:     `{"label": "home", "address": {"street": "742 Evergreen Terrace", "city": "Springfield", "zip": "97475", "country": "US"}, "email": "jane.doe@example.com"}`,
+            want:     []string{`"label":"home"`},
+            wantNot:  []string{"jane.doe@example.com", "742 Evergreen Terrace", "Springfield", "97475"},
+        },
+        {name: "not JSON", payloads: true, body: "street=1 Main St", want: []string{"[16 bytes, not JSON]"}, wantNot: []string{"1 Main St"}},
+        {name: "over the cap", payloads: true, body: `{"street": "` + strings.Repeat("1 Main St ", 500) + `"}`, want: []string{"[4096 bytes, not JSON]"}, wantNot: []string{"1 Main St"}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            logredact.SetPayloadLogging(tt.payloads)
+            defer logredact.SetPayloadLogging(false)
+            var logs bytes.Buffer
+            defer log.SetOutput(log.Writer())
+            log.SetOutput(&logs)
+            
+            var read string
+            handler := Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                data, _ := io.ReadAll(r.Body)
+                read = string(data)
+                w.WriteHeader(http.StatusCreated)
+            }))
+            handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/orders", strings.NewReader(tt.body)))
+            
+            if read != tt.body {
+                t.Errorf("handler read %d bytes, want the whole body of %d", len(read), len(tt.body))
+            }
+            if !strings.Contains(logs.String(), "POST /api/v1/orders 201") {
+                t.Errorf("log = %q, want the request line", logs.String())
+            }
+            for _, want := range tt.want {
+                if !strings.Contains(logs.String(), want) {
+                    t.Errorf("log = %q, want %q", logs.String(), want)
+                }
+            }
+            for _, pii := range tt.wantNot {
+                if strings.Contains(logs.String(), pii) {
+                    t.Errorf("log = %q, contains %q", logs.String(), pii)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,245 @@
+package httpmw
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the middlewares a pipeline can apply
+const (
+    MiddlewareRecovery  = "recovery"
+    MiddlewareLogging   = "logging"
+    MiddlewareMetrics   = "metrics"
+    MiddlewareAuth      = "auth"
+    MiddlewareRateLimit = "ratelimit"
+    MiddlewareCORS      = "cors"
+    MiddlewareTimeout   = "timeout"
+)
+
+// Pipeline profiles
+const (
+    // ProfileInternal serves trusted callers: no CORS, auth or rate limit
+    ProfileInternal = "internal"
+    // ProfilePublic applies every middleware
+    ProfilePublic = "public"
+    // ProfileCustom applies PipelineConfig.Middlewares
+    ProfileCustom = "custom"
+)
+
+// Profiles lists the middlewares of each profile but custom, outermost
+// first. Logging and metrics wrap recovery so they see the 500 it answers a
+// panic with.
+var Profiles = map[string][]string{
+    ProfileInternal: {MiddlewareLogging, MiddlewareMetrics, MiddlewareRecovery, MiddlewareTimeout},
+    ProfilePublic:   {MiddlewareLogging, MiddlewareMetrics, MiddlewareRecovery, MiddlewareCORS, MiddlewareRateLimit, MiddlewareAuth, MiddlewareTimeout},
+}
+
+// DefaultMiddlewares is the custom list used when none is configured, the
+// chain the services used before pipelines were configurable.
+var DefaultMiddlewares = []string{MiddlewareRecovery, MiddlewareCORS}
+
+// DefaultTimeout bounds requests when the timeout middleware applies and no
+// timeout is configured.
+const DefaultTimeout = 30 * time.Second
+
+// ErrInvalidPipeline is wrapped by the errors NewPipeline returns for a
+// configuration that cannot work.
+var ErrInvalidPipeline = errors.New("invalid middleware pipeline")
+
+// PipelineConfig selects and configures the middlewares in front of a
+// service's router. Request ids and trace context are always applied,
+// outside the configured middlewares.
+type PipelineConfig struct {
+    // Profile is internal, public or custom; empty means custom
+    Profile string
+    // Middlewares lists the custom profile's middlewares, outermost first;
+    // empty means DefaultMiddlewares
+    Middlewares []string
+    CORS        CORSConfig
+    // APIKeys are accepted by the auth middleware in the X-API-Key header
+    APIKeys   []string
+    // RateLimit defaults to DefaultRateLimitConfig when zero
+    RateLimit RateLimitConfig
+    // Timeout defaults to DefaultTimeout
+    Timeout time.Duration
+    // OpenPaths need no API key and are not rate limited; defaults to
+    // /health
+    OpenPaths []string
+}
+
+// PipelineConfigFromEnv reads HTTP_PROFILE, HTTP_MIDDLEWARES (comma
+// separated, for the custom profile), HTTP_API_KEYS (comma separated),
+// HTTP_RATE_LIMIT_RPS, HTTP_RATE_LIMIT_BURST, HTTP_TIMEOUT and
+// HTTP_OPEN_PATHS, with CORS configured by CORSConfigFromEnv.
+func PipelineConfigFromEnv() PipelineConfig {
+    cfg := PipelineConfig{
+        Profile:     strings.ToLower(strings.TrimSpace(os.Getenv("HTTP_PROFILE"))),
+        Middlewares: splitList(strings.ToLower(os.Getenv("HTTP_MIDDLEWARES"))),
+        CORS:        CORSConfigFromEnv(),
+        APIKeys:     splitList(os.Getenv("HTTP_API_KEYS")),
+        RateLimit:   DefaultRateLimitConfig,
+        OpenPaths:   splitList(os.Getenv("HTTP_OPEN_PATHS")),
+    }
+    
+    if v, err := strconv.ParseFloat(os.Getenv("HTTP_RATE_LIMIT_RPS"), 64); err == nil && v > 0 {
+        cfg.RateLimit.RequestsPerSecond = v
+    }
+    if v, err := strconv.Atoi(os.Getenv("HTTP_RATE_LIMIT_BURST")); err == nil && v > 0 {
+        cfg.RateLimit.Burst = v
+    }
+    if v, err := time.ParseDuration(os.Getenv("HTTP_TIMEOUT")); err == nil && v > 0 {
+        cfg.Timeout = v
+    }
+    
+    return cfg
+}
+
+// Pipeline is a validated chain of middlewares.
+type Pipeline struct {
+    names       []string
+    middlewares []func(http.Handler) http.Handler
+}
+
+// NewPipeline checks cfg and builds its chain. It fails, so the service can
+// refuse to start, on an unknown profile or middleware, a repeated
+// middleware, auth without API keys, a rate limit that admits nothing, and
+// orders that break a middleware:
+//   - cors must come before auth and ratelimit, which would otherwise reject
+//     or count preflight requests
+//   - recovery must come before timeout, whose handler goroutine re-panics
+//     in the caller
+func NewPipeline(cfg PipelineConfig) (*Pipeline, error) {
+    names, err := cfg.middlewareNames()
+    if err != nil {
+        return nil, err
+    }
+    if err := validateOrder(names); err != nil {
+        return nil, err
+    }
+    
+    open := cfg.OpenPaths
+    if len(open) == 0 {
+        open = []string{"/health"}
+    }
+    if cfg.RateLimit == (RateLimitConfig{}) {
+        cfg.RateLimit = DefaultRateLimitConfig
+    }
+    timeout := cfg.Timeout
+    if timeout <= 0 {
+        timeout = DefaultTimeout
+    }
+    
+    pipeline := &Pipeline{names: names}
+    for _, name := range names {
+        var middleware func(http.Handler) http.Handler
+        switch name {
+        case MiddlewareRecovery:
+            middleware = Recover
+        case MiddlewareLogging:
+            middleware = Logging
+        case MiddlewareMetrics:
+            middleware = Metrics
+        case MiddlewareAuth:
+            if len(cfg.APIKeys) == 0 {
+                return nil, fmt.Errorf("%w: auth needs at least one API key", ErrInvalidPipeline)
+            }
+            middleware = RequireAPIKey(cfg.APIKeys, open)
+        case MiddlewareRateLimit:
+            if cfg.RateLimit.RequestsPerSecond <= 0 || cfg.RateLimit.Burst < 1 {
+                return nil, fmt.Errorf("%w: ratelimit needs a positive rate and a burst of at least 1", ErrInvalidPipeline)
+            }
+            middleware = RateLimit(cfg.RateLimit, open)
+        case MiddlewareCORS:
+            middleware = CORS(cfg.CORS)
+        case MiddlewareTimeout:
+            middleware = func(next http.Handler) http.Handler {
+                return http.TimeoutHandler(next, timeout, "request timed out")
+            }
+        }
+        pipeline.middlewares = append(pipeline.middlewares, middleware)
+    }
+    
+    return pipeline, nil
+}
+
+func (cfg PipelineConfig) middlewareNames() ([]string, error) {
+    var names []string
+    switch cfg.Profile {
+    case "", ProfileCustom:
+        names = cfg.Middlewares
+        if len(names) == 0 {
+            names = DefaultMiddlewares
+        }
+    default:
+        profile, ok := Profiles[cfg.Profile]
+        if !ok {
+            return nil, fmt.Errorf("%w: unknown profile %q, must be internal, public or custom", ErrInvalidPipeline, cfg.Profile)
+        }
+        if len(cfg.Middlewares) > 0 {
+            return nil, fmt.Errorf("%w: middlewares can only be listed with the custom profile", ErrInvalidPipeline)
+        }
+        names = profile
+    }
+    
+    seen := make(map[string]bool)
+    for _, name := range names {
+        switch name {
+        case MiddlewareRecovery, MiddlewareLogging, MiddlewareMetrics, MiddlewareAuth, MiddlewareRateLimit, MiddlewareCORS, MiddlewareTimeout:
+        default:
+            return nil, fmt.Errorf("%w: unknown middleware %q", ErrInvalidPipeline, name)
+        }
+        if seen[name] {
+            return nil, fmt.Errorf("%w: %s is listed twice", ErrInvalidPipeline, name)
+        }
+        seen[name] = true
+    }
+    return names, nil
+}
+
+// mustPrecede lists, for a middleware, those that may only come after it.
+var mustPrecede = map[string][]string{
+    MiddlewareCORS:     {MiddlewareAuth, MiddlewareRateLimit},
+    MiddlewareRecovery: {MiddlewareTimeout},
+}
+
+func validateOrder(names []string) error {
+    position := make(map[string]int, len(names))
+    for i, name := range names {
+        position[name] = i
+    }
+    for first, laters := range mustPrecede {
+        at, ok := position[first]
+        if !ok {
+            continue
+        }
+        for _, later := range laters {
+            if laterAt, ok := position[later]; ok && laterAt < at {
+                return fmt.Errorf("%w: %s must come before %s", ErrInvalidPipeline, first, later)
+            }
+        }
+    }
+    return nil
+}
+
+// Names returns the pipeline's middlewares, outermost first.
+func (p *Pipeline) Names() []string {
+    return append([]string(nil), p.names...)
+}
+
+// Then wraps handler in the pipeline, inside RequestID and TraceContext.
+func (p *Pipeline) Then(handler http.Handler) http.Handler {
+    for i := len(p.middlewares) - 1; i >= 0; i-- {
+        handler = p.middlewares[i](handler)
+    }
+    return RequestID(TraceContext(handler))
+}
+
+// String describes the chain for startup logs.
+func (p *Pipeline) String() string {
+    return strings.Join(append([]string{"requestid", "tracecontext"}, p.names...), " > ")
+}
@@ -0,0 +1,204 @@
+package httpmw
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Each profile composes its middlewares in its documented order; the
+// custom profile takes the configured list or the pre-pipeline default.
+func TestNewPipeline_profiles(t *testing.T) {
+    tests := []struct {
+        name string
+        cfg  PipelineConfig
+        want []string
+    }{
+        {name: "internal", cfg: PipelineConfig{Profile: ProfileInternal}, want: []string{"logging", "metrics", "recovery", "timeout"}},
+        {name: "public", cfg: PipelineConfig{Profile: ProfilePublic, APIKeys: []string{"key"}}, want: []string{"logging", "metrics", "recovery", "cors", "ratelimit", "auth", "timeout"}},
+        {name: "custom default", cfg: PipelineConfig{}, want: []string{"recovery", "cors"}},
+        {name: "custom", cfg: PipelineConfig{Profile: ProfileCustom, Middlewares: []string{"logging", "cors", "auth"}, APIKeys: []string{"key"}}, want: []string{"logging", "cors", "auth"}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pipeline, err := NewPipeline(tt.cfg)
+            if err != nil {
+                t.Fatalf("NewPipeline() = %v", err)
+            }
+            if got := pipeline.Names(); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("Names() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+// Configurations that cannot work fail at startup.
+func TestNewPipeline_invalid(t *testing.T) {
+    tests := []struct {
+        name string
+        cfg  PipelineConfig
+    }{
+        {name: "unknown profile", cfg: PipelineConfig{Profile: "partner"}},
+        {name: "middlewares with a profile", cfg: PipelineConfig{Profile: ProfileInternal, Middlewares: []string{"cors"}}},
+        {name: "unknown middleware", cfg: PipelineConfig{Middlewares: []string{"recovery", "gzip"}}},
+        {name: "repeated middleware", cfg: PipelineConfig{Middlewares: []string{"logging", "logging"}}},
+        {name: "public without API keys", cfg: PipelineConfig{Profile: ProfilePublic}},
+        {name: "rate limit admitting nothing", cfg: PipelineConfig{Middlewares: []string{"ratelimit"}, RateLimit: RateLimitConfig{RequestsPerSecond: 1}}},
+        {name: "cors after auth", cfg: PipelineConfig{Middlewares: []string{"auth", "cors"}, APIKeys: []string{"key"}}},
+        {name: "cors after ratelimit", cfg: PipelineConfig{Middlewares: []string{"ratelimit", "cors"}}},
+        {name: "recovery after timeout", cfg: PipelineConfig{Middlewares: []string{"timeout", "recovery"}}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if pipeline, err := NewPipeline(tt.cfg); !errors.Is(err, ErrInvalidPipeline) {
+                t.Errorf("NewPipeline() = %v, %v, want ErrInvalidPipeline", pipeline, err)
+            }
+        })
+    }
+}
+
+// The public chain lets preflights and open paths through without a key,
+// refuses other requests without one, and recovers panics.
+func TestPipeline_Then_public(t *testing.T) {
+    pipeline, err := NewPipeline(PipelineConfig{
+        Profile: ProfilePublic,
+        APIKeys: []string{"secret"},
+        CORS:    CORSConfig{AllowedOrigins: []string{"https://shop.example.com"}, AllowedMethods: []string{"GET"}},
+    })
+    if err != nil {
+        t.Fatalf("NewPipeline() = %v", err)
+    }
+    handler := pipeline.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/panic" {
+            panic("handler bug")
+        }
+        w.WriteHeader(http.StatusOK)
+    }))
+    
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        key        string
+        origin     string
+        wantStatus int
+    }{
+        {name: "without a key", method: http.MethodGet, path: "/orders", wantStatus: http.StatusUnauthorized},
+        {name: "with a wrong key", method: http.MethodGet, path: "/orders", key: "guess", wantStatus: http.StatusUnauthorized},
+        {name: "with the key", method: http.MethodGet, path: "/orders", key: "secret", wantStatus: http.StatusOK},
+        {name: "health without a key", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK},
+        {name: "preflight without a key", method: http.MethodOptions, path: "/orders", origin: "https://shop.example.com", wantStatus: http.StatusNoContent},
+        {name: "panic", method: http.MethodGet, path: "/panic", key: "secret", wantStatus: http.StatusInternalServerError},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(tt.method, tt.path, nil)
+            if tt.key != "" {
+                r.Header.Set(APIKeyHeader, tt.key)
+            }
+            if tt.origin != "" {
+                r.Header.Set("Origin", tt.origin)
+                r.Header.Set("Access-Control-Request-Method", "GET")
+            }
+            w := httptest.NewRecorder()
+            handler.ServeHTTP(w, r)
+            if w.Code != tt.wantStatus {
+                t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if w.Header().Get(RequestIDHeader) == "" {
+                t.Errorf("response has no %s", RequestIDHeader)
+            }
+        })
+    }
+}
+
+// The internal chain needs no key and applies no rate limit.
+func TestPipeline_Then_internal(t *testing.T) {
+    pipeline, err := NewPipeline(PipelineConfig{Profile: ProfileInternal})
+    if err != nil {
+        t.Fatalf("NewPipeline() = %v", err)
+    }
+    handler := pipeline.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }))
+    for i := 0; i < DefaultRateLimitConfig.Burst+1; i++ {
+        w := httptest.NewRecorder()
+        handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+        if w.Code != http.StatusOK {
+            t.Fatalf("request %d = %d, want 200", i+1, w.Code)
+        }
+    }
+}
+
+// Each client has its own bucket, refilled at the configured rate.
+func TestRateLimiter_allow(t *testing.T) {
+    now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    limiter := &rateLimiter{cfg: RateLimitConfig{RequestsPerSecond: 2, Burst: 2}, now: func() time.Time { return now }, buckets: make(map[string]*bucket)}
+    
+    for i := 0; i < 2; i++ {
+        if ok, _ := limiter.allow("10.0.0.1"); !ok {
+            t.Fatalf("request %d within the burst refused", i+1)
+        }
+    }
+    if ok, wait := limiter.allow("10.0.0.1"); ok || wait != 500*time.Millisecond {
+        t.Errorf("request over the burst = %t, wait %s, want refused for 500ms", ok, wait)
+    }
+    if ok, _ := limiter.allow("10.0.0.2"); !ok {
+        t.Errorf("another client's request refused")
+    }
+    
+    now = now.Add(500 * time.Millisecond)
+    if ok, _ := limiter.allow("10.0.0.1"); !ok {
+        t.Errorf("request after the refill refused")
+    }
+}
+
+// A limited client gets 429 with a Retry-After in whole seconds.
+func TestRateLimit(t *testing.T) {
+    handler := RateLimit(RateLimitConfig{RequestsPerSecond: 0.5, Burst: 1}, []string{"/health"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }))
+    serve := func(path string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+        return w
+    }
+    
+    if w := serve("/orders"); w.Code != http.StatusOK {
+        t.Fatalf("first request = %d, want 200", w.Code)
+    }
+    w := serve("/orders")
+    if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+        t.Errorf("second request = %d, Retry-After %q, want 429 after 2 seconds", w.Code, w.Header().Get("Retry-After"))
+    }
+    if w := serve("/health"); w.Code != http.StatusOK {
+        t.Errorf("open path = %d, want 200", w.Code)
+    }
+}
+
+func TestPipelineConfigFromEnv(t *testing.T) {
+    t.Setenv("HTTP_PROFILE", " Custom ")
+    t.Setenv("HTTP_MIDDLEWARES", "Recovery, cors")
+    t.Setenv("HTTP_API_KEYS", "a,b")
+    t.Setenv("HTTP_RATE_LIMIT_RPS", "5")
+    t.Setenv("HTTP_RATE_LIMIT_BURST", "bad")
+    t.Setenv("HTTP_TIMEOUT", "5s")
+    t.Setenv("HTTP_OPEN_PATHS", "/health,/ready")
+    
+    cfg := PipelineConfigFromEnv()
+    if cfg.Profile != ProfileCustom || !reflect.DeepEqual(cfg.Middlewares, []string{"recovery", "cors"}) {
+        t.Errorf("profile %q with %v, want custom with [recovery cors]", cfg.Profile, cfg.Middlewares)
+    }
+    if !reflect.DeepEqual(cfg.APIKeys, []string{"a", "b"}) || !reflect.DeepEqual(cfg.OpenPaths, []string{"/health", "/ready"}) {
+        t.Errorf("API keys %v, open paths %v", cfg.APIKeys, cfg.OpenPaths)
+    }
+    if want := (RateLimitConfig{RequestsPerSecond: 5, Burst: DefaultRateLimitConfig.Burst}); cfg.RateLimit != want || cfg.Timeout != 5*time.Second {
+        t.Errorf("rate limit %+v, timeout %s, want %+v, 5s", cfg.RateLimit, cfg.Timeout, want)
+    }
+}
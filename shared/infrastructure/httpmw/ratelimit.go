@@ -0,0 +1,106 @@
+package httpmw
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig bounds each client, identified by its remote address, to
+// RequestsPerSecond on average with bursts of up to Burst requests.
+type RateLimitConfig struct {
+    RequestsPerSecond float64
+    Burst             int
+}
+
+// DefaultRateLimitConfig allows 20 requests a second with bursts of 40.
+var DefaultRateLimitConfig = RateLimitConfig{RequestsPerSecond: 20, Burst: 40}
+
+// idleBucketTTL is how long a client's bucket is kept after its last
+// request.
+const idleBucketTTL = 10 * time.Minute
+
+type bucket struct {
+    tokens float64
+    last   time.Time
+}
+
+type rateLimiter struct {
+    cfg     RateLimitConfig
+    now     func() time.Time
+    mu      sync.Mutex
+    buckets map[string]*bucket
+    swept   time.Time
+}
+
+// allow takes a token from client's bucket, returning how long to wait
+// for one when none is left.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    
+    now := l.now()
+    l.sweep(now)
+    
+    b, ok := l.buckets[client]
+    if !ok {
+        b = &bucket{tokens: float64(l.cfg.Burst), last: now}
+        l.buckets[client] = b
+    }
+    b.tokens = math.Min(float64(l.cfg.Burst), b.tokens+now.Sub(b.last).Seconds()*l.cfg.RequestsPerSecond)
+    b.last = now
+    
+    if b.tokens < 1 {
+        return false, time.Duration((1 - b.tokens) / l.cfg.RequestsPerSecond * float64(time.Second))
+    }
+    b.tokens--
+    return true, 0
+}
+
+// sweep drops the buckets of clients idle for idleBucketTTL, at most once
+// per idleBucketTTL.
+func (l *rateLimiter) sweep(now time.Time) {
+    if now.Sub(l.swept) < idleBucketTTL {
+        return
+    }
+    for client, b := range l.buckets {
+        if now.Sub(b.last) > idleBucketTTL {
+            delete(l.buckets, client)
+        }
+    }
+    l.swept = now
+}
+
+// RateLimit answers 429 with a Retry-After header to clients over cfg's
+// rate. Requests for the paths in open are not limited. Limits are kept per
+// instance, in memory.
+func RateLimit(cfg RateLimitConfig, open []string) func(http.Handler) http.Handler {
+    limiter := &rateLimiter{cfg: cfg, now: time.Now, buckets: make(map[string]*bucket)}
+    
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if !containsPath(open, r.URL.Path) {
+                if ok, wait := limiter.allow(clientAddress(r)); !ok {
+                    w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+                    http.Error(w, "too many requests", http.StatusTooManyRequests)
+                    return
+                }
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// clientAddress is the host of the request's remote address. Forwarding
+// headers are not trusted, so behind a proxy every client shares the
+// proxy's limit.
+func clientAddress(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
@@ -0,0 +1,39 @@
+package httpmw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+)
+
+// Recover converts a panic in next into a 500 JSON error carrying the
+// request id. The panic is logged, counted and reported through the
+// recovery package. Place it inside RequestID so the id is available.
+func Recover(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        defer func() {
+            value := recover()
+            if value == nil {
+                return
+            }
+            if value == http.ErrAbortHandler {
+                // Deliberate abort; let net/http handle it
+                panic(value)
+            }
+            
+            requestID := RequestIDFromContext(r.Context())
+            recovery.Recovered(r.Context(), "http", fmt.Sprintf("%s %s request_id=%s", r.Method, r.URL.Path, requestID), value)
+            
+            w.Header().Set("Content-Type", "application/json")
+            w.WriteHeader(http.StatusInternalServerError)
+            json.NewEncoder(w).Encode(map[string]string{
+                "error":      "internal_error",
+                "request_id": requestID,
+            })
+        }()
+        
+        next.ServeHTTP(w, r)
+    })
+}
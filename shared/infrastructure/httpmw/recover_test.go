@@ -0,0 +1,54 @@
+package httpmw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+)
+
+// A panicking handler is answered with a 500 carrying the request id, and
+// the server goes on serving other requests.
+func TestRecover(t *testing.T) {
+    router := mux.NewRouter()
+    router.HandleFunc("/panic", func(http.ResponseWriter, *http.Request) { panic("handler bug") })
+    router.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+    server := httptest.NewServer(RequestID(Recover(router)))
+    defer server.Close()
+    before := recovery.Count("http")
+    
+    req, err := http.NewRequest(http.MethodGet, server.URL+"/panic", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    req.Header.Set(RequestIDHeader, "req-1")
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatalf("GET /panic: %v", err)
+    }
+    var body map[string]string
+    err = json.NewDecoder(resp.Body).Decode(&body)
+    resp.Body.Close()
+    if err != nil {
+        t.Fatalf("decoding the error: %v", err)
+    }
+    if resp.StatusCode != http.StatusInternalServerError || body["error"] != "internal_error" || body["request_id"] != "req-1" {
+        t.Errorf("GET /panic = %d %v, want 500 internal_error for req-1", resp.StatusCode, body)
+    }
+    if got := recovery.Count("http"); got != before+1 {
+        t.Errorf("recovered %d http panics, want %d", got, before+1)
+    }
+    
+    resp, err = http.Get(server.URL + "/ok")
+    if err != nil {
+        t.Fatalf("GET /ok after the panic: %v", err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Errorf("GET /ok after the panic = %d, want 200", resp.StatusCode)
+    }
+}
@@ -0,0 +1,33 @@
+package httpmw
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request id in and out of both services.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID tags each request with the id from the X-Request-ID header, or
+// a new one when absent, and echoes it on the response.
+func RequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(RequestIDHeader)
+        if id == "" {
+            id = uuid.New().String()
+        }
+        
+        w.Header().Set(RequestIDHeader, id)
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+    })
+}
+
+// RequestIDFromContext returns the id assigned by RequestID, if any.
+func RequestIDFromContext(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
@@ -0,0 +1,17 @@
+package httpmw
+
+import (
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/tracing"
+)
+
+// TraceContext adopts the caller's W3C traceparent header as the remote
+// parent of the request context, so work started by the request, including
+// events it writes to the outbox, joins the caller's trace.
+func TraceContext(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ctx := tracing.ContextWithTraceparent(r.Context(), r.Header.Get(tracing.TraceparentHeader))
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
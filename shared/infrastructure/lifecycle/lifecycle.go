@@ -0,0 +1,38 @@
+// Package lifecycle supervises a service's background components and shuts
+// the service down in order: stop taking work, stop the components and
+// wait for them, then close the connections they used. Closing the database
+// while a component is mid-query only produces spurious errors.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Step is one stage of a shutdown.
+type Step struct {
+    Name string
+    Run  func(ctx context.Context) error
+}
+
+// Close returns a step running close, for connections and other resources
+// closed without a context.
+func Close(name string, close func() error) Step {
+    return Step{Name: name, Run: func(context.Context) error { return close() }}
+}
+
+// Shutdown runs steps in order. A step that fails is logged and the next
+// ones still run, so a worker that does not stop in time does not keep
+// the connections open; the failures are returned joined.
+func Shutdown(ctx context.Context, steps ...Step) error {
+    var errs []error
+    for _, step := range steps {
+        if err := step.Run(ctx); err != nil {
+            log.Printf("Shutdown step %s failed: %v", step.Name, err)
+            errs = append(errs, fmt.Errorf("%s: %w", step.Name, err))
+        }
+    }
+    return errors.Join(errs...)
+}
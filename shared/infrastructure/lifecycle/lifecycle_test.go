@@ -0,0 +1,76 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Shutdown runs every step in order, even after one fails, and reports the
+// failures by step.
+func TestShutdown(t *testing.T) {
+    errStuck := errors.New("worker did not stop")
+    tests := []struct {
+        name    string
+        failing string
+        wantErr string
+    }{
+        {name: "clean"},
+        {name: "stuck worker", failing: "workers", wantErr: "workers: worker did not stop"},
+        {name: "redis failing to close", failing: "redis", wantErr: "redis: worker did not stop"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var calls []string
+            step := func(name string) Step {
+                return Step{Name: name, Run: func(context.Context) error {
+                    calls = append(calls, name)
+                    if name == tt.failing {
+                        return errStuck
+                    }
+                    return nil
+                }}
+            }
+            closing := func(name string) Step {
+                return Close(name, func() error {
+                    calls = append(calls, name)
+                    if name == tt.failing {
+                        return errStuck
+                    }
+                    return nil
+                })
+            }
+            
+            err := Shutdown(context.Background(), step("server"), step("workers"), closing("event bus"), closing("redis"), closing("database"))
+            if want := []string{"server", "workers", "event bus", "redis", "database"}; !reflect.DeepEqual(calls, want) {
+                t.Errorf("shutdown order = %v, want %v", calls, want)
+            }
+            if tt.wantErr == "" {
+                if err != nil {
+                    t.Errorf("Shutdown() = %v, want nil", err)
+                }
+                return
+            }
+            if !errors.Is(err, errStuck) || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Errorf("Shutdown() = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+// Steps get the shutdown's context, so a worker that does not stop in time
+// gives up when it is done.
+func TestShutdown_context(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    err := Shutdown(ctx, Step{Name: "workers", Run: func(ctx context.Context) error {
+        <-ctx.Done()
+        return ctx.Err()
+    }})
+    if !errors.Is(err, context.Canceled) {
+        t.Errorf("Shutdown() = %v, want context.Canceled", err)
+    }
+}
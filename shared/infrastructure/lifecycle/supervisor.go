@@ -0,0 +1,384 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+)
+
+// componentStats is published as the "lifecycle_components" expvar: the
+// status of every supervised component, by name.
+var componentStats = expvar.NewMap("lifecycle_components")
+
+// Component states
+const (
+    StateRunning    = "running"
+    // StateRestarting is a component waiting out its backoff after a
+    // failure
+    StateRestarting = "restarting"
+    // StateStopped is a component that returned without an error, or was
+    // stopped with the supervisor
+    StateStopped    = "stopped"
+    // StateFailed is a fatal component that returned an error
+    StateFailed     = "failed"
+)
+
+// Backoff is how long a Supervisor waits before restarting a failed
+// component: Initial after the first failure, doubling with every failure
+// in a row up to Max. A run lasting longer than Max counts as recovered.
+type Backoff struct {
+    Initial time.Duration
+    Max     time.Duration
+}
+
+// DefaultBackoff restarts after 1s, 2s, 4s... up to a minute.
+var DefaultBackoff = Backoff{Initial: time.Second, Max: time.Minute}
+
+func (b Backoff) withDefaults() Backoff {
+    if b.Initial <= 0 {
+        b.Initial = DefaultBackoff.Initial
+    }
+    if b.Max < b.Initial {
+        b.Max = b.Initial
+    }
+    return b
+}
+
+func (b Backoff) delay(failures int) time.Duration {
+    delay := b.Initial
+    for i := 1; i < failures && delay < b.Max; i++ {
+        delay *= 2
+    }
+    if delay > b.Max {
+        return b.Max
+    }
+    return delay
+}
+
+// ComponentStatus is a supervised component as /health/ready and the
+// "lifecycle_components" expvar report it.
+type ComponentStatus struct {
+    Name      string            `json:"name"`
+    State     string            `json:"state"`
+    // Fatal is set for components whose failure stops the service
+    Fatal     bool              `json:"fatal"`
+    Restarts  int               `json:"restarts"`
+    LastError string            `json:"last_error,omitempty"`
+    Since     apijson.Timestamp `json:"since"`
+}
+
+// Readiness is the /health/ready response.
+type Readiness struct {
+    Ready      bool                   `json:"ready"`
+    Components []ComponentStatus      `json:"components"`
+    // Details are what the service added with Supervisor.Detail, by name
+    Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+type component struct {
+    name     string
+    fatal    bool
+    state    string
+    restarts int
+    lastErr  error
+    since    time.Time
+}
+
+// Supervisor runs a service's background components under a context of
+// their own, so they can be stopped together and waited for. A component
+// started with Go is restarted with a backoff when it returns an error; one
+// started with GoFatal fails the supervisor instead, which Failed reports
+// so the service shuts down and is restarted. A panic counts as an error.
+type Supervisor struct {
+    ctx     context.Context
+    cancel  context.CancelFunc
+    wg      sync.WaitGroup
+    backoff Backoff
+    
+    mu         sync.Mutex
+    components []*component
+    details    map[string]func() interface{}
+    failed     chan error
+    failure    error
+}
+
+func NewSupervisor(backoff Backoff) *Supervisor {
+    ctx, cancel := context.WithCancel(context.Background())
+    return &Supervisor{
+        ctx:     ctx,
+        cancel:  cancel,
+        backoff: backoff.withDefaults(),
+        failed:  make(chan error, 1),
+    }
+}
+
+// Context is done once Stop is called, for work started outside Go that
+// should stop with the components.
+func (s *Supervisor) Context() context.Context {
+    return s.ctx
+}
+
+// Go runs run in a goroutine with the supervisor's context, and again
+// after a backoff whenever it returns an error before Stop. Returning nil
+// ends it for good.
+func (s *Supervisor) Go(name string, run func(ctx context.Context) error) {
+    s.start(s.register(name, false), run)
+}
+
+// GoFatal runs run in a goroutine with the supervisor's context. An error
+// it returns before Stop fails the supervisor.
+func (s *Supervisor) GoFatal(name string, run func(ctx context.Context) error) {
+    s.start(s.register(name, true), run)
+}
+
+// Fail fails the supervisor with err, for failures reported outside a
+// component's run, such as by an event bus's error handler. The component
+// named, if any, is marked failed.
+func (s *Supervisor) Fail(name string, err error) {
+    s.mu.Lock()
+    for _, c := range s.components {
+        if c.name == name {
+            s.setStateLocked(c, StateFailed, err)
+        }
+    }
+    s.mu.Unlock()
+    s.fail(fmt.Errorf("%s: %w", name, err))
+}
+
+// Failed receives the first fatal failure. The service should shut down
+// and exit non-zero.
+func (s *Supervisor) Failed() <-chan error {
+    return s.failed
+}
+
+// Stop cancels the supervisor's context and waits for the components to
+// return, or until ctx is done.
+func (s *Supervisor) Stop(ctx context.Context) error {
+    s.cancel()
+    
+    done := make(chan struct{})
+    go func() {
+        s.wg.Wait()
+        close(done)
+    }()
+    
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return fmt.Errorf("components did not stop: %w", ctx.Err())
+    }
+}
+
+// Detail adds what report returns to the /health/ready response under
+// name, for measurements that describe the service's health without
+// deciding its readiness.
+func (s *Supervisor) Detail(name string, report func() interface{}) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    if s.details == nil {
+        s.details = make(map[string]func() interface{})
+    }
+    s.details[name] = report
+}
+
+// Status reports every component, in the order they were started.
+func (s *Supervisor) Status() []ComponentStatus {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    statuses := make([]ComponentStatus, len(s.components))
+    for i, c := range s.components {
+        statuses[i] = c.status()
+    }
+    return statuses
+}
+
+// Ready reports whether the service can take work: the supervisor is
+// neither stopping nor failed, and every fatal component is running.
+// Components restarting after a failure are reported but do not make the
+// service unready.
+func (s *Supervisor) Ready() bool {
+    if s.ctx.Err() != nil {
+        return false
+    }
+    
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    if s.failure != nil {
+        return false
+    }
+    for _, c := range s.components {
+        if c.fatal && c.state != StateRunning {
+            return false
+        }
+    }
+    return true
+}
+
+// ReadyHandler serves /health/ready: 200 with every component's status
+// when the service is ready, 503 otherwise.
+func (s *Supervisor) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+    readiness := Readiness{Ready: s.Ready(), Components: s.Status(), Details: s.reportDetails()}
+    status := http.StatusOK
+    if !readiness.Ready {
+        status = http.StatusServiceUnavailable
+    }
+    apijson.Write(w, r, status, readiness)
+}
+
+// Serve returns a component serving server until it is shut down. Shut it
+// down with server.Shutdown before stopping the supervisor, so the
+// requests in flight finish; a server that fails to listen fails the
+// component.
+func Serve(server *http.Server) func(ctx context.Context) error {
+    return func(context.Context) error {
+        if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            return err
+        }
+        return nil
+    }
+}
+
+func (s *Supervisor) reportDetails() map[string]interface{} {
+    s.mu.Lock()
+    reports := make(map[string]func() interface{}, len(s.details))
+    for name, report := range s.details {
+        reports[name] = report
+    }
+    s.mu.Unlock()
+    
+    if len(reports) == 0 {
+        return nil
+    }
+    // Outside the lock, as reports may take locks of their own
+    details := make(map[string]interface{}, len(reports))
+    for name, report := range reports {
+        details[name] = report()
+    }
+    return details
+}
+
+func (s *Supervisor) register(name string, fatal bool) *component {
+    c := &component{name: name, fatal: fatal, state: StateRunning, since: clock.Now()}
+    
+    s.mu.Lock()
+    s.components = append(s.components, c)
+    s.mu.Unlock()
+    
+    componentStats.Set(name, expvar.Func(func() interface{} {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        return c.status()
+    }))
+    return c
+}
+
+func (s *Supervisor) start(c *component, run func(ctx context.Context) error) {
+    s.wg.Add(1)
+    go func() {
+        defer s.wg.Done()
+        
+        failures := 0
+        for {
+            started := time.Now()
+            err := recovery.Guard(s.ctx, c.name, "supervised component", func() error {
+                return run(s.ctx)
+            })
+            
+            // The context's own error is how components stop with the
+            // supervisor
+            if s.ctx.Err() != nil && errors.Is(err, context.Canceled) {
+                err = nil
+            }
+            if err == nil || s.ctx.Err() != nil {
+                s.setState(c, StateStopped, err)
+                return
+            }
+            
+            log.Printf("%s stopped: %v", c.name, err)
+            if c.fatal {
+                s.setState(c, StateFailed, err)
+                s.fail(fmt.Errorf("%s: %w", c.name, err))
+                return
+            }
+            
+            if time.Since(started) > s.backoff.Max {
+                failures = 0
+            }
+            failures++
+            delay := s.backoff.delay(failures)
+            s.setState(c, StateRestarting, err)
+            log.Printf("Restarting %s in %s", c.name, delay)
+            
+            timer := time.NewTimer(delay)
+            select {
+            case <-s.ctx.Done():
+                timer.Stop()
+                s.setState(c, StateStopped, nil)
+                return
+            case <-timer.C:
+            }
+            
+            s.mu.Lock()
+            c.restarts++
+            s.setStateLocked(c, StateRunning, nil)
+            s.mu.Unlock()
+        }
+    }()
+}
+
+func (s *Supervisor) fail(err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    if s.failure != nil {
+        return
+    }
+    s.failure = err
+    s.failed <- err
+}
+
+func (s *Supervisor) setState(c *component, state string, err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    s.setStateLocked(c, state, err)
+}
+
+// setStateLocked moves c to state, keeping its last error unless err
+// replaces it.
+func (s *Supervisor) setStateLocked(c *component, state string, err error) {
+    if err != nil {
+        c.lastErr = err
+    }
+    if c.state != state {
+        c.state = state
+        c.since = clock.Now()
+    }
+}
+
+func (c *component) status() ComponentStatus {
+    status := ComponentStatus{
+        Name:     c.name,
+        State:    c.state,
+        Fatal:    c.fatal,
+        Restarts: c.restarts,
+        Since:    apijson.NewTimestamp(c.since),
+    }
+    if c.lastErr != nil {
+        status.LastError = c.lastErr.Error()
+    }
+    return status
+}
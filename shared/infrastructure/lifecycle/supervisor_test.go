@@ -0,0 +1,199 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff_delay(t *testing.T) {
+    backoff := Backoff{Initial: time.Second, Max: 5 * time.Second}
+    tests := []struct {
+        failures int
+        want     time.Duration
+    }{
+        {failures: 1, want: time.Second},
+        {failures: 2, want: 2 * time.Second},
+        {failures: 3, want: 4 * time.Second},
+        {failures: 4, want: 5 * time.Second},
+        {failures: 10, want: 5 * time.Second},
+    }
+    for _, tt := range tests {
+        if got := backoff.delay(tt.failures); got != tt.want {
+            t.Errorf("delay(%d) = %s, want %s", tt.failures, got, tt.want)
+        }
+    }
+    
+    if got := (Backoff{Max: time.Millisecond}).withDefaults(); got != (Backoff{Initial: time.Second, Max: time.Second}) {
+        t.Errorf("withDefaults() = %+v, want 1s initial and max", got)
+    }
+}
+
+// waitFor polls the supervisor until done reports true for the named
+// component's status, failing the test after a second.
+func waitFor(t *testing.T, s *Supervisor, name string, done func(ComponentStatus) bool) ComponentStatus {
+    t.Helper()
+    deadline := time.Now().Add(time.Second)
+    for {
+        for _, status := range s.Status() {
+            if status.Name == name && done(status) {
+                return status
+            }
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("%s never got there: %+v", name, s.Status())
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+// readiness serves /health/ready.
+func readiness(t *testing.T, s *Supervisor) (int, Readiness) {
+    t.Helper()
+    w := httptest.NewRecorder()
+    s.ReadyHandler(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+    var body Readiness
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decoding %q: %v", w.Body, err)
+    }
+    return w.Code, body
+}
+
+// A component that dies, by error or panic, is restarted after the backoff
+// and reported with its restarts and last error, without making the
+// service unready; stopping the supervisor stops it.
+func TestSupervisor_restart(t *testing.T) {
+    s := NewSupervisor(Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond})
+    var runs int32
+    s.Go("test.flaky", func(ctx context.Context) error {
+        switch atomic.AddInt32(&runs, 1) {
+        case 1:
+            return errors.New("connection reset")
+        case 2:
+            panic("nil map")
+        }
+        <-ctx.Done()
+        return ctx.Err()
+    })
+    s.Detail("outbox_lag", func() interface{} { return 3 })
+    
+    status := waitFor(t, s, "test.flaky", func(status ComponentStatus) bool {
+        return status.Restarts == 2 && status.State == StateRunning
+    })
+    if !strings.Contains(status.LastError, "nil map") || status.Fatal {
+        t.Errorf("status = %+v, want the panic as last error", status)
+    }
+    
+    code, body := readiness(t, s)
+    if code != http.StatusOK || !body.Ready || len(body.Components) != 1 || body.Components[0].Restarts != 2 || body.Details["outbox_lag"] != 3.0 {
+        t.Errorf("/health/ready = %d %+v, want ready with the component and its details", code, body)
+    }
+    if stat := componentStats.Get("test.flaky"); stat == nil || !strings.Contains(stat.String(), `"restarts":2`) {
+        t.Errorf("lifecycle_components test.flaky = %v, want 2 restarts", stat)
+    }
+    
+    if err := s.Stop(context.Background()); err != nil {
+        t.Fatalf("Stop() = %v", err)
+    }
+    if status := s.Status()[0]; status.State != StateStopped || status.Restarts != 2 {
+        t.Errorf("status after Stop() = %+v, want stopped", status)
+    }
+    if code, _ := readiness(t, s); code != http.StatusServiceUnavailable {
+        t.Errorf("/health/ready while stopping = %d, want 503", code)
+    }
+    select {
+    case err := <-s.Failed():
+        t.Errorf("Failed() = %v, want no failure", err)
+    default:
+    }
+}
+
+// A fatal component that dies fails the supervisor once and makes the
+// service unready, while the others keep running.
+func TestSupervisor_fatal(t *testing.T) {
+    s := NewSupervisor(Backoff{Initial: time.Millisecond})
+    kill := make(chan struct{})
+    s.Go("test.worker", func(ctx context.Context) error {
+        <-ctx.Done()
+        return nil
+    })
+    s.GoFatal("test.consumer", func(ctx context.Context) error {
+        select {
+        case <-kill:
+            return errors.New("broker unreachable")
+        case <-ctx.Done():
+            return nil
+        }
+    })
+    defer s.Stop(context.Background())
+    
+    if code, _ := readiness(t, s); code != http.StatusOK {
+        t.Fatalf("/health/ready before the failure = %d, want 200", code)
+    }
+    close(kill)
+    
+    select {
+    case err := <-s.Failed():
+        if err == nil || err.Error() != "test.consumer: broker unreachable" {
+            t.Errorf("Failed() = %v, want the consumer's error", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("Failed() received nothing")
+    }
+    code, body := readiness(t, s)
+    if code != http.StatusServiceUnavailable || body.Ready {
+        t.Errorf("/health/ready after the failure = %d %+v, want 503", code, body)
+    }
+    consumer := waitFor(t, s, "test.consumer", func(status ComponentStatus) bool { return status.State == StateFailed })
+    if !consumer.Fatal || consumer.LastError != "broker unreachable" {
+        t.Errorf("consumer = %+v, want failed with its error", consumer)
+    }
+    if worker := s.Status()[0]; worker.State != StateRunning {
+        t.Errorf("worker = %+v, want it still running", worker)
+    }
+    
+    // Later failures are not delivered again
+    s.Fail("test.worker", errors.New("event bus error"))
+    select {
+    case err := <-s.Failed():
+        t.Errorf("Failed() = %v after the first failure, want nothing", err)
+    default:
+    }
+    if worker := s.Status()[0]; worker.State != StateFailed || worker.LastError != "event bus error" {
+        t.Errorf("worker after Fail() = %+v, want failed", worker)
+    }
+}
+
+// Components returning nil are done for good, and Stop gives up on those
+// that ignore the context.
+func TestSupervisor_stop(t *testing.T) {
+    s := NewSupervisor(Backoff{Initial: time.Millisecond})
+    var runs int32
+    s.Go("test.once", func(context.Context) error {
+        atomic.AddInt32(&runs, 1)
+        return nil
+    })
+    waitFor(t, s, "test.once", func(status ComponentStatus) bool { return status.State == StateStopped })
+    
+    release := make(chan struct{})
+    defer close(release)
+    s.Go("test.stuck", func(context.Context) error {
+        <-release
+        return nil
+    })
+    
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+    defer cancel()
+    if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("Stop() = %v, want the deadline exceeded", err)
+    }
+    if n := atomic.LoadInt32(&runs); n != 1 {
+        t.Errorf("component returning nil ran %d times, want once", n)
+    }
+}
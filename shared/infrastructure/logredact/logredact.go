@@ -0,0 +1,101 @@
+// Package logredact keeps personal data out of the logs. Event and request
+// payloads carry shipping addresses, emails and names, so they are only
+// logged when payload logging is switched on for debugging, and then with
+// those fields masked.
+package logredact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Mask replaces the value of every personal data field.
+const Mask = "[REDACTED]"
+
+// piiFields are the JSON members masked wherever they appear: the address
+// fields but the country, emails, names and phone numbers.
+var piiFields = map[string]bool{
+    "street":        true,
+    "city":          true,
+    "state":         true,
+    "zip":           true,
+    "zip_code":      true,
+    "postal_code":   true,
+    "email":         true,
+    "contact_email": true,
+    "name":          true,
+    "first_name":    true,
+    "last_name":     true,
+    "full_name":     true,
+    "phone":         true,
+}
+
+// IsPII reports whether the JSON member field holds personal data.
+func IsPII(field string) bool {
+    return piiFields[strings.ToLower(field)]
+}
+
+// payloads enables logging redacted payloads.
+var payloads atomic.Bool
+
+// SetPayloadLogging makes the event consumers, the outbox publisher, the
+// projections and the HTTP request log add the payloads they handle to
+// their log lines, redacted. It is off by default; payloads are never
+// logged without it.
+func SetPayloadLogging(on bool) {
+    payloads.Store(on)
+}
+
+// PayloadLogging reports whether payloads are logged.
+func PayloadLogging() bool {
+    return payloads.Load()
+}
+
+// JSON returns data, a JSON document, with every personal data field
+// masked. Anything that is not JSON is replaced by its length, since it
+// cannot be redacted.
+func JSON(data []byte) string {
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.UseNumber()
+    var value interface{}
+    if err := decoder.Decode(&value); err != nil {
+        return fmt.Sprintf("[%d bytes, not JSON]", len(data))
+    }
+    redacted, err := json.Marshal(redact(value))
+    if err != nil {
+        return fmt.Sprintf("[%d bytes, not JSON]", len(data))
+    }
+    return string(redacted)
+}
+
+// Value returns v as JSON with every personal data field masked.
+func Value(v interface{}) string {
+    data, err := json.Marshal(v)
+    if err != nil {
+        return fmt.Sprintf("[%T, not JSON]", v)
+    }
+    return JSON(data)
+}
+
+func redact(value interface{}) interface{} {
+    switch value := value.(type) {
+    case map[string]interface{}:
+        for field, member := range value {
+            if IsPII(field) {
+                if member != nil && member != "" {
+                    value[field] = Mask
+                }
+                continue
+            }
+            value[field] = redact(member)
+        }
+    case []interface{}:
+        for i, element := range value {
+            value[i] = redact(element)
+        }
+    }
+    return value
+}
@@ -0,0 +1,92 @@
+package logredact
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+func TestJSON(t *testing.T) {
+    tests := []struct {
+        name string
+        data string
+        want string
+    }{
+        {name: "top level", data: `{"email": "jane@example.com", "id": "o1"}`, want: `{"email":"[REDACTED]","id":"o1"}`},
+        {name: "nested", data: `{"address": {"street": "1 Main St", "country": "US"}}`, want: `{"address":{"country":"US","street":"[REDACTED]"}}`},
+        {name: "in arrays", data: `[{"Name": "Jane"}, {"name": "John"}]`, want: `[{"Name":"[REDACTED]"},{"name":"[REDACTED]"}]`},
+        {name: "empty values kept", data: `{"zip": "", "city": null}`, want: `{"city":null,"zip":""}`},
+        {name: "numbers kept exactly", data: `{"amount": 12345678901234567890}`, want: `{"amount":12345678901234567890}`},
+        {name: "not JSON", data: `street=1 Main St`, want: `[16 bytes, not JSON]`},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := JSON([]byte(tt.data)); got != tt.want {
+                t.Errorf("JSON(%s) = %s, want %s", tt.data, got, tt.want)
+            }
+        })
+    }
+}
+
+// An order's creation event logs its items and country, but none of its
+// shipping address.
+func TestValue_orderCreatedEvent(t *testing.T) {
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("742 Evergreen Terrace", "Springfield", "OR", "97475", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    if err := order.AddItem("product-1", 2, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem() = %v", err)
+    }
+    
+    logged := Value(events.NewOrderCreatedEvent(order))
+    for _, pii := range []string{"742 Evergreen Terrace", "Springfield", "97475"} {
+        if strings.Contains(logged, pii) {
+            t.Errorf("logged event %s contains %q", logged, pii)
+        }
+    }
+    for _, kept := range []string{"product-1", `"US"`, string(order.ID)} {
+        if !strings.Contains(logged, kept) {
+            t.Errorf("logged event %s does not contain %q", logged, kept)
+        }
+    }
+}
+
+// A guest order's creation event logs neither its contact email nor its
+// shipping address, whether logged as a value or as the payload the outbox
+// and the bus carry.
+func TestValue_guestOrderCreatedEvent(t *testing.T) {
+    order, err := entities.NewOrder("", valueobjects.Email("jane.doe@example.com"), valueobjects.NewAddress("742 Evergreen Terrace", "Springfield", "OR", "97475", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder() = %v", err)
+    }
+    if err := order.AddItem("product-1", 2, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem() = %v", err)
+    }
+    event := events.NewOrderCreatedEvent(order)
+    payload, err := json.Marshal(event)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(payload), "jane.doe@example.com") {
+        t.Fatalf("payload %s does not carry the contact email to redact", payload)
+    }
+    
+    for name, logged := range map[string]string{"Value": Value(event), "JSON": JSON(payload)} {
+        for _, pii := range []string{"jane.doe@example.com", "742 Evergreen Terrace", "Springfield", "97475"} {
+            if strings.Contains(logged, pii) {
+                t.Errorf("%s logged %s, containing %q", name, logged, pii)
+            }
+        }
+        for _, kept := range []string{`"contact_email":"` + Mask + `"`, "product-1", `"US"`, string(order.ID)} {
+            if !strings.Contains(logged, kept) {
+                t.Errorf("%s logged %s, not containing %q", name, logged, kept)
+            }
+        }
+    }
+}
@@ -0,0 +1,237 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+)
+
+// ErrEventNotFound is returned by Archiver.FindEvent when neither the
+// outbox nor its archive has the event.
+var ErrEventNotFound = errors.New("outbox event not found")
+
+// ArchiveConfig controls how processed events move out of the outbox.
+type ArchiveConfig struct {
+    // Disabled leaves every event in the outbox
+    Disabled bool
+    // After is how old a processed event must be to be archived
+    After time.Duration
+    // BatchSize is the number of events moved per transaction, which
+    // bounds how long each one holds its locks
+    BatchSize int
+    // Interval is the time between archiving runs
+    Interval time.Duration
+    // Clock tells the age of events and stamps archived ones; nil uses
+    // clock.Default
+    Clock clock.Clock
+}
+
+// DefaultArchiveConfig archives events processed more than a week ago, once
+// an hour, a thousand at a time.
+var DefaultArchiveConfig = ArchiveConfig{
+    After:     7 * 24 * time.Hour,
+    BatchSize: 1000,
+    Interval:  time.Hour,
+}
+
+// ArchiveConfigFromEnv reads OUTBOX_ARCHIVE_ENABLED, OUTBOX_ARCHIVE_AFTER,
+// OUTBOX_ARCHIVE_BATCH_SIZE and OUTBOX_ARCHIVE_INTERVAL, falling back to
+// DefaultArchiveConfig.
+func ArchiveConfigFromEnv() ArchiveConfig {
+    cfg := DefaultArchiveConfig
+    
+    if enabled, err := strconv.ParseBool(os.Getenv("OUTBOX_ARCHIVE_ENABLED")); err == nil {
+        cfg.Disabled = !enabled
+    }
+    if value, err := time.ParseDuration(os.Getenv("OUTBOX_ARCHIVE_AFTER")); err == nil && value > 0 {
+        cfg.After = value
+    }
+    if value, err := strconv.Atoi(os.Getenv("OUTBOX_ARCHIVE_BATCH_SIZE")); err == nil && value > 0 {
+        cfg.BatchSize = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("OUTBOX_ARCHIVE_INTERVAL")); err == nil && value > 0 {
+        cfg.Interval = value
+    }
+    
+    return cfg
+}
+
+// ArchiveTable names the archive of an outbox table.
+func ArchiveTable(table string) string {
+    return table + "_archive"
+}
+
+// archivedColumns are the outbox columns copied to the archive.
+const archivedColumns = "id, event_type, event_data, payload, content_encoding, created_at, processed, traceparent, failed_at, failure_reason, destination"
+
+// archiveStats is published as the "outbox_archive" expvar: per outbox
+// table the events archived, the batches that moved them, and failed runs.
+var archiveStats = expvar.NewMap("outbox_archive")
+
+// ArchivedEvent is an outbox event found by FindEvent, in the outbox or in
+// its archive.
+type ArchivedEvent struct {
+    Event
+    FailedAt      *time.Time `json:"failed_at,omitempty"`
+    FailureReason string     `json:"failure_reason,omitempty"`
+    // ArchivedAt is set when the event was found in the archive
+    ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+}
+
+// Archiver moves processed events older than ArchiveConfig.After from an
+// outbox table to its archive, which CreateTable creates alongside it.
+// Unprocessed and failed events are never moved. Instances sharing a
+// table may run archivers concurrently: each batch skips rows another is
+// moving.
+type Archiver struct {
+    db    *sql.DB
+    table string
+    cfg   ArchiveConfig
+}
+
+func NewArchiver(db *sql.DB, table string, cfg ArchiveConfig) *Archiver {
+    if cfg.After <= 0 {
+        cfg.After = DefaultArchiveConfig.After
+    }
+    if cfg.BatchSize <= 0 {
+        cfg.BatchSize = DefaultArchiveConfig.BatchSize
+    }
+    if cfg.Interval <= 0 {
+        cfg.Interval = DefaultArchiveConfig.Interval
+    }
+    cfg.Clock = clock.OrDefault(cfg.Clock)
+    return &Archiver{db: db, table: table, cfg: cfg}
+}
+
+// Run archives once at start and then every Interval until ctx is done. A
+// disabled archiver returns at once.
+func (a *Archiver) Run(ctx context.Context) error {
+    if a.cfg.Disabled {
+        return nil
+    }
+    
+    ticker := time.NewTicker(a.cfg.Interval)
+    defer ticker.Stop()
+    
+    for {
+        if moved, err := a.ArchiveOnce(ctx); err != nil {
+            log.Printf("Error archiving %s: %v", a.table, err)
+        } else if moved > 0 {
+            log.Printf("Archived %d events from %s", moved, a.table)
+        }
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// ArchiveOnce moves every event due for archiving, a batch per transaction,
+// and returns how many it moved. Events processed while it runs are left
+// for the next run.
+func (a *Archiver) ArchiveOnce(ctx context.Context) (int64, error) {
+    cutoff := a.cfg.Clock.Now().Add(-a.cfg.After)
+    
+    var total int64
+    for {
+        moved, err := a.archiveBatch(ctx, cutoff)
+        total += moved
+        if err != nil {
+            archiveStats.Add(a.table+".errors", 1)
+            return total, err
+        }
+        if moved < int64(a.cfg.BatchSize) {
+            return total, nil
+        }
+    }
+}
+
+// archiveBatch moves up to BatchSize events created before cutoff in one
+// statement, so a batch is archived entirely or not at all.
+func (a *Archiver) archiveBatch(ctx context.Context, cutoff time.Time) (int64, error) {
+    query := fmt.Sprintf(`
+        WITH moved AS (
+            DELETE FROM %[1]s
+            WHERE id IN (
+                SELECT id FROM %[1]s
+                WHERE processed = true AND failed_at IS NULL AND created_at < $1
+                ORDER BY created_at ASC
+                LIMIT $2
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING %[3]s
+        )
+        INSERT INTO %[2]s (%[3]s, archived_at)
+        SELECT %[3]s, $3 FROM moved
+    `, a.table, ArchiveTable(a.table), archivedColumns)
+    
+    result, err := a.db.ExecContext(ctx, query, cutoff, a.cfg.BatchSize, a.cfg.Clock.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to archive events: %w", err)
+    }
+    
+    moved, err := result.RowsAffected()
+    if err != nil {
+        return 0, fmt.Errorf("failed to get rows affected: %w", err)
+    }
+    if moved > 0 {
+        archiveStats.Add(a.table+".archived", moved)
+        archiveStats.Add(a.table+".batches", 1)
+    }
+    return moved, nil
+}
+
+// FindEvent looks an event up by id in the outbox and then in its archive.
+func (a *Archiver) FindEvent(ctx context.Context, eventID string) (*ArchivedEvent, error) {
+    query := fmt.Sprintf(`
+        SELECT id, event_type, COALESCE(payload, convert_to(event_data::text, 'UTF8')), created_at, processed,
+            COALESCE(traceparent, ''), COALESCE(content_encoding, ''), COALESCE(destination, ''), failed_at,
+            COALESCE(failure_reason, ''), archived_at
+        FROM (
+            SELECT %[3]s, NULL::timestamp AS archived_at FROM %[1]s WHERE id = $1
+            UNION ALL
+            SELECT %[3]s, archived_at FROM %[2]s WHERE id = $1
+        ) found
+        LIMIT 1
+    `, a.table, ArchiveTable(a.table), archivedColumns)
+    
+    var event ArchivedEvent
+    var failedAt, archivedAt sql.NullTime
+    err := a.db.QueryRowContext(ctx, query, eventID).Scan(
+        &event.ID,
+        &event.EventType,
+        &event.EventData,
+        &event.CreatedAt,
+        &event.Processed,
+        &event.Traceparent,
+        &event.ContentEncoding,
+        &event.Destination,
+        &failedAt,
+        &event.FailureReason,
+        &archivedAt,
+    )
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, fmt.Errorf("%w: %s", ErrEventNotFound, eventID)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to find outbox event: %w", err)
+    }
+    
+    if failedAt.Valid {
+        event.FailedAt = &failedAt.Time
+    }
+    if archivedAt.Valid {
+        event.ArchivedAt = &archivedAt.Time
+    }
+    return &event, nil
+}
@@ -0,0 +1,218 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// outboxRow is an event inserted straight into an outbox table.
+type outboxRow struct {
+    id        string
+    createdAt time.Time
+    processed bool
+    failed    bool
+}
+
+func insertOutboxRows(t *testing.T, db *sql.DB, table string, rows []outboxRow) {
+    t.Helper()
+    for _, row := range rows {
+        var failedAt *time.Time
+        if row.failed {
+            failedAt = &row.createdAt
+        }
+        _, err := db.Exec(
+            fmt.Sprintf(`INSERT INTO %s (id, event_type, event_data, created_at, processed, failed_at) VALUES ($1, 'OrderCreated', '{}', $2, $3, $4)`, table),
+            row.id, row.createdAt, row.processed, failedAt,
+        )
+        if err != nil {
+            t.Fatalf("inserting %s: %v", row.id, err)
+        }
+    }
+}
+
+func tableIDs(t *testing.T, db *sql.DB, table string) []string {
+    t.Helper()
+    rows, err := db.Query(fmt.Sprintf(`SELECT id FROM %s ORDER BY id`, table))
+    if err != nil {
+        t.Fatalf("reading %s: %v", table, err)
+    }
+    defer rows.Close()
+    ids := []string{}
+    for rows.Next() {
+        var id string
+        if err := rows.Scan(&id); err != nil {
+            t.Fatalf("reading %s: %v", table, err)
+        }
+        ids = append(ids, id)
+    }
+    return ids
+}
+
+func archiveStat(table, name string) int64 {
+    if v, ok := archiveStats.Get(table + "." + name).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
+
+// Processed events past the cutoff move in batches of at most BatchSize;
+// unprocessed, failed and recent events stay in the outbox.
+func TestArchiver_ArchiveOnce(t *testing.T) {
+    now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+    old := now.Add(-8 * 24 * time.Hour)
+    
+    tests := []struct {
+        name        string
+        due         int
+        batchSize   int
+        wantBatches int64
+    }{
+        {name: "partial last batch", due: 5, batchSize: 2, wantBatches: 3},
+        {name: "exact multiple of the batch size", due: 4, batchSize: 2, wantBatches: 2},
+        {name: "one batch", due: 2, batchSize: 10, wantBatches: 1},
+        {name: "nothing due", due: 0, batchSize: 2, wantBatches: 0},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db := schematest.Open(t)
+            ctx := context.Background()
+            if err := CreateTable(ctx, db, DefaultTable); err != nil {
+                t.Fatal(err)
+            }
+            
+            rows := []outboxRow{
+                {id: "in-flight", createdAt: old},
+                {id: "failed", createdAt: old, processed: true, failed: true},
+                {id: "recent", createdAt: now.Add(-time.Hour), processed: true},
+            }
+            var wantArchived []string
+            for i := 0; i < tt.due; i++ {
+                id := fmt.Sprintf("due-%d", i)
+                rows = append(rows, outboxRow{id: id, createdAt: old.Add(time.Duration(i) * time.Second), processed: true})
+                wantArchived = append(wantArchived, id)
+            }
+            insertOutboxRows(t, db, DefaultTable, rows)
+            
+            archiver := NewArchiver(db, DefaultTable, ArchiveConfig{
+                After:     7 * 24 * time.Hour,
+                BatchSize: tt.batchSize,
+                Clock:     clock.NewFake(now),
+            })
+            batches := archiveStat(DefaultTable, "batches")
+            moved, err := archiver.ArchiveOnce(ctx)
+            if err != nil {
+                t.Fatalf("ArchiveOnce() = %v", err)
+            }
+            if moved != int64(tt.due) {
+                t.Errorf("ArchiveOnce() moved %d, want %d", moved, tt.due)
+            }
+            if got := archiveStat(DefaultTable, "batches") - batches; got != tt.wantBatches {
+                t.Errorf("archived in %d batches, want %d", got, tt.wantBatches)
+            }
+            
+            if wantArchived == nil {
+                wantArchived = []string{}
+            }
+            if got := tableIDs(t, db, ArchiveTable(DefaultTable)); !reflect.DeepEqual(got, wantArchived) {
+                t.Errorf("archive = %v, want %v", got, wantArchived)
+            }
+            if got, want := tableIDs(t, db, DefaultTable), []string{"failed", "in-flight", "recent"}; !reflect.DeepEqual(got, want) {
+                t.Errorf("outbox = %v, want %v", got, want)
+            }
+        })
+    }
+}
+
+func TestArchiver_FindEvent(t *testing.T) {
+    db := schematest.Open(t)
+    ctx := context.Background()
+    if err := CreateTable(ctx, db, DefaultTable); err != nil {
+        t.Fatal(err)
+    }
+    now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+    insertOutboxRows(t, db, DefaultTable, []outboxRow{
+        {id: "archived", createdAt: now.Add(-30 * 24 * time.Hour), processed: true},
+        {id: "pending", createdAt: now},
+    })
+    archiver := NewArchiver(db, DefaultTable, ArchiveConfig{Clock: clock.NewFake(now)})
+    if _, err := archiver.ArchiveOnce(ctx); err != nil {
+        t.Fatalf("ArchiveOnce() = %v", err)
+    }
+    
+    tests := []struct {
+        id           string
+        wantArchived bool
+        wantErr      error
+    }{
+        {id: "archived", wantArchived: true},
+        {id: "pending"},
+        {id: "unknown", wantErr: ErrEventNotFound},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.id, func(t *testing.T) {
+            event, err := archiver.FindEvent(ctx, tt.id)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("FindEvent() = %v, want %v", err, tt.wantErr)
+            }
+            if err != nil {
+                return
+            }
+            if event.ID != tt.id || (event.ArchivedAt != nil) != tt.wantArchived {
+                t.Errorf("FindEvent() = %s archived at %v, want %s archived %v", event.ID, event.ArchivedAt, tt.id, tt.wantArchived)
+            }
+            if tt.wantArchived && !event.ArchivedAt.Equal(now) {
+                t.Errorf("ArchivedAt = %v, want %v", event.ArchivedAt, now)
+            }
+        })
+    }
+}
+
+func TestArchiveConfigFromEnv(t *testing.T) {
+    tests := []struct {
+        name string
+        env  map[string]string
+        want ArchiveConfig
+    }{
+        {name: "defaults", want: DefaultArchiveConfig},
+        {
+            name: "configured",
+            env:  map[string]string{"OUTBOX_ARCHIVE_ENABLED": "false", "OUTBOX_ARCHIVE_AFTER": "72h", "OUTBOX_ARCHIVE_BATCH_SIZE": "50", "OUTBOX_ARCHIVE_INTERVAL": "10m"},
+            want: ArchiveConfig{Disabled: true, After: 72 * time.Hour, BatchSize: 50, Interval: 10 * time.Minute},
+        },
+        {
+            name: "invalid values keep the defaults",
+            env:  map[string]string{"OUTBOX_ARCHIVE_AFTER": "-1h", "OUTBOX_ARCHIVE_BATCH_SIZE": "0", "OUTBOX_ARCHIVE_INTERVAL": "often"},
+            want: DefaultArchiveConfig,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, name := range []string{"OUTBOX_ARCHIVE_ENABLED", "OUTBOX_ARCHIVE_AFTER", "OUTBOX_ARCHIVE_BATCH_SIZE", "OUTBOX_ARCHIVE_INTERVAL"} {
+                t.Setenv(name, tt.env[name])
+            }
+            if got := ArchiveConfigFromEnv(); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("ArchiveConfigFromEnv() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+// A disabled archiver returns without touching the database.
+func TestArchiver_Run_disabled(t *testing.T) {
+    archiver := NewArchiver(nil, DefaultTable, ArchiveConfig{Disabled: true})
+    if err := archiver.Run(context.Background()); err != nil {
+        t.Errorf("Run() = %v, want nil", err)
+    }
+}
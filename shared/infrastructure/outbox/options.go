@@ -0,0 +1,127 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+    defaultPollInterval = 5 * time.Second
+    defaultBatchSize    = 100
+)
+
+// RetryPolicy controls how often publishing a single event is retried within
+// one batch before the event is left for the next poll.
+type RetryPolicy struct {
+    MaxAttempts    int
+    InitialBackoff time.Duration
+    MaxBackoff     time.Duration
+}
+
+// NoRetry publishes each event once per poll.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+    backoff := p.InitialBackoff << (attempt - 1)
+    if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+        return p.MaxBackoff
+    }
+    return backoff
+}
+
+// RedeliveryPolicy spaces out the polls that retry an event whose publish
+// failed. The delay after the nth failed attempt is InitialDelay doubled n-1
+// times, capped at MaxDelay.
+type RedeliveryPolicy struct {
+    InitialDelay time.Duration
+    MaxDelay     time.Duration
+}
+
+// DefaultRedeliveryPolicy retries after 5 seconds, backing off to 5 minutes.
+var DefaultRedeliveryPolicy = RedeliveryPolicy{InitialDelay: 5 * time.Second, MaxDelay: 5 * time.Minute}
+
+func (p RedeliveryPolicy) delay(attempts int) time.Duration {
+    delay := p.InitialDelay
+    for i := 1; i < attempts && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+        delay *= 2
+    }
+    if p.MaxDelay > 0 && delay > p.MaxDelay {
+        return p.MaxDelay
+    }
+    return delay
+}
+
+// Metrics receives publisher observations. Implementations must be safe for
+// concurrent use.
+type Metrics interface {
+    EventPublished(eventType string, latency time.Duration)
+    EventFailed(eventType string, err error)
+    BatchProcessed(size int, duration time.Duration)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) EventPublished(string, time.Duration) {}
+func (noopMetrics) EventFailed(string, error)            {}
+func (noopMetrics) BatchProcessed(int, time.Duration)    {}
+
+type Option func(*Publisher)
+
+func WithPollInterval(interval time.Duration) Option {
+    return func(p *Publisher) {
+        p.pollInterval = interval
+    }
+}
+
+func WithBatchSize(size int) Option {
+    return func(p *Publisher) {
+        p.batchSize = size
+    }
+}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+    return func(p *Publisher) {
+        p.retryPolicy = policy
+    }
+}
+
+// WithRedeliveryPolicy replaces DefaultRedeliveryPolicy.
+func WithRedeliveryPolicy(policy RedeliveryPolicy) Option {
+    return func(p *Publisher) {
+        p.redelivery = policy
+    }
+}
+
+func WithMetrics(metrics Metrics) Option {
+    return func(p *Publisher) {
+        p.metrics = metrics
+    }
+}
+
+// WithTracerProvider creates publish spans from provider instead of the
+// global OpenTelemetry provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+    return func(p *Publisher) {
+        p.tracer = provider.Tracer(tracerName)
+    }
+}
+
+// WithTopicResolver routes each event saved without a destination to the
+// topic returned by resolver instead of eventbus.DefaultTopic.
+func WithTopicResolver(resolver eventbus.TopicResolver) Option {
+    return func(p *Publisher) {
+        p.topicResolver = resolver
+    }
+}
+
+// WithClock schedules redeliveries by c instead of clock.Default. Give the
+// repository the same clock, with WithRepositoryClock, as it decides when
+// they fall due.
+func WithClock(c clock.Clock) Option {
+    return func(p *Publisher) {
+        p.clock = clock.OrDefault(c)
+    }
+}
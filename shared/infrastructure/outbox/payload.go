@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"expvar"
+	"os"
+	"strconv"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+// DefaultMaxPayloadBytes keeps stored events under Kafka's default 1MB
+// message limit, leaving room for headers.
+const DefaultMaxPayloadBytes = 900 * 1024
+
+// ErrPayloadTooLarge is matched by the error returned when an event would
+// exceed the configured payload limit, an *events.EventTooLargeError. Such
+// an event could never be published, so it is rejected before it reaches
+// the outbox. It is events.ErrEventTooLarge, which the event store's size
+// limit returns too.
+var ErrPayloadTooLarge = events.ErrEventTooLarge
+
+// PayloadLimits bounds the size of stored events.
+type PayloadLimits struct {
+    // MaxBytes is the largest payload accepted, after compression. Zero
+    // disables the check.
+    MaxBytes int
+    // CompressAbove gzips payloads larger than this many bytes. Zero
+    // disables compression.
+    CompressAbove int
+}
+
+// DefaultPayloadLimits rejects payloads over DefaultMaxPayloadBytes and
+// never compresses.
+var DefaultPayloadLimits = PayloadLimits{MaxBytes: DefaultMaxPayloadBytes}
+
+// PayloadLimitsFromEnv reads OUTBOX_MAX_EVENT_BYTES and
+// EVENT_COMPRESSION_THRESHOLD, falling back to DefaultPayloadLimits.
+func PayloadLimitsFromEnv() PayloadLimits {
+    limits := DefaultPayloadLimits
+    
+    if value, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_EVENT_BYTES")); err == nil && value >= 0 {
+        limits.MaxBytes = value
+    }
+    if value, err := strconv.Atoi(os.Getenv("EVENT_COMPRESSION_THRESHOLD")); err == nil && value >= 0 {
+        limits.CompressAbove = value
+    }
+    
+    return limits
+}
+
+// payloadStats is published as the "event_payloads" expvar: per event type
+// the number of events stored, their JSON size and their stored size in
+// bytes, plus the number rejected as too large.
+var payloadStats = expvar.NewMap("event_payloads")
+
+// encode prepares a serialized event for storage, compressing it when it is
+// over the threshold. It returns the payload and its content encoding.
+func (l PayloadLimits) encode(event events.DomainEvent, data []byte) ([]byte, string, error) {
+    payload, encoding := data, ""
+    if l.CompressAbove > 0 && len(data) > l.CompressAbove {
+        compressed, err := events.Compress(data)
+        if err != nil {
+            return nil, "", err
+        }
+        payload, encoding = compressed, events.ContentEncodingGzip
+    }
+    
+    if err := events.CheckSize(event, payload, l.MaxBytes, "OUTBOX_MAX_EVENT_BYTES"); err != nil {
+        payloadStats.Add(event.Type()+".rejected", 1)
+        return nil, "", err
+    }
+    
+    return payload, encoding, nil
+}
+
+func recordPayload(eventType string, size, storedSize int) {
+    payloadStats.Add(eventType+".count", 1)
+    payloadStats.Add(eventType+".bytes", int64(size))
+    payloadStats.Add(eventType+".stored_bytes", int64(storedSize))
+}
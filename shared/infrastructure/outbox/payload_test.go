@@ -0,0 +1,138 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// largeCreatedEvent is the creation of an order with items lines, whose
+// JSON grows with the number of items and compresses well.
+func largeCreatedEvent(t *testing.T, orderID string, items int) events.DomainEvent {
+    t.Helper()
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    order.ID = entities.OrderID(orderID)
+    for i := 0; i < items; i++ {
+        if err := order.AddItem(fmt.Sprintf("product-%03d", i), 1, valueobjects.NewMoney(1000, "USD")); err != nil {
+            t.Fatalf("AddItem: %v", err)
+        }
+    }
+    return events.NewOrderCreatedEvent(order)
+}
+
+func TestPayloadLimits_encode(t *testing.T) {
+    event := largeCreatedEvent(t, "order-1", 100)
+    data, err := json.Marshal(event)
+    if err != nil {
+        t.Fatal(err)
+    }
+    compressed, err := events.Compress(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    tests := []struct {
+        name         string
+        limits       PayloadLimits
+        wantEncoding string
+        wantErr      bool
+    }{
+        {name: "under the limit", limits: PayloadLimits{MaxBytes: len(data)}},
+        {name: "no limit", limits: PayloadLimits{}},
+        {name: "over the limit", limits: PayloadLimits{MaxBytes: len(data) - 1}, wantErr: true},
+        {name: "under the compression threshold", limits: PayloadLimits{MaxBytes: len(data), CompressAbove: len(data)}},
+        {name: "compressed", limits: PayloadLimits{CompressAbove: 256}, wantEncoding: events.ContentEncodingGzip},
+        {name: "compression brings it under the limit", limits: PayloadLimits{MaxBytes: len(compressed), CompressAbove: 256}, wantEncoding: events.ContentEncodingGzip},
+        {name: "over the limit even compressed", limits: PayloadLimits{MaxBytes: len(compressed) - 1, CompressAbove: 256}, wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            payload, encoding, err := tt.limits.encode(event, data)
+            if tt.wantErr {
+                var tooLarge *events.EventTooLargeError
+                if !errors.As(err, &tooLarge) || !errors.Is(err, ErrPayloadTooLarge) {
+                    t.Fatalf("encode() = %v, want an *events.EventTooLargeError", err)
+                }
+                // The error names the limit and where it is configured
+                for _, want := range []string{fmt.Sprintf("limit of %d bytes", tt.limits.MaxBytes), "OUTBOX_MAX_EVENT_BYTES", "OrderCreated", "order-1"} {
+                    if !strings.Contains(err.Error(), want) {
+                        t.Errorf("error %q does not mention %q", err, want)
+                    }
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("encode() = %v", err)
+            }
+            if encoding != tt.wantEncoding {
+                t.Errorf("encoding = %q, want %q", encoding, tt.wantEncoding)
+            }
+            
+            decoded, err := events.Decompress(payload)
+            if err != nil {
+                t.Fatalf("Decompress() = %v", err)
+            }
+            if string(decoded) != string(data) {
+                t.Error("payload does not decode to the event's JSON")
+            }
+        })
+    }
+}
+
+// A compressed event goes from the outbox through the publisher and the bus
+// to a consumer, which receives the event as it was saved.
+func TestPublisher_compressedEventRoundTrip(t *testing.T) {
+    db := schematest.Open(t)
+    ctx := context.Background()
+    if err := CreateTable(ctx, db, DefaultTable); err != nil {
+        t.Fatal(err)
+    }
+    
+    repo := NewRepository(db, DefaultTable, WithPayloadLimits(PayloadLimits{MaxBytes: DefaultMaxPayloadBytes, CompressAbove: 256}))
+    bus := eventbus.NewInMemoryEventBus(nil)
+    var received []events.DomainEvent
+    err := bus.Subscribe(ctx, []string{eventbus.DefaultTopic}, func(_ context.Context, event events.DomainEvent) error {
+        received = append(received, event)
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    saved := largeCreatedEvent(t, "order-1", 100)
+    if err := repo.SaveEvent(ctx, saved); err != nil {
+        t.Fatalf("SaveEvent() = %v", err)
+    }
+    stored, err := repo.GetUnprocessedEvents(ctx, 10)
+    if err != nil || len(stored) != 1 {
+        t.Fatalf("GetUnprocessedEvents() = %d events, %v, want 1", len(stored), err)
+    }
+    if stored[0].ContentEncoding != events.ContentEncodingGzip || !events.IsCompressed(stored[0].EventData) {
+        t.Fatalf("stored with encoding %q, want it compressed", stored[0].ContentEncoding)
+    }
+    
+    if _, err := NewPublisher(repo, bus, events.DefaultRegistry()).processBatch(ctx); err != nil {
+        t.Fatalf("processBatch() = %v", err)
+    }
+    if len(received) != 1 {
+        t.Fatalf("consumer received %d events, want 1", len(received))
+    }
+    want, _ := json.Marshal(saved)
+    got, _ := json.Marshal(received[0])
+    if string(got) != string(want) {
+        t.Errorf("consumer received\n%s\nwant\n%s", got, want)
+    }
+}
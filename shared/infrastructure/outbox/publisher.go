@@ -0,0 +1,245 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"os"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/logredact"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/recovery"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Publisher polls an outbox repository and publishes pending events to the
+// event bus, marking each one processed once the bus has accepted it.
+type Publisher struct {
+    repo          Repository
+    eventBus      eventbus.EventBus
+    registry      *events.Registry
+    pollInterval  time.Duration
+    batchSize     int
+    retryPolicy   RetryPolicy
+    redelivery    RedeliveryPolicy
+    metrics       Metrics
+    topicResolver eventbus.TopicResolver
+    tracer        trace.Tracer
+    clock         clock.Clock
+}
+
+const tracerName = "github.com/vdntruong/dddcqrs/shared/infrastructure/outbox"
+
+func NewPublisher(repo Repository, eventBus eventbus.EventBus, registry *events.Registry, opts ...Option) *Publisher {
+    p := &Publisher{
+        repo:          repo,
+        eventBus:      eventBus,
+        registry:      registry,
+        pollInterval:  defaultPollInterval,
+        batchSize:     defaultBatchSize,
+        retryPolicy:   NoRetry,
+        redelivery:    DefaultRedeliveryPolicy,
+        metrics:       noopMetrics{},
+        topicResolver: eventbus.DefaultTopicResolver,
+        tracer:        otel.Tracer(tracerName),
+        clock:         clock.Default,
+    }
+    
+    for _, opt := range opts {
+        opt(p)
+    }
+    
+    return p
+}
+
+func (p *Publisher) ProcessEvents(ctx context.Context) error {
+    ticker := time.NewTicker(p.pollInterval)
+    defer ticker.Stop()
+    
+    for {
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+            if _, err := p.processBatch(ctx); err != nil {
+                log.Printf("Error processing event batch: %v", err)
+            }
+        }
+    }
+}
+
+// DefaultDrainTimeout bounds Drain at shutdown when OUTBOX_DRAIN_TIMEOUT is
+// not set.
+const DefaultDrainTimeout = 10 * time.Second
+
+// DrainTimeoutFromEnv reads OUTBOX_DRAIN_TIMEOUT as a duration, falling back
+// to DefaultDrainTimeout. Zero skips the drain.
+func DrainTimeoutFromEnv() time.Duration {
+    if value, err := time.ParseDuration(os.Getenv("OUTBOX_DRAIN_TIMEOUT")); err == nil && value >= 0 {
+        return value
+    }
+    return DefaultDrainTimeout
+}
+
+// drainStats is published as the "outbox_drain" expvar: the events
+// published by drains and those still pending when a drain ended.
+var drainStats = expvar.NewMap("outbox_drain")
+
+// Drain publishes pending events batch after batch, without waiting for the
+// poll interval, until none are left, a batch makes no progress or ctx is
+// done. It returns how many events are still pending. Run it at shutdown,
+// once no more commands are accepted and ProcessEvents has returned, and
+// before closing the event bus, so the last commands' events are not left
+// for the next deploy.
+func (p *Publisher) Drain(ctx context.Context) (int, error) {
+    for ctx.Err() == nil {
+        done, err := p.processBatch(ctx)
+        if err != nil {
+            log.Printf("Error draining outbox: %v", err)
+            break
+        }
+        drainStats.Add("published", int64(done))
+        if done == 0 {
+            break
+        }
+    }
+    
+    // ctx may be over by now; the count gets a moment of its own
+    countCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+    defer cancel()
+    remaining, err := p.repo.CountUnprocessed(countCtx)
+    if err != nil {
+        return 0, err
+    }
+    drainStats.Add("left_behind", int64(remaining))
+    return remaining, nil
+}
+
+// processBatch publishes the next batch of pending events. It returns how
+// many of them left the queue, published or marked failed.
+func (p *Publisher) processBatch(ctx context.Context) (int, error) {
+    start := time.Now()
+    
+    // Get unprocessed events
+    outboxEvents, err := p.repo.GetUnprocessedEvents(ctx, p.batchSize)
+    if err != nil {
+        return 0, err
+    }
+    
+    if len(outboxEvents) == 0 {
+        return 0, nil
+    }
+    
+    log.Printf("Processing %d events from outbox", len(outboxEvents))
+    
+    done := 0
+    for _, outboxEvent := range outboxEvents {
+        err := recovery.Guard(ctx, "outbox-publisher", outboxEvent.EventType+" "+outboxEvent.ID, func() error {
+            return p.processEvent(ctx, outboxEvent)
+        })
+        if err != nil {
+            log.Printf("Error processing event %s: %v", outboxEvent.ID, err)
+            p.metrics.EventFailed(outboxEvent.EventType, err)
+            if errors.Is(err, events.ErrInvalidEvent) || errors.Is(err, recovery.ErrPanic) {
+                if err := p.repo.MarkAsFailed(ctx, outboxEvent.ID, err.Error()); err != nil {
+                    log.Printf("Error marking event %s as failed: %v", outboxEvent.ID, err)
+                } else {
+                    done++
+                }
+                continue
+            }
+            
+            // Defer the event so it does not take a slot in every batch
+            retryAt := p.clock.Now().Add(p.redelivery.delay(outboxEvent.Attempts + 1))
+            if err := p.repo.MarkAttemptFailed(ctx, outboxEvent.ID, err.Error(), retryAt); err != nil {
+                log.Printf("Error recording failed attempt for event %s: %v", outboxEvent.ID, err)
+            }
+            continue
+        }
+        
+        // Mark as processed
+        if err := p.repo.MarkAsProcessed(ctx, outboxEvent.ID); err != nil {
+            log.Printf("Error marking event %s as processed: %v", outboxEvent.ID, err)
+            continue
+        }
+        done++
+    }
+    
+    p.metrics.BatchProcessed(len(outboxEvents), time.Since(start))
+    return done, nil
+}
+
+func (p *Publisher) processEvent(ctx context.Context, outboxEvent Event) (err error) {
+    // The publish runs later than the command that wrote the event, so link
+    // to the command's span rather than parenting under this poll
+    opts := []trace.SpanStartOption{
+        trace.WithSpanKind(trace.SpanKindProducer),
+        trace.WithAttributes(
+            attribute.String("event.id", outboxEvent.ID),
+            attribute.String("event.type", outboxEvent.EventType),
+        ),
+    }
+    if link, ok := tracing.LinkTo(outboxEvent.Traceparent); ok {
+        opts = append(opts, trace.WithLinks(link))
+    }
+    
+    ctx, span := p.tracer.Start(ctx, "outbox publish "+outboxEvent.EventType, opts...)
+    defer func() {
+        if err != nil {
+            span.RecordError(err)
+            span.SetStatus(codes.Error, err.Error())
+        }
+        span.End()
+    }()
+    
+    // Parse the event
+    event, err := p.registry.Unmarshal(outboxEvent.EventType, outboxEvent.EventData)
+    if err != nil {
+        return err
+    }
+    
+    // Publish to the event bus; rows saved before destinations were
+    // recorded fall back to the resolver
+    topic := outboxEvent.Destination
+    if topic == "" {
+        topic = p.topicResolver(event)
+    }
+    span.SetAttributes(attribute.String("messaging.destination.name", topic))
+    if err := p.publishWithRetry(ctx, topic, event); err != nil {
+        return err
+    }
+    
+    p.metrics.EventPublished(event.Type(), time.Since(outboxEvent.CreatedAt))
+    log.Printf("Successfully published event %s for aggregate %s", event.Type(), event.AggregateID())
+    if logredact.PayloadLogging() {
+        log.Printf("Published event payload: %s", logredact.Value(event))
+    }
+    return nil
+}
+
+func (p *Publisher) publishWithRetry(ctx context.Context, topic string, event events.DomainEvent) error {
+    var err error
+    for attempt := 1; ; attempt++ {
+        if err = p.eventBus.PublishTo(ctx, topic, event); err == nil {
+            return nil
+        }
+        
+        if attempt >= p.retryPolicy.MaxAttempts {
+            return err
+        }
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(p.retryPolicy.backoff(attempt)):
+        }
+    }
+}
@@ -0,0 +1,422 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// memoryRepository is a Repository over a list of pending events, recording
+// what the publisher marks.
+type memoryRepository struct {
+    Repository
+    pending []Event
+    
+    limits    []int
+    processed []string
+    failed    []string
+    retryAt   map[string]time.Time
+}
+
+func (r *memoryRepository) GetUnprocessedEvents(_ context.Context, limit int) ([]Event, error) {
+    r.limits = append(r.limits, limit)
+    return r.pending[:min(limit, len(r.pending))], nil
+}
+
+func (r *memoryRepository) MarkAsProcessed(_ context.Context, eventID string) error {
+    r.processed = append(r.processed, eventID)
+    return nil
+}
+
+func (r *memoryRepository) MarkAsFailed(_ context.Context, eventID string, _ string) error {
+    r.failed = append(r.failed, eventID)
+    return nil
+}
+
+func (r *memoryRepository) MarkAttemptFailed(_ context.Context, eventID string, _ string, retryAt time.Time) error {
+    if r.retryAt == nil {
+        r.retryAt = make(map[string]time.Time)
+    }
+    r.retryAt[eventID] = retryAt
+    return nil
+}
+
+// topicBus records the topic of each publish. Publishes of the aggregate
+// failing fail until failures runs out, or always when it is negative.
+type topicBus struct {
+    eventbus.EventBus
+    failing  string
+    failures int
+    
+    mu       sync.Mutex
+    attempts int
+    topics   map[string]string
+}
+
+func (b *topicBus) PublishTo(_ context.Context, topic string, event events.DomainEvent) error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if event.AggregateID() == b.failing {
+        b.attempts++
+        if b.failures < 0 || b.attempts <= b.failures {
+            return errors.New("broker unavailable")
+        }
+    }
+    if b.topics == nil {
+        b.topics = make(map[string]string)
+    }
+    b.topics[event.AggregateID()] = topic
+    return nil
+}
+
+// recordingMetrics records the publisher's observations.
+type recordingMetrics struct {
+    mu        sync.Mutex
+    published []string
+    failed    []string
+    batches   []int
+}
+
+func (m *recordingMetrics) EventPublished(eventType string, _ time.Duration) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.published = append(m.published, eventType)
+}
+
+func (m *recordingMetrics) EventFailed(eventType string, _ error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.failed = append(m.failed, eventType)
+}
+
+func (m *recordingMetrics) BatchProcessed(size int, _ time.Duration) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.batches = append(m.batches, size)
+}
+
+// pendingEvent returns an outbox row holding an OrderCreated event of
+// orderID, with destination.
+func pendingEvent(t *testing.T, orderID, destination string) Event {
+    t.Helper()
+    data, err := json.Marshal(createdEvent(t, orderID))
+    if err != nil {
+        t.Fatalf("json.Marshal: %v", err)
+    }
+    return Event{ID: "event-" + orderID, EventType: "OrderCreated", EventData: data, Destination: destination}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+    policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+    tests := []struct {
+        attempt int
+        want    time.Duration
+    }{
+        {attempt: 1, want: 100 * time.Millisecond},
+        {attempt: 2, want: 200 * time.Millisecond},
+        {attempt: 4, want: 800 * time.Millisecond},
+        {attempt: 5, want: time.Second},
+    }
+    
+    for _, tt := range tests {
+        if got := policy.backoff(tt.attempt); got != tt.want {
+            t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+        }
+    }
+}
+
+func TestRedeliveryPolicy_delay(t *testing.T) {
+    tests := []struct {
+        name     string
+        policy   RedeliveryPolicy
+        attempts int
+        want     time.Duration
+    }{
+        {name: "first failure", policy: DefaultRedeliveryPolicy, attempts: 1, want: 5 * time.Second},
+        {name: "doubles", policy: DefaultRedeliveryPolicy, attempts: 3, want: 20 * time.Second},
+        {name: "capped", policy: DefaultRedeliveryPolicy, attempts: 20, want: 5 * time.Minute},
+        {name: "uncapped", policy: RedeliveryPolicy{InitialDelay: time.Second}, attempts: 11, want: 1024 * time.Second},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.policy.delay(tt.attempts); got != tt.want {
+                t.Errorf("delay(%d) = %v, want %v", tt.attempts, got, tt.want)
+            }
+        })
+    }
+}
+
+// Events saved without a destination go to the resolver's topic; the
+// others keep theirs.
+func TestPublisher_WithTopicResolver(t *testing.T) {
+    repo := &memoryRepository{pending: []Event{
+        pendingEvent(t, "order-1", ""),
+        pendingEvent(t, "order-2", "orders.priority"),
+    }}
+    bus := &topicBus{}
+    publisher := NewPublisher(repo, bus, events.DefaultRegistry(),
+        WithTopicResolver(func(events.DomainEvent) string { return "orders.lifecycle" }),
+    )
+    
+    if _, err := publisher.processBatch(context.Background()); err != nil {
+        t.Fatalf("processBatch: %v", err)
+    }
+    want := map[string]string{"order-1": "orders.lifecycle", "order-2": "orders.priority"}
+    if !reflect.DeepEqual(bus.topics, want) {
+        t.Errorf("topics = %v, want %v", bus.topics, want)
+    }
+}
+
+func TestPublisher_defaultTopic(t *testing.T) {
+    repo := &memoryRepository{pending: []Event{pendingEvent(t, "order-1", "")}}
+    bus := &topicBus{}
+    
+    if _, err := NewPublisher(repo, bus, events.DefaultRegistry()).processBatch(context.Background()); err != nil {
+        t.Fatalf("processBatch: %v", err)
+    }
+    if got := bus.topics["order-1"]; got != eventbus.DefaultTopic {
+        t.Errorf("topic = %q, want %q", got, eventbus.DefaultTopic)
+    }
+}
+
+func TestPublisher_WithBatchSize(t *testing.T) {
+    repo := &memoryRepository{pending: []Event{
+        pendingEvent(t, "order-1", ""),
+        pendingEvent(t, "order-2", ""),
+        pendingEvent(t, "order-3", ""),
+    }}
+    publisher := NewPublisher(repo, &topicBus{}, events.DefaultRegistry(), WithBatchSize(2))
+    
+    done, err := publisher.processBatch(context.Background())
+    if err != nil || done != 2 {
+        t.Fatalf("processBatch() = %d, %v, want 2", done, err)
+    }
+    if !reflect.DeepEqual(repo.limits, []int{2}) {
+        t.Errorf("asked for batches of %v, want [2]", repo.limits)
+    }
+    if want := []string{"event-order-1", "event-order-2"}; !reflect.DeepEqual(repo.processed, want) {
+        t.Errorf("processed %v, want %v", repo.processed, want)
+    }
+}
+
+// A publish failing fewer times than the retry policy allows succeeds in the
+// same batch; one failing more is deferred by the redelivery policy.
+func TestPublisher_WithRetryPolicy(t *testing.T) {
+    policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+    tests := []struct {
+        name          string
+        failures      int
+        wantProcessed bool
+        wantAttempts  int
+    }{
+        {name: "recovers within the batch", failures: 2, wantProcessed: true, wantAttempts: 3},
+        {name: "gives up after max attempts", failures: -1, wantAttempts: 3},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+            repo := &memoryRepository{pending: []Event{pendingEvent(t, "order-1", "")}}
+            bus := &topicBus{failing: "order-1", failures: tt.failures}
+            metrics := &recordingMetrics{}
+            publisher := NewPublisher(repo, bus, events.DefaultRegistry(),
+                WithRetryPolicy(policy),
+                WithRedeliveryPolicy(RedeliveryPolicy{InitialDelay: time.Minute}),
+                WithMetrics(metrics),
+                WithClock(clock.NewFake(now)),
+            )
+            
+            if _, err := publisher.processBatch(context.Background()); err != nil {
+                t.Fatalf("processBatch: %v", err)
+            }
+            if bus.attempts != tt.wantAttempts {
+                t.Errorf("attempts = %d, want %d", bus.attempts, tt.wantAttempts)
+            }
+            if processed := len(repo.processed) == 1; processed != tt.wantProcessed {
+                t.Errorf("processed = %v, want processed %t", repo.processed, tt.wantProcessed)
+            }
+            if tt.wantProcessed {
+                if !reflect.DeepEqual(metrics.published, []string{"OrderCreated"}) || len(metrics.failed) != 0 {
+                    t.Errorf("metrics = published %v, failed %v, want one published", metrics.published, metrics.failed)
+                }
+                return
+            }
+            if got, want := repo.retryAt["event-order-1"], now.Add(time.Minute); !got.Equal(want) {
+                t.Errorf("retry at %v, want %v", got, want)
+            }
+            if !reflect.DeepEqual(metrics.failed, []string{"OrderCreated"}) || len(metrics.published) != 0 {
+                t.Errorf("metrics = published %v, failed %v, want one failed", metrics.published, metrics.failed)
+            }
+            if !reflect.DeepEqual(metrics.batches, []int{1}) {
+                t.Errorf("batches = %v, want [1]", metrics.batches)
+            }
+        })
+    }
+}
+
+// Events that do not decode are marked failed rather than retried.
+func TestPublisher_invalidEventMarkedFailed(t *testing.T) {
+    repo := &memoryRepository{pending: []Event{{ID: "event-bad", EventType: "OrderCreated", EventData: []byte(`{"order_id": 5}`)}}}
+    
+    done, err := NewPublisher(repo, &topicBus{}, events.DefaultRegistry()).processBatch(context.Background())
+    if err != nil || done != 1 {
+        t.Fatalf("processBatch() = %d, %v, want 1", done, err)
+    }
+    if !reflect.DeepEqual(repo.failed, []string{"event-bad"}) || len(repo.retryAt) != 0 {
+        t.Errorf("failed %v, deferred %v, want event-bad failed", repo.failed, repo.retryAt)
+    }
+}
+
+// The publish span links to the span of the command that wrote the event.
+func TestPublisher_publishSpanLinksToCommand(t *testing.T) {
+    const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+    traced := pendingEvent(t, "order-1", "")
+    traced.Traceparent = traceparent
+    repo := &memoryRepository{pending: []Event{traced, pendingEvent(t, "order-2", "")}}
+    recorder := tracetest.NewSpanRecorder()
+    provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+    publisher := NewPublisher(repo, &topicBus{}, events.DefaultRegistry(), WithTracerProvider(provider))
+    
+    if _, err := publisher.processBatch(context.Background()); err != nil {
+        t.Fatalf("processBatch: %v", err)
+    }
+    spans := recorder.Ended()
+    if len(spans) != 2 {
+        t.Fatalf("ended %d spans, want 2", len(spans))
+    }
+    
+    links := spans[0].Links()
+    if len(links) != 1 {
+        t.Fatalf("publish span of the traced event has %d links, want 1", len(links))
+    }
+    if got := links[0].SpanContext; got.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || got.SpanID().String() != "00f067aa0ba902b7" {
+        t.Errorf("link = trace %s span %s, want the command's", got.TraceID(), got.SpanID())
+    }
+    if spans[0].SpanContext().TraceID() == links[0].SpanContext.TraceID() {
+        t.Error("publish span joined the command's trace, want a new trace linked to it")
+    }
+    if links := spans[1].Links(); len(links) != 0 {
+        t.Errorf("publish span of the untraced event has links %v", links)
+    }
+}
+
+// queueRepository removes events from the queue once published.
+type queueRepository struct {
+    memoryRepository
+}
+
+func (r *queueRepository) MarkAsProcessed(ctx context.Context, eventID string) error {
+    for i, event := range r.pending {
+        if event.ID == eventID {
+            r.pending = append(r.pending[:i:i], r.pending[i+1:]...)
+            break
+        }
+    }
+    return r.memoryRepository.MarkAsProcessed(ctx, eventID)
+}
+
+func (r *queueRepository) CountUnprocessed(context.Context) (int, error) {
+    return len(r.pending), nil
+}
+
+// closingBus records how many events were published when it was closed.
+type closingBus struct {
+    topicBus
+    publishedAtClose int
+    closed           bool
+}
+
+func (b *closingBus) Close() error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.publishedAtClose = len(b.topics)
+    b.closed = true
+    return nil
+}
+
+// Drain publishes batch after batch until the outbox is empty, so the bus
+// closed after it has every event, and counts what it left behind when the
+// bus keeps failing or the drain runs out of time.
+func TestPublisher_Drain(t *testing.T) {
+    leftBehind := func() int64 {
+        if value, ok := drainStats.Get("left_behind").(*expvar.Int); ok {
+            return value.Value()
+        }
+        return 0
+    }
+    cancelled, cancel := context.WithCancel(context.Background())
+    cancel()
+    
+    tests := []struct {
+        name          string
+        ctx           context.Context
+        failing       string
+        wantRemaining int
+        wantBatches   int
+    }{
+        {name: "to empty", ctx: context.Background(), wantRemaining: 0, wantBatches: 4},
+        {name: "bus failing", ctx: context.Background(), failing: "order-5", wantRemaining: 1, wantBatches: 3},
+        {name: "out of time", ctx: cancelled, wantRemaining: 5},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            repo := &queueRepository{}
+            for i := 1; i <= 5; i++ {
+                repo.pending = append(repo.pending, pendingEvent(t, fmt.Sprintf("order-%d", i), ""))
+            }
+            bus := &closingBus{topicBus: topicBus{failing: tt.failing, failures: -1}}
+            publisher := NewPublisher(repo, bus, events.DefaultRegistry(), WithBatchSize(2), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+            before := leftBehind()
+            
+            remaining, err := publisher.Drain(tt.ctx)
+            if err != nil || remaining != tt.wantRemaining {
+                t.Fatalf("Drain() = %d, %v, want %d", remaining, err, tt.wantRemaining)
+            }
+            if got := len(repo.limits); got != tt.wantBatches {
+                t.Errorf("read %d batches, want %d", got, tt.wantBatches)
+            }
+            if got := leftBehind() - before; got != int64(tt.wantRemaining) {
+                t.Errorf("left_behind grew by %d, want %d", got, tt.wantRemaining)
+            }
+            
+            bus.Close()
+            if want := 5 - tt.wantRemaining; bus.publishedAtClose != want {
+                t.Errorf("bus closed with %d events published, want %d", bus.publishedAtClose, want)
+            }
+        })
+    }
+}
+
+func TestDrainTimeoutFromEnv(t *testing.T) {
+    tests := []struct {
+        value string
+        want  time.Duration
+    }{
+        {value: "", want: DefaultDrainTimeout},
+        {value: "30s", want: 30 * time.Second},
+        {value: "0", want: 0},
+        {value: "-1s", want: DefaultDrainTimeout},
+        {value: "soon", want: DefaultDrainTimeout},
+    }
+    
+    for _, tt := range tests {
+        t.Setenv("OUTBOX_DRAIN_TIMEOUT", tt.value)
+        if got := DrainTimeoutFromEnv(); got != tt.want {
+            t.Errorf("DrainTimeoutFromEnv() with %q = %s, want %s", tt.value, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,423 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/tracing"
+)
+
+// DefaultTable is the outbox table used by the order management service.
+const DefaultTable = "outbox_events"
+
+type Repository interface {
+    SaveEvent(ctx context.Context, event events.DomainEvent) error
+    SaveEventWithTx(ctx context.Context, tx *sql.Tx, event events.DomainEvent) error
+    SaveEventWithOptions(ctx context.Context, event events.DomainEvent, opts SaveOptions) error
+    // CheckEvent returns an error wrapping ErrPayloadTooLarge if SaveEvent
+    // would reject event, so callers can fail before writing anything else.
+    CheckEvent(event events.DomainEvent) error
+    // GetUnprocessedEvents returns up to limit events to publish, oldest
+    // first. Events that failed before are only returned once their next
+    // attempt is due, and take at most half the batch while fresh events
+    // are waiting.
+    GetUnprocessedEvents(ctx context.Context, limit int) ([]Event, error)
+    // CountUnprocessed returns how many events are waiting to be published.
+    CountUnprocessed(ctx context.Context) (int, error)
+    MarkAsProcessed(ctx context.Context, eventID string) error
+    MarkAsFailed(ctx context.Context, eventID string, reason string) error
+    // MarkAttemptFailed records a failed publish of an event that may
+    // still succeed, deferring its next attempt to retryAt.
+    MarkAttemptFailed(ctx context.Context, eventID string, reason string, retryAt time.Time) error
+    ListEvents(ctx context.Context, since time.Time) ([]Event, error)
+    Requeue(ctx context.Context, eventID string) error
+}
+
+type Event struct {
+    ID        string    `json:"id"`
+    EventType string    `json:"event_type"`
+    EventData []byte    `json:"event_data"`
+    CreatedAt time.Time `json:"created_at"`
+    Processed bool      `json:"processed"`
+    // Traceparent is the W3C trace context of the command that wrote the
+    // event, empty when it was not traced.
+    Traceparent string `json:"traceparent,omitempty"`
+    // ContentEncoding is events.ContentEncodingGzip when EventData is
+    // compressed, empty otherwise.
+    ContentEncoding string `json:"content_encoding,omitempty"`
+    // Destination is the topic the event is published to. It is empty for
+    // events saved without a destination resolver, which the publisher
+    // routes with its own.
+    Destination string `json:"destination,omitempty"`
+    // Attempts counts the failed publishes recorded by MarkAttemptFailed;
+    // only GetUnprocessedEvents fills it in.
+    Attempts int `json:"attempts,omitempty"`
+}
+
+// SaveOptions adjust how SaveEventWithOptions writes an event.
+type SaveOptions struct {
+    // Tx writes the event in the caller's transaction when set
+    Tx *sql.Tx
+    // Destination overrides the topic picked by the repository's
+    // destination resolver, for events that need special routing such as
+    // a priority topic
+    Destination string
+}
+
+type execer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type repository struct {
+    db           *sql.DB
+    table        string
+    limits       PayloadLimits
+    destinations eventbus.TopicResolver
+    clock        clock.Clock
+}
+
+type RepositoryOption func(*repository)
+
+// WithPayloadLimits replaces DefaultPayloadLimits.
+func WithPayloadLimits(limits PayloadLimits) RepositoryOption {
+    return func(r *repository) {
+        r.limits = limits
+    }
+}
+
+// WithDestinations records the topic returned by resolver as each saved
+// event's destination. Without it events are saved without one and the
+// publisher picks their topic.
+func WithDestinations(resolver eventbus.TopicResolver) RepositoryOption {
+    return func(r *repository) {
+        r.destinations = resolver
+    }
+}
+
+// WithRepositoryClock stamps saved and failed events with c, and retries
+// fall due by it, instead of clock.Default.
+func WithRepositoryClock(c clock.Clock) RepositoryOption {
+    return func(r *repository) {
+        r.clock = clock.OrDefault(c)
+    }
+}
+
+// NewRepository returns an outbox repository backed by table. Services
+// sharing a database must use distinct tables so their publishers don't
+// pick up each other's events.
+func NewRepository(db *sql.DB, table string, opts ...RepositoryOption) Repository {
+    r := &repository{db: db, table: table, limits: DefaultPayloadLimits, clock: clock.Default}
+    
+    for _, opt := range opts {
+        opt(r)
+    }
+    
+    return r
+}
+
+func (r *repository) SaveEvent(ctx context.Context, event events.DomainEvent) error {
+    return r.saveEvent(ctx, r.db, event, "")
+}
+
+func (r *repository) SaveEventWithTx(ctx context.Context, tx *sql.Tx, event events.DomainEvent) error {
+    return r.saveEvent(ctx, tx, event, "")
+}
+
+func (r *repository) SaveEventWithOptions(ctx context.Context, event events.DomainEvent, opts SaveOptions) error {
+    if opts.Tx != nil {
+        return r.saveEvent(ctx, opts.Tx, event, opts.Destination)
+    }
+    return r.saveEvent(ctx, r.db, event, opts.Destination)
+}
+
+func (r *repository) CheckEvent(event events.DomainEvent) error {
+    eventData, err := json.Marshal(event)
+    if err != nil {
+        return fmt.Errorf("failed to marshal event: %w", err)
+    }
+    
+    _, _, err = r.limits.encode(event, eventData)
+    return err
+}
+
+// saveEvent writes event for publishing to destination, or to the topic the
+// repository's resolver picks when destination is empty.
+func (r *repository) saveEvent(ctx context.Context, exec execer, event events.DomainEvent, destination string) error {
+    eventData, err := json.Marshal(event)
+    if err != nil {
+        return fmt.Errorf("failed to marshal event: %w", err)
+    }
+    
+    payload, encoding, err := r.limits.encode(event, eventData)
+    if err != nil {
+        return err
+    }
+    
+    // Compressed payloads are not valid JSON and go in the payload column
+    var jsonData, compressed []byte
+    if encoding == "" {
+        jsonData = payload
+    } else {
+        compressed = payload
+    }
+    
+    if destination == "" && r.destinations != nil {
+        destination = r.destinations(event)
+    }
+    
+    query := fmt.Sprintf(`
+        INSERT INTO %s (id, event_type, event_data, payload, content_encoding, created_at, processed, traceparent, destination)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, NULLIF($9, ''))
+    `, r.table)
+    
+    // Reuse the event's own id so outbox rows, bus messages and consumer
+    // logs can be correlated.
+    id := event.EventID()
+    if id == "" {
+        id = uuid.New().String()
+    }
+    
+    _, err = exec.ExecContext(ctx, query,
+        id,
+        event.Type(),
+        jsonData,
+        compressed,
+        encoding,
+        r.clock.Now(),
+        false,
+        tracing.Traceparent(ctx),
+        destination,
+    )
+    
+    if err != nil {
+        return fmt.Errorf("failed to save event to outbox: %w", err)
+    }
+    
+    recordPayload(event.Type(), len(eventData), len(payload))
+    return nil
+}
+
+func (r *repository) GetUnprocessedEvents(ctx context.Context, limit int) ([]Event, error) {
+    // Fresh events and due retries are selected separately, each up to the
+    // whole batch, and shared out below
+    query := fmt.Sprintf(`
+        SELECT id, event_type, data, created_at, processed, traceparent, content_encoding, destination, attempts
+        FROM (
+            (SELECT id, event_type, COALESCE(payload, convert_to(event_data::text, 'UTF8')) AS data, created_at, processed,
+                COALESCE(traceparent, '') AS traceparent, COALESCE(content_encoding, '') AS content_encoding,
+                COALESCE(destination, '') AS destination, attempts
+            FROM %[1]s
+            WHERE processed = false AND failed_at IS NULL AND attempts = 0
+            ORDER BY created_at ASC
+            LIMIT $1)
+            UNION ALL
+            (SELECT id, event_type, COALESCE(payload, convert_to(event_data::text, 'UTF8')), created_at, processed,
+                COALESCE(traceparent, ''), COALESCE(content_encoding, ''), COALESCE(destination, ''), attempts
+            FROM %[1]s
+            WHERE processed = false AND failed_at IS NULL AND attempts > 0
+                AND (next_attempt_at IS NULL OR next_attempt_at <= $2)
+            ORDER BY created_at ASC
+            LIMIT $1)
+        ) pending
+        ORDER BY created_at ASC
+    `, r.table)
+    
+    rows, err := r.db.QueryContext(ctx, query, limit, r.clock.Now())
+    if err != nil {
+        return nil, fmt.Errorf("failed to query unprocessed events: %w", err)
+    }
+    defer rows.Close()
+    
+    var fresh, retries []Event
+    for rows.Next() {
+        var event Event
+        err := rows.Scan(
+            &event.ID,
+            &event.EventType,
+            &event.EventData,
+            &event.CreatedAt,
+            &event.Processed,
+            &event.Traceparent,
+            &event.ContentEncoding,
+            &event.Destination,
+            &event.Attempts,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+        }
+        if event.Attempts == 0 {
+            fresh = append(fresh, event)
+        } else {
+            retries = append(retries, event)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to query unprocessed events: %w", err)
+    }
+    
+    return shareBatch(fresh, retries, limit), nil
+}
+
+// shareBatch fills a batch of limit events from fresh and retries, both
+// oldest first. Retries get half the batch, and whatever fresh events leave
+// unused, so a backlog of failing events cannot hold back new ones.
+func shareBatch(fresh, retries []Event, limit int) []Event {
+    retryShare := (limit + 1) / 2
+    if unused := limit - len(fresh); unused > retryShare {
+        retryShare = unused
+    }
+    if len(retries) > retryShare {
+        retries = retries[:retryShare]
+    }
+    if len(fresh) > limit-len(retries) {
+        fresh = fresh[:limit-len(retries)]
+    }
+    
+    // Merge back into created_at order
+    batch := make([]Event, 0, len(fresh)+len(retries))
+    for len(fresh) > 0 || len(retries) > 0 {
+        if len(retries) == 0 || (len(fresh) > 0 && !retries[0].CreatedAt.Before(fresh[0].CreatedAt)) {
+            batch, fresh = append(batch, fresh[0]), fresh[1:]
+        } else {
+            batch, retries = append(batch, retries[0]), retries[1:]
+        }
+    }
+    return batch
+}
+
+func (r *repository) CountUnprocessed(ctx context.Context) (int, error) {
+    query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE processed = false AND failed_at IS NULL`, r.table)
+    
+    var count int
+    if err := r.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+        return 0, fmt.Errorf("failed to count unprocessed events: %w", err)
+    }
+    return count, nil
+}
+
+func (r *repository) MarkAsProcessed(ctx context.Context, eventID string) error {
+    query := fmt.Sprintf(`
+        UPDATE %s
+        SET processed = true
+        WHERE id = $1
+    `, r.table)
+    
+    result, err := r.db.ExecContext(ctx, query, eventID)
+    if err != nil {
+        return fmt.Errorf("failed to mark event as processed: %w", err)
+    }
+    
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("failed to get rows affected: %w", err)
+    }
+    
+    if rowsAffected == 0 {
+        return fmt.Errorf("event not found: %s", eventID)
+    }
+    
+    return nil
+}
+
+// MarkAsFailed parks an event that can never be published, recording why.
+// Failed events are no longer returned by GetUnprocessedEvents.
+func (r *repository) MarkAsFailed(ctx context.Context, eventID string, reason string) error {
+    query := fmt.Sprintf(`
+        UPDATE %s
+        SET failed_at = $2, failure_reason = $3
+        WHERE id = $1
+    `, r.table)
+    
+    if _, err := r.db.ExecContext(ctx, query, eventID, r.clock.Now(), reason); err != nil {
+        return fmt.Errorf("failed to mark event as failed: %w", err)
+    }
+    
+    return nil
+}
+
+func (r *repository) MarkAttemptFailed(ctx context.Context, eventID string, reason string, retryAt time.Time) error {
+    query := fmt.Sprintf(`
+        UPDATE %s
+        SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3
+        WHERE id = $1
+    `, r.table)
+    
+    if _, err := r.db.ExecContext(ctx, query, eventID, retryAt, reason); err != nil {
+        return fmt.Errorf("failed to record failed attempt: %w", err)
+    }
+    
+    return nil
+}
+
+// ListEvents returns every event written since the given time, processed or
+// not, in the order they were written.
+func (r *repository) ListEvents(ctx context.Context, since time.Time) ([]Event, error) {
+    query := fmt.Sprintf(`
+        SELECT id, event_type, COALESCE(payload, convert_to(event_data::text, 'UTF8')), created_at, processed,
+            COALESCE(traceparent, ''), COALESCE(content_encoding, ''), COALESCE(destination, '')
+        FROM %s
+        WHERE created_at >= $1
+        ORDER BY created_at ASC, id ASC
+    `, r.table)
+    
+    rows, err := r.db.QueryContext(ctx, query, since)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query outbox events: %w", err)
+    }
+    defer rows.Close()
+    
+    var outboxEvents []Event
+    for rows.Next() {
+        var event Event
+        err := rows.Scan(
+            &event.ID,
+            &event.EventType,
+            &event.EventData,
+            &event.CreatedAt,
+            &event.Processed,
+            &event.Traceparent,
+            &event.ContentEncoding,
+            &event.Destination,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+        }
+        outboxEvents = append(outboxEvents, event)
+    }
+    
+    return outboxEvents, rows.Err()
+}
+
+// Requeue clears the processed and failed markers and the failed attempts
+// of an event so the publisher sends it again at once.
+func (r *repository) Requeue(ctx context.Context, eventID string) error {
+    query := fmt.Sprintf(`
+        UPDATE %s
+        SET processed = false, failed_at = NULL, failure_reason = NULL,
+            attempts = 0, next_attempt_at = NULL, last_error = NULL
+        WHERE id = $1
+    `, r.table)
+    
+    result, err := r.db.ExecContext(ctx, query, eventID)
+    if err != nil {
+        return fmt.Errorf("failed to requeue event: %w", err)
+    }
+    
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("failed to get rows affected: %w", err)
+    }
+    
+    if rowsAffected == 0 {
+        return fmt.Errorf("event not found: %s", eventID)
+    }
+    
+    return nil
+}
@@ -0,0 +1,230 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/eventbus"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// outboxEvents returns n events named prefix-0 to prefix-n-1, created a
+// second apart from start.
+func outboxEvents(prefix string, n int, start time.Time) []Event {
+    batch := make([]Event, n)
+    for i := range batch {
+        batch[i] = Event{ID: fmt.Sprintf("%s-%d", prefix, i), CreatedAt: start.Add(time.Duration(i) * time.Second)}
+    }
+    return batch
+}
+
+func eventIDs(batch []Event) []string {
+    ids := make([]string, len(batch))
+    for i, event := range batch {
+        ids[i] = event.ID
+    }
+    return ids
+}
+
+func TestShareBatch(t *testing.T) {
+    older := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    newer := older.Add(time.Hour)
+    tests := []struct {
+        name        string
+        fresh       []Event
+        retries     []Event
+        limit       int
+        wantFresh   int
+        wantRetries int
+    }{
+        {name: "nothing due", limit: 100},
+        {name: "fresh only", fresh: outboxEvents("fresh", 30, newer), limit: 100, wantFresh: 30},
+        {name: "retries only", retries: outboxEvents("retry", 150, older), limit: 100, wantRetries: 100},
+        {name: "backlog of retries leaves room for fresh", fresh: outboxEvents("fresh", 10, newer), retries: outboxEvents("retry", 150, older), limit: 100, wantFresh: 10, wantRetries: 90},
+        {name: "both over the limit split it", fresh: outboxEvents("fresh", 150, newer), retries: outboxEvents("retry", 150, older), limit: 100, wantFresh: 50, wantRetries: 50},
+        {name: "odd limit favours retries", fresh: outboxEvents("fresh", 10, newer), retries: outboxEvents("retry", 10, older), limit: 5, wantFresh: 2, wantRetries: 3},
+        {name: "few retries leave the rest to fresh", fresh: outboxEvents("fresh", 150, newer), retries: outboxEvents("retry", 5, older), limit: 100, wantFresh: 95, wantRetries: 5},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := shareBatch(tt.fresh, tt.retries, tt.limit)
+            
+            want := append(eventIDs(tt.retries[:tt.wantRetries]), eventIDs(tt.fresh[:tt.wantFresh])...)
+            if ids := eventIDs(got); !reflect.DeepEqual(ids, want) {
+                t.Errorf("shareBatch() = %d events %v, want %d events %v", len(ids), ids, len(want), want)
+            }
+        })
+    }
+}
+
+func TestShareBatch_mergesByCreatedAt(t *testing.T) {
+    start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    fresh := []Event{{ID: "fresh-1", CreatedAt: start.Add(time.Second)}, {ID: "fresh-3", CreatedAt: start.Add(3 * time.Second)}}
+    retries := []Event{{ID: "retry-0", CreatedAt: start}, {ID: "retry-2", CreatedAt: start.Add(2 * time.Second)}}
+    
+    got := eventIDs(shareBatch(fresh, retries, 10))
+    if want := []string{"retry-0", "fresh-1", "retry-2", "fresh-3"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("shareBatch() = %v, want %v", got, want)
+    }
+}
+
+// failingBus fails every publish for the aggregate stuck and records the
+// aggregates of the others.
+type failingBus struct {
+    eventbus.EventBus
+    stuck string
+    
+    mu        sync.Mutex
+    published []string
+}
+
+func (b *failingBus) PublishTo(_ context.Context, _ string, event events.DomainEvent) error {
+    if event.AggregateID() == b.stuck {
+        return errors.New("broker rejected the event")
+    }
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.published = append(b.published, event.AggregateID())
+    return nil
+}
+
+func createdEvent(t *testing.T, orderID string) events.DomainEvent {
+    t.Helper()
+    order, err := entities.NewOrder("customer-1", "", valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"))
+    if err != nil {
+        t.Fatalf("NewOrder: %v", err)
+    }
+    order.ID = entities.OrderID(orderID)
+    if err := order.AddItem("product-1", 1, valueobjects.NewMoney(1000, "USD")); err != nil {
+        t.Fatalf("AddItem: %v", err)
+    }
+    return events.NewOrderCreatedEvent(order)
+}
+
+// A backlog of events that keep failing must not hold back events saved
+// after it: each batch keeps room for fresh events.
+func TestPublisher_processBatch_failingEventsDoNotStarveOthers(t *testing.T) {
+    db := schematest.Open(t)
+    ctx := context.Background()
+    if err := CreateTable(ctx, db, DefaultTable); err != nil {
+        t.Fatal(err)
+    }
+    
+    fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    repo := NewRepository(db, DefaultTable, WithRepositoryClock(fake))
+    bus := &failingBus{stuck: "order-stuck"}
+    publisher := NewPublisher(repo, bus, events.DefaultRegistry(),
+        WithBatchSize(100),
+        WithRetryPolicy(NoRetry),
+        WithRedeliveryPolicy(RedeliveryPolicy{InitialDelay: time.Second, MaxDelay: time.Second}),
+        WithClock(fake),
+    )
+    
+    const stuck, others = 150, 10
+    for i := 0; i < stuck; i++ {
+        fake.Advance(time.Millisecond)
+        if err := repo.SaveEvent(ctx, createdEvent(t, "order-stuck")); err != nil {
+            t.Fatalf("SaveEvent: %v", err)
+        }
+    }
+    // Two polls try every stuck event once, so all of them are retries
+    for i := 0; i < 2; i++ {
+        if _, err := publisher.processBatch(ctx); err != nil {
+            t.Fatalf("processBatch: %v", err)
+        }
+    }
+    if len(bus.published) != 0 {
+        t.Fatalf("published %v, want nothing yet", bus.published)
+    }
+    
+    fake.Advance(time.Minute)
+    for i := 0; i < others; i++ {
+        if err := repo.SaveEvent(ctx, createdEvent(t, fmt.Sprintf("order-%d", i))); err != nil {
+            t.Fatalf("SaveEvent: %v", err)
+        }
+    }
+    
+    // The stuck events are older and all due again, yet the next batch
+    // still publishes every new one
+    if _, err := publisher.processBatch(ctx); err != nil {
+        t.Fatalf("processBatch: %v", err)
+    }
+    if len(bus.published) != others {
+        t.Fatalf("published %d events %v, want the %d new ones", len(bus.published), bus.published, others)
+    }
+    if n, err := repo.CountUnprocessed(ctx); err != nil || n != stuck {
+        t.Errorf("CountUnprocessed() = %d, %v, want %d", n, err, stuck)
+    }
+}
+
+// Saved events record the resolver's topic unless given a destination;
+// events saved without a resolver, as before destinations were recorded,
+// go to the publisher's topic.
+func TestRepository_destinations(t *testing.T) {
+    db := schematest.Open(t)
+    ctx := context.Background()
+    if err := CreateTable(ctx, db, DefaultTable); err != nil {
+        t.Fatal(err)
+    }
+    
+    fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    repo := NewRepository(db, DefaultTable, WithRepositoryClock(fake),
+        WithDestinations(func(events.DomainEvent) string { return "orders.lifecycle" }))
+    legacy := NewRepository(db, DefaultTable, WithRepositoryClock(fake))
+    
+    saves := []struct {
+        orderID string
+        save    func(event events.DomainEvent) error
+    }{
+        {orderID: "order-resolved", save: func(event events.DomainEvent) error { return repo.SaveEvent(ctx, event) }},
+        {orderID: "order-priority", save: func(event events.DomainEvent) error {
+            return repo.SaveEventWithOptions(ctx, event, SaveOptions{Destination: "orders.priority"})
+        }},
+        {orderID: "order-legacy", save: func(event events.DomainEvent) error { return legacy.SaveEvent(ctx, event) }},
+    }
+    for _, s := range saves {
+        fake.Advance(time.Second)
+        if err := s.save(createdEvent(t, s.orderID)); err != nil {
+            t.Fatalf("saving %s: %v", s.orderID, err)
+        }
+    }
+    
+    pending, err := repo.GetUnprocessedEvents(ctx, 10)
+    if err != nil {
+        t.Fatalf("GetUnprocessedEvents() = %v", err)
+    }
+    var destinations []string
+    for _, event := range pending {
+        destinations = append(destinations, event.Destination)
+    }
+    if want := []string{"orders.lifecycle", "orders.priority", ""}; !reflect.DeepEqual(destinations, want) {
+        t.Errorf("destinations = %q, want %q", destinations, want)
+    }
+    
+    bus := &topicBus{}
+    publisher := NewPublisher(repo, bus, events.DefaultRegistry(),
+        WithTopicResolver(func(events.DomainEvent) string { return "orders.fallback" }),
+        WithClock(fake),
+    )
+    if _, err := publisher.processBatch(ctx); err != nil {
+        t.Fatalf("processBatch() = %v", err)
+    }
+    want := map[string]string{
+        "order-resolved": "orders.lifecycle",
+        "order-priority": "orders.priority",
+        "order-legacy":   "orders.fallback",
+    }
+    if !reflect.DeepEqual(bus.topics, want) {
+        t.Errorf("published topics = %v, want %v", bus.topics, want)
+    }
+}
@@ -0,0 +1,26 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+//go:embed schema.sql
+var schemaTemplate string
+
+// Schema returns the DDL for an outbox table named table.
+func Schema(table string) string {
+    return strings.ReplaceAll(schemaTemplate, "{{table}}", table)
+}
+
+// CreateTable creates the outbox table, its archive and their indexes if
+// they don't exist.
+func CreateTable(ctx context.Context, db *sql.DB, table string) error {
+    if _, err := db.ExecContext(ctx, Schema(table)); err != nil {
+        return fmt.Errorf("failed to create outbox table %s: %w", table, err)
+    }
+    return nil
+}
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS {{table}} (
+    id VARCHAR(255) PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    event_data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    processed BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS failed_at TIMESTAMP;
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS failure_reason TEXT;
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS traceparent TEXT;
+
+-- Compressed events are stored in payload, leaving event_data null
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS payload BYTEA;
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS content_encoding TEXT;
+ALTER TABLE {{table}} ALTER COLUMN event_data DROP NOT NULL;
+
+-- The topic the event is published to; null for events saved before it was
+-- recorded, which the publisher routes with its topic resolver
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS destination TEXT;
+
+-- Failed publish attempts; an event that failed is not retried before
+-- next_attempt_at, and is picked separately from fresh events so failing
+-- ones cannot fill every batch
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP;
+ALTER TABLE {{table}} ADD COLUMN IF NOT EXISTS last_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_{{table}}_processed ON {{table}}(processed);
+CREATE INDEX IF NOT EXISTS idx_{{table}}_pending ON {{table}}(attempts, created_at) WHERE processed = false AND failed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_{{table}}_created_at ON {{table}}(created_at);
+CREATE INDEX IF NOT EXISTS idx_{{table}}_archivable ON {{table}}(created_at) WHERE processed = true AND failed_at IS NULL;
+
+-- Processed events moved out of {{table}} by the outbox archiver
+CREATE TABLE IF NOT EXISTS {{table}}_archive (
+    id VARCHAR(255) PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    event_data JSONB,
+    payload BYTEA,
+    content_encoding TEXT,
+    created_at TIMESTAMP NOT NULL,
+    processed BOOLEAN NOT NULL,
+    traceparent TEXT,
+    failed_at TIMESTAMP,
+    failure_reason TEXT,
+    archived_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE {{table}}_archive ADD COLUMN IF NOT EXISTS destination TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_{{table}}_archive_created_at ON {{table}}_archive(created_at);
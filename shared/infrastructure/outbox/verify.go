@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+)
+
+// Delivery is one event seen by a consumer, either read back from the bus
+// or taken from a consumer-side log.
+type Delivery struct {
+    EventID     string `json:"event_id"`
+    AggregateID string `json:"aggregate_id"`
+    EventType   string `json:"event_type"`
+}
+
+// Report summarises how the deliveries compare with what the outbox recorded.
+type Report struct {
+    GeneratedAt  time.Time         `json:"generated_at"`
+    DryRun       bool              `json:"dry_run"`
+    StoredEvents int               `json:"stored_events"`
+    Deliveries   int               `json:"deliveries"`
+    Unidentified int               `json:"unidentified"`
+    Unexpected   []string          `json:"unexpected,omitempty"`
+    Aggregates   []AggregateReport `json:"aggregates"`
+    Republished  []string          `json:"republished,omitempty"`
+}
+
+// AggregateReport lists the problems found for one aggregate. Aggregates
+// without problems are left out of the report.
+type AggregateReport struct {
+    AggregateID        string              `json:"aggregate_id"`
+    Missing            []string            `json:"missing,omitempty"`
+    Duplicates         []Duplicate         `json:"duplicates,omitempty"`
+    OrderingViolations []OrderingViolation `json:"ordering_violations,omitempty"`
+}
+
+type Duplicate struct {
+    EventID    string `json:"event_id"`
+    EventType  string `json:"event_type"`
+    Deliveries int    `json:"deliveries"`
+}
+
+// OrderingViolation records an event delivered after one that was written
+// to the outbox later.
+type OrderingViolation struct {
+    EventID   string `json:"event_id"`
+    EventType string `json:"event_type"`
+    After     string `json:"after"`
+}
+
+// Missing returns the ids of every stored event that was never delivered.
+func (r Report) Missing() []string {
+    var missing []string
+    for _, aggregate := range r.Aggregates {
+        missing = append(missing, aggregate.Missing...)
+    }
+    return missing
+}
+
+// Verify compares stored events, in the order they were written, with the
+// deliveries in the order they were received. Stored events without an id
+// predate event ids and are only counted.
+func Verify(stored []events.DomainEvent, deliveries []Delivery) Report {
+    report := Report{
+        GeneratedAt:  time.Now(),
+        StoredEvents: len(stored),
+        Deliveries:   len(deliveries),
+        Aggregates:   []AggregateReport{},
+    }
+    
+    position := make(map[string]int)
+    byID := make(map[string]events.DomainEvent)
+    var aggregateOrder []string
+    seenAggregate := make(map[string]bool)
+    for i, event := range stored {
+        if event.EventID() == "" {
+            report.Unidentified++
+            continue
+        }
+        position[event.EventID()] = i
+        byID[event.EventID()] = event
+        if !seenAggregate[event.AggregateID()] {
+            seenAggregate[event.AggregateID()] = true
+            aggregateOrder = append(aggregateOrder, event.AggregateID())
+        }
+    }
+    
+    reports := make(map[string]*AggregateReport)
+    reportFor := func(aggregateID string) *AggregateReport {
+        if reports[aggregateID] == nil {
+            reports[aggregateID] = &AggregateReport{AggregateID: aggregateID}
+        }
+        return reports[aggregateID]
+    }
+    
+    counts := make(map[string]int)
+    latest := make(map[string]string)
+    for _, delivery := range deliveries {
+        event, ok := byID[delivery.EventID]
+        if !ok {
+            if counts[delivery.EventID] == 0 {
+                report.Unexpected = append(report.Unexpected, delivery.EventID)
+            }
+            counts[delivery.EventID]++
+            continue
+        }
+        
+        counts[delivery.EventID]++
+        if counts[delivery.EventID] > 1 {
+            continue
+        }
+        
+        aggregateID := event.AggregateID()
+        if last, ok := latest[aggregateID]; ok && position[delivery.EventID] < position[last] {
+            reportFor(aggregateID).OrderingViolations = append(reportFor(aggregateID).OrderingViolations, OrderingViolation{
+                EventID:   delivery.EventID,
+                EventType: event.Type(),
+                After:     last,
+            })
+            continue
+        }
+        latest[aggregateID] = delivery.EventID
+    }
+    
+    for _, event := range stored {
+        id := event.EventID()
+        if id == "" {
+            continue
+        }
+        switch {
+        case counts[id] == 0:
+            reportFor(event.AggregateID()).Missing = append(reportFor(event.AggregateID()).Missing, id)
+        case counts[id] > 1:
+            reportFor(event.AggregateID()).Duplicates = append(reportFor(event.AggregateID()).Duplicates, Duplicate{
+                EventID:    id,
+                EventType:  event.Type(),
+                Deliveries: counts[id],
+            })
+        }
+    }
+    
+    for _, aggregateID := range aggregateOrder {
+        if aggregate, ok := reports[aggregateID]; ok {
+            report.Aggregates = append(report.Aggregates, *aggregate)
+        }
+    }
+    
+    return report
+}
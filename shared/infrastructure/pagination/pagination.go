@@ -0,0 +1,107 @@
+package pagination
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type Pagination struct {
+    Limit  int `json:"limit"`
+    Offset int `json:"offset"`
+}
+
+// Error describes a rejected pagination parameter. Handlers return it to
+// clients as a structured 400 response via WriteError.
+type Error struct {
+    Parameter string `json:"parameter"`
+    Value     string `json:"value"`
+    Message   string `json:"message"`
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("invalid %s %q: %s", e.Parameter, e.Value, e.Message)
+}
+
+// ParsePagination reads limit and offset from the query string. Missing
+// parameters take their value from defaults; malformed, negative, or
+// out-of-range values are rejected with an *Error instead of being clamped.
+func ParsePagination(r *http.Request, defaults Pagination, maxLimit int) (Pagination, error) {
+    p := defaults
+    query := r.URL.Query()
+    
+    if limitStr := query.Get("limit"); limitStr != "" {
+        limit, err := strconv.Atoi(limitStr)
+        if err != nil {
+            return Pagination{}, &Error{Parameter: "limit", Value: limitStr, Message: "must be an integer"}
+        }
+        if limit <= 0 {
+            return Pagination{}, &Error{Parameter: "limit", Value: limitStr, Message: "must be greater than zero"}
+        }
+        if maxLimit > 0 && limit > maxLimit {
+            return Pagination{}, &Error{Parameter: "limit", Value: limitStr, Message: fmt.Sprintf("must not exceed %d", maxLimit)}
+        }
+        p.Limit = limit
+    }
+    
+    if offsetStr := query.Get("offset"); offsetStr != "" {
+        offset, err := strconv.Atoi(offsetStr)
+        if err != nil {
+            return Pagination{}, &Error{Parameter: "offset", Value: offsetStr, Message: "must be an integer"}
+        }
+        if offset < 0 {
+            return Pagination{}, &Error{Parameter: "offset", Value: offsetStr, Message: "must not be negative"}
+        }
+        p.Offset = offset
+    }
+    
+    return p, nil
+}
+
+// WriteError writes err as a 400 response. Pagination errors are encoded
+// as JSON so clients can tell which parameter was rejected.
+func WriteError(w http.ResponseWriter, err error) {
+    var pErr *Error
+    if !errors.As(err, &pErr) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusBadRequest)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error":     "invalid_pagination",
+        "parameter": pErr.Parameter,
+        "value":     pErr.Value,
+        "message":   pErr.Message,
+    })
+}
+
+// LimitOffsetClause returns a LIMIT/OFFSET clause with placeholders numbered
+// from argIndex, along with the matching arguments.
+func (p Pagination) LimitOffsetClause(argIndex int) (string, []interface{}) {
+    clause := fmt.Sprintf("LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+    return clause, []interface{}{p.Limit, p.Offset}
+}
+
+// KeysetClause returns a condition seeking past the last seen value of
+// column, and the ORDER BY/LIMIT clause that must follow it. When after is
+// nil the condition matches every row so the first page can share the query.
+// Offset is ignored; keyset pages are addressed by the last key only.
+func (p Pagination) KeysetClause(column string, after interface{}, descending bool, argIndex int) (string, string, []interface{}) {
+    direction, comparison := "ASC", ">"
+    if descending {
+        direction, comparison = "DESC", "<"
+    }
+    
+    if after == nil {
+        order := fmt.Sprintf("ORDER BY %s %s LIMIT $%d", column, direction, argIndex)
+        return "1=1", order, []interface{}{p.Limit}
+    }
+    
+    condition := fmt.Sprintf("%s %s $%d", column, comparison, argIndex)
+    order := fmt.Sprintf("ORDER BY %s %s LIMIT $%d", column, direction, argIndex+1)
+    return condition, order, []interface{}{after, p.Limit}
+}
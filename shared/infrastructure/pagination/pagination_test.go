@@ -0,0 +1,190 @@
+package pagination
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+    defaults := Pagination{Limit: 20, Offset: 0}
+    tests := []struct {
+        name      string
+        query     string
+        maxLimit  int
+        want      Pagination
+        wantParam string
+        wantMsg   string
+    }{
+        {name: "no parameters", query: "", maxLimit: 100, want: defaults},
+        {name: "empty parameters", query: "limit=&offset=", maxLimit: 100, want: defaults},
+        {name: "limit only", query: "limit=50", maxLimit: 100, want: Pagination{Limit: 50}},
+        {name: "offset only", query: "offset=40", maxLimit: 100, want: Pagination{Limit: 20, Offset: 40}},
+        {name: "both", query: "limit=10&offset=30", maxLimit: 100, want: Pagination{Limit: 10, Offset: 30}},
+        {name: "limit at the maximum", query: "limit=100", maxLimit: 100, want: Pagination{Limit: 100}},
+        {name: "limit of one", query: "limit=1", maxLimit: 100, want: Pagination{Limit: 1}},
+        {name: "offset of zero", query: "offset=0", maxLimit: 100, want: defaults},
+        {name: "no maximum", query: "limit=100000", maxLimit: 0, want: Pagination{Limit: 100000}},
+        {name: "leading plus", query: "limit=%2B5", maxLimit: 100, want: Pagination{Limit: 5}},
+        {name: "first value wins", query: "limit=5&limit=500", maxLimit: 100, want: Pagination{Limit: 5}},
+        {name: "unrelated parameters", query: "status=confirmed&sort=created_at", maxLimit: 100, want: defaults},
+        
+        {name: "limit not a number", query: "limit=ten", maxLimit: 100, wantParam: "limit", wantMsg: "must be an integer"},
+        {name: "limit fractional", query: "limit=1.5", maxLimit: 100, wantParam: "limit", wantMsg: "must be an integer"},
+        {name: "limit with spaces", query: "limit=%2010", maxLimit: 100, wantParam: "limit", wantMsg: "must be an integer"},
+        {name: "limit overflows int", query: "limit=99999999999999999999", maxLimit: 0, wantParam: "limit", wantMsg: "must be an integer"},
+        {name: "limit zero", query: "limit=0", maxLimit: 100, wantParam: "limit", wantMsg: "must be greater than zero"},
+        {name: "limit negative", query: "limit=-1", maxLimit: 100, wantParam: "limit", wantMsg: "must be greater than zero"},
+        {name: "limit over the maximum", query: "limit=101", maxLimit: 100, wantParam: "limit", wantMsg: "must not exceed 100"},
+        {name: "offset not a number", query: "offset=abc", maxLimit: 100, wantParam: "offset", wantMsg: "must be an integer"},
+        {name: "offset hex", query: "offset=0x10", maxLimit: 100, wantParam: "offset", wantMsg: "must be an integer"},
+        {name: "offset negative", query: "offset=-5", maxLimit: 100, wantParam: "offset", wantMsg: "must not be negative"},
+        {name: "limit checked before offset", query: "limit=0&offset=-1", maxLimit: 100, wantParam: "limit", wantMsg: "must be greater than zero"},
+        {name: "bad offset with good limit", query: "limit=10&offset=x", maxLimit: 100, wantParam: "offset", wantMsg: "must be an integer"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, "/orders?"+tt.query, nil)
+            
+            got, err := ParsePagination(r, defaults, tt.maxLimit)
+            
+            if tt.wantParam == "" {
+                if err != nil {
+                    t.Fatalf("ParsePagination() error = %v", err)
+                }
+                if got != tt.want {
+                    t.Errorf("ParsePagination() = %+v, want %+v", got, tt.want)
+                }
+                return
+            }
+            var pErr *Error
+            if !errors.As(err, &pErr) {
+                t.Fatalf("ParsePagination() error = %v, want *Error", err)
+            }
+            if pErr.Parameter != tt.wantParam || pErr.Message != tt.wantMsg {
+                t.Errorf("ParsePagination() error = %+v, want parameter %q message %q", pErr, tt.wantParam, tt.wantMsg)
+            }
+            if got != (Pagination{}) {
+                t.Errorf("ParsePagination() = %+v with an error, want the zero Pagination", got)
+            }
+        })
+    }
+}
+
+func TestWriteError(t *testing.T) {
+    tests := []struct {
+        name            string
+        err             error
+        wantContentType string
+        wantBody        map[string]interface{}
+    }{
+        {
+            name:            "pagination error",
+            err:             &Error{Parameter: "limit", Value: "0", Message: "must be greater than zero"},
+            wantContentType: "application/json",
+            wantBody: map[string]interface{}{
+                "error":     "invalid_pagination",
+                "parameter": "limit",
+                "value":     "0",
+                "message":   "must be greater than zero",
+            },
+        },
+        {
+            name:            "other error",
+            err:             errors.New("bad cursor"),
+            wantContentType: "text/plain; charset=utf-8",
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            
+            WriteError(w, tt.err)
+            
+            if w.Code != http.StatusBadRequest {
+                t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+            }
+            if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+                t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+            }
+            if tt.wantBody == nil {
+                if got := w.Body.String(); got != tt.err.Error()+"\n" {
+                    t.Errorf("body = %q, want %q", got, tt.err.Error()+"\n")
+                }
+                return
+            }
+            var body map[string]interface{}
+            if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+                t.Fatalf("body is not JSON: %v", err)
+            }
+            if !reflect.DeepEqual(body, tt.wantBody) {
+                t.Errorf("body = %v, want %v", body, tt.wantBody)
+            }
+        })
+    }
+}
+
+func TestPagination_LimitOffsetClause(t *testing.T) {
+    tests := []struct {
+        name       string
+        pagination Pagination
+        argIndex   int
+        wantClause string
+        wantArgs   []interface{}
+    }{
+        {name: "first placeholders", pagination: Pagination{Limit: 20}, argIndex: 1, wantClause: "LIMIT $1 OFFSET $2", wantArgs: []interface{}{20, 0}},
+        {name: "after filters", pagination: Pagination{Limit: 10, Offset: 30}, argIndex: 4, wantClause: "LIMIT $4 OFFSET $5", wantArgs: []interface{}{10, 30}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            clause, args := tt.pagination.LimitOffsetClause(tt.argIndex)
+            if clause != tt.wantClause {
+                t.Errorf("clause = %q, want %q", clause, tt.wantClause)
+            }
+            if !reflect.DeepEqual(args, tt.wantArgs) {
+                t.Errorf("args = %v, want %v", args, tt.wantArgs)
+            }
+        })
+    }
+}
+
+func TestPagination_KeysetClause(t *testing.T) {
+    tests := []struct {
+        name          string
+        after         interface{}
+        descending    bool
+        argIndex      int
+        wantCondition string
+        wantOrder     string
+        wantArgs      []interface{}
+    }{
+        {name: "first page ascending", argIndex: 1, wantCondition: "1=1", wantOrder: "ORDER BY id ASC LIMIT $1", wantArgs: []interface{}{25}},
+        {name: "first page descending", descending: true, argIndex: 3, wantCondition: "1=1", wantOrder: "ORDER BY id DESC LIMIT $3", wantArgs: []interface{}{25}},
+        {name: "next page ascending", after: "order-9", argIndex: 1, wantCondition: "id > $1", wantOrder: "ORDER BY id ASC LIMIT $2", wantArgs: []interface{}{"order-9", 25}},
+        {name: "next page descending", after: "order-9", descending: true, argIndex: 2, wantCondition: "id < $2", wantOrder: "ORDER BY id DESC LIMIT $3", wantArgs: []interface{}{"order-9", 25}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // Offset is ignored by keyset pages
+            p := Pagination{Limit: 25, Offset: 50}
+            
+            condition, order, args := p.KeysetClause("id", tt.after, tt.descending, tt.argIndex)
+            if condition != tt.wantCondition {
+                t.Errorf("condition = %q, want %q", condition, tt.wantCondition)
+            }
+            if order != tt.wantOrder {
+                t.Errorf("order = %q, want %q", order, tt.wantOrder)
+            }
+            if !reflect.DeepEqual(args, tt.wantArgs) {
+                t.Errorf("args = %v, want %v", args, tt.wantArgs)
+            }
+        })
+    }
+}
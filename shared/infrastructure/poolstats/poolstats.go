@@ -0,0 +1,127 @@
+// Package poolstats publishes the connection pool stats of a service's
+// database and Redis client as expvar gauges, refreshed periodically, and
+// warns when callers spend long waiting for a database connection.
+package poolstats
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dbStats and redisStats are published as the "db_pool" and "redis_pool"
+// expvars. Counters such as wait_count are totals since the pool opened.
+var (
+    dbStats    = expvar.NewMap("db_pool")
+    redisStats = expvar.NewMap("redis_pool")
+)
+
+// Default Reporter settings
+const (
+    DefaultInterval    = 15 * time.Second
+    DefaultWaitWarning = time.Second
+)
+
+// Config configures a Reporter.
+type Config struct {
+    // Interval is how often the stats are refreshed; defaults to
+    // DefaultInterval
+    Interval time.Duration
+    // WaitWarning is how long callers may wait for database connections in
+    // total within one interval before a warning is logged; defaults to
+    // DefaultWaitWarning
+    WaitWarning time.Duration
+}
+
+// ConfigFromEnv reads POOL_STATS_INTERVAL and POOL_WAIT_WARNING.
+func ConfigFromEnv() Config {
+    var cfg Config
+    if interval, err := time.ParseDuration(os.Getenv("POOL_STATS_INTERVAL")); err == nil && interval > 0 {
+        cfg.Interval = interval
+    }
+    if warning, err := time.ParseDuration(os.Getenv("POOL_WAIT_WARNING")); err == nil && warning > 0 {
+        cfg.WaitWarning = warning
+    }
+    return cfg
+}
+
+// Reporter refreshes the pool gauges until its context is done.
+type Reporter struct {
+    db    *sql.DB
+    redis *redis.Client
+    cfg   Config
+    
+    refreshed bool
+    lastWait  time.Duration
+}
+
+// NewReporter returns a reporter for db and, unless it is nil,
+// redisClient.
+func NewReporter(db *sql.DB, redisClient *redis.Client, cfg Config) *Reporter {
+    if cfg.Interval <= 0 {
+        cfg.Interval = DefaultInterval
+    }
+    if cfg.WaitWarning <= 0 {
+        cfg.WaitWarning = DefaultWaitWarning
+    }
+    return &Reporter{db: db, redis: redisClient, cfg: cfg}
+}
+
+// Run refreshes the gauges at start and then every interval until ctx is
+// done.
+func (r *Reporter) Run(ctx context.Context) error {
+    ticker := time.NewTicker(r.cfg.Interval)
+    defer ticker.Stop()
+    
+    for {
+        r.Refresh()
+        
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// Refresh publishes the current stats, logging a warning when the time
+// spent waiting for database connections grew by more than WaitWarning
+// since the previous refresh.
+func (r *Reporter) Refresh() {
+    stats := r.db.Stats()
+    dbStats.Set("max_open", intVar(int64(stats.MaxOpenConnections)))
+    dbStats.Set("open", intVar(int64(stats.OpenConnections)))
+    dbStats.Set("in_use", intVar(int64(stats.InUse)))
+    dbStats.Set("idle", intVar(int64(stats.Idle)))
+    dbStats.Set("wait_count", intVar(stats.WaitCount))
+    dbStats.Set("wait_duration_ms", intVar(stats.WaitDuration.Milliseconds()))
+    dbStats.Set("max_idle_closed", intVar(stats.MaxIdleClosed))
+    dbStats.Set("max_lifetime_closed", intVar(stats.MaxLifetimeClosed))
+    
+    if waited := stats.WaitDuration - r.lastWait; r.refreshed && waited > r.cfg.WaitWarning {
+        log.Printf("Database pool saturated: callers waited %s for connections in the last %s, %d of %d connections in use", waited, r.cfg.Interval, stats.InUse, stats.MaxOpenConnections)
+    }
+    r.refreshed, r.lastWait = true, stats.WaitDuration
+    
+    if r.redis == nil {
+        return
+    }
+    pool := r.redis.PoolStats()
+    redisStats.Set("hits", intVar(int64(pool.Hits)))
+    redisStats.Set("misses", intVar(int64(pool.Misses)))
+    redisStats.Set("timeouts", intVar(int64(pool.Timeouts)))
+    redisStats.Set("total_conns", intVar(int64(pool.TotalConns)))
+    redisStats.Set("idle_conns", intVar(int64(pool.IdleConns)))
+    redisStats.Set("stale_conns", intVar(int64(pool.StaleConns)))
+}
+
+func intVar(value int64) *expvar.Int {
+    v := new(expvar.Int)
+    v.Set(value)
+    return v
+}
@@ -0,0 +1,141 @@
+package poolstats
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"expvar"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// stubConnector opens connections that run nothing; the pool stats only
+// need them opened and closed.
+type stubConnector struct{}
+
+func (stubConnector) Connect(context.Context) (driver.Conn, error) { return stubConn{}, nil }
+func (stubConnector) Driver() driver.Driver                        { return stubDriver{} }
+
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (stubConn) Close() error                        { return nil }
+func (stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func gauge(t *testing.T, stats *expvar.Map, name string) int64 {
+    t.Helper()
+    v, ok := stats.Get(name).(*expvar.Int)
+    if !ok {
+        t.Fatalf("%s is not published", name)
+    }
+    return v.Value()
+}
+
+// captureLog sends the standard logger to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+    t.Helper()
+    var buf bytes.Buffer
+    writer := log.Writer()
+    log.SetOutput(&buf)
+    t.Cleanup(func() { log.SetOutput(writer) })
+    return &buf
+}
+
+// Refresh publishes the pools' gauges, and warns when callers waited longer
+// than WaitWarning for a database connection since the last refresh.
+func TestReporter_Refresh(t *testing.T) {
+    ctx := context.Background()
+    db := sql.OpenDB(stubConnector{})
+    defer db.Close()
+    db.SetMaxOpenConns(1)
+    client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+    defer client.Close()
+    if err := client.Ping(ctx).Err(); err != nil {
+        t.Fatalf("Ping() = %v", err)
+    }
+    logged := captureLog(t)
+    reporter := NewReporter(db, client, Config{WaitWarning: 5 * time.Millisecond})
+    
+    held, err := db.Conn(ctx)
+    if err != nil {
+        t.Fatalf("Conn() = %v", err)
+    }
+    reporter.Refresh()
+    for name, want := range map[string]int64{"max_open": 1, "open": 1, "in_use": 1, "idle": 0, "wait_count": 0} {
+        if got := gauge(t, dbStats, name); got != want {
+            t.Errorf("db_pool %s = %d, want %d", name, got, want)
+        }
+    }
+    if got := gauge(t, redisStats, "total_conns"); got < 1 {
+        t.Errorf("redis_pool total_conns = %d, want the connection of the ping", got)
+    }
+    
+    // Another caller waits for the held connection
+    waited := make(chan error, 1)
+    go func() {
+        conn, err := db.Conn(ctx)
+        if err == nil {
+            err = conn.Close()
+        }
+        waited <- err
+    }()
+    time.Sleep(20 * time.Millisecond)
+    held.Close()
+    if err := <-waited; err != nil {
+        t.Fatalf("waiting caller's Conn() = %v", err)
+    }
+    
+    reporter.Refresh()
+    if got := gauge(t, dbStats, "wait_count"); got != 1 {
+        t.Errorf("db_pool wait_count = %d, want 1", got)
+    }
+    if gauge(t, dbStats, "wait_duration_ms") < 20 || gauge(t, dbStats, "in_use") != 0 {
+        t.Errorf("db_pool = wait %dms, %d in use, want at least 20ms and none in use", gauge(t, dbStats, "wait_duration_ms"), gauge(t, dbStats, "in_use"))
+    }
+    if !strings.Contains(logged.String(), "Database pool saturated") {
+        t.Errorf("log = %q, want a saturation warning", logged)
+    }
+    
+    // The wait is only reported once
+    logged.Reset()
+    reporter.Refresh()
+    if logged.Len() != 0 {
+        t.Errorf("log after a refresh without waits = %q, want nothing", logged)
+    }
+    
+    // A new reporter takes the waits before its first refresh as its start
+    NewReporter(db, nil, Config{WaitWarning: 5 * time.Millisecond}).Refresh()
+    if logged.Len() != 0 {
+        t.Errorf("log after a first refresh = %q, want nothing", logged)
+    }
+}
+
+func TestConfigFromEnv(t *testing.T) {
+    tests := []struct {
+        interval, warning string
+        want              Config
+    }{
+        {want: Config{}},
+        {interval: "1m", warning: "250ms", want: Config{Interval: time.Minute, WaitWarning: 250 * time.Millisecond}},
+        {interval: "often", warning: "-1s", want: Config{}},
+    }
+    
+    for _, tt := range tests {
+        t.Setenv("POOL_STATS_INTERVAL", tt.interval)
+        t.Setenv("POOL_WAIT_WARNING", tt.warning)
+        if got := ConfigFromEnv(); got != tt.want {
+            t.Errorf("ConfigFromEnv() with %q, %q = %+v, want %+v", tt.interval, tt.warning, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,56 @@
+// Package ratelog logs warnings that may repeat for every message a
+// consumer handles at most once per interval for each key, so a flood of
+// the same problem stays visible without drowning the rest of the log.
+package ratelog
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Logger logs each key at most once per interval. The lines it skips are
+// counted and reported with the next line logged for the key.
+type Logger struct {
+    interval time.Duration
+    
+    mu   sync.Mutex
+    keys map[string]*entry
+}
+
+type entry struct {
+    logged     time.Time
+    suppressed int
+}
+
+func New(interval time.Duration) *Logger {
+    return &Logger{interval: interval, keys: make(map[string]*entry)}
+}
+
+// Printf logs as log.Printf does unless a line was logged for key within
+// the interval.
+func (l *Logger) Printf(key, format string, args ...interface{}) {
+    now := time.Now()
+    
+    l.mu.Lock()
+    e, ok := l.keys[key]
+    if !ok {
+        e = &entry{}
+        l.keys[key] = e
+    }
+    if ok && now.Sub(e.logged) < l.interval {
+        e.suppressed++
+        l.mu.Unlock()
+        return
+    }
+    suppressed := e.suppressed
+    e.logged, e.suppressed = now, 0
+    l.mu.Unlock()
+    
+    message := fmt.Sprintf(format, args...)
+    if suppressed > 0 {
+        message += fmt.Sprintf(" (%d more since last logged)", suppressed)
+    }
+    log.Print(message)
+}
@@ -0,0 +1,36 @@
+package ratelog
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Each key is logged once per interval; the next line logged for it says
+// how many were skipped.
+func TestLogger_Printf(t *testing.T) {
+    var logs bytes.Buffer
+    defer log.SetOutput(log.Writer())
+    log.SetOutput(&logs)
+    
+    l := New(50 * time.Millisecond)
+    for i := 0; i < 3; i++ {
+        l.Printf("OrderRenamed", "unknown event type %q", "OrderRenamed")
+    }
+    l.Printf("OrderMerged", "unknown event type %q", "OrderMerged")
+    if n := strings.Count(logs.String(), `"OrderRenamed"`); n != 1 {
+        t.Errorf("OrderRenamed logged %d times within the interval, want once: %q", n, logs.String())
+    }
+    if !strings.Contains(logs.String(), `"OrderMerged"`) {
+        t.Errorf("log = %q, want the other key logged", logs.String())
+    }
+    
+    time.Sleep(60 * time.Millisecond)
+    logs.Reset()
+    l.Printf("OrderRenamed", "unknown event type %q", "OrderRenamed")
+    if !strings.Contains(logs.String(), `unknown event type "OrderRenamed" (2 more since last logged)`) {
+        t.Errorf("log = %q, want the 2 skipped lines reported", logs.String())
+    }
+}
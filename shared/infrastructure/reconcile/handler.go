@@ -0,0 +1,57 @@
+package reconcile
+
+import (
+	"net/http"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+)
+
+// Handler serves a side's order counts and ids under CountsPath and
+// IDsPath. Mount it behind the admin key.
+type Handler struct {
+    Source Source
+}
+
+// HandleCounts counts the orders by status.
+func (h *Handler) HandleCounts(w http.ResponseWriter, r *http.Request) {
+    counts, err := h.Source.CountOrdersByStatus(r.Context())
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    apijson.Write(w, r, http.StatusOK, NewCounts(counts, clock.Now()))
+}
+
+// HandleIDs pages through the order ids in byte order.
+func (h *Handler) HandleIDs(w http.ResponseWriter, r *http.Request) {
+    after := r.URL.Query().Get("after")
+    
+    page, err := pagination.ParsePagination(r, pagination.Pagination{Limit: 500}, MaxIDsLimit)
+    if err != nil {
+        pagination.WriteError(w, err)
+        return
+    }
+    if page.Offset != 0 {
+        http.Error(w, "offset is not supported, page with after", http.StatusBadRequest)
+        return
+    }
+    
+    ids, err := h.Source.ListOrderIDs(r.Context(), after, page.Limit)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    
+    response := IDPage{IDs: ids, NextAfter: after}
+    if response.IDs == nil {
+        response.IDs = []string{}
+    }
+    if len(ids) > 0 {
+        response.NextAfter = ids[len(ids)-1]
+    }
+    
+    apijson.Write(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,83 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// idSource is a Source over a fixed list of ids.
+type idSource []string
+
+func (s idSource) CountOrdersByStatus(context.Context) (map[string]int64, error) {
+    return map[string]int64{"pending": int64(len(s))}, nil
+}
+
+func (s idSource) ListOrderIDs(_ context.Context, after string, limit int) ([]string, error) {
+    ids := append([]string(nil), s...)
+    sort.Strings(ids)
+    var page []string
+    for _, id := range ids {
+        if id > after && len(page) < limit {
+            page = append(page, id)
+        }
+    }
+    return page, nil
+}
+
+func TestHandler_HandleIDs(t *testing.T) {
+    handler := &Handler{Source: idSource{"c", "a", "b"}}
+    tests := []struct {
+        name       string
+        query      string
+        wantStatus int
+        want       IDPage
+    }{
+        {name: "first page", query: "limit=2", wantStatus: http.StatusOK, want: IDPage{IDs: []string{"a", "b"}, NextAfter: "b"}},
+        {name: "next page", query: "after=b&limit=2", wantStatus: http.StatusOK, want: IDPage{IDs: []string{"c"}, NextAfter: "c"}},
+        {name: "past the end", query: "after=c", wantStatus: http.StatusOK, want: IDPage{IDs: []string{}, NextAfter: "c"}},
+        {name: "default limit", query: "", wantStatus: http.StatusOK, want: IDPage{IDs: []string{"a", "b", "c"}, NextAfter: "c"}},
+        {name: "limit zero", query: "limit=0", wantStatus: http.StatusBadRequest},
+        {name: "limit over the maximum", query: "limit=1001", wantStatus: http.StatusBadRequest},
+        {name: "offset", query: "offset=1", wantStatus: http.StatusBadRequest},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            recorder := httptest.NewRecorder()
+            handler.HandleIDs(recorder, httptest.NewRequest(http.MethodGet, IDsPath+"?"+tt.query, nil))
+            if recorder.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+            
+            var got IDPage
+            if err := json.NewDecoder(recorder.Body).Decode(&got); err != nil {
+                t.Fatalf("decoding page: %v", err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("page = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestHandler_HandleCounts(t *testing.T) {
+    handler := &Handler{Source: idSource{"a", "b"}}
+    recorder := httptest.NewRecorder()
+    handler.HandleCounts(recorder, httptest.NewRequest(http.MethodGet, CountsPath, nil))
+    
+    var got Counts
+    if err := json.NewDecoder(recorder.Body).Decode(&got); err != nil {
+        t.Fatalf("decoding counts: %v", err)
+    }
+    if got.Total != 2 || got.ByStatus["pending"] != 2 {
+        t.Errorf("counts = %+v, want 2 pending", got)
+    }
+}
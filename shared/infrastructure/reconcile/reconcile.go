@@ -0,0 +1,285 @@
+// Package reconcile compares the orders the management service stores with
+// the orders the reporting service has projected, to tell when the read
+// side has drifted from the write side further than projection lag
+// explains. Each service serves its side under CountsPath and IDsPath;
+// Compare diffs the counts by status and samples the ids present on one
+// side only.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apiclient"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// CountsPath and IDsPath are the paths of the reconciliation endpoints
+// under a service's base URL. Both require the admin key.
+const (
+    CountsPath = "/admin/reconcile/counts"
+    IDsPath    = "/admin/reconcile/ids"
+)
+
+// MaxIDsLimit caps the ids IDsPath returns at once.
+const MaxIDsLimit = 1000
+
+// Source counts a side's orders and pages through their ids. Order
+// repositories and read models implement it over their tables.
+type Source interface {
+    // CountOrdersByStatus returns how many orders there are in each status
+    CountOrdersByStatus(ctx context.Context) (map[string]int64, error)
+    // ListOrderIDs returns up to limit order ids greater than after, in
+    // byte order. Fewer than limit means there are no more.
+    ListOrderIDs(ctx context.Context, after string, limit int) ([]string, error)
+}
+
+// Counts is a response of CountsPath.
+type Counts struct {
+    Total     int64             `json:"total"`
+    ByStatus  map[string]int64  `json:"by_status"`
+    CountedAt apijson.Timestamp `json:"counted_at"`
+}
+
+// NewCounts totals byStatus, counted at countedAt.
+func NewCounts(byStatus map[string]int64, countedAt time.Time) *Counts {
+    counts := &Counts{ByStatus: byStatus, CountedAt: apijson.NewTimestamp(countedAt)}
+    if counts.ByStatus == nil {
+        counts.ByStatus = map[string]int64{}
+    }
+    for _, count := range counts.ByStatus {
+        counts.Total += count
+    }
+    return counts
+}
+
+// IDPage is a response of IDsPath. NextAfter is the id to ask for the
+// following page after, the last id's or, when IDs is empty, the one asked
+// for.
+type IDPage struct {
+    IDs       []string `json:"ids"`
+    NextAfter string   `json:"next_after"`
+}
+
+// Client reads the reconciliation endpoints of one service.
+type Client struct {
+    api *apiclient.Client
+}
+
+// NewClient returns a client for the service at cfg.BaseURL. The endpoints
+// require the service's admin key in cfg.APIKey.
+func NewClient(cfg apiclient.Config) (*Client, error) {
+    api, err := apiclient.New(cfg)
+    if err != nil {
+        return nil, err
+    }
+    return &Client{api: api}, nil
+}
+
+func (c *Client) CountOrdersByStatus(ctx context.Context) (map[string]int64, error) {
+    var counts Counts
+    if err := c.api.Do(ctx, apiclient.Request{Method: http.MethodGet, Path: CountsPath}, &counts); err != nil {
+        return nil, err
+    }
+    return counts.ByStatus, nil
+}
+
+func (c *Client) ListOrderIDs(ctx context.Context, after string, limit int) ([]string, error) {
+    query := url.Values{}
+    query.Set("after", after)
+    query.Set("limit", strconv.Itoa(limit))
+    
+    var page IDPage
+    if err := c.api.Do(ctx, apiclient.Request{Method: http.MethodGet, Path: IDsPath, Query: query}, &page); err != nil {
+        return nil, err
+    }
+    return page.IDs, nil
+}
+
+// Options tunes Compare.
+type Options struct {
+    // Threshold is the divergence tolerated before the report is marked
+    // diverged, leaving room for orders still being projected
+    Threshold  int64
+    // SampleSize bounds the ids listed as missing on each side; zero skips
+    // the id scan
+    SampleSize int
+    // PageSize is how many ids are read from each side at once, 500 when
+    // zero
+    PageSize   int
+}
+
+// StatusDiff compares the orders in one status. Diff is Read minus Write,
+// negative when the read side is missing orders.
+type StatusDiff struct {
+    Status string `json:"status"`
+    Write  int64  `json:"write"`
+    Read   int64  `json:"read"`
+    Diff   int64  `json:"diff"`
+}
+
+// Report is the outcome of Compare.
+type Report struct {
+    Write            *Counts      `json:"write"`
+    Read             *Counts      `json:"read"`
+    // Statuses lists every status either side has orders in, by name
+    Statuses         []StatusDiff `json:"statuses"`
+    // Divergence sums the absolute differences of Statuses, so an order
+    // projected in a stale status counts twice
+    Divergence       int64        `json:"divergence"`
+    Threshold        int64        `json:"threshold"`
+    Diverged         bool         `json:"diverged"`
+    // MissingFromRead and MissingFromWrite sample the ids found on one
+    // side only, up to the sample size each, in byte order. They are
+    // empty when the counts agree, as the id scan is then skipped
+    MissingFromRead  []string     `json:"missing_from_read"`
+    MissingFromWrite []string     `json:"missing_from_write"`
+    // Truncated is set when either sample left ids out, or may have, as
+    // the scan stops once both are full
+    Truncated        bool         `json:"truncated"`
+}
+
+// Compare counts the orders of write and read by status and, when the
+// counts differ, scans both sides' ids to sample the orders present on one
+// side only. The sides are read one after the other, not at one instant,
+// so orders created or changed meanwhile show up as divergence; Threshold
+// absorbs them.
+func Compare(ctx context.Context, write, read Source, opts Options) (*Report, error) {
+    if opts.PageSize <= 0 {
+        opts.PageSize = 500
+    }
+    
+    writeCounts, err := write.CountOrdersByStatus(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count write side orders: %w", err)
+    }
+    writeCountedAt := time.Now()
+    readCounts, err := read.CountOrdersByStatus(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count read side orders: %w", err)
+    }
+    
+    report := &Report{
+        Write:            NewCounts(writeCounts, writeCountedAt),
+        Read:             NewCounts(readCounts, time.Now()),
+        Threshold:        opts.Threshold,
+        MissingFromRead:  []string{},
+        MissingFromWrite: []string{},
+    }
+    report.Statuses, report.Divergence = diffStatuses(report.Write.ByStatus, report.Read.ByStatus)
+    report.Diverged = report.Divergence > opts.Threshold
+    
+    if report.Divergence == 0 || opts.SampleSize <= 0 {
+        return report, nil
+    }
+    if err := sampleMissing(ctx, write, read, opts, report); err != nil {
+        return nil, err
+    }
+    return report, nil
+}
+
+func diffStatuses(write, read map[string]int64) ([]StatusDiff, int64) {
+    statuses := map[string]bool{}
+    for status := range write {
+        statuses[status] = true
+    }
+    for status := range read {
+        statuses[status] = true
+    }
+    
+    diffs := make([]StatusDiff, 0, len(statuses))
+    var divergence int64
+    for status := range statuses {
+        diff := StatusDiff{Status: status, Write: write[status], Read: read[status]}
+        diff.Diff = diff.Read - diff.Write
+        if diff.Diff < 0 {
+            divergence -= diff.Diff
+        } else {
+            divergence += diff.Diff
+        }
+        diffs = append(diffs, diff)
+    }
+    sort.Slice(diffs, func(i, j int) bool { return diffs[i].Status < diffs[j].Status })
+    return diffs, divergence
+}
+
+// sampleMissing merges the id-ordered pages of both sides, holding one page
+// of each at a time, until both samples are full or both sides are read.
+func sampleMissing(ctx context.Context, write, read Source, opts Options, report *Report) error {
+    writeIDs := &idCursor{source: write, side: "write", pageSize: opts.PageSize}
+    readIDs := &idCursor{source: read, side: "read", pageSize: opts.PageSize}
+    
+    for len(report.MissingFromRead) < opts.SampleSize || len(report.MissingFromWrite) < opts.SampleSize {
+        writeID, writeOK, err := writeIDs.peek(ctx)
+        if err != nil {
+            return err
+        }
+        readID, readOK, err := readIDs.peek(ctx)
+        if err != nil {
+            return err
+        }
+        
+        switch {
+        case !writeOK && !readOK:
+            return nil
+        case writeOK && (!readOK || writeID < readID):
+            if len(report.MissingFromRead) < opts.SampleSize {
+                report.MissingFromRead = append(report.MissingFromRead, writeID)
+            } else {
+                report.Truncated = true
+            }
+            writeIDs.next()
+        case readOK && (!writeOK || readID < writeID):
+            if len(report.MissingFromWrite) < opts.SampleSize {
+                report.MissingFromWrite = append(report.MissingFromWrite, readID)
+            } else {
+                report.Truncated = true
+            }
+            readIDs.next()
+        default:
+            writeIDs.next()
+            readIDs.next()
+        }
+    }
+    report.Truncated = true
+    return nil
+}
+
+// idCursor walks the ids of a source a page at a time.
+type idCursor struct {
+    source   Source
+    side     string
+    pageSize int
+    page     []string
+    after    string
+    done     bool
+}
+
+// peek returns the current id, reading the next page when the current one
+// is used up; ok is false once the source has no more ids.
+func (c *idCursor) peek(ctx context.Context) (string, bool, error) {
+    if len(c.page) == 0 && !c.done {
+        page, err := c.source.ListOrderIDs(ctx, c.after, c.pageSize)
+        if err != nil {
+            return "", false, fmt.Errorf("failed to list %s side order ids: %w", c.side, err)
+        }
+        c.page = page
+        c.done = len(page) < c.pageSize
+        if len(page) > 0 {
+            c.after = page[len(page)-1]
+        }
+    }
+    if len(c.page) == 0 {
+        return "", false, nil
+    }
+    return c.page[0], true, nil
+}
+
+func (c *idCursor) next() {
+    c.page = c.page[1:]
+}
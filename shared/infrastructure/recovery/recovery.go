@@ -0,0 +1,78 @@
+// Package recovery turns panics in request handlers and background loops
+// into logged, counted errors so one bad request or event cannot take the
+// process down.
+package recovery
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrPanic is wrapped by the errors Guard returns for recovered panics.
+var ErrPanic = errors.New("recovered panic")
+
+// Reporter receives every recovered panic, e.g. to forward it to an error
+// tracking service.
+type Reporter interface {
+    ReportPanic(ctx context.Context, source string, value interface{}, stack []byte)
+}
+
+// panics counts recovered panics per source and is published as the
+// "panics" expvar.
+var panics = expvar.NewMap("panics")
+
+var (
+    reporterMu sync.RWMutex
+    reporter   Reporter
+)
+
+// SetReporter installs the reporter recovered panics are forwarded to. A nil
+// reporter disables forwarding.
+func SetReporter(r Reporter) {
+    reporterMu.Lock()
+    defer reporterMu.Unlock()
+    
+    reporter = r
+}
+
+// Recovered records a value returned by recover(): it logs detail with the
+// stack, counts the panic under source and forwards it to the reporter. The
+// returned error wraps ErrPanic.
+func Recovered(ctx context.Context, source, detail string, value interface{}) error {
+    stack := debug.Stack()
+    log.Printf("Recovered panic in %s (%s): %v\n%s", source, detail, value, stack)
+    panics.Add(source, 1)
+    
+    reporterMu.RLock()
+    r := reporter
+    reporterMu.RUnlock()
+    if r != nil {
+        r.ReportPanic(ctx, source, value, stack)
+    }
+    
+    return fmt.Errorf("%w in %s: %v", ErrPanic, source, value)
+}
+
+// Guard runs fn and converts a panic into an error wrapping ErrPanic.
+func Guard(ctx context.Context, source, detail string, fn func() error) (err error) {
+    defer func() {
+        if value := recover(); value != nil {
+            err = Recovered(ctx, source, detail, value)
+        }
+    }()
+    
+    return fn()
+}
+
+// Count returns how many panics have been recovered for source.
+func Count(source string) int64 {
+    if v, ok := panics.Get(source).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
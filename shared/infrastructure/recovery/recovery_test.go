@@ -0,0 +1,66 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingReporter records the sources of the panics reported to it, and
+// whether each came with a stack.
+type recordingReporter struct {
+    sources []string
+    stacks  []bool
+}
+
+func (r *recordingReporter) ReportPanic(_ context.Context, source string, _ interface{}, stack []byte) {
+    r.sources = append(r.sources, source)
+    r.stacks = append(r.stacks, len(stack) > 0)
+}
+
+func TestGuard(t *testing.T) {
+    reporter := &recordingReporter{}
+    SetReporter(reporter)
+    defer SetReporter(nil)
+    failure := errors.New("handler failed")
+    tests := []struct {
+        name      string
+        fn        func() error
+        wantErr   error
+        wantPanic bool
+    }{
+        {name: "no error", fn: func() error { return nil }},
+        {name: "error", fn: func() error { return failure }, wantErr: failure},
+        {name: "panic", fn: func() error { panic("bad event") }, wantErr: ErrPanic, wantPanic: true},
+        {name: "nil map write", fn: func() error {
+            var m map[string]int
+            m["x"] = 1
+            return nil
+        }, wantErr: ErrPanic, wantPanic: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            source := "test " + tt.name
+            reporter.sources, reporter.stacks = nil, nil
+            
+            err := Guard(context.Background(), source, "detail", tt.fn)
+            if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+                t.Errorf("Guard() = %v, want %v", err, tt.wantErr)
+            }
+            var wantCount int64
+            var wantReports []string
+            var wantStacks []bool
+            if tt.wantPanic {
+                wantCount, wantReports, wantStacks = 1, []string{source}, []bool{true}
+            }
+            if got := Count(source); got != wantCount {
+                t.Errorf("Count(%q) = %d, want %d", source, got, wantCount)
+            }
+            if !reflect.DeepEqual(reporter.sources, wantReports) || !reflect.DeepEqual(reporter.stacks, wantStacks) {
+                t.Errorf("reported %v with stacks %v, want %v", reporter.sources, reporter.stacks, wantReports)
+            }
+        })
+    }
+}
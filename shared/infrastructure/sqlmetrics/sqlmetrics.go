@@ -0,0 +1,222 @@
+// Package sqlmetrics times SQL statements by name, publishing a latency
+// histogram per statement and logging the ones slower than a threshold.
+// Each call site passes a name constant so slow analytics can be traced to
+// the statement responsible.
+package sqlmetrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSlowThreshold is the duration above which statements are logged.
+const DefaultSlowThreshold = 500 * time.Millisecond
+
+// maxLoggedStatement bounds how much of a slow statement is logged.
+const maxLoggedStatement = 200
+
+// Queryer runs statements. *sql.DB and *sql.Tx implement it.
+type Queryer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+    QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+    QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// DB runs statements on a Queryer, timing each one under its name. Query
+// durations cover the statement up to its first row, not the caller's
+// iteration over the rows.
+type DB struct {
+    conn          Queryer
+    slowThreshold time.Duration
+}
+
+// Wrap instruments conn, logging statements slower than slowThreshold. A
+// zero threshold uses DefaultSlowThreshold; a negative one disables the
+// slow log.
+func Wrap(conn Queryer, slowThreshold time.Duration) *DB {
+    if slowThreshold == 0 {
+        slowThreshold = DefaultSlowThreshold
+    }
+    return &DB{conn: conn, slowThreshold: slowThreshold}
+}
+
+// SlowThresholdFromEnv reads SLOW_QUERY_THRESHOLD, falling back to
+// DefaultSlowThreshold.
+func SlowThresholdFromEnv() time.Duration {
+    if threshold, err := time.ParseDuration(os.Getenv("SLOW_QUERY_THRESHOLD")); err == nil {
+        return threshold
+    }
+    return DefaultSlowThreshold
+}
+
+func (d *DB) Exec(ctx context.Context, name, query string, args ...interface{}) (sql.Result, error) {
+    start := time.Now()
+    result, err := d.conn.ExecContext(ctx, query, args...)
+    d.observe(name, query, time.Since(start), err)
+    return result, err
+}
+
+func (d *DB) Query(ctx context.Context, name, query string, args ...interface{}) (*sql.Rows, error) {
+    start := time.Now()
+    rows, err := d.conn.QueryContext(ctx, query, args...)
+    d.observe(name, query, time.Since(start), err)
+    return rows, err
+}
+
+// QueryRow errors surface on Scan, so only the duration is recorded.
+func (d *DB) QueryRow(ctx context.Context, name, query string, args ...interface{}) *sql.Row {
+    start := time.Now()
+    row := d.conn.QueryRowContext(ctx, query, args...)
+    d.observe(name, query, time.Since(start), nil)
+    return row
+}
+
+// BeginTx starts a transaction whose statements are instrumented like d's.
+// The wrapped Queryer must be a *sql.DB.
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+    db, ok := d.conn.(*sql.DB)
+    if !ok {
+        return nil, errors.New("sqlmetrics: transactions need a wrapped *sql.DB")
+    }
+    
+    tx, err := db.BeginTx(ctx, opts)
+    if err != nil {
+        return nil, err
+    }
+    return &Tx{DB: &DB{conn: tx, slowThreshold: d.slowThreshold}, tx: tx}, nil
+}
+
+// Tx is an instrumented transaction.
+type Tx struct {
+    *DB
+    tx *sql.Tx
+}
+
+func (t *Tx) Commit() error {
+    return t.tx.Commit()
+}
+
+func (t *Tx) Rollback() error {
+    return t.tx.Rollback()
+}
+
+// Unwrap returns the underlying transaction, for writers outside this
+// package that take a *sql.Tx. Their statements are not instrumented.
+func (t *Tx) Unwrap() *sql.Tx {
+    return t.tx
+}
+
+func (d *DB) observe(name, query string, duration time.Duration, err error) {
+    histogramFor(name).observe(duration, err)
+    
+    if d.slowThreshold > 0 && duration > d.slowThreshold {
+        log.Printf("Slow query %s took %s: %s", name, duration.Round(time.Millisecond), truncate(query))
+    }
+}
+
+// truncate collapses the indentation of a statement and shortens it for
+// logging.
+func truncate(query string) string {
+    statement := strings.Join(strings.Fields(query), " ")
+    if len(statement) > maxLoggedStatement {
+        return statement[:maxLoggedStatement] + "..."
+    }
+    return statement
+}
+
+// stats is published as the "sql_queries" expvar: a latency histogram per
+// statement name.
+var (
+    stats      = expvar.NewMap("sql_queries")
+    histograms sync.Map
+)
+
+// bucketBounds are the upper bounds of the histogram buckets; slower
+// statements fall in the last, unbounded bucket.
+var bucketBounds = []time.Duration{
+    time.Millisecond,
+    5 * time.Millisecond,
+    10 * time.Millisecond,
+    50 * time.Millisecond,
+    100 * time.Millisecond,
+    500 * time.Millisecond,
+    time.Second,
+    5 * time.Second,
+}
+
+// Histogram counts the durations of one statement by bucket. Buckets are
+// cumulative: le_50ms includes every statement that took at most 50ms.
+type Histogram struct {
+    mu      sync.Mutex
+    count   int64
+    errors  int64
+    total   time.Duration
+    buckets []int64
+}
+
+func histogramFor(name string) *Histogram {
+    if h, ok := histograms.Load(name); ok {
+        return h.(*Histogram)
+    }
+    
+    h, loaded := histograms.LoadOrStore(name, &Histogram{buckets: make([]int64, len(bucketBounds)+1)})
+    if !loaded {
+        stats.Set(name, h.(*Histogram))
+    }
+    return h.(*Histogram)
+}
+
+// Observed returns the histogram recorded for the statement name, or nil if
+// it has not run.
+func Observed(name string) *Histogram {
+    if h, ok := histograms.Load(name); ok {
+        return h.(*Histogram)
+    }
+    return nil
+}
+
+func (h *Histogram) observe(duration time.Duration, err error) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    h.count++
+    h.total += duration
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        h.errors++
+    }
+    for i, bound := range bucketBounds {
+        if duration <= bound {
+            h.buckets[i]++
+        }
+    }
+    h.buckets[len(bucketBounds)]++
+}
+
+// Count returns the number of statements observed.
+func (h *Histogram) Count() int64 {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    return h.count
+}
+
+// String renders the histogram as JSON for expvar.
+func (h *Histogram) String() string {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    var b strings.Builder
+    fmt.Fprintf(&b, `{"count": %d, "errors": %d, "total_ms": %.3f`, h.count, h.errors, float64(h.total)/float64(time.Millisecond))
+    for i, bound := range bucketBounds {
+        fmt.Fprintf(&b, `, "le_%s": %d`, bound, h.buckets[i])
+    }
+    fmt.Fprintf(&b, `, "le_inf": %d}`, h.buckets[len(bucketBounds)])
+    return b.String()
+}
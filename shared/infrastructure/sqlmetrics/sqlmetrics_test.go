@@ -0,0 +1,164 @@
+package sqlmetrics
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowExecer takes delay over every statement and fails with err.
+type slowExecer struct {
+    delay time.Duration
+    err   error
+}
+
+func (e slowExecer) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+    time.Sleep(e.delay)
+    return nil, e.err
+}
+
+func (e slowExecer) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+    time.Sleep(e.delay)
+    return nil, e.err
+}
+
+func (e slowExecer) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+    time.Sleep(e.delay)
+    return nil
+}
+
+// captureLog sends the standard logger to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+    t.Helper()
+    var buf bytes.Buffer
+    writer, flags := log.Writer(), log.Flags()
+    log.SetOutput(&buf)
+    log.SetFlags(0)
+    t.Cleanup(func() {
+        log.SetOutput(writer)
+        log.SetFlags(flags)
+    })
+    return &buf
+}
+
+func TestDB_observe(t *testing.T) {
+    query := "SELECT id\n        FROM orders\n        WHERE " + strings.Repeat("status = 'x' OR ", 20) + "true"
+    tests := []struct {
+        name       string
+        execer     slowExecer
+        threshold  time.Duration
+        run        func(db *DB, name string)
+        wantSlow   bool
+        wantErrors string
+    }{
+        {
+            name:       "slow exec is logged",
+            execer:     slowExecer{delay: 5 * time.Millisecond},
+            threshold:  time.Millisecond,
+            run:        func(db *DB, name string) { db.Exec(context.Background(), name, query) },
+            wantSlow:   true,
+            wantErrors: `"errors": 0`,
+        },
+        {
+            name:       "fast query is not",
+            execer:     slowExecer{},
+            threshold:  time.Second,
+            run:        func(db *DB, name string) { db.Query(context.Background(), name, query) },
+            wantErrors: `"errors": 0`,
+        },
+        {
+            name:       "negative threshold disables the log",
+            execer:     slowExecer{delay: 5 * time.Millisecond},
+            threshold:  -1,
+            run:        func(db *DB, name string) { db.QueryRow(context.Background(), name, query) },
+            wantErrors: `"errors": 0`,
+        },
+        {
+            name:       "failed statements are counted",
+            execer:     slowExecer{err: errors.New("connection reset")},
+            threshold:  time.Second,
+            run:        func(db *DB, name string) { db.Exec(context.Background(), name, query) },
+            wantErrors: `"errors": 2`,
+        },
+        {
+            name:       "no rows is not a failure",
+            execer:     slowExecer{err: sql.ErrNoRows},
+            threshold:  time.Second,
+            run:        func(db *DB, name string) { db.Query(context.Background(), name, query) },
+            wantErrors: `"errors": 0`,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            logs := captureLog(t)
+            name := "test." + strings.ReplaceAll(tt.name, " ", "_")
+            db := Wrap(tt.execer, tt.threshold)
+            
+            tt.run(db, name)
+            tt.run(db, name)
+            
+            histogram := Observed(name)
+            if histogram == nil || histogram.Count() != 2 {
+                t.Fatalf("Observed(%q) = %v, want 2 statements", name, histogram)
+            }
+            if rendered := histogram.String(); !strings.Contains(rendered, tt.wantErrors) || !strings.Contains(rendered, `"le_inf": 2`) {
+                t.Errorf("histogram = %s, want %s and both statements in le_inf", rendered, tt.wantErrors)
+            }
+            
+            logged := logs.String()
+            if slow := strings.Contains(logged, "Slow query "+name); slow != tt.wantSlow {
+                t.Fatalf("slow query logged = %v, want %v: %q", slow, tt.wantSlow, logged)
+            }
+            if !tt.wantSlow {
+                return
+            }
+            if !strings.Contains(logged, "SELECT id FROM orders WHERE status") || !strings.Contains(logged, "...") {
+                t.Errorf("slow query log = %q, want the statement collapsed and truncated", logged)
+            }
+            if line := strings.SplitN(logged, "\n", 2)[0]; len(line) > maxLoggedStatement+100 {
+                t.Errorf("slow query log line is %d bytes long", len(line))
+            }
+        })
+    }
+}
+
+func TestHistogram_buckets(t *testing.T) {
+    h := &Histogram{buckets: make([]int64, len(bucketBounds)+1)}
+    for _, duration := range []time.Duration{time.Millisecond, 7 * time.Millisecond, 2 * time.Second, time.Minute} {
+        h.observe(duration, nil)
+    }
+    
+    rendered := h.String()
+    for _, want := range []string{`"count": 4`, `"le_1ms": 1`, `"le_10ms": 2`, `"le_1s": 2`, `"le_5s": 3`, `"le_inf": 4`} {
+        if !strings.Contains(rendered, want) {
+            t.Errorf("histogram = %s, want %s", rendered, want)
+        }
+    }
+}
+
+func TestSlowThresholdFromEnv(t *testing.T) {
+    tests := []struct {
+        value string
+        want  time.Duration
+    }{
+        {value: "", want: DefaultSlowThreshold},
+        {value: "250ms", want: 250 * time.Millisecond},
+        {value: "-1s", want: -time.Second},
+        {value: "soon", want: DefaultSlowThreshold},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.value, func(t *testing.T) {
+            t.Setenv("SLOW_QUERY_THRESHOLD", tt.value)
+            if got := SlowThresholdFromEnv(); got != tt.want {
+                t.Errorf("SlowThresholdFromEnv() = %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,257 @@
+package timewindow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	// The zone database is embedded so ?tz works on hosts and images
+	// without one
+	_ "time/tzdata"
+)
+
+// Period names a preset window, or Custom for one given by from and to.
+type Period string
+
+const (
+    // Daily runs from midnight today
+    Daily   Period = "daily"
+    // Weekly runs from midnight on Monday of this ISO week
+    Weekly  Period = "weekly"
+    // Monthly runs from midnight on the first of this month
+    Monthly Period = "monthly"
+    // All covers all time
+    All     Period = "all"
+    // Custom runs between the given from and to
+    Custom  Period = "custom"
+)
+
+// DefaultPeriod is the period ParsePeriod picks when none is given.
+const DefaultPeriod = Monthly
+
+// Presets are the periods ParsePeriod accepts by name, besides Custom.
+var Presets = []Period{Daily, Weekly, Monthly, All}
+
+// Error describes a rejected window parameter. Handlers return it to
+// clients as a 400 response via WriteError.
+type Error struct {
+    Parameter string `json:"parameter"`
+    Value     string `json:"value"`
+    Message   string `json:"message"`
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("invalid %s %q: %s", e.Parameter, e.Value, e.Message)
+}
+
+// WriteError writes err as a 400 response. Window errors are encoded as
+// JSON so clients can tell which parameter was rejected.
+func WriteError(w http.ResponseWriter, err error) {
+    var wErr *Error
+    if !errors.As(err, &wErr) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusBadRequest)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error":     "invalid_window",
+        "parameter": wErr.Parameter,
+        "value":     wErr.Value,
+        "message":   wErr.Message,
+    })
+}
+
+// Window is the half-open range [From, To) a report covers, with the
+// location its days start in. An All window has zero From and To and
+// covers everything.
+type Window struct {
+    Period   Period
+    From     time.Time
+    To       time.Time
+    Location *time.Location
+}
+
+// Unbounded reports whether w covers all time.
+func (w Window) Unbounded() bool {
+    return w.From.IsZero() && w.To.IsZero()
+}
+
+// ParsePeriod reads the window a report covers from the query string at
+// now:
+//
+//   - period is daily, weekly, monthly or all, running from the start of
+//     now's day, ISO week or month up to now; it defaults to DefaultPeriod
+//   - from and to, with period custom or left out, give the window
+//     instead; each is a date, taken as midnight, or an RFC 3339
+//     timestamp. from is required and to defaults to now
+//   - tz is the IANA time zone days start in, such as Europe/Berlin; it
+//     defaults to loc, or UTC when loc is nil
+//
+// Days, weeks and months start at local midnight, so a window spanning a
+// daylight saving change is an hour shorter or longer than its nominal
+// length. Rejected parameters are reported as an *Error.
+func ParsePeriod(query url.Values, now time.Time, loc *time.Location) (Window, error) {
+    if loc == nil {
+        loc = time.UTC
+    }
+    if tz := query.Get("tz"); tz != "" {
+        parsed, err := LoadLocation(tz)
+        if err != nil {
+            return Window{}, &Error{Parameter: "tz", Value: tz, Message: "must be an IANA time zone, such as UTC or Europe/Berlin"}
+        }
+        loc = parsed
+    }
+    now = now.In(loc)
+    
+    period := Period(query.Get("period"))
+    rawFrom, rawTo := query.Get("from"), query.Get("to")
+    if rawFrom != "" || rawTo != "" || period == Custom {
+        if period != "" && period != Custom {
+            return Window{}, &Error{Parameter: "period", Value: string(period), Message: "must be custom, or left out, when from or to is given"}
+        }
+        return parseRange(rawFrom, rawTo, now, loc)
+    }
+    
+    if period == "" {
+        period = DefaultPeriod
+    }
+    window, ok := Preset(period, now)
+    if !ok {
+        return Window{}, &Error{Parameter: "period", Value: string(period), Message: "must be one of daily, weekly, monthly, all or custom"}
+    }
+    return window, nil
+}
+
+func parseRange(rawFrom, rawTo string, now time.Time, loc *time.Location) (Window, error) {
+    if rawFrom == "" {
+        return Window{}, &Error{Parameter: "from", Message: "is required for a custom period"}
+    }
+    from, ok := parseDateOrTime(rawFrom, loc)
+    if !ok {
+        return Window{}, &Error{Parameter: "from", Value: rawFrom, Message: "must be a date (2006-01-02) or an RFC 3339 timestamp"}
+    }
+    to := now
+    if rawTo != "" {
+        if to, ok = parseDateOrTime(rawTo, loc); !ok {
+            return Window{}, &Error{Parameter: "to", Value: rawTo, Message: "must be a date (2006-01-02) or an RFC 3339 timestamp"}
+        }
+    }
+    if !from.Before(to) {
+        return Window{}, &Error{Parameter: "to", Value: rawTo, Message: "must be after from"}
+    }
+    return Window{Period: Custom, From: from, To: to, Location: loc}, nil
+}
+
+// parseDateOrTime parses a date, as its first instant in loc, or an RFC
+// 3339 timestamp.
+func parseDateOrTime(raw string, loc *time.Location) (time.Time, bool) {
+    if date, err := time.Parse("2006-01-02", raw); err == nil {
+        return StartOfDay(date.Year(), date.Month(), date.Day(), loc), true
+    }
+    parsed, err := time.Parse(time.RFC3339, raw)
+    return parsed.In(loc), err == nil
+}
+
+// LoadLocation loads the IANA time zone name. Unlike time.LoadLocation it
+// refuses "Local", whose meaning depends on the host.
+func LoadLocation(name string) (*time.Location, error) {
+    if strings.EqualFold(name, "Local") {
+        return nil, fmt.Errorf("unknown time zone %s", name)
+    }
+    return time.LoadLocation(name)
+}
+
+// Preset returns the window of period up to now, in now's location,
+// reporting false for Custom and unknown periods.
+func Preset(period Period, now time.Time) (Window, bool) {
+    loc := now.Location()
+    window := Window{Period: period, To: now, Location: loc}
+    year, month, day := now.Date()
+    switch period {
+    case Daily:
+        window.From = StartOfDay(year, month, day, loc)
+    case Weekly:
+        // Weekday counts from Sunday; weeks here start on Monday
+        window.From = StartOfDay(year, month, day-(int(now.Weekday())+6)%7, loc)
+    case Monthly:
+        window.From = StartOfDay(year, month, 1, loc)
+    case All:
+        return Window{Period: All, Location: loc}, true
+    default:
+        return Window{}, false
+    }
+    return window, true
+}
+
+// Previous returns the whole period before w: the day, ISO week or month
+// before a preset's, or the range of the same length ending at From for a
+// custom window. An All window has none, and is returned as it is.
+func (w Window) Previous() Window {
+    if w.Unbounded() {
+        return w
+    }
+    previous := Window{Period: w.Period, To: w.From, Location: w.Location}
+    from := w.From.In(w.Location)
+    year, month, day := from.Date()
+    switch w.Period {
+    case Daily:
+        previous.From = StartOfDay(year, month, day-1, w.Location)
+    case Weekly:
+        previous.From = StartOfDay(year, month, day-7, w.Location)
+    case Monthly:
+        previous.From = StartOfDay(year, month-1, 1, w.Location)
+    default:
+        previous.From = w.From.Add(-w.To.Sub(w.From))
+    }
+    return previous
+}
+
+// StartOfDay returns the first instant of the date in loc, normalizing it
+// as time.Date does. Where a daylight saving change skips midnight, the
+// day starts when the clocks jump.
+func StartOfDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+    start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+    if start.Hour() == 0 {
+        return start
+    }
+    // time.Date resolves a skipped midnight to either side of the jump;
+    // from the previous day's side, the jump is as long as the offset
+    // changes by
+    noon := time.Date(year, month, day, 12, 0, 0, 0, loc)
+    if start.Day() != noon.Day() {
+        _, before := start.Zone()
+        _, after := noon.Zone()
+        start = start.Add(time.Duration(after-before) * time.Second)
+    }
+    return start
+}
+
+// Key identifies the window for caching: the period and zone of a preset,
+// whose bounds move with now, or the bounds of a custom window.
+func (w Window) Key() string {
+    zone := "UTC"
+    if w.Location != nil {
+        zone = w.Location.String()
+    }
+    if w.Period != Custom {
+        return string(w.Period) + "@" + zone
+    }
+    return fmt.Sprintf("%s@%s:%s", w.Period, w.From.UTC().Format(time.RFC3339Nano), w.To.UTC().Format(time.RFC3339Nano))
+}
+
+// WhereClause returns the condition restricting column, a UTC timestamp
+// without time zone, to w, with placeholders numbered from argIndex and
+// the matching arguments. An All window matches every row.
+func (w Window) WhereClause(column string, argIndex int) (string, []interface{}) {
+    if w.Unbounded() {
+        return "1=1", nil
+    }
+    clause := fmt.Sprintf("%[1]s >= $%[2]d AND %[1]s < $%[3]d", column, argIndex, argIndex+1)
+    return clause, []interface{}{w.From.UTC(), w.To.UTC()}
+}
@@ -0,0 +1,282 @@
+package timewindow
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+    t.Helper()
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+        t.Fatalf("LoadLocation(%q): %v", name, err)
+    }
+    return loc
+}
+
+func TestParsePeriod(t *testing.T) {
+    berlin := mustLoad(t, "Europe/Berlin")
+    newYork := mustLoad(t, "America/New_York")
+    // Wednesday 2024-03-13 15:30 UTC
+    now := time.Date(2024, 3, 13, 15, 30, 0, 0, time.UTC)
+    
+    tests := []struct {
+        name       string
+        query      string
+        loc        *time.Location
+        wantPeriod Period
+        wantFrom   time.Time
+        wantTo     time.Time
+        wantZone   string
+    }{
+        {name: "default is monthly", query: "", wantPeriod: Monthly, wantFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), wantTo: now, wantZone: "UTC"},
+        {name: "daily", query: "period=daily", wantPeriod: Daily, wantFrom: time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC), wantTo: now, wantZone: "UTC"},
+        {name: "weekly starts on Monday", query: "period=weekly", wantPeriod: Weekly, wantFrom: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), wantTo: now, wantZone: "UTC"},
+        {name: "monthly", query: "period=monthly", wantPeriod: Monthly, wantFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), wantTo: now, wantZone: "UTC"},
+        {name: "all", query: "period=all", wantPeriod: All, wantZone: "UTC"},
+        {name: "daily in tz", query: "period=daily&tz=Europe/Berlin", wantPeriod: Daily, wantFrom: time.Date(2024, 3, 13, 0, 0, 0, 0, berlin), wantTo: now, wantZone: "Europe/Berlin"},
+        {name: "daily in tz behind UTC", query: "period=daily&tz=America/New_York", wantPeriod: Daily, wantFrom: time.Date(2024, 3, 13, 0, 0, 0, 0, newYork), wantTo: now, wantZone: "America/New_York"},
+        {name: "default location", query: "period=daily", loc: newYork, wantPeriod: Daily, wantFrom: time.Date(2024, 3, 13, 0, 0, 0, 0, newYork), wantTo: now, wantZone: "America/New_York"},
+        {name: "tz overrides default location", query: "period=daily&tz=UTC", loc: newYork, wantPeriod: Daily, wantFrom: time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC), wantTo: now, wantZone: "UTC"},
+        {name: "custom dates", query: "from=2024-01-01&to=2024-02-01", wantPeriod: Custom, wantFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), wantZone: "UTC"},
+        {name: "custom dates in tz", query: "from=2024-01-01&to=2024-02-01&tz=Europe/Berlin", wantPeriod: Custom, wantFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, berlin), wantTo: time.Date(2024, 2, 1, 0, 0, 0, 0, berlin), wantZone: "Europe/Berlin"},
+        {name: "custom timestamps", query: "from=2024-03-01T10:00:00%2B02:00&to=2024-03-02T10:00:00Z", wantPeriod: Custom, wantFrom: time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC), wantTo: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC), wantZone: "UTC"},
+        {name: "custom to defaults to now", query: "from=2024-03-01", wantPeriod: Custom, wantFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), wantTo: now, wantZone: "UTC"},
+        {name: "explicit custom", query: "period=custom&from=2024-03-01", wantPeriod: Custom, wantFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), wantTo: now, wantZone: "UTC"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            query, err := url.ParseQuery(tt.query)
+            if err != nil {
+                t.Fatalf("ParseQuery: %v", err)
+            }
+            
+            window, err := ParsePeriod(query, now, tt.loc)
+            if err != nil {
+                t.Fatalf("ParsePeriod() error = %v", err)
+            }
+            if window.Period != tt.wantPeriod {
+                t.Errorf("Period = %q, want %q", window.Period, tt.wantPeriod)
+            }
+            if !window.From.Equal(tt.wantFrom) || !window.To.Equal(tt.wantTo) {
+                t.Errorf("window = [%s, %s), want [%s, %s)", window.From, window.To, tt.wantFrom, tt.wantTo)
+            }
+            if window.Location.String() != tt.wantZone {
+                t.Errorf("Location = %s, want %s", window.Location, tt.wantZone)
+            }
+        })
+    }
+}
+
+func TestParsePeriod_errors(t *testing.T) {
+    now := time.Date(2024, 3, 13, 15, 30, 0, 0, time.UTC)
+    tests := []struct {
+        name      string
+        query     string
+        wantParam string
+    }{
+        {name: "unknown period", query: "period=yearly", wantParam: "period"},
+        {name: "preset with from", query: "period=daily&from=2024-01-01", wantParam: "period"},
+        {name: "preset with to", query: "period=all&to=2024-01-01", wantParam: "period"},
+        {name: "custom without from", query: "period=custom", wantParam: "from"},
+        {name: "to without from", query: "to=2024-01-01", wantParam: "from"},
+        {name: "malformed from", query: "from=01/02/2024", wantParam: "from"},
+        {name: "malformed to", query: "from=2024-01-01&to=tomorrow", wantParam: "to"},
+        {name: "to before from", query: "from=2024-02-01&to=2024-01-01", wantParam: "to"},
+        {name: "empty range", query: "from=2024-02-01&to=2024-02-01", wantParam: "to"},
+        {name: "from after now", query: "from=2025-01-01", wantParam: "to"},
+        {name: "unknown tz", query: "tz=Mars/Olympus", wantParam: "tz"},
+        {name: "host tz", query: "tz=Local", wantParam: "tz"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            query, err := url.ParseQuery(tt.query)
+            if err != nil {
+                t.Fatalf("ParseQuery: %v", err)
+            }
+            
+            _, err = ParsePeriod(query, now, nil)
+            var wErr *Error
+            if !errors.As(err, &wErr) {
+                t.Fatalf("ParsePeriod() error = %v, want *Error", err)
+            }
+            if wErr.Parameter != tt.wantParam {
+                t.Errorf("Parameter = %q, want %q (%v)", wErr.Parameter, tt.wantParam, wErr)
+            }
+        })
+    }
+}
+
+func TestPreset(t *testing.T) {
+    berlin := mustLoad(t, "Europe/Berlin")
+    tests := []struct {
+        name     string
+        period   Period
+        now      time.Time
+        wantFrom time.Time
+        wantOK   bool
+    }{
+        {name: "weekly on Monday", period: Weekly, now: time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC), wantFrom: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), wantOK: true},
+        {name: "weekly on Sunday", period: Weekly, now: time.Date(2024, 3, 17, 23, 0, 0, 0, time.UTC), wantFrom: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), wantOK: true},
+        {name: "weekly across a month", period: Weekly, now: time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), wantFrom: time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), wantOK: true},
+        {name: "weekly across a year", period: Weekly, now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), wantFrom: time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC), wantOK: true},
+        {name: "monthly on the first", period: Monthly, now: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), wantFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), wantOK: true},
+        {name: "daily after spring forward", period: Daily, now: time.Date(2024, 3, 31, 12, 0, 0, 0, berlin), wantFrom: time.Date(2024, 3, 31, 0, 0, 0, 0, berlin), wantOK: true},
+        {name: "weekly spanning fall back", period: Weekly, now: time.Date(2024, 10, 28, 12, 0, 0, 0, berlin), wantFrom: time.Date(2024, 10, 28, 0, 0, 0, 0, berlin), wantOK: true},
+        {name: "custom", period: Custom, now: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+        {name: "unknown", period: "hourly", now: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            window, ok := Preset(tt.period, tt.now)
+            if ok != tt.wantOK {
+                t.Fatalf("Preset() ok = %t, want %t", ok, tt.wantOK)
+            }
+            if !ok {
+                return
+            }
+            if !window.From.Equal(tt.wantFrom) || !window.To.Equal(tt.now) {
+                t.Errorf("window = [%s, %s), want [%s, %s)", window.From, window.To, tt.wantFrom, tt.now)
+            }
+            if window.Location != tt.now.Location() {
+                t.Errorf("Location = %s, want %s", window.Location, tt.now.Location())
+            }
+        })
+    }
+}
+
+func TestPreset_all(t *testing.T) {
+    window, ok := Preset(All, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+    if !ok || !window.Unbounded() {
+        t.Fatalf("Preset(All) = %+v, %t; want an unbounded window", window, ok)
+    }
+    if clause, args := window.WhereClause("created_at", 1); clause != "1=1" || args != nil {
+        t.Errorf("WhereClause() = %q, %v; want 1=1 without arguments", clause, args)
+    }
+}
+
+func TestWindow_Previous(t *testing.T) {
+    berlin := mustLoad(t, "Europe/Berlin")
+    tests := []struct {
+        name     string
+        period   Period
+        now      time.Time
+        wantFrom time.Time
+        wantTo   time.Time
+        wantLen  time.Duration
+    }{
+        {name: "daily", period: Daily, now: time.Date(2024, 3, 13, 15, 0, 0, 0, time.UTC), wantFrom: time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC), wantLen: 24 * time.Hour},
+        {name: "daily after spring forward", period: Daily, now: time.Date(2024, 4, 1, 9, 0, 0, 0, berlin), wantFrom: time.Date(2024, 3, 31, 0, 0, 0, 0, berlin), wantTo: time.Date(2024, 4, 1, 0, 0, 0, 0, berlin), wantLen: 23 * time.Hour},
+        {name: "daily after fall back", period: Daily, now: time.Date(2024, 10, 28, 9, 0, 0, 0, berlin), wantFrom: time.Date(2024, 10, 27, 0, 0, 0, 0, berlin), wantTo: time.Date(2024, 10, 28, 0, 0, 0, 0, berlin), wantLen: 25 * time.Hour},
+        {name: "weekly", period: Weekly, now: time.Date(2024, 3, 13, 15, 0, 0, 0, time.UTC), wantFrom: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), wantLen: 7 * 24 * time.Hour},
+        {name: "weekly spanning spring forward", period: Weekly, now: time.Date(2024, 4, 2, 9, 0, 0, 0, berlin), wantFrom: time.Date(2024, 3, 25, 0, 0, 0, 0, berlin), wantTo: time.Date(2024, 4, 1, 0, 0, 0, 0, berlin), wantLen: 7*24*time.Hour - time.Hour},
+        {name: "monthly", period: Monthly, now: time.Date(2024, 3, 13, 15, 0, 0, 0, time.UTC), wantFrom: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), wantLen: 29 * 24 * time.Hour},
+        {name: "monthly in January", period: Monthly, now: time.Date(2024, 1, 20, 15, 0, 0, 0, time.UTC), wantFrom: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), wantTo: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), wantLen: 31 * 24 * time.Hour},
+        {name: "monthly spanning fall back", period: Monthly, now: time.Date(2024, 11, 5, 9, 0, 0, 0, berlin), wantFrom: time.Date(2024, 10, 1, 0, 0, 0, 0, berlin), wantTo: time.Date(2024, 11, 1, 0, 0, 0, 0, berlin), wantLen: 31*24*time.Hour + time.Hour},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            window, ok := Preset(tt.period, tt.now)
+            if !ok {
+                t.Fatalf("Preset(%q) not ok", tt.period)
+            }
+            
+            previous := window.Previous()
+            if !previous.From.Equal(tt.wantFrom) || !previous.To.Equal(tt.wantTo) {
+                t.Errorf("Previous() = [%s, %s), want [%s, %s)", previous.From, previous.To, tt.wantFrom, tt.wantTo)
+            }
+            if got := previous.To.Sub(previous.From); got != tt.wantLen {
+                t.Errorf("Previous() spans %s, want %s", got, tt.wantLen)
+            }
+            if !previous.To.Equal(window.From) {
+                t.Errorf("Previous() ends at %s, want the window's start %s", previous.To, window.From)
+            }
+            if previous.Period != tt.period || previous.Location != window.Location {
+                t.Errorf("Previous() = %s in %s, want %s in %s", previous.Period, previous.Location, tt.period, window.Location)
+            }
+        })
+    }
+}
+
+func TestWindow_Previous_customAndAll(t *testing.T) {
+    custom := Window{Period: Custom, From: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC), Location: time.UTC}
+    previous := custom.Previous()
+    wantFrom := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+    if !previous.From.Equal(wantFrom) || !previous.To.Equal(custom.From) {
+        t.Errorf("custom Previous() = [%s, %s), want [%s, %s)", previous.From, previous.To, wantFrom, custom.From)
+    }
+    
+    all := Window{Period: All, Location: time.UTC}
+    if got := all.Previous(); got != all {
+        t.Errorf("all Previous() = %+v, want the window itself", got)
+    }
+}
+
+func TestStartOfDay(t *testing.T) {
+    berlin := mustLoad(t, "Europe/Berlin")
+    saoPaulo := mustLoad(t, "America/Sao_Paulo")
+    havana := mustLoad(t, "America/Havana")
+    tests := []struct {
+        name  string
+        year  int
+        month time.Month
+        day   int
+        loc   *time.Location
+        want  time.Time
+    }{
+        {name: "UTC", year: 2024, month: 3, day: 13, loc: time.UTC, want: time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)},
+        {name: "normalizes day zero", year: 2024, month: 3, day: 0, loc: time.UTC, want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+        {name: "normalizes month thirteen", year: 2024, month: 13, day: 1, loc: time.UTC, want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+        {name: "spring forward at 2am", year: 2024, month: 3, day: 31, loc: berlin, want: time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC)},
+        {name: "fall back at 3am", year: 2024, month: 10, day: 27, loc: berlin, want: time.Date(2024, 10, 26, 22, 0, 0, 0, time.UTC)},
+        // Clocks went from 00:00 to 01:00, so the day started at 01:00 -02
+        {name: "midnight skipped in Sao Paulo", year: 2018, month: 11, day: 4, loc: saoPaulo, want: time.Date(2018, 11, 4, 3, 0, 0, 0, time.UTC)},
+        {name: "midnight skipped in Havana", year: 2024, month: 3, day: 10, loc: havana, want: time.Date(2024, 3, 10, 5, 0, 0, 0, time.UTC)},
+        // Clocks went from 00:00 back to 23:00 the day before, so the day
+        // started at the second midnight, -03
+        {name: "fall back at midnight in Sao Paulo", year: 2019, month: 2, day: 17, loc: saoPaulo, want: time.Date(2019, 2, 17, 3, 0, 0, 0, time.UTC)},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := StartOfDay(tt.year, tt.month, tt.day, tt.loc)
+            if !got.Equal(tt.want) {
+                t.Errorf("StartOfDay() = %s, want %s", got.UTC(), tt.want)
+            }
+            if got.Location() != tt.loc {
+                t.Errorf("StartOfDay() location = %s, want %s", got.Location(), tt.loc)
+            }
+            // No earlier instant falls on the same local day
+            if before := got.Add(-time.Second).In(tt.loc); before.Day() == got.Day() {
+                t.Errorf("%s is still on the day starting at %s", before, got)
+            }
+        })
+    }
+}
+
+func TestWindow_Key(t *testing.T) {
+    berlin := mustLoad(t, "Europe/Berlin")
+    tests := []struct {
+        name   string
+        window Window
+        want   string
+    }{
+        {name: "preset", window: Window{Period: Daily, From: time.Date(2024, 3, 13, 0, 0, 0, 0, berlin), To: time.Now(), Location: berlin}, want: "daily@Europe/Berlin"},
+        {name: "no location", window: Window{Period: All}, want: "all@UTC"},
+        {name: "custom", window: Window{Period: Custom, From: time.Date(2024, 1, 1, 0, 0, 0, 0, berlin), To: time.Date(2024, 2, 1, 0, 0, 0, 0, berlin), Location: berlin}, want: "custom@2023-12-31T23:00:00Z:2024-01-31T23:00:00Z"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.window.Key(); got != tt.want {
+                t.Errorf("Key() = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
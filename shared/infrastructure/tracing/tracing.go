@@ -0,0 +1,45 @@
+// Package tracing carries W3C trace context across the asynchronous hops of
+// the system: from a command into the outbox, and from the bus into the
+// consumer. Spans are created through the global OpenTelemetry provider, so
+// they are no-ops until a service installs one.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceparentHeader is the W3C trace context header name, used both on
+// HTTP requests and on bus messages.
+const TraceparentHeader = "traceparent"
+
+var propagator = propagation.TraceContext{}
+
+// Traceparent encodes the span context carried by ctx, or returns "" when
+// ctx carries none.
+func Traceparent(ctx context.Context) string {
+    carrier := propagation.MapCarrier{}
+    propagator.Inject(ctx, carrier)
+    return carrier.Get(TraceparentHeader)
+}
+
+// ContextWithTraceparent returns ctx carrying the remote span context encoded
+// in traceparent. Empty or malformed values leave ctx unchanged.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+    if traceparent == "" {
+        return ctx
+    }
+    return propagator.Extract(ctx, propagation.MapCarrier{TraceparentHeader: traceparent})
+}
+
+// LinkTo returns a link to the span encoded in traceparent, or false when it
+// does not decode to a valid span context.
+func LinkTo(traceparent string) (trace.Link, bool) {
+    sc := trace.SpanContextFromContext(ContextWithTraceparent(context.Background(), traceparent))
+    if !sc.IsValid() {
+        return trace.Link{}, false
+    }
+    return trace.Link{SpanContext: sc}, true
+}
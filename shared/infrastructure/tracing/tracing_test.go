@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTraceparent_roundTrip(t *testing.T) {
+    tests := []struct {
+        name        string
+        traceparent string
+        want        string
+        wantLink    bool
+    }{
+        {name: "sampled", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantLink: true},
+        {name: "not sampled", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", want: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", wantLink: true},
+        {name: "empty", traceparent: ""},
+        {name: "malformed", traceparent: "not-a-traceparent"},
+        {name: "zero trace id", traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := ContextWithTraceparent(context.Background(), tt.traceparent)
+            if got := Traceparent(ctx); got != tt.want {
+                t.Errorf("Traceparent() = %q, want %q", got, tt.want)
+            }
+            if _, ok := LinkTo(tt.traceparent); ok != tt.wantLink {
+                t.Errorf("LinkTo() = %t, want %t", ok, tt.wantLink)
+            }
+        })
+    }
+}
@@ -0,0 +1,541 @@
+// Package projections holds the order projection, shared by the reporting
+// service's event consumer and the management service's synchronous
+// projection mode.
+package projections
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/ratelog"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// ErrUnhandledEvent is returned by a strict OrderProjectionHandler for
+// events of types it does not apply, wrapped with events.ErrInvalidEvent so
+// the consumer dead letters them.
+var ErrUnhandledEvent = errors.New("event not handled by the order projection")
+
+// unhandledStats is published as the "projection_unhandled_events" expvar:
+// events the order projection received but does not apply, by type. The
+// consumers skip such events before they reach it, so anything but zero
+// means EventTypes is out of step with Handle.
+var unhandledStats = expvar.NewMap("projection_unhandled_events")
+
+// unhandledLog warns about each unhandled event type once a minute.
+var unhandledLog = ratelog.New(time.Minute)
+
+// OrderProjectionHandler keeps the order read model and order history up to
+// date. Customer summaries and status durations have projections of their
+// own in the reporting service.
+//
+// Every event may be handled more than once, as when a consumer sees an
+// event the synchronous projection already applied: creations are inserted
+// once, and status changes to the current status and other changes whose
+// sequence the order's version has reached are skipped.
+type OrderProjectionHandler struct {
+    OrderReadModel   readmodels.OrderReadModel
+    HistoryReadModel readmodels.OrderHistoryReadModel
+    // Strict fails events the projection does not apply with
+    // ErrUnhandledEvent instead of skipping them
+    Strict           bool
+    // StrictFunc, when set, reports Strict for each event instead, so it
+    // can be switched while the projection runs
+    StrictFunc       func() bool
+}
+
+func (h *OrderProjectionHandler) Handle(ctx context.Context, event events.DomainEvent) error {
+    // Reject malformed payloads before they touch the read model
+    if err := validateItemPayload(event); err != nil {
+        return err
+    }
+    
+    var err error
+    switch e := event.(type) {
+    case events.OrderCreatedEvent:
+        err = h.handleOrderCreated(ctx, e)
+    case events.OrderConfirmedEvent:
+        err = h.handleOrderConfirmed(ctx, e)
+    case events.OrderShippedEvent:
+        err = h.handleOrderShipped(ctx, e)
+    case events.OrderDeliveredEvent:
+        err = h.handleOrderDelivered(ctx, e)
+    case events.OrderCancelledEvent:
+        err = h.handleOrderCancelled(ctx, e)
+    case events.OrderReopenedEvent:
+        err = h.handleOrderReopened(ctx, e)
+    case events.OrderHeldEvent:
+        err = h.applyStatusChange(ctx, e, "on_hold")
+    case events.OrderReleasedEvent:
+        err = h.applyStatusChange(ctx, e, "confirmed")
+    case events.OrderItemAddedEvent:
+        err = h.handleOrderItemAdded(ctx, e)
+    case events.OrderItemRemovedEvent:
+        err = h.handleOrderItemRemoved(ctx, e)
+    case events.OrderItemQuantityChangedEvent:
+        err = h.handleOrderItemQuantityChanged(ctx, e)
+    case events.OrderShippingAddressChangedEvent:
+        err = h.handleOrderShippingAddressChanged(ctx, e)
+    case events.OrderCustomerReassignedEvent:
+        err = h.handleOrderCustomerReassigned(ctx, e)
+    case events.OrderStatusChangedEvent:
+        // Published alongside the specific status event, which is applied
+        return nil
+    default:
+        return h.unhandled(event)
+    }
+    
+    if err != nil {
+        return err
+    }
+    
+    return h.recordHistory(ctx, event)
+}
+
+// unhandled counts an event the projection does not apply and, unless the
+// handler is strict, skips it with a rate limited warning.
+func (h *OrderProjectionHandler) unhandled(event events.DomainEvent) error {
+    unhandledStats.Add(event.Type(), 1)
+    if h.strict() {
+        return fmt.Errorf("%w: %w: %s for order %s", events.ErrInvalidEvent, ErrUnhandledEvent, event.Type(), event.AggregateID())
+    }
+    unhandledLog.Printf(event.Type(), "Order projection skipping unhandled event type %q (%T)", event.Type(), event)
+    return nil
+}
+
+func (h *OrderProjectionHandler) strict() bool {
+    if h.StrictFunc != nil {
+        return h.StrictFunc()
+    }
+    return h.Strict
+}
+
+// EventTypes lists the events Handle applies, for consumers to skip the
+// others without decoding them. Keep it in step with Handle.
+func (h *OrderProjectionHandler) EventTypes() []string {
+    return []string{
+        "OrderCreated",
+        "OrderConfirmed",
+        "OrderShipped",
+        "OrderDelivered",
+        "OrderCancelled",
+        "OrderReopened",
+        "OrderHeld",
+        "OrderReleased",
+        "OrderItemAdded",
+        "OrderItemRemoved",
+        "OrderItemQuantityChanged",
+        "OrderShippingAddressChanged",
+        "OrderCustomerReassigned",
+    }
+}
+
+// validateItemPayload checks the item data carried by order events. Errors
+// wrap events.ErrInvalidEvent so the consumer dead-letters the message
+// instead of retrying it.
+func validateItemPayload(event events.DomainEvent) error {
+    switch e := event.(type) {
+    case events.OrderCreatedEvent:
+        for i, item := range e.Items {
+            if err := validateItem(item.ProductID, item.Quantity, item.Price); err != nil {
+                return fmt.Errorf("%w: %s for order %s has invalid item at index %d: %v", events.ErrInvalidEvent, e.Type(), e.AggregateID(), i, err)
+            }
+        }
+    case events.OrderItemAddedEvent:
+        if err := validateItem(e.ProductID, e.Quantity, e.Price); err != nil {
+            return fmt.Errorf("%w: %s for order %s: %v", events.ErrInvalidEvent, e.Type(), e.AggregateID(), err)
+        }
+    case events.OrderItemRemovedEvent:
+        if e.ProductID == "" {
+            return fmt.Errorf("%w: %s for order %s: product_id is required", events.ErrInvalidEvent, e.Type(), e.AggregateID())
+        }
+    case events.OrderItemQuantityChangedEvent:
+        if e.ProductID == "" {
+            return fmt.Errorf("%w: %s for order %s: product_id is required", events.ErrInvalidEvent, e.Type(), e.AggregateID())
+        }
+        if e.Quantity <= 0 {
+            return fmt.Errorf("%w: %s for order %s: quantity must be greater than zero", events.ErrInvalidEvent, e.Type(), e.AggregateID())
+        }
+    case events.OrderShippingAddressChangedEvent:
+        if err := e.ShippingAddress.Validate(); err != nil {
+            return fmt.Errorf("%w: %s for order %s: invalid shipping address: %v", events.ErrInvalidEvent, e.Type(), e.AggregateID(), err)
+        }
+    }
+    return nil
+}
+
+func validateItem(productID string, quantity int, price valueobjects.Money) error {
+    if productID == "" {
+        return errors.New("product_id is required")
+    }
+    
+    if quantity <= 0 {
+        return errors.New("quantity must be greater than zero")
+    }
+    
+    if price.IsNegative() {
+        return errors.New("price cannot be negative")
+    }
+    
+    if err := price.Validate(); err != nil {
+        return fmt.Errorf("invalid price: %w", err)
+    }
+    
+    return nil
+}
+
+// recordHistory adds an entry for event to the order's history.
+func (h *OrderProjectionHandler) recordHistory(ctx context.Context, event events.DomainEvent) error {
+    if h.HistoryReadModel == nil {
+        return nil
+    }
+    
+    entry := &readmodels.OrderHistoryEntryDTO{
+        OrderID:    event.AggregateID(),
+        EventType:  event.Type(),
+        Sequence:   event.Sequence(),
+        Details:    historyDetails(event),
+        OccurredAt: apijson.NewTimestamp(event.OccurredAt()),
+    }
+    
+    return h.HistoryReadModel.AddEntry(ctx, entry)
+}
+
+func historyDetails(event events.DomainEvent) string {
+    switch e := event.(type) {
+    case events.OrderCancelledEvent:
+        details := "reason: " + e.Reason.String()
+        if e.Details != "" {
+            details += " (" + e.Details + ")"
+        }
+        if e.Forced {
+            details += ", forced by admin"
+        }
+        return details
+    case events.OrderDeliveredEvent:
+        if e.SignedBy != "" {
+            return "signed by " + e.SignedBy
+        }
+        return ""
+    case events.OrderReopenedEvent:
+        return "reopened after cancellation in draft"
+    case events.OrderHeldEvent:
+        return "held: " + e.Reason
+    case events.OrderReleasedEvent:
+        details := "released from hold"
+        if e.HoldReason != "" {
+            details += " (held: " + e.HoldReason + ")"
+        }
+        if e.Reason != "" {
+            details += ", reason: " + e.Reason
+        }
+        return details
+    case events.OrderItemAddedEvent:
+        return fmt.Sprintf("added %d x %s at %s", e.Quantity, e.ProductID, e.Price.String())
+    case events.OrderItemRemovedEvent:
+        return "removed " + e.ProductID
+    case events.OrderItemQuantityChangedEvent:
+        return fmt.Sprintf("changed quantity of %s to %d", e.ProductID, e.Quantity)
+    case events.OrderShippingAddressChangedEvent:
+        return "shipping address changed to " + e.ShippingAddress.String()
+    case events.OrderCustomerReassignedEvent:
+        return fmt.Sprintf("moved from customer %s to %s in a merge", e.PreviousCustomerID, e.CustomerID)
+    default:
+        return ""
+    }
+}
+
+func (h *OrderProjectionHandler) handleOrderCreated(ctx context.Context, event events.OrderCreatedEvent) error {
+    return h.OrderReadModel.InsertOrder(ctx, newOrder(event))
+}
+
+// newOrder returns the order event creates.
+func newOrder(event events.OrderCreatedEvent) *readmodels.OrderDTO {
+    // Convert items
+    items := make([]readmodels.OrderItemDTO, len(event.Items))
+    for i, item := range event.Items {
+        items[i] = readmodels.OrderItemDTO{
+            ProductID: item.ProductID,
+            Quantity:  item.Quantity,
+            Price:     item.Price,
+        }
+    }
+    
+    order := &readmodels.OrderDTO{
+        ID:              event.AggregateID(),
+        OrderNumber:     event.OrderNumber,
+        CustomerID:      event.CustomerID,
+        ContactEmail:    event.ContactEmail.String(),
+        Status:          "draft",
+        TotalAmount:     event.TotalAmount,
+        ShippingCost:    event.ShippingCost,
+        GrandTotal:      event.GrandTotal,
+        ShippingAddress: event.ShippingAddress,
+        Channel:         event.Channel.String(),
+        Items:           items,
+        Version:         1,
+        StatusChangedAt: apijson.NewTimestamp(event.OccurredAt()),
+        CreatedAt:       apijson.NewTimestamp(event.OccurredAt()),
+        UpdatedAt:       apijson.NewTimestamp(event.OccurredAt()),
+        Meta:            &readmodels.OrderMetaDTO{LastEventType: event.Type()},
+    }
+    
+    // Events from before shipping existed carry no grand total
+    if order.GrandTotal.Currency == "" {
+        order.GrandTotal = order.TotalAmount
+    }
+    if order.Channel == "" {
+        order.Channel = valueobjects.OrderChannelUnknown.String()
+    }
+    return order
+}
+
+// handleOrderConfirmed also records the order's grand total in the
+// confirmed order value histogram, once per order confirmation.
+func (h *OrderProjectionHandler) handleOrderConfirmed(ctx context.Context, event events.OrderConfirmedEvent) error {
+    order, changed, err := h.changeStatus(ctx, event, readmodels.StatusChange{Status: "confirmed"})
+    if err != nil || !changed {
+        return err
+    }
+    observeConfirmedOrder(order.GrandTotal.Currency, order.GrandTotal.Amount)
+    return nil
+}
+
+func (h *OrderProjectionHandler) handleOrderShipped(ctx context.Context, event events.OrderShippedEvent) error {
+    return h.applyStatusChange(ctx, event, "shipped")
+}
+
+func (h *OrderProjectionHandler) handleOrderDelivered(ctx context.Context, event events.OrderDeliveredEvent) error {
+    _, _, err := h.changeStatus(ctx, event, readmodels.StatusChange{Status: "delivered", Delivery: newDelivery(event)})
+    return err
+}
+
+// newDelivery returns the delivery details of event, leaving null those
+// that events from before they were recorded lack.
+func newDelivery(event events.OrderDeliveredEvent) *readmodels.DeliveryDTO {
+    delivery := &readmodels.DeliveryDTO{}
+    if !event.DeliveredAt.IsZero() {
+        deliveredAt := apijson.NewTimestamp(event.DeliveredAt)
+        delivery.DeliveredAt = &deliveredAt
+    }
+    if event.SignedBy != "" {
+        signedBy := event.SignedBy
+        delivery.SignedBy = &signedBy
+    }
+    if event.CarrierReference != "" {
+        carrierReference := event.CarrierReference
+        delivery.CarrierReference = &carrierReference
+    }
+    return delivery
+}
+
+func (h *OrderProjectionHandler) handleOrderCancelled(ctx context.Context, event events.OrderCancelledEvent) error {
+    _, _, err := h.changeStatus(ctx, event, readmodels.StatusChange{Status: "cancelled", Cancellation: newCancellation(event)})
+    return err
+}
+
+// newCancellation returns why event cancelled the order. Events from before
+// reasons were enumerated decode with reason other.
+func newCancellation(event events.OrderCancelledEvent) *readmodels.CancellationDTO {
+    cancellation := &readmodels.CancellationDTO{Reason: event.Reason.String(), Forced: event.Forced}
+    if event.Details != "" {
+        details := event.Details
+        cancellation.Details = &details
+    }
+    return cancellation
+}
+
+func (h *OrderProjectionHandler) handleOrderReopened(ctx context.Context, event events.OrderReopenedEvent) error {
+    return h.applyStatusChange(ctx, event, "draft")
+}
+
+// applyStatusChange moves the order to newStatus.
+func (h *OrderProjectionHandler) applyStatusChange(ctx context.Context, event events.DomainEvent, newStatus string) error {
+    _, _, err := h.changeStatus(ctx, event, readmodels.StatusChange{Status: newStatus})
+    return err
+}
+
+// changeStatus writes change, whose Status and details the caller sets,
+// returning the order as it was read and whether it changed.
+func (h *OrderProjectionHandler) changeStatus(ctx context.Context, event events.DomainEvent, change readmodels.StatusChange) (*readmodels.OrderDTO, bool, error) {
+    // Get existing order
+    order, err := h.OrderReadModel.GetOrder(ctx, event.AggregateID())
+    if err != nil {
+        return nil, false, err
+    }
+    
+    // Redelivered event, the status change is already projected. Orders
+    // can return to an earlier status, as when released from hold, so the
+    // sequence is checked too
+    if order.Status == change.Status || applied(order, event) {
+        return order, false, nil
+    }
+    
+    change.ChangedAt = event.OccurredAt()
+    change.Version = order.Version + 1
+    change.EventType = event.Type()
+    err = h.OrderReadModel.SetStatus(ctx, order.ID, change)
+    return order, err == nil, err
+}
+
+func (h *OrderProjectionHandler) handleOrderItemAdded(ctx context.Context, event events.OrderItemAddedEvent) error {
+    // Get existing order
+    order, err := h.OrderReadModel.GetOrder(ctx, event.AggregateID())
+    if err != nil {
+        return err
+    }
+    if applied(order, event) {
+        return nil
+    }
+    
+    changeItems(order, event)
+    return h.setItems(ctx, order, event)
+}
+
+// applied reports whether the order already reflects event. Each projected
+// event raises the order's version by one from the creation's 1, in step
+// with the aggregate's event sequence; events stored before sequences were
+// stamped carry none and are always applied.
+func applied(order *readmodels.OrderDTO, event events.DomainEvent) bool {
+    return event.Sequence() > 0 && event.Sequence() <= order.Version
+}
+
+// setItems writes the order's items and totals after an item event.
+func (h *OrderProjectionHandler) setItems(ctx context.Context, order *readmodels.OrderDTO, event events.DomainEvent) error {
+    return h.OrderReadModel.SetItemsAndTotal(ctx, order.ID, readmodels.ItemsChange{
+        Items:        order.Items,
+        TotalAmount:  order.TotalAmount,
+        ShippingCost: order.ShippingCost,
+        GrandTotal:   order.GrandTotal,
+        UpdatedAt:    event.OccurredAt(),
+        Version:      order.Version + 1,
+        EventType:    event.Type(),
+    })
+}
+
+// changeItems applies an item event to the order's items and totals.
+func changeItems(order *readmodels.OrderDTO, event events.DomainEvent) {
+    switch e := event.(type) {
+    case events.OrderItemAddedEvent:
+        order.Items = append(order.Items, readmodels.OrderItemDTO{
+            ProductID: e.ProductID,
+            Quantity:  e.Quantity,
+            Price:     e.Price,
+        })
+        recalculateTotals(order, e.ShippingCost)
+    case events.OrderItemRemovedEvent:
+        for i, item := range order.Items {
+            if item.ProductID == e.ProductID {
+                order.Items = append(order.Items[:i], order.Items[i+1:]...)
+                break
+            }
+        }
+        recalculateTotals(order, e.ShippingCost)
+    case events.OrderItemQuantityChangedEvent:
+        // Change the first line of the product, as the aggregate does
+        for i, item := range order.Items {
+            if item.ProductID == e.ProductID {
+                order.Items[i].Quantity = e.Quantity
+                break
+            }
+        }
+        recalculateTotals(order, e.ShippingCost)
+    }
+}
+
+// recalculateTotals sums the order's items and applies the shipping cost the
+// command side priced for the change. Events from before shipping existed
+// carry no shipping currency and keep the order's current shipping cost.
+func recalculateTotals(order *readmodels.OrderDTO, shippingCost valueobjects.Money) {
+    total := int64(0)
+    for _, item := range order.Items {
+        total += item.Price.Amount * int64(item.Quantity)
+    }
+    order.TotalAmount.Amount = total
+    // Totals are in the items' currency, as on the aggregate
+    if len(order.Items) > 0 {
+        order.TotalAmount.Currency = order.Items[0].Price.Currency
+    }
+    
+    if shippingCost.Currency != "" {
+        order.ShippingCost = shippingCost
+    }
+    order.GrandTotal = valueobjects.Money{
+        Amount:   total + order.ShippingCost.Amount,
+        Currency: order.TotalAmount.Currency,
+    }
+}
+
+func (h *OrderProjectionHandler) handleOrderItemRemoved(ctx context.Context, event events.OrderItemRemovedEvent) error {
+    // Get existing order
+    order, err := h.OrderReadModel.GetOrder(ctx, event.AggregateID())
+    if err != nil {
+        return err
+    }
+    if applied(order, event) {
+        return nil
+    }
+    
+    changeItems(order, event)
+    return h.setItems(ctx, order, event)
+}
+
+func (h *OrderProjectionHandler) handleOrderItemQuantityChanged(ctx context.Context, event events.OrderItemQuantityChangedEvent) error {
+    // Get existing order
+    order, err := h.OrderReadModel.GetOrder(ctx, event.AggregateID())
+    if err != nil {
+        return err
+    }
+    if applied(order, event) {
+        return nil
+    }
+    
+    changeItems(order, event)
+    return h.setItems(ctx, order, event)
+}
+
+func (h *OrderProjectionHandler) handleOrderShippingAddressChanged(ctx context.Context, event events.OrderShippingAddressChangedEvent) error {
+    // Get existing order
+    order, err := h.OrderReadModel.GetOrder(ctx, event.AggregateID())
+    if err != nil {
+        return err
+    }
+    if applied(order, event) {
+        return nil
+    }
+    
+    return h.OrderReadModel.SetShippingAddress(ctx, order.ID, readmodels.ShippingAddressChange{
+        ShippingAddress: event.ShippingAddress,
+        ShippingCost:    event.ShippingCost,
+        GrandTotal:      event.GrandTotal,
+        UpdatedAt:       event.OccurredAt(),
+        Version:         order.Version + 1,
+        EventType:       event.Type(),
+    })
+}
+
+func (h *OrderProjectionHandler) handleOrderCustomerReassigned(ctx context.Context, event events.OrderCustomerReassignedEvent) error {
+    order, err := h.OrderReadModel.GetOrder(ctx, event.AggregateID())
+    if err != nil {
+        return err
+    }
+    // Like a status change, a move to the order's customer was applied
+    // whatever its sequence
+    if applied(order, event) || order.CustomerID == event.CustomerID {
+        return nil
+    }
+    
+    return h.OrderReadModel.SetCustomer(ctx, order.ID, readmodels.CustomerChange{
+        CustomerID:         event.CustomerID,
+        PreviousCustomerID: event.PreviousCustomerID,
+        UpdatedAt:          event.OccurredAt(),
+        Version:            order.Version + 1,
+        EventType:          event.Type(),
+    })
+}
@@ -0,0 +1,196 @@
+package projections
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// HandleBatch applies batch as Handle would applying each event in turn,
+// but reads and writes each order once: the orders the events belong to
+// are read with one GetOrders, each order's events are applied to it in
+// memory in batch order, and each order they change is written with one
+// ApplyOrder. History entries are then recorded for every event, as Handle
+// records them.
+//
+// Nothing is written when an event is malformed or cannot be applied, such
+// as a change to an order neither stored nor created earlier in the batch;
+// the error is returned as Handle would return it, as is a strict
+// handler's ErrUnhandledEvent, and callers wanting to isolate the event can
+// fall back to Handle. A write finding its order
+// moved on by another writer returns readmodels.ErrStaleVersion after the
+// orders before it were written; retrying the batch skips what was
+// applied.
+func (h *OrderProjectionHandler) HandleBatch(ctx context.Context, batch []events.DomainEvent) error {
+    // Reject malformed payloads before they touch the read model
+    var applicable []events.DomainEvent
+    for _, event := range batch {
+        if err := validateItemPayload(event); err != nil {
+            return err
+        }
+        if handled(event) {
+            applicable = append(applicable, event)
+            continue
+        }
+        // Status changed events are published alongside the specific
+        // status event, which is applied
+        if _, ok := event.(events.OrderStatusChangedEvent); !ok {
+            if err := h.unhandled(event); err != nil {
+                return err
+            }
+        }
+    }
+    if len(applicable) == 0 {
+        return nil
+    }
+    
+    // Orders are kept in the order of their first event, so they are
+    // written in batch order
+    var orderIDs []string
+    byOrder := map[string][]events.DomainEvent{}
+    for _, event := range applicable {
+        orderID := event.AggregateID()
+        if _, ok := byOrder[orderID]; !ok {
+            orderIDs = append(orderIDs, orderID)
+        }
+        byOrder[orderID] = append(byOrder[orderID], event)
+    }
+    
+    orders, err := h.OrderReadModel.GetOrders(ctx, orderIDs)
+    if err != nil {
+        return err
+    }
+    
+    var changed []*readmodels.OrderDTO
+    var confirmed []valueobjects.Money
+    var previousCustomers []string
+    for _, orderID := range orderIDs {
+        order, orderChanged := orders[orderID], false
+        for _, event := range byOrder[orderID] {
+            next, eventChanged, err := applyEvent(order, event)
+            if err != nil {
+                return err
+            }
+            if !eventChanged {
+                continue
+            }
+            order, orderChanged = next, true
+            order.Meta = &readmodels.OrderMetaDTO{LastEventType: event.Type()}
+            if _, ok := event.(events.OrderConfirmedEvent); ok {
+                confirmed = append(confirmed, order.GrandTotal)
+            }
+            if reassigned, ok := event.(events.OrderCustomerReassignedEvent); ok {
+                previousCustomers = append(previousCustomers, reassigned.PreviousCustomerID)
+            }
+        }
+        if orderChanged {
+            changed = append(changed, order)
+        }
+    }
+    
+    for _, order := range changed {
+        if err := h.OrderReadModel.ApplyOrder(ctx, order); err != nil {
+            return fmt.Errorf("failed to apply batch to order %s: %w", order.ID, err)
+        }
+    }
+    // ApplyOrder refreshes the cached orders of the customer an order is
+    // written with, not of the one it moved from
+    for _, customerID := range previousCustomers {
+        if err := h.OrderReadModel.CacheCustomerOrders(ctx, customerID); err != nil {
+            return err
+        }
+    }
+    for _, total := range confirmed {
+        observeConfirmedOrder(total.Currency, total.Amount)
+    }
+    
+    for _, event := range applicable {
+        if err := h.recordHistory(ctx, event); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// applyEvent applies event to order, which is nil when it does not exist
+// yet, returning the order and whether the event changed it. Redelivered
+// events are skipped as Handle skips them.
+func applyEvent(order *readmodels.OrderDTO, event events.DomainEvent) (*readmodels.OrderDTO, bool, error) {
+    if created, ok := event.(events.OrderCreatedEvent); ok {
+        if order != nil {
+            return order, false, nil
+        }
+        return newOrder(created), true, nil
+    }
+    if order == nil {
+        return nil, false, fmt.Errorf("%s for order %s: %w", event.Type(), event.AggregateID(), readmodels.ErrOrderNotFound)
+    }
+    
+    occurredAt := apijson.NewTimestamp(event.OccurredAt())
+    if status, ok := events.StatusAfter(event); ok {
+        // Redelivered event, the status change is already projected
+        if order.Status == string(status) || applied(order, event) {
+            return order, false, nil
+        }
+        order.Status = string(status)
+        order.StatusChangedAt = occurredAt
+        order.UpdatedAt = occurredAt
+        order.Version++
+        if delivered, ok := event.(events.OrderDeliveredEvent); ok {
+            order.Delivery = newDelivery(delivered)
+        }
+        // As SetStatus, only a cancelled order keeps its cancellation
+        order.Cancellation = nil
+        if cancelled, ok := event.(events.OrderCancelledEvent); ok {
+            order.Cancellation = newCancellation(cancelled)
+        }
+        return order, true, nil
+    }
+    
+    if applied(order, event) {
+        return order, false, nil
+    }
+    if reassigned, ok := event.(events.OrderCustomerReassignedEvent); ok && order.CustomerID == reassigned.CustomerID {
+        return order, false, nil
+    }
+    switch e := event.(type) {
+    case events.OrderShippingAddressChangedEvent:
+        order.ShippingAddress = e.ShippingAddress
+        order.ShippingCost = e.ShippingCost
+        order.GrandTotal = e.GrandTotal
+    case events.OrderCustomerReassignedEvent:
+        order.CustomerID = e.CustomerID
+    default:
+        changeItems(order, event)
+    }
+    order.UpdatedAt = occurredAt
+    order.Version++
+    return order, true, nil
+}
+
+// handled reports whether Handle applies event and records it in the
+// history. Keep it in step with Handle.
+func handled(event events.DomainEvent) bool {
+    switch event.(type) {
+    case events.OrderCreatedEvent,
+        events.OrderConfirmedEvent,
+        events.OrderShippedEvent,
+        events.OrderDeliveredEvent,
+        events.OrderCancelledEvent,
+        events.OrderReopenedEvent,
+        events.OrderHeldEvent,
+        events.OrderReleasedEvent,
+        events.OrderItemAddedEvent,
+        events.OrderItemRemovedEvent,
+        events.OrderItemQuantityChangedEvent,
+        events.OrderShippingAddressChangedEvent,
+        events.OrderCustomerReassignedEvent:
+        return true
+    default:
+        return false
+    }
+}
@@ -0,0 +1,402 @@
+package projections
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+func (m *memoryOrderReadModel) InsertOrder(_ context.Context, order *readmodels.OrderDTO) error {
+    m.orders[order.ID] = *order
+    return nil
+}
+
+func (m *memoryOrderReadModel) GetOrders(ctx context.Context, orderIDs []string) (map[string]*readmodels.OrderDTO, error) {
+    orders := map[string]*readmodels.OrderDTO{}
+    for _, orderID := range orderIDs {
+        if order, err := m.GetOrder(ctx, orderID); err == nil {
+            orders[orderID] = order
+        }
+    }
+    return orders, nil
+}
+
+func (m *memoryOrderReadModel) ApplyOrder(_ context.Context, order *readmodels.OrderDTO) error {
+    if stored, ok := m.orders[order.ID]; ok && stored.Version >= order.Version {
+        return readmodels.ErrStaleVersion
+    }
+    m.orders[order.ID] = *order
+    return nil
+}
+
+// countingReadModel counts the read model calls the projection makes.
+type countingReadModel struct {
+    *memoryOrderReadModel
+    calls map[string]int
+}
+
+func newCountingReadModel() *countingReadModel {
+    return &countingReadModel{
+        memoryOrderReadModel: &memoryOrderReadModel{orders: map[string]readmodels.OrderDTO{}},
+        calls:                map[string]int{},
+    }
+}
+
+func (c *countingReadModel) GetOrder(ctx context.Context, orderID string) (*readmodels.OrderDTO, error) {
+    c.calls["GetOrder"]++
+    return c.memoryOrderReadModel.GetOrder(ctx, orderID)
+}
+
+func (c *countingReadModel) GetOrders(ctx context.Context, orderIDs []string) (map[string]*readmodels.OrderDTO, error) {
+    c.calls["GetOrders"]++
+    return c.memoryOrderReadModel.GetOrders(ctx, orderIDs)
+}
+
+func (c *countingReadModel) InsertOrder(ctx context.Context, order *readmodels.OrderDTO) error {
+    c.calls["InsertOrder"]++
+    return c.memoryOrderReadModel.InsertOrder(ctx, order)
+}
+
+func (c *countingReadModel) SetStatus(ctx context.Context, orderID string, change readmodels.StatusChange) error {
+    c.calls["SetStatus"]++
+    return c.memoryOrderReadModel.SetStatus(ctx, orderID, change)
+}
+
+func (c *countingReadModel) SetItemsAndTotal(ctx context.Context, orderID string, change readmodels.ItemsChange) error {
+    c.calls["SetItemsAndTotal"]++
+    return c.memoryOrderReadModel.SetItemsAndTotal(ctx, orderID, change)
+}
+
+func (c *countingReadModel) ApplyOrder(ctx context.Context, order *readmodels.OrderDTO) error {
+    c.calls["ApplyOrder"]++
+    return c.memoryOrderReadModel.ApplyOrder(ctx, order)
+}
+
+func (c *countingReadModel) total() int {
+    total := 0
+    for _, n := range c.calls {
+        total += n
+    }
+    return total
+}
+
+// recordingHistory keeps the event types of the history entries added.
+type recordingHistory struct {
+    readmodels.OrderHistoryReadModel
+    entries []string
+}
+
+func (r *recordingHistory) AddEntry(_ context.Context, entry *readmodels.OrderHistoryEntryDTO) error {
+    r.entries = append(r.entries, fmt.Sprintf("%s %s #%d", entry.OrderID, entry.EventType, entry.Sequence))
+    return nil
+}
+
+// placedOrder returns the events of an order created with two units at
+// 10.00 USD, confirmed and given a third unit of another product.
+func placedOrder(orderID string) []events.DomainEvent {
+    usd := func(amount int64) valueobjects.Money { return valueobjects.NewMoney(amount, "USD") }
+    occurredAt := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+    base := func(eventType string, sequence int) events.BaseDomainEvent {
+        return events.BaseDomainEvent{
+            EventIDValue:     fmt.Sprintf("%s-%d", orderID, sequence),
+            EventType:        eventType,
+            AggregateIDValue: orderID,
+            OccurredAtTime:   occurredAt.Add(time.Duration(sequence) * time.Minute),
+            SequenceValue:    sequence,
+        }
+    }
+    return []events.DomainEvent{
+        events.OrderCreatedEvent{
+            BaseDomainEvent: base("OrderCreated", 1),
+            CustomerID:      "customer-1",
+            Items:           []events.OrderItemData{{ProductID: "product-1", Quantity: 2, Price: usd(1000)}},
+            TotalAmount:     usd(2000),
+            ShippingCost:    usd(500),
+            GrandTotal:      usd(2500),
+            ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+        },
+        events.OrderConfirmedEvent{BaseDomainEvent: base("OrderConfirmed", 2), CustomerID: "customer-1"},
+        events.OrderItemAddedEvent{BaseDomainEvent: base("OrderItemAdded", 3), ProductID: "product-2", Quantity: 1, Price: usd(1500), ShippingCost: usd(500), GrandTotal: usd(4000)},
+    }
+}
+
+// projected returns what both paths write of order; the in-memory
+// per-event writes leave out timestamps and metadata.
+func projected(order readmodels.OrderDTO) readmodels.OrderDTO {
+    return readmodels.OrderDTO{
+        ID:           order.ID,
+        CustomerID:   order.CustomerID,
+        Status:       order.Status,
+        Items:        order.Items,
+        TotalAmount:  order.TotalAmount,
+        ShippingCost: order.ShippingCost,
+        GrandTotal:   order.GrandTotal,
+        Version:      order.Version,
+    }
+}
+
+// A batch creating, confirming and adding to an order projects the row the
+// events projected one by one do, with one read and one write, and records
+// the same history; redelivered, it writes nothing.
+func TestOrderProjectionHandler_HandleBatch(t *testing.T) {
+    ctx := context.Background()
+    batch := placedOrder("order-1")
+    
+    single, singleHistory := newCountingReadModel(), &recordingHistory{}
+    handler := &OrderProjectionHandler{OrderReadModel: single, HistoryReadModel: singleHistory}
+    for _, event := range batch {
+        if err := handler.Handle(ctx, event); err != nil {
+            t.Fatalf("Handle(%s) = %v", event.Type(), err)
+        }
+    }
+    
+    batched, batchedHistory := newCountingReadModel(), &recordingHistory{}
+    handler = &OrderProjectionHandler{OrderReadModel: batched, HistoryReadModel: batchedHistory}
+    if err := handler.HandleBatch(ctx, batch); err != nil {
+        t.Fatalf("HandleBatch() = %v", err)
+    }
+    
+    usd := func(amount int64) valueobjects.Money { return valueobjects.NewMoney(amount, "USD") }
+    want := readmodels.OrderDTO{
+        ID:         "order-1",
+        CustomerID: "customer-1",
+        Status:     "confirmed",
+        Items: []readmodels.OrderItemDTO{
+            {ProductID: "product-1", Quantity: 2, Price: usd(1000)},
+            {ProductID: "product-2", Quantity: 1, Price: usd(1500)},
+        },
+        TotalAmount:  usd(3500),
+        ShippingCost: usd(500),
+        GrandTotal:   usd(4000),
+        Version:      3,
+    }
+    if got := projected(batched.orders["order-1"]); !reflect.DeepEqual(got, want) {
+        t.Errorf("HandleBatch() projected %+v, want %+v", got, want)
+    }
+    if got := projected(single.orders["order-1"]); !reflect.DeepEqual(got, want) {
+        t.Errorf("Handle() projected %+v, want %+v", got, want)
+    }
+    
+    stored := batched.orders["order-1"]
+    if stored.Meta == nil || stored.Meta.LastEventType != "OrderItemAdded" {
+        t.Errorf("HandleBatch() meta = %+v, want the item added last", stored.Meta)
+    }
+    if stored.StatusChangedAt != apijson.NewTimestamp(batch[1].OccurredAt()) || stored.UpdatedAt != apijson.NewTimestamp(batch[2].OccurredAt()) {
+        t.Errorf("HandleBatch() status changed at %v and updated at %v, want the confirmation and the item added", stored.StatusChangedAt, stored.UpdatedAt)
+    }
+    
+    wantCalls := map[string]int{"GetOrders": 1, "ApplyOrder": 1}
+    if !reflect.DeepEqual(batched.calls, wantCalls) {
+        t.Errorf("HandleBatch() calls = %v, want %v", batched.calls, wantCalls)
+    }
+    if single.total() != 5 {
+        t.Errorf("Handle() made %d calls, want 5: %v", single.total(), single.calls)
+    }
+    if !reflect.DeepEqual(batchedHistory.entries, singleHistory.entries) || len(batchedHistory.entries) != 3 {
+        t.Errorf("HandleBatch() history = %v, want %v", batchedHistory.entries, singleHistory.entries)
+    }
+    
+    // Redelivered, the batch reads the order and finds nothing to write
+    if err := handler.HandleBatch(ctx, batch); err != nil {
+        t.Fatalf("HandleBatch() of a redelivery = %v", err)
+    }
+    if batched.calls["ApplyOrder"] != 1 || !reflect.DeepEqual(batched.orders["order-1"], stored) {
+        t.Errorf("HandleBatch() of a redelivery wrote %d times, want once in all", batched.calls["ApplyOrder"])
+    }
+}
+
+// Batches spanning orders read them together and write each once, in the
+// order of their first event.
+func TestOrderProjectionHandler_HandleBatch_orders(t *testing.T) {
+    var batch []events.DomainEvent
+    first, second := placedOrder("order-1"), placedOrder("order-2")
+    for i := range first {
+        batch = append(batch, first[i], second[i])
+    }
+    rm := newCountingReadModel()
+    
+    if err := (&OrderProjectionHandler{OrderReadModel: rm}).HandleBatch(context.Background(), batch); err != nil {
+        t.Fatalf("HandleBatch() = %v", err)
+    }
+    if rm.calls["GetOrders"] != 1 || rm.calls["ApplyOrder"] != 2 || rm.total() != 3 {
+        t.Errorf("HandleBatch() calls = %v, want one GetOrders and two ApplyOrder", rm.calls)
+    }
+    for _, orderID := range []string{"order-1", "order-2"} {
+        if order := rm.orders[orderID]; order.Status != "confirmed" || order.Version != 3 {
+            t.Errorf("%s is %s at version %d, want confirmed at 3", orderID, order.Status, order.Version)
+        }
+    }
+}
+
+// racingReadModel has another writer move order-1 on to moved right after
+// the batch reads it.
+type racingReadModel struct {
+    *countingReadModel
+    moved readmodels.OrderDTO
+}
+
+func (r *racingReadModel) GetOrders(ctx context.Context, orderIDs []string) (map[string]*readmodels.OrderDTO, error) {
+    orders, err := r.countingReadModel.GetOrders(ctx, orderIDs)
+    r.orders[r.moved.ID] = r.moved
+    return orders, err
+}
+
+// Nothing is written when an event of the batch cannot be applied, and the
+// error is the one Handle returns; an order another writer moved on is
+// left as that writer left it.
+func TestOrderProjectionHandler_HandleBatch_errors(t *testing.T) {
+    placed := placedOrder("order-1")
+    
+    tests := []struct {
+        name    string
+        batch   []events.DomainEvent
+        wantErr error
+    }{
+        {
+            name:    "change to a missing order",
+            batch:   []events.DomainEvent{placed[0], placedOrder("order-2")[2]},
+            wantErr: readmodels.ErrOrderNotFound,
+        },
+        {
+            name:    "invalid payload",
+            batch:   []events.DomainEvent{placed[0], events.OrderItemAddedEvent{BaseDomainEvent: baseEvent("OrderItemAdded"), Quantity: 1}},
+            wantErr: events.ErrInvalidEvent,
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            rm := newCountingReadModel()
+            if err := (&OrderProjectionHandler{OrderReadModel: rm}).HandleBatch(context.Background(), tt.batch); !errors.Is(err, tt.wantErr) {
+                t.Fatalf("HandleBatch() = %v, want %v", err, tt.wantErr)
+            }
+            if rm.calls["ApplyOrder"] != 0 || len(rm.orders) != 0 {
+                t.Errorf("HandleBatch() wrote %v, want nothing", rm.orders)
+            }
+        })
+    }
+    
+    t.Run("order moved on by another writer", func(t *testing.T) {
+        moved := readmodels.OrderDTO{ID: "order-1", Status: "cancelled", Version: 5}
+        rm := &racingReadModel{countingReadModel: newCountingReadModel(), moved: moved}
+        rm.orders["order-1"] = readmodels.OrderDTO{ID: "order-1", Status: "draft", Version: 1}
+        
+        if err := (&OrderProjectionHandler{OrderReadModel: rm}).HandleBatch(context.Background(), placed[1:]); !errors.Is(err, readmodels.ErrStaleVersion) {
+            t.Fatalf("HandleBatch() = %v, want ErrStaleVersion", err)
+        }
+        if got := rm.orders["order-1"]; !reflect.DeepEqual(got, moved) {
+            t.Errorf("HandleBatch() rolled order-1 back to %+v", got)
+        }
+    })
+}
+
+func unhandledStat(name string) int64 {
+    if v, ok := unhandledStats.Get(name).(*expvar.Int); ok {
+        return v.Value()
+    }
+    return 0
+}
+
+// Events the projection does not apply are counted by type. A lenient
+// handler skips them, projecting the rest of a batch; a strict one fails
+// them for the dead letter queue, and fails a batch holding one before
+// writing anything.
+func TestOrderProjectionHandler_unhandled(t *testing.T) {
+    ctx := context.Background()
+    unknown := events.NewCustomerFirstOrderEvent("customer-1", "order-1")
+    tests := []struct {
+        name   string
+        strict bool
+    }{
+        {name: "lenient"},
+        {name: "strict", strict: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            counted := unhandledStat(unknown.Type())
+            
+            handler := &OrderProjectionHandler{OrderReadModel: &untouchedReadModel{}, Strict: tt.strict}
+            err := handler.Handle(ctx, unknown)
+            
+            rm := newCountingReadModel()
+            handler = &OrderProjectionHandler{OrderReadModel: rm, HistoryReadModel: &recordingHistory{}, Strict: tt.strict}
+            batchErr := handler.HandleBatch(ctx, append(placedOrder("order-1"), unknown))
+            
+            if tt.strict {
+                for _, err := range []error{err, batchErr} {
+                    if !errors.Is(err, events.ErrInvalidEvent) || !errors.Is(err, ErrUnhandledEvent) {
+                        t.Errorf("error = %v, want ErrUnhandledEvent as an invalid event", err)
+                    }
+                }
+                if rm.total() != 0 {
+                    t.Errorf("read model calls = %v, want none", rm.calls)
+                }
+            } else {
+                if err != nil || batchErr != nil {
+                    t.Errorf("Handle() = %v, HandleBatch() = %v, want nil", err, batchErr)
+                }
+                if _, ok := rm.orders["order-1"]; !ok {
+                    t.Error("order-1 not projected, want the rest of the batch applied")
+                }
+            }
+            if got := unhandledStat(unknown.Type()) - counted; got != 2 {
+                t.Errorf("%s counted %d times, want 2", unknown.Type(), got)
+            }
+        })
+    }
+}
+
+// BenchmarkOrderProjectionHandler compares projecting a batch of orders'
+// events with HandleBatch against one Handle per event. The read model is
+// in memory, so ns/op is the projection's own work; read model calls per
+// batch stand for the database round trips each makes.
+func BenchmarkOrderProjectionHandler(b *testing.B) {
+    var batch []events.DomainEvent
+    for i := 0; i < 50; i++ {
+        batch = append(batch, placedOrder(fmt.Sprintf("order-%d", i))...)
+    }
+    ctx := context.Background()
+    
+    for _, bm := range []struct {
+        name    string
+        project func(*OrderProjectionHandler) error
+    }{
+        {
+            name: "Handle",
+            project: func(h *OrderProjectionHandler) error {
+                for _, event := range batch {
+                    if err := h.Handle(ctx, event); err != nil {
+                        return err
+                    }
+                }
+                return nil
+            },
+        },
+        {
+            name:    "HandleBatch",
+            project: func(h *OrderProjectionHandler) error { return h.HandleBatch(ctx, batch) },
+        },
+    } {
+        b.Run(bm.name, func(b *testing.B) {
+            calls := 0
+            for i := 0; i < b.N; i++ {
+                rm := newCountingReadModel()
+                if err := bm.project(&OrderProjectionHandler{OrderReadModel: rm, HistoryReadModel: &recordingHistory{}}); err != nil {
+                    b.Fatal(err)
+                }
+                calls += rm.total()
+            }
+            b.ReportMetric(float64(calls)/float64(b.N), "calls/op")
+        })
+    }
+}
@@ -0,0 +1,397 @@
+package projections
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// untouchedReadModel fails the test on any read or write: its embedded
+// read models are nil, so every call panics.
+type untouchedReadModel struct {
+    readmodels.OrderReadModel
+}
+
+// memoryOrderReadModel keeps orders in memory, implementing the reads and
+// writes of the status, item and address events.
+type memoryOrderReadModel struct {
+    readmodels.OrderReadModel
+    orders map[string]readmodels.OrderDTO
+}
+
+func (m *memoryOrderReadModel) GetOrder(_ context.Context, orderID string) (*readmodels.OrderDTO, error) {
+    order, ok := m.orders[orderID]
+    if !ok {
+        return nil, readmodels.ErrOrderNotFound
+    }
+    order.Items = append([]readmodels.OrderItemDTO(nil), order.Items...)
+    return &order, nil
+}
+
+func (m *memoryOrderReadModel) SetItemsAndTotal(_ context.Context, orderID string, change readmodels.ItemsChange) error {
+    order := m.orders[orderID]
+    order.Items, order.TotalAmount, order.ShippingCost, order.GrandTotal = change.Items, change.TotalAmount, change.ShippingCost, change.GrandTotal
+    order.Version = change.Version
+    m.orders[orderID] = order
+    return nil
+}
+
+func (m *memoryOrderReadModel) SetStatus(_ context.Context, orderID string, change readmodels.StatusChange) error {
+    order := m.orders[orderID]
+    order.Status, order.Version = change.Status, change.Version
+    if change.Delivery != nil {
+        order.Delivery = change.Delivery
+    }
+    // Only a cancelled order keeps its cancellation
+    if change.Status != "cancelled" {
+        order.Cancellation = nil
+    } else if change.Cancellation != nil {
+        order.Cancellation = change.Cancellation
+    }
+    m.orders[orderID] = order
+    return nil
+}
+
+func (m *memoryOrderReadModel) SetShippingAddress(_ context.Context, orderID string, change readmodels.ShippingAddressChange) error {
+    order := m.orders[orderID]
+    order.ShippingAddress, order.ShippingCost, order.GrandTotal = change.ShippingAddress, change.ShippingCost, change.GrandTotal
+    order.Version = change.Version
+    m.orders[orderID] = order
+    return nil
+}
+
+func baseEvent(eventType string) events.BaseDomainEvent {
+    return events.BaseDomainEvent{EventIDValue: "event-1", EventType: eventType, AggregateIDValue: "order-1"}
+}
+
+// Events carrying invalid item data are rejected for the dead letter queue
+// before the read model is read or written.
+func TestOrderProjectionHandler_Handle_invalidItemPayload(t *testing.T) {
+    usd := func(amount int64) valueobjects.Money { return valueobjects.NewMoney(amount, "USD") }
+    tests := []struct {
+        name  string
+        event events.DomainEvent
+    }{
+        {
+            name:  "item added without currency",
+            event: events.OrderItemAddedEvent{BaseDomainEvent: baseEvent("OrderItemAdded"), ProductID: "product-1", Quantity: 1, Price: valueobjects.Money{Amount: 1000}},
+        },
+        {
+            name:  "item added with a negative quantity",
+            event: events.OrderItemAddedEvent{BaseDomainEvent: baseEvent("OrderItemAdded"), ProductID: "product-1", Quantity: -1, Price: usd(1000)},
+        },
+        {
+            name:  "item added without product",
+            event: events.OrderItemAddedEvent{BaseDomainEvent: baseEvent("OrderItemAdded"), Quantity: 1, Price: usd(1000)},
+        },
+        {
+            name:  "item added at a negative price",
+            event: events.OrderItemAddedEvent{BaseDomainEvent: baseEvent("OrderItemAdded"), ProductID: "product-1", Quantity: 1, Price: usd(-1000)},
+        },
+        {
+            name:  "item added with a malformed currency",
+            event: events.OrderItemAddedEvent{BaseDomainEvent: baseEvent("OrderItemAdded"), ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "US")},
+        },
+        {
+            name: "created with an invalid item",
+            event: events.OrderCreatedEvent{BaseDomainEvent: baseEvent("OrderCreated"), Items: []events.OrderItemData{
+                {ProductID: "product-1", Quantity: 1, Price: usd(1000)},
+                {ProductID: "product-2", Quantity: 0, Price: usd(1000)},
+            }},
+        },
+        {
+            name:  "item removed without product",
+            event: events.OrderItemRemovedEvent{BaseDomainEvent: baseEvent("OrderItemRemoved")},
+        },
+        {
+            name:  "quantity changed to zero",
+            event: events.OrderItemQuantityChangedEvent{BaseDomainEvent: baseEvent("OrderItemQuantityChanged"), ProductID: "product-1"},
+        },
+        {
+            name:  "shipping address changed to an invalid address",
+            event: events.OrderShippingAddressChangedEvent{BaseDomainEvent: baseEvent("OrderShippingAddressChanged")},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            handler := &OrderProjectionHandler{OrderReadModel: untouchedReadModel{}}
+            defer func() {
+                if r := recover(); r != nil {
+                    t.Errorf("Handle() touched the read model: %v", r)
+                }
+            }()
+            
+            if err := handler.Handle(context.Background(), tt.event); !errors.Is(err, events.ErrInvalidEvent) {
+                t.Errorf("Handle() = %v, want ErrInvalidEvent", err)
+            }
+        })
+    }
+}
+
+// Quantity and address changes of a patched order are applied once, in
+// sequence, with the totals they carry.
+func TestOrderProjectionHandler_Handle_patchEvents(t *testing.T) {
+    usd := func(amount int64) valueobjects.Money { return valueobjects.NewMoney(amount, "USD") }
+    sequenced := func(eventType string, sequence int) events.BaseDomainEvent {
+        base := baseEvent(eventType)
+        base.SequenceValue = sequence
+        return base
+    }
+    chicago := valueobjects.NewAddress("1 Main St", "Chicago", "IL", "60601", "US")
+    
+    rm := &memoryOrderReadModel{orders: map[string]readmodels.OrderDTO{
+        "order-1": {
+            ID:              "order-1",
+            Items:           []readmodels.OrderItemDTO{{ProductID: "product-1", Quantity: 2, Price: usd(1000)}},
+            TotalAmount:     usd(2000),
+            ShippingCost:    usd(500),
+            GrandTotal:      usd(2500),
+            ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+            Version:         1,
+        },
+    }}
+    handler := &OrderProjectionHandler{OrderReadModel: rm}
+    
+    for _, event := range []events.DomainEvent{
+        events.OrderItemQuantityChangedEvent{BaseDomainEvent: sequenced("OrderItemQuantityChanged", 2), ProductID: "product-1", Quantity: 3, ShippingCost: usd(500), GrandTotal: usd(3500)},
+        events.OrderShippingAddressChangedEvent{BaseDomainEvent: sequenced("OrderShippingAddressChanged", 3), ShippingAddress: chicago, ShippingCost: usd(700), GrandTotal: usd(3700)},
+        // A redelivery changes nothing
+        events.OrderItemQuantityChangedEvent{BaseDomainEvent: sequenced("OrderItemQuantityChanged", 2), ProductID: "product-1", Quantity: 3, ShippingCost: usd(500), GrandTotal: usd(3500)},
+    } {
+        if err := handler.Handle(context.Background(), event); err != nil {
+            t.Fatalf("Handle(%s) = %v", event.Type(), err)
+        }
+    }
+    
+    want := readmodels.OrderDTO{
+        ID:              "order-1",
+        Items:           []readmodels.OrderItemDTO{{ProductID: "product-1", Quantity: 3, Price: usd(1000)}},
+        TotalAmount:     usd(3000),
+        ShippingCost:    usd(700),
+        GrandTotal:      usd(3700),
+        ShippingAddress: chicago,
+        Version:         3,
+    }
+    if got := rm.orders["order-1"]; !reflect.DeepEqual(got, want) {
+        t.Errorf("projected order = %+v, want %+v", got, want)
+    }
+}
+
+// Created orders keep their channel; those created before channels were
+// recorded are projected as unknown.
+func TestNewOrder_channel(t *testing.T) {
+    tests := []struct {
+        channel valueobjects.OrderChannel
+        want    string
+    }{
+        {channel: valueobjects.OrderChannelMobile, want: "mobile"},
+        {channel: "", want: "unknown"},
+    }
+    
+    for _, tt := range tests {
+        event := events.OrderCreatedEvent{BaseDomainEvent: baseEvent("OrderCreated"), Channel: tt.channel}
+        if got := newOrder(event).Channel; got != tt.want {
+            t.Errorf("newOrder() of a %q order has channel %q, want %q", tt.channel, got, tt.want)
+        }
+    }
+}
+
+// OrderStatusChanged accompanies the status event the projection applies,
+// so even a strict projection skips it without reading the read model.
+func TestOrderProjectionHandler_Handle_orderStatusChanged(t *testing.T) {
+    handler := &OrderProjectionHandler{OrderReadModel: untouchedReadModel{}, Strict: true}
+    event := events.OrderStatusChangedEvent{BaseDomainEvent: baseEvent("OrderStatusChanged"), FromStatus: "draft", ToStatus: "confirmed"}
+    if err := handler.Handle(context.Background(), event); err != nil {
+        t.Errorf("Handle(OrderStatusChanged) = %v, want it skipped", err)
+    }
+}
+
+// Delivery details are projected with the delivered status, per event and
+// in batches alike; events from before they were recorded project a
+// delivery whose details are null.
+func TestOrderProjectionHandler_delivery(t *testing.T) {
+    deliveredAt := time.Date(2024, 3, 15, 13, 30, 0, 0, time.UTC)
+    delivered := func(event events.OrderDeliveredEvent) events.OrderDeliveredEvent {
+        event.BaseDomainEvent = baseEvent("OrderDelivered")
+        event.SequenceValue = 4
+        return event
+    }
+    str := func(s string) *string { return &s }
+    at := apijson.NewTimestamp(deliveredAt)
+    
+    tests := []struct {
+        name  string
+        event events.OrderDeliveredEvent
+        want  readmodels.DeliveryDTO
+    }{
+        {
+            name:  "details",
+            event: delivered(events.OrderDeliveredEvent{DeliveredAt: deliveredAt, SignedBy: "J. Doe", CarrierReference: "POD-123"}),
+            want:  readmodels.DeliveryDTO{DeliveredAt: &at, SignedBy: str("J. Doe"), CarrierReference: str("POD-123")},
+        },
+        {
+            name:  "signed only",
+            event: delivered(events.OrderDeliveredEvent{DeliveredAt: deliveredAt, SignedBy: "J. Doe"}),
+            want:  readmodels.DeliveryDTO{DeliveredAt: &at, SignedBy: str("J. Doe")},
+        },
+        {
+            name:  "legacy",
+            event: delivered(events.OrderDeliveredEvent{}),
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for name, handle := range map[string]func(*OrderProjectionHandler, events.DomainEvent) error{
+                "Handle": func(h *OrderProjectionHandler, event events.DomainEvent) error {
+                    return h.Handle(context.Background(), event)
+                },
+                "HandleBatch": func(h *OrderProjectionHandler, event events.DomainEvent) error {
+                    return h.HandleBatch(context.Background(), []events.DomainEvent{event})
+                },
+            } {
+                rm := &memoryOrderReadModel{orders: map[string]readmodels.OrderDTO{
+                    "order-1": {ID: "order-1", Status: "shipped", Version: 3},
+                }}
+                if err := handle(&OrderProjectionHandler{OrderReadModel: rm}, tt.event); err != nil {
+                    t.Fatalf("%s() = %v", name, err)
+                }
+                got := rm.orders["order-1"]
+                if got.Status != "delivered" || got.Delivery == nil || !reflect.DeepEqual(*got.Delivery, tt.want) {
+                    t.Errorf("%s() projected %s with delivery %+v, want delivered with %+v", name, got.Status, got.Delivery, tt.want)
+                }
+            }
+        })
+    }
+}
+
+// A cancellation's reason, details and whether it was forced are projected
+// with the cancelled status, free text from before reasons were enumerated
+// as other, and cleared when the order is reopened.
+func TestOrderProjectionHandler_cancellation(t *testing.T) {
+    str := func(s string) *string { return &s }
+    reopened := events.OrderReopenedEvent{BaseDomainEvent: baseEvent("OrderReopened")}
+    reopened.SequenceValue = 3
+    
+    tests := []struct {
+        name        string
+        payload     string
+        want        readmodels.CancellationDTO
+        wantHistory string
+    }{
+        {
+            name:        "code",
+            payload:     `"reason": "fraud"`,
+            want:        readmodels.CancellationDTO{Reason: "fraud"},
+            wantHistory: "reason: fraud",
+        },
+        {
+            name:        "details, forced",
+            payload:     `"reason": "customer_request", "details": "found a better price", "forced": true`,
+            want:        readmodels.CancellationDTO{Reason: "customer_request", Details: str("found a better price"), Forced: true},
+            wantHistory: "reason: customer_request (found a better price), forced by admin",
+        },
+        {
+            name:        "legacy free text",
+            payload:     `"reason": "customer changed their mind"`,
+            want:        readmodels.CancellationDTO{Reason: "other", Details: str("customer changed their mind")},
+            wantHistory: "reason: other (customer changed their mind)",
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            data := `{"event_id": "event-1", "event_type": "OrderCancelled", "aggregate_id": "order-1", "occurred_at": "2024-03-15T12:00:00Z", "sequence": 2, "customer_id": "customer-1", ` + tt.payload + `}`
+            cancelled, err := events.DefaultRegistry().Unmarshal("OrderCancelled", []byte(data))
+            if err != nil {
+                t.Fatalf("Unmarshal() = %v", err)
+            }
+            if got := historyDetails(cancelled); got != tt.wantHistory {
+                t.Errorf("history details = %q, want %q", got, tt.wantHistory)
+            }
+            
+            for name, handle := range map[string]func(*OrderProjectionHandler, events.DomainEvent) error{
+                "Handle": func(h *OrderProjectionHandler, event events.DomainEvent) error {
+                    return h.Handle(context.Background(), event)
+                },
+                "HandleBatch": func(h *OrderProjectionHandler, event events.DomainEvent) error {
+                    return h.HandleBatch(context.Background(), []events.DomainEvent{event})
+                },
+            } {
+                rm := &memoryOrderReadModel{orders: map[string]readmodels.OrderDTO{
+                    "order-1": {ID: "order-1", Status: "draft", Version: 1},
+                }}
+                handler := &OrderProjectionHandler{OrderReadModel: rm}
+                if err := handle(handler, cancelled); err != nil {
+                    t.Fatalf("%s() = %v", name, err)
+                }
+                got := rm.orders["order-1"]
+                if got.Status != "cancelled" || got.Cancellation == nil || !reflect.DeepEqual(*got.Cancellation, tt.want) {
+                    t.Errorf("%s() projected %s with cancellation %+v, want cancelled with %+v", name, got.Status, got.Cancellation, tt.want)
+                }
+                
+                if err := handle(handler, reopened); err != nil {
+                    t.Fatalf("%s(reopened) = %v", name, err)
+                }
+                if got := rm.orders["order-1"]; got.Status != "draft" || got.Cancellation != nil {
+                    t.Errorf("%s() reopened to %s with cancellation %+v, want draft with none", name, got.Status, got.Cancellation)
+                }
+            }
+        })
+    }
+}
+
+// A hold and its release move the order to on_hold and back, and show in
+// the history with their reasons; a hold redelivered after the release is
+// skipped by its sequence although the order is back in the status it left.
+func TestOrderProjectionHandler_holdAndRelease(t *testing.T) {
+    held := events.OrderHeldEvent{BaseDomainEvent: baseEvent("OrderHeld"), Reason: "fraud review"}
+    held.SequenceValue = 3
+    released := events.OrderReleasedEvent{BaseDomainEvent: baseEvent("OrderReleased"), HoldReason: "fraud review", Reason: "cleared"}
+    released.SequenceValue = 4
+    
+    if got, want := historyDetails(held), "held: fraud review"; got != want {
+        t.Errorf("hold history details = %q, want %q", got, want)
+    }
+    if got, want := historyDetails(released), "released from hold (held: fraud review), reason: cleared"; got != want {
+        t.Errorf("release history details = %q, want %q", got, want)
+    }
+    
+    for name, handle := range map[string]func(*OrderProjectionHandler, events.DomainEvent) error{
+        "Handle": func(h *OrderProjectionHandler, event events.DomainEvent) error {
+            return h.Handle(context.Background(), event)
+        },
+        "HandleBatch": func(h *OrderProjectionHandler, event events.DomainEvent) error {
+            return h.HandleBatch(context.Background(), []events.DomainEvent{event})
+        },
+    } {
+        rm := &memoryOrderReadModel{orders: map[string]readmodels.OrderDTO{
+            "order-1": {ID: "order-1", Status: "confirmed", Version: 2},
+        }}
+        handler := &OrderProjectionHandler{OrderReadModel: rm}
+        for _, step := range []struct {
+            event       events.DomainEvent
+            wantStatus  string
+            wantVersion int
+        }{
+            {event: held, wantStatus: "on_hold", wantVersion: 3},
+            {event: released, wantStatus: "confirmed", wantVersion: 4},
+            {event: held, wantStatus: "confirmed", wantVersion: 4},
+        } {
+            if err := handle(handler, step.event); err != nil {
+                t.Fatalf("%s(%s) = %v", name, step.event.Type(), err)
+            }
+            if got := rm.orders["order-1"]; got.Status != step.wantStatus || got.Version != step.wantVersion {
+                t.Errorf("%s(%s #%d) left the order %s at version %d, want %s at %d", name, step.event.Type(), step.event.Sequence(), got.Status, got.Version, step.wantStatus, step.wantVersion)
+            }
+        }
+    }
+}
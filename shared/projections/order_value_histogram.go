@@ -0,0 +1,69 @@
+package projections
+
+import (
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// orderValueStats is published as the "confirmed_order_values" expvar: a
+// histogram of the grand totals of confirmed orders per currency, over the
+// bands of readmodels.DefaultOrderValueBuckets.
+var (
+    orderValueStats      = expvar.NewMap("confirmed_order_values")
+    orderValueHistograms sync.Map
+)
+
+// valueHistogram counts order values by band. Buckets are cumulative, as
+// Prometheus histograms are: le_5000 includes every order worth at most
+// 5000 minor units.
+type valueHistogram struct {
+    mu      sync.Mutex
+    count   int64
+    sum     int64
+    buckets []int64
+}
+
+// observeConfirmedOrder records the grand total of an order confirmed in
+// currency.
+func observeConfirmedOrder(currency string, grandTotal int64) {
+    h, ok := orderValueHistograms.Load(currency)
+    if !ok {
+        var loaded bool
+        h, loaded = orderValueHistograms.LoadOrStore(currency, &valueHistogram{
+            buckets: make([]int64, len(readmodels.DefaultOrderValueBuckets)+1),
+        })
+        if !loaded {
+            orderValueStats.Set(currency, h.(*valueHistogram))
+        }
+    }
+    h.(*valueHistogram).observe(grandTotal)
+}
+
+func (h *valueHistogram) observe(value int64) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    h.count++
+    h.sum += value
+    for i := readmodels.OrderValueBucket(readmodels.DefaultOrderValueBuckets, value); i < len(h.buckets); i++ {
+        h.buckets[i]++
+    }
+}
+
+// String renders the histogram as JSON for expvar.
+func (h *valueHistogram) String() string {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    var b strings.Builder
+    fmt.Fprintf(&b, `{"count": %d, "sum": %d`, h.count, h.sum)
+    for i, bound := range readmodels.DefaultOrderValueBuckets {
+        fmt.Fprintf(&b, `, "le_%d": %d`, bound, h.buckets[i])
+    }
+    fmt.Fprintf(&b, `, "le_inf": %d}`, h.buckets[len(readmodels.DefaultOrderValueBuckets)])
+    return b.String()
+}
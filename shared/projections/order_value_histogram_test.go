@@ -0,0 +1,73 @@
+package projections
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// confirmedOrderValues returns the confirmed order value histogram of
+// currency as published.
+func confirmedOrderValues(t *testing.T, currency string) map[string]int64 {
+    t.Helper()
+    histogram := orderValueStats.Get(currency)
+    if histogram == nil {
+        return nil
+    }
+    var values map[string]int64
+    if err := json.Unmarshal([]byte(histogram.String()), &values); err != nil {
+        t.Fatalf("decoding %s histogram %s: %v", currency, histogram, err)
+    }
+    return values
+}
+
+// Confirming an order records its grand total once in the cumulative
+// buckets at and above its band; a value on a bound counts in that bound's
+// bucket.
+func TestOrderProjectionHandler_Handle_confirmedOrderValues(t *testing.T) {
+    // No other test confirms orders in francs
+    const currency = "CHF"
+    rm := &memoryOrderReadModel{orders: map[string]readmodels.OrderDTO{
+        "order-1": {ID: "order-1", Status: "draft", GrandTotal: valueobjects.NewMoney(2500, currency), Version: 1},
+        "order-2": {ID: "order-2", Status: "draft", GrandTotal: valueobjects.NewMoney(200000, currency), Version: 1},
+    }}
+    handler := &OrderProjectionHandler{OrderReadModel: rm}
+    confirm := func(orderID string) events.DomainEvent {
+        base := baseEvent("OrderConfirmed")
+        base.AggregateIDValue, base.SequenceValue = orderID, 2
+        return events.OrderConfirmedEvent{BaseDomainEvent: base}
+    }
+    
+    // order-1's confirmation is redelivered
+    for _, event := range []events.DomainEvent{confirm("order-1"), confirm("order-1"), confirm("order-2")} {
+        if err := handler.Handle(context.Background(), event); err != nil {
+            t.Fatalf("Handle() = %v", err)
+        }
+    }
+    
+    want := map[string]int64{
+        "count":     2,
+        "sum":       202500,
+        "le_1000":   0,
+        "le_2500":   1,
+        "le_5000":   1,
+        "le_10000":  1,
+        "le_25000":  1,
+        "le_50000":  1,
+        "le_100000": 1,
+        "le_inf":    2,
+    }
+    got := confirmedOrderValues(t, currency)
+    for name, count := range want {
+        if got[name] != count {
+            t.Errorf("%s histogram %s = %d, want %d", currency, name, got[name], count)
+        }
+    }
+    if len(got) != len(want) {
+        t.Errorf("%s histogram = %v, want the fields %v", currency, got, want)
+    }
+}
@@ -0,0 +1,61 @@
+package readmodels
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+// CachedAnalyticsDTO is a copy of order analytics kept in the cache, with
+// the time it was computed.
+type CachedAnalyticsDTO struct {
+    Analytics *OrderAnalyticsDTO `json:"analytics"`
+    CachedAt  apijson.Timestamp  `json:"cached_at"`
+}
+
+// AnalyticsCache keeps the last order analytics computed for each window,
+// for CacheConfig.AnalyticsRetention, so they can still be served while
+// the database is unavailable. It is a fallback only: it is never read
+// while the database answers. A disabled cache keeps nothing.
+type AnalyticsCache struct {
+    cache *Cache
+}
+
+// NewAnalyticsCache keeps analytics in cache; a nil cache keeps nothing.
+func NewAnalyticsCache(cache *Cache) *AnalyticsCache {
+    return &AnalyticsCache{cache: orNoCache(cache)}
+}
+
+// key holds the window's Key, so a preset such as daily in a time zone is
+// one entry however its bounds move.
+func (c *AnalyticsCache) key(window timewindow.Window, includeShipping bool) string {
+    return c.cache.Key(cacheEntityOrderAnalytics, window.Key()+":"+strconv.FormatBool(includeShipping))
+}
+
+// Save keeps analytics, computed at computedAt, as the last known for
+// window, replacing the previous copy.
+func (c *AnalyticsCache) Save(ctx context.Context, window timewindow.Window, includeShipping bool, analytics *OrderAnalyticsDTO, computedAt time.Time) {
+    data, err := json.Marshal(CachedAnalyticsDTO{Analytics: analytics, CachedAt: apijson.NewTimestamp(computedAt)})
+    if err != nil {
+        return
+    }
+    c.cache.set(ctx, c.key(window, includeShipping), data, c.cache.cfg.AnalyticsRetention)
+}
+
+// Load returns the last analytics saved for window, reporting false when
+// there are none or the cache is unavailable too.
+func (c *AnalyticsCache) Load(ctx context.Context, window timewindow.Window, includeShipping bool) (*CachedAnalyticsDTO, bool) {
+    data, ok := c.cache.get(ctx, c.key(window, includeShipping))
+    if !ok {
+        return nil, false
+    }
+    var cached CachedAnalyticsDTO
+    if err := json.Unmarshal([]byte(data), &cached); err != nil || cached.Analytics == nil {
+        return nil, false
+    }
+    return &cached, true
+}
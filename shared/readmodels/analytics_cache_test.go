@@ -0,0 +1,72 @@
+package readmodels
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+// The last analytics saved for a window are loaded back, with the time they
+// were computed, until the retention runs out. A preset is one entry as
+// its bounds move; the revenue basis is part of the key.
+func TestAnalyticsCache(t *testing.T) {
+    ctx := context.Background()
+    client, server, _ := newCountingClient(t)
+    cache := NewAnalyticsCache(NewCache(client, CacheConfig{Namespace: "test", AnalyticsRetention: time.Hour}))
+    
+    computedAt := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+    daily, _ := timewindow.Preset(timewindow.Daily, computedAt)
+    weekly, _ := timewindow.Preset(timewindow.Weekly, computedAt)
+    analytics := &OrderAnalyticsDTO{TotalOrders: 3, TotalRevenue: 4500, OrdersByStatus: map[string]int64{"confirmed": 3}}
+    
+    if _, ok := cache.Load(ctx, daily, true); ok {
+        t.Fatal("Load() from an empty cache reported analytics")
+    }
+    cache.Save(ctx, daily, true, analytics, computedAt)
+    
+    later, _ := timewindow.Preset(timewindow.Daily, computedAt.Add(time.Hour))
+    cached, ok := cache.Load(ctx, later, true)
+    if !ok {
+        t.Fatal("Load() of the saved window reported none")
+    }
+    if !reflect.DeepEqual(cached.Analytics, analytics) || !cached.CachedAt.Time.Equal(computedAt) {
+        t.Errorf("Load() = %+v at %v, want %+v at %v", cached.Analytics, cached.CachedAt.Time, analytics, computedAt)
+    }
+    if _, ok := cache.Load(ctx, daily, false); ok {
+        t.Error("Load() without shipping returned the analytics saved with it")
+    }
+    if _, ok := cache.Load(ctx, weekly, true); ok {
+        t.Error("Load() of another window returned the daily analytics")
+    }
+    
+    // A copy that is not analytics is not served
+    server.Set("test:order_analytics:"+weekly.Key()+":true", "{}")
+    if _, ok := cache.Load(ctx, weekly, true); ok {
+        t.Error("Load() of an empty entry reported analytics")
+    }
+    
+    server.FastForward(time.Hour)
+    if _, ok := cache.Load(ctx, daily, true); ok {
+        t.Error("Load() after the retention reported analytics")
+    }
+}
+
+// A disabled cache keeps nothing, and sends nothing to Redis.
+func TestAnalyticsCache_disabled(t *testing.T) {
+    ctx := context.Background()
+    client, _, hook := newCountingClient(t)
+    window, _ := timewindow.Preset(timewindow.Daily, time.Now())
+    
+    for _, cache := range []*AnalyticsCache{NewAnalyticsCache(nil), NewAnalyticsCache(NewCache(client, CacheConfig{Disabled: true}))} {
+        cache.Save(ctx, window, true, &OrderAnalyticsDTO{TotalOrders: 1}, time.Now())
+        if _, ok := cache.Load(ctx, window, true); ok {
+            t.Error("Load() from a disabled cache reported analytics")
+        }
+    }
+    if n := hook.commands.Load(); n != 0 {
+        t.Errorf("disabled cache sent %d Redis commands", n)
+    }
+}
@@ -0,0 +1,172 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// AnomalyCancellationRate is the anomaly type of a cancellation rate above
+// its baseline.
+const AnomalyCancellationRate = "cancellation_rate"
+
+// AnomalyReadModel records anomalies detected in the order flow, such as
+// cancellation rate spikes. It reads the transitions recorded by the status
+// duration projection.
+type AnomalyReadModel interface {
+    // CountDecisions counts the orders cancelled and the orders confirmed
+    // in [from, to). Orders released from hold were confirmed before and
+    // are not counted again.
+    CountDecisions(ctx context.Context, from, to time.Time) (*DecisionCountsDTO, error)
+    // RecordAnomaly records anomaly unless another of its type was detected
+    // within cooldown before it, and calls save with the transaction
+    // recording it and its ID set, so events derived from it are saved
+    // with it. It reports whether the anomaly was recorded; concurrent
+    // evaluators are serialized so only one records it.
+    RecordAnomaly(ctx context.Context, anomaly *AnomalyDTO, cooldown time.Duration, save func(tx *sql.Tx, anomaly *AnomalyDTO) error) (bool, error)
+    // RecoverAnomalies marks the unrecovered anomalies of anomalyType as
+    // recovered at at, and returns how many it marked.
+    RecoverAnomalies(ctx context.Context, anomalyType string, at time.Time) (int64, error)
+}
+
+// DecisionCountsDTO counts the orders decided in a window: cancelled, or
+// confirmed. An order confirmed and then cancelled counts twice.
+type DecisionCountsDTO struct {
+    Cancellations int64
+    Confirmations int64
+}
+
+// Decisions is the number of orders cancelled or confirmed.
+func (c DecisionCountsDTO) Decisions() int64 {
+    return c.Cancellations + c.Confirmations
+}
+
+// CancellationRate is the share of decisions that were cancellations, zero
+// when there were none.
+func (c DecisionCountsDTO) CancellationRate() float64 {
+    if c.Decisions() == 0 {
+        return 0
+    }
+    return float64(c.Cancellations) / float64(c.Decisions())
+}
+
+// AnomalyDTO is a detected anomaly. RecoveredAt is set once an evaluation
+// found the measure back within its baseline.
+type AnomalyDTO struct {
+    ID          int64              `json:"id"`
+    AnomalyType string             `json:"anomaly_type"`
+    DetectedAt  apijson.Timestamp  `json:"detected_at"`
+    WindowStart apijson.Timestamp  `json:"window_start"`
+    WindowEnd   apijson.Timestamp  `json:"window_end"`
+    Value       float64            `json:"value"`
+    Baseline    float64            `json:"baseline"`
+    // Count and Total are what Value was measured over, such as the
+    // cancellations and decisions of a cancellation rate
+    Count       int64              `json:"count"`
+    Total       int64              `json:"total"`
+    RecoveredAt *apijson.Timestamp `json:"recovered_at,omitempty"`
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryCountDecisions   = "order_status_transitions.count_decisions"
+    queryLockAnomalyType  = "order_anomalies.lock"
+    queryLastAnomaly      = "order_anomalies.last"
+    queryRecordAnomaly    = "order_anomalies.record"
+    queryRecoverAnomalies = "order_anomalies.recover"
+)
+
+type anomalyReadModel struct {
+    db *sqlmetrics.DB
+}
+
+func NewAnomalyReadModel(db *sqlmetrics.DB) AnomalyReadModel {
+    return &anomalyReadModel{db: db}
+}
+
+func (rm *anomalyReadModel) CountDecisions(ctx context.Context, from, to time.Time) (*DecisionCountsDTO, error) {
+    query := `
+        SELECT
+            COUNT(*) FILTER (WHERE to_status = 'cancelled'),
+            COUNT(*) FILTER (WHERE to_status = 'confirmed' AND from_status <> 'on_hold')
+        FROM order_status_transitions
+        WHERE occurred_at >= $1 AND occurred_at < $2 AND to_status IN ('cancelled', 'confirmed')
+    `
+    
+    var counts DecisionCountsDTO
+    if err := rm.db.QueryRow(ctx, queryCountDecisions, query, from.UTC(), to.UTC()).Scan(&counts.Cancellations, &counts.Confirmations); err != nil {
+        return nil, fmt.Errorf("failed to count order decisions: %w", err)
+    }
+    return &counts, nil
+}
+
+// RecordAnomaly holds a transaction-scoped advisory lock on the anomaly
+// type, so evaluators running on several instances check the cooldown one
+// at a time.
+func (rm *anomalyReadModel) RecordAnomaly(ctx context.Context, anomaly *AnomalyDTO, cooldown time.Duration, save func(tx *sql.Tx, anomaly *AnomalyDTO) error) (bool, error) {
+    tx, err := rm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+    
+    query := `SELECT pg_advisory_xact_lock(hashtext('order_anomalies:' || $1))`
+    if _, err := tx.Exec(ctx, queryLockAnomalyType, query, anomaly.AnomalyType); err != nil {
+        return false, fmt.Errorf("failed to lock anomaly type: %w", err)
+    }
+    
+    detectedAt := anomaly.DetectedAt.Time
+    var last sql.NullTime
+    query = `SELECT MAX(detected_at) FROM order_anomalies WHERE anomaly_type = $1`
+    if err := tx.QueryRow(ctx, queryLastAnomaly, query, anomaly.AnomalyType).Scan(&last); err != nil {
+        return false, fmt.Errorf("failed to read last anomaly: %w", err)
+    }
+    if last.Valid && detectedAt.Sub(last.Time) < cooldown {
+        return false, nil
+    }
+    
+    query = `
+        INSERT INTO order_anomalies (anomaly_type, detected_at, window_start, window_end, value, baseline, count, total)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id
+    `
+    err = tx.QueryRow(ctx, queryRecordAnomaly, query,
+        anomaly.AnomalyType,
+        detectedAt.UTC(),
+        anomaly.WindowStart.Time.UTC(),
+        anomaly.WindowEnd.Time.UTC(),
+        anomaly.Value,
+        anomaly.Baseline,
+        anomaly.Count,
+        anomaly.Total,
+    ).Scan(&anomaly.ID)
+    if err != nil {
+        return false, fmt.Errorf("failed to record anomaly: %w", err)
+    }
+    
+    if err := save(tx.Unwrap(), anomaly); err != nil {
+        return false, err
+    }
+    if err := tx.Commit(); err != nil {
+        return false, fmt.Errorf("failed to commit anomaly: %w", err)
+    }
+    return true, nil
+}
+
+func (rm *anomalyReadModel) RecoverAnomalies(ctx context.Context, anomalyType string, at time.Time) (int64, error) {
+    query := `UPDATE order_anomalies SET recovered_at = $2 WHERE anomaly_type = $1 AND recovered_at IS NULL`
+    
+    result, err := rm.db.Exec(ctx, queryRecoverAnomalies, query, anomalyType, at.UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to recover anomalies: %w", err)
+    }
+    recovered, err := result.RowsAffected()
+    if err != nil {
+        return 0, fmt.Errorf("failed to get rows affected: %w", err)
+    }
+    return recovered, nil
+}
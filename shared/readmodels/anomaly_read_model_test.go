@@ -0,0 +1,126 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// Decisions are counted from the recorded transitions within the window,
+// leaving out confirmations on release from hold.
+func TestAnomalyReadModel_CountDecisions(t *testing.T) {
+    ctx := context.Background()
+    db := sqlmetrics.Wrap(schematest.Open(t), 0)
+    statuses := NewStatusDurationReadModel(db)
+    rm := NewAnomalyReadModel(db)
+    start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+    at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+    
+    type change struct {
+        status string
+        hours  int
+    }
+    track := func(changes ...change) {
+        t.Helper()
+        orderID := uuid.NewString()
+        if err := statuses.TrackOrder(ctx, orderID, "draft", start); err != nil {
+            t.Fatalf("TrackOrder() = %v", err)
+        }
+        for i, change := range changes {
+            if err := statuses.RecordStatusChange(ctx, orderID, change.status, i+2, at(change.hours)); err != nil {
+                t.Fatalf("RecordStatusChange(%s) = %v", change.status, err)
+            }
+        }
+    }
+    track(change{"confirmed", 1})
+    track(change{"confirmed", 2}, change{"on_hold", 3}, change{"confirmed", 4})
+    track(change{"confirmed", 2}, change{"cancelled", 5})
+    track(change{"cancelled", 3})
+    // Outside the window
+    track(change{"confirmed", 10})
+    
+    counts, err := rm.CountDecisions(ctx, at(1), at(10))
+    if err != nil {
+        t.Fatalf("CountDecisions() = %v", err)
+    }
+    if want := (DecisionCountsDTO{Cancellations: 2, Confirmations: 3}); *counts != want {
+        t.Errorf("CountDecisions() = %+v, want %+v", *counts, want)
+    }
+    if counts.CancellationRate() != 0.4 {
+        t.Errorf("CancellationRate() = %v, want 0.4", counts.CancellationRate())
+    }
+}
+
+// Anomalies within the cooldown of the last are not recorded; one whose
+// derived events fail to save is rolled back; recovering marks the open
+// ones once.
+func TestAnomalyReadModel_RecordAndRecover(t *testing.T) {
+    ctx := context.Background()
+    sqlDB := schematest.Open(t)
+    rm := NewAnomalyReadModel(sqlmetrics.Wrap(sqlDB, 0))
+    start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    anomalyAt := func(at time.Time) *AnomalyDTO {
+        return &AnomalyDTO{
+            AnomalyType: AnomalyCancellationRate,
+            DetectedAt:  apijson.NewTimestamp(at),
+            WindowStart: apijson.NewTimestamp(at.Add(-time.Hour)),
+            WindowEnd:   apijson.NewTimestamp(at),
+            Value:       0.4,
+            Baseline:    0.2,
+            Count:       6,
+            Total:       15,
+        }
+    }
+    var saved []int64
+    save := func(tx *sql.Tx, anomaly *AnomalyDTO) error {
+        if tx == nil {
+            return errors.New("no transaction")
+        }
+        saved = append(saved, anomaly.ID)
+        return nil
+    }
+    record := func(at time.Time, save func(*sql.Tx, *AnomalyDTO) error) (bool, error) {
+        return rm.RecordAnomaly(ctx, anomalyAt(at), 2*time.Hour, save)
+    }
+    countAnomalies := func() (total, open int) {
+        t.Helper()
+        if err := sqlDB.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(*) FILTER (WHERE recovered_at IS NULL) FROM order_anomalies`).Scan(&total, &open); err != nil {
+            t.Fatal(err)
+        }
+        return total, open
+    }
+    
+    if recorded, err := record(start, save); err != nil || !recorded {
+        t.Fatalf("RecordAnomaly() = %v, %v, want recorded", recorded, err)
+    }
+    if recorded, err := record(start.Add(time.Hour), save); err != nil || recorded {
+        t.Fatalf("RecordAnomaly() within the cooldown = %v, %v, want suppressed", recorded, err)
+    }
+    failing := errors.New("outbox down")
+    if _, err := record(start.Add(3*time.Hour), func(*sql.Tx, *AnomalyDTO) error { return failing }); !errors.Is(err, failing) {
+        t.Fatalf("RecordAnomaly() with a failing save = %v, want %v", err, failing)
+    }
+    if len(saved) != 1 || saved[0] == 0 {
+        t.Errorf("saved anomalies %v, want the first with its id", saved)
+    }
+    if total, open := countAnomalies(); total != 1 || open != 1 {
+        t.Errorf("stored %d anomalies, %d open, want the first alone", total, open)
+    }
+    
+    for _, want := range []int64{1, 0} {
+        if recovered, err := rm.RecoverAnomalies(ctx, AnomalyCancellationRate, start.Add(4*time.Hour)); err != nil || recovered != want {
+            t.Errorf("RecoverAnomalies() = %d, %v, want %d", recovered, err, want)
+        }
+    }
+    if total, open := countAnomalies(); total != 1 || open != 0 {
+        t.Errorf("stored %d anomalies, %d open, want it recovered", total, open)
+    }
+}
@@ -0,0 +1,114 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// BootstrapCheckpointStore records how far a projection bootstrap got, so
+// an interrupted one resumes and a finished one is not run again.
+type BootstrapCheckpointStore interface {
+    // GetCheckpoint returns the named bootstrap's checkpoint, nil if it
+    // never started.
+    GetCheckpoint(ctx context.Context, name string) (*BootstrapCheckpointDTO, error)
+    SaveCheckpoint(ctx context.Context, checkpoint *BootstrapCheckpointDTO) error
+}
+
+// BootstrapCheckpointDTO is a bootstrap's progress: the position of the
+// last event it applied and when that event was stored. CompletedAt is set
+// once it reached the end of its source.
+type BootstrapCheckpointDTO struct {
+    Name         string
+    Source       string
+    Position     int64
+    LastStoredAt time.Time
+    Applied      int64
+    StartedAt    time.Time
+    UpdatedAt    time.Time
+    CompletedAt  *time.Time
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryGetBootstrapCheckpoint  = "projection_bootstraps.get"
+    querySaveBootstrapCheckpoint = "projection_bootstraps.save"
+)
+
+type bootstrapCheckpointStore struct {
+    db *sqlmetrics.DB
+}
+
+func NewBootstrapCheckpointStore(db *sqlmetrics.DB) BootstrapCheckpointStore {
+    return &bootstrapCheckpointStore{db: db}
+}
+
+func (s *bootstrapCheckpointStore) GetCheckpoint(ctx context.Context, name string) (*BootstrapCheckpointDTO, error) {
+    query := `
+        SELECT name, source, position, last_stored_at, applied, started_at, updated_at, completed_at
+        FROM projection_bootstraps
+        WHERE name = $1
+    `
+    
+    var checkpoint BootstrapCheckpointDTO
+    var lastStoredAt, completedAt sql.NullTime
+    err := s.db.QueryRow(ctx, queryGetBootstrapCheckpoint, query, name).Scan(
+        &checkpoint.Name,
+        &checkpoint.Source,
+        &checkpoint.Position,
+        &lastStoredAt,
+        &checkpoint.Applied,
+        &checkpoint.StartedAt,
+        &checkpoint.UpdatedAt,
+        &completedAt,
+    )
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get bootstrap checkpoint: %w", err)
+    }
+    
+    checkpoint.LastStoredAt = lastStoredAt.Time
+    if completedAt.Valid {
+        checkpoint.CompletedAt = &completedAt.Time
+    }
+    return &checkpoint, nil
+}
+
+func (s *bootstrapCheckpointStore) SaveCheckpoint(ctx context.Context, checkpoint *BootstrapCheckpointDTO) error {
+    query := `
+        INSERT INTO projection_bootstraps (name, source, position, last_stored_at, applied, started_at, updated_at, completed_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        ON CONFLICT (name) DO UPDATE
+        SET source = EXCLUDED.source, position = EXCLUDED.position, last_stored_at = EXCLUDED.last_stored_at,
+            applied = EXCLUDED.applied, updated_at = EXCLUDED.updated_at, completed_at = EXCLUDED.completed_at
+    `
+    
+    var lastStoredAt, completedAt sql.NullTime
+    if !checkpoint.LastStoredAt.IsZero() {
+        lastStoredAt = sql.NullTime{Time: checkpoint.LastStoredAt.UTC(), Valid: true}
+    }
+    if checkpoint.CompletedAt != nil {
+        completedAt = sql.NullTime{Time: checkpoint.CompletedAt.UTC(), Valid: true}
+    }
+    
+    _, err := s.db.Exec(ctx, querySaveBootstrapCheckpoint, query,
+        checkpoint.Name,
+        checkpoint.Source,
+        checkpoint.Position,
+        lastStoredAt,
+        checkpoint.Applied,
+        checkpoint.StartedAt.UTC(),
+        checkpoint.UpdatedAt.UTC(),
+        completedAt,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to save bootstrap checkpoint: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,164 @@
+package readmodels
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultCacheTTL is how long cached orders and customers live when no TTL
+// is configured.
+const DefaultCacheTTL = time.Hour
+
+// DefaultAnalyticsRetention is how long the last analytics computed are
+// kept as a fallback when no retention is configured.
+const DefaultAnalyticsRetention = 24 * time.Hour
+
+// CacheConfig controls the Redis cache in front of the read models. The zero
+// value caches with DefaultCacheTTL and unprefixed keys.
+type CacheConfig struct {
+    // Disabled bypasses Redis entirely; every read goes to the database
+    Disabled bool
+    // Namespace prefixes every key, so environments sharing a Redis
+    // cluster do not collide: "staging" gives "staging:order:<id>"
+    Namespace string
+    // OrderTTL and CustomerTTL default to DefaultCacheTTL. A customer's
+    // cached order list lives for OrderTTL, their order summary for
+    // CustomerTTL
+    OrderTTL    time.Duration
+    CustomerTTL time.Duration
+    // AnalyticsRetention is how long the last analytics computed are kept
+    // to serve while the database is unavailable; it defaults to
+    // DefaultAnalyticsRetention
+    AnalyticsRetention time.Duration
+}
+
+// CacheConfigFromEnv reads CACHE_ENABLED, CACHE_NAMESPACE, CACHE_ORDER_TTL,
+// CACHE_CUSTOMER_TTL and CACHE_ANALYTICS_RETENTION.
+func CacheConfigFromEnv() CacheConfig {
+    var cfg CacheConfig
+    if enabled, err := strconv.ParseBool(os.Getenv("CACHE_ENABLED")); err == nil {
+        cfg.Disabled = !enabled
+    }
+    cfg.Namespace = os.Getenv("CACHE_NAMESPACE")
+    if ttl, err := time.ParseDuration(os.Getenv("CACHE_ORDER_TTL")); err == nil && ttl > 0 {
+        cfg.OrderTTL = ttl
+    }
+    if ttl, err := time.ParseDuration(os.Getenv("CACHE_CUSTOMER_TTL")); err == nil && ttl > 0 {
+        cfg.CustomerTTL = ttl
+    }
+    if retention, err := time.ParseDuration(os.Getenv("CACHE_ANALYTICS_RETENTION")); err == nil && retention > 0 {
+        cfg.AnalyticsRetention = retention
+    }
+    return cfg
+}
+
+// Cache entity names, the second part of each key.
+const (
+    cacheEntityOrder                = "order"
+    cacheEntityCustomer             = "customer"
+    cacheEntityCustomerOrders       = "customer_orders"
+    cacheEntityCustomerOrderSummary = "customer_order_summary"
+    cacheEntityOrderAnalytics       = "order_analytics"
+)
+
+// CustomerOrdersCacheSize is how many of a customer's most recent orders
+// are cached; order list pages within it are served from the cache.
+const CustomerOrdersCacheSize = 20
+
+// Cache is the read models' view of Redis: keys are namespaced, and a
+// disabled cache makes no Redis calls, behaving as if every key missed.
+type Cache struct {
+    client redis.Cmdable
+    cfg    CacheConfig
+}
+
+// NewCache caches in client as cfg says. client may be nil when cfg is
+// disabled.
+func NewCache(client redis.Cmdable, cfg CacheConfig) *Cache {
+    if cfg.OrderTTL <= 0 {
+        cfg.OrderTTL = DefaultCacheTTL
+    }
+    if cfg.CustomerTTL <= 0 {
+        cfg.CustomerTTL = DefaultCacheTTL
+    }
+    if cfg.AnalyticsRetention <= 0 {
+        cfg.AnalyticsRetention = DefaultAnalyticsRetention
+    }
+    if client == nil {
+        cfg.Disabled = true
+    }
+    return &Cache{client: client, cfg: cfg}
+}
+
+// orNoCache returns cache, or a disabled cache when it is nil, so the read
+// models run without caching when given none.
+func orNoCache(cache *Cache) *Cache {
+    if cache == nil {
+        return NewCache(nil, CacheConfig{})
+    }
+    return cache
+}
+
+// Key returns the Redis key of an entity: "<namespace>:<entity>:<id>", or
+// "<entity>:<id>" without a namespace.
+func (c *Cache) Key(entity, id string) string {
+    if c.cfg.Namespace == "" {
+        return entity + ":" + id
+    }
+    return c.cfg.Namespace + ":" + entity + ":" + id
+}
+
+func (c *Cache) orderKey(orderID string) string {
+    return c.Key(cacheEntityOrder, orderID)
+}
+
+func (c *Cache) customerKey(customerID string) string {
+    return c.Key(cacheEntityCustomer, customerID)
+}
+
+func (c *Cache) customerOrdersKey(customerID string) string {
+    return c.Key(cacheEntityCustomerOrders, customerID)
+}
+
+func (c *Cache) customerOrderSummaryKey(customerID string) string {
+    return c.Key(cacheEntityCustomerOrderSummary, customerID)
+}
+
+// get returns the cached value of key, reporting false on a miss or error.
+func (c *Cache) get(ctx context.Context, key string) (string, bool) {
+    if c.cfg.Disabled {
+        return "", false
+    }
+    value, err := c.client.Get(ctx, key).Result()
+    return value, err == nil
+}
+
+// mget returns the cached values of keys, with nil for misses.
+func (c *Cache) mget(ctx context.Context, keys []string) []interface{} {
+    values := make([]interface{}, len(keys))
+    if c.cfg.Disabled || len(keys) == 0 {
+        return values
+    }
+    if cached, err := c.client.MGet(ctx, keys...).Result(); err == nil && len(cached) == len(keys) {
+        return cached
+    }
+    return values
+}
+
+func (c *Cache) set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+    if c.cfg.Disabled {
+        return
+    }
+    c.client.Set(ctx, key, value, ttl)
+}
+
+func (c *Cache) del(ctx context.Context, keys ...string) {
+    if c.cfg.Disabled {
+        return
+    }
+    c.client.Del(ctx, keys...)
+}
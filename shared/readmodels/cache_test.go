@@ -0,0 +1,167 @@
+package readmodels
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// countingHook counts the commands a client sends.
+type countingHook struct {
+    commands atomic.Int64
+}
+
+func (h *countingHook) DialHook(next redis.DialHook) redis.DialHook {
+    return next
+}
+
+func (h *countingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+    return func(ctx context.Context, cmd redis.Cmder) error {
+        h.commands.Add(1)
+        return next(ctx, cmd)
+    }
+}
+
+func (h *countingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+    return func(ctx context.Context, cmds []redis.Cmder) error {
+        h.commands.Add(int64(len(cmds)))
+        return next(ctx, cmds)
+    }
+}
+
+// newCountingClient returns a client of a fresh miniredis that counts its
+// commands.
+func newCountingClient(t *testing.T) (*redis.Client, *miniredis.Miniredis, *countingHook) {
+    t.Helper()
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+    t.Cleanup(func() { client.Close() })
+    hook := &countingHook{}
+    client.AddHook(hook)
+    return client, server, hook
+}
+
+func TestCache_Key(t *testing.T) {
+    tests := []struct {
+        namespace string
+        key       func(c *Cache) string
+        want      string
+    }{
+        {key: func(c *Cache) string { return c.orderKey("o1") }, want: "order:o1"},
+        {namespace: "staging", key: func(c *Cache) string { return c.orderKey("o1") }, want: "staging:order:o1"},
+        {namespace: "staging", key: func(c *Cache) string { return c.customerKey("c1") }, want: "staging:customer:c1"},
+        {namespace: "staging", key: func(c *Cache) string { return c.customerOrdersKey("c1") }, want: "staging:customer_orders:c1"},
+        {namespace: "prod", key: func(c *Cache) string { return c.customerOrderSummaryKey("c1") }, want: "prod:customer_order_summary:c1"},
+        {namespace: "prod", key: func(c *Cache) string { return c.Key(cacheEntityOrderAnalytics, "all") }, want: "prod:order_analytics:all"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.want, func(t *testing.T) {
+            cache := NewCache(nil, CacheConfig{Namespace: tt.namespace})
+            if got := tt.key(cache); got != tt.want {
+                t.Errorf("key = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestCache_ttls(t *testing.T) {
+    ctx := context.Background()
+    client, server, _ := newCountingClient(t)
+    cache := NewCache(client, CacheConfig{Namespace: "staging", CustomerTTL: 5 * time.Minute})
+    
+    cache.set(ctx, cache.orderKey("o1"), []byte("{}"), cache.cfg.OrderTTL)
+    cache.set(ctx, cache.customerKey("c1"), []byte("{}"), cache.cfg.CustomerTTL)
+    if ttl := server.TTL("staging:order:o1"); ttl != DefaultCacheTTL {
+        t.Errorf("order TTL = %s, want the default %s", ttl, DefaultCacheTTL)
+    }
+    if ttl := server.TTL("staging:customer:c1"); ttl != 5*time.Minute {
+        t.Errorf("customer TTL = %s, want 5m", ttl)
+    }
+    if value, ok := cache.get(ctx, "staging:order:o1"); !ok || value != "{}" {
+        t.Errorf("get() = %q, %v, want the cached value", value, ok)
+    }
+}
+
+func TestCache_disabled(t *testing.T) {
+    ctx := context.Background()
+    client, _, hook := newCountingClient(t)
+    cache := NewCache(client, CacheConfig{Disabled: true})
+    
+    cache.set(ctx, cache.orderKey("o1"), []byte("{}"), time.Hour)
+    if _, ok := cache.get(ctx, cache.orderKey("o1")); ok {
+        t.Error("get() on a disabled cache hit")
+    }
+    if values := cache.mget(ctx, []string{"a", "b"}); len(values) != 2 || values[0] != nil || values[1] != nil {
+        t.Errorf("mget() on a disabled cache = %v, want two misses", values)
+    }
+    cache.del(ctx, cache.orderKey("o1"))
+    if n := hook.commands.Load(); n != 0 {
+        t.Errorf("disabled cache sent %d Redis commands", n)
+    }
+}
+
+// Read models given a disabled cache serve reads from the database without
+// touching Redis.
+func TestOrderReadModel_cacheDisabled(t *testing.T) {
+    ctx := context.Background()
+    client, _, hook := newCountingClient(t)
+    rm := NewOrderReadModel(sqlmetrics.Wrap(schematest.Open(t), 0), NewCache(client, CacheConfig{Disabled: true}))
+    
+    order := seedOrder(t, rm)
+    if err := rm.SetStatus(ctx, order.ID, StatusChange{Status: "shipped", ChangedAt: order.UpdatedAt.Time, Version: order.Version + 1, EventType: "OrderShipped"}); err != nil {
+        t.Fatalf("SetStatus() = %v", err)
+    }
+    got, err := rm.GetOrder(ctx, order.ID)
+    if err != nil {
+        t.Fatalf("GetOrder() = %v", err)
+    }
+    if got.Status != "shipped" {
+        t.Errorf("status = %q, want shipped", got.Status)
+    }
+    if n := hook.commands.Load(); n != 0 {
+        t.Errorf("read model sent %d Redis commands with the cache disabled", n)
+    }
+}
+
+func TestCacheConfigFromEnv(t *testing.T) {
+    t.Setenv("CACHE_ENABLED", "false")
+    t.Setenv("CACHE_NAMESPACE", "staging")
+    t.Setenv("CACHE_ORDER_TTL", "10m")
+    t.Setenv("CACHE_CUSTOMER_TTL", "-1m")
+    t.Setenv("CACHE_ANALYTICS_RETENTION", "never")
+    
+    want := CacheConfig{Disabled: true, Namespace: "staging", OrderTTL: 10 * time.Minute}
+    if got := CacheConfigFromEnv(); got != want {
+        t.Errorf("CacheConfigFromEnv() = %+v, want %+v", got, want)
+    }
+}
+
+// noCacheEnv makes newTestReadModels build read models without a cache.
+const noCacheEnv = "READMODELS_TEST_NO_CACHE"
+
+// The read models behave the same without a cache: the package's tests are
+// run again in a child process whose read models have none.
+func TestReadModels_withoutCache(t *testing.T) {
+    if os.Getenv(noCacheEnv) != "" {
+        t.Skip("already running without a cache")
+    }
+    if testing.Short() {
+        t.Skip("runs the package's tests again")
+    }
+    
+    cmd := exec.Command(os.Args[0], "-test.run", "^Test(OrderReadModel|OrderHistoryReadModel|ReadModels)_?", "-test.count", "1")
+    cmd.Env = append(os.Environ(), noCacheEnv+"=1")
+    if output, err := cmd.CombinedOutput(); err != nil {
+        t.Fatalf("tests without a cache failed: %v\n%s", err, output)
+    }
+}
@@ -0,0 +1,381 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+type CustomerReadModel interface {
+    GetCustomer(ctx context.Context, customerID string) (*CustomerDTO, error)
+    CreateCustomer(ctx context.Context, customer *CustomerDTO) error
+    UpdateCustomer(ctx context.Context, customer *CustomerDTO) error
+    DeleteCustomer(ctx context.Context, customerID string) error
+    // RecordOrder adds an order to those counted by the customer's order
+    // summary and refreshes the summary, in one transaction. When the
+    // order is the customer's first, firstOrder is called in that
+    // transaction, so what it writes commits with the summary or not at
+    // all. Recording an order twice has no effect.
+    RecordOrder(ctx context.Context, customerID, orderID string, createdAt time.Time, firstOrder func(tx *sql.Tx) error) error
+    // ReassignOrder moves a recorded order to customerID, for the summaries
+    // of both customers to be refreshed. Reassigning an order twice, or
+    // one not recorded, has no effect.
+    ReassignOrder(ctx context.Context, orderID, customerID string) error
+    // MarkMerged records that customerID was merged into targetID at
+    // mergedAt; customers not in the read model are left alone.
+    MarkMerged(ctx context.Context, customerID, targetID string, mergedAt time.Time) error
+    RefreshOrderSummary(ctx context.Context, customerID string) (previousCount, currentCount int64, err error)
+    // GetOrderSummary returns the customer's order summary, or
+    // ErrOrderSummaryNotFound before their first order is recorded.
+    GetOrderSummary(ctx context.Context, customerID string) (*CustomerOrderSummaryDTO, error)
+    // CacheOrderSummary reloads the cached order summary of a customer from
+    // the database.
+    CacheOrderSummary(ctx context.Context, customerID string) error
+    // DeleteOrdersCreatedSince forgets the orders created at or after since,
+    // so replaying their events records them again. Summaries keep their
+    // counts until the replay refreshes them, so it derives no first-order
+    // events twice. It returns how many orders were forgotten.
+    DeleteOrdersCreatedSince(ctx context.Context, since time.Time) (int64, error)
+}
+
+type CustomerDTO struct {
+    ID        string                     `json:"id"`
+    Email     string                     `json:"email"`
+    Name      string                     `json:"name"`
+    Addresses []entities.CustomerAddress `json:"addresses"`
+    CreatedAt apijson.Timestamp          `json:"created_at"`
+    UpdatedAt apijson.Timestamp          `json:"updated_at"`
+    // MergedInto is the customer this one was merged into, and MergedAt
+    // when; unset unless merged
+    MergedInto string                    `json:"merged_into,omitempty"`
+    MergedAt   *apijson.Timestamp        `json:"merged_at,omitempty"`
+}
+
+// ErrOrderSummaryNotFound is returned for a customer with no recorded
+// orders.
+var ErrOrderSummaryNotFound = errors.New("customer order summary not found")
+
+// CustomerOrderSummaryDTO counts a customer's orders. The times are unset
+// when every counted order was forgotten by DeleteOrdersCreatedSince and
+// the summary refreshed since.
+type CustomerOrderSummaryDTO struct {
+    CustomerID   string             `json:"customer_id"`
+    OrderCount   int64              `json:"order_count"`
+    FirstOrderAt *apijson.Timestamp `json:"first_order_at,omitempty"`
+    LastOrderAt  *apijson.Timestamp `json:"last_order_at,omitempty"`
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryGetCustomer          = "customer_read_models.get"
+    queryUpsertCustomer       = "customer_read_models.upsert"
+    queryDeleteCustomer       = "customer_read_models.delete"
+    queryRefreshOrderSummary  = "customer_read_models.refresh_order_summary"
+    queryGetOrderSummary      = "customer_order_summaries.get"
+    queryRecordCustomerOrder  = "customer_orders.record"
+    queryReassignOrder        = "customer_orders.reassign"
+    queryMarkCustomerMerged   = "customer_read_models.mark_merged"
+    queryDeleteCustomerOrders = "customer_orders.delete_since"
+)
+
+type customerReadModel struct {
+    db    *sqlmetrics.DB
+    cache *Cache
+}
+
+// NewCustomerReadModel reads customers from db through cache, which may be
+// nil for no caching.
+func NewCustomerReadModel(db *sqlmetrics.DB, cache *Cache) CustomerReadModel {
+    return &customerReadModel{
+        db:    db,
+        cache: orNoCache(cache),
+    }
+}
+
+func (rm *customerReadModel) GetCustomer(ctx context.Context, customerID string) (*CustomerDTO, error) {
+    // Try cache first
+    cacheKey := rm.cache.customerKey(customerID)
+    if cached, ok := rm.cache.get(ctx, cacheKey); ok {
+        var customer CustomerDTO
+        if err := json.Unmarshal([]byte(cached), &customer); err == nil {
+            return &customer, nil
+        }
+    }
+    
+    // Fallback to database
+    query := `
+        SELECT id, email, name, addresses, created_at, updated_at, COALESCE(merged_into, ''), merged_at
+        FROM customer_read_models
+        WHERE id = $1
+    `
+    
+    var customer CustomerDTO
+    var addressesJSON string
+    var mergedAt sql.NullTime
+    
+    err := rm.db.QueryRow(ctx, queryGetCustomer, query, customerID).Scan(
+        &customer.ID,
+        &customer.Email,
+        &customer.Name,
+        &addressesJSON,
+        &customer.CreatedAt,
+        &customer.UpdatedAt,
+        &customer.MergedInto,
+        &mergedAt,
+    )
+    
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, fmt.Errorf("customer not found")
+        }
+        return nil, fmt.Errorf("failed to find customer: %w", err)
+    }
+    
+    // Parse addresses
+    if err := json.Unmarshal([]byte(addressesJSON), &customer.Addresses); err != nil {
+        return nil, fmt.Errorf("failed to unmarshal addresses: %w", err)
+    }
+    if mergedAt.Valid {
+        merged := apijson.NewTimestamp(mergedAt.Time)
+        customer.MergedAt = &merged
+    }
+    
+    // Cache the result
+    customerData, _ := json.Marshal(customer)
+    rm.cache.set(ctx, cacheKey, customerData, rm.cache.cfg.CustomerTTL)
+    
+    return &customer, nil
+}
+
+func (rm *customerReadModel) CreateCustomer(ctx context.Context, customer *CustomerDTO) error {
+    addressesJSON, err := json.Marshal(customer.Addresses)
+    if err != nil {
+        return fmt.Errorf("failed to marshal addresses: %w", err)
+    }
+    
+    query := `
+        INSERT INTO customer_read_models (id, email, name, addresses, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (id) DO UPDATE SET
+            email = $2,
+            name = $3,
+            addresses = $4,
+            updated_at = $6
+    `
+    
+    _, err = rm.db.Exec(ctx, queryUpsertCustomer, query,
+        customer.ID,
+        customer.Email,
+        customer.Name,
+        addressesJSON,
+        customer.CreatedAt,
+        customer.UpdatedAt,
+    )
+    
+    if err != nil {
+        return fmt.Errorf("failed to save customer: %w", err)
+    }
+    
+    // Dropped rather than cached, as the row may have merge columns the
+    // customer given does not
+    rm.cache.del(ctx, rm.cache.customerKey(customer.ID))
+    
+    return nil
+}
+
+func (rm *customerReadModel) UpdateCustomer(ctx context.Context, customer *CustomerDTO) error {
+    return rm.CreateCustomer(ctx, customer) // Same as create due to UPSERT
+}
+
+func (rm *customerReadModel) DeleteCustomer(ctx context.Context, customerID string) error {
+    query := `DELETE FROM customer_read_models WHERE id = $1`
+    
+    _, err := rm.db.Exec(ctx, queryDeleteCustomer, query, customerID)
+    if err != nil {
+        return fmt.Errorf("failed to delete customer: %w", err)
+    }
+    
+    // Remove from cache
+    rm.cache.del(ctx, rm.cache.customerKey(customerID))
+    
+    return nil
+}
+
+// RecordOrder inserts into customer_orders, the orders summaries are
+// computed from. The customer summary projection keeps its own record of
+// orders so it does not depend on the order read model being up to date.
+//
+// A redelivered event whose first attempt failed to commit finds the
+// summary as it was, so it calls firstOrder again.
+func (rm *customerReadModel) RecordOrder(ctx context.Context, customerID, orderID string, createdAt time.Time, firstOrder func(tx *sql.Tx) error) error {
+    tx, err := rm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+    
+    query := `
+        INSERT INTO customer_orders (order_id, customer_id, created_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (order_id) DO NOTHING
+    `
+    if _, err := tx.Exec(ctx, queryRecordCustomerOrder, query, orderID, customerID, createdAt.UTC()); err != nil {
+        return fmt.Errorf("failed to record customer order: %w", err)
+    }
+    
+    previousCount, currentCount, err := refreshOrderSummary(ctx, tx.DB, customerID)
+    if err != nil {
+        return err
+    }
+    if previousCount == 0 && currentCount == 1 && firstOrder != nil {
+        if err := firstOrder(tx.Unwrap()); err != nil {
+            return err
+        }
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("failed to commit customer order: %w", err)
+    }
+    rm.cache.del(ctx, rm.cache.customerOrderSummaryKey(customerID))
+    return nil
+}
+
+func (rm *customerReadModel) ReassignOrder(ctx context.Context, orderID, customerID string) error {
+    query := `UPDATE customer_orders SET customer_id = $2 WHERE order_id = $1`
+    
+    if _, err := rm.db.Exec(ctx, queryReassignOrder, query, orderID, customerID); err != nil {
+        return fmt.Errorf("failed to reassign customer order: %w", err)
+    }
+    return nil
+}
+
+func (rm *customerReadModel) MarkMerged(ctx context.Context, customerID, targetID string, mergedAt time.Time) error {
+    // A merge recorded again keeps the time it was first recorded
+    query := `
+        UPDATE customer_read_models
+        SET merged_into = $2, merged_at = COALESCE(merged_at, $3)
+        WHERE id = $1
+    `
+    
+    if _, err := rm.db.Exec(ctx, queryMarkCustomerMerged, query, customerID, targetID, mergedAt.UTC()); err != nil {
+        return fmt.Errorf("failed to mark customer merged: %w", err)
+    }
+    
+    rm.cache.del(ctx, rm.cache.customerKey(customerID))
+    return nil
+}
+
+func (rm *customerReadModel) DeleteOrdersCreatedSince(ctx context.Context, since time.Time) (int64, error) {
+    query := `DELETE FROM customer_orders WHERE created_at >= $1`
+    
+    result, err := rm.db.Exec(ctx, queryDeleteCustomerOrders, query, since.UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete customer orders: %w", err)
+    }
+    return result.RowsAffected()
+}
+
+// RefreshOrderSummary recomputes the customer's order summary from the
+// orders recorded with RecordOrder and reports the order count before and
+// after the refresh. Recomputing rather than incrementing keeps redelivered
+// events idempotent.
+func (rm *customerReadModel) RefreshOrderSummary(ctx context.Context, customerID string) (int64, int64, error) {
+    previousCount, currentCount, err := refreshOrderSummary(ctx, rm.db, customerID)
+    if err != nil {
+        return 0, 0, err
+    }
+    
+    rm.cache.del(ctx, rm.cache.customerOrderSummaryKey(customerID))
+    return previousCount, currentCount, nil
+}
+
+// refreshOrderSummary is RefreshOrderSummary on db, which may be a
+// transaction, leaving the cache alone.
+func refreshOrderSummary(ctx context.Context, db *sqlmetrics.DB, customerID string) (int64, int64, error) {
+    query := `
+        WITH previous AS (
+            SELECT order_count FROM customer_order_summaries WHERE customer_id = $1
+        ), current AS (
+            SELECT COUNT(*) AS order_count, MIN(created_at) AS first_order_at, MAX(created_at) AS last_order_at
+            FROM customer_orders
+            WHERE customer_id = $1
+        ), upserted AS (
+            INSERT INTO customer_order_summaries (customer_id, order_count, first_order_at, last_order_at)
+            SELECT $1, order_count, first_order_at, last_order_at FROM current
+            ON CONFLICT (customer_id) DO UPDATE SET
+                order_count = EXCLUDED.order_count,
+                first_order_at = EXCLUDED.first_order_at,
+                last_order_at = EXCLUDED.last_order_at
+            RETURNING order_count
+        )
+        SELECT COALESCE((SELECT order_count FROM previous), 0), (SELECT order_count FROM upserted)
+    `
+    
+    var previousCount, currentCount int64
+    err := db.QueryRow(ctx, queryRefreshOrderSummary, query, customerID).Scan(&previousCount, &currentCount)
+    if err != nil {
+        return 0, 0, fmt.Errorf("failed to refresh customer order summary: %w", err)
+    }
+    return previousCount, currentCount, nil
+}
+
+func (rm *customerReadModel) GetOrderSummary(ctx context.Context, customerID string) (*CustomerOrderSummaryDTO, error) {
+    if cached, ok := rm.cache.get(ctx, rm.cache.customerOrderSummaryKey(customerID)); ok {
+        var summary CustomerOrderSummaryDTO
+        if err := json.Unmarshal([]byte(cached), &summary); err == nil {
+            return &summary, nil
+        }
+    }
+    return rm.loadOrderSummary(ctx, customerID)
+}
+
+func (rm *customerReadModel) CacheOrderSummary(ctx context.Context, customerID string) error {
+    _, err := rm.loadOrderSummary(ctx, customerID)
+    if errors.Is(err, ErrOrderSummaryNotFound) {
+        return nil
+    }
+    return err
+}
+
+// loadOrderSummary reads a customer's order summary and caches it.
+func (rm *customerReadModel) loadOrderSummary(ctx context.Context, customerID string) (*CustomerOrderSummaryDTO, error) {
+    query := `
+        SELECT customer_id, order_count, first_order_at, last_order_at
+        FROM customer_order_summaries
+        WHERE customer_id = $1
+    `
+    
+    var summary CustomerOrderSummaryDTO
+    var firstOrderAt, lastOrderAt sql.NullTime
+    err := rm.db.QueryRow(ctx, queryGetOrderSummary, query, customerID).Scan(
+        &summary.CustomerID,
+        &summary.OrderCount,
+        &firstOrderAt,
+        &lastOrderAt,
+    )
+    if err == sql.ErrNoRows {
+        return nil, ErrOrderSummaryNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get customer order summary: %w", err)
+    }
+    if firstOrderAt.Valid {
+        first := apijson.NewTimestamp(firstOrderAt.Time)
+        summary.FirstOrderAt = &first
+    }
+    if lastOrderAt.Valid {
+        last := apijson.NewTimestamp(lastOrderAt.Time)
+        summary.LastOrderAt = &last
+    }
+    
+    data, _ := json.Marshal(summary)
+    rm.cache.set(ctx, rm.cache.customerOrderSummaryKey(customerID), data, rm.cache.cfg.CustomerTTL)
+    return &summary, nil
+}
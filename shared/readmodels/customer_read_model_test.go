@@ -0,0 +1,110 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+func newTestCustomerReadModel(t *testing.T) CustomerReadModel {
+    t.Helper()
+    return NewCustomerReadModel(sqlmetrics.Wrap(schematest.Open(t), 0), nil)
+}
+
+// A first order whose derived write fails leaves no trace, so the
+// redelivered event derives it again; once committed it is not derived
+// again.
+func TestCustomerReadModel_RecordOrder_firstOrder(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestCustomerReadModel(t)
+    customerID := uuid.NewString()
+    orderID := uuid.NewString()
+    createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    
+    errSave := errors.New("outbox unavailable")
+    calls := 0
+    record := func(saveErr error) error {
+        return rm.RecordOrder(ctx, customerID, orderID, createdAt, func(tx *sql.Tx) error {
+            calls++
+            return saveErr
+        })
+    }
+    
+    if err := record(errSave); !errors.Is(err, errSave) {
+        t.Fatalf("RecordOrder() = %v, want %v", err, errSave)
+    }
+    if _, err := rm.GetOrderSummary(ctx, customerID); !errors.Is(err, ErrOrderSummaryNotFound) {
+        t.Fatalf("GetOrderSummary() after a failed save = %v, want %v", err, ErrOrderSummaryNotFound)
+    }
+    
+    if err := record(nil); err != nil {
+        t.Fatalf("RecordOrder() on redelivery = %v", err)
+    }
+    if calls != 2 {
+        t.Errorf("firstOrder called %d times after the redelivery, want 2", calls)
+    }
+    summary, err := rm.GetOrderSummary(ctx, customerID)
+    if err != nil {
+        t.Fatalf("GetOrderSummary() = %v", err)
+    }
+    if summary.OrderCount != 1 {
+        t.Errorf("GetOrderSummary() order count = %d, want 1", summary.OrderCount)
+    }
+    
+    if err := record(nil); err != nil {
+        t.Fatalf("RecordOrder() on a second redelivery = %v", err)
+    }
+    if calls != 2 {
+        t.Errorf("firstOrder called %d times after the order was committed, want 2", calls)
+    }
+}
+
+// CacheOrderSummary writes the customer's summary to its key, and leaves a
+// customer without orders uncached.
+func TestCustomerReadModel_CacheOrderSummary(t *testing.T) {
+    ctx := context.Background()
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+    t.Cleanup(func() { client.Close() })
+    cache := NewCache(client, CacheConfig{})
+    rm := NewCustomerReadModel(sqlmetrics.Wrap(schematest.Open(t), 0), cache)
+    customerID := uuid.NewString()
+    createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    
+    if err := rm.CacheOrderSummary(ctx, customerID); err != nil {
+        t.Fatalf("CacheOrderSummary() without orders = %v", err)
+    }
+    if server.Exists(cache.customerOrderSummaryKey(customerID)) {
+        t.Error("CacheOrderSummary() cached a customer without orders")
+    }
+    
+    for i := 0; i < 2; i++ {
+        if err := rm.RecordOrder(ctx, customerID, uuid.NewString(), createdAt.Add(time.Duration(i)*time.Hour), nil); err != nil {
+            t.Fatalf("RecordOrder() = %v", err)
+        }
+    }
+    if err := rm.CacheOrderSummary(ctx, customerID); err != nil {
+        t.Fatalf("CacheOrderSummary() = %v", err)
+    }
+    data, err := server.Get(cache.customerOrderSummaryKey(customerID))
+    if err != nil {
+        t.Fatalf("order summary key: %v", err)
+    }
+    var summary CustomerOrderSummaryDTO
+    if err := json.Unmarshal([]byte(data), &summary); err != nil {
+        t.Fatalf("decoding order summary key: %v", err)
+    }
+    if summary.CustomerID != customerID || summary.OrderCount != 2 {
+        t.Errorf("cached order summary = %+v, want 2 orders of %s", summary, customerID)
+    }
+}
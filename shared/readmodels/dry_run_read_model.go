@@ -0,0 +1,384 @@
+package readmodels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+// DefaultDryRunLogSize is how many mutations a dry-run read model keeps
+// when none is configured.
+const DefaultDryRunLogSize = 1000
+
+// DryRunMutation is a write a projection running in dry-run mode asked for
+// and that was not applied.
+type DryRunMutation struct {
+    At      time.Time `json:"at"`
+    Method  string    `json:"method"`
+    OrderID string    `json:"order_id,omitempty"`
+    // Summary describes the write in one line
+    Summary string    `json:"summary"`
+    // Fields holds the order fields the write would have set, encoded as
+    // the API returns them; empty for deletes
+    Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// FieldDifference is a field the dry run would have written differently
+// from the live read model.
+type FieldDifference struct {
+    DryRun interface{} `json:"dry_run"`
+    Live   interface{} `json:"live"`
+}
+
+// DryRunComparison is a recorded mutation checked against the live read
+// model's current state of the order.
+type DryRunComparison struct {
+    DryRunMutation
+    // Matches is set when the live order already has every field the dry
+    // run would have written, or is gone when the dry run deleted it
+    Matches     bool                       `json:"matches"`
+    LiveMissing bool                       `json:"live_missing,omitempty"`
+    // Superseded is set when the live order has moved past the version the
+    // mutation wrote, so its fields are no longer comparable
+    Superseded  bool                       `json:"superseded,omitempty"`
+    Differences map[string]FieldDifference `json:"differences,omitempty"`
+}
+
+// DryRunOrderReadModel lets a new version of a projection run against live
+// traffic without touching the read model tables. Reads go to the live read
+// model; writes are recorded in a fixed-size in-memory log, oldest first
+// out, and can be compared with what the live projection wrote.
+type DryRunOrderReadModel struct {
+    live OrderReadModel
+    
+    mu      sync.Mutex
+    entries []DryRunMutation
+    next    int
+    full    bool
+}
+
+// NewDryRunOrderReadModel wraps the live read model, keeping the last size
+// mutations; DefaultDryRunLogSize if size is not positive.
+func NewDryRunOrderReadModel(live OrderReadModel, size int) *DryRunOrderReadModel {
+    if size <= 0 {
+        size = DefaultDryRunLogSize
+    }
+    return &DryRunOrderReadModel{
+        live:    live,
+        entries: make([]DryRunMutation, size),
+    }
+}
+
+// Mutations returns up to limit recorded mutations, newest first. A limit
+// that is not positive returns all of them.
+func (rm *DryRunOrderReadModel) Mutations(limit int) []DryRunMutation {
+    rm.mu.Lock()
+    defer rm.mu.Unlock()
+    
+    count := rm.next
+    if rm.full {
+        count = len(rm.entries)
+    }
+    if limit <= 0 || limit > count {
+        limit = count
+    }
+    
+    mutations := make([]DryRunMutation, 0, limit)
+    for i := 1; i <= limit; i++ {
+        index := (rm.next - i + len(rm.entries)) % len(rm.entries)
+        mutations = append(mutations, rm.entries[index])
+    }
+    return mutations
+}
+
+// Compare checks up to limit recorded mutations, newest first, against the
+// live read model. The live projection may not have caught up with the
+// newest ones yet, so recent mismatches are expected to settle.
+func (rm *DryRunOrderReadModel) Compare(ctx context.Context, limit int) ([]DryRunComparison, error) {
+    mutations := rm.Mutations(limit)
+    comparisons := make([]DryRunComparison, 0, len(mutations))
+    live := map[string]map[string]interface{}{}
+    
+    for _, mutation := range mutations {
+        comparison := DryRunComparison{DryRunMutation: mutation}
+        if mutation.OrderID == "" {
+            // Bulk writes have no single order to compare with
+            comparisons = append(comparisons, comparison)
+            continue
+        }
+        
+        fields, ok := live[mutation.OrderID]
+        if !ok {
+            order, err := rm.live.GetOrder(ctx, mutation.OrderID)
+            if err != nil && !errors.Is(err, ErrOrderNotFound) {
+                return nil, fmt.Errorf("failed to read live order %s: %w", mutation.OrderID, err)
+            }
+            if order != nil {
+                fields = jsonFields(order)
+            }
+            live[mutation.OrderID] = fields
+        }
+        
+        comparison.LiveMissing = fields == nil
+        if mutation.Method == "DeleteOrder" {
+            comparison.Matches = comparison.LiveMissing
+            comparisons = append(comparisons, comparison)
+            continue
+        }
+        
+        if version, ok := mutation.Fields["version"].(float64); ok && fields != nil {
+            if liveVersion, ok := fields["version"].(float64); ok && liveVersion > version {
+                comparison.Superseded = true
+                comparisons = append(comparisons, comparison)
+                continue
+            }
+        }
+        
+        for name, value := range mutation.Fields {
+            var liveValue interface{}
+            if fields != nil {
+                liveValue = fields[name]
+            }
+            if !reflect.DeepEqual(value, liveValue) {
+                if comparison.Differences == nil {
+                    comparison.Differences = map[string]FieldDifference{}
+                }
+                comparison.Differences[name] = FieldDifference{DryRun: value, Live: liveValue}
+            }
+        }
+        comparison.Matches = !comparison.LiveMissing && len(comparison.Differences) == 0
+        comparisons = append(comparisons, comparison)
+    }
+    return comparisons, nil
+}
+
+func (rm *DryRunOrderReadModel) record(method, orderID, summary string, fields map[string]interface{}) {
+    rm.mu.Lock()
+    defer rm.mu.Unlock()
+    
+    rm.entries[rm.next] = DryRunMutation{
+        At:      clock.Now().UTC(),
+        Method:  method,
+        OrderID: orderID,
+        Summary: summary,
+        Fields:  fields,
+    }
+    rm.next = (rm.next + 1) % len(rm.entries)
+    if rm.next == 0 {
+        rm.full = true
+    }
+}
+
+// jsonFields returns v's JSON object fields decoded into plain values, so
+// values recorded from different Go types compare equal when the API would
+// return them the same.
+func jsonFields(v interface{}) map[string]interface{} {
+    data, err := json.Marshal(v)
+    if err != nil {
+        return nil
+    }
+    var fields map[string]interface{}
+    if err := json.Unmarshal(data, &fields); err != nil {
+        return nil
+    }
+    return fields
+}
+
+func (rm *DryRunOrderReadModel) GetOrder(ctx context.Context, orderID string) (*OrderDTO, error) {
+    return rm.live.GetOrder(ctx, orderID)
+}
+
+func (rm *DryRunOrderReadModel) GetOrders(ctx context.Context, orderIDs []string) (map[string]*OrderDTO, error) {
+    return rm.live.GetOrders(ctx, orderIDs)
+}
+
+func (rm *DryRunOrderReadModel) GetOrderStatuses(ctx context.Context, orderIDs []string) (map[string]OrderStatusDTO, error) {
+    return rm.live.GetOrderStatuses(ctx, orderIDs)
+}
+
+func (rm *DryRunOrderReadModel) InsertOrder(ctx context.Context, order *OrderDTO) error {
+    rm.recordOrder("InsertOrder", order)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) UpsertOrder(ctx context.Context, order *OrderDTO) error {
+    rm.recordOrder("UpsertOrder", order)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) ApplyOrder(ctx context.Context, order *OrderDTO) error {
+    rm.recordOrder("ApplyOrder", order)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) recordOrder(method string, order *OrderDTO) {
+    fields := jsonFields(order)
+    // Tags are kept by the admin API, not written by projections, and meta
+    // records when the live model wrote the row
+    delete(fields, "tags")
+    delete(fields, "meta")
+    summary := fmt.Sprintf("%s order for customer %s with %d items, grand total %s", order.Status, order.CustomerID, len(order.Items), order.GrandTotal)
+    rm.record(method, order.ID, summary, fields)
+}
+
+func (rm *DryRunOrderReadModel) SetStatus(ctx context.Context, orderID string, change StatusChange) error {
+    fields := jsonFields(struct {
+        Status          string            `json:"status"`
+        StatusChangedAt apijson.Timestamp `json:"status_changed_at"`
+        Version         int               `json:"version"`
+    }{change.Status, apijson.NewTimestamp(change.ChangedAt), change.Version})
+    rm.record("SetStatus", orderID, fmt.Sprintf("status to %s at version %d", change.Status, change.Version), fields)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) OverrideStatus(ctx context.Context, orderID, status string, changedAt time.Time) error {
+    fields := jsonFields(struct {
+        Status          string            `json:"status"`
+        StatusChangedAt apijson.Timestamp `json:"status_changed_at"`
+    }{status, apijson.NewTimestamp(changedAt)})
+    rm.record("OverrideStatus", orderID, "override status to "+status, fields)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) SetItemsAndTotal(ctx context.Context, orderID string, change ItemsChange) error {
+    fields := jsonFields(struct {
+        Items        []OrderItemDTO     `json:"items"`
+        TotalAmount  valueobjects.Money `json:"total_amount"`
+        ShippingCost valueobjects.Money `json:"shipping_cost"`
+        GrandTotal   valueobjects.Money `json:"grand_total"`
+        UpdatedAt    apijson.Timestamp  `json:"updated_at"`
+        Version      int                `json:"version"`
+    }{change.Items, change.TotalAmount, change.ShippingCost, change.GrandTotal, apijson.NewTimestamp(change.UpdatedAt), change.Version})
+    summary := fmt.Sprintf("%d items, grand total %s at version %d", len(change.Items), change.GrandTotal, change.Version)
+    rm.record("SetItemsAndTotal", orderID, summary, fields)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) SetShippingAddress(ctx context.Context, orderID string, change ShippingAddressChange) error {
+    fields := jsonFields(struct {
+        ShippingAddress valueobjects.Address `json:"shipping_address"`
+        ShippingCost    valueobjects.Money   `json:"shipping_cost"`
+        GrandTotal      valueobjects.Money   `json:"grand_total"`
+        UpdatedAt       apijson.Timestamp    `json:"updated_at"`
+        Version         int                  `json:"version"`
+    }{change.ShippingAddress, change.ShippingCost, change.GrandTotal, apijson.NewTimestamp(change.UpdatedAt), change.Version})
+    summary := fmt.Sprintf("shipping address, grand total %s at version %d", change.GrandTotal, change.Version)
+    rm.record("SetShippingAddress", orderID, summary, fields)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) SetCustomer(ctx context.Context, orderID string, change CustomerChange) error {
+    fields := jsonFields(struct {
+        CustomerID string            `json:"customer_id"`
+        UpdatedAt  apijson.Timestamp `json:"updated_at"`
+        Version    int               `json:"version"`
+    }{change.CustomerID, apijson.NewTimestamp(change.UpdatedAt), change.Version})
+    summary := fmt.Sprintf("customer %s to %s at version %d", change.PreviousCustomerID, change.CustomerID, change.Version)
+    rm.record("SetCustomer", orderID, summary, fields)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) DeleteOrder(ctx context.Context, orderID string) error {
+    rm.record("DeleteOrder", orderID, "delete order", nil)
+    return nil
+}
+
+// DeleteOrdersCreatedSince records the delete and reports nothing removed.
+func (rm *DryRunOrderReadModel) DeleteOrdersCreatedSince(ctx context.Context, since time.Time) (int64, error) {
+    rm.record("DeleteOrdersCreatedSince", "", fmt.Sprintf("delete orders created since %s", since.UTC().Format(time.RFC3339)), nil)
+    return 0, nil
+}
+
+func (rm *DryRunOrderReadModel) ListOrders(ctx context.Context, filter OrderFilter, page pagination.Pagination) ([]*OrderDTO, error) {
+    return rm.live.ListOrders(ctx, filter, page)
+}
+
+func (rm *DryRunOrderReadModel) ListOrderSummaries(ctx context.Context, filter OrderFilter, page pagination.Pagination) ([]*OrderSummaryDTO, error) {
+    return rm.live.ListOrderSummaries(ctx, filter, page)
+}
+
+func (rm *DryRunOrderReadModel) AddTag(ctx context.Context, orderID, tag string) error {
+    rm.record("AddTag", orderID, "add tag "+tag, nil)
+    return nil
+}
+
+func (rm *DryRunOrderReadModel) RemoveTag(ctx context.Context, orderID, tag string) error {
+    rm.record("RemoveTag", orderID, "remove tag "+tag, nil)
+    return nil
+}
+
+// CacheCustomerOrders reloads the live cache from the live read model; it
+// changes no read model state.
+func (rm *DryRunOrderReadModel) CacheCustomerOrders(ctx context.Context, customerID string) error {
+    return rm.live.CacheCustomerOrders(ctx, customerID)
+}
+
+func (rm *DryRunOrderReadModel) GetOrderAnalytics(ctx context.Context, window timewindow.Window, includeShipping bool) (*OrderAnalyticsDTO, error) {
+    return rm.live.GetOrderAnalytics(ctx, window, includeShipping)
+}
+
+func (rm *DryRunOrderReadModel) CompareOrderAnalytics(ctx context.Context, window timewindow.Window, includeShipping bool) (*OrderComparisonDTO, error) {
+    return rm.live.CompareOrderAnalytics(ctx, window, includeShipping)
+}
+
+func (rm *DryRunOrderReadModel) GetOrderValueDistribution(ctx context.Context, window timewindow.Window, bounds []int64) (*OrderValueDistributionDTO, error) {
+    return rm.live.GetOrderValueDistribution(ctx, window, bounds)
+}
+
+func (rm *DryRunOrderReadModel) GetProductSalesTimeSeries(ctx context.Context, productID string, from, to time.Time, bucket string) (*ProductSalesTimeSeriesDTO, error) {
+    return rm.live.GetProductSalesTimeSeries(ctx, productID, from, to, bucket)
+}
+
+func (rm *DryRunOrderReadModel) ListOrderChanges(ctx context.Context, since time.Time, afterID string, limit int) (*OrderChangesDTO, error) {
+    return rm.live.ListOrderChanges(ctx, since, afterID, limit)
+}
+
+func (rm *DryRunOrderReadModel) GetStatusDurations(ctx context.Context, window timewindow.Window) (*StatusDurationsDTO, error) {
+    return rm.live.GetStatusDurations(ctx, window)
+}
+
+func (rm *DryRunOrderReadModel) FindTotalDiscrepancies(ctx context.Context, limit int) ([]*TotalDiscrepancyDTO, error) {
+    return rm.live.FindTotalDiscrepancies(ctx, limit)
+}
+
+func (rm *DryRunOrderReadModel) FindCorruptOrders(ctx context.Context, limit int) ([]*CorruptOrderDTO, error) {
+    return rm.live.FindCorruptOrders(ctx, limit)
+}
+
+func (rm *DryRunOrderReadModel) CountOrdersByStatus(ctx context.Context) (map[string]int64, error) {
+    return rm.live.CountOrdersByStatus(ctx)
+}
+
+func (rm *DryRunOrderReadModel) ListOrderIDs(ctx context.Context, after string, limit int) ([]string, error) {
+    return rm.live.ListOrderIDs(ctx, after, limit)
+}
+
+// ArchiveOrders records the archiving and reports nothing moved.
+func (rm *DryRunOrderReadModel) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int64, error) {
+    rm.record("ArchiveOrders", "", fmt.Sprintf("archive up to %d orders delivered or cancelled before %s", limit, before.UTC().Format(time.RFC3339)), nil)
+    return 0, nil
+}
+
+// AnonymizeOrders records the anonymization, without the subject's
+// contact email, and reports nothing scrubbed.
+func (rm *DryRunOrderReadModel) AnonymizeOrders(ctx context.Context, subject DataSubject) (int64, error) {
+    if err := subject.Validate(); err != nil {
+        return 0, err
+    }
+    summary := "anonymize the orders of a guest contact email"
+    if subject.CustomerID != "" {
+        summary = "anonymize the orders of customer " + subject.CustomerID
+    }
+    rm.record("AnonymizeOrders", "", summary, nil)
+    return 0, nil
+}
@@ -0,0 +1,175 @@
+package readmodels
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// liveOrders is a live read model that can only be read: any write reaching
+// it calls the nil embedded OrderReadModel and panics.
+type liveOrders struct {
+    OrderReadModel
+    orders map[string]OrderDTO
+}
+
+func (rm *liveOrders) GetOrder(_ context.Context, orderID string) (*OrderDTO, error) {
+    order, ok := rm.orders[orderID]
+    if !ok {
+        return nil, ErrOrderNotFound
+    }
+    return &order, nil
+}
+
+func liveOrder(id string, status valueobjects.OrderStatus, version int, changedAt time.Time) OrderDTO {
+    return OrderDTO{
+        ID:              id,
+        CustomerID:      "customer-1",
+        Status:          status.String(),
+        TotalAmount:     valueobjects.NewMoney(2000, "USD"),
+        ShippingCost:    valueobjects.NewMoney(500, "USD"),
+        GrandTotal:      valueobjects.NewMoney(2500, "USD"),
+        Channel:         "web",
+        Items:           []OrderItemDTO{},
+        Version:         version,
+        StatusChangedAt: apijson.NewTimestamp(changedAt),
+        CreatedAt:       apijson.NewTimestamp(changedAt),
+        UpdatedAt:       apijson.NewTimestamp(changedAt),
+        Tags:            []string{"vip"},
+    }
+}
+
+// Every write is recorded and none reaches the live read model.
+func TestDryRunOrderReadModel_writesAreNotApplied(t *testing.T) {
+    ctx := context.Background()
+    rm := NewDryRunOrderReadModel(&liveOrders{}, 0)
+    at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    order := liveOrder(uuid.NewString(), valueobjects.OrderStatusDraft, 1, at)
+    
+    writes := []struct {
+        method string
+        write  func() error
+    }{
+        {"InsertOrder", func() error { return rm.InsertOrder(ctx, &order) }},
+        {"UpsertOrder", func() error { return rm.UpsertOrder(ctx, &order) }},
+        {"ApplyOrder", func() error { return rm.ApplyOrder(ctx, &order) }},
+        {"SetStatus", func() error {
+            return rm.SetStatus(ctx, order.ID, StatusChange{Status: "confirmed", ChangedAt: at, Version: 2})
+        }},
+        {"OverrideStatus", func() error { return rm.OverrideStatus(ctx, order.ID, "shipped", at) }},
+        {"SetItemsAndTotal", func() error { return rm.SetItemsAndTotal(ctx, order.ID, ItemsChange{Version: 3}) }},
+        {"SetShippingAddress", func() error { return rm.SetShippingAddress(ctx, order.ID, ShippingAddressChange{Version: 4}) }},
+        {"SetCustomer", func() error { return rm.SetCustomer(ctx, order.ID, CustomerChange{CustomerID: "customer-2", Version: 5}) }},
+        {"AddTag", func() error { return rm.AddTag(ctx, order.ID, "vip") }},
+        {"RemoveTag", func() error { return rm.RemoveTag(ctx, order.ID, "vip") }},
+        {"DeleteOrder", func() error { return rm.DeleteOrder(ctx, order.ID) }},
+        {"DeleteOrdersCreatedSince", func() error { _, err := rm.DeleteOrdersCreatedSince(ctx, at); return err }},
+        {"ArchiveOrders", func() error { _, err := rm.ArchiveOrders(ctx, at, 10); return err }},
+        {"AnonymizeOrders", func() error { _, err := rm.AnonymizeOrders(ctx, DataSubject{CustomerID: uuid.NewString()}); return err }},
+    }
+    
+    var want []string
+    for _, w := range writes {
+        if err := w.write(); err != nil {
+            t.Fatalf("%s() = %v", w.method, err)
+        }
+        want = append([]string{w.method}, want...)
+    }
+    var got []string
+    for _, mutation := range rm.Mutations(0) {
+        got = append(got, mutation.Method)
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("recorded %v, want %v", got, want)
+    }
+}
+
+// The log keeps the newest size mutations, newest first.
+func TestDryRunOrderReadModel_Mutations(t *testing.T) {
+    ctx := context.Background()
+    rm := NewDryRunOrderReadModel(&liveOrders{}, 3)
+    for _, id := range []string{"a", "b", "c", "d", "e"} {
+        rm.DeleteOrder(ctx, id)
+    }
+    
+    tests := []struct {
+        limit int
+        want  []string
+    }{
+        {limit: 0, want: []string{"e", "d", "c"}},
+        {limit: 2, want: []string{"e", "d"}},
+        {limit: 10, want: []string{"e", "d", "c"}},
+    }
+    
+    for _, tt := range tests {
+        var got []string
+        for _, mutation := range rm.Mutations(tt.limit) {
+            got = append(got, mutation.OrderID)
+        }
+        if !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("Mutations(%d) = %v, want %v", tt.limit, got, tt.want)
+        }
+    }
+}
+
+func TestDryRunOrderReadModel_Compare(t *testing.T) {
+    ctx := context.Background()
+    at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    same, differs, superseded, missing := uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString()
+    live := &liveOrders{orders: map[string]OrderDTO{
+        same:       liveOrder(same, valueobjects.OrderStatusConfirmed, 2, at),
+        differs:    liveOrder(differs, valueobjects.OrderStatusConfirmed, 2, at),
+        superseded: liveOrder(superseded, valueobjects.OrderStatusShipped, 3, at),
+    }}
+    rm := NewDryRunOrderReadModel(live, 0)
+    
+    sameOrder := live.orders[same]
+    // Tags are not the projection's to write, so they do not count
+    sameOrder.Tags = nil
+    rm.ApplyOrder(ctx, &sameOrder)
+    rm.SetStatus(ctx, differs, StatusChange{Status: valueobjects.OrderStatusCancelled.String(), ChangedAt: at, Version: 2})
+    rm.SetStatus(ctx, superseded, StatusChange{Status: valueobjects.OrderStatusConfirmed.String(), ChangedAt: at, Version: 2})
+    rm.SetStatus(ctx, missing, StatusChange{Status: valueobjects.OrderStatusConfirmed.String(), ChangedAt: at, Version: 2})
+    rm.DeleteOrder(ctx, missing)
+    rm.DeleteOrdersCreatedSince(ctx, at)
+    
+    comparisons, err := rm.Compare(ctx, 0)
+    if err != nil {
+        t.Fatalf("Compare() = %v", err)
+    }
+    type result struct {
+        Method      string
+        OrderID     string
+        Matches     bool
+        LiveMissing bool
+        Superseded  bool
+        Differences map[string]FieldDifference
+    }
+    var got []result
+    for _, c := range comparisons {
+        got = append(got, result{c.Method, c.OrderID, c.Matches, c.LiveMissing, c.Superseded, c.Differences})
+    }
+    want := []result{
+        {Method: "DeleteOrdersCreatedSince"},
+        {Method: "DeleteOrder", OrderID: missing, Matches: true, LiveMissing: true},
+        {Method: "SetStatus", OrderID: missing, LiveMissing: true, Differences: map[string]FieldDifference{
+            "status":            {DryRun: "confirmed"},
+            "status_changed_at": {DryRun: "2024-03-01T12:00:00.000Z"},
+            "version":           {DryRun: 2.0},
+        }},
+        {Method: "SetStatus", OrderID: superseded, Superseded: true},
+        {Method: "SetStatus", OrderID: differs, Differences: map[string]FieldDifference{
+            "status": {DryRun: "cancelled", Live: "confirmed"},
+        }},
+        {Method: "ApplyOrder", OrderID: same, Matches: true},
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("Compare() =\n%+v\nwant\n%+v", got, want)
+    }
+}
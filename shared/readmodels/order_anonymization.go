@@ -0,0 +1,142 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Statement names recorded by sqlmetrics
+const queryAnonymizeOrders = "order_read_models.anonymize"
+
+// ErrInvalidDataSubject is returned by AnonymizeOrders for a subject that
+// names neither a customer nor a contact email, or both.
+var ErrInvalidDataSubject = errors.New("name either a customer_id or a contact_email")
+
+// DataSubject is the person whose personal data AnonymizeOrders scrubs: a
+// registered customer, or the guest who checked out with a contact email.
+type DataSubject struct {
+    CustomerID   string
+    ContactEmail string
+}
+
+// Validate checks that the subject names a valid customer id or contact
+// email, and not both.
+func (s DataSubject) Validate() error {
+    _, _, err := s.condition()
+    return err
+}
+
+// condition returns the column matching the subject's orders and the value
+// it must have.
+func (s DataSubject) condition() (string, string, error) {
+    switch {
+    case (s.CustomerID == "") == (s.ContactEmail == ""):
+        return "", "", ErrInvalidDataSubject
+    case s.CustomerID != "":
+        if _, err := entities.ParseCustomerID(s.CustomerID); err != nil {
+            return "", "", err
+        }
+        return "customer_id", s.CustomerID, nil
+    default:
+        email, err := valueobjects.ParseEmail(s.ContactEmail)
+        if err != nil {
+            return "", "", fmt.Errorf("invalid contact_email: %w", err)
+        }
+        return "contact_email", email.String(), nil
+    }
+}
+
+// anonymizedOrder is the SET clause scrubbing an order row: the contact
+// email, the shipping address but for its country, which identifies no
+// one, and the name the delivery was signed by. updated_at moves so
+// incremental extracts pick the scrubbed order up.
+const anonymizedOrder = `
+            contact_email = NULL,
+            shipping_address = jsonb_build_object('street', '', 'city', '', 'state', '', 'zip', '', 'country', COALESCE(shipping_address->>'country', '')),
+            delivery = CASE WHEN jsonb_typeof(delivery) = 'object' THEN delivery || '{"signed_by": null}'::jsonb ELSE delivery END,
+            updated_at = $2`
+
+// anonymizedHistory scrubs the history entries of the orders in the
+// anonymized CTE whose details quote an address or a signature.
+const anonymizedHistory = `
+            UPDATE order_history
+            SET details = CASE event_type WHEN 'OrderShippingAddressChanged' THEN 'shipping address changed' ELSE '' END
+            WHERE order_id IN (SELECT id FROM anonymized) AND event_type IN ('OrderShippingAddressChanged', 'OrderDelivered')`
+
+// AnonymizeOrders scrubs the personal data of subject from its orders, live
+// and, WithArchive, archived, and from their history, in one statement. The
+// orders keep their ids, customer, items and totals, so the analytics are
+// unchanged. It returns how many orders were scrubbed; running it again
+// scrubs them again.
+//
+// Only the read models are scrubbed. The events they are projected from
+// still hold the data, so a replay or rebuild of the orders restores it
+// until the write side erases it too.
+func (rm *orderReadModel) AnonymizeOrders(ctx context.Context, subject DataSubject) (int64, error) {
+    column, value, err := subject.condition()
+    if err != nil {
+        return 0, err
+    }
+    
+    query := `
+        WITH anonymized AS (
+            UPDATE order_read_models SET ` + anonymizedOrder + `
+            WHERE ` + column + ` = $1
+            RETURNING id, customer_id
+        ), history AS (` + anonymizedHistory + `
+        )
+        SELECT id, customer_id FROM anonymized
+    `
+    if rm.archive {
+        query = `
+            WITH live AS (
+                UPDATE order_read_models SET ` + anonymizedOrder + `
+                WHERE ` + column + ` = $1
+                RETURNING id, customer_id
+            ), archived AS (
+                UPDATE order_read_models_archive SET ` + anonymizedOrder + `
+                WHERE ` + column + ` = $1
+                RETURNING id, customer_id
+            ), anonymized AS (
+                SELECT id, customer_id FROM live UNION ALL SELECT id, customer_id FROM archived
+            ), history AS (` + anonymizedHistory + `
+            )
+            SELECT id, customer_id FROM anonymized
+        `
+    }
+    
+    rows, err := rm.db.Query(ctx, queryAnonymizeOrders, query, value, clock.Now().UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to anonymize orders: %w", err)
+    }
+    defer rows.Close()
+    
+    var keys []string
+    var anonymized int64
+    customers := make(map[string]bool)
+    for rows.Next() {
+        var orderID, customerID string
+        if err := rows.Scan(&orderID, &customerID); err != nil {
+            return 0, fmt.Errorf("failed to scan anonymized order: %w", err)
+        }
+        keys = append(keys, rm.cache.orderKey(orderID))
+        if !customers[customerID] {
+            customers[customerID] = true
+            keys = append(keys, rm.cache.customerOrdersKey(customerID))
+        }
+        anonymized++
+    }
+    if err := rows.Err(); err != nil {
+        return 0, fmt.Errorf("failed to anonymize orders: %w", err)
+    }
+    
+    if len(keys) > 0 {
+        rm.cache.del(ctx, keys...)
+    }
+    return anonymized, nil
+}
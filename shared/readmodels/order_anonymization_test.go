@@ -0,0 +1,158 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+func TestDataSubject_Validate(t *testing.T) {
+    tests := []struct {
+        name    string
+        subject DataSubject
+        wantErr error
+        wantAny bool
+    }{
+        {name: "customer", subject: DataSubject{CustomerID: uuid.NewString()}},
+        {name: "contact email", subject: DataSubject{ContactEmail: "Buyer@Example.com"}},
+        {name: "neither", wantErr: ErrInvalidDataSubject},
+        {name: "both", subject: DataSubject{CustomerID: uuid.NewString(), ContactEmail: "buyer@example.com"}, wantErr: ErrInvalidDataSubject},
+        {name: "malformed customer", subject: DataSubject{CustomerID: "customer-1"}, wantErr: entities.ErrInvalidCustomerID},
+        {name: "malformed contact email", subject: DataSubject{ContactEmail: "buyer"}, wantAny: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := tt.subject.Validate()
+            if tt.wantAny {
+                if err == nil {
+                    t.Error("Validate() = nil, want an error")
+                }
+                return
+            }
+            if !errors.Is(err, tt.wantErr) {
+                t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+// The subject's orders lose their contact email, street address and
+// signature, live, archived and in their history; everything else, and
+// other people's orders, are left alone.
+func TestOrderReadModel_AnonymizeOrders(t *testing.T) {
+    signedBy := "J. Doe"
+    tests := []struct {
+        name    string
+        archive bool
+        // subject picks the data subject of the seeded order
+        subject func(order *OrderDTO) DataSubject
+    }{
+        {name: "by customer", subject: func(order *OrderDTO) DataSubject { return DataSubject{CustomerID: order.CustomerID} }},
+        {name: "by contact email", subject: func(*OrderDTO) DataSubject { return DataSubject{ContactEmail: "Buyer@Example.com"} }},
+        {name: "archived", archive: true, subject: func(order *OrderDTO) DataSubject { return DataSubject{CustomerID: order.CustomerID} }},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            rm, history := newTestReadModels(t, WithArchive(tt.archive))
+            order := seedOrder(t, rm)
+            other := *order
+            other.ID, other.CustomerID, other.ContactEmail, other.Tags = uuid.NewString(), uuid.NewString(), "someone@example.com", nil
+            if err := rm.InsertOrder(ctx, &other); err != nil {
+                t.Fatalf("InsertOrder() = %v", err)
+            }
+            
+            // The order is delivered long enough ago to be archived
+            deliveredAt := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+            delivery := &DeliveryDTO{DeliveredAt: timestampPtr(deliveredAt), SignedBy: &signedBy}
+            if err := rm.SetStatus(ctx, order.ID, StatusChange{Status: "delivered", ChangedAt: deliveredAt, Version: 3, EventType: "OrderDelivered", Delivery: delivery}); err != nil {
+                t.Fatalf("SetStatus() = %v", err)
+            }
+            if tt.archive {
+                if moved, err := rm.ArchiveOrders(ctx, deliveredAt.Add(time.Hour), 10); err != nil || moved != 1 {
+                    t.Fatalf("ArchiveOrders() = %d, %v, want 1 order moved", moved, err)
+                }
+            }
+            entries := []*OrderHistoryEntryDTO{
+                {OrderID: order.ID, EventType: "OrderShippingAddressChanged", Sequence: 2, Details: "shipping address changed to 1 Main St, Springfield, IL 62701, US"},
+                {OrderID: order.ID, EventType: "OrderDelivered", Sequence: 3, Details: "signed by " + signedBy},
+                {OrderID: order.ID, EventType: "OrderItemRemoved", Sequence: 4, Details: "removed product-2"},
+                {OrderID: other.ID, EventType: "OrderShippingAddressChanged", Sequence: 2, Details: "shipping address changed to 1 Main St, Springfield, IL 62701, US"},
+            }
+            for _, entry := range entries {
+                entry.OccurredAt = apijson.NewTimestamp(deliveredAt)
+                if err := history.AddEntry(ctx, entry); err != nil {
+                    t.Fatalf("AddEntry() = %v", err)
+                }
+            }
+            before, err := rm.GetOrder(ctx, order.ID)
+            if err != nil {
+                t.Fatalf("GetOrder() = %v", err)
+            }
+            otherBefore, err := rm.GetOrder(ctx, other.ID)
+            if err != nil {
+                t.Fatalf("GetOrder() = %v", err)
+            }
+            
+            anonymized, err := rm.AnonymizeOrders(ctx, tt.subject(order))
+            if err != nil {
+                t.Fatalf("AnonymizeOrders() = %v", err)
+            }
+            if anonymized != 1 {
+                t.Errorf("AnonymizeOrders() = %d, want 1", anonymized)
+            }
+            
+            // Read through the cache GetOrder filled above
+            after, err := rm.GetOrder(ctx, order.ID)
+            if err != nil {
+                t.Fatalf("GetOrder() = %v", err)
+            }
+            want := withoutTimestamps(before)
+            want.ContactEmail = ""
+            want.ShippingAddress = valueobjects.Address{Country: "US"}
+            want.Delivery = &DeliveryDTO{DeliveredAt: before.Delivery.DeliveredAt}
+            if got := withoutTimestamps(after); !reflect.DeepEqual(got, want) {
+                t.Errorf("anonymized order =\n%+v\nwant\n%+v", got, want)
+            }
+            if !after.UpdatedAt.Time.After(before.UpdatedAt.Time) {
+                t.Errorf("updated_at = %v, want it moved past %v", after.UpdatedAt, before.UpdatedAt)
+            }
+            if otherAfter, err := rm.GetOrder(ctx, other.ID); err != nil || otherAfter.ShippingAddress != otherBefore.ShippingAddress {
+                t.Errorf("other order = %+v, %v, want it left alone", otherAfter, err)
+            }
+            
+            wantDetails := map[string]string{
+                order.ID + " OrderShippingAddressChanged": "shipping address changed",
+                order.ID + " OrderDelivered":              "",
+                order.ID + " OrderItemRemoved":            "removed product-2",
+                other.ID + " OrderShippingAddressChanged": "shipping address changed to 1 Main St, Springfield, IL 62701, US",
+            }
+            for _, orderID := range []string{order.ID, other.ID} {
+                got, err := history.GetHistory(ctx, orderID)
+                if err != nil {
+                    t.Fatalf("GetHistory() = %v", err)
+                }
+                for _, entry := range got {
+                    if want := wantDetails[orderID+" "+entry.EventType]; entry.Details != want {
+                        t.Errorf("%s entry of order %s = %q, want %q", entry.EventType, orderID, entry.Details, want)
+                    }
+                }
+            }
+        })
+    }
+}
+
+func timestampPtr(t time.Time) *apijson.Timestamp {
+    ts := apijson.NewTimestamp(t)
+    return &ts
+}
@@ -0,0 +1,230 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// Statement names recorded by sqlmetrics
+const (
+    queryArchiveOrders  = "order_read_models.archive"
+    queryUnarchiveOrder = "order_read_models_archive.restore"
+    queryGetArchived    = "order_read_models_archive.get"
+)
+
+// OrderArchiveConfig configures the archiving of old delivered and
+// cancelled orders to the order_read_models_archive table.
+type OrderArchiveConfig struct {
+    // Disabled neither archives orders nor reads the archive
+    Disabled  bool
+    // MaxAge is how long an order stays live after it was delivered or
+    // cancelled
+    MaxAge    time.Duration
+    // Interval is how often orders are archived
+    Interval  time.Duration
+    // BatchSize is how many orders one statement moves
+    BatchSize int
+}
+
+// DefaultOrderArchiveConfig is disabled. Enabled, it archives orders a year
+// after they were delivered or cancelled, 500 at a time, every hour.
+var DefaultOrderArchiveConfig = OrderArchiveConfig{
+    Disabled:  true,
+    MaxAge:    365 * 24 * time.Hour,
+    Interval:  time.Hour,
+    BatchSize: 500,
+}
+
+// OrderArchiveConfigFromEnv reads ORDER_ARCHIVE_ENABLED,
+// ORDER_ARCHIVE_MAX_AGE, ORDER_ARCHIVE_INTERVAL and
+// ORDER_ARCHIVE_BATCH_SIZE, falling back to DefaultOrderArchiveConfig.
+// Every service writing the read models must agree on ORDER_ARCHIVE_ENABLED.
+func OrderArchiveConfigFromEnv() OrderArchiveConfig {
+    cfg := DefaultOrderArchiveConfig
+    if enabled, err := strconv.ParseBool(os.Getenv("ORDER_ARCHIVE_ENABLED")); err == nil {
+        cfg.Disabled = !enabled
+    }
+    if value, err := time.ParseDuration(os.Getenv("ORDER_ARCHIVE_MAX_AGE")); err == nil && value > 0 {
+        cfg.MaxAge = value
+    }
+    if value, err := time.ParseDuration(os.Getenv("ORDER_ARCHIVE_INTERVAL")); err == nil && value > 0 {
+        cfg.Interval = value
+    }
+    if value, err := strconv.Atoi(os.Getenv("ORDER_ARCHIVE_BATCH_SIZE")); err == nil && value > 0 {
+        cfg.BatchSize = value
+    }
+    return cfg
+}
+
+// WithArchive makes the read model read orders moved to the
+// order_read_models_archive table by ArchiveOrders: GetOrder and GetOrders
+// fall back to it, listings include it when asked to, and the analytics
+// and reconciliation count its orders. A projection write to an archived
+// order restores it first; its tags cannot be changed while it is
+// archived. Without it the archive table is never touched and need not
+// exist.
+func WithArchive(enabled bool) OrderReadModelOption {
+    return func(rm *orderReadModel) {
+        rm.archive = enabled
+    }
+}
+
+// archivedOrderColumns are orderColumns read from the archive, whose rows
+// keep the tags the order had when it was archived.
+const archivedOrderColumns = `id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, channel, COALESCE(order_number, ''), items, version, status_changed_at, created_at, updated_at, tags::json, COALESCE(last_event_type, ''), projected_at, COALESCE(contact_email, ''), ` + deliveryColumn + `, ` + cancellationColumn + `, TRUE`
+
+// listedOrderColumns are the columns ListOrders reads from each table,
+// with whether the order is archived last.
+const (
+    listedOrderColumns         = `id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, channel, COALESCE(order_number, ''), items, version, status_changed_at, created_at, updated_at, ` + tagsColumn + `, COALESCE(contact_email, ''), ` + deliveryColumn + `, ` + cancellationColumn + `, FALSE`
+    listedArchivedOrderColumns = `id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, channel, COALESCE(order_number, ''), items, version, status_changed_at, created_at, updated_at, tags::json, COALESCE(contact_email, ''), ` + deliveryColumn + `, ` + cancellationColumn + `, TRUE`
+)
+
+// summaryColumns are the columns listOrderSummaries reads from both
+// tables, before whether the order is archived.
+const summaryColumns = `id, COALESCE(order_number, ''), customer_id, status, channel, total_amount, total_amount + shipping_cost, currency, item_count, created_at`
+
+// allOrders reads the live and archived orders together, with the columns
+// the analytics and reconciliation queries use.
+const allOrders = `(
+            SELECT id, status, channel, total_amount, shipping_cost, grand_total, currency, items, product_ids, cancellation, created_at FROM order_read_models
+            UNION ALL
+            SELECT id, status, channel, total_amount, shipping_cost, grand_total, currency, items, product_ids, cancellation, created_at FROM order_read_models_archive
+        )`
+
+// archivableStatuses are the statuses orders are archived in; no event
+// moves an order out of them but a redelivery or an operator's repair.
+var archivableStatuses = []string{string(valueobjects.OrderStatusDelivered), string(valueobjects.OrderStatusCancelled)}
+
+// allOrdersTable is the table the analytics and reconciliation read
+// orders from, under the live table's name so their queries count archived
+// orders unchanged.
+func (rm *orderReadModel) allOrdersTable() string {
+    if rm.archive {
+        return allOrders + ` AS order_read_models`
+    }
+    return "order_read_models"
+}
+
+// ArchiveOrders moves up to limit orders delivered or cancelled before
+// before to the archive, oldest first, with their tags, in one statement.
+// Orders locked by a projection write are left for the next run. It
+// returns how many orders were moved.
+func (rm *orderReadModel) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int64, error) {
+    if !rm.archive {
+        return 0, nil
+    }
+    
+    // The tags are read before the delete cascades to them, as every part
+    // of the statement sees the tables as they were when it started
+    query := `
+        WITH candidates AS (
+            SELECT id, ` + tagsColumn + `::jsonb AS tags
+            FROM order_read_models
+            WHERE status IN ($1, $2) AND status_changed_at < $3
+            ORDER BY status_changed_at
+            LIMIT $4
+            FOR UPDATE SKIP LOCKED
+        ), moved AS (
+            DELETE FROM order_read_models o
+            USING candidates c
+            WHERE o.id = c.id
+            RETURNING o.id, o.customer_id, o.status, o.total_amount, o.shipping_cost, o.grand_total, o.currency, o.shipping_address, o.items, o.version, o.status_changed_at, o.created_at, o.updated_at, o.channel, o.order_number, o.last_event_type, o.projected_at, o.contact_email, o.delivery, o.cancellation, c.tags
+        )
+        INSERT INTO order_read_models_archive (id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, items, version, status_changed_at, created_at, updated_at, channel, order_number, last_event_type, projected_at, contact_email, delivery, cancellation, tags, archived_at)
+        SELECT id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, items, version, status_changed_at, created_at, updated_at, channel, order_number, last_event_type, projected_at, contact_email, delivery, cancellation, tags, $5
+        FROM moved
+        RETURNING id, customer_id
+    `
+    
+    rows, err := rm.db.Query(ctx, queryArchiveOrders, query, archivableStatuses[0], archivableStatuses[1], before.UTC(), limit, clock.Now().UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to archive orders: %w", err)
+    }
+    defer rows.Close()
+    
+    var keys []string
+    var archived int64
+    customers := make(map[string]bool)
+    for rows.Next() {
+        var orderID, customerID string
+        if err := rows.Scan(&orderID, &customerID); err != nil {
+            return 0, fmt.Errorf("failed to scan archived order: %w", err)
+        }
+        keys = append(keys, rm.cache.orderKey(orderID))
+        if !customers[customerID] {
+            customers[customerID] = true
+            keys = append(keys, rm.cache.customerOrdersKey(customerID))
+        }
+        archived++
+    }
+    if err := rows.Err(); err != nil {
+        return 0, fmt.Errorf("failed to archive orders: %w", err)
+    }
+    
+    // Cached orders would still read as live
+    if len(keys) > 0 {
+        rm.cache.del(ctx, keys...)
+    }
+    return archived, nil
+}
+
+// getArchivedOrder reads an order from the archive, returning
+// sql.ErrNoRows when it is not there.
+func (rm *orderReadModel) getArchivedOrder(ctx context.Context, orderID string) (*OrderDTO, error) {
+    query := `
+        SELECT ` + archivedOrderColumns + `
+        FROM order_read_models_archive
+        WHERE id = $1
+    `
+    return scanOrder(rm.db.QueryRow(ctx, queryGetArchived, query, orderID))
+}
+
+// unarchive moves an order back from the archive with the tags it had,
+// reporting whether it was archived. Events for archived orders are rare,
+// but a write must not leave the order both live and archived.
+func (rm *orderReadModel) unarchive(ctx context.Context, orderID string) (bool, error) {
+    if !rm.archive {
+        return false, nil
+    }
+    
+    query := `
+        WITH restored AS (
+            DELETE FROM order_read_models_archive WHERE id = $1
+            RETURNING id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, items, version, status_changed_at, created_at, updated_at, channel, order_number, last_event_type, projected_at, contact_email, delivery, cancellation, tags
+        ), inserted AS (
+            INSERT INTO order_read_models (id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, items, version, status_changed_at, created_at, updated_at, channel, order_number, last_event_type, projected_at, contact_email, delivery, cancellation)
+            SELECT id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, items, version, status_changed_at, created_at, updated_at, channel, order_number, last_event_type, projected_at, contact_email, delivery, cancellation
+            FROM restored
+            RETURNING id, customer_id
+        ), tags AS (
+            INSERT INTO order_tags (order_id, tag, created_at)
+            SELECT inserted.id, t.tag, $2
+            FROM inserted
+            JOIN restored ON restored.id = inserted.id
+            CROSS JOIN LATERAL jsonb_array_elements_text(restored.tags) AS t(tag)
+        )
+        SELECT customer_id FROM inserted
+    `
+    
+    var customerID string
+    err := rm.db.QueryRow(ctx, queryUnarchiveOrder, query, orderID, clock.Now().UTC()).Scan(&customerID)
+    if errors.Is(err, sql.ErrNoRows) {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to restore archived order: %w", err)
+    }
+    
+    rm.invalidate(ctx, orderID)
+    rm.invalidateCustomerOrders(ctx, customerID)
+    return true, nil
+}
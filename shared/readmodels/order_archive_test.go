@@ -0,0 +1,116 @@
+package readmodels
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+// The analytics read orders through allOrdersTable, so archiving an order
+// changes none of them.
+func TestOrderReadModel_analyticsCountArchivedOrders(t *testing.T) {
+    ctx := context.Background()
+    rm, _ := newTestReadModels(t, WithArchive(true))
+    
+    // seedOrder creates an order on March 1 worth 3500 with shipping
+    order := seedOrder(t, rm)
+    deliveredAt := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+    if err := rm.SetStatus(ctx, order.ID, StatusChange{Status: "delivered", ChangedAt: deliveredAt, Version: 3, EventType: "OrderDelivered"}); err != nil {
+        t.Fatalf("SetStatus() = %v", err)
+    }
+    if moved, err := rm.ArchiveOrders(ctx, deliveredAt.Add(time.Hour), 10); err != nil || moved != 1 {
+        t.Fatalf("ArchiveOrders() = %d, %v, want 1 order moved", moved, err)
+    }
+    
+    window := timewindow.Window{
+        Period:   timewindow.Custom,
+        From:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+        To:       time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+        Location: time.UTC,
+    }
+    
+    analytics, err := rm.GetOrderAnalytics(ctx, window, true)
+    if err != nil {
+        t.Fatalf("GetOrderAnalytics() = %v", err)
+    }
+    if analytics.TotalOrders != 1 {
+        t.Errorf("GetOrderAnalytics() total orders = %d, want 1", analytics.TotalOrders)
+    }
+    
+    comparison, err := rm.CompareOrderAnalytics(ctx, window, true)
+    if err != nil {
+        t.Fatalf("CompareOrderAnalytics() = %v", err)
+    }
+    if got := comparison.Current.ByCurrency["USD"]; got.Orders != 1 || got.Revenue != 3500 {
+        t.Errorf("CompareOrderAnalytics() current USD = %+v, want 1 order worth 3500", got)
+    }
+    
+    distribution, err := rm.GetOrderValueDistribution(ctx, window, []int64{1000, 5000})
+    if err != nil {
+        t.Fatalf("GetOrderValueDistribution() = %v", err)
+    }
+    bands := distribution.ByCurrency["USD"]
+    if len(bands) != 3 || bands[0].Count != 0 || bands[1].Count != 1 || bands[2].Count != 0 {
+        t.Errorf("GetOrderValueDistribution() USD bands = %+v, want the order in (1000, 5000]", bands)
+    }
+}
+
+// With only some orders archived, the comparison and distribution totals
+// add the archived orders to the live ones rather than reading one table.
+func TestOrderReadModel_analyticsCountArchivedAndLiveOrders(t *testing.T) {
+    ctx := context.Background()
+    rm, _ := newTestReadModels(t, WithArchive(true))
+    
+    // Two orders stay live: one like the seeded order, one worth 8000
+    archived := seedOrder(t, rm)
+    for i, amount := range []int64{3000, 7500} {
+        order := *archived
+        order.ID = uuid.NewString()
+        order.OrderNumber = fmt.Sprintf("ORD-2024-%06d", i+2)
+        order.TotalAmount = valueobjects.NewMoney(amount, "USD")
+        order.GrandTotal = valueobjects.NewMoney(amount+500, "USD")
+        order.Tags = nil
+        if err := rm.InsertOrder(ctx, &order); err != nil {
+            t.Fatalf("InsertOrder() = %v", err)
+        }
+    }
+    deliveredAt := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+    if err := rm.SetStatus(ctx, archived.ID, StatusChange{Status: "delivered", ChangedAt: deliveredAt, Version: 3, EventType: "OrderDelivered"}); err != nil {
+        t.Fatalf("SetStatus() = %v", err)
+    }
+    if moved, err := rm.ArchiveOrders(ctx, deliveredAt.Add(time.Hour), 10); err != nil || moved != 1 {
+        t.Fatalf("ArchiveOrders() = %d, %v, want 1 order moved", moved, err)
+    }
+    
+    window := timewindow.Window{
+        Period:   timewindow.Custom,
+        From:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+        To:       time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+        Location: time.UTC,
+    }
+    
+    comparison, err := rm.CompareOrderAnalytics(ctx, window, true)
+    if err != nil {
+        t.Fatalf("CompareOrderAnalytics() = %v", err)
+    }
+    if got := comparison.Current.ByCurrency["USD"]; got.Orders != 3 || got.Revenue != 15000 {
+        t.Errorf("CompareOrderAnalytics() current USD = %+v, want 3 orders worth 15000", got)
+    }
+    if got := comparison.Deltas["USD"].Orders.Delta; got != 3 {
+        t.Errorf("CompareOrderAnalytics() USD orders delta = %d, want 3", got)
+    }
+    
+    distribution, err := rm.GetOrderValueDistribution(ctx, window, []int64{1000, 5000})
+    if err != nil {
+        t.Fatalf("GetOrderValueDistribution() = %v", err)
+    }
+    bands := distribution.ByCurrency["USD"]
+    if len(bands) != 3 || bands[0].Count != 0 || bands[1].Count != 2 || bands[2].Count != 1 {
+        t.Errorf("GetOrderValueDistribution() USD bands = %+v, want 2 orders in (1000, 5000] and 1 above", bands)
+    }
+}
@@ -0,0 +1,96 @@
+package readmodels
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Paging through the changes with small pages returns every order once,
+// in (updated_at, id) order, though seven of them share an update time.
+func TestOrderReadModel_ListOrderChanges(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    base := seedOrder(t, rm)
+    
+    // Microseconds are kept, so the shared time is compared at full precision
+    shared := time.Date(2024, 3, 1, 12, 5, 0, 123456000, time.UTC)
+    type change struct {
+        id        string
+        updatedAt time.Time
+    }
+    want := []change{{id: base.ID, updatedAt: base.UpdatedAt.Time}}
+    for i := 0; i < 10; i++ {
+        order := *base
+        order.ID = uuid.NewString()
+        order.OrderNumber = ""
+        order.Tags = nil
+        order.UpdatedAt.Time = shared
+        if i >= 7 {
+            order.UpdatedAt.Time = shared.Add(time.Duration(i) * time.Minute)
+        }
+        if i == 9 {
+            order.Status = "cancelled"
+        }
+        if err := rm.InsertOrder(ctx, &order); err != nil {
+            t.Fatalf("InsertOrder() = %v", err)
+        }
+        want = append(want, change{id: order.ID, updatedAt: order.UpdatedAt.Time})
+    }
+    sort.Slice(want, func(i, j int) bool {
+        if !want[i].updatedAt.Equal(want[j].updatedAt) {
+            return want[i].updatedAt.Before(want[j].updatedAt)
+        }
+        return want[i].id < want[j].id
+    })
+    
+    var got []change
+    var since time.Time
+    afterID := ""
+    for pages := 0; ; pages++ {
+        if pages > len(want) {
+            t.Fatalf("changes did not end after %d pages", pages)
+        }
+        page, err := rm.ListOrderChanges(ctx, since, afterID, 3)
+        if err != nil {
+            t.Fatalf("ListOrderChanges(%s, %q) = %v", since, afterID, err)
+        }
+        for _, order := range page.Orders {
+            got = append(got, change{id: order.ID, updatedAt: order.UpdatedAt.Time})
+            if order.ID == want[len(want)-1].id && order.Status != "cancelled" {
+                t.Errorf("cancelled order came back %s", order.Status)
+            }
+        }
+        if page.HasMore != (len(page.Orders) == 3) {
+            t.Errorf("page of %d orders has_more = %t", len(page.Orders), page.HasMore)
+        }
+        if since, err = time.Parse(time.RFC3339Nano, page.NextSince); err != nil {
+            t.Fatalf("next_since %q: %v", page.NextSince, err)
+        }
+        afterID = page.NextAfterID
+        if !page.HasMore {
+            break
+        }
+    }
+    
+    if len(got) != len(want) {
+        t.Fatalf("paged %d orders, want %d", len(got), len(want))
+    }
+    for i := range want {
+        if got[i].id != want[i].id || !got[i].updatedAt.Equal(want[i].updatedAt) {
+            t.Errorf("change %d = %s at %v, want %s at %v", i, got[i].id, got[i].updatedAt, want[i].id, want[i].updatedAt)
+        }
+    }
+    
+    // Past the end the watermark stays where it is
+    page, err := rm.ListOrderChanges(ctx, since, afterID, 3)
+    if err != nil {
+        t.Fatalf("ListOrderChanges() past the end = %v", err)
+    }
+    if len(page.Orders) != 0 || page.HasMore || page.NextAfterID != afterID || page.NextSince != since.Format(time.RFC3339Nano) {
+        t.Errorf("page past the end = %+v, want an empty page at %s, %s", page, since.Format(time.RFC3339Nano), afterID)
+    }
+}
@@ -0,0 +1,159 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+// ErrInvalidComparisonPeriod is returned for comparing all time, which has
+// no period before it.
+var ErrInvalidComparisonPeriod = errors.New("invalid comparison period")
+
+// OrderComparisonDTO compares the order metrics of two periods, by
+// currency. A currency with orders in only one window appears in both,
+// with zero metrics in the other.
+type OrderComparisonDTO struct {
+    Period   string                       `json:"period"`
+    Current  PeriodMetricsDTO             `json:"current"`
+    Previous PeriodMetricsDTO             `json:"previous"`
+    Deltas   map[string]CurrencyDeltasDTO `json:"deltas"`
+}
+
+// PeriodMetricsDTO holds the metrics of one comparison window.
+type PeriodMetricsDTO struct {
+    Start      apijson.Timestamp             `json:"start"`
+    End        apijson.Timestamp             `json:"end"`
+    ByCurrency map[string]CurrencyMetricsDTO `json:"by_currency"`
+}
+
+// CurrencyMetricsDTO holds the metrics of the orders in one currency.
+// Amounts are in the currency's minor units.
+type CurrencyMetricsDTO struct {
+    Orders            int64 `json:"orders"`
+    Revenue           int64 `json:"revenue"`
+    AverageOrderValue int64 `json:"average_order_value"`
+}
+
+// CurrencyDeltasDTO holds how each metric of a currency changed.
+type CurrencyDeltasDTO struct {
+    Orders            MetricDeltaDTO `json:"orders"`
+    Revenue           MetricDeltaDTO `json:"revenue"`
+    AverageOrderValue MetricDeltaDTO `json:"average_order_value"`
+}
+
+// MetricDeltaDTO is the change of a metric from the previous window.
+// PercentChange is nil when the previous value is zero.
+type MetricDeltaDTO struct {
+    Delta         int64    `json:"delta"`
+    PercentChange *float64 `json:"percent_change"`
+}
+
+func newMetricDelta(current, previous int64) MetricDeltaDTO {
+    delta := MetricDeltaDTO{Delta: current - previous}
+    if previous != 0 {
+        percent := float64(current-previous) / float64(previous) * 100
+        delta.PercentChange = &percent
+    }
+    return delta
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryOrderComparison = "order_read_models.comparison"
+)
+
+// CompareOrderAnalytics compares the orders created in window with those
+// of window.Previous: the whole day, ISO week or month before a preset's,
+// or the range of the same length before a custom window. Revenue includes
+// shipping unless includeShipping is false. Archived orders count too, as
+// in GetOrderAnalytics.
+func (rm *orderReadModel) CompareOrderAnalytics(ctx context.Context, window timewindow.Window, includeShipping bool) (*OrderComparisonDTO, error) {
+    if window.Unbounded() {
+        return nil, fmt.Errorf("%w: %q", ErrInvalidComparisonPeriod, window.Period)
+    }
+    
+    comparison := &OrderComparisonDTO{Period: string(window.Period)}
+    for _, side := range []struct {
+        window  timewindow.Window
+        metrics *PeriodMetricsDTO
+    }{
+        {window, &comparison.Current},
+        {window.Previous(), &comparison.Previous},
+    } {
+        byCurrency, err := rm.currencyMetrics(ctx, side.window, includeShipping)
+        if err != nil {
+            return nil, err
+        }
+        *side.metrics = PeriodMetricsDTO{
+            Start:      apijson.NewTimestamp(side.window.From),
+            End:        apijson.NewTimestamp(side.window.To),
+            ByCurrency: byCurrency,
+        }
+    }
+    
+    // Both sides list every currency seen in either window
+    for currency := range comparison.Current.ByCurrency {
+        if _, ok := comparison.Previous.ByCurrency[currency]; !ok {
+            comparison.Previous.ByCurrency[currency] = CurrencyMetricsDTO{}
+        }
+    }
+    for currency := range comparison.Previous.ByCurrency {
+        if _, ok := comparison.Current.ByCurrency[currency]; !ok {
+            comparison.Current.ByCurrency[currency] = CurrencyMetricsDTO{}
+        }
+    }
+    
+    comparison.Deltas = make(map[string]CurrencyDeltasDTO, len(comparison.Current.ByCurrency))
+    for currency, cur := range comparison.Current.ByCurrency {
+        prev := comparison.Previous.ByCurrency[currency]
+        comparison.Deltas[currency] = CurrencyDeltasDTO{
+            Orders:            newMetricDelta(cur.Orders, prev.Orders),
+            Revenue:           newMetricDelta(cur.Revenue, prev.Revenue),
+            AverageOrderValue: newMetricDelta(cur.AverageOrderValue, prev.AverageOrderValue),
+        }
+    }
+    
+    return comparison, nil
+}
+
+// currencyMetrics reports the orders created in window, archived orders
+// included, by currency.
+func (rm *orderReadModel) currencyMetrics(ctx context.Context, window timewindow.Window, includeShipping bool) (map[string]CurrencyMetricsDTO, error) {
+    revenue := "total_amount + shipping_cost"
+    if !includeShipping {
+        revenue = "total_amount"
+    }
+    whereClause, args := window.WhereClause("created_at", 1)
+    
+    query := fmt.Sprintf(`
+        SELECT currency, COUNT(*), COALESCE(SUM(%s), 0)
+        FROM %s
+        WHERE %s
+        GROUP BY currency
+    `, revenue, rm.allOrdersTable(), whereClause)
+    
+    rows, err := rm.db.Query(ctx, queryOrderComparison, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get comparison analytics: %w", err)
+    }
+    defer rows.Close()
+    
+    byCurrency := make(map[string]CurrencyMetricsDTO)
+    for rows.Next() {
+        var currency string
+        var metrics CurrencyMetricsDTO
+        if err := rows.Scan(&currency, &metrics.Orders, &metrics.Revenue); err != nil {
+            return nil, fmt.Errorf("failed to scan comparison analytics: %w", err)
+        }
+        if metrics.Orders > 0 {
+            metrics.AverageOrderValue = metrics.Revenue / metrics.Orders
+        }
+        byCurrency[currency] = metrics
+    }
+    
+    return byCurrency, rows.Err()
+}
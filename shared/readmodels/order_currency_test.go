@@ -0,0 +1,85 @@
+package readmodels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+// seedYenOrder inserts a copy of a seedOrder order for customerID, priced
+// in yen.
+func seedYenOrder(t *testing.T, rm OrderReadModel, customerID string) *OrderDTO {
+    t.Helper()
+    order := *seedOrder(t, rm)
+    order.ID = uuid.NewString()
+    order.OrderNumber = "ORD-2024-000002"
+    order.CustomerID = customerID
+    order.Tags = nil
+    order.TotalAmount = valueobjects.NewMoney(30000, "JPY")
+    order.ShippingCost = valueobjects.NewMoney(0, "JPY")
+    order.GrandTotal = valueobjects.NewMoney(30000, "JPY")
+    order.Items = []OrderItemDTO{{ProductID: "product-1", Quantity: 3, Price: valueobjects.NewMoney(10000, "JPY")}}
+    if err := rm.InsertOrder(context.Background(), &order); err != nil {
+        t.Fatalf("InsertOrder() = %v", err)
+    }
+    return &order
+}
+
+// Orders keep the currency of their totals, which the analytics group by.
+func TestOrderReadModel_currency(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    customerID := uuid.NewString()
+    yen := seedYenOrder(t, rm, customerID)
+    
+    stored, err := rm.GetOrder(ctx, yen.ID)
+    if err != nil {
+        t.Fatalf("GetOrder() = %v", err)
+    }
+    if stored.TotalAmount != yen.TotalAmount || stored.GrandTotal != yen.GrandTotal || stored.ShippingCost.Currency != "JPY" {
+        t.Errorf("GetOrder() totals = %v, %v, %v, want them in JPY", stored.TotalAmount, stored.ShippingCost, stored.GrandTotal)
+    }
+    
+    summaries, err := rm.ListOrderSummaries(ctx, OrderFilter{CustomerID: customerID}, pagination.Pagination{Limit: 10})
+    if err != nil {
+        t.Fatalf("ListOrderSummaries() = %v", err)
+    }
+    if len(summaries) != 1 || summaries[0].Currency != "JPY" {
+        t.Errorf("ListOrderSummaries() = %+v, want the order in JPY", summaries)
+    }
+    
+    window := timewindow.Window{
+        Period:   timewindow.Custom,
+        From:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+        To:       time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+        Location: time.UTC,
+    }
+    comparison, err := rm.CompareOrderAnalytics(ctx, window, true)
+    if err != nil {
+        t.Fatalf("CompareOrderAnalytics() = %v", err)
+    }
+    // seedYenOrder seeds a USD order from seedOrder too
+    if got := comparison.Current.ByCurrency["USD"]; got.Orders != 1 || got.Revenue != 3500 {
+        t.Errorf("CompareOrderAnalytics() current USD = %+v, want 1 order worth 3500", got)
+    }
+    if got := comparison.Current.ByCurrency["JPY"]; got.Orders != 1 || got.Revenue != 30000 {
+        t.Errorf("CompareOrderAnalytics() current JPY = %+v, want 1 order worth 30000", got)
+    }
+    
+    distribution, err := rm.GetOrderValueDistribution(ctx, window, []int64{1000, 5000})
+    if err != nil {
+        t.Fatalf("GetOrderValueDistribution() = %v", err)
+    }
+    if bands := distribution.ByCurrency["USD"]; len(bands) != 3 || bands[1].Count != 1 {
+        t.Errorf("GetOrderValueDistribution() USD bands = %+v, want the order in (1000, 5000]", bands)
+    }
+    if bands := distribution.ByCurrency["JPY"]; len(bands) != 3 || bands[2].Count != 1 {
+        t.Errorf("GetOrderValueDistribution() JPY bands = %+v, want the order above 5000", bands)
+    }
+}
@@ -0,0 +1,96 @@
+package readmodels
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// ErrCorruptOrder matches every *CorruptOrderError.
+var ErrCorruptOrder = errors.New("order read model row is corrupt")
+
+// CorruptOrderError reports an order row whose JSON column does not decode
+// into the order's shape, such as items stored as an object.
+type CorruptOrderError struct {
+    OrderID string
+    // Field is the column that failed: shipping_address, items, tags,
+    // delivery or cancellation
+    Field   string
+    Err     error
+}
+
+func (e *CorruptOrderError) Error() string {
+    return fmt.Sprintf("order %s has a corrupt %s column: %v", e.OrderID, e.Field, e.Err)
+}
+
+func (e *CorruptOrderError) Unwrap() error {
+    return e.Err
+}
+
+func (e *CorruptOrderError) Is(target error) bool {
+    return target == ErrCorruptOrder
+}
+
+// CorruptOrderDTO is an order found by FindCorruptOrders.
+type CorruptOrderDTO struct {
+    OrderID string `json:"order_id"`
+    Field   string `json:"field"`
+    Error   string `json:"error"`
+}
+
+// corruptRowStats is published as the "order_read_model_corrupt_rows"
+// expvar: corrupt rows met by reads, by column.
+var corruptRowStats = expvar.NewMap("order_read_model_corrupt_rows")
+
+// OrderReadModelOption configures NewOrderReadModel.
+type OrderReadModelOption func(*orderReadModel)
+
+// WithStrictDecoding makes ListOrders fail on a corrupt row instead of
+// leaving it out of the page.
+func WithStrictDecoding(strict bool) OrderReadModelOption {
+    return func(rm *orderReadModel) {
+        rm.strict = strict
+    }
+}
+
+// StrictDecodingFromEnv reads ORDER_READ_MODEL_STRICT; corrupt rows are
+// skipped unless it is true.
+func StrictDecodingFromEnv() bool {
+    strict, _ := strconv.ParseBool(os.Getenv("ORDER_READ_MODEL_STRICT"))
+    return strict
+}
+
+// decodeOrderJSON fills the order's JSON columns, returning a
+// *CorruptOrderError naming the first one that does not decode.
+func decodeOrderJSON(order *OrderDTO, shippingAddressJSON, itemsJSON, tagsJSON, deliveryJSON, cancellationJSON []byte) error {
+    columns := []struct {
+        field string
+        data  []byte
+        into  interface{}
+    }{
+        {"shipping_address", shippingAddressJSON, &order.ShippingAddress},
+        {"items", itemsJSON, &order.Items},
+        {"tags", tagsJSON, &order.Tags},
+        {"delivery", deliveryJSON, &order.Delivery},
+        {"cancellation", cancellationJSON, &order.Cancellation},
+    }
+    for _, column := range columns {
+        if err := json.Unmarshal(column.data, column.into); err != nil {
+            return &CorruptOrderError{OrderID: order.ID, Field: column.field, Err: err}
+        }
+    }
+    return nil
+}
+
+// corruptRow counts a corrupt row and logs it unless the caller fails with
+// it.
+func corruptRow(err *CorruptOrderError, skipped bool) {
+    corruptRowStats.Add(err.Field, 1)
+    if skipped {
+        log.Printf("Skipping corrupt order read model row: %v", err)
+    }
+}
@@ -0,0 +1,124 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// decodeOrderJSON names the first column that does not decode.
+func TestDecodeOrderJSON(t *testing.T) {
+    valid := map[string]string{
+        "shipping_address": `{"street": "1 Main St", "city": "Springfield", "zip": "62701", "country": "US"}`,
+        "items":            `[{"product_id": "product-1", "quantity": 1, "price": {"amount": 1000, "currency": "USD"}}]`,
+        "tags":             `["vip"]`,
+        "delivery":         `null`,
+        "cancellation":     `null`,
+    }
+    tests := []struct {
+        name      string
+        broken    map[string]string
+        wantField string
+    }{
+        {name: "valid"},
+        {name: "items as an object", broken: map[string]string{"items": `{"product_id": "product-1"}`}, wantField: "items"},
+        {name: "truncated address", broken: map[string]string{"shipping_address": `{"street": "1 Ma`}, wantField: "shipping_address"},
+        {name: "tags of numbers", broken: map[string]string{"tags": `[1, 2]`}, wantField: "tags"},
+        {name: "first of several", broken: map[string]string{"items": `"none"`, "tags": `{}`}, wantField: "items"},
+        {name: "delivery as a string", broken: map[string]string{"delivery": `"yesterday"`}, wantField: "delivery"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            column := func(field string) []byte {
+                if data, ok := tt.broken[field]; ok {
+                    return []byte(data)
+                }
+                return []byte(valid[field])
+            }
+            order := OrderDTO{ID: "order-1"}
+            err := decodeOrderJSON(&order, column("shipping_address"), column("items"), column("tags"), column("delivery"), column("cancellation"))
+            if tt.wantField == "" {
+                if err != nil || len(order.Items) != 1 || order.ShippingAddress.City != "Springfield" {
+                    t.Errorf("decodeOrderJSON() = %v, decoding %+v", err, order)
+                }
+                return
+            }
+            
+            var corrupt *CorruptOrderError
+            if !errors.As(err, &corrupt) || !errors.Is(err, ErrCorruptOrder) {
+                t.Fatalf("decodeOrderJSON() = %v, want a *CorruptOrderError", err)
+            }
+            if corrupt.OrderID != "order-1" || corrupt.Field != tt.wantField || corrupt.Err == nil {
+                t.Errorf("error = %+v, want order-1's %s", corrupt, tt.wantField)
+            }
+        })
+    }
+}
+
+func TestStrictDecodingFromEnv(t *testing.T) {
+    for value, want := range map[string]bool{"": false, "true": true, "1": true, "false": false, "strict": false} {
+        t.Setenv("ORDER_READ_MODEL_STRICT", value)
+        if got := StrictDecodingFromEnv(); got != want {
+            t.Errorf("StrictDecodingFromEnv() with %q = %t, want %t", value, got, want)
+        }
+    }
+}
+
+// A row with broken JSON fails GetOrder with its id and column, is left out
+// of ListOrders unless decoding is strict, and is found by the scan.
+func TestOrderReadModel_corruptRows(t *testing.T) {
+    ctx := context.Background()
+    sqlDB := schematest.Open(t)
+    db := sqlmetrics.Wrap(sqlDB, 0)
+    cache := NewCache(nil, CacheConfig{Disabled: true})
+    rm := NewOrderReadModel(db, cache)
+    strict := NewOrderReadModel(db, cache, WithStrictDecoding(true))
+    
+    healthy := seedOrder(t, rm)
+    broken := *healthy
+    broken.ID = uuid.NewString()
+    broken.OrderNumber = "ORD-2024-000002"
+    if err := rm.InsertOrder(ctx, &broken); err != nil {
+        t.Fatalf("InsertOrder() = %v", err)
+    }
+    if _, err := sqlDB.ExecContext(ctx, `UPDATE order_read_models SET items = '{"product_id": "product-1"}' WHERE id = $1`, broken.ID); err != nil {
+        t.Fatalf("corrupting items: %v", err)
+    }
+    
+    _, err := rm.GetOrder(ctx, broken.ID)
+    var corrupt *CorruptOrderError
+    if !errors.As(err, &corrupt) || corrupt.OrderID != broken.ID || corrupt.Field != "items" {
+        t.Errorf("GetOrder() of the broken order = %v, want its items column corrupt", err)
+    }
+    if _, err := rm.GetOrder(ctx, healthy.ID); err != nil {
+        t.Errorf("GetOrder() of the healthy order = %v", err)
+    }
+    
+    filter := OrderFilter{CustomerID: healthy.CustomerID}
+    orders, err := rm.ListOrders(ctx, filter, pagination.Pagination{Limit: 10})
+    if err != nil || len(orders) != 1 || orders[0].ID != healthy.ID {
+        t.Errorf("ListOrders() = %d orders, %v, want the healthy order alone", len(orders), err)
+    }
+    if _, err := strict.ListOrders(ctx, filter, pagination.Pagination{Limit: 10}); !errors.As(err, &corrupt) || corrupt.OrderID != broken.ID {
+        t.Errorf("strict ListOrders() = %v, want the broken order's error", err)
+    }
+    
+    found, err := rm.FindCorruptOrders(ctx, 10)
+    if err != nil {
+        t.Fatalf("FindCorruptOrders() = %v", err)
+    }
+    if len(found) != 1 || found[0].OrderID != broken.ID || found[0].Field != "items" || found[0].Error == "" {
+        t.Errorf("FindCorruptOrders() = %+v, want the broken order's items", found)
+    }
+    if found, err := rm.FindCorruptOrders(ctx, 0); err != nil || !reflect.DeepEqual(found, []*CorruptOrderDTO(nil)) {
+        t.Errorf("FindCorruptOrders(0) = %+v, %v, want none", found, err)
+    }
+}
@@ -0,0 +1,106 @@
+package readmodels
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+var updateContracts = flag.Bool("update", false, "rewrite the contract files in testdata/contract")
+
+// contractOrder is a delivered order with every optional field set. Its
+// times are not in UTC and carry sub-millisecond digits, which the
+// encoding truncates rather than rounds.
+func contractOrder() *OrderDTO {
+    zone := time.FixedZone("UTC+7", 7*60*60)
+    at := func(day, hour int) apijson.Timestamp {
+        return apijson.NewTimestamp(time.Date(2024, 3, day, hour, 15, 30, 123999999, zone))
+    }
+    deliveredAt := at(4, 16)
+    signedBy := "J. Doe"
+    projectedAt := at(4, 17)
+    staleness := 2.5
+    
+    return &OrderDTO{
+        ID:              "5f8e4c1a-3b2d-4e6f-9a7b-1c2d3e4f5a6b",
+        OrderNumber:     "ORD-2024-000042",
+        CustomerID:      "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e",
+        Status:          "delivered",
+        TotalAmount:     valueobjects.NewMoney(3000, "USD"),
+        ShippingCost:    valueobjects.NewMoney(599, "USD"),
+        GrandTotal:      valueobjects.NewMoney(3599, "USD"),
+        ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+        Channel:         "web",
+        Items: []OrderItemDTO{
+            {ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")},
+            {ProductID: "product-2", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")},
+        },
+        Version:         5,
+        StatusChangedAt: deliveredAt,
+        CreatedAt:       at(1, 9),
+        UpdatedAt:       deliveredAt,
+        Tags:            []string{"vip"},
+        Delivery:        &DeliveryDTO{DeliveredAt: &deliveredAt, SignedBy: &signedBy},
+        Meta:            &OrderMetaDTO{LastAppliedVersion: 5, LastEventType: "OrderDelivered", ProjectedAt: &projectedAt, StalenessSeconds: &staleness},
+    }
+}
+
+// The contract files pin the exact bytes clients receive for an order in
+// each encoding. Run with -update after an intended change and review the
+// diff.
+func TestOrderDTO_contract(t *testing.T) {
+    tests := []struct {
+        file string
+        opts apijson.Options
+    }{
+        {file: "order.json"},
+        {file: "order_camel.json", opts: apijson.Options{CamelCase: true}},
+        {file: "order_money_display.json", opts: apijson.Options{MoneyDisplay: true}},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.file, func(t *testing.T) {
+            got, err := apijson.Marshal(contractOrder(), tt.opts)
+            if err != nil {
+                t.Fatalf("Marshal() = %v", err)
+            }
+            
+            path := filepath.Join("testdata", "contract", tt.file)
+            if *updateContracts {
+                if err := os.WriteFile(path, append(got, '\n'), 0o644); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            want, err := os.ReadFile(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if string(got)+"\n" != string(want) {
+                t.Errorf("Marshal() =\n%s\nwant\n%s", got, want)
+            }
+        })
+    }
+}
+
+// Staleness is counted from the projection's write; rows written before it
+// was recorded have none, and the original is left as it was.
+func TestOrderMetaDTO_WithStaleness(t *testing.T) {
+    projectedAt := apijson.NewTimestamp(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    meta := OrderMetaDTO{LastAppliedVersion: 3, LastEventType: "OrderShipped", ProjectedAt: &projectedAt}
+    
+    got := meta.WithStaleness(projectedAt.Add(1500 * time.Millisecond))
+    if got.StalenessSeconds == nil || *got.StalenessSeconds != 1.5 || got.LastEventType != "OrderShipped" {
+        t.Errorf("WithStaleness() = %+v, want 1.5s stale", got)
+    }
+    if meta.StalenessSeconds != nil {
+        t.Error("WithStaleness() changed the original")
+    }
+    if got := (OrderMetaDTO{LastAppliedVersion: 3}).WithStaleness(time.Now()); got.StalenessSeconds != nil {
+        t.Errorf("WithStaleness() without a projection time = %v, want none", *got.StalenessSeconds)
+    }
+}
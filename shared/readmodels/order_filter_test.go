@@ -0,0 +1,54 @@
+package readmodels
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderFilter_whereClause(t *testing.T) {
+    tests := []struct {
+        name      string
+        filter    OrderFilter
+        wantWhere string
+        wantArgs  []interface{}
+    }{
+        {name: "no filter"},
+        {
+            name:      "product",
+            filter:    OrderFilter{ProductID: "product-1"},
+            wantWhere: "WHERE product_ids @> jsonb_build_array($1::text)",
+            wantArgs:  []interface{}{"product-1"},
+        },
+        {
+            name:      "order number",
+            filter:    OrderFilter{Number: "ORD-2024-000123"},
+            wantWhere: "WHERE order_number = $1",
+            wantArgs:  []interface{}{"ORD-2024-000123"},
+        },
+        {
+            name:      "customer, tag and product",
+            filter:    OrderFilter{CustomerID: "customer-1", Tag: "vip", ProductID: "product-1"},
+            wantWhere: "WHERE customer_id = $1 AND id IN (SELECT order_id FROM order_tags WHERE tag = $2) AND product_ids @> jsonb_build_array($3::text)",
+            wantArgs:  []interface{}{"customer-1", "vip", "product-1"},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            where, args := tt.filter.whereClause()
+            if where != tt.wantWhere || !reflect.DeepEqual(args, tt.wantArgs) {
+                t.Errorf("whereClause() = %q, %v, want %q, %v", where, args, tt.wantWhere, tt.wantArgs)
+            }
+        })
+    }
+}
+
+// The archive keeps each order's tags in a column, so its clause matches
+// tags by containment with the same placeholders.
+func TestOrderFilter_archiveWhereClause(t *testing.T) {
+    filter := OrderFilter{Tag: "vip", ProductID: "product-1"}
+    want := "WHERE tags @> jsonb_build_array($1::text) AND product_ids @> jsonb_build_array($2::text)"
+    if got := filter.archiveWhereClause(); got != want {
+        t.Errorf("archiveWhereClause() = %q, want %q", got, want)
+    }
+}
@@ -0,0 +1,101 @@
+package readmodels
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+type OrderHistoryReadModel interface {
+    AddEntry(ctx context.Context, entry *OrderHistoryEntryDTO) error
+    GetHistory(ctx context.Context, orderID string) ([]*OrderHistoryEntryDTO, error)
+}
+
+// OrderHistoryEntryDTO is one event in an order's history. Sequence is the
+// event's version in the event store and orders the history; it is zero for
+// events published before events carried one.
+type OrderHistoryEntryDTO struct {
+    OrderID    string            `json:"order_id"`
+    EventType  string            `json:"event_type"`
+    Sequence   int               `json:"sequence,omitempty"`
+    Details    string            `json:"details,omitempty"`
+    OccurredAt apijson.Timestamp `json:"occurred_at"`
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryAddHistoryEntry = "order_history.add"
+    queryGetHistory      = "order_history.get"
+)
+
+type orderHistoryReadModel struct {
+    db *sqlmetrics.DB
+}
+
+func NewOrderHistoryReadModel(db *sqlmetrics.DB) OrderHistoryReadModel {
+    return &orderHistoryReadModel{db: db}
+}
+
+func (rm *orderHistoryReadModel) AddEntry(ctx context.Context, entry *OrderHistoryEntryDTO) error {
+    // Redelivered events produce the same entry, which the unique key drops.
+    // The sequence keeps apart events of one type sharing a timestamp.
+    query := `
+        INSERT INTO order_history (order_id, event_type, sequence, details, occurred_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (order_id, event_type, occurred_at, sequence) DO NOTHING
+    `
+    
+    _, err := rm.db.Exec(ctx, queryAddHistoryEntry, query,
+        entry.OrderID,
+        entry.EventType,
+        entry.Sequence,
+        entry.Details,
+        entry.OccurredAt,
+    )
+    
+    if err != nil {
+        return fmt.Errorf("failed to add history entry: %w", err)
+    }
+    
+    return nil
+}
+
+func (rm *orderHistoryReadModel) GetHistory(ctx context.Context, orderID string) ([]*OrderHistoryEntryDTO, error) {
+    if _, err := entities.ParseOrderID(orderID); err != nil {
+        return nil, err
+    }
+    
+    query := `
+        SELECT order_id, event_type, sequence, details, occurred_at
+        FROM order_history
+        WHERE order_id = $1
+        ORDER BY sequence ASC, occurred_at ASC, id ASC
+    `
+    
+    rows, err := rm.db.Query(ctx, queryGetHistory, query, orderID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query order history: %w", err)
+    }
+    defer rows.Close()
+    
+    var entries []*OrderHistoryEntryDTO
+    for rows.Next() {
+        var entry OrderHistoryEntryDTO
+        err := rows.Scan(
+            &entry.OrderID,
+            &entry.EventType,
+            &entry.Sequence,
+            &entry.Details,
+            &entry.OccurredAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan history entry: %w", err)
+        }
+        entries = append(entries, &entry)
+    }
+    
+    return entries, rows.Err()
+}
@@ -0,0 +1,46 @@
+package readmodels
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// Events sharing a timestamp are listed in sequence order, however they
+// arrived, and a redelivered event adds no entry.
+func TestOrderHistoryReadModel_sameTimestamp(t *testing.T) {
+    ctx := context.Background()
+    _, rm := newTestReadModels(t)
+    orderID := uuid.NewString()
+    occurredAt := apijson.NewTimestamp(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    
+    arrivals := []OrderHistoryEntryDTO{
+        {OrderID: orderID, EventType: "OrderItemAdded", Sequence: 3, OccurredAt: occurredAt},
+        {OrderID: orderID, EventType: "OrderCreated", Sequence: 1, OccurredAt: occurredAt},
+        {OrderID: orderID, EventType: "OrderItemAdded", Sequence: 2, OccurredAt: occurredAt},
+        // Redelivered
+        {OrderID: orderID, EventType: "OrderItemAdded", Sequence: 3, OccurredAt: occurredAt},
+    }
+    for i := range arrivals {
+        if err := rm.AddEntry(ctx, &arrivals[i]); err != nil {
+            t.Fatalf("AddEntry(%s #%d) = %v", arrivals[i].EventType, arrivals[i].Sequence, err)
+        }
+    }
+    
+    history, err := rm.GetHistory(ctx, orderID)
+    if err != nil {
+        t.Fatalf("GetHistory() = %v", err)
+    }
+    var got []int
+    for _, entry := range history {
+        got = append(got, entry.Sequence)
+    }
+    if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+        t.Errorf("history sequences = %v, want %v", got, want)
+    }
+}
@@ -0,0 +1,1698 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+type OrderReadModel interface {
+    GetOrder(ctx context.Context, orderID string) (*OrderDTO, error)
+    // GetOrders returns the orders in orderIDs, keyed by id, leaving out
+    // those that do not exist.
+    GetOrders(ctx context.Context, orderIDs []string) (map[string]*OrderDTO, error)
+    GetOrderStatuses(ctx context.Context, orderIDs []string) (map[string]OrderStatusDTO, error)
+    InsertOrder(ctx context.Context, order *OrderDTO) error
+    SetStatus(ctx context.Context, orderID string, change StatusChange) error
+    // OverrideStatus sets an order's status whatever its version, for
+    // operators repairing a read model that disagrees with the event
+    // stream. The version is kept, so later events still apply.
+    OverrideStatus(ctx context.Context, orderID, status string, changedAt time.Time) error
+    SetItemsAndTotal(ctx context.Context, orderID string, change ItemsChange) error
+    SetShippingAddress(ctx context.Context, orderID string, change ShippingAddressChange) error
+    // SetCustomer moves an order to another customer, invalidating the
+    // cached order lists of both.
+    SetCustomer(ctx context.Context, orderID string, change CustomerChange) error
+    UpsertOrder(ctx context.Context, order *OrderDTO) error
+    // ApplyOrder writes every projection-owned column of an order as
+    // UpsertOrder does, unless the stored order is already at or past its
+    // version.
+    ApplyOrder(ctx context.Context, order *OrderDTO) error
+    DeleteOrder(ctx context.Context, orderID string) error
+    // DeleteOrdersCreatedSince removes orders created at or after since,
+    // with their history, so replaying their events rebuilds them. It
+    // returns how many orders were removed.
+    DeleteOrdersCreatedSince(ctx context.Context, since time.Time) (int64, error)
+    ListOrders(ctx context.Context, filter OrderFilter, page pagination.Pagination) ([]*OrderDTO, error)
+    // ListOrderSummaries serves pages within the first
+    // CustomerOrdersCacheSize orders of a filter on the customer alone from
+    // the cache.
+    ListOrderSummaries(ctx context.Context, filter OrderFilter, page pagination.Pagination) ([]*OrderSummaryDTO, error)
+    // CacheCustomerOrders reloads the cached order list of a customer from
+    // the database.
+    CacheCustomerOrders(ctx context.Context, customerID string) error
+    AddTag(ctx context.Context, orderID, tag string) error
+    RemoveTag(ctx context.Context, orderID, tag string) error
+    GetOrderAnalytics(ctx context.Context, window timewindow.Window, includeShipping bool) (*OrderAnalyticsDTO, error)
+    // CompareOrderAnalytics compares the orders of window with those of
+    // the period before it, by currency.
+    CompareOrderAnalytics(ctx context.Context, window timewindow.Window, includeShipping bool) (*OrderComparisonDTO, error)
+    // GetOrderValueDistribution counts the orders of window in the value
+    // bands bounds delimits, by currency.
+    GetOrderValueDistribution(ctx context.Context, window timewindow.Window, bounds []int64) (*OrderValueDistributionDTO, error)
+    // GetProductSalesTimeSeries reports the units sold of a product and
+    // their revenue over [from, to) in buckets of a day, week or month.
+    GetProductSalesTimeSeries(ctx context.Context, productID string, from, to time.Time, bucket string) (*ProductSalesTimeSeriesDTO, error)
+    // ListOrderChanges pages through the orders updated after a watermark,
+    // for incremental extraction
+    ListOrderChanges(ctx context.Context, since time.Time, afterID string, limit int) (*OrderChangesDTO, error)
+    GetStatusDurations(ctx context.Context, window timewindow.Window) (*StatusDurationsDTO, error)
+    FindTotalDiscrepancies(ctx context.Context, limit int) ([]*TotalDiscrepancyDTO, error)
+    // FindCorruptOrders decodes every order row and reports up to limit
+    // whose JSON columns do not decode.
+    FindCorruptOrders(ctx context.Context, limit int) ([]*CorruptOrderDTO, error)
+    // CountOrdersByStatus and ListOrderIDs serve the reconciliation with
+    // the write side; see package reconcile.
+    CountOrdersByStatus(ctx context.Context) (map[string]int64, error)
+    ListOrderIDs(ctx context.Context, after string, limit int) ([]string, error)
+    // ArchiveOrders moves up to limit orders delivered or cancelled before
+    // before to the archive, returning how many were moved; see
+    // WithArchive.
+    ArchiveOrders(ctx context.Context, before time.Time, limit int) (int64, error)
+    // AnonymizeOrders scrubs the personal data of subject from its orders
+    // and their history, returning how many orders were scrubbed.
+    AnonymizeOrders(ctx context.Context, subject DataSubject) (int64, error)
+}
+
+type OrderDTO struct {
+    ID              string                `json:"id"`
+    // OrderNumber is the human-readable order number, empty for orders
+    // placed before numbers were given
+    OrderNumber     string                `json:"order_number,omitempty"`
+    // CustomerID is empty for guest checkouts
+    CustomerID      string                `json:"customer_id"`
+    // ContactEmail is the email of guest checkouts
+    ContactEmail    string                `json:"contact_email,omitempty"`
+    Status          string                `json:"status"`
+    TotalAmount     valueobjects.Money    `json:"total_amount"`
+    ShippingCost    valueobjects.Money    `json:"shipping_cost"`
+    GrandTotal      valueobjects.Money    `json:"grand_total"`
+    ShippingAddress valueobjects.Address  `json:"shipping_address"`
+    // Channel is the sales channel, "unknown" for orders placed before
+    // channels were recorded
+    Channel         string                `json:"channel"`
+    Items           []OrderItemDTO        `json:"items"`
+    Version         int                   `json:"version"`
+    StatusChangedAt apijson.Timestamp     `json:"status_changed_at"`
+    CreatedAt       apijson.Timestamp     `json:"created_at"`
+    UpdatedAt       apijson.Timestamp     `json:"updated_at"`
+    // Tags are operational labels set through the admin API. They are not
+    // part of the order's domain state and the projection never writes them.
+    Tags            []string              `json:"tags"`
+    // Delivery is set once the order is delivered
+    Delivery        *DeliveryDTO          `json:"delivery,omitempty"`
+    // Cancellation is set while the order is cancelled
+    Cancellation    *CancellationDTO      `json:"cancellation,omitempty"`
+    // Meta describes the projection's last write to the row. Only GetOrder
+    // reads it, and the API returns it only when asked to
+    Meta            *OrderMetaDTO         `json:"meta,omitempty"`
+    // Archived is set for orders read from the archive
+    Archived        bool                  `json:"archived,omitempty"`
+}
+
+// DeliveryDTO details the delivery of an order. Orders delivered before the
+// details were recorded have them null.
+type DeliveryDTO struct {
+    DeliveredAt      *apijson.Timestamp `json:"delivered_at"`
+    SignedBy         *string            `json:"signed_by"`
+    CarrierReference *string            `json:"carrier_reference"`
+}
+
+// CancellationDTO tells why an order was cancelled. Orders cancelled before
+// reasons were enumerated have reason other and their free text as details;
+// those projected before reasons were recorded have no cancellation.
+type CancellationDTO struct {
+    Reason  string  `json:"reason"`
+    Details *string `json:"details"`
+    Forced  bool    `json:"forced"`
+}
+
+// OrderMetaDTO tells how fresh an order's read model row is.
+type OrderMetaDTO struct {
+    // LastAppliedVersion is the version of the last event projected
+    LastAppliedVersion int                `json:"last_applied_version"`
+    // LastEventType and ProjectedAt are empty for rows last written before
+    // they were recorded
+    LastEventType      string             `json:"last_event_type"`
+    ProjectedAt        *apijson.Timestamp `json:"projected_at"`
+    // StalenessSeconds is how long ago the row was projected; see
+    // WithStaleness
+    StalenessSeconds   *float64           `json:"staleness_seconds"`
+}
+
+// WithStaleness returns a copy of m with StalenessSeconds counted up to
+// now.
+func (m OrderMetaDTO) WithStaleness(now time.Time) *OrderMetaDTO {
+    m.StalenessSeconds = nil
+    if m.ProjectedAt != nil {
+        staleness := now.Sub(m.ProjectedAt.Time).Seconds()
+        m.StalenessSeconds = &staleness
+    }
+    return &m
+}
+
+// OrderStatusDTO is the part of an order that status pollers need.
+type OrderStatusDTO struct {
+    Status    string            `json:"status"`
+    UpdatedAt apijson.Timestamp `json:"updated_at"`
+    Version   int               `json:"version"`
+}
+
+// StatusChange is written by SetStatus.
+type StatusChange struct {
+    Status    string
+    ChangedAt time.Time
+    Version   int
+    // EventType is the type of the event making the change
+    EventType string
+    // Delivery is written with the delivered status; nil leaves the
+    // stored delivery alone
+    Delivery     *DeliveryDTO
+    // Cancellation is written with the cancelled status; any other status
+    // clears the stored one
+    Cancellation *CancellationDTO
+}
+
+// ItemsChange is written by SetItemsAndTotal.
+type ItemsChange struct {
+    Items        []OrderItemDTO
+    TotalAmount  valueobjects.Money
+    ShippingCost valueobjects.Money
+    GrandTotal   valueobjects.Money
+    UpdatedAt    time.Time
+    Version      int
+    EventType    string
+}
+
+// ShippingAddressChange is written by SetShippingAddress, with the shipping
+// cost repriced for the address and the resulting grand total.
+type ShippingAddressChange struct {
+    ShippingAddress valueobjects.Address
+    ShippingCost    valueobjects.Money
+    GrandTotal      valueobjects.Money
+    UpdatedAt       time.Time
+    Version         int
+    EventType       string
+}
+
+// CustomerChange is written by SetCustomer, when the customer who placed
+// the order, PreviousCustomerID, is merged into CustomerID.
+type CustomerChange struct {
+    CustomerID         string
+    PreviousCustomerID string
+    UpdatedAt          time.Time
+    Version            int
+    EventType          string
+}
+
+// OrderFilter selects the orders to list. Empty fields don't filter.
+type OrderFilter struct {
+    CustomerID      string
+    // ContactEmail selects the orders with the contact email, as
+    // valueobjects.ParseEmail normalizes it
+    ContactEmail    string
+    // Number selects the order with the human-readable order number
+    Number          string
+    Channel         string
+    Tag             string
+    // ProductID selects orders with a line for the product
+    ProductID       string
+    // IncludeArchived adds the archived orders matching the other fields
+    IncludeArchived bool
+}
+
+// whereClause returns the WHERE clause for the filter, numbering its
+// placeholders from $1, and the matching arguments.
+func (f OrderFilter) whereClause() (string, []interface{}) {
+    return f.where("id IN (SELECT order_id FROM order_tags WHERE tag = $%d)")
+}
+
+// archiveWhereClause returns whereClause for the archive, whose rows keep
+// their tags, with the same arguments.
+func (f OrderFilter) archiveWhereClause() string {
+    whereClause, _ := f.where("tags @> jsonb_build_array($%d::text)")
+    return whereClause
+}
+
+// where builds the WHERE clause with tagCondition, formatted with the
+// tag's placeholder number.
+func (f OrderFilter) where(tagCondition string) (string, []interface{}) {
+    var conditions []string
+    var args []interface{}
+    if f.CustomerID != "" {
+        args = append(args, f.CustomerID)
+        conditions = append(conditions, fmt.Sprintf("customer_id = $%d", len(args)))
+    }
+    if f.ContactEmail != "" {
+        args = append(args, f.ContactEmail)
+        conditions = append(conditions, fmt.Sprintf("contact_email = $%d", len(args)))
+    }
+    if f.Number != "" {
+        args = append(args, f.Number)
+        conditions = append(conditions, fmt.Sprintf("order_number = $%d", len(args)))
+    }
+    if f.Channel != "" {
+        args = append(args, f.Channel)
+        conditions = append(conditions, fmt.Sprintf("channel = $%d", len(args)))
+    }
+    if f.Tag != "" {
+        args = append(args, f.Tag)
+        conditions = append(conditions, fmt.Sprintf(tagCondition, len(args)))
+    }
+    if f.ProductID != "" {
+        // Containment on the generated product_ids column uses its GIN index
+        args = append(args, f.ProductID)
+        conditions = append(conditions, fmt.Sprintf("product_ids @> jsonb_build_array($%d::text)", len(args)))
+    }
+    if len(conditions) == 0 {
+        return "", nil
+    }
+    return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ErrOrderNotFound is returned when an order is not in the read model.
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrStaleVersion is returned by SetStatus, SetItemsAndTotal,
+// SetShippingAddress, SetCustomer and ApplyOrder when the order is already at or past
+// the change's version, because another writer projected the same event
+// first. A retry re-reads the order and finds the event applied.
+var ErrStaleVersion = errors.New("order read model is already at or past the version")
+
+// ErrInvalidTag is returned for tags that are not lowercase slugs.
+var ErrInvalidTag = errors.New("tag must be 1-64 lowercase letters, digits or dashes, starting with a letter or digit")
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// ValidateTag returns ErrInvalidTag unless tag is a lowercase slug such as
+// "fraud-review".
+func ValidateTag(tag string) error {
+    if !tagPattern.MatchString(tag) {
+        return ErrInvalidTag
+    }
+    return nil
+}
+
+// tagsColumn selects an order's tags as a JSON array, sorted.
+const tagsColumn = `COALESCE((SELECT json_agg(tag ORDER BY tag) FROM order_tags WHERE order_id = order_read_models.id), '[]'::json)`
+
+// deliveryColumn selects an order's delivery, JSON null for orders not
+// delivered.
+const deliveryColumn = `COALESCE(delivery, 'null'::jsonb)`
+
+// cancellationColumn selects an order's cancellation, JSON null for orders
+// not cancelled.
+const cancellationColumn = `COALESCE(cancellation, 'null'::jsonb)`
+
+// OrderSummaryDTO is the list view of an order. It is read without decoding
+// the items and address JSON, so listing stays cheap for large pages.
+type OrderSummaryDTO struct {
+    ID          string    `json:"id"`
+    OrderNumber string    `json:"order_number,omitempty"`
+    CustomerID  string    `json:"customer_id"`
+    Status      string    `json:"status"`
+    Channel     string    `json:"channel"`
+    Total       int64     `json:"total"`
+    GrandTotal  int64     `json:"grand_total"`
+    Currency    string    `json:"currency"`
+    ItemCount   int       `json:"item_count"`
+    CreatedAt   apijson.Timestamp `json:"created_at"`
+    // Archived is set for orders listed from the archive
+    Archived    bool      `json:"archived,omitempty"`
+}
+
+type OrderItemDTO struct {
+    ProductID string              `json:"product_id"`
+    Quantity  int                `json:"quantity"`
+    Price     valueobjects.Money  `json:"price"`
+}
+
+type OrderAnalyticsDTO struct {
+    TotalOrders     int64   `json:"total_orders"`
+    TotalRevenue    int64   `json:"total_revenue"`
+    ShippingRevenue int64   `json:"shipping_revenue"`
+    AverageOrderValue int64 `json:"average_order_value"`
+    OrdersByStatus  map[string]int64 `json:"orders_by_status"`
+    // ByChannel breaks the order count and revenue down by sales channel
+    ByChannel       map[string]ChannelAnalyticsDTO `json:"by_channel"`
+    // CancellationsByReason counts the cancelled orders by cancellation
+    // reason. Orders projected before reasons were recorded count as other
+    CancellationsByReason map[string]int64 `json:"cancellations_by_reason"`
+}
+
+type ChannelAnalyticsDTO struct {
+    Orders  int64 `json:"orders"`
+    Revenue int64 `json:"revenue"`
+}
+
+// StatusTransitionDTO is a single status change recorded by the projection.
+// Version is the order's version after the transition, which keeps
+// redelivered events from recording the same transition twice.
+type StatusTransitionDTO struct {
+    OrderID                  string        `json:"order_id"`
+    FromStatus               string        `json:"from_status"`
+    ToStatus                 string        `json:"to_status"`
+    Version                  int           `json:"version"`
+    OccurredAt               apijson.Timestamp `json:"occurred_at"`
+    DurationInPreviousStatus time.Duration `json:"duration_in_previous_status"`
+}
+
+// TotalDiscrepancyDTO reports an order whose stored total does not match the
+// sum of its items.
+type TotalDiscrepancyDTO struct {
+    OrderID     string `json:"order_id"`
+    TotalAmount int64  `json:"total_amount"`
+    ItemsTotal  int64  `json:"items_total"`
+    Difference  int64  `json:"difference"`
+}
+
+type StatusDurationDTO struct {
+    Transitions    int64   `json:"transitions"`
+    AverageSeconds float64 `json:"average_seconds"`
+    P50Seconds     float64 `json:"p50_seconds"`
+    P90Seconds     float64 `json:"p90_seconds"`
+    P95Seconds     float64 `json:"p95_seconds"`
+}
+
+type StatusDurationsDTO struct {
+    Durations map[string]StatusDurationDTO `json:"durations"`
+}
+
+// trackedDurationStatuses are the statuses an order leaves on its way to
+// delivery; time spent in terminal statuses is not reported.
+var trackedDurationStatuses = []string{"draft", "confirmed", "on_hold", "shipped"}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryGetOrder               = "order_read_models.get"
+    queryGetOrders              = "order_read_models.get_many"
+    queryGetOrderStatuses       = "order_read_models.get_statuses"
+    queryInsertOrder            = "order_read_models.insert"
+    queryApplyOrder             = "order_read_models.apply"
+    querySetStatus              = "order_read_models.set_status"
+    queryOverrideStatus         = "order_read_models.override_status"
+    querySetItemsAndTotal       = "order_read_models.set_items"
+    querySetShippingAddress     = "order_read_models.set_shipping_address"
+    querySetCustomer            = "order_read_models.set_customer"
+    queryDeleteOrder            = "order_read_models.delete"
+    queryDeleteOrdersSince      = "order_read_models.delete_since"
+    queryOrderExists            = "order_read_models.exists"
+    queryListOrders             = "order_read_models.list"
+    queryListOrderSummaries     = "order_read_models.list_summaries"
+    queryAddTag                 = "order_tags.add"
+    queryRemoveTag              = "order_tags.remove"
+    queryOrderAnalytics         = "order_read_models.analytics"
+    queryOrderStatusCounts      = "order_read_models.status_counts"
+    queryOrderChannelAnalytics  = "order_read_models.channel_analytics"
+    queryCancellationReasons    = "order_read_models.cancellation_reasons"
+    queryRecordStatusTransition = "order_status_transitions.record"
+    queryStatusDurations        = "order_status_transitions.durations"
+    queryTotalDiscrepancies     = "order_read_models.total_discrepancies"
+    queryCorruptOrders          = "order_read_models.corrupt_scan"
+    queryCountByStatus          = "order_read_models.count_by_status"
+    queryListOrderIDs           = "order_read_models.list_ids"
+)
+
+type orderReadModel struct {
+    db      *sqlmetrics.DB
+    cache   *Cache
+    strict  bool
+    archive bool
+}
+
+// NewOrderReadModel reads orders from db through cache, which may be nil
+// for no caching.
+func NewOrderReadModel(db *sqlmetrics.DB, cache *Cache, opts ...OrderReadModelOption) OrderReadModel {
+    rm := &orderReadModel{
+        db:    db,
+        cache: orNoCache(cache),
+    }
+    for _, opt := range opts {
+        opt(rm)
+    }
+    return rm
+}
+
+func (rm *orderReadModel) GetOrder(ctx context.Context, orderID string) (*OrderDTO, error) {
+    // Try cache first; entries cached before orders carried Meta are
+    // read again
+    cacheKey := rm.cache.orderKey(orderID)
+    if cached, ok := rm.cache.get(ctx, cacheKey); ok {
+        if order, ok := decodeCachedOrder(cached); ok {
+            return order, nil
+        }
+    }
+    
+    // Fallback to database
+    query := `
+        SELECT ` + orderColumns + `
+        FROM order_read_models
+        WHERE id = $1
+    `
+    
+    order, err := scanOrder(rm.db.QueryRow(ctx, queryGetOrder, query, orderID))
+    if err == sql.ErrNoRows && rm.archive {
+        order, err = rm.getArchivedOrder(ctx, orderID)
+    }
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, ErrOrderNotFound
+        }
+        var corrupt *CorruptOrderError
+        if errors.As(err, &corrupt) {
+            corruptRow(corrupt, false)
+            return nil, corrupt
+        }
+        return nil, fmt.Errorf("failed to find order: %w", err)
+    }
+    
+    // Cache the result
+    orderData, _ := json.Marshal(order)
+    rm.cache.set(ctx, cacheKey, orderData, rm.cache.cfg.OrderTTL)
+    
+    return order, nil
+}
+
+// GetOrders returns the orders in orderIDs, keyed by id. Orders that do not
+// exist are left out. Cached orders are read with one MGET and the rest
+// with one query; those are not cached, as GetOrders serves batch
+// projection, which rewrites them straight after.
+func (rm *orderReadModel) GetOrders(ctx context.Context, orderIDs []string) (map[string]*OrderDTO, error) {
+    orders := make(map[string]*OrderDTO, len(orderIDs))
+    if len(orderIDs) == 0 {
+        return orders, nil
+    }
+    
+    cacheKeys := make([]string, len(orderIDs))
+    for i, orderID := range orderIDs {
+        cacheKeys[i] = rm.cache.orderKey(orderID)
+    }
+    
+    var uncached []string
+    cached := rm.cache.mget(ctx, cacheKeys)
+    for i, orderID := range orderIDs {
+        if data, ok := cached[i].(string); ok {
+            if order, ok := decodeCachedOrder(data); ok {
+                orders[orderID] = order
+                continue
+            }
+        }
+        uncached = append(uncached, orderID)
+    }
+    if len(uncached) == 0 {
+        return orders, nil
+    }
+    
+    // Without an array-aware driver the ids are bound one placeholder each
+    placeholders := make([]string, len(uncached))
+    args := make([]interface{}, len(uncached))
+    for i, orderID := range uncached {
+        placeholders[i] = fmt.Sprintf("$%d", i+1)
+        args[i] = orderID
+    }
+    query := `
+        SELECT ` + orderColumns + `
+        FROM order_read_models
+        WHERE id IN (` + strings.Join(placeholders, ", ") + `)
+    `
+    if rm.archive {
+        query += `
+        UNION ALL
+        SELECT ` + archivedOrderColumns + `
+        FROM order_read_models_archive
+        WHERE id IN (` + strings.Join(placeholders, ", ") + `)
+    `
+    }
+    
+    rows, err := rm.db.Query(ctx, queryGetOrders, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query orders: %w", err)
+    }
+    defer rows.Close()
+    
+    for rows.Next() {
+        order, err := scanOrder(rows)
+        if err != nil {
+            var corrupt *CorruptOrderError
+            if errors.As(err, &corrupt) {
+                corruptRow(corrupt, false)
+                return nil, corrupt
+            }
+            return nil, fmt.Errorf("failed to scan order: %w", err)
+        }
+        orders[order.ID] = order
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to query orders: %w", err)
+    }
+    
+    return orders, nil
+}
+
+// orderColumns are the columns scanOrder reads, ending with whether the
+// order is archived.
+const orderColumns = `id, customer_id, status, total_amount, shipping_cost, grand_total, currency, shipping_address, channel, COALESCE(order_number, ''), items, version, status_changed_at, created_at, updated_at, ` + tagsColumn + `, COALESCE(last_event_type, ''), projected_at, COALESCE(contact_email, ''), ` + deliveryColumn + `, ` + cancellationColumn + `, FALSE`
+
+// scanOrder reads an order selected as orderColumns, with its Meta.
+// Columns that do not decode are reported as a *CorruptOrderError.
+func scanOrder(row interface{ Scan(dest ...interface{}) error }) (*OrderDTO, error) {
+    var order OrderDTO
+    var shippingAddressJSON, itemsJSON, tagsJSON, deliveryJSON, cancellationJSON []byte
+    var currency string
+    var meta OrderMetaDTO
+    var projectedAt sql.NullTime
+    
+    err := row.Scan(
+        &order.ID,
+        &order.CustomerID,
+        &order.Status,
+        &order.TotalAmount.Amount,
+        &order.ShippingCost.Amount,
+        &order.GrandTotal.Amount,
+        &currency,
+        &shippingAddressJSON,
+        &order.Channel,
+        &order.OrderNumber,
+        &itemsJSON,
+        &order.Version,
+        &order.StatusChangedAt,
+        &order.CreatedAt,
+        &order.UpdatedAt,
+        &tagsJSON,
+        &meta.LastEventType,
+        &projectedAt,
+        &order.ContactEmail,
+        &deliveryJSON,
+        &cancellationJSON,
+        &order.Archived,
+    )
+    if err != nil {
+        return nil, err
+    }
+    
+    meta.LastAppliedVersion = order.Version
+    if projectedAt.Valid {
+        meta.ProjectedAt = &apijson.Timestamp{Time: projectedAt.Time}
+    }
+    order.Meta = &meta
+    
+    if err := decodeOrderJSON(&order, shippingAddressJSON, itemsJSON, tagsJSON, deliveryJSON, cancellationJSON); err != nil {
+        return nil, err
+    }
+    
+    setCurrency(&order, currency)
+    return &order, nil
+}
+
+// decodeCachedOrder decodes a cached order, reporting false for entries
+// that do not decode or were cached before orders carried Meta.
+func decodeCachedOrder(data string) (*OrderDTO, bool) {
+    var order OrderDTO
+    if err := json.Unmarshal([]byte(data), &order); err != nil || order.Meta == nil {
+        return nil, false
+    }
+    return &order, true
+}
+
+// GetOrderStatuses returns the statuses of the orders in orderIDs, keyed by
+// id. Orders that do not exist are left out. Cached orders are read with one
+// MGET and the rest with one query.
+func (rm *orderReadModel) GetOrderStatuses(ctx context.Context, orderIDs []string) (map[string]OrderStatusDTO, error) {
+    statuses := make(map[string]OrderStatusDTO, len(orderIDs))
+    if len(orderIDs) == 0 {
+        return statuses, nil
+    }
+    
+    cacheKeys := make([]string, len(orderIDs))
+    for i, orderID := range orderIDs {
+        cacheKeys[i] = rm.cache.orderKey(orderID)
+    }
+    
+    // A cache failure only means every order is read from the database
+    var uncached []string
+    cached := rm.cache.mget(ctx, cacheKeys)
+    for i, orderID := range orderIDs {
+        if data, ok := cached[i].(string); ok {
+            var order OrderDTO
+            if json.Unmarshal([]byte(data), &order) == nil {
+                statuses[orderID] = OrderStatusDTO{Status: order.Status, UpdatedAt: order.UpdatedAt, Version: order.Version}
+                continue
+            }
+        }
+        uncached = append(uncached, orderID)
+    }
+    if len(uncached) == 0 {
+        return statuses, nil
+    }
+    
+    // Without an array-aware driver the ids are bound one placeholder each
+    placeholders := make([]string, len(uncached))
+    args := make([]interface{}, len(uncached))
+    for i, orderID := range uncached {
+        placeholders[i] = fmt.Sprintf("$%d", i+1)
+        args[i] = orderID
+    }
+    query := `
+        SELECT id, status, updated_at, version
+        FROM order_read_models
+        WHERE id IN (` + strings.Join(placeholders, ", ") + `)
+    `
+    
+    rows, err := rm.db.Query(ctx, queryGetOrderStatuses, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query order statuses: %w", err)
+    }
+    defer rows.Close()
+    
+    for rows.Next() {
+        var orderID string
+        var status OrderStatusDTO
+        if err := rows.Scan(&orderID, &status.Status, &status.UpdatedAt, &status.Version); err != nil {
+            return nil, fmt.Errorf("failed to scan order status: %w", err)
+        }
+        statuses[orderID] = status
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to query order statuses: %w", err)
+    }
+    
+    return statuses, nil
+}
+
+// InsertOrder adds a newly created order. A redelivered creation event
+// finds the order already there and changes nothing, so it cannot roll back
+// later updates.
+func (rm *orderReadModel) InsertOrder(ctx context.Context, order *OrderDTO) error {
+    return rm.insertOrder(ctx, order, `ON CONFLICT (id) DO NOTHING`)
+}
+
+// UpsertOrder writes every projection-owned column of an order, inserting
+// it if needed. It is meant for rebuilding or importing read models; event
+// projection goes through InsertOrder and the narrow Set methods. Columns
+// owned by other writers, such as the order's tags, are left alone.
+func (rm *orderReadModel) UpsertOrder(ctx context.Context, order *OrderDTO) error {
+    return rm.insertOrder(ctx, order, `
+        ON CONFLICT (id) DO UPDATE SET
+            customer_id = $2,
+            status = $3,
+            total_amount = $4,
+            shipping_cost = $5,
+            grand_total = $6,
+            shipping_address = $7,
+            items = $8,
+            version = $9,
+            status_changed_at = $10,
+            updated_at = $12,
+            channel = $13,
+            order_number = NULLIF($14, ''),
+            last_event_type = $15,
+            projected_at = $16,
+            contact_email = NULLIF($17, ''),
+            delivery = $18::jsonb,
+            cancellation = $19::jsonb,
+            currency = $20`)
+}
+
+// ApplyOrder writes the order as UpsertOrder does when its version is past
+// the stored one, and returns ErrStaleVersion, writing nothing, when it is
+// not.
+func (rm *orderReadModel) ApplyOrder(ctx context.Context, order *OrderDTO) error {
+    return rm.saveOrder(ctx, queryApplyOrder, order, `
+        ON CONFLICT (id) DO UPDATE SET
+            customer_id = $2,
+            status = $3,
+            total_amount = $4,
+            shipping_cost = $5,
+            grand_total = $6,
+            shipping_address = $7,
+            items = $8,
+            version = $9,
+            status_changed_at = $10,
+            updated_at = $12,
+            channel = $13,
+            order_number = NULLIF($14, ''),
+            last_event_type = $15,
+            projected_at = $16,
+            contact_email = NULLIF($17, ''),
+            delivery = $18::jsonb,
+            cancellation = $19::jsonb,
+            currency = $20
+        WHERE order_read_models.version < $9`)
+}
+
+func (rm *orderReadModel) insertOrder(ctx context.Context, order *OrderDTO, onConflict string) error {
+    err := rm.saveOrder(ctx, queryInsertOrder, order, onConflict)
+    if errors.Is(err, ErrStaleVersion) {
+        // An order already there is left alone on purpose
+        return nil
+    }
+    return err
+}
+
+// saveOrder runs the INSERT statement name with onConflict, returning
+// ErrStaleVersion when it writes no row.
+func (rm *orderReadModel) saveOrder(ctx context.Context, name string, order *OrderDTO, onConflict string) error {
+    shippingAddressJSON, itemsJSON, err := marshalOrderJSON(order)
+    if err != nil {
+        return err
+    }
+    deliveryJSON, err := marshalDelivery(order.Delivery)
+    if err != nil {
+        return err
+    }
+    cancellationJSON, err := marshalCancellation(order.Cancellation)
+    if err != nil {
+        return err
+    }
+    var lastEventType string
+    if order.Meta != nil {
+        lastEventType = order.Meta.LastEventType
+    }
+    // The order is written live, so an archived copy is brought back first
+    if _, err := rm.unarchive(ctx, order.ID); err != nil {
+        return err
+    }
+    
+    query := `
+        INSERT INTO order_read_models (id, customer_id, status, total_amount, shipping_cost, grand_total, shipping_address, items, version, status_changed_at, created_at, updated_at, channel, order_number, last_event_type, projected_at, contact_email, delivery, cancellation, currency)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), $15, $16, NULLIF($17, ''), $18::jsonb, $19::jsonb, $20)
+        ` + onConflict
+    
+    result, err := rm.db.Exec(ctx, name, query,
+        order.ID,
+        order.CustomerID,
+        order.Status,
+        order.TotalAmount.Amount,
+        order.ShippingCost.Amount,
+        order.GrandTotal.Amount,
+        shippingAddressJSON,
+        itemsJSON,
+        order.Version,
+        order.StatusChangedAt,
+        order.CreatedAt,
+        order.UpdatedAt,
+        order.Channel,
+        order.OrderNumber,
+        lastEventType,
+        clock.Now().UTC(),
+        order.ContactEmail,
+        deliveryJSON,
+        cancellationJSON,
+        orderCurrency(order.TotalAmount),
+    )
+    
+    if err != nil {
+        return fmt.Errorf("failed to save order: %w", err)
+    }
+    if written, err := result.RowsAffected(); err == nil && written == 0 {
+        return ErrStaleVersion
+    }
+    
+    rm.invalidate(ctx, order.ID)
+    rm.invalidateCustomerOrders(ctx, order.CustomerID)
+    return nil
+}
+
+// SetStatus writes an order's status and the columns that track it, with
+// the delivery or cancellation when the change carries one. Items, totals,
+// the shipping address and tags are not touched.
+func (rm *orderReadModel) SetStatus(ctx context.Context, orderID string, change StatusChange) error {
+    deliveryJSON, err := marshalDelivery(change.Delivery)
+    if err != nil {
+        return err
+    }
+    cancellationJSON, err := marshalCancellation(change.Cancellation)
+    if err != nil {
+        return err
+    }
+    
+    query := `
+        UPDATE order_read_models
+        SET status = $2, status_changed_at = $3, updated_at = $3, version = $4, last_event_type = $5, projected_at = $6, delivery = COALESCE($7::jsonb, delivery),
+            cancellation = CASE WHEN $2 = 'cancelled' THEN COALESCE($8::jsonb, cancellation) END
+        WHERE id = $1 AND version < $4
+        RETURNING customer_id
+    `
+    
+    return rm.update(ctx, querySetStatus, orderID, query, change.Status, change.ChangedAt, change.Version, change.EventType, clock.Now().UTC(), deliveryJSON, cancellationJSON)
+}
+
+func (rm *orderReadModel) OverrideStatus(ctx context.Context, orderID, status string, changedAt time.Time) error {
+    if _, err := entities.ParseOrderID(orderID); err != nil {
+        return err
+    }
+    
+    query := `
+        UPDATE order_read_models
+        SET status = $2, status_changed_at = $3, updated_at = $3
+        WHERE id = $1
+        RETURNING customer_id
+    `
+    
+    // With no version condition, update only finds no row for a missing order
+    return rm.update(ctx, queryOverrideStatus, orderID, query, status, changedAt)
+}
+
+// SetItemsAndTotal writes an order's items and the totals derived from them.
+func (rm *orderReadModel) SetItemsAndTotal(ctx context.Context, orderID string, change ItemsChange) error {
+    itemsJSON, err := json.Marshal(change.Items)
+    if err != nil {
+        return fmt.Errorf("failed to marshal items: %w", err)
+    }
+    
+    query := `
+        UPDATE order_read_models
+        SET items = $2, total_amount = $3, shipping_cost = $4, grand_total = $5, updated_at = $6, version = $7, last_event_type = $8, projected_at = $9, currency = $10
+        WHERE id = $1 AND version < $7
+        RETURNING customer_id
+    `
+    
+    return rm.update(ctx, querySetItemsAndTotal, orderID, query,
+        itemsJSON,
+        change.TotalAmount.Amount,
+        change.ShippingCost.Amount,
+        change.GrandTotal.Amount,
+        change.UpdatedAt,
+        change.Version,
+        change.EventType,
+        clock.Now().UTC(),
+        orderCurrency(change.TotalAmount),
+    )
+}
+
+// SetShippingAddress writes an order's shipping address and the totals
+// repriced for it.
+func (rm *orderReadModel) SetShippingAddress(ctx context.Context, orderID string, change ShippingAddressChange) error {
+    shippingAddressJSON, err := json.Marshal(change.ShippingAddress)
+    if err != nil {
+        return fmt.Errorf("failed to marshal shipping address: %w", err)
+    }
+    
+    query := `
+        UPDATE order_read_models
+        SET shipping_address = $2, shipping_cost = $3, grand_total = $4, updated_at = $5, version = $6, last_event_type = $7, projected_at = $8
+        WHERE id = $1 AND version < $6
+        RETURNING customer_id
+    `
+    
+    return rm.update(ctx, querySetShippingAddress, orderID, query,
+        shippingAddressJSON,
+        change.ShippingCost.Amount,
+        change.GrandTotal.Amount,
+        change.UpdatedAt,
+        change.Version,
+        change.EventType,
+        clock.Now().UTC(),
+    )
+}
+
+func (rm *orderReadModel) SetCustomer(ctx context.Context, orderID string, change CustomerChange) error {
+    query := `
+        UPDATE order_read_models
+        SET customer_id = $2, updated_at = $3, version = $4, last_event_type = $5, projected_at = $6
+        WHERE id = $1 AND version < $4
+        RETURNING customer_id
+    `
+    
+    err := rm.update(ctx, querySetCustomer, orderID, query,
+        change.CustomerID,
+        change.UpdatedAt,
+        change.Version,
+        change.EventType,
+        clock.Now().UTC(),
+    )
+    if err != nil {
+        return err
+    }
+    
+    // update invalidated the new customer's list
+    rm.invalidateCustomerOrders(ctx, change.PreviousCustomerID)
+    return nil
+}
+
+// update runs the single-order UPDATE statement name, whose first
+// placeholder is the order id and which returns the order's customer, and
+// invalidates the cached order and customer order list.
+func (rm *orderReadModel) update(ctx context.Context, name, orderID, query string, args ...interface{}) error {
+    var customerID string
+    err := rm.db.QueryRow(ctx, name, query, append([]interface{}{orderID}, args...)...).Scan(&customerID)
+    if errors.Is(err, sql.ErrNoRows) {
+        err := rm.ensureExists(ctx, orderID)
+        if errors.Is(err, ErrOrderNotFound) {
+            // A change to an archived order brings it back before applying
+            restored, restoreErr := rm.unarchive(ctx, orderID)
+            if restoreErr != nil {
+                return restoreErr
+            }
+            if restored {
+                return rm.update(ctx, name, orderID, query, args...)
+            }
+        }
+        if err != nil {
+            return err
+        }
+        return ErrStaleVersion
+    }
+    if err != nil {
+        return fmt.Errorf("failed to update order: %w", err)
+    }
+    
+    rm.invalidate(ctx, orderID)
+    rm.invalidateCustomerOrders(ctx, customerID)
+    return nil
+}
+
+func marshalOrderJSON(order *OrderDTO) ([]byte, []byte, error) {
+    shippingAddressJSON, err := json.Marshal(order.ShippingAddress)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to marshal shipping address: %w", err)
+    }
+    
+    itemsJSON, err := json.Marshal(order.Items)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to marshal items: %w", err)
+    }
+    
+    return shippingAddressJSON, itemsJSON, nil
+}
+
+// marshalDelivery encodes a delivery for its JSONB column, nil for none.
+func marshalDelivery(delivery *DeliveryDTO) (interface{}, error) {
+    if delivery == nil {
+        return nil, nil
+    }
+    deliveryJSON, err := json.Marshal(delivery)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal delivery: %w", err)
+    }
+    return string(deliveryJSON), nil
+}
+
+// marshalCancellation encodes a cancellation for its JSONB column, nil for
+// none.
+func marshalCancellation(cancellation *CancellationDTO) (interface{}, error) {
+    if cancellation == nil {
+        return nil, nil
+    }
+    cancellationJSON, err := json.Marshal(cancellation)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal cancellation: %w", err)
+    }
+    return string(cancellationJSON), nil
+}
+
+// invalidate drops the cached copy of an order. Writers don't cache the DTO
+// they wrote because it may not reflect columns they don't own; the next
+// GetOrder reloads the whole row.
+func (rm *orderReadModel) invalidate(ctx context.Context, orderID string) {
+    rm.cache.del(ctx, rm.cache.orderKey(orderID))
+}
+
+// invalidateCustomerOrders drops the cached order list of a customer, for
+// CacheCustomerOrders or the next listing to reload.
+func (rm *orderReadModel) invalidateCustomerOrders(ctx context.Context, customerID string) {
+    rm.cache.del(ctx, rm.cache.customerOrdersKey(customerID))
+}
+
+// AddTag labels an order. Adding a tag the order already has is a no-op.
+func (rm *orderReadModel) AddTag(ctx context.Context, orderID, tag string) error {
+    if _, err := entities.ParseOrderID(orderID); err != nil {
+        return err
+    }
+    if err := ValidateTag(tag); err != nil {
+        return err
+    }
+    
+    query := `
+        INSERT INTO order_tags (order_id, tag, created_at)
+        SELECT id, $2, $3 FROM order_read_models WHERE id = $1
+        ON CONFLICT (order_id, tag) DO NOTHING
+    `
+    
+    if _, err := rm.db.Exec(ctx, queryAddTag, query, orderID, tag, clock.Now()); err != nil {
+        return fmt.Errorf("failed to add tag: %w", err)
+    }
+    
+    if err := rm.ensureExists(ctx, orderID); err != nil {
+        return err
+    }
+    
+    rm.invalidate(ctx, orderID)
+    return nil
+}
+
+// RemoveTag removes a label from an order. Removing a tag the order doesn't
+// have is a no-op.
+func (rm *orderReadModel) RemoveTag(ctx context.Context, orderID, tag string) error {
+    if _, err := entities.ParseOrderID(orderID); err != nil {
+        return err
+    }
+    if err := ValidateTag(tag); err != nil {
+        return err
+    }
+    
+    query := `DELETE FROM order_tags WHERE order_id = $1 AND tag = $2`
+    
+    if _, err := rm.db.Exec(ctx, queryRemoveTag, query, orderID, tag); err != nil {
+        return fmt.Errorf("failed to remove tag: %w", err)
+    }
+    
+    if err := rm.ensureExists(ctx, orderID); err != nil {
+        return err
+    }
+    
+    rm.invalidate(ctx, orderID)
+    return nil
+}
+
+func (rm *orderReadModel) ensureExists(ctx context.Context, orderID string) error {
+    var exists bool
+    query := `SELECT EXISTS (SELECT 1 FROM order_read_models WHERE id = $1)`
+    if err := rm.db.QueryRow(ctx, queryOrderExists, query, orderID).Scan(&exists); err != nil {
+        return fmt.Errorf("failed to find order: %w", err)
+    }
+    if !exists {
+        return ErrOrderNotFound
+    }
+    return nil
+}
+
+func (rm *orderReadModel) DeleteOrder(ctx context.Context, orderID string) error {
+    query := `DELETE FROM order_read_models WHERE id = $1 RETURNING customer_id`
+    if rm.archive {
+        query = `
+            WITH live AS (
+                DELETE FROM order_read_models WHERE id = $1 RETURNING customer_id
+            ), archived AS (
+                DELETE FROM order_read_models_archive WHERE id = $1 RETURNING customer_id
+            )
+            SELECT customer_id FROM live UNION ALL SELECT customer_id FROM archived
+        `
+    }
+    
+    var customerID string
+    err := rm.db.QueryRow(ctx, queryDeleteOrder, query, orderID).Scan(&customerID)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        return fmt.Errorf("failed to delete order: %w", err)
+    }
+    
+    // Remove from cache
+    rm.cache.del(ctx, rm.cache.orderKey(orderID))
+    if customerID != "" {
+        rm.invalidateCustomerOrders(ctx, customerID)
+    }
+    
+    return nil
+}
+
+// DeleteOrdersCreatedSince removes the orders in one statement, archived
+// ones included. Their tags go too; tags are set through the admin API and
+// are not replayed.
+func (rm *orderReadModel) DeleteOrdersCreatedSince(ctx context.Context, since time.Time) (int64, error) {
+    query := `
+        WITH deleted AS (
+            DELETE FROM order_read_models WHERE created_at >= $1 RETURNING id, customer_id
+        ), history AS (
+            DELETE FROM order_history WHERE order_id IN (SELECT id FROM deleted)
+        )
+        SELECT id, customer_id FROM deleted
+    `
+    if rm.archive {
+        query = `
+            WITH live AS (
+                DELETE FROM order_read_models WHERE created_at >= $1 RETURNING id, customer_id
+            ), archived AS (
+                DELETE FROM order_read_models_archive WHERE created_at >= $1 RETURNING id, customer_id
+            ), deleted AS (
+                SELECT id, customer_id FROM live UNION ALL SELECT id, customer_id FROM archived
+            ), history AS (
+                DELETE FROM order_history WHERE order_id IN (SELECT id FROM deleted)
+            )
+            SELECT id, customer_id FROM deleted
+        `
+    }
+    
+    rows, err := rm.db.Query(ctx, queryDeleteOrdersSince, query, since.UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete orders: %w", err)
+    }
+    defer rows.Close()
+    
+    var keys []string
+    var deleted int64
+    customers := make(map[string]bool)
+    for rows.Next() {
+        var orderID, customerID string
+        if err := rows.Scan(&orderID, &customerID); err != nil {
+            return 0, fmt.Errorf("failed to scan deleted order: %w", err)
+        }
+        keys = append(keys, rm.cache.orderKey(orderID))
+        if !customers[customerID] {
+            customers[customerID] = true
+            keys = append(keys, rm.cache.customerOrdersKey(customerID))
+        }
+        deleted++
+    }
+    if err := rows.Err(); err != nil {
+        return 0, fmt.Errorf("failed to delete orders: %w", err)
+    }
+    
+    if len(keys) > 0 {
+        rm.cache.del(ctx, keys...)
+    }
+    return deleted, nil
+}
+
+func (rm *orderReadModel) ListOrders(ctx context.Context, filter OrderFilter, page pagination.Pagination) ([]*OrderDTO, error) {
+    whereClause, args := filter.whereClause()
+    limitClause, limitArgs := page.LimitOffsetClause(len(args) + 1)
+    query := `
+        SELECT ` + listedOrderColumns + `
+        FROM order_read_models
+        ` + whereClause
+    if filter.IncludeArchived && rm.archive {
+        query += `
+        UNION ALL
+        SELECT ` + listedArchivedOrderColumns + `
+        FROM order_read_models_archive
+        ` + filter.archiveWhereClause()
+    }
+    query += `
+        ORDER BY created_at DESC
+        ` + limitClause
+    
+    args = append(args, limitArgs...)
+    rows, err := rm.db.Query(ctx, queryListOrders, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query orders: %w", err)
+    }
+    defer rows.Close()
+    
+    var orders []*OrderDTO
+    for rows.Next() {
+        var order OrderDTO
+        var shippingAddressJSON, itemsJSON, tagsJSON, deliveryJSON, cancellationJSON []byte
+        var currency string
+        
+        err := rows.Scan(
+            &order.ID,
+            &order.CustomerID,
+            &order.Status,
+            &order.TotalAmount.Amount,
+            &order.ShippingCost.Amount,
+            &order.GrandTotal.Amount,
+            &currency,
+            &shippingAddressJSON,
+            &order.Channel,
+            &order.OrderNumber,
+            &itemsJSON,
+            &order.Version,
+            &order.StatusChangedAt,
+            &order.CreatedAt,
+            &order.UpdatedAt,
+            &tagsJSON,
+            &order.ContactEmail,
+            &deliveryJSON,
+            &cancellationJSON,
+            &order.Archived,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan order: %w", err)
+        }
+        
+        var corrupt *CorruptOrderError
+        if err := decodeOrderJSON(&order, shippingAddressJSON, itemsJSON, tagsJSON, deliveryJSON, cancellationJSON); errors.As(err, &corrupt) {
+            corruptRow(corrupt, !rm.strict)
+            if rm.strict {
+                return nil, corrupt
+            }
+            continue
+        }
+        
+        setCurrency(&order, currency)
+        
+        orders = append(orders, &order)
+    }
+    
+    return orders, rows.Err()
+}
+
+func (rm *orderReadModel) ListOrderSummaries(ctx context.Context, filter OrderFilter, page pagination.Pagination) ([]*OrderSummaryDTO, error) {
+    if filter.CustomerID == "" || filter != (OrderFilter{CustomerID: filter.CustomerID}) || page.Offset != 0 || page.Limit > CustomerOrdersCacheSize {
+        return rm.listOrderSummaries(ctx, filter, page)
+    }
+    
+    cacheKey := rm.cache.customerOrdersKey(filter.CustomerID)
+    if cached, ok := rm.cache.get(ctx, cacheKey); ok {
+        var summaries []*OrderSummaryDTO
+        if err := json.Unmarshal([]byte(cached), &summaries); err == nil {
+            return firstSummaries(summaries, page.Limit), nil
+        }
+    }
+    
+    summaries, err := rm.loadCustomerOrders(ctx, filter.CustomerID)
+    if err != nil {
+        return nil, err
+    }
+    return firstSummaries(summaries, page.Limit), nil
+}
+
+func (rm *orderReadModel) CacheCustomerOrders(ctx context.Context, customerID string) error {
+    _, err := rm.loadCustomerOrders(ctx, customerID)
+    return err
+}
+
+// loadCustomerOrders reads the first CustomerOrdersCacheSize orders of a
+// customer and caches them.
+func (rm *orderReadModel) loadCustomerOrders(ctx context.Context, customerID string) ([]*OrderSummaryDTO, error) {
+    filter := OrderFilter{CustomerID: customerID}
+    summaries, err := rm.listOrderSummaries(ctx, filter, pagination.Pagination{Limit: CustomerOrdersCacheSize})
+    if err != nil {
+        return nil, err
+    }
+    
+    // An empty list is cached as [], not null
+    if summaries == nil {
+        summaries = []*OrderSummaryDTO{}
+    }
+    data, _ := json.Marshal(summaries)
+    rm.cache.set(ctx, rm.cache.customerOrdersKey(customerID), data, rm.cache.cfg.OrderTTL)
+    return summaries, nil
+}
+
+// firstSummaries returns up to limit summaries, and nil for none as an
+// uncached listing does.
+func firstSummaries(summaries []*OrderSummaryDTO, limit int) []*OrderSummaryDTO {
+    if len(summaries) == 0 {
+        return nil
+    }
+    if len(summaries) > limit {
+        return summaries[:limit]
+    }
+    return summaries
+}
+
+func (rm *orderReadModel) listOrderSummaries(ctx context.Context, filter OrderFilter, page pagination.Pagination) ([]*OrderSummaryDTO, error) {
+    whereClause, args := filter.whereClause()
+    limitClause, limitArgs := page.LimitOffsetClause(len(args) + 1)
+    query := `
+        SELECT ` + summaryColumns + `, FALSE
+        FROM order_read_models
+        ` + whereClause
+    if filter.IncludeArchived && rm.archive {
+        query += `
+        UNION ALL
+        SELECT ` + summaryColumns + `, TRUE
+        FROM order_read_models_archive
+        ` + filter.archiveWhereClause()
+    }
+    query += `
+        ORDER BY created_at DESC
+        ` + limitClause
+    
+    args = append(args, limitArgs...)
+    rows, err := rm.db.Query(ctx, queryListOrderSummaries, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query order summaries: %w", err)
+    }
+    defer rows.Close()
+    
+    var summaries []*OrderSummaryDTO
+    for rows.Next() {
+        summary := &OrderSummaryDTO{}
+        err := rows.Scan(
+            &summary.ID,
+            &summary.OrderNumber,
+            &summary.CustomerID,
+            &summary.Status,
+            &summary.Channel,
+            &summary.Total,
+            &summary.GrandTotal,
+            &summary.Currency,
+            &summary.ItemCount,
+            &summary.CreatedAt,
+            &summary.Archived,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan order summary: %w", err)
+        }
+        summaries = append(summaries, summary)
+    }
+    
+    return summaries, rows.Err()
+}
+
+// GetOrderAnalytics reports order counts and revenue for the orders
+// created in window, archived ones included. Revenue includes shipping
+// unless includeShipping is false; shipping revenue is always reported
+// separately.
+func (rm *orderReadModel) GetOrderAnalytics(ctx context.Context, window timewindow.Window, includeShipping bool) (*OrderAnalyticsDTO, error) {
+    // This is a simplified analytics query
+    // In production, you might want to use a separate analytics database or data warehouse
+    
+    whereClause, args := window.WhereClause("created_at", 1)
+    
+    // Grand totals are derived rather than read so rows projected before
+    // shipping existed still count their item revenue
+    revenue := "total_amount + shipping_cost"
+    if !includeShipping {
+        revenue = "total_amount"
+    }
+    
+    // Get total orders and revenue
+    query := fmt.Sprintf(`
+        SELECT 
+            COUNT(*) as total_orders,
+            COALESCE(SUM(%[2]s), 0) as total_revenue,
+            COALESCE(SUM(shipping_cost), 0) as shipping_revenue,
+            COALESCE(AVG(%[2]s), 0) as average_order_value
+        FROM %[3]s
+        WHERE %[1]s
+    `, whereClause, revenue, rm.allOrdersTable())
+    
+    var analytics OrderAnalyticsDTO
+    err := rm.db.QueryRow(ctx, queryOrderAnalytics, query, args...).Scan(
+        &analytics.TotalOrders,
+        &analytics.TotalRevenue,
+        &analytics.ShippingRevenue,
+        &analytics.AverageOrderValue,
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to get analytics: %w", err)
+    }
+    
+    // Get orders by status
+    statusQuery := fmt.Sprintf(`
+        SELECT status, COUNT(*)
+        FROM %s
+        WHERE %s
+        GROUP BY status
+    `, rm.allOrdersTable(), whereClause)
+    
+    rows, err := rm.db.Query(ctx, queryOrderStatusCounts, statusQuery, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get status analytics: %w", err)
+    }
+    defer rows.Close()
+    
+    analytics.OrdersByStatus = make(map[string]int64)
+    for rows.Next() {
+        var status string
+        var count int64
+        if err := rows.Scan(&status, &count); err != nil {
+            return nil, fmt.Errorf("failed to scan status: %w", err)
+        }
+        analytics.OrdersByStatus[status] = count
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read status analytics: %w", err)
+    }
+    
+    // Get orders and revenue by channel
+    channelQuery := fmt.Sprintf(`
+        SELECT channel, COUNT(*), COALESCE(SUM(%[2]s), 0)
+        FROM %[3]s
+        WHERE %[1]s
+        GROUP BY channel
+    `, whereClause, revenue, rm.allOrdersTable())
+    
+    channelRows, err := rm.db.Query(ctx, queryOrderChannelAnalytics, channelQuery, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get channel analytics: %w", err)
+    }
+    defer channelRows.Close()
+    
+    analytics.ByChannel = make(map[string]ChannelAnalyticsDTO)
+    for channelRows.Next() {
+        var channel string
+        var byChannel ChannelAnalyticsDTO
+        if err := channelRows.Scan(&channel, &byChannel.Orders, &byChannel.Revenue); err != nil {
+            return nil, fmt.Errorf("failed to scan channel: %w", err)
+        }
+        analytics.ByChannel[channel] = byChannel
+    }
+    if err := channelRows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read channel analytics: %w", err)
+    }
+    
+    // Get cancelled orders by reason
+    reasonQuery := fmt.Sprintf(`
+        SELECT COALESCE(cancellation->>'reason', $%[3]d), COUNT(*)
+        FROM %[1]s
+        WHERE %[2]s AND status = $%[4]d
+        GROUP BY 1
+    `, rm.allOrdersTable(), whereClause, len(args)+1, len(args)+2)
+    reasonArgs := append(args[:len(args):len(args)], string(valueobjects.CancellationReasonOther), string(valueobjects.OrderStatusCancelled))
+    
+    reasonRows, err := rm.db.Query(ctx, queryCancellationReasons, reasonQuery, reasonArgs...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get cancellation analytics: %w", err)
+    }
+    defer reasonRows.Close()
+    
+    analytics.CancellationsByReason = make(map[string]int64)
+    for reasonRows.Next() {
+        var reason string
+        var count int64
+        if err := reasonRows.Scan(&reason, &count); err != nil {
+            return nil, fmt.Errorf("failed to scan cancellation reason: %w", err)
+        }
+        analytics.CancellationsByReason[reason] = count
+    }
+    
+    return &analytics, reasonRows.Err()
+}
+
+// recordStatusTransition stores a transition once; redelivered ones are
+// ignored.
+func recordStatusTransition(ctx context.Context, db *sqlmetrics.DB, transition *StatusTransitionDTO) error {
+    query := `
+        INSERT INTO order_status_transitions (order_id, from_status, to_status, version, occurred_at, duration_in_previous_status)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (order_id, to_status, version) DO NOTHING
+    `
+    
+    _, err := db.Exec(ctx, queryRecordStatusTransition, query,
+        transition.OrderID,
+        transition.FromStatus,
+        transition.ToStatus,
+        transition.Version,
+        transition.OccurredAt,
+        int64(transition.DurationInPreviousStatus.Seconds()),
+    )
+    
+    if err != nil {
+        return fmt.Errorf("failed to record status transition: %w", err)
+    }
+    
+    return nil
+}
+
+// GetStatusDurations reports how long orders stayed in each tracked status,
+// from the transitions out of it that occurred in window. Archiving an
+// order leaves its transitions in place, so archived orders count too, as
+// in GetOrderAnalytics.
+func (rm *orderReadModel) GetStatusDurations(ctx context.Context, window timewindow.Window) (*StatusDurationsDTO, error) {
+    whereClause, args := window.WhereClause("occurred_at", 1)
+    query := fmt.Sprintf(`
+        SELECT
+            from_status,
+            COUNT(*),
+            COALESCE(AVG(duration_in_previous_status), 0),
+            COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY duration_in_previous_status), 0),
+            COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY duration_in_previous_status), 0),
+            COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY duration_in_previous_status), 0)
+        FROM order_status_transitions
+        WHERE %s
+        GROUP BY from_status
+    `, whereClause)
+    
+    rows, err := rm.db.Query(ctx, queryStatusDurations, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get status durations: %w", err)
+    }
+    defer rows.Close()
+    
+    durations := &StatusDurationsDTO{Durations: make(map[string]StatusDurationDTO)}
+    for _, status := range trackedDurationStatuses {
+        durations.Durations[status] = StatusDurationDTO{}
+    }
+    
+    for rows.Next() {
+        var status string
+        var duration StatusDurationDTO
+        if err := rows.Scan(
+            &status,
+            &duration.Transitions,
+            &duration.AverageSeconds,
+            &duration.P50Seconds,
+            &duration.P90Seconds,
+            &duration.P95Seconds,
+        ); err != nil {
+            return nil, fmt.Errorf("failed to scan status duration: %w", err)
+        }
+        if _, tracked := durations.Durations[status]; tracked {
+            durations.Durations[status] = duration
+        }
+    }
+    
+    return durations, rows.Err()
+}
+
+// FindTotalDiscrepancies scans the read model for orders whose total_amount
+// differs from the sum of quantity * unit price over their items.
+func (rm *orderReadModel) FindTotalDiscrepancies(ctx context.Context, limit int) ([]*TotalDiscrepancyDTO, error) {
+    query := `
+        SELECT id, total_amount, items_total
+        FROM (
+            SELECT
+                id,
+                total_amount,
+                COALESCE((
+                    SELECT SUM((item->'price'->>'amount')::BIGINT * (item->>'quantity')::BIGINT)
+                    FROM jsonb_array_elements(items) AS item
+                ), 0) AS items_total
+            FROM order_read_models
+        ) totals
+        WHERE total_amount <> items_total
+        ORDER BY id
+        LIMIT $1
+    `
+    
+    rows, err := rm.db.Query(ctx, queryTotalDiscrepancies, query, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to scan order totals: %w", err)
+    }
+    defer rows.Close()
+    
+    var discrepancies []*TotalDiscrepancyDTO
+    for rows.Next() {
+        var d TotalDiscrepancyDTO
+        if err := rows.Scan(&d.OrderID, &d.TotalAmount, &d.ItemsTotal); err != nil {
+            return nil, fmt.Errorf("failed to scan discrepancy: %w", err)
+        }
+        d.Difference = d.TotalAmount - d.ItemsTotal
+        discrepancies = append(discrepancies, &d)
+    }
+    
+    return discrepancies, rows.Err()
+}
+
+// FindCorruptOrders reads the JSON columns of the whole table in id order.
+// It is a full scan meant for the admin consistency check.
+func (rm *orderReadModel) FindCorruptOrders(ctx context.Context, limit int) ([]*CorruptOrderDTO, error) {
+    query := `
+        SELECT id, shipping_address, items, ` + tagsColumn + `, ` + deliveryColumn + `, ` + cancellationColumn + `
+        FROM order_read_models
+        ORDER BY id
+    `
+    
+    rows, err := rm.db.Query(ctx, queryCorruptOrders, query)
+    if err != nil {
+        return nil, fmt.Errorf("failed to scan orders: %w", err)
+    }
+    defer rows.Close()
+    
+    var corrupt []*CorruptOrderDTO
+    for rows.Next() && len(corrupt) < limit {
+        var order OrderDTO
+        var shippingAddressJSON, itemsJSON, tagsJSON, deliveryJSON, cancellationJSON []byte
+        if err := rows.Scan(&order.ID, &shippingAddressJSON, &itemsJSON, &tagsJSON, &deliveryJSON, &cancellationJSON); err != nil {
+            return nil, fmt.Errorf("failed to scan order: %w", err)
+        }
+        
+        var corruptErr *CorruptOrderError
+        if err := decodeOrderJSON(&order, shippingAddressJSON, itemsJSON, tagsJSON, deliveryJSON, cancellationJSON); errors.As(err, &corruptErr) {
+            corrupt = append(corrupt, &CorruptOrderDTO{OrderID: corruptErr.OrderID, Field: corruptErr.Field, Error: corruptErr.Err.Error()})
+        }
+    }
+    
+    return corrupt, rows.Err()
+}
+
+// CountOrdersByStatus counts archived orders too, as the write side keeps
+// them.
+func (rm *orderReadModel) CountOrdersByStatus(ctx context.Context) (map[string]int64, error) {
+    query := `SELECT status, COUNT(*) FROM ` + rm.allOrdersTable() + ` GROUP BY status`
+    
+    rows, err := rm.db.Query(ctx, queryCountByStatus, query)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count orders by status: %w", err)
+    }
+    defer rows.Close()
+    
+    counts := map[string]int64{}
+    for rows.Next() {
+        var status string
+        var count int64
+        if err := rows.Scan(&status, &count); err != nil {
+            return nil, fmt.Errorf("failed to scan status count: %w", err)
+        }
+        counts[status] = count
+    }
+    return counts, rows.Err()
+}
+
+// ListOrderIDs compares ids in the C collation, so they come in the byte
+// order the reconciliation merges them in whatever the database's collation.
+// Archived orders are listed too.
+func (rm *orderReadModel) ListOrderIDs(ctx context.Context, after string, limit int) ([]string, error) {
+    query := `
+        SELECT id FROM ` + rm.allOrdersTable() + `
+        WHERE id COLLATE "C" > $1
+        ORDER BY id COLLATE "C"
+        LIMIT $2
+    `
+    
+    rows, err := rm.db.Query(ctx, queryListOrderIDs, query, after, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list order ids: %w", err)
+    }
+    defer rows.Close()
+    
+    var ids []string
+    for rows.Next() {
+        var id string
+        if err := rows.Scan(&id); err != nil {
+            return nil, fmt.Errorf("failed to scan order id: %w", err)
+        }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+// orderCurrency returns the currency an order totalling total is stored
+// in, valueobjects.DefaultCurrency for totals written without one.
+func orderCurrency(total valueobjects.Money) string {
+    if total.Currency == "" {
+        return valueobjects.DefaultCurrency
+    }
+    return total.Currency
+}
+
+// setCurrency gives order's totals the currency it is stored in, and its
+// items too when they were stored before unit price currencies were kept
+// on the read model.
+func setCurrency(order *OrderDTO, currency string) {
+    order.TotalAmount.Currency = currency
+    order.ShippingCost.Currency = currency
+    order.GrandTotal.Currency = currency
+    for i := range order.Items {
+        if order.Items[i].Price.Currency == "" {
+            order.Items[i].Price.Currency = currency
+        }
+    }
+}
@@ -0,0 +1,678 @@
+package readmodels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/domain/entities"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// newTestOrderReadModel reads and writes orders in a fresh schema, through
+// a cache in miniredis, so a mutator that forgets to invalidate the cache
+// reads back its old order.
+func newTestOrderReadModel(t *testing.T) OrderReadModel {
+    t.Helper()
+    rm, _ := newTestReadModels(t)
+    return rm
+}
+
+// newTestReadModels is newTestOrderReadModel with opts, and the history
+// read model of the same schema. With noCacheEnv set the order read model
+// runs without a cache, as it does when Redis is not configured.
+func newTestReadModels(t *testing.T, opts ...OrderReadModelOption) (OrderReadModel, OrderHistoryReadModel) {
+    t.Helper()
+    db := sqlmetrics.Wrap(schematest.Open(t), 0)
+    if os.Getenv(noCacheEnv) != "" {
+        return NewOrderReadModel(db, nil, opts...), NewOrderHistoryReadModel(db)
+    }
+    client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+    t.Cleanup(func() { client.Close() })
+    return NewOrderReadModel(db, NewCache(client, CacheConfig{}), opts...), NewOrderHistoryReadModel(db)
+}
+
+// seedOrder inserts a confirmed order at version 2, with columns each
+// writer owns set: items and address by the projection, order number,
+// channel and contact email at creation, and a tag through the admin API.
+func seedOrder(t *testing.T, rm OrderReadModel) *OrderDTO {
+    t.Helper()
+    ctx := context.Background()
+    createdAt := apijson.NewTimestamp(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+    order := &OrderDTO{
+        ID:              uuid.NewString(),
+        OrderNumber:     "ORD-2024-000001",
+        CustomerID:      uuid.NewString(),
+        ContactEmail:    "buyer@example.com",
+        Status:          "confirmed",
+        TotalAmount:     valueobjects.NewMoney(3000, "USD"),
+        ShippingCost:    valueobjects.NewMoney(500, "USD"),
+        GrandTotal:      valueobjects.NewMoney(3500, "USD"),
+        ShippingAddress: valueobjects.NewAddress("1 Main St", "Springfield", "IL", "62701", "US"),
+        Channel:         "web",
+        Items: []OrderItemDTO{
+            {ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(1000, "USD")},
+            {ProductID: "product-2", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")},
+        },
+        Version:         2,
+        StatusChangedAt: createdAt,
+        CreatedAt:       createdAt,
+        UpdatedAt:       createdAt,
+    }
+    if err := rm.InsertOrder(ctx, order); err != nil {
+        t.Fatalf("InsertOrder() = %v", err)
+    }
+    if err := rm.AddTag(ctx, order.ID, "vip"); err != nil {
+        t.Fatalf("AddTag() = %v", err)
+    }
+    
+    stored, err := rm.GetOrder(ctx, order.ID)
+    if err != nil {
+        t.Fatalf("GetOrder() = %v", err)
+    }
+    return stored
+}
+
+// withoutTimestamps leaves out the timestamps and projection metadata
+// every write changes.
+func withoutTimestamps(order *OrderDTO) OrderDTO {
+    c := *order
+    c.StatusChangedAt, c.CreatedAt, c.UpdatedAt = apijson.Timestamp{}, apijson.Timestamp{}, apijson.Timestamp{}
+    c.Meta = nil
+    return c
+}
+
+// Each mutator writes only the columns its event owns, leaving the rest of
+// the order as it was.
+func TestOrderReadModel_narrowMutators(t *testing.T) {
+    later := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+    newItems := []OrderItemDTO{{ProductID: "product-3", Quantity: 5, Price: valueobjects.NewMoney(200, "USD")}}
+    newAddress := valueobjects.NewAddress("2 Oak Ave", "Portland", "OR", "97201", "US")
+    laterTimestamp, signedBy := apijson.NewTimestamp(later), "J. Doe"
+    
+    tests := []struct {
+        name    string
+        mutate  func(ctx context.Context, rm OrderReadModel, orderID string) error
+        wantErr error
+        // want applies the mutation's changes to the order as it was
+        want    func(order *OrderDTO)
+    }{
+        {
+            name: "status",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.SetStatus(ctx, orderID, StatusChange{Status: "shipped", ChangedAt: later, Version: 3, EventType: "OrderShipped"})
+            },
+            want: func(order *OrderDTO) {
+                order.Status = "shipped"
+                order.Version = 3
+            },
+        },
+        {
+            name: "cancellation",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.SetStatus(ctx, orderID, StatusChange{Status: "cancelled", ChangedAt: later, Version: 3, EventType: "OrderCancelled", Cancellation: &CancellationDTO{Reason: "fraud"}})
+            },
+            want: func(order *OrderDTO) {
+                order.Status = "cancelled"
+                order.Version = 3
+                order.Cancellation = &CancellationDTO{Reason: "fraud"}
+            },
+        },
+        {
+            name: "delivery",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.SetStatus(ctx, orderID, StatusChange{Status: "delivered", ChangedAt: later, Version: 3, EventType: "OrderDelivered", Delivery: &DeliveryDTO{DeliveredAt: &laterTimestamp, SignedBy: &signedBy}})
+            },
+            want: func(order *OrderDTO) {
+                order.Status = "delivered"
+                order.Version = 3
+                order.Delivery = &DeliveryDTO{DeliveredAt: &laterTimestamp, SignedBy: &signedBy}
+            },
+        },
+        {
+            name: "items",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.SetItemsAndTotal(ctx, orderID, ItemsChange{
+                    Items:        newItems,
+                    TotalAmount:  valueobjects.NewMoney(1000, "USD"),
+                    ShippingCost: valueobjects.NewMoney(500, "USD"),
+                    GrandTotal:   valueobjects.NewMoney(1500, "USD"),
+                    UpdatedAt:    later,
+                    Version:      3,
+                    EventType:    "OrderItemAdded",
+                })
+            },
+            want: func(order *OrderDTO) {
+                order.Items = newItems
+                order.TotalAmount.Amount, order.GrandTotal.Amount = 1000, 1500
+                order.Version = 3
+            },
+        },
+        {
+            name: "shipping address",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.SetShippingAddress(ctx, orderID, ShippingAddressChange{
+                    ShippingAddress: newAddress,
+                    ShippingCost:    valueobjects.NewMoney(700, "USD"),
+                    GrandTotal:      valueobjects.NewMoney(3700, "USD"),
+                    UpdatedAt:       later,
+                    Version:         3,
+                    EventType:       "OrderShippingAddressChanged",
+                })
+            },
+            want: func(order *OrderDTO) {
+                order.ShippingAddress = newAddress
+                order.ShippingCost.Amount, order.GrandTotal.Amount = 700, 3700
+                order.Version = 3
+            },
+        },
+        {
+            name: "status override keeps the version",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.OverrideStatus(ctx, orderID, "delivered", later)
+            },
+            want: func(order *OrderDTO) {
+                order.Status = "delivered"
+            },
+        },
+        {
+            name: "status override of a missing order",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.OverrideStatus(ctx, uuid.NewString(), "delivered", later)
+            },
+            wantErr: ErrOrderNotFound,
+            want:    func(*OrderDTO) {},
+        },
+        {
+            name: "stale status",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.SetStatus(ctx, orderID, StatusChange{Status: "draft", ChangedAt: later, Version: 2, EventType: "OrderReopened"})
+            },
+            wantErr: ErrStaleVersion,
+            want:    func(*OrderDTO) {},
+        },
+        {
+            name: "redelivered creation",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                return rm.InsertOrder(ctx, &OrderDTO{ID: orderID, Status: "draft", Channel: "api", Items: newItems, Version: 1})
+            },
+            want: func(*OrderDTO) {},
+        },
+        {
+            name: "rebuild keeps the tags",
+            mutate: func(ctx context.Context, rm OrderReadModel, orderID string) error {
+                order, err := rm.GetOrder(ctx, orderID)
+                if err != nil {
+                    return err
+                }
+                order.Status, order.Version, order.Tags = "shipped", 3, nil
+                return rm.UpsertOrder(ctx, order)
+            },
+            want: func(order *OrderDTO) {
+                order.Status = "shipped"
+                order.Version = 3
+            },
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx := context.Background()
+            rm := newTestOrderReadModel(t)
+            before := seedOrder(t, rm)
+            
+            if err := tt.mutate(ctx, rm, before.ID); !errors.Is(err, tt.wantErr) {
+                t.Fatalf("mutation = %v, want %v", err, tt.wantErr)
+            }
+            
+            // Read through the cache GetOrder filled in seedOrder
+            after, err := rm.GetOrder(ctx, before.ID)
+            if err != nil {
+                t.Fatalf("GetOrder() = %v", err)
+            }
+            want := withoutTimestamps(before)
+            tt.want(&want)
+            if got := withoutTimestamps(after); !reflect.DeepEqual(got, want) {
+                t.Errorf("order after the mutation =\n%+v\nwant\n%+v", got, want)
+            }
+        })
+    }
+}
+
+// Orders whose total differs from their items' sum are reported; consistent
+// ones are not.
+func TestOrderReadModel_FindTotalDiscrepancies(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    drifted := *seedOrder(t, rm)
+    drifted.ID = uuid.NewString()
+    drifted.OrderNumber = "ORD-2024-000002"
+    drifted.Tags = nil
+    drifted.TotalAmount = valueobjects.NewMoney(2500, "USD")
+    if err := rm.InsertOrder(ctx, &drifted); err != nil {
+        t.Fatalf("InsertOrder() = %v", err)
+    }
+    
+    discrepancies, err := rm.FindTotalDiscrepancies(ctx, 10)
+    if err != nil {
+        t.Fatalf("FindTotalDiscrepancies() = %v", err)
+    }
+    want := []*TotalDiscrepancyDTO{{OrderID: drifted.ID, TotalAmount: 2500, ItemsTotal: 3000, Difference: -500}}
+    if !reflect.DeepEqual(discrepancies, want) {
+        t.Errorf("FindTotalDiscrepancies() = %+v, want %+v", discrepancies, want)
+    }
+}
+
+// Statuses of cached orders come from the cache, the rest from one query, and
+// unknown ids are left out.
+func TestOrderReadModel_GetOrderStatuses(t *testing.T) {
+    ctx := context.Background()
+    sqlDB := schematest.Open(t)
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+    t.Cleanup(func() { client.Close() })
+    cache := NewCache(client, CacheConfig{})
+    rm := NewOrderReadModel(sqlmetrics.Wrap(sqlDB, 0), cache)
+    
+    // seedOrder reads the order back, caching it as confirmed
+    cached := seedOrder(t, rm)
+    uncached := *cached
+    uncached.ID = uuid.NewString()
+    uncached.OrderNumber = "ORD-2024-000002"
+    uncached.Tags = nil
+    if err := rm.InsertOrder(ctx, &uncached); err != nil {
+        t.Fatalf("InsertOrder() = %v", err)
+    }
+    server.Del(cache.orderKey(uncached.ID))
+    // Moving both on in the table alone shows which source each status came from
+    if _, err := sqlDB.ExecContext(ctx, `UPDATE order_read_models SET status = 'shipped', version = 3 WHERE id IN ($1, $2)`, cached.ID, uncached.ID); err != nil {
+        t.Fatalf("updating orders: %v", err)
+    }
+    missing := uuid.NewString()
+    
+    statuses, err := rm.GetOrderStatuses(ctx, []string{cached.ID, uncached.ID, missing})
+    if err != nil {
+        t.Fatalf("GetOrderStatuses() = %v", err)
+    }
+    want := map[string]OrderStatusDTO{
+        cached.ID:   {Status: "confirmed", UpdatedAt: cached.UpdatedAt, Version: 2},
+        uncached.ID: {Status: "shipped", UpdatedAt: uncached.UpdatedAt, Version: 3},
+    }
+    if !reflect.DeepEqual(statuses, want) {
+        t.Errorf("GetOrderStatuses() = %+v, want %+v", statuses, want)
+    }
+}
+
+// CacheCustomerOrders writes the customer's first orders as the database
+// has them now to the customer's list key.
+func TestOrderReadModel_CacheCustomerOrders(t *testing.T) {
+    ctx := context.Background()
+    sqlDB := schematest.Open(t)
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+    t.Cleanup(func() { client.Close() })
+    cache := NewCache(client, CacheConfig{})
+    rm := NewOrderReadModel(sqlmetrics.Wrap(sqlDB, 0), cache)
+    order := seedOrder(t, rm)
+    
+    cached := func() []*OrderSummaryDTO {
+        t.Helper()
+        data, err := server.Get(cache.customerOrdersKey(order.CustomerID))
+        if err != nil {
+            t.Fatalf("customer orders key: %v", err)
+        }
+        var summaries []*OrderSummaryDTO
+        if err := json.Unmarshal([]byte(data), &summaries); err != nil {
+            t.Fatalf("decoding customer orders key: %v", err)
+        }
+        return summaries
+    }
+    
+    if err := rm.CacheCustomerOrders(ctx, order.CustomerID); err != nil {
+        t.Fatalf("CacheCustomerOrders() = %v", err)
+    }
+    if got := cached(); len(got) != 1 || got[0].ID != order.ID || got[0].Status != "confirmed" {
+        t.Fatalf("cached customer orders = %+v, want the confirmed order", got)
+    }
+    
+    // A refresh reads the table, not what the key held
+    if _, err := sqlDB.ExecContext(ctx, `UPDATE order_read_models SET status = 'shipped' WHERE id = $1`, order.ID); err != nil {
+        t.Fatalf("updating order: %v", err)
+    }
+    if err := rm.CacheCustomerOrders(ctx, order.CustomerID); err != nil {
+        t.Fatalf("CacheCustomerOrders() = %v", err)
+    }
+    if got := cached(); len(got) != 1 || got[0].Status != "shipped" {
+        t.Errorf("cached customer orders after a refresh = %+v, want the shipped order", got)
+    }
+    
+    // A customer without orders is cached as an empty list
+    other := uuid.NewString()
+    if err := rm.CacheCustomerOrders(ctx, other); err != nil {
+        t.Fatalf("CacheCustomerOrders() = %v", err)
+    }
+    if data, _ := server.Get(cache.customerOrdersKey(other)); data != "[]" {
+        t.Errorf("cached orders of a customer without orders = %q, want []", data)
+    }
+}
+
+// Filtering by product matches on the generated product_ids column, and the
+// generated item_count follows the items.
+func TestOrderReadModel_productFilter(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    twoItems := seedOrder(t, rm)
+    oneItem := *twoItems
+    oneItem.ID = uuid.NewString()
+    oneItem.OrderNumber = "ORD-2024-000002"
+    oneItem.Items = []OrderItemDTO{{ProductID: "product-3", Quantity: 4, Price: valueobjects.NewMoney(750, "USD")}}
+    if err := rm.InsertOrder(ctx, &oneItem); err != nil {
+        t.Fatalf("InsertOrder() = %v", err)
+    }
+    
+    tests := []struct {
+        productID string
+        wantIDs   []string
+        wantCount int
+    }{
+        {productID: "product-2", wantIDs: []string{twoItems.ID}, wantCount: 2},
+        {productID: "product-3", wantIDs: []string{oneItem.ID}, wantCount: 1},
+        {productID: "product-9"},
+        // A product id is matched whole, not as a prefix
+        {productID: "product"},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.productID, func(t *testing.T) {
+            filter := OrderFilter{ProductID: tt.productID}
+            summaries, err := rm.ListOrderSummaries(ctx, filter, pagination.Pagination{Limit: 10})
+            if err != nil {
+                t.Fatalf("ListOrderSummaries() = %v", err)
+            }
+            var ids []string
+            for _, summary := range summaries {
+                ids = append(ids, summary.ID)
+                if summary.ItemCount != tt.wantCount {
+                    t.Errorf("item_count of %s = %d, want %d", summary.ID, summary.ItemCount, tt.wantCount)
+                }
+            }
+            if !reflect.DeepEqual(ids, tt.wantIDs) {
+                t.Errorf("ListOrderSummaries(%s) = %v, want %v", tt.productID, ids, tt.wantIDs)
+            }
+            
+            orders, err := rm.ListOrders(ctx, filter, pagination.Pagination{Limit: 10})
+            if err != nil {
+                t.Fatalf("ListOrders() = %v", err)
+            }
+            if len(orders) != len(tt.wantIDs) {
+                t.Fatalf("ListOrders(%s) = %d orders, want %d", tt.productID, len(orders), len(tt.wantIDs))
+            }
+            for _, order := range orders {
+                if len(order.Items) != tt.wantCount {
+                    t.Errorf("ListOrders(%s) decoded %d items, want %d", tt.productID, len(order.Items), tt.wantCount)
+                }
+            }
+        })
+    }
+}
+
+// Analytics break orders and revenue down by channel, and the list filters
+// on it.
+func TestOrderReadModel_channels(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    web := seedOrder(t, rm)
+    var mobile []string
+    for i, channel := range []string{"mobile", "mobile", "unknown"} {
+        order := *web
+        order.ID = uuid.NewString()
+        order.OrderNumber = fmt.Sprintf("ORD-2024-%06d", i+2)
+        order.Channel = channel
+        if err := rm.InsertOrder(ctx, &order); err != nil {
+            t.Fatalf("InsertOrder() = %v", err)
+        }
+        if channel == "mobile" {
+            mobile = append(mobile, order.ID)
+        }
+    }
+    
+    analytics, err := rm.GetOrderAnalytics(ctx, timewindow.Window{Period: timewindow.All, Location: time.UTC}, true)
+    if err != nil {
+        t.Fatalf("GetOrderAnalytics() = %v", err)
+    }
+    want := map[string]ChannelAnalyticsDTO{
+        "web":     {Orders: 1, Revenue: 3500},
+        "mobile":  {Orders: 2, Revenue: 7000},
+        "unknown": {Orders: 1, Revenue: 3500},
+    }
+    if !reflect.DeepEqual(analytics.ByChannel, want) {
+        t.Errorf("ByChannel = %v, want %v", analytics.ByChannel, want)
+    }
+    
+    summaries, err := rm.ListOrderSummaries(ctx, OrderFilter{Channel: "mobile"}, pagination.Pagination{Limit: 10})
+    if err != nil {
+        t.Fatalf("ListOrderSummaries() = %v", err)
+    }
+    var got []string
+    for _, summary := range summaries {
+        got = append(got, summary.ID)
+    }
+    sort.Strings(got)
+    sort.Strings(mobile)
+    if !reflect.DeepEqual(got, mobile) {
+        t.Errorf("mobile orders = %v, want %v", got, mobile)
+    }
+}
+
+// Cancelled orders are counted by reason, those projected before reasons
+// were recorded as other; a reopened order loses its reason and is not
+// counted.
+func TestOrderReadModel_cancellationsByReason(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    seeded := seedOrder(t, rm)
+    cancelledAt := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+    insert := func(n int, status string) string {
+        order := *seeded
+        order.ID = uuid.NewString()
+        order.OrderNumber = fmt.Sprintf("ORD-2024-%06d", n)
+        order.Status = status
+        order.Tags = nil
+        if err := rm.InsertOrder(ctx, &order); err != nil {
+            t.Fatalf("InsertOrder() = %v", err)
+        }
+        return order.ID
+    }
+    cancel := func(orderID, reason string) {
+        change := StatusChange{Status: "cancelled", ChangedAt: cancelledAt, Version: 3, EventType: "OrderCancelled", Cancellation: &CancellationDTO{Reason: reason}}
+        if err := rm.SetStatus(ctx, orderID, change); err != nil {
+            t.Fatalf("SetStatus(cancelled) = %v", err)
+        }
+    }
+    
+    cancel(insert(2, "confirmed"), "fraud")
+    cancel(insert(3, "confirmed"), "fraud")
+    insert(4, "cancelled")
+    reopened := insert(5, "confirmed")
+    cancel(reopened, "payment_failed")
+    if err := rm.SetStatus(ctx, reopened, StatusChange{Status: "draft", ChangedAt: cancelledAt.Add(time.Hour), Version: 4, EventType: "OrderReopened"}); err != nil {
+        t.Fatalf("SetStatus(draft) = %v", err)
+    }
+    
+    order, err := rm.GetOrder(ctx, reopened)
+    if err != nil {
+        t.Fatalf("GetOrder() = %v", err)
+    }
+    if order.Cancellation != nil {
+        t.Errorf("reopened order's cancellation = %+v, want none", order.Cancellation)
+    }
+    analytics, err := rm.GetOrderAnalytics(ctx, timewindow.Window{Period: timewindow.All, Location: time.UTC}, true)
+    if err != nil {
+        t.Fatalf("GetOrderAnalytics() = %v", err)
+    }
+    want := map[string]int64{"fraud": 2, "other": 1}
+    if !reflect.DeepEqual(analytics.CancellationsByReason, want) {
+        t.Errorf("CancellationsByReason = %v, want %v", analytics.CancellationsByReason, want)
+    }
+}
+
+// Writes and history reads of a malformed order id fail before reaching the
+// database, which is nil here.
+func TestReadModels_invalidOrderID(t *testing.T) {
+    ctx := context.Background()
+    rm := NewOrderReadModel(nil, nil)
+    history := NewOrderHistoryReadModel(nil)
+    
+    calls := map[string]func() error{
+        "AddTag":         func() error { return rm.AddTag(ctx, "order-1", "vip") },
+        "RemoveTag":      func() error { return rm.RemoveTag(ctx, "order-1", "vip") },
+        "OverrideStatus": func() error { return rm.OverrideStatus(ctx, "order-1", "shipped", time.Now()) },
+        "GetHistory": func() error {
+            _, err := history.GetHistory(ctx, "order-1")
+            return err
+        },
+    }
+    for name, call := range calls {
+        if err := call(); !errors.Is(err, entities.ErrInvalidOrderID) {
+            t.Errorf("%s() = %v, want ErrInvalidOrderID", name, err)
+        }
+    }
+}
+
+// An order is found by its number, which no other order of the read model
+// may have; orders without a number are never matched.
+func TestOrderReadModel_orderNumber(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    numbered := seedOrder(t, rm)
+    unnumbered := *numbered
+    unnumbered.ID = uuid.NewString()
+    unnumbered.OrderNumber = ""
+    unnumbered.Tags = nil
+    if err := rm.InsertOrder(ctx, &unnumbered); err != nil {
+        t.Fatalf("InsertOrder() without a number = %v", err)
+    }
+    
+    summaries, err := rm.ListOrderSummaries(ctx, OrderFilter{Number: numbered.OrderNumber}, pagination.Pagination{Limit: 10})
+    if err != nil {
+        t.Fatalf("ListOrderSummaries() = %v", err)
+    }
+    if len(summaries) != 1 || summaries[0].ID != numbered.ID || summaries[0].OrderNumber != numbered.OrderNumber {
+        t.Errorf("orders numbered %s = %+v, want only %s", numbered.OrderNumber, summaries, numbered.ID)
+    }
+    if orders, err := rm.ListOrders(ctx, OrderFilter{Number: "ORD-2024-999999"}, pagination.Pagination{Limit: 10}); err != nil || len(orders) != 0 {
+        t.Errorf("orders with an unknown number = %d, %v, want none", len(orders), err)
+    }
+    
+    duplicate := unnumbered
+    duplicate.ID = uuid.NewString()
+    duplicate.OrderNumber = numbered.OrderNumber
+    if err := rm.InsertOrder(ctx, &duplicate); err == nil {
+        t.Error("InsertOrder() of a second order with the same number = nil, want an error")
+    }
+}
+
+// Projection writes record the event they applied and when; an admin
+// status override is no projection and leaves them alone.
+func TestOrderReadModel_meta(t *testing.T) {
+    ctx := context.Background()
+    fake := clock.NewFake(time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC))
+    defer clock.Set(fake)()
+    rm := newTestOrderReadModel(t)
+    order := seedOrder(t, rm)
+    
+    fake.Advance(time.Hour)
+    if err := rm.SetStatus(ctx, order.ID, StatusChange{Status: "shipped", ChangedAt: order.UpdatedAt.Add(time.Hour), Version: order.Version + 1, EventType: "OrderShipped"}); err != nil {
+        t.Fatalf("SetStatus() = %v", err)
+    }
+    shippedAt := fake.Now()
+    want := OrderMetaDTO{LastAppliedVersion: order.Version + 1, LastEventType: "OrderShipped"}
+    got, err := rm.GetOrder(ctx, order.ID)
+    if err != nil {
+        t.Fatalf("GetOrder() = %v", err)
+    }
+    if got.Meta == nil || got.Meta.ProjectedAt == nil || !got.Meta.ProjectedAt.Equal(shippedAt) || got.Meta.LastAppliedVersion != want.LastAppliedVersion || got.Meta.LastEventType != want.LastEventType {
+        t.Fatalf("meta = %+v, want %+v projected at %v", got.Meta, want, shippedAt)
+    }
+    
+    fake.Advance(time.Hour)
+    if err := rm.OverrideStatus(ctx, order.ID, "delivered", fake.Now()); err != nil {
+        t.Fatalf("OverrideStatus() = %v", err)
+    }
+    got, err = rm.GetOrder(ctx, order.ID)
+    if err != nil {
+        t.Fatalf("GetOrder() = %v", err)
+    }
+    if got.Status != "delivered" || got.Meta.LastEventType != "OrderShipped" || !got.Meta.ProjectedAt.Equal(shippedAt) {
+        t.Errorf("after the override order is %s with meta %+v, want delivered with the shipment's meta", got.Status, got.Meta)
+    }
+}
+
+// GetOrders reads cached orders from the cache and the rest from the
+// table, leaving out unknown ids; ApplyOrder writes an order only over an
+// older version.
+func TestOrderReadModel_GetOrdersAndApplyOrder(t *testing.T) {
+    ctx := context.Background()
+    sqlDB := schematest.Open(t)
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+    t.Cleanup(func() { client.Close() })
+    rm := NewOrderReadModel(sqlmetrics.Wrap(sqlDB, 0), NewCache(client, CacheConfig{}))
+    
+    // seedOrder reads the order back, caching it
+    cached := seedOrder(t, rm)
+    uncached := *cached
+    uncached.ID = uuid.NewString()
+    uncached.OrderNumber = "ORD-2024-000002"
+    uncached.Tags = nil
+    if err := rm.InsertOrder(ctx, &uncached); err != nil {
+        t.Fatalf("InsertOrder() = %v", err)
+    }
+    
+    orders, err := rm.GetOrders(ctx, []string{cached.ID, uncached.ID, uuid.NewString()})
+    if err != nil {
+        t.Fatalf("GetOrders() = %v", err)
+    }
+    if len(orders) != 2 || orders[cached.ID] == nil || orders[uncached.ID] == nil {
+        t.Fatalf("GetOrders() = %v, want the two stored orders", orders)
+    }
+    if got := withoutTimestamps(orders[cached.ID]); !reflect.DeepEqual(got, withoutTimestamps(cached)) {
+        t.Errorf("GetOrders() cached order = %+v, want %+v", got, withoutTimestamps(cached))
+    }
+    if got := orders[uncached.ID]; got.OrderNumber != uncached.OrderNumber || !reflect.DeepEqual(got.Items, uncached.Items) {
+        t.Errorf("GetOrders() uncached order = %+v, want %+v", got, uncached)
+    }
+    if orders, err := rm.GetOrders(ctx, nil); err != nil || len(orders) != 0 {
+        t.Errorf("GetOrders(nil) = %v, %v, want no orders", orders, err)
+    }
+    
+    shipped := *orders[cached.ID]
+    shipped.Status, shipped.Version = "shipped", cached.Version+1
+    if err := rm.ApplyOrder(ctx, &shipped); err != nil {
+        t.Fatalf("ApplyOrder() = %v", err)
+    }
+    stale := shipped
+    stale.Status = "cancelled"
+    if err := rm.ApplyOrder(ctx, &stale); !errors.Is(err, ErrStaleVersion) {
+        t.Errorf("ApplyOrder() at the stored version = %v, want ErrStaleVersion", err)
+    }
+    if got, err := rm.GetOrder(ctx, cached.ID); err != nil || got.Status != "shipped" || got.Version != shipped.Version {
+        t.Errorf("GetOrder() after ApplyOrder() = %+v, %v, want shipped at version %d", got, err, shipped.Version)
+    }
+}
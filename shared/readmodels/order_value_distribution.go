@@ -0,0 +1,143 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+// ErrInvalidValueBuckets is returned for order value bucket bounds that are
+// not increasing, are negative or are too many.
+var ErrInvalidValueBuckets = errors.New("invalid order value buckets")
+
+// MaxOrderValueBuckets caps the bounds a distribution may be asked for.
+const MaxOrderValueBuckets = 50
+
+// DefaultOrderValueBuckets are the upper bounds, in minor units, of the
+// order value bands reported when no others are asked for.
+var DefaultOrderValueBuckets = []int64{1000, 2500, 5000, 10000, 25000, 50000, 100000}
+
+// OrderValueDistributionDTO counts the orders in each value band, by
+// currency. Every currency lists every band, including empty ones.
+type OrderValueDistributionDTO struct {
+    Period     string                           `json:"period"`
+    Bounds     []int64                          `json:"bounds"`
+    ByCurrency map[string][]OrderValueBucketDTO `json:"by_currency"`
+}
+
+// OrderValueBucketDTO is one value band: orders worth more than Above and
+// at most UpTo. The first band has no lower bound and the last no upper
+// bound.
+type OrderValueBucketDTO struct {
+    Above *int64 `json:"above"`
+    UpTo  *int64 `json:"up_to"`
+    Count int64  `json:"count"`
+}
+
+// ValidateOrderValueBuckets checks that bounds are usable bucket bounds:
+// non-negative, strictly increasing and at most MaxOrderValueBuckets.
+func ValidateOrderValueBuckets(bounds []int64) error {
+    if len(bounds) > MaxOrderValueBuckets {
+        return fmt.Errorf("%w: at most %d bounds", ErrInvalidValueBuckets, MaxOrderValueBuckets)
+    }
+    for i, bound := range bounds {
+        if bound < 0 {
+            return fmt.Errorf("%w: bound %d is negative", ErrInvalidValueBuckets, bound)
+        }
+        if i > 0 && bound <= bounds[i-1] {
+            return fmt.Errorf("%w: bounds must increase, %d follows %d", ErrInvalidValueBuckets, bound, bounds[i-1])
+        }
+    }
+    return nil
+}
+
+// OrderValueBucket returns the index of the band of bounds that value falls
+// in. Upper bounds are inclusive, as Prometheus' le buckets are: a value
+// equal to bounds[i] falls in band i, and values above the last bound in
+// band len(bounds).
+func OrderValueBucket(bounds []int64, value int64) int {
+    return sort.Search(len(bounds), func(i int) bool { return value <= bounds[i] })
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryOrderValueDistribution = "order_read_models.value_distribution"
+)
+
+// GetOrderValueDistribution counts the orders created in window by grand
+// total, in the bands bounds delimits as OrderValueBucket assigns them.
+// No bounds take DefaultOrderValueBuckets. Archived orders count too, as
+// in GetOrderAnalytics.
+func (rm *orderReadModel) GetOrderValueDistribution(ctx context.Context, window timewindow.Window, bounds []int64) (*OrderValueDistributionDTO, error) {
+    if len(bounds) == 0 {
+        bounds = DefaultOrderValueBuckets
+    }
+    if err := ValidateOrderValueBuckets(bounds); err != nil {
+        return nil, err
+    }
+    // The bands point into bounds, which must not be the caller's
+    bounds = append([]int64(nil), bounds...)
+    
+    // The CASE assigns bands as OrderValueBucket does; its first matching
+    // branch is the lowest bound the value does not exceed
+    var bands strings.Builder
+    args := make([]interface{}, len(bounds))
+    for i, bound := range bounds {
+        fmt.Fprintf(&bands, " WHEN value <= $%d THEN %d", i+1, i)
+        args[i] = bound
+    }
+    whereClause, windowArgs := window.WhereClause("created_at", len(bounds)+1)
+    args = append(args, windowArgs...)
+    
+    query := fmt.Sprintf(`
+        SELECT currency, CASE%s ELSE %d END AS band, COUNT(*)
+        FROM (
+            SELECT currency, total_amount + shipping_cost AS value
+            FROM %s
+            WHERE %s
+        ) AS orders
+        GROUP BY currency, band
+    `, bands.String(), len(bounds), rm.allOrdersTable(), whereClause)
+    
+    rows, err := rm.db.Query(ctx, queryOrderValueDistribution, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get order value distribution: %w", err)
+    }
+    defer rows.Close()
+    
+    distribution := &OrderValueDistributionDTO{
+        Period:     string(window.Period),
+        Bounds:     bounds,
+        ByCurrency: make(map[string][]OrderValueBucketDTO),
+    }
+    for rows.Next() {
+        var currency string
+        var band int
+        var count int64
+        if err := rows.Scan(&currency, &band, &count); err != nil {
+            return nil, fmt.Errorf("failed to scan order value distribution: %w", err)
+        }
+        buckets, ok := distribution.ByCurrency[currency]
+        if !ok {
+            buckets = newOrderValueBuckets(bounds)
+            distribution.ByCurrency[currency] = buckets
+        }
+        buckets[band].Count = count
+    }
+    
+    return distribution, rows.Err()
+}
+
+// newOrderValueBuckets returns the empty bands bounds delimits.
+func newOrderValueBuckets(bounds []int64) []OrderValueBucketDTO {
+    buckets := make([]OrderValueBucketDTO, len(bounds)+1)
+    for i := range bounds {
+        buckets[i].UpTo = &bounds[i]
+        buckets[i+1].Above = &bounds[i]
+    }
+    return buckets
+}
@@ -0,0 +1,149 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/timewindow"
+)
+
+// Upper bounds are inclusive: a value on a bound falls in the band below
+// it, one minor unit more in the band above.
+func TestOrderValueBucket(t *testing.T) {
+    bounds := []int64{1000, 5000}
+    tests := []struct {
+        value int64
+        want  int
+    }{
+        {value: -1, want: 0},
+        {value: 0, want: 0},
+        {value: 999, want: 0},
+        {value: 1000, want: 0},
+        {value: 1001, want: 1},
+        {value: 5000, want: 1},
+        {value: 5001, want: 2},
+        {value: 1 << 40, want: 2},
+    }
+    
+    for _, tt := range tests {
+        if got := OrderValueBucket(bounds, tt.value); got != tt.want {
+            t.Errorf("OrderValueBucket(%v, %d) = %d, want %d", bounds, tt.value, got, tt.want)
+        }
+    }
+    if got := OrderValueBucket(nil, 1000); got != 0 {
+        t.Errorf("OrderValueBucket(nil, 1000) = %d, want 0", got)
+    }
+}
+
+func TestValidateOrderValueBuckets(t *testing.T) {
+    tooMany := make([]int64, MaxOrderValueBuckets+1)
+    for i := range tooMany {
+        tooMany[i] = int64(i)
+    }
+    
+    tests := []struct {
+        name    string
+        bounds  []int64
+        wantErr bool
+    }{
+        {name: "default", bounds: DefaultOrderValueBuckets},
+        {name: "none", bounds: nil},
+        {name: "zero", bounds: []int64{0, 1000}},
+        {name: "the most", bounds: tooMany[:MaxOrderValueBuckets]},
+        {name: "negative", bounds: []int64{-1, 1000}, wantErr: true},
+        {name: "repeated", bounds: []int64{1000, 1000}, wantErr: true},
+        {name: "decreasing", bounds: []int64{5000, 1000}, wantErr: true},
+        {name: "too many", bounds: tooMany, wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := ValidateOrderValueBuckets(tt.bounds)
+            if tt.wantErr != errors.Is(err, ErrInvalidValueBuckets) || (!tt.wantErr && err != nil) {
+                t.Errorf("ValidateOrderValueBuckets(%v) = %v, want error %t", tt.bounds, err, tt.wantErr)
+            }
+        })
+    }
+}
+
+// The first band has no lower bound and the last no upper bound; the others
+// run from the bound below them to their own.
+func TestNewOrderValueBuckets(t *testing.T) {
+    type band struct{ above, upTo int64 }
+    var got []band
+    for _, bucket := range newOrderValueBuckets([]int64{1000, 5000}) {
+        b := band{above: -1, upTo: -1}
+        if bucket.Above != nil {
+            b.above = *bucket.Above
+        }
+        if bucket.UpTo != nil {
+            b.upTo = *bucket.UpTo
+        }
+        got = append(got, b)
+    }
+    want := []band{{above: -1, upTo: 1000}, {above: 1000, upTo: 5000}, {above: 5000, upTo: -1}}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("newOrderValueBuckets() = %v, want %v", got, want)
+    }
+}
+
+// Orders are counted by grand total in the band OrderValueBucket assigns,
+// so orders on a bound fall below it.
+func TestOrderReadModel_GetOrderValueDistribution(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    base := seedOrder(t, rm)
+    // seedOrder's order is worth 3500; the others sit on and next to the
+    // bounds
+    for i, grandTotal := range []int64{1000, 1001, 5000, 5001} {
+        order := *base
+        order.ID = uuid.NewString()
+        order.OrderNumber = ""
+        order.Tags = nil
+        order.TotalAmount = valueobjects.NewMoney(grandTotal-500, "USD")
+        order.GrandTotal = valueobjects.NewMoney(grandTotal, "USD")
+        order.Items = []OrderItemDTO{{ProductID: "product-1", Quantity: 1, Price: valueobjects.NewMoney(grandTotal-500, "USD")}}
+        order.CreatedAt.Time = order.CreatedAt.Add(time.Duration(i+1) * time.Minute)
+        if err := rm.InsertOrder(ctx, &order); err != nil {
+            t.Fatalf("InsertOrder() = %v", err)
+        }
+    }
+    window := timewindow.Window{
+        Period:   timewindow.Custom,
+        From:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+        To:       time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+        Location: time.UTC,
+    }
+    
+    bounds := []int64{1000, 5000}
+    distribution, err := rm.GetOrderValueDistribution(ctx, window, bounds)
+    if err != nil {
+        t.Fatalf("GetOrderValueDistribution() = %v", err)
+    }
+    var counts []int64
+    for _, bucket := range distribution.ByCurrency["USD"] {
+        counts = append(counts, bucket.Count)
+    }
+    if want := []int64{1, 3, 1}; !reflect.DeepEqual(counts, want) {
+        t.Errorf("GetOrderValueDistribution() USD counts = %v, want %v", counts, want)
+    }
+    
+    // No bounds take the defaults
+    distribution, err = rm.GetOrderValueDistribution(ctx, window, nil)
+    if err != nil {
+        t.Fatalf("GetOrderValueDistribution() = %v", err)
+    }
+    if !reflect.DeepEqual(distribution.Bounds, DefaultOrderValueBuckets) || len(distribution.ByCurrency["USD"]) != len(DefaultOrderValueBuckets)+1 {
+        t.Errorf("GetOrderValueDistribution() without bounds = %v, %d bands, want the default bands", distribution.Bounds, len(distribution.ByCurrency["USD"]))
+    }
+    
+    if _, err := rm.GetOrderValueDistribution(ctx, window, []int64{5000, 1000}); !errors.Is(err, ErrInvalidValueBuckets) {
+        t.Errorf("GetOrderValueDistribution() with decreasing bounds = %v, want ErrInvalidValueBuckets", err)
+    }
+}
@@ -0,0 +1,88 @@
+package readmodels
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// ProcessedEventStore remembers the events each projection handled, by
+// event id, so a redelivered event can be recognised and skipped.
+type ProcessedEventStore interface {
+    IsProcessed(ctx context.Context, projection, eventID string) (bool, error)
+    // MarkProcessed records eventID as handled by projection. occurredAt
+    // is when the event occurred, which resets forget events by.
+    MarkProcessed(ctx context.Context, projection, eventID string, occurredAt time.Time) error
+    // ForgetSince forgets the events projection handled that occurred at
+    // or after since, so replaying them applies them again.
+    ForgetSince(ctx context.Context, projection string, since time.Time) (int64, error)
+    // DeleteProcessedBefore forgets every event recorded before cutoff.
+    DeleteProcessedBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryIsEventProcessed      = "processed_events.exists"
+    queryMarkEventProcessed    = "processed_events.insert"
+    queryForgetProcessedEvents = "processed_events.forget"
+    queryDeleteProcessedEvents = "processed_events.delete_before"
+)
+
+type processedEventStore struct {
+    db *sqlmetrics.DB
+}
+
+func NewProcessedEventStore(db *sqlmetrics.DB) ProcessedEventStore {
+    return &processedEventStore{db: db}
+}
+
+func (s *processedEventStore) IsProcessed(ctx context.Context, projection, eventID string) (bool, error) {
+    query := `
+        SELECT EXISTS (
+            SELECT 1 FROM processed_events WHERE projection = $1 AND event_id = $2
+        )
+    `
+    
+    var processed bool
+    if err := s.db.QueryRow(ctx, queryIsEventProcessed, query, projection, eventID).Scan(&processed); err != nil {
+        return false, fmt.Errorf("failed to check processed event: %w", err)
+    }
+    return processed, nil
+}
+
+func (s *processedEventStore) MarkProcessed(ctx context.Context, projection, eventID string, occurredAt time.Time) error {
+    query := `
+        INSERT INTO processed_events (projection, event_id, occurred_at, processed_at)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (projection, event_id) DO NOTHING
+    `
+    
+    _, err := s.db.Exec(ctx, queryMarkEventProcessed, query, projection, eventID, occurredAt.UTC(), clock.Now().UTC())
+    if err != nil {
+        return fmt.Errorf("failed to mark event processed: %w", err)
+    }
+    return nil
+}
+
+func (s *processedEventStore) ForgetSince(ctx context.Context, projection string, since time.Time) (int64, error) {
+    query := `DELETE FROM processed_events WHERE projection = $1 AND occurred_at >= $2`
+    
+    result, err := s.db.Exec(ctx, queryForgetProcessedEvents, query, projection, since.UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to forget processed events: %w", err)
+    }
+    return result.RowsAffected()
+}
+
+func (s *processedEventStore) DeleteProcessedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+    query := `DELETE FROM processed_events WHERE processed_at < $1`
+    
+    result, err := s.db.Exec(ctx, queryDeleteProcessedEvents, query, cutoff.UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete processed events: %w", err)
+    }
+    return result.RowsAffected()
+}
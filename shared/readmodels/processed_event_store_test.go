@@ -0,0 +1,63 @@
+package readmodels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/clock"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// Events are remembered per projection; resets forget them by when they
+// occurred and pruning by when they were recorded.
+func TestProcessedEventStore(t *testing.T) {
+    ctx := context.Background()
+    occurredAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    fake := clock.NewFake(occurredAt.Add(time.Hour))
+    defer clock.Set(fake)()
+    store := NewProcessedEventStore(sqlmetrics.Wrap(schematest.Open(t), 0))
+    
+    processed := func(projection, eventID string) bool {
+        t.Helper()
+        ok, err := store.IsProcessed(ctx, projection, eventID)
+        if err != nil {
+            t.Fatalf("IsProcessed() = %v", err)
+        }
+        return ok
+    }
+    mark := func(eventID string, occurredAt time.Time) {
+        t.Helper()
+        if err := store.MarkProcessed(ctx, "customers", eventID, occurredAt); err != nil {
+            t.Fatalf("MarkProcessed(%s) = %v", eventID, err)
+        }
+    }
+    
+    mark("event-1", occurredAt)
+    // Recording an event twice is not an error
+    mark("event-1", occurredAt)
+    if !processed("customers", "event-1") || processed("orders", "event-1") || processed("customers", "event-2") {
+        t.Fatal("event-1 should be processed by customers only")
+    }
+    
+    fake.Advance(time.Hour)
+    mark("event-2", occurredAt.Add(2*time.Hour))
+    
+    // A reset forgets the events that occurred from its start
+    if forgotten, err := store.ForgetSince(ctx, "customers", occurredAt.Add(time.Hour)); err != nil || forgotten != 1 {
+        t.Fatalf("ForgetSince() = %d, %v, want 1", forgotten, err)
+    }
+    if !processed("customers", "event-1") || processed("customers", "event-2") {
+        t.Error("ForgetSince() should forget event-2 only")
+    }
+    
+    // Pruning goes by when events were recorded
+    mark("event-2", occurredAt.Add(2*time.Hour))
+    if pruned, err := store.DeleteProcessedBefore(ctx, fake.Now().Add(-time.Minute)); err != nil || pruned != 1 {
+        t.Fatalf("DeleteProcessedBefore() = %d, %v, want 1", pruned, err)
+    }
+    if processed("customers", "event-1") || !processed("customers", "event-2") {
+        t.Error("DeleteProcessedBefore() should prune event-1 only")
+    }
+}
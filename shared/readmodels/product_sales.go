@@ -0,0 +1,167 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// ErrProductNotSold is returned for a product no order has ever listed.
+var ErrProductNotSold = errors.New("product does not appear in any order")
+
+// ErrInvalidTimeSeries is returned for a time series with an unknown bucket
+// width, an empty range or too many buckets.
+var ErrInvalidTimeSeries = errors.New("invalid time series")
+
+// MaxTimeSeriesBuckets caps the buckets a time series may be asked for.
+const MaxTimeSeriesBuckets = 1000
+
+// Time series bucket widths
+const (
+    BucketDay   = "day"
+    BucketWeek  = "week"
+    BucketMonth = "month"
+)
+
+// TimeSeriesBuckets returns the starts of the buckets of width bucket
+// covering [from, to), in UTC. The first bucket starts at the start of
+// from's day, ISO week (starting Monday) or month, as Postgres' date_trunc
+// aligns them.
+func TimeSeriesBuckets(bucket string, from, to time.Time) ([]time.Time, error) {
+    from, to = from.UTC(), to.UTC()
+    if !from.Before(to) {
+        return nil, fmt.Errorf("%w: from must be before to", ErrInvalidTimeSeries)
+    }
+    
+    start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+    var next func(time.Time) time.Time
+    switch bucket {
+    case BucketDay:
+        next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+    case BucketWeek:
+        // Weekday counts from Sunday; weeks here start on Monday
+        start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+        next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+    case BucketMonth:
+        start = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+        next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+    default:
+        return nil, fmt.Errorf("%w: unknown bucket %q", ErrInvalidTimeSeries, bucket)
+    }
+    
+    var starts []time.Time
+    for t := start; t.Before(to); t = next(t) {
+        if len(starts) == MaxTimeSeriesBuckets {
+            return nil, fmt.Errorf("%w: at most %d buckets", ErrInvalidTimeSeries, MaxTimeSeriesBuckets)
+        }
+        starts = append(starts, t)
+    }
+    return starts, nil
+}
+
+// ProductSalesTimeSeriesDTO reports the sales of a product over [From, To)
+// in buckets of one day, week or month. Every bucket is listed, including
+// those without sales.
+type ProductSalesTimeSeriesDTO struct {
+    ProductID string                 `json:"product_id"`
+    Bucket    string                 `json:"bucket"`
+    From      apijson.Timestamp      `json:"from"`
+    To        apijson.Timestamp      `json:"to"`
+    Points    []ProductSalesPointDTO `json:"points"`
+}
+
+// ProductSalesPointDTO holds the sales of the bucket starting at Start.
+// Revenue is the product's item revenue by currency, in minor units.
+type ProductSalesPointDTO struct {
+    Start   apijson.Timestamp `json:"start"`
+    Units   int64             `json:"units"`
+    Revenue map[string]int64  `json:"revenue"`
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryProductSold        = "order_read_models.product_sold"
+    queryProductSalesSeries = "order_read_models.product_sales_series"
+)
+
+// GetProductSalesTimeSeries reports the units of productID and their
+// revenue by the day, week or month the orders listing it were created,
+// over [from, to). Cancelled orders are left out whenever they were
+// cancelled, so cancelling an order removes its units from the bucket it
+// was created in rather than from the day of the cancellation; past
+// buckets change as orders are cancelled. Archived orders count too.
+func (rm *orderReadModel) GetProductSalesTimeSeries(ctx context.Context, productID string, from, to time.Time, bucket string) (*ProductSalesTimeSeriesDTO, error) {
+    starts, err := TimeSeriesBuckets(bucket, from, to)
+    if err != nil {
+        return nil, err
+    }
+    
+    // Containment on the generated product_ids column uses its GIN index
+    var sold bool
+    soldQuery := `SELECT EXISTS (SELECT 1 FROM ` + rm.allOrdersTable() + ` WHERE product_ids @> jsonb_build_array($1::text))`
+    if err := rm.db.QueryRow(ctx, queryProductSold, soldQuery, productID).Scan(&sold); err != nil {
+        return nil, fmt.Errorf("failed to look up product: %w", err)
+    }
+    if !sold {
+        return nil, ErrProductNotSold
+    }
+    
+    orders := "order_read_models"
+    if rm.archive {
+        orders = allOrders
+    }
+    
+    // Items stored before unit price currencies were kept are in the
+    // order's currency, as setCurrency assumes
+    query := `
+        SELECT date_trunc($2, o.created_at) AS bucket_start,
+               COALESCE(NULLIF(item.price->>'currency', ''), o.currency) AS currency,
+               SUM(item.quantity),
+               SUM(item.quantity * (item.price->>'amount')::BIGINT)
+        FROM ` + orders + ` AS o
+        CROSS JOIN LATERAL jsonb_to_recordset(o.items) AS item(product_id TEXT, quantity BIGINT, price JSONB)
+        WHERE o.product_ids @> jsonb_build_array($1::text)
+            AND item.product_id = $1
+            AND o.status <> $3
+            AND o.created_at >= $4 AND o.created_at < $5
+        GROUP BY bucket_start, currency
+    `
+    rows, err := rm.db.Query(ctx, queryProductSalesSeries, query, productID, bucket, string(valueobjects.OrderStatusCancelled), from.UTC(), to.UTC())
+    if err != nil {
+        return nil, fmt.Errorf("failed to get product sales: %w", err)
+    }
+    defer rows.Close()
+    
+    series := &ProductSalesTimeSeriesDTO{
+        ProductID: productID,
+        Bucket:    bucket,
+        From:      apijson.NewTimestamp(from),
+        To:        apijson.NewTimestamp(to),
+        Points:    make([]ProductSalesPointDTO, len(starts)),
+    }
+    index := make(map[int64]int, len(starts))
+    for i, start := range starts {
+        series.Points[i] = ProductSalesPointDTO{Start: apijson.NewTimestamp(start), Revenue: make(map[string]int64)}
+        index[start.Unix()] = i
+    }
+    for rows.Next() {
+        var start time.Time
+        var currency string
+        var units, revenue int64
+        if err := rows.Scan(&start, &currency, &units, &revenue); err != nil {
+            return nil, fmt.Errorf("failed to scan product sales: %w", err)
+        }
+        i, ok := index[start.Unix()]
+        if !ok {
+            continue
+        }
+        series.Points[i].Units += units
+        series.Points[i].Revenue[currency] += revenue
+    }
+    
+    return series, rows.Err()
+}
@@ -0,0 +1,61 @@
+package readmodels
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+)
+
+// Cancelling an order takes its units out of the bucket it was created in,
+// not the one it was cancelled in.
+func TestOrderReadModel_GetProductSalesTimeSeries_cancellation(t *testing.T) {
+    ctx := context.Background()
+    rm := newTestOrderReadModel(t)
+    
+    // seedOrder creates an order on March 1 with two units of product-2
+    first := seedOrder(t, rm)
+    second := *first
+    second.ID = uuid.NewString()
+    second.OrderNumber = "ORD-2024-000002"
+    second.Tags = nil
+    created := apijson.NewTimestamp(time.Date(2024, 3, 3, 9, 0, 0, 0, time.UTC))
+    second.StatusChangedAt, second.CreatedAt, second.UpdatedAt = created, created, created
+    if err := rm.InsertOrder(ctx, &second); err != nil {
+        t.Fatalf("InsertOrder() = %v", err)
+    }
+    
+    from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+    to := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+    units := func() []int64 {
+        t.Helper()
+        series, err := rm.GetProductSalesTimeSeries(ctx, "product-2", from, to, BucketDay)
+        if err != nil {
+            t.Fatalf("GetProductSalesTimeSeries() = %v", err)
+        }
+        var units []int64
+        for _, point := range series.Points {
+            units = append(units, point.Units)
+        }
+        return units
+    }
+    
+    if got, want := units(), []int64{2, 0, 2}; !reflect.DeepEqual(got, want) {
+        t.Fatalf("units before the cancellation = %v, want %v", got, want)
+    }
+    
+    // Cancelled on March 3, the day the second order was created
+    cancelledAt := time.Date(2024, 3, 3, 15, 0, 0, 0, time.UTC)
+    change := StatusChange{Status: "cancelled", ChangedAt: cancelledAt, Version: first.Version + 1, EventType: "OrderCancelled", Cancellation: &CancellationDTO{Reason: "customer_request"}}
+    if err := rm.SetStatus(ctx, first.ID, change); err != nil {
+        t.Fatalf("SetStatus() = %v", err)
+    }
+    
+    if got, want := units(), []int64{0, 0, 2}; !reflect.DeepEqual(got, want) {
+        t.Errorf("units after the cancellation = %v, want %v", got, want)
+    }
+}
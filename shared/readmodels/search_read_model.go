@@ -0,0 +1,140 @@
+package readmodels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// SearchReadModel looks orders and customers up by fragments of their ids,
+// emails and names, for support staff pasting partial references.
+type SearchReadModel interface {
+    FindOrdersByIDPrefix(ctx context.Context, prefix string, limit int) ([]SearchHit, error)
+    FindCustomers(ctx context.Context, search CustomerSearch, limit int) ([]SearchHit, error)
+}
+
+// Search hit types.
+const (
+    SearchHitOrder    = "order"
+    SearchHitCustomer = "customer"
+)
+
+// SearchHit is one search result, with a snippet to tell hits apart.
+type SearchHit struct {
+    Type    string `json:"type"`
+    ID      string `json:"id"`
+    Snippet string `json:"snippet"`
+}
+
+// CustomerSearch selects the customers matching any of its non-empty fields.
+type CustomerSearch struct {
+    IDPrefix     string
+    EmailPrefix  string
+    NameContains string
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    querySearchOrders    = "search.orders"
+    querySearchCustomers = "search.customers"
+)
+
+type searchReadModel struct {
+    db *sqlmetrics.DB
+}
+
+func NewSearchReadModel(db *sqlmetrics.DB) SearchReadModel {
+    return &searchReadModel{db: db}
+}
+
+// FindOrdersByIDPrefix matches ids case-insensitively by prefix, using the
+// varchar_pattern_ops index on id.
+func (rm *searchReadModel) FindOrdersByIDPrefix(ctx context.Context, prefix string, limit int) ([]SearchHit, error) {
+    query := `
+        SELECT id, customer_id, status, item_count
+        FROM order_read_models
+        WHERE id LIKE $1 ESCAPE '\'
+        ORDER BY id
+        LIMIT $2
+    `
+    
+    rows, err := rm.db.Query(ctx, querySearchOrders, query, escapeLike(strings.ToLower(prefix))+"%", limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search orders: %w", err)
+    }
+    defer rows.Close()
+    
+    hits := []SearchHit{}
+    for rows.Next() {
+        var id, customerID, status string
+        var itemCount int
+        if err := rows.Scan(&id, &customerID, &status, &itemCount); err != nil {
+            return nil, fmt.Errorf("failed to scan order: %w", err)
+        }
+        hits = append(hits, SearchHit{
+            Type:    SearchHitOrder,
+            ID:      id,
+            Snippet: fmt.Sprintf("%s order with %d items for customer %s", status, itemCount, customerID),
+        })
+    }
+    return hits, rows.Err()
+}
+
+// FindCustomers matches ids and emails by prefix and names by substring,
+// all case-insensitively. The email and name lookups use the pattern and
+// trigram indexes on customer_read_models.
+func (rm *searchReadModel) FindCustomers(ctx context.Context, search CustomerSearch, limit int) ([]SearchHit, error) {
+    var conditions []string
+    var args []interface{}
+    if search.IDPrefix != "" {
+        args = append(args, escapeLike(strings.ToLower(search.IDPrefix))+"%")
+        conditions = append(conditions, fmt.Sprintf(`id LIKE $%d ESCAPE '\'`, len(args)))
+    }
+    if search.EmailPrefix != "" {
+        args = append(args, escapeLike(strings.ToLower(search.EmailPrefix))+"%")
+        conditions = append(conditions, fmt.Sprintf(`lower(email) LIKE $%d ESCAPE '\'`, len(args)))
+    }
+    if search.NameContains != "" {
+        args = append(args, "%"+escapeLike(search.NameContains)+"%")
+        conditions = append(conditions, fmt.Sprintf(`name ILIKE $%d ESCAPE '\'`, len(args)))
+    }
+    if len(conditions) == 0 {
+        return []SearchHit{}, nil
+    }
+    
+    args = append(args, limit)
+    query := fmt.Sprintf(`
+        SELECT id, name, email
+        FROM customer_read_models
+        WHERE %s
+        ORDER BY name, id
+        LIMIT $%d
+    `, strings.Join(conditions, " OR "), len(args))
+    
+    rows, err := rm.db.Query(ctx, querySearchCustomers, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search customers: %w", err)
+    }
+    defer rows.Close()
+    
+    hits := []SearchHit{}
+    for rows.Next() {
+        var id, name, email string
+        if err := rows.Scan(&id, &name, &email); err != nil {
+            return nil, fmt.Errorf("failed to scan customer: %w", err)
+        }
+        hits = append(hits, SearchHit{
+            Type:    SearchHitCustomer,
+            ID:      id,
+            Snippet: fmt.Sprintf("%s <%s>", name, email),
+        })
+    }
+    return hits, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
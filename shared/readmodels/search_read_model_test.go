@@ -0,0 +1,77 @@
+package readmodels
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+func TestSearchReadModel(t *testing.T) {
+    ctx := context.Background()
+    sqlDB := schematest.Open(t)
+    db := sqlmetrics.Wrap(sqlDB, 0)
+    rm := NewSearchReadModel(db)
+    client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+    t.Cleanup(func() { client.Close() })
+    order := seedOrder(t, NewOrderReadModel(db, NewCache(client, CacheConfig{})))
+    
+    now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    customers := []struct{ id, email, name string }{
+        {"7f3a0000-0000-4000-8000-000000000001", "jane.doe@example.com", "Jane Doe"},
+        {"7f3b0000-0000-4000-8000-000000000002", "john@example.com", "John Smith"},
+        {"a1b20000-0000-4000-8000-000000000003", "support_team@example.com", "Dana Janeway"},
+    }
+    for _, c := range customers {
+        _, err := sqlDB.ExecContext(ctx, `INSERT INTO customer_read_models (id, email, name, created_at, updated_at) VALUES ($1, $2, $3, $4, $4)`, c.id, c.email, c.name, now)
+        if err != nil {
+            t.Fatalf("inserting customer: %v", err)
+        }
+    }
+    
+    tests := []struct {
+        name   string
+        search CustomerSearch
+        want   []string
+    }{
+        {name: "id prefix", search: CustomerSearch{IDPrefix: "7F3A"}, want: []string{customers[0].id}},
+        {name: "email prefix", search: CustomerSearch{EmailPrefix: "JOHN@"}, want: []string{customers[1].id}},
+        {name: "name substring", search: CustomerSearch{NameContains: "jane"}, want: []string{customers[2].id, customers[0].id}},
+        // An underscore is matched literally, not as a wildcard
+        {name: "wildcards are literal", search: CustomerSearch{EmailPrefix: "support_"}, want: []string{customers[2].id}},
+        {name: "wildcard finds nothing", search: CustomerSearch{EmailPrefix: "%"}},
+        {name: "nothing to search"},
+    }
+    
+    hits, err := rm.FindOrdersByIDPrefix(ctx, strings.ToUpper(order.ID[:8]), 20)
+    if err != nil {
+        t.Fatalf("FindOrdersByIDPrefix() = %v", err)
+    }
+    want := []SearchHit{{Type: SearchHitOrder, ID: order.ID, Snippet: "confirmed order with 2 items for customer " + order.CustomerID}}
+    if !reflect.DeepEqual(hits, want) {
+        t.Errorf("FindOrdersByIDPrefix() = %+v, want %+v", hits, want)
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            hits, err := rm.FindCustomers(ctx, tt.search, 20)
+            if err != nil {
+                t.Fatalf("FindCustomers() = %v", err)
+            }
+            var ids []string
+            for _, hit := range hits {
+                ids = append(ids, hit.ID)
+            }
+            if !reflect.DeepEqual(ids, tt.want) {
+                t.Errorf("FindCustomers(%+v) = %v, want %v", tt.search, ids, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,215 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// BreachNotShipped is the breach type of a confirmed order not shipped in
+// time.
+const BreachNotShipped = "confirmed_not_shipped"
+
+// SLABreachReadModel records orders that missed a fulfillment deadline. It
+// reads the statuses tracked by the status duration projection, so breaches
+// are detected as soon as that projection has seen the confirmation.
+type SLABreachReadModel interface {
+    // DetectNotShipped records a BreachNotShipped breach for every order
+    // confirmed for longer than shipWithin at now, not counting time on
+    // hold, and returns how many new breaches it recorded. An order
+    // confirmed again after its breach was resolved breaches anew.
+    DetectNotShipped(ctx context.Context, shipWithin time.Duration, now time.Time) (int64, error)
+    // ResolveBreaches closes the open breaches of an order that moved to
+    // status at changedAt. A breach whose deadline had not passed by then
+    // was only detected late and is removed instead.
+    ResolveBreaches(ctx context.Context, orderID, status string, changedAt time.Time) error
+    ListBreaches(ctx context.Context, filter SLABreachFilter, page pagination.Pagination) ([]*SLABreachDTO, error)
+    // CountOpen returns the number of open breaches by breach type.
+    CountOpen(ctx context.Context) (map[string]int64, error)
+}
+
+// SLABreachDTO is an order that missed its deadline. ConfirmedAt is when
+// its shipping clock started: when it was confirmed, moved later by the
+// time it spent on hold since. ResolvedAt and Resolution are set once the
+// order reached the status it was late for, or another status ending the
+// wait.
+type SLABreachDTO struct {
+    OrderID     string             `json:"order_id"`
+    CustomerID  string             `json:"customer_id"`
+    BreachType  string             `json:"breach_type"`
+    ConfirmedAt apijson.Timestamp  `json:"confirmed_at"`
+    DeadlineAt  apijson.Timestamp  `json:"deadline_at"`
+    DetectedAt  apijson.Timestamp  `json:"detected_at"`
+    ResolvedAt  *apijson.Timestamp `json:"resolved_at,omitempty"`
+    Resolution  string             `json:"resolution,omitempty"`
+}
+
+// SLABreachFilter selects breaches; the zero value selects open ones.
+type SLABreachFilter struct {
+    // State is open, resolved or all; empty means open
+    State      string
+    BreachType string
+    CustomerID string
+    // DetectedSince keeps breaches detected at or after it when set
+    DetectedSince time.Time
+}
+
+func (f SLABreachFilter) whereClause() (string, []interface{}) {
+    var conditions []string
+    var args []interface{}
+    
+    switch f.State {
+    case "", "open":
+        conditions = append(conditions, "b.resolved_at IS NULL")
+    case "resolved":
+        conditions = append(conditions, "b.resolved_at IS NOT NULL")
+    }
+    if f.BreachType != "" {
+        args = append(args, f.BreachType)
+        conditions = append(conditions, fmt.Sprintf("b.breach_type = $%d", len(args)))
+    }
+    if f.CustomerID != "" {
+        args = append(args, f.CustomerID)
+        conditions = append(conditions, fmt.Sprintf("o.customer_id = $%d", len(args)))
+    }
+    if !f.DetectedSince.IsZero() {
+        args = append(args, f.DetectedSince.UTC())
+        conditions = append(conditions, fmt.Sprintf("b.detected_at >= $%d", len(args)))
+    }
+    
+    if len(conditions) == 0 {
+        return "", nil
+    }
+    return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryDetectNotShipped  = "order_sla_breaches.detect_not_shipped"
+    queryDiscardLateBreach = "order_sla_breaches.discard"
+    queryResolveBreaches   = "order_sla_breaches.resolve"
+    queryListBreaches      = "order_sla_breaches.list"
+    queryCountOpenBreaches = "order_sla_breaches.count_open"
+)
+
+type slaBreachReadModel struct {
+    db *sqlmetrics.DB
+}
+
+func NewSLABreachReadModel(db *sqlmetrics.DB) SLABreachReadModel {
+    return &slaBreachReadModel{db: db}
+}
+
+func (rm *slaBreachReadModel) DetectNotShipped(ctx context.Context, shipWithin time.Duration, now time.Time) (int64, error) {
+    query := `
+        INSERT INTO order_sla_breaches (order_id, breach_type, confirmed_at, deadline_at, detected_at)
+        SELECT order_id, $1, clock_at, clock_at + $2::float8 * INTERVAL '1 second', $3
+        FROM (
+            SELECT order_id, COALESCE(shipping_clock_at, entered_at) AS clock_at
+            FROM order_current_statuses
+            WHERE status = 'confirmed'
+        ) confirmed
+        WHERE clock_at + $2::float8 * INTERVAL '1 second' < $3
+        ON CONFLICT (order_id, breach_type) DO UPDATE
+        SET confirmed_at = EXCLUDED.confirmed_at, deadline_at = EXCLUDED.deadline_at,
+            detected_at = EXCLUDED.detected_at, resolved_at = NULL, resolution = NULL
+        WHERE order_sla_breaches.resolved_at IS NOT NULL AND order_sla_breaches.resolved_at <= EXCLUDED.confirmed_at
+    `
+    
+    result, err := rm.db.Exec(ctx, queryDetectNotShipped, query, BreachNotShipped, shipWithin.Seconds(), now.UTC())
+    if err != nil {
+        return 0, fmt.Errorf("failed to detect SLA breaches: %w", err)
+    }
+    return result.RowsAffected()
+}
+
+func (rm *slaBreachReadModel) ResolveBreaches(ctx context.Context, orderID, status string, changedAt time.Time) error {
+    query := `DELETE FROM order_sla_breaches WHERE order_id = $1 AND resolved_at IS NULL AND deadline_at >= $2`
+    if _, err := rm.db.Exec(ctx, queryDiscardLateBreach, query, orderID, changedAt.UTC()); err != nil {
+        return fmt.Errorf("failed to discard SLA breaches: %w", err)
+    }
+    
+    query = `
+        UPDATE order_sla_breaches
+        SET resolved_at = $2, resolution = $3
+        WHERE order_id = $1 AND resolved_at IS NULL AND confirmed_at <= $2
+    `
+    if _, err := rm.db.Exec(ctx, queryResolveBreaches, query, orderID, changedAt.UTC(), status); err != nil {
+        return fmt.Errorf("failed to resolve SLA breaches: %w", err)
+    }
+    return nil
+}
+
+func (rm *slaBreachReadModel) ListBreaches(ctx context.Context, filter SLABreachFilter, page pagination.Pagination) ([]*SLABreachDTO, error) {
+    whereClause, args := filter.whereClause()
+    limitClause, limitArgs := page.LimitOffsetClause(len(args) + 1)
+    query := `
+        SELECT b.order_id, COALESCE(o.customer_id, ''), b.breach_type, b.confirmed_at, b.deadline_at, b.detected_at,
+            b.resolved_at, COALESCE(b.resolution, '')
+        FROM order_sla_breaches b
+        LEFT JOIN order_read_models o ON o.id = b.order_id
+        ` + whereClause + `
+        ORDER BY b.deadline_at ASC, b.order_id ASC
+        ` + limitClause
+    
+    args = append(args, limitArgs...)
+    rows, err := rm.db.Query(ctx, queryListBreaches, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query SLA breaches: %w", err)
+    }
+    defer rows.Close()
+    
+    var breaches []*SLABreachDTO
+    for rows.Next() {
+        var breach SLABreachDTO
+        var resolvedAt sql.NullTime
+        err := rows.Scan(
+            &breach.OrderID,
+            &breach.CustomerID,
+            &breach.BreachType,
+            &breach.ConfirmedAt,
+            &breach.DeadlineAt,
+            &breach.DetectedAt,
+            &resolvedAt,
+            &breach.Resolution,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan SLA breach: %w", err)
+        }
+        if resolvedAt.Valid {
+            resolved := apijson.NewTimestamp(resolvedAt.Time)
+            breach.ResolvedAt = &resolved
+        }
+        breaches = append(breaches, &breach)
+    }
+    
+    return breaches, rows.Err()
+}
+
+func (rm *slaBreachReadModel) CountOpen(ctx context.Context) (map[string]int64, error) {
+    query := `SELECT breach_type, COUNT(*) FROM order_sla_breaches WHERE resolved_at IS NULL GROUP BY breach_type`
+    
+    rows, err := rm.db.Query(ctx, queryCountOpenBreaches, query)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count open SLA breaches: %w", err)
+    }
+    defer rows.Close()
+    
+    counts := make(map[string]int64)
+    for rows.Next() {
+        var breachType string
+        var count int64
+        if err := rows.Scan(&breachType, &count); err != nil {
+            return nil, fmt.Errorf("failed to scan open SLA breaches: %w", err)
+        }
+        counts[breachType] = count
+    }
+    
+    return counts, rows.Err()
+}
@@ -0,0 +1,128 @@
+package readmodels
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/pagination"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+func TestSLABreachFilter_whereClause(t *testing.T) {
+    since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name      string
+        filter    SLABreachFilter
+        wantWhere string
+        wantArgs  []interface{}
+    }{
+        {name: "zero", wantWhere: "WHERE b.resolved_at IS NULL"},
+        {name: "resolved", filter: SLABreachFilter{State: "resolved"}, wantWhere: "WHERE b.resolved_at IS NOT NULL"},
+        {name: "all", filter: SLABreachFilter{State: "all"}, wantWhere: ""},
+        {
+            name:      "every filter",
+            filter:    SLABreachFilter{State: "all", BreachType: BreachNotShipped, CustomerID: "customer-1", DetectedSince: since},
+            wantWhere: "WHERE b.breach_type = $1 AND o.customer_id = $2 AND b.detected_at >= $3",
+            wantArgs:  []interface{}{BreachNotShipped, "customer-1", since},
+        },
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            where, args := tt.filter.whereClause()
+            if where != tt.wantWhere || !reflect.DeepEqual(args, tt.wantArgs) {
+                t.Errorf("whereClause() = %q, %v, want %q, %v", where, args, tt.wantWhere, tt.wantArgs)
+            }
+        })
+    }
+}
+
+// Orders confirmed for longer than the deadline breach it, time on hold not
+// counting; shipping resolves a breach, and a breach detected only after
+// the order had shipped in time is discarded.
+func TestSLABreachReadModel(t *testing.T) {
+    ctx := context.Background()
+    db := sqlmetrics.Wrap(schematest.Open(t), 0)
+    statuses := NewStatusDurationReadModel(db)
+    rm := NewSLABreachReadModel(db)
+    start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+    at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+    const shipWithin = 48 * time.Hour
+    
+    type change struct {
+        status string
+        hours  int
+    }
+    track := func(orderID string, changes ...change) {
+        t.Helper()
+        if err := statuses.TrackOrder(ctx, orderID, "draft", start); err != nil {
+            t.Fatalf("TrackOrder() = %v", err)
+        }
+        for i, change := range changes {
+            if err := statuses.RecordStatusChange(ctx, orderID, change.status, i+2, at(change.hours)); err != nil {
+                t.Fatalf("RecordStatusChange(%s) = %v", change.status, err)
+            }
+        }
+    }
+    late, held, recent := uuid.NewString(), uuid.NewString(), uuid.NewString()
+    track(late, change{"confirmed", 1})
+    // On hold for ten hours, so its deadline moves from hour 49 to 59
+    track(held, change{"confirmed", 1}, change{"on_hold", 2}, change{"confirmed", 12})
+    track(recent, change{"confirmed", 40})
+    
+    detect := func(hours int, want int64) {
+        t.Helper()
+        if detected, err := rm.DetectNotShipped(ctx, shipWithin, at(hours)); err != nil || detected != want {
+            t.Fatalf("DetectNotShipped() at hour %d = %d, %v, want %d", hours, detected, err, want)
+        }
+    }
+    list := func(state string) map[string]string {
+        t.Helper()
+        breaches, err := rm.ListBreaches(ctx, SLABreachFilter{State: state}, pagination.Pagination{Limit: 10})
+        if err != nil {
+            t.Fatalf("ListBreaches(%s) = %v", state, err)
+        }
+        got := make(map[string]string)
+        for _, breach := range breaches {
+            got[breach.OrderID] = breach.DeadlineAt.UTC().Format(time.RFC3339) + " " + breach.Resolution
+        }
+        return got
+    }
+    
+    detect(50, 1)
+    detect(50, 0)
+    if got, want := list("open"), map[string]string{late: at(49).Format(time.RFC3339) + " "}; !reflect.DeepEqual(got, want) {
+        t.Errorf("open breaches at hour 50 = %v, want %v", got, want)
+    }
+    
+    // Shipping resolves the breach; holding would not
+    if err := rm.ResolveBreaches(ctx, late, "shipped", at(51)); err != nil {
+        t.Fatalf("ResolveBreaches() = %v", err)
+    }
+    if counts, err := rm.CountOpen(ctx); err != nil || len(counts) != 0 {
+        t.Errorf("CountOpen() after shipping = %v, %v, want none", counts, err)
+    }
+    if got, want := list("resolved"), map[string]string{late: at(49).Format(time.RFC3339) + " shipped"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("resolved breaches = %v, want %v", got, want)
+    }
+    
+    detect(60, 1)
+    if counts, err := rm.CountOpen(ctx); err != nil || !reflect.DeepEqual(counts, map[string]int64{BreachNotShipped: 1}) {
+        t.Errorf("CountOpen() at hour 60 = %v, %v, want one not shipped", counts, err)
+    }
+    
+    // The recent order shipped at hour 80, within its deadline of hour 88,
+    // but the projection saw it after the evaluator ran at hour 100
+    detect(100, 1)
+    if err := rm.ResolveBreaches(ctx, recent, "shipped", at(80)); err != nil {
+        t.Fatalf("ResolveBreaches() = %v", err)
+    }
+    if got := list("all"); len(got) != 2 || got[recent] != "" {
+        t.Errorf("breaches after the late detection = %v, want the late and held orders'", got)
+    }
+}
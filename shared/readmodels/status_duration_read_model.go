@@ -0,0 +1,148 @@
+package readmodels
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/apijson"
+	"github.com/vdntruong/dddcqrs/shared/infrastructure/sqlmetrics"
+)
+
+// ErrOrderNotTracked is returned when a status change arrives for an order
+// whose creation the status duration projection has not seen yet.
+var ErrOrderNotTracked = errors.New("order status is not tracked")
+
+// StatusDurationReadModel records the status transitions behind the status
+// duration analytics. It tracks each order's current status itself, so the
+// projection writing it does not depend on the order read model.
+type StatusDurationReadModel interface {
+    // TrackOrder starts tracking an order in its initial status.
+    TrackOrder(ctx context.Context, orderID, status string, createdAt time.Time) error
+    // RecordStatusChange moves a tracked order to status, recording the
+    // transition and the time spent in the previous status. Changes at or
+    // below the tracked version are redeliveries and are ignored; a zero
+    // version, from events stored before versions were stamped on them,
+    // follows the tracked one. The order's shipping clock starts when it is
+    // confirmed and stops while it is on hold: releasing it moves the
+    // clock's start later by the time it was held.
+    RecordStatusChange(ctx context.Context, orderID, status string, version int, changedAt time.Time) error
+    // DeleteOrdersCreatedSince stops tracking orders created at or after
+    // since and removes their transitions, so replaying their events
+    // rebuilds them. It returns how many orders were removed.
+    DeleteOrdersCreatedSince(ctx context.Context, since time.Time) (int64, error)
+}
+
+// Statement names recorded by sqlmetrics
+const (
+    queryTrackOrderStatus   = "order_current_statuses.track"
+    queryGetTrackedStatus   = "order_current_statuses.get"
+    querySetTrackedStatus   = "order_current_statuses.set"
+    queryDeleteTrackedSince = "order_current_statuses.delete_since"
+)
+
+type statusDurationReadModel struct {
+    db *sqlmetrics.DB
+}
+
+func NewStatusDurationReadModel(db *sqlmetrics.DB) StatusDurationReadModel {
+    return &statusDurationReadModel{db: db}
+}
+
+func (rm *statusDurationReadModel) TrackOrder(ctx context.Context, orderID, status string, createdAt time.Time) error {
+    query := `
+        INSERT INTO order_current_statuses (order_id, status, entered_at, version, created_at)
+        VALUES ($1, $2, $3, 1, $3)
+        ON CONFLICT (order_id) DO NOTHING
+    `
+    
+    if _, err := rm.db.Exec(ctx, queryTrackOrderStatus, query, orderID, status, createdAt.UTC()); err != nil {
+        return fmt.Errorf("failed to track order status: %w", err)
+    }
+    return nil
+}
+
+// RecordStatusChange locks the order's tracked status for the transaction,
+// so concurrent redeliveries record the transition once.
+func (rm *statusDurationReadModel) RecordStatusChange(ctx context.Context, orderID, status string, version int, changedAt time.Time) error {
+    tx, err := rm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+    
+    var current string
+    var enteredAt time.Time
+    var trackedVersion int
+    var clockAt sql.NullTime
+    query := `SELECT status, entered_at, version, shipping_clock_at FROM order_current_statuses WHERE order_id = $1 FOR UPDATE`
+    err = tx.QueryRow(ctx, queryGetTrackedStatus, query, orderID).Scan(&current, &enteredAt, &trackedVersion, &clockAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return fmt.Errorf("%w: %s", ErrOrderNotTracked, orderID)
+    }
+    if err != nil {
+        return fmt.Errorf("failed to read tracked order status: %w", err)
+    }
+    
+    if version == 0 {
+        version = trackedVersion + 1
+    }
+    if version <= trackedVersion || current == status {
+        return nil
+    }
+    
+    transition := &StatusTransitionDTO{
+        OrderID:                  orderID,
+        FromStatus:               current,
+        ToStatus:                 status,
+        Version:                  version,
+        OccurredAt:               apijson.NewTimestamp(changedAt),
+        DurationInPreviousStatus: changedAt.Sub(enteredAt),
+    }
+    if err := recordStatusTransition(ctx, tx.DB, transition); err != nil {
+        return err
+    }
+    
+    switch {
+    case status == "confirmed" && current == "on_hold" && clockAt.Valid:
+        clockAt.Time = clockAt.Time.Add(changedAt.Sub(enteredAt))
+    case status == "confirmed":
+        clockAt = sql.NullTime{Time: changedAt, Valid: true}
+    case status != "on_hold":
+        clockAt = sql.NullTime{}
+    }
+    
+    query = `UPDATE order_current_statuses SET status = $2, entered_at = $3, version = $4, shipping_clock_at = $5 WHERE order_id = $1`
+    if _, err := tx.Exec(ctx, querySetTrackedStatus, query, orderID, status, changedAt.UTC(), version, nullUTC(clockAt)); err != nil {
+        return fmt.Errorf("failed to update tracked order status: %w", err)
+    }
+    
+    return tx.Commit()
+}
+
+func (rm *statusDurationReadModel) DeleteOrdersCreatedSince(ctx context.Context, since time.Time) (int64, error) {
+    query := `
+        WITH deleted AS (
+            DELETE FROM order_current_statuses WHERE created_at >= $1 RETURNING order_id
+        ), transitions AS (
+            DELETE FROM order_status_transitions WHERE order_id IN (SELECT order_id FROM deleted)
+        )
+        SELECT COUNT(*) FROM deleted
+    `
+    
+    var deleted int64
+    if err := rm.db.QueryRow(ctx, queryDeleteTrackedSince, query, since.UTC()).Scan(&deleted); err != nil {
+        return 0, fmt.Errorf("failed to delete tracked order statuses: %w", err)
+    }
+    return deleted, nil
+}
+
+// nullUTC returns t in UTC, keeping it NULL when it is.
+func nullUTC(t sql.NullTime) sql.NullTime {
+    if t.Valid {
+        t.Time = t.Time.UTC()
+    }
+    return t
+}
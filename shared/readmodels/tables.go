@@ -0,0 +1,25 @@
+package readmodels
+
+// Tables are the tables the read models keep, which the projections of both
+// services write. Schema checks verify them at startup.
+var Tables = []string{
+    "order_read_models",
+    "order_tags",
+    "order_status_transitions",
+    "order_history",
+    "order_current_statuses",
+    "order_sla_breaches",
+    "customer_read_models",
+    "customer_orders",
+    "customer_order_summaries",
+}
+
+// Tables used only by the features needing them: the ProcessedEventStore of
+// deduplicating projections, the BootstrapCheckpointStore, the
+// AnomalyReadModel and order read models created WithArchive.
+const (
+    ProcessedEventsTable      = "processed_events"
+    BootstrapCheckpointsTable = "projection_bootstraps"
+    AnomaliesTable            = "order_anomalies"
+    ArchivedOrdersTable       = "order_read_models_archive"
+)
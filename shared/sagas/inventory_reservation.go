@@ -0,0 +1,105 @@
+// Package sagas holds the process managers reacting to order events on
+// behalf of other services.
+package sagas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/readmodels"
+)
+
+// ErrItemsUnavailable is returned for a confirmation stored before
+// confirmations carried their items when no OrderItemsSource is configured
+// to read them.
+var ErrItemsUnavailable = errors.New("confirmation carries no items and no order source is configured")
+
+// ReservationLine is a quantity of a product to reserve for an order.
+type ReservationLine struct {
+    ProductID string
+    Quantity  int
+}
+
+// Inventory reserves stock for orders. Events are delivered at least once,
+// so Reserve must treat a second reservation for an order as the first.
+type Inventory interface {
+    Reserve(ctx context.Context, orderID string, lines []ReservationLine) error
+}
+
+// OrderItemsSource reads the items of an order, for confirmations stored
+// before they carried them.
+type OrderItemsSource interface {
+    OrderItems(ctx context.Context, orderID string) ([]ReservationLine, error)
+}
+
+// InventoryReservationSaga reserves the stock of each confirmed order from
+// the items its OrderConfirmed event carries. Only confirmations stored
+// before events carried items are looked up in Orders.
+type InventoryReservationSaga struct {
+    Inventory Inventory
+    // Orders reads the items of old confirmations; nil fails them with
+    // ErrItemsUnavailable
+    Orders    OrderItemsSource
+}
+
+// EventTypes lists the events Handle acts on.
+func (s *InventoryReservationSaga) EventTypes() []string {
+    return []string{"OrderConfirmed"}
+}
+
+func (s *InventoryReservationSaga) Handle(ctx context.Context, event events.DomainEvent) error {
+    confirmed, ok := event.(events.OrderConfirmedEvent)
+    if !ok {
+        return nil
+    }
+    
+    lines, err := s.lines(ctx, confirmed)
+    if err != nil {
+        return err
+    }
+    
+    if err := s.Inventory.Reserve(ctx, confirmed.AggregateID(), lines); err != nil {
+        return fmt.Errorf("failed to reserve stock for order %s: %w", confirmed.AggregateID(), err)
+    }
+    return nil
+}
+
+// lines returns the lines to reserve for a confirmation, from its items,
+// or from Orders for an old confirmation carrying none.
+func (s *InventoryReservationSaga) lines(ctx context.Context, confirmed events.OrderConfirmedEvent) ([]ReservationLine, error) {
+    if confirmed.HasItems() {
+        lines := make([]ReservationLine, len(confirmed.Items))
+        for i, item := range confirmed.Items {
+            lines[i] = ReservationLine{ProductID: item.ProductID, Quantity: item.Quantity}
+        }
+        return lines, nil
+    }
+    
+    if s.Orders == nil {
+        return nil, fmt.Errorf("order %s: %w", confirmed.AggregateID(), ErrItemsUnavailable)
+    }
+    lines, err := s.Orders.OrderItems(ctx, confirmed.AggregateID())
+    if err != nil {
+        return nil, fmt.Errorf("failed to read the items of order %s: %w", confirmed.AggregateID(), err)
+    }
+    return lines, nil
+}
+
+// ReadModelItems is an OrderItemsSource reading the order read model.
+type ReadModelItems struct {
+    ReadModel readmodels.OrderReadModel
+}
+
+func (r ReadModelItems) OrderItems(ctx context.Context, orderID string) ([]ReservationLine, error) {
+    order, err := r.ReadModel.GetOrder(ctx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    lines := make([]ReservationLine, len(order.Items))
+    for i, item := range order.Items {
+        lines[i] = ReservationLine{ProductID: item.ProductID, Quantity: item.Quantity}
+    }
+    return lines, nil
+}
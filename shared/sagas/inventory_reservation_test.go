@@ -0,0 +1,104 @@
+package sagas
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/domain/events"
+	"github.com/vdntruong/dddcqrs/shared/domain/valueobjects"
+)
+
+// inventory records the reservations asked of it, failing with err when it
+// is set.
+type inventory struct {
+    reserved map[string][]ReservationLine
+    err      error
+}
+
+func (i *inventory) Reserve(_ context.Context, orderID string, lines []ReservationLine) error {
+    if i.err != nil {
+        return i.err
+    }
+    i.reserved[orderID] = lines
+    return nil
+}
+
+// orderItems serves the items of orders, counting the lookups.
+type orderItems struct {
+    items   map[string][]ReservationLine
+    lookups int
+}
+
+func (o *orderItems) OrderItems(_ context.Context, orderID string) ([]ReservationLine, error) {
+    o.lookups++
+    items, ok := o.items[orderID]
+    if !ok {
+        return nil, errors.New("order not found")
+    }
+    return items, nil
+}
+
+func confirmation(items ...events.OrderItemData) events.OrderConfirmedEvent {
+    return events.OrderConfirmedEvent{
+        BaseDomainEvent: events.BaseDomainEvent{EventType: "OrderConfirmed", AggregateIDValue: "order-1"},
+        CustomerID:      "customer-1",
+        Items:           items,
+    }
+}
+
+func TestInventoryReservationSaga_Handle(t *testing.T) {
+    errOutOfStock := errors.New("out of stock")
+    stored := map[string][]ReservationLine{"order-1": {{ProductID: "product-9", Quantity: 4}}}
+    tests := []struct {
+        name        string
+        event       events.DomainEvent
+        orders      bool
+        reserveErr  error
+        want        []ReservationLine
+        wantLookups int
+        wantErr     error
+    }{
+        {
+            name: "embedded items",
+            event: confirmation(
+                events.OrderItemData{ProductID: "product-1", Quantity: 2, Price: valueobjects.NewMoney(1000, "USD")},
+                events.OrderItemData{ProductID: "product-2", Quantity: 1, Price: valueobjects.NewMoney(500, "USD")},
+            ),
+            orders: true,
+            want:   []ReservationLine{{ProductID: "product-1", Quantity: 2}, {ProductID: "product-2", Quantity: 1}},
+        },
+        {name: "old confirmation reads the order", event: confirmation(), orders: true, want: stored["order-1"], wantLookups: 1},
+        {name: "old confirmation without an order source", event: confirmation(), wantErr: ErrItemsUnavailable},
+        {
+            name:       "reservation fails",
+            event:      confirmation(events.OrderItemData{ProductID: "product-1", Quantity: 2}),
+            reserveErr: errOutOfStock,
+            wantErr:    errOutOfStock,
+        },
+        {name: "other events are ignored", event: events.NewCustomerFirstOrderEvent("customer-1", "order-1")},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            inv := &inventory{reserved: make(map[string][]ReservationLine), err: tt.reserveErr}
+            source := &orderItems{items: stored}
+            saga := &InventoryReservationSaga{Inventory: inv}
+            if tt.orders {
+                saga.Orders = source
+            }
+            
+            err := saga.Handle(context.Background(), tt.event)
+            if !errors.Is(err, tt.wantErr) {
+                t.Fatalf("Handle() = %v, want %v", err, tt.wantErr)
+            }
+            if got := inv.reserved["order-1"]; !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("reserved %+v, want %+v", got, tt.want)
+            }
+            if source.lookups != tt.wantLookups {
+                t.Errorf("%d order lookups, want %d", source.lookups, tt.wantLookups)
+            }
+        })
+    }
+}
@@ -0,0 +1,161 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// CheckMode picks what a service does about a database schema missing
+// tables or columns it needs.
+type CheckMode string
+
+const (
+    // CheckOff skips the check
+    CheckOff     CheckMode = "off"
+    // CheckWarn logs what is missing and starts anyway, turning off the
+    // optional features whose tables are missing
+    CheckWarn    CheckMode = "warn"
+    // CheckEnforce logs what is missing and refuses to start
+    CheckEnforce CheckMode = "enforce"
+)
+
+// ParseCheckMode parses the SCHEMA_CHECK setting.
+func ParseCheckMode(value string) (CheckMode, error) {
+    switch mode := CheckMode(value); mode {
+    case CheckOff, CheckWarn, CheckEnforce:
+        return mode, nil
+    default:
+        return "", fmt.Errorf("invalid schema check mode %q: must be off, warn or enforce", value)
+    }
+}
+
+// Missing is a table, or a column of a table, missing from the database.
+type Missing struct {
+    Table  string
+    // Column is empty when the whole table is missing
+    Column string
+}
+
+func (m Missing) String() string {
+    if m.Column == "" {
+        return "table " + m.Table
+    }
+    return "column " + m.Table + "." + m.Column
+}
+
+// MismatchError lists what a database is missing.
+type MismatchError struct {
+    Missing []Missing
+}
+
+func (e *MismatchError) Error() string {
+    names := make([]string, len(e.Missing))
+    for i, missing := range e.Missing {
+        names[i] = missing.String()
+    }
+    return fmt.Sprintf("database schema is missing %d objects: %s", len(e.Missing), strings.Join(names, ", "))
+}
+
+// MissingAny reports whether e lists any of tables, or any of their
+// columns, as missing.
+func (e *MismatchError) MissingAny(tables ...string) bool {
+    for _, missing := range e.Missing {
+        for _, table := range tables {
+            if missing.Table == table {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// Verify checks that every table and column in expected exists in the
+// schemas on db's search path. It returns a *MismatchError listing those
+// that do not, sorted by table and column.
+func Verify(ctx context.Context, db *sql.DB, expected Tables) error {
+    rows, err := db.QueryContext(ctx, `
+        SELECT table_name, column_name
+        FROM information_schema.columns
+        WHERE table_schema = ANY(current_schemas(false))
+    `)
+    if err != nil {
+        return fmt.Errorf("failed to read database schema: %w", err)
+    }
+    defer rows.Close()
+    
+    actual := map[string]map[string]bool{}
+    for rows.Next() {
+        var table, column string
+        if err := rows.Scan(&table, &column); err != nil {
+            return fmt.Errorf("failed to read database schema: %w", err)
+        }
+        if actual[table] == nil {
+            actual[table] = map[string]bool{}
+        }
+        actual[table][column] = true
+    }
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("failed to read database schema: %w", err)
+    }
+    
+    if missing := compare(expected, actual); len(missing) > 0 {
+        return &MismatchError{Missing: missing}
+    }
+    return nil
+}
+
+// compare lists what of expected actual lacks.
+func compare(expected Tables, actual map[string]map[string]bool) []Missing {
+    var missing []Missing
+    for table, columns := range expected {
+        present, ok := actual[table]
+        if !ok {
+            missing = append(missing, Missing{Table: table})
+            continue
+        }
+        for _, column := range columns {
+            if !present[column] {
+                missing = append(missing, Missing{Table: table, Column: column})
+            }
+        }
+    }
+    sort.Slice(missing, func(i, j int) bool {
+        if missing[i].Table != missing[j].Table {
+            return missing[i].Table < missing[j].Table
+        }
+        return missing[i].Column < missing[j].Column
+    })
+    return missing
+}
+
+// Check verifies expected on db as mode asks, logging each missing table
+// and column. It returns the *MismatchError only in CheckEnforce mode, and
+// errors reading the schema in either mode; in CheckWarn mode the caller
+// gets the mismatch, if any, to turn features off with.
+func Check(ctx context.Context, db *sql.DB, expected Tables, mode CheckMode) (*MismatchError, error) {
+    if mode == CheckOff || mode == "" {
+        return nil, nil
+    }
+    
+    var mismatch *MismatchError
+    if err := Verify(ctx, db, expected); err != nil && !errors.As(err, &mismatch) {
+        return nil, err
+    }
+    if mismatch == nil {
+        log.Printf("Database schema has the %d tables this service needs", len(expected))
+        return nil, nil
+    }
+    
+    for _, missing := range mismatch.Missing {
+        log.Printf("Database schema is missing %s; apply shared/schema/migrations", missing)
+    }
+    if mode == CheckEnforce {
+        return nil, mismatch
+    }
+    return mismatch, nil
+}
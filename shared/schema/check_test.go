@@ -0,0 +1,156 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCheckMode(t *testing.T) {
+    tests := []struct {
+        value   string
+        want    CheckMode
+        wantErr bool
+    }{
+        {value: "off", want: CheckOff},
+        {value: "warn", want: CheckWarn},
+        {value: "enforce", want: CheckEnforce},
+        {value: "", wantErr: true},
+        {value: "strict", wantErr: true},
+    }
+    
+    for _, tt := range tests {
+        t.Run(tt.value, func(t *testing.T) {
+            got, err := ParseCheckMode(tt.value)
+            if (err != nil) != tt.wantErr || got != tt.want {
+                t.Errorf("ParseCheckMode(%q) = %q, %v, want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+            }
+        })
+    }
+}
+
+// compare lists missing tables once, not column by column, and missing
+// columns of the tables that exist, sorted either way; extra tables and
+// columns are fine.
+func TestCompare(t *testing.T) {
+    expected := Tables{
+        "orders":          {"id", "status", "order_number"},
+        "order_history":   {"order_id", "event_type"},
+        "order_anomalies": {"order_id"},
+    }
+    actual := map[string]map[string]bool{
+        "orders":        {"id": true, "status": true, "notes": true},
+        "order_history": {"order_id": true},
+        "customers":     {"id": true},
+    }
+    
+    want := []Missing{
+        {Table: "order_anomalies"},
+        {Table: "order_history", Column: "event_type"},
+        {Table: "orders", Column: "order_number"},
+    }
+    if got := compare(expected, actual); !reflect.DeepEqual(got, want) {
+        t.Errorf("compare() = %v, want %v", got, want)
+    }
+    
+    actual["order_history"]["event_type"] = true
+    actual["orders"]["order_number"] = true
+    actual["order_anomalies"] = map[string]bool{"order_id": true}
+    if got := compare(expected, actual); len(got) != 0 {
+        t.Errorf("compare() of a complete schema = %v, want nothing", got)
+    }
+}
+
+func TestMismatchError(t *testing.T) {
+    err := &MismatchError{Missing: []Missing{
+        {Table: "order_anomalies"},
+        {Table: "orders", Column: "order_number"},
+    }}
+    
+    want := "database schema is missing 2 objects: table order_anomalies, column orders.order_number"
+    if got := err.Error(); got != want {
+        t.Errorf("Error() = %q, want %q", got, want)
+    }
+    
+    tests := []struct {
+        tables []string
+        want   bool
+    }{
+        {tables: []string{"order_anomalies"}, want: true},
+        {tables: []string{"customer_merges", "orders"}, want: true},
+        {tables: []string{"order_history"}, want: false},
+        {want: false},
+    }
+    for _, tt := range tests {
+        if got := err.MissingAny(tt.tables...); got != tt.want {
+            t.Errorf("MissingAny(%v) = %v, want %v", tt.tables, got, tt.want)
+        }
+    }
+}
+
+// Parse follows a table through the statements the migrations use, leaving
+// out constraints, indexes and DO blocks.
+func TestParse(t *testing.T) {
+    ddl := `
+        -- The orders table; CREATE TABLE ignored (x INT) here
+        CREATE TABLE IF NOT EXISTS orders (
+            id UUID PRIMARY KEY,
+            status VARCHAR(20) NOT NULL CHECK (status IN ('draft', 'confirmed')),
+            total NUMERIC(12, 2),
+            legacy TEXT,
+            UNIQUE (id, status),
+            CONSTRAINT orders_total CHECK (total >= 0)
+        );
+        CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+        CREATE TABLE scratch (id INT);
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS order_number VARCHAR(32), DROP COLUMN legacy;
+        ALTER TABLE orders RENAME COLUMN total TO total_amount;
+        ALTER TABLE IF EXISTS scratch RENAME TO workspace;
+        DO $$ BEGIN ALTER TABLE orders ADD COLUMN ignored INT; END $$;
+        DROP TABLE IF EXISTS missing;
+        CREATE TABLE gone (id INT);
+        DROP TABLE gone;
+    `
+    
+    want := Tables{
+        "orders":    {"id", "status", "order_number", "total_amount"},
+        "workspace": {"id"},
+    }
+    if got := Parse(ddl); !reflect.DeepEqual(got, want) {
+        t.Errorf("Parse() = %v, want %v", got, want)
+    }
+}
+
+func TestTables_Select(t *testing.T) {
+    tables := Tables{"orders": {"id"}, "order_history": {"order_id"}}
+    
+    selected, err := tables.Select("orders")
+    if err != nil || !reflect.DeepEqual(selected, Tables{"orders": {"id"}}) {
+        t.Errorf("Select(orders) = %v, %v, want only orders", selected, err)
+    }
+    if _, err := tables.Select("orders", "order_anomalies"); err == nil || !strings.Contains(err.Error(), "order_anomalies") {
+        t.Errorf("Select(order_anomalies) = %v, want an error naming the table", err)
+    }
+}
+
+// Expected hands out copies, so callers merging into or trimming what they
+// get cannot change what the next caller sees.
+func TestExpected_copies(t *testing.T) {
+    first, err := Expected()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !contains(first["order_read_models"], "projected_at") {
+        t.Fatalf("Expected() order_read_models = %v, want projected_at", first["order_read_models"])
+    }
+    delete(first, "orders")
+    first["order_read_models"][0] = "renamed"
+    
+    second, err := Expected()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := second["orders"]; !ok || second["order_read_models"][0] == "renamed" {
+        t.Errorf("Expected() changed by an earlier caller: %v", second)
+    }
+}
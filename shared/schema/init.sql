@@ -0,0 +1,301 @@
+-- Create database tables for CQRS implementation
+
+-- Trigram indexes back the substring search over customer names
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Orders table (Command side)
+CREATE TABLE IF NOT EXISTS orders (
+    id VARCHAR(255) PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    previous_status VARCHAR(50) NOT NULL DEFAULT '',
+    total_amount BIGINT NOT NULL,
+    shipping_cost BIGINT NOT NULL DEFAULT 0,
+    grand_total BIGINT NOT NULL DEFAULT 0,
+    shipping_address JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP,
+    -- Sales channel; 'unknown' for orders from before channels were recorded
+    channel VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    -- Human-readable number, such as ORD-2024-000123; NULL for orders from
+    -- before numbers were given
+    order_number VARCHAR(32),
+    -- Contact email of guest checkouts, whose customer_id is empty; NULL
+    -- when the order has none
+    contact_email VARCHAR(254),
+    -- When the order shipped and was delivered, and who signed for it;
+    -- NULL until then, and for orders from before they were recorded
+    shipped_at TIMESTAMP,
+    delivered_at TIMESTAMP,
+    signed_by VARCHAR(255),
+    -- Why the order is on hold; NULL unless it is
+    hold_reason TEXT
+);
+
+-- Order items table
+CREATE TABLE IF NOT EXISTS order_items (
+    id SERIAL PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    product_id VARCHAR(255) NOT NULL,
+    quantity INTEGER NOT NULL,
+    price_amount BIGINT NOT NULL,
+    price_currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Event store table
+CREATE TABLE IF NOT EXISTS events (
+    id SERIAL PRIMARY KEY,
+    aggregate_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    event_data JSONB NOT NULL,
+    version INTEGER NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(aggregate_id, version)
+);
+
+-- Customers merged into another (Command side); the source takes no new
+-- orders
+CREATE TABLE IF NOT EXISTS customer_merges (
+    source_id VARCHAR(255) PRIMARY KEY,
+    target_id VARCHAR(255) NOT NULL,
+    merged_at TIMESTAMPTZ NOT NULL
+);
+
+-- Outbox tables are created by each service at startup from
+-- shared/infrastructure/outbox/schema.sql
+
+-- Read models table (Query side)
+CREATE TABLE IF NOT EXISTS order_read_models (
+    id VARCHAR(255) PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    total_amount BIGINT NOT NULL,
+    shipping_cost BIGINT NOT NULL DEFAULT 0,
+    grand_total BIGINT NOT NULL DEFAULT 0,
+    -- Currency of the three totals above, that of the order's items
+    currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    shipping_address JSONB NOT NULL,
+    items JSONB NOT NULL,
+    item_count INTEGER GENERATED ALWAYS AS (jsonb_array_length(items)) STORED,
+    product_ids JSONB GENERATED ALWAYS AS (jsonb_path_query_array(items, '$[*].product_id')) STORED,
+    version INTEGER NOT NULL DEFAULT 0,
+    status_changed_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    channel VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    order_number VARCHAR(32),
+    last_event_type VARCHAR(100),
+    projected_at TIMESTAMP,
+    contact_email VARCHAR(254),
+    -- Delivery details of delivered orders; NULL until then
+    delivery JSONB,
+    -- Reason code and details of cancelled orders; NULL for orders in any
+    -- other status
+    cancellation JSONB
+);
+
+-- Operational labels on orders (Query side), set through the admin API and
+-- never written by the projection
+CREATE TABLE IF NOT EXISTS order_tags (
+    order_id VARCHAR(255) NOT NULL REFERENCES order_read_models(id) ON DELETE CASCADE,
+    tag VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (order_id, tag)
+);
+
+-- Delivered and cancelled orders past the archive age, moved out of
+-- order_read_models with the tags they had (Query side)
+CREATE TABLE IF NOT EXISTS order_read_models_archive (
+    id VARCHAR(255) PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    total_amount BIGINT NOT NULL,
+    shipping_cost BIGINT NOT NULL DEFAULT 0,
+    grand_total BIGINT NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    shipping_address JSONB NOT NULL,
+    items JSONB NOT NULL,
+    item_count INTEGER GENERATED ALWAYS AS (jsonb_array_length(items)) STORED,
+    product_ids JSONB GENERATED ALWAYS AS (jsonb_path_query_array(items, '$[*].product_id')) STORED,
+    version INTEGER NOT NULL DEFAULT 0,
+    status_changed_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    channel VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    order_number VARCHAR(32),
+    last_event_type VARCHAR(100),
+    projected_at TIMESTAMP,
+    contact_email VARCHAR(254),
+    delivery JSONB,
+    cancellation JSONB,
+    tags JSONB NOT NULL DEFAULT '[]',
+    archived_at TIMESTAMP NOT NULL
+);
+
+-- Order status transitions (Query side), duration is in seconds
+CREATE TABLE IF NOT EXISTS order_status_transitions (
+    id SERIAL PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL,
+    from_status VARCHAR(50) NOT NULL,
+    to_status VARCHAR(50) NOT NULL,
+    version INTEGER NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    duration_in_previous_status BIGINT NOT NULL,
+    UNIQUE(order_id, to_status, version)
+);
+
+-- Customer read models
+CREATE TABLE IF NOT EXISTS customer_read_models (
+    id VARCHAR(255) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    addresses JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    -- The customer this one was merged into, and when; NULL unless merged
+    merged_into VARCHAR(255),
+    merged_at TIMESTAMPTZ
+);
+
+-- Order history (Query side), one entry per projected event, ordered by
+-- the event's version in the event store
+CREATE TABLE IF NOT EXISTS order_history (
+    id SERIAL PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    sequence INTEGER NOT NULL DEFAULT 0,
+    details TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMPTZ NOT NULL,
+    UNIQUE(order_id, event_type, occurred_at, sequence)
+);
+
+-- Customer order summaries (Query side)
+CREATE TABLE IF NOT EXISTS customer_order_summaries (
+    customer_id VARCHAR(255) PRIMARY KEY,
+    order_count BIGINT NOT NULL DEFAULT 0,
+    first_order_at TIMESTAMP,
+    last_order_at TIMESTAMP
+);
+
+-- Orders counted by the customer order summaries, recorded by the customer
+-- summary projection independently of order_read_models
+CREATE TABLE IF NOT EXISTS customer_orders (
+    order_id VARCHAR(255) PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Each order's current status as tracked by the status duration projection,
+-- independently of order_read_models
+CREATE TABLE IF NOT EXISTS order_current_statuses (
+    order_id VARCHAR(255) PRIMARY KEY,
+    status VARCHAR(50) NOT NULL,
+    entered_at TIMESTAMPTZ NOT NULL,
+    version INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    -- When the shipping clock of a confirmed or held order started, moved
+    -- later by the time it spent on hold; NULL in other statuses, and for
+    -- orders confirmed before it was recorded
+    shipping_clock_at TIMESTAMPTZ
+);
+
+-- Orders that missed a fulfillment deadline, detected by the SLA evaluator
+-- and resolved by the status duration projection
+CREATE TABLE IF NOT EXISTS order_sla_breaches (
+    order_id VARCHAR(255) NOT NULL,
+    breach_type VARCHAR(50) NOT NULL,
+    confirmed_at TIMESTAMPTZ NOT NULL,
+    deadline_at TIMESTAMPTZ NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ,
+    resolution VARCHAR(50),
+    PRIMARY KEY (order_id, breach_type)
+);
+
+-- Progress of projection bootstraps from the event feed or a snapshot,
+-- by the event position they reached
+CREATE TABLE IF NOT EXISTS projection_bootstraps (
+    name VARCHAR(100) PRIMARY KEY,
+    source VARCHAR(50) NOT NULL,
+    position BIGINT NOT NULL DEFAULT 0,
+    last_stored_at TIMESTAMPTZ,
+    applied BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ
+);
+
+-- Events handled by the projections that skip redelivered events, by
+-- event id
+CREATE TABLE IF NOT EXISTS processed_events (
+    projection VARCHAR(100) NOT NULL,
+    event_id VARCHAR(100) NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (projection, event_id)
+);
+
+-- Anomalies detected in the order flow, such as cancellation rate spikes
+CREATE TABLE IF NOT EXISTS order_anomalies (
+    id SERIAL PRIMARY KEY,
+    anomaly_type VARCHAR(50) NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    baseline DOUBLE PRECISION NOT NULL,
+    count BIGINT NOT NULL,
+    total BIGINT NOT NULL,
+    recovered_at TIMESTAMPTZ
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_order_number ON orders(order_number);
+CREATE INDEX IF NOT EXISTS idx_orders_contact_email ON orders(contact_email, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_items_product_id ON order_items(product_id);
+
+CREATE INDEX IF NOT EXISTS idx_events_aggregate_id ON events(aggregate_id);
+CREATE INDEX IF NOT EXISTS idx_events_event_type ON events(event_type);
+CREATE INDEX IF NOT EXISTS idx_events_occurred_at ON events(occurred_at);
+
+CREATE INDEX IF NOT EXISTS idx_customer_merges_target_id ON customer_merges(target_id);
+
+CREATE INDEX IF NOT EXISTS idx_order_read_models_customer_id ON order_read_models(customer_id);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_status ON order_read_models(status);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_created_at ON order_read_models(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_updated_at ON order_read_models(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_channel ON order_read_models(channel, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_read_models_order_number ON order_read_models(order_number);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_contact_email ON order_read_models(contact_email);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_product_ids ON order_read_models USING GIN (product_ids jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_id_pattern ON order_read_models(id varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archivable ON order_read_models(status_changed_at) WHERE status IN ('delivered', 'cancelled');
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archive_customer_id ON order_read_models_archive(customer_id);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archive_created_at ON order_read_models_archive(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archive_order_number ON order_read_models_archive(order_number);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archive_product_ids ON order_read_models_archive USING GIN (product_ids jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_order_tags_tag ON order_tags(tag);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_transitions_order_id ON order_status_transitions(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_status_transitions_occurred_at ON order_status_transitions(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_customer_orders_customer_id ON customer_orders(customer_id);
+CREATE INDEX IF NOT EXISTS idx_customer_orders_created_at ON customer_orders(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_current_statuses_created_at ON order_current_statuses(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_current_statuses_status ON order_current_statuses(status, entered_at);
+CREATE INDEX IF NOT EXISTS idx_order_sla_breaches_open ON order_sla_breaches(deadline_at) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events(processed_at);
+CREATE INDEX IF NOT EXISTS idx_processed_events_occurred_at ON processed_events(projection, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_order_anomalies_type ON order_anomalies(anomaly_type, detected_at);
+
+CREATE INDEX IF NOT EXISTS idx_customer_read_models_email ON customer_read_models(email);
+CREATE INDEX IF NOT EXISTS idx_customer_read_models_id_pattern ON customer_read_models(id varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_customer_read_models_email_pattern ON customer_read_models(lower(email) varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_customer_read_models_name_trgm ON customer_read_models USING GIN (name gin_trgm_ops);
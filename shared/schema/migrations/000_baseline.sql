@@ -0,0 +1,71 @@
+-- Brings databases created before the numbered migrations were kept up to
+-- the schema 001 starts from: the columns and tables init.sql gained in
+-- that time, which CREATE TABLE IF NOT EXISTS never adds to an existing
+-- database. Tables are created as they were first added; the later
+-- migrations change them from there. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/000_baseline.sql
+
+BEGIN;
+
+-- Order versions and status transitions. Existing orders start at version
+-- 0, so every event still applies to them, and in their current status
+-- since their last update.
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP;
+UPDATE order_read_models SET status_changed_at = updated_at WHERE status_changed_at IS NULL;
+ALTER TABLE order_read_models ALTER COLUMN status_changed_at SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS order_status_transitions (
+    id SERIAL PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL,
+    from_status VARCHAR(50) NOT NULL,
+    to_status VARCHAR(50) NOT NULL,
+    version INTEGER NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    duration_in_previous_status BIGINT NOT NULL,
+    UNIQUE(order_id, to_status, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_transitions_order_id ON order_status_transitions(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_status_transitions_occurred_at ON order_status_transitions(occurred_at);
+
+-- Order history, and the status orders were cancelled from. Orders
+-- cancelled before it was recorded have none, and cannot be reopened.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS previous_status VARCHAR(50) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS order_history (
+    id SERIAL PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMP NOT NULL,
+    UNIQUE(order_id, event_type, occurred_at)
+);
+
+-- Shipping costs. Orders placed before them were charged no shipping, so
+-- their grand total is their total.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_cost BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS grand_total BIGINT NOT NULL DEFAULT 0;
+UPDATE orders SET grand_total = total_amount + shipping_cost WHERE grand_total = 0;
+
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS shipping_cost BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS grand_total BIGINT NOT NULL DEFAULT 0;
+UPDATE order_read_models SET grand_total = total_amount + shipping_cost WHERE grand_total = 0;
+
+-- Order tags, set through the admin API.
+CREATE TABLE IF NOT EXISTS order_tags (
+    order_id VARCHAR(255) NOT NULL REFERENCES order_read_models(id) ON DELETE CASCADE,
+    tag VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (order_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_tags_tag ON order_tags(tag);
+
+-- When orders were confirmed, for the cancellation window. Orders
+-- confirmed before it was recorded have none, and may be cancelled while
+-- confirmed without a window.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMP;
+
+COMMIT;
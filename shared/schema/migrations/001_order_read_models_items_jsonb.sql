@@ -0,0 +1,26 @@
+-- Moves order_read_models.items to JSONB on databases created before it was
+-- one, and adds the generated columns and index used to count items and find
+-- orders by product. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/001_order_read_models_items_jsonb.sql
+
+BEGIN;
+
+-- Convert items stored as text. Empty blobs become an empty list.
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'order_read_models' AND column_name = 'items') <> 'jsonb' THEN
+        ALTER TABLE order_read_models
+            ALTER COLUMN items TYPE JSONB USING COALESCE(NULLIF(btrim(items::text), ''), '[]')::jsonb;
+    END IF;
+END $$;
+
+ALTER TABLE order_read_models
+    ADD COLUMN IF NOT EXISTS item_count INTEGER GENERATED ALWAYS AS (jsonb_array_length(items)) STORED;
+ALTER TABLE order_read_models
+    ADD COLUMN IF NOT EXISTS product_ids JSONB GENERATED ALWAYS AS (jsonb_path_query_array(items, '$[*].product_id')) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_order_read_models_product_ids ON order_read_models USING GIN (product_ids jsonb_path_ops);
+
+COMMIT;
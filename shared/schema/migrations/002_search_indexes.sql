@@ -0,0 +1,12 @@
+-- Adds the indexes behind GET /api/v1/search in the reporting service: id
+-- and email prefix matches, and substring matches over customer names. Safe
+-- to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/002_search_indexes.sql
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_order_read_models_id_pattern ON order_read_models(id varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_customer_read_models_id_pattern ON customer_read_models(id varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_customer_read_models_email_pattern ON customer_read_models(lower(email) varchar_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_customer_read_models_name_trgm ON customer_read_models USING GIN (name gin_trgm_ops);
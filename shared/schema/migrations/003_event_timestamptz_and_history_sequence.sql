@@ -0,0 +1,34 @@
+-- Stores event timestamps as TIMESTAMPTZ, reading existing values as UTC,
+-- and orders the reporting service's order history by each event's version
+-- in the event store. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/003_event_timestamptz_and_history_sequence.sql
+
+BEGIN;
+
+-- Convert only columns still without a time zone; converting a TIMESTAMPTZ
+-- column again would shift it by the session's offset
+DO $$
+DECLARE
+    col RECORD;
+BEGIN
+    FOR col IN
+        SELECT table_name, column_name FROM information_schema.columns
+        WHERE data_type = 'timestamp without time zone'
+          AND (table_name, column_name) IN (
+              ('events', 'occurred_at'),
+              ('events', 'created_at'),
+              ('order_status_transitions', 'occurred_at'),
+              ('order_history', 'occurred_at'))
+    LOOP
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE TIMESTAMPTZ USING %I AT TIME ZONE ''UTC''',
+            col.table_name, col.column_name, col.column_name);
+    END LOOP;
+END $$;
+
+ALTER TABLE order_history ADD COLUMN IF NOT EXISTS sequence INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_history DROP CONSTRAINT IF EXISTS order_history_order_id_event_type_occurred_at_key;
+CREATE UNIQUE INDEX IF NOT EXISTS order_history_order_id_event_type_occurred_at_sequence_key
+    ON order_history(order_id, event_type, occurred_at, sequence);
+
+COMMIT;
@@ -0,0 +1,39 @@
+-- Gives the customer summary and status duration projections state of their
+-- own, so they consume under their own consumer groups instead of reading
+-- order_read_models. Both tables are backfilled from order_read_models, and
+-- the new groups skip the events already reflected in them. Safe to run more
+-- than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/004_independent_projections.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS customer_orders (
+    order_id VARCHAR(255) PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS order_current_statuses (
+    order_id VARCHAR(255) PRIMARY KEY,
+    status VARCHAR(50) NOT NULL,
+    entered_at TIMESTAMPTZ NOT NULL,
+    version INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_orders_customer_id ON customer_orders(customer_id);
+CREATE INDEX IF NOT EXISTS idx_customer_orders_created_at ON customer_orders(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_current_statuses_created_at ON order_current_statuses(created_at);
+
+INSERT INTO customer_orders (order_id, customer_id, created_at)
+SELECT id, customer_id, created_at FROM order_read_models
+ON CONFLICT (order_id) DO NOTHING;
+
+-- order_read_models stores UTC without a time zone
+INSERT INTO order_current_statuses (order_id, status, entered_at, version, created_at)
+SELECT id, status, status_changed_at AT TIME ZONE 'UTC', version, created_at AT TIME ZONE 'UTC'
+FROM order_read_models
+ON CONFLICT (order_id) DO NOTHING;
+
+COMMIT;
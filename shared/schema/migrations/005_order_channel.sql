@@ -0,0 +1,15 @@
+-- Records the sales channel of each order, on the command side's orders and
+-- in the reporting read model, for filtering and analytics by channel.
+-- Existing orders were placed before channels were recorded and get
+-- 'unknown'. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/005_order_channel.sql
+
+BEGIN;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS channel VARCHAR(20) NOT NULL DEFAULT 'unknown';
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS channel VARCHAR(20) NOT NULL DEFAULT 'unknown';
+
+CREATE INDEX IF NOT EXISTS idx_order_read_models_channel ON order_read_models(channel, created_at);
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Records orders that missed a fulfillment deadline, such as confirmed
+-- orders not shipped within 48 hours. Rows are written by the reporting
+-- service's SLA evaluator from order_current_statuses and resolved by the
+-- status-durations projection. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/006_order_sla_breaches.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS order_sla_breaches (
+    order_id VARCHAR(255) NOT NULL,
+    breach_type VARCHAR(50) NOT NULL,
+    confirmed_at TIMESTAMPTZ NOT NULL,
+    deadline_at TIMESTAMPTZ NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ,
+    resolution VARCHAR(50),
+    PRIMARY KEY (order_id, breach_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_sla_breaches_open ON order_sla_breaches(deadline_at) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_order_current_statuses_status ON order_current_statuses(status, entered_at);
+
+COMMIT;
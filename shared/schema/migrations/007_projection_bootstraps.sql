@@ -0,0 +1,21 @@
+-- Records the progress of a reporting deployment's bootstrap, which
+-- projects the history from the management service's event feed or a
+-- snapshot file before consuming events from the broker. Safe to run more
+-- than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/007_projection_bootstraps.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS projection_bootstraps (
+    name VARCHAR(100) PRIMARY KEY,
+    source VARCHAR(50) NOT NULL,
+    position BIGINT NOT NULL DEFAULT 0,
+    last_stored_at TIMESTAMPTZ,
+    applied BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ
+);
+
+COMMIT;
@@ -0,0 +1,20 @@
+-- Records the events each reporting projection handled, for projections
+-- that skip redelivered events by event id. Rows are deleted once older
+-- than the retention. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/008_processed_events.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS processed_events (
+    projection VARCHAR(100) NOT NULL,
+    event_id VARCHAR(100) NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (projection, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events(processed_at);
+CREATE INDEX IF NOT EXISTS idx_processed_events_occurred_at ON processed_events(projection, occurred_at);
+
+COMMIT;
@@ -0,0 +1,7 @@
+-- Indexes order read models by their update time, for the reporting
+-- service's incremental order feed, GET /api/v1/orders/changes. Safe to run
+-- more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/009_order_read_models_updated_at.sql
+
+CREATE INDEX IF NOT EXISTS idx_order_read_models_updated_at ON order_read_models(updated_at, id);
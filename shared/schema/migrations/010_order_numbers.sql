@@ -0,0 +1,18 @@
+-- Adds the human-readable order numbers, such as ORD-2024-000123, to the
+-- command side's orders and to the reporting read model, unique in both so
+-- a duplicate number is refused and retried with another. Existing orders
+-- keep a NULL number. The per-year sequences the numbers are drawn from are
+-- created by the management service on first use. Safe to run more than
+-- once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/010_order_numbers.sql
+
+BEGIN;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS order_number VARCHAR(32);
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS order_number VARCHAR(32);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_order_number ON orders(order_number);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_read_models_order_number ON order_read_models(order_number);
+
+COMMIT;
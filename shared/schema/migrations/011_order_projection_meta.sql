@@ -0,0 +1,13 @@
+-- Records on each read model row the type of the last event projected onto
+-- it and when the projection wrote it, returned by GET /api/v1/orders/{id}
+-- with ?include=meta. Existing rows keep NULLs until their next event. Safe
+-- to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/011_order_projection_meta.sql
+
+BEGIN;
+
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS last_event_type VARCHAR(100);
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS projected_at TIMESTAMP;
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- Adds the contact email guest checkouts carry instead of a customer to the
+-- command side's orders and to the reporting read model, indexed for rate
+-- limiting guest checkouts and for listing orders by contact email. Guest
+-- orders store an empty customer_id; existing orders keep a NULL contact
+-- email. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/012_order_contact_email.sql
+
+BEGIN;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS contact_email VARCHAR(254);
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS contact_email VARCHAR(254);
+
+CREATE INDEX IF NOT EXISTS idx_orders_contact_email ON orders(contact_email, created_at);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_contact_email ON order_read_models(contact_email);
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Adds the table the cancellation anomaly evaluator of the reporting
+-- service records cancellation rate spikes in, indexed for the cooldown
+-- check on the last anomaly of each type. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/013_order_anomalies.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS order_anomalies (
+    id SERIAL PRIMARY KEY,
+    anomaly_type VARCHAR(50) NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    baseline DOUBLE PRECISION NOT NULL,
+    count BIGINT NOT NULL,
+    total BIGINT NOT NULL,
+    recovered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_anomalies_type ON order_anomalies(anomaly_type, detected_at);
+
+COMMIT;
@@ -0,0 +1,16 @@
+-- Records when orders shipped and the details of their delivery: the
+-- command side's orders get the shipment and delivery times and who signed
+-- for the order, which bound the delivery times accepted later, and the
+-- reporting read model gets a delivery section. Orders shipped or
+-- delivered before keep NULLs. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/014_order_deliveries.sql
+
+BEGIN;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipped_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS signed_by VARCHAR(255);
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS delivery JSONB;
+
+COMMIT;
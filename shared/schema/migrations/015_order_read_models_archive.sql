@@ -0,0 +1,41 @@
+-- Adds the table the reporting service's order archiver moves delivered
+-- and cancelled orders to once they are past the archive age, with the
+-- tags they had, and an index for finding those orders. Safe to run more
+-- than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/015_order_read_models_archive.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS order_read_models_archive (
+    id VARCHAR(255) PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    total_amount BIGINT NOT NULL,
+    shipping_cost BIGINT NOT NULL DEFAULT 0,
+    grand_total BIGINT NOT NULL DEFAULT 0,
+    shipping_address JSONB NOT NULL,
+    items JSONB NOT NULL,
+    item_count INTEGER GENERATED ALWAYS AS (jsonb_array_length(items)) STORED,
+    product_ids JSONB GENERATED ALWAYS AS (jsonb_path_query_array(items, '$[*].product_id')) STORED,
+    version INTEGER NOT NULL DEFAULT 0,
+    status_changed_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    channel VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    order_number VARCHAR(32),
+    last_event_type VARCHAR(100),
+    projected_at TIMESTAMP,
+    contact_email VARCHAR(254),
+    delivery JSONB,
+    tags JSONB NOT NULL DEFAULT '[]',
+    archived_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archivable ON order_read_models(status_changed_at) WHERE status IN ('delivered', 'cancelled');
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archive_customer_id ON order_read_models_archive(customer_id);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archive_created_at ON order_read_models_archive(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archive_order_number ON order_read_models_archive(order_number);
+CREATE INDEX IF NOT EXISTS idx_order_read_models_archive_product_ids ON order_read_models_archive USING GIN (product_ids jsonb_path_ops);
+
+COMMIT;
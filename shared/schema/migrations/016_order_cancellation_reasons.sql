@@ -0,0 +1,14 @@
+-- Records why orders were cancelled in the reporting read model: a reason
+-- code and optional details, kept with archived orders too. Orders
+-- cancelled before keep NULL, and count as other in the analytics until a
+-- rebuild projects the reasons their events carry. Safe to run more than
+-- once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/016_order_cancellation_reasons.sql
+
+BEGIN;
+
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS cancellation JSONB;
+ALTER TABLE order_read_models_archive ADD COLUMN IF NOT EXISTS cancellation JSONB;
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Supports merging duplicate customers. The command side records each
+-- merge in customer_merges, so the merged customer takes no new orders and
+-- merging again finishes the same merge; the reporting side marks the
+-- merged customer in customer_read_models. Safe to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/017_customer_merges.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS customer_merges (
+    source_id VARCHAR(255) PRIMARY KEY,
+    target_id VARCHAR(255) NOT NULL,
+    merged_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_merges_target_id ON customer_merges(target_id);
+
+ALTER TABLE customer_read_models ADD COLUMN IF NOT EXISTS merged_into VARCHAR(255);
+ALTER TABLE customer_read_models ADD COLUMN IF NOT EXISTS merged_at TIMESTAMPTZ;
+
+COMMIT;
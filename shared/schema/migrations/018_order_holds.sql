@@ -0,0 +1,15 @@
+-- Supports holding orders, as for fraud review. The command side records
+-- why an order is on hold; the status duration projection records when the
+-- shipping clock of a confirmed order started, moved later by the time it
+-- spent on hold, for the SLA evaluator. Orders confirmed before keep NULL
+-- and their clock runs from when they entered the confirmed status. Safe to
+-- run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/018_order_holds.sql
+
+BEGIN;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS hold_reason TEXT;
+ALTER TABLE order_current_statuses ADD COLUMN IF NOT EXISTS shipping_clock_at TIMESTAMPTZ;
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- Adds the table the customer summary projection keeps customers' order
+-- counts in, which init.sql gained without a migration. Summaries are
+-- backfilled from customer_orders, so customers who already ordered derive
+-- no first order event when their next order is projected. Safe to run
+-- more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/019_customer_order_summaries.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS customer_order_summaries (
+    customer_id VARCHAR(255) PRIMARY KEY,
+    order_count BIGINT NOT NULL DEFAULT 0,
+    first_order_at TIMESTAMP,
+    last_order_at TIMESTAMP
+);
+
+INSERT INTO customer_order_summaries (customer_id, order_count, first_order_at, last_order_at)
+SELECT customer_id, COUNT(*), MIN(created_at), MAX(created_at)
+FROM customer_orders
+GROUP BY customer_id
+ON CONFLICT (customer_id) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Keeps the currency of each order's totals in the reporting read model,
+-- which read every order as USD. Orders projected before take the
+-- currency of their first item where it was kept, and USD otherwise. Safe
+-- to run more than once.
+--
+--   psql "$DATABASE_URL" -f shared/schema/migrations/020_order_currency.sql
+
+BEGIN;
+
+ALTER TABLE order_read_models ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE order_read_models_archive ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+
+UPDATE order_read_models
+SET currency = items->0->'price'->>'currency'
+WHERE COALESCE(items->0->'price'->>'currency', '') NOT IN ('', currency);
+
+UPDATE order_read_models_archive
+SET currency = items->0->'price'->>'currency'
+WHERE COALESCE(items->0->'price'->>'currency', '') NOT IN ('', currency);
+
+COMMIT;
@@ -0,0 +1,220 @@
+// Package schema holds the database schema the services expect: init.sql,
+// which creates it on a new database, and the migrations in migrations/,
+// which bring an existing one up to date. Both are embedded, so the checks
+// in this package read the expected tables and columns from the same files
+// that create them.
+package schema
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed init.sql migrations/*.sql
+var files embed.FS
+
+// Tables maps table names to their columns.
+type Tables map[string][]string
+
+var (
+    expectedOnce sync.Once
+    expected     Tables
+    expectedErr  error
+)
+
+// Expected returns the tables and columns init.sql and the migrations
+// create. Outbox tables are created from their own schema; see
+// outbox.Schema.
+func Expected() (Tables, error) {
+    expectedOnce.Do(func() {
+        expected, expectedErr = loadExpected()
+    })
+    return expected.copy(), expectedErr
+}
+
+func loadExpected() (Tables, error) {
+    names := []string{"init.sql"}
+    migrations, err := fs.Glob(files, "migrations/*.sql")
+    if err != nil {
+        return nil, err
+    }
+    // The migrations are numbered, so their names sort in the order they
+    // are applied in
+    sort.Strings(migrations)
+    names = append(names, migrations...)
+    
+    tables := Tables{}
+    for _, name := range names {
+        ddl, err := files.ReadFile(name)
+        if err != nil {
+            return nil, err
+        }
+        tables.apply(string(ddl))
+    }
+    return tables, nil
+}
+
+// InitSQL returns init.sql, which creates the schema on a new database.
+func InitSQL() string {
+    ddl, err := files.ReadFile("init.sql")
+    if err != nil {
+        panic(fmt.Sprintf("schema: init.sql not embedded: %v", err))
+    }
+    return string(ddl)
+}
+
+// Parse returns the tables and columns ddl creates.
+func Parse(ddl string) Tables {
+    tables := Tables{}
+    tables.apply(ddl)
+    return tables
+}
+
+// Select returns the named tables, failing for a name t does not have.
+func (t Tables) Select(names ...string) (Tables, error) {
+    selected := make(Tables, len(names))
+    for _, name := range names {
+        columns, ok := t[name]
+        if !ok {
+            return nil, fmt.Errorf("table %s is not in the schema", name)
+        }
+        selected[name] = columns
+    }
+    return selected, nil
+}
+
+// Merge adds the tables of other to t, replacing any t already has.
+func (t Tables) Merge(other Tables) {
+    for name, columns := range other {
+        t[name] = columns
+    }
+}
+
+func (t Tables) copy() Tables {
+    tables := make(Tables, len(t))
+    for name, columns := range t {
+        tables[name] = append([]string(nil), columns...)
+    }
+    return tables
+}
+
+var (
+    lineComment     = regexp.MustCompile(`--[^\n]*`)
+    dollarQuoted    = regexp.MustCompile(`(?s)\$\$.*?\$\$`)
+    createTable     = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)\s*\((.*)\)$`)
+    dropTable       = regexp.MustCompile(`(?is)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?(\w+)`)
+    alterTable      = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?(\w+)\s+(.*)$`)
+    renameTable     = regexp.MustCompile(`(?is)^RENAME\s+TO\s+(\w+)$`)
+    addColumn       = regexp.MustCompile(`(?is)^ADD\s+COLUMN\s+(?:IF\s+NOT\s+EXISTS\s+)?(\w+)`)
+    dropColumn      = regexp.MustCompile(`(?is)^DROP\s+COLUMN\s+(?:IF\s+EXISTS\s+)?(\w+)`)
+    renameColumn    = regexp.MustCompile(`(?is)^RENAME\s+(?:COLUMN\s+)?(\w+)\s+TO\s+(\w+)$`)
+    tableConstraint = regexp.MustCompile(`(?i)^(PRIMARY|UNIQUE|CONSTRAINT|FOREIGN|CHECK|EXCLUDE|LIKE)\b`)
+)
+
+// apply applies the table and column changes of ddl to t. It understands
+// the statements the schema files use: CREATE TABLE, DROP TABLE and the
+// ADD, DROP and RENAME actions of ALTER TABLE. Anything else, such as
+// indexes or DO blocks, is skipped.
+func (t Tables) apply(ddl string) {
+    ddl = lineComment.ReplaceAllString(ddl, "")
+    ddl = dollarQuoted.ReplaceAllString(ddl, "")
+    
+    for _, statement := range strings.Split(ddl, ";") {
+        statement = strings.TrimSpace(statement)
+        if match := createTable.FindStringSubmatch(statement); match != nil {
+            if _, ok := t[match[1]]; !ok {
+                t[match[1]] = createColumns(match[2])
+            }
+            continue
+        }
+        if match := dropTable.FindStringSubmatch(statement); match != nil {
+            delete(t, match[1])
+            continue
+        }
+        if match := alterTable.FindStringSubmatch(statement); match != nil {
+            t.alter(match[1], match[2])
+        }
+    }
+}
+
+func (t Tables) alter(table, actions string) {
+    for _, action := range splitTopLevel(actions) {
+        switch {
+        case renameTable.MatchString(action):
+            renamed := renameTable.FindStringSubmatch(action)[1]
+            t[renamed] = t[table]
+            delete(t, table)
+            table = renamed
+        case addColumn.MatchString(action):
+            column := addColumn.FindStringSubmatch(action)[1]
+            if !contains(t[table], column) {
+                t[table] = append(t[table], column)
+            }
+        case dropColumn.MatchString(action):
+            column := dropColumn.FindStringSubmatch(action)[1]
+            t[table] = remove(t[table], column)
+        case renameColumn.MatchString(action):
+            match := renameColumn.FindStringSubmatch(action)
+            t[table] = append(remove(t[table], match[1]), match[2])
+        }
+    }
+}
+
+// createColumns returns the columns a CREATE TABLE body defines, leaving
+// out table constraints.
+func createColumns(body string) []string {
+    var columns []string
+    for _, element := range splitTopLevel(body) {
+        if element == "" || tableConstraint.MatchString(element) {
+            continue
+        }
+        columns = append(columns, strings.Fields(element)[0])
+    }
+    return columns
+}
+
+// splitTopLevel splits s at the commas outside parentheses and quotes,
+// trimming each part.
+func splitTopLevel(s string) []string {
+    var parts []string
+    depth, quoted, start := 0, false, 0
+    for i, r := range s {
+        switch {
+        case r == '\'':
+            quoted = !quoted
+        case quoted:
+        case r == '(':
+            depth++
+        case r == ')':
+            depth--
+        case r == ',' && depth == 0:
+            parts = append(parts, strings.TrimSpace(s[start:i]))
+            start = i + 1
+        }
+    }
+    return append(parts, strings.TrimSpace(s[start:]))
+}
+
+func contains(columns []string, column string) bool {
+    for _, c := range columns {
+        if c == column {
+            return true
+        }
+    }
+    return false
+}
+
+func remove(columns []string, column string) []string {
+    kept := columns[:0:0]
+    for _, c := range columns {
+        if c != column {
+            kept = append(kept, c)
+        }
+    }
+    return kept
+}
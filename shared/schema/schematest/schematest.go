@@ -0,0 +1,92 @@
+// Package schematest gives tests a Postgres database with the schema of
+// init.sql. Tests using it are skipped unless TEST_DATABASE_URL names a
+// database they may create schemas in; CI points it at its Postgres
+// service.
+package schematest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"github.com/vdntruong/dddcqrs/shared/schema"
+)
+
+// EnvDatabaseURL names the variable holding the test database's URL.
+const EnvDatabaseURL = "TEST_DATABASE_URL"
+
+// Open returns a connection to the test database whose tables live in a
+// schema of their own, created from init.sql and dropped when t ends, so
+// tests and packages running at the same time never see each other's
+// rows. It skips t when TEST_DATABASE_URL is not set.
+func Open(t testing.TB) *sql.DB {
+    t.Helper()
+    
+    rawURL := os.Getenv(EnvDatabaseURL)
+    if rawURL == "" {
+        t.Skipf("%s not set, skipping Postgres test", EnvDatabaseURL)
+    }
+    ctx := context.Background()
+    
+    admin, err := sql.Open("postgres", rawURL)
+    if err != nil {
+        t.Fatalf("open %s: %v", EnvDatabaseURL, err)
+    }
+    defer admin.Close()
+    
+    name := "test_" + randomHex(t)
+    // Extensions belong to the database, not the schema; created in
+    // public, they outlive the schemas dropped after each test
+    if _, err := admin.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public`); err != nil {
+        t.Fatalf("create pg_trgm: %v", err)
+    }
+    if _, err := admin.ExecContext(ctx, `CREATE SCHEMA `+name); err != nil {
+        t.Fatalf("create schema %s: %v", name, err)
+    }
+    t.Cleanup(func() {
+        admin, err := sql.Open("postgres", rawURL)
+        if err != nil {
+            t.Errorf("open %s: %v", EnvDatabaseURL, err)
+            return
+        }
+        defer admin.Close()
+        if _, err := admin.ExecContext(context.Background(), `DROP SCHEMA `+name+` CASCADE`); err != nil {
+            t.Errorf("drop schema %s: %v", name, err)
+        }
+    })
+    
+    scoped, err := url.Parse(rawURL)
+    if err != nil {
+        t.Fatalf("parse %s: %v", EnvDatabaseURL, err)
+    }
+    query := scoped.Query()
+    // lib/pq sends parameters it does not know as run-time settings
+    query.Set("search_path", name+",public")
+    scoped.RawQuery = query.Encode()
+    
+    db, err := sql.Open("postgres", scoped.String())
+    if err != nil {
+        t.Fatalf("open schema %s: %v", name, err)
+    }
+    t.Cleanup(func() { db.Close() })
+    
+    if _, err := db.ExecContext(ctx, schema.InitSQL()); err != nil {
+        t.Fatalf("apply init.sql: %v", err)
+    }
+    return db
+}
+
+func randomHex(t testing.TB) string {
+    t.Helper()
+    b := make([]byte, 6)
+    if _, err := rand.Read(b); err != nil {
+        t.Fatalf("random schema name: %v", err)
+    }
+    return hex.EncodeToString(b)
+}
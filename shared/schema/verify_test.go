@@ -0,0 +1,87 @@
+package schema_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vdntruong/dddcqrs/shared/schema"
+	"github.com/vdntruong/dddcqrs/shared/schema/schematest"
+)
+
+// A database one migration behind, lacking a column and a table init.sql
+// creates, fails Verify with both listed; Check logs them and, by mode,
+// starts without the features they back, refuses to start or looks away.
+func TestCheck_partiallyMigrated(t *testing.T) {
+    db := schematest.Open(t)
+    ctx := context.Background()
+    expected, err := schema.Expected()
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    if err := schema.Verify(ctx, db, expected); err != nil {
+        t.Fatalf("Verify() of a database created from init.sql = %v", err)
+    }
+    
+    if _, err := db.ExecContext(ctx, `
+        ALTER TABLE order_read_models DROP COLUMN projected_at;
+        DROP TABLE order_anomalies;
+    `); err != nil {
+        t.Fatal(err)
+    }
+    want := []schema.Missing{
+        {Table: "order_anomalies"},
+        {Table: "order_read_models", Column: "projected_at"},
+    }
+    
+    var mismatch *schema.MismatchError
+    if err := schema.Verify(ctx, db, expected); !errors.As(err, &mismatch) || !reflect.DeepEqual(mismatch.Missing, want) {
+        t.Fatalf("Verify() = %v, want %v missing", err, want)
+    }
+    
+    tests := []struct {
+        mode         schema.CheckMode
+        wantMismatch bool
+        wantErr      bool
+        wantLogged   bool
+    }{
+        {mode: schema.CheckOff},
+        {mode: ""},
+        {mode: schema.CheckWarn, wantMismatch: true, wantLogged: true},
+        {mode: schema.CheckEnforce, wantErr: true, wantLogged: true},
+    }
+    for _, tt := range tests {
+        t.Run(string(tt.mode), func(t *testing.T) {
+            var logs bytes.Buffer
+            defer log.SetOutput(log.Writer())
+            log.SetOutput(&logs)
+            
+            mismatch, err := schema.Check(ctx, db, expected, tt.mode)
+            if (mismatch != nil) != tt.wantMismatch || (err != nil) != tt.wantErr {
+                t.Fatalf("Check(%q) = %v, %v, want mismatch %v, error %v", tt.mode, mismatch, err, tt.wantMismatch, tt.wantErr)
+            }
+            if mismatch != nil && !mismatch.MissingAny("order_anomalies") {
+                t.Errorf("Check(%q) mismatch = %v, want order_anomalies missing", tt.mode, mismatch)
+            }
+            for _, missing := range want {
+                if logged := strings.Contains(logs.String(), "missing "+missing.String()); logged != tt.wantLogged {
+                    t.Errorf("Check(%q) logged %s = %v, want %v: %q", tt.mode, missing, logged, tt.wantLogged, logs.String())
+                }
+            }
+        })
+    }
+    
+    // Services checking only the tables they use start cleanly
+    orders, err := expected.Select("orders", "order_items", "events")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if mismatch, err := schema.Check(ctx, db, orders, schema.CheckEnforce); mismatch != nil || err != nil {
+        t.Errorf("Check() of the tables present = %v, %v, want nil", mismatch, err)
+    }
+}